@@ -86,7 +86,7 @@ func cliqueEngine(ctx context.Context, logger log.Logger) error {
 			return err
 		}
 	}
-	server.db = openDB(filepath.Join(datadir, "clique", "db"), logger)
+	server.db = clique.OpenDatabase(filepath.Join(datadir, "clique", "db"), logger, false)
 	server.c = clique.New(server.chainConfig, params.CliqueSnapshot, server.db)
 	<-ctx.Done()
 	return nil
@@ -4,12 +4,9 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/ledgerwatch/erigon-lib/kv"
-	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
 	"github.com/ledgerwatch/erigon/cmd/utils"
 	"github.com/ledgerwatch/erigon/common/paths"
 	"github.com/ledgerwatch/erigon/internal/debug"
-	"github.com/ledgerwatch/log/v3"
 	"github.com/spf13/cobra"
 )
 
@@ -62,7 +59,3 @@ func withApiAddr(cmd *cobra.Command) {
 func withConfig(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&config, "config", "", "`file:<path>` to specify config file in file system, `embed:<path>` to use embedded file, `test` to register test interface and receive config from test driver")
 }
-
-func openDB(path string, logger log.Logger) kv.RwDB {
-	return mdbx.NewMDBX(logger).Path(path).MustOpen()
-}
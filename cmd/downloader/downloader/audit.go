@@ -0,0 +1,128 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// CorruptedFile - snapshot file which content doesn't match piece hashes of its .torrent file
+type CorruptedFile struct {
+	Name      string
+	InfoHash  metainfo.Hash
+	BadPieces []int
+}
+
+// Audit - re-hashes files of all .torrent files in snapshotDir. Only pieces which are marked as complete in
+// completion store are checked - others are not downloaded yet, missing files are skipped for the same reason.
+func Audit(ctx context.Context, snapshotDir string, completion storage.PieceCompletion) ([]CorruptedFile, error) {
+	logEvery := time.NewTicker(20 * time.Second)
+	defer logEvery.Stop()
+
+	var corrupted []CorruptedFile
+	if err := ForEachTorrentFile(snapshotDir, func(torrentFilePath string) error {
+		mi, err := metainfo.LoadFromFile(torrentFilePath)
+		if err != nil {
+			return err
+		}
+		info, err := mi.UnmarshalInfo()
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(filepath.Join(snapshotDir, info.Name))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		defer f.Close()
+
+		file := CorruptedFile{Name: info.Name, InfoHash: mi.HashInfoBytes()}
+		buf := make([]byte, info.PieceLength)
+		for i := 0; i < info.NumPieces(); i++ {
+			c, err := completion.Get(metainfo.PieceKey{InfoHash: file.InfoHash, Index: i})
+			if err != nil {
+				return err
+			}
+			if !c.Complete {
+				continue
+			}
+			if !pieceHashMatch(f, info.Piece(i), buf) {
+				file.BadPieces = append(file.BadPieces, i)
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-logEvery.C:
+				log.Info("[torrent] Auditing snapshots", "file", info.Name, "progress", fmt.Sprintf("%d/%d", i, info.NumPieces()))
+			default:
+			}
+		}
+		if len(file.BadPieces) > 0 {
+			corrupted = append(corrupted, file)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return corrupted, nil
+}
+
+// MarkCorrupted - forget completion of bad pieces, so torrent client downloads them again on next start
+func MarkCorrupted(completion storage.PieceCompletion, corrupted []CorruptedFile) error {
+	for _, file := range corrupted {
+		for _, i := range file.BadPieces {
+			if err := completion.Set(metainfo.PieceKey{InfoHash: file.InfoHash, Index: i}, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AuditLoop - re-hashes snapshots every interval. Bad pieces are re-hashed by torrent client too: it marks
+// them as incomplete and downloads them again (from torrent peers or from web seeds).
+func AuditLoop(ctx context.Context, cli *Client, snapshotDir string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		corrupted, err := Audit(ctx, snapshotDir, cli.pieceCompletionStore)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn("[torrent] Audit failed", "err", err)
+			continue
+		}
+		for _, file := range corrupted {
+			log.Warn("[torrent] Corrupted file, re-downloading bad pieces", "file", file.Name, "pieces", len(file.BadPieces))
+			t, ok := cli.Cli.Torrent(file.InfoHash)
+			if !ok {
+				if err = MarkCorrupted(cli.pieceCompletionStore, []CorruptedFile{file}); err != nil {
+					log.Warn("[torrent] Can't mark corrupted file", "file", file.Name, "err", err)
+				}
+				continue
+			}
+			for _, i := range file.BadPieces {
+				t.Piece(i).VerifyData()
+			}
+		}
+		log.Info("[torrent] Audit done", "corrupted files", len(corrupted))
+	}
+}
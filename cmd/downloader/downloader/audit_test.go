@@ -0,0 +1,54 @@
+package downloader
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	dir := t.TempDir()
+	name := "v1-000000-000500-bodies.seg"
+	data := make([]byte, 10*testPieceSize+100)
+	rand.New(rand.NewSource(1)).Read(data)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0644))
+	info := &metainfo.Info{PieceLength: testPieceSize}
+	require.NoError(t, info.BuildFromFilePath(filepath.Join(dir, name)))
+	require.NoError(t, CreateTorrentFile(dir, info, nil))
+	mi, err := metainfo.LoadFromFile(filepath.Join(dir, name+".torrent"))
+	require.NoError(t, err)
+	infoHash := mi.HashInfoBytes()
+	// .torrent file of not downloaded file is not a corruption
+	require.NoError(t, CreateTorrentFile(dir, &metainfo.Info{Name: "v1-000000-000500-headers.seg", PieceLength: testPieceSize, Length: 1, Pieces: make([]byte, 20)}, nil))
+
+	completion := storage.NewMapPieceCompletion()
+	ctx := context.Background()
+	for i := 0; i < info.NumPieces(); i++ {
+		require.NoError(t, completion.Set(metainfo.PieceKey{InfoHash: infoHash, Index: i}, i != 7))
+	}
+	corrupted, err := Audit(ctx, dir, completion)
+	require.NoError(t, err)
+	require.Empty(t, corrupted)
+
+	// corrupt pieces 3 and 7, piece 7 is not downloaded yet - its content doesn't matter
+	data[3*testPieceSize+5]++
+	data[7*testPieceSize+5]++
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0644))
+	corrupted, err = Audit(ctx, dir, completion)
+	require.NoError(t, err)
+	require.Equal(t, []CorruptedFile{{Name: name, InfoHash: infoHash, BadPieces: []int{3}}}, corrupted)
+
+	require.NoError(t, MarkCorrupted(completion, corrupted))
+	c, err := completion.Get(metainfo.PieceKey{InfoHash: infoHash, Index: 3})
+	require.NoError(t, err)
+	require.False(t, c.Complete)
+	corrupted, err = Audit(ctx, dir, completion)
+	require.NoError(t, err)
+	require.Empty(t, corrupted)
+}
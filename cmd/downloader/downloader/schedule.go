@@ -0,0 +1,329 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/types"
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon/cmd/downloader/downloadergrpc"
+	"github.com/ledgerwatch/erigon/turbo/maintenance"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/log/v3"
+	"golang.org/x/time/rate"
+)
+
+// BandwidthWindow - rate limit which is active inside of window
+type BandwidthWindow struct {
+	maintenance.Window
+	Limit datasize.ByteSize
+}
+
+// BandwidthSchedule - time of day dependent rate limits, first matching window wins.
+// Outside of all windows the base limit is used.
+type BandwidthSchedule []BandwidthWindow
+
+// ParseBandwidthSchedule parses comma separated windows "HH:MM-HH:MM=limit", for example "01:00-07:00=1gb,09:00-18:00=0".
+// Limit 0 pauses transfer during the window.
+func ParseBandwidthSchedule(s string) (BandwidthSchedule, error) {
+	var schedule BandwidthSchedule
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		eq := strings.LastIndexByte(item, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("bandwidth window %q: expected format HH:MM-HH:MM=limit", item)
+		}
+		var w BandwidthWindow
+		var err error
+		if w.Window, err = maintenance.ParseWindow(item[:eq]); err != nil {
+			return nil, fmt.Errorf("bandwidth window %q: %w", item, err)
+		}
+		if err = w.Limit.UnmarshalText([]byte(item[eq+1:])); err != nil {
+			return nil, fmt.Errorf("bandwidth window %q: %w", item, err)
+		}
+		schedule = append(schedule, w)
+	}
+	return schedule, nil
+}
+
+// Limit - rate limit at moment now
+func (s BandwidthSchedule) Limit(now time.Time, base datasize.ByteSize) datasize.ByteSize {
+	for _, w := range s {
+		if w.Contains(now) {
+			return w.Limit
+		}
+	}
+	return base
+}
+
+func (s BandwidthSchedule) String() string {
+	items := make([]string, len(s))
+	for i, w := range s {
+		items[i] = w.Window.String() + "=" + w.Limit.String()
+	}
+	return strings.Join(items, ",")
+}
+
+// Bandwidth - applies base rate limits and schedules to rate limiters of torrent client. If weights are set, limits
+// are shared with other processes by weights of their classes (see BandwidthWeights).
+// All settings can be changed at runtime.
+type Bandwidth struct {
+	download, upload *rate.Limiter
+
+	lock                             sync.Mutex
+	downloadLimit, uploadLimit       datasize.ByteSize
+	downloadSchedule, uploadSchedule BandwidthSchedule
+	weights                          BandwidthWeights
+	usage                            map[BandwidthClass]*classUsage
+}
+
+func NewBandwidth(cfg *torrent.ClientConfig, downloadLimit, uploadLimit datasize.ByteSize, downloadSchedule, uploadSchedule BandwidthSchedule, weights BandwidthWeights) *Bandwidth {
+	b := &Bandwidth{
+		download:         cfg.DownloadRateLimiter,
+		upload:           cfg.UploadRateLimiter,
+		downloadLimit:    downloadLimit,
+		uploadLimit:      uploadLimit,
+		downloadSchedule: downloadSchedule,
+		uploadSchedule:   uploadSchedule,
+		weights:          weights,
+		usage:            map[BandwidthClass]*classUsage{},
+	}
+	b.apply(time.Now())
+	return b
+}
+
+// BandwidthSettings - nil fields are left unchanged by Bandwidth.Update
+type BandwidthSettings struct {
+	DownloadLimit, UploadLimit       *datasize.ByteSize
+	DownloadSchedule, UploadSchedule *BandwidthSchedule
+	Weights                          *BandwidthWeights
+}
+
+func (b *Bandwidth) Update(s BandwidthSettings) {
+	b.lock.Lock()
+	if s.DownloadLimit != nil {
+		b.downloadLimit = *s.DownloadLimit
+	}
+	if s.UploadLimit != nil {
+		b.uploadLimit = *s.UploadLimit
+	}
+	if s.DownloadSchedule != nil {
+		b.downloadSchedule = *s.DownloadSchedule
+	}
+	if s.UploadSchedule != nil {
+		b.uploadSchedule = *s.UploadSchedule
+	}
+	if s.Weights != nil {
+		b.weights = *s.Weights
+	}
+	b.lock.Unlock()
+	b.apply(time.Now())
+}
+
+// Settings - copy of current settings
+func (b *Bandwidth) Settings() (downloadLimit, uploadLimit datasize.ByteSize, downloadSchedule, uploadSchedule BandwidthSchedule, weights BandwidthWeights) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.downloadLimit, b.uploadLimit, b.downloadSchedule, b.uploadSchedule, b.weights
+}
+
+// Current - limits which are active at moment now, shared by all classes
+func (b *Bandwidth) Current(now time.Time) (download, upload datasize.ByteSize) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.currentLocked(now)
+}
+
+func (b *Bandwidth) currentLocked(now time.Time) (download, upload datasize.ByteSize) {
+	return b.downloadSchedule.Limit(now, b.downloadLimit), b.uploadSchedule.Limit(now, b.uploadLimit)
+}
+
+// torrentLimits - limits of torrent client: whole limits if torrent client doesn't share them
+func (b *Bandwidth) torrentLimits(now time.Time) (download, upload float64, shared bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, ok := b.weights[ClassTorrent]; !ok {
+		downloadTotal, uploadTotal := b.currentLocked(now)
+		return float64(downloadTotal.Bytes()), float64(uploadTotal.Bytes()), false
+	}
+	downloadShares, uploadShares := b.sharesLocked(now)
+	if u, ok := b.usage[ClassTorrent]; ok {
+		u.downloadLimit, u.uploadLimit = downloadShares[ClassTorrent], uploadShares[ClassTorrent]
+	}
+	return downloadShares[ClassTorrent], uploadShares[ClassTorrent], true
+}
+
+func (b *Bandwidth) apply(now time.Time) {
+	download, upload, shared := b.torrentLimits(now)
+	// shared limits follow usage of other processes, changes are too frequent for info level
+	logLimit := log.Info
+	if shared {
+		logLimit = log.Debug
+	}
+	if downloadergrpc.SetRateLimit(b.download, download, now) {
+		logLimit("[torrent] Download rate limit", "limit", formatShare(download)+"/s")
+	}
+	if downloadergrpc.SetRateLimit(b.upload, upload, now) {
+		logLimit("[torrent] Upload rate limit", "limit", formatShare(upload)+"/s")
+	}
+}
+
+// Priority - download priority of snapshot file. Torrent client requests pieces of files with higher priority first.
+type Priority int8
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+var priorityNames = map[Priority]string{PriorityLow: "low", PriorityNormal: "normal", PriorityHigh: "high"}
+
+func (p Priority) String() string { return priorityNames[p] }
+
+func ParsePriority(s string) (Priority, error) {
+	for p, name := range priorityNames {
+		if name == strings.TrimSpace(s) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown priority %q, expected one of: low, normal, high", s)
+}
+
+// piecePriority - DownloadAll gives every piece PiecePriorityNormal, so our levels start from it
+func (p Priority) piecePriority() types.PiecePriority {
+	switch p {
+	case PriorityHigh:
+		return types.PiecePriorityReadahead
+	case PriorityNormal:
+		return types.PiecePriorityHigh
+	default:
+		return types.PiecePriorityNormal
+	}
+}
+
+// Priorities - priority of snapshot files, by type of segment (headers, bodies, transactions) or by file name.
+// Priority of file name wins over priority of its type.
+type Priorities struct {
+	lock   sync.Mutex
+	byType map[snapshotsync.SnapshotType]Priority
+	byFile map[string]Priority
+}
+
+// DefaultPriorities - headers before bodies before transactions
+func DefaultPriorities() *Priorities {
+	return &Priorities{
+		byType: map[snapshotsync.SnapshotType]Priority{
+			snapshotsync.Headers:      PriorityHigh,
+			snapshotsync.Bodies:       PriorityNormal,
+			snapshotsync.Transactions: PriorityLow,
+		},
+		byFile: map[string]Priority{},
+	}
+}
+
+// Set - key is type of segment or file name
+func (p *Priorities) Set(key string, priority Priority) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, t := range snapshotsync.AllSnapshotTypes {
+		if key == string(t) {
+			p.byType[t] = priority
+			return
+		}
+	}
+	p.byFile[key] = priority
+}
+
+// Parse applies comma separated "key=priority" list, for example "headers=high,v1-000000-000500-bodies.seg=low"
+func (p *Priorities) Parse(s string) error {
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		eq := strings.LastIndexByte(item, '=')
+		if eq < 0 {
+			return fmt.Errorf("priority %q: expected format key=priority", item)
+		}
+		priority, err := ParsePriority(item[eq+1:])
+		if err != nil {
+			return err
+		}
+		p.Set(strings.TrimSpace(item[:eq]), priority)
+	}
+	return nil
+}
+
+// Of - priority of snapshot file
+func (p *Priorities) Of(name string) Priority {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if priority, ok := p.byFile[name]; ok {
+		return priority
+	}
+	if _, _, snapshotType, err := snapshotsync.ParseFileName(name, ".seg"); err == nil {
+		if priority, ok := p.byType[snapshotType]; ok {
+			return priority
+		}
+	}
+	return PriorityNormal
+}
+
+func (p *Priorities) String() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var items []string
+	for t, priority := range p.byType {
+		items = append(items, string(t)+"="+priority.String())
+	}
+	for name, priority := range p.byFile {
+		items = append(items, name+"="+priority.String())
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+func (p *Priorities) apply(torrentClient *torrent.Client) {
+	for _, t := range torrentClient.Torrents() {
+		select {
+		case <-t.GotInfo():
+		default:
+			continue
+		}
+		for _, f := range t.Files() {
+			if prio := p.Of(f.DisplayPath()).piecePriority(); f.Priority() != prio {
+				f.SetPriority(prio)
+			}
+		}
+	}
+}
+
+// ScheduleLoop - switches rate limits by time of day, shares them by usage of classes and applies priorities to new torrents
+func ScheduleLoop(ctx context.Context, torrentClient *torrent.Client, bandwidth *Bandwidth, priorities *Priorities) {
+	const interval = 10 * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	stats := torrentClient.ConnStats()
+	for {
+		priorities.apply(torrentClient)
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			prev := stats
+			stats = torrentClient.ConnStats()
+			read, written := stats.BytesRead.Int64()-prev.BytesRead.Int64(), stats.BytesWritten.Int64()-prev.BytesWritten.Int64()
+			bandwidth.report(ClassTorrent, float64(read)/interval.Seconds(), float64(written)/interval.Seconds(), now)
+			bandwidth.apply(now)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package downloader
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/log/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ScheduleServer - runtime control of bandwidth and priorities. Service "downloader.Schedule" uses well-known protobuf types,
+// keys of structs are same as names of downloader flags:
+// SetBandwidth - {"download.limit": "32mb", "download.schedule": "01:00-07:00=1gb", "upload.limit": ..., "upload.schedule": ...}
+// SetPriority - {"headers": "high", "v1-000000-000500-bodies.seg": "low"}, key is type of segment or file name
+// GetSchedule - current settings and active limits
+// ReportBandwidth - {"class": "p2p", "download": <bytes per second>, "upload": ...} usage of process which shares
+// bandwidth, reply has limits of its class {"download.limit": <bytes per second>, ...}, no key - not limited
+type ScheduleServer interface {
+	SetBandwidth(context.Context, *structpb.Struct) (*emptypb.Empty, error)
+	SetPriority(context.Context, *structpb.Struct) (*emptypb.Empty, error)
+	GetSchedule(context.Context, *emptypb.Empty) (*structpb.Struct, error)
+	ReportBandwidth(context.Context, *structpb.Struct) (*structpb.Struct, error)
+}
+
+type GrpcScheduleServer struct {
+	bandwidth     *Bandwidth
+	priorities    *Priorities
+	torrentClient *torrent.Client
+}
+
+func NewScheduleServer(bandwidth *Bandwidth, priorities *Priorities, torrentClient *torrent.Client) *GrpcScheduleServer {
+	return &GrpcScheduleServer{bandwidth: bandwidth, priorities: priorities, torrentClient: torrentClient}
+}
+
+func stringField(key string, v *structpb.Value) (string, error) {
+	s, ok := v.GetKind().(*structpb.Value_StringValue)
+	if !ok {
+		return "", status.Errorf(codes.InvalidArgument, "%s: expected string value", key)
+	}
+	return s.StringValue, nil
+}
+
+func (s *GrpcScheduleServer) SetBandwidth(_ context.Context, in *structpb.Struct) (*emptypb.Empty, error) {
+	var settings BandwidthSettings
+	for key, v := range in.GetFields() {
+		str, err := stringField(key, v)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "download.limit", "upload.limit":
+			var limit datasize.ByteSize
+			if err = limit.UnmarshalText([]byte(str)); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "%s: %v", key, err)
+			}
+			if key == "download.limit" {
+				settings.DownloadLimit = &limit
+			} else {
+				settings.UploadLimit = &limit
+			}
+		case "download.schedule", "upload.schedule":
+			schedule, err := ParseBandwidthSchedule(str)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "%s: %v", key, err)
+			}
+			if key == "download.schedule" {
+				settings.DownloadSchedule = &schedule
+			} else {
+				settings.UploadSchedule = &schedule
+			}
+		case "bandwidth.weights":
+			weights, err := ParseBandwidthWeights(str)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "%s: %v", key, err)
+			}
+			settings.Weights = &weights
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unknown setting %s", key)
+		}
+	}
+	s.bandwidth.Update(settings)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *GrpcScheduleServer) SetPriority(_ context.Context, in *structpb.Struct) (*emptypb.Empty, error) {
+	priorities := make(map[string]Priority, len(in.GetFields()))
+	for key, v := range in.GetFields() {
+		str, err := stringField(key, v)
+		if err != nil {
+			return nil, err
+		}
+		if priorities[key], err = ParsePriority(str); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s: %v", key, err)
+		}
+	}
+	for key, priority := range priorities {
+		s.priorities.Set(key, priority)
+	}
+	log.Info("[torrent] Priorities changed", "priorities", s.priorities.String())
+	if s.torrentClient != nil {
+		s.priorities.apply(s.torrentClient)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *GrpcScheduleServer) GetSchedule(context.Context, *emptypb.Empty) (*structpb.Struct, error) {
+	downloadLimit, uploadLimit, downloadSchedule, uploadSchedule, weights := s.bandwidth.Settings()
+	now := time.Now()
+	download, upload := s.bandwidth.Current(now)
+	return structpb.NewStruct(map[string]interface{}{
+		"download.limit":    downloadLimit.String(),
+		"download.schedule": downloadSchedule.String(),
+		"download.current":  download.String(),
+		"upload.limit":      uploadLimit.String(),
+		"upload.schedule":   uploadSchedule.String(),
+		"upload.current":    upload.String(),
+		"priority":          s.priorities.String(),
+		"bandwidth.weights": weights.String(),
+		"bandwidth.shares":  s.bandwidth.Shares(now),
+	})
+}
+
+func (s *GrpcScheduleServer) ReportBandwidth(_ context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	fields := in.GetFields()
+	class := BandwidthClass(fields["class"].GetStringValue())
+	if !class.known() || class == ClassTorrent {
+		return nil, status.Errorf(codes.InvalidArgument, "class: unknown class %q, expected one of: p2p, rpc", class)
+	}
+	downloadLimit, uploadLimit := s.bandwidth.Report(class, fields["download"].GetNumberValue(), fields["upload"].GetNumberValue())
+	limits := map[string]interface{}{}
+	if !math.IsInf(downloadLimit, 1) {
+		limits["download.limit"] = downloadLimit
+	}
+	if !math.IsInf(uploadLimit, 1) {
+		limits["upload.limit"] = uploadLimit
+	}
+	return structpb.NewStruct(limits)
+}
+
+func _Schedule_SetBandwidth_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScheduleServer).SetBandwidth(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/downloader.Schedule/SetBandwidth",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScheduleServer).SetBandwidth(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Schedule_SetPriority_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScheduleServer).SetPriority(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/downloader.Schedule/SetPriority",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScheduleServer).SetPriority(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Schedule_ReportBandwidth_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScheduleServer).ReportBandwidth(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/downloader.Schedule/ReportBandwidth",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScheduleServer).ReportBandwidth(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Schedule_GetSchedule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScheduleServer).GetSchedule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/downloader.Schedule/GetSchedule",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScheduleServer).GetSchedule(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Schedule_ServiceDesc - descriptor of "downloader.Schedule" service, written in same way as protoc-gen-go-grpc does
+var Schedule_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "downloader.Schedule",
+	HandlerType: (*ScheduleServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SetBandwidth",
+			Handler:    _Schedule_SetBandwidth_Handler,
+		},
+		{
+			MethodName: "SetPriority",
+			Handler:    _Schedule_SetPriority_Handler,
+		},
+		{
+			MethodName: "GetSchedule",
+			Handler:    _Schedule_GetSchedule_Handler,
+		},
+		{
+			MethodName: "ReportBandwidth",
+			Handler:    _Schedule_ReportBandwidth_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
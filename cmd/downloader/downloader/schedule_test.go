@@ -0,0 +1,161 @@
+package downloader
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestBandwidthSchedule(t *testing.T) {
+	schedule, err := ParseBandwidthSchedule("22:00-06:00=1gb, 09:00-18:00=0")
+	require.NoError(t, err)
+	require.Equal(t, "22:00-06:00=1GB,09:00-18:00=0B", schedule.String())
+
+	at := func(hour, min int) time.Time { return time.Date(2022, 1, 1, hour, min, 0, 0, time.Local) }
+	base := 32 * datasize.MB
+	require.Equal(t, datasize.GB, schedule.Limit(at(23, 30), base))
+	require.Equal(t, datasize.GB, schedule.Limit(at(5, 59), base))
+	require.Equal(t, base, schedule.Limit(at(6, 0), base))
+	require.Equal(t, datasize.ByteSize(0), schedule.Limit(at(12, 0), base))
+	require.Equal(t, base, schedule.Limit(at(18, 0), base))
+
+	for _, bad := range []string{"22:00=1gb", "22:00-06:00", "25:00-06:00=1gb", "06:00-06:00=1gb", "01:00-02:00=fast"} {
+		_, err = ParseBandwidthSchedule(bad)
+		require.Error(t, err, bad)
+	}
+	schedule, err = ParseBandwidthSchedule("")
+	require.NoError(t, err)
+	require.Empty(t, schedule)
+}
+
+func TestPriorities(t *testing.T) {
+	p := DefaultPriorities()
+	require.Equal(t, PriorityHigh, p.Of("v1-000000-000500-headers.seg"))
+	require.Equal(t, PriorityNormal, p.Of("v1-000000-000500-bodies.seg"))
+	require.Equal(t, PriorityLow, p.Of("v1-000000-000500-transactions.seg"))
+	require.Equal(t, PriorityNormal, p.Of("unknown.dat"))
+
+	require.NoError(t, p.Parse("transactions=high, v1-000500-001000-transactions.seg=low"))
+	require.Equal(t, PriorityHigh, p.Of("v1-000000-000500-transactions.seg"))
+	require.Equal(t, PriorityLow, p.Of("v1-000500-001000-transactions.seg"))
+	require.Error(t, p.Parse("headers=urgent"))
+	require.Error(t, p.Parse("headers"))
+}
+
+func TestScheduleServer(t *testing.T) {
+	cfg := &torrent.ClientConfig{
+		DownloadRateLimiter: rate.NewLimiter(rate.Inf, 0),
+		UploadRateLimiter:   rate.NewLimiter(rate.Inf, 0),
+	}
+	bandwidth := NewBandwidth(cfg, 32*datasize.MB, 4*datasize.MB, nil, nil, nil)
+	require.Equal(t, rate.Limit(32*datasize.MB), cfg.DownloadRateLimiter.Limit())
+	require.Equal(t, rate.Limit(4*datasize.MB), cfg.UploadRateLimiter.Limit())
+
+	srv := NewScheduleServer(bandwidth, DefaultPriorities(), nil)
+	ctx := context.Background()
+	in, err := structpb.NewStruct(map[string]interface{}{"download.limit": "1mb", "upload.schedule": "00:00-23:59=0"})
+	require.NoError(t, err)
+	_, err = srv.SetBandwidth(ctx, in)
+	require.NoError(t, err)
+	require.Equal(t, rate.Limit(datasize.MB), cfg.DownloadRateLimiter.Limit())
+
+	// invalid request doesn't change anything
+	in, err = structpb.NewStruct(map[string]interface{}{"download.limit": "2mb", "upload.limit": 5})
+	require.NoError(t, err)
+	_, err = srv.SetBandwidth(ctx, in)
+	require.Error(t, err)
+	require.Equal(t, rate.Limit(datasize.MB), cfg.DownloadRateLimiter.Limit())
+
+	in, err = structpb.NewStruct(map[string]interface{}{"headers": "low", "v1-000000-000500-bodies.seg": "high"})
+	require.NoError(t, err)
+	_, err = srv.SetPriority(ctx, in)
+	require.NoError(t, err)
+	in, err = structpb.NewStruct(map[string]interface{}{"bodies": "top"})
+	require.NoError(t, err)
+	_, err = srv.SetPriority(ctx, in)
+	require.Error(t, err)
+
+	reply, err := srv.GetSchedule(ctx, &emptypb.Empty{})
+	require.NoError(t, err)
+	require.Equal(t, "1MB", reply.Fields["download.limit"].GetStringValue())
+	require.Equal(t, "00:00-23:59=0B", reply.Fields["upload.schedule"].GetStringValue())
+	require.Equal(t, "bodies=normal,headers=low,transactions=low,v1-000000-000500-bodies.seg=high", reply.Fields["priority"].GetStringValue())
+}
+
+func TestSplitBandwidth(t *testing.T) {
+	weights, err := ParseBandwidthWeights("torrent=1, p2p=2, rpc=2")
+	require.NoError(t, err)
+	require.Equal(t, "torrent=1,p2p=2,rpc=2", weights.String())
+	for _, bad := range []string{"torrent", "torrent=0", "torrent=-1", "bittorrent=1"} {
+		_, err = ParseBandwidthWeights(bad)
+		require.Error(t, err, bad)
+	}
+	inf := math.Inf(1)
+
+	// leftover of satisfied p2p goes to others by weights
+	limits := splitBandwidth(100, weights, map[BandwidthClass]float64{ClassTorrent: inf, ClassP2P: 10, ClassRPC: inf})
+	require.InDeltaMapValues(t, map[BandwidthClass]float64{ClassTorrent: 30, ClassP2P: 10, ClassRPC: 60}, limits, 1e-9)
+	// all satisfied: the rest is divided by weights
+	limits = splitBandwidth(100, weights, map[BandwidthClass]float64{ClassTorrent: 10, ClassP2P: 10, ClassRPC: 10})
+	require.InDeltaMapValues(t, map[BandwidthClass]float64{ClassTorrent: 24, ClassP2P: 38, ClassRPC: 38}, limits, 1e-9)
+	// idle class keeps minimal share
+	limits = splitBandwidth(100, weights, map[BandwidthClass]float64{ClassTorrent: inf, ClassRPC: inf})
+	require.InDeltaMapValues(t, map[BandwidthClass]float64{ClassTorrent: 32, ClassP2P: 4, ClassRPC: 64}, limits, 1e-9)
+}
+
+func TestBandwidthShares(t *testing.T) {
+	cfg := &torrent.ClientConfig{
+		DownloadRateLimiter: rate.NewLimiter(rate.Inf, 0),
+		UploadRateLimiter:   rate.NewLimiter(rate.Inf, 0),
+	}
+	weights, err := ParseBandwidthWeights("torrent=1,rpc=1")
+	require.NoError(t, err)
+	bandwidth := NewBandwidth(cfg, 100*datasize.MB, 10*datasize.MB, nil, nil, weights)
+	require.InDelta(t, float64(50*datasize.MB), float64(cfg.DownloadRateLimiter.Limit()), 1)
+	srv := NewScheduleServer(bandwidth, DefaultPriorities(), nil)
+	ctx := context.Background()
+	report := func(class string, download, upload float64) (*structpb.Struct, error) {
+		in, err := structpb.NewStruct(map[string]interface{}{"class": class, "download": download, "upload": upload})
+		require.NoError(t, err)
+		return srv.ReportBandwidth(ctx, in)
+	}
+
+	// torrent didn't report usage yet: it keeps minimal share, rpc gets the rest
+	reply, err := report("rpc", float64(50*datasize.MB), 0)
+	require.NoError(t, err)
+	require.InDelta(t, float64(95*datasize.MB), reply.Fields["download.limit"].GetNumberValue(), 1)
+	// rpc uses whole share, torrent uses 10mb: torrent keeps twice of its usage
+	now := time.Now()
+	bandwidth.report(ClassTorrent, float64(10*datasize.MB), 0, now)
+	bandwidth.apply(now)
+	require.InDelta(t, float64(20*datasize.MB), float64(cfg.DownloadRateLimiter.Limit()), 1)
+	reply, err = report("rpc", float64(95*datasize.MB), 0)
+	require.NoError(t, err)
+	require.InDelta(t, float64(80*datasize.MB), reply.Fields["download.limit"].GetNumberValue(), 1)
+	require.InDelta(t, float64(5*datasize.MB), reply.Fields["upload.limit"].GetNumberValue(), 1)
+
+	// p2p doesn't share bandwidth
+	reply, err = report("p2p", 1, 1)
+	require.NoError(t, err)
+	require.Empty(t, reply.Fields)
+	_, err = report("torrent", 1, 1)
+	require.Error(t, err)
+
+	// empty weights give whole limits to torrent client
+	in, err := structpb.NewStruct(map[string]interface{}{"bandwidth.weights": ""})
+	require.NoError(t, err)
+	_, err = srv.SetBandwidth(ctx, in)
+	require.NoError(t, err)
+	require.Equal(t, rate.Limit(100*datasize.MB), cfg.DownloadRateLimiter.Limit())
+	reply, err = report("rpc", 1, 1)
+	require.NoError(t, err)
+	require.Empty(t, reply.Fields)
+}
@@ -22,11 +22,12 @@ var (
 	_ proto_downloader.DownloaderServer = &SNDownloaderServer{}
 )
 
-func NewServer(db kv.RwDB, client *Client, snapshotDir string) (*SNDownloaderServer, error) {
+func NewServer(db kv.RwDB, client *Client, snapshotDir string, webSeeds *WebSeeds) (*SNDownloaderServer, error) {
 	sn := &SNDownloaderServer{
 		db:          db,
 		t:           client,
 		snapshotDir: snapshotDir,
+		webSeeds:    webSeeds,
 	}
 	return sn, nil
 }
@@ -51,6 +52,7 @@ type SNDownloaderServer struct {
 	t           *Client
 	db          kv.RwDB
 	snapshotDir string
+	webSeeds    *WebSeeds // nil if web seeds fallback disabled
 }
 
 func (s *SNDownloaderServer) Download(ctx context.Context, request *proto_downloader.DownloadRequest) (*emptypb.Empty, error) {
@@ -58,6 +60,9 @@ func (s *SNDownloaderServer) Download(ctx context.Context, request *proto_downlo
 	for i, it := range request.Items {
 		//TODO: if hash is empty - create .torrent file from path file (if it exists)
 		infoHashes[i] = gointerfaces.ConvertH160toAddress(it.TorrentHash)
+		if s.webSeeds != nil && it.Path != "" {
+			s.webSeeds.Add(infoHashes[i], it.Path)
+		}
 	}
 	ctx, cancel := context.WithTimeout(ctx, time.Minute*10)
 	defer cancel()
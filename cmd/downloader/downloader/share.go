@@ -0,0 +1,199 @@
+package downloader
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// BandwidthClass - consumer of network throughput which shares limits of Downloader: torrent client of Downloader
+// and other processes which report their usage to Downloader (see downloadergrpc.BandwidthShare).
+type BandwidthClass string
+
+const (
+	ClassTorrent BandwidthClass = "torrent" // snapshots downloading and seeding
+	ClassP2P     BandwidthClass = "p2p"     // devp2p of Erigon: syncing and serving peers
+	ClassRPC     BandwidthClass = "rpc"     // serving of rpcdaemon
+)
+
+var bandwidthClasses = []BandwidthClass{ClassTorrent, ClassP2P, ClassRPC}
+
+// BandwidthWeights - shares of classes in download and upload limits. Classes which aren't listed are not limited,
+// empty weights disable sharing: torrent client gets whole limits.
+type BandwidthWeights map[BandwidthClass]uint64
+
+// ParseBandwidthWeights parses comma separated "class=weight" list, for example "torrent=1,p2p=2,rpc=2"
+func ParseBandwidthWeights(s string) (BandwidthWeights, error) {
+	weights := BandwidthWeights{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		eq := strings.IndexByte(item, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("bandwidth weight %q: expected format class=weight", item)
+		}
+		class := BandwidthClass(strings.TrimSpace(item[:eq]))
+		if !class.known() {
+			return nil, fmt.Errorf("bandwidth weight %q: unknown class, expected one of: torrent, p2p, rpc", item)
+		}
+		weight, err := strconv.ParseUint(strings.TrimSpace(item[eq+1:]), 10, 64)
+		if err != nil || weight == 0 {
+			return nil, fmt.Errorf("bandwidth weight %q: expected positive integer weight", item)
+		}
+		weights[class] = weight
+	}
+	return weights, nil
+}
+
+func (c BandwidthClass) known() bool {
+	for _, known := range bandwidthClasses {
+		if c == known {
+			return true
+		}
+	}
+	return false
+}
+
+func (w BandwidthWeights) String() string {
+	items := make([]string, 0, len(w))
+	for _, class := range bandwidthClasses {
+		if weight, ok := w[class]; ok {
+			items = append(items, string(class)+"="+strconv.FormatUint(weight, 10))
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+const (
+	// shareReportTimeout - class which didn't report usage for this long is considered idle
+	shareReportTimeout = time.Minute
+	// shareSaturation - class which used this fraction of its limit wants more
+	shareSaturation = 0.8
+	// shareHeadroom - demand of class which doesn't use whole limit, relative to its usage
+	shareHeadroom = 2
+	// shareMinimum - demand of idle class, relative to its fair share: limit never drops to 0, so class can show
+	// that it needs more
+	shareMinimum = 0.1
+)
+
+// classUsage - last reported usage of class, bytes per second
+type classUsage struct {
+	download, upload           float64
+	downloadLimit, uploadLimit float64
+	reported                   time.Time
+}
+
+func demandOf(used, limit float64) float64 {
+	if used >= shareSaturation*limit {
+		return math.Inf(1)
+	}
+	return used * shareHeadroom
+}
+
+// splitBandwidth - weighted water-filling: total is divided by weights, class gets at most its demand and leftover
+// of satisfied classes goes to the others. What remains when all classes are satisfied is divided by weights too,
+// so idle classes can burst before their next report. Demand of class is at least shareMinimum of its fair share.
+func splitBandwidth(total float64, weights BandwidthWeights, demand map[BandwidthClass]float64) map[BandwidthClass]float64 {
+	limits := make(map[BandwidthClass]float64, len(weights))
+	active := make(map[BandwidthClass]uint64, len(weights))
+	var allWeights uint64
+	for class, weight := range weights {
+		active[class] = weight
+		allWeights += weight
+	}
+	remaining := total
+	for len(active) > 0 {
+		var sum uint64
+		for _, weight := range active {
+			sum += weight
+		}
+		var satisfied []BandwidthClass
+		for class, weight := range active {
+			d := math.Max(demand[class], total*float64(weight)/float64(allWeights)*shareMinimum)
+			if d <= remaining*float64(weight)/float64(sum) {
+				limits[class] = d
+				satisfied = append(satisfied, class)
+			}
+		}
+		if len(satisfied) == 0 {
+			for class, weight := range active {
+				limits[class] = remaining * float64(weight) / float64(sum)
+			}
+			return limits
+		}
+		for _, class := range satisfied {
+			remaining -= limits[class]
+			delete(active, class)
+		}
+	}
+	for class, weight := range weights {
+		limits[class] += remaining * float64(weight) / float64(allWeights)
+	}
+	return limits
+}
+
+// sharesLocked - limits of classes which have weights, by their usage. Caller holds lock of Bandwidth.
+func (b *Bandwidth) sharesLocked(now time.Time) (download, upload map[BandwidthClass]float64) {
+	downloadDemand := make(map[BandwidthClass]float64, len(b.weights))
+	uploadDemand := make(map[BandwidthClass]float64, len(b.weights))
+	for class := range b.weights {
+		if u, ok := b.usage[class]; ok && now.Sub(u.reported) < shareReportTimeout {
+			downloadDemand[class] = demandOf(u.download, u.downloadLimit)
+			uploadDemand[class] = demandOf(u.upload, u.uploadLimit)
+		}
+	}
+	downloadTotal, uploadTotal := b.currentLocked(now)
+	return splitBandwidth(float64(downloadTotal.Bytes()), b.weights, downloadDemand), splitBandwidth(float64(uploadTotal.Bytes()), b.weights, uploadDemand)
+}
+
+// Report - usage of class in bytes per second since previous report, returns limits of class (Inf - not limited)
+func (b *Bandwidth) Report(class BandwidthClass, download, upload float64) (downloadLimit, uploadLimit float64) {
+	return b.report(class, download, upload, time.Now())
+}
+
+func (b *Bandwidth) report(class BandwidthClass, download, upload float64, now time.Time) (downloadLimit, uploadLimit float64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, ok := b.weights[class]; !ok {
+		return math.Inf(1), math.Inf(1)
+	}
+	u, ok := b.usage[class]
+	if !ok {
+		u = &classUsage{downloadLimit: math.Inf(1), uploadLimit: math.Inf(1)}
+		b.usage[class] = u
+	}
+	u.download, u.upload, u.reported = download, upload, now
+	downloadShares, uploadShares := b.sharesLocked(now)
+	u.downloadLimit, u.uploadLimit = downloadShares[class], uploadShares[class]
+	return u.downloadLimit, u.uploadLimit
+}
+
+// Shares - current limits of classes which share bandwidth, for GetSchedule
+func (b *Bandwidth) Shares(now time.Time) string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if len(b.weights) == 0 {
+		return ""
+	}
+	download, upload := b.sharesLocked(now)
+	items := make([]string, 0, len(b.weights))
+	for class := range b.weights {
+		items = append(items, fmt.Sprintf("%s=%s/%s", class, formatShare(download[class]), formatShare(upload[class])))
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+func formatShare(limit float64) string {
+	if math.IsInf(limit, 1) || limit >= math.MaxInt64 {
+		return "unlimited"
+	}
+	return datasize.ByteSize(limit).HR()
+}
@@ -20,7 +20,7 @@ import (
 // DefaultPieceSize - Erigon serves many big files, bigger pieces will reduce
 // amount of network announcements, but can't go over 2Mb
 // see https://wiki.theory.org/BitTorrentSpecification#Metainfo_File_Structure
-const DefaultPieceSize = 1 * 1024 * 1024
+const DefaultPieceSize = snapshotsync.TorrentPieceSize
 
 // Trackers - break down by priority tier
 var Trackers = [][]string{
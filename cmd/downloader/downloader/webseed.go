@@ -0,0 +1,327 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// WebSeeds - HTTP fallback for snapshot files which can't be downloaded by torrent (not enough peers, restrictive NAT, etc...).
+// Web seed must serve "<url>/<file name>" with Range requests support and "<url>/<file name>.torrent".
+// Every downloaded piece is checked against piece hashes of torrent, and torrent must match preverified info hash -
+// so web seed doesn't need to be trusted.
+type WebSeeds struct {
+	urls        []string
+	client      *http.Client
+	snapshotDir string
+
+	lock  sync.Mutex
+	names map[metainfo.Hash]string // files which must be downloaded
+}
+
+func NewWebSeeds(urls []string, snapshotDir string) *WebSeeds {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 30 * time.Second
+	trimmed := make([]string, len(urls))
+	for i, u := range urls {
+		trimmed[i] = strings.TrimSuffix(u, "/")
+	}
+	return &WebSeeds{
+		urls:        trimmed,
+		client:      &http.Client{Transport: transport},
+		snapshotDir: snapshotDir,
+		names:       map[metainfo.Hash]string{},
+	}
+}
+
+// Add - register file which can be downloaded from web seeds
+func (w *WebSeeds) Add(infoHash metainfo.Hash, name string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.names[infoHash] = name
+}
+
+func (w *WebSeeds) files() map[metainfo.Hash]string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	res := make(map[metainfo.Hash]string, len(w.names))
+	for k, v := range w.names {
+		res[k] = v
+	}
+	return res
+}
+
+func (w *WebSeeds) get(ctx context.Context, fileURL string, from, to int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if to > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, to-1))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: unexpected status %s", fileURL, resp.Status)
+	}
+	return resp, nil
+}
+
+// DownloadMetaInfo - download .torrent file of given name and check that it has expected info hash
+func (w *WebSeeds) DownloadMetaInfo(ctx context.Context, infoHash metainfo.Hash, name string) (*metainfo.MetaInfo, error) {
+	var lastErr error
+	for _, base := range w.urls {
+		mi, err := w.downloadMetaInfo(ctx, base+"/"+url.PathEscape(name+".torrent"))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if mi.HashInfoBytes() != infoHash {
+			lastErr = fmt.Errorf("%s: .torrent has info hash %x, expected %x", base, mi.HashInfoBytes(), infoHash)
+			continue
+		}
+		return mi, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no web seeds")
+	}
+	return nil, lastErr
+}
+
+func (w *WebSeeds) downloadMetaInfo(ctx context.Context, fileURL string) (*metainfo.MetaInfo, error) {
+	resp, err := w.get(ctx, fileURL, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return metainfo.Load(resp.Body)
+}
+
+// DownloadFile - download file described by info into snapshot dir. Only missing (or corrupted) pieces are
+// requested, by HTTP Range requests - so download continues from where previous attempt (or torrent) stopped.
+func (w *WebSeeds) DownloadFile(ctx context.Context, info *metainfo.Info) error {
+	if info.IsDir() {
+		return fmt.Errorf("multi-file torrent %s is not supported by web seeds", info.Name)
+	}
+	f, err := os.OpenFile(filepath.Join(w.snapshotDir, info.Name), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if st.Size() != info.Length {
+		if err = f.Truncate(info.Length); err != nil {
+			return err
+		}
+	}
+
+	missing := missingPieces(f, info)
+	if len(missing) == 0 {
+		return nil
+	}
+	for _, base := range w.urls {
+		missing, err = w.downloadPieces(ctx, base+"/"+url.PathEscape(info.Name), f, info, missing)
+		if len(missing) == 0 {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Warn("[webseed] Download interrupted", "url", base, "file", info.Name, "missing pieces", len(missing), "err", err)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s: %d pieces are missing after trying all web seeds: %w", info.Name, len(missing), err)
+	}
+	return f.Sync()
+}
+
+// missingPieces - indices of pieces which don't match their hashes
+func missingPieces(f *os.File, info *metainfo.Info) []int {
+	var missing []int
+	buf := make([]byte, info.PieceLength)
+	for i := 0; i < info.NumPieces(); i++ {
+		if !pieceHashMatch(f, info.Piece(i), buf) {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// pieceHashMatch - buf must be at least of piece length
+func pieceHashMatch(f *os.File, p metainfo.Piece, buf []byte) bool {
+	b := buf[:p.Length()]
+	if _, err := f.ReadAt(b, p.Offset()); err != nil {
+		return false
+	}
+	return metainfo.Hash(sha1.Sum(b)) == p.Hash()
+}
+
+// downloadPieces - request runs of consecutive missing pieces, returns pieces which are still missing
+func (w *WebSeeds) downloadPieces(ctx context.Context, fileURL string, f *os.File, info *metainfo.Info, missing []int) ([]int, error) {
+	for len(missing) > 0 {
+		run := 1
+		for run < len(missing) && missing[run] == missing[0]+run {
+			run++
+		}
+		done, err := w.downloadRun(ctx, fileURL, f, info, missing[0], run)
+		missing = missing[done:]
+		if err != nil {
+			return missing, err
+		}
+	}
+	return nil, nil
+}
+
+func (w *WebSeeds) downloadRun(ctx context.Context, fileURL string, f *os.File, info *metainfo.Info, first, count int) (int, error) {
+	from := info.Piece(first).Offset()
+	last := info.Piece(first + count - 1)
+	resp, err := w.get(ctx, fileURL, from, last.Offset()+last.Length())
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK { // server ignored Range header
+		if _, err = io.CopyN(io.Discard, resp.Body, from); err != nil {
+			return 0, err
+		}
+	}
+
+	buf := make([]byte, info.PieceLength)
+	for i := 0; i < count; i++ {
+		p := info.Piece(first + i)
+		b := buf[:p.Length()]
+		if _, err = io.ReadFull(resp.Body, b); err != nil {
+			return i, err
+		}
+		if metainfo.Hash(sha1.Sum(b)) != p.Hash() {
+			return i, fmt.Errorf("piece %d of %s has wrong hash", p.Index(), info.Name)
+		}
+		if _, err = f.WriteAt(b, p.Offset()); err != nil {
+			return i, err
+		}
+	}
+	return count, nil
+}
+
+// fallback - download file via web seeds, then (re-)add it to torrent client as complete - to seed it
+func (w *WebSeeds) fallback(ctx context.Context, cli *Client, infoHash metainfo.Hash, name string) error {
+	var mi *metainfo.MetaInfo
+	if t, ok := cli.Cli.Torrent(infoHash); ok {
+		select {
+		case <-t.GotInfo():
+			m := t.Metainfo()
+			mi = &m
+		default:
+		}
+		// torrent storage keeps file open (mmap), release it before writing
+		if err := cli.StopSeeding(infoHash); err != nil {
+			return err
+		}
+	}
+	if mi == nil {
+		var err error
+		if mi, err = w.DownloadMetaInfo(ctx, infoHash, name); err != nil {
+			return err
+		}
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return err
+	}
+	if err = w.DownloadFile(ctx, &info); err != nil {
+		return err
+	}
+	for i := 0; i < info.NumPieces(); i++ {
+		if err = cli.pieceCompletionStore.Set(metainfo.PieceKey{InfoHash: infoHash, Index: i}, true); err != nil {
+			return err
+		}
+	}
+	if err = CreateTorrentFileIfNotExists(w.snapshotDir, &info, mi); err != nil {
+		return err
+	}
+	mi.AnnounceList = Trackers
+	t, err := cli.Cli.AddTorrent(mi)
+	if err != nil {
+		return err
+	}
+	t.AllowDataDownload()
+	t.AllowDataUpload()
+	t.DownloadAll()
+	return nil
+}
+
+// WebSeedLoop - download via web seeds files which are not complete and had less than minPeers torrent peers
+// during fallbackAfter
+func WebSeedLoop(ctx context.Context, cli *Client, webSeeds *WebSeeds, minPeers int, fallbackAfter time.Duration) {
+	logEvery := time.NewTicker(10 * time.Second)
+	defer logEvery.Stop()
+	scarceSince := map[metainfo.Hash]time.Time{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-logEvery.C:
+		}
+		// files from .torrent files are known without Download request (for example after restart)
+		for _, t := range cli.Cli.Torrents() {
+			select {
+			case <-t.GotInfo():
+				webSeeds.Add(t.InfoHash(), t.Info().Name)
+			default:
+			}
+		}
+		for infoHash, name := range webSeeds.files() {
+			if t, ok := cli.Cli.Torrent(infoHash); ok {
+				complete := false
+				select {
+				case <-t.GotInfo():
+					complete = t.Complete.Bool()
+				default:
+				}
+				if complete || len(t.PeerConns()) >= minPeers {
+					delete(scarceSince, infoHash)
+					continue
+				}
+			}
+			since, ok := scarceSince[infoHash]
+			if !ok {
+				scarceSince[infoHash] = time.Now()
+				continue
+			}
+			if time.Since(since) < fallbackAfter {
+				continue
+			}
+
+			log.Info("[webseed] Not enough torrent peers, downloading via HTTP", "file", name)
+			if err := webSeeds.fallback(ctx, cli, infoHash, name); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Warn("[webseed] Download failed, will retry", "file", name, "err", err)
+				scarceSince[infoHash] = time.Now()
+				continue
+			}
+			log.Info("[webseed] Downloaded", "file", name)
+			delete(scarceSince, infoHash)
+		}
+	}
+}
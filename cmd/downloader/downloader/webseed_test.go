@@ -0,0 +1,111 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+)
+
+const testPieceSize = 16 * 1024
+
+func newTestWebSeed(t *testing.T, name string, data []byte) (*httptest.Server, metainfo.Hash, *int32) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0644))
+	info := &metainfo.Info{PieceLength: testPieceSize}
+	require.NoError(t, info.BuildFromFilePath(filepath.Join(dir, name)))
+	require.NoError(t, CreateTorrentFile(dir, info, nil))
+	mi, err := metainfo.LoadFromFile(filepath.Join(dir, name+".torrent"))
+	require.NoError(t, err)
+
+	var ranges int32
+	fileServer := http.FileServer(http.Dir(dir))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			atomic.AddInt32(&ranges, 1)
+		}
+		fileServer.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, mi.HashInfoBytes(), &ranges
+}
+
+func TestWebSeedDownload(t *testing.T) {
+	name := "v1-000000-000500-headers.seg"
+	data := make([]byte, 10*testPieceSize+100)
+	rand.New(rand.NewSource(1)).Read(data)
+	srv, infoHash, ranges := newTestWebSeed(t, name, data)
+
+	// broken web seed goes first, download must switch to the next one
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	defer broken.Close()
+
+	dir := t.TempDir()
+	webSeeds := NewWebSeeds([]string{broken.URL, srv.URL + "/"}, dir)
+	ctx := context.Background()
+
+	_, err := webSeeds.DownloadMetaInfo(ctx, metainfo.Hash{1}, name)
+	require.Error(t, err)
+	mi, err := webSeeds.DownloadMetaInfo(ctx, infoHash, name)
+	require.NoError(t, err)
+	info, err := mi.UnmarshalInfo()
+	require.NoError(t, err)
+
+	require.NoError(t, webSeeds.DownloadFile(ctx, &info))
+	downloaded, err := os.ReadFile(filepath.Join(dir, name))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(data, downloaded))
+	require.Equal(t, int32(1), atomic.LoadInt32(ranges))
+
+	// corrupt 2 separate runs of pieces - only them must be re-downloaded
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_RDWR, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xff, 0xff}, 2*testPieceSize)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xff, 0xff}, 5*testPieceSize+1)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xff, 0xff}, 6*testPieceSize+1)
+	require.NoError(t, err)
+	require.Equal(t, []int{2, 5, 6}, missingPieces(f, &info))
+	require.NoError(t, f.Close())
+
+	require.NoError(t, webSeeds.DownloadFile(ctx, &info))
+	downloaded, err = os.ReadFile(filepath.Join(dir, name))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(data, downloaded))
+	require.Equal(t, int32(3), atomic.LoadInt32(ranges))
+}
+
+func TestWebSeedWrongData(t *testing.T) {
+	name := "v1-000000-000500-bodies.seg"
+	data := make([]byte, 3*testPieceSize)
+	rand.New(rand.NewSource(2)).Read(data)
+	srv, infoHash, _ := newTestWebSeed(t, name, data)
+
+	// serves .torrent of the right file, but different content
+	other := make([]byte, len(data))
+	otherSrv, _, _ := newTestWebSeed(t, name, other)
+
+	dir := t.TempDir()
+	ctx := context.Background()
+	mi, err := NewWebSeeds([]string{srv.URL}, dir).DownloadMetaInfo(ctx, infoHash, name)
+	require.NoError(t, err)
+	info, err := mi.UnmarshalInfo()
+	require.NoError(t, err)
+
+	require.Error(t, NewWebSeeds([]string{otherSrv.URL}, dir).DownloadFile(ctx, &info))
+	f, err := os.Open(filepath.Join(dir, name))
+	require.NoError(t, err)
+	defer f.Close()
+	require.Equal(t, []int{0, 1, 2}, missingPieces(f, &info))
+}
@@ -0,0 +1,225 @@
+package downloadergrpc
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/log/v3"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Classes of processes which share bandwidth limits of Downloader, see downloader.BandwidthWeights
+const (
+	BandwidthClassP2P = "p2p"
+	BandwidthClassRPC = "rpc"
+)
+
+// BandwidthReportInterval - how often processes report usage to Downloader, same as Downloader applies limits
+const BandwidthReportInterval = 10 * time.Second
+
+// bandwidthBurst - bytes which can be transferred at once, also max size of one wait of limiter
+const bandwidthBurst = 64 * 1024
+
+// BandwidthShare - rate limits of process which shares bandwidth with torrent client of Downloader.
+// Process reports its usage to Downloader periodically and gets back limits of its class. Until first reply,
+// or if Downloader doesn't share bandwidth, process isn't limited.
+type BandwidthShare struct {
+	ctx              context.Context // of process, waits of connections stop when it's done
+	class            string
+	download, upload *rate.Limiter
+	read, written    uint64 // atomic, bytes since last report
+}
+
+func NewBandwidthShare(ctx context.Context, class string) *BandwidthShare {
+	return &BandwidthShare{
+		ctx:      ctx,
+		class:    class,
+		download: rate.NewLimiter(rate.Inf, bandwidthBurst),
+		upload:   rate.NewLimiter(rate.Inf, bandwidthBurst),
+	}
+}
+
+// Loop - reports usage every interval via "downloader.Schedule/ReportBandwidth" until ctx is done
+func (s *BandwidthShare) Loop(ctx context.Context, conn grpc.ClientConnInterface, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.report(ctx, conn, interval); err != nil {
+			log.Debug("[bandwidth] Report to downloader", "class", s.class, "err", err)
+		}
+	}
+}
+
+func (s *BandwidthShare) report(ctx context.Context, conn grpc.ClientConnInterface, interval time.Duration) error {
+	read, written := atomic.SwapUint64(&s.read, 0), atomic.SwapUint64(&s.written, 0)
+	in, err := structpb.NewStruct(map[string]interface{}{
+		"class":    s.class,
+		"download": float64(read) / interval.Seconds(),
+		"upload":   float64(written) / interval.Seconds(),
+	})
+	if err != nil {
+		return err
+	}
+	out := new(structpb.Struct)
+	if err = conn.Invoke(ctx, "/downloader.Schedule/ReportBandwidth", in, out); err != nil {
+		// Downloader is unreachable or doesn't share bandwidth: don't keep stale limits
+		s.setLimits(math.Inf(1), math.Inf(1))
+		return err
+	}
+	download, upload := math.Inf(1), math.Inf(1)
+	if v, ok := out.GetFields()["download.limit"]; ok {
+		download = v.GetNumberValue()
+	}
+	if v, ok := out.GetFields()["upload.limit"]; ok {
+		upload = v.GetNumberValue()
+	}
+	s.setLimits(download, upload)
+	return nil
+}
+
+func (s *BandwidthShare) setLimits(download, upload float64) {
+	now := time.Now()
+	SetRateLimit(s.download, download, now)
+	SetRateLimit(s.upload, upload, now)
+}
+
+// SetRateLimit - sets limit in bytes per second (+Inf - not limited) if it differs from current one, reports whether
+// it was changed. Shared by torrent client of Downloader and processes which share its bandwidth.
+func SetRateLimit(limiter *rate.Limiter, bytesPerSecond float64, now time.Time) bool {
+	limit := rate.Limit(bytesPerSecond)
+	if math.IsInf(bytesPerSecond, 1) {
+		limit = rate.Inf
+	}
+	if limiter.Limit() == limit {
+		return false
+	}
+	limiter.SetLimitAt(now, limit)
+	return true
+}
+
+// Limits - current limits in bytes per second, rate.Inf - not limited
+func (s *BandwidthShare) Limits() (download, upload rate.Limit) {
+	return s.download.Limit(), s.upload.Limit()
+}
+
+// wait - blocks until n bytes can be transferred or ctx is done, accounts them as usage
+func (s *BandwidthShare) wait(ctx context.Context, limiter *rate.Limiter, counter *uint64, n int) error {
+	atomic.AddUint64(counter, uint64(n))
+	for n > 0 {
+		chunk := n
+		if chunk > bandwidthBurst {
+			chunk = bandwidthBurst
+		}
+		if err := limiter.WaitN(ctx, chunk); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// limit 0 (downloader paused transfers by schedule): p2p and rpc are not paused
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// Conn - limits connection by shared limits, waits stop when the connection is closed or ctx of share is done
+func (s *BandwidthShare) Conn(c net.Conn) net.Conn {
+	ctx, cancel := context.WithCancel(s.ctx)
+	return &limitedConn{Conn: c, share: s, ctx: ctx, cancel: cancel}
+}
+
+type limitedConn struct {
+	net.Conn
+	share  *BandwidthShare
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (c *limitedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if waitErr := c.share.wait(c.ctx, c.share.download, &c.share.read, n); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
+
+func (c *limitedConn) Write(b []byte) (int, error) {
+	if err := c.share.wait(c.ctx, c.share.upload, &c.share.written, len(b)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *limitedConn) Close() error {
+	c.cancel()
+	return c.Conn.Close()
+}
+
+// Handler - limits request bodies and responses of HTTP handler by shared limits
+func (s *BandwidthShare) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			r.Body = &limitedBody{ReadCloser: r.Body, share: s, ctx: r.Context()}
+		}
+		h.ServeHTTP(&limitedResponseWriter{ResponseWriter: w, share: s, ctx: r.Context()}, r)
+	})
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	share *BandwidthShare
+	ctx   context.Context // of request
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if waitErr := b.share.wait(b.ctx, b.share.download, &b.share.read, n); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
+
+type limitedResponseWriter struct {
+	http.ResponseWriter
+	share *BandwidthShare
+	ctx   context.Context // of request
+}
+
+func (w *limitedResponseWriter) Write(p []byte) (int, error) {
+	if err := w.share.wait(w.ctx, w.share.upload, &w.share.written, len(p)); err != nil {
+		return 0, err
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush - streaming responses must stay streaming
+func (w *limitedResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack - websocket upgrade needs underlying connection, it's limited as well
+func (w *limitedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return w.share.Conn(conn), rw, nil
+}
@@ -17,6 +17,15 @@ import (
 )
 
 func NewClient(ctx context.Context, downloaderAddr string) (proto_downloader.DownloaderClient, error) {
+	conn, err := NewConn(ctx, downloaderAddr)
+	if err != nil {
+		return nil, err
+	}
+	return proto_downloader.NewDownloaderClient(conn), nil
+}
+
+// NewConn - connection to Downloader, for its services other than proto_downloader.DownloaderClient
+func NewConn(ctx context.Context, downloaderAddr string) (*grpc.ClientConn, error) {
 	// creating grpc client connection
 	var dialOpts []grpc.DialOption
 
@@ -34,7 +43,7 @@ func NewClient(ctx context.Context, downloaderAddr string) (proto_downloader.Dow
 	if err != nil {
 		return nil, fmt.Errorf("creating client connection to sentry P2P: %w", err)
 	}
-	return proto_downloader.NewDownloaderClient(conn), nil
+	return conn, nil
 }
 
 func InfoHashes2Proto(in []metainfo.Hash) []*prototypes.H160 {
@@ -42,6 +42,14 @@ var (
 	downloaderApiAddr                string
 	torrentVerbosity                 string
 	downloadLimitStr, uploadLimitStr string
+	webSeedsStr                      string
+	webSeedMinPeers                  int
+	webSeedFallbackAfter             time.Duration
+	downloadScheduleStr              string
+	uploadScheduleStr                string
+	priorityStr                      string
+	bandwidthWeightsStr              string
+	auditInterval                    time.Duration
 )
 
 func init() {
@@ -55,6 +63,14 @@ func init() {
 	rootCmd.Flags().StringVar(&torrentVerbosity, "torrent.verbosity", lg.Info.LogString(), "DEBUG | INFO | WARN | ERROR")
 	rootCmd.Flags().StringVar(&downloadLimitStr, "download.limit", "1gb", "bytes per second, example: 32mb")
 	rootCmd.Flags().StringVar(&uploadLimitStr, "upload.limit", "1gb", "bytes per second, example: 32mb")
+	rootCmd.Flags().StringVar(&downloadScheduleStr, "download.schedule", "", "time of day dependent download.limit, example: 01:00-07:00=1gb,09:00-18:00=0 (0 - pause)")
+	rootCmd.Flags().StringVar(&uploadScheduleStr, "upload.schedule", "", "time of day dependent upload.limit, same format as download.schedule")
+	rootCmd.Flags().StringVar(&bandwidthWeightsStr, "bandwidth.weights", "", "share download.limit and upload.limit between classes: torrent, p2p (devp2p of Erigon), rpc (rpcdaemon), example: torrent=1,p2p=2,rpc=2 (empty - torrent only)")
+	rootCmd.Flags().StringVar(&priorityStr, "download.priority", "", "download priority (low, normal, high) of segment types or files, default: headers=high,bodies=normal,transactions=low")
+	rootCmd.Flags().StringVar(&webSeedsStr, "webseeds", "", "comma separated list of HTTP(S) urls serving snapshot files and their .torrent files, used when torrent peers are scarce")
+	rootCmd.Flags().IntVar(&webSeedMinPeers, "webseed.min.peers", 3, "download file from web seeds if it has less torrent peers")
+	rootCmd.Flags().DurationVar(&webSeedFallbackAfter, "webseed.fallback.after", 5*time.Minute, "how long to wait for torrent peers before downloading from web seeds")
+	rootCmd.Flags().DurationVar(&auditInterval, "audit.interval", 0, "re-hash downloaded snapshots every interval and re-download corrupted pieces, example: 24h (0 - disabled)")
 
 	withDatadir(printInfoHashes)
 	printInfoHashes.PersistentFlags().BoolVar(&asJson, "json", false, "Print in json format (default: toml)")
@@ -113,6 +129,22 @@ func Downloader(ctx context.Context, cmd *cobra.Command) error {
 	if err := uploadLimit.UnmarshalText([]byte(uploadLimitStr)); err != nil {
 		return err
 	}
+	downloadSchedule, err := downloader.ParseBandwidthSchedule(downloadScheduleStr)
+	if err != nil {
+		return fmt.Errorf("download.schedule: %w", err)
+	}
+	uploadSchedule, err := downloader.ParseBandwidthSchedule(uploadScheduleStr)
+	if err != nil {
+		return fmt.Errorf("upload.schedule: %w", err)
+	}
+	weights, err := downloader.ParseBandwidthWeights(bandwidthWeightsStr)
+	if err != nil {
+		return fmt.Errorf("bandwidth.weights: %w", err)
+	}
+	priorities := downloader.DefaultPriorities()
+	if err = priorities.Parse(priorityStr); err != nil {
+		return fmt.Errorf("download.priority: %w", err)
+	}
 
 	log.Info("Run snapshot downloader", "addr", downloaderApiAddr, "datadir", datadir, "seeding", seeding)
 	if err := os.MkdirAll(snapshotsDir, 0755); err != nil {
@@ -120,7 +152,9 @@ func Downloader(ctx context.Context, cmd *cobra.Command) error {
 	}
 
 	db := mdbx.MustOpen(snapshotsDir + "/db")
+	defer db.Close()
 	var t *downloader.Client
+	var bandwidth *downloader.Bandwidth
 	if err := db.Update(context.Background(), func(tx kv.RwTx) error {
 		peerID, err := tx.GetOne(kv.BittorrentInfo, []byte(kv.BittorrentPeerID))
 		if err != nil {
@@ -135,6 +169,7 @@ func Downloader(ctx context.Context, cmd *cobra.Command) error {
 		if err != nil {
 			return err
 		}
+		bandwidth = downloader.NewBandwidth(cfg, downloadLimit, uploadLimit, downloadSchedule, uploadSchedule, weights)
 		if len(peerID) == 0 {
 			err = t.SavePeerID(tx)
 			if err != nil {
@@ -146,9 +181,17 @@ func Downloader(ctx context.Context, cmd *cobra.Command) error {
 	}); err != nil {
 		return err
 	}
-	defer t.Close()
+	defer func() {
+		log.Info("Shutdown: closing torrent sessions", "torrents", len(t.Cli.Torrents()))
+		t.Close()
+	}()
+
+	var webSeeds *downloader.WebSeeds
+	if webSeedsStr != "" {
+		webSeeds = downloader.NewWebSeeds(utils.SplitAndTrim(webSeedsStr), snapshotsDir)
+	}
 
-	bittorrentServer, err := downloader.NewServer(db, t, snapshotsDir)
+	bittorrentServer, err := downloader.NewServer(db, t, snapshotsDir, webSeeds)
 	if err != nil {
 		return fmt.Errorf("new server: %w", err)
 	}
@@ -184,13 +227,31 @@ func Downloader(ctx context.Context, cmd *cobra.Command) error {
 	}
 
 	go downloader.MainLoop(ctx, t.Cli)
+	go downloader.ScheduleLoop(ctx, t.Cli, bandwidth, priorities)
+	if webSeeds != nil {
+		go downloader.WebSeedLoop(ctx, t, webSeeds, webSeedMinPeers, webSeedFallbackAfter)
+	}
+	if auditInterval > 0 {
+		go downloader.AuditLoop(ctx, t, snapshotsDir, auditInterval)
+	}
 
-	grpcServer, err := StartGrpc(bittorrentServer, downloaderApiAddr, nil)
+	grpcServer, err := StartGrpc(bittorrentServer, downloader.NewScheduleServer(bandwidth, priorities, t.Cli), downloaderApiAddr, nil)
 	if err != nil {
 		return err
 	}
 	<-cmd.Context().Done()
-	grpcServer.GracefulStop()
+	// Erigon keeps streams open, they would hold graceful stop
+	log.Info("Shutdown: stopping grpc server")
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		grpcServer.GracefulStop()
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		grpcServer.Stop()
+	}
 	return nil
 }
 
@@ -233,7 +294,7 @@ var printInfoHashes = &cobra.Command{
 	},
 }
 
-func StartGrpc(snServer *downloader.SNDownloaderServer, addr string, creds *credentials.TransportCredentials) (*grpc.Server, error) {
+func StartGrpc(snServer *downloader.SNDownloaderServer, scheduleServer downloader.ScheduleServer, addr string, creds *credentials.TransportCredentials) (*grpc.Server, error) {
 	lis, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, fmt.Errorf("could not create listener: %w, addr=%s", err, addr)
@@ -270,6 +331,9 @@ func StartGrpc(snServer *downloader.SNDownloaderServer, addr string, creds *cred
 	if snServer != nil {
 		proto_downloader.RegisterDownloaderServer(grpcServer, snServer)
 	}
+	if scheduleServer != nil {
+		grpcServer.RegisterService(&downloader.Schedule_ServiceDesc, scheduleServer)
+	}
 
 	//if metrics.Enabled {
 	//	grpc_prometheus.Register(grpcServer)
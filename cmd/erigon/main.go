@@ -28,6 +28,23 @@ func runErigon(cliCtx *cli.Context) {
 	nodeCfg := node.NewNodConfigUrfave(cliCtx)
 	ethCfg := node.NewEthConfigUrfave(cliCtx, nodeCfg)
 
+	nodeCfgs, ethCfgs, err := node.NewNetworkConfigsUrfave(cliCtx, nodeCfg, ethCfg)
+	if err != nil {
+		log.Error("Erigon startup", "err", err)
+		return
+	}
+	if len(nodeCfgs) > 1 {
+		multiNode, err := node.NewMulti(nodeCfgs, ethCfgs, logger)
+		if err != nil {
+			log.Error("Erigon startup", "err", err)
+			return
+		}
+		if err = multiNode.Serve(); err != nil {
+			log.Error("error while serving Erigon nodes", "err", err)
+		}
+		return
+	}
+
 	ethNode, err := node.New(nodeCfg, ethCfg, logger)
 	if err != nil {
 		log.Error("Erigon startup", "err", err)
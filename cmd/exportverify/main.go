@@ -0,0 +1,106 @@
+// exportverify follows the export stream of a running Erigon node (served on its private API) and verifies it:
+// checksums, integrity and continuity of blocks, rolling checksums of state commitments. If the chaindata of a backup
+// is given, exported blocks and state roots are also compared with the backup.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/ethdb/privateapi"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/export"
+	"github.com/ledgerwatch/log/v3"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var (
+	addr          = flag.String("private.api.addr", "127.0.0.1:9090", "private API of the node")
+	backup        = flag.String("backup", "", "chaindata directory of the backup to compare with, optional")
+	from          = flag.Uint64("from", 0, "first block to verify")
+	commitment    = flag.Uint64("commitment.every", export.DefaultCommitmentInterval, "request state commitment every N blocks")
+	confirmations = flag.Uint64("confirmations", 0, "stay N blocks behind the executed head of the node")
+)
+
+func main() {
+	flag.Parse()
+	log.Root().SetHandler(log.LvlFilterHandler(log.LvlInfo, log.StderrHandler))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-ch
+		cancel()
+	}()
+	if err := verify(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		log.Error("Verification failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func verify(ctx context.Context) error {
+	var backupDB kv.RoDB
+	if *backup != "" {
+		db, err := mdbx.NewMDBX(log.New()).Path(*backup).Readonly().Open()
+		if err != nil {
+			return fmt.Errorf("opening backup: %w", err)
+		}
+		defer db.Close()
+		backupDB = db
+	}
+	conn, err := grpcutil.Connect(nil, *addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	req, err := rlp.EncodeToBytes(&export.Request{From: *from, CommitmentInterval: *commitment, Confirmations: *confirmations})
+	if err != nil {
+		return err
+	}
+	stream, err := privateapi.NewExportClient(conn).Blocks(ctx, wrapperspb.Bytes(req))
+	if err != nil {
+		return err
+	}
+	verifier := export.NewVerifier(backupDB)
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		f, err := export.DecodeFrame(msg.GetValue())
+		if err != nil {
+			return err
+		}
+		if err := verifier.Verify(ctx, f); err != nil {
+			return err
+		}
+		if f.Kind == export.KindCommitment {
+			log.Info("Commitment verified", "block", f.Number, "root", f.Root, "chain", f.Chain)
+		}
+		select {
+		case <-logEvery.C:
+			log.Info("Progress", "block", f.Number, "blocks", verifier.Blocks, "verified in backup", verifier.Verified, "missing in backup", verifier.Missing)
+		default:
+		}
+	}
+}
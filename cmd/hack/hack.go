@@ -859,11 +859,11 @@ func validateTxLookups2(db kv.RwDB, startBlock uint64, interruptCh chan bool) {
 		panic(err)
 	}
 	defer tx.Rollback()
+	blockReader := snapshotsync.NewBlockReader()
 	blockNum := startBlock
 	iterations := 0
 	var interrupt bool
 	// Validation Process
-	blockBytes := big.NewInt(0)
 	for !interrupt {
 		blockHash, err := rawdb.ReadCanonicalHash(tx, blockNum)
 		tool.Check(err)
@@ -878,18 +878,15 @@ func validateTxLookups2(db kv.RwDB, startBlock uint64, interruptCh chan bool) {
 			log.Info("interrupted, please wait for cleanup...")
 		default:
 		}
-		blockBytes.SetUint64(blockNum)
-		bn := blockBytes.Bytes()
-
 		for _, txn := range body.Transactions {
-			val, err := tx.GetOne(kv.TxLookup, txn.Hash().Bytes())
+			val, err := rawdb.ReadTxLookupEntry(context.Background(), tx, blockReader, txn.Hash())
 			iterations++
 			if iterations%100000 == 0 {
 				log.Info("Validated", "entries", iterations, "number", blockNum)
 			}
-			if !bytes.Equal(val, bn) {
+			if val == nil || *val != blockNum {
 				tool.Check(err)
-				panic(fmt.Sprintf("Validation process failed(%d). Expected %b, got %b", iterations, bn, val))
+				panic(fmt.Sprintf("Validation process failed(%d). Expected %d, got %v", iterations, blockNum, val))
 			}
 		}
 		blockNum++
@@ -2273,6 +2270,9 @@ func scanReceipts2(chaindata string) error {
 			return err
 		}
 		var receipts types.Receipts
+		if v, err = rawdb.DecodeReceiptsValue(tx, v); err != nil {
+			return err
+		}
 		if err = cbor.Unmarshal(&receipts, bytes.NewReader(v)); err == nil {
 			broken := false
 			for _, receipt := range receipts {
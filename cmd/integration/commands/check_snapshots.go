@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/anacrolix/torrent/storage"
+	"github.com/ledgerwatch/erigon/cmd/downloader/downloader"
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+)
+
+var cmdCheckSnapshots = &cobra.Command{
+	Use:   "check_snapshots",
+	Short: "Re-hash downloaded snapshot files against their .torrent files and mark corrupted pieces for re-download by next start of downloader",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, _ := utils.RootContext()
+		if err := checkSnapshots(ctx, path.Join(datadir, "snapshots")); err != nil {
+			log.Error(err.Error())
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	withDatadir(cmdCheckSnapshots)
+	rootCmd.AddCommand(cmdCheckSnapshots)
+}
+
+func checkSnapshots(ctx context.Context, snapshotDir string) error {
+	completion, err := storage.NewBoltPieceCompletion(snapshotDir)
+	if err != nil {
+		return fmt.Errorf("open pieces completion db (downloader must be stopped, or use its --audit.interval instead): %w", err)
+	}
+	defer completion.Close()
+
+	corrupted, err := downloader.Audit(ctx, snapshotDir, completion)
+	if err != nil {
+		return err
+	}
+	if len(corrupted) == 0 {
+		log.Info("All downloaded snapshots are correct")
+		return nil
+	}
+	for _, file := range corrupted {
+		log.Warn("Corrupted", "file", file.Name, "bad pieces", len(file.BadPieces))
+	}
+	if err = downloader.MarkCorrupted(completion, corrupted); err != nil {
+		return err
+	}
+	return fmt.Errorf("%d files are corrupted, downloader will re-download their bad pieces on next start", len(corrupted))
+}
@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/core/rawdb/gethfreezer"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ancientDir       string
+	ancientThreshold uint64
+)
+
+var cmdExportAncient = &cobra.Command{
+	Use:   "export_ancient",
+	Short: "Export headers, bodies and receipts older than threshold into geth's ancient store format (point geth --datadir.ancient to the result)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, _ := utils.RootContext()
+		logger := log.New()
+		db := openDB(chaindata, logger, true)
+		defer db.Close()
+
+		if err := exportAncient(ctx, db); err != nil {
+			log.Error(err.Error())
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	withDatadir(cmdExportAncient)
+	withChain(cmdExportAncient)
+	cmdExportAncient.Flags().StringVar(&ancientDir, "ancient.dir", "", "path to the new geth ancient store (must not exist or be empty)")
+	must(cmdExportAncient.MarkFlagRequired("ancient.dir"))
+	cmdExportAncient.Flags().Uint64Var(&ancientThreshold, "ancient.threshold", params.FullImmutabilityThreshold, "amount of recent blocks which are not frozen, same as geth's freeze threshold")
+
+	rootCmd.AddCommand(cmdExportAncient)
+}
+
+func exportAncient(ctx context.Context, db kv.RoDB) error {
+	return db.View(ctx, func(tx kv.Tx) error {
+		progress, err := stages.GetStageProgress(tx, stages.Execution)
+		if err != nil {
+			return err
+		}
+		if progress <= ancientThreshold {
+			return fmt.Errorf("nothing to export: executed up to block %d, threshold %d", progress, ancientThreshold)
+		}
+		_, chainConfig := byChain()
+		return gethfreezer.Export(ctx, tx, getBlockReader(chainConfig), ancientDir, progress-ancientThreshold)
+	})
+}
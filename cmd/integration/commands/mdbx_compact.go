@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	mdbx2 "github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/node"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+	"github.com/torquem-ch/mdbx-go/mdbx"
+)
+
+var cmdMdbxCompact = &cobra.Command{
+	Use:   "mdbx_compact",
+	Short: "copy '--chaindata' with compaction, Erigon can keep running. Copy replaces database on next start of Erigon",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, _ := utils.RootContext()
+		logger := log.New()
+		err := mdbxCompact(ctx, logger, chaindata)
+		if err != nil {
+			log.Error(err.Error())
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	withDatadir(cmdMdbxCompact)
+
+	rootCmd.AddCommand(cmdMdbxCompact)
+}
+
+// mdbxCompact - copies consistent snapshot of database (one read transaction) into '<chaindata>.compact'. Copy is
+// written by appends - without free pages and with filled pages. Blocks which Erigon processes after start of copy
+// are not in copy, they will be synced again after restart.
+func mdbxCompact(ctx context.Context, logger log.Logger, chaindata string) error {
+	tmpPath := chaindata + node.CompactedSuffix + ".tmp"
+	if err := os.RemoveAll(tmpPath); err != nil {
+		return err
+	}
+	src := mdbx2.NewMDBX(logger).Path(chaindata).Flags(func(flags uint) uint { return mdbx.Readonly | mdbx.Accede }).MustOpen()
+	defer src.Close()
+	dst := mdbx2.NewMDBX(logger).Path(tmpPath).MustOpen()
+	if err := kv2kv(ctx, src, dst); err != nil {
+		dst.Close()
+		return err
+	}
+	dst.Close()
+
+	// rename is the commit point: partial copy is never used
+	compacted := chaindata + node.CompactedSuffix
+	if err := os.RemoveAll(compacted); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, compacted); err != nil {
+		return err
+	}
+	log.Info("Compacted copy created, it will replace database on next start of Erigon", "path", compacted,
+		"size", dataFileSize(chaindata), "compacted", dataFileSize(compacted))
+	return nil
+}
+
+func dataFileSize(dbPath string) string {
+	info, err := os.Stat(filepath.Join(dbPath, "mdbx.dat"))
+	if err != nil {
+		return "unknown"
+	}
+	return libcommon.ByteCount(uint64(info.Size()))
+}
@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/migrations"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+)
+
+var migrateDryRun, migrateAllowMajorUpgrade bool
+
+var cmdMigrate = &cobra.Command{
+	Use:   "migrate",
+	Short: "Convert datadir to table layout of this version of Erigon in place, instead of resync",
+	Long: `Convert datadir to table layout of this version of Erigon in place, instead of resync: print the schema version of
+the DB, applied and pending migrations with estimated time and disk space, then apply pending migrations.
+Progress is logged periodically. It's safe to interrupt: on next run (or start of Erigon) migration resumes from
+the last checkpoint. Erigon must be stopped.
+--allow.major.upgrade applies migrations to DB which is more than 1 major version behind (Erigon refuses it on start).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db := openKV(kv.ChainDB, log.New(), chaindata, !migrateDryRun)
+		defer db.Close()
+		migrator := migrations.NewMigrator(kv.ChainDB)
+		migrator.AllowMajorUpgrade = migrateAllowMajorUpgrade
+		return migrate(db, migrator)
+	},
+}
+
+func init() {
+	withDatadir(cmdMigrate)
+	cmdMigrate.Flags().BoolVar(&migrateDryRun, "dry-run", false, "print status and pending migrations without applying them")
+	cmdMigrate.Flags().BoolVar(&migrateAllowMajorUpgrade, "allow.major.upgrade", false, "apply migrations to DB which is more than 1 major version behind")
+
+	rootCmd.AddCommand(cmdMigrate)
+}
+
+func migrate(db kv.RwDB, migrator *migrations.Migrator) error {
+	status, err := migrator.Status(db)
+	if err != nil {
+		return err
+	}
+	version := status.SchemaVersion
+	if version == "" {
+		version = "none"
+	}
+	log.Info("DB schema", "version", version, "erigon", fmt.Sprintf("%d.%d.%d", kv.DBSchemaVersion.Major, kv.DBSchemaVersion.Minor, kv.DBSchemaVersion.Patch))
+	log.Info("Applied", "migrations", strings.Join(status.Applied, " "))
+	if len(status.Unknown) > 0 {
+		log.Warn("Applied migrations unknown to this version: DB was migrated by newer version or other fork, their tables may be left as is", "migrations", strings.Join(status.Unknown, " "))
+	}
+	if len(status.Pending) == 0 {
+		log.Info("No pending migrations")
+		return nil
+	}
+	for _, p := range status.Pending {
+		log.Info("Pending migration " + p.String())
+	}
+	if status.MajorUpgrade() && !migrator.AllowMajorUpgrade {
+		return fmt.Errorf("DB version %s is more than 1 major version behind, use --allow.major.upgrade if you know what you are doing", status.SchemaVersion)
+	}
+	if migrateDryRun {
+		return nil
+	}
+	if err := migrator.Apply(db, datadir); err != nil {
+		return err
+	}
+	log.Info("Datadir migrated", "migrations", len(status.Pending))
+	return nil
+}
@@ -0,0 +1,322 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ledgerwatch/erigon-lib/common/length"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/changeset"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/ethdb/cbor"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/statediff"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+)
+
+var (
+	queryPrefix, queryFrom, queryTo string
+	queryLimit                      uint64
+	queryDecode                     string
+)
+
+var cmdQuery = &cobra.Command{
+	Use:   "query",
+	Short: "Print rows of '--bucket' table as JSON lines, with keys and values decoded",
+	Long: `Print rows of '--bucket' table as JSON lines: {"key": ..., "block": ..., "value": ...}.
+"block" is set for tables whose keys start with block number. Keys of --prefix, --from and --to are 0x-prefixed hex or
+decimal block numbers (8 bytes big-endian), for example:
+  integration query --datadir=... --bucket=Header --from=1000 --limit=2
+  integration query --datadir=... --bucket=PlainState --prefix=0x3ee18b2214aff97000d974cf647e7c347e8fa585`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, _ := utils.RootContext()
+		db := openDB(chaindata, log.New(), false)
+		defer db.Close()
+		return query(ctx, db, os.Stdout)
+	},
+}
+
+func init() {
+	withDatadir(cmdQuery)
+	withBucket(cmdQuery)
+	cmdQuery.Flags().StringVar(&queryPrefix, "prefix", "", "print only keys with this prefix")
+	cmdQuery.Flags().StringVar(&queryFrom, "from", "", "first key, inclusive")
+	cmdQuery.Flags().StringVar(&queryTo, "to", "", "last key, exclusive")
+	cmdQuery.Flags().Uint64Var(&queryLimit, "limit", 100, "max amount of rows, 0 - no limit")
+	cmdQuery.Flags().StringVar(&queryDecode, "decode", "auto", "decoder of values: auto - by table, "+strings.Join(queryDecoderNames(), ", "))
+
+	rootCmd.AddCommand(cmdQuery)
+}
+
+// queryRow - printed row of the table
+type queryRow struct {
+	Key   hexutil.Bytes `json:"key"`
+	Block *uint64       `json:"block,omitempty"`
+	Value interface{}   `json:"value"`
+}
+
+// queryDecoder - JSON-friendly form of the row of table
+type queryDecoder func(tx kv.Tx, table string, k, v []byte) (interface{}, error)
+
+var queryDecoders = map[string]queryDecoder{
+	"hex": func(tx kv.Tx, table string, k, v []byte) (interface{}, error) {
+		return hexutil.Bytes(v), nil
+	},
+	"uint64": func(tx kv.Tx, table string, k, v []byte) (interface{}, error) {
+		if len(v) != 8 {
+			return nil, fmt.Errorf("value of %d bytes is not uint64", len(v))
+		}
+		return binary.BigEndian.Uint64(v), nil
+	},
+	"rlp": func(tx kv.Tx, table string, k, v []byte) (interface{}, error) {
+		return decodeRLPItems(v)
+	},
+	"header": func(tx kv.Tx, table string, k, v []byte) (interface{}, error) {
+		h := new(types.Header)
+		if err := rlp.DecodeBytes(v, h); err != nil {
+			return nil, err
+		}
+		return h, nil
+	},
+	"body": func(tx kv.Tx, table string, k, v []byte) (interface{}, error) {
+		b := new(types.BodyForStorage)
+		if err := rlp.DecodeBytes(v, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	},
+	"tx": func(tx kv.Tx, table string, k, v []byte) (interface{}, error) {
+		return types.UnmarshalTransactionFromBinary(v)
+	},
+	"receipts": func(tx kv.Tx, table string, k, v []byte) (interface{}, error) {
+		data, err := rawdb.DecodeReceiptsValue(tx, v)
+		if err != nil {
+			return nil, err
+		}
+		var receipts types.Receipts
+		if err = cbor.Unmarshal(&receipts, bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+		return receipts, nil
+	},
+	"logs": func(tx kv.Tx, table string, k, v []byte) (interface{}, error) {
+		return rawdb.UnmarshalLogs(tx, v)
+	},
+	"account": func(tx kv.Tx, table string, k, v []byte) (interface{}, error) {
+		return decodeQueryAccount(v)
+	},
+	"state": func(tx kv.Tx, table string, k, v []byte) (interface{}, error) {
+		if len(k) == length.Addr {
+			return decodeQueryAccount(v)
+		}
+		return hexutil.Bytes(v), nil
+	},
+	"changeset": func(tx kv.Tx, table string, k, v []byte) (interface{}, error) {
+		m, ok := changeset.Mapper[table]
+		if !ok {
+			return nil, fmt.Errorf("%s is not a changeset table", table)
+		}
+		blockNum, key, value := m.Decode(k, v)
+		change := struct {
+			Block uint64        `json:"block"`
+			Key   hexutil.Bytes `json:"key"`
+			Value interface{}   `json:"value"`
+		}{Block: blockNum, Key: key, Value: hexutil.Bytes(value)}
+		if table == kv.AccountChangeSet && len(value) > 0 {
+			acc, err := decodeQueryAccount(value)
+			if err != nil {
+				return nil, err
+			}
+			change.Value = acc
+		}
+		return change, nil
+	},
+	"statediff": func(tx kv.Tx, table string, k, v []byte) (interface{}, error) {
+		diff := new(statediff.Tx)
+		if err := rlp.DecodeBytes(v, diff); err != nil {
+			return nil, err
+		}
+		return diff, nil
+	},
+}
+
+// queryTableDecoders - decoders of "auto"
+var queryTableDecoders = map[string]string{
+	kv.Headers:           "header",
+	kv.HeaderCanonical:   "hex",
+	kv.HeaderNumber:      "uint64",
+	kv.BlockBody:         "body",
+	kv.EthTx:             "tx",
+	kv.NonCanonicalTxs:   "tx",
+	kv.Receipts:          "receipts",
+	kv.Log:               "logs",
+	kv.PlainState:        "state",
+	kv.AccountChangeSet:  "changeset",
+	kv.StorageChangeSet:  "changeset",
+	kv.SyncStageProgress: "uint64",
+	rawdb.StateDiffs:     "statediff",
+}
+
+// queryBlockKeyedTables - tables whose keys start with block number
+var queryBlockKeyedTables = map[string]bool{
+	kv.Headers:          true,
+	kv.HeaderCanonical:  true,
+	kv.HeaderTD:         true,
+	kv.BlockBody:        true,
+	kv.Receipts:         true,
+	kv.Log:              true,
+	kv.AccountChangeSet: true,
+	kv.StorageChangeSet: true,
+	kv.CallTraceSet:     true,
+	rawdb.StateDiffs:    true,
+}
+
+func queryDecoderNames() []string {
+	names := make([]string, 0, len(queryDecoders))
+	for name := range queryDecoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func decodeQueryAccount(v []byte) (interface{}, error) {
+	var acc accounts.Account
+	if err := acc.DecodeForStorage(v); err != nil {
+		return nil, err
+	}
+	return struct {
+		Nonce       uint64       `json:"nonce"`
+		Balance     *hexutil.Big `json:"balance"`
+		CodeHash    common.Hash  `json:"codeHash"`
+		Incarnation uint64       `json:"incarnation"`
+	}{Nonce: acc.Nonce, Balance: (*hexutil.Big)(acc.Balance.ToBig()), CodeHash: acc.CodeHash, Incarnation: acc.Incarnation}, nil
+}
+
+// decodeRLPItems - RLP as nested arrays of hex strings
+func decodeRLPItems(b []byte) (interface{}, error) {
+	kind, content, rest, err := rlp.Split(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%d bytes after RLP item", len(rest))
+	}
+	if kind != rlp.List {
+		return hexutil.Bytes(content), nil
+	}
+	items := []interface{}{}
+	for len(content) > 0 {
+		_, _, rest, err := rlp.Split(content)
+		if err != nil {
+			return nil, err
+		}
+		item, err := decodeRLPItems(content[:len(content)-len(rest)])
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		content = rest
+	}
+	return items, nil
+}
+
+// parseQueryKey - 0x-prefixed hex, or decimal block number
+func parseQueryKey(s string) ([]byte, error) {
+	if strings.HasPrefix(s, "0x") {
+		return hexutil.Decode(s)
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("key %q is neither 0x-prefixed hex nor block number", s)
+	}
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, n)
+	return k, nil
+}
+
+func query(ctx context.Context, db kv.RoDB, w io.Writer) error {
+	if _, ok := kv.ChaindataTablesCfg[bucket]; !ok {
+		return fmt.Errorf("unknown table %q", bucket)
+	}
+	decoderName := queryDecode
+	if decoderName == "auto" {
+		if decoderName = queryTableDecoders[bucket]; decoderName == "" {
+			decoderName = "hex"
+		}
+	}
+	decode, ok := queryDecoders[decoderName]
+	if !ok {
+		return fmt.Errorf("unknown decoder %q, supported: auto, %s", decoderName, strings.Join(queryDecoderNames(), ", "))
+	}
+	var prefix, from, to []byte
+	var err error
+	for _, key := range []struct {
+		s string
+		k *[]byte
+	}{{queryPrefix, &prefix}, {queryFrom, &from}, {queryTo, &to}} {
+		if key.s == "" {
+			continue
+		}
+		if *key.k, err = parseQueryKey(key.s); err != nil {
+			return err
+		}
+	}
+	if bytes.Compare(from, prefix) < 0 {
+		from = prefix
+	}
+
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	c, err := tx.Cursor(bucket)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	enc := json.NewEncoder(w)
+	var rows uint64
+	for k, v, err := c.Seek(from); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(k, prefix) || (to != nil && bytes.Compare(k, to) >= 0) {
+			break
+		}
+		if queryLimit > 0 && rows >= queryLimit {
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		row := queryRow{Key: k}
+		if queryBlockKeyedTables[bucket] && len(k) >= 8 {
+			blockNum := binary.BigEndian.Uint64(k)
+			row.Block = &blockNum
+		}
+		if row.Value, err = decode(tx, bucket, k, v); err != nil {
+			return fmt.Errorf("decode %x as %s: %w", k, decoderName, err)
+		}
+		if err = enc.Encode(row); err != nil {
+			return err
+		}
+		rows++
+	}
+	return nil
+}
@@ -13,6 +13,7 @@ import (
 	mdbx2 "github.com/ledgerwatch/erigon-lib/kv/mdbx"
 	"github.com/ledgerwatch/erigon/cmd/utils"
 	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/log/v3"
 	"github.com/spf13/cobra"
 	"github.com/torquem-ch/mdbx-go/mdbx"
@@ -32,7 +33,7 @@ var stateBuckets = []string{
 	kv.TrieOfStorage,
 	kv.AccountsHistory,
 	kv.StorageHistory,
-	kv.TxLookup,
+	rawdb.TxLookupCompact,
 	kv.ContractTEVMCode,
 }
 
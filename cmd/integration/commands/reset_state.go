@@ -9,6 +9,7 @@ import (
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/cmd/utils"
 	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/eth/stagedsync"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 	"github.com/ledgerwatch/erigon/ethdb/prune"
@@ -62,6 +63,9 @@ func resetState(db kv.RwDB, logger log.Logger, ctx context.Context) error {
 	if err := db.Update(ctx, resetCallTraces); err != nil {
 		return err
 	}
+	if err := db.Update(ctx, resetAddressAppearances); err != nil {
+		return err
+	}
 	if err := db.Update(ctx, resetTxLookup); err != nil {
 		return err
 	}
@@ -132,6 +136,15 @@ func resetExec(tx kv.RwTx, g *core.Genesis) error {
 	if err := tx.ClearBucket(kv.CallTraceSet); err != nil {
 		return err
 	}
+	if err := tx.ClearBucket(rawdb.CallSelectorSet); err != nil {
+		return err
+	}
+	if err := tx.ClearBucket(rawdb.CodeHistory); err != nil {
+		return err
+	}
+	if err := tx.ClearBucket(rawdb.TxCallSet); err != nil {
+		return err
+	}
 	if err := tx.ClearBucket(kv.Epoch); err != nil {
 		return err
 	}
@@ -197,6 +210,9 @@ func resetCallTraces(tx kv.RwTx) error {
 	if err := tx.ClearBucket(kv.CallToIndex); err != nil {
 		return err
 	}
+	if err := tx.ClearBucket(rawdb.CallSelectorIndex); err != nil {
+		return err
+	}
 	if err := stages.SaveStageProgress(tx, stages.CallTraces, 0); err != nil {
 		return err
 	}
@@ -206,10 +222,29 @@ func resetCallTraces(tx kv.RwTx) error {
 	return nil
 }
 
+func resetAddressAppearances(tx kv.RwTx) error {
+	if err := tx.ClearBucket(rawdb.AppearanceIndex); err != nil {
+		return err
+	}
+	if err := stages.SaveStageProgress(tx, stages.AddressAppearances, 0); err != nil {
+		return err
+	}
+	if err := stages.SaveStagePruneProgress(tx, stages.AddressAppearances, 0); err != nil {
+		return err
+	}
+	return nil
+}
+
 func resetTxLookup(tx kv.RwTx) error {
 	if err := tx.ClearBucket(kv.TxLookup); err != nil {
 		return err
 	}
+	if err := tx.ClearBucket(rawdb.TxLookupCompact); err != nil {
+		return err
+	}
+	if err := tx.ClearBucket(rawdb.UncleInclusion); err != nil {
+		return err
+	}
 	if err := stages.SaveStageProgress(tx, stages.TxLookup, 0); err != nil {
 		return err
 	}
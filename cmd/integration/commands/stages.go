@@ -260,6 +260,43 @@ var cmdRemoveMigration = &cobra.Command{
 	},
 }
 
+var cmdMigrationsDryRun = &cobra.Command{
+	Use:   "migrations_dry_run",
+	Short: "Print pending migrations with estimated time and disk space, without applying them",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := log.New()
+		db := openDB(chaindata, logger, false)
+		defer db.Close()
+		plans, err := migrations.NewMigrator(kv.ChainDB).DryRun(db)
+		if err != nil {
+			log.Error("Error", "err", err)
+			return err
+		}
+		if len(plans) == 0 {
+			log.Info("No pending migrations")
+		}
+		for _, p := range plans {
+			log.Info("Pending migration " + p.String())
+		}
+		return nil
+	},
+}
+
+var cmdRollbackMigration = &cobra.Command{
+	Use:   "rollback_migration",
+	Short: "Revert migration and restore DB schema version, allows to downgrade Erigon",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := log.New()
+		db := openKV(kv.ChainDB, logger, chaindata, true)
+		defer db.Close()
+		if err := migrations.NewMigrator(kv.ChainDB).Rollback(db, migration, datadir); err != nil {
+			log.Error("Error", "err", err)
+			return err
+		}
+		return nil
+	},
+}
+
 var cmdRunMigrations = &cobra.Command{
 	Use:   "run_migrations",
 	Short: "",
@@ -384,6 +421,15 @@ func init() {
 	withChain(cmdRemoveMigration)
 	rootCmd.AddCommand(cmdRemoveMigration)
 
+	withDatadir(cmdMigrationsDryRun)
+	withChain(cmdMigrationsDryRun)
+	rootCmd.AddCommand(cmdMigrationsDryRun)
+
+	withDatadir(cmdRollbackMigration)
+	withMigration(cmdRollbackMigration)
+	withChain(cmdRollbackMigration)
+	rootCmd.AddCommand(cmdRollbackMigration)
+
 	withDatadir(cmdRunMigrations)
 	withChain(cmdRunMigrations)
 	rootCmd.AddCommand(cmdRunMigrations)
@@ -541,7 +587,7 @@ func stageSenders(db kv.RwDB, ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	cfg := stagedsync.StageSendersCfg(db, chainConfig, tmpdir, pm, allSnapshots(chainConfig))
+	cfg := stagedsync.StageSendersCfg(db, chainConfig, tmpdir, pm, allSnapshots(chainConfig), nil)
 	if unwind > 0 {
 		u := sync.NewUnwindState(stages.Senders, s.BlockNumber-unwind, s.BlockNumber)
 		err = stagedsync.UnwindSendersStage(u, tx, cfg, ctx)
@@ -589,7 +635,7 @@ func stageExec(db kv.RwDB, ctx context.Context) error {
 		pm.TxIndex = prune.Distance(s.BlockNumber - pruneTo)
 	}
 
-	cfg := stagedsync.StageExecuteBlocksCfg(db, pm, batchSize, nil, chainConfig, engine, vmConfig, nil, false, tmpdir, getBlockReader(chainConfig))
+	cfg := stagedsync.StageExecuteBlocksCfg(db, pm, batchSize, nil, nil, chainConfig, engine, vmConfig, nil, false, true, 0, tmpdir, getBlockReader(chainConfig), nil)
 	if unwind > 0 {
 		u := sync.NewUnwindState(stages.Execution, s.BlockNumber-unwind, s.BlockNumber)
 		err := stagedsync.UnwindExecutionStage(u, s, nil, ctx, cfg, false)
@@ -1067,7 +1113,7 @@ func newSync(ctx context.Context, db kv.RwDB, miningConfig *params.MiningConfig)
 		if err != nil {
 			return err
 		}
-		if err = stagedsync.UpdateMetrics(tx); err != nil {
+		if err = stagedsync.UpdateMetrics(chain, tx); err != nil {
 			return err
 		}
 		return nil
@@ -1080,13 +1126,19 @@ func newSync(ctx context.Context, db kv.RwDB, miningConfig *params.MiningConfig)
 	var engine consensus.Engine
 	config := &ethconfig.Defaults
 	var consensusConfig interface{}
-	if chainConfig.Clique != nil {
+	if _, ok := consensus.LookupEngine(chainConfig.Consensus); ok {
+		consensusConfig = &params.ExternalConsensusConfig{DBPath: path.Join(datadir, "consensus")}
+		engine = ethconfig.CreateConsensusEngine(chainConfig, logger, consensusConfig, config.Miner.Notify, config.Miner.Noverify, common.Hash{})
+	} else if chainConfig.Clique != nil {
 		c := params.CliqueSnapshot
 		c.DBPath = path.Join(datadir, "clique/db")
 		engine = ethconfig.CreateConsensusEngine(chainConfig, logger, c, config.Miner.Notify, config.Miner.Noverify, common.Hash{})
 	} else if chainConfig.Aura != nil {
 		consensusConfig = &params.AuRaConfig{DBPath: path.Join(datadir, "aura")}
 		engine = ethconfig.CreateConsensusEngine(chainConfig, logger, consensusConfig, config.Miner.Notify, config.Miner.Noverify, common.Hash{})
+	} else if chainConfig.Bor != nil {
+		consensusConfig = &params.BorConfig{DBPath: path.Join(datadir, "bor"), HeimdallURL: "http://localhost:1317"}
+		engine = ethconfig.CreateConsensusEngine(chainConfig, logger, consensusConfig, config.Miner.Notify, config.Miner.Noverify, common.Hash{})
 	} else { //ethash
 		engine = ethash.NewFaker()
 	}
@@ -1128,11 +1180,11 @@ func newSync(ctx context.Context, db kv.RwDB, miningConfig *params.MiningConfig)
 
 	miningSync := stagedsync.New(
 		stagedsync.MiningStages(ctx,
-			stagedsync.StageMiningCreateBlockCfg(db, miner, *chainConfig, engine, nil, nil, tmpdir),
-			stagedsync.StageMiningExecCfg(db, miner, events, *chainConfig, engine, &vm.Config{}, tmpdir),
+			stagedsync.StageMiningCreateBlockCfg(db, miner, chainConfig, engine, nil, nil, tmpdir),
+			stagedsync.StageMiningExecCfg(db, miner, events, chainConfig, engine, nil, &vm.Config{}, tmpdir),
 			stagedsync.StageHashStateCfg(db, tmpdir),
 			stagedsync.StageTrieCfg(db, false, true, tmpdir, getBlockReader(chainConfig)),
-			stagedsync.StageMiningFinishCfg(db, *chainConfig, engine, miner, ctx.Done()),
+			stagedsync.StageMiningFinishCfg(db, chainConfig, engine, miner, ctx.Done()),
 		),
 		stagedsync.MiningUnwindOrder,
 		stagedsync.MiningPruneOrder,
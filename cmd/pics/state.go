@@ -19,6 +19,7 @@ import (
 	"github.com/ledgerwatch/erigon/cmd/pics/contracts"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/erigon/params"
@@ -68,28 +69,28 @@ import (
 }*/
 
 var bucketLabels = map[string]string{
-	kv.Receipts:          "Receipts",
-	kv.Log:               "Event Logs",
-	kv.AccountsHistory:   "History Of Accounts",
-	kv.StorageHistory:    "History Of Storage",
-	kv.Headers:           "Headers",
-	kv.HeaderCanonical:   "Canonical headers",
-	kv.HeaderTD:          "Headers TD",
-	kv.BlockBody:         "Block Bodies",
-	kv.HeaderNumber:      "Header Numbers",
-	kv.TxLookup:          "Transaction Index",
-	kv.Code:              "Code Of Contracts",
-	kv.SyncStageProgress: "Sync Progress",
-	kv.PlainState:        "Plain State",
-	kv.HashedAccounts:    "Hashed Accounts",
-	kv.HashedStorage:     "Hashed Storage",
-	kv.TrieOfAccounts:    "Intermediate Hashes Of Accounts",
-	kv.TrieOfStorage:     "Intermediate Hashes Of Storage",
-	kv.AccountChangeSet:  "Account Changes",
-	kv.StorageChangeSet:  "Storage Changes",
-	kv.IncarnationMap:    "Incarnations",
-	kv.Senders:           "Transaction Senders",
-	kv.ContractTEVMCode:  "Contract TEVM code",
+	kv.Receipts:           "Receipts",
+	kv.Log:                "Event Logs",
+	kv.AccountsHistory:    "History Of Accounts",
+	kv.StorageHistory:     "History Of Storage",
+	kv.Headers:            "Headers",
+	kv.HeaderCanonical:    "Canonical headers",
+	kv.HeaderTD:           "Headers TD",
+	kv.BlockBody:          "Block Bodies",
+	kv.HeaderNumber:       "Header Numbers",
+	rawdb.TxLookupCompact: "Transaction Index",
+	kv.Code:               "Code Of Contracts",
+	kv.SyncStageProgress:  "Sync Progress",
+	kv.PlainState:         "Plain State",
+	kv.HashedAccounts:     "Hashed Accounts",
+	kv.HashedStorage:      "Hashed Storage",
+	kv.TrieOfAccounts:     "Intermediate Hashes Of Accounts",
+	kv.TrieOfStorage:      "Intermediate Hashes Of Storage",
+	kv.AccountChangeSet:   "Account Changes",
+	kv.StorageChangeSet:   "Storage Changes",
+	kv.IncarnationMap:     "Incarnations",
+	kv.Senders:            "Transaction Senders",
+	kv.ContractTEVMCode:   "Contract TEVM code",
 }
 
 /*dbutils.PlainContractCode,
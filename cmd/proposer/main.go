@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	txpool_proto "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedb"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus"
+	"github.com/ledgerwatch/erigon/consensus/clique"
+	"github.com/ledgerwatch/erigon/consensus/ethash"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
+	"github.com/ledgerwatch/erigon/ethdb/privateapi"
+	"github.com/ledgerwatch/erigon/internal/debug"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	stages2 "github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+)
+
+var (
+	privateApiAddr string // execution service: remote kv
+	txpoolApiAddr  string
+	miningApiAddr  string // where produced blocks are served
+
+	TLSCertfile string
+	TLSCACert   string
+	TLSKeyFile  string
+
+	etherbase string
+	sigFile   string
+	extraData string
+	gasLimit  uint64
+	gasTarget uint64
+	recommit  time.Duration
+)
+
+func init() {
+	utils.CobraFlags(rootCmd, append(debug.Flags, utils.MetricFlags...))
+	rootCmd.Flags().StringVar(&privateApiAddr, "private.api.addr", "localhost:9090", "execution service <host>:<port>, its db is only read")
+	rootCmd.Flags().StringVar(&txpoolApiAddr, "txpool.api.addr", "localhost:9094", "txpool service <host>:<port>")
+	rootCmd.Flags().StringVar(&miningApiAddr, "mining.api.addr", "localhost:9096", "serve produced blocks (txpool.Mining gRPC service: OnPendingBlock, OnMinedBlock, GetWork, SubmitWork) at <host>:<port>")
+	rootCmd.PersistentFlags().StringVar(&TLSCertfile, "tls.cert", "", "certificate for client side TLS handshake")
+	rootCmd.PersistentFlags().StringVar(&TLSKeyFile, "tls.key", "", "key file for client side TLS handshake")
+	rootCmd.PersistentFlags().StringVar(&TLSCACert, "tls.cacert", "", "CA certificate for client side TLS handshake")
+
+	rootCmd.Flags().StringVar(&etherbase, utils.MinerEtherbaseFlag.Name, "", utils.MinerEtherbaseFlag.Usage)
+	rootCmd.Flags().StringVar(&sigFile, utils.MinerSigningKeyFileFlag.Name, "", utils.MinerSigningKeyFileFlag.Usage+" (clique), etherbase is its address")
+	rootCmd.Flags().StringVar(&extraData, utils.MinerExtraDataFlag.Name, "", utils.MinerExtraDataFlag.Usage)
+	rootCmd.Flags().Uint64Var(&gasLimit, utils.MinerGasLimitFlag.Name, ethconfig.Defaults.Miner.GasCeil, utils.MinerGasLimitFlag.Usage)
+	rootCmd.Flags().Uint64Var(&gasTarget, utils.MinerGasTargetFlag.Name, ethconfig.Defaults.Miner.GasFloor, utils.MinerGasTargetFlag.Usage)
+	rootCmd.Flags().DurationVar(&recommit, utils.MinerRecommitIntervalFlag.Name, ethconfig.Defaults.Miner.Recommit, utils.MinerRecommitIntervalFlag.Usage)
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "proposer",
+	Short: "Produce blocks over remote db and remote txpool, without datadir",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return debug.SetupCobra(cmd)
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		debug.Exit()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		miningConfig := ethconfig.Defaults.Miner
+		miningConfig.Enabled = true
+		miningConfig.ExtraData = []byte(extraData)
+		miningConfig.GasCeil = gasLimit
+		miningConfig.GasFloor = gasTarget
+		miningConfig.Recommit = recommit
+		if sigFile != "" {
+			key, err := crypto.LoadECDSA(sigFile)
+			if err != nil {
+				return fmt.Errorf("--%s: %w", utils.MinerSigningKeyFileFlag.Name, err)
+			}
+			miningConfig.SigKey = key
+			miningConfig.Etherbase = crypto.PubkeyToAddress(key.PublicKey)
+		} else if etherbase != "" {
+			miningConfig.Etherbase = common.HexToAddress(etherbase)
+		} else {
+			return fmt.Errorf("--%s or --%s is required", utils.MinerEtherbaseFlag.Name, utils.MinerSigningKeyFileFlag.Name)
+		}
+
+		creds, err := grpcutil.TLS(TLSCACert, TLSCertfile, TLSKeyFile)
+		if err != nil {
+			return fmt.Errorf("could not connect to remoteKv: %w", err)
+		}
+		coreConn, err := grpcutil.Connect(creds, privateApiAddr)
+		if err != nil {
+			return fmt.Errorf("could not connect to remoteKv: %w", err)
+		}
+		coreDB, err := remotedb.NewRemote(gointerfaces.VersionFromProto(remotedbserver.KvServiceAPIVersion), log.New(), remote.NewKVClient(coreConn)).Open()
+		if err != nil {
+			return fmt.Errorf("could not connect to remoteKv: %w", err)
+		}
+		defer coreDB.Close()
+		txpoolConn, err := grpcutil.Connect(creds, txpoolApiAddr)
+		if err != nil {
+			return fmt.Errorf("could not connect to txpool: %w", err)
+		}
+
+		var chainConfig *params.ChainConfig
+		if err := coreDB.View(ctx, func(tx kv.Tx) error {
+			genesisHash, err := rawdb.ReadCanonicalHash(tx, 0)
+			if err != nil {
+				return err
+			}
+			chainConfig, err = rawdb.ReadChainConfig(tx, genesisHash)
+			return err
+		}); err != nil {
+			return fmt.Errorf("read chain config: %w", err)
+		}
+		if chainConfig == nil {
+			return errors.New("chain config not found, execution service has no genesis yet")
+		}
+		engine, ethashApi, err := newEngine(chainConfig, &miningConfig)
+		if err != nil {
+			return err
+		}
+		log.Info("Proposer started", "chain", chainConfig.ChainName, "etherbase", miningConfig.Etherbase, "db", privateApiAddr, "txpool", txpoolApiAddr)
+
+		tmpdir, err := os.MkdirTemp("", "proposer")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmpdir)
+		miner := stagedsync.NewMiningState(&miningConfig)
+		txSource := stagedsync.NewRemoteTxSource(txpool_proto.NewTxpoolClient(txpoolConn))
+		mining := stagedsync.New(
+			stagedsync.MiningStages(ctx,
+				stagedsync.StageMiningCreateBlockCfg(nil, miner, chainConfig, engine, txSource, nil, tmpdir),
+				stagedsync.StageMiningExecCfg(nil, miner, nil, chainConfig, engine, nil, &vm.Config{}, tmpdir),
+				stagedsync.StageHashStateCfg(nil, tmpdir),
+				stagedsync.StageTrieCfg(nil, false, true, tmpdir, snapshotsync.NewBlockReader()),
+				stagedsync.StageMiningFinishCfg(nil, chainConfig, engine, miner, ctx.Done()),
+			), stagedsync.MiningUnwindOrder, stagedsync.MiningPruneOrder)
+
+		miningServer := privateapi.NewMiningServer(ctx, isMining{}, ethashApi)
+		grpcServer := grpcutil.NewServer(0, nil)
+		txpool_proto.RegisterMiningServer(grpcServer, miningServer)
+		lis, err := net.Listen("tcp", miningApiAddr)
+		if err != nil {
+			return fmt.Errorf("could not create listener: %w, addr=%s", err, miningApiAddr)
+		}
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Error("mining gRPC server fail", "err", err)
+			}
+		}()
+		defer grpcServer.GracefulStop()
+
+		go broadcastBlocks(ctx, miner, miningServer)
+		return mineLoop(ctx, coreDB, mining, recommit)
+	},
+}
+
+type isMining struct{}
+
+func (isMining) IsMining() bool { return true }
+
+// newEngine - consensus engine which keeps its data in memory
+func newEngine(chainConfig *params.ChainConfig, cfg *params.MiningConfig) (consensus.Engine, *ethash.API, error) {
+	switch {
+	case chainConfig.Clique != nil:
+		if cfg.SigKey == nil {
+			return nil, nil, fmt.Errorf("clique needs --%s", utils.MinerSigningKeyFileFlag.Name)
+		}
+		engine := clique.New(chainConfig, params.CliqueSnapshot, clique.OpenDatabase("", log.New(), true))
+		key := cfg.SigKey
+		engine.Authorize(cfg.Etherbase, func(_ common.Address, mimeType string, message []byte) ([]byte, error) {
+			return crypto.Sign(crypto.Keccak256(message), key)
+		})
+		return engine, nil, nil
+	case chainConfig.Consensus == params.EtHashConsensus:
+		// blocks are sealed by remote miners through GetWork/SubmitWork
+		engine := ethash.New(ethash.Config{CachesInMem: 2, DatasetsInMem: 1}, nil, false)
+		return engine, engine.APIs(nil)[1].Service.(*ethash.API), nil
+	}
+	return nil, nil, fmt.Errorf("consensus %s is not supported by proposer", chainConfig.Consensus)
+}
+
+func broadcastBlocks(ctx context.Context, miner stagedsync.MiningState, miningServer *privateapi.MiningServer) {
+	for {
+		select {
+		case b := <-miner.MiningResultCh:
+			log.Info("Block sealed", "number", b.NumberU64(), "hash", b.Hash(), "txs", b.Transactions().Len())
+			if err := miningServer.BroadcastMinedBlock(b); err != nil {
+				log.Error("mined block broadcast", "err", err)
+			}
+		case b := <-miner.PendingResultCh:
+			if err := miningServer.BroadcastPendingBlock(b); err != nil {
+				log.Error("pending block broadcast", "err", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// mineLoop - builds block on top of the head of remote db every recommit interval, one at a time
+func mineLoop(ctx context.Context, db kv.RoDB, mining *stagedsync.Sync, recommit time.Duration) error {
+	mineEvery := time.NewTicker(recommit)
+	defer mineEvery.Stop()
+	for {
+		if err := stages2.MiningStepInMemory(ctx, db, mining); err != nil {
+			if errors.Is(err, libcommon.ErrStopped) || ctx.Err() != nil {
+				return nil
+			}
+			log.Warn("mining", "err", err)
+		}
+		select {
+		case <-mineEvery.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func main() {
+	ctx, cancel := utils.RootContext()
+	defer cancel()
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,246 @@
+// Package beaconproxy serves selected Beacon API endpoints (headers, blocks, validators) of a consensus layer node
+// from HTTP endpoint of rpcdaemon, so one endpoint serves both execution and consensus layer data. Responses are
+// cached: addressed by block/state root - until evicted, by other ids (head, finalized, slot) - for one slot.
+// Clients authenticate by token of rpcdaemon, credentials of consensus layer node (user info of its URL) are added
+// by the proxy and not exposed to clients.
+package beaconproxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/c2h5oh/datasize"
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/ledgerwatch/erigon/turbo/authtoken"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	PathPrefix       = "/eth/"
+	DefaultCacheSize = 256 * datasize.MB
+	// DefaultTTL - responses for mutable ids (head, slot number) are valid for one slot
+	DefaultTTL     = 12 * time.Second
+	requestTimeout = 30 * time.Second
+	maxCachedBody  = 8 << 20 // validators of mainnet state are hundreds of MB - streamed, not cached
+	maxCacheItems  = 1 << 16 // bound of lru, cache is limited by size of bodies
+	rootIDPrefix   = "0x"
+)
+
+var (
+	cacheHits   = metrics.GetOrCreateCounter(`beacon_proxy_requests{result="hit"}`)
+	cacheMisses = metrics.GetOrCreateCounter(`beacon_proxy_requests{result="miss"}`)
+	upstreamErr = metrics.GetOrCreateCounter(`beacon_proxy_requests{result="error"}`)
+)
+
+// routes - proxied endpoints, first group is block or state id (if the endpoint has one)
+var routes = []*regexp.Regexp{
+	regexp.MustCompile(`^/eth/v1/beacon/headers$`),
+	regexp.MustCompile(`^/eth/v1/beacon/headers/([^/]+)$`),
+	regexp.MustCompile(`^/eth/v[12]/beacon/blocks/([^/]+)$`),
+	regexp.MustCompile(`^/eth/v1/beacon/blocks/([^/]+)/root$`),
+	regexp.MustCompile(`^/eth/v1/beacon/states/([^/]+)/validators$`),
+	regexp.MustCompile(`^/eth/v1/beacon/states/([^/]+)/validators/[^/]+$`),
+	regexp.MustCompile(`^/eth/v1/beacon/states/([^/]+)/validator_balances$`),
+}
+
+type Config struct {
+	Upstream  string            // REST endpoint of consensus layer node, may contain user:password
+	AuthToken string            // if set, clients need header "Authorization: Bearer <token>"
+	CacheSize datasize.ByteSize // total size of cached response bodies
+	TTL       time.Duration
+}
+
+type Proxy struct {
+	upstream  *url.URL
+	user      *url.Userinfo
+	authToken string
+	ttl       time.Duration
+	client    *http.Client
+
+	cacheLock  sync.Mutex // guards cache and cacheSize
+	cache      *simplelru.LRU
+	cacheSize  int // bytes of cached bodies
+	cacheLimit int
+}
+
+type response struct {
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time // zero - never
+}
+
+func New(cfg Config) (*Proxy, error) {
+	u, err := url.Parse(strings.TrimSuffix(cfg.Upstream, "/"))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid beacon api address")
+	}
+	if cfg.CacheSize == 0 {
+		cfg.CacheSize = DefaultCacheSize
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	p := &Proxy{upstream: u, user: u.User, authToken: cfg.AuthToken, ttl: cfg.TTL, client: &http.Client{Timeout: requestTimeout}, cacheLimit: int(cfg.CacheSize)}
+	// eviction callback is called under cacheLock
+	if p.cache, err = simplelru.NewLRU(maxCacheItems, func(_, value interface{}) { p.cacheSize -= len(value.(*response).body) }); err != nil {
+		return nil, err
+	}
+	p.upstream.User = nil
+	return p, nil
+}
+
+// Wrap - serves Beacon API paths by the proxy, other requests by next
+func (p *Proxy) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, PathPrefix) {
+			p.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET requests are proxied")
+		return
+	}
+	if p.authToken != "" && !authtoken.Matches(r.Header.Get(authtoken.Header), p.authToken) {
+		writeError(w, http.StatusUnauthorized, "header 'Authorization: Bearer <token>' is required")
+		return
+	}
+	immutable, ok := match(r.URL.Path)
+	if !ok {
+		writeError(w, http.StatusNotFound, "endpoint is not proxied")
+		return
+	}
+	accept := r.Header.Get("Accept")
+	key := accept + " " + r.URL.RequestURI()
+	if resp, ok := p.cached(key); ok {
+		cacheHits.Inc()
+		resp.write(w)
+		return
+	}
+	cacheMisses.Inc()
+
+	upstreamResp, err := p.get(r, accept)
+	if err != nil {
+		upstreamErr.Inc()
+		log.Debug("[beacon proxy] Upstream request failed", "path", r.URL.Path, "err", err)
+		writeError(w, http.StatusBadGateway, "consensus layer node is not available")
+		return
+	}
+	defer upstreamResp.Body.Close()
+	resp := &response{status: upstreamResp.StatusCode, contentType: upstreamResp.Header.Get("Content-Type")}
+	if resp.body, err = io.ReadAll(io.LimitReader(upstreamResp.Body, maxCachedBody+1)); err != nil {
+		upstreamErr.Inc()
+		writeError(w, http.StatusBadGateway, "consensus layer node is not available")
+		return
+	}
+	if len(resp.body) > maxCachedBody { // too big to cache - stream the rest
+		resp.write(w)
+		_, _ = io.Copy(w, upstreamResp.Body)
+		return
+	}
+	if resp.status == http.StatusOK {
+		if !immutable {
+			resp.expires = time.Now().Add(p.ttl)
+		}
+		p.add(key, resp)
+	}
+	resp.write(w)
+}
+
+// cached - not expired response, expired one is removed
+func (p *Proxy) cached(key string) (*response, bool) {
+	p.cacheLock.Lock()
+	defer p.cacheLock.Unlock()
+	cached, ok := p.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	resp := cached.(*response)
+	if resp.expires.IsZero() || time.Now().Before(resp.expires) {
+		return resp, true
+	}
+	p.cache.Remove(key)
+	return nil, false
+}
+
+// add - caches response, evicts least recently used ones while total size of bodies is over the limit
+func (p *Proxy) add(key string, resp *response) {
+	if len(resp.body) > p.cacheLimit {
+		return
+	}
+	p.cacheLock.Lock()
+	defer p.cacheLock.Unlock()
+	p.cache.Remove(key) // replaced entry is evicted with its size
+	p.cache.Add(key, resp)
+	p.cacheSize += len(resp.body)
+	for p.cacheSize > p.cacheLimit {
+		p.cache.RemoveOldest()
+	}
+}
+
+// get - request to consensus layer node with same path and query, and credentials of the node instead of client's
+func (p *Proxy) get(r *http.Request, accept string) (*http.Response, error) {
+	u := *p.upstream
+	u.Path += r.URL.Path
+	u.RawQuery = r.URL.RawQuery
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if p.user != nil {
+		password, _ := p.user.Password()
+		req.SetBasicAuth(p.user.Username(), password)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) { // don't log url
+			err = urlErr.Err
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// match - whether path is proxied, and whether its response never changes (block or state is addressed by root)
+func match(path string) (immutable bool, ok bool) {
+	for _, route := range routes {
+		m := route.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+		return len(m) > 1 && strings.HasPrefix(m[1], rootIDPrefix), true
+	}
+	return false, false
+}
+
+func (resp *response) write(w http.ResponseWriter) {
+	if resp.contentType != "" {
+		w.Header().Set("Content-Type", resp.contentType)
+	}
+	w.WriteHeader(resp.status)
+	_, _ = w.Write(resp.body)
+}
+
+// writeError - error in format of Beacon API
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"code":%d,"message":%q}`, code, message)
+}
@@ -0,0 +1,105 @@
+package beaconproxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	for path, expect := range map[string][2]bool{
+		"/eth/v1/beacon/headers":                             {false, true},
+		"/eth/v1/beacon/headers/head":                        {false, true},
+		"/eth/v2/beacon/blocks/0xabcd":                       {true, true},
+		"/eth/v1/beacon/blocks/100/root":                     {false, true},
+		"/eth/v1/beacon/states/0xabcd/validators/12":         {true, true},
+		"/eth/v1/beacon/states/finalized/validator_balances": {false, true},
+		"/eth/v1/validator/duties/proposer/1":                {false, false},
+		"/eth/v2/debug/beacon/states/head":                   {false, false},
+	} {
+		immutable, ok := match(path)
+		require.Equal(t, expect, [2]bool{immutable, ok}, path)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	var requests int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"path":%q,"query":%q,"n":%d}`, r.URL.Path, r.URL.RawQuery, requests)
+	}))
+	defer upstream.Close()
+
+	p, err := New(Config{Upstream: strings.Replace(upstream.URL, "http://", "http://user:secret@", 1) + "/", AuthToken: "token", TTL: time.Hour})
+	require.NoError(t, err)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "rpc") })
+	srv := httptest.NewServer(p.Wrap(next))
+	defer srv.Close()
+
+	get := func(path, token string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get("/", "")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "rpc", body)
+
+	status, _ = get("/eth/v1/beacon/headers/head", "")
+	require.Equal(t, http.StatusUnauthorized, status)
+	status, _ = get("/eth/v1/beacon/headers/head", "wrong")
+	require.Equal(t, http.StatusUnauthorized, status)
+	status, _ = get("/eth/v1/node/identity", "token")
+	require.Equal(t, http.StatusNotFound, status)
+	require.Equal(t, 0, requests)
+
+	status, body = get("/eth/v1/beacon/headers?slot=5", "token")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, `{"path":"/eth/v1/beacon/headers","query":"slot=5","n":1}`, body)
+	_, body = get("/eth/v1/beacon/headers?slot=5", "token")
+	require.Equal(t, `{"path":"/eth/v1/beacon/headers","query":"slot=5","n":1}`, body)
+	require.Equal(t, 1, requests)
+
+	// mutable ids expire after TTL, roots don't
+	p.ttl = -time.Second
+	_, body = get("/eth/v2/beacon/blocks/head", "token")
+	require.Contains(t, body, `"n":2`)
+	_, body = get("/eth/v2/beacon/blocks/head", "token")
+	require.Contains(t, body, `"n":3`)
+	_, body = get("/eth/v2/beacon/blocks/0x01", "token")
+	require.Contains(t, body, `"n":4`)
+	_, body = get("/eth/v2/beacon/blocks/0x01", "token")
+	require.Contains(t, body, `"n":4`)
+
+	// cache is limited by total size of bodies, least recently used ones are evicted
+	p.cacheLimit = len(body) + 1
+	_, body = get("/eth/v2/beacon/blocks/0x02", "token")
+	require.Contains(t, body, `"n":5`)
+	require.Equal(t, len(body), p.cacheSize)
+	_, body = get("/eth/v2/beacon/blocks/0x01", "token")
+	require.Contains(t, body, `"n":6`)
+	_, body = get("/eth/v2/beacon/blocks/0x01", "token")
+	require.Contains(t, body, `"n":6`)
+	require.Equal(t, 1, p.cache.Len())
+}
@@ -8,7 +8,10 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"os"
 	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ledgerwatch/erigon-lib/gointerfaces"
@@ -19,19 +22,33 @@ import (
 	kv2 "github.com/ledgerwatch/erigon-lib/kv/mdbx"
 	"github.com/ledgerwatch/erigon-lib/kv/remotedb"
 	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
+	"github.com/ledgerwatch/erigon/cmd/downloader/downloadergrpc"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/beaconproxy"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/filters"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/health"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/interfaces"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/services"
 	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/common/otel"
 	"github.com/ledgerwatch/erigon/common/paths"
+	"github.com/ledgerwatch/erigon/common/reqlabel"
+	"github.com/ledgerwatch/erigon/consensus/bor"
+	"github.com/ledgerwatch/erigon/consensus/clique"
 	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
 	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/ethdb/dbstats"
+	"github.com/ledgerwatch/erigon/ethdb/kvtrace"
+	"github.com/ledgerwatch/erigon/ethdb/kvwatchdog"
+	"github.com/ledgerwatch/erigon/ethdb/statecache"
 	"github.com/ledgerwatch/erigon/internal/debug"
 	"github.com/ledgerwatch/erigon/node"
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/historysnapshot"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snapshothashes"
+	"github.com/ledgerwatch/erigon/turbo/tiering"
 	"github.com/ledgerwatch/log/v3"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
@@ -43,6 +60,7 @@ import (
 
 type Flags struct {
 	PrivateApiAddr         string
+	PrivateApiNetworks     []string
 	SingleNodeMode         bool // Erigon's database can be read by separated processes on same machine - in read-only mode - with full support of transactions. It will share same "OS PageCache" with Erigon process.
 	Datadir                string
 	Chaindata              string
@@ -56,6 +74,9 @@ type Flags struct {
 	HttpCompression        bool
 	API                    []string
 	Gascap                 uint64
+	BatchGascap            uint64
+	EstimateGasErrorRatio  float64
+	AuthToken              string
 	MaxTraces              uint64
 	WebsocketEnabled       bool
 	WebsocketCompression   bool
@@ -63,13 +84,35 @@ type Flags struct {
 	RpcBatchConcurrency    uint
 	TraceCompatibility     bool // Bug for bug compatibility for trace_ routines with OpenEthereum
 	TxPoolApiAddr          string
+	DownloaderApiAddr      string
 	TevmEnabled            bool
 	StateCache             kvcache.CoherentConfig
+	StateCacheAutoTune     bool
+	StateCacheMaxKeys      int
 	Snapshot               ethconfig.Snapshot
+	HistorySnapshots       bool
+	TieringColdDir         string
+	ReadTxWarn             time.Duration
+	ReadTxCancel           bool
+	SampleKeys             uint
+	SamplePrefixLen        int
 	GRPCServerEnabled      bool
 	GRPCListenAddress      string
 	GRPCPort               int
 	GRPCHealthCheckEnabled bool
+	EngineFixturesDir      string
+	EngineValidatePayloads bool
+	PollFiltersDir         string
+	PollFiltersTTL         time.Duration
+	MaxFiltersPerClient    int
+	BeaconApiAddr          string
+	BeaconApiAuth          bool
+	BeaconApiCacheSize     string
+	GpoBlocks              int
+	GpoPercentile          int
+	GpoMaxPrice            int64
+	GpoMinPrice            int64
+	GpoIgnorePrice         int64
 }
 
 var rootCmd = &cobra.Command{
@@ -82,6 +125,7 @@ func RootCommand() (*cobra.Command, *Flags) {
 
 	cfg := &Flags{StateCache: kvcache.DefaultCoherentConfig}
 	rootCmd.PersistentFlags().StringVar(&cfg.PrivateApiAddr, "private.api.addr", "127.0.0.1:9090", "private api network address, for example: 127.0.0.1:9090")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.PrivateApiNetworks, "private.api.networks", []string{}, "Comma separated private api addresses of additional chains (see --networks of Erigon), each optionally followed by =<datadir> of the chain to read its databases locally. APIs of every chain are served under /<chain id> path of HTTP endpoint (for example http://localhost:8545/5), chain of --private.api.addr also at /")
 	rootCmd.PersistentFlags().StringVar(&cfg.Datadir, "datadir", "", "path to Erigon working directory")
 	rootCmd.PersistentFlags().StringVar(&cfg.Chaindata, "chaindata", "", "path to the database")
 	rootCmd.PersistentFlags().StringVar(&cfg.HttpListenAddress, "http.addr", node.DefaultHTTPHost, "HTTP-RPC server listening interface")
@@ -94,6 +138,9 @@ func RootCommand() (*cobra.Command, *Flags) {
 	rootCmd.PersistentFlags().BoolVar(&cfg.HttpCompression, "http.compression", true, "Disable http compression")
 	rootCmd.PersistentFlags().StringSliceVar(&cfg.API, "http.api", []string{"eth", "erigon"}, "API's offered over the HTTP-RPC interface: eth,erigon,web3,net,debug,trace,txpool,db. Supported methods: https://github.com/ledgerwatch/erigon/tree/devel/cmd/rpcdaemon")
 	rootCmd.PersistentFlags().Uint64Var(&cfg.Gascap, "rpc.gascap", 50000000, "Sets a cap on gas that can be used in eth_call/estimateGas")
+	rootCmd.PersistentFlags().Uint64Var(&cfg.BatchGascap, "rpc.batch.gascap", 0, "Sets a cap on total gas of eth_call/estimateGas/trace_call... in one batch request (0 = unlimited)")
+	rootCmd.PersistentFlags().Float64Var(&cfg.EstimateGasErrorRatio, "rpc.estimategas.errorratio", 0.015, "eth_estimateGas returns gas limit which is at most this ratio above the minimal one, lower ratio costs more executions (0 - exact)")
+	rootCmd.PersistentFlags().StringVar(&cfg.AuthToken, "rpc.authtoken", "", "Enables privileged methods (debug_setHead/debug_rewindToBlock, admin_updateChainConfig, admin_setLogLevel, erigon_previewPayload) and lifts --rpc.gascap and --rpc.batch.gascap for HTTP requests with header 'Authorization: Bearer <token>'")
 	rootCmd.PersistentFlags().Uint64Var(&cfg.MaxTraces, "trace.maxtraces", 200, "Sets a limit on traces that can be returned in trace_filter")
 	rootCmd.PersistentFlags().BoolVar(&cfg.WebsocketEnabled, "ws", false, "Enable Websockets")
 	rootCmd.PersistentFlags().BoolVar(&cfg.WebsocketCompression, "ws.compression", false, "Enable Websocket compression (RFC 7692)")
@@ -101,13 +148,35 @@ func RootCommand() (*cobra.Command, *Flags) {
 	rootCmd.PersistentFlags().UintVar(&cfg.RpcBatchConcurrency, "rpc.batch.concurrency", 2, "Does limit amount of goroutines to process 1 batch request. Means 1 bach request can't overload server. 1 batch still can have unlimited amount of request")
 	rootCmd.PersistentFlags().BoolVar(&cfg.TraceCompatibility, "trace.compat", false, "Bug for bug compatibility with OE for trace_ routines")
 	rootCmd.PersistentFlags().StringVar(&cfg.TxPoolApiAddr, "txpool.api.addr", "127.0.0.1:9090", "txpool api network address, for example: 127.0.0.1:9090")
+	rootCmd.PersistentFlags().StringVar(&cfg.DownloaderApiAddr, "downloader.api.addr", "", "share bandwidth limits of Downloader at this address, see --bandwidth.weights of Downloader (empty - not limited)")
 	rootCmd.PersistentFlags().BoolVar(&cfg.TevmEnabled, "tevm", false, "Enables Transpiled EVM experiment")
 	rootCmd.PersistentFlags().BoolVar(&cfg.Snapshot.Enabled, "experimental.snapshot", false, "Enables Snapshot Sync")
+	rootCmd.PersistentFlags().BoolVar(&cfg.HistorySnapshots, "experimental.history.snapshots", false, "Read history of state from files in <datadir>/snapshots/history (requires --datadir)")
+	rootCmd.PersistentFlags().StringVar(&cfg.TieringColdDir, "tiering.cold.dir", "", "Read old blocks moved by Erigon with --tiering.cold.dir from database in this directory (requires --datadir)")
+	rootCmd.PersistentFlags().DurationVar(&cfg.ReadTxWarn, "database.readtx.warn", 0, "Log (with stack) read transactions open longer than this - they don't allow db to reuse free pages. 0 - disabled")
+	rootCmd.PersistentFlags().BoolVar(&cfg.ReadTxCancel, "database.readtx.cancel", false, "Fail queries which hold read transaction longer than --database.readtx.warn")
+	rootCmd.PersistentFlags().UintVar(&cfg.SampleKeys, "database.sample.keys", 0, "Record key prefix of 1 of N database accesses, hottest prefixes are returned by debug_dbAccessStats. 0 - disabled")
+	rootCmd.PersistentFlags().IntVar(&cfg.SamplePrefixLen, "database.sample.prefix", 8, "Amount of leading key bytes by which --database.sample.keys groups samples")
 	rootCmd.PersistentFlags().IntVar(&cfg.StateCache.KeysLimit, "state.cache", kvcache.DefaultCoherentConfig.KeysLimit, "Amount of keys to store in StateCache (enabled if no --datadir set). Set 0 to disable StateCache. 1_000_000 keys ~ equal to 2Gb RAM (maybe we will add RAM accounting in future versions).")
+	rootCmd.PersistentFlags().BoolVar(&cfg.StateCacheAutoTune, "state.cache.autotune", false, "Resize StateCache by its hit rate and available memory, starting from --state.cache keys. Resize drops cached keys")
+	rootCmd.PersistentFlags().IntVar(&cfg.StateCacheMaxKeys, "state.cache.max", statecache.DefaultTuneConfig.MaxKeys, "Max amount of keys of StateCache with --state.cache.autotune")
 	rootCmd.PersistentFlags().BoolVar(&cfg.GRPCServerEnabled, "grpc", false, "Enable GRPC server")
 	rootCmd.PersistentFlags().StringVar(&cfg.GRPCListenAddress, "grpc.addr", node.DefaultGRPCHost, "GRPC server listening interface")
 	rootCmd.PersistentFlags().IntVar(&cfg.GRPCPort, "grpc.port", node.DefaultGRPCPort, "GRPC server listening port")
 	rootCmd.PersistentFlags().BoolVar(&cfg.GRPCHealthCheckEnabled, "grpc.healthcheck", false, "Enable GRPC health check")
+	rootCmd.PersistentFlags().StringVar(&cfg.PollFiltersDir, "rpc.filters.dir", "", "Store filters of eth_newFilter/eth_newBlockFilter in database in this directory, to keep them over restarts (empty - in memory)")
+	rootCmd.PersistentFlags().DurationVar(&cfg.PollFiltersTTL, "rpc.filters.ttl", filters.DefaultPollFilterTTL, "Uninstall filters which were not polled by eth_getFilterChanges for this time")
+	rootCmd.PersistentFlags().IntVar(&cfg.MaxFiltersPerClient, "rpc.filters.maxperclient", filters.DefaultMaxFiltersClient, "Max amount of filters installed by one client (IP address), 0 - unlimited")
+	rootCmd.PersistentFlags().StringVar(&cfg.BeaconApiAddr, "beacon.api.addr", "", "Proxy Beacon API of consensus layer node at this REST endpoint (headers, blocks, validators) under /eth/ path of HTTP endpoint, with caching. Credentials in the address are not exposed to clients")
+	rootCmd.PersistentFlags().BoolVar(&cfg.BeaconApiAuth, "beacon.api.auth", false, "Proxied Beacon API requires header 'Authorization: Bearer <token>' with token of --rpc.authtoken")
+	rootCmd.PersistentFlags().StringVar(&cfg.BeaconApiCacheSize, "beacon.api.cache", beaconproxy.DefaultCacheSize.String(), "Total size of cached responses of proxied Beacon API")
+	rootCmd.PersistentFlags().IntVar(&cfg.GpoBlocks, utils.GpoBlocksFlag.Name, utils.GpoBlocksFlag.Value, utils.GpoBlocksFlag.Usage)
+	rootCmd.PersistentFlags().IntVar(&cfg.GpoPercentile, utils.GpoPercentileFlag.Name, utils.GpoPercentileFlag.Value, utils.GpoPercentileFlag.Usage)
+	rootCmd.PersistentFlags().Int64Var(&cfg.GpoMaxPrice, utils.GpoMaxGasPriceFlag.Name, utils.GpoMaxGasPriceFlag.Value, utils.GpoMaxGasPriceFlag.Usage)
+	rootCmd.PersistentFlags().Int64Var(&cfg.GpoMinPrice, utils.GpoMinGasPriceFlag.Name, utils.GpoMinGasPriceFlag.Value, utils.GpoMinGasPriceFlag.Usage)
+	rootCmd.PersistentFlags().Int64Var(&cfg.GpoIgnorePrice, utils.GpoIgnoreGasPriceFlag.Name, utils.GpoIgnoreGasPriceFlag.Value, utils.GpoIgnoreGasPriceFlag.Usage)
+	rootCmd.PersistentFlags().StringVar(&cfg.EngineFixturesDir, "engine.fixtures.dir", "", "Record engine API exchanges and resulting canonical chain into test fixtures (hive blockchain tests with engine payloads) in this directory")
+	rootCmd.PersistentFlags().BoolVar(&cfg.EngineValidatePayloads, "engine.validate", false, "Execute payloads of engine_executePayloadV1 in memory before sending them to Erigon, invalid ones are rejected without reaching the DB. Each payload is executed twice then")
 
 	if err := rootCmd.MarkPersistentFlagFilename("rpc.accessList", "json"); err != nil {
 		panic(err)
@@ -123,16 +192,7 @@ func RootCommand() (*cobra.Command, *Flags) {
 		if err := utils.SetupCobra(cmd); err != nil {
 			return err
 		}
-		cfg.SingleNodeMode = cfg.Datadir != "" || cfg.Chaindata != ""
-		if cfg.SingleNodeMode {
-			if cfg.Datadir == "" {
-				cfg.Datadir = paths.DefaultDataDir()
-			}
-			if cfg.Chaindata == "" {
-				cfg.Chaindata = path.Join(cfg.Datadir, "chaindata")
-			}
-			cfg.Snapshot.Dir = path.Join(cfg.Datadir, "snapshots")
-		}
+		setDatadir(cfg)
 		return nil
 	}
 	rootCmd.PersistentPostRunE = func(cmd *cobra.Command, args []string) error {
@@ -145,6 +205,53 @@ func RootCommand() (*cobra.Command, *Flags) {
 	return rootCmd, cfg
 }
 
+// setDatadir switches cfg to single node mode if --datadir or --chaindata is set, and derives paths inside datadir
+func setDatadir(cfg *Flags) {
+	cfg.SingleNodeMode = cfg.Datadir != "" || cfg.Chaindata != ""
+	if cfg.SingleNodeMode {
+		if cfg.Datadir == "" {
+			cfg.Datadir = paths.DefaultDataDir()
+		}
+		if cfg.Chaindata == "" {
+			cfg.Chaindata = path.Join(cfg.Datadir, "chaindata")
+		}
+		cfg.Snapshot.Dir = path.Join(cfg.Datadir, "snapshots")
+		if cfg.HistorySnapshots {
+			cfg.Snapshot.HistoryDir = path.Join(cfg.Snapshot.Dir, historysnapshot.DirName)
+		}
+	}
+}
+
+func watchReadTxs(db kv.RwDB, cfg Flags) kv.RwDB {
+	if cfg.ReadTxWarn == 0 {
+		return db
+	}
+	// chain is not known before db is open, every chain served by rpcdaemon has own metrics label
+	return kvwatchdog.New(db, "", cfg.StateCache.MetricsLabel, cfg.ReadTxWarn, cfg.ReadTxCancel)
+}
+
+// traceReads - read transactions of traced requests are recorded as spans, if tracing is set up by --otel.endpoint
+func traceReads(db kv.RwDB) kv.RwDB {
+	if !otel.Enabled() {
+		return db
+	}
+	return kvtrace.New(db, "rpc")
+}
+
+// labeledKVClient - read transactions of RPC calls carry their labels to the node, see reqlabel.Outgoing
+type labeledKVClient struct {
+	remote.KVClient
+}
+
+func (c labeledKVClient) Tx(ctx context.Context, opts ...grpc.CallOption) (remote.KV_TxClient, error) {
+	return c.KVClient.Tx(reqlabel.Outgoing(ctx), opts...)
+}
+
+// countAccess - per-table counters are always on, key sampling is optional
+func countAccess(db kv.RwDB, cfg Flags) kv.RwDB {
+	return dbstats.NewAccessDB(db, dbstats.NewAccess(cfg.SampleKeys, cfg.SamplePrefixLen))
+}
+
 type StateChangesClient interface {
 	StateChanges(ctx context.Context, in *remote.StateChangeRequest, opts ...grpc.CallOption) (remote.KV_StateChangesClient, error)
 }
@@ -231,9 +338,9 @@ func checkDbCompatibility(ctx context.Context, db kv.RoDB) error {
 	return nil
 }
 
-func RemoteServices(ctx context.Context, cfg Flags, logger log.Logger, rootCancel context.CancelFunc) (db kv.RoDB, eth services.ApiBackend, txPool *services.TxPoolService, mining *services.MiningService, stateCache kvcache.Cache, blockReader interfaces.BlockReader, err error) {
+func RemoteServices(ctx context.Context, cfg Flags, logger log.Logger, rootCancel context.CancelFunc) (db kv.RoDB, eth services.ApiBackend, txPool *services.TxPoolService, mining *services.MiningService, stateCache kvcache.Cache, blockReader interfaces.BlockReader, history state.HistorySnapshots, err error) {
 	if !cfg.SingleNodeMode && cfg.PrivateApiAddr == "" {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("either remote db or local db must be specified")
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("either remote db or local db must be specified")
 	}
 
 	// Do not change the order of these checks. Chaindata needs to be checked first, because PrivateApiAddr has default value which is not ""
@@ -242,16 +349,32 @@ func RemoteServices(ctx context.Context, cfg Flags, logger log.Logger, rootCance
 		var rwKv kv.RwDB
 		rwKv, err = kv2.NewMDBX(logger).Path(cfg.Chaindata).Readonly().Open()
 		if err != nil {
-			return nil, nil, nil, nil, nil, nil, err
+			return nil, nil, nil, nil, nil, nil, nil, err
 		}
 		if compatErr := checkDbCompatibility(ctx, rwKv); compatErr != nil {
-			return nil, nil, nil, nil, nil, nil, compatErr
+			return nil, nil, nil, nil, nil, nil, nil, compatErr
+		}
+		hot := countAccess(traceReads(watchReadTxs(rwKv, cfg)), cfg)
+		// old blocks moved by Erigon to cold database are read by transactions of chaindata
+		if cfg.TieringColdDir != "" {
+			coldDB, err := tiering.Open(cfg.TieringColdDir, rwKv, true)
+			if err != nil {
+				rwKv.Close()
+				return nil, nil, nil, nil, nil, nil, nil, err
+			}
+			hot = tiering.NewDB(hot, coldDB)
 		}
-		db = rwKv
+		db = hot
 		stateCache = kvcache.NewDummy()
 	} else {
 		if cfg.StateCache.KeysLimit > 0 {
-			stateCache = kvcache.New(cfg.StateCache)
+			cache := statecache.New(cfg.StateCache)
+			if cfg.StateCacheAutoTune {
+				tuneCfg := statecache.DefaultTuneConfig
+				tuneCfg.MaxKeys = cfg.StateCacheMaxKeys
+				go cache.AutoTune(ctx, tuneCfg)
+			}
+			stateCache = cache
 		} else {
 			stateCache = kvcache.NewDummy()
 		}
@@ -272,38 +395,46 @@ func RemoteServices(ctx context.Context, cfg Flags, logger log.Logger, rootCance
 				}
 				return nil
 			}); err != nil {
-				return nil, nil, nil, nil, nil, nil, err
+				return nil, nil, nil, nil, nil, nil, nil, err
 			}
 			if cc == nil {
-				return nil, nil, nil, nil, nil, nil, fmt.Errorf("chain config not found in db. Need start erigon at least once on this db")
+				return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("chain config not found in db. Need start erigon at least once on this db")
 			}
 
 			allSnapshots := snapshotsync.NewAllSnapshots(cfg.Snapshot.Dir, snapshothashes.KnownConfig(cc.ChainName))
 			if err != nil {
-				return nil, nil, nil, nil, nil, nil, err
+				return nil, nil, nil, nil, nil, nil, nil, err
 			}
 			blockReader = snapshotsync.NewBlockReaderWithSnapshots(allSnapshots)
 		} else {
 			blockReader = snapshotsync.NewBlockReader()
 		}
+		if cfg.Snapshot.HistoryDir != "" {
+			historySnapshots, err := historysnapshot.Open(cfg.Snapshot.HistoryDir)
+			if err != nil {
+				return nil, nil, nil, nil, nil, nil, nil, err
+			}
+			history = historySnapshots
+			log.Info("[history snapshots] Opened", "to", historySnapshots.To())
+		}
 	}
 	if cfg.PrivateApiAddr == "" {
-		return db, eth, txPool, mining, stateCache, blockReader, nil
+		return db, eth, txPool, mining, stateCache, blockReader, history, nil
 	}
 
 	creds, err := grpcutil.TLS(cfg.TLSCACert, cfg.TLSCertfile, cfg.TLSKeyFile)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("open tls cert: %w", err)
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("open tls cert: %w", err)
 	}
 	conn, err := grpcutil.Connect(creds, cfg.PrivateApiAddr)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("could not connect to execution service privateApi: %w", err)
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("could not connect to execution service privateApi: %w", err)
 	}
 
 	kvClient := remote.NewKVClient(conn)
-	remoteKv, err := remotedb.NewRemote(gointerfaces.VersionFromProto(remotedbserver.KvServiceAPIVersion), logger, kvClient).Open()
+	remoteKv, err := remotedb.NewRemote(gointerfaces.VersionFromProto(remotedbserver.KvServiceAPIVersion), logger, labeledKVClient{kvClient}).Open()
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("could not connect to remoteKv: %w", err)
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("could not connect to remoteKv: %w", err)
 	}
 
 	subscribeToStateChangesLoop(ctx, kvClient, stateCache)
@@ -318,14 +449,14 @@ func RemoteServices(ctx context.Context, cfg Flags, logger log.Logger, rootCance
 	if cfg.TxPoolApiAddr != cfg.PrivateApiAddr {
 		txpoolConn, err = grpcutil.Connect(creds, cfg.TxPoolApiAddr)
 		if err != nil {
-			return nil, nil, nil, nil, nil, nil, fmt.Errorf("could not connect to txpool api: %w", err)
+			return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("could not connect to txpool api: %w", err)
 		}
 	}
 
 	mining = services.NewMiningService(txpoolConn)
 	txPool = services.NewTxPoolService(txpoolConn)
 	if db == nil {
-		db = remoteKv
+		db = countAccess(traceReads(watchReadTxs(remoteKv, cfg)), cfg)
 	}
 	eth = remoteEth
 	go func() {
@@ -342,23 +473,16 @@ func RemoteServices(ctx context.Context, cfg Flags, logger log.Logger, rootCance
 			rootCancel()
 		}
 	}()
-	return db, eth, txPool, mining, stateCache, blockReader, err
+	return db, eth, txPool, mining, stateCache, blockReader, history, err
 }
 
-func StartRpcServer(ctx context.Context, cfg Flags, rpcAPI []rpc.API) error {
-	// register apis and create handler stack
-	httpEndpoint := fmt.Sprintf("%s:%d", cfg.HttpListenAddress, cfg.HttpPort)
-
+// newRpcHandler creates RPC server of rpcAPI and its HTTP handler with healthcheck and websockets
+func newRpcHandler(cfg Flags, rpcAPI []rpc.API, allowList rpc.AllowList) (*rpc.Server, http.Handler, error) {
 	srv := rpc.NewServer(cfg.RpcBatchConcurrency)
-
-	allowListForRPC, err := parseAllowListForRPC(cfg.RpcAllowListFilePath)
-	if err != nil {
-		return err
-	}
-	srv.SetAllowList(allowListForRPC)
+	srv.SetAllowList(allowList)
 
 	if err := node.RegisterApisFromWhitelist(rpcAPI, cfg.API, srv, false); err != nil {
-		return fmt.Errorf("could not start register RPC apis: %w", err)
+		return nil, nil, fmt.Errorf("could not start register RPC apis: %w", err)
 	}
 
 	httpHandler := node.NewHTTPHandlerStack(srv, cfg.HttpCORSDomain, cfg.HttpVirtualHost, cfg.HttpCompression)
@@ -367,7 +491,7 @@ func StartRpcServer(ctx context.Context, cfg Flags, rpcAPI []rpc.API) error {
 		wsHandler = srv.WebsocketHandler([]string{"*"}, cfg.WebsocketCompression)
 	}
 
-	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return srv, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// adding a healthcheck here
 		if health.ProcessHealthcheckIfNeeded(w, r, rpcAPI) {
 			return
@@ -377,7 +501,156 @@ func StartRpcServer(ctx context.Context, cfg Flags, rpcAPI []rpc.API) error {
 			return
 		}
 		httpHandler.ServeHTTP(w, r)
-	})
+	}), nil
+}
+
+// OpenBorDB opens bor database (spans, state sync events, snapshots) next to chaindata, nil if it's not
+// available: remote mode or not a Bor chain
+func OpenBorDB(cfg Flags, logger log.Logger) (kv.RoDB, error) {
+	if !cfg.SingleNodeMode {
+		return nil, nil
+	}
+	borPath := path.Join(path.Dir(cfg.Chaindata), "bor")
+	if _, err := os.Stat(borPath); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return bor.OpenDatabaseReadonly(borPath, logger)
+}
+
+// OpenCliqueDB opens clique database (snapshots, proposals) next to chaindata, nil if it's not available:
+// remote mode or not a Clique chain. It's opened for writing, clique_propose changes votes of running Erigon.
+func OpenCliqueDB(cfg Flags, logger log.Logger) (kv.RwDB, error) {
+	if !cfg.SingleNodeMode {
+		return nil, nil
+	}
+	cliquePath := path.Join(path.Dir(cfg.Chaindata), "clique", "db")
+	if _, err := os.Stat(cliquePath); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return clique.OpenDatabaseShared(cliquePath, logger)
+}
+
+// Network is a set of APIs of an additional chain, served under /<chain id> path of HTTP endpoint
+type Network struct {
+	ChainID uint64
+	APIs    []rpc.API
+}
+
+// NetworkFlags returns flags to connect to an additional chain of --private.api.networks. Entry of the list is
+// private api address of the chain, optionally followed by =<datadir> of its node: then the chain is read like the
+// primary one with --datadir, including its bor and clique databases. Otherwise it's accessed remotely, --datadir and
+// --chaindata belong to the primary chain.
+func NetworkFlags(cfg Flags, network string) Flags {
+	addr, datadir := network, ""
+	if i := strings.IndexByte(network, '='); i >= 0 {
+		addr, datadir = network[:i], network[i+1:]
+	}
+	cfg.PrivateApiAddr = addr
+	cfg.PrivateApiNetworks = nil
+	cfg.TxPoolApiAddr = addr
+	cfg.Datadir, cfg.Chaindata = datadir, ""
+	cfg.Snapshot = ethconfig.Snapshot{}
+	setDatadir(&cfg)
+	cfg.StateCache.MetricsLabel = "rpc_" + addr
+	cfg.EngineFixturesDir = "" // recorded for the primary chain only
+	return cfg
+}
+
+// PollFiltersDir returns directory of filters database of chain chainID in dir of --rpc.filters.dir. If rpcdaemon
+// serves several chains (see --private.api.networks), each of them, the primary one too, has own database there.
+func PollFiltersDir(dir string, chainID uint64) string {
+	if dir == "" {
+		return ""
+	}
+	return path.Join(dir, strconv.FormatUint(chainID, 10))
+}
+
+// ReadChainID returns chain id from chain config stored in db
+func ReadChainID(ctx context.Context, db kv.RoDB) (uint64, error) {
+	var chainID uint64
+	if err := db.View(ctx, func(tx kv.Tx) error {
+		genesisHash, err := rawdb.ReadCanonicalHash(tx, 0)
+		if err != nil {
+			return err
+		}
+		cc, err := rawdb.ReadChainConfig(tx, genesisHash)
+		if err != nil {
+			return err
+		}
+		if cc == nil || cc.ChainID == nil {
+			return fmt.Errorf("chain config not found in db. Need start erigon at least once on this db")
+		}
+		chainID = cc.ChainID.Uint64()
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return chainID, nil
+}
+
+func StartRpcServer(ctx context.Context, cfg Flags, rpcAPI []rpc.API, networks ...Network) error {
+	// register apis and create handler stack
+	httpEndpoint := fmt.Sprintf("%s:%d", cfg.HttpListenAddress, cfg.HttpPort)
+
+	allowListForRPC, err := parseAllowListForRPC(cfg.RpcAllowListFilePath)
+	if err != nil {
+		return err
+	}
+
+	srv, handler, err := newRpcHandler(cfg, rpcAPI, allowListForRPC)
+	if err != nil {
+		return err
+	}
+	if cfg.BeaconApiAddr != "" {
+		if cfg.BeaconApiAuth && cfg.AuthToken == "" {
+			return fmt.Errorf("--beacon.api.auth requires --rpc.authtoken")
+		}
+		beaconCfg := beaconproxy.Config{Upstream: cfg.BeaconApiAddr}
+		if err := beaconCfg.CacheSize.UnmarshalText([]byte(cfg.BeaconApiCacheSize)); err != nil {
+			return fmt.Errorf("invalid --beacon.api.cache: %w", err)
+		}
+		if cfg.BeaconApiAuth {
+			beaconCfg.AuthToken = cfg.AuthToken
+		}
+		proxy, err := beaconproxy.New(beaconCfg)
+		if err != nil {
+			return err
+		}
+		handler = proxy.Wrap(handler)
+		log.Info("Proxying Beacon API", "path", beaconproxy.PathPrefix, "auth", cfg.BeaconApiAuth)
+	}
+	servers := []*rpc.Server{srv}
+	if len(networks) > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/", handler)
+		seen := map[uint64]struct{}{}
+		for _, network := range networks {
+			if _, ok := seen[network.ChainID]; ok {
+				return fmt.Errorf("chain %d is served by several private api addresses", network.ChainID)
+			}
+			seen[network.ChainID] = struct{}{}
+			networkSrv, networkHandler, err := newRpcHandler(cfg, network.APIs, allowListForRPC)
+			if err != nil {
+				return fmt.Errorf("chain %d: %w", network.ChainID, err)
+			}
+			servers = append(servers, networkSrv)
+			prefix := fmt.Sprintf("/%d", network.ChainID)
+			mux.Handle(prefix, http.StripPrefix(prefix, networkHandler))
+			mux.Handle(prefix+"/", http.StripPrefix(prefix, networkHandler))
+			log.Info("Serving chain", "chainId", network.ChainID, "path", prefix)
+		}
+		handler = mux
+	}
+
+	if cfg.DownloaderApiAddr != "" {
+		downloaderConn, err := downloadergrpc.NewConn(ctx, cfg.DownloaderApiAddr)
+		if err != nil {
+			return fmt.Errorf("could not connect to downloader: %w", err)
+		}
+		share := downloadergrpc.NewBandwidthShare(ctx, downloadergrpc.BandwidthClassRPC)
+		go share.Loop(ctx, downloaderConn, downloadergrpc.BandwidthReportInterval)
+		handler = share.Handler(handler)
+	}
 
 	listener, _, err := node.StartHTTPEndpoint(httpEndpoint, rpc.DefaultHTTPTimeouts, handler)
 	if err != nil {
@@ -408,7 +681,9 @@ func StartRpcServer(ctx context.Context, cfg Flags, rpcAPI []rpc.API) error {
 	log.Info("HTTP endpoint opened", info...)
 
 	defer func() {
-		srv.Stop()
+		for _, srv := range servers {
+			srv.Stop()
+		}
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		_ = listener.Shutdown(shutdownCtx)
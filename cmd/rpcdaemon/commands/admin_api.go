@@ -5,25 +5,44 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/services"
+	"github.com/ledgerwatch/erigon/common/logging"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/ethdb/privateapi"
 	"github.com/ledgerwatch/erigon/p2p"
+	"github.com/ledgerwatch/erigon/params"
 )
 
 // AdminAPI the interface for the admin_* RPC commands.
 type AdminAPI interface {
 	// NodeInfo returns a collection of metadata known about the host.
 	NodeInfo(ctx context.Context) (*p2p.NodeInfo, error)
+	// UpdateChainConfig schedules forks of the node, applied after restart.
+	UpdateChainConfig(ctx context.Context, cfg *params.ChainConfig) (*params.ChainConfig, error)
+	// Sentries returns sentries used by the node with their labels, state and request counters.
+	Sentries(ctx context.Context) ([]privateapi.SentryInfo, error)
+	// Peers returns peers connected to sentries of the node.
+	Peers(ctx context.Context) ([]privateapi.PeerInfo, error)
+	// SetLogLevel changes log level of a subsystem at runtime.
+	SetLogLevel(ctx context.Context, subsystem string, level string) (map[string]string, error)
 }
 
 // AdminAPIImpl data structure to store things needed for admin_* commands.
 type AdminAPIImpl struct {
+	*BaseAPI
 	ethBackend services.ApiBackend
+	db         kv.RoDB
+	authToken  string
 }
 
-// NewAdminAPI returns AdminAPIImpl instance.
-func NewAdminAPI(eth services.ApiBackend) *AdminAPIImpl {
+// NewAdminAPI returns AdminAPIImpl instance, authToken enables methods changing the node.
+func NewAdminAPI(base *BaseAPI, db kv.RoDB, eth services.ApiBackend, authToken string) *AdminAPIImpl {
 	return &AdminAPIImpl{
+		BaseAPI:    base,
 		ethBackend: eth,
+		db:         db,
+		authToken:  authToken,
 	}
 }
 
@@ -39,3 +58,82 @@ func (api *AdminAPIImpl) NodeInfo(ctx context.Context) (*p2p.NodeInfo, error) {
 
 	return &nodes[0], nil
 }
+
+// UpdateChainConfig implements admin_updateChainConfig. cfg replaces stored chain config of the node if it only adds or
+// moves forks above downloaded headers (e.g. hard fork scheduled on private chain), returns chain config stored by the
+// node. Node and rpcdaemon apply it after restart. Requires header "Authorization: Bearer <token>" with token of
+// --rpc.authtoken.
+func (api *AdminAPIImpl) UpdateChainConfig(ctx context.Context, cfg *params.ChainConfig) (*params.ChainConfig, error) {
+	if err := authorize(ctx, api.authToken, "chain config update"); err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, errors.New("chain config is empty")
+	}
+	if err := api.ethBackend.UpdateChainConfig(ctx, cfg); err != nil {
+		return nil, fmt.Errorf("update chain config: %w", err)
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	genesisHash, err := rawdb.ReadCanonicalHash(tx, 0)
+	if err != nil {
+		return nil, err
+	}
+	return rawdb.ReadChainConfig(tx, genesisHash)
+}
+
+// Sentries implements admin_sentries. Header and body requests go first to sentries preferred by
+// --sentry.prefer.headers and --sentry.prefer.bodies, sentries which failed recently are asked last.
+func (api *AdminAPIImpl) Sentries(ctx context.Context) ([]privateapi.SentryInfo, error) {
+	sentries, err := api.ethBackend.Sentries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("sentries request error: %w", err)
+	}
+	return sentries, nil
+}
+
+// Peers implements admin_peers. Peers of all sentries: protocol version, head of the peer (as of handshake, number -
+// highest announced block), latency of the last ping, bytes in/out and connection duration. A peer connected to
+// several sentries is listed once per sentry. Sentries which don't answer are skipped.
+func (api *AdminAPIImpl) Peers(ctx context.Context) ([]privateapi.PeerInfo, error) {
+	peers, err := api.ethBackend.Peers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("peers request error: %w", err)
+	}
+	if peers == nil {
+		peers = []privateapi.PeerInfo{}
+	}
+	return peers, nil
+}
+
+// SetLogLevel implements admin_setLogLevel. Level (trace, debug, info, warn, error, crit or 0..5) of subsystem
+// "rpcdaemon" is changed in this process, of other subsystems (downloader, sentry, stages, txpool, default) - in the
+// node. Returns levels of all subsystems. Requires header "Authorization: Bearer <token>" with token of
+// --rpc.authtoken.
+func (api *AdminAPIImpl) SetLogLevel(ctx context.Context, subsystem string, level string) (map[string]string, error) {
+	if err := authorize(ctx, api.authToken, "log level change"); err != nil {
+		return nil, err
+	}
+	lvl, err := logging.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	levels := map[string]string{}
+	if subsystem == "rpcdaemon" || api.ethBackend == nil {
+		if err = logging.SetLevel(subsystem, lvl); err != nil {
+			return nil, err
+		}
+	} else if levels, err = api.ethBackend.SetLogLevel(ctx, subsystem, level); err != nil {
+		return nil, fmt.Errorf("set log level of node: %w", err)
+	}
+	// level of rpcdaemon is of this process, others - of the node
+	for name, l := range logging.Levels() {
+		if _, ok := levels[name]; !ok || name == "rpcdaemon" {
+			levels[name] = l
+		}
+	}
+	return levels, nil
+}
@@ -0,0 +1,23 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon/turbo/authtoken"
+)
+
+// authTokenFlag - token of privileged methods (admin, rewind, payload preview) and of requests which are not gas
+// capped. Privileged methods are disabled until it's set, requests need header "Authorization: Bearer <token>".
+const authTokenFlag = "rpc.authtoken"
+
+// authorize - request of ctx carries token, what - privileged action, for errors
+func authorize(ctx context.Context, token, what string) error {
+	if token == "" {
+		return fmt.Errorf("%s is disabled, enable it by --%s", what, authTokenFlag)
+	}
+	if !authtoken.Matches(authtoken.FromContext(ctx), token) {
+		return fmt.Errorf("%s requires header 'Authorization: Bearer <token>'", what)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/consensus/bor"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+// BorAPI Bor (Polygon PoS) specific routines: validator snapshots, Heimdall spans and state sync events
+type BorAPI interface {
+	GetSnapshot(ctx context.Context, number *rpc.BlockNumber) (*bor.Snapshot, error)
+	GetAuthor(ctx context.Context, number *rpc.BlockNumber) (*common.Address, error)
+	GetSnapshotAtHash(ctx context.Context, hash common.Hash) (*bor.Snapshot, error)
+	GetSigners(ctx context.Context, number *rpc.BlockNumber) ([]common.Address, error)
+	GetSignersAtHash(ctx context.Context, hash common.Hash) ([]common.Address, error)
+	GetCurrentProposer(ctx context.Context) (common.Address, error)
+	GetCurrentValidators(ctx context.Context) ([]*bor.Validator, error)
+	GetRootHash(ctx context.Context, start, end uint64) (string, error)
+	GetSpan(ctx context.Context, spanID hexutil.Uint64) (*bor.HeimdallSpan, error)
+	GetStateSyncEvents(ctx context.Context, number rpc.BlockNumber) ([]*bor.EventRecordWithTime, error)
+}
+
+// BorImpl is implementation of the BorAPI interface
+type BorImpl struct {
+	*BaseAPI
+	db    kv.RoDB
+	borDB kv.RoDB // nil if bor database is not available
+
+	engineLock sync.Mutex
+	engine     *bor.Bor
+}
+
+// NewBorAPI returns BorImpl instance
+func NewBorAPI(base *BaseAPI, db kv.RoDB, borDB kv.RoDB) *BorImpl {
+	return &BorImpl{
+		BaseAPI: base,
+		db:      db,
+		borDB:   borDB,
+	}
+}
+
+// withAPI runs f with bor.API reading headers from chaindata and snapshots from bor database
+func (api *BorImpl) withAPI(ctx context.Context, f func(tx kv.Tx, borAPI *bor.API) error) error {
+	if api.borDB == nil {
+		return fmt.Errorf("bor database is not available, rpcdaemon must run with --datadir of Erigon following Bor chain")
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return err
+	}
+	if chainConfig.Bor == nil {
+		return fmt.Errorf("not a Bor chain")
+	}
+	api.engineLock.Lock()
+	if api.engine == nil {
+		api.engine = bor.NewReadonly(chainConfig, api.borDB)
+	}
+	engine := api.engine
+	api.engineLock.Unlock()
+	return f(tx, bor.NewAPI(stagedsync.ChainReader{Cfg: *chainConfig, Db: tx}, engine))
+}
+
+// GetSnapshot implements bor_getSnapshot. Returns validator set snapshot at given block.
+func (api *BorImpl) GetSnapshot(ctx context.Context, number *rpc.BlockNumber) (snap *bor.Snapshot, err error) {
+	err = api.withAPI(ctx, func(_ kv.Tx, borAPI *bor.API) error {
+		snap, err = borAPI.GetSnapshot(number)
+		return err
+	})
+	return snap, err
+}
+
+// GetAuthor implements bor_getAuthor. Returns signer of given block.
+func (api *BorImpl) GetAuthor(ctx context.Context, number *rpc.BlockNumber) (author *common.Address, err error) {
+	err = api.withAPI(ctx, func(_ kv.Tx, borAPI *bor.API) error {
+		author, err = borAPI.GetAuthor(number)
+		return err
+	})
+	return author, err
+}
+
+// GetSnapshotAtHash implements bor_getSnapshotAtHash. Returns validator set snapshot at given block.
+func (api *BorImpl) GetSnapshotAtHash(ctx context.Context, hash common.Hash) (snap *bor.Snapshot, err error) {
+	err = api.withAPI(ctx, func(tx kv.Tx, borAPI *bor.API) error {
+		if rawdb.ReadHeaderNumber(tx, hash) == nil {
+			return fmt.Errorf("block %x not found", hash)
+		}
+		snap, err = borAPI.GetSnapshotAtHash(hash)
+		return err
+	})
+	return snap, err
+}
+
+// GetSigners implements bor_getSigners. Returns validators authorized to sign at given block.
+func (api *BorImpl) GetSigners(ctx context.Context, number *rpc.BlockNumber) (signers []common.Address, err error) {
+	err = api.withAPI(ctx, func(_ kv.Tx, borAPI *bor.API) error {
+		signers, err = borAPI.GetSigners(number)
+		return err
+	})
+	return signers, err
+}
+
+// GetSignersAtHash implements bor_getSignersAtHash. Returns validators authorized to sign at given block.
+func (api *BorImpl) GetSignersAtHash(ctx context.Context, hash common.Hash) (signers []common.Address, err error) {
+	err = api.withAPI(ctx, func(tx kv.Tx, borAPI *bor.API) error {
+		if rawdb.ReadHeaderNumber(tx, hash) == nil {
+			return fmt.Errorf("block %x not found", hash)
+		}
+		signers, err = borAPI.GetSignersAtHash(hash)
+		return err
+	})
+	return signers, err
+}
+
+// GetCurrentProposer implements bor_getCurrentProposer. Returns in-turn proposer at head header.
+func (api *BorImpl) GetCurrentProposer(ctx context.Context) (proposer common.Address, err error) {
+	err = api.withAPI(ctx, func(_ kv.Tx, borAPI *bor.API) error {
+		proposer, err = borAPI.GetCurrentProposer()
+		return err
+	})
+	return proposer, err
+}
+
+// GetCurrentValidators implements bor_getCurrentValidators. Returns validator set at head header.
+func (api *BorImpl) GetCurrentValidators(ctx context.Context) (validators []*bor.Validator, err error) {
+	err = api.withAPI(ctx, func(_ kv.Tx, borAPI *bor.API) error {
+		validators, err = borAPI.GetCurrentValidators()
+		return err
+	})
+	return validators, err
+}
+
+// GetRootHash implements bor_getRootHash. Returns merkle root of headers in [start, end], used for checkpoints.
+func (api *BorImpl) GetRootHash(ctx context.Context, start, end uint64) (root string, err error) {
+	err = api.withAPI(ctx, func(_ kv.Tx, borAPI *bor.API) error {
+		root, err = borAPI.GetRootHash(start, end)
+		return err
+	})
+	return root, err
+}
+
+// GetSpan implements bor_getSpan. Returns Heimdall span downloaded by BorHeimdall stage.
+func (api *BorImpl) GetSpan(ctx context.Context, spanID hexutil.Uint64) (*bor.HeimdallSpan, error) {
+	if api.borDB == nil {
+		return nil, fmt.Errorf("bor database is not available")
+	}
+	tx, err := api.borDB.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	return bor.ReadSpan(tx, uint64(spanID))
+}
+
+// GetStateSyncEvents implements bor_getStateSyncEvents. Returns state sync events committed in given
+// block, empty for blocks which are not sprint starts.
+func (api *BorImpl) GetStateSyncEvents(ctx context.Context, number rpc.BlockNumber) ([]*bor.EventRecordWithTime, error) {
+	if api.borDB == nil {
+		return nil, fmt.Errorf("bor database is not available")
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	if chainConfig.Bor == nil {
+		return nil, fmt.Errorf("not a Bor chain")
+	}
+	blockNum, err := getBlockNumber(number, tx)
+	if err != nil {
+		return nil, err
+	}
+	sprint := chainConfig.Bor.Sprint
+	if blockNum == 0 || blockNum%sprint != 0 {
+		return []*bor.EventRecordWithTime{}, nil
+	}
+
+	borTx, err := api.borDB.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer borTx.Rollback()
+	lastEventID, ok, err := bor.ReadLastEventID(borTx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("state sync events of block %d are not downloaded", blockNum)
+	}
+	prevEventID := uint64(0)
+	if blockNum > sprint {
+		if prevEventID, _, err = bor.ReadLastEventID(borTx, blockNum-sprint); err != nil {
+			return nil, err
+		}
+	}
+	if lastEventID <= prevEventID {
+		return []*bor.EventRecordWithTime{}, nil
+	}
+	return bor.ReadEvents(borTx, prevEventID+1, lastEventID)
+}
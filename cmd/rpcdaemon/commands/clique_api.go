@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus/clique"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+// CliqueAPI Clique (proof-of-authority) specific routines: signer snapshots and voting proposals
+type CliqueAPI interface {
+	GetSnapshot(ctx context.Context, number *rpc.BlockNumber) (*clique.Snapshot, error)
+	GetSnapshotAtHash(ctx context.Context, hash common.Hash) (*clique.Snapshot, error)
+	GetSigners(ctx context.Context, number *rpc.BlockNumber) ([]common.Address, error)
+	GetSignersAtHash(ctx context.Context, hash common.Hash) ([]common.Address, error)
+	Proposals(ctx context.Context) (map[common.Address]bool, error)
+	Propose(ctx context.Context, address common.Address, auth bool) error
+	Discard(ctx context.Context, address common.Address) error
+	Status(ctx context.Context) (*clique.Status, error)
+	RecoverSnapshot(ctx context.Context, number rpc.BlockNumber) (*clique.Snapshot, error)
+}
+
+// CliqueImpl is implementation of the CliqueAPI interface
+type CliqueImpl struct {
+	*BaseAPI
+	db       kv.RoDB
+	cliqueDB kv.RwDB // nil if clique database is not available
+
+	engineLock sync.Mutex
+	engine     *clique.Clique
+}
+
+// NewCliqueAPI returns CliqueImpl instance
+func NewCliqueAPI(base *BaseAPI, db kv.RoDB, cliqueDB kv.RwDB) *CliqueImpl {
+	return &CliqueImpl{
+		BaseAPI:  base,
+		db:       db,
+		cliqueDB: cliqueDB,
+	}
+}
+
+// withAPI runs f with clique.API reading headers from chaindata and snapshots and proposals from clique database
+func (api *CliqueImpl) withAPI(ctx context.Context, f func(tx kv.Tx, cliqueAPI *clique.API) error) error {
+	if api.cliqueDB == nil {
+		return fmt.Errorf("clique database is not available, rpcdaemon must run with --datadir of Erigon following Clique chain")
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return err
+	}
+	if chainConfig.Clique == nil {
+		return fmt.Errorf("not a Clique chain")
+	}
+	api.engineLock.Lock()
+	if api.engine == nil {
+		api.engine = clique.New(chainConfig, params.CliqueSnapshot, api.cliqueDB)
+	}
+	engine := api.engine
+	api.engineLock.Unlock()
+	return f(tx, clique.NewAPI(stagedsync.ChainReader{Cfg: *chainConfig, Db: tx}, engine))
+}
+
+// GetSnapshot implements clique_getSnapshot. Returns signers snapshot at given block.
+func (api *CliqueImpl) GetSnapshot(ctx context.Context, number *rpc.BlockNumber) (snap *clique.Snapshot, err error) {
+	err = api.withAPI(ctx, func(_ kv.Tx, cliqueAPI *clique.API) error {
+		snap, err = cliqueAPI.GetSnapshot(number)
+		return err
+	})
+	return snap, err
+}
+
+// GetSnapshotAtHash implements clique_getSnapshotAtHash. Returns signers snapshot at given block.
+func (api *CliqueImpl) GetSnapshotAtHash(ctx context.Context, hash common.Hash) (snap *clique.Snapshot, err error) {
+	err = api.withAPI(ctx, func(tx kv.Tx, cliqueAPI *clique.API) error {
+		if rawdb.ReadHeaderNumber(tx, hash) == nil {
+			return fmt.Errorf("block %x not found", hash)
+		}
+		snap, err = cliqueAPI.GetSnapshotAtHash(hash)
+		return err
+	})
+	return snap, err
+}
+
+// GetSigners implements clique_getSigners. Returns signers authorized at given block.
+func (api *CliqueImpl) GetSigners(ctx context.Context, number *rpc.BlockNumber) (signers []common.Address, err error) {
+	err = api.withAPI(ctx, func(_ kv.Tx, cliqueAPI *clique.API) error {
+		signers, err = cliqueAPI.GetSigners(number)
+		return err
+	})
+	return signers, err
+}
+
+// GetSignersAtHash implements clique_getSignersAtHash. Returns signers authorized at given block.
+func (api *CliqueImpl) GetSignersAtHash(ctx context.Context, hash common.Hash) (signers []common.Address, err error) {
+	err = api.withAPI(ctx, func(tx kv.Tx, cliqueAPI *clique.API) error {
+		if rawdb.ReadHeaderNumber(tx, hash) == nil {
+			return fmt.Errorf("block %x not found", hash)
+		}
+		signers, err = cliqueAPI.GetSignersAtHash(hash)
+		return err
+	})
+	return signers, err
+}
+
+// Proposals implements clique_proposals. Returns proposals the node votes on when sealing.
+func (api *CliqueImpl) Proposals(ctx context.Context) (proposals map[common.Address]bool, err error) {
+	err = api.withAPI(ctx, func(_ kv.Tx, cliqueAPI *clique.API) error {
+		proposals, err = cliqueAPI.Proposals()
+		return err
+	})
+	return proposals, err
+}
+
+// Propose implements clique_propose. Adds proposal to authorize (auth=true) or drop signer.
+func (api *CliqueImpl) Propose(ctx context.Context, address common.Address, auth bool) error {
+	return api.withAPI(ctx, func(_ kv.Tx, cliqueAPI *clique.API) error {
+		return cliqueAPI.Propose(address, auth)
+	})
+}
+
+// Discard implements clique_discard. Removes proposal, the node stops voting on it.
+func (api *CliqueImpl) Discard(ctx context.Context, address common.Address) error {
+	return api.withAPI(ctx, func(_ kv.Tx, cliqueAPI *clique.API) error {
+		return cliqueAPI.Discard(address)
+	})
+}
+
+// Status implements clique_status. Returns signing activity of the last 64 blocks.
+func (api *CliqueImpl) Status(ctx context.Context) (status *clique.Status, err error) {
+	err = api.withAPI(ctx, func(_ kv.Tx, cliqueAPI *clique.API) error {
+		status, err = cliqueAPI.Status()
+		return err
+	})
+	return status, err
+}
+
+// RecoverSnapshot implements clique_recoverSnapshot. Rebuilds signers snapshot from the given epoch
+// checkpoint block and stores it, so that later snapshots don't have to be replayed from genesis.
+func (api *CliqueImpl) RecoverSnapshot(ctx context.Context, number rpc.BlockNumber) (snap *clique.Snapshot, err error) {
+	err = api.withAPI(ctx, func(_ kv.Tx, cliqueAPI *clique.API) error {
+		snap, err = cliqueAPI.RecoverSnapshot(number)
+		return err
+	})
+	return snap, err
+}
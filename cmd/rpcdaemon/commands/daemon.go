@@ -2,6 +2,7 @@ package commands
 
 import (
 	"context"
+	"math/big"
 
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
 	"github.com/ledgerwatch/erigon-lib/kv"
@@ -10,14 +11,17 @@ import (
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/filters"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/interfaces"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/services"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
 	"github.com/ledgerwatch/erigon/rpc"
 )
 
 // APIList describes the list of available RPC apis
-func APIList(ctx context.Context, db kv.RoDB,
-	eth services.ApiBackend, txPool txpool.TxpoolClient, mining txpool.MiningClient, filters *filters.Filters,
+func APIList(ctx context.Context, db kv.RoDB, borDB kv.RoDB, cliqueDB kv.RwDB,
+	eth services.ApiBackend, txPool txpool.TxpoolClient, mining txpool.MiningClient, filters *filters.Filters, pollFilters *filters.PollFilters,
 	stateCache kvcache.Cache,
 	blockReader interfaces.BlockReader,
+	history state.HistorySnapshots,
 	cfg cli.Flags, customAPIList []rpc.API) []rpc.API {
 	var defaultAPIList []rpc.API
 
@@ -25,17 +29,38 @@ func APIList(ctx context.Context, db kv.RoDB,
 	if cfg.TevmEnabled {
 		base.EnableTevmExperiment()
 	}
+	base.SetGasCaps(cfg.Gascap, cfg.BatchGascap, cfg.AuthToken)
+	base.SetPollFilters(pollFilters)
+	base.SetHistorySnapshots(history)
+	gpo := ethconfig.Defaults.GPO
+	gpo.Blocks, gpo.Percentile = cfg.GpoBlocks, cfg.GpoPercentile
+	gpo.MaxPrice, gpo.IgnorePrice = big.NewInt(cfg.GpoMaxPrice), big.NewInt(cfg.GpoIgnorePrice)
+	if cfg.GpoMinPrice > 0 {
+		gpo.MinPrice = big.NewInt(cfg.GpoMinPrice)
+	}
+	base.SetGasPriceOracle(gpo)
 	ethImpl := NewEthAPI(base, db, eth, txPool, mining, cfg.Gascap)
+	ethImpl.SetEstimateGasErrorRatio(cfg.EstimateGasErrorRatio)
 	erigonImpl := NewErigonAPI(base, db, eth)
+	erigonImpl.SetConsensusDBs(borDB, cliqueDB)
+	payloadPreviewImpl := NewPayloadPreviewAPI(base, db, txPool, cfg.AuthToken)
 	starknetImpl := NewStarknetAPI(base, db, txPool)
 	txpoolImpl := NewTxPoolAPI(base, db, txPool)
 	netImpl := NewNetAPIImpl(eth)
 	debugImpl := NewPrivateDebugAPI(base, db, cfg.Gascap)
+	debugImpl.SetAdmin(eth, cfg.AuthToken)
 	traceImpl := NewTraceAPI(base, db, &cfg)
 	web3Impl := NewWeb3APIImpl(eth)
 	dbImpl := NewDBAPIImpl() /* deprecated */
-	engineImpl := NewEngineAPI(base, db, eth)
-	adminImpl := NewAdminAPI(eth)
+	engineAPI := NewEngineAPI(base, db, eth)
+	engineAPI.SetPayloadValidation(cfg.EngineValidatePayloads)
+	var engineImpl EngineAPI = engineAPI
+	if cfg.EngineFixturesDir != "" {
+		engineImpl = NewEngineRecorder(engineImpl, base, db, cfg.EngineFixturesDir)
+	}
+	adminImpl := NewAdminAPI(base, db, eth, cfg.AuthToken)
+	borImpl := NewBorAPI(base, db, borDB)
+	cliqueImpl := NewCliqueAPI(base, db, cliqueDB)
 
 	for _, enabledAPI := range cfg.API {
 		switch enabledAPI {
@@ -45,6 +70,11 @@ func APIList(ctx context.Context, db kv.RoDB,
 				Public:    true,
 				Service:   EthAPI(ethImpl),
 				Version:   "1.0",
+			}, rpc.API{
+				Namespace: "eth",
+				Public:    true,
+				Service:   NewSyncingAPI(db),
+				Version:   "1.0",
 			})
 		case "debug":
 			defaultAPIList = append(defaultAPIList, rpc.API{
@@ -94,6 +124,11 @@ func APIList(ctx context.Context, db kv.RoDB,
 				Public:    true,
 				Service:   ErigonAPI(erigonImpl),
 				Version:   "1.0",
+			}, rpc.API{
+				Namespace: "erigon",
+				Public:    true,
+				Service:   PayloadPreviewAPI(payloadPreviewImpl),
+				Version:   "1.0",
 			})
 		case "starknet":
 			defaultAPIList = append(defaultAPIList, rpc.API{
@@ -106,7 +141,21 @@ func APIList(ctx context.Context, db kv.RoDB,
 			defaultAPIList = append(defaultAPIList, rpc.API{
 				Namespace: "engine",
 				Public:    true,
-				Service:   EngineAPI(engineImpl),
+				Service:   engineImpl,
+				Version:   "1.0",
+			})
+		case "bor":
+			defaultAPIList = append(defaultAPIList, rpc.API{
+				Namespace: "bor",
+				Public:    true,
+				Service:   BorAPI(borImpl),
+				Version:   "1.0",
+			})
+		case "clique":
+			defaultAPIList = append(defaultAPIList, rpc.API{
+				Namespace: "clique",
+				Public:    false,
+				Service:   CliqueAPI(cliqueImpl),
 				Version:   "1.0",
 			})
 		case "admin":
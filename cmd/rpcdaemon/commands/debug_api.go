@@ -6,6 +6,7 @@ import (
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/services"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/changeset"
 	"github.com/ledgerwatch/erigon/common/hexutil"
@@ -17,6 +18,8 @@ import (
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 	"github.com/ledgerwatch/erigon/eth/tracers"
 	"github.com/ledgerwatch/erigon/ethdb"
+	"github.com/ledgerwatch/erigon/ethdb/dbstats"
+	"github.com/ledgerwatch/erigon/ethdb/statecache"
 	"github.com/ledgerwatch/erigon/internal/ethapi"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/transactions"
@@ -30,14 +33,28 @@ type PrivateDebugAPI interface {
 	GetModifiedAccountsByNumber(ctx context.Context, startNum rpc.BlockNumber, endNum *rpc.BlockNumber) ([]common.Address, error)
 	GetModifiedAccountsByHash(_ context.Context, startHash common.Hash, endHash *common.Hash) ([]common.Address, error)
 	TraceCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, config *tracers.TraceConfig, stream *jsoniter.Stream) error
+	TraceBlockByNumber(ctx context.Context, blockNum rpc.BlockNumber, config *tracers.TraceConfig, stream *jsoniter.Stream) error
+	TraceBlockByHash(ctx context.Context, hash common.Hash, config *tracers.TraceConfig, stream *jsoniter.Stream) error
+	ProfileBlockRange(ctx context.Context, from, to rpc.BlockNumber, stream *jsoniter.Stream) error
+	ZkTraceBlockRange(ctx context.Context, from, to rpc.BlockNumber) (hexutil.Bytes, error)
 	AccountAt(ctx context.Context, blockHash common.Hash, txIndex uint64, account common.Address) (*AccountResult, error)
+	DbStats(ctx context.Context) (*dbstats.Stats, error)
+	DbAccessStats(ctx context.Context, reset *bool) (*dbstats.AccessStats, error)
+	StateCacheStats(ctx context.Context) (*statecache.Stats, error)
+	StateCacheFlush(ctx context.Context) (*statecache.Stats, error)
+	SetHead(ctx context.Context, number hexutil.Uint64) error
+	RewindToBlock(ctx context.Context, number hexutil.Uint64) (*RewindResult, error)
 }
 
 // PrivateDebugAPIImpl is implementation of the PrivateDebugAPI interface based on remote Db access
 type PrivateDebugAPIImpl struct {
 	*BaseAPI
-	db     kv.RoDB
-	GasCap uint64
+	db      kv.RoDB
+	GasCap  uint64
+	dbStats *dbstats.Tracker
+
+	ethBackend     services.ApiBackend
+	adminAuthToken string
 }
 
 // NewPrivateDebugAPI returns PrivateDebugAPIImpl instance
@@ -46,6 +63,7 @@ func NewPrivateDebugAPI(base *BaseAPI, db kv.RoDB, gascap uint64) *PrivateDebugA
 		BaseAPI: base,
 		db:      db,
 		GasCap:  gascap,
+		dbStats: dbstats.NewTracker(nil),
 	}
 }
 
@@ -67,7 +85,7 @@ func (api *PrivateDebugAPIImpl) StorageRangeAt(ctx context.Context, blockHash co
 		return StorageRangeResult{}, err
 	}
 	if block == nil {
-		return StorageRangeResult{}, nil
+		return StorageRangeResult{}, fmt.Errorf("block %x not found", blockHash)
 	}
 	getHeader := func(hash common.Hash, number uint64) *types.Header {
 		return rawdb.ReadHeader(tx, hash, number)
@@ -78,7 +96,7 @@ func (api *PrivateDebugAPIImpl) StorageRangeAt(ctx context.Context, blockHash co
 		contractHasTEVM = ethdb.GetHasTEVM(tx)
 	}
 
-	_, _, _, _, stateReader, err := transactions.ComputeTxEnv(ctx, block, chainConfig, getHeader, contractHasTEVM, ethash.NewFaker(), tx, blockHash, txIndex)
+	_, _, _, _, stateReader, err := transactions.ComputeTxEnv(ctx, block, chainConfig, getHeader, contractHasTEVM, ethash.NewFaker(), tx, api.historySnapshots, blockHash, txIndex)
 	if err != nil {
 		return StorageRangeResult{}, err
 	}
@@ -145,7 +163,8 @@ func (api *PrivateDebugAPIImpl) AccountRange(ctx context.Context, blockNrOrHash
 	return res, nil
 }
 
-// GetModifiedAccountsByNumber implements debug_getModifiedAccountsByNumber. Returns a list of accounts modified in the given block.
+// GetModifiedAccountsByNumber implements debug_getModifiedAccountsByNumber. Returns a list of accounts modified in the
+// given block, or in blocks after startNumber up to endNumber (inclusive) - as geth, which compares state of both blocks.
 func (api *PrivateDebugAPIImpl) GetModifiedAccountsByNumber(ctx context.Context, startNumber rpc.BlockNumber, endNumber *rpc.BlockNumber) ([]common.Address, error) {
 	tx, err := api.db.BeginRo(ctx)
 	if err != nil {
@@ -153,36 +172,17 @@ func (api *PrivateDebugAPIImpl) GetModifiedAccountsByNumber(ctx context.Context,
 	}
 	defer tx.Rollback()
 
-	latestBlock, err := stages.GetStageProgress(tx, stages.Finish)
-	if err != nil {
-		return nil, err
-	}
-
 	// forces negative numbers to fail (too large) but allows zero
 	startNum := uint64(startNumber.Int64())
-	if startNum > latestBlock {
-		return nil, fmt.Errorf("start block (%d) is later than the latest block (%d)", startNum, latestBlock)
-	}
-
-	endNum := startNum + 1 // allows for single param calls
-	if endNumber != nil {
-		// forces negative numbers to fail (too large) but allows zero
-		endNum = uint64(endNumber.Int64()) + 1
-	}
-
-	// is endNum too big?
-	if endNum > latestBlock {
-		return nil, fmt.Errorf("end block (%d) is later than the latest block (%d)", endNum, latestBlock)
-	}
-
-	if startNum > endNum {
-		return nil, fmt.Errorf("start block (%d) must be less than or equal to end block (%d)", startNum, endNum)
+	if endNumber == nil {
+		return modifiedAccounts(tx, startNum, nil)
 	}
-
-	return changeset.GetModifiedAccounts(tx, startNum, endNum)
+	endNum := uint64(endNumber.Int64())
+	return modifiedAccounts(tx, startNum, &endNum)
 }
 
-// GetModifiedAccountsByHash implements debug_getModifiedAccountsByHash. Returns a list of accounts modified in the given block.
+// GetModifiedAccountsByHash implements debug_getModifiedAccountsByHash. Returns a list of accounts modified in the given
+// block, or in blocks after startHash up to endHash (inclusive).
 func (api *PrivateDebugAPIImpl) GetModifiedAccountsByHash(ctx context.Context, startHash common.Hash, endHash *common.Hash) ([]common.Address, error) {
 	tx, err := api.db.BeginRo(ctx)
 	if err != nil {
@@ -190,32 +190,55 @@ func (api *PrivateDebugAPIImpl) GetModifiedAccountsByHash(ctx context.Context, s
 	}
 	defer tx.Rollback()
 
-	startBlock, err := api.blockByHashWithSenders(tx, startHash)
+	startNum, err := canonicalBlockNumber(tx, startHash)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("start block: %w", err)
 	}
-	if startBlock == nil {
-		return nil, fmt.Errorf("start block %x not found", startHash)
+	if endHash == nil {
+		return modifiedAccounts(tx, startNum, nil)
 	}
-	startNum := startBlock.NumberU64()
-	endNum := startNum + 1 // allows for single parameter calls
-
-	if endHash != nil {
-		endBlock, err := api.blockByHashWithSenders(tx, *endHash)
-		if err != nil {
-			return nil, err
-		}
-		if endBlock == nil {
-			return nil, fmt.Errorf("end block %x not found", *endHash)
-		}
-		endNum = endBlock.NumberU64() + 1
+	endNum, err := canonicalBlockNumber(tx, *endHash)
+	if err != nil {
+		return nil, fmt.Errorf("end block: %w", err)
 	}
+	return modifiedAccounts(tx, startNum, &endNum)
+}
 
-	if startNum > endNum {
-		return nil, fmt.Errorf("start block (%d) must be less than or equal to end block (%d)", startNum, endNum)
+// canonicalBlockNumber - changesets are written only for canonical blocks
+func canonicalBlockNumber(tx kv.Tx, hash common.Hash) (uint64, error) {
+	number := rawdb.ReadHeaderNumber(tx, hash)
+	if number == nil {
+		return 0, fmt.Errorf("block %x not found", hash)
+	}
+	canonical, err := rawdb.ReadCanonicalHash(tx, *number)
+	if err != nil {
+		return 0, err
 	}
+	if canonical != hash {
+		return 0, fmt.Errorf("block %x is not canonical", hash)
+	}
+	return *number, nil
+}
 
-	return changeset.GetModifiedAccounts(tx, startNum, endNum)
+// modifiedAccounts - accounts modified in block startNum if endNum is nil, otherwise in blocks (startNum, endNum]
+func modifiedAccounts(tx kv.Tx, startNum uint64, endNum *uint64) ([]common.Address, error) {
+	latestBlock, err := stages.GetStageProgress(tx, stages.Finish)
+	if err != nil {
+		return nil, err
+	}
+	if endNum == nil {
+		if startNum > latestBlock {
+			return nil, fmt.Errorf("block (%d) is later than the latest block (%d)", startNum, latestBlock)
+		}
+		return changeset.GetModifiedAccounts(tx, startNum, startNum+1)
+	}
+	if startNum >= *endNum {
+		return nil, fmt.Errorf("start block height (%d) must be less than end block height (%d)", startNum, *endNum)
+	}
+	if *endNum > latestBlock {
+		return nil, fmt.Errorf("end block (%d) is later than the latest block (%d)", *endNum, latestBlock)
+	}
+	return changeset.GetModifiedAccounts(tx, startNum+1, *endNum+1)
 }
 
 func (api *PrivateDebugAPIImpl) AccountAt(ctx context.Context, blockHash common.Hash, txIndex uint64, address common.Address) (*AccountResult, error) {
@@ -244,7 +267,7 @@ func (api *PrivateDebugAPIImpl) AccountAt(ctx context.Context, blockHash common.
 	if api.TevmEnabled {
 		contractHasTEVM = ethdb.GetHasTEVM(tx)
 	}
-	_, _, _, ibs, _, err := transactions.ComputeTxEnv(ctx, block, chainConfig, getHeader, contractHasTEVM, ethash.NewFaker(), tx, blockHash, txIndex)
+	_, _, _, ibs, _, err := transactions.ComputeTxEnv(ctx, block, chainConfig, getHeader, contractHasTEVM, ethash.NewFaker(), tx, api.historySnapshots, blockHash, txIndex)
 	if err != nil {
 		return nil, err
 	}
@@ -262,3 +285,49 @@ type AccountResult struct {
 	Code     hexutil.Bytes  `json:"code"`
 	CodeHash common.Hash    `json:"codeHash"`
 }
+
+// DbStats implements debug_dbStats. Returns sizes of MDBX tables and their growth since previous call.
+// Works only with local database (--datadir)
+func (api *PrivateDebugAPIImpl) DbStats(ctx context.Context) (*dbstats.Stats, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	return api.dbStats.Stats(tx)
+}
+
+// DbAccessStats implements debug_dbAccessStats. Returns reads and writes per table made by this RPC daemon
+// and hottest key prefixes (if --database.sample.keys set). If reset is true, counters start from zero after the call.
+func (api *PrivateDebugAPIImpl) DbAccessStats(_ context.Context, reset *bool) (*dbstats.AccessStats, error) {
+	db, ok := api.db.(dbstats.HasAccess)
+	if !ok {
+		return nil, fmt.Errorf("access stats are not collected for %T", api.db)
+	}
+	stats := db.Access().Stats(dbstats.DefaultHotPrefixes)
+	if reset != nil && *reset {
+		db.Access().Reset()
+	}
+	return stats, nil
+}
+
+// StateCacheStats implements debug_stateCacheStats. Returns size, limit and hit rate per table of state cache
+// which serves eth_call, eth_getBalance... on latest block
+func (api *PrivateDebugAPIImpl) StateCacheStats(_ context.Context) (*statecache.Stats, error) {
+	cache, ok := api.stateCache.(*statecache.Cache)
+	if !ok {
+		return nil, fmt.Errorf("state cache is disabled")
+	}
+	return cache.Stats(), nil
+}
+
+// StateCacheFlush implements debug_stateCacheFlush. Drops all keys of state cache, returns its stats before flush
+func (api *PrivateDebugAPIImpl) StateCacheFlush(_ context.Context) (*statecache.Stats, error) {
+	cache, ok := api.stateCache.(*statecache.Cache)
+	if !ok {
+		return nil, fmt.Errorf("state cache is disabled")
+	}
+	stats := cache.Stats()
+	cache.Flush()
+	return stats, nil
+}
@@ -4,15 +4,24 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
+	"sort"
 	"testing"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/rpcdaemontest"
 	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/erigon/eth/tracers"
+	"github.com/ledgerwatch/erigon/eth/tracers/zktrace"
 	"github.com/ledgerwatch/erigon/internal/ethapi"
+	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/stretchr/testify/require"
 )
 
 var debugTraceTransactionTests = []struct {
@@ -69,6 +78,59 @@ func TestTraceTransaction(t *testing.T) {
 	}
 }
 
+func TestTraceBlockByNumber(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	api := NewPrivateDebugAPI(
+		NewBaseApi(nil, stateCache, snapshotsync.NewBlockReader(), false),
+		db, 0)
+	for _, tt := range debugTraceTransactionTests {
+		tx, err := db.BeginRo(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, blockNum, txIndex, err := rawdb.ReadTransaction(tx, common.HexToHash(tt.txHash))
+		tx.Rollback()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		stream := jsoniter.NewStream(jsoniter.ConfigDefault, &buf, 4096)
+		if err = api.TraceBlockByNumber(context.Background(), rpc.BlockNumber(blockNum), &tracers.TraceConfig{}, stream); err != nil {
+			t.Fatalf("traceBlockByNumber %d: %v", blockNum, err)
+		}
+		if err = stream.Flush(); err != nil {
+			t.Fatalf("error flusing: %v", err)
+		}
+		var results []struct {
+			Result ethapi.ExecutionResult `json:"result"`
+		}
+		if err = json.Unmarshal(buf.Bytes(), &results); err != nil {
+			t.Fatalf("parsing result: %v", err)
+		}
+		if results[txIndex].Result.Gas != tt.gas {
+			t.Errorf("wrong gas for transaction %s, got %d, expected %d", tt.txHash, results[txIndex].Result.Gas, tt.gas)
+		}
+
+		buf.Reset()
+		profiler := tracers.OpcodeProfilerName
+		if err = api.TraceBlockByNumber(context.Background(), rpc.BlockNumber(blockNum), &tracers.TraceConfig{Tracer: &profiler}, stream); err != nil {
+			t.Fatalf("profiling block %d: %v", blockNum, err)
+		}
+		if err = stream.Flush(); err != nil {
+			t.Fatalf("error flusing: %v", err)
+		}
+		var profile tracers.ProfileResult
+		if err = json.Unmarshal(buf.Bytes(), &profile); err != nil {
+			t.Fatalf("parsing profile: %v", err)
+		}
+		if profile.Txs != uint64(len(results)) {
+			t.Errorf("wrong number of profiled transactions in block %d, got %d, expected %d", blockNum, profile.Txs, len(results))
+		}
+	}
+}
+
 func TestTraceTransactionNoRefund(t *testing.T) {
 	db := rpcdaemontest.CreateTestKV(t)
 	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
@@ -101,3 +163,189 @@ func TestTraceTransactionNoRefund(t *testing.T) {
 		}
 	}
 }
+
+func TestStorageRangeAt(t *testing.T) {
+	m, chain, _ := rpcdaemontest.CreateTestSentry(t)
+	api := NewPrivateDebugAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, 0)
+	ctx := context.Background()
+	token := chain.Receipts[6][0].ContractAddress // deployed in block 7, balances are transferred in block 8
+	block8 := chain.Blocks[7].Hash()
+
+	all, err := api.StorageRangeAt(ctx, block8, 0, token, nil, 1000)
+	require.NoError(t, err)
+	require.Nil(t, all.NextKey)
+	require.Greater(t, len(all.Storage), 32)
+	var smallest common.Hash
+	for seckey, entry := range all.Storage {
+		if entry.Key != nil { // preimages are known only for locations changed after block 8
+			require.Equal(t, crypto.Keccak256Hash(entry.Key[:]), seckey)
+		}
+		require.NotEqual(t, common.Hash{}, entry.Value)
+		if smallest == (common.Hash{}) || bytes.Compare(seckey[:], smallest[:]) < 0 {
+			smallest = seckey
+		}
+	}
+
+	empty, err := api.StorageRangeAt(ctx, block8, 0, token, nil, 0)
+	require.NoError(t, err)
+	require.Empty(t, empty.Storage)
+	require.Equal(t, &smallest, empty.NextKey)
+
+	// pages follow hashed locations
+	paged := StorageMap{}
+	var start hexutil.Bytes
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, len(all.Storage))
+		page, err := api.StorageRangeAt(ctx, block8, 0, token, start, 5)
+		require.NoError(t, err)
+		for seckey, entry := range page.Storage {
+			require.True(t, bytes.Compare(seckey[:], start) >= 0)
+			require.True(t, page.NextKey == nil || bytes.Compare(seckey[:], page.NextKey[:]) < 0)
+			paged[seckey] = entry
+		}
+		if page.NextKey == nil {
+			break
+		}
+		require.Len(t, page.Storage, 5)
+		start = page.NextKey[:]
+	}
+	require.Equal(t, all.Storage, paged)
+
+	// second transaction of block 8 transfers a token, storage changed by the first one is visible after it
+	afterTransfer, err := api.StorageRangeAt(ctx, block8, 2, token, nil, 1000)
+	require.NoError(t, err)
+	require.Len(t, afterTransfer.Storage, len(all.Storage))
+	require.NotEqual(t, all.Storage, afterTransfer.Storage)
+
+	// storage of the head block is read from HashedStorage only
+	head, err := api.StorageRangeAt(ctx, chain.TopBlock.Hash(), 0, token, nil, 1000)
+	require.NoError(t, err)
+	require.NotEmpty(t, head.Storage)
+	for _, entry := range head.Storage {
+		require.Nil(t, entry.Key)
+	}
+
+	// before deployment
+	beforeDeploy, err := api.StorageRangeAt(ctx, chain.Blocks[6].Hash(), 0, token, nil, 1000)
+	require.NoError(t, err)
+	require.Empty(t, beforeDeploy.Storage)
+	require.Nil(t, beforeDeploy.NextKey)
+
+	_, err = api.StorageRangeAt(ctx, common.Hash{1}, 0, token, nil, 10)
+	require.Error(t, err)
+}
+
+func TestGetModifiedAccounts(t *testing.T) {
+	m, chain, _ := rpcdaemontest.CreateTestSentry(t)
+	api := NewPrivateDebugAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, 0)
+	ctx := context.Background()
+	number := func(n rpc.BlockNumber) *rpc.BlockNumber { return &n }
+
+	block6, err := api.GetModifiedAccountsByNumber(ctx, 6, nil)
+	require.NoError(t, err)
+	block7, err := api.GetModifiedAccountsByNumber(ctx, 7, nil)
+	require.NoError(t, err)
+	require.Contains(t, block7, chain.Receipts[6][0].ContractAddress)
+
+	// end block is included, start block is not
+	accounts, err := api.GetModifiedAccountsByNumber(ctx, 6, number(7))
+	require.NoError(t, err)
+	require.Equal(t, block7, accounts)
+	accounts, err = api.GetModifiedAccountsByNumber(ctx, 5, number(7))
+	require.NoError(t, err)
+	for _, addr := range append(block6, block7...) {
+		require.Contains(t, accounts, addr)
+	}
+	require.True(t, sort.SliceIsSorted(accounts, func(i, j int) bool { return bytes.Compare(accounts[i][:], accounts[j][:]) < 0 }))
+
+	block7Hash := chain.Blocks[6].Hash()
+	byHash, err := api.GetModifiedAccountsByHash(ctx, chain.Blocks[4].Hash(), &block7Hash)
+	require.NoError(t, err)
+	require.Equal(t, accounts, byHash)
+	byHash, err = api.GetModifiedAccountsByHash(ctx, chain.Blocks[6].Hash(), nil)
+	require.NoError(t, err)
+	require.Equal(t, block7, byHash)
+
+	// latest block
+	_, err = api.GetModifiedAccountsByNumber(ctx, 10, nil)
+	require.NoError(t, err)
+	_, err = api.GetModifiedAccountsByNumber(ctx, 9, number(10))
+	require.NoError(t, err)
+
+	_, err = api.GetModifiedAccountsByNumber(ctx, 7, number(7))
+	require.Error(t, err)
+	_, err = api.GetModifiedAccountsByNumber(ctx, 9, number(11))
+	require.Error(t, err)
+	_, err = api.GetModifiedAccountsByNumber(ctx, 11, nil)
+	require.Error(t, err)
+	_, err = api.GetModifiedAccountsByHash(ctx, common.Hash{1}, nil)
+	require.Error(t, err)
+}
+
+func TestRewindToBlockAuth(t *testing.T) {
+	m, _, _ := rpcdaemontest.CreateTestSentry(t)
+	api := NewPrivateDebugAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, 0)
+
+	_, err := api.RewindToBlock(context.Background(), 5)
+	require.ErrorContains(t, err, "disabled")
+
+	api.SetAdmin(nil, "secret")
+	_, err = api.RewindToBlock(context.Background(), 5)
+	require.ErrorContains(t, err, "Authorization")
+	ctx := context.WithValue(context.Background(), "Authorization", "Bearer secret") //nolint:staticcheck
+	_, err = api.RewindToBlock(ctx, 5)
+	require.ErrorContains(t, err, "private API")
+}
+
+func TestZkTraceBlockRange(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	api := NewPrivateDebugAPI(
+		NewBaseApi(nil, stateCache, snapshotsync.NewBlockReader(), false),
+		db, 0)
+	for _, tt := range debugTraceTransactionTests {
+		tx, err := db.BeginRo(context.Background())
+		require.NoError(t, err)
+		_, _, blockNum, txIndex, err := rawdb.ReadTransaction(tx, common.HexToHash(tt.txHash))
+		tx.Rollback()
+		require.NoError(t, err)
+
+		result, err := api.ZkTraceBlockRange(context.Background(), rpc.BlockNumber(blockNum), rpc.BlockNumber(blockNum))
+		require.NoError(t, err)
+		r, err := zktrace.NewReader(bytes.NewReader(result))
+		require.NoError(t, err)
+		block, err := r.ReadBlock()
+		require.NoError(t, err)
+		require.Equal(t, blockNum, block.Number)
+		traced := block.Transactions[txIndex]
+		require.Equal(t, common.HexToHash(tt.txHash), traced.Hash)
+		require.Equal(t, tt.gas, traced.GasUsed)
+		require.Equal(t, tt.failed, traced.Failed)
+		for _, step := range traced.Steps {
+			switch step.Op {
+			case vm.SLOAD, vm.SSTORE, vm.BALANCE, vm.CALL, vm.STATICCALL:
+				require.NotEmpty(t, step.Accesses, "%s at pc %d", step.Op, step.PC)
+				require.Equal(t, uint32(1), step.Depth)
+			}
+		}
+		_, err = r.ReadBlock()
+		require.ErrorIs(t, err, io.EOF)
+	}
+
+	_, err := api.ZkTraceBlockRange(context.Background(), 1, maxZkTraceBlocks+1)
+	require.Error(t, err)
+}
+
+func TestProfileBlockRangeLimit(t *testing.T) {
+	m, _, _ := rpcdaemontest.CreateTestSentry(t)
+	api := NewPrivateDebugAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, 0)
+	var buf bytes.Buffer
+	stream := jsoniter.NewStream(jsoniter.ConfigDefault, &buf, 4096)
+	require.NoError(t, api.ProfileBlockRange(context.Background(), 1, 3, stream))
+	require.NoError(t, stream.Flush())
+	require.NotEqual(t, "null", buf.String())
+
+	buf.Reset()
+	stream = jsoniter.NewStream(jsoniter.ConfigDefault, &buf, 4096)
+	require.Error(t, api.ProfileBlockRange(context.Background(), 1, maxProfileBlocks+1, stream))
+}
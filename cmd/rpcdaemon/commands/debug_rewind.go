@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/services"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+)
+
+// RewindResult - head of the node after debug_rewindToBlock, sync continues from it
+type RewindResult struct {
+	Number hexutil.Uint64 `json:"number"`
+	Hash   common.Hash    `json:"hash"`
+}
+
+// SetAdmin - node which is rewound by debug_setHead/debug_rewindToBlock, authToken enables these methods
+func (api *PrivateDebugAPIImpl) SetAdmin(eth services.ApiBackend, authToken string) {
+	api.ethBackend = eth
+	api.adminAuthToken = authToken
+}
+
+// SetHead implements debug_setHead, same as debug_rewindToBlock
+func (api *PrivateDebugAPIImpl) SetHead(ctx context.Context, number hexutil.Uint64) error {
+	_, err := api.RewindToBlock(ctx, number)
+	return err
+}
+
+// RewindToBlock implements debug_rewindToBlock. Node unwinds all stages to the block and continues sync from there.
+// Refused if node is syncing, or data of unwound blocks is pruned or in snapshots.
+// Requires header "Authorization: Bearer <token>" with token of --rpc.authtoken.
+func (api *PrivateDebugAPIImpl) RewindToBlock(ctx context.Context, number hexutil.Uint64) (*RewindResult, error) {
+	if err := authorize(ctx, api.adminAuthToken, "rewind"); err != nil {
+		return nil, err
+	}
+	if api.ethBackend == nil {
+		return nil, errors.New("rewind requires private API of the node")
+	}
+	if err := api.ethBackend.Rewind(ctx, uint64(number)); err != nil {
+		return nil, fmt.Errorf("rewind to block %d: %w", number, err)
+	}
+
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	hash, err := rawdb.ReadCanonicalHash(tx, uint64(number))
+	if err != nil {
+		return nil, err
+	}
+	return &RewindResult{Number: number, Hash: hash}, nil
+}
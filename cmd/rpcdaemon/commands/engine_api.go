@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
 
@@ -15,7 +16,9 @@ import (
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/services"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/consensus/serenity"
 	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
 	"github.com/ledgerwatch/erigon/rlp"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/log/v3"
@@ -58,44 +61,44 @@ type EngineAPI interface {
 	ForkchoiceUpdatedV1(ctx context.Context, forkChoiceState *ForkChoiceState, payloadAttributes *PayloadAttributes) (map[string]interface{}, error)
 	ExecutePayloadV1(context.Context, *ExecutionPayload) (map[string]interface{}, error)
 	GetPayloadV1(ctx context.Context, payloadID hexutil.Bytes) (*ExecutionPayload, error)
+	GetPayloadV2(ctx context.Context, payloadID hexutil.Bytes) (*GetPayloadV2Response, error)
 	GetPayloadBodiesV1(ctx context.Context, blockHashes []rpc.BlockNumberOrHash) (map[common.Hash]ExecutionPayload, error)
 }
 
 // EngineImpl is implementation of the EngineAPI interface
 type EngineImpl struct {
 	*BaseAPI
-	db  kv.RoDB
-	api services.ApiBackend
+	db               kv.RoDB
+	api              services.ApiBackend
+	validatePayloads bool
 }
 
 // ForkchoiceUpdatedV1 is executed only if we are running a beacon validator,
 // in erigon we do not use this for reorgs like go-ethereum does since we can do that in engine_executePayloadV1
 // if the payloadAttributes is different than null, we return
 func (e *EngineImpl) ForkchoiceUpdatedV1(ctx context.Context, forkChoiceState *ForkChoiceState, payloadAttributes *PayloadAttributes) (map[string]interface{}, error) {
-	// Unwinds can be made within engine_excutePayloadV1 so we can return success regardless
-	if payloadAttributes == nil {
-		return map[string]interface{}{
-			"status": "SUCCESS",
-		}, nil
-	}
-	// Request for assembling payload
-	reply, err := e.api.EngineForkchoiceUpdateV1(ctx, &remote.EngineForkChoiceUpdatedRequest{
-		Prepare: &remote.EnginePreparePayload{
-			Timestamp:    uint64(payloadAttributes.Timestamp),
-			Random:       gointerfaces.ConvertHashToH256(payloadAttributes.Random),
-			FeeRecipient: gointerfaces.ConvertAddressToH160(payloadAttributes.SuggestedFeeRecipient),
-		},
+	// Fork choice state is always delivered, to keep track of safe and finalized blocks
+	req := &remote.EngineForkChoiceUpdatedRequest{
 		Forkchoice: &remote.EngineForkChoiceUpdated{
 			HeadBlockHash:      gointerfaces.ConvertHashToH256(forkChoiceState.HeadHash),
 			FinalizedBlockHash: gointerfaces.ConvertHashToH256(forkChoiceState.FinalizedBlockHash),
 			SafeBlockHash:      gointerfaces.ConvertHashToH256(forkChoiceState.SafeBlockHash),
 		},
-	})
+	}
+	// Request for assembling payload
+	if payloadAttributes != nil {
+		req.Prepare = &remote.EnginePreparePayload{
+			Timestamp:    uint64(payloadAttributes.Timestamp),
+			Random:       gointerfaces.ConvertHashToH256(payloadAttributes.Random),
+			FeeRecipient: gointerfaces.ConvertAddressToH160(payloadAttributes.SuggestedFeeRecipient),
+		}
+	}
+	reply, err := e.api.EngineForkchoiceUpdateV1(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-	// Process reply
-	if reply.Status == "SYNCING" {
+	// Process reply. Unwinds can be made within engine_excutePayloadV1 so we can return success regardless
+	if payloadAttributes == nil || reply.Status == "SYNCING" {
 		return map[string]interface{}{
 			"status": reply.Status,
 		}, nil
@@ -128,6 +131,12 @@ func (e *EngineImpl) ExecutePayloadV1(ctx context.Context, payload *ExecutionPay
 	for i, transaction := range payload.Transactions {
 		transactions[i] = ([]byte)(transaction)
 	}
+	// payload on top of the latest block is executed in memory first: invalid one never reaches the DB
+	if e.validatePayloads {
+		if status := e.validatePayload(ctx, payload, baseFee, transactions); status != nil {
+			return status, nil
+		}
+	}
 	res, err := e.api.EngineExecutePayloadV1(ctx, &types2.ExecutionPayload{
 		ParentHash:    gointerfaces.ConvertHashToH256(payload.ParentHash),
 		Coinbase:      gointerfaces.ConvertAddressToH160(payload.FeeRecipient),
@@ -160,6 +169,79 @@ func (e *EngineImpl) ExecutePayloadV1(ctx context.Context, payload *ExecutionPay
 	}, nil
 }
 
+// validatePayload - executes payload which follows the latest executed block on an in-memory overlay of the DB, returns
+// INVALID status if execution rejects it. Returns nil status for other payloads and valid ones, the node executes them.
+// Errors which say nothing about the payload (DB reads, cancellation) are logged and the node decides too.
+func (e *EngineImpl) validatePayload(ctx context.Context, payload *ExecutionPayload, baseFee *uint256.Int, transactions [][]byte) map[string]interface{} {
+	block, err := payloadToBlock(payload, baseFee, transactions)
+	if err != nil {
+		return nil // malformed payload is reported by the node
+	}
+	err = e.executePayload(ctx, block)
+	var invalid invalidBlockError
+	if errors.As(err, &invalid) {
+		log.Warn("Invalid payload", "number", block.NumberU64(), "hash", block.Hash(), "err", invalid.err)
+		return map[string]interface{}{
+			"status":          "INVALID",
+			"latestValidHash": payload.ParentHash,
+		}
+	}
+	if err != nil {
+		log.Warn("Payload not validated in memory", "number", block.NumberU64(), "hash", block.Hash(), "err", err)
+	}
+	return nil
+}
+
+func (e *EngineImpl) executePayload(ctx context.Context, block *types.Block) error {
+	tx, err := e.db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	chainConfig, err := e.chainConfig(tx)
+	if err != nil {
+		return err
+	}
+	overlay, err := e.executeOnOverlay(tx, chainConfig, block, vm.Config{})
+	if overlay != nil {
+		overlay.Rollback()
+	}
+	return err
+}
+
+// payloadToBlock - block of the payload, header is built as by the node
+func payloadToBlock(payload *ExecutionPayload, baseFee *uint256.Int, transactions [][]byte) (*types.Block, error) {
+	header := &types.Header{
+		ParentHash:  payload.ParentHash,
+		Coinbase:    payload.FeeRecipient,
+		Root:        payload.StateRoot,
+		Bloom:       types.BytesToBloom(payload.LogsBloom),
+		Extra:       payload.ExtraData,
+		Number:      new(big.Int).SetUint64(uint64(payload.BlockNumber)),
+		GasUsed:     uint64(payload.GasUsed),
+		GasLimit:    uint64(payload.GasLimit),
+		Time:        uint64(payload.Timestamp),
+		MixDigest:   payload.Random,
+		UncleHash:   types.EmptyUncleHash,
+		Difficulty:  serenity.SerenityDifficulty,
+		Nonce:       serenity.SerenityNonce,
+		ReceiptHash: payload.ReceiptsRoot,
+		TxHash:      types.DeriveSha(types.RawTransactions(transactions)),
+	}
+	if baseFee != nil {
+		header.BaseFee = baseFee.ToBig()
+		header.Eip1559 = true
+	}
+	if header.Hash() != payload.BlockHash {
+		return nil, fmt.Errorf("invalid hash for payload: %x, header: %x", payload.BlockHash, header.Hash())
+	}
+	txs, err := types.DecodeTransactions(transactions)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewBlockFromStorage(payload.BlockHash, header, txs, nil), nil
+}
+
 func (e *EngineImpl) GetPayloadV1(ctx context.Context, payloadID hexutil.Bytes) (*ExecutionPayload, error) {
 	decodedPayloadId := binary.BigEndian.Uint64(payloadID)
 	payload, err := e.api.EngineGetPayloadV1(ctx, decodedPayloadId)
@@ -250,6 +332,12 @@ func (e *EngineImpl) GetPayloadBodiesV1(ctx context.Context, blockHashes []rpc.B
 	return blockHashToBody, nil
 }
 
+// SetPayloadValidation - execute payloads on top of the latest block in memory before sending them to the node.
+// Invalid payload never reaches the DB then, but every payload is executed twice: here and by the node.
+func (e *EngineImpl) SetPayloadValidation(enabled bool) {
+	e.validatePayloads = enabled
+}
+
 // NewEngineAPI returns EngineImpl instance
 func NewEngineAPI(base *BaseAPI, db kv.RoDB, api services.ApiBackend) *EngineImpl {
 	return &EngineImpl{
@@ -0,0 +1,393 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/common/math"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// EngineFixture - recorded session of engine API, in format of blockchain tests with engine payloads (hive "pyspec"
+// simulator): client is initialized with genesis and pre state, imports blocks, then receives payloads.
+// EngineExchanges and CanonicalChain are not used by hive, they allow to replay forkchoice updates exactly and
+// to check resulting chain.
+type EngineFixture struct {
+	Network            string              `json:"network"`
+	SealEngine         string              `json:"sealEngine"`
+	Config             *params.ChainConfig `json:"config"`
+	GenesisBlockHeader *FixtureHeader      `json:"genesisBlockHeader"`
+	Pre                core.GenesisAlloc   `json:"pre"`
+	Blocks             []FixtureBlock      `json:"blocks"` // canonical chain before the first exchange
+	EngineNewPayloads  []EngineNewPayload  `json:"engineNewPayloads"`
+	EngineExchanges    []EngineExchange    `json:"engineExchanges"`
+	CanonicalChain     []FixtureBlockID    `json:"canonicalChain"` // canonical chain after the last exchange, above Blocks
+	LastBlockHash      common.Hash         `json:"lastblockhash"`
+}
+
+// FixtureHeader - block header in format of ethereum/tests
+type FixtureHeader struct {
+	Bloom            types.Bloom           `json:"bloom"`
+	Coinbase         common.Address        `json:"coinbase"`
+	MixHash          common.Hash           `json:"mixHash"`
+	Nonce            types.BlockNonce      `json:"nonce"`
+	Number           *math.HexOrDecimal256 `json:"number"`
+	Hash             common.Hash           `json:"hash"`
+	ParentHash       common.Hash           `json:"parentHash"`
+	ReceiptTrie      common.Hash           `json:"receiptTrie"`
+	StateRoot        common.Hash           `json:"stateRoot"`
+	TransactionsTrie common.Hash           `json:"transactionsTrie"`
+	UncleHash        common.Hash           `json:"uncleHash"`
+	ExtraData        hexutil.Bytes         `json:"extraData"`
+	Difficulty       *math.HexOrDecimal256 `json:"difficulty"`
+	GasLimit         math.HexOrDecimal64   `json:"gasLimit"`
+	GasUsed          math.HexOrDecimal64   `json:"gasUsed"`
+	Timestamp        math.HexOrDecimal64   `json:"timestamp"`
+	BaseFee          *math.HexOrDecimal256 `json:"baseFeePerGas,omitempty"`
+}
+
+func newFixtureHeader(h *types.Header) *FixtureHeader {
+	return &FixtureHeader{
+		Bloom:            h.Bloom,
+		Coinbase:         h.Coinbase,
+		MixHash:          h.MixDigest,
+		Nonce:            h.Nonce,
+		Number:           (*math.HexOrDecimal256)(h.Number),
+		Hash:             h.Hash(),
+		ParentHash:       h.ParentHash,
+		ReceiptTrie:      h.ReceiptHash,
+		StateRoot:        h.Root,
+		TransactionsTrie: h.TxHash,
+		UncleHash:        h.UncleHash,
+		ExtraData:        h.Extra,
+		Difficulty:       (*math.HexOrDecimal256)(h.Difficulty),
+		GasLimit:         math.HexOrDecimal64(h.GasLimit),
+		GasUsed:          math.HexOrDecimal64(h.GasUsed),
+		Timestamp:        math.HexOrDecimal64(h.Time),
+		BaseFee:          (*math.HexOrDecimal256)(h.BaseFee),
+	}
+}
+
+type FixtureBlock struct {
+	BlockHeader *FixtureHeader `json:"blockHeader"`
+	Rlp         hexutil.Bytes  `json:"rlp"`
+}
+
+type FixtureBlockID struct {
+	Number hexutil.Uint64 `json:"number"`
+	Hash   common.Hash    `json:"hash"`
+}
+
+// EngineNewPayload - payload sent to the client and the status it replied with
+type EngineNewPayload struct {
+	ExecutionPayload *ExecutionPayload `json:"executionPayload"`
+	Version          string            `json:"version"`
+	Status           string            `json:"status,omitempty"`
+	LatestValidHash  *common.Hash      `json:"latestValidHash,omitempty"`
+	Error            string            `json:"error,omitempty"`
+}
+
+// EngineExchange - call of engine API and its response
+type EngineExchange struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+	Result interface{}   `json:"result,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// EngineRecorder - EngineAPI which passes calls to the wrapped implementation and records them, with the resulting
+// canonical chain, into a test fixture. Fixture is rewritten after every exchange, so it's complete at any moment.
+// Pre state and blocks before the first exchange are included - recording is meant for devnets and testnets.
+type EngineRecorder struct {
+	engine EngineAPI
+	base   *BaseAPI
+	db     kv.RoDB
+	dir    string
+
+	lock    sync.Mutex // exchanges are recorded in order of execution
+	name    string
+	fixture *EngineFixture
+}
+
+// NewEngineRecorder returns EngineRecorder which writes fixtures to dir
+func NewEngineRecorder(engine EngineAPI, base *BaseAPI, db kv.RoDB, dir string) *EngineRecorder {
+	return &EngineRecorder{engine: engine, base: base, db: db, dir: dir}
+}
+
+func (r *EngineRecorder) ForkchoiceUpdatedV1(ctx context.Context, forkChoiceState *ForkChoiceState, payloadAttributes *PayloadAttributes) (map[string]interface{}, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.begin(ctx)
+	res, err := r.engine.ForkchoiceUpdatedV1(ctx, forkChoiceState, payloadAttributes)
+	r.record(ctx, "engine_forkchoiceUpdatedV1", res, err, forkChoiceState, payloadAttributes)
+	return res, err
+}
+
+func (r *EngineRecorder) ExecutePayloadV1(ctx context.Context, payload *ExecutionPayload) (map[string]interface{}, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.begin(ctx)
+	res, err := r.engine.ExecutePayloadV1(ctx, payload)
+	if r.fixture != nil {
+		newPayload := EngineNewPayload{ExecutionPayload: payload, Version: "1"}
+		if err != nil {
+			newPayload.Error = err.Error()
+		}
+		if status, ok := res["status"].(string); ok {
+			newPayload.Status = status
+		}
+		if hash, ok := res["latestValidHash"].(common.Hash); ok {
+			newPayload.LatestValidHash = &hash
+		}
+		r.fixture.EngineNewPayloads = append(r.fixture.EngineNewPayloads, newPayload)
+	}
+	r.record(ctx, "engine_executePayloadV1", res, err, payload)
+	return res, err
+}
+
+func (r *EngineRecorder) GetPayloadV1(ctx context.Context, payloadID hexutil.Bytes) (*ExecutionPayload, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.begin(ctx)
+	res, err := r.engine.GetPayloadV1(ctx, payloadID)
+	r.record(ctx, "engine_getPayloadV1", res, err, payloadID)
+	return res, err
+}
+
+func (r *EngineRecorder) GetPayloadV2(ctx context.Context, payloadID hexutil.Bytes) (*GetPayloadV2Response, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.begin(ctx)
+	res, err := r.engine.GetPayloadV2(ctx, payloadID)
+	r.record(ctx, "engine_getPayloadV2", res, err, payloadID)
+	return res, err
+}
+
+func (r *EngineRecorder) GetPayloadBodiesV1(ctx context.Context, blockHashes []rpc.BlockNumberOrHash) (map[common.Hash]ExecutionPayload, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.begin(ctx)
+	res, err := r.engine.GetPayloadBodiesV1(ctx, blockHashes)
+	r.record(ctx, "engine_getPayloadBodiesV1", res, err, blockHashes)
+	return res, err
+}
+
+// begin - at the first exchange captures genesis, pre state and chain, which client must have before the exchanges.
+// Recording is disabled if it fails, engine API keeps working.
+func (r *EngineRecorder) begin(ctx context.Context) {
+	if r.name != "" {
+		return
+	}
+	r.name = fmt.Sprintf("engine_%d", time.Now().Unix())
+	fixture, err := r.initialFixture(ctx)
+	if err != nil {
+		log.Warn("[engine] Recording of fixture disabled", "err", err)
+		return
+	}
+	r.fixture = fixture
+	log.Info("[engine] Recording fixture", "file", r.path(), "blocks", len(fixture.Blocks))
+}
+
+func (r *EngineRecorder) path() string {
+	return filepath.Join(r.dir, r.name+".json")
+}
+
+func (r *EngineRecorder) initialFixture(ctx context.Context) (*EngineFixture, error) {
+	tx, err := r.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	chainConfig, genesis, err := r.base.chainConfigWithGenesis(tx)
+	if err != nil {
+		return nil, err
+	}
+	pre, err := genesisAlloc(tx)
+	if err != nil {
+		return nil, err
+	}
+	fixture := &EngineFixture{
+		Network:            fixtureNetwork(chainConfig),
+		SealEngine:         "NoProof",
+		Config:             chainConfig,
+		GenesisBlockHeader: newFixtureHeader(genesis.Header()),
+		Pre:                pre,
+		Blocks:             []FixtureBlock{},
+		EngineNewPayloads:  []EngineNewPayload{},
+		EngineExchanges:    []EngineExchange{},
+		CanonicalChain:     []FixtureBlockID{},
+		LastBlockHash:      genesis.Hash(),
+	}
+	head := rawdb.ReadHeaderNumber(tx, rawdb.ReadHeadBlockHash(tx))
+	if head == nil {
+		return fixture, nil
+	}
+	for number := uint64(1); number <= *head; number++ {
+		block, err := r.base.blockByNumberWithSenders(tx, number)
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			return nil, fmt.Errorf("canonical block %d not found", number)
+		}
+		encoded, err := rlp.EncodeToBytes(block)
+		if err != nil {
+			return nil, err
+		}
+		fixture.Blocks = append(fixture.Blocks, FixtureBlock{BlockHeader: newFixtureHeader(block.Header()), Rlp: encoded})
+		fixture.LastBlockHash = block.Hash()
+	}
+	return fixture, nil
+}
+
+// genesisAlloc - state after genesis block
+func genesisAlloc(tx kv.Tx) (core.GenesisAlloc, error) {
+	alloc := core.GenesisAlloc{}
+	var acc accounts.Account
+	var incarnations []uint64
+	var addrs []common.Address
+	if err := state.WalkAsOfAccounts(tx, common.Address{}, 1, func(k, v []byte) (bool, error) {
+		if len(k) > common.AddressLength {
+			return true, nil
+		}
+		if err := acc.DecodeForStorage(v); err != nil {
+			return false, fmt.Errorf("decoding %x for %x: %w", v, k, err)
+		}
+		addr := common.BytesToAddress(k)
+		alloc[addr] = core.GenesisAccount{Balance: acc.Balance.ToBig(), Nonce: acc.Nonce}
+		addrs = append(addrs, addr)
+		incarnations = append(incarnations, acc.Incarnation)
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	for i, addr := range addrs {
+		if incarnations[i] == 0 {
+			continue
+		}
+		account := alloc[addr]
+		codeHash, err := tx.GetOne(kv.PlainContractCode, dbutils.PlainGenerateStoragePrefix(addr[:], incarnations[i]))
+		if err != nil {
+			return nil, err
+		}
+		if len(codeHash) > 0 {
+			if account.Code, err = tx.GetOne(kv.Code, codeHash); err != nil {
+				return nil, err
+			}
+		}
+		if err = state.WalkAsOfStorage(tx, addr, incarnations[i], common.Hash{}, 1, func(_, loc, vs []byte) (bool, error) {
+			if account.Storage == nil {
+				account.Storage = map[common.Hash]common.Hash{}
+			}
+			account.Storage[common.BytesToHash(loc)] = common.BytesToHash(vs)
+			return true, nil
+		}); err != nil {
+			return nil, err
+		}
+		alloc[addr] = account
+	}
+	return alloc, nil
+}
+
+// fixtureNetwork - name of the latest fork of the chain, as named in ethereum/tests
+func fixtureNetwork(config *params.ChainConfig) string {
+	switch {
+	case config.TerminalTotalDifficulty != nil:
+		return "Merge"
+	case config.ArrowGlacierBlock != nil:
+		return "ArrowGlacier"
+	case config.LondonBlock != nil:
+		return "London"
+	case config.BerlinBlock != nil:
+		return "Berlin"
+	case config.IstanbulBlock != nil:
+		return "Istanbul"
+	default:
+		return "Frontier"
+	}
+}
+
+// record - appends exchange, updates canonical chain and writes the fixture
+func (r *EngineRecorder) record(ctx context.Context, method string, result interface{}, err error, params ...interface{}) {
+	if r.fixture == nil {
+		return
+	}
+	exchange := EngineExchange{Method: method, Params: params, Result: result}
+	if err != nil {
+		exchange.Result = nil
+		exchange.Error = err.Error()
+	}
+	r.fixture.EngineExchanges = append(r.fixture.EngineExchanges, exchange)
+	if err := r.updateCanonical(ctx); err != nil {
+		log.Warn("[engine] Reading canonical chain for fixture", "err", err)
+	}
+	if err := r.write(); err != nil {
+		log.Warn("[engine] Writing fixture", "file", r.path(), "err", err)
+	}
+}
+
+func (r *EngineRecorder) updateCanonical(ctx context.Context) error {
+	tx, err := r.db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	headHash := rawdb.ReadHeadBlockHash(tx)
+	head := rawdb.ReadHeaderNumber(tx, headHash)
+	if head == nil {
+		return nil
+	}
+	r.fixture.CanonicalChain = r.fixture.CanonicalChain[:0]
+	for number := uint64(len(r.fixture.Blocks)) + 1; number <= *head; number++ {
+		hash, err := rawdb.ReadCanonicalHash(tx, number)
+		if err != nil {
+			return err
+		}
+		r.fixture.CanonicalChain = append(r.fixture.CanonicalChain, FixtureBlockID{Number: hexutil.Uint64(number), Hash: hash})
+	}
+	r.fixture.LastBlockHash = headHash
+	return nil
+}
+
+// write - replaces fixture file atomically
+func (r *EngineRecorder) write() error {
+	data, err := json.MarshalIndent(map[string]*EngineFixture{r.name: r.fixture}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(r.dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(r.dir, r.name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path())
+}
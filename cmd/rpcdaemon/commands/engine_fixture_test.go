@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEngine - inserts next block of the chain on every payload, like the node which accepted it
+type fakeEngine struct {
+	insert func() error
+}
+
+func (e *fakeEngine) ForkchoiceUpdatedV1(ctx context.Context, forkChoiceState *ForkChoiceState, payloadAttributes *PayloadAttributes) (map[string]interface{}, error) {
+	return map[string]interface{}{"status": "SUCCESS"}, nil
+}
+
+func (e *fakeEngine) ExecutePayloadV1(ctx context.Context, payload *ExecutionPayload) (map[string]interface{}, error) {
+	if err := e.insert(); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"status": "VALID", "latestValidHash": payload.BlockHash}, nil
+}
+
+func (e *fakeEngine) GetPayloadV1(ctx context.Context, payloadID hexutil.Bytes) (*ExecutionPayload, error) {
+	return nil, errors.New("unknown payload")
+}
+
+func (e *fakeEngine) GetPayloadV2(ctx context.Context, payloadID hexutil.Bytes) (*GetPayloadV2Response, error) {
+	return nil, errors.New("unknown payload")
+}
+
+func (e *fakeEngine) GetPayloadBodiesV1(ctx context.Context, blockHashes []rpc.BlockNumberOrHash) (map[common.Hash]ExecutionPayload, error) {
+	return nil, nil
+}
+
+func TestEngineRecorder(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	contract := common.Address{0xcc}
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc: core.GenesisAlloc{
+			sender:   {Balance: big.NewInt(params.Ether)},
+			contract: {Balance: big.NewInt(0), Code: []byte{0x60, 0x00}, Storage: map[common.Hash]common.Hash{{1}: {2}}},
+		},
+	}
+	m := stages.MockWithGenesis(t, gspec, key)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 3, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain.Slice(0, 2)))
+
+	dir := t.TempDir()
+	engine := &fakeEngine{insert: func() error { return m.InsertChain(chain.Slice(2, 3)) }}
+	recorder := NewEngineRecorder(engine, NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, dir)
+
+	ctx := context.Background()
+	payload := &ExecutionPayload{BlockHash: chain.TopBlock.Hash(), BlockNumber: 3}
+	res, err := recorder.ExecutePayloadV1(ctx, payload)
+	require.NoError(t, err)
+	require.Equal(t, "VALID", res["status"])
+	_, err = recorder.ForkchoiceUpdatedV1(ctx, &ForkChoiceState{HeadHash: chain.TopBlock.Hash()}, nil)
+	require.NoError(t, err)
+	_, err = recorder.GetPayloadV1(ctx, hexutil.Bytes{0, 0, 0, 0, 0, 0, 0, 1})
+	require.Error(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := ioutil.ReadFile(files[0])
+	require.NoError(t, err)
+	var fixtures map[string]*EngineFixture
+	require.NoError(t, json.Unmarshal(data, &fixtures))
+	require.Len(t, fixtures, 1)
+	for _, fixture := range fixtures {
+		require.Equal(t, m.Genesis.Hash(), fixture.GenesisBlockHeader.Hash)
+		require.Equal(t, m.Genesis.Root(), fixture.GenesisBlockHeader.StateRoot)
+		require.Equal(t, gspec.Alloc[contract].Code, fixture.Pre[contract].Code)
+		require.Equal(t, gspec.Alloc[contract].Storage, fixture.Pre[contract].Storage)
+		require.Equal(t, gspec.Alloc[sender].Balance, fixture.Pre[sender].Balance)
+		require.Len(t, fixture.Pre, 2)
+
+		// blocks before the first exchange
+		require.Len(t, fixture.Blocks, 2)
+		var block types.Block
+		require.NoError(t, rlp.DecodeBytes(fixture.Blocks[1].Rlp, &block))
+		require.Equal(t, chain.Blocks[1].Hash(), block.Hash())
+		require.Equal(t, chain.Blocks[1].Hash(), fixture.Blocks[1].BlockHeader.Hash)
+
+		require.Len(t, fixture.EngineNewPayloads, 1)
+		require.Equal(t, "VALID", fixture.EngineNewPayloads[0].Status)
+		require.Equal(t, chain.TopBlock.Hash(), *fixture.EngineNewPayloads[0].LatestValidHash)
+		require.Len(t, fixture.EngineExchanges, 3)
+		require.Equal(t, "engine_forkchoiceUpdatedV1", fixture.EngineExchanges[1].Method)
+		require.NotEmpty(t, fixture.EngineExchanges[2].Error)
+
+		require.Equal(t, []FixtureBlockID{{Number: 3, Hash: chain.TopBlock.Hash()}}, fixture.CanonicalChain)
+		require.Equal(t, chain.TopBlock.Hash(), fixture.LastBlockHash)
+	}
+}
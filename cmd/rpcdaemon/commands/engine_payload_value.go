@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/consensus/ethash"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/ethdb"
+)
+
+// GetPayloadV2Response - reply of engine_getPayloadV2: payload and its value for fee recipient.
+// Payloads have no withdrawals - this chain has no Shanghai fork yet.
+type GetPayloadV2Response struct {
+	ExecutionPayload *ExecutionPayload `json:"executionPayload"`
+	BlockValue       *hexutil.Big      `json:"blockValue"`
+}
+
+// GetPayloadV2 - same payload as GetPayloadV1 with blockValue: balance increase of fee recipient by transactions of
+// payload (priority fees and direct payments, e.g. of MEV searchers). Transactions are executed on top of the parent
+// to calculate the value.
+func (e *EngineImpl) GetPayloadV2(ctx context.Context, payloadID hexutil.Bytes) (*GetPayloadV2Response, error) {
+	payload, err := e.GetPayloadV1(ctx, payloadID)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := e.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	value, err := e.payloadValue(ctx, tx, payload)
+	if err != nil {
+		return nil, fmt.Errorf("value of payload %x: %w", payload.BlockHash, err)
+	}
+	return &GetPayloadV2Response{ExecutionPayload: payload, BlockValue: (*hexutil.Big)(value)}, nil
+}
+
+// payloadValue - executes transactions of payload in memory and returns balance increase of its fee recipient
+func (e *EngineImpl) payloadValue(ctx context.Context, tx kv.Tx, payload *ExecutionPayload) (*big.Int, error) {
+	chainConfig, err := e.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := rawdb.ReadHeaderByHash(tx, payload.ParentHash)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil {
+		return nil, fmt.Errorf("parent %x not found", payload.ParentHash)
+	}
+	rawTxs := make([][]byte, len(payload.Transactions))
+	for i, rawTx := range payload.Transactions {
+		rawTxs[i] = rawTx
+	}
+	txs, err := types.DecodeTransactions(rawTxs)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &types.Header{
+		ParentHash: payload.ParentHash,
+		Coinbase:   payload.FeeRecipient,
+		Difficulty: new(big.Int),
+		Number:     new(big.Int).SetUint64(uint64(payload.BlockNumber)),
+		GasLimit:   uint64(payload.GasLimit),
+		Time:       uint64(payload.Timestamp),
+		Extra:      payload.ExtraData,
+		MixDigest:  payload.Random,
+	}
+	if payload.BaseFeePerGas != nil {
+		header.BaseFee = payload.BaseFeePerGas.ToInt()
+		header.Eip1559 = true
+	}
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		return rawdb.ReadHeader(tx, hash, number)
+	}
+	contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
+	if e.TevmEnabled {
+		contractHasTEVM = ethdb.GetHasTEVM(tx)
+	}
+	ibs := state.New(state.NewPlainState(tx, parent.Number.Uint64()+1, e.historySnapshots))
+	noop := state.NewNoopWriter()
+	engine := ethash.NewFaker()
+	gp := new(core.GasPool).AddGas(header.GasLimit)
+
+	before := ibs.GetBalance(header.Coinbase).ToBig()
+	for i, txn := range txs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		ibs.Prepare(txn.Hash(), common.Hash{}, i)
+		if _, _, err := core.ApplyTransaction(chainConfig, getHeader, engine, &header.Coinbase, gp, ibs, noop, header, txn, &header.GasUsed, vm.Config{}, contractHasTEVM); err != nil {
+			return nil, fmt.Errorf("transaction %d (%x): %w", i, txn.Hash(), err)
+		}
+	}
+	value := new(big.Int).Sub(ibs.GetBalance(header.Coinbase).ToBig(), before)
+	if value.Sign() < 0 { // fee recipient paid more by own transactions than received
+		value.SetUint64(0)
+	}
+	return value, nil
+}
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/consensus/misc"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadValue(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	chainConfig := *params.TestChainConfig
+	chainConfig.LondonBlock = big.NewInt(0) // to have base fee
+	gspec := &core.Genesis{
+		Config: &chainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	m := stages.MockWithGenesis(t, gspec, key)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 1, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	feeRecipient := common.Address{0xfe}
+	signer := types.LatestSignerForChainID(m.ChainConfig.ChainID)
+	gasPrice := uint256.NewInt(10 * params.GWei)
+	payload := &ExecutionPayload{
+		ParentHash:    chain.TopBlock.Hash(),
+		FeeRecipient:  feeRecipient,
+		BlockNumber:   2,
+		GasLimit:      hexutil.Uint64(chain.TopBlock.GasLimit()),
+		Timestamp:     hexutil.Uint64(chain.TopBlock.Time() + 12),
+		BaseFeePerGas: (*hexutil.Big)(misc.CalcBaseFee(m.ChainConfig, chain.TopBlock.Header())),
+	}
+	for nonce, to := range []common.Address{feeRecipient, {2}} {
+		txn, err := types.SignTx(types.NewTransaction(uint64(nonce), to, uint256.NewInt(1000), params.TxGas, gasPrice, nil), *signer, key)
+		require.NoError(t, err)
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, txn.MarshalBinary(buf))
+		payload.Transactions = append(payload.Transactions, buf.Bytes())
+	}
+
+	api := NewEngineAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil)
+	tx, err := m.DB.BeginRo(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	value, err := api.payloadValue(context.Background(), tx, payload)
+	require.NoError(t, err)
+	tip := new(big.Int).Sub(gasPrice.ToBig(), payload.BaseFeePerGas.ToInt())
+	tips := new(big.Int).Mul(tip, big.NewInt(2*int64(params.TxGas)))
+	require.Equal(t, new(big.Int).Add(tips, big.NewInt(1000)), value) // priority fees and direct payment
+
+	payload.Transactions = payload.Transactions[1:] // nonce 1 can't go first
+	_, err = api.payloadValue(context.Background(), tx, payload)
+	require.Error(t, err)
+}
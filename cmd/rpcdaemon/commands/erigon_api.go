@@ -2,10 +2,13 @@ package commands
 
 import (
 	"context"
+	"sync"
 
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/services"
 	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/consensus"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/p2p"
 	"github.com/ledgerwatch/erigon/rpc"
@@ -15,10 +18,14 @@ import (
 type ErigonAPI interface {
 	// System related (see ./erigon_system.go)
 	Forks(ctx context.Context) (Forks, error)
+	Forkchoice(ctx context.Context) (*Forkchoice, error)
+	GasCaps(ctx context.Context) (*GasCaps, error)
+	VersionInfo(ctx context.Context) (*VersionInfo, error) // see ./erigon_version_info.go
 
 	// Blocks related (see ./erigon_blocks.go)
 	GetHeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error)
 	GetHeaderByHash(_ context.Context, hash common.Hash) (*types.Header, error)
+	GetUncleInclusion(ctx context.Context, uncleHash common.Hash) (map[string]interface{}, error)
 
 	// Receipt related (see ./erigon_receipts.go)
 	GetLogsByHash(ctx context.Context, hash common.Hash) ([][]*types.Log, error)
@@ -27,6 +34,40 @@ type ErigonAPI interface {
 	// WatchTheBurn / reward related (see ./erigon_issuance.go)
 	WatchTheBurn(ctx context.Context, blockNr rpc.BlockNumber) (Issuance, error)
 
+	// Fees of transactions to the contract (see ./erigon_fees.go)
+	GasPricePercentiles(ctx context.Context, to common.Address, blockCount rpc.DecimalOrHex, percentiles []float64) (*ContractFeesResult, error)
+
+	// Storage range with proofs (see ./erigon_storage_proofs.go)
+	GetStorageRangeWithProofs(ctx context.Context, address common.Address, start common.Hash, maxResult int, blockNrOrHash rpc.BlockNumberOrHash) (*StorageRangeWithProofsResult, error)
+
+	// Witness of block execution for stateless verification (see ./erigon_witness.go)
+	GetBlockWitness(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*BlockWitness, error)
+
+	// Balance history from history index (see ./erigon_balances.go)
+	GetHistoricalBalances(ctx context.Context, address common.Address, fromBlock, toBlock rpc.BlockNumber, maxResult int) (*HistoricalBalancesResult, error)
+	GetLatestAccountChange(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (*hexutil.Uint64, error)
+
+	// Calls of contract functions from call traces index (see ./erigon_selectors.go)
+	GetBlocksBySelector(ctx context.Context, contract common.Address, selector hexutil.Bytes, fromBlock, toBlock rpc.BlockNumber, maxResult int) (*SelectorCallsResult, error)
+
+	// Deployments and self-destructs of contracts (see ./erigon_code_history.go)
+	GetCodeHistory(ctx context.Context, address common.Address) ([]*CodeChange, error)
+
+	// Transactions in which the address appears (see ./erigon_appearances.go)
+	GetAddressAppearances(ctx context.Context, address common.Address, fromBlock, toBlock rpc.BlockNumber, maxResult int) (*AddressAppearancesResult, error)
+
+	// Reorgs observed by the node (see ./erigon_reorgs.go)
+	GetReorgs(ctx context.Context, fromID *hexutil.Uint64) ([]*ReorgResult, error)
+	Reorgs(ctx context.Context) (*rpc.Subscription, error)
+
+	// Light clients support (see ./erigon_light_client.go)
+	GetHeaderChainProof(ctx context.Context, number rpc.BlockNumber, anchor *common.Hash) (*HeaderChainProof, error)
+	GetFinalityUpdate(ctx context.Context) (*FinalityUpdate, error)
+
+	// State expiry research (see ./erigon_state_access.go)
+	StateAccessStats(ctx context.Context, bucketSize *hexutil.Uint64) (*StateAccessStats, error)
+	StateExpiryReport(ctx context.Context, period hexutil.Uint64, top *int) (*StateExpiryReport, error)
+
 	// NodeInfo returns a collection of metadata known about the host.
 	NodeInfo(ctx context.Context) ([]p2p.NodeInfo, error)
 }
@@ -36,6 +77,11 @@ type ErigonImpl struct {
 	*BaseAPI
 	db         kv.RoDB
 	ethBackend services.ApiBackend
+
+	borDB      kv.RoDB
+	cliqueDB   kv.RwDB
+	engineLock sync.Mutex
+	engine     consensus.Engine // engine of the chain for re-execution of blocks, created on first use
 }
 
 // NewErigonAPI returns ErigonImpl instance
@@ -46,3 +92,8 @@ func NewErigonAPI(base *BaseAPI, db kv.RoDB, eth services.ApiBackend) *ErigonImp
 		ethBackend: eth,
 	}
 }
+
+// SetConsensusDBs - databases of Bor and Clique engines, nil if they are not available
+func (api *ErigonImpl) SetConsensusDBs(borDB kv.RoDB, cliqueDB kv.RwDB) {
+	api.borDB, api.cliqueDB = borDB, cliqueDB
+}
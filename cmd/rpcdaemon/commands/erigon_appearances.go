@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb/bitmapdb"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+const (
+	// maxAddressAppearances - limit of appearances returned by one erigon_getAddressAppearances call
+	maxAddressAppearances = 10_000
+)
+
+// Appearance - transaction in which the address appears
+type Appearance struct {
+	BlockNumber      hexutil.Uint64 `json:"blockNumber"`
+	TransactionIndex hexutil.Uint64 `json:"transactionIndex"`
+}
+
+// AddressAppearancesResult - appearances of the address in blocks FromBlock..ToBlock
+type AddressAppearancesResult struct {
+	FromBlock   hexutil.Uint64  `json:"fromBlock"`
+	ToBlock     hexutil.Uint64  `json:"toBlock"` // lower than requested if appearances index is behind
+	Appearances []Appearance    `json:"appearances"`
+	NextBlock   *hexutil.Uint64 `json:"nextBlock"` // result is truncated, fromBlock of the next page
+}
+
+// AddressAppearances - appearances of the address from fromBlock to toBlock, found by rawdb.AppearanceIndex.
+// Appearances of one block are never split between pages, so a page may have more than maxResult of them.
+func AddressAppearances(tx kv.Tx, address common.Address, fromBlock, toBlock uint64, maxResult int) (*AddressAppearancesResult, error) {
+	pm, err := prune.Get(tx)
+	if err != nil {
+		return nil, err
+	}
+	if !pm.Experiments.Appearances {
+		return nil, fmt.Errorf("address appearances are not indexed, node must run with `appearances` in --experiments")
+	}
+	indexed, err := stages.GetStageProgress(tx, stages.AddressAppearances)
+	if err != nil {
+		return nil, err
+	}
+	if toBlock > indexed {
+		toBlock = indexed
+	}
+	if fromBlock > toBlock {
+		return nil, fmt.Errorf("fromBlock %d is higher than toBlock %d (appearances are indexed up to %d)", fromBlock, toBlock, indexed)
+	}
+
+	from, to := rawdb.AppearanceID(fromBlock, 0), rawdb.AppearanceID(toBlock, rawdb.MaxAppearanceTxIndex)
+	ids, err := bitmapdb.Get64(tx, rawdb.AppearanceIndex, address[:], from, to)
+	if err != nil {
+		return nil, err
+	}
+	// bitmap may include appearances of the chunks outside of the range
+	ids.RemoveRange(0, from)
+	ids.RemoveRange(to+1, math.MaxUint64)
+
+	result := &AddressAppearancesResult{FromBlock: hexutil.Uint64(fromBlock), ToBlock: hexutil.Uint64(toBlock), Appearances: []Appearance{}}
+	for it := ids.Iterator(); it.HasNext(); {
+		blockNum, txIndex := rawdb.SplitAppearanceID(it.Next())
+		if n := len(result.Appearances); n >= maxResult && uint64(result.Appearances[n-1].BlockNumber) != blockNum {
+			next := hexutil.Uint64(blockNum)
+			result.NextBlock = &next
+			break
+		}
+		result.Appearances = append(result.Appearances, Appearance{BlockNumber: hexutil.Uint64(blockNum), TransactionIndex: hexutil.Uint64(txIndex)})
+	}
+	return result, nil
+}
+
+// GetAddressAppearances implements erigon_getAddressAppearances. Returns transactions in which the address appears:
+// as sender or recipient, in internal calls (including self-destruct beneficiaries), as log address or log topic.
+// Requires `appearances` experiment, it's meant for wallet history without scanning of all blocks.
+func (api *ErigonImpl) GetAddressAppearances(ctx context.Context, address common.Address, fromBlock, toBlock rpc.BlockNumber, maxResult int) (*AddressAppearancesResult, error) {
+	if maxResult <= 0 || maxResult > maxAddressAppearances {
+		maxResult = maxAddressAppearances
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	from, err := getBlockNumber(fromBlock, tx)
+	if err != nil {
+		return nil, err
+	}
+	to, err := getBlockNumber(toBlock, tx)
+	if err != nil {
+		return nil, err
+	}
+	return AddressAppearances(tx, address, from, to, maxResult)
+}
@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAddressAppearances(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	pm := prune.DefaultMode
+	pm.Experiments.Appearances = true
+	m := stages.MockWithGenesisPruneMode(t, gspec, key, pm)
+	signer := types.LatestSignerForChainID(nil)
+
+	// contract calls `callee` and emits log with `topic` address
+	callee := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	topic := common.HexToAddress("0xcccccccccccccccccccccccccccccccccccccccc")
+	recipient := common.Address{2}
+	contract := crypto.CreateAddress(sender, 0)
+	initCode := common.FromHex("0x603f600c600039603f6000f3" +
+		"60006000600060006000" + "73" + callee.Hex()[2:] + "61fffff150" +
+		"73" + topic.Hex()[2:] + "60006000a1" + "00")
+
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 3, func(i int, b *core.BlockGen) {
+		var txs []types.Transaction
+		switch i {
+		case 0:
+			txs = append(txs, types.NewContractCreation(b.TxNonce(sender), uint256.NewInt(0), 200_000, uint256.NewInt(1), initCode))
+		case 1:
+			txs = append(txs, types.NewTransaction(b.TxNonce(sender), recipient, uint256.NewInt(7), params.TxGas, uint256.NewInt(1), nil))
+			txs = append(txs, types.NewTransaction(b.TxNonce(sender)+1, contract, uint256.NewInt(0), 200_000, uint256.NewInt(1), nil))
+		}
+		for _, txn := range txs {
+			signed, err := types.SignTx(txn, *signer, key)
+			require.NoError(t, err)
+			b.AddTx(signed)
+		}
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	fork, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 4, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+	// node saves its prune mode at start, mock doesn't
+	require.NoError(t, m.DB.Update(context.Background(), func(tx kv.RwTx) error { return prune.Override(tx, pm) }))
+
+	api := NewErigonAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil)
+	ctx := context.Background()
+	appearancesOf := func(address common.Address, from, to rpc.BlockNumber, maxResult int) *AddressAppearancesResult {
+		res, err := api.GetAddressAppearances(ctx, address, from, to, maxResult)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := appearancesOf(sender, rpc.EarliestBlockNumber, rpc.LatestBlockNumber, 0)
+	require.Equal(t, hexutil.Uint64(3), res.ToBlock)
+	require.Equal(t, []Appearance{{1, 0}, {2, 0}, {2, 1}}, res.Appearances)
+	require.Nil(t, res.NextBlock)
+	require.Equal(t, []Appearance{{1, 0}, {2, 1}}, appearancesOf(contract, 0, 3, 0).Appearances)
+	require.Equal(t, []Appearance{{2, 0}}, appearancesOf(recipient, 0, 3, 0).Appearances)
+	require.Equal(t, []Appearance{{2, 1}}, appearancesOf(callee, 0, 3, 0).Appearances)
+	require.Equal(t, []Appearance{{2, 1}}, appearancesOf(topic, 0, 3, 0).Appearances)
+
+	// pages don't split blocks
+	res = appearancesOf(sender, 0, 3, 1)
+	require.Equal(t, []Appearance{{1, 0}}, res.Appearances)
+	require.Equal(t, hexutil.Uint64(2), *res.NextBlock)
+	res = appearancesOf(sender, 2, 3, 1)
+	require.Equal(t, []Appearance{{2, 0}, {2, 1}}, res.Appearances)
+	require.Nil(t, res.NextBlock)
+
+	// reorg to the longer chain without transactions unwinds the index
+	require.NoError(t, m.InsertChain(fork))
+	res = appearancesOf(sender, 0, rpc.LatestBlockNumber, 0)
+	require.Equal(t, hexutil.Uint64(4), res.ToBlock)
+	require.Empty(t, res.Appearances)
+	require.Empty(t, appearancesOf(callee, 0, 4, 0).Appearances)
+}
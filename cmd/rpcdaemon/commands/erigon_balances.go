@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb/bitmapdb"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+const (
+	// maxHistoricalBalances - limit of balance changes returned by one erigon_getHistoricalBalances call
+	maxHistoricalBalances = 10_000
+)
+
+// BalanceChange - balance of the account after the block
+type BalanceChange struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	Balance     *hexutil.Big   `json:"balance"`
+}
+
+// HistoricalBalancesResult - balance changes of the account in blocks FromBlock..ToBlock
+type HistoricalBalancesResult struct {
+	FromBlock      hexutil.Uint64  `json:"fromBlock"`
+	ToBlock        hexutil.Uint64  `json:"toBlock"`        // lower than requested if history index is behind
+	InitialBalance *hexutil.Big    `json:"initialBalance"` // before FromBlock
+	Changes        []BalanceChange `json:"changes"`
+	NextBlock      *hexutil.Uint64 `json:"nextBlock"` // result is truncated, fromBlock of the next page
+}
+
+// balanceAsOf - balance before block blockNum, by history of database (pruned blocks are rejected by HistoricalBalances)
+func balanceAsOf(tx kv.Tx, indexC kv.Cursor, changesC kv.CursorDupSort, address common.Address, blockNum uint64) (*uint256.Int, error) {
+	enc, err := state.GetAsOf(tx, nil /* history */, indexC, changesC, false, address.Bytes(), blockNum)
+	if err != nil {
+		return nil, err
+	}
+	if len(enc) == 0 {
+		return new(uint256.Int), nil
+	}
+	var acc accounts.Account
+	if err = acc.DecodeForStorage(enc); err != nil {
+		return nil, err
+	}
+	return &acc.Balance, nil
+}
+
+// HistoricalBalances - at most maxResult blocks from fromBlock to toBlock which changed balance of the account, found
+// by history index: one call instead of eth_getBalance for every block
+func HistoricalBalances(tx kv.Tx, address common.Address, fromBlock, toBlock uint64, maxResult int) (*HistoricalBalancesResult, error) {
+	indexed, err := stages.GetStageProgress(tx, stages.AccountHistoryIndex)
+	if err != nil {
+		return nil, err
+	}
+	if toBlock > indexed {
+		toBlock = indexed
+	}
+	if fromBlock > toBlock {
+		return nil, fmt.Errorf("fromBlock %d is higher than toBlock %d (history is indexed up to %d)", fromBlock, toBlock, indexed)
+	}
+	pm, err := prune.Get(tx)
+	if err != nil {
+		return nil, err
+	}
+	if pm.History.Enabled() && fromBlock < pm.History.PruneTo(indexed) {
+		return nil, fmt.Errorf("history is pruned before block %d", pm.History.PruneTo(indexed))
+	}
+
+	indexC, err := tx.Cursor(kv.AccountsHistory)
+	if err != nil {
+		return nil, err
+	}
+	defer indexC.Close()
+	changesC, err := tx.CursorDupSort(kv.AccountChangeSet)
+	if err != nil {
+		return nil, err
+	}
+	defer changesC.Close()
+
+	balance, err := balanceAsOf(tx, indexC, changesC, address, fromBlock)
+	if err != nil {
+		return nil, err
+	}
+	result := &HistoricalBalancesResult{
+		FromBlock:      hexutil.Uint64(fromBlock),
+		ToBlock:        hexutil.Uint64(toBlock),
+		InitialBalance: (*hexutil.Big)(balance.ToBig()),
+		Changes:        []BalanceChange{},
+	}
+	blocks, err := bitmapdb.Get64(tx, kv.AccountsHistory, address.Bytes(), fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	// bitmap may include blocks of the chunks outside of the range
+	blocks.RemoveRange(0, fromBlock)
+	blocks.RemoveRange(toBlock+1, math.MaxUint64)
+	for it := blocks.Iterator(); it.HasNext(); {
+		blockNum := it.Next()
+		// account changed, but maybe not its balance
+		after, err := balanceAsOf(tx, indexC, changesC, address, blockNum+1)
+		if err != nil {
+			return nil, err
+		}
+		if after.Eq(balance) {
+			continue
+		}
+		if len(result.Changes) == maxResult {
+			next := hexutil.Uint64(blockNum)
+			result.NextBlock = &next
+			break
+		}
+		result.Changes = append(result.Changes, BalanceChange{BlockNumber: hexutil.Uint64(blockNum), Balance: (*hexutil.Big)(after.ToBig())})
+		balance = after
+	}
+	return result, nil
+}
+
+// GetHistoricalBalances implements erigon_getHistoricalBalances. Returns balance of the address after every block of
+// the range which changed it, and the balance before the range.
+func (api *ErigonImpl) GetHistoricalBalances(ctx context.Context, address common.Address, fromBlock, toBlock rpc.BlockNumber, maxResult int) (*HistoricalBalancesResult, error) {
+	if maxResult <= 0 || maxResult > maxHistoricalBalances {
+		maxResult = maxHistoricalBalances
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	from, err := getBlockNumber(fromBlock, tx)
+	if err != nil {
+		return nil, err
+	}
+	to, err := getBlockNumber(toBlock, tx)
+	if err != nil {
+		return nil, err
+	}
+	return HistoricalBalances(tx, address, from, to, maxResult)
+}
+
+// GetLatestAccountChange implements erigon_getLatestAccountChange. Returns the last block up to blockNr (inclusive)
+// which changed the account (balance, nonce, code or storage root), or null if the account never changed. Blocks
+// pruned from history of database are searched in history snapshots, skipping segments by their blooms.
+func (api *ErigonImpl) GetLatestAccountChange(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (*hexutil.Uint64, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	blockNum, err := getBlockNumber(blockNr, tx)
+	if err != nil {
+		return nil, err
+	}
+	indexed, err := stages.GetStageProgress(tx, stages.AccountHistoryIndex)
+	if err != nil {
+		return nil, err
+	}
+	if blockNum > indexed {
+		return nil, fmt.Errorf("block %d is not indexed yet, history is indexed up to %d", blockNum, indexed)
+	}
+	changed, ok, err := state.LatestAccountChange(tx, api.historySnapshots, address, blockNum)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return (*hexutil.Uint64)(&changed), nil
+}
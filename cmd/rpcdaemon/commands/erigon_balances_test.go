@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetHistoricalBalances(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	receiver := common.Address{1}
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	m := stages.MockWithGenesis(t, gspec, key)
+	signer := types.LatestSignerForChainID(nil)
+
+	// receiver gets 1000 wei in blocks 1 and 3
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 4, func(i int, b *core.BlockGen) {
+		if i != 0 && i != 2 {
+			return
+		}
+		txn, err := types.SignTx(types.NewTransaction(b.TxNonce(sender), receiver, uint256.NewInt(1000), 21_000, uint256.NewInt(1), nil), *signer, key)
+		require.NoError(t, err)
+		b.AddTx(txn)
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	api := NewErigonAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil)
+	ctx := context.Background()
+
+	res, err := api.GetHistoricalBalances(ctx, receiver, rpc.EarliestBlockNumber, rpc.LatestBlockNumber, 0)
+	require.NoError(t, err)
+	require.Equal(t, hexutil.Uint64(4), res.ToBlock)
+	require.Equal(t, int64(0), res.InitialBalance.ToInt().Int64())
+	require.Len(t, res.Changes, 2)
+	require.Equal(t, hexutil.Uint64(1), res.Changes[0].BlockNumber)
+	require.Equal(t, int64(1000), res.Changes[0].Balance.ToInt().Int64())
+	require.Equal(t, hexutil.Uint64(3), res.Changes[1].BlockNumber)
+	require.Equal(t, int64(2000), res.Changes[1].Balance.ToInt().Int64())
+	require.Nil(t, res.NextBlock)
+
+	// paging
+	res, err = api.GetHistoricalBalances(ctx, receiver, 0, 4, 1)
+	require.NoError(t, err)
+	require.Len(t, res.Changes, 1)
+	require.Equal(t, hexutil.Uint64(3), *res.NextBlock)
+	res, err = api.GetHistoricalBalances(ctx, receiver, 3, 4, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), res.InitialBalance.ToInt().Int64())
+	require.Len(t, res.Changes, 1)
+	require.Equal(t, hexutil.Uint64(3), res.Changes[0].BlockNumber)
+	require.Nil(t, res.NextBlock)
+
+	// sender pays for gas too
+	res, err = api.GetHistoricalBalances(ctx, sender, 2, 2, 0)
+	require.NoError(t, err)
+	require.Equal(t, new(big.Int).Sub(big.NewInt(params.Ether), big.NewInt(1000+21_000)), res.InitialBalance.ToInt())
+	require.Empty(t, res.Changes)
+
+	_, err = api.GetHistoricalBalances(ctx, sender, 5, 4, 0)
+	require.Error(t, err)
+
+	changed, err := api.GetLatestAccountChange(ctx, receiver, rpc.LatestBlockNumber)
+	require.NoError(t, err)
+	require.Equal(t, hexutil.Uint64(3), *changed)
+	changed, err = api.GetLatestAccountChange(ctx, receiver, 2)
+	require.NoError(t, err)
+	require.Equal(t, hexutil.Uint64(1), *changed)
+	changed, err = api.GetLatestAccountChange(ctx, common.Address{2}, rpc.LatestBlockNumber)
+	require.NoError(t, err)
+	require.Nil(t, changed)
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 
 	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
 	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
 	"github.com/ledgerwatch/erigon/rpc"
 )
 
@@ -58,3 +61,57 @@ func (api *ErigonImpl) GetHeaderByHash(ctx context.Context, hash common.Hash) (*
 
 	return header, nil
 }
+
+// GetUncleInclusion implements erigon_getUncleInclusion. Returns number, hash of the canonical block which included given uncle and index of uncle in this block.
+// Index is pruned with transaction lookup index, unknown uncle is an error then - it may be included by a pruned block.
+func (api *ErigonImpl) GetUncleInclusion(ctx context.Context, uncleHash common.Hash) (map[string]interface{}, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	blockNum, err := rawdb.ReadUncleInclusion(tx, uncleHash)
+	if err != nil {
+		return nil, err
+	}
+	if blockNum == nil {
+		// index is pruned together with transaction lookup index (--prune=t)
+		pm, err := prune.Get(tx)
+		if err != nil {
+			return nil, err
+		}
+		if pm.TxIndex.Enabled() {
+			indexed, err := stages.GetStageProgress(tx, stages.TxLookup)
+			if err != nil {
+				return nil, err
+			}
+			if pruneTo := pm.TxIndex.PruneTo(indexed); pruneTo > 0 {
+				return nil, fmt.Errorf("uncle not found, uncle inclusion index is pruned before block %d by --prune=t", pruneTo)
+			}
+		}
+		return nil, nil // not error, see https://github.com/ledgerwatch/erigon/issues/1645
+	}
+	hash, err := rawdb.ReadCanonicalHash(tx, *blockNum)
+	if err != nil {
+		return nil, err
+	}
+	uncles, found, err := api.uncles(ctx, tx, hash, *blockNum)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+	for i, uncle := range uncles {
+		if uncle.Hash() != uncleHash {
+			continue
+		}
+		return map[string]interface{}{
+			"blockNumber": hexutil.Uint64(*blockNum),
+			"blockHash":   hash,
+			"uncleIndex":  hexutil.Uint(i),
+		}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUncleInclusionPruned(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{crypto.PubkeyToAddress(key.PublicKey): {Balance: big.NewInt(params.Ether)}},
+	}
+	pm := prune.DefaultMode
+	pm.TxIndex = prune.Distance(2)
+	m := stages.MockWithGenesisPruneMode(t, gspec, key, pm)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 5, func(i int, b *core.BlockGen) {}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+	// node saves its prune mode at start, mock doesn't
+	require.NoError(t, m.DB.Update(context.Background(), func(tx kv.RwTx) error { return prune.Override(tx, pm) }))
+
+	// uncle unknown to the index may be included by a pruned block
+	api := NewErigonAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil)
+	_, err = api.GetUncleInclusion(context.Background(), common.Hash{1})
+	require.ErrorContains(t, err, "pruned before block 3")
+}
@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/ledgerwatch/erigon-lib/common/length"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+)
+
+const (
+	CodeChangeDeploy       = "deploy"
+	CodeChangeRedeploy     = "redeploy"
+	CodeChangeSelfDestruct = "selfdestruct"
+)
+
+// CodeChange - change of contract code by the block
+type CodeChange struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	Type        string         `json:"type"` // deploy, redeploy (after self-destruct) or selfdestruct
+	Incarnation hexutil.Uint64 `json:"incarnation"`
+	CodeHash    *common.Hash   `json:"codeHash"` // nil for selfdestruct
+}
+
+// CodeHistory - code changes of the address in order of blocks, read from rawdb.CodeHistory
+func CodeHistory(tx kv.Tx, address common.Address) ([]*CodeChange, error) {
+	c, err := tx.CursorDupSort(rawdb.CodeHistory)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	history := []*CodeChange{}
+	deployed := false
+	for k, v, err := c.SeekExact(address[:]); k != nil; k, v, err = c.NextDup() {
+		if err != nil {
+			return nil, err
+		}
+		change := &CodeChange{
+			BlockNumber: hexutil.Uint64(binary.BigEndian.Uint64(v)),
+			Incarnation: hexutil.Uint64(binary.BigEndian.Uint64(v[8:])),
+		}
+		codeHash := common.BytesToHash(v[8+length.Incarnation:])
+		switch {
+		case codeHash == (common.Hash{}):
+			change.Type = CodeChangeSelfDestruct
+		case deployed:
+			change.Type = CodeChangeRedeploy
+			change.CodeHash = &codeHash
+		default:
+			change.Type = CodeChangeDeploy
+			change.CodeHash = &codeHash
+		}
+		// contract is deployed before the first change if it is a self-destruct
+		deployed = true
+		history = append(history, change)
+	}
+	return history, nil
+}
+
+// GetCodeHistory implements erigon_getCodeHistory. Returns deployments, self-destructs and redeployments (e.g. by
+// CREATE2 to the same address) of the contract, to find metamorphic contracts without tracing historical blocks.
+// Contracts of genesis allocation don't have a deploy record.
+func (api *ErigonImpl) GetCodeHistory(ctx context.Context, address common.Address) ([]*CodeChange, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return CodeHistory(tx, address)
+}
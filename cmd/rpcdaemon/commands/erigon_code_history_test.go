@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCodeHistory(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	m := stages.MockWithGenesis(t, gspec, key)
+	signer := types.LatestSignerForChainID(nil)
+
+	// factory deploys call data as init code by CREATE2 with zero salt, child self-destructs when called
+	factoryInit := common.FromHex("0x6e36600060003760003660006000f500600052600f6011f3")
+	childInit := common.FromHex("0x6133ff6000526002601ef3")
+	factory := crypto.CreateAddress(sender, 0)
+	child := crypto.CreateAddress2(factory, [32]byte{}, crypto.Keccak256(childInit))
+
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 5, func(i int, b *core.BlockGen) {
+		var txn types.Transaction
+		switch i {
+		case 0:
+			txn = types.NewContractCreation(b.TxNonce(sender), uint256.NewInt(0), 100_000, uint256.NewInt(1), factoryInit)
+		case 1, 3:
+			txn = types.NewTransaction(b.TxNonce(sender), factory, uint256.NewInt(0), 100_000, uint256.NewInt(1), childInit)
+		case 2:
+			txn = types.NewTransaction(b.TxNonce(sender), child, uint256.NewInt(0), 100_000, uint256.NewInt(1), nil)
+		default:
+			return
+		}
+		signed, err := types.SignTx(txn, *signer, key)
+		require.NoError(t, err)
+		b.AddTx(signed)
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	fork, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 6, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	api := NewErigonAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil)
+	ctx := context.Background()
+
+	childHash := common.BytesToHash(crypto.Keccak256(common.FromHex("0x33ff")))
+	history, err := api.GetCodeHistory(ctx, child)
+	require.NoError(t, err)
+	require.Equal(t, []*CodeChange{
+		{BlockNumber: 2, Type: CodeChangeDeploy, Incarnation: 1, CodeHash: &childHash},
+		{BlockNumber: 3, Type: CodeChangeSelfDestruct, Incarnation: 1},
+		{BlockNumber: 4, Type: CodeChangeRedeploy, Incarnation: 2, CodeHash: &childHash},
+	}, history)
+
+	history, err = api.GetCodeHistory(ctx, factory)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.Equal(t, CodeChangeDeploy, history[0].Type)
+
+	history, err = api.GetCodeHistory(ctx, sender)
+	require.NoError(t, err)
+	require.Empty(t, history)
+
+	// reorg to the longer chain without transactions unwinds code history
+	require.NoError(t, m.InsertChain(fork))
+	history, err = api.GetCodeHistory(ctx, child)
+	require.NoError(t, err)
+	require.Empty(t, history)
+}
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+var defaultFeePercentiles = []float64{10, 50, 90}
+
+// ContractFeesResult - suggested fees for transaction to the contract, every fee slice has one item per requested percentile
+type ContractFeesResult struct {
+	OldestBlock     hexutil.Uint64 `json:"oldestBlock"`
+	BlockCount      hexutil.Uint64 `json:"blockCount"`
+	BaseFee         *hexutil.Big   `json:"baseFeePerGas"` // of the next block
+	Percentiles     []float64      `json:"percentiles"`
+	GasUsed         hexutil.Uint64 `json:"gasUsed"`
+	ContractGasUsed hexutil.Uint64 `json:"contractGasUsed"`
+	ContractTxs     hexutil.Uint64 `json:"contractTransactions"`
+	GasShare        float64        `json:"contractGasShare"`
+	Hot             bool           `json:"hot"`
+	Reward          []*hexutil.Big `json:"reward"`
+	ContractReward  []*hexutil.Big `json:"contractReward"`
+	MaxPriorityFee  []*hexutil.Big `json:"maxPriorityFeePerGas"`
+	MaxFee          []*hexutil.Big `json:"maxFeePerGas"`
+}
+
+func toHexBigs(in []*big.Int) []*hexutil.Big {
+	out := make([]*hexutil.Big, len(in))
+	for i, v := range in {
+		out[i] = (*hexutil.Big)(v)
+	}
+	return out
+}
+
+// GasPricePercentiles implements erigon_gasPricePercentiles. Like eth_feeHistory reward percentiles, but over all blocks
+// of the range and additionally over transactions sent to the given address only. If the address is "hot" (its transactions
+// used a noticeable share of gas) - suggested fees follow the fees paid to the address when they are higher.
+func (api *ErigonImpl) GasPricePercentiles(ctx context.Context, to common.Address, blockCount rpc.DecimalOrHex, percentiles []float64) (*ContractFeesResult, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	cc, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	if blockCount == 0 {
+		blockCount = rpc.DecimalOrHex(api.gpo.Blocks)
+	}
+	if len(percentiles) == 0 {
+		percentiles = defaultFeePercentiles
+	}
+	oracle := api.gasPriceOracle(tx, cc)
+	fees, err := oracle.ContractFees(ctx, int(blockCount), rpc.LatestBlockNumber, to, percentiles)
+	if err != nil {
+		return nil, err
+	}
+	return &ContractFeesResult{
+		OldestBlock:     hexutil.Uint64(fees.OldestBlock),
+		BlockCount:      hexutil.Uint64(fees.Blocks),
+		BaseFee:         (*hexutil.Big)(fees.NextBaseFee),
+		Percentiles:     percentiles,
+		GasUsed:         hexutil.Uint64(fees.GasUsed),
+		ContractGasUsed: hexutil.Uint64(fees.ContractGasUsed),
+		ContractTxs:     hexutil.Uint64(fees.ContractTxs),
+		GasShare:        fees.GasShare,
+		Hot:             fees.Hot,
+		Reward:          toHexBigs(fees.Tips),
+		ContractReward:  toHexBigs(fees.ContractTips),
+		MaxPriorityFee:  toHexBigs(fees.SuggestedTips),
+		MaxFee:          toHexBigs(fees.SuggestedMaxFees),
+	}, nil
+}
@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+)
+
+// maxHeaderChainProofLength - limit of headers returned by one erigon_getHeaderChainProof call
+const maxHeaderChainProofLength = 1024
+
+// HeaderChainProof is the result of erigon_getHeaderChainProof. Headers are canonical headers from the requested block
+// up to the anchor block, each one is the parent of the next one. Client which trusts the anchor (usually finalized
+// block) checks them by hashing: hash of the last header is the anchor, hash of every other header is ParentHash of
+// the next one. After that state, transactions and receipts roots of every header can be used to verify eth_getProof
+// and other merkle proofs.
+type HeaderChainProof struct {
+	Anchor  common.Hash     `json:"anchor"`
+	Headers []*types.Header `json:"headers"`
+}
+
+// FinalityUpdate is the result of erigon_getFinalityUpdate - headers of the blocks of the last fork choice update
+// received from consensus layer (engine_forkchoiceUpdated). It's not signed by consensus layer: light client should
+// check finalized block against its own source of finality (sync committee, checkpoint) before using it as an anchor.
+type FinalityUpdate struct {
+	FinalizedHeader *types.Header  `json:"finalizedHeader"`
+	SafeHeader      *types.Header  `json:"safeHeader"`
+	HeadHeader      *types.Header  `json:"headHeader"`
+	UpdatedAt       hexutil.Uint64 `json:"updatedAt"`
+}
+
+// canonicalHeader - header of canonical block with given hash, error if block is unknown or not canonical
+func canonicalHeader(tx kv.Tx, hash common.Hash) (*types.Header, error) {
+	number := rawdb.ReadHeaderNumber(tx, hash)
+	if number == nil {
+		return nil, fmt.Errorf("block %x not found", hash)
+	}
+	canonical, err := rawdb.ReadCanonicalHash(tx, *number)
+	if err != nil {
+		return nil, err
+	}
+	if canonical != hash {
+		return nil, fmt.Errorf("block %x is not canonical", hash)
+	}
+	header := rawdb.ReadHeader(tx, hash, *number)
+	if header == nil {
+		return nil, fmt.Errorf("header %x not found", hash)
+	}
+	return header, nil
+}
+
+// GetHeaderChainProof implements erigon_getHeaderChainProof. Returns canonical headers linking the given block to the
+// anchor block. If anchor is not given, finalized block of the last fork choice update is used.
+func (api *ErigonImpl) GetHeaderChainProof(ctx context.Context, number rpc.BlockNumber, anchor *common.Hash) (*HeaderChainProof, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	blockNr, _, err := rpchelper.GetCanonicalBlockNumber(rpc.BlockNumberOrHashWithNumber(number), tx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	var anchorHash common.Hash
+	if anchor != nil {
+		anchorHash = *anchor
+	} else if _, anchorHash, err = rpchelper.GetForkchoiceBlockNumber(rpc.FinalizedBlockNumber, tx); err != nil {
+		return nil, err
+	}
+	anchorHeader, err := canonicalHeader(tx, anchorHash)
+	if err != nil {
+		return nil, err
+	}
+	anchorNr := anchorHeader.Number.Uint64()
+	if blockNr > anchorNr {
+		return nil, fmt.Errorf("block %d is after anchor block %d", blockNr, anchorNr)
+	}
+	if anchorNr-blockNr >= maxHeaderChainProofLength {
+		return nil, fmt.Errorf("block %d is too far from anchor block %d, max length of header chain is %d", blockNr, anchorNr, maxHeaderChainProofLength)
+	}
+
+	result := &HeaderChainProof{Anchor: anchorHash, Headers: make([]*types.Header, 0, anchorNr-blockNr+1)}
+	for n := blockNr; n < anchorNr; n++ {
+		hash, err := rawdb.ReadCanonicalHash(tx, n)
+		if err != nil {
+			return nil, err
+		}
+		header := rawdb.ReadHeader(tx, hash, n)
+		if header == nil {
+			return nil, fmt.Errorf("header %d not found", n)
+		}
+		result.Headers = append(result.Headers, header)
+	}
+	result.Headers = append(result.Headers, anchorHeader)
+	for i := 1; i < len(result.Headers); i++ {
+		if result.Headers[i].ParentHash != result.Headers[i-1].Hash() {
+			return nil, fmt.Errorf("canonical chain is being changed at block %d, retry", result.Headers[i].Number.Uint64())
+		}
+	}
+	return result, nil
+}
+
+// GetFinalityUpdate implements erigon_getFinalityUpdate. Returns headers of the finalized, safe and head blocks of the
+// last fork choice update, nil if Erigon doesn't follow consensus layer (there was no fork choice update).
+func (api *ErigonImpl) GetFinalityUpdate(ctx context.Context) (*FinalityUpdate, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	updatedAt := rawdb.ReadForkchoiceUpdatedAt(tx)
+	if updatedAt == 0 {
+		return nil, nil
+	}
+	result := &FinalityUpdate{UpdatedAt: hexutil.Uint64(updatedAt)}
+	// headers are nil if blocks are not downloaded yet, or not marked yet (nothing is finalized right after the merge)
+	if result.FinalizedHeader, err = rawdb.ReadHeaderByHash(tx, rawdb.ReadForkchoiceFinalized(tx)); err != nil {
+		return nil, err
+	}
+	if result.SafeHeader, err = rawdb.ReadHeaderByHash(tx, rawdb.ReadForkchoiceSafe(tx)); err != nil {
+		return nil, err
+	}
+	if result.HeadHeader, err = rawdb.ReadHeaderByHash(tx, rawdb.ReadForkchoiceHead(tx)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/rpcdaemontest"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderChainProofAndFinalityUpdate(t *testing.T) {
+	db := rpcdaemontest.CreateTestKV(t)
+	api := NewErigonAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), db, nil)
+	ctx := context.Background()
+
+	// no fork choice update yet
+	update, err := api.GetFinalityUpdate(ctx)
+	require.NoError(t, err)
+	require.Nil(t, update)
+	_, err = api.GetHeaderChainProof(ctx, 1, nil)
+	require.Error(t, err)
+
+	var head, safe, finalized common.Hash
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		var err error
+		if head, err = rawdb.ReadCanonicalHash(tx, 10); err != nil {
+			return err
+		}
+		if safe, err = rawdb.ReadCanonicalHash(tx, 8); err != nil {
+			return err
+		}
+		if finalized, err = rawdb.ReadCanonicalHash(tx, 5); err != nil {
+			return err
+		}
+		return rawdb.WriteForkchoice(tx, head, safe, finalized, 1000)
+	}))
+
+	update, err = api.GetFinalityUpdate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, finalized, update.FinalizedHeader.Hash())
+	require.Equal(t, safe, update.SafeHeader.Hash())
+	require.Equal(t, head, update.HeadHeader.Hash())
+
+	proof, err := api.GetHeaderChainProof(ctx, 2, nil)
+	require.NoError(t, err)
+	require.Equal(t, finalized, proof.Anchor)
+	require.Len(t, proof.Headers, 4)
+	require.Equal(t, uint64(2), proof.Headers[0].Number.Uint64())
+	require.Equal(t, finalized, proof.Headers[3].Hash())
+	for i := 1; i < len(proof.Headers); i++ {
+		require.Equal(t, proof.Headers[i-1].Hash(), proof.Headers[i].ParentHash)
+	}
+
+	proof, err = api.GetHeaderChainProof(ctx, 5, &head)
+	require.NoError(t, err)
+	require.Len(t, proof.Headers, 6)
+	require.Equal(t, finalized, proof.Headers[0].Hash())
+
+	_, err = api.GetHeaderChainProof(ctx, 6, nil) // after finalized block
+	require.Error(t, err)
+	_, err = api.GetHeaderChainProof(ctx, rpc.LatestBlockNumber, &common.Hash{1}) // unknown anchor
+	require.Error(t, err)
+}
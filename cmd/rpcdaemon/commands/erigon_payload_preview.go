@@ -0,0 +1,248 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/holiman/uint256"
+	proto_txpool "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/consensus/ethash"
+	"github.com/ledgerwatch/erigon/consensus/misc"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/ethdb"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+)
+
+// PayloadPreviewAPI - dry-run of block production
+type PayloadPreviewAPI interface {
+	PreviewPayload(ctx context.Context, feeRecipient common.Address, timestamp *hexutil.Uint64) (*PayloadPreview, error)
+}
+
+// PayloadPreviewImpl - implementation of PayloadPreviewAPI, registered in erigon namespace
+type PayloadPreviewImpl struct {
+	*BaseAPI
+	db        kv.RoDB
+	pool      proto_txpool.TxpoolClient
+	authToken string
+}
+
+// NewPayloadPreviewAPI returns PayloadPreviewImpl instance
+func NewPayloadPreviewAPI(base *BaseAPI, db kv.RoDB, pool proto_txpool.TxpoolClient, authToken string) *PayloadPreviewImpl {
+	return &PayloadPreviewImpl{
+		BaseAPI:   base,
+		db:        db,
+		pool:      pool,
+		authToken: authToken,
+	}
+}
+
+// PayloadPreview - payload which would be built on top of the latest block for FeeRecipient
+type PayloadPreview struct {
+	ParentHash    common.Hash                `json:"parentHash"`
+	BlockNumber   hexutil.Uint64             `json:"blockNumber"`
+	Timestamp     hexutil.Uint64             `json:"timestamp"`
+	FeeRecipient  common.Address             `json:"feeRecipient"`
+	GasLimit      hexutil.Uint64             `json:"gasLimit"`
+	GasUsed       hexutil.Uint64             `json:"gasUsed"`
+	BaseFeePerGas *hexutil.Big               `json:"baseFeePerGas"`
+	Value         *hexutil.Big               `json:"value"` // balance increase of fee recipient: priority fees and direct payments
+	Transactions  []*PayloadPreviewTx        `json:"transactions"`
+	Skipped       []*PayloadPreviewSkippedTx `json:"skipped"`
+}
+
+// PayloadPreviewTx - transaction included into previewed payload
+type PayloadPreviewTx struct {
+	Hash            common.Hash    `json:"hash"`
+	From            common.Address `json:"from"`
+	GasUsed         hexutil.Uint64 `json:"gasUsed"`
+	EffectiveGasTip *hexutil.Big   `json:"effectiveGasTip"`
+	Value           *hexutil.Big   `json:"value"`  // balance increase of fee recipient by this transaction
+	Failed          bool           `json:"failed"` // reverted, but still pays fees
+}
+
+// PayloadPreviewSkippedTx - pending transaction which can't be included into previewed payload
+type PayloadPreviewSkippedTx struct {
+	Hash  common.Hash    `json:"hash"`
+	From  common.Address `json:"from"`
+	Error string         `json:"error"`
+}
+
+// PreviewPayload implements erigon_previewPayload. Builds payload on top of the latest block from pending transactions
+// of txpool, as if feeRecipient was proposer at timestamp (now by default), and returns its value and composition.
+// Payload is executed in memory: nothing is written and the builder of the node isn't affected.
+// Requires header "Authorization: Bearer <token>" with token of --rpc.authtoken.
+func (api *PayloadPreviewImpl) PreviewPayload(ctx context.Context, feeRecipient common.Address, timestamp *hexutil.Uint64) (*PayloadPreview, error) {
+	if err := authorize(ctx, api.authToken, "payload preview"); err != nil {
+		return nil, err
+	}
+	if api.pool == nil {
+		return nil, errors.New("payload preview requires txpool")
+	}
+	groups, err := api.pendingTxs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	parentNum, parentHash, err := rpchelper.GetBlockNumber(rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), tx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	parent := rawdb.ReadHeader(tx, parentHash, parentNum)
+	if parent == nil {
+		return nil, fmt.Errorf("block %d(%x) not found", parentNum, parentHash)
+	}
+	cacheView, err := api.stateCache.View(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	ibs := state.New(state.NewCachedReader2(cacheView, tx))
+
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Coinbase:   feeRecipient,
+		Difficulty: new(big.Int).Set(parent.Difficulty),
+		Number:     new(big.Int).SetUint64(parentNum + 1),
+		GasLimit:   parent.GasLimit,
+		Time:       uint64(time.Now().Unix()),
+	}
+	if timestamp != nil {
+		header.Time = uint64(*timestamp)
+	}
+	if header.Time <= parent.Time {
+		header.Time = parent.Time + 1
+	}
+	var baseFee uint256.Int
+	if chainConfig.IsLondon(header.Number.Uint64()) {
+		header.BaseFee = misc.CalcBaseFee(chainConfig, parent)
+		header.Eip1559 = true
+		baseFee.SetFromBig(header.BaseFee)
+	}
+
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		return rawdb.ReadHeader(tx, hash, number)
+	}
+	contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
+	if api.TevmEnabled {
+		contractHasTEVM = ethdb.GetHasTEVM(tx)
+	}
+	engine := ethash.NewFaker()
+	noop := state.NewNoopWriter()
+	gp := new(core.GasPool).AddGas(header.GasLimit)
+	signer := types.MakeSigner(chainConfig, header.Number.Uint64())
+
+	preview := &PayloadPreview{
+		ParentHash:   header.ParentHash,
+		BlockNumber:  hexutil.Uint64(header.Number.Uint64()),
+		Timestamp:    hexutil.Uint64(header.Time),
+		FeeRecipient: feeRecipient,
+		GasLimit:     hexutil.Uint64(header.GasLimit),
+		Transactions: []*PayloadPreviewTx{},
+		Skipped:      []*PayloadPreviewSkippedTx{},
+	}
+	if header.BaseFee != nil {
+		preview.BaseFeePerGas = (*hexutil.Big)(header.BaseFee)
+	}
+	initialBalance := ibs.GetBalance(feeRecipient).Clone()
+	skip := func(txn types.Transaction, from common.Address, err error) {
+		preview.Skipped = append(preview.Skipped, &PayloadPreviewSkippedTx{Hash: txn.Hash(), From: from, Error: err.Error()})
+	}
+	// same selection as mining: by price, honouring nonces of sender
+	txs := types.NewTransactionsByPriceAndNonce(*signer, groups)
+	for gp.Gas() >= params.TxGas {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		txn := txs.Peek()
+		if txn == nil {
+			break
+		}
+		from, _ := txn.Sender(*signer)
+		if txn.Protected() && !chainConfig.IsEIP155(header.Number.Uint64()) {
+			skip(txn, from, errors.New("replay protected transaction before EIP-155"))
+			txs.Pop()
+			continue
+		}
+		before := ibs.GetBalance(feeRecipient).Clone()
+		snap := ibs.Snapshot()
+		ibs.Prepare(txn.Hash(), common.Hash{}, len(preview.Transactions))
+		receipt, _, err := core.ApplyTransaction(chainConfig, getHeader, engine, &feeRecipient, gp, ibs, noop, header, txn, &header.GasUsed, vm.Config{}, contractHasTEVM)
+		if err != nil {
+			ibs.RevertToSnapshot(snap)
+			skip(txn, from, err)
+			if errors.Is(err, core.ErrNonceTooLow) {
+				txs.Shift()
+			} else {
+				// next transactions of sender can't be executed without this one
+				txs.Pop()
+			}
+			continue
+		}
+		preview.Transactions = append(preview.Transactions, &PayloadPreviewTx{
+			Hash:            txn.Hash(),
+			From:            from,
+			GasUsed:         hexutil.Uint64(receipt.GasUsed),
+			EffectiveGasTip: (*hexutil.Big)(txn.GetEffectiveGasTip(&baseFee).ToBig()),
+			Value:           (*hexutil.Big)(new(big.Int).Sub(ibs.GetBalance(feeRecipient).ToBig(), before.ToBig())),
+			Failed:          receipt.Status == types.ReceiptStatusFailed,
+		})
+		txs.Shift()
+	}
+	preview.GasUsed = hexutil.Uint64(header.GasUsed)
+	preview.Value = (*hexutil.Big)(new(big.Int).Sub(ibs.GetBalance(feeRecipient).ToBig(), initialBalance.ToBig()))
+	return preview, nil
+}
+
+// pendingTxs - executable transactions of txpool, grouped by sender and sorted by nonce
+func (api *PayloadPreviewImpl) pendingTxs(ctx context.Context) (types.TransactionsGroupedBySender, error) {
+	reply, err := api.pool.All(ctx, &proto_txpool.AllRequest{})
+	if err != nil {
+		return nil, err
+	}
+	bySender := map[common.Address]types.Transactions{}
+	var senders []common.Address
+	for _, poolTx := range reply.Txs {
+		if poolTx.Type != proto_txpool.AllReply_PENDING {
+			continue
+		}
+		txn, err := types.DecodeTransaction(rlp.NewStream(bytes.NewReader(poolTx.RlpTx), 0))
+		if err != nil {
+			return nil, err
+		}
+		sender := common.BytesToAddress(poolTx.Sender)
+		txn.SetSender(sender)
+		if _, ok := bySender[sender]; !ok {
+			senders = append(senders, sender)
+		}
+		bySender[sender] = append(bySender[sender], txn)
+	}
+	groups := make(types.TransactionsGroupedBySender, 0, len(senders))
+	for _, sender := range senders {
+		sort.Sort(types.TxByNonce(bySender[sender]))
+		groups = append(groups, bySender[sender])
+	}
+	return groups, nil
+}
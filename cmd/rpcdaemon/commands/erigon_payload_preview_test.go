@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// staticTxPool - txpool with fixed transactions
+type staticTxPool struct {
+	txpool.TxpoolClient
+	txs []*txpool.AllReply_Tx
+}
+
+func (p staticTxPool) All(context.Context, *txpool.AllRequest, ...grpc.CallOption) (*txpool.AllReply, error) {
+	return &txpool.AllReply{Txs: p.txs}, nil
+}
+
+func TestPreviewPayload(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	key2, _ := crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+	sender, sender2 := crypto.PubkeyToAddress(key.PublicKey), crypto.PubkeyToAddress(key2.PublicKey)
+	chainConfig := *params.TestChainConfig
+	chainConfig.LondonBlock = big.NewInt(0) // to have base fee
+	gspec := &core.Genesis{
+		Config: &chainConfig,
+		Alloc: core.GenesisAlloc{
+			sender:  {Balance: big.NewInt(params.Ether)},
+			sender2: {Balance: big.NewInt(params.Ether)},
+		},
+	}
+	m := stages.MockWithGenesis(t, gspec, key)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 1, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	feeRecipient := common.Address{0xfe}
+	signer := types.LatestSignerForChainID(m.ChainConfig.ChainID)
+	gasPrice := uint256.NewInt(10 * params.GWei)
+	newTx := func(privKey *ecdsa.PrivateKey, nonce uint64, to common.Address, value uint64, price *uint256.Int) *txpool.AllReply_Tx {
+		txn, err := types.SignTx(types.NewTransaction(nonce, to, uint256.NewInt(value), params.TxGas, price, nil), *signer, privKey)
+		require.NoError(t, err)
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, txn.MarshalBinary(buf))
+		return &txpool.AllReply_Tx{Type: txpool.AllReply_PENDING, Sender: crypto.PubkeyToAddress(privKey.PublicKey).Bytes(), RlpTx: buf.Bytes()}
+	}
+	pool := staticTxPool{txs: []*txpool.AllReply_Tx{
+		newTx(key, 1, common.Address{2}, 1, gasPrice),                                           // after nonce 0 of sender
+		newTx(key, 0, feeRecipient, 1000, gasPrice),                                             // direct payment
+		newTx(key2, 0, common.Address{2}, 1, new(uint256.Int).Mul(gasPrice, uint256.NewInt(2))), // highest price
+		newTx(key2, 5, common.Address{2}, 1, gasPrice),                                          // nonce gap, queued
+	}}
+	pool.txs[3].Type = txpool.AllReply_QUEUED
+
+	base := NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false)
+	ctx := context.WithValue(context.Background(), "Authorization", "Bearer secret") //nolint:staticcheck
+	_, err = NewPayloadPreviewAPI(base, m.DB, pool, "").PreviewPayload(ctx, feeRecipient, nil)
+	require.EqualError(t, err, "payload preview is disabled, enable it by --rpc.authtoken")
+	api := NewPayloadPreviewAPI(base, m.DB, pool, "secret")
+	_, err = api.PreviewPayload(context.Background(), feeRecipient, nil)
+	require.Error(t, err)
+
+	timestamp := hexutil.Uint64(chain.TopBlock.Time() + 12)
+	preview, err := api.PreviewPayload(ctx, feeRecipient, &timestamp)
+	require.NoError(t, err)
+	require.Equal(t, chain.TopBlock.Hash(), preview.ParentHash)
+	require.Equal(t, hexutil.Uint64(2), preview.BlockNumber)
+	require.Equal(t, timestamp, preview.Timestamp)
+	require.Equal(t, hexutil.Uint64(3*params.TxGas), preview.GasUsed)
+	require.Empty(t, preview.Skipped)
+	require.Len(t, preview.Transactions, 3)
+	require.Equal(t, sender2, preview.Transactions[0].From)
+	require.Equal(t, sender, preview.Transactions[1].From)
+	require.Equal(t, sender, preview.Transactions[2].From)
+
+	baseFee := preview.BaseFeePerGas.ToInt()
+	tip := new(big.Int).Sub(gasPrice.ToBig(), baseFee)
+	tipValue := new(big.Int).Mul(tip, big.NewInt(int64(params.TxGas)))
+	require.Equal(t, tip, preview.Transactions[1].EffectiveGasTip.ToInt())
+	require.Equal(t, new(big.Int).Add(tipValue, big.NewInt(1000)), preview.Transactions[1].Value.ToInt())
+	require.Equal(t, tipValue, preview.Transactions[2].Value.ToInt())
+	value := new(big.Int)
+	for _, txn := range preview.Transactions {
+		value.Add(value, txn.Value.ToInt())
+	}
+	require.Equal(t, value, preview.Value.ToInt())
+
+	// preview doesn't change state
+	eth := NewEthAPI(base, m.DB, nil, nil, nil, 5000000)
+	balance, err := eth.GetBalance(context.Background(), feeRecipient, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+	require.NoError(t, err)
+	require.Zero(t, balance.ToInt().Sign())
+}
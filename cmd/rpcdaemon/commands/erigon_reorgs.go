@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"context"
+	"time"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/debug"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// reorgsPollInterval - how often "reorgs" subscription checks rawdb.ReorgLog
+const reorgsPollInterval = time.Second
+
+// ReorgBlock - block number and hash
+type ReorgBlock struct {
+	Number hexutil.Uint64 `json:"number"`
+	Hash   common.Hash    `json:"hash"`
+}
+
+// ReorgResult - reorg of canonical chain: blocks above commonAncestor up to oldHead were replaced by blocks up to newHead
+type ReorgResult struct {
+	ID             hexutil.Uint64 `json:"id"`
+	OldHead        ReorgBlock     `json:"oldHead"`
+	NewHead        ReorgBlock     `json:"newHead"`
+	CommonAncestor ReorgBlock     `json:"commonAncestor"`
+	Depth          hexutil.Uint64 `json:"depth"`
+	Timestamp      hexutil.Uint64 `json:"timestamp"`
+}
+
+func newReorgResult(r *rawdb.Reorg) *ReorgResult {
+	return &ReorgResult{
+		ID:             hexutil.Uint64(r.ID),
+		OldHead:        ReorgBlock{Number: hexutil.Uint64(r.OldHeadNumber), Hash: r.OldHeadHash},
+		NewHead:        ReorgBlock{Number: hexutil.Uint64(r.NewHeadNumber), Hash: r.NewHeadHash},
+		CommonAncestor: ReorgBlock{Number: hexutil.Uint64(r.AncestorNumber), Hash: r.AncestorHash},
+		Depth:          hexutil.Uint64(r.Depth()),
+		Timestamp:      hexutil.Uint64(r.Time),
+	}
+}
+
+// GetReorgs implements erigon_getReorgs. Returns reorgs observed by the node with id >= fromId (all kept reorgs if not
+// given), the last rawdb.MaxReorgLogEntries reorgs are kept. Ids grow by 1, so client can poll with last seen id + 1.
+func (api *ErigonImpl) GetReorgs(ctx context.Context, fromID *hexutil.Uint64) ([]*ReorgResult, error) {
+	var from uint64
+	if fromID != nil {
+		from = uint64(*fromID)
+	}
+	return api.readReorgs(ctx, from)
+}
+
+func (api *ErigonImpl) readReorgs(ctx context.Context, fromID uint64) ([]*ReorgResult, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	reorgs, err := rawdb.ReadReorgs(tx, fromID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*ReorgResult, 0, len(reorgs))
+	for _, r := range reorgs {
+		result = append(result, newReorgResult(r))
+	}
+	return result, nil
+}
+
+// Reorgs - erigon_subscribe("reorgs"), notifies about each reorg observed after subscription
+func (api *ErigonImpl) Reorgs(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	// reorgs which happened before subscription are not notified
+	known, err := api.readReorgs(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	var next uint64 = 1
+	if len(known) > 0 {
+		next = uint64(known[len(known)-1].ID) + 1
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		defer debug.LogPanic()
+		ticker := time.NewTicker(reorgsPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-rpcSub.Err():
+				return
+			}
+			reorgs, err := api.readReorgs(context.Background(), next)
+			if err != nil {
+				log.Warn("[rpc] reorgs subscription", "err", err)
+				continue
+			}
+			for _, r := range reorgs {
+				if err := notifier.Notify(rpcSub.ID, r); err != nil {
+					log.Warn("error while notifying subscription", "err", err)
+				}
+				next = uint64(r.ID) + 1
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
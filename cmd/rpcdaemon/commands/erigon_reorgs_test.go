@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetReorgs(t *testing.T) {
+	m := stages.Mock(t)
+	short, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 3, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	long, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 5, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{2})
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+
+	api := NewErigonAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil)
+	require.NoError(t, m.InsertChain(short))
+	reorgs, err := api.GetReorgs(context.Background(), nil)
+	require.NoError(t, err)
+	require.Empty(t, reorgs)
+
+	require.NoError(t, m.InsertChain(long))
+	reorgs, err = api.GetReorgs(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, reorgs, 1)
+	r := reorgs[0]
+	require.Equal(t, hexutil.Uint64(1), r.ID)
+	require.Equal(t, ReorgBlock{Number: 3, Hash: short.TopBlock.Hash()}, r.OldHead)
+	require.Equal(t, ReorgBlock{Number: 5, Hash: long.TopBlock.Hash()}, r.NewHead)
+	require.Equal(t, ReorgBlock{Number: 0, Hash: m.Genesis.Hash()}, r.CommonAncestor)
+	require.Equal(t, hexutil.Uint64(3), r.Depth)
+
+	fromNext := hexutil.Uint64(2)
+	reorgs, err = api.GetReorgs(context.Background(), &fromNext)
+	require.NoError(t, err)
+	require.Empty(t, reorgs)
+}
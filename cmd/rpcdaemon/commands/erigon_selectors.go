@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb/bitmapdb"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+const (
+	// maxSelectorCallBlocks - limit of blocks returned by one erigon_getBlocksBySelector call
+	maxSelectorCallBlocks = 10_000
+)
+
+// SelectorCallsResult - blocks of FromBlock..ToBlock which called the function of the contract
+type SelectorCallsResult struct {
+	FromBlock hexutil.Uint64   `json:"fromBlock"`
+	ToBlock   hexutil.Uint64   `json:"toBlock"` // lower than requested if call traces index is behind
+	Blocks    []hexutil.Uint64 `json:"blocks"`
+	NextBlock *hexutil.Uint64  `json:"nextBlock"` // result is truncated, fromBlock of the next page
+}
+
+// BlocksBySelector - at most maxResult blocks from fromBlock to toBlock in which the contract's function with given
+// selector was called (by transaction or internal call), found by rawdb.CallSelectorIndex
+func BlocksBySelector(tx kv.Tx, contract common.Address, selector [4]byte, fromBlock, toBlock uint64, maxResult int) (*SelectorCallsResult, error) {
+	indexed, err := stages.GetStageProgress(tx, stages.CallTraces)
+	if err != nil {
+		return nil, err
+	}
+	if toBlock > indexed {
+		toBlock = indexed
+	}
+	if fromBlock > toBlock {
+		return nil, fmt.Errorf("fromBlock %d is higher than toBlock %d (call traces are indexed up to %d)", fromBlock, toBlock, indexed)
+	}
+	pm, err := prune.Get(tx)
+	if err != nil {
+		return nil, err
+	}
+	if pm.CallTraces.Enabled() && fromBlock < pm.CallTraces.PruneTo(indexed) {
+		return nil, fmt.Errorf("call traces are pruned before block %d", pm.CallTraces.PruneTo(indexed))
+	}
+
+	key := make([]byte, 0, len(contract)+len(selector))
+	key = append(append(key, contract[:]...), selector[:]...)
+	blocks, err := bitmapdb.Get64(tx, rawdb.CallSelectorIndex, key, fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	// bitmap may include blocks of the chunks outside of the range
+	blocks.RemoveRange(0, fromBlock)
+	blocks.RemoveRange(toBlock+1, math.MaxUint64)
+
+	result := &SelectorCallsResult{FromBlock: hexutil.Uint64(fromBlock), ToBlock: hexutil.Uint64(toBlock), Blocks: []hexutil.Uint64{}}
+	for it := blocks.Iterator(); it.HasNext(); {
+		blockNum := it.Next()
+		if len(result.Blocks) == maxResult {
+			next := hexutil.Uint64(blockNum)
+			result.NextBlock = &next
+			break
+		}
+		result.Blocks = append(result.Blocks, hexutil.Uint64(blockNum))
+	}
+	return result, nil
+}
+
+// GetBlocksBySelector implements erigon_getBlocksBySelector. Returns blocks in which the function of the contract
+// (4-byte selector, first bytes of call data) was called, for method-level analytics without tracing every block.
+// For DELEGATECALL and CALLCODE the contract is the one whose code is executed.
+func (api *ErigonImpl) GetBlocksBySelector(ctx context.Context, contract common.Address, selector hexutil.Bytes, fromBlock, toBlock rpc.BlockNumber, maxResult int) (*SelectorCallsResult, error) {
+	if len(selector) != 4 {
+		return nil, fmt.Errorf("selector must be 4 bytes, got %d", len(selector))
+	}
+	if maxResult <= 0 || maxResult > maxSelectorCallBlocks {
+		maxResult = maxSelectorCallBlocks
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	from, err := getBlockNumber(fromBlock, tx)
+	if err != nil {
+		return nil, err
+	}
+	to, err := getBlockNumber(toBlock, tx)
+	if err != nil {
+		return nil, err
+	}
+	var sel [4]byte
+	copy(sel[:], selector)
+	return BlocksBySelector(tx, contract, sel, from, to, maxResult)
+}
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetBlocksBySelector(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	contract := common.Address{1}
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	m := stages.MockWithGenesis(t, gspec, key)
+	signer := types.LatestSignerForChainID(nil)
+
+	transfer, approve := common.FromHex("0xa9059cbb"), common.FromHex("0x095ea7b3")
+	calls := [][]byte{transfer, approve, append(common.CopyBytes(transfer), 1, 2, 3), nil, transfer}
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, len(calls), func(i int, b *core.BlockGen) {
+		if calls[i] == nil {
+			return
+		}
+		txn, err := types.SignTx(types.NewTransaction(b.TxNonce(sender), contract, uint256.NewInt(0), 50_000, uint256.NewInt(1), calls[i]), *signer, key)
+		require.NoError(t, err)
+		b.AddTx(txn)
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	api := NewErigonAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil)
+	ctx := context.Background()
+
+	res, err := api.GetBlocksBySelector(ctx, contract, transfer, rpc.EarliestBlockNumber, rpc.LatestBlockNumber, 0)
+	require.NoError(t, err)
+	require.Equal(t, hexutil.Uint64(5), res.ToBlock)
+	require.Equal(t, []hexutil.Uint64{1, 3, 5}, res.Blocks)
+	require.Nil(t, res.NextBlock)
+
+	res, err = api.GetBlocksBySelector(ctx, contract, approve, 0, 5, 0)
+	require.NoError(t, err)
+	require.Equal(t, []hexutil.Uint64{2}, res.Blocks)
+
+	// paging and range
+	res, err = api.GetBlocksBySelector(ctx, contract, transfer, 2, 5, 1)
+	require.NoError(t, err)
+	require.Equal(t, []hexutil.Uint64{3}, res.Blocks)
+	require.Equal(t, hexutil.Uint64(5), *res.NextBlock)
+
+	res, err = api.GetBlocksBySelector(ctx, common.Address{2}, transfer, 0, 5, 0)
+	require.NoError(t, err)
+	require.Empty(t, res.Blocks)
+
+	_, err = api.GetBlocksBySelector(ctx, contract, transfer[:3], 0, 5, 0)
+	require.Error(t, err)
+}
@@ -0,0 +1,194 @@
+package commands
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+)
+
+const (
+	defaultStateAccessBucketSize = 100_000 // ~2 weeks of mainnet blocks
+	maxStateAccessBuckets        = 10_000
+	defaultExpiryReportTop       = 20
+	maxExpiryReportTop           = 1000
+)
+
+var errStateAccessDisabled = errors.New("state access tracking is disabled, enable it by adding `stateaccess` to --experiments of erigon")
+
+// StateAccessBucket - amount of accounts and storage slots last accessed between FromAge and ToAge (exclusive) blocks ago
+type StateAccessBucket struct {
+	FromAge  hexutil.Uint64 `json:"fromAge"`
+	ToAge    hexutil.Uint64 `json:"toAge"`
+	Accounts hexutil.Uint64 `json:"accounts"`
+	Slots    hexutil.Uint64 `json:"slots"`
+}
+
+// StateAccessStats - distribution of accounts and storage slots by age of their last access
+type StateAccessStats struct {
+	Head     hexutil.Uint64      `json:"head"`
+	Accounts hexutil.Uint64      `json:"accounts"`
+	Slots    hexutil.Uint64      `json:"slots"`
+	Buckets  []StateAccessBucket `json:"buckets"`
+}
+
+// ExpiredContract - storage of the contract which would be expired
+type ExpiredContract struct {
+	Address      common.Address `json:"address"`
+	Slots        hexutil.Uint64 `json:"slots"`
+	ExpiredSlots hexutil.Uint64 `json:"expiredSlots"`
+}
+
+// StateExpiryReport - what would be expired if accounts and slots not accessed during Period blocks expire
+type StateExpiryReport struct {
+	Head            hexutil.Uint64    `json:"head"`
+	Period          hexutil.Uint64    `json:"period"`
+	Accounts        hexutil.Uint64    `json:"accounts"`
+	ExpiredAccounts hexutil.Uint64    `json:"expiredAccounts"`
+	Slots           hexutil.Uint64    `json:"slots"`
+	ExpiredSlots    hexutil.Uint64    `json:"expiredSlots"`
+	TopContracts    []ExpiredContract `json:"topContracts"`
+}
+
+// walkStateLastAccess - calls walker for every account (len(key) == 20) and storage slot (len(key) == 52) with age of its last access
+func walkStateLastAccess(ctx context.Context, tx kv.Tx, walker func(key []byte, age uint64)) (head uint64, err error) {
+	head, err = stages.GetStageProgress(tx, stages.StateAccess)
+	if err != nil {
+		return 0, err
+	}
+	if head == 0 {
+		return 0, errStateAccessDisabled
+	}
+	c, err := tx.Cursor(rawdb.StateLastAccess)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+	for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return 0, err
+		}
+		if err = ctx.Err(); err != nil {
+			return 0, err
+		}
+		if lastAccess := binary.BigEndian.Uint64(v); lastAccess < head {
+			walker(k, head-lastAccess)
+		} else {
+			walker(k, 0)
+		}
+	}
+	return head, nil
+}
+
+// StateAccessStats implements erigon_stateAccessStats. Returns histogram of accounts and storage slots by age of their last access,
+// bucketSize blocks per bucket, at most maxStateAccessBuckets buckets. Requires `stateaccess` experiment, walks over all
+// tracked state - slow on big chains.
+func (api *ErigonImpl) StateAccessStats(ctx context.Context, bucketSize *hexutil.Uint64) (*StateAccessStats, error) {
+	size := uint64(defaultStateAccessBucketSize)
+	if bucketSize != nil && *bucketSize > 0 {
+		size = uint64(*bucketSize)
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	head, err := stages.GetStageProgress(tx, stages.StateAccess)
+	if err != nil {
+		return nil, err
+	}
+	if head/size >= maxStateAccessBuckets { // age is at most head
+		return nil, fmt.Errorf("bucket size must be at least %d for %d blocks of tracked state", head/maxStateAccessBuckets+1, head)
+	}
+
+	stats := &StateAccessStats{}
+	head, err = walkStateLastAccess(ctx, tx, func(key []byte, age uint64) {
+		i := int(age / size)
+		for len(stats.Buckets) <= i {
+			from := uint64(len(stats.Buckets)) * size
+			stats.Buckets = append(stats.Buckets, StateAccessBucket{FromAge: hexutil.Uint64(from), ToAge: hexutil.Uint64(from + size)})
+		}
+		if len(key) == common.AddressLength {
+			stats.Accounts++
+			stats.Buckets[i].Accounts++
+		} else {
+			stats.Slots++
+			stats.Buckets[i].Slots++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.Head = hexutil.Uint64(head)
+	return stats, nil
+}
+
+// StateExpiryReport implements erigon_stateExpiryReport. Simulates expiry of accounts and storage slots which were not accessed
+// during last period blocks, returns totals and top contracts by amount of expired slots.
+// Requires `stateaccess` experiment, walks over all tracked state - slow on big chains.
+func (api *ErigonImpl) StateExpiryReport(ctx context.Context, period hexutil.Uint64, top *int) (*StateExpiryReport, error) {
+	if period == 0 {
+		return nil, errors.New("period must be positive")
+	}
+	limit := defaultExpiryReportTop
+	if top != nil {
+		limit = *top
+	}
+	if limit < 0 || limit > maxExpiryReportTop {
+		return nil, errors.New("top must be between 0 and 1000")
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	report := &StateExpiryReport{Period: period}
+	var contracts []ExpiredContract
+	var current ExpiredContract
+	flush := func() {
+		if current.ExpiredSlots > 0 {
+			contracts = append(contracts, current)
+		}
+	}
+	head, err := walkStateLastAccess(ctx, tx, func(key []byte, age uint64) {
+		expired := age >= uint64(period)
+		if len(key) == common.AddressLength {
+			report.Accounts++
+			if expired {
+				report.ExpiredAccounts++
+			}
+			return
+		}
+		report.Slots++
+		address := common.BytesToAddress(key[:common.AddressLength])
+		if address != current.Address {
+			flush()
+			current = ExpiredContract{Address: address}
+		}
+		current.Slots++
+		if expired {
+			report.ExpiredSlots++
+			current.ExpiredSlots++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	flush()
+
+	sort.SliceStable(contracts, func(i, j int) bool { return contracts[i].ExpiredSlots > contracts[j].ExpiredSlots })
+	if len(contracts) > limit {
+		contracts = contracts[:limit]
+	}
+	report.Head = hexutil.Uint64(head)
+	report.TopContracts = contracts
+	return report, nil
+}
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateExpiryReport(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	pm := prune.DefaultMode
+	pm.Experiments.StateAccess = true
+	m := stages.MockWithGenesisPruneMode(t, gspec, key, pm)
+	signer := types.LatestSignerForChainID(nil)
+
+	// block 1 creates contract with 2 storage slots, next blocks don't touch it
+	contract := crypto.CreateAddress(sender, 0)
+	initCode := common.FromHex("0x6001600055600160015500")
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 5, func(i int, b *core.BlockGen) {
+		var txn types.Transaction
+		var err error
+		if i == 0 {
+			txn, err = types.SignTx(types.NewContractCreation(b.TxNonce(sender), uint256.NewInt(0), 100_000, uint256.NewInt(1), initCode), *signer, key)
+		} else {
+			txn, err = types.SignTx(types.NewTransaction(b.TxNonce(sender), common.Address{2}, uint256.NewInt(1), params.TxGas, uint256.NewInt(1), nil), *signer, key)
+		}
+		require.NoError(t, err)
+		b.AddTx(txn)
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	api := NewErigonAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil)
+	ctx := context.Background()
+
+	bucketSize := hexutil.Uint64(2)
+	stats, err := api.StateAccessStats(ctx, &bucketSize)
+	require.NoError(t, err)
+	require.Equal(t, hexutil.Uint64(5), stats.Head)
+	require.Equal(t, hexutil.Uint64(2), stats.Slots)
+	require.Len(t, stats.Buckets, 3)
+	require.Equal(t, StateAccessBucket{FromAge: 4, ToAge: 6, Accounts: 1, Slots: 2}, stats.Buckets[2])
+
+	report, err := api.StateExpiryReport(ctx, 3, nil)
+	require.NoError(t, err)
+	require.Equal(t, stats.Accounts, report.Accounts)
+	require.Equal(t, hexutil.Uint64(1), report.ExpiredAccounts)
+	require.Equal(t, hexutil.Uint64(2), report.ExpiredSlots)
+	require.Equal(t, []ExpiredContract{{Address: contract, Slots: 2, ExpiredSlots: 2}}, report.TopContracts)
+
+	report, err = api.StateExpiryReport(ctx, 5, nil)
+	require.NoError(t, err)
+	require.Equal(t, hexutil.Uint64(0), report.ExpiredSlots)
+	require.Empty(t, report.TopContracts)
+
+	// tracking is disabled
+	_, err = NewErigonAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), stages.Mock(t).DB, nil).StateAccessStats(ctx, nil)
+	require.ErrorIs(t, err, errStateAccessDisabled)
+}
@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/adapter"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+	"github.com/ledgerwatch/erigon/turbo/trie"
+)
+
+const (
+	// maxStorageRangeWithProofs - limit of slots returned by one erigon_getStorageRangeWithProofs call
+	maxStorageRangeWithProofs = 4096
+	// maxStorageTrieSize - storage trie is built in memory from all slots of the contract
+	maxStorageTrieSize = 1_000_000
+)
+
+// StorageRangeWithProofsResult is the result of erigon_getStorageRangeWithProofs. Storage is sorted by hashed key,
+// Proof contains nodes of the paths to the start key and to the last returned key - enough to check that there are
+// no other slots between them (same as range proofs of snap protocol).
+type StorageRangeWithProofsResult struct {
+	StorageHash common.Hash         `json:"storageHash"`
+	Storage     []StorageProofEntry `json:"storage"`
+	Proof       []hexutil.Bytes     `json:"proof"`
+	NextKey     *common.Hash        `json:"nextKey"` // hashed key of the next slot, nil if Storage includes the last slot
+}
+
+// StorageProofEntry - one storage slot, HashedKey is keccak256 of Key and is the key in the storage trie
+type StorageProofEntry struct {
+	Key       common.Hash `json:"key"`
+	HashedKey common.Hash `json:"hashedKey"`
+	Value     common.Hash `json:"value"`
+}
+
+type storageSlot struct {
+	key, hashedKey common.Hash
+	value          []byte
+}
+
+// StorageRangeWithProofs - reads all storage of the contract as of blockNr, builds its trie and returns range of
+// at most maxResult slots starting from hashed key start, with proofs of both boundaries.
+func StorageRangeWithProofs(tx kv.Tx, history state.HistorySnapshots, blockNr uint64, address common.Address, start common.Hash, maxResult int) (*StorageRangeWithProofsResult, error) {
+	acc, err := adapter.NewStateReader(tx, blockNr, history).ReadAccountData(address)
+	if err != nil {
+		return nil, err
+	}
+	result := &StorageRangeWithProofsResult{StorageHash: trie.EmptyRoot, Storage: []StorageProofEntry{}}
+	if acc == nil || acc.Incarnation == 0 {
+		return result, nil
+	}
+
+	var slots []storageSlot
+	if err = state.WalkAsOfStorage(tx, address, acc.Incarnation, common.Hash{}, blockNr+1, func(kAddr, kLoc, vs []byte) (bool, error) {
+		if !bytes.Equal(kAddr, address[:]) {
+			return false, nil
+		}
+		if len(vs) == 0 { // deleted
+			return true, nil
+		}
+		if len(slots) >= maxStorageTrieSize {
+			return false, fmt.Errorf("storage of %x has more than %d slots", address, maxStorageTrieSize)
+		}
+		hashedKey, err := common.HashData(kLoc)
+		if err != nil {
+			return false, err
+		}
+		slots = append(slots, storageSlot{key: common.BytesToHash(kLoc), hashedKey: hashedKey, value: common.CopyBytes(vs)})
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(slots, func(i, j int) bool { return bytes.Compare(slots[i].hashedKey[:], slots[j].hashedKey[:]) < 0 })
+
+	t := trie.New(common.Hash{})
+	for _, slot := range slots {
+		t.Update(slot.hashedKey[:], slot.value)
+	}
+	result.StorageHash = t.Hash()
+
+	from := sort.Search(len(slots), func(i int) bool { return bytes.Compare(slots[i].hashedKey[:], start[:]) >= 0 })
+	to := from + maxResult
+	if to > len(slots) {
+		to = len(slots)
+	}
+	for _, slot := range slots[from:to] {
+		result.Storage = append(result.Storage, StorageProofEntry{Key: slot.key, HashedKey: slot.hashedKey, Value: common.BytesToHash(slot.value)})
+	}
+	if to < len(slots) {
+		next := slots[to].hashedKey
+		result.NextKey = &next
+	}
+
+	if len(slots) == 0 { // proof of empty trie is empty
+		return result, nil
+	}
+	seen := map[string]struct{}{}
+	boundaries := [][]byte{start[:]}
+	if len(result.Storage) > 0 {
+		boundaries = append(boundaries, result.Storage[len(result.Storage)-1].HashedKey[:])
+	}
+	for _, key := range boundaries {
+		proof, err := t.Prove(key, 0, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range proof {
+			if _, ok := seen[string(node)]; ok {
+				continue
+			}
+			seen[string(node)] = struct{}{}
+			result.Proof = append(result.Proof, node)
+		}
+	}
+	return result, nil
+}
+
+// GetStorageRangeWithProofs implements erigon_getStorageRangeWithProofs. Returns contiguous (by hashed key) range of storage
+// of the contract at the given block, with proof of the range against storage root.
+func (api *ErigonImpl) GetStorageRangeWithProofs(ctx context.Context, address common.Address, start common.Hash, maxResult int, blockNrOrHash rpc.BlockNumberOrHash) (*StorageRangeWithProofsResult, error) {
+	if maxResult <= 0 || maxResult > maxStorageRangeWithProofs {
+		maxResult = maxStorageRangeWithProofs
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	blockNumber, _, err := rpchelper.GetBlockNumber(blockNrOrHash, tx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	return StorageRangeWithProofs(tx, api.historySnapshots, blockNumber, address, start, maxResult)
+}
@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetStorageRangeWithProofs(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	m := stages.MockWithGenesis(t, gspec, key)
+	signer := types.LatestSignerForChainID(nil)
+
+	// block 1 creates contract with slots 0..3 = 1..4, block 2 calls it: slot 1 = 0, slot 2 = 9
+	contract := crypto.CreateAddress(sender, 0)
+	initCode := common.FromHex("0x6001600055600260015560036002556004600355600b6020600039600b6000f3" + "6000600155600960025500")
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 2, func(i int, b *core.BlockGen) {
+		var txn types.Transaction
+		var err error
+		if i == 0 {
+			txn, err = types.SignTx(types.NewContractCreation(b.TxNonce(sender), uint256.NewInt(0), 200_000, uint256.NewInt(1), initCode), *signer, key)
+		} else {
+			txn, err = types.SignTx(types.NewTransaction(b.TxNonce(sender), contract, uint256.NewInt(0), 100_000, uint256.NewInt(1), nil), *signer, key)
+		}
+		require.NoError(t, err)
+		b.AddTx(txn)
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	api := NewErigonAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil)
+	ctx := context.Background()
+	block1 := rpc.BlockNumberOrHashWithNumber(1)
+
+	full, err := api.GetStorageRangeWithProofs(ctx, contract, common.Hash{}, 0, block1)
+	require.NoError(t, err)
+	require.Len(t, full.Storage, 4)
+	require.Nil(t, full.NextKey)
+	values := map[common.Hash]common.Hash{}
+	for i, entry := range full.Storage {
+		require.Equal(t, crypto.Keccak256Hash(entry.Key[:]), entry.HashedKey)
+		if i > 0 {
+			require.True(t, full.Storage[i-1].HashedKey.Big().Cmp(entry.HashedKey.Big()) < 0)
+		}
+		values[entry.Key] = entry.Value
+	}
+	require.Equal(t, common.BigToHash(big.NewInt(2)), values[common.BigToHash(big.NewInt(1))])
+
+	// storage root is same as in state dump, root node of proof is the root
+	tx, err := m.DB.BeginRo(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	dump := state.NewDumper(tx, 2).RawDump(true, false)
+	require.Equal(t, common.BytesToHash(dump.Accounts[contract].Root), full.StorageHash)
+	require.NotEmpty(t, full.Proof)
+	require.Equal(t, full.StorageHash, crypto.Keccak256Hash(full.Proof[0]))
+
+	// paging
+	first, err := api.GetStorageRangeWithProofs(ctx, contract, common.Hash{}, 3, block1)
+	require.NoError(t, err)
+	require.Len(t, first.Storage, 3)
+	require.NotNil(t, first.NextKey)
+	require.Equal(t, full.Storage[3].HashedKey, *first.NextKey)
+	rest, err := api.GetStorageRangeWithProofs(ctx, contract, *first.NextKey, 3, block1)
+	require.NoError(t, err)
+	require.Equal(t, full.Storage[3:], rest.Storage)
+	require.Nil(t, rest.NextKey)
+	require.Equal(t, full.StorageHash, rest.StorageHash)
+
+	// block 2 deleted slot 1 and changed slot 2
+	latest, err := api.GetStorageRangeWithProofs(ctx, contract, common.Hash{}, 0, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+	require.NoError(t, err)
+	require.Len(t, latest.Storage, 3)
+	require.NotEqual(t, full.StorageHash, latest.StorageHash)
+	for _, entry := range latest.Storage {
+		require.NotEqual(t, common.BigToHash(big.NewInt(1)), entry.Key)
+		if entry.Key == common.BigToHash(big.NewInt(2)) {
+			require.Equal(t, common.BigToHash(big.NewInt(9)), entry.Value)
+		}
+	}
+
+	empty, err := api.GetStorageRangeWithProofs(ctx, common.Address{2}, common.Hash{}, 0, block1)
+	require.NoError(t, err)
+	require.Empty(t, empty.Storage)
+	require.Empty(t, empty.Proof)
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 
 	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
 	"github.com/ledgerwatch/erigon/core/forkid"
+	"github.com/ledgerwatch/erigon/core/rawdb"
 )
 
 // Forks is a data type to record a list of forks passed by this node
@@ -29,3 +31,36 @@ func (api *ErigonImpl) Forks(ctx context.Context) (Forks, error) {
 
 	return Forks{genesis.Hash(), forksBlocks}, nil
 }
+
+// Forkchoice is a data type to record the latest fork choice state received from the consensus layer
+type Forkchoice struct {
+	HeadBlockHash      common.Hash    `json:"headBlockHash"`
+	SafeBlockHash      common.Hash    `json:"safeBlockHash"`
+	FinalizedBlockHash common.Hash    `json:"finalizedBlockHash"`
+	UpdatedAt          hexutil.Uint64 `json:"updatedAt"`
+}
+
+// Forkchoice implements erigon_forkchoice. Returns the latest fork choice state delivered via engine_forkchoiceUpdated and the unix time of its update
+func (api *ErigonImpl) Forkchoice(ctx context.Context) (*Forkchoice, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	updatedAt := rawdb.ReadForkchoiceUpdatedAt(tx)
+	if updatedAt == 0 {
+		return nil, nil // not error, see https://github.com/ledgerwatch/erigon/issues/1645
+	}
+	return &Forkchoice{
+		HeadBlockHash:      rawdb.ReadForkchoiceHead(tx),
+		SafeBlockHash:      rawdb.ReadForkchoiceSafe(tx),
+		FinalizedBlockHash: rawdb.ReadForkchoiceFinalized(tx),
+		UpdatedAt:          hexutil.Uint64(updatedAt),
+	}, nil
+}
+
+// GasCaps implements erigon_gasCaps. Returns caps of gas which apply to calls of this request (eth_call, eth_estimateGas, trace_call...)
+func (api *ErigonImpl) GasCaps(ctx context.Context) (*GasCaps, error) {
+	return api.gasCapsOf(ctx), nil
+}
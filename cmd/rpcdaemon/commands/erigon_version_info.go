@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/params"
+)
+
+// VersionInfo - what node and rpcdaemon are running, in machine-readable form
+type VersionInfo struct {
+	Node            string           `json:"node"`      // web3_clientVersion of the node, empty without connection to it
+	RPCDaemon       params.BuildInfo `json:"rpcdaemon"` // build of this rpcdaemon
+	Chain           string           `json:"chain"`
+	GenesisHash     common.Hash      `json:"genesisHash"`
+	ChainConfigHash common.Hash      `json:"chainConfigHash"`
+	Experiments     []string         `json:"experiments"` // enabled by --experiments flags of the node
+}
+
+// VersionInfo implements erigon_versionInfo. Returns build metadata, chain config hash and experimental features
+// enabled in the database - same values as "Version info" line which the node prints at startup.
+func (api *ErigonImpl) VersionInfo(ctx context.Context) (*VersionInfo, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	chainConfig, genesis, err := api.chainConfigWithGenesis(tx)
+	if err != nil {
+		return nil, err
+	}
+	configHash, err := params.ChainConfigHash(chainConfig)
+	if err != nil {
+		return nil, err
+	}
+	pm, err := prune.Get(tx)
+	if err != nil {
+		return nil, err
+	}
+	info := &VersionInfo{
+		RPCDaemon:       params.GetBuildInfo(),
+		Chain:           chainConfig.ChainName,
+		GenesisHash:     genesis.Hash(),
+		ChainConfigHash: configHash,
+		Experiments:     pm.Experiments.Names(),
+	}
+	if api.ethBackend != nil {
+		if info.Node, err = api.ethBackend.ClientVersion(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
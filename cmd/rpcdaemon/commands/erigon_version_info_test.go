@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionInfo(t *testing.T) {
+	m := stages.Mock(t)
+	pm := prune.DefaultMode
+	pm.Experiments.StateDiffs = true
+	pm.Experiments.Appearances = true
+	tx, err := m.DB.BeginRw(m.Ctx)
+	require.NoError(t, err)
+	require.NoError(t, prune.Override(tx, pm))
+	require.NoError(t, tx.Commit())
+
+	api := NewErigonAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil)
+	info, err := api.VersionInfo(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, params.GetBuildInfo(), info.RPCDaemon)
+	require.Empty(t, info.Node)
+	require.Equal(t, m.Genesis.Hash(), info.GenesisHash)
+	require.Equal(t, []string{"statediffs", "appearances"}, info.Experiments)
+
+	configHash, err := params.ChainConfigHash(m.ChainConfig)
+	require.NoError(t, err)
+	require.Equal(t, configHash, info.ChainConfigHash)
+	other := *m.ChainConfig
+	other.ByzantiumBlock = big.NewInt(100)
+	otherHash, err := params.ChainConfigHash(&other)
+	require.NoError(t, err)
+	require.NotEqual(t, configHash, otherHash)
+}
@@ -0,0 +1,212 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/consensus"
+	"github.com/ledgerwatch/erigon/consensus/aura"
+	"github.com/ledgerwatch/erigon/consensus/aura/consensusconfig"
+	"github.com/ledgerwatch/erigon/consensus/bor"
+	"github.com/ledgerwatch/erigon/consensus/clique"
+	"github.com/ledgerwatch/erigon/consensus/ethash"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
+	"github.com/ledgerwatch/erigon/ethdb"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/reexec"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+	"github.com/ledgerwatch/erigon/turbo/trie"
+)
+
+// BlockWitness is the result of erigon_getBlockWitness - everything needed to execute the block without state database:
+// accounts and storage slots accessed by the block with their values before the block, code of accessed contracts and
+// nodes of the state trie which prove accounts and slots (also absent ones) against state root of the parent block.
+type BlockWitness struct {
+	BlockNumber     hexutil.Uint64    `json:"blockNumber"`
+	BlockHash       common.Hash       `json:"blockHash"`
+	ParentStateRoot common.Hash       `json:"parentStateRoot"`
+	Accounts        []*WitnessAccount `json:"accounts"`
+	Codes           []hexutil.Bytes   `json:"codes"`
+	State           []hexutil.Bytes   `json:"state"` // RLP of trie nodes of all proofs, without duplicates
+}
+
+// WitnessAccount - account accessed by the block, as of the state before the block
+type WitnessAccount struct {
+	Address     common.Address `json:"address"`
+	Exists      bool           `json:"exists"`
+	Nonce       hexutil.Uint64 `json:"nonce"`
+	Balance     *hexutil.Big   `json:"balance"`
+	CodeHash    common.Hash    `json:"codeHash"`
+	StorageHash common.Hash    `json:"storageHash"`
+	Storage     []WitnessSlot  `json:"storage"`
+}
+
+// WitnessSlot - storage slot accessed by the block, zero value means the slot is absent
+type WitnessSlot struct {
+	Key   common.Hash `json:"key"`
+	Value common.Hash `json:"value"`
+}
+
+// GetBlockWitness implements erigon_getBlockWitness. Re-executes the block on the state of its parent recording accessed
+// state, then proves it. Available for the blocks which parent is at most maxGetProofRewindBlockCount blocks older than
+// the latest block with calculated state root.
+func (api *ErigonImpl) GetBlockWitness(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*BlockWitness, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	blockNr, hash, err := rpchelper.GetBlockNumber(blockNrOrHash, tx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	if blockNr == 0 {
+		return nil, fmt.Errorf("genesis block has no witness")
+	}
+	block, err := api.blockWithSenders(tx, hash, blockNr)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %d not found", blockNr)
+	}
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
+	if api.TevmEnabled {
+		contractHasTEVM = ethdb.GetHasTEVM(tx)
+	}
+	engine, err := api.consensusEngine(chainConfig)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := recordBlockWitness(tx, api.historySnapshots, chainConfig, engine, block, contractHasTEVM)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[common.Address][]common.Hash{}
+	for _, address := range rec.Accounts() {
+		keys[address] = rec.Storage(address)
+	}
+	proven, err := proveState(ctx, tx, "erigon_getBlockWitness", blockNr-1, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	witness := &BlockWitness{
+		BlockNumber:     hexutil.Uint64(blockNr),
+		BlockHash:       block.Hash(),
+		ParentStateRoot: proven.root,
+		Accounts:        make([]*WitnessAccount, 0, len(keys)),
+		Codes:           make([]hexutil.Bytes, 0),
+		State:           make([]hexutil.Bytes, 0),
+	}
+	for _, code := range rec.Codes() {
+		witness.Codes = append(witness.Codes, code)
+	}
+	seen := map[string]struct{}{}
+	addProof := func(proof [][]byte) {
+		for _, node := range proof {
+			if _, ok := seen[string(node)]; ok {
+				continue
+			}
+			seen[string(node)] = struct{}{}
+			witness.State = append(witness.State, node)
+		}
+	}
+	for _, address := range rec.Accounts() {
+		account := &WitnessAccount{
+			Address:     address,
+			Balance:     (*hexutil.Big)(new(big.Int)),
+			CodeHash:    trie.EmptyCodeHash,
+			StorageHash: proven.storageRoot(address),
+			Storage:     make([]WitnessSlot, 0, len(keys[address])),
+		}
+		if acc := proven.accounts[address]; acc != nil {
+			account.Exists = true
+			account.Nonce = hexutil.Uint64(acc.Nonce)
+			account.Balance = (*hexutil.Big)(acc.Balance.ToBig())
+			account.CodeHash = acc.CodeHash
+		}
+		proof, err := proven.accountProof(address)
+		if err != nil {
+			return nil, err
+		}
+		addProof(proof)
+		for _, key := range keys[address] {
+			account.Storage = append(account.Storage, WitnessSlot{Key: key, Value: common.BytesToHash(proven.storage[address][key])})
+			if account.StorageHash == trie.EmptyRoot {
+				continue // absence of the slot is proven by the account
+			}
+			if proof, err = proven.storageProof(address, key); err != nil {
+				return nil, err
+			}
+			addProof(proof)
+		}
+		witness.Accounts = append(witness.Accounts, account)
+	}
+	return witness, nil
+}
+
+// recordBlockWitness - executes the block on the state of its parent, returns state accessed by the block. The block is
+// finalized by engine: state accessed by system calls and rewards is recorded too.
+func recordBlockWitness(tx kv.Tx, history state.HistorySnapshots, chainConfig *params.ChainConfig, engine consensus.Engine, block *types.Block, contractHasTEVM func(common.Hash) (bool, error)) (*state.WitnessRecorder, error) {
+	rec := state.NewWitnessRecorder()
+	reader := rec.Reader(state.NewPlainState(tx, block.NumberU64()-1, history))
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		return rawdb.ReadHeader(tx, hash, number)
+	}
+	chain := stagedsync.ChainReader{Cfg: *chainConfig, Db: tx}
+	if _, err := core.ExecuteBlockEphemerally(chainConfig, &vm.Config{}, getHeader, engine, block, reader, state.NewNoopWriter(), reexec.NewEpochReader(tx), chain, contractHasTEVM); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// consensusEngine - engine of the chain, for re-execution of blocks. Clique and Bor engines read snapshots from
+// their databases, AuRa keeps nothing in own database.
+func (api *ErigonImpl) consensusEngine(chainConfig *params.ChainConfig) (consensus.Engine, error) {
+	api.engineLock.Lock()
+	defer api.engineLock.Unlock()
+	if api.engine != nil {
+		return api.engine, nil
+	}
+	switch {
+	case chainConfig.Clique != nil:
+		if api.cliqueDB == nil {
+			return nil, fmt.Errorf("clique database is not available, rpcdaemon must run with --datadir of Erigon following Clique chain")
+		}
+		api.engine = clique.New(chainConfig, params.CliqueSnapshot, api.cliqueDB)
+	case chainConfig.Bor != nil:
+		if api.borDB == nil {
+			return nil, fmt.Errorf("bor database is not available, rpcdaemon must run with --datadir of Erigon following Bor chain")
+		}
+		api.engine = bor.NewReadonly(chainConfig, api.borDB)
+	case chainConfig.Aura != nil:
+		engine, err := aura.NewAuRa(chainConfig.Aura, memdb.New(), chainConfig.Aura.Etherbase, consensusconfig.GetConfigByChain(chainConfig.ChainName))
+		if err != nil {
+			return nil, err
+		}
+		api.engine = engine
+	case chainConfig.Consensus == "" || chainConfig.Consensus == params.EtHashConsensus:
+		api.engine = ethash.NewFaker() // rewards are same, PoW is not verified
+	default:
+		return nil, fmt.Errorf("re-execution of blocks is not supported for %s consensus", chainConfig.Consensus)
+	}
+	return api.engine, nil
+}
@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetBlockWitness(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	m := stages.MockWithGenesis(t, gspec, key)
+	signer := types.LatestSignerForChainID(nil)
+
+	// block 1 creates contract with slots 0..3 = 1..4, block 2 calls it: slot 1 = 0, slot 2 = 9
+	contract := crypto.CreateAddress(sender, 0)
+	runtimeCode := common.FromHex("0x6000600155600960025500")
+	initCode := common.FromHex("0x6001600055600260015560036002556004600355600b6020600039600b6000f3" + "6000600155600960025500")
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 2, func(i int, b *core.BlockGen) {
+		var txn types.Transaction
+		var err error
+		if i == 0 {
+			txn, err = types.SignTx(types.NewContractCreation(b.TxNonce(sender), uint256.NewInt(0), 200_000, uint256.NewInt(1), initCode), *signer, key)
+		} else {
+			txn, err = types.SignTx(types.NewTransaction(b.TxNonce(sender), contract, uint256.NewInt(0), 100_000, uint256.NewInt(1), nil), *signer, key)
+		}
+		require.NoError(t, err)
+		b.AddTx(txn)
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	base := NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false)
+	api := NewErigonAPI(base, m.DB, nil)
+	ethApi := NewEthAPI(base, m.DB, nil, nil, nil, 5000000)
+	ctx := context.Background()
+
+	witness, err := api.GetBlockWitness(ctx, rpc.BlockNumberOrHashWithNumber(2))
+	require.NoError(t, err)
+	require.Equal(t, chain.Headers[0].Root, witness.ParentStateRoot)
+	require.Equal(t, chain.Headers[1].Hash(), witness.BlockHash)
+	require.Equal(t, 1, len(witness.Codes))
+	require.Equal(t, runtimeCode, []byte(witness.Codes[0]))
+
+	state := map[string]struct{}{}
+	for _, node := range witness.State {
+		state[string(node)] = struct{}{}
+	}
+	requireInState := func(proof []string) {
+		for _, node := range proof {
+			_, ok := state[string(common.FromHex(node))]
+			require.True(t, ok)
+		}
+	}
+	accessed := map[common.Address]*WitnessAccount{}
+	for _, account := range witness.Accounts {
+		accessed[account.Address] = account
+		slots := make([]string, len(account.Storage))
+		for i, slot := range account.Storage {
+			slots[i] = slot.Key.Hex()
+		}
+		// witness proves the same as eth_getProof of the parent block
+		proof, err := ethApi.GetProof(ctx, account.Address, slots, rpc.BlockNumberOrHashWithNumber(1))
+		require.NoError(t, err)
+		require.Equal(t, proof.Balance.ToInt(), account.Balance.ToInt())
+		require.Equal(t, proof.StorageHash, account.StorageHash)
+		requireInState(proof.AccountProof)
+		for i, slot := range account.Storage {
+			require.Equal(t, proof.StorageProof[i].Value.ToInt(), slot.Value.Big())
+			requireInState(proof.StorageProof[i].Proof)
+		}
+	}
+	require.True(t, accessed[sender].Exists)
+	require.Equal(t, []WitnessSlot{
+		{Key: common.HexToHash("0x1"), Value: common.HexToHash("0x2")},
+		{Key: common.HexToHash("0x2"), Value: common.HexToHash("0x3")},
+	}, accessed[contract].Storage)
+	require.Contains(t, accessed, chain.Headers[1].Coinbase)
+
+	_, err = api.GetBlockWitness(ctx, rpc.BlockNumberOrHashWithNumber(0))
+	require.Error(t, err)
+}
+
+func TestWitnessConsensusEngine(t *testing.T) {
+	base := NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false)
+	engine, err := NewErigonAPI(base, nil, nil).consensusEngine(params.TestChainConfig)
+	require.NoError(t, err)
+	require.NotNil(t, engine)
+
+	// engines which read own databases
+	_, err = NewErigonAPI(base, nil, nil).consensusEngine(params.RinkebyChainConfig)
+	require.Error(t, err)
+	_, err = NewErigonAPI(base, nil, nil).consensusEngine(params.BSCMainnetChainConfig)
+	require.Error(t, err)
+
+	engine, err = NewErigonAPI(base, nil, nil).consensusEngine(params.SokolChainConfig)
+	require.NoError(t, err)
+	require.NotNil(t, engine)
+}
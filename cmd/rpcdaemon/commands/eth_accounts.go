@@ -28,7 +28,7 @@ func (api *APIImpl) GetBalance(ctx context.Context, address common.Address, bloc
 		return nil, err
 	}
 
-	acc, err := rpchelper.GetAccount(tx, blockNumber, address)
+	acc, err := rpchelper.GetAccount(tx, blockNumber, api.historySnapshots, address)
 	if err != nil {
 		return nil, fmt.Errorf("cant get a balance for account %q for block %v", address.String(), blockNumber)
 	}
@@ -64,7 +64,7 @@ func (api *APIImpl) GetTransactionCount(ctx context.Context, address common.Addr
 		return nil, err
 	}
 	nonce := hexutil.Uint64(0)
-	reader := adapter.NewStateReader(tx, blockNumber)
+	reader := adapter.NewStateReader(tx, blockNumber, api.historySnapshots)
 	acc, err := reader.ReadAccountData(address)
 	if acc == nil || err != nil {
 		return &nonce, err
@@ -84,7 +84,7 @@ func (api *APIImpl) GetCode(ctx context.Context, address common.Address, blockNr
 		return nil, err
 	}
 
-	reader := adapter.NewStateReader(tx, blockNumber)
+	reader := adapter.NewStateReader(tx, blockNumber, api.historySnapshots)
 	acc, err := reader.ReadAccountData(address)
 	if acc == nil || err != nil {
 		return hexutil.Bytes(""), nil
@@ -110,7 +110,7 @@ func (api *APIImpl) GetStorageAt(ctx context.Context, address common.Address, in
 	if err != nil {
 		return hexutil.Encode(common.LeftPadBytes(empty, 32)), err
 	}
-	reader := adapter.NewStateReader(tx, blockNumber)
+	reader := adapter.NewStateReader(tx, blockNumber, api.historySnapshots)
 	acc, err := reader.ReadAccountData(address)
 	if acc == nil || err != nil {
 		return hexutil.Encode(common.LeftPadBytes(empty, 32)), err
@@ -19,8 +19,11 @@ import (
 	"github.com/ledgerwatch/erigon/common/math"
 	"github.com/ledgerwatch/erigon/consensus/misc"
 	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
 	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
 	ethFilters "github.com/ledgerwatch/erigon/eth/filters"
+	"github.com/ledgerwatch/erigon/eth/gasprice"
 	"github.com/ledgerwatch/erigon/internal/ethapi"
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rpc"
@@ -55,10 +58,10 @@ type EthAPI interface {
 
 	// Filter related (see ./eth_filters.go)
 	NewPendingTransactionFilter(_ context.Context) (hexutil.Uint64, error)
-	NewBlockFilter(_ context.Context) (hexutil.Uint64, error)
-	NewFilter(_ context.Context, filter interface{}) (hexutil.Uint64, error)
+	NewBlockFilter(ctx context.Context) (hexutil.Uint64, error)
+	NewFilter(ctx context.Context, crit ethFilters.FilterCriteria) (hexutil.Uint64, error)
 	UninstallFilter(_ context.Context, index hexutil.Uint64) (bool, error)
-	GetFilterChanges(_ context.Context, index hexutil.Uint64) ([]interface{}, error)
+	GetFilterChanges(ctx context.Context, index hexutil.Uint64) ([]interface{}, error)
 
 	// Account related (see ./eth_accounts.go)
 	Accounts(ctx context.Context) ([]common.Address, error)
@@ -76,12 +79,12 @@ type EthAPI interface {
 
 	// Sending related (see ./eth_call.go)
 	Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *map[common.Address]ethapi.Account) (hexutil.Bytes, error)
-	EstimateGas(ctx context.Context, args ethapi.CallArgs, blockNrOrHash *rpc.BlockNumberOrHash) (hexutil.Uint64, error)
+	EstimateGas(ctx context.Context, args ethapi.CallArgs, blockNrOrHash *rpc.BlockNumberOrHash, overrides *map[common.Address]ethapi.Account, blockOverrides *ethapi.BlockOverrides) (hexutil.Uint64, error)
 	SendRawTransaction(ctx context.Context, encodedTx hexutil.Bytes) (common.Hash, error)
 	SendTransaction(_ context.Context, txObject interface{}) (common.Hash, error)
 	Sign(ctx context.Context, _ common.Address, _ hexutil.Bytes) (hexutil.Bytes, error)
 	SignTransaction(_ context.Context, txObject interface{}) (common.Hash, error)
-	GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNr rpc.BlockNumber) (*interface{}, error)
+	GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNrOrHash rpc.BlockNumberOrHash) (*ethapi.AccountResult, error)
 	CreateAccessList(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash) (*accessListResult, error)
 
 	// Mining related (see ./eth_mining.go)
@@ -103,12 +106,17 @@ type BaseAPI struct {
 	stateCache   kvcache.Cache // thread-safe
 	blocksLRU    *lru.Cache    // thread-safe
 	filters      *filters.Filters
+	pollFilters  *filters.PollFilters
 	_chainConfig *params.ChainConfig
 	_genesis     *types.Block
 	_genesisLock sync.RWMutex
 
-	_blockReader interfaces.BlockReader
-	TevmEnabled  bool // experiment
+	_blockReader     interfaces.BlockReader
+	historySnapshots state.HistorySnapshots
+	TevmEnabled      bool // experiment
+	gasCaps          gasCapsConfig
+	gpo              gasprice.Config
+	gpoCache         *gasprice.Cache
 }
 
 func NewBaseApi(f *filters.Filters, stateCache kvcache.Cache, blockReader interfaces.BlockReader, singleNodeMode bool) *BaseAPI {
@@ -121,7 +129,8 @@ func NewBaseApi(f *filters.Filters, stateCache kvcache.Cache, blockReader interf
 		panic(err)
 	}
 
-	return &BaseAPI{filters: f, stateCache: stateCache, blocksLRU: blocksLRU, _blockReader: blockReader}
+	return &BaseAPI{filters: f, stateCache: stateCache, blocksLRU: blocksLRU, _blockReader: blockReader,
+		gpo: ethconfig.Defaults.GPO, gpoCache: gasprice.NewCache()}
 }
 
 func (api *BaseAPI) chainConfig(tx kv.Tx) (*params.ChainConfig, error) {
@@ -131,6 +140,14 @@ func (api *BaseAPI) chainConfig(tx kv.Tx) (*params.ChainConfig, error) {
 
 func (api *BaseAPI) EnableTevmExperiment() { api.TevmEnabled = true }
 
+// SetHistorySnapshots - files with history of state, read before database for blocks they cover
+func (api *BaseAPI) SetHistorySnapshots(history state.HistorySnapshots) {
+	api.historySnapshots = history
+}
+
+// SetPollFilters - storage of filters of eth_newFilter/eth_newBlockFilter, these methods fail without it
+func (api *BaseAPI) SetPollFilters(pf *filters.PollFilters) { api.pollFilters = pf }
+
 // nolint:unused
 func (api *BaseAPI) genesis(tx kv.Tx) (*types.Block, error) {
 	_, genesis, err := api.chainConfigWithGenesis(tx)
@@ -180,6 +197,54 @@ func (api *BaseAPI) blockWithSenders(tx kv.Tx, hash common.Hash, number uint64)
 	return block, nil
 }
 
+// txnLookup - canonical transaction with given hash, its block and index in the block. Lookup collisions and blocks
+// are resolved by block reader, so transactions of blocks in snapshots are found too. nil if transaction is not found.
+func (api *BaseAPI) txnLookup(ctx context.Context, tx kv.Tx, hash common.Hash) (types.Transaction, *types.Block, uint64, error) {
+	blockNumber, err := rawdb.ReadTxLookupEntry(ctx, tx, api._blockReader, hash)
+	if err != nil || blockNumber == nil {
+		return nil, nil, 0, err
+	}
+	block, err := api.blockByNumberWithSenders(tx, *blockNumber)
+	if err != nil || block == nil {
+		return nil, nil, 0, err
+	}
+	for i, txn := range block.Transactions() {
+		if txn.Hash() == hash {
+			return txn, block, uint64(i), nil
+		}
+	}
+	return nil, nil, 0, nil
+}
+
+// uncles - returns uncles of given block. If underlying block reader supports it - block's transactions are not decoded (it's
+// important for blocks stored in snapshots). found=false means block is unknown.
+func (api *BaseAPI) uncles(ctx context.Context, tx kv.Tx, hash common.Hash, number uint64) (uncles []*types.Header, found bool, err error) {
+	if unclesReader, ok := api._blockReader.(interfaces.UnclesReader); ok {
+		if api.blocksLRU != nil {
+			if it, ok := api.blocksLRU.Get(hash); ok && it != nil {
+				return it.(*types.Block).Uncles(), true, nil
+			}
+		}
+		if rawdb.ReadHeaderNumber(tx, hash) == nil {
+			return nil, false, nil
+		}
+		uncles, err = unclesReader.Uncles(ctx, tx, hash, number)
+		if err != nil {
+			return nil, false, err
+		}
+		return uncles, true, nil
+	}
+
+	block, err := api.blockWithSenders(tx, hash, number)
+	if err != nil {
+		return nil, false, err
+	}
+	if block == nil {
+		return nil, false, nil
+	}
+	return block.Uncles(), true, nil
+}
+
 func (api *BaseAPI) chainConfigWithGenesis(tx kv.Tx) (*params.ChainConfig, *types.Block, error) {
 	api._genesisLock.RLock()
 	cc, genesisBlock := api._chainConfig, api._genesis
@@ -231,6 +296,8 @@ type APIImpl struct {
 	mining     txpool.MiningClient
 	db         kv.RoDB
 	GasCap     uint64
+
+	estimateGasErrorRatio float64
 }
 
 // NewEthAPI returns APIImpl instance
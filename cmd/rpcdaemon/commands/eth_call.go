@@ -2,29 +2,38 @@ package commands
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math/big"
+	"os"
+	"strings"
 
 	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces"
 	txpool_proto "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
 	"github.com/ledgerwatch/erigon/common/hexutil"
 	"github.com/ledgerwatch/erigon/core"
 	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/state"
 	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
 	"github.com/ledgerwatch/erigon/core/vm"
 	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 	"github.com/ledgerwatch/erigon/eth/tracers/logger"
 	"github.com/ledgerwatch/erigon/ethdb"
+	"github.com/ledgerwatch/erigon/ethdb/olddb"
 	"github.com/ledgerwatch/erigon/internal/ethapi"
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
 	"github.com/ledgerwatch/erigon/turbo/transactions"
+	"github.com/ledgerwatch/erigon/turbo/trie"
 	"github.com/ledgerwatch/log/v3"
 	"google.golang.org/grpc"
 )
@@ -42,38 +51,56 @@ func (api *APIImpl) Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHas
 		return nil, err
 	}
 
-	if args.Gas == nil || uint64(*args.Gas) == 0 {
-		args.Gas = (*hexutil.Uint64)(&api.GasCap)
+	allowance, err := api.allowGas(ctx, api.GasCap, requestedGas(args.Gas))
+	if err != nil {
+		return nil, err
 	}
+	args.Gas = (*hexutil.Uint64)(&allowance.gas)
 
 	contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
 	if api.TevmEnabled {
 		contractHasTEVM = ethdb.GetHasTEVM(tx)
 	}
 
-	blockNumber, hash, err := rpchelper.GetCanonicalBlockNumber(blockNrOrHash, tx, api.filters) // DoCall cannot be executed on non-canonical blocks
-	if err != nil {
-		return nil, err
-	}
-	block, err := api.BaseAPI.blockWithSenders(tx, hash, blockNumber)
-	if err != nil {
-		return nil, err
+	var block *types.Block
+	if num, ok := blockNrOrHash.Number(); ok && num == rpc.PendingBlockNumber {
+		overlay, pending, err := api.pendingOverlay(tx, chainConfig)
+		if err != nil {
+			return nil, err
+		}
+		if overlay != nil {
+			defer overlay.Rollback()
+			tx, block = overlay, pending
+		} else {
+			blockNrOrHash = rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+		}
 	}
 	if block == nil {
-		return nil, nil
+		blockNumber, hash, err := rpchelper.GetCanonicalBlockNumber(blockNrOrHash, tx, api.filters) // DoCall cannot be executed on non-canonical blocks
+		if err != nil {
+			return nil, err
+		}
+		block, err = api.BaseAPI.blockWithSenders(tx, hash, blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			return nil, nil
+		}
 	}
 
-	result, err := transactions.DoCall(ctx, args, tx, blockNrOrHash, block, overrides, api.GasCap, chainConfig, api.stateCache, contractHasTEVM)
+	result, err := transactions.DoCall(ctx, args, tx, blockNrOrHash, block, overrides, nil, allowance.gas, chainConfig, api.stateCache, api.historySnapshots, contractHasTEVM)
 	if err != nil {
 		return nil, err
 	}
+	allowance.release(result.UsedGas)
 
 	// If the result contains a revert reason, try to unpack and return it.
 	if len(result.Revert()) > 0 {
 		return nil, ethapi.NewRevertError(result)
 	}
 
-	return result.Return(), result.Err
+	return result.Return(), allowance.capError(result.Err)
 }
 
 func HeaderByNumberOrHash(ctx context.Context, tx kv.Tx, blockNrOrHash rpc.BlockNumberOrHash) (*types.Header, error) {
@@ -112,8 +139,12 @@ func HeaderByNumberOrHash(ctx context.Context, tx kv.Tx, blockNrOrHash rpc.Block
 	return nil, errors.New("invalid arguments; neither block nor hash specified")
 }
 
+// SetEstimateGasErrorRatio - eth_estimateGas stops the binary search when the estimate is within this ratio of the
+// minimal gas limit (0 - exact)
+func (api *APIImpl) SetEstimateGasErrorRatio(ratio float64) { api.estimateGasErrorRatio = ratio }
+
 // EstimateGas implements eth_estimateGas. Returns an estimate of how much gas is necessary to allow the transaction to complete. The transaction will not be added to the blockchain.
-func (api *APIImpl) EstimateGas(ctx context.Context, args ethapi.CallArgs, blockNrOrHash *rpc.BlockNumberOrHash) (hexutil.Uint64, error) {
+func (api *APIImpl) EstimateGas(ctx context.Context, args ethapi.CallArgs, blockNrOrHash *rpc.BlockNumberOrHash, overrides *map[common.Address]ethapi.Account, blockOverrides *ethapi.BlockOverrides) (hexutil.Uint64, error) {
 	bNrOrHash := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
 	if blockNrOrHash != nil {
 		bNrOrHash = *blockNrOrHash
@@ -136,16 +167,24 @@ func (api *APIImpl) EstimateGas(ctx context.Context, args ethapi.CallArgs, block
 		args.From = new(common.Address)
 	}
 
+	blockNumber, hash, err := rpchelper.GetCanonicalBlockNumber(bNrOrHash, dbtx, api.filters) // DoCall cannot be executed on non-canonical blocks
+	if err != nil {
+		return 0, err
+	}
+	block, err := api.BaseAPI.blockWithSenders(dbtx, hash, blockNumber)
+	if err != nil {
+		return 0, err
+	}
+	if block == nil {
+		return 0, fmt.Errorf("block %d not found", blockNumber)
+	}
+
 	// Determine the highest gas limit can be used during the estimation.
 	if args.Gas != nil && uint64(*args.Gas) >= params.TxGas {
 		hi = uint64(*args.Gas)
 	} else {
-		// Retrieve the block to act as the gas ceiling
-		h, err := HeaderByNumberOrHash(ctx, dbtx, bNrOrHash)
-		if err != nil {
-			return 0, err
-		}
-		hi = h.GasLimit
+		// Use the block gas limit as the gas ceiling
+		hi = blockOverrides.Override(block.Header()).GasLimit
 	}
 
 	var feeCap *big.Int
@@ -160,18 +199,22 @@ func (api *APIImpl) EstimateGas(ctx context.Context, args ethapi.CallArgs, block
 	}
 	// Recap the highest gas limit with account's available balance.
 	if feeCap.Sign() != 0 {
-		cacheView, err := api.stateCache.View(ctx, dbtx)
-		if err != nil {
-			return 0, err
-		}
-		stateReader := state.NewCachedReader2(cacheView, dbtx)
-		state := state.New(stateReader)
-		if state == nil {
-			return 0, fmt.Errorf("can't get the current state")
+		var balance *big.Int
+		if account, ok := overrideOf(overrides, *args.From); ok && account.Balance != nil {
+			balance = new(big.Int).Set((*account.Balance).ToInt())
+		} else {
+			cacheView, err := api.stateCache.View(ctx, dbtx)
+			if err != nil {
+				return 0, err
+			}
+			stateReader := state.NewCachedReader2(cacheView, dbtx)
+			state := state.New(stateReader)
+			if state == nil {
+				return 0, fmt.Errorf("can't get the current state")
+			}
+			balance = state.GetBalance(*args.From).ToBig() // from can't be nil
 		}
-
-		balance := state.GetBalance(*args.From) // from can't be nil
-		available := balance.ToBig()
+		available := new(big.Int).Set(balance)
 		if args.Value != nil {
 			if args.Value.ToInt().Cmp(available) >= 0 {
 				return 0, errors.New("insufficient funds for transfer")
@@ -193,12 +236,12 @@ func (api *APIImpl) EstimateGas(ctx context.Context, args ethapi.CallArgs, block
 	}
 
 	// Recap the highest gas allowance with specified gascap.
-	if hi > api.GasCap {
-		log.Warn("Caller gas above allowance, capping", "requested", hi, "cap", api.GasCap)
-		hi = api.GasCap
+	allowance, err := api.allowGas(ctx, api.GasCap, hi)
+	if err != nil {
+		return 0, err
 	}
+	hi = allowance.gas
 	cap = hi
-	var lastBlockNum = rpc.LatestBlockNumber
 
 	chainConfig, err := api.chainConfig(dbtx)
 	if err != nil {
@@ -214,21 +257,8 @@ func (api *APIImpl) EstimateGas(ctx context.Context, args ethapi.CallArgs, block
 	executable := func(gas uint64) (bool, *core.ExecutionResult, error) {
 		args.Gas = (*hexutil.Uint64)(&gas)
 
-		numOrHash := rpc.BlockNumberOrHash{BlockNumber: &lastBlockNum}
-		blockNumber, hash, err := rpchelper.GetCanonicalBlockNumber(numOrHash, dbtx, api.filters) // DoCall cannot be executed on non-canonical blocks
-		if err != nil {
-			return false, nil, err
-		}
-		block, err := api.BaseAPI.blockWithSenders(dbtx, hash, blockNumber)
-		if err != nil {
-			return false, nil, err
-		}
-		if block == nil {
-			return false, nil, nil
-		}
-
-		result, err := transactions.DoCall(ctx, args, dbtx, numOrHash, block, nil,
-			api.GasCap, chainConfig, api.stateCache, contractHasTEVM)
+		result, err := transactions.DoCall(ctx, args, dbtx, bNrOrHash, block, overrides, blockOverrides,
+			cap, chainConfig, api.stateCache, api.historySnapshots, contractHasTEVM)
 		if err != nil {
 			if errors.Is(err, core.ErrIntrinsicGas) {
 				// Special case, raise gas limit
@@ -240,9 +270,52 @@ func (api *APIImpl) EstimateGas(ctx context.Context, args ethapi.CallArgs, block
 		}
 		return result.Failed(), result, nil
 	}
+	// Reject the transaction as invalid if it fails at the highest allowance
+	failed, result, err := executable(hi)
+	if err != nil {
+		return 0, err
+	}
+	if failed {
+		if result != nil && !errors.Is(result.Err, vm.ErrOutOfGas) {
+			if len(result.Revert()) > 0 {
+				return 0, ethapi.NewRevertError(result)
+			}
+			return 0, result.Err
+		}
+		// Otherwise, the specified gas cap is too low
+		if allowance.capBy != "" {
+			return 0, fmt.Errorf("gas required exceeds allowance (%d), it's capped by --%s", cap, allowance.capBy)
+		}
+		return 0, fmt.Errorf("gas required exceeds allowance (%d)", cap)
+	}
+	// Transaction can't need less gas than it used, and usually needs just a bit more than it used without refunds:
+	// 1/64 of gas is kept by the caller of nested calls (EIP-150) and call with value gets the stipend.
+	// Try this limit first - most transactions succeed with it and the binary search is skipped.
+	if result.UsedGas-1 > lo {
+		lo = result.UsedGas - 1
+	}
+	optimistic := (result.UsedGas + result.RefundedGas + params.CallStipend) * 64 / 63
+	if optimistic < hi {
+		failed, _, err := executable(optimistic)
+		if err != nil {
+			return 0, err
+		}
+		if failed {
+			lo = optimistic
+		} else {
+			hi = optimistic
+		}
+	}
 	// Execute the binary search and hone in on an executable gas limit
 	for lo+1 < hi {
+		if float64(hi-lo)/float64(hi) < api.estimateGasErrorRatio {
+			break // estimate is close enough to the minimal gas limit
+		}
 		mid := (hi + lo) / 2
+		if mid > lo*2 {
+			// Most transactions need gas close to the lower bound, don't jump far above it
+			mid = lo * 2
+		}
 		failed, _, err := executable(mid)
 
 		// If the error is not nil(consensus error), it means the provided message
@@ -257,39 +330,233 @@ func (api *APIImpl) EstimateGas(ctx context.Context, args ethapi.CallArgs, block
 			hi = mid
 		}
 	}
-	// Reject the transaction as invalid if it still fails at the highest allowance
-	if hi == cap {
-		failed, result, err := executable(hi)
+	allowance.release(uint64(hi))
+	return hexutil.Uint64(hi), nil
+}
+
+func overrideOf(overrides *map[common.Address]ethapi.Account, addr common.Address) (ethapi.Account, bool) {
+	if overrides == nil {
+		return ethapi.Account{}, false
+	}
+	account, ok := (*overrides)[addr]
+	return account, ok
+}
+
+// maxGetProofRewindBlockCount - proofs for older blocks require to unwind hashed state in memory, it's bounded
+const maxGetProofRewindBlockCount = 1_000
+
+// GetProof implements eth_getProof (EIP-1186). Returns the account and storage values of the given address with merkle
+// proofs against the state root of the block. Available for the blocks at most maxGetProofRewindBlockCount blocks older
+// than the latest block with calculated state root.
+func (api *APIImpl) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNrOrHash rpc.BlockNumberOrHash) (*ethapi.AccountResult, error) {
+	keys := make([]common.Hash, len(storageKeys))
+	for i, key := range storageKeys {
+		var err error
+		if keys[i], err = decodeStorageKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	blockNr, _, err := rpchelper.GetBlockNumber(blockNrOrHash, tx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+	proven, err := proveState(ctx, tx, "eth_getProof", blockNr, map[common.Address][]common.Hash{address: keys})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ethapi.AccountResult{
+		Address:      address,
+		Balance:      (*hexutil.Big)(new(big.Int)),
+		CodeHash:     trie.EmptyCodeHash,
+		StorageHash:  trie.EmptyRoot,
+		StorageProof: make([]ethapi.StorageResult, len(keys)),
+	}
+	if acc := proven.accounts[address]; acc != nil {
+		result.Balance = (*hexutil.Big)(acc.Balance.ToBig())
+		result.Nonce = hexutil.Uint64(acc.Nonce)
+		result.CodeHash = acc.CodeHash
+	}
+	accountProof, err := proven.accountProof(address)
+	if err != nil {
+		return nil, err
+	}
+	result.AccountProof = toHexSlice(accountProof)
+	result.StorageHash = proven.storageRoot(address)
+	for i, key := range keys {
+		proof, err := proven.storageProof(address, key)
+		if err != nil {
+			return nil, err
+		}
+		result.StorageProof[i] = ethapi.StorageResult{
+			Key:   storageKeys[i],
+			Value: (*hexutil.Big)(new(big.Int).SetBytes(proven.storage[address][key])),
+			Proof: toHexSlice(proof),
+		}
+	}
+	return result, nil
+}
+
+// provenState - accounts and storage slots of the state after some block, with the state trie which retains paths to them
+type provenState struct {
+	root     common.Hash
+	trie     *trie.Trie
+	accounts map[common.Address]*accounts.Account      // nil - account doesn't exist
+	storage  map[common.Address]map[common.Hash][]byte // absent slots are not in the map
+}
+
+// proveState - reads given accounts and storage slots of the state after block blockNr and builds the state trie with
+// paths to all of them, checking its root against the header. The block must be at most maxGetProofRewindBlockCount
+// blocks older than the latest block with calculated state root.
+func proveState(ctx context.Context, tx kv.Tx, logPrefix string, blockNr uint64, keys map[common.Address][]common.Hash) (*provenState, error) {
+	hash, err := rawdb.ReadCanonicalHash(tx, blockNr)
+	if err != nil {
+		return nil, err
+	}
+	header := rawdb.ReadHeader(tx, hash, blockNr)
+	if header == nil {
+		return nil, fmt.Errorf("block %d not found", blockNr)
+	}
+	latest, err := stages.GetStageProgress(tx, stages.IntermediateHashes)
+	if err != nil {
+		return nil, err
+	}
+	if blockNr > latest {
+		return nil, fmt.Errorf("state root of block %d is not calculated yet, latest is %d", blockNr, latest)
+	}
+	if latest-blockNr > maxGetProofRewindBlockCount {
+		return nil, fmt.Errorf("block %d is too old, proofs are available for the last %d blocks (latest is %d)", blockNr, maxGetProofRewindBlockCount, latest)
+	}
+
+	batch := olddb.NewMemoryBatch(tx)
+	defer batch.Rollback()
+	rl := trie.NewRetainList(0)
+	var loader *trie.FlatDBTrieLoader
+	if blockNr < latest {
+		if loader, err = stagedsync.UnwindIntermediateHashesForTrieLoader(logPrefix, rl, latest, blockNr, batch, os.TempDir(), ctx.Done()); err != nil {
+			return nil, err
+		}
+	} else {
+		loader = trie.NewFlatDBTrieLoader(logPrefix)
+		if err = loader.Reset(rl, nil, nil, false); err != nil {
+			return nil, err
+		}
+	}
+
+	// accounts and storage of the block are in (unwound) hashed state
+	proven := &provenState{
+		accounts: make(map[common.Address]*accounts.Account, len(keys)),
+		storage:  map[common.Address]map[common.Hash][]byte{},
+	}
+	proofRL := trie.NewRetainList(0)
+	for address, storageKeys := range keys {
+		addrHash := crypto.Keccak256Hash(address[:])
+		enc, err := batch.GetOne(kv.HashedAccounts, addrHash[:])
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		if failed {
-			if result != nil && !errors.Is(result.Err, vm.ErrOutOfGas) {
-				if len(result.Revert()) > 0 {
-					return 0, ethapi.NewRevertError(result)
-				}
-				return 0, result.Err
+		var incarnation uint64
+		if len(enc) > 0 {
+			acc := new(accounts.Account)
+			if err = acc.DecodeForStorage(enc); err != nil {
+				return nil, err
+			}
+			proven.accounts[address] = acc
+			incarnation = acc.Incarnation
+		}
+		rl.AddKey(addrHash[:])
+		proofRL.AddKey(addrHash[:])
+		for _, key := range storageKeys {
+			keyHash := crypto.Keccak256Hash(key[:])
+			storageKey := dbutils.GenerateCompositeStorageKey(addrHash, incarnation, keyHash)
+			rl.AddKey(storageKey)
+			proofRL.AddKey(storageKey)
+			if incarnation == 0 {
+				continue
 			}
-			// Otherwise, the specified gas cap is too low
-			return 0, fmt.Errorf("gas required exceeds allowance (%d)", cap)
+			v, err := batch.GetOne(kv.HashedStorage, storageKey)
+			if err != nil {
+				return nil, err
+			}
+			if len(v) == 0 {
+				continue
+			}
+			if proven.storage[address] == nil {
+				proven.storage[address] = map[common.Hash][]byte{}
+			}
+			proven.storage[address][key] = common.CopyBytes(v)
 		}
 	}
-	return hexutil.Uint64(hi), nil
+
+	loader.RetainNodes(proofRL)
+	root, err := loader.CalcTrieRoot(batch, nil, ctx.Done())
+	if err != nil {
+		return nil, err
+	}
+	if root != header.Root {
+		return nil, fmt.Errorf("wrong trie root of block %d: %x, expected (from header): %x", blockNr, root, header.Root)
+	}
+	proven.root, proven.trie = root, loader.RetainedTrie()
+	return proven, nil
+}
+
+// accountProof - nodes of the account trie on the path to the account (or to the place where it would be)
+func (p *provenState) accountProof(address common.Address) ([][]byte, error) {
+	addrHash := crypto.Keccak256Hash(address[:])
+	return p.trie.Prove(addrHash[:], 0, false)
+}
+
+// storageProof - nodes of the storage trie of the account on the path to the slot
+func (p *provenState) storageProof(address common.Address, key common.Hash) ([][]byte, error) {
+	addrHash, keyHash := crypto.Keccak256Hash(address[:]), crypto.Keccak256Hash(key[:])
+	return p.trie.Prove(append(addrHash.Bytes(), keyHash[:]...), 64, true)
+}
+
+func (p *provenState) storageRoot(address common.Address) common.Hash {
+	addrHash := crypto.Keccak256Hash(address[:])
+	if acc, ok := p.trie.GetAccount(addrHash[:]); ok && acc != nil {
+		return acc.Root
+	}
+	return trie.EmptyRoot
 }
 
-// GetProof not implemented
-func (api *APIImpl) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNr rpc.BlockNumber) (*interface{}, error) {
-	var stub interface{}
-	return &stub, fmt.Errorf(NotImplemented, "eth_getProof")
+// decodeStorageKey - like geth, accepts keys shorter than 32 bytes and odd number of hex digits
+func decodeStorageKey(s string) (common.Hash, error) {
+	h := strings.TrimPrefix(s, "0x")
+	if len(h)%2 == 1 {
+		h = "0" + h
+	}
+	b, err := hex.DecodeString(h)
+	if err != nil || len(b) > common.HashLength {
+		return common.Hash{}, fmt.Errorf("invalid storage key %q", s)
+	}
+	return common.BytesToHash(b), nil
+}
+
+func toHexSlice(b [][]byte) []string {
+	r := make([]string, len(b))
+	for i := range b {
+		r[i] = hexutil.Encode(b[i])
+	}
+	return r
 }
 
 // accessListResult returns an optional accesslist
-// Its the result of the `debug_createAccessList` RPC call.
+// Its the result of the `eth_createAccessList` RPC call.
 // It contains an error if the transaction itself failed.
 type accessListResult struct {
 	Accesslist *types.AccessList `json:"accessList"`
 	Error      string            `json:"error,omitempty"`
 	GasUsed    hexutil.Uint64    `json:"gasUsed"`
+	// GasUsedWithoutAccessList - gas used by the same transaction without access list, to decide if the list is worth it
+	GasUsedWithoutAccessList hexutil.Uint64 `json:"gasUsedWithoutAccessList"`
 }
 
 // CreateAccessList implements eth_createAccessList. It creates an access list for the given transaction.
@@ -329,14 +596,21 @@ func (api *APIImpl) CreateAccessList(ctx context.Context, args ethapi.CallArgs,
 		}
 		stateReader = state.NewCachedReader2(cacheView, tx)
 	} else {
-		stateReader = state.NewPlainState(tx, blockNumber)
+		stateReader = state.NewPlainState(tx, blockNumber, api.historySnapshots)
 	}
-	state := state.New(stateReader)
 
 	header := block.Header()
 	// If the gas amount is not set, extract this as it will depend on access
 	// lists and we'll need to reestimate every time
 	nogas := args.Gas == nil
+	allowance, err := api.allowGas(ctx, api.GasCap, requestedGas(args.Gas))
+	if err != nil {
+		return nil, err
+	}
+	// Use zero address if sender unspecified.
+	if args.From == nil {
+		args.From = new(common.Address)
+	}
 
 	var to common.Address
 	if args.To != nil {
@@ -359,18 +633,10 @@ func (api *APIImpl) CreateAccessList(ctx context.Context, args ethapi.CallArgs,
 		to = crypto.CreateAddress(*args.From, uint64(*args.Nonce))
 	}
 	// Retrieve the precompiles since they don't need to be added to the access list
-	precompiles := vm.ActivePrecompiles(chainConfig.Rules(blockNumber))
-
-	// Create an initial tracer
-	prevTracer := logger.NewAccessListTracer(nil, *args.From, to, precompiles)
-	if args.AccessList != nil {
-		prevTracer = logger.NewAccessListTracer(*args.AccessList, *args.From, to, precompiles)
-	}
-	for {
-		// Retrieve the current access list to expand
-		accessList := prevTracer.AccessList()
-		log.Trace("Creating access list", "input", accessList)
+	precompiles := vm.PrecompiledAddresses(chainConfig, blockNumber)
 
+	// apply - executes the transaction with given access list on top of the block state
+	apply := func(accessList types.AccessList) (*core.ExecutionResult, *logger.AccessListTracer, error) {
 		// If no gas amount was specified, each unique access list needs it's own
 		// gas calculation. This is quite expensive, but we need to be accurate
 		// and it's convered by the sender only anyway.
@@ -379,10 +645,13 @@ func (api *APIImpl) CreateAccessList(ctx context.Context, args ethapi.CallArgs,
 		}
 		// Set the accesslist to the last al
 		args.AccessList = &accessList
-		baseFee, _ := uint256.FromBig(header.BaseFee)
-		msg, err := args.ToMessage(api.GasCap, baseFee)
+		var baseFee *uint256.Int
+		if header.BaseFee != nil {
+			baseFee, _ = uint256.FromBig(header.BaseFee)
+		}
+		msg, err := args.ToMessage(allowance.gas, baseFee)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		// Apply the transaction with the access list tracer
@@ -390,18 +659,48 @@ func (api *APIImpl) CreateAccessList(ctx context.Context, args ethapi.CallArgs,
 		config := vm.Config{Tracer: tracer, Debug: true, NoBaseFee: true}
 		blockCtx, txCtx := transactions.GetEvmContext(msg, header, blockNrOrHash.RequireCanonical, tx, contractHasTEVM)
 
-		evm := vm.NewEVM(blockCtx, txCtx, state, chainConfig, config)
+		evm := vm.NewEVM(blockCtx, txCtx, state.New(stateReader), chainConfig, config)
 		gp := new(core.GasPool).AddGas(msg.Gas())
 		res, err := core.ApplyMessage(evm, msg, gp, true /* refunds */, false /* gasBailout */)
+		if err != nil {
+			return nil, nil, err
+		}
+		return res, tracer, nil
+	}
+
+	// Create an initial tracer
+	prevTracer := logger.NewAccessListTracer(nil, *args.From, to, precompiles)
+	if args.AccessList != nil {
+		prevTracer = logger.NewAccessListTracer(*args.AccessList, *args.From, to, precompiles)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// Retrieve the current access list to expand
+		accessList := prevTracer.AccessList()
+		log.Trace("Creating access list", "input", accessList)
+
+		res, tracer, err := apply(accessList)
 		if err != nil {
 			return nil, err
 		}
 		if tracer.Equal(prevTracer) {
+			gasWithout := res.UsedGas
+			if len(accessList) > 0 {
+				resWithout, _, err := apply(nil)
+				if err != nil {
+					return nil, err
+				}
+				gasWithout = resWithout.UsedGas
+			}
+			allowance.release(res.UsedGas)
 			var errString string
 			if res.Err != nil {
-				errString = res.Err.Error()
+				errString = allowance.capError(res.Err).Error()
 			}
-			return &accessListResult{Accesslist: &accessList, Error: errString, GasUsed: hexutil.Uint64(res.UsedGas)}, nil
+			return &accessListResult{Accesslist: &accessList, Error: errString, GasUsed: hexutil.Uint64(res.UsedGas),
+				GasUsedWithoutAccessList: hexutil.Uint64(gasWithout)}, nil
 		}
 		prevTracer = tracer
 	}
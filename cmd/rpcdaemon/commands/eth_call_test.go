@@ -3,14 +3,24 @@ package commands
 import (
 	"context"
 	"fmt"
+	"math/big"
 	"testing"
 
+	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/rpcdaemontest"
 	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/erigon/internal/ethapi"
+	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/ledgerwatch/erigon/turbo/trie"
+	"github.com/stretchr/testify/require"
 )
 
 func TestEstimateGas(t *testing.T) {
@@ -22,11 +32,75 @@ func TestEstimateGas(t *testing.T) {
 	if _, err := api.EstimateGas(context.Background(), ethapi.CallArgs{
 		From: &from,
 		To:   &to,
-	}, nil); err != nil {
+	}, nil, nil, nil); err != nil {
 		t.Errorf("calling EstimateGas: %v", err)
 	}
 }
 
+func TestEstimateGasOverrides(t *testing.T) {
+	m := stages.Mock(t)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 1, func(i int, b *core.BlockGen) {}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	api := NewEthAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil, nil, nil, 5000000)
+	ctx := context.Background()
+	latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	from, to := common.Address{0xf}, common.Address{0xc}
+	args := ethapi.CallArgs{From: &from, To: &to, Value: (*hexutil.Big)(big.NewInt(1)), GasPrice: (*hexutil.Big)(big.NewInt(1))}
+
+	_, err = api.EstimateGas(ctx, args, &latest, nil, nil)
+	require.EqualError(t, err, "insufficient funds for transfer")
+	balance := (*hexutil.Big)(big.NewInt(params.Ether))
+	code := hexutil.Bytes(common.FromHex("0x600160005500")) // sstore(0, 1)
+	overrides := map[common.Address]ethapi.Account{from: {Balance: &balance}, to: {Code: &code}}
+	gas, err := api.EstimateGas(ctx, args, &latest, &overrides, nil)
+	require.NoError(t, err)
+
+	// estimate is the minimal gas limit
+	args.Gas = &gas
+	_, err = api.Call(ctx, args, latest, &overrides)
+	require.NoError(t, err)
+	lower := gas - 1
+	args.Gas = &lower
+	_, err = api.Call(ctx, args, latest, &overrides)
+	require.Error(t, err)
+	args.Gas = nil
+
+	api.SetEstimateGasErrorRatio(0.015)
+	approx, err := api.EstimateGas(ctx, args, &latest, &overrides, nil)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, uint64(approx), uint64(gas))
+	require.LessOrEqual(t, float64(approx), float64(gas)*1.015)
+
+	gasLimit := hexutil.Uint64(30_000)
+	_, err = api.EstimateGas(ctx, args, &latest, &overrides, &ethapi.BlockOverrides{GasLimit: &gasLimit})
+	require.EqualError(t, err, "gas required exceeds allowance (30000)")
+}
+
+func TestCreateAccessList(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	contract := common.Address{0xc}
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc: core.GenesisAlloc{
+			sender:   {Balance: big.NewInt(params.Ether)},
+			contract: {Balance: new(big.Int), Code: common.FromHex("0x60005400")}, // sload(0)
+		},
+	}
+	m := stages.MockWithGenesis(t, gspec, key)
+	api := NewEthAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil, nil, nil, 5000000)
+
+	result, err := api.CreateAccessList(context.Background(), ethapi.CallArgs{From: &sender, To: &contract}, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+	require.NoError(t, err)
+	require.Empty(t, result.Error)
+	require.Equal(t, types.AccessList{{Address: contract, StorageKeys: []common.Hash{{}}}}, *result.Accesslist)
+	// warm slot costs 2100-100 less, but listed address and slot cost 2400+1900
+	require.Equal(t, uint64(params.TxGas+3+2100), uint64(result.GasUsedWithoutAccessList))
+	require.Equal(t, uint64(result.GasUsedWithoutAccessList)+2300, uint64(result.GasUsed))
+}
+
 func TestEthCallNonCanonical(t *testing.T) {
 	db := rpcdaemontest.CreateTestKV(t)
 	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
@@ -42,3 +116,91 @@ func TestEthCallNonCanonical(t *testing.T) {
 		}
 	}
 }
+
+func TestGetProof(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	m := stages.MockWithGenesis(t, gspec, key)
+	signer := types.LatestSignerForChainID(nil)
+
+	// block 1 creates contract with slots 0..3 = 1..4, block 2 calls it: slot 1 = 0, slot 2 = 9, block 3 is empty
+	contract := crypto.CreateAddress(sender, 0)
+	initCode := common.FromHex("0x6001600055600260015560036002556004600355600b6020600039600b6000f3" + "6000600155600960025500")
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 3, func(i int, b *core.BlockGen) {
+		var txn types.Transaction
+		var err error
+		switch i {
+		case 0:
+			txn, err = types.SignTx(types.NewContractCreation(b.TxNonce(sender), uint256.NewInt(0), 200_000, uint256.NewInt(1), initCode), *signer, key)
+		case 1:
+			txn, err = types.SignTx(types.NewTransaction(b.TxNonce(sender), contract, uint256.NewInt(0), 100_000, uint256.NewInt(1), nil), *signer, key)
+		default:
+			return
+		}
+		require.NoError(t, err)
+		b.AddTx(txn)
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	api := NewEthAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil, nil, nil, 5000000)
+	ctx := context.Background()
+	slots := []string{"0x0", "0x1", "0x2", "0x0000000000000000000000000000000000000000000000000000000000000003", "0x4"}
+	expected := map[uint64][]int64{0: {0, 0, 0, 0, 0}, 1: {1, 2, 3, 4, 0}, 2: {1, 0, 9, 4, 0}, 3: {1, 0, 9, 4, 0}}
+	for blockNr, values := range expected {
+		var header *types.Header
+		if blockNr == 0 {
+			header = m.Genesis.Header()
+		} else {
+			header = chain.Headers[blockNr-1]
+		}
+		for _, address := range []common.Address{contract, sender, {1}} {
+			result, err := api.GetProof(ctx, address, slots, rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(blockNr)))
+			require.NoError(t, err, "block %d", blockNr)
+
+			addrHash := crypto.Keccak256(address[:])
+			accountProof := make([][]byte, len(result.AccountProof))
+			for i, node := range result.AccountProof {
+				accountProof[i] = common.FromHex(node)
+			}
+			enc, err := trie.VerifyProof(header.Root, addrHash, accountProof)
+			require.NoError(t, err, "block %d, address %x", blockNr, address)
+			if address == (common.Address{1}) || (address == contract && blockNr == 0) {
+				require.Nil(t, enc)
+				require.Equal(t, trie.EmptyRoot, result.StorageHash)
+			} else {
+				require.NotNil(t, enc)
+			}
+
+			for i, storage := range result.StorageProof {
+				require.Equal(t, slots[i], storage.Key)
+				proof := make([][]byte, len(storage.Proof))
+				for j, node := range storage.Proof {
+					proof[j] = common.FromHex(node)
+				}
+				slot := common.HexToHash(slots[i])
+				value, err := trie.VerifyProof(result.StorageHash, crypto.Keccak256(slot[:]), proof)
+				require.NoError(t, err, "block %d, slot %s", blockNr, slots[i])
+				want := int64(0)
+				if address == contract {
+					want = values[i]
+				}
+				require.Equal(t, want, storage.Value.ToInt().Int64(), "block %d, slot %s", blockNr, slots[i])
+				if want == 0 {
+					require.Nil(t, value)
+				} else {
+					require.Equal(t, big.NewInt(want).Bytes(), common.TrimLeftZeroes(value))
+				}
+			}
+		}
+	}
+
+	_, err = api.GetProof(ctx, contract, []string{"0xzz"}, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+	require.Error(t, err)
+	_, err = api.GetProof(ctx, contract, nil, rpc.BlockNumberOrHashWithNumber(4))
+	require.Error(t, err)
+}
@@ -2,39 +2,161 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/filters"
 	"github.com/ledgerwatch/erigon/common/debug"
 	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/types"
+	ethFilters "github.com/ledgerwatch/erigon/eth/filters"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/log/v3"
 )
 
+var (
+	errPollFiltersUnavailable = errors.New("filters are not available")
+	errFilterNotFound         = errors.New("filter not found")
+)
+
 // NewPendingTransactionFilter new transaction filter
 func (api *APIImpl) NewPendingTransactionFilter(ctx context.Context) (hexutil.Uint64, error) {
 	return 0, fmt.Errorf(NotImplemented, "eth_newPendingTransactionFilter")
 }
 
-// NewBlockFilter new transaction filter
-func (api *APIImpl) NewBlockFilter(_ context.Context) (hexutil.Uint64, error) {
-	return 0, fmt.Errorf(NotImplemented, "eth_newBlockFilter")
+// NewBlockFilter implements eth_newBlockFilter. Creates a filter of hashes of new canonical blocks.
+func (api *APIImpl) NewBlockFilter(ctx context.Context) (hexutil.Uint64, error) {
+	return api.installPollFilter(ctx, &filters.PollFilter{Kind: filters.BlockPollFilter})
 }
 
-// NewFilter implements eth_newFilter. Creates an arbitrary filter object, based on filter options, to notify when the state changes (logs).
-func (api *APIImpl) NewFilter(_ context.Context, filter interface{}) (hexutil.Uint64, error) {
-	return 0, fmt.Errorf(NotImplemented, "eth_newFilter")
+// NewFilter implements eth_newFilter. Creates a filter of logs of new canonical blocks which match addresses and topics
+// of criteria. fromBlock and toBlock are ignored, use eth_getLogs for past blocks.
+func (api *APIImpl) NewFilter(ctx context.Context, crit ethFilters.FilterCriteria) (hexutil.Uint64, error) {
+	return api.installPollFilter(ctx, &filters.PollFilter{Kind: filters.LogsPollFilter, Addresses: crit.Addresses, Topics: crit.Topics})
 }
 
-// UninstallFilter new transaction filter
+func (api *APIImpl) installPollFilter(ctx context.Context, f *filters.PollFilter) (hexutil.Uint64, error) {
+	if api.pollFilters == nil {
+		return 0, errPollFiltersUnavailable
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var head uint64
+	if f.Kind == filters.LogsPollFilter {
+		head, err = logsHead(tx)
+	} else {
+		head, err = getLatestBlockNumber(tx)
+	}
+	if err != nil {
+		return 0, err
+	}
+	// head is remembered as sent, so its replacement is returned by the first poll
+	if f.Recent, err = appendSent(tx, nil, head, head, head, nil); err != nil {
+		return 0, err
+	}
+	f.Next = head + 1
+	f.Client = filterClient(ctx)
+	id, err := api.pollFilters.Install(f)
+	return hexutil.Uint64(id), err
+}
+
+// filterClient - IP address of HTTP client or connection of WebSocket/IPC client, filters are limited per client
+func filterClient(ctx context.Context) string {
+	if c, ok := rpc.ClientFromContext(ctx); ok {
+		return fmt.Sprintf("conn-%d", c.ConnID())
+	}
+	remote, _ := ctx.Value("remote").(string)
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		return host
+	}
+	return remote
+}
+
+// UninstallFilter implements eth_uninstallFilter
 func (api *APIImpl) UninstallFilter(_ context.Context, index hexutil.Uint64) (bool, error) {
-	return false, fmt.Errorf(NotImplemented, "eth_uninstallFilter")
+	if api.pollFilters == nil {
+		return false, errPollFiltersUnavailable
+	}
+	return api.pollFilters.Uninstall(uint64(index))
 }
 
-// GetFilterChanges implements eth_getFilterChanges. Polling method for a previously-created filter, which returns an array of logs which occurred since last poll.
-func (api *APIImpl) GetFilterChanges(_ context.Context, index hexutil.Uint64) ([]interface{}, error) {
-	var stub []interface{}
-	return stub, fmt.Errorf(NotImplemented, "eth_getFilterChanges")
+// GetFilterChanges implements eth_getFilterChanges. Polling method for a previously-created filter, returns hashes of
+// blocks or logs of blocks which were added to the canonical chain since last poll. At most logsBatch logs are returned
+// at once (logs of one block are not split), the rest is returned by next poll. On reorg, returned logs of replaced
+// blocks are returned again with removed=true, then changes of the new canonical blocks.
+func (api *APIImpl) GetFilterChanges(ctx context.Context, index hexutil.Uint64) ([]interface{}, error) {
+	if api.pollFilters == nil {
+		return nil, errPollFiltersUnavailable
+	}
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	changes := []interface{}{}
+	found, err := api.pollFilters.Poll(uint64(index), func(f *filters.PollFilter) error {
+		// reorg: changes of blocks which are not canonical anymore are returned again, logs with removed=true
+		recent, removed, err := unwindSent(tx, f.Recent)
+		if err != nil {
+			return err
+		}
+		if len(recent) < len(f.Recent) {
+			f.Next = f.Recent[len(recent)].Number
+		}
+		f.Recent = recent
+		switch f.Kind {
+		case filters.BlockPollFilter:
+			head, err := getLatestBlockNumber(tx)
+			if err != nil {
+				return err
+			}
+			from := f.Next
+			for ; f.Next <= head; f.Next++ {
+				hash, err := rawdb.ReadCanonicalHash(tx, f.Next)
+				if err != nil {
+					return err
+				}
+				changes = append(changes, hash)
+			}
+			if from <= head {
+				f.Recent, err = appendSent(tx, f.Recent, from, head, head, nil)
+			}
+			return err
+		case filters.LogsPollFilter:
+			for _, l := range removed {
+				changes = append(changes, l)
+			}
+			head, err := logsHead(tx)
+			if err != nil || f.Next > head {
+				return err
+			}
+			crit := ethFilters.FilterCriteria{Addresses: f.Addresses, Topics: f.Topics}
+			logs, last, err := api.getLogsInRange(ctx, tx, crit, f.Next, head, logsBatch)
+			if err != nil {
+				return err
+			}
+			for _, l := range logs {
+				changes = append(changes, l)
+			}
+			if f.Recent, err = appendSent(tx, f.Recent, f.Next, last, head, logs); err != nil {
+				return err
+			}
+			f.Next = last + 1
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errFilterNotFound
+	}
+	return changes, nil
 }
 
 // NewHeads send a notification each time a new (header) block is appended to the chain.
@@ -110,3 +232,39 @@ func (api *APIImpl) NewPendingTransactions(ctx context.Context) (*rpc.Subscripti
 
 	return rpcSub, nil
 }
+
+// DroppedTransactions send a notification each time txpool drops transaction, which was sent via this RPC daemon
+// and accepted by txpool, without mining it.
+func (api *APIImpl) DroppedTransactions(ctx context.Context) (*rpc.Subscription, error) {
+	if api.filters == nil {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		defer debug.LogPanic()
+		droppedCh := make(chan *filters.DroppedTx, 1)
+		defer close(droppedCh)
+		id := api.filters.SubscribeDroppedTxs(droppedCh)
+		defer api.filters.UnsubscribeDroppedTxs(id)
+
+		for {
+			select {
+			case d := <-droppedCh:
+				err := notifier.Notify(rpcSub.ID, d)
+				if err != nil {
+					log.Warn("error while notifying subscription", "err", err)
+				}
+			case <-rpcSub.Err():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
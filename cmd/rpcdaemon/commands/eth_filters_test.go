@@ -0,0 +1,147 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/filters"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/rpcdaemontest"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/types"
+	ethFilters "github.com/ledgerwatch/erigon/eth/filters"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollFilters(t *testing.T) {
+	m, chain, _ := rpcdaemontest.CreateTestSentry(t)
+	base := NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false)
+	pf, err := filters.OpenPollFilters("", filters.PollFiltersConfig{TTL: filters.DefaultPollFilterTTL}, log.New())
+	require.NoError(t, err)
+	defer pf.Close()
+	base.SetPollFilters(pf)
+	api := NewEthAPI(base, m.DB, nil, nil, nil, 5000000)
+	ctx := context.Background()
+
+	// new filters start after the head
+	blockFilter, err := api.NewBlockFilter(ctx)
+	require.NoError(t, err)
+	changes, err := api.GetFilterChanges(ctx, blockFilter)
+	require.NoError(t, err)
+	require.Empty(t, changes)
+	logsFilter, err := api.NewFilter(ctx, ethFilters.FilterCriteria{})
+	require.NoError(t, err)
+	changes, err = api.GetFilterChanges(ctx, logsFilter)
+	require.NoError(t, err)
+	require.Empty(t, changes)
+
+	// filters installed before blocks were added
+	id, err := pf.Install(&filters.PollFilter{Kind: filters.BlockPollFilter, Next: 8})
+	require.NoError(t, err)
+	changes, err = api.GetFilterChanges(ctx, hexutil.Uint64(id))
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{chain.Blocks[7].Hash(), chain.Blocks[8].Hash(), chain.Blocks[9].Hash()}, changes)
+
+	expected, err := api.GetLogs(ctx, ethFilters.FilterCriteria{})
+	require.NoError(t, err)
+	require.NotEmpty(t, expected)
+	id, err = pf.Install(&filters.PollFilter{Kind: filters.LogsPollFilter, Next: 1})
+	require.NoError(t, err)
+	changes, err = api.GetFilterChanges(ctx, hexutil.Uint64(id))
+	require.NoError(t, err)
+	require.Len(t, changes, len(expected))
+	changes, err = api.GetFilterChanges(ctx, hexutil.Uint64(id))
+	require.NoError(t, err)
+	require.Empty(t, changes)
+
+	id, err = pf.Install(&filters.PollFilter{Kind: filters.LogsPollFilter, Addresses: []common.Address{{1}}, Next: 1})
+	require.NoError(t, err)
+	changes, err = api.GetFilterChanges(ctx, hexutil.Uint64(id))
+	require.NoError(t, err)
+	require.Empty(t, changes)
+
+	uninstalled, err := api.UninstallFilter(ctx, hexutil.Uint64(id))
+	require.NoError(t, err)
+	require.True(t, uninstalled)
+	_, err = api.GetFilterChanges(ctx, hexutil.Uint64(id))
+	require.Error(t, err)
+}
+
+func TestPollFiltersReorg(t *testing.T) {
+	m, chain, _ := rpcdaemontest.CreateTestSentry(t)
+	base := NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false)
+	pf, err := filters.OpenPollFilters("", filters.PollFiltersConfig{TTL: filters.DefaultPollFilterTTL}, log.New())
+	require.NoError(t, err)
+	defer pf.Close()
+	base.SetPollFilters(pf)
+	api := NewEthAPI(base, m.DB, nil, nil, nil, 5000000)
+	ctx := context.Background()
+	top := chain.TopBlock.NumberU64()
+
+	// blocks from 8 were returned before reorg
+	sent := func() []filters.SentBlock {
+		return []filters.SentBlock{
+			{Number: 7, Hash: chain.Blocks[6].Hash()},
+			{Number: 8, Hash: common.Hash{1}, Logs: []*types.Log{{BlockNumber: 8, BlockHash: common.Hash{1}, Topics: []common.Hash{}}}},
+			{Number: 9, Hash: common.Hash{2}, Logs: []*types.Log{{BlockNumber: 9, BlockHash: common.Hash{2}, Index: 1, Topics: []common.Hash{}}}},
+		}
+	}
+	id, err := pf.Install(&filters.PollFilter{Kind: filters.BlockPollFilter, Next: 10, Recent: sent()})
+	require.NoError(t, err)
+	changes, err := api.GetFilterChanges(ctx, hexutil.Uint64(id))
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{chain.Blocks[7].Hash(), chain.Blocks[8].Hash(), chain.Blocks[9].Hash()}, changes)
+	changes, err = api.GetFilterChanges(ctx, hexutil.Uint64(id))
+	require.NoError(t, err)
+	require.Empty(t, changes)
+
+	expected, err := api.GetLogs(ctx, ethFilters.FilterCriteria{FromBlock: big.NewInt(8)})
+	require.NoError(t, err)
+	require.NotEmpty(t, expected)
+	id, err = pf.Install(&filters.PollFilter{Kind: filters.LogsPollFilter, Next: 10, Recent: sent()})
+	require.NoError(t, err)
+	changes, err = api.GetFilterChanges(ctx, hexutil.Uint64(id))
+	require.NoError(t, err)
+	require.Len(t, changes, 2+len(expected))
+	require.Equal(t, &types.Log{BlockNumber: 9, BlockHash: common.Hash{2}, Index: 1, Topics: []common.Hash{}, Data: []byte{}, Removed: true}, changes[0])
+	require.Equal(t, &types.Log{BlockNumber: 8, BlockHash: common.Hash{1}, Topics: []common.Hash{}, Data: []byte{}, Removed: true}, changes[1])
+	for i, l := range expected {
+		require.Equal(t, *l, *changes[2+i].(*types.Log))
+	}
+	found, err := pf.Poll(id, func(f *filters.PollFilter) error {
+		require.Equal(t, top+1, f.Next)
+		require.Equal(t, top, f.Recent[len(f.Recent)-1].Number)
+		return nil
+	})
+	require.NoError(t, err)
+	require.True(t, found)
+	changes, err = api.GetFilterChanges(ctx, hexutil.Uint64(id))
+	require.NoError(t, err)
+	require.Empty(t, changes)
+}
+
+func TestPollFiltersPerConnection(t *testing.T) {
+	m, _, _ := rpcdaemontest.CreateTestSentry(t)
+	base := NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false)
+	pf, err := filters.OpenPollFilters("", filters.PollFiltersConfig{TTL: filters.DefaultPollFilterTTL, MaxPerClient: 1}, log.New())
+	require.NoError(t, err)
+	defer pf.Close()
+	base.SetPollFilters(pf)
+	server := rpc.NewServer(1)
+	require.NoError(t, server.RegisterName("eth", NewEthAPI(base, m.DB, nil, nil, nil, 5000000)))
+	defer server.Stop()
+
+	// connections without remote address are separate clients
+	first, second := rpc.DialInProc(server), rpc.DialInProc(server)
+	defer first.Close()
+	defer second.Close()
+	var id hexutil.Uint64
+	require.NoError(t, first.Call(&id, "eth_newBlockFilter"))
+	require.Error(t, first.Call(&id, "eth_newBlockFilter"))
+	require.NoError(t, second.Call(&id, "eth_newBlockFilter"))
+}
@@ -0,0 +1,263 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	rpcfilters "github.com/ledgerwatch/erigon/cmd/rpcdaemon/filters"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/debug"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/filters"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	// logsBatch - logs read in one read transaction. Transaction is closed before they are sent, so slow client
+	// doesn't keep it open
+	logsBatch = 10_000
+	// logsReorgDepth - sent logs of this many last blocks are remembered, to send them with removed=true on reorg
+	logsReorgDepth = 128
+	// logsPollInterval - how often subscription checks for new blocks, if new headers are not delivered by filters
+	logsPollInterval = time.Second
+)
+
+// errLogsNotify - client can't be notified (connection is closed or write timed out), subscription stops
+var errLogsNotify = errors.New("notify")
+
+// Logs - eth_subscribe("logs", criteria), notifies about logs of new canonical blocks which match addresses and topics
+// of criteria. If fromBlock of criteria is in the past, logs from fromBlock are sent first, read by log index in
+// batches - next batch is read when client received previous one. Then subscription continues with new blocks, without
+// gap or duplicates. On reorg, sent logs of replaced blocks are sent again with removed=true.
+func (api *APIImpl) Logs(ctx context.Context, crit filters.FilterCriteria) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	if crit.BlockHash != nil {
+		return nil, errors.New("blockHash is not supported by logs subscription")
+	}
+	if crit.ToBlock != nil {
+		return nil, errors.New("toBlock is not supported by logs subscription, it continues with new blocks")
+	}
+
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	head, err := logsHead(tx)
+	if err != nil {
+		return nil, err
+	}
+	next := head + 1
+	if crit.FromBlock != nil {
+		if crit.FromBlock.Sign() >= 0 {
+			next = crit.FromBlock.Uint64()
+		} else if !crit.FromBlock.IsInt64() || crit.FromBlock.Int64() != int64(rpc.LatestBlockNumber) {
+			return nil, fmt.Errorf("negative value for FromBlock: %v", crit.FromBlock)
+		}
+	}
+	pm, err := prune.Get(tx)
+	if err != nil {
+		return nil, err
+	}
+	if pm.Receipts.Enabled() && next < pm.Receipts.PruneTo(head) {
+		return nil, fmt.Errorf("logs are pruned before block %d", pm.Receipts.PruneTo(head))
+	}
+
+	sub := &logsSubscription{api: api, crit: crit, notifier: notifier, rpcSub: notifier.CreateSubscription(), next: next}
+	go sub.run()
+	return sub.rpcSub, nil
+}
+
+// logsHead - last block which logs can be read by log index
+func logsHead(tx kv.Tx) (uint64, error) {
+	executed, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return 0, err
+	}
+	indexed, err := stages.GetStageProgress(tx, stages.LogIndex)
+	if err != nil {
+		return 0, err
+	}
+	if indexed < executed {
+		return indexed, nil
+	}
+	return executed, nil
+}
+
+type logsSubscription struct {
+	api      *APIImpl
+	crit     filters.FilterCriteria
+	notifier *rpc.Notifier
+	rpcSub   *rpc.Subscription
+
+	next   uint64                 // first block which logs were not sent yet
+	recent []rpcfilters.SentBlock // sent blocks near head, contiguous
+}
+
+func (s *logsSubscription) run() {
+	defer debug.LogPanic()
+	wake := make(chan struct{}, 1)
+	if s.api.filters != nil {
+		headers := make(chan *types.Header, 1)
+		defer close(headers)
+		id := s.api.filters.SubscribeNewHeads(headers)
+		defer s.api.filters.UnsubscribeHeads(id)
+		// filters must not wait while historical logs are sent
+		go func() {
+			for range headers {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+	// notifications are buffered before activation, don't read logs until they can be sent
+	select {
+	case <-s.notifier.Activated():
+	case <-s.rpcSub.Err():
+		return
+	}
+
+	ticker := time.NewTicker(logsPollInterval)
+	defer ticker.Stop()
+	for {
+		caughtUp, err := s.step()
+		if errors.Is(err, errLogsNotify) {
+			log.Debug("[rpc] logs subscription stopped", "err", err)
+			return
+		}
+		if err != nil {
+			log.Warn("[rpc] logs subscription", "err", err)
+		}
+		if !caughtUp && err == nil {
+			select {
+			case <-s.rpcSub.Err():
+				return
+			default:
+			}
+			continue
+		}
+		select {
+		case <-wake:
+		case <-ticker.C:
+		case <-s.rpcSub.Err():
+			return
+		}
+	}
+}
+
+// step - sends removed logs of reorg and next batch of logs, caughtUp - all logs up to head are sent
+func (s *logsSubscription) step() (caughtUp bool, err error) {
+	removed, logs, caughtUp, err := s.read()
+	if err != nil {
+		return false, err
+	}
+	for _, l := range append(removed, logs...) {
+		if err := s.notifier.Notify(s.rpcSub.ID, l); err != nil {
+			return false, fmt.Errorf("%w: %v", errLogsNotify, err)
+		}
+	}
+	return caughtUp, nil
+}
+
+func (s *logsSubscription) read() (removed, logs []*types.Log, caughtUp bool, err error) {
+	tx, err := s.api.db.BeginRo(context.Background())
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer tx.Rollback()
+
+	// reorg: sent blocks which are not canonical anymore
+	kept, removed, err := unwindSent(tx, s.recent)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if len(kept) < len(s.recent) {
+		s.next = s.recent[len(kept)].Number
+	}
+	s.recent = kept
+
+	head, err := logsHead(tx)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if s.next > head {
+		return removed, nil, true, nil
+	}
+	logs, last, err := s.api.getLogsInRange(context.Background(), tx, s.crit, s.next, head, logsBatch)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if s.recent, err = appendSent(tx, s.recent, s.next, last, head, logs); err != nil {
+		return nil, nil, false, err
+	}
+	s.next = last + 1
+	return removed, logs, last == head, nil
+}
+
+// unwindSent - drops sent blocks which are not canonical anymore, returns their logs with removed=true, starting from
+// the top
+func unwindSent(tx kv.Tx, recent []rpcfilters.SentBlock) (kept []rpcfilters.SentBlock, removed []*types.Log, err error) {
+	n := len(recent)
+	for ; n > 0; n-- {
+		hash, err := rawdb.ReadCanonicalHash(tx, recent[n-1].Number)
+		if err != nil {
+			return nil, nil, err
+		}
+		if hash == recent[n-1].Hash {
+			break
+		}
+	}
+	for i := len(recent) - 1; i >= n; i-- {
+		for _, l := range recent[i].Logs {
+			removedLog := *l
+			removedLog.Removed = true
+			removed = append(removed, &removedLog)
+		}
+	}
+	return recent[:n], removed, nil
+}
+
+// appendSent - remembers sent blocks from..last and their logs, only blocks of last logsReorgDepth blocks are kept
+func appendSent(tx kv.Tx, recent []rpcfilters.SentBlock, from, last, head uint64, logs []*types.Log) ([]rpcfilters.SentBlock, error) {
+	if head >= logsReorgDepth && from <= head-logsReorgDepth {
+		from = head - logsReorgDepth + 1
+	}
+	if len(recent) > 0 && recent[len(recent)-1].Number+1 != from {
+		recent = nil // not contiguous: blocks before from were far from head
+	}
+	for n := from; n <= last; n++ {
+		hash, err := rawdb.ReadCanonicalHash(tx, n)
+		if err != nil {
+			return nil, err
+		}
+		recent = append(recent, rpcfilters.SentBlock{Number: n, Hash: hash})
+	}
+	for _, l := range logs {
+		if len(recent) > 0 && l.BlockNumber >= recent[0].Number {
+			if l.Topics == nil { // filters store sent blocks as JSON, null topics are not decoded
+				withTopics := *l
+				withTopics.Topics = []common.Hash{}
+				l = &withTopics
+			}
+			i := l.BlockNumber - recent[0].Number
+			recent[i].Logs = append(recent[i].Logs, l)
+		}
+	}
+	if len(recent) > logsReorgDepth {
+		recent = recent[len(recent)-logsReorgDepth:]
+	}
+	return recent, nil
+}
@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/rpcdaemontest"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/filters"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogsSubscriptionReplay(t *testing.T) {
+	m, chain, _ := rpcdaemontest.CreateTestSentry(t)
+	api := NewEthAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil, nil, nil, 5000000)
+	expected, err := api.GetLogs(context.Background(), filters.FilterCriteria{})
+	require.NoError(t, err)
+	require.NotEmpty(t, expected)
+
+	s := &logsSubscription{api: api}
+	var sent []*types.Log
+	for {
+		removed, logs, caughtUp, err := s.read()
+		require.NoError(t, err)
+		require.Empty(t, removed)
+		sent = append(sent, logs...)
+		if caughtUp {
+			break
+		}
+	}
+	require.Equal(t, len(expected), len(sent))
+	for i := range expected {
+		require.Equal(t, *expected[i], *sent[i])
+	}
+	require.Equal(t, chain.TopBlock.NumberU64()+1, s.next)
+	require.Len(t, s.recent, int(chain.TopBlock.NumberU64())+1)
+
+	// nothing new
+	removed, logs, caughtUp, err := s.read()
+	require.NoError(t, err)
+	require.True(t, caughtUp)
+	require.Empty(t, removed)
+	require.Empty(t, logs)
+
+	// sent blocks from 7 were not canonical: their logs are removed, starting from the top, logs from block 7 are sent again
+	for i := 7; i < len(s.recent); i++ {
+		s.recent[i].Hash = common.Hash{1}
+	}
+	s.recent[7].Logs = []*types.Log{{BlockNumber: 7, BlockHash: common.Hash{1}}}
+	removed, logs, caughtUp, err = s.read()
+	require.NoError(t, err)
+	require.True(t, caughtUp)
+	require.Equal(t, []*types.Log{{BlockNumber: 7, BlockHash: common.Hash{1}, Removed: true}}, removed[len(removed)-1:])
+	var resent []*types.Log
+	for _, l := range expected {
+		if l.BlockNumber >= 7 {
+			resent = append(resent, l)
+		}
+	}
+	require.Equal(t, len(resent), len(logs))
+	require.Equal(t, chain.TopBlock.NumberU64()+1, s.next)
+}
@@ -1,7 +1,6 @@
 package commands
 
 import (
-	"bytes"
 	"context"
 	"encoding/binary"
 	"fmt"
@@ -13,7 +12,6 @@ import (
 	"github.com/RoaringBitmap/roaring"
 	libcommon "github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon/common"
-	"github.com/ledgerwatch/erigon/common/dbutils"
 	"github.com/ledgerwatch/erigon/common/hexutil"
 	"github.com/ledgerwatch/erigon/consensus/ethash"
 	"github.com/ledgerwatch/erigon/core"
@@ -24,13 +22,12 @@ import (
 	"github.com/ledgerwatch/erigon/eth/filters"
 	"github.com/ledgerwatch/erigon/ethdb"
 	"github.com/ledgerwatch/erigon/ethdb/bitmapdb"
-	"github.com/ledgerwatch/erigon/ethdb/cbor"
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/transactions"
 )
 
-func getReceipts(ctx context.Context, tx kv.Tx, chainConfig *params.ChainConfig, block *types.Block, senders []common.Address) (types.Receipts, error) {
+func getReceipts(ctx context.Context, tx kv.Tx, history state.HistorySnapshots, chainConfig *params.ChainConfig, block *types.Block, senders []common.Address) (types.Receipts, error) {
 	if cached := rawdb.ReadReceipts(tx, block, senders); cached != nil {
 		return cached, nil
 	}
@@ -39,7 +36,7 @@ func getReceipts(ctx context.Context, tx kv.Tx, chainConfig *params.ChainConfig,
 		return rawdb.ReadHeader(tx, hash, number)
 	}
 	contractHasTEVM := ethdb.GetHasTEVM(tx)
-	_, _, _, ibs, _, err := transactions.ComputeTxEnv(ctx, block, chainConfig, getHeader, contractHasTEVM, ethash.NewFaker(), tx, block.Hash(), 0)
+	_, _, _, ibs, _, err := transactions.ComputeTxEnv(ctx, block, chainConfig, getHeader, contractHasTEVM, ethash.NewFaker(), tx, history, block.Hash(), 0)
 	if err != nil {
 		return nil, err
 	}
@@ -111,12 +108,20 @@ func (api *APIImpl) GetLogs(ctx context.Context, crit filters.FilterCriteria) ([
 		return nil, fmt.Errorf("end (%d) < begin (%d)", end, begin)
 	}
 
+	logs, _, err := api.getLogsInRange(ctx, tx, crit, begin, end, 0)
+	return returnLogs(logs), err
+}
+
+// getLogsInRange - logs of blocks [begin, end] which match crit.Addresses and crit.Topics. If maxLogs > 0, stops after
+// the block where amount of logs reached maxLogs. Returns the last block which was processed.
+func (api *APIImpl) getLogsInRange(ctx context.Context, tx kv.Tx, crit filters.FilterCriteria, begin, end uint64, maxLogs int) ([]*types.Log, uint64, error) {
+	var logs []*types.Log //nolint:prealloc
 	blockNumbers := roaring.New()
 	blockNumbers.AddRange(begin, end+1) // [min,max)
 
 	topicsBitmap, err := getTopicsBitmap(tx, crit.Topics, uint32(begin), uint32(end))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if topicsBitmap != nil {
 		if blockNumbers == nil {
@@ -130,7 +135,7 @@ func (api *APIImpl) GetLogs(ctx context.Context, crit filters.FilterCriteria) ([
 	for _, addr := range crit.Addresses {
 		m, err := bitmapdb.Get(tx, kv.LogAddressIndex, addr[:], uint32(begin), uint32(end))
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if addrBitmap == nil {
 			addrBitmap = m
@@ -148,21 +153,21 @@ func (api *APIImpl) GetLogs(ctx context.Context, crit filters.FilterCriteria) ([
 	}
 
 	if blockNumbers.GetCardinality() == 0 {
-		return returnLogs(logs), nil
+		return logs, end, nil
 	}
 
 	iter := blockNumbers.Iterator()
 	for iter.HasNext() {
 		if err = libcommon.Stopped(ctx.Done()); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		blockNToMatch := uint64(iter.Next())
 		var logIndex uint
 		var blockLogs types.Logs
-		if err := tx.ForPrefix(kv.Log, dbutils.EncodeBlockNumber(blockNToMatch), func(k, v []byte) error {
-			var logs types.Logs
-			if err := cbor.Unmarshal(&logs, bytes.NewReader(v)); err != nil {
+		if err := rawdb.ForEachLog(tx, blockNToMatch, func(k, v []byte) error {
+			logs, err := rawdb.UnmarshalLogs(tx, v)
+			if err != nil {
 				return fmt.Errorf("receipt unmarshal failed:  %w", err)
 			}
 			for _, log := range logs {
@@ -179,16 +184,16 @@ func (api *APIImpl) GetLogs(ctx context.Context, crit filters.FilterCriteria) ([
 			}
 			return nil
 		}); err != nil {
-			return returnLogs(logs), err
+			return logs, 0, err
 		}
 
 		if len(blockLogs) > 0 {
 			b, err := api.blockByNumberWithSenders(tx, blockNToMatch)
 			if err != nil {
-				return nil, err
+				return nil, 0, err
 			}
 			if b == nil {
-				return nil, fmt.Errorf("block not found %d", blockNToMatch)
+				return nil, 0, fmt.Errorf("block not found %d", blockNToMatch)
 			}
 			blockHash := b.Hash()
 			for _, log := range blockLogs {
@@ -198,8 +203,11 @@ func (api *APIImpl) GetLogs(ctx context.Context, crit filters.FilterCriteria) ([
 			}
 			logs = append(logs, blockLogs...)
 		}
+		if maxLogs > 0 && len(logs) >= maxLogs {
+			return logs, blockNToMatch, nil
+		}
 	}
-	return returnLogs(logs), nil
+	return logs, end, nil
 }
 
 // The Topic list restricts matches to particular event topics. Each event has a list
@@ -248,7 +256,7 @@ func (api *APIImpl) GetTransactionReceipt(ctx context.Context, hash common.Hash)
 	}
 	defer tx.Rollback()
 
-	blockNumber, err := rawdb.ReadTxLookupEntry(tx, hash)
+	blockNumber, err := rawdb.ReadTxLookupEntry(ctx, tx, api._blockReader, hash)
 	if err != nil {
 		return nil, err
 	}
@@ -281,7 +289,7 @@ func (api *APIImpl) GetTransactionReceipt(ctx context.Context, hash common.Hash)
 	if err != nil {
 		return nil, err
 	}
-	receipts, err := getReceipts(ctx, tx, cc, block, block.Body().SendersFromTxs())
+	receipts, err := getReceipts(ctx, tx, api.historySnapshots, cc, block, block.Body().SendersFromTxs())
 	if err != nil {
 		return nil, fmt.Errorf("getReceipts error: %w", err)
 	}
@@ -314,7 +322,7 @@ func (api *APIImpl) GetBlockReceipts(ctx context.Context, number rpc.BlockNumber
 	if err != nil {
 		return nil, err
 	}
-	receipts, err := getReceipts(ctx, tx, chainConfig, block, block.Body().SendersFromTxs())
+	receipts, err := getReceipts(ctx, tx, api.historySnapshots, chainConfig, block, block.Body().SendersFromTxs())
 	if err != nil {
 		return nil, fmt.Errorf("getReceipts error: %w", err)
 	}
@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"context"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common/debug"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	syncingPollInterval         = time.Second
+	defaultSyncingProgressDelta = 1_000
+)
+
+// SyncingAPI - eth_subscribe("syncing"). It's separated from APIImpl, because service can't have call and subscription
+// with same name (eth_syncing)
+type SyncingAPI struct {
+	db kv.RoDB
+}
+
+func NewSyncingAPI(db kv.RoDB) *SyncingAPI {
+	return &SyncingAPI{db: db}
+}
+
+// SyncingStatus - notification of "syncing" subscription
+type SyncingStatus struct {
+	Syncing bool          `json:"syncing"`
+	Status  *syncProgress `json:"status,omitempty"`
+}
+
+// Syncing - notifies when sync starts and stops, when sync moves to next stage, and when progress of any stage grows by
+// progressDelta blocks (default 1000)
+func (api *SyncingAPI) Syncing(ctx context.Context, progressDelta *hexutil.Uint64) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	delta := hexutil.Uint64(defaultSyncingProgressDelta)
+	if progressDelta != nil {
+		delta = *progressDelta
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		defer debug.LogPanic()
+		ticker := time.NewTicker(syncingPollInterval)
+		defer ticker.Stop()
+
+		var notified *syncProgress
+		for {
+			progress, err := api.readProgress()
+			if err != nil {
+				log.Warn("[rpc] syncing subscription", "err", err)
+			} else if shouldNotifySyncing(notified, progress, delta) {
+				status := SyncingStatus{Syncing: progress.syncing()}
+				if status.Syncing {
+					status.Status = progress
+				}
+				if err := notifier.Notify(rpcSub.ID, status); err != nil {
+					log.Warn("error while notifying subscription", "err", err)
+				}
+				notified = progress
+			}
+			select {
+			case <-ticker.C:
+			case <-rpcSub.Err():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+func (api *SyncingAPI) readProgress() (*syncProgress, error) {
+	tx, err := api.db.BeginRo(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	return readSyncProgress(tx)
+}
+
+// shouldNotifySyncing - compares progress with last notified one
+func shouldNotifySyncing(notified, progress *syncProgress, delta hexutil.Uint64) bool {
+	if notified == nil || notified.syncing() != progress.syncing() {
+		return true
+	}
+	if !progress.syncing() {
+		return false
+	}
+	if notified.Stage != progress.Stage {
+		return true
+	}
+	for i := range progress.Stages {
+		if progress.Stages[i].BlockNumber < notified.Stages[i].BlockNumber || // unwind
+			progress.Stages[i].BlockNumber-notified.Stages[i].BlockNumber >= delta {
+			return true
+		}
+	}
+	return false
+}
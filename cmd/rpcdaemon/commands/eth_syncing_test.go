@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+func saveStagesProgress(t *testing.T, db kv.RwDB, progress map[stages.SyncStage]uint64) {
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		for stage, p := range progress {
+			if err := stages.SaveStageProgress(tx, stage, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func TestSyncingSubscription(t *testing.T) {
+	require := require.New(t)
+	db := memdb.New()
+	defer db.Close()
+	saveStagesProgress(t, db, map[stages.SyncStage]uint64{stages.Headers: 100, stages.Bodies: 100, stages.Senders: 50})
+
+	server := rpc.NewServer(1)
+	defer server.Stop()
+	require.NoError(server.RegisterName("eth", NewSyncingAPI(db)))
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	ch := make(chan SyncingStatus)
+	delta := hexutil.Uint64(10)
+	sub, err := client.Subscribe(context.Background(), "eth", ch, "syncing", &delta)
+	require.NoError(err)
+	defer sub.Unsubscribe()
+	next := func() SyncingStatus {
+		select {
+		case status := <-ch:
+			return status
+		case err := <-sub.Err():
+			t.Fatal(err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("timeout")
+		}
+		return SyncingStatus{}
+	}
+
+	status := next()
+	require.True(status.Syncing)
+	require.Equal(string(stages.Senders), status.Status.Stage)
+	require.Equal(hexutil.Uint64(100), status.Status.HighestBlock)
+
+	// progress below delta is not notified
+	saveStagesProgress(t, db, map[stages.SyncStage]uint64{stages.Senders: 55})
+	time.Sleep(2 * syncingPollInterval)
+	saveStagesProgress(t, db, map[stages.SyncStage]uint64{stages.Senders: 100})
+	status = next()
+	require.Equal(string(stages.Execution), status.Status.Stage)
+	require.Equal(hexutil.Uint64(100), status.Status.Stages[3].BlockNumber)
+
+	synced := map[stages.SyncStage]uint64{}
+	for _, stage := range stages.AllStages {
+		synced[stage] = 100
+	}
+	saveStagesProgress(t, db, synced)
+	status = next()
+	require.False(status.Syncing)
+	require.Nil(status.Status)
+}
+
+func TestSyncProgressStage(t *testing.T) {
+	db := memdb.New()
+	defer db.Close()
+	saveStagesProgress(t, db, map[stages.SyncStage]uint64{
+		stages.Headers: 100, stages.Bodies: 100, stages.Senders: 100, stages.Execution: 100,
+		// Translation is disabled
+		stages.HashState: 50, stages.IntermediateHashes: 50,
+	})
+	require.NoError(t, db.View(context.Background(), func(tx kv.Tx) error {
+		progress, err := readSyncProgress(tx)
+		require.NoError(t, err)
+		require.Equal(t, string(stages.HashState), progress.Stage)
+		return nil
+	}))
+}
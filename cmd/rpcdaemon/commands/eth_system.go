@@ -9,8 +9,6 @@ import (
 	"github.com/ledgerwatch/erigon/common/hexutil"
 	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/types"
-	"github.com/ledgerwatch/erigon/eth/ethconfig"
-	"github.com/ledgerwatch/erigon/eth/gasprice"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rpc"
@@ -37,40 +35,66 @@ func (api *APIImpl) Syncing(ctx context.Context) (interface{}, error) {
 		return nil, err
 	}
 	defer tx.Rollback()
-	highestBlock, err := stages.GetStageProgress(tx, stages.Headers)
-	if err != nil {
-		return false, err
-	}
-
-	currentBlock, err := stages.GetStageProgress(tx, stages.Finish)
+	progress, err := readSyncProgress(tx)
 	if err != nil {
 		return false, err
 	}
-
-	if currentBlock > 0 && currentBlock >= highestBlock { // Return not syncing if the synchronisation already completed
+	if !progress.syncing() { // Return not syncing if the synchronisation already completed
 		return false, nil
 	}
 
-	// Otherwise gather the block sync stats
-	type S struct {
-		StageName   string         `json:"stage_name"`
-		BlockNumber hexutil.Uint64 `json:"block_number"`
+	return map[string]interface{}{
+		"currentBlock": progress.CurrentBlock,
+		"highestBlock": progress.HighestBlock,
+		"stages":       progress.Stages,
+	}, nil
+}
+
+type stageProgress struct {
+	StageName   string         `json:"stage_name"`
+	BlockNumber hexutil.Uint64 `json:"block_number"`
+}
+
+type syncProgress struct {
+	CurrentBlock hexutil.Uint64  `json:"currentBlock"`
+	HighestBlock hexutil.Uint64  `json:"highestBlock"`
+	Stage        string          `json:"stage"` // first stage which is behind highestBlock - usually it's running stage
+	Stages       []stageProgress `json:"stages"`
+}
+
+func (p *syncProgress) syncing() bool {
+	return p.CurrentBlock == 0 || p.CurrentBlock < p.HighestBlock
+}
+
+func readSyncProgress(tx kv.Tx) (*syncProgress, error) {
+	highestBlock, err := stages.GetStageProgress(tx, stages.Headers)
+	if err != nil {
+		return nil, err
+	}
+	currentBlock, err := stages.GetStageProgress(tx, stages.Finish)
+	if err != nil {
+		return nil, err
 	}
-	stagesMap := make([]S, len(stages.AllStages))
+	p := &syncProgress{CurrentBlock: hexutil.Uint64(currentBlock), HighestBlock: hexutil.Uint64(highestBlock), Stages: make([]stageProgress, len(stages.AllStages))}
 	for i, stage := range stages.AllStages {
 		progress, err := stages.GetStageProgress(tx, stage)
 		if err != nil {
 			return nil, err
 		}
-		stagesMap[i].StageName = string(stage)
-		stagesMap[i].BlockNumber = hexutil.Uint64(progress)
+		p.Stages[i].StageName = string(stage)
+		p.Stages[i].BlockNumber = hexutil.Uint64(progress)
+	}
+	// skip disabled stages: they are behind next stages
+	var ahead hexutil.Uint64
+	for i := len(p.Stages) - 1; i >= 0; i-- {
+		if p.Stages[i].BlockNumber < p.HighestBlock && p.Stages[i].BlockNumber >= ahead {
+			p.Stage = p.Stages[i].StageName
+		}
+		if p.Stages[i].BlockNumber > ahead {
+			ahead = p.Stages[i].BlockNumber
+		}
 	}
-
-	return map[string]interface{}{
-		"currentBlock": hexutil.Uint64(currentBlock),
-		"highestBlock": hexutil.Uint64(highestBlock),
-		"stages":       stagesMap,
-	}, nil
+	return p, nil
 }
 
 // ChainId implements eth_chainId. Returns the current ethereum chainId.
@@ -113,7 +137,7 @@ func (api *APIImpl) GasPrice(ctx context.Context) (*hexutil.Big, error) {
 	if err != nil {
 		return nil, err
 	}
-	oracle := gasprice.NewOracle(NewGasPriceOracleBackend(tx, cc, api.BaseAPI), ethconfig.Defaults.GPO)
+	oracle := api.gasPriceOracle(tx, cc)
 	tipcap, err := oracle.SuggestTipCap(ctx)
 	if err != nil {
 		return nil, err
@@ -135,7 +159,7 @@ func (api *APIImpl) MaxPriorityFeePerGas(ctx context.Context) (*hexutil.Big, err
 	if err != nil {
 		return nil, err
 	}
-	oracle := gasprice.NewOracle(NewGasPriceOracleBackend(tx, cc, api.BaseAPI), ethconfig.Defaults.GPO)
+	oracle := api.gasPriceOracle(tx, cc)
 	tipcap, err := oracle.SuggestTipCap(ctx)
 	if err != nil {
 		return nil, err
@@ -160,7 +184,7 @@ func (api *APIImpl) FeeHistory(ctx context.Context, blockCount rpc.DecimalOrHex,
 	if err != nil {
 		return nil, err
 	}
-	oracle := gasprice.NewOracle(NewGasPriceOracleBackend(tx, cc, api.BaseAPI), ethconfig.Defaults.GPO)
+	oracle := api.gasPriceOracle(tx, cc)
 
 	oldest, reward, baseFee, gasUsed, err := oracle.FeeHistory(ctx, int(blockCount), lastBlock, rewardPercentiles)
 	if err != nil {
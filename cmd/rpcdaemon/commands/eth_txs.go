@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"math/big"
 
 	"github.com/ledgerwatch/erigon-lib/gointerfaces"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
@@ -26,27 +25,17 @@ func (api *APIImpl) GetTransactionByHash(ctx context.Context, hash common.Hash)
 	defer tx.Rollback()
 
 	// https://infura.io/docs/ethereum/json-rpc/eth-getTransactionByHash
-	txn, blockHash, blockNumber, txIndex, err := rawdb.ReadTransaction(tx, hash)
+	txn, block, txIndex, err := api.txnLookup(ctx, tx, hash)
 	if err != nil {
 		return nil, err
 	}
-
-	// Add GasPrice for the DynamicFeeTransaction
-	var baseFee *big.Int
 	chainConfig, err := api.chainConfig(tx)
 	if err != nil {
 		return nil, err
 	}
-	if chainConfig.IsLondon(blockNumber) && blockHash != (common.Hash{}) {
-		block, err := api.blockByHashWithSenders(tx, blockHash)
-		if err != nil {
-			return nil, err
-		}
-		baseFee = block.BaseFee()
-	}
-
 	if txn != nil {
-		return newRPCTransaction(txn, blockHash, blockNumber, txIndex, baseFee), nil
+		// Add GasPrice for the DynamicFeeTransaction
+		return newRPCTransaction(txn, block.Hash(), block.NumberU64(), txIndex, block.BaseFee()), nil
 	}
 
 	curHeader := rawdb.ReadCurrentHeader(tx)
@@ -81,7 +70,7 @@ func (api *APIImpl) GetRawTransactionByHash(ctx context.Context, hash common.Has
 	defer tx.Rollback()
 
 	// https://infura.io/docs/ethereum/json-rpc/eth-getTransactionByHash
-	txn, _, _, _, err := rawdb.ReadTransaction(tx, hash)
+	txn, _, _, err := api.txnLookup(ctx, tx, hash)
 	if err != nil {
 		return nil, err
 	}
@@ -24,24 +24,29 @@ func (api *APIImpl) GetUncleByBlockNumberAndIndex(ctx context.Context, number rp
 	if err != nil {
 		return nil, err
 	}
-	block, err := api.blockByNumberWithSenders(tx, blockNum)
+	hash, err := rawdb.ReadCanonicalHash(tx, blockNum)
 	if err != nil {
 		return nil, err
 	}
-	if block == nil {
+	if hash == (common.Hash{}) {
+		return nil, nil // not error, see https://github.com/ledgerwatch/erigon/issues/1645
+	}
+	uncles, found, err := api.uncles(ctx, tx, hash, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
 		return nil, nil // not error, see https://github.com/ledgerwatch/erigon/issues/1645
 	}
-	hash := block.Hash()
 	additionalFields := make(map[string]interface{})
-	td, err := rawdb.ReadTd(tx, block.Hash(), blockNum)
+	td, err := rawdb.ReadTd(tx, hash, blockNum)
 	if err != nil {
 		return nil, err
 	}
 	additionalFields["totalDifficulty"] = (*hexutil.Big)(td)
 
-	uncles := block.Uncles()
 	if index >= hexutil.Uint(len(uncles)) {
-		log.Trace("Requested uncle not found", "number", block.Number(), "hash", hash, "index", index)
+		log.Trace("Requested uncle not found", "number", blockNum, "hash", hash, "index", index)
 		return nil, nil
 	}
 	uncle := types.NewBlockWithHeader(uncles[index])
@@ -56,24 +61,26 @@ func (api *APIImpl) GetUncleByBlockHashAndIndex(ctx context.Context, hash common
 	}
 	defer tx.Rollback()
 
-	block, err := api.blockByHashWithSenders(tx, hash)
+	number := rawdb.ReadHeaderNumber(tx, hash)
+	if number == nil {
+		return nil, nil // not error, see https://github.com/ledgerwatch/erigon/issues/1645
+	}
+	uncles, found, err := api.uncles(ctx, tx, hash, *number)
 	if err != nil {
 		return nil, err
 	}
-	if block == nil {
+	if !found {
 		return nil, nil // not error, see https://github.com/ledgerwatch/erigon/issues/1645
 	}
-	number := block.NumberU64()
 	additionalFields := make(map[string]interface{})
-	td, err := rawdb.ReadTd(tx, hash, number)
+	td, err := rawdb.ReadTd(tx, hash, *number)
 	if err != nil {
 		return nil, err
 	}
 	additionalFields["totalDifficulty"] = (*hexutil.Big)(td)
 
-	uncles := block.Uncles()
 	if index >= hexutil.Uint(len(uncles)) {
-		log.Trace("Requested uncle not found", "number", block.Number(), "hash", hash, "index", index)
+		log.Trace("Requested uncle not found", "number", *number, "hash", hash, "index", index)
 		return nil, nil
 	}
 	uncle := types.NewBlockWithHeader(uncles[index])
@@ -95,15 +102,22 @@ func (api *APIImpl) GetUncleCountByBlockNumber(ctx context.Context, number rpc.B
 	if err != nil {
 		return &n, err
 	}
+	hash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	if hash == (common.Hash{}) {
+		return nil, nil // not error, see https://github.com/ledgerwatch/erigon/issues/1645
+	}
 
-	block, err := api.blockByNumberWithSenders(tx, blockNum)
+	uncles, found, err := api.uncles(ctx, tx, hash, blockNum)
 	if err != nil {
 		return nil, err
 	}
-	if block == nil {
+	if !found {
 		return nil, nil // not error, see https://github.com/ledgerwatch/erigon/issues/1645
 	}
-	n = hexutil.Uint(len(block.Uncles()))
+	n = hexutil.Uint(len(uncles))
 	return &n, nil
 }
 
@@ -121,13 +135,13 @@ func (api *APIImpl) GetUncleCountByBlockHash(ctx context.Context, hash common.Ha
 		return nil, nil // not error, see https://github.com/ledgerwatch/erigon/issues/1645
 	}
 
-	block, err := api.blockWithSenders(tx, hash, *number)
+	uncles, found, err := api.uncles(ctx, tx, hash, *number)
 	if err != nil {
 		return nil, err
 	}
-	if block == nil {
+	if !found {
 		return nil, nil // not error, see https://github.com/ledgerwatch/erigon/issues/1645
 	}
-	n = hexutil.Uint(len(block.Uncles()))
+	n = hexutil.Uint(len(uncles))
 	return &n, nil
 }
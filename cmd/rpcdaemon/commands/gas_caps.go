@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/authtoken"
+)
+
+// Gas caps limit gas of calls which rpcdaemon executes for clients: eth_call, eth_estimateGas,
+// eth_createAccessList, debug_traceCall, trace_call and trace_callMany. They don't depend on block gas limit:
+// analytic calls may legitimately need more gas than a block has.
+//
+//	--rpc.gascap       - gas of one call
+//	--rpc.batch.gascap - total gas of calls in one batch request
+//	--rpc.authtoken    - HTTP requests with header "Authorization: Bearer <token>" aren't capped
+const (
+	callGasCapFlag  = "rpc.gascap"
+	batchGasCapFlag = "rpc.batch.gascap"
+)
+
+// GasCaps - caps applied to request, see erigon_gasCaps. 0 means unlimited.
+type GasCaps struct {
+	Call      hexutil.Uint64 `json:"call"`
+	Batch     hexutil.Uint64 `json:"batch"`
+	Unlimited bool           `json:"unlimited"` // request is authenticated, caps are not applied
+}
+
+type gasCapsConfig struct {
+	call      uint64
+	batch     uint64
+	authToken string
+}
+
+// SetGasCaps - call is used only to report caps, APIs keep own copy of it
+func (api *BaseAPI) SetGasCaps(call, batch uint64, authToken string) {
+	api.gasCaps = gasCapsConfig{call: call, batch: batch, authToken: authToken}
+}
+
+// gasCapsOf - caps which apply to request of ctx
+func (api *BaseAPI) gasCapsOf(ctx context.Context) *GasCaps {
+	if api.gasUnlimited(ctx) {
+		return &GasCaps{Unlimited: true}
+	}
+	return &GasCaps{Call: hexutil.Uint64(api.gasCaps.call), Batch: hexutil.Uint64(api.gasCaps.batch)}
+}
+
+func (api *BaseAPI) gasUnlimited(ctx context.Context) bool {
+	return authtoken.Matches(authtoken.FromContext(ctx), api.gasCaps.authToken)
+}
+
+// batchGasBudget - remaining gas of batch request, shared by its concurrent calls
+type batchGasBudget struct {
+	remaining uint64 // atomic
+}
+
+func (b *batchGasBudget) take(gas uint64) uint64 {
+	for {
+		remaining := atomic.LoadUint64(&b.remaining)
+		taken := gas
+		if taken > remaining {
+			taken = remaining
+		}
+		if atomic.CompareAndSwapUint64(&b.remaining, remaining, remaining-taken) {
+			return taken
+		}
+	}
+}
+
+// gasAllowance - gas granted to one call
+type gasAllowance struct {
+	gas    uint64
+	capBy  string          // flag which limited gas of call, empty if call got requested gas
+	budget *batchGasBudget // nil if batch isn't capped
+}
+
+// allowGas - requested is gas field of call, 0 if it's not set: such calls get callCap (also authenticated ones).
+// Batch budget is charged by allowance, release returns unused gas.
+func (api *BaseAPI) allowGas(ctx context.Context, callCap uint64, requested uint64) (*gasAllowance, error) {
+	if callCap == 0 {
+		callCap = math.MaxUint64 / 2
+	}
+	a := &gasAllowance{gas: requested}
+	unlimited := api.gasUnlimited(ctx)
+	if requested == 0 || (requested > callCap && !unlimited) {
+		a.gas, a.capBy = callCap, callGasCapFlag
+	}
+	if unlimited || api.gasCaps.batch == 0 {
+		return a, nil
+	}
+	batch, ok := rpc.BatchFromContext(ctx)
+	if !ok {
+		return a, nil
+	}
+	budget, _ := batch.LoadOrStore(batchGasCapFlag, &batchGasBudget{remaining: api.gasCaps.batch})
+	a.budget = budget.(*batchGasBudget)
+	taken := a.budget.take(a.gas)
+	if taken == 0 {
+		return nil, fmt.Errorf("gas of batch request exhausted, it's capped at %d by --%s", api.gasCaps.batch, batchGasCapFlag)
+	}
+	if taken < a.gas {
+		a.gas, a.capBy = taken, batchGasCapFlag
+	}
+	return a, nil
+}
+
+func (a *gasAllowance) release(used uint64) {
+	if a.budget != nil && used < a.gas {
+		atomic.AddUint64(&a.budget.remaining, a.gas-used)
+	}
+}
+
+// capError - tells client that out of gas is caused by cap of server, not by gas of call
+func (a *gasAllowance) capError(err error) error {
+	if a.capBy == "" || !errors.Is(err, vm.ErrOutOfGas) {
+		return err
+	}
+	return fmt.Errorf("%w: gas capped at %d by --%s", err, a.gas, a.capBy)
+}
+
+func requestedGas(gas *hexutil.Uint64) uint64 {
+	if gas == nil {
+		return 0
+	}
+	return uint64(*gas)
+}
@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/stretchr/testify/require"
+)
+
+type gasCapsTestService struct{ api *BaseAPI }
+
+func (s *gasCapsTestService) Allow(ctx context.Context, requested hexutil.Uint64) (hexutil.Uint64, error) {
+	a, err := s.api.allowGas(ctx, 100, uint64(requested))
+	if err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(a.gas), nil
+}
+
+func TestAllowGas(t *testing.T) {
+	base := NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false)
+	base.SetGasCaps(100, 150, "secret")
+	ctx := context.Background()
+
+	a, err := base.allowGas(ctx, 100, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), a.gas)
+	require.EqualError(t, a.capError(vm.ErrOutOfGas), "out of gas: gas capped at 100 by --rpc.gascap")
+	a, err = base.allowGas(ctx, 100, 50)
+	require.NoError(t, err)
+	require.Equal(t, uint64(50), a.gas)
+	require.Equal(t, vm.ErrOutOfGas, a.capError(vm.ErrOutOfGas))
+	a, err = base.allowGas(ctx, 100, 200)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), a.gas)
+
+	authCtx := context.WithValue(ctx, "Authorization", "Bearer secret") //nolint:staticcheck
+	a, err = base.allowGas(authCtx, 100, 200)
+	require.NoError(t, err)
+	require.Equal(t, uint64(200), a.gas)
+	require.Equal(t, &GasCaps{Unlimited: true}, base.gasCapsOf(authCtx))
+	wrongCtx := context.WithValue(ctx, "Authorization", "Bearer wrong") //nolint:staticcheck
+	a, err = base.allowGas(wrongCtx, 100, 200)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), a.gas)
+	require.Equal(t, &GasCaps{Call: 100, Batch: 150}, base.gasCapsOf(wrongCtx))
+}
+
+func TestBatchGasCap(t *testing.T) {
+	base := NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false)
+	base.SetGasCaps(100, 150, "")
+	server := rpc.NewServer(2)
+	defer server.Stop()
+	require.NoError(t, server.RegisterName("test", &gasCapsTestService{api: base}))
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	batch := make([]rpc.BatchElem, 3)
+	for i := range batch {
+		batch[i] = rpc.BatchElem{Method: "test_allow", Args: []interface{}{hexutil.Uint64(100)}, Result: new(hexutil.Uint64)}
+	}
+	require.NoError(t, client.BatchCall(batch))
+	var allowed []uint64
+	var errs []string
+	for _, elem := range batch {
+		if elem.Error != nil {
+			errs = append(errs, elem.Error.Error())
+			continue
+		}
+		allowed = append(allowed, uint64(*elem.Result.(*hexutil.Uint64)))
+	}
+	sort.Slice(allowed, func(i, j int) bool { return allowed[i] < allowed[j] })
+	require.Equal(t, []uint64{50, 100}, allowed)
+	require.Equal(t, []string{"gas of batch request exhausted, it's capped at 150 by --rpc.batch.gascap"}, errs)
+
+	// batch cap doesn't apply to single requests
+	var gas hexutil.Uint64
+	for i := 0; i < 3; i++ {
+		require.NoError(t, client.Call(&gas, "test_allow", hexutil.Uint64(100)))
+		require.Equal(t, hexutil.Uint64(100), gas)
+	}
+}
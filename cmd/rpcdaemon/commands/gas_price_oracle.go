@@ -0,0 +1,18 @@
+package commands
+
+import (
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/eth/gasprice"
+	"github.com/ledgerwatch/erigon/params"
+)
+
+// SetGasPriceOracle - config of oracle behind eth_gasPrice/eth_maxPriorityFeePerGas (--gpo.* flags). Samples of blocks
+// are kept between requests: on new head oracle reads only new blocks.
+func (api *BaseAPI) SetGasPriceOracle(cfg gasprice.Config) {
+	api.gpo = cfg
+	api.gpoCache = gasprice.NewCache()
+}
+
+func (api *BaseAPI) gasPriceOracle(tx kv.Tx, cc *params.ChainConfig) *gasprice.Oracle {
+	return gasprice.NewOracleWithCache(NewGasPriceOracleBackend(tx, cc, api), api.gpo, api.gpoCache)
+}
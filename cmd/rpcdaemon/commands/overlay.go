@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus/ethash"
+	"github.com/ledgerwatch/erigon/consensus/serenity"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb"
+	"github.com/ledgerwatch/erigon/ethdb/olddb"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/reexec"
+)
+
+// invalidBlockError - block is rejected by execution
+type invalidBlockError struct{ err error }
+
+func (e invalidBlockError) Error() string { return e.err.Error() }
+func (e invalidBlockError) Unwrap() error { return e.err }
+
+// executeOnOverlay - executes block which follows the latest executed block in an in-memory overlay of tx
+// (olddb.NewMemoryBatch): the DB is not written, the overlay has PlainState after the block. Execution checks gas used,
+// receipts root and bloom of the header, unless vmConfig.NoReceipts; state root is not checked. Returns nil overlay if
+// parent of the block is not the latest executed block, invalidBlockError if execution rejects the block (see
+// core.IsBlockValidationError), other errors of execution - DB reads, cancellation - as they are. Caller rolls the
+// overlay back.
+func (api *BaseAPI) executeOnOverlay(tx kv.Tx, chainConfig *params.ChainConfig, block *types.Block, vmConfig vm.Config) (kv.RwTx, error) {
+	head, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return nil, err
+	}
+	headHash, err := rawdb.ReadCanonicalHash(tx, head)
+	if err != nil {
+		return nil, err
+	}
+	if block.NumberU64() != head+1 || block.ParentHash() != headHash {
+		return nil, nil
+	}
+
+	overlay := olddb.NewMemoryBatch(tx)
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		return rawdb.ReadHeader(overlay, hash, number)
+	}
+	contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
+	if api.TevmEnabled {
+		contractHasTEVM = ethdb.GetHasTEVM(overlay)
+	}
+	engine := serenity.New(ethash.NewFaker()) // rewards of PoW blocks, none after the merge
+	chain := stagedsync.ChainReader{Cfg: *chainConfig, Db: overlay}
+	if _, err = core.ExecuteBlockEphemerally(chainConfig, &vmConfig, getHeader, engine, block, state.NewPlainStateReader(overlay), state.NewPlainStateWriterNoHistory(overlay), reexec.NewEpochReader(overlay), chain, contractHasTEVM); err != nil {
+		overlay.Rollback()
+		if core.IsBlockValidationError(err) {
+			return nil, invalidBlockError{err}
+		}
+		return nil, err
+	}
+	return overlay, nil
+}
+
+// pendingOverlay - overlay with state after the pending block, nil if there is no pending block or it doesn't follow
+// the latest executed block (pending state is the latest one then)
+func (api *BaseAPI) pendingOverlay(tx kv.Tx, chainConfig *params.ChainConfig) (kv.RwTx, *types.Block, error) {
+	pending := api.filters.LastPendingBlock()
+	if pending == nil {
+		return nil, nil, nil
+	}
+	// header of the pending block isn't sealed, receipts root and bloom may be not set yet
+	overlay, err := api.executeOnOverlay(tx, chainConfig, pending, vm.Config{NoReceipts: true})
+	if err != nil || overlay == nil {
+		return nil, nil, err
+	}
+	return overlay, pending, nil
+}
@@ -0,0 +1,195 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	types2 "github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/filters"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/services"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/consensus/serenity"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/internal/ethapi"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+// selfBalanceContract - returns its own balance
+var selfBalanceContract = common.Address{0xcc}
+
+// overlayTestChain - first block is inserted, second one pays 1000 wei to selfBalanceContract
+func overlayTestChain(t *testing.T) (*stages.MockSentry, *core.ChainPack) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	chainConfig := *params.TestChainConfig
+	chainConfig.LondonBlock = big.NewInt(0) // payloads have base fee
+	gspec := &core.Genesis{
+		Config: &chainConfig,
+		Alloc: core.GenesisAlloc{
+			crypto.PubkeyToAddress(key.PublicKey): {Balance: big.NewInt(params.Ether)},
+			// SELFBALANCE PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+			selfBalanceContract: {Balance: big.NewInt(0), Code: common.FromHex("0x4760005260206000f3")},
+		},
+	}
+	m := stages.MockWithGenesis(t, gspec, key)
+	signer := types.LatestSignerForChainID(m.ChainConfig.ChainID)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 2, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+		if i == 1 {
+			txn, err := types.SignTx(types.NewTransaction(b.TxNonce(crypto.PubkeyToAddress(key.PublicKey)), selfBalanceContract, uint256.NewInt(1000), 50000, uint256.NewInt(10*params.GWei), nil), *signer, key)
+			require.NoError(t, err)
+			b.AddTx(txn)
+		}
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain.Slice(0, 1)))
+	return m, chain
+}
+
+func TestCallPending(t *testing.T) {
+	m, chain := overlayTestChain(t)
+	ctx := context.Background()
+	ff := filters.New(ctx, nil, nil, nil)
+	api := NewEthAPI(NewBaseApi(ff, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil, nil, nil, 5000000)
+	args := ethapi.CallArgs{To: &selfBalanceContract}
+	pending := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
+
+	// no pending block - latest state
+	balance, err := api.Call(ctx, args, pending, nil)
+	require.NoError(t, err)
+	require.Equal(t, common.Hash{}.Bytes(), []byte(balance))
+
+	// pending block is executed in memory
+	rplBlock, err := rlp.EncodeToBytes(chain.Blocks[1])
+	require.NoError(t, err)
+	ff.HandlePendingBlock(&txpool.OnPendingBlockReply{RplBlock: rplBlock})
+	balance, err = api.Call(ctx, args, pending, nil)
+	require.NoError(t, err)
+	require.Equal(t, common.BigToHash(big.NewInt(1000)).Bytes(), []byte(balance))
+	balance, err = api.Call(ctx, args, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), nil)
+	require.NoError(t, err)
+	require.Equal(t, common.Hash{}.Bytes(), []byte(balance))
+}
+
+// recordingBackend - accepts payloads which reach the node
+type recordingBackend struct {
+	services.ApiBackend
+	payloads []common.Hash
+}
+
+func (b *recordingBackend) EngineExecutePayloadV1(ctx context.Context, payload *types2.ExecutionPayload) (*remote.EngineExecutePayloadReply, error) {
+	b.payloads = append(b.payloads, gointerfaces.ConvertH256ToHash(payload.BlockHash))
+	return &remote.EngineExecutePayloadReply{Status: "VALID", LatestValidHash: payload.BlockHash}, nil
+}
+
+// blockPayload - payload of proof-of-stake block with header and transactions of the block
+func blockPayload(t *testing.T, block *types.Block) *ExecutionPayload {
+	payload := &ExecutionPayload{
+		ParentHash:    block.ParentHash(),
+		FeeRecipient:  block.Coinbase(),
+		StateRoot:     block.Root(),
+		ReceiptsRoot:  block.ReceiptHash(),
+		LogsBloom:     block.Bloom().Bytes(),
+		Random:        block.MixDigest(),
+		BlockNumber:   hexutil.Uint64(block.NumberU64()),
+		GasLimit:      hexutil.Uint64(block.GasLimit()),
+		GasUsed:       hexutil.Uint64(block.GasUsed()),
+		Timestamp:     hexutil.Uint64(block.Time()),
+		ExtraData:     block.Extra(),
+		BaseFeePerGas: (*hexutil.Big)(block.BaseFee()),
+	}
+	for _, txn := range block.Transactions() {
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, txn.MarshalBinary(buf))
+		payload.Transactions = append(payload.Transactions, buf.Bytes())
+	}
+	setPayloadHash(payload)
+	return payload
+}
+
+func setPayloadHash(payload *ExecutionPayload) {
+	header := &types.Header{
+		ParentHash:  payload.ParentHash,
+		UncleHash:   types.EmptyUncleHash,
+		Coinbase:    payload.FeeRecipient,
+		Root:        payload.StateRoot,
+		TxHash:      types.DeriveSha(types.RawTransactions(txsBytes(payload.Transactions))),
+		ReceiptHash: payload.ReceiptsRoot,
+		Bloom:       types.BytesToBloom(payload.LogsBloom),
+		Difficulty:  serenity.SerenityDifficulty,
+		Number:      new(big.Int).SetUint64(uint64(payload.BlockNumber)),
+		GasLimit:    uint64(payload.GasLimit),
+		GasUsed:     uint64(payload.GasUsed),
+		Time:        uint64(payload.Timestamp),
+		Extra:       payload.ExtraData,
+		MixDigest:   payload.Random,
+		Nonce:       serenity.SerenityNonce,
+		BaseFee:     payload.BaseFeePerGas.ToInt(),
+		Eip1559:     true,
+	}
+	payload.BlockHash = header.Hash()
+}
+
+func txsBytes(txs []hexutil.Bytes) [][]byte {
+	out := make([][]byte, len(txs))
+	for i, txn := range txs {
+		out[i] = txn
+	}
+	return out
+}
+
+func TestExecutePayloadOnOverlay(t *testing.T) {
+	m, chain := overlayTestChain(t)
+	ctx := context.Background()
+	backend := &recordingBackend{}
+	api := NewEngineAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, backend)
+	api.SetPayloadValidation(true)
+
+	// gas used doesn't match execution - rejected without the node
+	invalid := blockPayload(t, chain.Blocks[1])
+	invalid.GasUsed++
+	setPayloadHash(invalid)
+	status, err := api.ExecutePayloadV1(ctx, invalid)
+	require.NoError(t, err)
+	require.Equal(t, "INVALID", status["status"])
+	require.Equal(t, chain.Blocks[0].Hash(), status["latestValidHash"])
+	require.Empty(t, backend.payloads)
+
+	// valid payload reaches the node, its execution in memory isn't written
+	valid := blockPayload(t, chain.Blocks[1])
+	status, err = api.ExecutePayloadV1(ctx, valid)
+	require.NoError(t, err)
+	require.Equal(t, "VALID", status["status"])
+	require.Equal(t, []common.Hash{valid.BlockHash}, backend.payloads)
+	tx, err := m.DB.BeginRo(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	acc, err := state.NewPlainStateReader(tx).ReadAccountData(selfBalanceContract)
+	require.NoError(t, err)
+	require.True(t, acc.Balance.IsZero())
+}
+
+func TestOverlayErrorIsNotInvalidBlock(t *testing.T) {
+	// only consensus errors reject a payload, failures of reading the DB leave it to the node
+	require.True(t, core.IsBlockValidationError(fmt.Errorf("%w: gas used by execution: 1, in header: 2", core.ErrGasUsedMismatch)))
+	require.True(t, core.IsBlockValidationError(fmt.Errorf("could not apply tx 0 from block 1 [0x]: %w", core.ErrNonceTooLow)))
+	require.False(t, core.IsBlockValidationError(fmt.Errorf("could not apply tx 0 from block 1 [0x]: %w", context.Canceled)))
+	require.False(t, core.IsBlockValidationError(errors.New("mdbx_get: MDBX_PANIC")))
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
 )
 
 func getBlockNumber(number rpc.BlockNumber, tx kv.Tx) (uint64, error) {
@@ -18,6 +19,11 @@ func getBlockNumber(number rpc.BlockNumber, tx kv.Tx) (uint64, error) {
 		}
 	} else if number == rpc.EarliestBlockNumber {
 		blockNum = 0
+	} else if number == rpc.SafeBlockNumber || number == rpc.FinalizedBlockNumber {
+		blockNum, _, err = rpchelper.GetForkchoiceBlockNumber(number, tx)
+		if err != nil {
+			return 0, err
+		}
 	} else {
 		blockNum = uint64(number.Int64())
 	}
@@ -10,7 +10,9 @@ import (
 	txPoolProto "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core"
 	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/erigon/eth/ethconfig"
@@ -34,6 +36,9 @@ func (api *APIImpl) SendRawTransaction(ctx context.Context, encodedTx hexutil.By
 	if !txn.Protected() {
 		return common.Hash{}, errors.New("only replay-protected (EIP-155) transactions allowed over RPC")
 	}
+	if err := api.validateSponsoredTx(ctx, txn); err != nil {
+		return common.Hash{}, err
+	}
 	hash := txn.Hash()
 	res, err := api.txPool.Add(ctx, &txPoolProto.AddRequest{RlpTxs: [][]byte{encodedTx}})
 	if err != nil {
@@ -65,6 +70,10 @@ func (api *APIImpl) SendRawTransaction(ctx context.Context, encodedTx hexutil.By
 		return common.Hash{}, err
 	}
 
+	if api.filters != nil {
+		api.filters.TrackLocalTx(txn, from)
+	}
+
 	if txn.GetTo() == nil {
 		addr := crypto.CreateAddress(from, txn.GetNonce())
 		log.Info("Submitted contract creation", "hash", txn.Hash().Hex(), "from", from, "nonce", txn.GetNonce(), "contract", addr.Hex(), "value", txn.GetValue())
@@ -75,6 +84,34 @@ func (api *APIImpl) SendRawTransaction(ctx context.Context, encodedTx hexutil.By
 	return txn.Hash(), nil
 }
 
+// validateSponsoredTx - checks sponsored transaction (see params.SponsorshipConfig) the way block execution charges it:
+// fee payer must afford gas and sender must afford value. Txpool then checks only sender's balance, so sponsored
+// transactions whose sender can't pay for gas are rejected by it - they're submitted as bundles (--miner.builder.addr).
+func (api *APIImpl) validateSponsoredTx(ctx context.Context, txn types.Transaction) error {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	cc, err := api.chainConfig(tx)
+	if err != nil {
+		return err
+	}
+	head := rawdb.ReadCurrentHeader(tx)
+	if head == nil {
+		return nil
+	}
+	blockNum := head.Number.Uint64() + 1
+	if !cc.IsSponsorship(blockNum) {
+		return nil
+	}
+	msg, err := txn.AsMessage(*types.MakeSigner(cc, blockNum), head.BaseFee)
+	if err != nil {
+		return err
+	}
+	return core.ValidateSponsoredTx(cc, blockNum, state.New(state.NewPlainStateReader(tx)), msg)
+}
+
 // SendTransaction implements eth_sendTransaction. Creates new message call transaction or a contract creation if the data field contains code.
 func (api *APIImpl) SendTransaction(_ context.Context, txObject interface{}) (common.Hash, error) {
 	return common.Hash{0}, fmt.Errorf(NotImplemented, "eth_sendTransaction")
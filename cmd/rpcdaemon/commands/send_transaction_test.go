@@ -2,7 +2,9 @@ package commands_test
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
+	"errors"
 	"math/big"
 	"testing"
 
@@ -17,6 +19,7 @@ import (
 	"github.com/ledgerwatch/erigon/common/u256"
 	"github.com/ledgerwatch/erigon/core"
 	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/erigon/eth/protocols/eth"
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rlp"
@@ -101,6 +104,35 @@ func TestSendRawTransaction(t *testing.T) {
 	//require.Equal(eth.ToProto[m.SentryClient.Protocol()][eth.NewPooledTransactionHashesMsg], sent.Id)
 }
 
+func TestSendRawSponsoredTransaction(t *testing.T) {
+	senderKey, _ := crypto.GenerateKey()
+	sender := crypto.PubkeyToAddress(senderKey.PublicKey)
+	sponsor, registry := common.HexToAddress("0x5000"), common.HexToAddress("0x6000")
+	var key [64]byte
+	copy(key[12:32], sender.Bytes())
+	config := *params.TestChainConfig
+	config.Sponsorship = &params.SponsorshipConfig{Block: big.NewInt(0), Scheme: "registry", Registry: registry}
+	m := stages.MockWithGenesis(t, &core.Genesis{
+		Config: &config,
+		Alloc: core.GenesisAlloc{
+			sponsor:  {Balance: new(big.Int).SetUint64(params.TxGas * params.GWei)},
+			registry: {Balance: big.NewInt(0), Storage: map[common.Hash]common.Hash{common.BytesToHash(crypto.Keccak256(key[:])): common.BytesToHash(sponsor.Bytes())}},
+		},
+	}, senderKey)
+	api := commands.NewEthAPI(commands.NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, nil, nil, nil, 5000000)
+	send := func(value, gasPrice uint64) error {
+		txn, err := types.SignTx(types.NewTransaction(0, common.Address{1}, uint256.NewInt(value), params.TxGas, uint256.NewInt(gasPrice), nil), *types.LatestSignerForChainID(config.ChainID), senderKey)
+		require.NoError(t, err)
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, txn.MarshalBinary(buf))
+		_, err = api.SendRawTransaction(context.Background(), buf.Bytes())
+		return err
+	}
+	// rejected before txpool, which checks only sender's balance
+	require.True(t, errors.Is(send(0, 2*params.GWei), core.ErrInsufficientFunds)) // sponsor can't pay for gas
+	require.True(t, errors.Is(send(1, params.GWei), core.ErrInsufficientFunds))   // sender can't pay value
+}
+
 func transaction(nonce uint64, gaslimit uint64, key *ecdsa.PrivateKey) types.Transaction {
 	return pricedTransaction(nonce, gaslimit, u256.Num1, key)
 }
@@ -22,7 +22,7 @@ func (api *StarknetImpl) GetCode(ctx context.Context, address common.Address, bl
 		return nil, err
 	}
 
-	reader := adapter.NewStateReader(tx, blockNumber)
+	reader := adapter.NewStateReader(tx, blockNumber, api.historySnapshots)
 	acc, err := reader.ReadAccountData(address)
 	if acc == nil || err != nil {
 		return hexutil.Bytes(""), nil
@@ -23,15 +23,21 @@ type StorageEntry struct {
 	Value common.Hash  `json:"value"`
 }
 
+// StorageRangeAt - storage entries of the contract in order of hashed locations, as geth returns them: start is the
+// hashed location to start from, NextKey is the hashed location of the next page. Key of the entry is nil if the
+// preimage of the location is unknown, as geth returns it without preimages
 func StorageRangeAt(stateReader *state.PlainState, contractAddress common.Address, start []byte, maxResult int) (StorageRangeResult, error) {
 	result := StorageRangeResult{Storage: StorageMap{}}
+	if maxResult < 0 {
+		maxResult = 0
+	}
 	resultCount := 0
 
-	if err := stateReader.ForEachStorage(contractAddress, common.BytesToHash(start), func(key, seckey common.Hash, value uint256.Int) bool {
+	if err := stateReader.ForEachStorageHashed(contractAddress, common.BytesToHash(start), func(key *common.Hash, seckey common.Hash, value uint256.Int) bool {
 		if resultCount < maxResult {
-			result.Storage[seckey] = StorageEntry{Key: &key, Value: value.Bytes32()}
+			result.Storage[seckey] = StorageEntry{Key: key, Value: value.Bytes32()}
 		} else {
-			result.NextKey = &key
+			result.NextKey = &seckey
 		}
 		resultCount++
 		return resultCount <= maxResult
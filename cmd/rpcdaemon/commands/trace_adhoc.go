@@ -696,7 +696,7 @@ func (api *TraceAPIImpl) ReplayTransaction(ctx context.Context, txHash common.Ha
 		return nil, err
 	}
 
-	blockNumber, err := rawdb.ReadTxLookupEntry(tx, txHash)
+	blockNumber, err := rawdb.ReadTxLookupEntry(ctx, tx, api._blockReader, txHash)
 	if err != nil {
 		return nil, err
 	}
@@ -719,6 +719,19 @@ func (api *TraceAPIImpl) ReplayTransaction(ctx context.Context, txHash common.Ha
 			break
 		}
 	}
+	if onlyStateDiff(traceTypes) {
+		diffs, err := storedStateDiffs(tx, *blockNumber, len(block.Transactions()))
+		if err != nil {
+			return nil, err
+		}
+		if diffs != nil {
+			sdMap, err := stateDiffOf(tx, diffs[txIndex])
+			if err != nil {
+				return nil, err
+			}
+			return &TraceCallResult{Output: diffs[txIndex].Output, StateDiff: sdMap, Trace: []*ParityTrace{}}, nil
+		}
+	}
 	bn := hexutil.Uint64(*blockNumber)
 
 	parentNr := bn
@@ -810,6 +823,25 @@ func (api *TraceAPIImpl) ReplayBlockTransactions(ctx context.Context, blockNrOrH
 		}
 	}
 
+	if onlyStateDiff(traceTypes) {
+		diffs, err := storedStateDiffs(tx, blockNumber, len(block.Transactions()))
+		if err != nil {
+			return nil, err
+		}
+		if diffs != nil {
+			result := make([]*TraceCallResult, len(diffs))
+			for i, diff := range diffs {
+				sdMap, err := stateDiffOf(tx, diff)
+				if err != nil {
+					return nil, err
+				}
+				txhash := block.Transactions()[i].Hash()
+				result[i] = &TraceCallResult{Output: diff.Output, StateDiff: sdMap, Trace: []*ParityTrace{}, TransactionHash: &txhash}
+			}
+			return result, nil
+		}
+	}
+
 	// Returns an array of trace arrays, one trace array for each transaction
 	traces, err := api.callManyTransactions(ctx, tx, block.Transactions(), traceTypes, block.ParentHash(), rpc.BlockNumber(parentNr), block.Header(), -1 /* all tx indices */, types.MakeSigner(chainConfig, blockNumber))
 	if err != nil {
@@ -868,7 +900,7 @@ func (api *TraceAPIImpl) Call(ctx context.Context, args TraceCallParam, traceTyp
 		}
 		stateReader = state.NewCachedReader2(cacheView, tx)
 	} else {
-		stateReader = state.NewPlainState(tx, blockNumber)
+		stateReader = state.NewPlainState(tx, blockNumber, api.historySnapshots)
 	}
 	ibs := state.New(stateReader)
 
@@ -923,7 +955,11 @@ func (api *TraceAPIImpl) Call(ctx context.Context, args TraceCallParam, traceTyp
 			return nil, fmt.Errorf("header.BaseFee uint256 overflow")
 		}
 	}
-	msg, err := args.ToMessage(api.gasCap, baseFee)
+	allowance, err := api.allowGas(ctx, api.gasCap, requestedGas(args.Gas))
+	if err != nil {
+		return nil, err
+	}
+	msg, err := args.ToMessage(allowance.gas, baseFee)
 	if err != nil {
 		return nil, err
 	}
@@ -952,6 +988,7 @@ func (api *TraceAPIImpl) Call(ctx context.Context, args TraceCallParam, traceTyp
 	if err != nil {
 		return nil, err
 	}
+	allowance.release(execResult.UsedGas)
 	traceResult.Output = common.CopyBytes(execResult.ReturnData)
 	if traceTypeStateDiff {
 		sdMap := make(map[common.Address]*StateDiffAccount)
@@ -1043,7 +1080,11 @@ func (api *TraceAPIImpl) CallMany(ctx context.Context, calls json.RawMessage, pa
 	}
 	msgs := make([]types.Message, len(callParams))
 	for i, args := range callParams {
-		msgs[i], err = args.ToMessage(api.gasCap, baseFee)
+		allowance, err := api.allowGas(ctx, api.gasCap, requestedGas(args.Gas))
+		if err != nil {
+			return nil, err
+		}
+		msgs[i], err = args.ToMessage(allowance.gas, baseFee)
 		if err != nil {
 			return nil, fmt.Errorf("convert callParam to msg: %w", err)
 		}
@@ -1074,7 +1115,7 @@ func (api *TraceAPIImpl) doCallMany(ctx context.Context, dbtx kv.Tx, msgs []type
 		}
 		stateReader = state.NewCachedReader2(cacheView, dbtx) // this cache stays between RPC calls
 	} else {
-		stateReader = state.NewPlainState(dbtx, blockNumber)
+		stateReader = state.NewPlainState(dbtx, blockNumber, api.historySnapshots)
 	}
 	stateCache := shards.NewStateCache(32, 0 /* no limit */) // this cache living only during current RPC call, but required to store state writes
 	cachedReader := state.NewCachedReader(stateReader, stateCache)
@@ -28,7 +28,7 @@ func (api *TraceAPIImpl) Transaction(ctx context.Context, txHash common.Hash) (P
 		return nil, err
 	}
 
-	blockNumber, err := rawdb.ReadTxLookupEntry(tx, txHash)
+	blockNumber, err := rawdb.ReadTxLookupEntry(ctx, tx, api._blockReader, txHash)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/turbo/statediff"
+)
+
+// onlyStateDiff - trace types can be served from state diffs recorded by StateDiffs stage
+func onlyStateDiff(traceTypes []string) bool {
+	if len(traceTypes) == 0 {
+		return false
+	}
+	for _, traceType := range traceTypes {
+		if traceType != TraceTypeStateDiff {
+			return false
+		}
+	}
+	return true
+}
+
+// storedStateDiffs - state diffs of block's transactions recorded by StateDiffs stage (`statediffs` experiment),
+// nil if they are not recorded for the block
+func storedStateDiffs(tx kv.Tx, blockNum uint64, txCount int) ([]*statediff.Tx, error) {
+	progress, err := stages.GetStageProgress(tx, stages.StateDiffs)
+	if err != nil {
+		return nil, err
+	}
+	if txCount == 0 || progress < blockNum {
+		return nil, nil
+	}
+	diffs, err := statediff.ReadBlock(tx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	if len(diffs) != txCount { // stage started after the block, e.g. history was pruned
+		return nil, nil
+	}
+	return diffs, nil
+}
+
+func readCode(tx kv.Tx, codeHash common.Hash) (hexutil.Bytes, error) {
+	if codeHash == (common.Hash{}) {
+		return nil, nil
+	}
+	return tx.GetOne(kv.Code, codeHash[:])
+}
+
+// stateDiffOf - the same result as StateDiff.CompareStates gives after re-execution of the transaction
+func stateDiffOf(tx kv.Tx, diff *statediff.Tx) (map[common.Address]*StateDiffAccount, error) {
+	sdMap := make(map[common.Address]*StateDiffAccount, len(diff.Accounts))
+	for _, a := range diff.Accounts {
+		accountDiff := &StateDiffAccount{Storage: make(map[common.Hash]map[string]interface{}, len(a.Storage))}
+		fromCode, err := readCode(tx, a.FromCodeHash)
+		if err != nil {
+			return nil, err
+		}
+		toCode, err := readCode(tx, a.ToCodeHash)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case a.FromExists && a.ToExists:
+			if a.FromBalance == a.ToBalance {
+				accountDiff.Balance = "="
+			} else {
+				accountDiff.Balance = map[string]*StateDiffBalance{"*": {From: (*hexutil.Big)(a.FromBalance.ToBig()), To: (*hexutil.Big)(a.ToBalance.ToBig())}}
+			}
+			if a.FromCodeHash == a.ToCodeHash {
+				accountDiff.Code = "="
+			} else {
+				accountDiff.Code = map[string]*StateDiffCode{"*": {From: fromCode, To: toCode}}
+			}
+			if a.FromNonce == a.ToNonce {
+				accountDiff.Nonce = "="
+			} else {
+				accountDiff.Nonce = map[string]*StateDiffNonce{"*": {From: hexutil.Uint64(a.FromNonce), To: hexutil.Uint64(a.ToNonce)}}
+			}
+		case a.FromExists:
+			accountDiff.Balance = map[string]*hexutil.Big{"-": (*hexutil.Big)(a.FromBalance.ToBig())}
+			accountDiff.Code = map[string]hexutil.Bytes{"-": fromCode}
+			accountDiff.Nonce = map[string]hexutil.Uint64{"-": hexutil.Uint64(a.FromNonce)}
+		default:
+			accountDiff.Balance = map[string]*hexutil.Big{"+": (*hexutil.Big)(a.ToBalance.ToBig())}
+			accountDiff.Code = map[string]hexutil.Bytes{"+": toCode}
+			accountDiff.Nonce = map[string]hexutil.Uint64{"+": hexutil.Uint64(a.ToNonce)}
+		}
+		for _, s := range a.Storage {
+			if a.FromExists {
+				accountDiff.Storage[s.Key] = map[string]interface{}{"*": &StateDiffStorage{From: s.From, To: s.To}}
+			} else {
+				to := s.To
+				accountDiff.Storage[s.Key] = map[string]interface{}{"+": &to}
+			}
+		}
+		sdMap[a.Address] = accountDiff
+	}
+	return sdMap, nil
+}
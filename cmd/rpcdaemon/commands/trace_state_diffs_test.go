@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/cli"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/ledgerwatch/erigon/turbo/statediff"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayStoredStateDiffs(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	pm := prune.DefaultMode
+	pm.Experiments.StateDiffs = true
+	m := stages.MockWithGenesisPruneMode(t, gspec, key, pm)
+	signer := types.LatestSignerForChainID(nil)
+
+	// contract sets slot 1 at creation, then stores call value in slot 0
+	contract := crypto.CreateAddress(sender, 0)
+	initCode := common.FromHex("0x600160015563346000556000526004601cf3")
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 3, func(i int, b *core.BlockGen) {
+		var txs []types.Transaction
+		switch i {
+		case 0:
+			txs = append(txs, types.NewContractCreation(b.TxNonce(sender), uint256.NewInt(0), 100_000, uint256.NewInt(1), initCode))
+			txs = append(txs, types.NewTransaction(b.TxNonce(sender)+1, common.Address{2}, uint256.NewInt(7), params.TxGas, uint256.NewInt(1), nil))
+		case 1:
+			txs = append(txs, types.NewTransaction(b.TxNonce(sender), contract, uint256.NewInt(5), 100_000, uint256.NewInt(1), nil))
+		case 2:
+			txs = append(txs, types.NewTransaction(b.TxNonce(sender), contract, uint256.NewInt(0), 100_000, uint256.NewInt(1), nil))
+		}
+		for _, txn := range txs {
+			signed, err := types.SignTx(txn, *signer, key)
+			require.NoError(t, err)
+			b.AddTx(signed)
+		}
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	tx, err := m.DB.BeginRo(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	for blockNum := uint64(1); blockNum <= 3; blockNum++ {
+		diffs, err := statediff.ReadBlock(tx, blockNum)
+		require.NoError(t, err)
+		require.Len(t, diffs, len(chain.Blocks[blockNum-1].Transactions()))
+	}
+
+	api := NewTraceAPI(NewBaseApi(nil, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false), m.DB, &cli.Flags{})
+	ctx := context.Background()
+	stateDiffOf := func(results []*TraceCallResult) string {
+		type diff struct {
+			Output    interface{}
+			StateDiff interface{}
+		}
+		diffs := make([]diff, len(results))
+		for i, r := range results {
+			diffs[i] = diff{Output: r.Output, StateDiff: r.StateDiff}
+		}
+		enc, err := json.Marshal(diffs)
+		require.NoError(t, err)
+		return string(enc)
+	}
+	for blockNum := rpc.BlockNumber(1); blockNum <= 3; blockNum++ {
+		stored, err := api.ReplayBlockTransactions(ctx, rpc.BlockNumberOrHashWithNumber(blockNum), []string{TraceTypeStateDiff})
+		require.NoError(t, err)
+		// "trace" can't be served from stored diffs, the block is re-executed
+		executed, err := api.ReplayBlockTransactions(ctx, rpc.BlockNumberOrHashWithNumber(blockNum), []string{TraceTypeStateDiff, TraceTypeTrace})
+		require.NoError(t, err)
+		require.Equal(t, stateDiffOf(executed), stateDiffOf(stored))
+		for i, r := range stored {
+			require.Equal(t, executed[i].TransactionHash, r.TransactionHash)
+			single, err := api.ReplayTransaction(ctx, *r.TransactionHash, []string{TraceTypeStateDiff})
+			require.NoError(t, err)
+			require.Equal(t, stateDiffOf(executed[i:i+1]), stateDiffOf([]*TraceCallResult{single}))
+		}
+	}
+
+	stored, err := api.ReplayBlockTransactions(ctx, rpc.BlockNumberOrHashWithNumber(2), []string{TraceTypeStateDiff})
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	slot := stored[0].StateDiff[contract].Storage[common.Hash{}]
+	require.Equal(t, &StateDiffStorage{From: common.Hash{}, To: common.BigToHash(big.NewInt(5))}, slot["*"])
+}
@@ -1,17 +1,23 @@
 package commands
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 
 	"github.com/holiman/uint256"
 	jsoniter "github.com/json-iterator/go"
+	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
 	"github.com/ledgerwatch/erigon/consensus/ethash"
+	"github.com/ledgerwatch/erigon/core"
 	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/state"
 	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
 	"github.com/ledgerwatch/erigon/eth/tracers"
+	"github.com/ledgerwatch/erigon/eth/tracers/zktrace"
 	"github.com/ledgerwatch/erigon/ethdb"
 	"github.com/ledgerwatch/erigon/internal/ethapi"
 	"github.com/ledgerwatch/erigon/rpc"
@@ -29,7 +35,7 @@ func (api *PrivateDebugAPIImpl) TraceTransaction(ctx context.Context, hash commo
 	defer tx.Rollback()
 
 	// Retrieve the transaction and assemble its EVM context
-	txn, blockHash, _, txIndex, err := rawdb.ReadTransaction(tx, hash)
+	txn, block, txIndex, err := api.txnLookup(ctx, tx, hash)
 	if err != nil {
 		return err
 	}
@@ -37,20 +43,13 @@ func (api *PrivateDebugAPIImpl) TraceTransaction(ctx context.Context, hash commo
 		stream.WriteNil()
 		return fmt.Errorf("transaction %#x not found", hash)
 	}
+	blockHash := block.Hash()
 
 	chainConfig, err := api.chainConfig(tx)
 	if err != nil {
 		stream.WriteNil()
 		return err
 	}
-
-	block, err := api.blockByHashWithSenders(tx, blockHash)
-	if err != nil {
-		return err
-	}
-	if block == nil {
-		return nil
-	}
 	getHeader := func(hash common.Hash, number uint64) *types.Header {
 		return rawdb.ReadHeader(tx, hash, number)
 	}
@@ -58,7 +57,7 @@ func (api *PrivateDebugAPIImpl) TraceTransaction(ctx context.Context, hash commo
 	if api.TevmEnabled {
 		contractHasTEVM = ethdb.GetHasTEVM(tx)
 	}
-	msg, blockCtx, txCtx, ibs, _, err := transactions.ComputeTxEnv(ctx, block, chainConfig, getHeader, contractHasTEVM, ethash.NewFaker(), tx, blockHash, txIndex)
+	msg, blockCtx, txCtx, ibs, _, err := transactions.ComputeTxEnv(ctx, block, chainConfig, getHeader, contractHasTEVM, ethash.NewFaker(), tx, api.historySnapshots, blockHash, txIndex)
 	if err != nil {
 		stream.WriteNil()
 		return err
@@ -94,7 +93,7 @@ func (api *PrivateDebugAPIImpl) TraceCall(ctx context.Context, args ethapi.CallA
 		}
 		stateReader = state.NewCachedReader2(cacheView, dbtx)
 	} else {
-		stateReader = state.NewPlainState(dbtx, blockNumber)
+		stateReader = state.NewPlainState(dbtx, blockNumber, api.historySnapshots)
 	}
 	header := rawdb.ReadHeader(dbtx, hash, blockNumber)
 	if header == nil {
@@ -111,7 +110,12 @@ func (api *PrivateDebugAPIImpl) TraceCall(ctx context.Context, args ethapi.CallA
 			return fmt.Errorf("header.BaseFee uint256 overflow")
 		}
 	}
-	msg, err := args.ToMessage(api.GasCap, baseFee)
+	allowance, err := api.allowGas(ctx, api.GasCap, requestedGas(args.Gas))
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	msg, err := args.ToMessage(allowance.gas, baseFee)
 	if err != nil {
 		return err
 	}
@@ -124,3 +128,191 @@ func (api *PrivateDebugAPIImpl) TraceCall(ctx context.Context, args ethapi.CallA
 	// Trace the transaction and return
 	return transactions.TraceTx(ctx, msg, blockCtx, txCtx, ibs, config, chainConfig, stream)
 }
+
+// TraceBlockByNumber implements debug_traceBlockByNumber. Returns Geth style traces of all transactions of the block,
+// or a single summary of the block for the "opcodeProfiler" tracer.
+func (api *PrivateDebugAPIImpl) TraceBlockByNumber(ctx context.Context, blockNum rpc.BlockNumber, config *tracers.TraceConfig, stream *jsoniter.Stream) error {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	defer tx.Rollback()
+	n, err := getBlockNumber(blockNum, tx)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	block, err := api.blockByNumberWithSenders(tx, n)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	if block == nil {
+		stream.WriteNil()
+		return fmt.Errorf("block %d not found", n)
+	}
+	return api.traceBlock(ctx, tx, block, config, stream)
+}
+
+// TraceBlockByHash implements debug_traceBlockByHash. Same as debug_traceBlockByNumber.
+func (api *PrivateDebugAPIImpl) TraceBlockByHash(ctx context.Context, hash common.Hash, config *tracers.TraceConfig, stream *jsoniter.Stream) error {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	defer tx.Rollback()
+	block, err := api.blockByHashWithSenders(tx, hash)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	if block == nil {
+		stream.WriteNil()
+		return fmt.Errorf("block %x not found", hash)
+	}
+	return api.traceBlock(ctx, tx, block, config, stream)
+}
+
+func (api *PrivateDebugAPIImpl) traceBlock(ctx context.Context, tx kv.Tx, block *types.Block, config *tracers.TraceConfig, stream *jsoniter.Stream) error {
+	if block.NumberU64() == 0 {
+		stream.WriteNil()
+		return fmt.Errorf("genesis block can't be traced")
+	}
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	ibs, blockCtx := api.blockEnv(tx, block)
+	return transactions.TraceBlock(ctx, block, blockCtx, ibs, config, chainConfig, stream)
+}
+
+// blockEnv - state before the block and EVM context of the block
+func (api *PrivateDebugAPIImpl) blockEnv(tx kv.Tx, block *types.Block) (*state.IntraBlockState, vm.BlockContext) {
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		return rawdb.ReadHeader(tx, hash, number)
+	}
+	contractHasTEVM := func(contractHash common.Hash) (bool, error) { return false, nil }
+	if api.TevmEnabled {
+		contractHasTEVM = ethdb.GetHasTEVM(tx)
+	}
+	ibs := state.New(state.NewPlainState(tx, block.NumberU64()-1, api.historySnapshots))
+	return ibs, core.NewEVMBlockContext(block.Header(), getHeader, ethash.NewFaker(), nil, contractHasTEVM)
+}
+
+// maxProfileBlocks - limit of blocks re-executed by one debug_profileBlockRange call
+const maxProfileBlocks = 1024
+
+// ProfileBlockRange implements debug_profileBlockRange. Returns summary of the "opcodeProfiler" tracer over
+// all transactions of blocks [from, to], at most maxProfileBlocks blocks.
+func (api *PrivateDebugAPIImpl) ProfileBlockRange(ctx context.Context, from, to rpc.BlockNumber, stream *jsoniter.Stream) error {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	defer tx.Rollback()
+	fromNum, err := getBlockNumber(from, tx)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	toNum, err := getBlockNumber(to, tx)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	if fromNum == 0 {
+		fromNum = 1 // genesis has no transactions
+	}
+	if toNum < fromNum || toNum-fromNum >= maxProfileBlocks {
+		stream.WriteNil()
+		return fmt.Errorf("range must have from 1 to %d blocks", maxProfileBlocks)
+	}
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	profiler := tracers.NewOpcodeProfiler()
+	for n := fromNum; n <= toNum; n++ {
+		block, err := api.blockByNumberWithSenders(tx, n)
+		if err != nil {
+			stream.WriteNil()
+			return err
+		}
+		if block == nil {
+			stream.WriteNil()
+			return fmt.Errorf("block %d not found", n)
+		}
+		ibs, blockCtx := api.blockEnv(tx, block)
+		if err = transactions.ProfileBlock(ctx, block, blockCtx, ibs, profiler, chainConfig); err != nil {
+			stream.WriteNil()
+			return fmt.Errorf("block %d: %w", n, err)
+		}
+	}
+	r, err := profiler.GetResult()
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	stream.Write(r)
+	return nil
+}
+
+// maxZkTraceBlocks - limit of blocks traced by one debug_zkTraceBlockRange call, result is kept in memory
+const maxZkTraceBlocks = 16
+
+// ZkTraceBlockRange implements debug_zkTraceBlockRange. Returns traces of blocks [from, to] in binary format of
+// zktrace package: header and block messages, length-delimited.
+func (api *PrivateDebugAPIImpl) ZkTraceBlockRange(ctx context.Context, from, to rpc.BlockNumber) (hexutil.Bytes, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	fromNum, err := getBlockNumber(from, tx)
+	if err != nil {
+		return nil, err
+	}
+	toNum, err := getBlockNumber(to, tx)
+	if err != nil {
+		return nil, err
+	}
+	if fromNum == 0 {
+		fromNum = 1 // genesis has no transactions
+	}
+	if toNum < fromNum || toNum-fromNum >= maxZkTraceBlocks {
+		return nil, fmt.Errorf("range must have from 1 to %d blocks", maxZkTraceBlocks)
+	}
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w, err := zktrace.NewWriter(&buf, chainConfig.ChainID.Uint64())
+	if err != nil {
+		return nil, err
+	}
+	for n := fromNum; n <= toNum; n++ {
+		block, err := api.blockByNumberWithSenders(tx, n)
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			return nil, fmt.Errorf("block %d not found", n)
+		}
+		ibs, blockCtx := api.blockEnv(tx, block)
+		traced, err := transactions.ZkTraceBlock(ctx, block, blockCtx, ibs, chainConfig)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", n, err)
+		}
+		if err = w.WriteBlock(traced); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -7,6 +7,7 @@ import (
 
 	proto_txpool "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/filters"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/hexutil"
 	"github.com/ledgerwatch/erigon/core/rawdb"
@@ -17,6 +18,7 @@ import (
 // NetAPI the interface for the net_ RPC commands
 type TxPoolAPI interface {
 	Content(ctx context.Context) (map[string]map[string]map[string]*RPCTransaction, error)
+	DroppedTransaction(ctx context.Context, hash common.Hash) (*filters.DroppedTx, error)
 }
 
 // TxPoolAPIImpl data structure to store things needed for net_ commands
@@ -130,6 +132,15 @@ func (api *TxPoolAPIImpl) Status(ctx context.Context) (map[string]hexutil.Uint,
 	}, nil
 }
 
+// DroppedTransaction returns reason why txpool dropped transaction sent via this RPC daemon.
+// Returns nil if transaction wasn't dropped (it's pending, mined or unknown), or if it was dropped long ago.
+func (api *TxPoolAPIImpl) DroppedTransaction(_ context.Context, hash common.Hash) (*filters.DroppedTx, error) {
+	if api.filters == nil {
+		return nil, fmt.Errorf("tracking of local transactions is not supported in chaindata mode")
+	}
+	return api.filters.DroppedTx(hash), nil
+}
+
 /*
 
 // Inspect retrieves the content of the transaction pool and flattens it into an
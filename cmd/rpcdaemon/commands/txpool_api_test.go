@@ -2,10 +2,14 @@ package commands
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
 	txPoolProto "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
 	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
@@ -15,10 +19,13 @@ import (
 	"github.com/ledgerwatch/erigon/common/hexutil"
 	"github.com/ledgerwatch/erigon/core"
 	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
 	"github.com/ledgerwatch/erigon/turbo/stages"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
 )
 
 func TestTxPoolContent(t *testing.T) {
@@ -62,3 +69,96 @@ func TestTxPoolContent(t *testing.T) {
 	require.Equal(status["pending"], hexutil.Uint(1))
 	require.Equal(status["queued"], hexutil.Uint(0))
 }
+
+// droppingTxPool - accepts all transactions and forgets them right away
+type droppingTxPool struct {
+	txpool.TxpoolClient
+}
+
+func (p droppingTxPool) Add(_ context.Context, in *txpool.AddRequest, _ ...grpc.CallOption) (*txpool.AddReply, error) {
+	reply := &txpool.AddReply{Imported: make([]txpool.ImportResult, len(in.RlpTxs)), Errors: make([]string, len(in.RlpTxs))}
+	for i := range reply.Imported {
+		reply.Imported[i] = txpool.ImportResult_SUCCESS
+	}
+	return reply, nil
+}
+
+func (p droppingTxPool) Transactions(_ context.Context, in *txpool.TransactionsRequest, _ ...grpc.CallOption) (*txpool.TransactionsReply, error) {
+	return &txpool.TransactionsReply{RlpTxs: make([][]byte, len(in.Hashes))}, nil
+}
+
+func TestTxPoolDroppedTransaction(t *testing.T) {
+	require := require.New(t)
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	chainConfig := *params.TestChainConfig
+	chainConfig.LondonBlock = big.NewInt(0) // to have base fee
+	gspec := &core.Genesis{
+		Config: &chainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	m := stages.MockWithGenesis(t, gspec, key)
+	signer := types.LatestSignerForChainID(m.ChainConfig.ChainID)
+	newTx := func(nonce uint64, gasPrice uint64) types.Transaction {
+		txn, err := types.SignTx(types.NewTransaction(nonce, common.Address{1}, uint256.NewInt(1), params.TxGas, uint256.NewInt(gasPrice), nil), *signer, key)
+		require.NoError(err)
+		return txn
+	}
+	minedTx := newTx(0, 10*params.GWei)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 1, func(i int, b *core.BlockGen) {
+		b.AddTx(minedTx)
+	}, false /* intemediateHashes */)
+	require.NoError(err)
+	require.NoError(m.InsertChain(chain))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := droppingTxPool{}
+	ff := filters.New(ctx, nil, nil, nil)
+	ff.WatchLocalTxs(ctx, m.DB, snapshotsync.NewBlockReader(), pool)
+	base := NewBaseApi(ff, kvcache.New(kvcache.DefaultCoherentConfig), snapshotsync.NewBlockReader(), false)
+	ethApi := NewEthAPI(base, m.DB, nil, pool, nil, 5000000)
+	api := NewTxPoolAPI(base, m.DB, pool)
+
+	replacedTx := newTx(0, 20*params.GWei) // same nonce as mined one
+	underpricedTx := newTx(1, 1)
+	discardedTx := newTx(2, 10*params.GWei)
+	for _, txn := range []types.Transaction{minedTx, replacedTx, underpricedTx, discardedTx} {
+		buf := bytes.NewBuffer(nil)
+		require.NoError(txn.MarshalBinary(buf))
+		_, err = ethApi.SendRawTransaction(ctx, buf.Bytes())
+		require.NoError(err)
+	}
+
+	droppedCh := make(chan *filters.DroppedTx, 4)
+	id := ff.SubscribeDroppedTxs(droppedCh)
+	defer ff.UnsubscribeDroppedTxs(id)
+	header, err := rlp.EncodeToBytes(chain.TopBlock.Header())
+	require.NoError(err)
+	ff.OnNewEvent(&remote.SubscribeReply{Type: remote.Event_HEADER, Data: header})
+
+	reasons := map[common.Hash]string{}
+	for i := 0; i < 3; i++ {
+		select {
+		case d := <-droppedCh:
+			require.Equal(sender, d.From)
+			require.Equal(hexutil.Uint64(1), d.BlockNumber)
+			reasons[d.Hash] = d.Reason
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for dropped transactions")
+		}
+	}
+	require.Equal(map[common.Hash]string{
+		replacedTx.Hash():    filters.DropReasonNonceTooLow,
+		underpricedTx.Hash(): filters.DropReasonUnderpriced,
+		discardedTx.Hash():   filters.DropReasonDiscarded,
+	}, reasons)
+
+	dropped, err := api.DroppedTransaction(ctx, underpricedTx.Hash())
+	require.NoError(err)
+	require.Equal(filters.DropReasonUnderpriced, dropped.Reason)
+	require.Equal(hexutil.Uint64(1), dropped.Nonce)
+	dropped, err = api.DroppedTransaction(ctx, minedTx.Hash())
+	require.NoError(err)
+	require.Nil(dropped)
+}
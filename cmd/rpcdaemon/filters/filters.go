@@ -39,6 +39,9 @@ type Filters struct {
 	pendingLogsSubs  map[PendingLogsSubID]chan types.Logs
 	pendingBlockSubs map[PendingBlockSubID]chan *types.Block
 	pendingTxsSubs   map[PendingTxsSubID]chan []types.Transaction
+	droppedTxsSubs   map[DroppedTxsSubID]chan *DroppedTx
+
+	localTxs *localTxs
 }
 
 func New(ctx context.Context, ethBackend services.ApiBackend, txPool txpool.TxpoolClient, mining txpool.MiningClient) *Filters {
@@ -49,6 +52,8 @@ func New(ctx context.Context, ethBackend services.ApiBackend, txPool txpool.Txpo
 		pendingTxsSubs:   make(map[PendingTxsSubID]chan []types.Transaction),
 		pendingLogsSubs:  make(map[PendingLogsSubID]chan types.Logs),
 		pendingBlockSubs: make(map[PendingBlockSubID]chan *types.Block),
+		droppedTxsSubs:   make(map[DroppedTxsSubID]chan *DroppedTx),
+		localTxs:         newLocalTxs(),
 	}
 
 	go func() {
@@ -169,7 +174,11 @@ func New(ctx context.Context, ethBackend services.ApiBackend, txPool txpool.Txpo
 	return ff
 }
 
+// LastPendingBlock - nil if there is no pending block or no filters (pending block is then the latest one)
 func (ff *Filters) LastPendingBlock() *types.Block {
+	if ff == nil {
+		return nil
+	}
 	ff.mu.RLock()
 	defer ff.mu.RUnlock()
 	return ff.pendingBlock
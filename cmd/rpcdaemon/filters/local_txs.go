@@ -0,0 +1,216 @@
+package filters
+
+import (
+	"context"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	types2 "github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/interfaces"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// Reasons of drop of local transactions. Txpool doesn't expose reasons of discards which happen after admission,
+// so they are derived from the state of the chain at the moment when drop is noticed.
+const (
+	DropReasonNonceTooLow = "nonce too low"               // other transaction with the same nonce was mined
+	DropReasonUnderpriced = "fee cap lower than base fee" // base fee has risen above fee cap of transaction
+	DropReasonDiscarded   = "discarded by txpool"         // evicted because sub-pool is full, replaced, etc.
+)
+
+const (
+	maxTrackedLocalTxs = 10_000
+	droppedTxsLRUSize  = 10_000
+)
+
+type DroppedTxsSubID SubscriptionID
+
+// DroppedTx - transaction sent via this RPC daemon, which was accepted by txpool but later dropped without being mined
+type DroppedTx struct {
+	Hash        common.Hash    `json:"hash"`
+	From        common.Address `json:"from"`
+	Nonce       hexutil.Uint64 `json:"nonce"`
+	Reason      string         `json:"reason"`
+	BlockNumber hexutil.Uint64 `json:"blockNumber"` // head block at the moment when drop was noticed
+}
+
+type localTx struct {
+	txn    types.Transaction
+	sender common.Address
+}
+
+// localTxs - transactions sent via eth_sendRawTransaction which are still waiting to be mined, and recently dropped ones
+type localTxs struct {
+	mu      sync.Mutex
+	pending map[common.Hash]localTx
+	dropped *lru.Cache // common.Hash -> *DroppedTx
+}
+
+func newLocalTxs() *localTxs {
+	dropped, err := lru.New(droppedTxsLRUSize)
+	if err != nil {
+		panic(err)
+	}
+	return &localTxs{pending: map[common.Hash]localTx{}, dropped: dropped}
+}
+
+// TrackLocalTx - remembers transaction accepted by txpool, to notice if it disappears from the pool without being mined
+func (ff *Filters) TrackLocalTx(txn types.Transaction, sender common.Address) {
+	l := ff.localTxs
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pending) >= maxTrackedLocalTxs {
+		log.Debug("rpc filters: too many local transactions tracked, skipping", "hash", txn.Hash())
+		return
+	}
+	l.pending[txn.Hash()] = localTx{txn: txn, sender: sender}
+	l.dropped.Remove(txn.Hash()) // re-sent after drop
+}
+
+// DroppedTx - returns reason of drop of local transaction, nil if transaction wasn't dropped or it was too long ago
+func (ff *Filters) DroppedTx(hash common.Hash) *DroppedTx {
+	if v, ok := ff.localTxs.dropped.Get(hash); ok {
+		return v.(*DroppedTx)
+	}
+	return nil
+}
+
+func (ff *Filters) SubscribeDroppedTxs(out chan *DroppedTx) DroppedTxsSubID {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	id := DroppedTxsSubID(generateSubscriptionID())
+	ff.droppedTxsSubs[id] = out
+	return id
+}
+
+func (ff *Filters) UnsubscribeDroppedTxs(id DroppedTxsSubID) {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	delete(ff.droppedTxsSubs, id)
+}
+
+// WatchLocalTxs - on every new head checks whether tracked local transactions are still in txpool,
+// records and sends to subscribers the ones which disappeared without being mined
+func (ff *Filters) WatchLocalTxs(ctx context.Context, db kv.RoDB, blockReader interfaces.BlockReader, txPool txpool.TxpoolClient) {
+	headsCh := make(chan *types.Header, 16)
+	id := ff.SubscribeNewHeads(headsCh)
+	go func() {
+		defer ff.UnsubscribeHeads(id)
+		for {
+			var head *types.Header
+			select {
+			case <-ctx.Done():
+				return
+			case head = <-headsCh:
+			}
+			// only the latest head matters, skip the ones which came during previous check
+			for len(headsCh) > 0 {
+				head = <-headsCh
+			}
+			dropped, err := ff.checkLocalTxs(ctx, db, blockReader, txPool, head)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Warn("rpc filters: checking local transactions", "err", err)
+				continue
+			}
+			ff.onDroppedTxs(dropped)
+		}
+	}()
+}
+
+func (ff *Filters) checkLocalTxs(ctx context.Context, db kv.RoDB, blockReader interfaces.BlockReader, txPool txpool.TxpoolClient, head *types.Header) ([]*DroppedTx, error) {
+	l := ff.localTxs
+	l.mu.Lock()
+	txs := make([]localTx, 0, len(l.pending))
+	for _, t := range l.pending {
+		txs = append(txs, t)
+	}
+	l.mu.Unlock()
+	if len(txs) == 0 {
+		return nil, nil
+	}
+
+	hashes := make([]*types2.H256, len(txs))
+	for i, t := range txs {
+		hashes[i] = gointerfaces.ConvertHashToH256(t.txn.Hash())
+	}
+	reply, err := txPool.Transactions(ctx, &txpool.TransactionsRequest{Hashes: hashes})
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	stateReader := state.NewPlainStateReader(tx)
+
+	var done []common.Hash
+	var dropped []*DroppedTx
+	for i, t := range txs {
+		if i < len(reply.RlpTxs) && len(reply.RlpTxs[i]) > 0 {
+			continue
+		}
+		hash := t.txn.Hash()
+		done = append(done, hash)
+		blockNum, err := rawdb.ReadTxLookupEntry(ctx, tx, blockReader, hash)
+		if err != nil {
+			return nil, err
+		}
+		if blockNum != nil { // mined
+			continue
+		}
+		reason := DropReasonDiscarded
+		acc, err := stateReader.ReadAccountData(t.sender)
+		if err != nil {
+			return nil, err
+		}
+		if acc != nil && acc.Nonce > t.txn.GetNonce() {
+			reason = DropReasonNonceTooLow
+		} else if head.BaseFee != nil && t.txn.GetFeeCap().ToBig().Cmp(head.BaseFee) < 0 {
+			reason = DropReasonUnderpriced
+		}
+		dropped = append(dropped, &DroppedTx{
+			Hash:        hash,
+			From:        t.sender,
+			Nonce:       hexutil.Uint64(t.txn.GetNonce()),
+			Reason:      reason,
+			BlockNumber: hexutil.Uint64(head.Number.Uint64()),
+		})
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, hash := range done {
+		delete(l.pending, hash)
+	}
+	for _, d := range dropped {
+		l.dropped.Add(d.Hash, d)
+	}
+	return dropped, nil
+}
+
+func (ff *Filters) onDroppedTxs(dropped []*DroppedTx) {
+	if len(dropped) == 0 {
+		return
+	}
+	ff.mu.RLock()
+	defer ff.mu.RUnlock()
+	for _, d := range dropped {
+		log.Debug("rpc filters: local transaction dropped by txpool", "hash", d.Hash, "reason", d.Reason)
+		for _, v := range ff.droppedTxsSubs {
+			v <- d
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package filters
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// PollFiltersTable - filter id (8 bytes) -> JSON of PollFilter
+const PollFiltersTable = "RpcPollFilters"
+
+const (
+	DefaultPollFilterTTL    = 5 * time.Minute
+	DefaultMaxFiltersClient = 100
+)
+
+// ErrTooManyFilters - client has --rpc.filters.maxperclient filters installed
+var ErrTooManyFilters = errors.New("too many filters installed, uninstall unused filters")
+
+type PollFilterKind uint8
+
+const (
+	BlockPollFilter PollFilterKind = 1 // eth_newBlockFilter - hashes of new canonical blocks
+	LogsPollFilter  PollFilterKind = 2 // eth_newFilter - logs of new canonical blocks
+)
+
+// PollFilter - filter of eth_newFilter/eth_newBlockFilter. It doesn't buffer events: eth_getFilterChanges reads
+// changes of blocks from Next up to the head from the database, so the filter survives restart of rpcdaemon.
+type PollFilter struct {
+	Kind      PollFilterKind   `json:"kind"`
+	Client    string           `json:"client"` // IP address of HTTP client or connection of WebSocket client
+	Addresses []common.Address `json:"addresses,omitempty"`
+	Topics    [][]common.Hash  `json:"topics,omitempty"`
+	Next      uint64           `json:"next"`             // first block which changes were not returned yet
+	Recent    []SentBlock      `json:"recent,omitempty"` // returned blocks near head, contiguous - to detect reorg
+	LastPoll  int64            `json:"lastPoll"`         // unix time of installation or last eth_getFilterChanges
+}
+
+// SentBlock - canonical block which changes were sent to the client. If it's not canonical anymore, its logs are sent
+// again with removed=true and changes of the new canonical chain are sent from its number.
+type SentBlock struct {
+	Number uint64       `json:"number"`
+	Hash   common.Hash  `json:"hash"`
+	Logs   []*types.Log `json:"logs,omitempty"`
+}
+
+type PollFiltersConfig struct {
+	TTL          time.Duration // filters which were not polled for TTL are uninstalled
+	MaxPerClient int           // 0 - unlimited
+}
+
+// PollFilters - installed filters, stored in own small database of rpcdaemon (Erigon's database is read-only for it)
+type PollFilters struct {
+	db  kv.RwDB
+	cfg PollFiltersConfig
+	now func() time.Time
+}
+
+func pollFiltersTablesCfg(kv.TableCfg) kv.TableCfg {
+	return kv.TableCfg{PollFiltersTable: kv.TableCfgItem{}}
+}
+
+// OpenPollFilters opens database of filters in dir, filters are kept in memory and lost on restart if dir is empty
+func OpenPollFilters(dir string, cfg PollFiltersConfig, logger log.Logger) (*PollFilters, error) {
+	opts := mdbx.NewMDBX(logger).WithTablessCfg(pollFiltersTablesCfg)
+	if dir == "" {
+		opts = opts.InMem()
+	} else {
+		opts = opts.Path(dir)
+	}
+	db, err := opts.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open filters database: %w", err)
+	}
+	return &PollFilters{db: db, cfg: cfg, now: time.Now}, nil
+}
+
+func (pf *PollFilters) Close() { pf.db.Close() }
+
+func (pf *PollFilters) expired(f *PollFilter) bool {
+	return pf.cfg.TTL > 0 && pf.now().Sub(time.Unix(f.LastPoll, 0)) > pf.cfg.TTL
+}
+
+// Install - stores new filter, uninstalls expired filters of all clients
+func (pf *PollFilters) Install(f *PollFilter) (uint64, error) {
+	f.LastPoll = pf.now().Unix()
+	v, err := json.Marshal(f)
+	if err != nil {
+		return 0, err
+	}
+	var id uint64
+	if err = pf.db.Update(context.Background(), func(tx kv.RwTx) error {
+		var expired [][]byte
+		var installed int
+		if err := tx.ForEach(PollFiltersTable, nil, func(k, v []byte) error {
+			var other PollFilter
+			if err := json.Unmarshal(v, &other); err != nil {
+				return err
+			}
+			if pf.expired(&other) {
+				expired = append(expired, common.CopyBytes(k))
+			} else if other.Client == f.Client {
+				installed++
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := tx.Delete(PollFiltersTable, k, nil); err != nil {
+				return err
+			}
+		}
+		if pf.cfg.MaxPerClient > 0 && installed >= pf.cfg.MaxPerClient {
+			return ErrTooManyFilters
+		}
+		var k [8]byte
+		for {
+			if _, err := rand.Read(k[:]); err != nil {
+				return err
+			}
+			if id = binary.BigEndian.Uint64(k[:]); id == 0 {
+				continue
+			}
+			if has, err := tx.Has(PollFiltersTable, k[:]); err != nil {
+				return err
+			} else if !has {
+				break
+			}
+		}
+		return tx.Put(PollFiltersTable, k[:], v)
+	}); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Poll - calls poll with filter (it can advance Next) and stores it with new LastPoll. false if filter is not
+// installed or it's expired
+func (pf *PollFilters) Poll(id uint64, poll func(f *PollFilter) error) (bool, error) {
+	var k [8]byte
+	binary.BigEndian.PutUint64(k[:], id)
+	var found bool
+	err := pf.db.Update(context.Background(), func(tx kv.RwTx) error {
+		v, err := tx.GetOne(PollFiltersTable, k[:])
+		if err != nil || v == nil {
+			return err
+		}
+		var f PollFilter
+		if err = json.Unmarshal(v, &f); err != nil {
+			return err
+		}
+		if pf.expired(&f) {
+			return tx.Delete(PollFiltersTable, k[:], nil)
+		}
+		found = true
+		if err = poll(&f); err != nil {
+			return err
+		}
+		f.LastPoll = pf.now().Unix()
+		if v, err = json.Marshal(&f); err != nil {
+			return err
+		}
+		return tx.Put(PollFiltersTable, k[:], v)
+	})
+	if err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+// Uninstall - false if filter is not installed
+func (pf *PollFilters) Uninstall(id uint64) (bool, error) {
+	var k [8]byte
+	binary.BigEndian.PutUint64(k[:], id)
+	var found bool
+	err := pf.db.Update(context.Background(), func(tx kv.RwTx) error {
+		v, err := tx.GetOne(PollFiltersTable, k[:])
+		if err != nil || v == nil {
+			return err
+		}
+		found = true
+		return tx.Delete(PollFiltersTable, k[:], nil)
+	})
+	return found, err
+}
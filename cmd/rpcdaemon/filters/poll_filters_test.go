@@ -0,0 +1,51 @@
+package filters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollFilters(t *testing.T) {
+	dir := t.TempDir()
+	cfg := PollFiltersConfig{TTL: time.Minute, MaxPerClient: 2}
+	pf, err := OpenPollFilters(dir, cfg, log.New())
+	require.NoError(t, err)
+	id1, err := pf.Install(&PollFilter{Kind: BlockPollFilter, Client: "10.0.0.1", Next: 5})
+	require.NoError(t, err)
+	_, err = pf.Install(&PollFilter{Kind: LogsPollFilter, Client: "10.0.0.1", Next: 5})
+	require.NoError(t, err)
+	_, err = pf.Install(&PollFilter{Kind: LogsPollFilter, Client: "10.0.0.1", Next: 5})
+	require.ErrorIs(t, err, ErrTooManyFilters)
+	_, err = pf.Install(&PollFilter{Kind: LogsPollFilter, Client: "10.0.0.2", Next: 5})
+	require.NoError(t, err)
+
+	// filters are kept over restart
+	pf.Close()
+	pf, err = OpenPollFilters(dir, cfg, log.New())
+	require.NoError(t, err)
+	defer pf.Close()
+	found, err := pf.Poll(id1, func(f *PollFilter) error {
+		require.Equal(t, BlockPollFilter, f.Kind)
+		require.Equal(t, uint64(5), f.Next)
+		f.Next = 7
+		return nil
+	})
+	require.NoError(t, err)
+	require.True(t, found)
+
+	// not polled for TTL
+	now := time.Now()
+	pf.now = func() time.Time { return now.Add(2 * time.Minute) }
+	found, err = pf.Poll(id1, func(f *PollFilter) error { return nil })
+	require.NoError(t, err)
+	require.False(t, found)
+	_, err = pf.Install(&PollFilter{Kind: LogsPollFilter, Client: "10.0.0.1", Next: 5})
+	require.NoError(t, err)
+
+	found, err = pf.Uninstall(id1)
+	require.NoError(t, err)
+	require.False(t, found)
+}
@@ -5,19 +5,19 @@ import (
 	"fmt"
 )
 
-func checkMinPeers(minPeerCount uint, api NetAPI) error {
+func checkMinPeers(minPeerCount uint, api NetAPI) (uint64, error) {
 	if api == nil {
-		return fmt.Errorf("no connection to the Erigon server or `net` namespace isn't enabled")
+		return 0, fmt.Errorf("no connection to the Erigon server or `net` namespace isn't enabled")
 	}
 
 	peerCount, err := api.PeerCount(context.TODO())
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	if uint64(peerCount) < uint64(minPeerCount) {
-		return fmt.Errorf("not enough peers: %d (minimum %d))", peerCount, minPeerCount)
+		return uint64(peerCount), fmt.Errorf("not enough peers: %d (minimum %d))", peerCount, minPeerCount)
 	}
 
-	return nil
+	return uint64(peerCount), nil
 }
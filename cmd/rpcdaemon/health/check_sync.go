@@ -0,0 +1,57 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+// checkBlocksBehind - executed block is at most maxBlocksBehind behind the highest known header
+func checkBlocksBehind(maxBlocksBehind uint64, api EthAPI) (uint64, error) {
+	if api == nil {
+		return 0, fmt.Errorf("no connection to the Erigon server or `eth` namespace isn't enabled")
+	}
+	syncing, err := api.Syncing(context.TODO())
+	if err != nil {
+		return 0, err
+	}
+	var behind uint64
+	// false if not syncing, progress otherwise
+	if progress, ok := syncing.(map[string]interface{}); ok {
+		current, _ := progress["currentBlock"].(hexutil.Uint64)
+		highest, _ := progress["highestBlock"].(hexutil.Uint64)
+		if highest > current {
+			behind = uint64(highest - current)
+		}
+	}
+	if behind > maxBlocksBehind {
+		return behind, fmt.Errorf("%d blocks behind head (maximum %d)", behind, maxBlocksBehind)
+	}
+	return behind, nil
+}
+
+// checkSecondsBehind - the latest executed block is at most maxSecondsBehind old
+func checkSecondsBehind(maxSecondsBehind uint64, api EthAPI, now time.Time) (uint64, error) {
+	if api == nil {
+		return 0, fmt.Errorf("no connection to the Erigon server or `eth` namespace isn't enabled")
+	}
+	block, err := api.GetBlockByNumber(context.TODO(), rpc.LatestBlockNumber, false)
+	if err != nil {
+		return 0, err
+	}
+	timestamp, ok := block["timestamp"].(hexutil.Uint64)
+	if !ok {
+		return 0, fmt.Errorf("no latest block")
+	}
+	var behind uint64
+	if uint64(now.Unix()) > uint64(timestamp) {
+		behind = uint64(now.Unix()) - uint64(timestamp)
+	}
+	if behind > maxSecondsBehind {
+		return behind, fmt.Errorf("latest block is %d seconds old (maximum %d)", behind, maxSecondsBehind)
+	}
+	return behind, nil
+}
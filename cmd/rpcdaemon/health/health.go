@@ -1,21 +1,38 @@
 package health
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/log/v3"
 )
 
 type requestBody struct {
-	MinPeerCount *uint            `json:"min_peer_count"`
-	BlockNumber  *rpc.BlockNumber `json:"known_block"`
+	MinPeerCount     *uint            `json:"min_peer_count"`
+	BlockNumber      *rpc.BlockNumber `json:"known_block"`
+	MaxBlocksBehind  *uint64          `json:"max_blocks_behind"`
+	MaxSecondsBehind *uint64          `json:"max_seconds_behind"`
+}
+
+// measurements - values found by enabled checks, for dashboards and probes' logs
+type measurements struct {
+	PeerCount     *uint64 `json:"peer_count,omitempty"`
+	BlocksBehind  *uint64 `json:"blocks_behind,omitempty"`
+	SecondsBehind *uint64 `json:"seconds_behind,omitempty"`
+}
+
+// checks - errors of checks by name, errCheckDisabled for checks which are not requested
+type checks struct {
+	query, minPeerCount, checkBlock, maxBlocksBehind, maxSecondsBehind error
 }
 
 const (
@@ -26,6 +43,9 @@ var (
 	errCheckDisabled = errors.New("error check disabled")
 )
 
+// ProcessHealthcheckIfNeeded - serves /health. Checks are configured by JSON body, query parameters
+// (`/health?max_blocks_behind=10&min_peer_count=3`) or headers (`X-Health-Max-Blocks-Behind: 10`), parameters override
+// body. Responds 200 if all requested checks pass, 500 otherwise - for Kubernetes readiness probes and load balancers.
 func ProcessHealthcheckIfNeeded(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -37,27 +57,49 @@ func ProcessHealthcheckIfNeeded(
 
 	netAPI, ethAPI := parseAPI(rpcAPI)
 
-	var errMinPeerCount = errCheckDisabled
-	var errCheckBlock = errCheckDisabled
+	c := checks{
+		minPeerCount:     errCheckDisabled,
+		checkBlock:       errCheckDisabled,
+		maxBlocksBehind:  errCheckDisabled,
+		maxSecondsBehind: errCheckDisabled,
+	}
+	var m measurements
 
 	body, errParse := parseHealthCheckBody(r.Body)
 	defer r.Body.Close()
+	if errParse == nil {
+		errParse = parseHealthCheckParams(r, &body)
+	}
+	c.query = errParse
 
 	if errParse != nil {
 		log.Root().Warn("unable to process healthcheck request", "error", errParse)
 	} else {
 		// 1. net_peerCount
 		if body.MinPeerCount != nil {
-			errMinPeerCount = checkMinPeers(*body.MinPeerCount, netAPI)
+			var peers uint64
+			peers, c.minPeerCount = checkMinPeers(*body.MinPeerCount, netAPI)
+			m.PeerCount = &peers
 		}
 		// 2. custom query (shouldn't fail)
 		if body.BlockNumber != nil {
-			errCheckBlock = checkBlockNumber(*body.BlockNumber, ethAPI)
+			c.checkBlock = checkBlockNumber(*body.BlockNumber, ethAPI)
+		}
+		// 3. eth_syncing
+		if body.MaxBlocksBehind != nil {
+			var behind uint64
+			behind, c.maxBlocksBehind = checkBlocksBehind(*body.MaxBlocksBehind, ethAPI)
+			m.BlocksBehind = &behind
+		}
+		// 4. timestamp of the latest block
+		if body.MaxSecondsBehind != nil {
+			var behind uint64
+			behind, c.maxSecondsBehind = checkSecondsBehind(*body.MaxSecondsBehind, ethAPI, time.Now())
+			m.SecondsBehind = &behind
 		}
-		// TODO add time from the last sync cycle
 	}
 
-	err := reportHealth(errParse, errMinPeerCount, errCheckBlock, w)
+	err := reportHealth(c, m, w)
 	if err != nil {
 		log.Root().Warn("unable to process healthcheck request", "error", err)
 	}
@@ -65,6 +107,7 @@ func ProcessHealthcheckIfNeeded(
 	return true
 }
 
+// parseHealthCheckBody - empty body is allowed: checks are given by parameters
 func parseHealthCheckBody(reader io.Reader) (requestBody, error) {
 	var body requestBody
 
@@ -72,6 +115,9 @@ func parseHealthCheckBody(reader io.Reader) (requestBody, error) {
 	if err != nil {
 		return body, err
 	}
+	if len(bytes.TrimSpace(bodyBytes)) == 0 {
+		return body, nil
+	}
 
 	err = json.Unmarshal(bodyBytes, &body)
 	if err != nil {
@@ -81,28 +127,74 @@ func parseHealthCheckBody(reader io.Reader) (requestBody, error) {
 	return body, nil
 }
 
-func reportHealth(errParse, errMinPeerCount, errCheckBlock error, w http.ResponseWriter) error {
-	statusCode := http.StatusOK
-	errors := make(map[string]string)
-
-	if shouldChangeStatusCode(errParse) {
-		statusCode = http.StatusInternalServerError
+// parseHealthCheckParams - query parameter `name` or header `X-Health-Name` (e.g. max_blocks_behind or
+// X-Health-Max-Blocks-Behind) of each check
+func parseHealthCheckParams(r *http.Request, body *requestBody) error {
+	param := func(name string) string {
+		if v := r.URL.Query().Get(name); v != "" {
+			return v
+		}
+		return r.Header.Get("X-Health-" + strings.ReplaceAll(name, "_", "-"))
 	}
-	errors["healthcheck_query"] = errorStringOrOK(errParse)
-
-	if shouldChangeStatusCode(errMinPeerCount) {
-		statusCode = http.StatusInternalServerError
+	parseUint := func(name string) (*uint64, error) {
+		v := param(name)
+		if v == "" {
+			return nil, nil
+		}
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return &n, nil
+	}
+	if n, err := parseUint("min_peer_count"); err != nil {
+		return err
+	} else if n != nil {
+		peers := uint(*n)
+		body.MinPeerCount = &peers
 	}
-	errors["min_peer_count"] = errorStringOrOK(errMinPeerCount)
+	if v := param("known_block"); v != "" {
+		var number rpc.BlockNumber
+		if err := number.UnmarshalJSON([]byte(strconv.Quote(v))); err != nil {
+			return fmt.Errorf("known_block: %w", err)
+		}
+		body.BlockNumber = &number
+	}
+	for name, field := range map[string]**uint64{"max_blocks_behind": &body.MaxBlocksBehind, "max_seconds_behind": &body.MaxSecondsBehind} {
+		n, err := parseUint(name)
+		if err != nil {
+			return err
+		}
+		if n != nil {
+			*field = n
+		}
+	}
+	return nil
+}
 
-	if shouldChangeStatusCode(errCheckBlock) {
-		statusCode = http.StatusInternalServerError
+func reportHealth(c checks, m measurements, w http.ResponseWriter) error {
+	statusCode := http.StatusOK
+	response := make(map[string]interface{})
+
+	for name, err := range map[string]error{
+		"healthcheck_query":  c.query,
+		"min_peer_count":     c.minPeerCount,
+		"check_block":        c.checkBlock,
+		"max_blocks_behind":  c.maxBlocksBehind,
+		"max_seconds_behind": c.maxSecondsBehind,
+	} {
+		if shouldChangeStatusCode(err) {
+			statusCode = http.StatusInternalServerError
+		}
+		response[name] = errorStringOrOK(err)
 	}
-	errors["check_block"] = errorStringOrOK(errCheckBlock)
+	response["healthy"] = statusCode == http.StatusOK
+	response["status"] = m
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
-	bodyJson, err := json.Marshal(errors)
+	bodyJson, err := json.Marshal(response)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,94 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+type netAPIMock struct{ peers uint }
+
+func (a netAPIMock) PeerCount(context.Context) (hexutil.Uint, error) {
+	return hexutil.Uint(a.peers), nil
+}
+
+type ethAPIMock struct {
+	current, highest uint64
+	timestamp        time.Time
+}
+
+func (a ethAPIMock) GetBlockByNumber(context.Context, rpc.BlockNumber, bool) (map[string]interface{}, error) {
+	return map[string]interface{}{"number": hexutil.Uint64(a.current), "timestamp": hexutil.Uint64(a.timestamp.Unix())}, nil
+}
+
+func (a ethAPIMock) Syncing(context.Context) (interface{}, error) {
+	if a.current >= a.highest {
+		return false, nil
+	}
+	return map[string]interface{}{"currentBlock": hexutil.Uint64(a.current), "highestBlock": hexutil.Uint64(a.highest)}, nil
+}
+
+func TestProcessHealthcheck(t *testing.T) {
+	apis := []rpc.API{
+		{Namespace: "net", Service: netAPIMock{peers: 5}},
+		{Namespace: "eth", Service: ethAPIMock{current: 90, highest: 100, timestamp: time.Now().Add(-time.Minute)}},
+	}
+	for _, tc := range []struct {
+		name    string
+		request func() *http.Request
+		code    int
+		checks  map[string]string
+	}{
+		{
+			name: "query",
+			request: func() *http.Request {
+				return httptest.NewRequest("GET", "/health?min_peer_count=3&max_blocks_behind=10", nil)
+			},
+			code:   http.StatusOK,
+			checks: map[string]string{"min_peer_count": "HEALTHY", "max_blocks_behind": "HEALTHY", "max_seconds_behind": "DISABLED"},
+		},
+		{
+			name: "header",
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", "/health", nil)
+				r.Header.Set("X-Health-Max-Seconds-Behind", "30")
+				return r
+			},
+			code:   http.StatusInternalServerError,
+			checks: map[string]string{"max_seconds_behind": "ERROR: latest block is 6"},
+		},
+		{
+			name: "query overrides body",
+			request: func() *http.Request {
+				return httptest.NewRequest("POST", "/health?max_blocks_behind=5", strings.NewReader(`{"max_blocks_behind": 20}`))
+			},
+			code:   http.StatusInternalServerError,
+			checks: map[string]string{"max_blocks_behind": "ERROR: 10 blocks behind head (maximum 5)"},
+		},
+		{
+			name:    "invalid",
+			request: func() *http.Request { return httptest.NewRequest("GET", "/health?min_peer_count=many", nil) },
+			code:    http.StatusInternalServerError,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			require.True(t, ProcessHealthcheckIfNeeded(w, tc.request(), apis))
+			require.Equal(t, tc.code, w.Code)
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.Equal(t, tc.code == http.StatusOK, response["healthy"])
+			for check, status := range tc.checks {
+				require.True(t, strings.HasPrefix(response[check].(string), status), "%s: %s", check, response[check])
+			}
+		})
+	}
+}
@@ -23,8 +23,14 @@ type BodyReader interface {
 	BodyRlp(ctx context.Context, tx kv.Tx, hash common.Hash, blockHeight uint64) (bodyRlp rlp.RawValue, err error)
 }
 
+// UnclesReader - allows read uncles of block without decoding it's transactions
+type UnclesReader interface {
+	Uncles(ctx context.Context, tx kv.Tx, hash common.Hash, blockHeight uint64) (uncles []*types.Header, err error)
+}
+
 type FullBlockReader interface {
 	BlockReader
 	BodyReader
 	HeaderReader
+	UnclesReader
 }
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"os"
 
+	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/cli"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/commands"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/filters"
@@ -16,21 +18,71 @@ func main() {
 	rootCtx, rootCancel := utils.RootContext()
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
 		logger := log.New()
-		db, backend, txPool, mining, stateCache, blockReader, err := cli.RemoteServices(cmd.Context(), *cfg, logger, rootCancel)
+		db, backend, txPool, mining, stateCache, blockReader, history, err := cli.RemoteServices(cmd.Context(), *cfg, logger, rootCancel)
 		if err != nil {
 			log.Error("Could not connect to DB", "error", err)
 			return nil
 		}
 		defer db.Close()
+		borDB, err := cli.OpenBorDB(*cfg, logger)
+		if err != nil {
+			log.Error("Could not open bor DB", "error", err)
+			return nil
+		}
+		if borDB != nil {
+			defer borDB.Close()
+		}
+		cliqueDB, err := cli.OpenCliqueDB(*cfg, logger)
+		if err != nil {
+			log.Error("Could not open clique DB", "error", err)
+			return nil
+		}
+		if cliqueDB != nil {
+			defer cliqueDB.Close()
+		}
+
+		var networks []cli.Network
+		pollFiltersDir := cfg.PollFiltersDir
+		if len(cfg.PrivateApiNetworks) > 0 {
+			chainID, err := cli.ReadChainID(cmd.Context(), db)
+			if err != nil {
+				log.Error("Could not read chain id", "error", err)
+				return nil
+			}
+			networks = append(networks, cli.Network{ChainID: chainID})
+			pollFiltersDir = cli.PollFiltersDir(cfg.PollFiltersDir, chainID)
+		}
+		pollFilters, err := filters.OpenPollFilters(pollFiltersDir, filters.PollFiltersConfig{TTL: cfg.PollFiltersTTL, MaxPerClient: cfg.MaxFiltersPerClient}, logger)
+		if err != nil {
+			log.Error("Could not open filters DB", "error", err)
+			return nil
+		}
+		defer pollFilters.Close()
 
 		var ff *filters.Filters
 		if backend != nil {
 			ff = filters.New(rootCtx, backend, txPool, mining)
+			ff.WatchLocalTxs(rootCtx, db, blockReader, txPool)
 		} else {
 			log.Info("filters are not supported in chaindata mode")
 		}
 
-		if err := cli.StartRpcServer(cmd.Context(), *cfg, commands.APIList(cmd.Context(), db, backend, txPool, mining, ff, stateCache, blockReader, *cfg, nil)); err != nil {
+		apiList := commands.APIList(cmd.Context(), db, borDB, cliqueDB, backend, txPool, mining, ff, pollFilters, stateCache, blockReader, history, *cfg, nil)
+
+		if len(networks) > 0 {
+			networks[0].APIs = apiList
+		}
+		for _, entry := range cfg.PrivateApiNetworks {
+			network, closeNetwork, err := openNetwork(cmd.Context(), rootCtx, cli.NetworkFlags(*cfg, entry), logger, rootCancel)
+			if err != nil {
+				log.Error("Could not connect to network", "network", entry, "error", err)
+				return nil
+			}
+			defer closeNetwork()
+			networks = append(networks, network)
+		}
+
+		if err := cli.StartRpcServer(cmd.Context(), *cfg, apiList, networks...); err != nil {
 			log.Error(err.Error())
 			return nil
 		}
@@ -42,3 +94,48 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// openNetwork connects to an additional chain of --private.api.networks and creates its APIs
+func openNetwork(ctx, rootCtx context.Context, cfg cli.Flags, logger log.Logger, rootCancel context.CancelFunc) (cli.Network, func(), error) {
+	db, backend, txPool, mining, stateCache, blockReader, history, err := cli.RemoteServices(ctx, cfg, logger, rootCancel)
+	if err != nil {
+		return cli.Network{}, nil, err
+	}
+	chainID, err := cli.ReadChainID(ctx, db)
+	if err != nil {
+		db.Close()
+		return cli.Network{}, nil, err
+	}
+	borDB, err := cli.OpenBorDB(cfg, logger)
+	if err != nil {
+		db.Close()
+		return cli.Network{}, nil, err
+	}
+	cliqueDB, err := cli.OpenCliqueDB(cfg, logger)
+	if err != nil {
+		closeDBs(db, borDB)
+		return cli.Network{}, nil, err
+	}
+	pollFilters, err := filters.OpenPollFilters(cli.PollFiltersDir(cfg.PollFiltersDir, chainID), filters.PollFiltersConfig{TTL: cfg.PollFiltersTTL, MaxPerClient: cfg.MaxFiltersPerClient}, logger)
+	if err != nil {
+		closeDBs(db, borDB, cliqueDB)
+		return cli.Network{}, nil, err
+	}
+	ff := filters.New(rootCtx, backend, txPool, mining)
+	ff.WatchLocalTxs(rootCtx, db, blockReader, txPool)
+
+	apiList := commands.APIList(ctx, db, borDB, cliqueDB, backend, txPool, mining, ff, pollFilters, stateCache, blockReader, history, cfg, nil)
+	return cli.Network{ChainID: chainID, APIs: apiList}, func() {
+		pollFilters.Close()
+		closeDBs(db, borDB, cliqueDB)
+	}, nil
+}
+
+// closeDBs closes opened databases of a network, bor and clique ones are nil if they are not available
+func closeDBs(dbs ...kv.RoDB) {
+	for _, db := range dbs {
+		if db != nil {
+			db.Close()
+		}
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/ethdb/privateapi"
 	"github.com/ledgerwatch/erigon/p2p"
+	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/log/v3"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/status"
@@ -37,10 +38,16 @@ type ApiBackend interface {
 	EngineForkchoiceUpdateV1(ctx context.Context, request *remote.EngineForkChoiceUpdatedRequest) (*remote.EngineForkChoiceUpdatedReply, error)
 	EngineGetPayloadV1(ctx context.Context, payloadId uint64) (*types2.ExecutionPayload, error)
 	NodeInfo(ctx context.Context, limit uint32) ([]p2p.NodeInfo, error)
+	Rewind(ctx context.Context, to uint64) error
+	UpdateChainConfig(ctx context.Context, cfg *params.ChainConfig) error
+	Sentries(ctx context.Context) ([]privateapi.SentryInfo, error)
+	Peers(ctx context.Context) ([]privateapi.PeerInfo, error)
+	SetLogLevel(ctx context.Context, subsystem, level string) (map[string]string, error)
 }
 
 type RemoteBackend struct {
 	remoteEthBackend remote.ETHBACKENDClient
+	admin            *privateapi.AdminClient
 	log              log.Logger
 	version          gointerfaces.Version
 	db               kv.RoDB
@@ -50,6 +57,7 @@ type RemoteBackend struct {
 func NewRemoteBackend(cc grpc.ClientConnInterface, db kv.RoDB, blockReader interfaces.BlockReader) *RemoteBackend {
 	return &RemoteBackend{
 		remoteEthBackend: remote.NewETHBACKENDClient(cc),
+		admin:            privateapi.NewAdminClient(cc),
 		version:          gointerfaces.VersionFromProto(privateapi.EthBackendAPIVersion),
 		log:              log.New("remote_service", "eth_backend"),
 		db:               db,
@@ -217,3 +225,28 @@ func (back *RemoteBackend) NodeInfo(ctx context.Context, limit uint32) ([]p2p.No
 
 	return ret, nil
 }
+
+// Rewind - unwinds all stages of the node to block to, see debug_rewindToBlock
+func (back *RemoteBackend) Rewind(ctx context.Context, to uint64) error {
+	return back.admin.Rewind(ctx, to)
+}
+
+// UpdateChainConfig - schedules forks of the node, see admin_updateChainConfig
+func (back *RemoteBackend) UpdateChainConfig(ctx context.Context, cfg *params.ChainConfig) error {
+	return back.admin.UpdateChainConfig(ctx, cfg)
+}
+
+// Sentries - sentries of the node with labels and request counters, see admin_sentries
+func (back *RemoteBackend) Sentries(ctx context.Context) ([]privateapi.SentryInfo, error) {
+	return back.admin.Sentries(ctx)
+}
+
+// Peers - peers of all sentries of the node, see admin_peers
+func (back *RemoteBackend) Peers(ctx context.Context) ([]privateapi.PeerInfo, error) {
+	return back.admin.Peers(ctx)
+}
+
+// SetLogLevel - changes log level of subsystem of the node, see admin_setLogLevel
+func (back *RemoteBackend) SetLogLevel(ctx context.Context, subsystem, level string) (map[string]string, error) {
+	return back.admin.SetLogLevel(ctx, subsystem, level)
+}
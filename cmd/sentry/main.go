@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 
+	"github.com/ledgerwatch/erigon/cmd/downloader/downloadergrpc"
 	"github.com/ledgerwatch/erigon/cmd/sentry/sentry"
 	"github.com/ledgerwatch/erigon/cmd/utils"
 	"github.com/ledgerwatch/erigon/common/paths"
@@ -27,21 +28,31 @@ var (
 	trustedPeers []string // trusted peers
 	discoveryDNS []string
 	nodiscover   bool // disable sentry's discovery mechanism
+	discoveryV5  bool // discv5 alongside discv4
 	protocol     string
 	netRestrict  string // CIDR to restrict peering to
 	healthCheck  bool
+
+	maxDownloadMbps float64 // cap of download rate, 0 - not capped
+	maxUploadMbps   float64 // cap of upload rate, 0 - not capped
+
+	downloaderAddr string // share bandwidth limits of Downloader
 )
 
 func init() {
 	utils.CobraFlags(rootCmd, append(debug.Flags, utils.MetricFlags...))
 
-	rootCmd.Flags().StringVar(&natSetting, "nat", "", `NAT port mapping mechanism (any|none|upnp|pmp|extip:<IP>)
-	     "" or "none"         default - do not nat
+	rootCmd.Flags().StringVar(&natSetting, "nat", "any", `NAT port mapping mechanism (any|none|upnp|pmp|stun|extip:<IP>)
+	     "none"               do not nat
 	     "extip:77.12.33.4"   will assume the local machine is reachable on the given IP
-	     "any"                uses the first auto-detected mechanism
+	     "any"                default - uses the first auto-detected mechanism
 	     "upnp"               uses the Universal Plug and Play protocol
 	     "pmp"                uses NAT-PMP with an auto-detected gateway address
 	     "pmp:192.168.0.1"    uses NAT-PMP with the given gateway address
+	     "stun"               only detects external IP by STUN servers, ports are forwarded manually
+	     "stun:<host>:<port>" uses the given STUN server
+	External IP is asked from STUN servers if the router doesn't know it (e.g. carrier-grade NAT).
+	Ports are mapped again when local network changes.
 `)
 	rootCmd.Flags().IntVar(&port, "port", 30303, "p2p port number")
 	rootCmd.Flags().StringVar(&sentryAddr, "sentry.api.addr", "localhost:9091", "grpc addresses")
@@ -50,9 +61,13 @@ func init() {
 	rootCmd.Flags().StringSliceVar(&trustedPeers, "trustedpeers", []string{}, "trusted peer list [enode]")
 	rootCmd.Flags().StringSliceVar(&discoveryDNS, utils.DNSDiscoveryFlag.Name, []string{}, utils.DNSDiscoveryFlag.Usage)
 	rootCmd.Flags().BoolVar(&nodiscover, utils.NoDiscoverFlag.Name, false, utils.NoDiscoverFlag.Usage)
+	rootCmd.Flags().BoolVar(&discoveryV5, utils.DiscoveryV5Flag.Name, false, utils.DiscoveryV5Flag.Usage)
 	rootCmd.Flags().StringVar(&netRestrict, "netrestrict", "", "CIDR range to accept peers from <CIDR>")
 	rootCmd.Flags().StringVar(&datadir, utils.DataDirFlag.Name, paths.DefaultDataDir(), utils.DataDirFlag.Usage)
 	rootCmd.Flags().BoolVar(&healthCheck, utils.HealthCheckFlag.Name, false, utils.HealthCheckFlag.Usage)
+	rootCmd.Flags().Float64Var(&maxDownloadMbps, utils.P2PMaxDownloadMbpsFlag.Name, 0, utils.P2PMaxDownloadMbpsFlag.Usage)
+	rootCmd.Flags().Float64Var(&maxUploadMbps, utils.P2PMaxUploadMbpsFlag.Name, 0, utils.P2PMaxUploadMbpsFlag.Usage)
+	rootCmd.Flags().StringVar(&downloaderAddr, "downloader.api.addr", "", "share bandwidth limits of Downloader at this address, see --bandwidth.weights of Downloader (empty - not limited)")
 	if err := rootCmd.MarkFlagDirname(utils.DataDirFlag.Name); err != nil {
 		panic(err)
 	}
@@ -81,6 +96,18 @@ var rootCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		p2pConfig.DiscoveryV5 = discoveryV5
+		p2pConfig.MaxDownloadMbps = maxDownloadMbps
+		p2pConfig.MaxUploadMbps = maxUploadMbps
+		if downloaderAddr != "" {
+			conn, err := downloadergrpc.NewConn(cmd.Context(), downloaderAddr)
+			if err != nil {
+				return err
+			}
+			share := downloadergrpc.NewBandwidthShare(cmd.Context(), downloadergrpc.BandwidthClassP2P)
+			go share.Loop(cmd.Context(), conn, downloadergrpc.BandwidthReportInterval)
+			p2pConfig.WrapConn = share.Conn
+		}
 		return sentry.Sentry(datadir, sentryAddr, discoveryDNS, p2pConfig, uint(p), healthCheck)
 	},
 }
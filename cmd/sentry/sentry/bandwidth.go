@@ -0,0 +1,112 @@
+package sentry
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon/eth/protocols/eth"
+	"github.com/ledgerwatch/erigon/p2p"
+	"golang.org/x/time/rate"
+)
+
+// bandwidthBurst - bytes which can be transferred at once, bigger messages wait for several bursts
+const bandwidthBurst = 256 * 1024
+
+// Bandwidth - accounts `eth` messages of all peers of sentry by direction and message id, and caps their rate
+// by token buckets. Received message is accounted after it is read, so the cap delays reading of next messages
+// and TCP flow control slows down the peer. Handshakes of RLPx, pings and discovery are not accounted.
+type Bandwidth struct {
+	download, upload *rate.Limiter
+	// counters of sentry_traffic_bytes metric by message code
+	downloaded, uploaded map[uint64]*metrics.Counter
+	downloadedOther      *metrics.Counter
+	uploadedOther        *metrics.Counter
+}
+
+// NewBandwidth - caps in megabits per second, 0 - not capped
+func NewBandwidth(protocol uint, downloadMbps, uploadMbps float64) *Bandwidth {
+	b := &Bandwidth{
+		download:        rate.NewLimiter(mbpsLimit(downloadMbps), bandwidthBurst),
+		upload:          rate.NewLimiter(mbpsLimit(uploadMbps), bandwidthBurst),
+		downloaded:      map[uint64]*metrics.Counter{},
+		uploaded:        map[uint64]*metrics.Counter{},
+		downloadedOther: trafficCounter("download", "other"),
+		uploadedOther:   trafficCounter("upload", "other"),
+	}
+	for code, id := range eth.ToProto[protocol] {
+		b.downloaded[code] = trafficCounter("download", id.String())
+		b.uploaded[code] = trafficCounter("upload", id.String())
+	}
+	return b
+}
+
+func trafficCounter(direction, msg string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`sentry_traffic_bytes{direction="%s",msg="%s"}`, direction, msg))
+}
+
+func mbpsLimit(mbps float64) rate.Limit {
+	if mbps <= 0 || math.IsInf(mbps, 1) {
+		return rate.Inf
+	}
+	return rate.Limit(mbps * 1_000_000 / 8)
+}
+
+// Wrap - message stream of peer, accounted and capped by b. Waiting for the cap stops when ctx is done - peer is
+// disconnected or sentry stops.
+func (b *Bandwidth) Wrap(ctx context.Context, rw p2p.MsgReadWriter) p2p.MsgReadWriter {
+	return &bandwidthRW{ctx: ctx, rw: rw, b: b}
+}
+
+func account(counters map[uint64]*metrics.Counter, other *metrics.Counter, code uint64, size uint32) {
+	if c, ok := counters[code]; ok {
+		c.Add(int(size))
+		return
+	}
+	other.Add(int(size))
+}
+
+// wait - blocks until size bytes fit into limiter or ctx is done
+func wait(ctx context.Context, limiter *rate.Limiter, size uint32) error {
+	if limiter.Limit() == rate.Inf {
+		return nil
+	}
+	for n := int(size); n > 0; n -= bandwidthBurst {
+		chunk := n
+		if chunk > bandwidthBurst {
+			chunk = bandwidthBurst
+		}
+		if err := limiter.WaitN(ctx, chunk); err != nil { // chunk never exceeds burst, only ctx fails it
+			return err
+		}
+	}
+	return nil
+}
+
+type bandwidthRW struct {
+	ctx context.Context
+	rw  p2p.MsgReadWriter
+	b   *Bandwidth
+}
+
+func (rw *bandwidthRW) ReadMsg() (p2p.Msg, error) {
+	msg, err := rw.rw.ReadMsg()
+	if err != nil {
+		return msg, err
+	}
+	account(rw.b.downloaded, rw.b.downloadedOther, msg.Code, msg.Size)
+	if err = wait(rw.ctx, rw.b.download, msg.Size); err != nil {
+		msg.Discard()
+		return p2p.Msg{}, err
+	}
+	return msg, nil
+}
+
+func (rw *bandwidthRW) WriteMsg(msg p2p.Msg) error {
+	if err := wait(rw.ctx, rw.b.upload, msg.Size); err != nil {
+		return err
+	}
+	account(rw.b.uploaded, rw.b.uploadedOther, msg.Code, msg.Size)
+	return rw.rw.WriteMsg(msg)
+}
@@ -0,0 +1,77 @@
+package sentry
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon/eth/protocols/eth"
+	"github.com/ledgerwatch/erigon/p2p"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestBandwidthAccounting(t *testing.T) {
+	b := NewBandwidth(eth.ETH66, 0, 0)
+	downloaded, uploaded := b.downloaded[eth.BlockHeadersMsg], b.uploaded[eth.GetBlockHeadersMsg]
+	downloadedBefore, uploadedBefore, otherBefore := downloaded.Get(), uploaded.Get(), b.downloadedOther.Get()
+
+	local, remote := p2p.MsgPipe()
+	defer local.Close()
+	rw := b.Wrap(context.Background(), local)
+	go func() {
+		_ = p2p.Send(remote, eth.BlockHeadersMsg, []uint{1, 2, 3})
+		_ = p2p.Send(remote, 0x7f, []uint{1})
+		msg, err := remote.ReadMsg()
+		if err == nil {
+			msg.Discard()
+		}
+	}()
+
+	msg, err := rw.ReadMsg()
+	require.NoError(t, err)
+	msg.Discard()
+	require.Equal(t, downloadedBefore+uint64(msg.Size), downloaded.Get())
+	msg, err = rw.ReadMsg()
+	require.NoError(t, err)
+	msg.Discard()
+	require.Equal(t, otherBefore+uint64(msg.Size), b.downloadedOther.Get())
+
+	require.NoError(t, rw.WriteMsg(p2p.Msg{Code: eth.GetBlockHeadersMsg, Size: 5, Payload: bytes.NewReader(make([]byte, 5))}))
+	require.Equal(t, uploadedBefore+5, uploaded.Get())
+}
+
+func TestBandwidthCap(t *testing.T) {
+	b := NewBandwidth(eth.ETH66, 0, 8) // 1MB/s upload
+	local, remote := p2p.MsgPipe()
+	defer local.Close()
+	go func() {
+		for {
+			msg, err := remote.ReadMsg()
+			if err != nil {
+				return
+			}
+			msg.Discard()
+		}
+	}()
+	rw := b.Wrap(context.Background(), local)
+	size := uint32(bandwidthBurst + 512*1024) // first burst is free, rest takes 0.5s
+	start := time.Now()
+	require.NoError(t, rw.WriteMsg(p2p.Msg{Code: eth.BlockBodiesMsg, Size: size, Payload: bytes.NewReader(make([]byte, size))}))
+	require.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+
+	// waiting stops when peer is disconnected
+	ctx, cancel := context.WithCancel(context.Background())
+	rw = b.Wrap(ctx, local)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start = time.Now()
+	err := rw.WriteMsg(p2p.Msg{Code: eth.BlockBodiesMsg, Size: 8 * bandwidthBurst, Payload: bytes.NewReader(make([]byte, 8*bandwidthBurst))})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(start), time.Second)
+
+	require.Equal(t, rate.Inf, mbpsLimit(0))
+}
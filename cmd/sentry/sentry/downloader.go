@@ -338,6 +338,13 @@ type ControlServerImpl struct {
 	networkId   uint64
 	db          kv.RwDB
 	Engine      consensus.Engine
+	// routing of requests between sentries, see SetSentryRouting
+	routingLock  sync.RWMutex
+	sentryAddrs  []string
+	sentryLabels []SentryLabels
+	routing      RoutingPolicy
+	sentryStats  []sentryStats
+	peersInfo    []PeersInfoSource // see SetPeersInfo
 }
 
 func NewControlServer(db kv.RwDB, nodeName string, chainConfig *params.ChainConfig, genesisHash common.Hash, engine consensus.Engine, networkID uint64, sentries []direct.SentryClient, window int) (*ControlServerImpl, error) {
@@ -356,12 +363,13 @@ func NewControlServer(db kv.RwDB, nodeName string, chainConfig *params.ChainConf
 	bd := bodydownload.NewBodyDownload(window /* outstandingLimit */, engine)
 
 	cs := &ControlServerImpl{
-		nodeName: nodeName,
-		Hd:       hd,
-		Bd:       bd,
-		sentries: sentries,
-		db:       db,
-		Engine:   engine,
+		nodeName:    nodeName,
+		Hd:          hd,
+		Bd:          bd,
+		sentries:    sentries,
+		db:          db,
+		Engine:      engine,
+		sentryStats: make([]sentryStats, len(sentries)),
 	}
 	cs.ChainConfig = chainConfig
 	cs.forks = forkid.GatherForks(cs.ChainConfig)
@@ -746,7 +754,8 @@ func makeStatusData(s *ControlServerImpl) *proto_sentry.StatusData {
 	}
 }
 
-func GrpcClient(ctx context.Context, sentryAddr string) (*direct.SentryClientRemote, error) {
+// GrpcClient - clients of "sentry.Sentry" and "sentry.PeersInfo" services of standalone sentry
+func GrpcClient(ctx context.Context, sentryAddr string) (*direct.SentryClientRemote, *PeersInfoClient, error) {
 	// creating grpc client connection
 	var dialOpts []grpc.DialOption
 
@@ -760,9 +769,13 @@ func GrpcClient(ctx context.Context, sentryAddr string) (*direct.SentryClientRem
 	}
 
 	dialOpts = append(dialOpts, grpc.WithInsecure())
+	sentryAddr, _, err := ParseSentryAddr(sentryAddr) // labels are used by routing of ControlServer
+	if err != nil {
+		return nil, nil, err
+	}
 	conn, err := grpc.DialContext(ctx, sentryAddr, dialOpts...)
 	if err != nil {
-		return nil, fmt.Errorf("creating client connection to sentry P2P: %w", err)
+		return nil, nil, fmt.Errorf("creating client connection to sentry P2P: %w", err)
 	}
-	return direct.NewSentryClientRemote(proto_sentry.NewSentryClient(conn)), nil
+	return direct.NewSentryClientRemote(proto_sentry.NewSentryClient(conn)), NewPeersInfoClient(conn), nil
 }
@@ -0,0 +1,110 @@
+package sentry
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/ledgerwatch/erigon/ethdb/privateapi"
+	"github.com/ledgerwatch/erigon/p2p"
+	"github.com/ledgerwatch/log/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// PeersInfoSource - peers of a sentry, implemented by SentryServerImpl and by PeersInfoClient of standalone sentry
+type PeersInfoSource interface {
+	PeersInfo(ctx context.Context) ([]*p2p.PeerInfo, error)
+}
+
+// rpc PeersInfo(google.protobuf.Empty) returns (google.protobuf.BytesValue) - value is JSON list of p2p.PeerInfo
+
+func _PeersInfo_PeersInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		peers, err := srv.(PeersInfoSource).PeersInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(peers)
+		if err != nil {
+			return nil, err
+		}
+		return wrapperspb.Bytes(data), nil
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sentry.PeersInfo/PeersInfo",
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PeersInfo_ServiceDesc - hand-written descriptor of "sentry.PeersInfo" service served by standalone sentry next to
+// "sentry.Sentry", messages are protobuf well-known types
+var PeersInfo_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sentry.PeersInfo",
+	HandlerType: (*PeersInfoSource)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PeersInfo",
+			Handler:    _PeersInfo_PeersInfo_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// PeersInfoClient - client of "sentry.PeersInfo" service
+type PeersInfoClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPeersInfoClient(cc grpc.ClientConnInterface) *PeersInfoClient {
+	return &PeersInfoClient{cc: cc}
+}
+
+func (c *PeersInfoClient) PeersInfo(ctx context.Context) ([]*p2p.PeerInfo, error) {
+	out := new(wrapperspb.BytesValue)
+	if err := c.cc.Invoke(ctx, "/sentry.PeersInfo/PeersInfo", &emptypb.Empty{}, out); err != nil {
+		return nil, err
+	}
+	var peers []*p2p.PeerInfo
+	if err := json.Unmarshal(out.GetValue(), &peers); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+// SetPeersInfo - sources of peers for admin_peers, i-th source belongs to i-th sentry
+func (cs *ControlServerImpl) SetPeersInfo(sources []PeersInfoSource) {
+	cs.routingLock.Lock()
+	defer cs.routingLock.Unlock()
+	cs.peersInfo = sources
+}
+
+// PeersInfo - peers of all sentries, sorted by id. Peer connected to several sentries is listed once per sentry.
+// Sentries which fail to answer are skipped.
+func (cs *ControlServerImpl) PeersInfo(ctx context.Context) []privateapi.PeerInfo {
+	cs.routingLock.RLock()
+	sources := cs.peersInfo
+	cs.routingLock.RUnlock()
+	var infos []privateapi.PeerInfo
+	for i, source := range sources {
+		peers, err := source.PeersInfo(ctx)
+		if err != nil {
+			log.Debug("[sentries] Could not get peers", "sentry", cs.sentryName(i), "err", err)
+			continue
+		}
+		for _, peer := range peers {
+			infos = append(infos, privateapi.PeerInfo{PeerInfo: peer, Sentry: cs.sentryName(i)})
+		}
+	}
+	sort.SliceStable(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
@@ -0,0 +1,55 @@
+package sentry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/direct"
+	"github.com/ledgerwatch/erigon/ethdb/privateapi"
+	"github.com/ledgerwatch/erigon/p2p"
+	"github.com/stretchr/testify/require"
+)
+
+type testPeersSource struct {
+	peers []*p2p.PeerInfo
+	err   error
+}
+
+func (s testPeersSource) PeersInfo(context.Context) ([]*p2p.PeerInfo, error) { return s.peers, s.err }
+
+func TestPeersInfo(t *testing.T) {
+	cs := &ControlServerImpl{
+		sentries:    make([]direct.SentryClient, 3),
+		sentryStats: make([]sentryStats, 3),
+	}
+	cs.SetSentryRouting([]string{"a:9091", "b:9091", "c:9091"}, nil, RoutingPolicy{})
+	peer := func(id string, bytesIn uint64) *p2p.PeerInfo {
+		info := &p2p.PeerInfo{ID: id}
+		info.Stats.BytesIn = bytesIn
+		return info
+	}
+	cs.SetPeersInfo([]PeersInfoSource{
+		testPeersSource{peers: []*p2p.PeerInfo{peer("02", 10), peer("01", 20)}},
+		testPeersSource{err: errors.New("unavailable")},
+		testPeersSource{peers: []*p2p.PeerInfo{peer("01", 30)}},
+	})
+	peers := cs.PeersInfo(context.Background())
+	require.Len(t, peers, 3)
+	require.Equal(t, "01", peers[0].ID)
+	require.Equal(t, "a:9091", peers[0].Sentry)
+	require.Equal(t, "c:9091", peers[1].Sentry)
+	require.Equal(t, "02", peers[2].ID)
+
+	// fields of p2p.PeerInfo are inlined, as in admin_peers of go-ethereum
+	data, err := json.Marshal(peers)
+	require.NoError(t, err)
+	var decoded []privateapi.PeerInfo
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, peers, decoded)
+	var raw []map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &raw))
+	require.Equal(t, "01", raw[0]["id"])
+	require.Equal(t, float64(20), raw[0]["stats"].(map[string]interface{})["bytesIn"])
+}
@@ -0,0 +1,191 @@
+package sentry
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/erigon/eth/protocols/eth"
+	"github.com/ledgerwatch/erigon/ethdb/privateapi"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// sentryDownBackoff - sentry which failed a request is asked only if other sentries can't serve, for this time
+const sentryDownBackoff = 10 * time.Second
+
+// SentryLabels - labels of sentry, given in its address: "<host>:<port>?region=eu&role=local"
+type SentryLabels map[string]string
+
+// ParseSentryAddr - splits sentry address into gRPC address and labels
+func ParseSentryAddr(s string) (string, SentryLabels, error) {
+	i := strings.IndexByte(s, '?')
+	if i < 0 {
+		return s, nil, nil
+	}
+	values, err := url.ParseQuery(s[i+1:])
+	if err != nil {
+		return "", nil, fmt.Errorf("labels of sentry %s: %w", s[:i], err)
+	}
+	labels := SentryLabels{}
+	for k, v := range values {
+		if len(v) != 1 || k == "" {
+			return "", nil, fmt.Errorf("labels of sentry %s: expected <label>=<value>", s[:i])
+		}
+		labels[k] = v[0]
+	}
+	return s[:i], labels, nil
+}
+
+// SentrySelector - matches sentries which have all these labels, empty selector matches none
+type SentrySelector map[string]string
+
+// ParseSentrySelector - "region=eu&role=local"
+func ParseSentrySelector(s string) (SentrySelector, error) {
+	if s == "" {
+		return nil, nil
+	}
+	labels, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	selector := SentrySelector{}
+	for k, v := range labels {
+		if len(v) != 1 || k == "" {
+			return nil, fmt.Errorf("expected <label>=<value>")
+		}
+		selector[k] = v[0]
+	}
+	return selector, nil
+}
+
+func (s SentrySelector) Match(labels SentryLabels) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for k, v := range s {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// RoutingPolicy - sentries asked first for headers and bodies, other sentries are fallback
+type RoutingPolicy struct {
+	Headers SentrySelector
+	Bodies  SentrySelector
+}
+
+type sentryStats struct {
+	requests  uint64 // atomic
+	noPeers   uint64 // atomic
+	errors    uint64 // atomic
+	downUntil int64  // atomic, unix nanoseconds
+}
+
+// SetSentryRouting - addresses and labels of sentries (in order of sentries of NewControlServer) and policy routing
+// header and body requests by labels
+func (cs *ControlServerImpl) SetSentryRouting(addrs []string, labels []SentryLabels, policy RoutingPolicy) {
+	cs.routingLock.Lock()
+	defer cs.routingLock.Unlock()
+	cs.sentryAddrs = addrs
+	cs.sentryLabels = labels
+	cs.routing = policy
+}
+
+type requestKind int
+
+const (
+	headerRequests requestKind = iota
+	bodyRequests
+)
+
+// sentryOrder - indices of sentries to try: preferred by routing policy, then others, sentries which are down go
+// last. Order within each group is random to spread load.
+func (cs *ControlServerImpl) sentryOrder(kind requestKind) []int {
+	cs.routingLock.RLock()
+	labels := cs.sentryLabels
+	selector := cs.routing.Headers
+	if kind == bodyRequests {
+		selector = cs.routing.Bodies
+	}
+	cs.routingLock.RUnlock()
+	now := time.Now().UnixNano()
+	order := rand.Perm(len(cs.sentries))
+	rank := func(i int) int {
+		if atomic.LoadInt64(&cs.sentryStats[i].downUntil) > now {
+			return 2
+		}
+		if i < len(labels) && selector.Match(labels[i]) {
+			return 0
+		}
+		return 1
+	}
+	sort.SliceStable(order, func(a, b int) bool { return rank(order[a]) < rank(order[b]) })
+	return order
+}
+
+// sentrySent - records outcome of request sent to sentry i
+func (cs *ControlServerImpl) sentrySent(i int, found bool, err error) {
+	stats := &cs.sentryStats[i]
+	atomic.AddUint64(&stats.requests, 1)
+	if err != nil {
+		atomic.AddUint64(&stats.errors, 1)
+		if atomic.SwapInt64(&stats.downUntil, time.Now().Add(sentryDownBackoff).UnixNano()) == 0 {
+			log.Warn("[sentries] Sentry is down, requests are routed to others", "sentry", cs.sentryName(i), "err", err)
+		}
+		return
+	}
+	if atomic.SwapInt64(&stats.downUntil, 0) != 0 {
+		log.Info("[sentries] Sentry is up again", "sentry", cs.sentryName(i))
+	}
+	if !found {
+		atomic.AddUint64(&stats.noPeers, 1)
+	}
+}
+
+func (cs *ControlServerImpl) sentryName(i int) string {
+	cs.routingLock.RLock()
+	defer cs.routingLock.RUnlock()
+	if i < len(cs.sentryAddrs) {
+		return cs.sentryAddrs[i]
+	}
+	return fmt.Sprintf("#%d", i)
+}
+
+// SentriesInfo - labels, state and request counters of sentries, see admin_sentries
+func (cs *ControlServerImpl) SentriesInfo() []privateapi.SentryInfo {
+	cs.routingLock.RLock()
+	defer cs.routingLock.RUnlock()
+	now := time.Now().UnixNano()
+	infos := make([]privateapi.SentryInfo, len(cs.sentries))
+	for i, sentry := range cs.sentries {
+		stats := &cs.sentryStats[i]
+		info := privateapi.SentryInfo{
+			Protocol: eth.ProtocolToString[sentry.Protocol()],
+			Ready:    sentry.Ready(),
+			Down:     atomic.LoadInt64(&stats.downUntil) > now,
+			Requests: atomic.LoadUint64(&stats.requests),
+			NoPeers:  atomic.LoadUint64(&stats.noPeers),
+			Errors:   atomic.LoadUint64(&stats.errors),
+		}
+		if i < len(cs.sentryAddrs) {
+			info.Addr = cs.sentryAddrs[i]
+		}
+		if i < len(cs.sentryLabels) {
+			info.Labels = cs.sentryLabels[i]
+			if cs.routing.Headers.Match(info.Labels) {
+				info.Preferred = append(info.Preferred, "headers")
+			}
+			if cs.routing.Bodies.Match(info.Labels) {
+				info.Preferred = append(info.Preferred, "bodies")
+			}
+		}
+		infos[i] = info
+	}
+	return infos
+}
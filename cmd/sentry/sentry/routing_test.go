@@ -0,0 +1,64 @@
+package sentry
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/direct"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSentryAddr(t *testing.T) {
+	addr, labels, err := ParseSentryAddr("127.0.0.1:9091")
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:9091", addr)
+	require.Nil(t, labels)
+
+	addr, labels, err = ParseSentryAddr("10.0.0.1:9091?region=eu&role=local")
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.1:9091", addr)
+	require.Equal(t, SentryLabels{"region": "eu", "role": "local"}, labels)
+
+	_, _, err = ParseSentryAddr("10.0.0.1:9091?region=eu&region=us")
+	require.Error(t, err)
+}
+
+func TestSentrySelector(t *testing.T) {
+	selector, err := ParseSentrySelector("region=eu&role=local")
+	require.NoError(t, err)
+	require.True(t, selector.Match(SentryLabels{"region": "eu", "role": "local", "rack": "1"}))
+	require.False(t, selector.Match(SentryLabels{"region": "eu"}))
+	require.False(t, selector.Match(nil))
+
+	selector, err = ParseSentrySelector("")
+	require.NoError(t, err)
+	require.False(t, selector.Match(SentryLabels{"region": "eu"}))
+}
+
+func TestSentryOrder(t *testing.T) {
+	cs := &ControlServerImpl{
+		sentries:    make([]direct.SentryClient, 3),
+		sentryStats: make([]sentryStats, 3),
+	}
+	cs.SetSentryRouting(
+		[]string{"a:9091", "b:9091", "c:9091"},
+		[]SentryLabels{{"region": "us"}, {"region": "eu"}, {"region": "eu", "role": "local"}},
+		RoutingPolicy{Headers: SentrySelector{"role": "local"}, Bodies: SentrySelector{"region": "eu"}},
+	)
+	for i := 0; i < 10; i++ {
+		require.Equal(t, 2, cs.sentryOrder(headerRequests)[0])
+		require.Equal(t, 0, cs.sentryOrder(bodyRequests)[2])
+	}
+
+	// preferred sentry is down - asked last until it serves a request again
+	cs.sentrySent(2, false, errors.New("unavailable"))
+	require.Equal(t, 2, cs.sentryOrder(headerRequests)[2])
+	require.Equal(t, []int{1, 0, 2}, cs.sentryOrder(bodyRequests))
+	cs.sentrySent(2, true, nil)
+	require.Equal(t, 2, cs.sentryOrder(headerRequests)[0])
+
+	cs.sentrySent(1, false, nil)
+	require.Equal(t, uint64(2), cs.sentryStats[2].requests)
+	require.Equal(t, uint64(1), cs.sentryStats[2].errors)
+	require.Equal(t, uint64(1), cs.sentryStats[1].noPeers)
+}
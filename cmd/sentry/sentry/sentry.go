@@ -56,6 +56,7 @@ type PeerInfo struct {
 	height    uint64
 	rw        p2p.MsgReadWriter
 	removed   bool
+	status    *eth.StatusPacket // received in handshake
 }
 
 func (pi *PeerInfo) ID() enode.ID {
@@ -75,6 +76,21 @@ func (pi *PeerInfo) Height() uint64 {
 	return atomic.LoadUint64(&pi.height)
 }
 
+// ethInfo - `eth` metadata of peer for admin_peers, nil while handshake is running
+func (pi *PeerInfo) ethInfo() *eth.PeerInfo {
+	pi.lock.RLock()
+	defer pi.lock.RUnlock()
+	if pi.status == nil {
+		return nil
+	}
+	return &eth.PeerInfo{
+		Version:    uint(pi.status.ProtocolVersion),
+		Difficulty: pi.status.TD,
+		Head:       pi.status.Head,
+		Number:     pi.Height(),
+	}
+}
+
 // SetIncreasedHeight atomically updates PeerInfo.height only if newHeight is higher
 func (pi *PeerInfo) SetIncreasedHeight(newHeight uint64) {
 	for {
@@ -157,7 +173,7 @@ func handShake(
 	rw p2p.MsgReadWriter,
 	version uint,
 	minVersion uint,
-	startSync func(bestHash common.Hash) error,
+	startSync func(status *eth.StatusPacket) error,
 ) error {
 	if status == nil {
 		return fmt.Errorf("could not get status message from core for peer %s connection", peerID)
@@ -224,7 +240,7 @@ func handShake(
 		}
 
 		if startSync != nil {
-			if err := startSync(reply.Head); err != nil {
+			if err := startSync(&reply); err != nil {
 				return err
 			}
 		}
@@ -470,6 +486,7 @@ func grpcSentryServer(ctx context.Context, sentryAddr string, ss *SentryServerIm
 	}
 	grpcServer := grpcutil.NewServer(100, nil)
 	proto_sentry.RegisterSentryServer(grpcServer, ss)
+	grpcServer.RegisterService(&PeersInfo_ServiceDesc, ss)
 	var healthServer *health.Server
 	if healthCheck {
 		healthServer = health.NewServer()
@@ -492,6 +509,13 @@ func NewSentryServer(ctx context.Context, dialCandidates enode.Iterator, readNod
 		ctx:          ctx,
 		p2p:          cfg,
 		peersStreams: NewPeersStreams(),
+		bandwidth:    NewBandwidth(protocol, cfg.MaxDownloadMbps, cfg.MaxUploadMbps),
+	}
+	if cfg.MaxDownloadMbps > 0 || cfg.MaxUploadMbps > 0 {
+		log.Info("[sentry] Bandwidth capped", "download_mbps", cfg.MaxDownloadMbps, "upload_mbps", cfg.MaxUploadMbps)
+	}
+	if readNodeInfo == nil {
+		readNodeInfo = ss.statusNodeInfo
 	}
 
 	if protocol != eth.ETH66 {
@@ -503,6 +527,7 @@ func NewSentryServer(ctx context.Context, dialCandidates enode.Iterator, readNod
 		Version:        protocol,
 		Length:         17,
 		DialCandidates: dialCandidates,
+		NodeFilter:     eth.NewNodeFilter(ss.forkFilter),
 		Run: func(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
 			peerID := peer.ID()
 			if ss.getPeer(peerID) != nil {
@@ -510,6 +535,9 @@ func NewSentryServer(ctx context.Context, dialCandidates enode.Iterator, readNod
 				return nil
 			}
 			log.Trace(fmt.Sprintf("[%s] Start with peer", peerID))
+			peerCtx, cancel := context.WithCancel(ctx) // writers of other goroutines stop waiting for bandwidth on disconnect
+			defer cancel()
+			rw = ss.bandwidth.Wrap(peerCtx, rw)
 
 			peerInfo := &PeerInfo{
 				peer: peer,
@@ -517,10 +545,13 @@ func NewSentryServer(ctx context.Context, dialCandidates enode.Iterator, readNod
 			}
 
 			defer ss.GoodPeers.Delete(peerID)
-			err := handShake(ctx, ss.GetStatus(), peerID, rw, protocol, protocol, func(bestHash common.Hash) error {
+			err := handShake(ctx, ss.GetStatus(), peerID, rw, protocol, protocol, func(status *eth.StatusPacket) error {
+				peerInfo.lock.Lock()
+				peerInfo.status = status
+				peerInfo.lock.Unlock()
 				ss.GoodPeers.Store(peerID, peerInfo)
 				ss.sendNewPeerToClients(gointerfaces.ConvertHashToH256(peerID))
-				return ss.startSync(ctx, bestHash, peerID)
+				return ss.startSync(ctx, status.Head, peerID)
 			})
 			if err != nil {
 				return fmt.Errorf("handshake to peer %s: %w", peerID, err)
@@ -545,7 +576,9 @@ func NewSentryServer(ctx context.Context, dialCandidates enode.Iterator, readNod
 		},
 		PeerInfo: func(peerID enode.ID) interface{} {
 			if peerInfo := ss.getPeer(peerID); peerInfo != nil {
-				return peerInfo.peer.Info()
+				if info := peerInfo.ethInfo(); info != nil {
+					return info
+				}
 			}
 			return nil
 		},
@@ -561,7 +594,7 @@ func Sentry(datadir string, sentryAddr string, discoveryDNS []string, cfg *p2p.C
 		return fmt.Errorf("could not create dir: %s, %w", datadir, err)
 	}
 	ctx := rootContext()
-	sentryServer := NewSentryServer(ctx, nil, func() *eth.NodeInfo { return nil }, cfg, protocolVersion)
+	sentryServer := NewSentryServer(ctx, nil, nil, cfg, protocolVersion)
 	sentryServer.discoveryDNS = discoveryDNS
 
 	grpcServer, err := grpcSentryServer(ctx, sentryAddr, sentryServer, healthCheck)
@@ -590,6 +623,7 @@ type SentryServerImpl struct {
 	messageStreamsLock   sync.RWMutex
 	peersStreams         *PeersStreams
 	p2p                  *p2p.Config
+	bandwidth            *Bandwidth
 }
 
 func (ss *SentryServerImpl) rangePeers(f func(peerInfo *PeerInfo) bool) {
@@ -836,6 +870,9 @@ func (ss *SentryServerImpl) SetStatus(_ context.Context, statusData *proto_sentr
 			if err != nil {
 				return nil, err
 			}
+			if ss.Protocol.DialCandidates != nil {
+				ss.Protocol.DialCandidates = enode.Filter(ss.Protocol.DialCandidates, ss.Protocol.NodeFilter)
+			}
 		}
 
 		srv, err := makeP2PServer(*ss.p2p, genesisHash, ss.Protocol)
@@ -881,6 +918,42 @@ func setupDiscovery(urls []string) (enode.Iterator, error) {
 	return client.NewIterator(urls...)
 }
 
+// statusNodeInfo - `eth` metadata of the node for standalone sentry, which has no access to its database
+func (ss *SentryServerImpl) statusNodeInfo() *eth.NodeInfo {
+	status := ss.GetStatus()
+	if status == nil {
+		return nil
+	}
+	return &eth.NodeInfo{
+		Network:    status.NetworkId,
+		Difficulty: gointerfaces.ConvertH256ToUint256Int(status.TotalDifficulty).ToBig(),
+		Genesis:    gointerfaces.ConvertH256ToHash(status.ForkData.Genesis),
+		Head:       gointerfaces.ConvertH256ToHash(status.BestHash),
+	}
+}
+
+// PeersInfo - connected peers with their `eth` metadata and connection stats
+func (ss *SentryServerImpl) PeersInfo(context.Context) ([]*p2p.PeerInfo, error) {
+	ss.lock.RLock()
+	srv := ss.P2pServer
+	ss.lock.RUnlock()
+	if srv == nil {
+		return nil, errors.New("p2p server was not started")
+	}
+	return srv.PeersInfo(), nil
+}
+
+// forkFilter - filter of fork IDs compatible with status of the node, nil until status is set
+func (ss *SentryServerImpl) forkFilter() forkid.Filter {
+	status := ss.GetStatus()
+	if status == nil {
+		return nil
+	}
+	forks := make([]uint64, len(status.ForkData.Forks)) // copy because forkid.NewFilterFromForks will write into this slice
+	copy(forks, status.ForkData.Forks)
+	return forkid.NewFilterFromForks(forks, gointerfaces.ConvertH256ToHash(status.ForkData.Genesis), status.MaxBlock)
+}
+
 func (ss *SentryServerImpl) GetStatus() *proto_sentry.StatusData {
 	ss.lock.RLock()
 	defer ss.lock.RUnlock()
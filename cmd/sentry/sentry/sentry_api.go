@@ -39,7 +39,7 @@ func (cs *ControlServerImpl) UpdateHead(ctx context.Context, height uint64, hash
 
 func (cs *ControlServerImpl) SendBodyRequest(ctx context.Context, req *bodydownload.BodyRequest) (peerID enode.ID, ok bool) {
 	// if sentry not found peers to send such message, try next one. stop if found.
-	for i, ok, next := cs.randSentryIndex(); ok; i, ok = next() {
+	for _, i := range cs.sentryOrder(bodyRequests) {
 		if !cs.sentries[i].Ready() {
 			continue
 		}
@@ -66,9 +66,10 @@ func (cs *ControlServerImpl) SendBodyRequest(ctx context.Context, req *bodydownl
 			}
 
 			sentPeers, err1 := cs.sentries[i].SendMessageByMinBlock(ctx, &outreq, &grpc.EmptyCallOption{})
+			cs.sentrySent(i, err1 == nil && sentPeers != nil && len(sentPeers.Peers) > 0, err1)
 			if err1 != nil {
-				log.Error("Could not send block bodies request", "err", err1)
-				return enode.ID{}, false
+				log.Debug("Could not send block bodies request", "err", err1)
+				continue
 			}
 			if sentPeers == nil || len(sentPeers.Peers) == 0 {
 				continue
@@ -81,7 +82,7 @@ func (cs *ControlServerImpl) SendBodyRequest(ctx context.Context, req *bodydownl
 
 func (cs *ControlServerImpl) SendHeaderRequest(ctx context.Context, req *headerdownload.HeaderRequest) (peerID enode.ID, ok bool) {
 	// if sentry not found peers to send such message, try next one. stop if found.
-	for i, ok, next := cs.randSentryIndex(); ok; i, ok = next() {
+	for _, i := range cs.sentryOrder(headerRequests) {
 		if !cs.sentries[i].Ready() {
 			continue
 		}
@@ -118,9 +119,10 @@ func (cs *ControlServerImpl) SendHeaderRequest(ctx context.Context, req *headerd
 				},
 			}
 			sentPeers, err1 := cs.sentries[i].SendMessageByMinBlock(ctx, &outreq, &grpc.EmptyCallOption{})
+			cs.sentrySent(i, err1 == nil && sentPeers != nil && len(sentPeers.Peers) > 0, err1)
 			if err1 != nil {
-				log.Error("Could not send header request", "err", err1)
-				return enode.ID{}, false
+				log.Debug("Could not send header request", "err", err1)
+				continue
 			}
 			if sentPeers == nil || len(sentPeers.Peers) == 0 {
 				continue
@@ -129,7 +129,7 @@ func CheckChangeSets(genesis *core.Genesis, logger log.Logger, blockNum uint64,
 			break
 		}
 
-		intraBlockState := state.New(state.NewPlainState(historyTx, block.NumberU64()-1))
+		intraBlockState := state.New(state.NewPlainState(historyTx, block.NumberU64()-1, nil))
 		csw := state.NewChangeSetWriterPlain(nil /* db */, block.NumberU64()-1)
 		var blockWriter state.StateWriter
 		if nocheck {
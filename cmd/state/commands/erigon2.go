@@ -151,7 +151,7 @@ func Erigon2(genesis *core.Genesis, logger log.Logger, blockNum uint64, datadir
 		r := agg.MakeStateReader(tx, block)
 		var checkR state.StateReader
 		if check {
-			checkR = state.NewPlainState(historyTx, block-1)
+			checkR = state.NewPlainState(historyTx, block-1, nil)
 		}
 		var w *aggregator.Writer
 		if w, err = agg.MakeStateWriter(rwTx, block); err != nil {
@@ -0,0 +1,396 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus/ethash"
+	"github.com/ledgerwatch/erigon/consensus/misc"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+)
+
+var (
+	repricingTo uint64
+	gasSchedule string
+)
+
+func init() {
+	withBlock(repriceGasCmd)
+	withDatadir(repriceGasCmd)
+	repriceGasCmd.Flags().Uint64Var(&repricingTo, "to", 0, "last block of the range, if omitted only --block is re-executed")
+	repriceGasCmd.Flags().StringVar(&gasSchedule, "schedule", "", `path to JSON file with modified gas costs, e.g. {"opcodes": {"SLOAD": 2100}, "intrinsic": {"txDataNonZero": 8}}`)
+	must(repriceGasCmd.MarkFlagFilename("schedule", "json"))
+	must(repriceGasCmd.MarkFlagRequired("schedule"))
+	rootCmd.AddCommand(repriceGasCmd)
+}
+
+var repriceGasCmd = &cobra.Command{
+	Use:   "repriceGas",
+	Short: "Re-executes historical blocks with modified gas costs and reports differences of gas and fees by category",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(gasSchedule)
+		if err != nil {
+			return err
+		}
+		schedule, err := vm.ParseGasSchedule(data)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", gasSchedule, err)
+		}
+		to := repricingTo
+		if to < block {
+			to = block
+		}
+		logger := log.New()
+		db, err := mdbx.NewMDBX(logger).Path(chaindata).Readonly().Open()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		report, err := RepriceGas(cmd.Context(), db, genesis.Config, schedule, block, to)
+		if err != nil {
+			return err
+		}
+		report.Print(os.Stdout)
+		return nil
+	},
+}
+
+// Categories of gas. Gas of instructions which start a new frame (calls and creates) doesn't include gas used
+// inside of the frame. "other" is the rest of gas used by transaction: refunds (negative), code deposit, gas burnt
+// on errors and gas of frames which ended abnormally.
+const (
+	gasIntrinsic   = "intrinsic"
+	gasCompute     = "compute"
+	gasMemory      = "memory"
+	gasHashing     = "hashing"
+	gasEnvironment = "environment"
+	gasStateAccess = "state access"
+	gasStorage     = "storage"
+	gasLog         = "log"
+	gasCall        = "call"
+	gasCreate      = "create"
+	gasPrecompile  = "precompile"
+	gasOther       = "other"
+)
+
+var gasCategories = []string{gasIntrinsic, gasCompute, gasMemory, gasHashing, gasEnvironment, gasStateAccess, gasStorage, gasLog, gasCall, gasCreate, gasPrecompile, gasOther}
+
+func opcodeGasCategory(op vm.OpCode) string {
+	if op >= vm.LOG0 && op <= vm.LOG4 {
+		return gasLog
+	}
+	switch op {
+	case vm.SLOAD, vm.SSTORE:
+		return gasStorage
+	case vm.BALANCE, vm.EXTCODESIZE, vm.EXTCODECOPY, vm.EXTCODEHASH, vm.BLOCKHASH:
+		return gasStateAccess
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		return gasCall
+	case vm.CREATE, vm.CREATE2, vm.SELFDESTRUCT:
+		return gasCreate
+	case vm.SHA3:
+		return gasHashing
+	case vm.MLOAD, vm.MSTORE, vm.MSTORE8, vm.MSIZE, vm.CALLDATACOPY, vm.CODECOPY, vm.RETURNDATACOPY, vm.RETURN, vm.REVERT:
+		return gasMemory
+	case vm.ADDRESS, vm.ORIGIN, vm.CALLER, vm.CALLVALUE, vm.CALLDATALOAD, vm.CALLDATASIZE, vm.CODESIZE, vm.GASPRICE,
+		vm.RETURNDATASIZE, vm.COINBASE, vm.TIMESTAMP, vm.NUMBER, vm.DIFFICULTY, vm.GASLIMIT, vm.CHAINID, vm.SELFBALANCE,
+		vm.BASEFEE, vm.GAS:
+		return gasEnvironment
+	}
+	return gasCompute
+}
+
+func startsFrame(op vm.OpCode) bool {
+	switch op {
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL, vm.CREATE, vm.CREATE2:
+		return true
+	}
+	return false
+}
+
+// frameOp - call or create instruction, its gas is known when the next instruction of the same frame starts
+type frameOp struct {
+	category string
+	gas      uint64 // gas before the instruction
+	children uint64 // gas used by frames started by the instruction
+}
+
+// gasCategoryTracer - attributes gas of one transaction to categories
+type gasCategoryTracer struct {
+	startGas   uint64 // gas of the top-level frame, what is left after intrinsic gas
+	categories map[string]int64
+	pending    map[int]*frameOp // by depth of frame
+	precompile []bool           // whether frames are precompiles, by depth
+}
+
+func newGasCategoryTracer() *gasCategoryTracer {
+	return &gasCategoryTracer{categories: map[string]int64{}, pending: map[int]*frameOp{}}
+}
+
+func (t *gasCategoryTracer) settle(depth int, gas uint64) {
+	if p, ok := t.pending[depth]; ok {
+		t.categories[p.category] += int64(p.gas) - int64(gas) - int64(p.children)
+		delete(t.pending, depth)
+	}
+}
+
+func (t *gasCategoryTracer) CaptureStart(env *vm.EVM, depth int, from common.Address, to common.Address, precompile bool, create bool, calltype vm.CallType, input []byte, gas uint64, value *big.Int, code []byte) {
+	if depth == 0 {
+		t.startGas = gas
+	}
+	t.precompile = append(t.precompile, precompile)
+}
+
+func (t *gasCategoryTracer) CaptureEnd(depth int, output []byte, startGas, endGas uint64, d time.Duration, err error) {
+	used := startGas - endGas
+	if t.precompile[len(t.precompile)-1] {
+		t.categories[gasPrecompile] += int64(used)
+	}
+	t.precompile = t.precompile[:len(t.precompile)-1]
+	// instruction which was not followed by another one in the finished frame goes to "other"
+	delete(t.pending, depth+1)
+	if p, ok := t.pending[depth]; ok {
+		p.children += used
+	}
+}
+
+func (t *gasCategoryTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	t.settle(depth, gas)
+	if err != nil {
+		return
+	}
+	if startsFrame(op) {
+		t.pending[depth] = &frameOp{category: opcodeGasCategory(op), gas: gas}
+		return
+	}
+	t.categories[opcodeGasCategory(op)] += int64(cost)
+}
+
+func (t *gasCategoryTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+func (t *gasCategoryTracer) CaptureSelfDestruct(from common.Address, to common.Address, value *big.Int) {
+}
+func (t *gasCategoryTracer) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+func (t *gasCategoryTracer) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
+
+// repricedTx - outcome of transaction execution with one of gas schedules
+type repricedTx struct {
+	invalid    bool // intrinsic gas above gas limit, or other consensus error
+	failed     bool
+	gasUsed    uint64
+	price      *big.Int
+	categories map[string]int64
+}
+
+// GasRepricingReport - aggregate gas and fees of re-executed transactions with fork costs (baseline) and with
+// modified gas schedule
+type GasRepricingReport struct {
+	From, To uint64
+	Txs      int
+
+	BaselineGas, ModifiedGas   map[string]int64
+	BaselineFees, ModifiedFees map[string]*big.Int // wei
+
+	NewlyFailed   int // succeeded with fork costs, failed with modified costs
+	NoLongerFail  int // failed with fork costs, succeeded with modified costs
+	NewlyInvalid  int // can't be included with modified costs
+	BaselineTotal uint64
+	ModifiedTotal uint64
+}
+
+func newGasRepricingReport(from, to uint64) *GasRepricingReport {
+	r := &GasRepricingReport{
+		From: from, To: to,
+		BaselineGas: map[string]int64{}, ModifiedGas: map[string]int64{},
+		BaselineFees: map[string]*big.Int{}, ModifiedFees: map[string]*big.Int{},
+	}
+	for _, c := range gasCategories {
+		r.BaselineFees[c], r.ModifiedFees[c] = new(big.Int), new(big.Int)
+	}
+	return r
+}
+
+func addRepricedTx(gas map[string]int64, fees map[string]*big.Int, tx *repricedTx) {
+	for c, g := range tx.categories {
+		gas[c] += g
+		fees[c].Add(fees[c], new(big.Int).Mul(big.NewInt(g), tx.price))
+	}
+}
+
+func (r *GasRepricingReport) add(baseline, modified *repricedTx) {
+	r.Txs++
+	addRepricedTx(r.BaselineGas, r.BaselineFees, baseline)
+	r.BaselineTotal += baseline.gasUsed
+	switch {
+	case modified.invalid:
+		r.NewlyInvalid++
+		return
+	case modified.failed && !baseline.failed:
+		r.NewlyFailed++
+	case !modified.failed && baseline.failed:
+		r.NoLongerFail++
+	}
+	addRepricedTx(r.ModifiedGas, r.ModifiedFees, modified)
+	r.ModifiedTotal += modified.gasUsed
+}
+
+// Print - table of categories, fees are in ETH
+func (r *GasRepricingReport) Print(out io.Writer) {
+	fmt.Fprintf(out, "Blocks %d-%d, %d transactions\n", r.From, r.To, r.Txs)
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "category\tbaseline gas\tmodified gas\tdiff\tdiff %\tbaseline fees\tmodified fees\tfees diff\t")
+	ether := new(big.Float).SetInt(big.NewInt(params.Ether))
+	eth := func(wei *big.Int) string {
+		return new(big.Float).Quo(new(big.Float).SetInt(wei), ether).Text('f', 9)
+	}
+	percent := func(diff, base int64) string {
+		if base == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%+.2f", 100*float64(diff)/float64(base))
+	}
+	totalBaselineFees, totalModifiedFees := new(big.Int), new(big.Int)
+	for _, c := range gasCategories {
+		b, m := r.BaselineGas[c], r.ModifiedGas[c]
+		bf, mf := r.BaselineFees[c], r.ModifiedFees[c]
+		totalBaselineFees.Add(totalBaselineFees, bf)
+		totalModifiedFees.Add(totalModifiedFees, mf)
+		fmt.Fprintf(w, "%s\t%d\t%d\t%+d\t%s\t%s\t%s\t%s\t\n", c, b, m, m-b, percent(m-b, b), eth(bf), eth(mf), eth(new(big.Int).Sub(mf, bf)))
+	}
+	b, m := int64(r.BaselineTotal), int64(r.ModifiedTotal)
+	fmt.Fprintf(w, "total\t%d\t%d\t%+d\t%s\t%s\t%s\t%s\t\n", b, m, m-b, percent(m-b, b), eth(totalBaselineFees), eth(totalModifiedFees), eth(new(big.Int).Sub(totalModifiedFees, totalBaselineFees)))
+	w.Flush()
+	fmt.Fprintf(out, "Transactions failing only with modified costs: %d, failing only with fork costs: %d, invalid with modified costs (excluded from modified totals): %d\n",
+		r.NewlyFailed, r.NoLongerFail, r.NewlyInvalid)
+}
+
+// RepriceGas re-executes blocks [from, to] on historical state twice: with gas costs of the fork and with
+// modified schedule, and aggregates gas and fees of transactions by category.
+// Every block is executed on its own historical state, so modified costs don't propagate to the next blocks.
+func RepriceGas(ctx context.Context, db kv.RoDB, chainConfig *params.ChainConfig, schedule *vm.GasSchedule, from, to uint64) (*GasRepricingReport, error) {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	execAt, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return nil, err
+	}
+	if to > execAt {
+		log.Warn("Range is limited by Execution stage", "to", to, "execution", execAt)
+		to = execAt
+	}
+	if from == 0 {
+		from = 1 // genesis has no transactions and no state before it
+	}
+
+	report := newGasRepricingReport(from, to)
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	for blockNum := from; blockNum <= to; blockNum++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-logEvery.C:
+			log.Info("Re-executing", "block", blockNum, "txs", report.Txs)
+		default:
+		}
+		blockHash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+		if err != nil {
+			return nil, err
+		}
+		b, _, err := rawdb.ReadBlockWithSenders(tx, blockHash, blockNum)
+		if err != nil {
+			return nil, err
+		}
+		if b == nil {
+			return nil, fmt.Errorf("block %d not found", blockNum)
+		}
+		baseline, err := repriceBlock(tx, chainConfig, b, nil)
+		if err != nil {
+			return nil, err
+		}
+		modified, err := repriceBlock(tx, chainConfig, b, schedule)
+		if err != nil {
+			return nil, err
+		}
+		for i := range baseline {
+			report.add(baseline[i], modified[i])
+		}
+	}
+	return report, nil
+}
+
+func repriceBlock(tx kv.Tx, chainConfig *params.ChainConfig, block *types.Block, schedule *vm.GasSchedule) ([]*repricedTx, error) {
+	header := block.Header()
+	ibs := state.New(state.NewPlainState(tx, block.NumberU64()-1, nil))
+	if chainConfig.DAOForkSupport && chainConfig.DAOForkBlock != nil && chainConfig.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(ibs)
+	}
+	getHeader := func(hash common.Hash, number uint64) *types.Header { return rawdb.ReadHeader(tx, hash, number) }
+	contractHasTEVM := ethdb.GetHasTEVM(tx)
+	engine := ethash.NewFullFaker()
+	signer := types.MakeSigner(chainConfig, block.NumberU64())
+	noOpWriter := state.NewNoopWriter()
+	// modified costs can exceed gas limit of the block, it's not a reason to stop
+	gp := new(core.GasPool).AddGas(math.MaxUint64)
+	usedGas := new(uint64)
+
+	result := make([]*repricedTx, len(block.Transactions()))
+	for i, txn := range block.Transactions() {
+		msg, err := txn.AsMessage(*signer, header.BaseFee)
+		if err != nil {
+			return nil, fmt.Errorf("tx %d [%x] of block %d: %w", i, txn.Hash(), block.NumberU64(), err)
+		}
+		tracer := newGasCategoryTracer()
+		vmConfig := vm.Config{Debug: true, Tracer: tracer, GasSchedule: schedule}
+		ibs.Prepare(txn.Hash(), block.Hash(), i)
+		snapshot := ibs.Snapshot()
+		receipt, _, err := core.ApplyTransaction(chainConfig, getHeader, engine, nil, gp, ibs, noOpWriter, header, txn, usedGas, vmConfig, contractHasTEVM)
+		if err != nil {
+			if schedule == nil {
+				return nil, fmt.Errorf("could not apply tx %d [%x] of block %d: %w", i, txn.Hash(), block.NumberU64(), err)
+			}
+			ibs.RevertToSnapshot(snapshot)
+			result[i] = &repricedTx{invalid: true}
+			continue
+		}
+		categories := tracer.categories
+		categories[gasIntrinsic] = int64(msg.Gas() - tracer.startGas)
+		other := int64(receipt.GasUsed)
+		for _, g := range categories {
+			other -= g
+		}
+		categories[gasOther] += other
+		result[i] = &repricedTx{
+			failed:     receipt.Status == types.ReceiptStatusFailed,
+			gasUsed:    receipt.GasUsed,
+			price:      msg.GasPrice().ToBig(),
+			categories: categories,
+		}
+	}
+	return result, nil
+}
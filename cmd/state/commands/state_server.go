@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"net"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/state/remotestate"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+)
+
+var stateServerAddr string
+
+func init() {
+	withDatadir(stateServerCmd)
+	stateServerCmd.Flags().StringVar(&stateServerAddr, "addr", "localhost:9095", "gRPC address to listen on, erigon connects with --experimental.state.backend")
+	rootCmd.AddCommand(stateServerCmd)
+}
+
+var stateServerCmd = &cobra.Command{
+	Use:   "stateServer",
+	Short: "Serve PlainState of the database as remote state store of Execution stage",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := log.New()
+		db, err := mdbx.NewMDBX(logger).Path(chaindata).Open()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		// empty database starts from genesis state, existing one must be at the same block as the node
+		if _, _, err = core.CommitGenesisBlock(db, genesis); err != nil {
+			return err
+		}
+		lis, err := net.Listen("tcp", stateServerAddr)
+		if err != nil {
+			return err
+		}
+		server := grpcutil.NewServer(100, nil)
+		server.RegisterService(&remotestate.State_ServiceDesc, remotestate.NewServer(remotestate.NewDbBackend(db)))
+		go func() {
+			<-cmd.Context().Done()
+			server.GracefulStop()
+		}()
+		log.Info("Serving state", "addr", stateServerAddr, "chaindata", chaindata)
+		return server.Serve(lis)
+	},
+}
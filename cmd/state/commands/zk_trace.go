@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus/ethash"
+	"github.com/ledgerwatch/erigon/consensus/misc"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/eth/tracers/zktrace"
+	"github.com/ledgerwatch/erigon/ethdb"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/transactions"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+)
+
+var (
+	zkTraceTo     uint64
+	zkTraceOutput string
+)
+
+func init() {
+	withBlock(zkTraceCmd)
+	withDatadir(zkTraceCmd)
+	zkTraceCmd.Flags().Uint64Var(&zkTraceTo, "to", 0, "last block of the range, if omitted only --block is traced")
+	zkTraceCmd.Flags().StringVar(&zkTraceOutput, "output", "zktrace.bin", "file to write, or grpc://host:port of zktrace.v1.TraceSink service")
+	rootCmd.AddCommand(zkTraceCmd)
+}
+
+var zkTraceCmd = &cobra.Command{
+	Use:   "zkTrace",
+	Short: "Re-executes historical blocks and exports traces with state accesses of every instruction for zkEVM provers",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		to := zkTraceTo
+		if to < block {
+			to = block
+		}
+		logger := log.New()
+		db, err := mdbx.NewMDBX(logger).Path(chaindata).Readonly().Open()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		sink, err := zktrace.OpenSink(zkTraceOutput, genesis.Config.ChainID.Uint64())
+		if err != nil {
+			return err
+		}
+		if err = ExportZkTraces(cmd.Context(), db, genesis.Config, block, to, sink); err != nil {
+			sink.Close()
+			return err
+		}
+		return sink.Close()
+	},
+}
+
+// ExportZkTraces re-executes blocks [from, to] on historical state and writes their traces to sink, block by block
+func ExportZkTraces(ctx context.Context, db kv.RoDB, chainConfig *params.ChainConfig, from, to uint64, sink zktrace.Sink) error {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	execAt, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return err
+	}
+	if to > execAt {
+		log.Warn("Range is limited by Execution stage", "to", to, "execution", execAt)
+		to = execAt
+	}
+	if from == 0 {
+		from = 1 // genesis has no transactions and no state before it
+	}
+
+	getHeader := func(hash common.Hash, number uint64) *types.Header { return rawdb.ReadHeader(tx, hash, number) }
+	contractHasTEVM := ethdb.GetHasTEVM(tx)
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	for blockNum := from; blockNum <= to; blockNum++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-logEvery.C:
+			log.Info("Tracing", "block", blockNum, "to", to)
+		default:
+		}
+		blockHash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+		if err != nil {
+			return err
+		}
+		b, _, err := rawdb.ReadBlockWithSenders(tx, blockHash, blockNum)
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			return fmt.Errorf("block %d not found", blockNum)
+		}
+		ibs := state.New(state.NewPlainState(tx, blockNum-1, nil))
+		if chainConfig.DAOForkSupport && chainConfig.DAOForkBlock != nil && chainConfig.DAOForkBlock.Cmp(b.Number()) == 0 {
+			misc.ApplyDAOHardFork(ibs)
+		}
+		blockCtx := core.NewEVMBlockContext(b.Header(), getHeader, ethash.NewFaker(), nil, contractHasTEVM)
+		traced, err := transactions.ZkTraceBlock(ctx, b, blockCtx, ibs, chainConfig)
+		if err != nil {
+			return fmt.Errorf("block %d: %w", blockNum, err)
+		}
+		if err = sink.WriteBlock(traced); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,18 +1,16 @@
 package verify
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"math/big"
 	"os"
 	"os/signal"
 	"time"
 
 	libcommon "github.com/ledgerwatch/erigon-lib/common"
-	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
 	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
 	"github.com/ledgerwatch/log/v3"
 )
 
@@ -35,11 +33,11 @@ func ValidateTxLookups(chaindata string) error {
 	defer func() {
 		log.Info("Validation ended", "it took", time.Since(t))
 	}()
+	blockReader := snapshotsync.NewBlockReader()
 	var blockNum uint64
 	iterations := 0
 	var interrupt bool
 	// Validation Process
-	blockBytes := big.NewInt(0)
 	for !interrupt {
 		if err := libcommon.Stopped(quitCh); err != nil {
 			return err
@@ -54,21 +52,18 @@ func ValidateTxLookups(chaindata string) error {
 			log.Error("Empty body", "blocknum", blockNum)
 			break
 		}
-		blockBytes.SetUint64(blockNum)
-		bn := blockBytes.Bytes()
-
 		for _, txn := range body.Transactions {
-			val, err := tx.GetOne(kv.TxLookup, txn.Hash().Bytes())
+			val, err := rawdb.ReadTxLookupEntry(context.Background(), tx, blockReader, txn.Hash())
 			iterations++
 			if iterations%100000 == 0 {
 				log.Info("Validated", "entries", iterations, "number", blockNum)
 
 			}
-			if !bytes.Equal(val, bn) {
+			if val == nil || *val != blockNum {
 				if err != nil {
 					panic(err)
 				}
-				panic(fmt.Sprintf("Validation process failed(%d). Expected %b, got %b", iterations, bn, val))
+				panic(fmt.Sprintf("Validation process failed(%d). Expected %d, got %v", iterations, blockNum, val))
 			}
 		}
 		blockNum++
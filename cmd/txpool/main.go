@@ -11,6 +11,7 @@ import (
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
 	proto_sentry "github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	txpool_proto "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
 	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
 	"github.com/ledgerwatch/erigon-lib/kv/remotedb"
 	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
@@ -19,7 +20,10 @@ import (
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/rpcdaemontest"
 	"github.com/ledgerwatch/erigon/cmd/utils"
 	"github.com/ledgerwatch/erigon/common/paths"
+	"github.com/ledgerwatch/erigon/eth/txpoolfetch"
+	"github.com/ledgerwatch/erigon/eth/txpoolshadow"
 	"github.com/ledgerwatch/erigon/ethdb/privateapi"
+	"github.com/ledgerwatch/erigon/ethdb/statecache"
 	"github.com/ledgerwatch/erigon/internal/debug"
 	"github.com/ledgerwatch/log/v3"
 	"github.com/spf13/cobra"
@@ -41,6 +45,12 @@ var (
 
 	priceLimit uint64
 	priceBump  uint64
+
+	shadow       bool
+	shadowFile   string
+	shadowPolicy string
+
+	fetchInflight uint64
 )
 
 func init() {
@@ -62,6 +72,10 @@ func init() {
 	rootCmd.PersistentFlags().Uint64Var(&priceLimit, "txpool.pricelimit", txpool.DefaultConfig.MinFeeCap, "Minimum gas price (fee cap) limit to enforce for acceptance into the pool")
 	rootCmd.PersistentFlags().Uint64Var(&priceLimit, "txpool.accountslots", txpool.DefaultConfig.AccountSlots, "Minimum number of executable transaction slots guaranteed per account")
 	rootCmd.PersistentFlags().Uint64Var(&priceBump, "txpool.pricebump", txpool.DefaultConfig.PriceBump, "Price bump percentage to replace an already existing transaction")
+	rootCmd.PersistentFlags().BoolVar(&shadow, utils.TxPoolShadowFlag.Name, false, utils.TxPoolShadowFlag.Usage)
+	rootCmd.PersistentFlags().StringVar(&shadowFile, utils.TxPoolShadowFileFlag.Name, "", utils.TxPoolShadowFileFlag.Usage)
+	rootCmd.PersistentFlags().StringVar(&shadowPolicy, utils.TxPoolShadowPolicyFlag.Name, "", utils.TxPoolShadowPolicyFlag.Usage)
+	rootCmd.PersistentFlags().Uint64Var(&fetchInflight, utils.TxPoolFetchInflightFlag.Name, utils.TxPoolFetchInflightFlag.Value, utils.TxPoolFetchInflightFlag.Usage)
 }
 
 var rootCmd = &cobra.Command{
@@ -119,15 +133,41 @@ var rootCmd = &cobra.Command{
 		cacheConfig := kvcache.DefaultCoherentConfig
 		cacheConfig.MetricsLabel = "txpool"
 
+		fetchScheduler, err := txpoolfetch.New(int(fetchInflight))
+		if err != nil {
+			return err
+		}
+		sentryClients = fetchScheduler.WrapSentries(sentryClients)
+
+		var shadowMode *txpoolshadow.Shadow
+		if shadow || shadowFile != "" || shadowPolicy != "" {
+			var policy *txpoolshadow.Policy
+			if shadowPolicy != "" {
+				if policy, err = txpoolshadow.ParsePolicy(shadowPolicy); err != nil {
+					return fmt.Errorf("--%s: %w", utils.TxPoolShadowPolicyFlag.Name, err)
+				}
+			}
+			if shadowMode, err = txpoolshadow.New(shadowFile, policy); err != nil {
+				return err
+			}
+			sentryClients = shadowMode.WrapSentries(sentryClients)
+		}
+
 		newTxs := make(chan txpool.Hashes, 1024)
 		defer close(newTxs)
 		txPoolDB, txPool, fetch, send, txpoolGrpcServer, err := txpooluitl.AllComponents(ctx, cfg,
-			kvcache.New(cacheConfig), newTxs, coreDB, sentryClients, kvClient)
+			statecache.New(cacheConfig), newTxs, coreDB, sentryClients, kvClient)
 		if err != nil {
 			return err
 		}
 		fetch.ConnectCore()
 		fetch.ConnectSentries()
+		go fetchScheduler.Loop(ctx)
+		var txpoolServer txpool_proto.TxpoolServer = txpoolGrpcServer
+		if shadowMode != nil {
+			txpoolServer = shadowMode.WrapGrpcServer(txpoolGrpcServer)
+			go shadowMode.Loop(ctx, txPool, txPoolDB)
+		}
 
 		/*
 			var ethashApi *ethash.API
@@ -137,7 +177,7 @@ var rootCmd = &cobra.Command{
 		*/
 		miningGrpcServer := privateapi.NewMiningServer(cmd.Context(), &rpcdaemontest.IsMiningMock{}, nil)
 
-		grpcServer, err := txpool.StartGrpc(txpoolGrpcServer, miningGrpcServer, txpoolApiAddr, nil)
+		grpcServer, err := txpool.StartGrpc(txpoolServer, miningGrpcServer, txpoolApiAddr, nil)
 		if err != nil {
 			return err
 		}
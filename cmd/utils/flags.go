@@ -29,10 +29,12 @@ import (
 	"strings"
 	"text/tabwriter"
 	"text/template"
+	"time"
 
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/txpool"
 	"github.com/ledgerwatch/erigon/eth/protocols/eth"
+	"github.com/ledgerwatch/erigon/eth/txpoolshadow"
 	"github.com/ledgerwatch/erigon/params/networkname"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -53,6 +55,7 @@ import (
 	"github.com/ledgerwatch/erigon/p2p/nat"
 	"github.com/ledgerwatch/erigon/p2p/netutil"
 	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/historysnapshot"
 	"github.com/ledgerwatch/log/v3"
 )
 
@@ -220,6 +223,27 @@ var (
 		Usage: "Comma separared list of addresses, whoes transactions will traced in transaction pool with debug printing",
 		Value: "",
 	}
+	TxPoolShadowFlag = cli.BoolFlag{
+		Name:  "txpool.shadow",
+		Usage: "Record rejected transactions (with reason, sender and fees) to metrics, see ./cmd/txpool/readme.md",
+	}
+	TxPoolShadowFileFlag = cli.StringFlag{
+		Name:  "txpool.shadow.file",
+		Usage: "File to append rejected transactions to, one JSON object per line (enables --txpool.shadow)",
+	}
+	TxPoolShadowPolicyFlag = cli.StringFlag{
+		Name:  "txpool.shadow.policy",
+		Usage: "Candidate pool policy to evaluate side-by-side without enforcing it, for example: pricelimit=2000000000,tiplimit=1000000000,maxdata=65536,maxgas=10000000 (enables --txpool.shadow)",
+	}
+	TxPoolEventsFlag = cli.BoolFlag{
+		Name:  "txpool.events",
+		Usage: "Publish transaction pool events (added, promoted, replaced, dropped, included) to subscribers and to gRPC stream txpoolevents.TxPoolEvents/Subscribe of --private.api.addr",
+	}
+	TxPoolFetchInflightFlag = cli.Uint64Flag{
+		Name:  "txpool.fetch.inflight",
+		Usage: "Budget in bytes of announced transactions requested from peers of all sentries and not received yet. Transaction announced by several peers is requested from one of them",
+		Value: ethconfig.Defaults.TxPool.FetchInflight,
+	}
 	// Miner settings
 	MiningEnabledFlag = cli.BoolFlag{
 		Name:  "mine",
@@ -267,6 +291,36 @@ var (
 		Name:  "miner.noverify",
 		Usage: "Disable remote sealing verification",
 	}
+	MinerBuilderAddrFlag = cli.StringFlag{
+		Name:  "miner.builder.addr",
+		Usage: "Listen address of local gRPC endpoint, which accepts transaction bundles from external builders (empty - disabled)",
+		Value: "",
+	}
+	MinerBuilderAuthTokenFlag = cli.StringFlag{
+		Name:  "miner.builder.authtoken",
+		Usage: "Required by --miner.builder.addr: gRPC requests of external builders need metadata 'authorization: Bearer <token>'",
+		Value: "",
+	}
+	MinerTxSelectionFlag = cli.StringFlag{
+		Name:  "miner.txselection",
+		Usage: "Policy of external builders' bundles selection: maxprofit, fifo",
+		Value: "maxprofit",
+	}
+	MinerRelayAddrFlag = cli.StringFlag{
+		Name:  "miner.relay.addr",
+		Usage: "Listen address of builder API (as served by mev-boost) for consensus layer: bids of --miner.relays are validated and compete with locally built payload (empty - disabled)",
+		Value: "",
+	}
+	MinerRelaysFlag = cli.StringFlag{
+		Name:  "miner.relays",
+		Usage: "Comma separated URLs of builder relays, whose bids compete with locally built payload",
+		Value: "",
+	}
+	MinerRelayTimeoutFlag = cli.DurationFlag{
+		Name:  "miner.relay.timeout",
+		Usage: "How long builder API waits for relays' bids",
+		Value: ethconfig.Defaults.Miner.RelayTimeout,
+	}
 	VMEnableDebugFlag = cli.BoolFlag{
 		Name:  "vmdebug",
 		Usage: "Record information useful for VM and contract debugging",
@@ -404,6 +458,14 @@ var (
 		Usage: "Maximum number of network peers (network disabled if set to 0)",
 		Value: node.DefaultConfig.P2P.MaxPeers,
 	}
+	P2PMaxDownloadMbpsFlag = cli.Float64Flag{
+		Name:  "p2p.max-download-mbps",
+		Usage: "Cap of devp2p download rate of all peers in megabits per second (0 - not capped)",
+	}
+	P2PMaxUploadMbpsFlag = cli.Float64Flag{
+		Name:  "p2p.max-upload-mbps",
+		Usage: "Cap of devp2p upload rate of all peers in megabits per second (0 - not capped)",
+	}
 	MaxPendingPeersFlag = cli.IntFlag{
 		Name:  "maxpendpeers",
 		Usage: "Maximum number of pending connection attempts (defaults used if set to 0)",
@@ -416,7 +478,15 @@ var (
 	}
 	SentryAddrFlag = cli.StringFlag{
 		Name:  "sentry.api.addr",
-		Usage: "comma separated sentry addresses '<host>:<port>,<host>:<port>'",
+		Usage: "comma separated sentry addresses '<host>:<port>,<host>:<port>', labelled as '<host>:<port>?region=eu&role=local'",
+	}
+	SentryPreferHeadersFlag = cli.StringFlag{
+		Name:  "sentry.prefer.headers",
+		Usage: "send header requests first to sentries with these labels, e.g. 'role=local'",
+	}
+	SentryPreferBodiesFlag = cli.StringFlag{
+		Name:  "sentry.prefer.bodies",
+		Usage: "send body requests first to sentries with these labels, e.g. 'region=eu&role=local'",
 	}
 	DownloaderAddrFlag = cli.StringFlag{
 		Name:  "downloader.api.addr",
@@ -448,13 +518,17 @@ var (
 	}
 	NATFlag = cli.StringFlag{
 		Name: "nat",
-		Usage: `NAT port mapping mechanism (any|none|upnp|pmp|extip:<IP>)
+		Usage: `NAT port mapping mechanism (any|none|upnp|pmp|stun|extip:<IP>)
 	     "" or "none"         default - do not nat
 	     "extip:77.12.33.4"   will assume the local machine is reachable on the given IP
 	     "any"                uses the first auto-detected mechanism
 	     "upnp"               uses the Universal Plug and Play protocol
 	     "pmp"                uses NAT-PMP with an auto-detected gateway address
 	     "pmp:192.168.0.1"    uses NAT-PMP with the given gateway address
+	     "stun"               only detects external IP by STUN servers, ports are forwarded manually
+	     "stun:<host>:<port>" uses the given STUN server
+	External IP is asked from STUN servers if the router doesn't know it (e.g. carrier-grade NAT).
+	Ports are mapped again when local network changes.
 `,
 		Value: "",
 	}
@@ -464,7 +538,7 @@ var (
 	}
 	DiscoveryV5Flag = cli.BoolFlag{
 		Name:  "v5disc",
-		Usage: "Enables the experimental RLPx V5 (Topic Discovery) mechanism",
+		Usage: "Enables discv5 peer discovery alongside discv4, nodes announcing incompatible fork ID in their records are not dialed",
 	}
 	NetrestrictFlag = cli.StringFlag{
 		Name:  "netrestrict",
@@ -498,6 +572,15 @@ var (
 		Usage: "Maximum gas price will be recommended by gpo",
 		Value: ethconfig.Defaults.GPO.MaxPrice.Int64(),
 	}
+	GpoMinGasPriceFlag = cli.Int64Flag{
+		Name:  "gpo.minprice",
+		Usage: "Minimum gas price will be recommended by gpo (0 = no minimum)",
+	}
+	GpoIgnoreGasPriceFlag = cli.Int64Flag{
+		Name:  "gpo.ignoreprice",
+		Usage: "Gas price below which gpo will ignore transactions",
+		Value: ethconfig.Defaults.GPO.IgnorePrice.Int64(),
+	}
 
 	// Metrics flags
 	MetricsEnabledFlag = cli.BoolFlag{
@@ -545,10 +628,57 @@ var (
 		Value: "",
 	}
 
+	HeimdallURLFlag = cli.StringFlag{
+		Name:  "bor.heimdall",
+		Usage: "URL of Heimdall service (spans and state sync events of Polygon PoS chains)",
+		Value: "http://localhost:1317",
+	}
+	WithoutHeimdallFlag = cli.BoolFlag{
+		Name:  "bor.withoutheimdall",
+		Usage: "Run without Heimdall service: validators are taken from headers, state sync events are not committed (for devnets)",
+	}
+
 	SnapshotSyncFlag = cli.BoolFlag{
 		Name:  "experimental.snapshot",
 		Usage: "Enabling experimental snapshot sync",
 	}
+	SnapshotMergeIntervalFlag = cli.DurationFlag{
+		Name:  "experimental.snapshot.merge.interval",
+		Usage: "How often to merge small snapshot segments into bigger ones in background (0 - disable)",
+		Value: time.Hour,
+	}
+	SnapshotRemoteFlag = cli.StringFlag{
+		Name: "experimental.snapshot.remote",
+		Usage: `S3-compatible bucket with snapshot segments: s3://bucket/prefix?endpoint=https://storage.googleapis.com&region=auto.
+	Segments missing in <datadir>/snapshots are fetched from there. Credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY`,
+	}
+	SnapshotRemoteLazyFlag = cli.BoolFlag{
+		Name:  "experimental.snapshot.remote.lazy",
+		Usage: "Fetch segments of --experimental.snapshot.remote on first read of their blocks instead of start (whole segment files, single blocks are not read from the bucket)",
+	}
+	SnapshotRemoteCacheFlag = cli.StringFlag{
+		Name:  "experimental.snapshot.remote.cache",
+		Usage: "How much of lazily fetched segments to keep in <datadir>/snapshots, least recently read are removed (0 - unlimited)",
+		Value: "100GB",
+	}
+	HistorySnapshotsFlag = cli.BoolFlag{
+		Name:  "experimental.history.snapshots",
+		Usage: "Read history of state from files in <datadir>/snapshots/history, created by 'erigon snapshots history'",
+	}
+
+	CLEndpointsFlag = cli.StringFlag{
+		Name:  "cl.endpoints",
+		Usage: "Comma separated consensus layer (beacon node) REST endpoints, to cross-check finalized blocks and use them as checkpoints of PoS sync",
+	}
+	CLQuorumFlag = cli.IntFlag{
+		Name:  "cl.quorum",
+		Usage: "How many of --cl.endpoints must report same finalized block (and head block with --cl.light) to trust it (0 - majority)",
+	}
+	CLLightFlag = cli.BoolFlag{
+		Name: "cl.light",
+		Usage: `Embedded light consensus layer: follow head agreed by --cl.quorum of beacon nodes of --cl.endpoints and drive execution
+	in-process, without external consensus layer client. Starts by checkpoint sync to finalized block agreed by --cl.quorum of them`,
+	}
 
 	HealthCheckFlag = cli.BoolFlag{
 		Name:  "healthcheck",
@@ -867,6 +997,12 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config, nodeName, dataDir string) {
 	if ctx.GlobalIsSet(MaxPeersFlag.Name) {
 		cfg.MaxPeers = ctx.GlobalInt(MaxPeersFlag.Name)
 	}
+	if ctx.GlobalIsSet(P2PMaxDownloadMbpsFlag.Name) {
+		cfg.MaxDownloadMbps = ctx.GlobalFloat64(P2PMaxDownloadMbpsFlag.Name)
+	}
+	if ctx.GlobalIsSet(P2PMaxUploadMbpsFlag.Name) {
+		cfg.MaxUploadMbps = ctx.GlobalFloat64(P2PMaxUploadMbpsFlag.Name)
+	}
 
 	if ctx.GlobalIsSet(MaxPendingPeersFlag.Name) {
 		cfg.MaxPendingPeers = ctx.GlobalInt(MaxPendingPeersFlag.Name)
@@ -902,6 +1038,10 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config, nodeName, dataDir string) {
 
 // SetNodeConfig applies node-related command line flags to the config.
 func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
+	cfg.Chain = ctx.GlobalString(ChainFlag.Name)
+	if cfg.Chain == "" {
+		cfg.Chain = networkname.MainnetChainName
+	}
 	setDataDir(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
 	SetP2PConfig(ctx, &cfg.P2P, cfg.NodeName(), cfg.DataDir)
@@ -982,6 +1122,14 @@ func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
 	if ctx.GlobalIsSet(GpoMaxGasPriceFlag.Name) {
 		cfg.MaxPrice = big.NewInt(ctx.GlobalInt64(GpoMaxGasPriceFlag.Name))
 	}
+	if ctx.GlobalIsSet(GpoMinGasPriceFlag.Name) {
+		if v := ctx.GlobalInt64(GpoMinGasPriceFlag.Name); v > 0 {
+			cfg.MinPrice = big.NewInt(v)
+		}
+	}
+	if ctx.GlobalIsSet(GpoIgnoreGasPriceFlag.Name) {
+		cfg.IgnorePrice = big.NewInt(ctx.GlobalInt64(GpoIgnoreGasPriceFlag.Name))
+	}
 }
 
 //nolint
@@ -995,6 +1143,12 @@ func setGPOCobra(f *pflag.FlagSet, cfg *gasprice.Config) {
 	if v := f.Int64(GpoMaxGasPriceFlag.Name, GpoMaxGasPriceFlag.Value, GpoMaxGasPriceFlag.Usage); v != nil {
 		cfg.MaxPrice = big.NewInt(*v)
 	}
+	if v := f.Int64(GpoMinGasPriceFlag.Name, GpoMinGasPriceFlag.Value, GpoMinGasPriceFlag.Usage); v != nil && *v > 0 {
+		cfg.MinPrice = big.NewInt(*v)
+	}
+	if v := f.Int64(GpoIgnoreGasPriceFlag.Name, GpoIgnoreGasPriceFlag.Value, GpoIgnoreGasPriceFlag.Usage); v != nil {
+		cfg.IgnorePrice = big.NewInt(*v)
+	}
 }
 
 func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
@@ -1053,6 +1207,26 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 			cfg.TracedSenders[i] = string(sender[:])
 		}
 	}
+	if ctx.GlobalIsSet(TxPoolShadowFlag.Name) {
+		cfg.Shadow = ctx.GlobalBool(TxPoolShadowFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolShadowFileFlag.Name) {
+		cfg.ShadowFile = ctx.GlobalString(TxPoolShadowFileFlag.Name)
+		cfg.Shadow = true
+	}
+	if ctx.GlobalIsSet(TxPoolShadowPolicyFlag.Name) {
+		cfg.ShadowPolicy = ctx.GlobalString(TxPoolShadowPolicyFlag.Name)
+		if _, err := txpoolshadow.ParsePolicy(cfg.ShadowPolicy); err != nil {
+			Fatalf("Invalid --%s: %v", TxPoolShadowPolicyFlag.Name, err)
+		}
+		cfg.Shadow = true
+	}
+	if ctx.GlobalIsSet(TxPoolEventsFlag.Name) {
+		cfg.Events = ctx.GlobalBool(TxPoolEventsFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolFetchInflightFlag.Name) {
+		cfg.FetchInflight = ctx.GlobalUint64(TxPoolFetchInflightFlag.Name)
+	}
 }
 
 func setEthash(ctx *cli.Context, datadir string, cfg *ethconfig.Config) {
@@ -1145,10 +1319,20 @@ func setAuRa(ctx *cli.Context, cfg *params.AuRaConfig, datadir string) {
 	cfg.DBPath = path.Join(datadir, "aura")
 }
 
+func setExternalConsensus(ctx *cli.Context, cfg *params.ExternalConsensusConfig, datadir string) {
+	cfg.DBPath = path.Join(datadir, "consensus")
+}
+
 func setParlia(ctx *cli.Context, cfg *params.ParliaConfig, datadir string) {
 	cfg.DBPath = path.Join(datadir, "parlia")
 }
 
+func setBor(ctx *cli.Context, cfg *params.BorConfig, datadir string) {
+	cfg.DBPath = path.Join(datadir, "bor")
+	cfg.HeimdallURL = ctx.GlobalString(HeimdallURLFlag.Name)
+	cfg.WithoutHeimdall = ctx.GlobalBool(WithoutHeimdallFlag.Name)
+}
+
 func setMiner(ctx *cli.Context, cfg *params.MiningConfig) {
 	if ctx.GlobalIsSet(MiningEnabledFlag.Name) {
 		cfg.Enabled = true
@@ -1177,6 +1361,20 @@ func setMiner(ctx *cli.Context, cfg *params.MiningConfig) {
 	if ctx.GlobalIsSet(MinerNoVerfiyFlag.Name) {
 		cfg.Noverify = ctx.GlobalBool(MinerNoVerfiyFlag.Name)
 	}
+	if ctx.GlobalIsSet(MinerBuilderAddrFlag.Name) {
+		cfg.BuilderAddr = ctx.GlobalString(MinerBuilderAddrFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerBuilderAuthTokenFlag.Name) {
+		cfg.BuilderAuthToken = ctx.GlobalString(MinerBuilderAuthTokenFlag.Name)
+	}
+	cfg.TxSelection = ctx.GlobalString(MinerTxSelectionFlag.Name)
+	if ctx.GlobalIsSet(MinerRelayAddrFlag.Name) {
+		cfg.RelayAddr = ctx.GlobalString(MinerRelayAddrFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerRelaysFlag.Name) {
+		cfg.Relays = SplitAndTrim(ctx.GlobalString(MinerRelaysFlag.Name))
+	}
+	cfg.RelayTimeout = ctx.GlobalDuration(MinerRelayTimeoutFlag.Name)
 }
 
 func setWhitelist(ctx *cli.Context, cfg *ethconfig.Config) {
@@ -1248,6 +1446,15 @@ func SetEthConfig(ctx *cli.Context, nodeConfig *node.Config, cfg *ethconfig.Conf
 	if ctx.GlobalBool(SnapshotSyncFlag.Name) {
 		cfg.Snapshot.Enabled = true
 		cfg.Snapshot.Dir = path.Join(nodeConfig.DataDir, "snapshots")
+		cfg.Snapshot.MergeInterval = ctx.GlobalDuration(SnapshotMergeIntervalFlag.Name)
+		cfg.Snapshot.Remote = ctx.GlobalString(SnapshotRemoteFlag.Name)
+		cfg.Snapshot.RemoteLazy = ctx.GlobalBool(SnapshotRemoteLazyFlag.Name)
+		if err := cfg.Snapshot.RemoteCacheSize.UnmarshalText([]byte(ctx.GlobalString(SnapshotRemoteCacheFlag.Name))); err != nil {
+			Fatalf("Invalid --%s: %v", SnapshotRemoteCacheFlag.Name, err)
+		}
+	}
+	if ctx.GlobalBool(HistorySnapshotsFlag.Name) {
+		cfg.Snapshot.HistoryDir = path.Join(nodeConfig.DataDir, "snapshots", historysnapshot.DirName)
 	}
 
 	CheckExclusive(ctx, MinerSigningKeyFileFlag, MinerEtherbaseFlag)
@@ -1258,8 +1465,15 @@ func SetEthConfig(ctx *cli.Context, nodeConfig *node.Config, cfg *ethconfig.Conf
 	setClique(ctx, &cfg.Clique, nodeConfig.DataDir)
 	setAuRa(ctx, &cfg.Aura, nodeConfig.DataDir)
 	setParlia(ctx, &cfg.Parlia, nodeConfig.DataDir)
+	setExternalConsensus(ctx, &cfg.External, nodeConfig.DataDir)
+	setBor(ctx, &cfg.Bor, nodeConfig.DataDir)
 	setMiner(ctx, &cfg.Miner)
 	setWhitelist(ctx, cfg)
+	cfg.CLEndpoints = SplitAndTrim(ctx.GlobalString(CLEndpointsFlag.Name))
+	cfg.CLQuorum = ctx.GlobalInt(CLQuorumFlag.Name)
+	cfg.CLLight = ctx.GlobalBool(CLLightFlag.Name)
+	cfg.SentryPreferHeaders = ctx.GlobalString(SentryPreferHeadersFlag.Name)
+	cfg.SentryPreferBodies = ctx.GlobalString(SentryPreferBodiesFlag.Name)
 
 	cfg.P2PEnabled = len(nodeConfig.P2P.SentryAddr) == 0
 
@@ -1456,6 +1670,10 @@ func CobraFlags(cmd *cobra.Command, urfaveCliFlags []cli.Flag) {
 			flags.String(f.Name, f.Value, f.Usage)
 		case cli.BoolFlag:
 			flags.Bool(f.Name, false, f.Usage)
+		case cli.Float64Flag:
+			flags.Float64(f.Name, f.Value, f.Usage)
+		case cli.DurationFlag:
+			flags.Duration(f.Name, f.Value, f.Usage)
 		default:
 			panic(fmt.Errorf("unexpected type: %T", flag))
 		}
@@ -56,7 +56,7 @@ func FindAccount(c kv.CursorDupSort, blockNumber uint64, key []byte) ([]byte, er
 	return v, nil
 }
 
-// GetModifiedAccounts returns a list of addresses that were modified in the block range
+// GetModifiedAccounts returns a sorted list of addresses that were modified in the block range
 // [startNum:endNum)
 func GetModifiedAccounts(db kv.Tx, startNum, endNum uint64) ([]common.Address, error) {
 	changedAddrs := make(map[common.Address]struct{})
@@ -77,6 +77,7 @@ func GetModifiedAccounts(db kv.Tx, startNum, endNum uint64) ([]common.Address, e
 		copy(result[idx][:], addr[:])
 		idx++
 	}
+	sort.Slice(result, func(i, j int) bool { return bytes.Compare(result[i][:], result[j][:]) < 0 })
 
 	return result, nil
 }
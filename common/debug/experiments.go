@@ -119,3 +119,18 @@ func StopBeforeStage() string {
 	stopBeforeStageFlag.Do(f)
 	return stopBeforeStage
 }
+
+var (
+	diffFuzzCorpusDir     string
+	diffFuzzCorpusDirFlag sync.Once
+)
+
+// DIFFFUZZ_CORPUS_DIR - directory where binary built with `difffuzz` tag exports transactions with diverging
+// execution results, before panic
+func DiffFuzzCorpusDir() string {
+	diffFuzzCorpusDirFlag.Do(func() {
+		v, _ := os.LookupEnv("DIFFFUZZ_CORPUS_DIR")
+		diffFuzzCorpusDir = v
+	})
+	return diffFuzzCorpusDir
+}
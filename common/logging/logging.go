@@ -0,0 +1,194 @@
+// Package logging - log levels per subsystem of the node. Subsystem of a record is found by package of the code which
+// logged it, e.g. records of eth/stagedsync belong to "stages". Levels are set by --log.levels and changed at runtime
+// by admin_setLogLevel; records of code outside of subsystems are filtered by default level (--verbosity).
+package logging
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ledgerwatch/log/v3"
+)
+
+// Subsystems - names of subsystems and packages of their code
+var Subsystems = map[string][]string{
+	"downloader": {"github.com/ledgerwatch/erigon/cmd/downloader", "github.com/ledgerwatch/erigon-lib/downloader", "github.com/ledgerwatch/erigon/turbo/snapshotsync"},
+	"sentry":     {"github.com/ledgerwatch/erigon/cmd/sentry", "github.com/ledgerwatch/erigon/p2p"},
+	"stages":     {"github.com/ledgerwatch/erigon/eth/stagedsync", "github.com/ledgerwatch/erigon/turbo/stages"},
+	"rpcdaemon":  {"github.com/ledgerwatch/erigon/cmd/rpcdaemon", "github.com/ledgerwatch/erigon/rpc", "github.com/ledgerwatch/erigon/turbo/rpchelper"},
+	"txpool":     {"github.com/ledgerwatch/erigon/cmd/txpool", "github.com/ledgerwatch/erigon-lib/txpool"},
+}
+
+// Default - name of levels of code outside of subsystems
+const Default = "default"
+
+type filter struct {
+	names  []string // subsystems, sorted; index len(names) - default
+	levels []int32  // atomic, log.Lvl by index of names
+	max    int32    // atomic, max of levels: records above are dropped without finding subsystem
+	byPC   sync.Map // uintptr -> int, subsystem of caller
+	json   bool     // records get "subsystem" key
+	next   log.Handler
+}
+
+var (
+	current atomic.Value // *filter
+	setLock sync.Mutex   // serializes updates of levels and their max
+)
+
+// Handler - filters records by level of their subsystem and passes them to next. json - adds key "subsystem" to
+// records, for log ingestion pipelines. Becomes target of SetLevel
+func Handler(defaultLvl log.Lvl, json bool, next log.Handler) log.Handler {
+	f := &filter{json: json, next: next}
+	for name := range Subsystems {
+		f.names = append(f.names, name)
+	}
+	sort.Strings(f.names)
+	f.levels = make([]int32, len(f.names)+1)
+	for i := range f.levels {
+		f.levels[i] = int32(defaultLvl)
+	}
+	f.max = int32(defaultLvl)
+	current.Store(f)
+	return f
+}
+
+func (f *filter) Log(r *log.Record) error {
+	if int32(r.Lvl) > atomic.LoadInt32(&f.max) {
+		return nil
+	}
+	i := f.subsystem(r)
+	if int32(r.Lvl) > atomic.LoadInt32(&f.levels[i]) {
+		return nil
+	}
+	if f.json && i < len(f.names) {
+		r.Ctx = append(r.Ctx, "subsystem", f.names[i])
+	}
+	return f.next.Log(r)
+}
+
+func (f *filter) subsystem(r *log.Record) int {
+	pc := r.Call.PC()
+	if i, ok := f.byPC.Load(pc); ok {
+		return i.(int)
+	}
+	fn := r.Call.Frame().Function
+	i := len(f.names)
+found:
+	for j, name := range f.names {
+		for _, pkg := range Subsystems[name] {
+			if inPackage(fn, pkg) {
+				i = j
+				break found
+			}
+		}
+	}
+	f.byPC.Store(pc, i)
+	return i
+}
+
+// inPackage - function fn (e.g. "github.com/ledgerwatch/erigon/p2p/discover.(*UDPv4).loop") is in package pkg or its subpackage
+func inPackage(fn, pkg string) bool {
+	return strings.HasPrefix(fn, pkg) && len(fn) > len(pkg) && (fn[len(pkg)] == '.' || fn[len(pkg)] == '/')
+}
+
+func (f *filter) index(subsystem string) (int, error) {
+	if subsystem == Default {
+		return len(f.names), nil
+	}
+	i := sort.SearchStrings(f.names, subsystem)
+	if i == len(f.names) || f.names[i] != subsystem {
+		return 0, fmt.Errorf("unknown subsystem %q, known: %s, %s", subsystem, strings.Join(f.names, ", "), Default)
+	}
+	return i, nil
+}
+
+// ParseLevel - level by name (trace, debug, info, warn, error, crit) or number 0..5 of --verbosity
+func ParseLevel(s string) (log.Lvl, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < int(log.LvlCrit) || n > int(log.LvlTrace) {
+			return 0, fmt.Errorf("log level must be in %d..%d: %d", log.LvlCrit, log.LvlTrace, n)
+		}
+		return log.Lvl(n), nil
+	}
+	if strings.ToLower(s) == "trace" {
+		return log.LvlTrace, nil
+	}
+	return log.LvlFromString(s)
+}
+
+// SetLevel - changes level of subsystem (or Default) at runtime
+func SetLevel(subsystem string, lvl log.Lvl) error {
+	f, _ := current.Load().(*filter)
+	if f == nil {
+		return fmt.Errorf("log levels per subsystem are not set up")
+	}
+	i, err := f.index(subsystem)
+	if err != nil {
+		return err
+	}
+	setLock.Lock()
+	defer setLock.Unlock()
+	atomic.StoreInt32(&f.levels[i], int32(lvl))
+	max := int32(log.LvlCrit)
+	for j := range f.levels {
+		if l := atomic.LoadInt32(&f.levels[j]); l > max {
+			max = l
+		}
+	}
+	atomic.StoreInt32(&f.max, max)
+	return nil
+}
+
+// SetLevels - applies `subsystem=level,...` of --log.levels
+func SetLevels(levels string) error {
+	for _, item := range strings.Split(levels, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("log level must be subsystem=level: %q", item)
+		}
+		lvl, err := ParseLevel(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return err
+		}
+		if err = SetLevel(strings.TrimSpace(kv[0]), lvl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Levels - current levels of subsystems and Default, by name
+func Levels() map[string]string {
+	f, _ := current.Load().(*filter)
+	if f == nil {
+		return map[string]string{}
+	}
+	res := make(map[string]string, len(f.levels))
+	for i := range f.levels {
+		name := Default
+		if i < len(f.names) {
+			name = f.names[i]
+		}
+		res[name] = levelName(log.Lvl(atomic.LoadInt32(&f.levels[i])))
+	}
+	return res
+}
+
+func levelName(lvl log.Lvl) string {
+	switch lvl {
+	case log.LvlDebug:
+		return "debug"
+	case log.LvlError:
+		return "error"
+	default:
+		return lvl.String()
+	}
+}
@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevels(t *testing.T) {
+	// code of this package belongs to "stages" in the test
+	defer func(pkgs []string) { Subsystems["stages"] = pkgs }(Subsystems["stages"])
+	Subsystems["stages"] = []string{"github.com/ledgerwatch/erigon/common/logging"}
+
+	var records []*log.Record
+	logger := log.New()
+	logger.SetHandler(Handler(log.LvlInfo, true, log.FuncHandler(func(r *log.Record) error {
+		records = append(records, r)
+		return nil
+	})))
+	logger.Debug("dropped")
+	logger.Info("passed")
+	require.Len(t, records, 1)
+	require.Equal(t, []interface{}{"subsystem", "stages"}, records[0].Ctx)
+
+	require.NoError(t, SetLevels("stages=debug, txpool=1"))
+	logger.Debug("passed")
+	require.Len(t, records, 2)
+	require.Equal(t, "debug", Levels()["stages"])
+	require.Equal(t, "error", Levels()["txpool"])
+	require.Equal(t, "info", Levels()[Default])
+
+	require.NoError(t, SetLevel("stages", log.LvlWarn))
+	logger.Info("dropped")
+	require.Len(t, records, 2)
+
+	require.Error(t, SetLevels("execution=debug"))
+	require.Error(t, SetLevels("stages"))
+	require.Error(t, SetLevels("stages=verbose"))
+}
+
+func TestInPackage(t *testing.T) {
+	require.True(t, inPackage("github.com/ledgerwatch/erigon/p2p.(*Server).run", "github.com/ledgerwatch/erigon/p2p"))
+	require.True(t, inPackage("github.com/ledgerwatch/erigon/p2p/discover.(*UDPv4).loop", "github.com/ledgerwatch/erigon/p2p"))
+	require.False(t, inPackage("github.com/ledgerwatch/erigon/p2psim.main", "github.com/ledgerwatch/erigon/p2p"))
+	require.False(t, inPackage("github.com/ledgerwatch/erigon/cmd/rpcdaemon/commands.New", "github.com/ledgerwatch/erigon/rpc"))
+}
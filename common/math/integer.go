@@ -56,6 +56,25 @@ func (i HexOrDecimal64) MarshalText() ([]byte, error) {
 	return []byte(fmt.Sprintf("%#x", uint64(i))), nil
 }
 
+// Decimal64 marshals uint64 as a decimal string. When unmarshalling,
+// it however accepts either "0x"-prefixed (hex encoded) or non-prefixed (decimal)
+type Decimal64 uint64
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (i *Decimal64) UnmarshalText(input []byte) error {
+	int, ok := ParseUint64(string(input))
+	if !ok {
+		return fmt.Errorf("invalid hex or decimal integer %q", input)
+	}
+	*i = Decimal64(int)
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (i Decimal64) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatUint(uint64(i), 10)), nil
+}
+
 // ParseUint64 parses s as an integer in decimal or hexadecimal syntax.
 // Leading zeros are accepted. The empty string parses as zero.
 func ParseUint64(s string) (uint64, bool) {
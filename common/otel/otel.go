@@ -0,0 +1,188 @@
+// Package otel - minimal OpenTelemetry tracing: spans are linked through context and exported by OTLP/HTTP (JSON
+// encoding) to collector, e.g. OpenTelemetry Collector, Jaeger or Tempo. Until Setup is called spans are not
+// recorded: Start returns nil span, and methods of nil span do nothing, so instrumented code costs one atomic load.
+//
+// Traces are continued from incoming W3C `traceparent` header, see Extract.
+package otel
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Kind int
+
+// Kinds of spans, values of OTLP
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Attr - attribute of span, Value is string, int64, uint64 (exported as int) or bool
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Attr      { return Attr{Key: key, Value: value} }
+func Int(key string, value int64) Attr   { return Attr{Key: key, Value: value} }
+func Uint(key string, value uint64) Attr { return Attr{Key: key, Value: value} }
+func Bool(key string, value bool) Attr   { return Attr{Key: key, Value: value} }
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// Span - timed operation of trace. Not safe for concurrent use: span is ended by goroutine which started it
+type Span struct {
+	TraceID  TraceID
+	ID       SpanID
+	Parent   SpanID // zero for root span
+	Name     string
+	Kind     Kind
+	Start    time.Time
+	End      time.Time
+	Attrs    []Attr
+	Error    string // status is error if it's not empty
+	exporter *exporter
+}
+
+// SetAttrs - adds attributes to the span
+func (s *Span) SetAttrs(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.Attrs = append(s.Attrs, attrs...)
+}
+
+// SetError - marks the span as failed, nil error is ignored
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.Error = err.Error()
+}
+
+// Finish - ends the span and queues it for export
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.End = time.Now()
+	s.exporter.add(s)
+}
+
+// spanContext - identity of span which is parent of new spans: local span or remote one from traceparent
+type spanContext struct {
+	traceID TraceID
+	spanID  SpanID
+	sampled bool
+}
+
+type spanContextKey struct{}
+
+// Start - starts span which is child of span in ctx, or root span of new trace (sampled by ratio of Setup).
+// Returns nil span if tracing is not set up or trace is not sampled
+func Start(ctx context.Context, kind Kind, name string, attrs ...Attr) (context.Context, *Span) {
+	e := getExporter()
+	if e == nil {
+		return ctx, nil
+	}
+	parent, ok := ctx.Value(spanContextKey{}).(spanContext)
+	if ok && !parent.sampled {
+		return ctx, nil
+	}
+	if !ok && !e.sample() {
+		return context.WithValue(ctx, spanContextKey{}, spanContext{}), nil
+	}
+	s := &Span{Name: name, Kind: kind, Start: time.Now(), Attrs: attrs, exporter: e}
+	if ok {
+		s.TraceID, s.Parent = parent.traceID, parent.spanID
+	} else {
+		randomID(s.TraceID[:])
+	}
+	randomID(s.ID[:])
+	return context.WithValue(ctx, spanContextKey{}, spanContext{traceID: s.TraceID, spanID: s.ID, sampled: true}), s
+}
+
+// StartChild - starts span only inside of sampled trace: for frequent operations (e.g. database reads) which are
+// interesting only as part of traced request
+func StartChild(ctx context.Context, kind Kind, name string, attrs ...Attr) (context.Context, *Span) {
+	if parent, ok := ctx.Value(spanContextKey{}).(spanContext); !ok || !parent.sampled {
+		return ctx, nil
+	}
+	return Start(ctx, kind, name, attrs...)
+}
+
+// Extract - continues trace of W3C traceparent header `00-<trace id>-<parent span id>-<flags>`, invalid header is ignored
+func Extract(ctx context.Context, traceparent string) context.Context {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ctx
+	}
+	var sc spanContext
+	flags, err1 := hex.DecodeString(parts[3])
+	_, err2 := hex.Decode(sc.traceID[:], []byte(parts[1]))
+	_, err3 := hex.Decode(sc.spanID[:], []byte(parts[2]))
+	if err1 != nil || err2 != nil || err3 != nil || sc.traceID == (TraceID{}) || sc.spanID == (SpanID{}) {
+		return ctx
+	}
+	sc.sampled = flags[0]&1 == 1
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// Traceparent - W3C traceparent header of span in ctx, empty if there is no sampled span
+func Traceparent(ctx context.Context) string {
+	sc, ok := ctx.Value(spanContextKey{}).(spanContext)
+	if !ok || !sc.sampled {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", sc.traceID, sc.spanID)
+}
+
+var (
+	randLock sync.Mutex
+	randBuf  [4096]byte
+	randPos  = len(randBuf)
+)
+
+func randomID(id []byte) {
+	randLock.Lock()
+	defer randLock.Unlock()
+	for {
+		if randPos+len(id) > len(randBuf) {
+			if _, err := rand.Read(randBuf[:]); err != nil {
+				binary.BigEndian.PutUint64(randBuf[:], uint64(time.Now().UnixNano()))
+			}
+			randPos = 0
+		}
+		copy(id, randBuf[randPos:])
+		randPos += len(id)
+		// zero ids are invalid
+		for _, b := range id {
+			if b != 0 {
+				return
+			}
+		}
+	}
+}
+
+var global atomic.Value // *exporter
+
+// Enabled - spans are exported, Setup is called
+func Enabled() bool { return getExporter() != nil }
+
+func getExporter() *exporter {
+	e, _ := global.Load().(*exporter)
+	return e
+}
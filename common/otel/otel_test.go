@@ -0,0 +1,80 @@
+package otel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	var lock sync.Mutex
+	var spans []map[string]interface{}
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/traces", r.URL.Path)
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []map[string]interface{}
+				}
+			}
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		lock.Lock()
+		defer lock.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	// not set up: nothing is recorded
+	_, span := Start(context.Background(), KindServer, "eth_call")
+	require.Nil(t, span)
+	span.SetError(errors.New("ignored"))
+	span.Finish()
+
+	require.NoError(t, Setup(collector.URL, "test", 1))
+	ctx := Extract(context.Background(), "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	ctx, span = Start(ctx, KindServer, "eth_call", String("rpc.method", "eth_call"))
+	require.Equal(t, "0af7651916cd43dd8448eb211c80319c", span.TraceID.String())
+	require.Equal(t, "b7ad6b7169203331", span.Parent.String())
+	_, child := StartChild(ctx, KindClient, "db.read", Int("db.gets", 3))
+	require.Equal(t, span.TraceID, child.TraceID)
+	require.Equal(t, span.ID, child.Parent)
+	child.Finish()
+	span.SetError(errors.New("execution reverted"))
+	span.Finish()
+
+	// outside of traced request child spans are not started, unsampled traces are not recorded
+	_, orphan := StartChild(context.Background(), KindClient, "db.read")
+	require.Nil(t, orphan)
+	_, unsampled := Start(Extract(context.Background(), "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00"), KindServer, "eth_call")
+	require.Nil(t, unsampled)
+
+	Shutdown()
+	require.False(t, Enabled())
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(t, spans, 2)
+	require.Equal(t, "db.read", spans[0]["name"])
+	require.Equal(t, span.ID.String(), spans[0]["parentSpanId"])
+	require.Equal(t, "eth_call", spans[1]["name"])
+	require.Equal(t, "0af7651916cd43dd8448eb211c80319c", spans[1]["traceId"])
+	require.Equal(t, map[string]interface{}{"code": float64(2), "message": "execution reverted"}, spans[1]["status"])
+}
+
+func TestExtractInvalid(t *testing.T) {
+	for _, header := range []string{"", "garbage", "00-00000000000000000000000000000000-b7ad6b7169203331-01", "01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"} {
+		require.Equal(t, "", Traceparent(Extract(context.Background(), header)), header)
+	}
+	require.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		Traceparent(Extract(context.Background(), "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")))
+}
@@ -0,0 +1,257 @@
+package otel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/log/v3"
+)
+
+var (
+	// BatchSize - spans are exported by batches of this size, or every FlushInterval
+	BatchSize     = 512
+	FlushInterval = 5 * time.Second
+	queueSize     = 4096
+
+	droppedSpans = metrics.GetOrCreateCounter("otel_dropped_spans")
+)
+
+// exporter - sends finished spans to OTLP/HTTP endpoint. Spans are dropped if the queue is full: tracing must not slow
+// down traced code
+type exporter struct {
+	url     string
+	service string
+	ratio   float64
+	client  *http.Client
+
+	queue chan *Span
+	quit  chan struct{}
+	wg    sync.WaitGroup
+
+	randLock sync.Mutex
+	rand     *rand.Rand
+}
+
+// Setup - starts export of spans to OTLP/HTTP collector, e.g. `http://localhost:4318` (path /v1/traces is added if
+// endpoint has no path). ratio - share of sampled root spans: 1 - all, 0.01 - every hundredth. Spans of traces
+// continued from traceparent header are sampled by its flag
+func Setup(endpoint, service string, ratio float64) error {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return fmt.Errorf("otlp endpoint must be http:// or https:// url: %s", endpoint)
+	}
+	if ratio < 0 || ratio > 1 {
+		return fmt.Errorf("sample ratio must be in [0, 1]: %f", ratio)
+	}
+	url := strings.TrimSuffix(endpoint, "/")
+	if strings.Count(url, "/") == 2 {
+		url += "/v1/traces"
+	}
+	e := &exporter{
+		url:     url,
+		service: service,
+		ratio:   ratio,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		queue:   make(chan *Span, queueSize),
+		quit:    make(chan struct{}),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec
+	}
+	Shutdown()
+	e.wg.Add(1)
+	go e.loop()
+	global.Store(e)
+	log.Info("Exporting traces", "endpoint", url, "sample", ratio)
+	return nil
+}
+
+// Shutdown - stops recording of spans and exports queued ones
+func Shutdown() {
+	e := getExporter()
+	if e == nil {
+		return
+	}
+	global.Store((*exporter)(nil))
+	close(e.quit)
+	e.wg.Wait()
+}
+
+func (e *exporter) sample() bool {
+	if e.ratio >= 1 {
+		return true
+	}
+	e.randLock.Lock()
+	defer e.randLock.Unlock()
+	return e.rand.Float64() < e.ratio
+}
+
+func (e *exporter) add(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+		droppedSpans.Inc()
+	}
+}
+
+func (e *exporter) loop() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(FlushInterval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			droppedSpans.Add(len(batch))
+			log.Debug("[otel] Export of spans failed", "spans", len(batch), "err", err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case s := <-e.queue:
+			if batch = append(batch, s); len(batch) >= BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.quit:
+			for {
+				select {
+				case s := <-e.queue:
+					batch = append(batch, s)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *exporter) export(spans []*Span) error {
+	body, err := json.Marshal(encodeSpans(e.service, spans))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded %s", resp.Status)
+	}
+	return nil
+}
+
+// OTLP JSON encoding of ExportTraceServiceRequest: ids are hex, 64-bit integers are strings
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              Kind       `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` // 0 - unset, 2 - error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func encodeAttrs(attrs []Attr) []otlpAttr {
+	res := make([]otlpAttr, 0, len(attrs))
+	for _, a := range attrs {
+		var v map[string]interface{}
+		switch value := a.Value.(type) {
+		case string:
+			v = map[string]interface{}{"stringValue": value}
+		case int64:
+			v = map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}
+		case uint64:
+			v = map[string]interface{}{"intValue": strconv.FormatUint(value, 10)}
+		case bool:
+			v = map[string]interface{}{"boolValue": value}
+		default:
+			v = map[string]interface{}{"stringValue": fmt.Sprint(value)}
+		}
+		res = append(res, otlpAttr{Key: a.Key, Value: v})
+	}
+	return res
+}
+
+func encodeSpans(service string, spans []*Span) otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.ID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        encodeAttrs(s.Attrs),
+		}
+		if s.Parent != (SpanID{}) {
+			span.ParentSpanID = s.Parent.String()
+		}
+		if s.Error != "" {
+			span.Status = otlpStatus{Code: 2, Message: s.Error}
+		}
+		encoded = append(encoded, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: encodeAttrs([]Attr{String("service.name", service)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/ledgerwatch/erigon"}, Spans: encoded}},
+	}}}
+}
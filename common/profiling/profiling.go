@@ -0,0 +1,282 @@
+// Package profiling - continuous profiling of the process: CPU and heap profiles are captured periodically into a ring
+// of files and/or pushed to Pyroscope-compatible server, heap profile is dumped when RSS crosses a threshold - so memory
+// incidents during sync can be diagnosed after the fact.
+package profiling
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/log/v3"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// CPUWindow - length of periodic CPU profile, shorter if Interval is shorter
+const CPUWindow = 30 * time.Second
+
+// rssCheckEvery - how often RSS is compared with HeapDumpRSS
+const rssCheckEvery = 10 * time.Second
+
+type Config struct {
+	Dir         string        // ring of profile files and heap dumps, "" - profiles are only pushed
+	Interval    time.Duration // between periodic captures, 0 - disabled
+	Keep        int           // files of each kind (cpu, heap, heapdump) kept in Dir
+	PushURL     string        // Pyroscope server (e.g. http://localhost:4040), "" - profiles are not pushed
+	App         string        // application name of pushed profiles
+	HeapDumpRSS uint64        // heap profile is written to Dir when RSS of the process crosses it, 0 - disabled
+}
+
+func (cfg Config) validate() error {
+	if cfg.Interval > 0 && cfg.Dir == "" && cfg.PushURL == "" {
+		return fmt.Errorf("periodic profiles need a directory or push URL")
+	}
+	if cfg.HeapDumpRSS > 0 && cfg.Dir == "" {
+		return fmt.Errorf("heap dumps need a directory")
+	}
+	if cfg.Dir != "" && cfg.Keep < 1 {
+		return fmt.Errorf("at least 1 file of each kind must be kept, got %d", cfg.Keep)
+	}
+	if cfg.PushURL != "" {
+		if _, err := url.Parse(cfg.PushURL); err != nil {
+			return fmt.Errorf("push URL: %w", err)
+		}
+	}
+	return nil
+}
+
+type profiler struct {
+	cfg    Config
+	client *http.Client
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var (
+	lock    sync.Mutex
+	running *profiler
+)
+
+// Start - starts periodic capture and RSS watching in background, until Stop
+func Start(cfg Config) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+			return err
+		}
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if running != nil {
+		return fmt.Errorf("profiling is already started")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &profiler{cfg: cfg, client: &http.Client{Timeout: 30 * time.Second}, cancel: cancel}
+	if cfg.Interval > 0 {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.capturePeriodically(ctx)
+		}()
+	}
+	if cfg.HeapDumpRSS > 0 {
+		proc, err := process.NewProcess(int32(os.Getpid()))
+		if err != nil {
+			cancel()
+			return fmt.Errorf("can't watch RSS: %w", err)
+		}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.watchRSS(ctx, proc)
+		}()
+	}
+	running = p
+	log.Info("Continuous profiling started", "dir", cfg.Dir, "interval", cfg.Interval, "push", cfg.PushURL, "heapDumpRSS", cfg.HeapDumpRSS)
+	return nil
+}
+
+// Stop - stops background capture, waits for running one
+func Stop() {
+	lock.Lock()
+	p := running
+	running = nil
+	lock.Unlock()
+	if p == nil {
+		return
+	}
+	p.cancel()
+	p.wg.Wait()
+}
+
+func (p *profiler) capturePeriodically(ctx context.Context) {
+	window := CPUWindow
+	if p.cfg.Interval < window {
+		window = p.cfg.Interval / 2
+	}
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		from := time.Now()
+		cpu, err := captureCPU(ctx, window)
+		if err != nil {
+			// e.g. CPU profile of --pprof.cpuprofile or /debug/pprof/profile is running
+			log.Debug("Periodic CPU profile skipped", "err", err)
+		} else {
+			p.save(ctx, "cpu", from, time.Now(), cpu)
+		}
+		heap, err := captureHeap()
+		if err != nil {
+			log.Warn("Periodic heap profile failed", "err", err)
+			continue
+		}
+		p.save(ctx, "heap", time.Now(), time.Now(), heap)
+	}
+}
+
+func (p *profiler) watchRSS(ctx context.Context, proc *process.Process) {
+	ticker := time.NewTicker(rssCheckEvery)
+	defer ticker.Stop()
+	dumped := false // dump once per crossing of threshold
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		mem, err := proc.MemoryInfo()
+		if err != nil {
+			log.Warn("Can't read RSS, heap dumps disabled", "err", err)
+			return
+		}
+		if mem.RSS < p.cfg.HeapDumpRSS {
+			dumped = false
+			continue
+		}
+		if dumped {
+			continue
+		}
+		dumped = true
+		heap, err := captureHeap()
+		if err != nil {
+			log.Warn("Heap dump failed", "err", err)
+			continue
+		}
+		path, err := writeRing(p.cfg.Dir, "heapdump", time.Now(), heap, p.cfg.Keep)
+		if err != nil {
+			log.Warn("Heap dump failed", "err", err)
+			continue
+		}
+		log.Warn("RSS crossed threshold, heap dumped", "rss", mem.RSS, "threshold", p.cfg.HeapDumpRSS, "file", path)
+	}
+}
+
+func (p *profiler) save(ctx context.Context, kind string, from, until time.Time, profile []byte) {
+	if p.cfg.Dir != "" {
+		if _, err := writeRing(p.cfg.Dir, kind, until, profile, p.cfg.Keep); err != nil {
+			log.Warn("Can't write profile", "kind", kind, "err", err)
+		}
+	}
+	if p.cfg.PushURL != "" {
+		if err := push(ctx, p.client, p.cfg.PushURL, p.cfg.App+"."+kind, from, until, profile); err != nil {
+			log.Warn("Can't push profile", "kind", kind, "err", err)
+		}
+	}
+}
+
+func captureCPU(ctx context.Context, window time.Duration) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(window):
+	}
+	pprof.StopCPUProfile()
+	return buf.Bytes(), nil
+}
+
+func captureHeap() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeRing - writes profile to dir as <kind>-<time>.pb.gz, removes the oldest files of kind above keep
+func writeRing(dir, kind string, at time.Time, profile []byte, keep int) (string, error) {
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.pb.gz", kind, at.UTC().Format("20060102-150405.000")))
+	if err := ioutil.WriteFile(path, profile, 0644); err != nil {
+		return "", err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, kind+"-*.pb.gz"))
+	if err != nil {
+		return path, err
+	}
+	sort.Strings(files) // by time: names differ only by it
+	for len(files) > keep {
+		if err = os.Remove(files[0]); err != nil {
+			return path, err
+		}
+		files = files[1:]
+	}
+	return path, nil
+}
+
+// push - sends profile to /ingest of Pyroscope server, as form field "profile" in pprof format
+func push(ctx context.Context, client *http.Client, pushURL, name string, from, until time.Time, profile []byte) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	fw, err := form.CreateFormFile("profile", "profile.pprof")
+	if err != nil {
+		return err
+	}
+	if _, err = fw.Write(profile); err != nil {
+		return err
+	}
+	if err = form.Close(); err != nil {
+		return err
+	}
+	q := url.Values{}
+	q.Set("name", name)
+	q.Set("from", fmt.Sprint(from.Unix()))
+	q.Set("until", fmt.Sprint(until.Unix()))
+	q.Set("spyName", "gospy")
+	q.Set("format", "pprof")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(pushURL, "/")+"/ingest?"+q.Encode(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
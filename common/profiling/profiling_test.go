@@ -0,0 +1,77 @@
+package profiling
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRing(t *testing.T) {
+	dir := t.TempDir()
+	at := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		_, err := writeRing(dir, "heap", at.Add(time.Duration(i)*time.Second), []byte{byte(i)}, 3)
+		require.NoError(t, err)
+	}
+	_, err := writeRing(dir, "cpu", at, []byte{0}, 3)
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "heap-*.pb.gz"))
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+	require.Equal(t, "heap-20220101-000002.000.pb.gz", filepath.Base(files[0]))
+	content, err := ioutil.ReadFile(files[2])
+	require.NoError(t, err)
+	require.Equal(t, []byte{4}, content)
+
+	files, err = filepath.Glob(filepath.Join(dir, "cpu-*.pb.gz"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+}
+
+func TestPush(t *testing.T) {
+	var name, profile string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ingest" {
+			http.NotFound(w, r)
+			return
+		}
+		name = r.URL.Query().Get("name")
+		f, _, err := r.FormFile("profile")
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(f)
+		require.NoError(t, err)
+		profile = string(content)
+	}))
+	defer server.Close()
+
+	require.NoError(t, push(context.Background(), server.Client(), server.URL+"/", "erigon.cpu", time.Now(), time.Now(), []byte("pprof")))
+	require.Equal(t, "erigon.cpu", name)
+	require.Equal(t, "pprof", profile)
+
+	require.Error(t, push(context.Background(), server.Client(), server.URL+"/missing", "erigon.cpu", time.Now(), time.Now(), nil))
+}
+
+func TestStart(t *testing.T) {
+	require.Error(t, Start(Config{Interval: time.Second}))
+	require.Error(t, Start(Config{HeapDumpRSS: 1}))
+
+	dir := t.TempDir()
+	require.NoError(t, Start(Config{Dir: dir, Interval: 100 * time.Millisecond, Keep: 2}))
+	require.Error(t, Start(Config{Dir: dir, Interval: time.Second, Keep: 2}))
+	require.Eventually(t, func() bool {
+		files, _ := filepath.Glob(filepath.Join(dir, "heap-*.pb.gz"))
+		return len(files) == 2
+	}, 5*time.Second, 50*time.Millisecond)
+	Stop()
+
+	files, err := filepath.Glob(filepath.Join(dir, "cpu-*.pb.gz"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+}
@@ -0,0 +1,118 @@
+// Package reqlabel - labels of RPC request (id, method, client) carried by context into database read transactions.
+// rpcdaemon sets them for each RPC call, remote KV client sends them to the node as gRPC metadata, so long read
+// transactions in logs of both processes can be attributed to specific RPC calls and clients.
+package reqlabel
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// MaxIDLength - longer ids given by clients (X-Request-Id) are replaced by generated ones
+const MaxIDLength = 64
+
+// gRPC metadata keys
+const (
+	idKey     = "erigon-request-id"
+	methodKey = "erigon-request-method"
+	clientKey = "erigon-request-client"
+)
+
+type Label struct {
+	ID     string // X-Request-Id of client or <process prefix>-<counter>
+	Method string // e.g. eth_getLogs
+	Client string // remote address
+}
+
+type ctxKey struct{}
+type idCtxKey struct{}
+
+var (
+	prefix  = randomPrefix()
+	counter uint64
+)
+
+func randomPrefix() string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// New - label of RPC call. ID given by client (see WithID) is kept, otherwise it's generated
+func New(ctx context.Context, method, client string) Label {
+	id, _ := ctx.Value(idCtxKey{}).(string)
+	if id == "" {
+		id = fmt.Sprintf("%s-%d", prefix, atomic.AddUint64(&counter, 1))
+	}
+	return Label{ID: id, Method: method, Client: client}
+}
+
+// WithID - id of request given by client, e.g. X-Request-Id header. Invalid ids are ignored
+func WithID(ctx context.Context, id string) context.Context {
+	if !validID(id) {
+		return ctx
+	}
+	return context.WithValue(ctx, idCtxKey{}, id)
+}
+
+func validID(id string) bool {
+	if id == "" || len(id) > MaxIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e { // printable ASCII without spaces: safe for logs and metadata
+			return false
+		}
+	}
+	return true
+}
+
+func With(ctx context.Context, l Label) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+func From(ctx context.Context) (Label, bool) {
+	l, ok := ctx.Value(ctxKey{}).(Label)
+	return l, ok
+}
+
+// LogCtx - key-value pairs for log records, nil without label
+func (l Label) LogCtx() []interface{} {
+	if l.ID == "" {
+		return nil
+	}
+	return []interface{}{"request", l.ID, "method", l.Method, "client", l.Client}
+}
+
+// Outgoing - adds label of ctx to metadata of outgoing gRPC calls
+func Outgoing(ctx context.Context) context.Context {
+	l, ok := From(ctx)
+	if !ok {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, idKey, l.ID, methodKey, l.Method, clientKey, l.Client)
+}
+
+// Incoming - label from metadata of incoming gRPC call
+func Incoming(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	get := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	id := get(idKey)
+	if !validID(id) {
+		return ctx
+	}
+	return With(ctx, Label{ID: id, Method: get(methodKey), Client: get(clientKey)})
+}
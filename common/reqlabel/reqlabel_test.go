@@ -0,0 +1,36 @@
+package reqlabel
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestNew(t *testing.T) {
+	l1, l2 := New(context.Background(), "eth_call", "127.0.0.1:1234"), New(context.Background(), "eth_call", "")
+	require.NotEqual(t, l1.ID, l2.ID)
+	require.True(t, strings.HasPrefix(l1.ID, prefix+"-"))
+
+	ctx := WithID(context.Background(), "client-id-1")
+	require.Equal(t, Label{ID: "client-id-1", Method: "eth_getLogs", Client: "10.0.0.1:80"}, New(ctx, "eth_getLogs", "10.0.0.1:80"))
+	for _, invalid := range []string{"with space", "line\nbreak", strings.Repeat("a", MaxIDLength+1)} {
+		require.NotEqual(t, invalid, New(WithID(context.Background(), invalid), "eth_call", "").ID)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	_, ok := From(Incoming(context.Background()))
+	require.False(t, ok)
+
+	l := Label{ID: "abc-1", Method: "eth_getLogs", Client: "10.0.0.1:80"}
+	md, ok := metadata.FromOutgoingContext(Outgoing(With(context.Background(), l)))
+	require.True(t, ok)
+	got, ok := From(Incoming(metadata.NewIncomingContext(context.Background(), md)))
+	require.True(t, ok)
+	require.Equal(t, l, got)
+	require.Equal(t, []interface{}{"request", "abc-1", "method", "eth_getLogs", "client", "10.0.0.1:80"}, got.LogCtx())
+	require.Nil(t, Label{}.LogCtx())
+}
@@ -189,7 +189,7 @@ func (e *EpochManager) noteNewEpoch() { e.force = true }
 // zoomValidators - Zooms to the epoch after the header with the given hash. Returns true if succeeded, false otherwise.
 // It's analog of zoom_to_after function in OE, but doesn't require external locking
 //nolint
-func (e *EpochManager) zoomToAfter(chain consensus.ChainHeaderReader, er consensus.EpochReader, validators ValidatorSet, hash common.Hash, call consensus.SystemCall) (*RollingFinality, uint64, bool) {
+func (e *EpochManager) zoomToAfter(chain consensus.ChainHeaderReader, er consensus.EpochReader, validators ValidatorSet, hash common.Hash, call consensus.SystemCall) (*RollingFinality, uint64, bool, error) {
 	var lastWasParent bool
 	if e.finalityChecker.lastPushed != nil {
 		lastWasParent = *e.finalityChecker.lastPushed == hash
@@ -198,7 +198,7 @@ func (e *EpochManager) zoomToAfter(chain consensus.ChainHeaderReader, er consens
 	// early exit for current target == chain head, but only if the epochs are
 	// the same.
 	if lastWasParent && !e.force {
-		return e.finalityChecker, e.epochTransitionNumber, true
+		return e.finalityChecker, e.epochTransitionNumber, true, nil
 	}
 	e.force = false
 
@@ -206,44 +206,36 @@ func (e *EpochManager) zoomToAfter(chain consensus.ChainHeaderReader, er consens
 	// forks it will only need to be called for the block directly after
 	// epoch transition, in which case it will be O(1) and require a single
 	// DB lookup.
-	lastTransition, ok := epochTransitionFor2(chain, er, hash)
+	lastTransition, ok, err := epochTransitionFor2(chain, er, hash)
+	if err != nil {
+		return e.finalityChecker, e.epochTransitionNumber, false, err
+	}
 	if !ok {
-		if lastTransition.BlockNumber > DEBUG_LOG_FROM {
-			fmt.Printf("zoom1: %d\n", lastTransition.BlockNumber)
-		}
-		return e.finalityChecker, e.epochTransitionNumber, false
+		return e.finalityChecker, e.epochTransitionNumber, false, nil
 	}
 
 	// extract other epoch set if it's not the same as the last.
+	// after unwind the last transition may be an older one - then hash also doesn't match
 	if lastTransition.BlockHash != e.epochTransitionHash {
 		proof := &EpochTransitionProof{}
 		if err := rlp.DecodeBytes(lastTransition.ProofRlp, proof); err != nil {
-			panic(err)
+			return e.finalityChecker, e.epochTransitionNumber, false, fmt.Errorf("decode epoch transition proof: block=%d, %w", lastTransition.BlockNumber, err)
 		}
 		first := proof.SignalNumber == 0
-		if lastTransition.BlockNumber > DEBUG_LOG_FROM {
-			fmt.Printf("zoom2: %d,%d\n", lastTransition.BlockNumber, len(proof.SetProof))
-		}
 
 		// use signal number so multi-set first calculation is correct.
 		list, _, err := validators.epochSet(first, proof.SignalNumber, proof.SetProof, call)
 		if err != nil {
-			panic(fmt.Errorf("proof produced by this engine is invalid: %w", err))
+			return e.finalityChecker, e.epochTransitionNumber, false, fmt.Errorf("proof produced by this engine is invalid: block=%d, %w", lastTransition.BlockNumber, err)
 		}
 		epochSet := list.validators
-		log.Trace("[aura] Updating finality checker with new validator set extracted from epoch", "num", lastTransition.BlockNumber)
+		log.Trace("[aura] Updating finality checker with new validator set extracted from epoch", "num", lastTransition.BlockNumber, "signal", proof.SignalNumber, "validators", len(epochSet))
 		e.finalityChecker = NewRollingFinality(epochSet)
-		if proof.SignalNumber >= DEBUG_LOG_FROM {
-			fmt.Printf("new rolling finality: %d\n", proof.SignalNumber)
-			for i := 0; i < len(epochSet); i++ {
-				fmt.Printf("\t%x\n", epochSet[i])
-			}
-		}
 	}
 
 	e.epochTransitionHash = lastTransition.BlockHash
 	e.epochTransitionNumber = lastTransition.BlockNumber
-	return e.finalityChecker, e.epochTransitionNumber, true
+	return e.finalityChecker, e.epochTransitionNumber, true, nil
 }
 
 /// Get the transition to the epoch the given parent hash is part of
@@ -252,20 +244,20 @@ func (e *EpochManager) zoomToAfter(chain consensus.ChainHeaderReader, er consens
 ///
 /// The block corresponding the the parent hash must be stored already.
 //nolint
-func epochTransitionFor2(chain consensus.ChainHeaderReader, e consensus.EpochReader, parentHash common.Hash) (transition EpochTransition, ok bool) {
+func epochTransitionFor2(chain consensus.ChainHeaderReader, e consensus.EpochReader, parentHash common.Hash) (transition EpochTransition, ok bool, err error) {
 	//TODO: probably this version of func doesn't support non-canonical epoch transitions
 	h := chain.GetHeaderByHash(parentHash)
 	if h == nil {
-		return transition, false
+		return transition, false, nil
 	}
 	num, hash, transitionProof, err := e.FindBeforeOrEqualNumber(h.Number.Uint64())
 	if err != nil {
-		panic(err)
+		return transition, false, err
 	}
 	if transitionProof == nil {
-		panic("genesis epoch transition must already be set")
+		return transition, false, fmt.Errorf("genesis epoch transition must already be set")
 	}
-	return EpochTransition{BlockNumber: num, BlockHash: hash, ProofRlp: transitionProof}, true
+	return EpochTransition{BlockNumber: num, BlockHash: hash, ProofRlp: transitionProof}, true, nil
 }
 
 //nolint
@@ -838,24 +830,21 @@ func (c *AuRa) Finalize(config *params.ChainConfig, header *types.Header, state
 	}
 
 	// check_and_lock_block -> check_epoch_end_signal (after enact)
-	if header.Number.Uint64() >= DEBUG_LOG_FROM {
-		fmt.Printf("finalize1: %d,%d\n", header.Number.Uint64(), len(r))
-	}
 	pendingTransitionProof, err := c.cfg.Validators.signalEpochEnd(header.Number.Uint64() == 0, header, r)
 	if err != nil {
 		return systemTxs, usedGas, err
 	}
 	if pendingTransitionProof != nil {
-		if header.Number.Uint64() >= DEBUG_LOG_FROM {
-			fmt.Printf("insert_pending_trancition: %d,receipts=%d, lenProof=%d\n", header.Number.Uint64(), len(r), len(pendingTransitionProof))
-		}
 		if err = e.PutPendingEpoch(header.Hash(), header.Number.Uint64(), pendingTransitionProof); err != nil {
 			return systemTxs, usedGas, err
 		}
 	}
 	// check_and_lock_block -> check_epoch_end_signal END
 
-	finalized := buildFinality(c.EpochManager, chain, e, c.cfg.Validators, header, syscall)
+	finalized, err := buildFinality(c.EpochManager, chain, e, c.cfg.Validators, header, syscall)
+	if err != nil {
+		return systemTxs, usedGas, err
+	}
 	c.EpochManager.finalityChecker.print(header.Number.Uint64())
 	epochEndProof, err := isEpochEnd(chain, e, finalized, header)
 	if err != nil {
@@ -872,11 +861,14 @@ func (c *AuRa) Finalize(config *params.ChainConfig, header *types.Header, state
 	return systemTxs, usedGas, nil
 }
 
-func buildFinality(e *EpochManager, chain consensus.ChainHeaderReader, er consensus.EpochReader, validators ValidatorSet, header *types.Header, syscall consensus.SystemCall) []unAssembledHeader {
+func buildFinality(e *EpochManager, chain consensus.ChainHeaderReader, er consensus.EpochReader, validators ValidatorSet, header *types.Header, syscall consensus.SystemCall) ([]unAssembledHeader, error) {
 	// commit_block -> aura.build_finality
-	_, _, ok := e.zoomToAfter(chain, er, validators, header.ParentHash, syscall)
+	_, _, ok, err := e.zoomToAfter(chain, er, validators, header.ParentHash, syscall)
+	if err != nil {
+		return nil, err
+	}
 	if !ok {
-		return []unAssembledHeader{}
+		return []unAssembledHeader{}, nil
 	}
 	if e.finalityChecker.lastPushed == nil || *e.finalityChecker.lastPushed != header.ParentHash {
 		if err := e.finalityChecker.buildAncestrySubChain(func(hash common.Hash) ([]common.Address, common.Hash, common.Hash, uint64, bool) {
@@ -887,16 +879,16 @@ func buildFinality(e *EpochManager, chain consensus.ChainHeaderReader, er consen
 			return []common.Address{h.Coinbase}, h.Hash(), h.ParentHash, h.Number.Uint64(), true
 		}, header.ParentHash, e.epochTransitionHash); err != nil {
 			//log.Warn("[aura] buildAncestrySubChain", "err", err)
-			return []unAssembledHeader{}
+			return []unAssembledHeader{}, nil
 		}
 	}
 
 	res, err := e.finalityChecker.push(header.Hash(), header.Number.Uint64(), []common.Address{header.Coinbase})
 	if err != nil {
 		//log.Warn("[aura] finalityChecker.push", "err", err)
-		return []unAssembledHeader{}
+		return []unAssembledHeader{}, nil
 	}
-	return res
+	return res, nil
 }
 
 func isEpochEnd(chain consensus.ChainHeaderReader, e consensus.EpochReader, finalized []unAssembledHeader, header *types.Header) ([]byte, error) {
@@ -909,17 +901,20 @@ func isEpochEnd(chain consensus.ChainHeaderReader, e consensus.EpochReader, fina
 		if pendingTransitionProof == nil {
 			continue
 		}
-		if header.Number.Uint64() >= DEBUG_LOG_FROM {
-			fmt.Printf("pending transition: %d,%x,len=%d\n", finalized[i].number, finalized[i].hash, len(pendingTransitionProof))
-		}
 
-		finalityProof := allHeadersUntil(chain, header, finalized[i].hash)
+		finalityProof, err := allHeadersUntil(chain, header, finalized[i].hash)
+		if err != nil {
+			return nil, err
+		}
 		var finalizedHeader *types.Header
 		if finalized[i].hash == header.Hash() {
 			finalizedHeader = header
 		} else {
 			finalizedHeader = chain.GetHeader(finalized[i].hash, finalized[i].number)
 		}
+		if finalizedHeader == nil {
+			return nil, fmt.Errorf("header of finalized block not found: %d, %x", finalized[i].number, finalized[i].hash)
+		}
 		signalNumber := finalizedHeader.Number
 		finalityProof = append(finalityProof, finalizedHeader)
 		for i, j := 0, len(finalityProof)-1; i < j; i, j = i+1, j-1 { // reverse
@@ -947,12 +942,16 @@ func isEpochEnd(chain consensus.ChainHeaderReader, e consensus.EpochReader, fina
 // allHeadersUntil walk the chain backwards from current head until finalized_hash
 // to construct transition proof. author == ec_recover(sig) known
 // since the blocks are in the DB.
-func allHeadersUntil(chain consensus.ChainHeaderReader, from *types.Header, to common.Hash) (out []*types.Header) {
+func allHeadersUntil(chain consensus.ChainHeaderReader, from *types.Header, to common.Hash) (out []*types.Header, err error) {
+	if from.Hash() == to {
+		return nil, nil
+	}
 	var header = from
 	for {
-		header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+		parentNum := header.Number.Uint64() - 1
+		header = chain.GetHeader(header.ParentHash, parentNum)
 		if header == nil {
-			panic("not found header")
+			return nil, fmt.Errorf("header not found: %d", parentNum)
 		}
 		if header.Number.Uint64() == 0 {
 			break
@@ -962,7 +961,7 @@ func allHeadersUntil(chain consensus.ChainHeaderReader, from *types.Header, to c
 		}
 		out = append(out, header)
 	}
-	return out
+	return out, nil
 }
 
 //func (c *AuRa) check_epoch_end(cc *params.ChainConfig, header *types.Header, state *state.IntraBlockState, txs []types.Transaction, uncles []*types.Header, syscall consensus.SystemCall) {
@@ -1180,7 +1179,10 @@ func (c *AuRa) epochSet(chain consensus.ChainHeaderReader, e consensus.EpochRead
 		return c.cfg.Validators, h.Number.Uint64(), nil
 	}
 
-	finalityChecker, epochTransitionNumber, ok := c.EpochManager.zoomToAfter(chain, e, c.cfg.Validators, h.ParentHash, call)
+	finalityChecker, epochTransitionNumber, ok, err := c.EpochManager.zoomToAfter(chain, e, c.cfg.Validators, h.ParentHash, call)
+	if err != nil {
+		return nil, 0, err
+	}
 	if !ok {
 		return nil, 0, fmt.Errorf("unable to zoomToAfter to epoch")
 	}
@@ -232,7 +232,11 @@ func (s *Multi) defaultCaller(blockHash common.Hash) (Call, error) {
 }
 
 func (s *Multi) getWithCaller(parentHash common.Hash, nonce uint, caller consensus.Call) (common.Address, error) {
-	panic("not implemented")
+	set, ok := s.correctSet(parentHash)
+	if !ok {
+		return common.Address{}, fmt.Errorf("no validator set for given parentHash: %x", parentHash)
+	}
+	return set.getWithCaller(parentHash, nonce, caller)
 }
 func (s *Multi) countWithCaller(parentHash common.Hash, caller consensus.Call) (uint64, error) {
 	set, ok := s.correctSet(parentHash)
@@ -243,6 +247,9 @@ func (s *Multi) countWithCaller(parentHash common.Hash, caller consensus.Call) (
 }
 
 func (s *Multi) correctSet(blockHash common.Hash) (ValidatorSet, bool) {
+	if s.parent == nil {
+		return nil, false
+	}
 	parent := s.parent(blockHash)
 	if parent == nil {
 		return nil, false
@@ -450,19 +457,10 @@ func (s *ValidatorSafeContract) epochSet(firstInEpoch bool, num uint64, setProof
 		if num == 0 {
 			return *NewSimpleList([]common.Address{proof.Header.Coinbase}), proof.Header.ParentHash, nil
 		}
-		l, ok := s.getListSyscall(call)
-		if !ok {
-			panic(1)
+		l, err := s.getListSyscall(call)
+		if err != nil {
+			return SimpleList{}, common.Hash{}, fmt.Errorf("[ValidatorSafeContract.epochSet] getValidators: %w", err)
 		}
-
-		//addresses, err := checkFirstValidatorSetProof(s.contractAddress, oldHeader, state_items)
-		//if err != nil {
-		//	panic(err)
-		//	return SimpleList{}, common.Hash{}, fmt.Errorf("insufitient proof: block=%d,%x: %w", oldHeader.Number.Uint64(), oldHeader.Hash(), err)
-		//}
-
-		//fmt.Printf("aaaa: %x,%x\n", common.HexToAddress("0xe8ddc5c7a2d2f0d7a9798459c0104fdf5e987aca"), params.SokolGenesisHash)
-		//fmt.Printf("bbbbb: %x,%x\n", proof.ContractAddress, proof.Header.Hash())
 		return *l, proof.Header.ParentHash, nil
 	}
 	var proof ValidatorSetProof
@@ -470,45 +468,15 @@ func (s *ValidatorSafeContract) epochSet(firstInEpoch bool, num uint64, setProof
 		return SimpleList{}, common.Hash{}, fmt.Errorf("[ValidatorSafeContract.epochSet] %w", err)
 	}
 
-	if num > DEBUG_LOG_FROM {
-		fmt.Printf("epoch_set1: %d,%d,%d\n", proof.Header.Number.Uint64(), len(setProof), len(proof.Receipts))
+	// ensure receipts match header.
+	if foundRoot := types.DeriveSha(proof.Receipts); foundRoot != proof.Header.ReceiptHash {
+		return SimpleList{}, common.Hash{}, fmt.Errorf("[ValidatorSafeContract.epochSet] invalid receipts root: block=%d, expected=%x, found=%x", proof.Header.Number.Uint64(), proof.Header.ReceiptHash, foundRoot)
 	}
 	ll, ok := s.extractFromEvent(proof.Header, proof.Receipts)
 	if !ok {
-		panic(1)
+		return SimpleList{}, common.Hash{}, fmt.Errorf("[ValidatorSafeContract.epochSet] insufficient proof: no log event in proof, block=%d", proof.Header.Number.Uint64())
 	}
-
-	// ensure receipts match header.
-	// TODO: optimize? these were just decoded.
-	/*
-	   let found_root = ::triehash::ordered_trie_root(receipts.iter().map(|r| r.encode()));
-	   if found_root != *old_header.receipts_root() {
-	       return Err(::error::BlockError::InvalidReceiptsRoot(Mismatch {
-	           expected: *old_header.receipts_root(),
-	           found: found_root,
-	       })
-	       .into());
-	   }
-
-	   let bloom = self.expected_bloom(&old_header);
-
-	   match self.extract_from_event(bloom, &old_header, &receipts) {
-	       Some(list) => Ok((list, Some(old_header.hash()))),
-	       None => Err(::engines::EngineError::InsufficientProof(
-	           "No log event in proof.".into(),
-	       )
-	       .into()),
-	   }
-	*/
-	return *ll, common.Hash{}, nil
-	/*
-		setProof, err := decodeValidatorSetProof(proof.SetProof)
-		if err != nil {
-			return SimpleList{}, common.Hash{}, err
-		}
-		_ = setProof
-	*/
-
+	return *ll, proof.Header.Hash(), nil
 }
 
 // check a first proof: fetch the validator set at the given block.
@@ -591,9 +559,9 @@ func (s *ValidatorSafeContract) getWithCaller(blockHash common.Hash, nonce uint,
 		return get(set.(ValidatorSet), blockHash, nonce, caller)
 	}
 
-	list, ok := s.getList(caller)
-	if !ok {
-		return common.Address{}, nil
+	list, err := s.getList(caller)
+	if err != nil {
+		return common.Address{}, err
 	}
 	s.validators.Add(blockHash, list)
 	return get(list, blockHash, nonce, caller)
@@ -603,204 +571,105 @@ func (s *ValidatorSafeContract) countWithCaller(parentHash common.Hash, caller c
 	if ok {
 		return count(set.(ValidatorSet), parentHash, caller)
 	}
-	list, ok := s.getList(caller)
-	if !ok {
-		return math.MaxUint64, nil
+	list, err := s.getList(caller)
+	if err != nil {
+		return math.MaxUint64, err
 	}
 	s.validators.Add(parentHash, list)
 	return count(list, parentHash, caller)
 }
 
-func (s *ValidatorSafeContract) getList(caller consensus.Call) (*SimpleList, bool) {
+func (s *ValidatorSafeContract) getList(caller consensus.Call) (*SimpleList, error) {
 	packed, err := s.abi.Pack("getValidators")
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	out, err := caller(s.contractAddress, packed)
 	if err != nil {
-		panic(err)
-	}
-	res, err := s.abi.Unpack("getValidators", out)
-	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	out0 := *abi.ConvertType(res[0], new([]common.Address)).(*[]common.Address)
-	return NewSimpleList(out0), true
+	return s.unpackList(out)
 }
 
-func (s *ValidatorSafeContract) getListSyscall(caller consensus.SystemCall) (*SimpleList, bool) {
+func (s *ValidatorSafeContract) getListSyscall(caller consensus.SystemCall) (*SimpleList, error) {
 	packed, err := s.abi.Pack("getValidators")
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	out, err := caller(s.contractAddress, packed)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	return s.unpackList(out)
+}
+
+func (s *ValidatorSafeContract) unpackList(out []byte) (*SimpleList, error) {
 	res, err := s.abi.Unpack("getValidators", out)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	out0 := *abi.ConvertType(res[0], new([]common.Address)).(*[]common.Address)
-	return NewSimpleList(out0), true
+	return NewSimpleList(out0), nil
 }
 
 func (s *ValidatorSafeContract) genesisEpochData(header *types.Header, call consensus.SystemCall) ([]byte, error) {
 	return proveInitial(s, s.contractAddress, header, call)
 }
 
+// onEpochBegin - calls finalizeChange, so contract applies validators set of InitiateChange event which became final
 func (s *ValidatorSafeContract) onEpochBegin(firstInEpoch bool, header *types.Header, caller consensus.SystemCall) error {
-	data := common.FromHex("75286211")
-	_, err := caller(s.contractAddress, data)
+	data, err := s.abi.Pack("finalizeChange")
 	if err != nil {
 		return err
 	}
-
-	/*
-	 let data = validator_set::functions::finalize_change::encode_input();
-	        caller(self.contract_address, data)
-	            .map(|_| ())
-	            .map_err(::engines::EngineError::FailedSystemCall)
-	            .map_err(Into::into)
-	*/
+	if _, err = caller(s.contractAddress, data); err != nil {
+		return fmt.Errorf("finalizeChange system call failed: block=%d, %w", header.Number.Uint64(), err)
+	}
 	return nil
 }
 
 func (s *ValidatorSafeContract) signalEpochEnd(firstInEpoch bool, header *types.Header, r types.Receipts) ([]byte, error) {
-	if header.Number.Uint64() >= DEBUG_LOG_FROM {
-		fmt.Printf("signalEpochEnd: %d,%t\n", header.Number.Uint64(), firstInEpoch)
-	}
 	// transition to the first block of a contract requires finality but has no log event.
 	if firstInEpoch {
-		/*
-		   let state_proof = Arc::new(FirstValidatorSetProof {
-		       contract_address: self.contract_address,
-		       header: header.clone(),
-		   });
-		   return ::engines::EpochChange::Yes(::engines::Proof::WithState(state_proof as Arc<_>));
-		*/
 		return rlp.EncodeToBytes(FirstValidatorSetProof{Header: header, ContractAddress: s.contractAddress})
 	}
 
 	// otherwise, we're checking for logs.
-	//let bloom = self.expected_bloom(header);
-	//let header_bloom = header.log_bloom();
-	//if &bloom & header_bloom != bloom {
-	//	return ::engines::EpochChange::No;
-	//}
-
 	_, ok := s.extractFromEvent(header, r)
 	if !ok {
-		if header.Number.Uint64() >= DEBUG_LOG_FROM {
-			fmt.Printf("signalEpochEnd: no-no-no %d,%d\n", header.Number.Uint64(), len(r))
-		}
 		return nil, nil
 	}
-	proof, err := rlp.EncodeToBytes(ValidatorSetProof{Header: header, Receipts: r})
-	if err != nil {
-		return nil, err
-	}
-	if header.Number.Uint64() >= DEBUG_LOG_FROM {
-		fmt.Printf("signalEpochEnd: %d,%d, proofLen=%d\n", header.Number.Uint64(), len(r), len(proof))
-	}
-	return proof, nil
+	log.Debug("[aura] validator set change signalled", "block", header.Number.Uint64(), "contract", s.contractAddress)
+	return rlp.EncodeToBytes(ValidatorSetProof{Header: header, Receipts: r})
 }
 
+// extractFromEvent - returns validators set of the last InitiateChange event emitted by the contract in the block
 func (s *ValidatorSafeContract) extractFromEvent(header *types.Header, receipts types.Receipts) (*SimpleList, bool) {
-	if len(receipts) == 0 {
-		if header.Number.Uint64() >= DEBUG_LOG_FROM {
-			fmt.Printf("extractFromEvent1: %d\n", header.Number.Uint64())
-		}
-		return nil, false
-	}
-	if header.Number.Uint64() >= DEBUG_LOG_FROM {
-		fmt.Printf("extractFromEvent111: %d,%d\n", header.Number.Uint64(), len(receipts))
-	}
-
 	// iterate in reverse because only the _last_ change in a given
 	// block actually has any effect.
 	// the contract should only increment the nonce once.
 	for j := len(receipts) - 1; j >= 0; j-- {
 		logs := receipts[j].Logs
-		/*
-			TODO: skipped next bloom check (is it required?)
-					expectedBloom := expected_bloom(&self, header: &Header) -> Bloom {
-				        let topics = vec![*EVENT_NAME_HASH, *header.parent_hash()];
-
-				        debug!(target: "engine", "Expected topics for header {}: {:?}",
-							header.hash(), topics);
-
-				        LogEntry {
-				            address: self.contract_address,
-				            topics: topics,
-				            data: Vec::new(), // irrelevant for bloom.
-				        }
-				        .bloom()
-				    }
-					if !r.log_bloom.contains_bloom(&bloom){
-						continue
-					}
-		*/
 		for i := 0; i < len(logs); i++ {
 			l := logs[i]
-			if header.Number.Uint64() >= DEBUG_LOG_FROM {
-				fmt.Printf("extractFromEvent3: %d\n", header.Number.Uint64())
-			}
 			if len(l.Topics) != 2 {
 				continue
 			}
 			found := l.Address == s.contractAddress && l.Topics[0] == EVENT_NAME_HASH && l.Topics[1] == header.ParentHash
 			if !found {
-				if header.Number.Uint64() >= DEBUG_LOG_FROM {
-					fmt.Printf("extractFromEvent4: %d\n", header.Number.Uint64())
-				}
 				continue
 			}
 
 			contract := bind.NewBoundContract(l.Address, s.abi, nil, nil, nil)
 			event := new(auraabi.ValidatorSetInitiateChange)
 			if err := contract.UnpackLog(event, "InitiateChange", *l); err != nil {
-				panic(err)
-			}
-			if header.Number.Uint64() >= DEBUG_LOG_FROM {
-				fmt.Printf("extractFromEvent5: %d\n", header.Number.Uint64())
+				log.Warn("[aura] can't parse InitiateChange event", "block", header.Number.Uint64(), "err", err)
+				continue
 			}
-
 			// only one last log is taken into account
 			return NewSimpleList(event.NewSet), true
 		}
 	}
-	/*
-					  let check_log = |log: &LogEntry| {
-		            log.address == self.contract_address
-		                && log.topics.len() == 2
-		                && log.topics[0] == *EVENT_NAME_HASH
-		                && log.topics[1] == *header.parent_hash()
-		        };
-
-		        //// iterate in reverse because only the _last_ change in a given
-		        //// block actually has any effect.
-		        //// the contract should only increment the nonce once.
-		        let mut decoded_events = receipts
-		            .iter()
-		            .rev()
-		            .filter(|r| r.log_bloom.contains_bloom(&bloom))
-		            .flat_map(|r| r.logs.iter())
-		            .filter(move |l| check_log(l))
-		            .filter_map(|log| {
-		                validator_set::events::initiate_change::parse_log(
-		                    (log.topics.clone(), log.data.clone()).into(),
-		                )
-		                .ok()
-		            });
-
-		        // only last log is taken into account
-		        decoded_events.next().map(|matched_event| {
-		            let l = SimpleList::new(matched_event.new_set);
-		            println!("matched_event: {:?}", l);
-		            l
-		        })
-	*/
 	return nil, false
 }
 
@@ -860,7 +729,7 @@ func (s *ValidatorSafeContract) onCloseBlock(header *types.Header, ourAddress co
 // ValidatorContract a validator contract with reporting.
 type ValidatorContract struct {
 	contractAddress  common.Address
-	validators       ValidatorSafeContract
+	validators       *ValidatorSafeContract
 	posdaoTransition *uint64
 }
 
@@ -0,0 +1,198 @@
+package aura
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/stretchr/testify/require"
+)
+
+type testEpochReader struct {
+	tx kv.RwTx
+}
+
+func (cr testEpochReader) GetEpoch(hash common.Hash, number uint64) ([]byte, error) {
+	return rawdb.ReadEpoch(cr.tx, number, hash)
+}
+func (cr testEpochReader) PutEpoch(hash common.Hash, number uint64, proof []byte) error {
+	return rawdb.WriteEpoch(cr.tx, number, hash, proof)
+}
+func (cr testEpochReader) GetPendingEpoch(hash common.Hash, number uint64) ([]byte, error) {
+	return rawdb.ReadPendingEpoch(cr.tx, number, hash)
+}
+func (cr testEpochReader) PutPendingEpoch(hash common.Hash, number uint64, proof []byte) error {
+	return rawdb.WritePendingEpoch(cr.tx, number, hash, proof)
+}
+func (cr testEpochReader) FindBeforeOrEqualNumber(number uint64) (uint64, common.Hash, []byte, error) {
+	return rawdb.FindEpochBeforeOrEqualNumber(cr.tx, number)
+}
+
+type testChainReader struct {
+	headers map[common.Hash]*types.Header
+}
+
+func (cr testChainReader) Config() *params.ChainConfig  { return params.TestChainConfig }
+func (cr testChainReader) CurrentHeader() *types.Header { return nil }
+func (cr testChainReader) GetHeader(hash common.Hash, number uint64) *types.Header {
+	return cr.headers[hash]
+}
+func (cr testChainReader) GetHeaderByNumber(number uint64) *types.Header {
+	for _, h := range cr.headers {
+		if h.Number.Uint64() == number {
+			return h
+		}
+	}
+	return nil
+}
+func (cr testChainReader) GetHeaderByHash(hash common.Hash) *types.Header { return cr.headers[hash] }
+func (cr testChainReader) GetTd(hash common.Hash, number uint64) *big.Int { return nil }
+
+// initiateChangeReceipts - receipts of a block in which validator set contract emitted InitiateChange event
+func initiateChangeReceipts(t *testing.T, s *ValidatorSafeContract, parentHash common.Hash, newSet []common.Address) types.Receipts {
+	data, err := s.abi.Events["InitiateChange"].Inputs.NonIndexed().Pack(newSet)
+	require.NoError(t, err)
+	return types.Receipts{
+		{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000},
+		{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 42000, Logs: []*types.Log{
+			{Address: s.contractAddress, Topics: []common.Hash{EVENT_NAME_HASH, parentHash}, Data: data},
+		}},
+	}
+}
+
+func TestValidatorSafeContractTransition(t *testing.T) {
+	s := NewValidatorSafeContract(common.Address{0xaa}, nil, nil)
+	newSet := []common.Address{{1}, {2}, {3}}
+	parent := &types.Header{Number: big.NewInt(9)}
+	r := initiateChangeReceipts(t, s, parent.Hash(), newSet)
+	header := &types.Header{Number: big.NewInt(10), ParentHash: parent.Hash(), ReceiptHash: types.DeriveSha(r)}
+
+	proof, err := s.signalEpochEnd(false, header, r)
+	require.NoError(t, err)
+	require.NotNil(t, proof)
+
+	list, hash, err := s.epochSet(false, 10, proof, nil)
+	require.NoError(t, err)
+	require.Equal(t, newSet, list.validators)
+	require.Equal(t, header.Hash(), hash)
+
+	// receipts don't match header
+	badHeader := types.CopyHeader(header)
+	badHeader.ReceiptHash = common.Hash{1}
+	badProof, err := rlp.EncodeToBytes(ValidatorSetProof{Header: badHeader, Receipts: r})
+	require.NoError(t, err)
+	_, _, err = s.epochSet(false, 10, badProof, nil)
+	require.Error(t, err)
+
+	// event is bound to parent hash of the block
+	otherParent := &types.Header{Number: big.NewInt(9), Extra: []byte("fork")}
+	r = initiateChangeReceipts(t, s, otherParent.Hash(), newSet)
+	header = &types.Header{Number: big.NewInt(10), ParentHash: parent.Hash(), ReceiptHash: types.DeriveSha(r)}
+	proof, err = s.signalEpochEnd(false, header, r)
+	require.NoError(t, err)
+	require.Nil(t, proof)
+	proof, err = rlp.EncodeToBytes(ValidatorSetProof{Header: header, Receipts: r})
+	require.NoError(t, err)
+	_, _, err = s.epochSet(false, 10, proof, nil)
+	require.Error(t, err)
+}
+
+func TestValidatorSafeContractFinalizeChange(t *testing.T) {
+	s := NewValidatorSafeContract(common.Address{0xaa}, nil, nil)
+	var called []byte
+	err := s.onEpochBegin(false, &types.Header{Number: big.NewInt(11)}, func(contract common.Address, data []byte) ([]byte, error) {
+		require.Equal(t, s.contractAddress, contract)
+		called = data
+		return nil, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, common.FromHex("75286211"), called)
+}
+
+func TestMultiGetWithCaller(t *testing.T) {
+	headers := map[common.Hash]*types.Header{}
+	h5 := &types.Header{Number: big.NewInt(5)}
+	h12 := &types.Header{Number: big.NewInt(12)}
+	headers[h5.Hash()] = h5
+	headers[h12.Hash()] = h12
+	multi := NewMulti(map[uint64]ValidatorSet{
+		0:  NewSimpleList([]common.Address{{1}, {2}}),
+		10: NewSimpleList([]common.Address{{3}, {4}, {5}}),
+	})
+	_, err := multi.getWithCaller(h5.Hash(), 1, nil)
+	require.Error(t, err)
+
+	multi.parent = func(hash common.Hash) *types.Header { return headers[hash] }
+	addr, err := multi.getWithCaller(h5.Hash(), 1, nil)
+	require.NoError(t, err)
+	require.Equal(t, common.Address{2}, addr)
+	addr, err = multi.getWithCaller(h12.Hash(), 1, nil)
+	require.NoError(t, err)
+	require.Equal(t, common.Address{4}, addr)
+	_, err = multi.getWithCaller(common.Hash{0xff}, 1, nil)
+	require.Error(t, err)
+}
+
+func TestEpochManagerUnwind(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	er := testEpochReader{tx: tx}
+	s := NewValidatorSafeContract(common.Address{0xaa}, nil, nil)
+	genesisSigner := common.Address{0x01}
+	newSet := []common.Address{{1}, {2}, {3}}
+
+	chain := testChainReader{headers: map[common.Hash]*types.Header{}}
+	headers := make([]*types.Header, 13)
+	var parentHash common.Hash
+	var transitionReceipts types.Receipts
+	for i := range headers {
+		h := &types.Header{Number: big.NewInt(int64(i)), ParentHash: parentHash, Coinbase: genesisSigner}
+		if i == 10 {
+			transitionReceipts = initiateChangeReceipts(t, s, parentHash, newSet)
+			h.ReceiptHash = types.DeriveSha(transitionReceipts)
+		}
+		headers[i] = h
+		chain.headers[h.Hash()] = h
+		parentHash = h.Hash()
+	}
+
+	genesisProof, err := proveInitial(s, s.contractAddress, headers[0], nil)
+	require.NoError(t, err)
+	genesisEpoch, err := rlp.EncodeToBytes(EpochTransitionProof{SignalNumber: 0, SetProof: genesisProof, FinalityProof: []byte{}})
+	require.NoError(t, err)
+	require.NoError(t, er.PutEpoch(headers[0].Hash(), 0, genesisEpoch))
+
+	setProof, err := s.signalEpochEnd(false, headers[10], transitionReceipts)
+	require.NoError(t, err)
+	transitionEpoch, err := rlp.EncodeToBytes(EpochTransitionProof{SignalNumber: 10, SetProof: setProof, FinalityProof: []byte{}})
+	require.NoError(t, err)
+	require.NoError(t, er.PutEpoch(headers[12].Hash(), 12, transitionEpoch))
+
+	e := NewEpochManager()
+	f, num, ok, err := e.zoomToAfter(chain, er, s, headers[12].Hash(), nil)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(12), num)
+	require.Equal(t, newSet, f.signers.validators)
+	_, err = f.push(common.Hash{0xbb}, 13, []common.Address{{2}})
+	require.NoError(t, err)
+
+	// unwind to block 8 removes transition, next block must be checked against genesis validator set again
+	require.NoError(t, rawdb.DeleteNewerEpochs(tx, 9))
+	f, num, ok, err = e.zoomToAfter(chain, er, s, headers[8].Hash(), nil)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(0), num)
+	require.Equal(t, []common.Address{genesisSigner}, f.signers.validators)
+
+	// broken transition proof is an error, not a panic
+	require.NoError(t, er.PutEpoch(headers[12].Hash(), 12, []byte{0x01, 0x02}))
+	e.noteNewEpoch()
+	_, _, _, err = e.zoomToAfter(chain, er, s, headers[12].Hash(), nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,62 @@
+package bor
+
+// Methods of genesis contracts of Bor chains called by the engine
+
+const validatorSetABI = `[
+	{
+		"constant": false,
+		"inputs": [
+			{"internalType": "uint256", "name": "newSpan", "type": "uint256"},
+			{"internalType": "uint256", "name": "startBlock", "type": "uint256"},
+			{"internalType": "uint256", "name": "endBlock", "type": "uint256"},
+			{"internalType": "bytes", "name": "validatorBytes", "type": "bytes"},
+			{"internalType": "bytes", "name": "producerBytes", "type": "bytes"}
+		],
+		"name": "commitSpan",
+		"outputs": [],
+		"payable": false,
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"constant": true,
+		"inputs": [],
+		"name": "getCurrentSpan",
+		"outputs": [
+			{"internalType": "uint256", "name": "number", "type": "uint256"},
+			{"internalType": "uint256", "name": "startBlock", "type": "uint256"},
+			{"internalType": "uint256", "name": "endBlock", "type": "uint256"}
+		],
+		"payable": false,
+		"stateMutability": "view",
+		"type": "function"
+	}
+]`
+
+const stateReceiverABI = `[
+	{
+		"constant": false,
+		"inputs": [
+			{"internalType": "uint256", "name": "syncTime", "type": "uint256"},
+			{"internalType": "bytes", "name": "recordBytes", "type": "bytes"}
+		],
+		"name": "commitState",
+		"outputs": [
+			{"internalType": "bool", "name": "success", "type": "bool"}
+		],
+		"payable": false,
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"constant": true,
+		"inputs": [],
+		"name": "lastStateId",
+		"outputs": [
+			{"internalType": "uint256", "name": "", "type": "uint256"}
+		],
+		"payable": false,
+		"stateMutability": "view",
+		"type": "function"
+	}
+]`
@@ -0,0 +1,247 @@
+package bor
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/rpc"
+	"golang.org/x/crypto/sha3"
+)
+
+var (
+	// MaxCheckpointLength is the maximum number of blocks that can be requested for constructing a checkpoint root hash
+	MaxCheckpointLength = uint64(math.Pow(2, 15))
+)
+
+// API is a user facing RPC API to allow controlling the signer and voting
+// mechanisms of the proof-of-authority scheme.
+type API struct {
+	chain         consensus.ChainHeaderReader
+	bor           *Bor
+	rootHashCache *lru.ARCCache
+	lock          sync.Mutex
+}
+
+func NewAPI(chain consensus.ChainHeaderReader, bor *Bor) *API {
+	return &API{chain: chain, bor: bor}
+}
+
+// GetSnapshot retrieves the state snapshot at a given block.
+func (api *API) GetSnapshot(number *rpc.BlockNumber) (*Snapshot, error) {
+	header := api.header(number)
+	// Ensure we have an actually valid block and return its snapshot
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	return api.bor.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+}
+
+// GetAuthor retrieves the author a block.
+func (api *API) GetAuthor(number *rpc.BlockNumber) (*common.Address, error) {
+	header := api.header(number)
+	// Ensure we have an actually valid block and return its snapshot
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	author, err := api.bor.Author(header)
+	return &author, err
+}
+
+// GetSnapshotAtHash retrieves the state snapshot at a given block.
+func (api *API) GetSnapshotAtHash(hash common.Hash) (*Snapshot, error) {
+	header := api.chain.GetHeaderByHash(hash)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	return api.bor.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+}
+
+// GetSigners retrieves the list of authorized signers at the specified block.
+func (api *API) GetSigners(number *rpc.BlockNumber) ([]common.Address, error) {
+	header := api.header(number)
+	// Ensure we have an actually valid block and return the signers from its snapshot
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	snap, err := api.bor.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return snap.signers(), nil
+}
+
+// GetSignersAtHash retrieves the list of authorized signers at the specified block.
+func (api *API) GetSignersAtHash(hash common.Hash) ([]common.Address, error) {
+	header := api.chain.GetHeaderByHash(hash)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	snap, err := api.bor.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return snap.signers(), nil
+}
+
+// GetCurrentProposer gets the current proposer
+func (api *API) GetCurrentProposer() (common.Address, error) {
+	snap, err := api.GetSnapshot(nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return snap.ValidatorSet.GetProposer().Address, nil
+}
+
+// GetCurrentValidators gets the current validators
+func (api *API) GetCurrentValidators() ([]*Validator, error) {
+	snap, err := api.GetSnapshot(nil)
+	if err != nil {
+		return make([]*Validator, 0), err
+	}
+	return snap.ValidatorSet.Validators, nil
+}
+
+// GetRootHash returns the merkle root of the start to end block headers
+func (api *API) GetRootHash(start uint64, end uint64) (string, error) {
+	if err := api.initializeRootHashCache(); err != nil {
+		return "", err
+	}
+	key := getRootHashKey(start, end)
+	if root, known := api.rootHashCache.Get(key); known {
+		return root.(string), nil
+	}
+	length := end - start + 1
+	if start > end || length > MaxCheckpointLength {
+		return "", &MaxCheckpointLengthExceededError{start, end}
+	}
+	currentHeaderNumber := api.chain.CurrentHeader().Number.Uint64()
+	if start > end || end > currentHeaderNumber {
+		return "", &InvalidStartEndBlockError{start, end, currentHeaderNumber}
+	}
+	blockHeaders := make([]*types.Header, length)
+	for number := start; number <= end; number++ {
+		blockHeaders[number-start] = api.chain.GetHeaderByNumber(number)
+		if blockHeaders[number-start] == nil {
+			return "", errUnknownBlock
+		}
+	}
+	headers := make([][32]byte, nextPowerOfTwo(length))
+	for i := 0; i < len(blockHeaders); i++ {
+		blockHeader := blockHeaders[i]
+		header := crypto.Keccak256(appendBytes32(
+			blockHeader.Number.Bytes(),
+			new(big.Int).SetUint64(blockHeader.Time).Bytes(),
+			blockHeader.TxHash.Bytes(),
+			blockHeader.ReceiptHash.Bytes(),
+		))
+
+		var arr [32]byte
+		copy(arr[:], header)
+		headers[i] = arr
+	}
+	root := common.Bytes2Hex(merkleRoot(headers))
+	api.rootHashCache.Add(key, root)
+	return root, nil
+}
+
+func (api *API) header(number *rpc.BlockNumber) *types.Header {
+	// Retrieve the requested block number (or current if none requested)
+	if number == nil || *number == rpc.LatestBlockNumber {
+		return api.chain.CurrentHeader()
+	}
+	return api.chain.GetHeaderByNumber(uint64(number.Int64()))
+}
+
+func (api *API) initializeRootHashCache() error {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	if api.rootHashCache != nil {
+		return nil
+	}
+	var err error
+	api.rootHashCache, err = lru.NewARC(10)
+	return err
+}
+
+func getRootHashKey(start uint64, end uint64) string {
+	return strconv.FormatUint(start, 10) + "-" + strconv.FormatUint(end, 10)
+}
+
+// MaxCheckpointLengthExceededError is returned if root hash of too many headers is requested
+type MaxCheckpointLengthExceededError struct {
+	Start uint64
+	End   uint64
+}
+
+func (e *MaxCheckpointLengthExceededError) Error() string {
+	return "Start: " + strconv.FormatUint(e.Start, 10) + " and end block: " + strconv.FormatUint(e.End, 10) +
+		" exceed max allowed checkpoint length: " + strconv.FormatUint(MaxCheckpointLength, 10)
+}
+
+// InvalidStartEndBlockError is returned if root hash of unknown blocks is requested
+type InvalidStartEndBlockError struct {
+	Start         uint64
+	End           uint64
+	CurrentHeader uint64
+}
+
+func (e *InvalidStartEndBlockError) Error() string {
+	return "Invalid parameters start: " + strconv.FormatUint(e.Start, 10) + " and end block: " +
+		strconv.FormatUint(e.End, 10) + " params. Current header: " + strconv.FormatUint(e.CurrentHeader, 10)
+}
+
+// appendBytes32 - concatenation of values left-padded to 32 bytes
+func appendBytes32(data ...[]byte) []byte {
+	var result []byte
+	for _, v := range data {
+		paddedV := common.LeftPadBytes(v, 32)
+		result = append(result, paddedV...)
+	}
+	return result
+}
+
+func nextPowerOfTwo(n uint64) uint64 {
+	if n == 0 {
+		return 1
+	}
+	// http://graphics.stanford.edu/~seander/bithacks.html#RoundUpPowerOf2
+	n--
+	n |= n >> 1
+	n |= n >> 2
+	n |= n >> 4
+	n |= n >> 8
+	n |= n >> 16
+	n |= n >> 32
+	n++
+	return n
+}
+
+// merkleRoot - root of binary keccak tree over leaves, number of leaves must be a power of two
+func merkleRoot(leaves [][32]byte) []byte {
+	if len(leaves) == 0 {
+		return nil
+	}
+	if len(leaves)&(len(leaves)-1) != 0 {
+		panic(errors.New("number of leaves must be a power of two"))
+	}
+	level := leaves
+	for len(level) > 1 {
+		next := make([][32]byte, len(level)/2)
+		for i := range next {
+			hasher := sha3.NewLegacyKeccak256()
+			hasher.Write(level[2*i][:])
+			hasher.Write(level[2*i+1][:])
+			hasher.Sum(next[i][:0])
+		}
+		level = next
+	}
+	return level[0][:]
+}
@@ -0,0 +1,1023 @@
+// Package bor implements the consensus engine of Polygon PoS chains. Validators of a span are elected on Ethereum
+// and announced by Heimdall, they take turns to produce blocks in sprints. At sprint start the engine commits
+// next span to validator set contract and state sync events (Ethereum -> Bor messages) to state receiver contract.
+package bor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/log/v3"
+
+	"github.com/ledgerwatch/erigon/accounts/abi"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus"
+	"github.com/ledgerwatch/erigon/consensus/clique"
+	"github.com/ledgerwatch/erigon/consensus/misc"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+const (
+	checkpointInterval = 1024 // Number of blocks after which to save the vote snapshot to the database
+	inmemorySnapshots  = 128  // Number of recent vote snapshots to keep in memory
+	inmemorySignatures = 4096 // Number of recent block signatures to keep in memory
+
+	extraVanity = 32 // Fixed number of extra-data prefix bytes reserved for signer vanity
+	extraSeal   = 65 // Fixed number of extra-data suffix bytes reserved for signer seal
+
+	// validatorHeaderBytesLength - validator in extra-data of sprint end header: address and voting power
+	validatorHeaderBytesLength = common.AddressLength + 20
+
+	// Spans of Heimdall: first span covers blocks [0, zerothSpanEnd], next ones have spanLength blocks
+	zerothSpanEnd = 255
+	spanLength    = 6400
+
+	// finalitySprints - Bor has no finality of its own (blocks are checkpointed to Ethereum with big delay),
+	// reorgs deeper than this amount of sprints are not accepted
+	finalitySprints = 64
+)
+
+// Various error messages to mark blocks invalid. These should be private to
+// prevent engine specific errors from being referenced in the remainder of the
+// codebase, inherently breaking if the engine is swapped out. Please put common
+// error types into the consensus package.
+var (
+	// errUnknownBlock is returned when the list of signers is requested for a block
+	// that is not part of the local blockchain.
+	errUnknownBlock = errors.New("unknown block")
+
+	// errMissingVanity is returned if a block's extra-data section is shorter than
+	// 32 bytes, which is required to store the signer vanity.
+	errMissingVanity = errors.New("extra-data 32 byte vanity prefix missing")
+
+	// errMissingSignature is returned if a block's extra-data section doesn't seem
+	// to contain a 65 byte secp256k1 signature.
+	errMissingSignature = errors.New("extra-data 65 byte signature suffix missing")
+
+	// errExtraValidators is returned if non-sprint-end block contain validator data in
+	// their extra-data fields.
+	errExtraValidators = errors.New("non-sprint-end block contains extra validator list")
+
+	// errInvalidSpanValidators is returned if a block contains an
+	// invalid list of validators (i.e. non divisible by 40 bytes).
+	errInvalidSpanValidators = errors.New("invalid validator list on sprint end block")
+
+	// errInvalidMixDigest is returned if a block's mix digest is non-zero.
+	errInvalidMixDigest = errors.New("non-zero mix digest")
+
+	// errInvalidUncleHash is returned if a block contains an non-empty uncle list.
+	errInvalidUncleHash = errors.New("non empty uncle hash")
+
+	// errInvalidDifficulty is returned if the difficulty of a block is missing.
+	errInvalidDifficulty = errors.New("invalid difficulty")
+
+	// errInvalidTimestamp is returned if the timestamp of a block is lower than
+	// the previous block's timestamp + the minimum block period.
+	errInvalidTimestamp = errors.New("invalid timestamp")
+
+	// errOutOfRangeChain is returned if an authorization list is attempted to
+	// be modified via out-of-range or non-contiguous headers.
+	errOutOfRangeChain = errors.New("out of range or non-contiguous chain")
+
+	// errBlockProduction - the engine only follows Bor chains
+	errBlockProduction = errors.New("block production is not supported by bor engine")
+
+	// ErrNotInHeimdall is returned if span or events are not known by Heimdall yet
+	ErrNotInHeimdall = errors.New("not found in heimdall")
+)
+
+// UnauthorizedSignerError is returned if a header is signed by a non-authorized entity.
+type UnauthorizedSignerError struct {
+	Number uint64
+	Signer common.Address
+}
+
+func (e *UnauthorizedSignerError) Error() string {
+	return fmt.Sprintf("Signer %s is not a part of the producer set at block %d", e.Signer, e.Number)
+}
+
+// UnauthorizedProposerError is returned if proposer of snapshot is not in its validator set.
+type UnauthorizedProposerError struct {
+	Number   uint64
+	Proposer common.Address
+}
+
+func (e *UnauthorizedProposerError) Error() string {
+	return fmt.Sprintf("Proposer %s is not a part of the producer set at block %d", e.Proposer, e.Number)
+}
+
+// BlockTooSoonError is returned if block is produced before its producer delay.
+type BlockTooSoonError struct {
+	Number     uint64
+	Succession int
+}
+
+func (e *BlockTooSoonError) Error() string {
+	return fmt.Sprintf("Block %d was created too soon. Signer turn-ness number is %d", e.Number, e.Succession)
+}
+
+// WrongDifficultyError is returned if the difficulty of a block doesn't match the turn of the signer.
+type WrongDifficultyError struct {
+	Number   uint64
+	Expected uint64
+	Actual   uint64
+	Signer   common.Address
+}
+
+func (e *WrongDifficultyError) Error() string {
+	return fmt.Sprintf("Wrong difficulty at block %d, expected: %d, actual %d. Signer was %s", e.Number, e.Expected, e.Actual, e.Signer)
+}
+
+// InvalidStateReceivedError is returned if state sync event doesn't follow previous one or is too new for block.
+type InvalidStateReceivedError struct {
+	Number      uint64
+	LastStateID uint64
+	To          time.Time
+	Event       *EventRecordWithTime
+}
+
+func (e *InvalidStateReceivedError) Error() string {
+	return fmt.Sprintf("Received invalid event %s at block %d. Requested events until %s. Last state id was %d",
+		e.Event, e.Number, e.To.Format(time.RFC3339), e.LastStateID)
+}
+
+// ecrecover extracts the Ethereum account address from a signed header.
+func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, error) {
+	// If the signature's already cached, return that
+	hash := header.Hash()
+	if address, known := sigcache.Get(hash); known {
+		return address.(common.Address), nil
+	}
+	// Retrieve the signature from the header extra-data
+	if len(header.Extra) < extraSeal {
+		return common.Address{}, errMissingSignature
+	}
+	signature := header.Extra[len(header.Extra)-extraSeal:]
+
+	// Recover the public key and the Ethereum address
+	pubkey, err := crypto.Ecrecover(SealHash(header).Bytes(), signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var signer common.Address
+	copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
+
+	sigcache.Add(hash, signer)
+	return signer, nil
+}
+
+// SealHash returns the hash of a block prior to it being sealed, it's same as of clique.
+func SealHash(header *types.Header) common.Hash {
+	return clique.SealHash(header)
+}
+
+// CalcProducerDelay is the block delay algorithm based on block time, period, producerDelay and turn-ness of a signer
+func CalcProducerDelay(number uint64, succession int, c *params.BorConfig) uint64 {
+	// When the block is the first block of the sprint, it is expected to be delayed by `producerDelay`.
+	// That is to allow time for block propagation in the last sprint
+	delay := c.CalculatePeriod(number)
+	if number%c.Sprint == 0 {
+		delay = c.ProducerDelay
+	}
+	if succession > 0 {
+		delay += uint64(succession) * c.CalculateBackupMultiplier(number)
+	}
+	return delay
+}
+
+// SpanIDAt - id of Heimdall span which contains the block
+func SpanIDAt(blockNum uint64) uint64 {
+	if blockNum > zerothSpanEnd {
+		return 1 + (blockNum-zerothSpanEnd-1)/spanLength
+	}
+	return 0
+}
+
+// FinalizedBlock - blocks up to it (sprint start) are not reorged anymore when canonical head is at given block
+func FinalizedBlock(config *params.BorConfig, head uint64) uint64 {
+	depth := finalitySprints * config.Sprint
+	if head < depth {
+		return 0
+	}
+	final := head - depth
+	return final - final%config.Sprint
+}
+
+// Bor is the matic-bor consensus engine
+type Bor struct {
+	chainConfig *params.ChainConfig // Chain config
+	config      *params.BorConfig   // Consensus engine configuration parameters for bor consensus
+	db          kv.RoDB             // Database to store and retrieve snapshot checkpoints, spans and events
+	rwDB        kv.RwDB             // nil in read-only mode (rpcdaemon)
+
+	recents    *lru.ARCCache // Snapshots for recent block to speed up reorgs
+	signatures *lru.ARCCache // Signatures of recent blocks to speed up mining
+
+	validatorSetABI  abi.ABI
+	stateReceiverABI abi.ABI
+	heimdall         IHeimdallClient // nil if heimdall is not used
+	withoutHeimdall  bool            // validators are taken from headers, state sync events are not committed
+
+	// The fields below are for testing only
+	fakeDiff bool // Skip difficulty verifications
+}
+
+// New creates a Bor consensus engine, heimdall is nil if chain is followed without Heimdall (devnets)
+func New(chainConfig *params.ChainConfig, db kv.RwDB, heimdall IHeimdallClient) *Bor {
+	c := newBor(chainConfig, db, heimdall)
+	c.rwDB = db
+	c.withoutHeimdall = heimdall == nil
+	return c
+}
+
+// NewReadonly - engine which doesn't write bor database and doesn't fetch data from Heimdall: for RPC of
+// snapshots, spans and events downloaded by Erigon
+func NewReadonly(chainConfig *params.ChainConfig, db kv.RoDB) *Bor {
+	return newBor(chainConfig, db, nil)
+}
+
+func newBor(chainConfig *params.ChainConfig, db kv.RoDB, heimdall IHeimdallClient) *Bor {
+	// Allocate the snapshot caches and create the engine
+	recents, err := lru.NewARC(inmemorySnapshots)
+	if err != nil {
+		panic(err)
+	}
+	signatures, err := lru.NewARC(inmemorySignatures)
+	if err != nil {
+		panic(err)
+	}
+	vABI, err := abi.JSON(strings.NewReader(validatorSetABI))
+	if err != nil {
+		panic(err)
+	}
+	sABI, err := abi.JSON(strings.NewReader(stateReceiverABI))
+	if err != nil {
+		panic(err)
+	}
+	return &Bor{
+		chainConfig:      chainConfig,
+		config:           chainConfig.Bor,
+		db:               db,
+		recents:          recents,
+		signatures:       signatures,
+		validatorSetABI:  vABI,
+		stateReceiverABI: sABI,
+		heimdall:         heimdall,
+	}
+}
+
+// DB - bor database: spans, state sync events and snapshots
+func (c *Bor) DB() kv.RwDB { return c.rwDB }
+
+// Heimdall - client of Heimdall, nil if chain is followed without it
+func (c *Bor) Heimdall() IHeimdallClient { return c.heimdall }
+
+// Author implements consensus.Engine, returning the Ethereum address recovered
+// from the signature in the header's extra-data section.
+func (c *Bor) Author(header *types.Header) (common.Address, error) {
+	return ecrecover(header, c.signatures)
+}
+
+// VerifyHeader checks whether a header conforms to the consensus rules.
+func (c *Bor) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
+	return c.verifyHeader(chain, header, nil)
+}
+
+// verifyHeader checks whether a header conforms to the consensus rules.The
+// caller may optionally pass in a batch of parents (ascending order) to avoid
+// looking those up from the database. This is useful for concurrently verifying
+// a batch of new headers.
+func (c *Bor) verifyHeader(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) error {
+	if header.Number == nil {
+		return errUnknownBlock
+	}
+	number := header.Number.Uint64()
+
+	// Don't waste time checking blocks from the future
+	if header.Time > uint64(time.Now().Unix()) {
+		return consensus.ErrFutureBlock
+	}
+	if err := validateHeaderExtraField(header.Extra); err != nil {
+		return err
+	}
+
+	// check extra data
+	isSprintEnd := (number+1)%c.config.Sprint == 0
+
+	// Ensure that the extra-data contains a signer list on checkpoint, but none otherwise
+	signersBytes := len(header.Extra) - extraVanity - extraSeal
+	if !isSprintEnd && signersBytes != 0 {
+		return errExtraValidators
+	}
+	if isSprintEnd && signersBytes%validatorHeaderBytesLength != 0 {
+		return errInvalidSpanValidators
+	}
+	// Ensure that the mix digest is zero as we don't have fork protection currently
+	if header.MixDigest != (common.Hash{}) {
+		return errInvalidMixDigest
+	}
+	// Ensure that the block doesn't contain any uncles which are meaningless in PoA
+	if header.UncleHash != types.EmptyUncleHash {
+		return errInvalidUncleHash
+	}
+	// Ensure that the block's difficulty is meaningful (may not be correct at this point)
+	if number > 0 && header.Difficulty == nil {
+		return errInvalidDifficulty
+	}
+	// If all checks passed, validate any special fields for hard forks
+	if err := misc.VerifyForkHashes(chain.Config(), header, false); err != nil {
+		return err
+	}
+	// All basic checks passed, verify cascading fields
+	return c.verifyCascadingFields(chain, header, parents)
+}
+
+// validateHeaderExtraField validates that the extra-data contains both the vanity and signature.
+// header.Extra = header.Vanity + header.ProducerBytes (optional) + header.Seal
+func validateHeaderExtraField(extraBytes []byte) error {
+	// See if we're still in the vanity part
+	if len(extraBytes) < extraVanity {
+		return errMissingVanity
+	}
+	if len(extraBytes) < extraVanity+extraSeal {
+		return errMissingSignature
+	}
+	return nil
+}
+
+// verifyCascadingFields verifies all the header fields that are not standalone,
+// rather depend on a batch of previous headers. The caller may optionally pass
+// in a batch of parents (ascending order) to avoid looking those up from the
+// database. This is useful for concurrently verifying a batch of new headers.
+func (c *Bor) verifyCascadingFields(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) error {
+	// The genesis block is the always valid dead-end
+	number := header.Number.Uint64()
+	if number == 0 {
+		return nil
+	}
+
+	// Ensure that the block's timestamp isn't too close to it's parent
+	var parent *types.Header
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	} else {
+		parent = chain.GetHeader(header.ParentHash, number-1)
+	}
+	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
+		return consensus.ErrUnknownAncestor
+	}
+
+	// Verify that the gasUsed is <= gasLimit
+	if header.GasUsed > header.GasLimit {
+		return fmt.Errorf("invalid gasUsed: have %d, gasLimit %d", header.GasUsed, header.GasLimit)
+	}
+	if !chain.Config().IsLondon(number) {
+		// Verify BaseFee not present before EIP-1559 fork.
+		if header.BaseFee != nil {
+			return fmt.Errorf("invalid baseFee before fork: have %d, want <nil>", header.BaseFee)
+		}
+		if err := misc.VerifyGaslimit(parent.GasLimit, header.GasLimit); err != nil {
+			return err
+		}
+	} else if err := misc.VerifyEip1559Header(chain.Config(), parent, header); err != nil {
+		// Verify the header's EIP-1559 attributes.
+		return err
+	}
+
+	if parent.Time+c.config.CalculatePeriod(number) > header.Time {
+		return errInvalidTimestamp
+	}
+
+	// Retrieve the snapshot needed to verify this header and cache it
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, parents)
+	if err != nil {
+		return err
+	}
+
+	// Verify the validator list of sprint end header against span of next sprint
+	if c.config.IsSprintStart(number+1) && c.heimdall != nil {
+		newValidators, err := c.spanValidators(number + 1)
+		if err != nil {
+			return err
+		}
+		sort.Sort(ValidatorsByAddress(newValidators))
+		headerVals, err := ParseValidators(header.Extra[extraVanity : len(header.Extra)-extraSeal])
+		if err != nil {
+			return err
+		}
+		if len(newValidators) != len(headerVals) {
+			return errInvalidSpanValidators
+		}
+		for i, val := range newValidators {
+			if string(val.HeaderBytes()) != string(headerVals[i].HeaderBytes()) {
+				return errInvalidSpanValidators
+			}
+		}
+	}
+
+	// All basic checks passed, verify the seal and return
+	return c.verifySeal(chain, header, parents, snap)
+}
+
+// Snapshot - validator set after given block
+func (c *Bor) Snapshot(chain consensus.ChainHeaderReader, number uint64, hash common.Hash) (*Snapshot, error) {
+	return c.snapshot(chain, number, hash, nil)
+}
+
+// snapshot retrieves the authorization snapshot at a given point in time.
+func (c *Bor) snapshot(chain consensus.ChainHeaderReader, number uint64, hash common.Hash, parents []*types.Header) (*Snapshot, error) {
+	// Search for a snapshot in memory or on disk for checkpoints
+	var (
+		headers []*types.Header
+		snap    *Snapshot
+	)
+
+	for snap == nil {
+		// If an in-memory snapshot was found, use that
+		if s, ok := c.recents.Get(hash); ok {
+			snap = s.(*Snapshot)
+			break
+		}
+
+		// If an on-disk checkpoint snapshot can be found, use that
+		if number%checkpointInterval == 0 {
+			s, err := loadSnapshot(c.config, c.signatures, c.db, number, hash)
+			if err != nil {
+				return nil, err
+			}
+			if s != nil {
+				log.Trace("Loaded snapshot from disk", "number", number, "hash", hash)
+				snap = s
+				break
+			}
+		}
+
+		// If we're at the genesis, snapshot the initial state. Alternatively if we're
+		// at a checkpoint block without a parent (light client CHT), or we have piled
+		// up more headers than allowed to be reorged (chain reinit from a freezer),
+		// consider the checkpoint trusted and snapshot it.
+		if number == 0 {
+			checkpoint := chain.GetHeaderByNumber(number)
+			if checkpoint != nil {
+				// get checkpoint data
+				hash := checkpoint.Hash()
+
+				// get validators and current span
+				validators, err := c.genesisValidators(checkpoint)
+				if err != nil {
+					return nil, err
+				}
+
+				// new snap shot
+				snap = newSnapshot(c.config, c.signatures, number, hash, validators)
+				if c.rwDB != nil {
+					if err := snap.store(c.rwDB); err != nil {
+						return nil, err
+					}
+				}
+				log.Info("Stored checkpoint snapshot to disk", "number", number, "hash", hash)
+				break
+			}
+		}
+
+		// No snapshot for this header, gather the header and move backward
+		var header *types.Header
+		if len(parents) > 0 {
+			// If we have explicit parents, pick from there (enforced)
+			header = parents[len(parents)-1]
+			if header.Hash() != hash || header.Number.Uint64() != number {
+				return nil, consensus.ErrUnknownAncestor
+			}
+			parents = parents[:len(parents)-1]
+		} else {
+			// No explicit parents (or no more left), reach out to the database
+			header = chain.GetHeader(hash, number)
+			if header == nil {
+				return nil, consensus.ErrUnknownAncestor
+			}
+		}
+		headers = append(headers, header)
+		number, hash = number-1, header.ParentHash
+	}
+
+	// check if snapshot is nil
+	if snap == nil {
+		return nil, fmt.Errorf("unknown error while retrieving snapshot at block number %v", number)
+	}
+
+	// Previous snapshot found, apply any pending headers on top of it
+	for i := 0; i < len(headers)/2; i++ {
+		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
+	}
+	snap, err := snap.apply(headers)
+	if err != nil {
+		return nil, err
+	}
+	c.recents.Add(snap.Hash, snap)
+
+	// If we've generated a new checkpoint snapshot, save to disk
+	if snap.Number%checkpointInterval == 0 && len(headers) > 0 && c.rwDB != nil {
+		if err = snap.store(c.rwDB); err != nil {
+			return nil, err
+		}
+		log.Trace("Stored snapshot to disk", "number", snap.Number, "hash", snap.Hash)
+	}
+	return snap, err
+}
+
+// genesisValidators - validators of first span, or validators from extra-data of genesis if chain is followed without
+// Heimdall
+func (c *Bor) genesisValidators(genesis *types.Header) ([]*Validator, error) {
+	if c.withoutHeimdall {
+		return ParseValidators(genesis.Extra[extraVanity : len(genesis.Extra)-extraSeal])
+	}
+	return c.spanValidators(1)
+}
+
+// spanValidators - validators of span which contains the block
+func (c *Bor) spanValidators(number uint64) ([]*Validator, error) {
+	span, err := c.span(SpanIDAt(number))
+	if err != nil {
+		return nil, err
+	}
+	return validatorListCopy(span.ValidatorSet.Validators), nil
+}
+
+// span - from bor database, fetched from Heimdall if it's not there yet
+func (c *Bor) span(spanID uint64) (*HeimdallSpan, error) {
+	var span *HeimdallSpan
+	if err := c.db.View(context.Background(), func(tx kv.Tx) (err error) {
+		span, err = ReadSpan(tx, spanID)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if span != nil {
+		return span, nil
+	}
+	if c.heimdall == nil {
+		return nil, fmt.Errorf("span %d is not downloaded", spanID)
+	}
+	span, err := c.heimdall.Span(context.Background(), spanID)
+	if err != nil {
+		return nil, err
+	}
+	if span.ChainID != c.chainConfig.ChainID.String() {
+		return nil, fmt.Errorf("chain id of span %d does not match, expected %s, got %s", spanID, c.chainConfig.ChainID, span.ChainID)
+	}
+	if c.rwDB != nil {
+		if err = c.rwDB.Update(context.Background(), func(tx kv.RwTx) error { return WriteSpan(tx, span) }); err != nil {
+			return nil, err
+		}
+	}
+	return span, nil
+}
+
+// VerifyUncles implements consensus.Engine, always returning an error for any
+// uncles as this consensus mechanism doesn't permit uncles.
+func (c *Bor) VerifyUncles(chain consensus.ChainReader, header *types.Header, uncles []*types.Header) error {
+	if len(uncles) > 0 {
+		return errors.New("uncles not allowed")
+	}
+	return nil
+}
+
+// verifySeal checks whether the signature contained in the header satisfies the
+// consensus protocol requirements. snap is the snapshot of parent block.
+func (c *Bor) verifySeal(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, snap *Snapshot) error {
+	// Verifying the genesis block is not supported
+	number := header.Number.Uint64()
+	if number == 0 {
+		return errUnknownBlock
+	}
+
+	// Resolve the authorization key and check against signers
+	signer, err := ecrecover(header, c.signatures)
+	if err != nil {
+		return err
+	}
+	if !snap.ValidatorSet.HasAddress(signer) {
+		return &UnauthorizedSignerError{number, signer}
+	}
+
+	succession, err := snap.GetSignerSuccessionNumber(signer)
+	if err != nil {
+		return err
+	}
+
+	var parent *types.Header
+	if len(parents) > 0 { // if parents is nil, len(parents) is zero
+		parent = parents[len(parents)-1]
+	} else if number > 0 {
+		parent = chain.GetHeader(header.ParentHash, number-1)
+	}
+	if parent != nil && header.Time < parent.Time+CalcProducerDelay(number, succession, c.config) {
+		return &BlockTooSoonError{number, succession}
+	}
+
+	// Ensure that the difficulty corresponds to the turn-ness of the signer
+	if !c.fakeDiff {
+		difficulty := snap.Difficulty(signer)
+		if header.Difficulty.Uint64() != difficulty {
+			return &WrongDifficultyError{number, difficulty, header.Difficulty.Uint64(), signer}
+		}
+	}
+	return nil
+}
+
+// Prepare implements consensus.Engine, the engine doesn't produce blocks.
+func (c *Bor) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
+	return errBlockProduction
+}
+
+func (c *Bor) Initialize(config *params.ChainConfig, chain consensus.ChainHeaderReader, e consensus.EpochReader, header *types.Header, txs []types.Transaction, uncles []*types.Header, syscall consensus.SystemCall) {
+}
+
+// Finalize implements consensus.Engine, commits span and state sync events at sprint start, no block rewards given.
+func (c *Bor) Finalize(config *params.ChainConfig, header *types.Header, state *state.IntraBlockState, txs []types.Transaction, uncles []*types.Header, r types.Receipts, e consensus.EpochReader, chain consensus.ChainHeaderReader, syscall consensus.SystemCall) ([]types.Transaction, uint64, error) {
+	headerNumber := header.Number.Uint64()
+	if headerNumber > 0 && c.config.IsSprintStart(headerNumber) {
+		// check and commit span
+		if err := c.checkAndCommitSpan(header, syscall); err != nil {
+			log.Error("Error while committing span", "err", err)
+			return nil, 0, err
+		}
+		if !c.withoutHeimdall {
+			// commit states
+			if err := c.CommitStates(header, chain, syscall); err != nil {
+				log.Error("Error while committing states", "err", err)
+				return nil, 0, err
+			}
+		}
+	}
+	if err := c.changeContractCodeIfNeeded(headerNumber, state); err != nil {
+		log.Error("Error changing contract code", "err", err)
+		return nil, 0, err
+	}
+	return nil, 0, nil
+}
+
+func (c *Bor) changeContractCodeIfNeeded(headerNumber uint64, state *state.IntraBlockState) error {
+	alloc, ok := c.config.BlockAlloc[strconv.FormatUint(headerNumber, 10)]
+	if !ok {
+		return nil
+	}
+	allocs, err := decodeGenesisAlloc(alloc)
+	if err != nil {
+		return fmt.Errorf("failed to decode genesis alloc: %w", err)
+	}
+	for addr, account := range allocs {
+		log.Info("change contract code", "address", addr)
+		state.SetCode(addr, account.Code)
+	}
+	return nil
+}
+
+func decodeGenesisAlloc(i interface{}) (core.GenesisAlloc, error) {
+	var alloc core.GenesisAlloc
+	b, err := json.Marshal(i)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &alloc); err != nil {
+		return nil, err
+	}
+	return alloc, nil
+}
+
+// FinalizeAndAssemble implements consensus.Engine, the engine doesn't produce blocks.
+func (c *Bor) FinalizeAndAssemble(config *params.ChainConfig, header *types.Header, state *state.IntraBlockState, txs []types.Transaction,
+	uncles []*types.Header, receipts types.Receipts, e consensus.EpochReader, chain consensus.ChainHeaderReader, syscall consensus.SystemCall, call consensus.Call) (*types.Block, []*types.Receipt, error) {
+	return nil, nil, errBlockProduction
+}
+
+// Seal implements consensus.Engine, the engine doesn't produce blocks.
+func (c *Bor) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	return errBlockProduction
+}
+
+func (c *Bor) GenerateSeal(chain consensus.ChainHeaderReader, currnt, parent *types.Header, call consensus.Call) []rlp.RawValue {
+	return nil
+}
+
+// CalcDifficulty is the difficulty adjustment algorithm. The engine has no signer, so difficulty
+// of a block without signer is returned.
+func (c *Bor) CalcDifficulty(chain consensus.ChainHeaderReader, time, parentTime uint64, parentDifficulty *big.Int, parentNumber uint64, parentHash, parentUncleHash common.Hash, parentSeal []rlp.RawValue) *big.Int {
+	snap, err := c.snapshot(chain, parentNumber, parentHash, nil)
+	if err != nil {
+		return nil
+	}
+	return new(big.Int).SetUint64(snap.Difficulty(common.Address{}))
+}
+
+// SealHash returns the hash of a block prior to it being sealed.
+func (c *Bor) SealHash(header *types.Header) common.Hash {
+	return SealHash(header)
+}
+
+// APIs implements consensus.Engine, returning the user facing RPC API to allow
+// controlling the signer voting.
+func (c *Bor) APIs(chain consensus.ChainHeaderReader) []rpc.API {
+	return []rpc.API{{
+		Namespace: "bor",
+		Version:   "1.0",
+		Service:   NewAPI(chain, c),
+		Public:    false,
+	}}
+}
+
+// Close implements consensus.Engine. It's a noop for bor as there are no background threads.
+func (c *Bor) Close() error {
+	return nil
+}
+
+// GetCurrentSpan get current span from contract
+func (c *Bor) GetCurrentSpan(syscall consensus.SystemCall) (*Span, error) {
+	// method
+	method := "getCurrentSpan"
+	data, err := c.validatorSetABI.Pack(method)
+	if err != nil {
+		log.Error("Unable to pack tx for getCurrentSpan", "err", err)
+		return nil, err
+	}
+	result, err := syscall(common.HexToAddress(c.config.ValidatorContract), data)
+	if err != nil {
+		return nil, err
+	}
+
+	// span result
+	ret := new(struct {
+		Number     *big.Int
+		StartBlock *big.Int
+		EndBlock   *big.Int
+	})
+	if err := c.validatorSetABI.UnpackIntoInterface(ret, method, result); err != nil {
+		return nil, err
+	}
+	return &Span{
+		ID:         ret.Number.Uint64(),
+		StartBlock: ret.StartBlock.Uint64(),
+		EndBlock:   ret.EndBlock.Uint64(),
+	}, nil
+}
+
+func (c *Bor) checkAndCommitSpan(header *types.Header, syscall consensus.SystemCall) error {
+	headerNumber := header.Number.Uint64()
+	span, err := c.GetCurrentSpan(syscall)
+	if err != nil {
+		return err
+	}
+	if c.needToCommitSpan(span, headerNumber) {
+		return c.fetchAndCommitSpan(span.ID+1, header, syscall)
+	}
+	return nil
+}
+
+func (c *Bor) needToCommitSpan(span *Span, headerNumber uint64) bool {
+	// if span is nil
+	if span == nil {
+		return false
+	}
+	// check span is not set initially
+	if span.EndBlock == 0 {
+		return true
+	}
+	// if current block is first block of last sprint in current span
+	return span.EndBlock > c.config.Sprint && span.EndBlock-c.config.Sprint+1 == headerNumber
+}
+
+func (c *Bor) fetchAndCommitSpan(newSpanID uint64, header *types.Header, syscall consensus.SystemCall) error {
+	var heimdallSpan *HeimdallSpan
+	var err error
+	if c.withoutHeimdall {
+		heimdallSpan, err = c.nextSpanWithoutHeimdall(newSpanID, header, syscall)
+	} else {
+		heimdallSpan, err = c.span(newSpanID)
+	}
+	if err != nil {
+		return err
+	}
+
+	// get validators bytes
+	validators := make([]MinimalVal, 0, len(heimdallSpan.ValidatorSet.Validators))
+	for _, val := range heimdallSpan.ValidatorSet.Validators {
+		validators = append(validators, val.MinimalVal())
+	}
+	validatorBytes, err := rlp.EncodeToBytes(validators)
+	if err != nil {
+		return err
+	}
+
+	// get producers bytes
+	producers := make([]MinimalVal, len(heimdallSpan.SelectedProducers))
+	for i, val := range heimdallSpan.SelectedProducers {
+		producers[i] = val.MinimalVal()
+	}
+	producerBytes, err := rlp.EncodeToBytes(producers)
+	if err != nil {
+		return err
+	}
+
+	// method
+	method := "commitSpan"
+	log.Debug("✅ Committing new span",
+		"id", heimdallSpan.ID,
+		"startBlock", heimdallSpan.StartBlock,
+		"endBlock", heimdallSpan.EndBlock,
+		"validatorBytes", common.Bytes2Hex(validatorBytes),
+		"producerBytes", common.Bytes2Hex(producerBytes),
+	)
+
+	// get packed data
+	data, err := c.validatorSetABI.Pack(method,
+		new(big.Int).SetUint64(heimdallSpan.ID),
+		new(big.Int).SetUint64(heimdallSpan.StartBlock),
+		new(big.Int).SetUint64(heimdallSpan.EndBlock),
+		validatorBytes,
+		producerBytes,
+	)
+	if err != nil {
+		log.Error("Unable to pack tx for commitSpan", "err", err)
+		return err
+	}
+	_, err = syscall(common.HexToAddress(c.config.ValidatorContract), data)
+	return err
+}
+
+// nextSpanWithoutHeimdall - span of same validators as current one, for devnets without Heimdall
+func (c *Bor) nextSpanWithoutHeimdall(newSpanID uint64, header *types.Header, syscall consensus.SystemCall) (*HeimdallSpan, error) {
+	span, err := c.GetCurrentSpan(syscall)
+	if err != nil {
+		return nil, err
+	}
+	genesis, err := c.genesisValidatorsFromDB()
+	if err != nil {
+		return nil, err
+	}
+	heimdallSpan := &HeimdallSpan{
+		Span: Span{
+			ID:         newSpanID,
+			StartBlock: span.EndBlock + 1,
+			EndBlock:   span.EndBlock + spanLength,
+		},
+		ValidatorSet: *NewValidatorSet(genesis),
+		ChainID:      c.chainConfig.ChainID.String(),
+	}
+	if span.EndBlock == 0 {
+		heimdallSpan.StartBlock = 0
+		heimdallSpan.EndBlock = zerothSpanEnd
+	}
+	for _, val := range heimdallSpan.ValidatorSet.Validators {
+		heimdallSpan.SelectedProducers = append(heimdallSpan.SelectedProducers, *val)
+	}
+	return heimdallSpan, nil
+}
+
+// genesisValidatorsFromDB - validators of genesis snapshot
+func (c *Bor) genesisValidatorsFromDB() ([]*Validator, error) {
+	var validators []*Validator
+	if err := c.db.View(context.Background(), func(tx kv.Tx) error {
+		cursor, err := tx.Cursor(BorSnapshot)
+		if err != nil {
+			return err
+		}
+		defer cursor.Close()
+		k, v, err := cursor.Seek(encodeNum(0))
+		if err != nil || k == nil {
+			return err
+		}
+		var snap Snapshot
+		if err = json.Unmarshal(v, &snap); err != nil {
+			return err
+		}
+		if snap.Number != 0 {
+			return nil
+		}
+		validators = validatorListCopy(snap.ValidatorSet.Validators)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if len(validators) == 0 {
+		return nil, errors.New("genesis snapshot not found")
+	}
+	return validators, nil
+}
+
+// CommitStates commits state sync events with ids following last committed one and time before
+// time of first block of previous sprint
+func (c *Bor) CommitStates(header *types.Header, chain consensus.ChainHeaderReader, syscall consensus.SystemCall) error {
+	number := header.Number.Uint64()
+	lastStateID, err := c.lastStateID(syscall)
+	if err != nil {
+		return err
+	}
+	prevSprintStart := chain.GetHeaderByNumber(number - c.config.Sprint)
+	if prevSprintStart == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	to := time.Unix(int64(prevSprintStart.Time), 0)
+	eventRecords, err := c.stateSyncEvents(number, lastStateID, to)
+	if err != nil {
+		return err
+	}
+	if limit, ok := c.config.OverrideStateSyncRecords[strconv.FormatUint(number, 10)]; ok && limit < len(eventRecords) {
+		log.Info("override state sync records", "number", number, "received", len(eventRecords), "committed", limit)
+		eventRecords = eventRecords[:limit]
+	}
+
+	chainID := c.chainConfig.ChainID.String()
+	for _, eventRecord := range eventRecords {
+		if eventRecord.ID <= lastStateID {
+			continue
+		}
+		if eventRecord.ID != lastStateID+1 || eventRecord.ChainID != chainID || !eventRecord.Time.Before(to) {
+			// events after it will be committed in next sprints
+			log.Error("invalid state sync event", "err", &InvalidStateReceivedError{number, lastStateID, to, eventRecord})
+			break
+		}
+		if err := c.commitState(eventRecord, syscall); err != nil {
+			return err
+		}
+		lastStateID++
+	}
+	return nil
+}
+
+// stateSyncEvents - events after lastStateID committed in the block: from bor database if BorHeimdall stage
+// downloaded them, from Heimdall otherwise
+func (c *Bor) stateSyncEvents(number, lastStateID uint64, to time.Time) ([]*EventRecordWithTime, error) {
+	var events []*EventRecordWithTime
+	var downloaded bool
+	if err := c.db.View(context.Background(), func(tx kv.Tx) error {
+		lastEventID, ok, err := ReadLastEventID(tx, number)
+		if err != nil || !ok {
+			return err
+		}
+		downloaded = true
+		if lastEventID <= lastStateID {
+			return nil
+		}
+		events, err = ReadEvents(tx, lastStateID+1, lastEventID)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if downloaded {
+		return events, nil
+	}
+	if c.heimdall == nil {
+		return nil, fmt.Errorf("state sync events of block %d are not downloaded", number)
+	}
+	return c.heimdall.StateSyncEvents(context.Background(), lastStateID+1, to.Unix())
+}
+
+func (c *Bor) lastStateID(syscall consensus.SystemCall) (uint64, error) {
+	method := "lastStateId"
+	data, err := c.stateReceiverABI.Pack(method)
+	if err != nil {
+		log.Error("Unable to pack tx for lastStateId", "err", err)
+		return 0, err
+	}
+	result, err := syscall(common.HexToAddress(c.config.StateReceiverContract), data)
+	if err != nil {
+		return 0, err
+	}
+	ret := new(*big.Int)
+	if err := c.stateReceiverABI.UnpackIntoInterface(ret, method, result); err != nil {
+		return 0, err
+	}
+	return (*ret).Uint64(), nil
+}
+
+func (c *Bor) commitState(event *EventRecordWithTime, syscall consensus.SystemCall) error {
+	recordBytes, err := rlp.EncodeToBytes(&event.EventRecord)
+	if err != nil {
+		return err
+	}
+	method := "commitState"
+	t := event.Time.Unix()
+	data, err := c.stateReceiverABI.Pack(method, big.NewInt(t), recordBytes)
+	if err != nil {
+		log.Error("Unable to pack tx for commitState", "err", err)
+		return err
+	}
+	log.Trace("→ committing new state", "eventRecord", event.String())
+	_, err = syscall(common.HexToAddress(c.config.StateReceiverContract), data)
+	return err
+}
@@ -0,0 +1,164 @@
+package bor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpanIDAt(t *testing.T) {
+	require.Equal(t, uint64(0), SpanIDAt(0))
+	require.Equal(t, uint64(0), SpanIDAt(zerothSpanEnd))
+	require.Equal(t, uint64(1), SpanIDAt(zerothSpanEnd+1))
+	require.Equal(t, uint64(1), SpanIDAt(zerothSpanEnd+spanLength))
+	require.Equal(t, uint64(2), SpanIDAt(zerothSpanEnd+spanLength+1))
+}
+
+func TestFinalizedBlock(t *testing.T) {
+	config := &params.BorConfig{Sprint: 64}
+	require.Equal(t, uint64(0), FinalizedBlock(config, 0))
+	require.Equal(t, uint64(0), FinalizedBlock(config, finalitySprints*64-1))
+	require.Equal(t, uint64(0), FinalizedBlock(config, finalitySprints*64+63))
+	require.Equal(t, uint64(64), FinalizedBlock(config, finalitySprints*64+64))
+	require.Equal(t, uint64(64), FinalizedBlock(config, finalitySprints*64+100))
+}
+
+func TestParseValidators(t *testing.T) {
+	vals := []*Validator{
+		NewValidator(common.HexToAddress("0x01"), 10),
+		NewValidator(common.HexToAddress("0x02"), 20),
+	}
+	var b []byte
+	for _, v := range vals {
+		b = append(b, v.HeaderBytes()...)
+	}
+	parsed, err := ParseValidators(b)
+	require.NoError(t, err)
+	require.Len(t, parsed, 2)
+	for i := range vals {
+		require.Equal(t, vals[i].Address, parsed[i].Address)
+		require.Equal(t, vals[i].VotingPower, parsed[i].VotingPower)
+	}
+	_, err = ParseValidators(b[:len(b)-1])
+	require.Error(t, err)
+}
+
+func TestValidatorSetProposerRotation(t *testing.T) {
+	a, b, c := common.HexToAddress("0x0a"), common.HexToAddress("0x0b"), common.HexToAddress("0x0c")
+	set := NewValidatorSet([]*Validator{NewValidator(a, 1), NewValidator(b, 1), NewValidator(c, 1)})
+	require.Equal(t, int64(3), set.TotalVotingPower())
+
+	// equal powers - every validator proposes once per round
+	seen := map[common.Address]int{}
+	for i := 0; i < 3; i++ {
+		seen[set.GetProposer().Address]++
+		set.IncrementProposerPriority(1)
+	}
+	require.Equal(t, map[common.Address]int{a: 1, b: 1, c: 1}, seen)
+
+	// validator missing in new list is removed, new one is added
+	d := common.HexToAddress("0x0d")
+	updated := getUpdatedValidatorSet(set.Copy(), []*Validator{NewValidator(a, 1), NewValidator(b, 5), NewValidator(d, 2)})
+	require.False(t, updated.HasAddress(c))
+	require.True(t, updated.HasAddress(d))
+	require.Equal(t, int64(8), updated.TotalVotingPower())
+	require.True(t, set.HasAddress(c), "original set must not be changed")
+}
+
+func TestEventsDB(t *testing.T) {
+	db := OpenDatabase("", log.New(), true)
+	defer db.Close()
+	start := time.Unix(1000, 0).UTC()
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		for id := uint64(1); id <= 5; id++ {
+			event := &EventRecordWithTime{EventRecord: EventRecord{ID: id, ChainID: "137"}, Time: start.Add(time.Duration(id) * time.Second)}
+			if err := WriteEvent(tx, event); err != nil {
+				return err
+			}
+		}
+		if err := WriteLastEventID(tx, 16, 2); err != nil {
+			return err
+		}
+		return WriteLastEventID(tx, 32, 5)
+	}))
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		last, err := LastEventID(tx)
+		require.NoError(t, err)
+		require.Equal(t, uint64(5), last)
+
+		events, err := ReadEvents(tx, 2, 4)
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+		require.Equal(t, uint64(2), events[0].ID)
+		require.Equal(t, start.Add(4*time.Second), events[2].Time)
+
+		require.NoError(t, TruncateEventNums(tx, 17))
+		id, ok, err := ReadLastEventID(tx, 16)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, uint64(2), id)
+		_, ok, err = ReadLastEventID(tx, 32)
+		require.NoError(t, err)
+		require.False(t, ok)
+		return nil
+	}))
+}
+
+func TestHeimdallClient(t *testing.T) {
+	const totalEvents = stateFetchLimit + 10
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result interface{}
+		switch r.URL.Path {
+		case "/bor/span/1":
+			result = HeimdallSpan{Span: Span{ID: 1, StartBlock: 256, EndBlock: 6655}, ChainID: "137"}
+		case "/bor/span/2":
+			result = nil // not known yet
+		case "/clerk/event-record/list":
+			fromID, _ := strconv.ParseUint(r.URL.Query().Get("from-id"), 10, 64)
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			var events []EventRecordWithTime
+			for id := fromID; id <= totalEvents && len(events) < limit; id++ {
+				events = append(events, EventRecordWithTime{EventRecord: EventRecord{ID: id}, Time: time.Unix(int64(id), 0)})
+			}
+			result = events
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		raw, _ := json.Marshal(result)
+		_ = json.NewEncoder(w).Encode(ResponseWithHeight{Height: "1", Result: raw})
+	}))
+	defer srv.Close()
+	client := NewHeimdallClient(srv.URL + "/")
+
+	span, err := client.Span(context.Background(), 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(6655), span.EndBlock)
+	require.Equal(t, "137", span.ChainID)
+
+	_, err = client.Span(context.Background(), 2)
+	require.True(t, errors.Is(err, ErrNotInHeimdall), fmt.Sprintf("%v", err))
+
+	events, err := client.StateSyncEvents(context.Background(), 1, 1000)
+	require.NoError(t, err)
+	require.Len(t, events, totalEvents)
+	for i, event := range events {
+		require.Equal(t, uint64(i+1), event.ID)
+	}
+
+	events, err = client.StateSyncEvents(context.Background(), totalEvents+1, 1000)
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
@@ -0,0 +1,158 @@
+package bor
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// Tables of bor database (datadir/bor), it's separate from chaindata as other consensus databases.
+const (
+	// span_id_u64 -> HeimdallSpan (json)
+	BorSpans = "BorSpans"
+	// event_id_u64 -> EventRecordWithTime (json)
+	BorEvents = "BorEvents"
+	// block_num_u64 (sprint start) -> last_event_id_u64: all events committed in this block are downloaded,
+	// their ids are not greater than last_event_id
+	BorEventNums = "BorEventNums"
+	// block_num_u64 + block_hash -> Snapshot (json)
+	BorSnapshot = "BorSnapshot"
+)
+
+var Tables = []string{BorSpans, BorEvents, BorEventNums, BorSnapshot}
+
+func tablesCfg(defaultBuckets kv.TableCfg) kv.TableCfg {
+	cfg := kv.TableCfg{}
+	for _, name := range Tables {
+		cfg[name] = kv.TableCfgItem{}
+	}
+	return cfg
+}
+
+func OpenDatabase(path string, logger log.Logger, inmem bool) kv.RwDB {
+	opts := mdbx.NewMDBX(logger).WithTablessCfg(tablesCfg)
+	if inmem {
+		opts = opts.InMem()
+	} else {
+		opts = opts.Path(path)
+	}
+	return opts.MustOpen()
+}
+
+// OpenDatabaseReadonly - for rpcdaemon, which reads bor database of running Erigon
+func OpenDatabaseReadonly(path string, logger log.Logger) (kv.RoDB, error) {
+	return mdbx.NewMDBX(logger).Path(path).WithTablessCfg(tablesCfg).Readonly().Open()
+}
+
+func encodeNum(n uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, n)
+	return k
+}
+
+func ReadSpan(tx kv.Getter, spanID uint64) (*HeimdallSpan, error) {
+	v, err := tx.GetOne(BorSpans, encodeNum(spanID))
+	if err != nil || v == nil {
+		return nil, err
+	}
+	var span HeimdallSpan
+	if err = json.Unmarshal(v, &span); err != nil {
+		return nil, err
+	}
+	return &span, nil
+}
+
+func WriteSpan(tx kv.Putter, span *HeimdallSpan) error {
+	v, err := json.Marshal(span)
+	if err != nil {
+		return err
+	}
+	return tx.Put(BorSpans, encodeNum(span.ID), v)
+}
+
+// LastSpanID - id of last stored span, false if there are no spans
+func LastSpanID(tx kv.Tx) (uint64, bool, error) {
+	return lastKey(tx, BorSpans)
+}
+
+// LastEventID - id of last stored event, 0 if there are no events (ids start from 1)
+func LastEventID(tx kv.Tx) (uint64, error) {
+	id, _, err := lastKey(tx, BorEvents)
+	return id, err
+}
+
+func lastKey(tx kv.Tx, table string) (uint64, bool, error) {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return 0, false, err
+	}
+	defer c.Close()
+	k, _, err := c.Last()
+	if err != nil || k == nil {
+		return 0, false, err
+	}
+	return binary.BigEndian.Uint64(k), true, nil
+}
+
+func WriteEvent(tx kv.Putter, event *EventRecordWithTime) error {
+	v, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return tx.Put(BorEvents, encodeNum(event.ID), v)
+}
+
+// ReadEvents - events with ids in [fromID, toID]
+func ReadEvents(tx kv.Tx, fromID, toID uint64) ([]*EventRecordWithTime, error) {
+	c, err := tx.Cursor(BorEvents)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	var events []*EventRecordWithTime
+	for k, v, err := c.Seek(encodeNum(fromID)); k != nil && binary.BigEndian.Uint64(k) <= toID; k, v, err = c.Next() {
+		if err != nil {
+			return nil, err
+		}
+		var event EventRecordWithTime
+		if err = json.Unmarshal(v, &event); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, nil
+}
+
+// ReadLastEventID - value of BorEventNums, false if events of the block are not downloaded yet
+func ReadLastEventID(tx kv.Getter, blockNum uint64) (uint64, bool, error) {
+	v, err := tx.GetOne(BorEventNums, encodeNum(blockNum))
+	if err != nil || len(v) != 8 {
+		return 0, false, err
+	}
+	return binary.BigEndian.Uint64(v), true, nil
+}
+
+func WriteLastEventID(tx kv.Putter, blockNum, eventID uint64) error {
+	return tx.Put(BorEventNums, encodeNum(blockNum), encodeNum(eventID))
+}
+
+// TruncateEventNums - deletes BorEventNums of blocks from given one, on unwind
+func TruncateEventNums(tx kv.RwTx, from uint64) error {
+	c, err := tx.RwCursor(BorEventNums)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for k, _, err := c.Seek(encodeNum(from)); k != nil; k, _, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err = c.DeleteCurrent(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
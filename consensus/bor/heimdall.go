@@ -0,0 +1,146 @@
+package bor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+)
+
+// Span - range of blocks produced by one validator set
+type Span struct {
+	ID         uint64 `json:"span_id"`
+	StartBlock uint64 `json:"start_block"`
+	EndBlock   uint64 `json:"end_block"`
+}
+
+// HeimdallSpan - span as it's announced by Heimdall
+type HeimdallSpan struct {
+	Span
+	ValidatorSet      ValidatorSet `json:"validator_set"`
+	SelectedProducers []Validator  `json:"selected_producers"`
+	ChainID           string       `json:"bor_chain_id"`
+}
+
+// EventRecord - state sync event: message from Ethereum to contract of Bor chain, committed to
+// state receiver contract at sprint start
+type EventRecord struct {
+	ID       uint64         `json:"id"`
+	Contract common.Address `json:"contract"`
+	Data     hexutil.Bytes  `json:"data"`
+	TxHash   common.Hash    `json:"tx_hash"`
+	LogIndex uint64         `json:"log_index"`
+	ChainID  string         `json:"bor_chain_id"`
+}
+
+type EventRecordWithTime struct {
+	EventRecord
+	Time time.Time `json:"record_time"`
+}
+
+func (e *EventRecordWithTime) String() string {
+	return fmt.Sprintf("id %d, contract %s, data: %s, txHash: %s, logIndex: %d, chainId: %s, time %s",
+		e.ID, e.Contract.String(), e.Data.String(), e.TxHash.Hex(), e.LogIndex, e.ChainID, e.Time.Format(time.RFC3339))
+}
+
+// IHeimdallClient - source of spans and state sync events
+type IHeimdallClient interface {
+	Span(ctx context.Context, spanID uint64) (*HeimdallSpan, error)
+	// StateSyncEvents - events starting from fromID (inclusive) with time before to (unix seconds), ordered by id
+	StateSyncEvents(ctx context.Context, fromID uint64, to int64) ([]*EventRecordWithTime, error)
+}
+
+// stateFetchLimit - events per request, max page size of Heimdall
+const stateFetchLimit = 50
+
+// HeimdallClient - client of Heimdall REST API
+type HeimdallClient struct {
+	urlString string
+	client    http.Client
+}
+
+func NewHeimdallClient(urlString string) *HeimdallClient {
+	return &HeimdallClient{
+		urlString: strings.TrimSuffix(urlString, "/"),
+		client:    http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// ResponseWithHeight - envelope of all Heimdall responses
+type ResponseWithHeight struct {
+	Height string          `json:"height"`
+	Result json.RawMessage `json:"result"`
+}
+
+func (h *HeimdallClient) Span(ctx context.Context, spanID uint64) (*HeimdallSpan, error) {
+	var span HeimdallSpan
+	if err := h.fetch(ctx, fmt.Sprintf("bor/span/%d", spanID), "", &span); err != nil {
+		return nil, err
+	}
+	return &span, nil
+}
+
+func (h *HeimdallClient) StateSyncEvents(ctx context.Context, fromID uint64, to int64) ([]*EventRecordWithTime, error) {
+	var events []*EventRecordWithTime
+	for {
+		var page []*EventRecordWithTime
+		query := fmt.Sprintf("from-id=%d&to-time=%d&limit=%d", fromID, to, stateFetchLimit)
+		err := h.fetch(ctx, "clerk/event-record/list", query, &page)
+		if errors.Is(err, ErrNotInHeimdall) { // no events yet
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, page...)
+		if len(page) < stateFetchLimit {
+			return events, nil
+		}
+		fromID += uint64(stateFetchLimit)
+	}
+}
+
+func (h *HeimdallClient) fetch(ctx context.Context, path, query string, result interface{}) error {
+	u, err := url.Parse(h.urlString)
+	if err != nil {
+		return err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + path
+	u.RawQuery = query
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("heimdall %s: %w", path, err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("heimdall %s: %w", path, err)
+	}
+	if res.StatusCode == http.StatusNoContent {
+		return fmt.Errorf("heimdall %s: %w", path, ErrNotInHeimdall)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("heimdall %s: status %d: %s", path, res.StatusCode, body)
+	}
+	var response ResponseWithHeight
+	if err = json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("heimdall %s: %w", path, err)
+	}
+	// Heimdall answers with empty result on unknown span
+	if len(response.Result) == 0 || string(response.Result) == "null" {
+		return fmt.Errorf("heimdall %s: %w", path, ErrNotInHeimdall)
+	}
+	return json.Unmarshal(response.Result, result)
+}
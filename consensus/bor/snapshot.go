@@ -0,0 +1,247 @@
+package bor
+
+import (
+	"context"
+	"encoding/json"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/log/v3"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/params"
+)
+
+// Snapshot is the state of the authorization voting at a given point in time.
+type Snapshot struct {
+	config   *params.BorConfig // Consensus engine parameters to fine tune behavior
+	sigcache *lru.ARCCache     // Cache of recent block signatures to speed up ecrecover
+
+	Number       uint64                    `json:"number"`       // Block number where the snapshot was created
+	Hash         common.Hash               `json:"hash"`         // Block hash where the snapshot was created
+	ValidatorSet *ValidatorSet             `json:"validatorSet"` // Validator set at this moment
+	Recents      map[uint64]common.Address `json:"recents"`      // Set of recent signers for spam protections
+}
+
+// newSnapshot creates a new snapshot with the specified startup parameters. This
+// method does not initialize the set of recent signers, so only ever use it for
+// the genesis block.
+func newSnapshot(config *params.BorConfig, sigcache *lru.ARCCache, number uint64, hash common.Hash, validators []*Validator) *Snapshot {
+	return &Snapshot{
+		config:       config,
+		sigcache:     sigcache,
+		Number:       number,
+		Hash:         hash,
+		ValidatorSet: NewValidatorSet(validators),
+		Recents:      make(map[uint64]common.Address),
+	}
+}
+
+// loadSnapshot loads an existing snapshot from the database.
+func loadSnapshot(config *params.BorConfig, sigcache *lru.ARCCache, db kv.RoDB, num uint64, hash common.Hash) (*Snapshot, error) {
+	tx, err := db.BeginRo(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	blob, err := tx.GetOne(BorSnapshot, append(encodeNum(num), hash.Bytes()...))
+	if err != nil || blob == nil {
+		return nil, err
+	}
+	snap := new(Snapshot)
+	if err := json.Unmarshal(blob, snap); err != nil {
+		return nil, err
+	}
+	snap.config = config
+	snap.sigcache = sigcache
+	// update total voting power
+	snap.ValidatorSet.updateTotalVotingPower()
+	return snap, nil
+}
+
+// store inserts the snapshot into the database.
+func (s *Snapshot) store(db kv.RwDB) error {
+	blob, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return db.Update(context.Background(), func(tx kv.RwTx) error {
+		return tx.Put(BorSnapshot, append(encodeNum(s.Number), s.Hash.Bytes()...), blob)
+	})
+}
+
+// copy creates a deep copy of the snapshot, though not the individual votes.
+func (s *Snapshot) copy() *Snapshot {
+	cpy := &Snapshot{
+		config:       s.config,
+		sigcache:     s.sigcache,
+		Number:       s.Number,
+		Hash:         s.Hash,
+		ValidatorSet: s.ValidatorSet.Copy(),
+		Recents:      make(map[uint64]common.Address),
+	}
+	for block, signer := range s.Recents {
+		cpy.Recents[block] = signer
+	}
+	return cpy
+}
+
+// apply creates a new authorization snapshot by applying the given headers to
+// the original one.
+func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
+	// Allow passing in no headers for cleaner code
+	if len(headers) == 0 {
+		return s, nil
+	}
+	// Sanity check that the headers can be applied
+	for i := 0; i < len(headers)-1; i++ {
+		if headers[i+1].Number.Uint64() != headers[i].Number.Uint64()+1 {
+			return nil, errOutOfRangeChain
+		}
+	}
+	if headers[0].Number.Uint64() != s.Number+1 {
+		return nil, errOutOfRangeChain
+	}
+	// Iterate through the headers and create a new snapshot
+	snap := s.copy()
+
+	for _, header := range headers {
+		// Remove any votes on checkpoint blocks
+		number := header.Number.Uint64()
+
+		// Delete the oldest signer from the recent list to allow it signing again
+		if number >= s.config.Sprint {
+			delete(snap.Recents, number-s.config.Sprint)
+		}
+
+		// Resolve the authorization key and check against signers
+		signer, err := ecrecover(header, s.sigcache)
+		if err != nil {
+			return nil, err
+		}
+
+		// check if signer is in validator set
+		if !snap.ValidatorSet.HasAddress(signer) {
+			return nil, &UnauthorizedSignerError{number, signer}
+		}
+		if _, err = snap.GetSignerSuccessionNumber(signer); err != nil {
+			return nil, err
+		}
+
+		// add recents
+		snap.Recents[number] = signer
+
+		// change validator set and change proposer
+		if number > 0 && (number+1)%s.config.Sprint == 0 {
+			if err := validateHeaderExtraField(header.Extra); err != nil {
+				return nil, err
+			}
+			validatorBytes := header.Extra[extraVanity : len(header.Extra)-extraSeal]
+
+			// get validators from headers and use that for new validator set
+			newVals, err := ParseValidators(validatorBytes)
+			if err != nil {
+				return nil, err
+			}
+			v := getUpdatedValidatorSet(snap.ValidatorSet.Copy(), newVals)
+			v.IncrementProposerPriority(1)
+			snap.ValidatorSet = v
+		}
+	}
+	snap.Number += uint64(len(headers))
+	snap.Hash = headers[len(headers)-1].Hash()
+
+	return snap, nil
+}
+
+// GetSignerSuccessionNumber returns the relative position of signer in terms of the in-turn proposer
+func (s *Snapshot) GetSignerSuccessionNumber(signer common.Address) (int, error) {
+	validators := s.ValidatorSet.Validators
+	proposer := s.ValidatorSet.GetProposer().Address
+	proposerIndex, _ := s.ValidatorSet.GetByAddress(proposer)
+	if proposerIndex == -1 {
+		return -1, &UnauthorizedProposerError{s.Number, proposer}
+	}
+	signerIndex, _ := s.ValidatorSet.GetByAddress(signer)
+	if signerIndex == -1 {
+		return -1, &UnauthorizedSignerError{s.Number, signer}
+	}
+
+	tempIndex := signerIndex
+	if proposerIndex != tempIndex {
+		if tempIndex < proposerIndex {
+			tempIndex = tempIndex + len(validators)
+		}
+	}
+	return tempIndex - proposerIndex, nil
+}
+
+// signers retrieves the list of authorized signers in ascending order.
+func (s *Snapshot) signers() []common.Address {
+	sigs := make([]common.Address, 0, len(s.ValidatorSet.Validators))
+	for _, sig := range s.ValidatorSet.Validators {
+		sigs = append(sigs, sig.Address)
+	}
+	return sigs
+}
+
+// Difficulty returns the difficulty for a particular signer at the current snapshot number
+func (s *Snapshot) Difficulty(signer common.Address) uint64 {
+	// if signer is empty
+	if signer == (common.Address{}) {
+		return 1
+	}
+
+	validators := s.ValidatorSet.Validators
+	proposer := s.ValidatorSet.GetProposer().Address
+	totalValidators := len(validators)
+
+	proposerIndex, _ := s.ValidatorSet.GetByAddress(proposer)
+	signerIndex, _ := s.ValidatorSet.GetByAddress(signer)
+
+	// temp index
+	tempIndex := signerIndex
+	if tempIndex < proposerIndex {
+		tempIndex = tempIndex + totalValidators
+	}
+
+	return uint64(totalValidators - (tempIndex - proposerIndex))
+}
+
+// getUpdatedValidatorSet - validators of old set missing in new list get zero power (are removed),
+// priorities of staying validators are kept
+func getUpdatedValidatorSet(oldValidatorSet *ValidatorSet, newVals []*Validator) *ValidatorSet {
+	v := oldValidatorSet
+	oldVals := v.Validators
+
+	changes := make([]*Validator, 0, len(oldVals))
+	for _, ov := range oldVals {
+		if f, ok := validatorContains(newVals, ov); ok {
+			ov.VotingPower = f.VotingPower
+		} else {
+			ov.VotingPower = 0
+		}
+		changes = append(changes, ov)
+	}
+
+	for _, nv := range newVals {
+		if _, ok := validatorContains(changes, nv); !ok {
+			changes = append(changes, nv)
+		}
+	}
+
+	if err := v.UpdateWithChangeSet(changes); err != nil {
+		log.Error("Error while updating change set", "error", err)
+	}
+	return v
+}
+
+func validatorContains(a []*Validator, x *Validator) (*Validator, bool) {
+	for _, n := range a {
+		if n.Address == x.Address {
+			return n, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,126 @@
+package bor
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/ledgerwatch/erigon/common"
+)
+
+// Validator represents Volatile state for each Validator
+type Validator struct {
+	ID               uint64         `json:"ID"`
+	Address          common.Address `json:"signer"`
+	VotingPower      int64          `json:"power"`
+	ProposerPriority int64          `json:"accum"`
+}
+
+// NewValidator creates new validator
+func NewValidator(address common.Address, votingPower int64) *Validator {
+	return &Validator{
+		Address:          address,
+		VotingPower:      votingPower,
+		ProposerPriority: 0,
+	}
+}
+
+// Copy creates a new copy of the validator so we can mutate ProposerPriority.
+// Panics if the validator is nil.
+func (v *Validator) Copy() *Validator {
+	vCopy := *v
+	return &vCopy
+}
+
+// Cmp returns the one validator with a higher ProposerPriority.
+// If ProposerPriority is same, it returns the validator with lexicographically smaller address
+func (v *Validator) Cmp(other *Validator) *Validator {
+	// if both of v and other are nil, nil will be returned and that could possibly lead to nil pointer dereference bubbling up the stack
+	if v == nil {
+		return other
+	}
+	if other == nil {
+		return v
+	}
+	if v.ProposerPriority > other.ProposerPriority {
+		return v
+	}
+	if v.ProposerPriority < other.ProposerPriority {
+		return other
+	}
+	result := bytes.Compare(v.Address.Bytes(), other.Address.Bytes())
+	if result < 0 {
+		return v
+	}
+	if result > 0 {
+		return other
+	}
+	panic("Cannot compare identical validators")
+}
+
+func (v *Validator) String() string {
+	if v == nil {
+		return "nil-Validator"
+	}
+	return fmt.Sprintf("Validator{%v Power:%v Priority:%v}", v.Address.Hex(), v.VotingPower, v.ProposerPriority)
+}
+
+// HeaderBytes return header bytes: address and voting power (20 bytes, big endian) - format of validators in
+// extra-data of sprint end header
+func (v *Validator) HeaderBytes() []byte {
+	result := make([]byte, validatorHeaderBytesLength)
+	copy(result[:common.AddressLength], v.Address.Bytes())
+	copy(result[common.AddressLength:], v.PowerBytes())
+	return result
+}
+
+// PowerBytes return power bytes
+func (v *Validator) PowerBytes() []byte {
+	powerBytes := big.NewInt(0).SetInt64(v.VotingPower).Bytes()
+	result := make([]byte, 20)
+	copy(result[20-len(powerBytes):], powerBytes)
+	return result
+}
+
+// MinimalVal - representation of validator in commitSpan call of validator set contract
+func (v *Validator) MinimalVal() MinimalVal {
+	return MinimalVal{
+		ID:          v.ID,
+		VotingPower: uint64(v.VotingPower),
+		Signer:      v.Address,
+	}
+}
+
+// ParseValidators - validators from extra-data of sprint end header
+func ParseValidators(validatorsBytes []byte) ([]*Validator, error) {
+	if len(validatorsBytes)%validatorHeaderBytesLength != 0 {
+		return nil, errInvalidSpanValidators
+	}
+	result := make([]*Validator, len(validatorsBytes)/validatorHeaderBytesLength)
+	for i := 0; i < len(validatorsBytes); i += validatorHeaderBytesLength {
+		address := validatorsBytes[i : i+common.AddressLength]
+		power := validatorsBytes[i+common.AddressLength : i+validatorHeaderBytesLength]
+		result[i/validatorHeaderBytesLength] = NewValidator(common.BytesToAddress(address), big.NewInt(0).SetBytes(power).Int64())
+	}
+	return result, nil
+}
+
+// MinimalVal is the minimal validator representation, used to send validator set to contract
+type MinimalVal struct {
+	ID          uint64         `json:"ID"`
+	VotingPower uint64         `json:"power"`
+	Signer      common.Address `json:"signer"`
+}
+
+// ValidatorsByAddress - sorts validators by address, as they are written into header
+type ValidatorsByAddress []*Validator
+
+func (valz ValidatorsByAddress) Len() int { return len(valz) }
+
+func (valz ValidatorsByAddress) Less(i, j int) bool {
+	return bytes.Compare(valz[i].Address.Bytes(), valz[j].Address.Bytes()) == -1
+}
+
+func (valz ValidatorsByAddress) Swap(i, j int) {
+	valz[i], valz[j] = valz[j], valz[i]
+}
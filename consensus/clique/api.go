@@ -16,7 +16,6 @@
 
 package clique
 
-/*
 import (
 	"fmt"
 
@@ -25,6 +24,7 @@ import (
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/rpc"
 )
+
 // API is a user facing RPC API to allow controlling the signer and voting
 // mechanisms of the proof-of-authority scheme.
 type API struct {
@@ -32,6 +32,11 @@ type API struct {
 	clique *Clique
 }
 
+// NewAPI creates API working with the given chain, used by rpcdaemon which has no engine of its own
+func NewAPI(chain consensus.ChainHeaderReader, clique *Clique) *API {
+	return &API{chain: chain, clique: clique}
+}
+
 // GetSnapshot retrieves the state snapshot at a given block.
 func (api *API) GetSnapshot(number *rpc.BlockNumber) (*Snapshot, error) {
 	// Retrieve the requested block number (or current if none requested)
@@ -46,7 +51,7 @@ func (api *API) GetSnapshot(number *rpc.BlockNumber) (*Snapshot, error) {
 		return nil, errUnknownBlock
 	}
 
-	snap, err := api.clique.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+	snap, err := api.clique.Snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +66,7 @@ func (api *API) GetSnapshotAtHash(hash common.Hash) (*Snapshot, error) {
 		return nil, errUnknownBlock
 	}
 
-	snap, err := api.clique.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+	snap, err := api.clique.Snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -83,11 +88,11 @@ func (api *API) GetSigners(number *rpc.BlockNumber) ([]common.Address, error) {
 		return nil, errUnknownBlock
 	}
 
-	snap, err := api.clique.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+	snap, err := api.clique.Snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
 	if err != nil {
 		return nil, err
 	}
-	return snap.signers(), nil
+	return snap.GetSigners(), nil
 }
 
 // GetSignersAtHash retrieves the list of authorized signers at the specified block.
@@ -96,44 +101,40 @@ func (api *API) GetSignersAtHash(hash common.Hash) ([]common.Address, error) {
 	if header == nil {
 		return nil, errUnknownBlock
 	}
-	snap, err := api.clique.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+	snap, err := api.clique.Snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
 	if err != nil {
 		return nil, err
 	}
-	return snap.signers(), nil
+	return snap.GetSigners(), nil
 }
 
 // Proposals returns the current proposals the node tries to uphold and vote on.
-func (api *API) Proposals() map[common.Address]bool {
-	api.clique.lock.RLock()
-	defer api.clique.lock.RUnlock()
-
-	proposals := make(map[common.Address]bool)
-	for address, auth := range api.clique.proposals {
-		proposals[address] = auth
-	}
-	return proposals
+func (api *API) Proposals() (map[common.Address]bool, error) {
+	return api.clique.Proposals()
 }
 
 // Propose injects a new authorization proposal that the signer will attempt to
 // push through.
-func (api *API) Propose(address common.Address, auth bool) {
-	api.clique.lock.Lock()
-	defer api.clique.lock.Unlock()
-
-	api.clique.proposals[address] = auth
+func (api *API) Propose(address common.Address, auth bool) error {
+	return api.clique.Propose(address, auth)
 }
 
 // Discard drops a currently running proposal, stopping the signer from casting
 // further votes (either for or against).
-func (api *API) Discard(address common.Address) {
-	api.clique.lock.Lock()
-	defer api.clique.lock.Unlock()
+func (api *API) Discard(address common.Address) error {
+	return api.clique.Discard(address)
+}
 
-	delete(api.clique.proposals, address)
+// RecoverSnapshot rebuilds the signers snapshot from the epoch checkpoint block with the given number.
+func (api *API) RecoverSnapshot(number rpc.BlockNumber) (*Snapshot, error) {
+	if number < 0 {
+		return nil, fmt.Errorf("checkpoint block number required")
+	}
+	return api.clique.RecoverSnapshot(api.chain, uint64(number))
 }
 
-type status struct {
+// Status is signing activity of recent blocks returned by clique_status
+type Status struct {
 	InturnPercent float64                `json:"inturnPercent"`
 	SigningStatus map[common.Address]int `json:"sealerActivity"`
 	NumBlocks     uint64                 `json:"numBlocks"`
@@ -143,19 +144,19 @@ type status struct {
 // - the number of active signers,
 // - the number of signers,
 // - the percentage of in-turn blocks
-func (api *API) Status() (*status, error) {
+func (api *API) Status() (*Status, error) {
 	var (
 		numBlocks = uint64(64)
 		header    = api.chain.CurrentHeader()
 		diff      = uint64(0)
 		optimals  = 0
 	)
-	snap, err := api.clique.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+	snap, err := api.clique.Snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
 	if err != nil {
 		return nil, err
 	}
 	var (
-		signers = snap.signers()
+		signers = snap.GetSigners()
 		end     = header.Number.Uint64()
 		start   = end - numBlocks
 	)
@@ -172,7 +173,7 @@ func (api *API) Status() (*status, error) {
 		if h == nil {
 			return nil, fmt.Errorf("missing block %d", n)
 		}
-		if h.Difficulty.Cmp(diffInTurn) == 0 {
+		if h.Difficulty.Cmp(DiffInTurn) == 0 {
 			optimals++
 		}
 		diff += h.Difficulty.Uint64()
@@ -182,10 +183,9 @@ func (api *API) Status() (*status, error) {
 		}
 		signStatus[sealer]++
 	}
-	return &status{
+	return &Status{
 		InturnPercent: float64(100*optimals) / float64(numBlocks),
 		SigningStatus: signStatus,
 		NumBlocks:     numBlocks,
 	}, nil
 }
-*/
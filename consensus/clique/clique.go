@@ -181,8 +181,6 @@ type Clique struct {
 	signatures *lru.ARCCache // Signatures of recent blocks to speed up mining
 	recents    *lru.ARCCache // Snapshots for recent block to speed up reorgs
 
-	proposals map[common.Address]bool // Current list of proposals we are pushing
-
 	signer common.Address // Ethereum address of the signing key
 	signFn SignerFn       // Signer function to authorize hashes with
 	lock   sync.RWMutex   // Protects the signer fields
@@ -216,7 +214,6 @@ func New(cfg *params.ChainConfig, snapshotConfig *params.ConsensusSnapshotConfig
 		db:             cliqueDB,
 		recents:        recents,
 		signatures:     signatures,
-		proposals:      make(map[common.Address]bool),
 		exitCh:         exitCh,
 	}
 
@@ -295,11 +292,13 @@ func (c *Clique) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 		return err
 	}
 	if number%c.config.Epoch != 0 {
-		c.lock.RLock()
-
+		proposals, err := c.Proposals()
+		if err != nil {
+			log.Warn("Failed to read clique proposals, not voting", "err", err)
+		}
 		// Gather all the proposals that make sense voting on
-		addresses := make([]common.Address, 0, len(c.proposals))
-		for address, authorize := range c.proposals {
+		addresses := make([]common.Address, 0, len(proposals))
+		for address, authorize := range proposals {
 			if snap.validVote(address, authorize) {
 				addresses = append(addresses, address)
 			}
@@ -307,13 +306,12 @@ func (c *Clique) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 		// If there's pending proposals, cast a vote on them
 		if len(addresses) > 0 {
 			header.Coinbase = addresses[rand.Intn(len(addresses))]
-			if c.proposals[header.Coinbase] {
+			if proposals[header.Coinbase] {
 				copy(header.Nonce[:], NonceAuthVote)
 			} else {
 				copy(header.Nonce[:], nonceDropVote)
 			}
 		}
-		c.lock.RUnlock()
 	}
 	// Set the correct difficulty
 	header.Difficulty = calcDifficulty(snap, c.signer)
@@ -495,12 +493,12 @@ func (c *Clique) Close() error {
 // controlling the signer voting.
 func (c *Clique) APIs(chain consensus.ChainHeaderReader) []rpc.API {
 	return []rpc.API{
-		//{
-		//Namespace: "clique",
-		//Version:   "1.0",
-		//Service:   &API{chain: chain, clique: c},
-		//Public:    false,
-		//}
+		{
+			Namespace: "clique",
+			Version:   "1.0",
+			Service:   &API{chain: chain, clique: c},
+			Public:    false,
+		},
 	}
 }
 
@@ -31,8 +31,11 @@ import (
 	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
 )
 
 // This test case is a repro of an annoying bug that took us forever to catch.
@@ -137,3 +140,65 @@ func TestReimportMirroredState(t *testing.T) {
 	}
 
 }
+
+func TestProposals(t *testing.T) {
+	cliqueDB := clique.OpenDatabase("", log.New(), true)
+	defer cliqueDB.Close()
+	a, b := common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+
+	engine := clique.New(params.AllCliqueProtocolChanges, params.CliqueSnapshot, cliqueDB)
+	require.NoError(t, engine.Propose(a, true))
+	require.NoError(t, engine.Propose(b, true))
+	require.NoError(t, engine.Propose(b, false))
+	proposals, err := engine.Proposals()
+	require.NoError(t, err)
+	require.Equal(t, map[common.Address]bool{a: true, b: false}, proposals)
+
+	// proposals are kept in database, another engine instance sees them
+	engine = clique.New(params.AllCliqueProtocolChanges, params.CliqueSnapshot, cliqueDB)
+	require.NoError(t, engine.Discard(b))
+	proposals, err = engine.Proposals()
+	require.NoError(t, err)
+	require.Equal(t, map[common.Address]bool{a: true}, proposals)
+}
+
+func TestRecoverSnapshot(t *testing.T) {
+	db := memdb.NewTestDB(t)
+	cliqueDB := clique.OpenDatabase("", log.New(), true)
+	defer cliqueDB.Close()
+	config := *params.AllCliqueProtocolChanges
+	config.Clique = &params.CliqueConfig{Period: 1, Epoch: 4}
+	signers := []common.Address{common.HexToAddress("0x0a"), common.HexToAddress("0x0b")}
+
+	// headers before the checkpoint are missing, so snapshot can't be built from genesis
+	parent := &types.Header{Number: big.NewInt(3), Extra: make([]byte, clique.ExtraVanity+clique.ExtraSeal)}
+	checkpoint := &types.Header{Number: big.NewInt(4), ParentHash: parent.Hash(), Extra: make([]byte, clique.ExtraVanity+len(signers)*common.AddressLength+clique.ExtraSeal)}
+	for i, signer := range signers {
+		copy(checkpoint.Extra[clique.ExtraVanity+i*common.AddressLength:], signer[:])
+	}
+	tx, err := db.BeginRw(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	for _, header := range []*types.Header{parent, checkpoint} {
+		rawdb.WriteHeader(tx, header)
+		require.NoError(t, rawdb.WriteCanonicalHash(tx, header.Hash(), header.Number.Uint64()))
+	}
+	chain := stagedsync.ChainReader{Cfg: config, Db: tx}
+
+	engine := clique.New(&config, params.CliqueSnapshot, cliqueDB)
+	_, err = engine.Snapshot(chain, 4, checkpoint.Hash(), nil)
+	require.Error(t, err)
+
+	_, err = engine.RecoverSnapshot(chain, 3)
+	require.Error(t, err)
+	snap, err := engine.RecoverSnapshot(chain, 4)
+	require.NoError(t, err)
+	require.Equal(t, signers, snap.GetSigners())
+
+	// recovered snapshot is stored, new engine instance loads it from database
+	engine = clique.New(&config, params.CliqueSnapshot, cliqueDB)
+	snap, err = engine.Snapshot(chain, 4, checkpoint.Hash(), nil)
+	require.NoError(t, err)
+	require.Equal(t, checkpoint.Hash(), snap.Hash)
+	require.Equal(t, signers, snap.GetSigners())
+}
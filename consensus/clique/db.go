@@ -0,0 +1,37 @@
+package clique
+
+import (
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/log/v3"
+	mdbx2 "github.com/torquem-ch/mdbx-go/mdbx"
+)
+
+// CliqueProposals - signer_address -> 1 (authorize) or 0 (deauthorize), votes the node casts when sealing
+const CliqueProposals = "CliqueProposals"
+
+func tablesCfg(defaultBuckets kv.TableCfg) kv.TableCfg {
+	cfg := kv.TableCfg{}
+	for name, item := range defaultBuckets {
+		cfg[name] = item
+	}
+	cfg[CliqueProposals] = kv.TableCfgItem{}
+	return cfg
+}
+
+// OpenDatabase opens clique database (snapshots and proposals)
+func OpenDatabase(path string, logger log.Logger, inmem bool) kv.RwDB {
+	opts := mdbx.NewMDBX(logger).WithTablessCfg(tablesCfg)
+	if inmem {
+		opts = opts.InMem()
+	} else {
+		opts = opts.Path(path)
+	}
+	return opts.MustOpen()
+}
+
+// OpenDatabaseShared opens clique database of running Erigon, for rpcdaemon to manage proposals
+// and store recovered snapshots
+func OpenDatabaseShared(path string, logger log.Logger) (kv.RwDB, error) {
+	return mdbx.NewMDBX(logger).Path(path).WithTablessCfg(tablesCfg).Flags(func(f uint) uint { return f | mdbx2.Accede }).Open()
+}
@@ -0,0 +1,47 @@
+package clique
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+)
+
+// Proposals are kept in clique database (CliqueProposals table), so they
+// survive restarts and can be changed by RPC daemon while Erigon is sealing.
+
+// Proposals returns the current proposals the node tries to uphold and vote on.
+func (c *Clique) Proposals() (map[common.Address]bool, error) {
+	proposals := make(map[common.Address]bool)
+	if err := c.db.View(context.Background(), func(tx kv.Tx) error {
+		return tx.ForEach(CliqueProposals, nil, func(k, v []byte) error {
+			if len(k) == common.AddressLength && len(v) == 1 {
+				proposals[common.BytesToAddress(k)] = v[0] == 1
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return proposals, nil
+}
+
+// Propose injects a new authorization proposal that the signer will attempt to
+// push through.
+func (c *Clique) Propose(address common.Address, auth bool) error {
+	v := []byte{0}
+	if auth {
+		v[0] = 1
+	}
+	return c.db.Update(context.Background(), func(tx kv.RwTx) error {
+		return tx.Put(CliqueProposals, address.Bytes(), v)
+	})
+}
+
+// Discard drops a currently running proposal, stopping the signer from casting
+// further votes (either for or against).
+func (c *Clique) Discard(address common.Address) error {
+	return c.db.Update(context.Background(), func(tx kv.RwTx) error {
+		return tx.Delete(CliqueProposals, address.Bytes(), nil)
+	})
+}
@@ -166,7 +166,7 @@ func (c *Clique) Snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 			break
 		}
 		// If an on-disk checkpoint snapshot can be found, use that
-		if number%c.snapshotConfig.CheckpointInterval == 0 {
+		if number%c.snapshotConfig.CheckpointInterval == 0 || number%c.config.Epoch == 0 {
 			if s, err := loadSnapshot(c.config, c.db, number, hash); err == nil {
 				log.Trace("Loaded voting snapshot from disk", "number", number, "hash", hash)
 				snap = s
@@ -180,17 +180,12 @@ func (c *Clique) Snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 		if number == 0 || (number%c.config.Epoch == 0 && (len(headers) > params.FullImmutabilityThreshold || chain.GetHeaderByNumber(number-1) == nil)) {
 			checkpoint := chain.GetHeaderByNumber(number)
 			if checkpoint != nil {
-				hash := checkpoint.Hash()
-
-				signers := make([]common.Address, (len(checkpoint.Extra)-ExtraVanity-ExtraSeal)/common.AddressLength)
-				for i := 0; i < len(signers); i++ {
-					copy(signers[i][:], checkpoint.Extra[ExtraVanity+i*common.AddressLength:])
-				}
-				snap = newSnapshot(c.config, number, hash, signers)
-				if err := snap.store(c.db); err != nil {
+				s, err := c.checkpointSnapshot(checkpoint)
+				if err != nil {
 					return nil, err
 				}
-				log.Info("[Clique] Stored checkpoint snapshot to disk", "number", number, "hash", hash)
+				snap = s
+				log.Info("[Clique] Stored checkpoint snapshot to disk", "number", number, "hash", snap.Hash)
 				break
 			}
 		}
@@ -276,3 +271,40 @@ func (c *Clique) verifySeal(chain consensus.ChainHeaderReader, header *types.Hea
 
 	return nil
 }
+
+// checkpointSnapshot creates and stores snapshot trusting signers list of the given epoch checkpoint header
+func (c *Clique) checkpointSnapshot(checkpoint *types.Header) (*Snapshot, error) {
+	signersBytes := len(checkpoint.Extra) - ExtraVanity - ExtraSeal
+	if signersBytes < 0 || signersBytes%common.AddressLength != 0 {
+		return nil, errInvalidCheckpointSigners
+	}
+	signers := make([]common.Address, signersBytes/common.AddressLength)
+	for i := 0; i < len(signers); i++ {
+		copy(signers[i][:], checkpoint.Extra[ExtraVanity+i*common.AddressLength:])
+	}
+	snap := newSnapshot(c.config, checkpoint.Number.Uint64(), checkpoint.Hash(), signers)
+	if err := snap.store(c.db); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// RecoverSnapshot rebuilds signers snapshot from the signers list of the canonical epoch checkpoint
+// header with the given number and stores it. Snapshots of later blocks are then derived from it,
+// without going back to genesis, which is useful when older snapshots were pruned or lost.
+func (c *Clique) RecoverSnapshot(chain consensus.ChainHeaderReader, number uint64) (*Snapshot, error) {
+	if number%c.config.Epoch != 0 {
+		return nil, fmt.Errorf("block %d is not an epoch checkpoint, epoch length is %d", number, c.config.Epoch)
+	}
+	checkpoint := chain.GetHeaderByNumber(number)
+	if checkpoint == nil {
+		return nil, errUnknownBlock
+	}
+	snap, err := c.checkpointSnapshot(checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	c.recents.Add(snap.Hash, snap)
+	log.Info("[Clique] Recovered snapshot from checkpoint", "number", number, "hash", snap.Hash, "signers", len(snap.Signers))
+	return snap, nil
+}
@@ -0,0 +1,52 @@
+package consensus
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// EngineConstructor - creates consensus engine registered via RegisterEngine. Engine-specific settings from the
+// chain config are in chainConfig.Engine (raw JSON), node settings (databases location) are in config.
+type EngineConstructor func(chainConfig *params.ChainConfig, config *params.ExternalConsensusConfig, logger log.Logger) (Engine, error)
+
+var builtinEngines = map[params.ConsensusType]struct{}{
+	params.AuRaConsensus:   {},
+	params.EtHashConsensus: {},
+	params.CliqueConsensus: {},
+	params.ParliaConsensus: {},
+	params.BorConsensus:    {},
+}
+
+var (
+	enginesLock sync.RWMutex
+	engines     = map[params.ConsensusType]EngineConstructor{}
+)
+
+// RegisterEngine - makes consensus engine available for chains which have given name in "consensus" field of chain
+// config. Applications embedding Erigon call it before node creation, usually from init(). Panics if the name is
+// empty, taken by built-in engine or already registered.
+func RegisterEngine(name params.ConsensusType, constructor EngineConstructor) {
+	if name == "" || constructor == nil {
+		panic("consensus: engine name and constructor are required")
+	}
+	if _, ok := builtinEngines[name]; ok {
+		panic(fmt.Sprintf("consensus: engine %q is built-in", name))
+	}
+	enginesLock.Lock()
+	defer enginesLock.Unlock()
+	if _, ok := engines[name]; ok {
+		panic(fmt.Sprintf("consensus: engine %q is already registered", name))
+	}
+	engines[name] = constructor
+}
+
+// LookupEngine - constructor of registered consensus engine, false if there is no engine with given name
+func LookupEngine(name params.ConsensusType) (EngineConstructor, bool) {
+	enginesLock.RLock()
+	defer enginesLock.RUnlock()
+	constructor, ok := engines[name]
+	return constructor, ok
+}
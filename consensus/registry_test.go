@@ -0,0 +1,50 @@
+package consensus_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+type testEngine struct {
+	consensus.Engine
+	period uint64
+	dbPath string
+}
+
+func TestRegisterEngine(t *testing.T) {
+	const name params.ConsensusType = "test-poa"
+	consensus.RegisterEngine(name, func(chainConfig *params.ChainConfig, config *params.ExternalConsensusConfig, logger log.Logger) (consensus.Engine, error) {
+		var settings struct {
+			Period uint64 `json:"period"`
+		}
+		if err := json.Unmarshal(chainConfig.Engine, &settings); err != nil {
+			return nil, err
+		}
+		return &testEngine{period: settings.Period, dbPath: config.DBPath}, nil
+	})
+	require.Panics(t, func() { consensus.RegisterEngine(name, nil) })
+	require.Panics(t, func() {
+		consensus.RegisterEngine(name, func(*params.ChainConfig, *params.ExternalConsensusConfig, log.Logger) (consensus.Engine, error) {
+			return nil, nil
+		})
+	})
+	require.Panics(t, func() {
+		consensus.RegisterEngine(params.CliqueConsensus, func(*params.ChainConfig, *params.ExternalConsensusConfig, log.Logger) (consensus.Engine, error) {
+			return nil, nil
+		})
+	})
+	_, ok := consensus.LookupEngine(params.EtHashConsensus)
+	require.False(t, ok)
+
+	var chainConfig params.ChainConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"chainId": 1337, "consensus": "test-poa", "engine": {"period": 5}}`), &chainConfig))
+	eng := ethconfig.CreateConsensusEngine(&chainConfig, log.New(), &params.ExternalConsensusConfig{DBPath: "/tmp/consensus"}, nil, false, common.Hash{})
+	require.Equal(t, &testEngine{period: 5, dbPath: "/tmp/consensus"}, eng)
+}
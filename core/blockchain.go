@@ -153,17 +153,17 @@ func ExecuteBlockEphemerally(
 	if chainConfig.IsByzantium(header.Number.Uint64()) && !vmConfig.NoReceipts {
 		receiptSha := types.DeriveSha(receipts)
 		if receiptSha != block.ReceiptHash() {
-			return nil, fmt.Errorf("mismatched receipt headers for block %d", block.NumberU64())
+			return nil, fmt.Errorf("%w for block %d", ErrReceiptsMismatch, block.NumberU64())
 		}
 	}
 
 	if *usedGas != header.GasUsed {
-		return nil, fmt.Errorf("gas used by execution: %d, in header: %d", *usedGas, header.GasUsed)
+		return nil, fmt.Errorf("%w: gas used by execution: %d, in header: %d", ErrGasUsedMismatch, *usedGas, header.GasUsed)
 	}
 	if !vmConfig.NoReceipts {
 		bloom := types.CreateBloom(receipts)
 		if bloom != header.Bloom {
-			return nil, fmt.Errorf("bloom computed by execution: %x, in header: %x", bloom, header.Bloom)
+			return nil, fmt.Errorf("%w: bloom computed by execution: %x, in header: %x", ErrBloomMismatch, bloom, header.Bloom)
 		}
 	}
 	if !vmConfig.ReadOnly {
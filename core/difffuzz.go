@@ -0,0 +1,167 @@
+//go:build difffuzz
+// +build difffuzz
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/debug"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/consensus"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// DiffConfigs - pair of interpreter configurations which must produce same execution result of every transaction.
+// By default: with skipping of jumpdest analysis (as Erigon runs on checked history) and without it.
+// Replace it to check other interpreter optimizations. ExtraEips don't fit here: they change shared jump tables in place.
+var DiffConfigs = func(config *params.ChainConfig, header *types.Header, cfg vm.Config) (optimized, reference vm.Config) {
+	optimized, reference = cfg, cfg
+	optimized.SkipAnalysis = SkipAnalysis(config, header.Number.Uint64())
+	reference.SkipAnalysis = false
+	reference.EnableTEMV = false
+	return optimized, reference
+}
+
+// DiffOutcome - everything which transaction execution produces and which must not depend on interpreter optimizations
+type DiffOutcome struct {
+	Error      string        `json:"error,omitempty"` // invalid transaction
+	UsedGas    uint64        `json:"usedGas"`
+	Failed     string        `json:"failed,omitempty"` // evm error
+	ReturnData hexutil.Bytes `json:"returnData"`
+	Logs       []*types.Log  `json:"logs"`
+	Writes     []string      `json:"writes"` // sorted state changes
+}
+
+// DiffCase - corpus entry: transaction and its diverging execution results
+type DiffCase struct {
+	BlockNumber uint64        `json:"blockNumber"`
+	BlockHash   common.Hash   `json:"blockHash"`
+	TxIndex     int           `json:"txIndex"`
+	TxHash      common.Hash   `json:"txHash"`
+	Tx          hexutil.Bytes `json:"tx"` // binary encoding
+	Optimized   *DiffOutcome  `json:"optimized"`
+	Reference   *DiffOutcome  `json:"reference"`
+}
+
+// diffCheckTransaction - executes transaction with both DiffConfigs on copies of state, before real execution.
+// Panics if results diverge, exports transaction to DIFFFUZZ_CORPUS_DIR before it if it's set.
+func diffCheckTransaction(config *params.ChainConfig, getHeader func(hash common.Hash, number uint64) *types.Header, engine consensus.Engine, author *common.Address, gp *GasPool, ibs *state.IntraBlockState, header *types.Header, tx types.Transaction, cfg vm.Config, contractHasTEVM func(contractHash common.Hash) (bool, error)) {
+	if tx.IsStarkNet() {
+		return
+	}
+	// tracers must see transaction only once
+	cfg.Debug, cfg.Tracer = false, nil
+	optimizedCfg, referenceCfg := DiffConfigs(config, header, cfg)
+	optimized := diffExecute(config, getHeader, engine, author, *gp, ibs, header, tx, optimizedCfg, contractHasTEVM)
+	reference := diffExecute(config, getHeader, engine, author, *gp, ibs, header, tx, referenceCfg, contractHasTEVM)
+	if reflect.DeepEqual(optimized, reference) {
+		return
+	}
+
+	msg := fmt.Sprintf("difffuzz: diverging execution of tx %x in block %d: optimized=%+v, reference=%+v", tx.Hash(), header.Number.Uint64(), optimized, reference)
+	if dir := debug.DiffFuzzCorpusDir(); dir != "" {
+		if err := exportDiffCase(dir, &DiffCase{
+			BlockNumber: header.Number.Uint64(),
+			BlockHash:   ibs.BlockHash(),
+			TxIndex:     ibs.TxIndex(),
+			TxHash:      tx.Hash(),
+			Optimized:   optimized,
+			Reference:   reference,
+		}, tx); err != nil {
+			panic(fmt.Sprintf("%s; export to %s: %v", msg, dir, err))
+		}
+		log.Warn("[difffuzz] diverging execution exported", "block", header.Number.Uint64(), "tx", tx.Hash(), "dir", dir)
+	}
+	panic(msg)
+}
+
+func diffExecute(config *params.ChainConfig, getHeader func(hash common.Hash, number uint64) *types.Header, engine consensus.Engine, author *common.Address, gp GasPool, ibs *state.IntraBlockState, header *types.Header, tx types.Transaction, cfg vm.Config, contractHasTEVM func(contractHash common.Hash) (bool, error)) *DiffOutcome {
+	outcome := &DiffOutcome{}
+	msg, err := tx.AsMessage(*types.MakeSigner(config, header.Number.Uint64()), header.BaseFee)
+	if err != nil {
+		outcome.Error = err.Error()
+		return outcome
+	}
+	statedb := ibs.Copy()
+	statedb.Prepare(tx.Hash(), ibs.BlockHash(), ibs.TxIndex())
+	evm := vm.NewEVM(NewEVMBlockContext(header, getHeader, engine, author, contractHasTEVM), NewEVMTxContext(msg), statedb, config, cfg)
+	result, err := ApplyMessage(evm, msg, &gp, true /* refunds */, false /* gasBailout */)
+	if err != nil {
+		outcome.Error = err.Error()
+		return outcome
+	}
+	outcome.UsedGas, outcome.ReturnData = result.UsedGas, result.ReturnData
+	if result.Err != nil {
+		outcome.Failed = result.Err.Error()
+	}
+	writes := &diffWritesRecorder{}
+	if err = statedb.FinalizeTx(evm.ChainRules(), writes); err != nil {
+		outcome.Error = err.Error()
+		return outcome
+	}
+	sort.Strings(writes.writes)
+	outcome.Writes = writes.writes
+	outcome.Logs = statedb.GetLogs(tx.Hash())
+	return outcome
+}
+
+func exportDiffCase(dir string, c *DiffCase, tx types.Transaction) error {
+	var buf bytes.Buffer
+	if err := tx.MarshalBinary(&buf); err != nil {
+		return err
+	}
+	c.Tx = buf.Bytes()
+	if err := os.MkdirAll(dir, 0744); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("%d_%x.json", c.BlockNumber, c.TxHash)), data, 0644)
+}
+
+// diffWritesRecorder - state writer which records changes in comparable form (FinalizeTx writes in map order)
+type diffWritesRecorder struct {
+	writes []string
+}
+
+func (w *diffWritesRecorder) UpdateAccountData(address common.Address, original, account *accounts.Account) error {
+	w.writes = append(w.writes, fmt.Sprintf("account %x nonce=%d balance=%s incarnation=%d codeHash=%x", address, account.Nonce, account.Balance.Hex(), account.Incarnation, account.CodeHash))
+	return nil
+}
+
+func (w *diffWritesRecorder) UpdateAccountCode(address common.Address, incarnation uint64, codeHash common.Hash, code []byte) error {
+	w.writes = append(w.writes, fmt.Sprintf("code %x incarnation=%d codeHash=%x", address, incarnation, codeHash))
+	return nil
+}
+
+func (w *diffWritesRecorder) DeleteAccount(address common.Address, original *accounts.Account) error {
+	w.writes = append(w.writes, fmt.Sprintf("delete %x", address))
+	return nil
+}
+
+func (w *diffWritesRecorder) WriteAccountStorage(address common.Address, incarnation uint64, key *common.Hash, original, value *uint256.Int) error {
+	w.writes = append(w.writes, fmt.Sprintf("storage %x incarnation=%d key=%x value=%s", address, incarnation, *key, value.Hex()))
+	return nil
+}
+
+func (w *diffWritesRecorder) CreateContract(address common.Address) error {
+	w.writes = append(w.writes, fmt.Sprintf("create %x", address))
+	return nil
+}
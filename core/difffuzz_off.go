@@ -0,0 +1,17 @@
+//go:build !difffuzz
+// +build !difffuzz
+
+package core
+
+import (
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/params"
+)
+
+// diffCheckTransaction - no-op, differential execution is enabled by `difffuzz` build tag (see difffuzz.go)
+func diffCheckTransaction(*params.ChainConfig, func(common.Hash, uint64) *types.Header, consensus.Engine, *common.Address, *GasPool, *state.IntraBlockState, *types.Header, types.Transaction, vm.Config, func(common.Hash) (bool, error)) {
+}
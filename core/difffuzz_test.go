@@ -0,0 +1,93 @@
+//go:build difffuzz
+// +build difffuzz
+
+package core_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffFuzzCorpus(t *testing.T) {
+	corpus := t.TempDir()
+	require.NoError(t, os.Setenv("DIFFFUZZ_CORPUS_DIR", corpus))
+	defer os.Unsetenv("DIFFFUZZ_CORPUS_DIR")
+
+	key, _ := crypto.GenerateKey()
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	caller, callee := common.HexToAddress("0x7000"), common.HexToAddress("0x7001")
+	config := *params.TestChainConfig
+	gspec := &core.Genesis{Config: &config, Alloc: core.GenesisAlloc{
+		sender: {Balance: big.NewInt(params.Ether)},
+		// CALL(gas, 0x7001, 0, 0, 0, 0, 0)
+		caller: {Balance: big.NewInt(0), Code: []byte{0x60, 0x00, 0x60, 0x00, 0x60, 0x00, 0x60, 0x00, 0x60, 0x00, 0x61, 0x70, 0x01, 0x5a, 0xf1, 0x00}},
+		// SSTORE(0, 1)
+		callee: {Balance: big.NewInt(0), Code: []byte{0x60, 0x01, 0x60, 0x00, 0x55, 0x00}},
+	}}
+	m := stages.MockWithGenesis(t, gspec, key)
+	signer := types.LatestSigner(&config)
+
+	var callTx, transferTx types.Transaction
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 1, func(i int, b *core.BlockGen) {
+		var err error
+		transferTx, err = types.SignTx(types.NewTransaction(0, common.Address{1}, uint256.NewInt(1), params.TxGas, uint256.NewInt(1), nil), *signer, key)
+		require.NoError(t, err)
+		b.AddTx(transferTx)
+		callTx, err = types.SignTx(types.NewTransaction(1, caller, uint256.NewInt(0), 100_000, uint256.NewInt(1), nil), *signer, key)
+		require.NoError(t, err)
+		b.AddTx(callTx)
+	}, false)
+	require.NoError(t, err)
+
+	// reference interpreter doesn't execute nested calls: divergence is exported and stops execution
+	defaultDiffConfigs := core.DiffConfigs
+	core.DiffConfigs = func(config *params.ChainConfig, header *types.Header, cfg vm.Config) (vm.Config, vm.Config) {
+		optimized, reference := defaultDiffConfigs(config, header, cfg)
+		reference.NoRecursion = true
+		return optimized, reference
+	}
+	defer func() { core.DiffConfigs = defaultDiffConfigs }()
+	err = m.InsertChain(chain) // stage loop turns the panic into error
+	require.ErrorContains(t, err, fmt.Sprintf("difffuzz: diverging execution of tx %x in block 1", callTx.Hash()))
+
+	files, err := ioutil.ReadDir(corpus)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := ioutil.ReadFile(filepath.Join(corpus, files[0].Name()))
+	require.NoError(t, err)
+	var c core.DiffCase
+	require.NoError(t, json.Unmarshal(data, &c))
+	require.Equal(t, callTx.Hash(), c.TxHash)
+	require.Equal(t, uint64(1), c.BlockNumber)
+	require.Equal(t, 1, c.TxIndex)
+	require.Greater(t, c.Optimized.UsedGas, c.Reference.UsedGas)
+	hasStorage := func(writes []string) bool {
+		for _, w := range writes {
+			if strings.HasPrefix(w, fmt.Sprintf("storage %x", callee)) {
+				return true
+			}
+		}
+		return false
+	}
+	require.True(t, hasStorage(c.Optimized.Writes))
+	require.False(t, hasStorage(c.Reference.Writes))
+	decoded, err := types.UnmarshalTransactionFromBinary(c.Tx)
+	require.NoError(t, err)
+	require.Equal(t, callTx.Hash(), decoded.Hash())
+}
@@ -43,6 +43,18 @@ var (
 	// ErrFeeCapVeryHigh is a sanity error to avoid extremely big numbers specified
 	// in the fee cap field.
 	ErrFeeCapVeryHigh = errors.New("fee cap higher than 2^256-1")
+
+	// ErrReceiptsMismatch is returned by block execution if root of receipts
+	// differs from the header.
+	ErrReceiptsMismatch = errors.New("mismatched receipt headers")
+
+	// ErrGasUsedMismatch is returned by block execution if gas used by
+	// transactions differs from the header.
+	ErrGasUsedMismatch = errors.New("mismatched gas used")
+
+	// ErrBloomMismatch is returned by block execution if bloom of receipts
+	// differs from the header.
+	ErrBloomMismatch = errors.New("mismatched bloom")
 )
 
 // List of evm-call-message pre-checking errors. All state transition messages will
@@ -92,3 +104,19 @@ var (
 	// See EIP-3607: Reject transactions from senders with deployed code.
 	ErrSenderNoEOA = errors.New("sender not an eoa")
 )
+
+// IsBlockValidationError - err means the block is invalid: header doesn't match execution or a transaction can't be
+// applied. Other errors (DB reads, cancellation) say nothing about the block.
+func IsBlockValidationError(err error) bool {
+	for _, target := range []error{
+		ErrReceiptsMismatch, ErrGasUsedMismatch, ErrBloomMismatch,
+		ErrNonceTooLow, ErrNonceTooHigh, ErrNonceMax, ErrGasLimitReached, ErrInsufficientFunds, ErrGasUintOverflow,
+		ErrIntrinsicGas, ErrTxTypeNotSupported, ErrFeeCapTooLow, ErrSenderNoEOA, ErrTipAboveFeeCap, ErrTipVeryHigh,
+		ErrFeeCapVeryHigh, types.ErrInvalidSig, types.ErrInvalidChainId,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -75,6 +75,8 @@ type Genesis struct {
 	GasUsed    uint64      `json:"gasUsed"`
 	ParentHash common.Hash `json:"parentHash"`
 	BaseFee    *big.Int    `json:"baseFee"`
+
+	allocStream *genesisAllocStream // instead of Alloc, see ReadGenesisJSON
 }
 
 // GenesisAlloc specifies the initial state that is part of the genesis block.
@@ -317,46 +319,50 @@ func (g *Genesis) configOrDefault(ghash common.Hash) *params.ChainConfig {
 func (g *Genesis) ToBlock() (*types.Block, *state.IntraBlockState, error) {
 	var root common.Hash
 	var statedb *state.IntraBlockState
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	go func() { // we may run inside write tx, can't open 2nd write tx in same goroutine
-		defer wg.Done()
-		tmpDB := mdbx.NewMDBX(log.New()).InMem().MustOpen()
-		defer tmpDB.Close()
-		tx, err := tmpDB.BeginRw(context.Background())
-		if err != nil {
-			panic(err)
-		}
-		defer tx.Rollback()
-		r, w := state.NewDbStateReader(tx), state.NewDbStateWriter(tx, 0)
-		statedb = state.New(r)
-		for addr, account := range g.Alloc {
-			balance, overflow := uint256.FromBig(account.Balance)
-			if overflow {
-				panic("overflow at genesis allocs")
+	if g.allocStream != nil {
+		root = g.allocStream.root // statedb stays nil, alloc is written from the stream
+	} else {
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		go func() { // we may run inside write tx, can't open 2nd write tx in same goroutine
+			defer wg.Done()
+			tmpDB := mdbx.NewMDBX(log.New()).InMem().MustOpen()
+			defer tmpDB.Close()
+			tx, err := tmpDB.BeginRw(context.Background())
+			if err != nil {
+				panic(err)
 			}
-			statedb.AddBalance(addr, balance)
-			statedb.SetCode(addr, account.Code)
-			statedb.SetNonce(addr, account.Nonce)
-			for key, value := range account.Storage {
-				key := key
-				val := uint256.NewInt(0).SetBytes(value.Bytes())
-				statedb.SetState(addr, &key, *val)
+			defer tx.Rollback()
+			r, w := state.NewDbStateReader(tx), state.NewDbStateWriter(tx, 0)
+			statedb = state.New(r)
+			for addr, account := range g.Alloc {
+				balance, overflow := uint256.FromBig(account.Balance)
+				if overflow {
+					panic("overflow at genesis allocs")
+				}
+				statedb.AddBalance(addr, balance)
+				statedb.SetCode(addr, account.Code)
+				statedb.SetNonce(addr, account.Nonce)
+				for key, value := range account.Storage {
+					key := key
+					val := uint256.NewInt(0).SetBytes(value.Bytes())
+					statedb.SetState(addr, &key, *val)
+				}
+
+				if len(account.Code) > 0 || len(account.Storage) > 0 {
+					statedb.SetIncarnation(addr, 1)
+				}
 			}
-
-			if len(account.Code) > 0 || len(account.Storage) > 0 {
-				statedb.SetIncarnation(addr, 1)
+			if err := statedb.FinalizeTx(params.Rules{}, w); err != nil {
+				panic(err)
 			}
-		}
-		if err := statedb.FinalizeTx(params.Rules{}, w); err != nil {
-			panic(err)
-		}
-		root, err = trie.CalcRoot("genesis", tx)
-		if err != nil {
-			panic(err)
-		}
-	}()
-	wg.Wait()
+			root, err = trie.CalcRoot("genesis", tx)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		wg.Wait()
+	}
 	decodeSeal := func(in []byte) (seal []rlp.RawValue) {
 		if len(in) == 0 {
 			return nil
@@ -421,6 +427,12 @@ func (g *Genesis) WriteGenesisState(tx kv.RwTx) (*types.Block, *state.IntraBlock
 	if block.Number().Sign() != 0 {
 		return nil, statedb, fmt.Errorf("can't commit genesis block with number > 0")
 	}
+	if g.allocStream != nil {
+		if err := g.allocStream.write(tx); err != nil {
+			return nil, nil, fmt.Errorf("cannot write state: %w", err)
+		}
+		return block, nil, nil
+	}
 
 	blockWriter := state.NewPlainStateWriter(tx, tx, 0)
 
@@ -488,6 +500,9 @@ func (g *Genesis) Write(tx kv.RwTx) (*types.Block, *state.IntraBlockState, error
 	for _, account := range g.Alloc {
 		genesisIssuance.Add(genesisIssuance, account.Balance)
 	}
+	if g.allocStream != nil {
+		genesisIssuance.Add(genesisIssuance, g.allocStream.issuance)
+	}
 
 	// BlockReward can be present at genesis
 	if block.Header().Difficulty.Cmp(serenity.SerenityDifficulty) == 0 {
@@ -0,0 +1,296 @@
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/etl"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/turbo/trie"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// genesisAllocStream - alloc of genesis which was read from JSON without keeping it in memory: plain state is sorted by
+// ETL collectors, state root is calculated from hashed state in temporary database
+type genesisAllocStream struct {
+	root     common.Hash
+	issuance *big.Int
+	accounts uint64
+
+	plainState        *etl.Collector
+	plainContractCode *etl.Collector
+	code              *etl.Collector
+	incarnations      *etl.Collector
+	written           bool
+}
+
+// ReadGenesisJSON - decodes genesis JSON, accounts of "alloc" are streamed through ETL collectors in tmpdir, so
+// genesis with millions of prefunded accounts doesn't have to fit into memory. Returned genesis is written by
+// CommitGenesisBlock only once, Close releases temporary files.
+func ReadGenesisJSON(r io.Reader, tmpdir string) (*Genesis, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	var stream *genesisAllocStream
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := t.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected token %v", t)
+		}
+		if key != "alloc" {
+			var v json.RawMessage
+			if err = dec.Decode(&v); err != nil {
+				return nil, fmt.Errorf("field %s: %w", key, err)
+			}
+			fields[key] = v
+			continue
+		}
+		if stream != nil {
+			stream.close()
+			return nil, errors.New("duplicate field alloc")
+		}
+		if stream, err = readGenesisAlloc(dec, tmpdir); err != nil {
+			return nil, err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		if stream != nil {
+			stream.close()
+		}
+		return nil, err
+	}
+	if stream == nil {
+		return nil, errors.New("missing required field 'alloc' for Genesis")
+	}
+
+	// the rest of fields is small, decode them as usual with empty alloc
+	fields["alloc"] = json.RawMessage("{}")
+	data, err := json.Marshal(fields)
+	if err != nil {
+		stream.close()
+		return nil, err
+	}
+	genesis := new(Genesis)
+	if err = json.Unmarshal(data, genesis); err != nil {
+		stream.close()
+		return nil, err
+	}
+	genesis.allocStream = stream
+	return genesis, nil
+}
+
+// Close - removes temporary files of alloc read by ReadGenesisJSON
+func (g *Genesis) Close() {
+	if g.allocStream != nil {
+		g.allocStream.close()
+	}
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := t.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("expected %v, got %v", delim, t)
+	}
+	return nil
+}
+
+func readGenesisAlloc(dec *json.Decoder, tmpdir string) (*genesisAllocStream, error) {
+	newCollector := func() *etl.Collector {
+		return etl.NewCollector("Genesis", tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize/4))
+	}
+	s := &genesisAllocStream{
+		issuance:          new(big.Int),
+		plainState:        newCollector(),
+		plainContractCode: newCollector(),
+		code:              etl.NewCollector("Genesis", tmpdir, etl.NewOldestEntryBuffer(etl.BufferOptimalSize/4)), // same code in many accounts
+		incarnations:      newCollector(),
+	}
+	hashedAccounts, hashedStorage := newCollector(), newCollector()
+	defer hashedAccounts.Close()
+	defer hashedStorage.Close()
+
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	err := func() error {
+		if err := expectDelim(dec, '{'); err != nil {
+			return err
+		}
+		for dec.More() {
+			t, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key, ok := t.(string)
+			if !ok {
+				return fmt.Errorf("alloc: unexpected token %v", t)
+			}
+			var addr common.UnprefixedAddress
+			if err = addr.UnmarshalText([]byte(key)); err != nil {
+				return fmt.Errorf("alloc: %w", err)
+			}
+			var account GenesisAccount
+			if err = dec.Decode(&account); err != nil {
+				return fmt.Errorf("alloc %s: %w", key, err)
+			}
+			if err = s.collect(common.Address(addr), &account, hashedAccounts, hashedStorage); err != nil {
+				return err
+			}
+			select {
+			case <-logEvery.C:
+				log.Info("Reading genesis alloc", "accounts", s.accounts)
+			default:
+			}
+		}
+		if err := expectDelim(dec, '}'); err != nil {
+			return err
+		}
+		log.Info("Calculating genesis state root", "accounts", s.accounts)
+		var err error
+		s.root, err = calcGenesisRoot(tmpdir, hashedAccounts, hashedStorage)
+		return err
+	}()
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// collect - puts account into collectors as state.PlainStateWriter and state.DbStateWriter write it
+func (s *genesisAllocStream) collect(addr common.Address, account *GenesisAccount, hashedAccounts, hashedStorage *etl.Collector) error {
+	balance, overflow := uint256.FromBig(account.Balance)
+	if overflow {
+		return fmt.Errorf("overflow at genesis alloc %x", addr)
+	}
+	acc := accounts.NewAccount()
+	acc.Balance = *balance
+	acc.Nonce = account.Nonce
+	if len(account.Code) > 0 || len(account.Storage) > 0 {
+		acc.Incarnation = state.FirstContractIncarnation
+	}
+	if len(account.Code) > 0 {
+		acc.CodeHash = crypto.Keccak256Hash(account.Code)
+		if err := s.code.Collect(acc.CodeHash[:], account.Code); err != nil {
+			return err
+		}
+		if err := s.plainContractCode.Collect(dbutils.PlainGenerateStoragePrefix(addr[:], acc.Incarnation), acc.CodeHash[:]); err != nil {
+			return err
+		}
+	} else if len(account.Storage) > 0 {
+		// Special case for weird tests - inaccessible storage
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], state.FirstContractIncarnation)
+		if err := s.incarnations.Collect(addr[:], b[:]); err != nil {
+			return err
+		}
+	}
+	value := make([]byte, acc.EncodingLengthForStorage())
+	acc.EncodeForStorage(value)
+	if err := s.plainState.Collect(addr[:], value); err != nil {
+		return err
+	}
+	addrHash := crypto.Keccak256Hash(addr[:])
+	if err := hashedAccounts.Collect(addrHash[:], value); err != nil {
+		return err
+	}
+	for key, val := range account.Storage {
+		v := uint256.NewInt(0).SetBytes(val.Bytes()).Bytes()
+		if len(v) == 0 {
+			continue
+		}
+		key := key
+		if err := s.plainState.Collect(dbutils.PlainGenerateCompositeStorageKey(addr[:], acc.Incarnation, key[:]), v); err != nil {
+			return err
+		}
+		seckey := crypto.Keccak256Hash(key[:])
+		if err := hashedStorage.Collect(dbutils.GenerateCompositeStorageKey(addrHash, acc.Incarnation, seckey), v); err != nil {
+			return err
+		}
+	}
+	s.issuance.Add(s.issuance, account.Balance)
+	s.accounts++
+	return nil
+}
+
+// calcGenesisRoot - loads hashed state into temporary database in tmpdir and calculates its root
+func calcGenesisRoot(tmpdir string, hashedAccounts, hashedStorage *etl.Collector) (common.Hash, error) {
+	dir, err := ioutil.TempDir(tmpdir, "genesis")
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer os.RemoveAll(dir)
+	db, err := mdbx.NewMDBX(log.New()).Path(dir).Open()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer db.Close()
+	var root common.Hash
+	if err = db.Update(context.Background(), func(tx kv.RwTx) error {
+		if err := hashedAccounts.Load(tx, kv.HashedAccounts, etl.IdentityLoadFunc, etl.TransformArgs{}); err != nil {
+			return err
+		}
+		if err := hashedStorage.Load(tx, kv.HashedStorage, etl.IdentityLoadFunc, etl.TransformArgs{}); err != nil {
+			return err
+		}
+		root, err = trie.CalcRoot("genesis", tx)
+		return err
+	}); err != nil {
+		return common.Hash{}, err
+	}
+	return root, nil
+}
+
+// write - loads plain state of alloc into tx. Unlike alloc in memory, no change sets are written for block 0: state
+// before genesis is empty and never read
+func (s *genesisAllocStream) write(tx kv.RwTx) error {
+	if s.written {
+		return errors.New("genesis alloc read from JSON can be written only once")
+	}
+	s.written = true
+	for _, c := range []struct {
+		collector *etl.Collector
+		table     string
+	}{
+		{s.plainState, kv.PlainState},
+		{s.plainContractCode, kv.PlainContractCode},
+		{s.code, kv.Code},
+		{s.incarnations, kv.IncarnationMap},
+	} {
+		if err := c.collector.Load(tx, c.table, etl.IdentityLoadFunc, etl.TransformArgs{}); err != nil {
+			return err
+		}
+	}
+	log.Info("Wrote genesis alloc", "accounts", s.accounts)
+	return nil
+}
+
+func (s *genesisAllocStream) close() {
+	s.plainState.Close()
+	s.plainContractCode.Close()
+	s.code.Close()
+	s.incarnations.Close()
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadGenesisJSON(t *testing.T) {
+	code := []byte{0x60, 0x01, 0x60, 0x00, 0x55} // same code in two accounts
+	genesis := &Genesis{
+		Config:     params.TestChainConfig,
+		GasLimit:   8_000_000,
+		Difficulty: big.NewInt(1),
+		Alloc: GenesisAlloc{
+			common.HexToAddress("0x01"): {Balance: big.NewInt(1)},
+			common.HexToAddress("0x02"): {Balance: big.NewInt(2), Nonce: 3, Code: code},
+			common.HexToAddress("0x03"): {Balance: big.NewInt(0), Code: code, Storage: map[common.Hash]common.Hash{
+				common.HexToHash("0x01"): common.HexToHash("0x0102"),
+				common.HexToHash("0x02"): {},
+			}},
+			common.HexToAddress("0x04"): {Balance: big.NewInt(4), Storage: map[common.Hash]common.Hash{
+				common.HexToHash("0x03"): common.HexToHash("0x03"),
+			}},
+		},
+	}
+	for i := 0; i < 100; i++ {
+		genesis.Alloc[common.BigToAddress(big.NewInt(int64(1000+i)))] = GenesisAccount{Balance: big.NewInt(int64(i))}
+	}
+	data, err := json.Marshal(genesis)
+	require.NoError(t, err)
+
+	streamed, err := ReadGenesisJSON(bytes.NewReader(data), t.TempDir())
+	require.NoError(t, err)
+	defer streamed.Close()
+	require.Empty(t, streamed.Alloc)
+	require.Equal(t, genesis.GasLimit, streamed.GasLimit)
+
+	db1, db2 := memdb.NewTestDB(t), memdb.NewTestDB(t)
+	_, block1, err := CommitGenesisBlock(db1, genesis)
+	require.NoError(t, err)
+	_, block2, err := CommitGenesisBlock(db2, streamed)
+	require.NoError(t, err)
+	require.Equal(t, block1.Hash(), block2.Hash())
+
+	// genesis is already written, only its hash is compared
+	_, _, err = CommitGenesisBlock(db2, streamed)
+	require.NoError(t, err)
+
+	dump := func(db kv.RoDB) (res []string) {
+		require.NoError(t, db.View(context.Background(), func(tx kv.Tx) error {
+			for _, table := range []string{kv.PlainState, kv.PlainContractCode, kv.Code, kv.IncarnationMap, kv.Issuance} {
+				if err := tx.ForEach(table, nil, func(k, v []byte) error {
+					res = append(res, fmt.Sprintf("%s %x %x", table, k, v))
+					return nil
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+		return res
+	}
+	require.Equal(t, dump(db1), dump(db2))
+
+	_, err = ReadGenesisJSON(bytes.NewReader([]byte(`{"gasLimit": "0x1"}`)), t.TempDir())
+	require.Error(t, err)
+}
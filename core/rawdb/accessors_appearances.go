@@ -0,0 +1,18 @@
+package rawdb
+
+// appearanceTxBits - bits of transaction index in AppearanceID, the rest is block number
+const appearanceTxBits = 24
+
+// MaxAppearanceTxIndex - transactions with higher index can't be encoded into AppearanceID
+const MaxAppearanceTxIndex = 1<<appearanceTxBits - 1
+
+// AppearanceID - appearance of address in transaction, as value of AppearanceIndex bitmap.
+// Ids are ordered by block number and then by transaction index.
+func AppearanceID(blockNum uint64, txIndex uint32) uint64 {
+	return blockNum<<appearanceTxBits | uint64(txIndex)
+}
+
+// SplitAppearanceID - block number and transaction index of AppearanceID
+func SplitAppearanceID(id uint64) (blockNum uint64, txIndex uint32) {
+	return id >> appearanceTxBits, uint32(id & MaxAppearanceTxIndex)
+}
@@ -266,6 +266,15 @@ func ReadStorageBodyRLP(db kv.Getter, hash common.Hash, number uint64) rlp.RawVa
 	if err != nil {
 		log.Error("ReadBodyRLP failed", "err", err)
 	}
+	if len(bodyRlp) == 0 {
+		if _, err = viewCold(db, number, func(tx kv.Tx) error {
+			v, err := tx.GetOne(kv.BlockBody, dbutils.BlockBodyKey(number, hash))
+			bodyRlp = common.CopyBytes(v)
+			return err
+		}); err != nil {
+			log.Error("ReadBodyRLP failed", "err", err)
+		}
+	}
 	return bodyRlp
 }
 
@@ -280,7 +289,7 @@ func CanonicalTransactions(db kv.Getter, baseTxId uint64, amount uint32) ([]type
 	binary.BigEndian.PutUint64(txIdKey, baseTxId)
 	i := uint32(0)
 
-	if err := db.ForAmount(kv.EthTx, txIdKey, amount, func(k, v []byte) error {
+	walker := func(k, v []byte) error {
 		var decodeErr error
 		reader.Reset(v)
 		stream.Reset(reader, 0)
@@ -289,7 +298,21 @@ func CanonicalTransactions(db kv.Getter, baseTxId uint64, amount uint32) ([]type
 		}
 		i++
 		return nil
-	}); err != nil {
+	}
+	// transactions of moved blocks
+	if _, ok := db.(ColdTx); ok {
+		if has, err := db.Has(kv.EthTx, txIdKey); err != nil {
+			return nil, err
+		} else if !has {
+			if _, err := viewCold(db, 0, func(tx kv.Tx) error {
+				return tx.ForAmount(kv.EthTx, txIdKey, amount, walker)
+			}); err != nil {
+				return nil, err
+			}
+			return txs[:i], nil
+		}
+	}
+	if err := db.ForAmount(kv.EthTx, txIdKey, amount, walker); err != nil {
 		return nil, err
 	}
 	txs = txs[:i] // user may request big "amount", but db can return small "amount". Return as much as we found.
@@ -722,35 +745,61 @@ func DeleteTd(db kv.Deleter, hash common.Hash, number uint64) error {
 // HasReceipts verifies the existence of all the transaction receipts belonging
 // to a block.
 func HasReceipts(db kv.Has, hash common.Hash, number uint64) bool {
-	if has, err := db.Has(kv.Receipts, dbutils.EncodeBlockNumber(number)); !has || err != nil {
+	if has, err := db.Has(kv.Receipts, dbutils.EncodeBlockNumber(number)); has && err == nil {
+		return true
+	}
+	var has bool
+	if _, err := viewCold(db, number, func(tx kv.Tx) (err error) {
+		has, err = tx.Has(kv.Receipts, dbutils.EncodeBlockNumber(number))
+		return err
+	}); err != nil {
 		return false
 	}
-	return true
+	return has
 }
 
 // ReadRawReceipts retrieves all the transaction receipts belonging to a block.
 // The receipt metadata fields are not guaranteed to be populated, so they
 // should not be used. Use ReadReceipts instead if the metadata is needed.
 func ReadRawReceipts(db kv.Tx, blockNum uint64) types.Receipts {
+	receipts, found := readRawReceipts(db, db, blockNum)
+	if found {
+		return receipts
+	}
+	if _, err := viewCold(db, blockNum, func(tx kv.Tx) error {
+		receipts, _ = readRawReceipts(tx, db, blockNum)
+		return nil
+	}); err != nil {
+		log.Error("ReadRawReceipts failed", "err", err)
+	}
+	return receipts
+}
+
+// readRawReceipts - receipts of the block in db, dictionaries of compressed values are read from dicts
+func readRawReceipts(db kv.Getter, dicts kv.Getter, blockNum uint64) (types.Receipts, bool) {
 	// Retrieve the flattened receipt slice
 	data, err := db.GetOne(kv.Receipts, dbutils.EncodeBlockNumber(blockNum))
 	if err != nil {
 		log.Error("ReadRawReceipts failed", "err", err)
 	}
 	if len(data) == 0 {
-		return nil
+		return nil, false
+	}
+	if data, err = DecodeReceiptsValue(dicts, data); err != nil {
+		log.Error("receipt decompression failed", "err", err)
+		return nil, true
 	}
 	var receipts types.Receipts
 	if err := cbor.Unmarshal(&receipts, bytes.NewReader(data)); err != nil {
 		log.Error("receipt unmarshal failed", "err", err)
-		return nil
+		return nil, true
 	}
 
 	prefix := make([]byte, 8)
 	binary.BigEndian.PutUint64(prefix, blockNum)
 	if err := db.ForPrefix(kv.Log, prefix, func(k, v []byte) error {
-		var logs types.Logs
-		if err := cbor.Unmarshal(&logs, bytes.NewReader(v)); err != nil {
+		logs, err := UnmarshalLogs(dicts, v)
+		if err != nil {
 			return fmt.Errorf("receipt unmarshal failed:  %w", err)
 		}
 
@@ -758,10 +807,10 @@ func ReadRawReceipts(db kv.Tx, blockNum uint64) types.Receipts {
 		return nil
 	}); err != nil {
 		log.Error("logs fetching failed", "err", err)
-		return nil
+		return nil, true
 	}
 
-	return receipts
+	return receipts, true
 }
 
 // ReadReceipts retrieves all the transaction receipts belonging to a block, including
@@ -812,7 +861,7 @@ func ReadReceiptsByHash(db kv.Tx, hash common.Hash) (types.Receipts, error) {
 }
 
 // WriteReceipts stores all the transaction receipts belonging to a block.
-func WriteReceipts(tx kv.Putter, number uint64, receipts types.Receipts) error {
+func WriteReceipts(tx kv.RwTx, number uint64, receipts types.Receipts) error {
 	buf := bytes.NewBuffer(make([]byte, 0, 1024))
 	for txId, r := range receipts {
 		if len(r.Logs) == 0 {
@@ -825,7 +874,11 @@ func WriteReceipts(tx kv.Putter, number uint64, receipts types.Receipts) error {
 			return fmt.Errorf("encode block logs for block %d: %w", number, err)
 		}
 
-		if err = tx.Put(kv.Log, dbutils.LogKey(number, uint32(txId)), buf.Bytes()); err != nil {
+		v, err := EncodeReceiptsValue(tx, number, buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("compress block logs for block %d: %w", number, err)
+		}
+		if err = tx.Put(kv.Log, dbutils.LogKey(number, uint32(txId)), v); err != nil {
 			return fmt.Errorf("writing logs for block %d: %w", number, err)
 		}
 	}
@@ -836,7 +889,11 @@ func WriteReceipts(tx kv.Putter, number uint64, receipts types.Receipts) error {
 		return fmt.Errorf("encode block receipts for block %d: %w", number, err)
 	}
 
-	if err = tx.Put(kv.Receipts, dbutils.EncodeBlockNumber(number), buf.Bytes()); err != nil {
+	v, err := EncodeReceiptsValue(tx, number, buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("compress block receipts for block %d: %w", number, err)
+	}
+	if err = tx.Put(kv.Receipts, dbutils.EncodeBlockNumber(number), v); err != nil {
 		return fmt.Errorf("writing receipts for block %d: %w", number, err)
 	}
 	return nil
@@ -857,7 +914,11 @@ func AppendReceipts(tx kv.RwTx, blockNumber uint64, receipts types.Receipts) err
 			return fmt.Errorf("encode block receipts for block %d: %w", blockNumber, err)
 		}
 
-		if err = tx.Append(kv.Log, dbutils.LogKey(blockNumber, uint32(txId)), buf.Bytes()); err != nil {
+		v, err := EncodeReceiptsValue(tx, blockNumber, buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("compress block receipts for block %d: %w", blockNumber, err)
+		}
+		if err = tx.Append(kv.Log, dbutils.LogKey(blockNumber, uint32(txId)), v); err != nil {
 			return fmt.Errorf("writing receipts for block %d: %w", blockNumber, err)
 		}
 	}
@@ -868,7 +929,11 @@ func AppendReceipts(tx kv.RwTx, blockNumber uint64, receipts types.Receipts) err
 		return fmt.Errorf("encode block receipts for block %d: %w", blockNumber, err)
 	}
 
-	if err = tx.Append(kv.Receipts, dbutils.EncodeBlockNumber(blockNumber), buf.Bytes()); err != nil {
+	v, err := EncodeReceiptsValue(tx, blockNumber, buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("compress block receipts for block %d: %w", blockNumber, err)
+	}
+	if err = tx.Append(kv.Receipts, dbutils.EncodeBlockNumber(blockNumber), v); err != nil {
 		return fmt.Errorf("writing receipts for block %d: %w", blockNumber, err)
 	}
 	return nil
@@ -909,6 +974,20 @@ func DeleteNewerReceipts(db kv.RwTx, number uint64) error {
 }
 
 func ReceiptsAvailableFrom(tx kv.Tx) (uint64, error) {
+	from := uint64(math.MaxUint64)
+	if _, err := viewCold(tx, 0, func(coldTx kv.Tx) (err error) {
+		from, err = receiptsAvailableFrom(coldTx)
+		return err
+	}); err != nil {
+		return math.MaxUint64, err
+	}
+	if from != math.MaxUint64 {
+		return from, nil
+	}
+	return receiptsAvailableFrom(tx)
+}
+
+func receiptsAvailableFrom(tx kv.Tx) (uint64, error) {
 	c, err := tx.Cursor(kv.Receipts)
 	if err != nil {
 		return math.MaxUint64, err
@@ -1132,9 +1211,11 @@ func ReadAncestor(db kv.Getter, hash common.Hash, number, ancestor uint64, maxNo
 	return hash, number
 }
 
+// DeleteNewerEpochs - removes epoch transitions and pending (signalled, but not finalized yet) transitions
+// of blocks starting from given number, so AuRa doesn't see validator set changes of unwound blocks
 func DeleteNewerEpochs(tx kv.RwTx, number uint64) error {
 	if err := tx.ForEach(kv.PendingEpoch, dbutils.EncodeBlockNumber(number), func(k, v []byte) error {
-		return tx.Delete(kv.Epoch, k, nil)
+		return tx.Delete(kv.PendingEpoch, k, nil)
 	}); err != nil {
 		return err
 	}
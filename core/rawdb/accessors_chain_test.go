@@ -437,3 +437,27 @@ func checkReceiptsRLP(have, want types.Receipts) error {
 	}
 	return nil
 }
+
+func TestDeleteNewerEpochs(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+
+	for i := uint64(1); i <= 3; i++ {
+		hash := common.Hash{byte(i)}
+		require.NoError(t, WriteEpoch(tx, i*10, hash, []byte{byte(i)}))
+		require.NoError(t, WritePendingEpoch(tx, i*10-1, hash, []byte{byte(i)}))
+	}
+	require.NoError(t, DeleteNewerEpochs(tx, 20))
+
+	num, hash, proof, err := FindEpochBeforeOrEqualNumber(tx, 100)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), num)
+	require.Equal(t, common.Hash{1}, hash)
+	require.Equal(t, []byte{1}, proof)
+
+	proof, err = ReadPendingEpoch(tx, 19, common.Hash{2})
+	require.NoError(t, err)
+	require.Equal(t, []byte{2}, proof)
+	proof, err = ReadPendingEpoch(tx, 29, common.Hash{3})
+	require.NoError(t, err)
+	require.Nil(t, proof)
+}
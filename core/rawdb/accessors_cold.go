@@ -0,0 +1,43 @@
+package rawdb
+
+import (
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+)
+
+// ColdTx - transaction of chaindata which has bodies, transactions and receipts of old blocks moved to database on
+// slower volume (see tiering package). Reads of kv.BlockBody, kv.EthTx, kv.Receipts and kv.Log fall back to it, when
+// data is absent in chaindata.
+type ColdTx interface {
+	// ColdTx - read transaction of cold database, it ends with chaindata transaction. nil - the block isn't moved
+	ColdTx(blockNum uint64) (kv.Tx, error)
+}
+
+// viewCold - runs f in read transaction of cold database, if db is transaction with cold database and the block is
+// moved there
+func viewCold(db interface{}, blockNum uint64, f func(tx kv.Tx) error) (bool, error) {
+	c, ok := db.(ColdTx)
+	if !ok {
+		return false, nil
+	}
+	tx, err := c.ColdTx(blockNum)
+	if err != nil || tx == nil {
+		return false, err
+	}
+	return true, f(tx)
+}
+
+// ForEachLog - values of kv.Log of the block, from chaindata or cold storage
+func ForEachLog(db kv.Getter, blockNum uint64, walker func(k, v []byte) error) error {
+	var found bool
+	if err := db.ForPrefix(kv.Log, dbutils.EncodeBlockNumber(blockNum), func(k, v []byte) error {
+		found = true
+		return walker(k, v)
+	}); err != nil || found {
+		return err
+	}
+	_, err := viewCold(db, blockNum, func(tx kv.Tx) error {
+		return tx.ForPrefix(kv.Log, dbutils.EncodeBlockNumber(blockNum), walker)
+	})
+	return err
+}
@@ -0,0 +1,77 @@
+package rawdb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/log/v3"
+)
+
+var (
+	ForkchoiceHeadKey      = []byte("headBlockHash")
+	ForkchoiceSafeKey      = []byte("safeBlockHash")
+	ForkchoiceFinalizedKey = []byte("finalizedBlockHash")
+	ForkchoiceUpdatedAtKey = []byte("updatedAt")
+)
+
+func readForkchoiceHash(db kv.Getter, key []byte) common.Hash {
+	data, err := db.GetOne(LastForkchoice, key)
+	if err != nil {
+		log.Error("ReadForkchoice failed", "key", string(key), "err", err)
+	}
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// ReadForkchoiceHead retrieves head block hash of last fork choice state received from consensus layer.
+func ReadForkchoiceHead(db kv.Getter) common.Hash {
+	return readForkchoiceHash(db, ForkchoiceHeadKey)
+}
+
+// ReadForkchoiceSafe retrieves safe block hash of last fork choice state received from consensus layer.
+func ReadForkchoiceSafe(db kv.Getter) common.Hash {
+	return readForkchoiceHash(db, ForkchoiceSafeKey)
+}
+
+// ReadForkchoiceFinalized retrieves finalized block hash of last fork choice state received from consensus layer.
+func ReadForkchoiceFinalized(db kv.Getter) common.Hash {
+	return readForkchoiceHash(db, ForkchoiceFinalizedKey)
+}
+
+// ReadForkchoiceUpdatedAt retrieves unix timestamp of last fork choice update, 0 if there were no updates.
+func ReadForkchoiceUpdatedAt(db kv.Getter) uint64 {
+	data, err := db.GetOne(LastForkchoice, ForkchoiceUpdatedAtKey)
+	if err != nil {
+		log.Error("ReadForkchoiceUpdatedAt failed", "err", err)
+	}
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WriteForkchoice stores fork choice state received from consensus layer. Empty safe or finalized hash
+// means "not known yet", such markers are not overwritten.
+func WriteForkchoice(db kv.Putter, head, safe, finalized common.Hash, updatedAt uint64) error {
+	for _, marker := range []struct {
+		key  []byte
+		hash common.Hash
+	}{{ForkchoiceHeadKey, head}, {ForkchoiceSafeKey, safe}, {ForkchoiceFinalizedKey, finalized}} {
+		if marker.hash == (common.Hash{}) {
+			continue
+		}
+		if err := db.Put(LastForkchoice, marker.key, marker.hash.Bytes()); err != nil {
+			return fmt.Errorf("failed to store fork choice %s: %w", marker.key, err)
+		}
+	}
+	var v [8]byte
+	binary.BigEndian.PutUint64(v[:], updatedAt)
+	if err := db.Put(LastForkchoice, ForkchoiceUpdatedAtKey, v[:]); err != nil {
+		return fmt.Errorf("failed to store fork choice update time: %w", err)
+	}
+	return nil
+}
@@ -17,9 +17,14 @@
 package rawdb
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
 	"math/big"
 
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/interfaces"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/log/v3"
@@ -33,40 +38,156 @@ type TxLookupEntry struct {
 	Index      uint64
 }
 
+// TxLookupPrefixLen - amount of transaction hash bytes used as key in TxLookupCompact table
+const TxLookupPrefixLen = 8
+
+// TxLookupKey - key of transaction in TxLookupCompact table
+func TxLookupKey(txnHash common.Hash) []byte {
+	return common.CopyBytes(txnHash[:TxLookupPrefixLen])
+}
+
+// EncodeTxLookupValue - value of transaction in TxLookupCompact table
+func EncodeTxLookupValue(blockNum uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, blockNum)
+	return buf[:n]
+}
+
+func DecodeTxLookupValue(v []byte) (uint64, error) {
+	blockNum, n := binary.Uvarint(v)
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid TxLookup value: %x", v)
+	}
+	return blockNum, nil
+}
+
+// ReadTxLookupEntries retrieves numbers of all blocks which may include transaction with given hash
+// (more than 1 only if prefixes of transaction hashes collide). Entries of kv.TxLookup (layout of previous versions)
+// are read if the hash has no TxLookupCompact entries.
+func ReadTxLookupEntries(db kv.Tx, txnHash common.Hash) ([]uint64, error) {
+	c, err := db.CursorDupSort(TxLookupCompact)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	var blockNums []uint64
+	k, v, err := c.SeekExact(TxLookupKey(txnHash))
+	for ; k != nil; k, v, err = c.NextDup() {
+		if err != nil {
+			return nil, err
+		}
+		blockNum, err := DecodeTxLookupValue(v)
+		if err != nil {
+			return nil, err
+		}
+		blockNums = append(blockNums, blockNum)
+	}
+	if err != nil { // error of the last seek doesn't return key
+		return nil, err
+	}
+	if len(blockNums) == 0 {
+		// entry of previous versions, it's moved to TxLookupCompact by prune of TxLookup stage
+		v, err := db.GetOne(kv.TxLookup, txnHash.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if len(v) > 0 {
+			blockNums = append(blockNums, new(big.Int).SetBytes(v).Uint64())
+		}
+	}
+	return blockNums, nil
+}
+
 // ReadTxLookupEntry retrieves the positional metadata associated with a transaction
-// hash to allow retrieving the transaction or receipt by hash.
-func ReadTxLookupEntry(db kv.Tx, txnHash common.Hash) (*uint64, error) {
-	data, err := db.GetOne(kv.TxLookup, txnHash.Bytes())
+// hash to allow retrieving the transaction or receipt by hash. Transactions of blocks
+// which have no TxLookupCompact entries (pruned) are searched by TxLookupBloom filters.
+// Blocks of colliding entries and of filters are read by blockReader.
+func ReadTxLookupEntry(ctx context.Context, db kv.Tx, blockReader interfaces.BlockReader, txnHash common.Hash) (*uint64, error) {
+	blockNums, err := ReadTxLookupEntries(db, txnHash)
 	if err != nil {
 		return nil, err
 	}
-	if len(data) == 0 {
-		return nil, nil
+	switch len(blockNums) {
+	case 0:
+		return findTxInBlooms(ctx, db, blockReader, txnHash)
+	case 1:
+		return &blockNums[0], nil
+	}
+	// prefix collision - find block which really has this transaction
+	for i := range blockNums {
+		found, err := canonicalBlockHasTxn(ctx, db, blockReader, blockNums[i], txnHash)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return &blockNums[i], nil
+		}
 	}
-	number := new(big.Int).SetBytes(data).Uint64()
-	return &number, nil
+	return nil, nil
 }
 
 // WriteTxLookupEntries stores a positional metadata for every transaction from
 // a block, enabling hash based transaction and receipt lookups.
 func WriteTxLookupEntries(db kv.Putter, block *types.Block) {
+	data := EncodeTxLookupValue(block.NumberU64())
 	for _, tx := range block.Transactions() {
-		data := block.Number().Bytes()
-		if err := db.Put(kv.TxLookup, tx.Hash().Bytes(), data); err != nil {
+		if err := db.Put(TxLookupCompact, TxLookupKey(tx.Hash()), data); err != nil {
 			log.Crit("Failed to store transaction lookup entry", "err", err)
 		}
 	}
 }
 
-// DeleteTxLookupEntry removes all transaction data associated with a hash.
-func DeleteTxLookupEntry(db kv.Deleter, hash common.Hash) error {
-	return db.Delete(kv.TxLookup, hash.Bytes(), nil)
+// DeleteTxLookupEntry removes transaction data associated with a hash and block number.
+func DeleteTxLookupEntry(db kv.Deleter, hash common.Hash, blockNum uint64) error {
+	if err := db.Delete(kv.TxLookup, hash.Bytes(), nil); err != nil {
+		return err
+	}
+	return db.Delete(TxLookupCompact, TxLookupKey(hash), EncodeTxLookupValue(blockNum))
+}
+
+// CmpTxLookup - order of TxLookupCompact records (keys, then values - as DupSort table does)
+func CmpTxLookup(k1, k2, v1, v2 []byte) int {
+	if c := bytes.Compare(k1, k2); c != 0 {
+		return c
+	}
+	return bytes.Compare(v1, v2)
+}
+
+// ReadUncleInclusion retrieves the number of the canonical block which included
+// given uncle (ommer).
+func ReadUncleInclusion(db kv.Getter, uncleHash common.Hash) (*uint64, error) {
+	data, err := db.GetOne(UncleInclusion, uncleHash.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	number := new(big.Int).SetBytes(data).Uint64()
+	return &number, nil
+}
+
+// WriteUncleInclusionEntries stores the number of including block for every uncle
+// of a block, enabling hash based uncle lookups.
+func WriteUncleInclusionEntries(db kv.Putter, number uint64, uncles []*types.Header) error {
+	data := new(big.Int).SetUint64(number).Bytes()
+	for _, uncle := range uncles {
+		if err := db.Put(UncleInclusion, uncle.Hash().Bytes(), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteUncleInclusionEntry removes uncle inclusion data associated with a hash.
+func DeleteUncleInclusionEntry(db kv.Deleter, uncleHash common.Hash) error {
+	return db.Delete(UncleInclusion, uncleHash.Bytes(), nil)
 }
 
 // ReadTransaction retrieves a specific transaction from the database, along with
 // its added positional metadata.
 func ReadTransaction(db kv.Tx, hash common.Hash) (types.Transaction, common.Hash, uint64, uint64, error) {
-	blockNumber, err := ReadTxLookupEntry(db, hash)
+	blockNumber, err := ReadTxLookupEntry(context.Background(), db, dbBlockReader{}, hash)
 	if err != nil {
 		return nil, common.Hash{}, 0, 0, err
 	}
@@ -101,7 +222,7 @@ func ReadTransaction(db kv.Tx, hash common.Hash) (types.Transaction, common.Hash
 
 func ReadReceipt(db kv.Tx, txHash common.Hash) (*types.Receipt, common.Hash, uint64, uint64, error) {
 	// Retrieve the context of the receipt based on the transaction hash
-	blockNumber, err := ReadTxLookupEntry(db, txHash)
+	blockNumber, err := ReadTxLookupEntry(context.Background(), db, dbBlockReader{}, txHash)
 	if err != nil {
 		return nil, common.Hash{}, 0, 0, err
 	}
@@ -17,6 +17,7 @@
 package rawdb
 
 import (
+	"context"
 	"math/big"
 	"testing"
 
@@ -86,7 +87,7 @@ func TestLookupStorage(t *testing.T) {
 			}
 			// Delete the transactions and check purge
 			for i, txn := range txs {
-				if err := DeleteTxLookupEntry(tx, txn.Hash()); err != nil {
+				if err := DeleteTxLookupEntry(tx, txn.Hash(), block.NumberU64()); err != nil {
 					t.Fatal(err)
 				}
 				if txn2, _, _, _, _ := ReadTransaction(tx, txn.Hash()); txn2 != nil {
@@ -96,3 +97,133 @@ func TestLookupStorage(t *testing.T) {
 		})
 	}
 }
+
+// Tests that uncle inclusion metadata can be stored, retrieved and deleted.
+func TestUncleInclusionStorage(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+
+	uncles := []*types.Header{
+		{Number: big.NewInt(312), Extra: []byte("uncle1")},
+		{Number: big.NewInt(313), Extra: []byte("uncle2")},
+	}
+	for i, uncle := range uncles {
+		if number, err := ReadUncleInclusion(tx, uncle.Hash()); err != nil || number != nil {
+			t.Fatalf("uncle #%d [%x]: non existent uncle returned: %v, %v", i, uncle.Hash(), number, err)
+		}
+	}
+	if err := WriteUncleInclusionEntries(tx, 314, uncles); err != nil {
+		t.Fatal(err)
+	}
+	for i, uncle := range uncles {
+		number, err := ReadUncleInclusion(tx, uncle.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if number == nil || *number != 314 {
+			t.Fatalf("uncle #%d [%x]: including block mismatch: have %v, want %d", i, uncle.Hash(), number, 314)
+		}
+	}
+	if err := DeleteUncleInclusionEntry(tx, uncles[0].Hash()); err != nil {
+		t.Fatal(err)
+	}
+	if number, _ := ReadUncleInclusion(tx, uncles[0].Hash()); number != nil {
+		t.Fatalf("deleted uncle returned: %d", *number)
+	}
+	if number, _ := ReadUncleInclusion(tx, uncles[1].Hash()); number == nil {
+		t.Fatalf("uncle deleted unexpectedly")
+	}
+}
+
+// Tests that lookup resolves transactions which hashes have same prefix.
+func TestLookupPrefixCollision(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+
+	txn := types.NewTransaction(1, common.BytesToAddress([]byte{0x11}), uint256.NewInt(111), 1111, uint256.NewInt(11111), []byte{0x11, 0x11, 0x11})
+	block := types.NewBlock(&types.Header{Number: big.NewInt(314)}, []types.Transaction{txn}, nil, nil)
+	if err := WriteCanonicalHash(tx, block.Hash(), block.NumberU64()); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteBlock(tx, block); err != nil {
+		t.Fatal(err)
+	}
+	WriteTxLookupEntries(tx, block)
+
+	// another transaction with same prefix of hash in block 100
+	if err := tx.Put(TxLookupCompact, TxLookupKey(txn.Hash()), EncodeTxLookupValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	blockNums, err := ReadTxLookupEntries(tx, txn.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blockNums) != 2 {
+		t.Fatalf("expected 2 candidates, got %d", len(blockNums))
+	}
+	number, err := ReadTxLookupEntry(context.Background(), tx, dbBlockReader{}, txn.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number == nil || *number != block.NumberU64() {
+		t.Fatalf("wrong block number: have %v, want %d", number, block.NumberU64())
+	}
+}
+
+// Tests that transactions of blocks without lookup entries are found by bloom filters of segments.
+func TestLookupBloom(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+
+	txn := types.NewTransaction(1, common.BytesToAddress([]byte{0x11}), uint256.NewInt(111), 1111, uint256.NewInt(11111), []byte{0x11, 0x11, 0x11})
+	block := types.NewBlock(&types.Header{Number: big.NewInt(TxLookupBloomSegmentSize + 314)}, []types.Transaction{txn}, nil, nil)
+	if err := WriteCanonicalHash(tx, block.Hash(), block.NumberU64()); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteBlock(tx, block); err != nil {
+		t.Fatal(err)
+	}
+	other := types.NewTransaction(2, common.BytesToAddress([]byte{0x22}), uint256.NewInt(222), 2222, uint256.NewInt(22222), nil)
+	for segment := uint64(0); segment < 3; segment++ {
+		bloom := NewTxBloom(1)
+		if segment == 1 {
+			bloom.Add(txn.Hash())
+		}
+		if bloom.Has(other.Hash()) {
+			t.Fatalf("segment %d: unexpected transaction in bloom filter", segment)
+		}
+		if err := WriteTxBloom(tx, segment, bloom); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	number, err := ReadTxLookupEntry(context.Background(), tx, dbBlockReader{}, txn.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number == nil || *number != block.NumberU64() {
+		t.Fatalf("wrong block number: have %v, want %d", number, block.NumberU64())
+	}
+	if number, _ = ReadTxLookupEntry(context.Background(), tx, dbBlockReader{}, other.Hash()); number != nil {
+		t.Fatalf("non existent transaction found in block %d", *number)
+	}
+
+	if err = DeleteTxBlooms(tx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if last, _ := ReadLastTxBloomSegment(tx); last == nil || *last != 0 {
+		t.Fatalf("wrong last segment after delete: %v", last)
+	}
+	if number, _ = ReadTxLookupEntry(context.Background(), tx, dbBlockReader{}, txn.Hash()); number != nil {
+		t.Fatalf("transaction of deleted bloom filter found in block %d", *number)
+	}
+
+	// lookup doesn't read blocks of all segments if filters say that transaction is everywhere
+	for segment := uint64(1); segment <= maxTxBloomReadSegments+1; segment++ {
+		bloom := NewTxBloom(1)
+		bloom.Add(other.Hash())
+		if err = WriteTxBloom(tx, segment, bloom); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = ReadTxLookupEntry(context.Background(), tx, dbBlockReader{}, other.Hash()); err == nil {
+		t.Fatal("expected error of too many segments")
+	}
+}
@@ -0,0 +1,93 @@
+package rawdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/rlp"
+)
+
+// PayloadStatsRetention - how many recent blocks keep their entries in PayloadLog
+const PayloadStatsRetention = 90_000
+
+// PayloadStats - composition and value of payload built by mining stages
+type PayloadStats struct {
+	Number       uint64
+	BuiltAt      uint64 // unix time in nanoseconds
+	ParentHash   common.Hash
+	Hash         common.Hash // hash of unsealed header
+	GasLimit     uint64
+	GasUsed      uint64
+	Value        *big.Int // balance increase of fee recipient by transactions: priority fees and direct payments
+	PriorityFees *big.Int // sum of gas used by transaction * effective gas tip
+	Candidates   uint64   // transactions offered by txpool
+	Included     uint64   // transactions of txpool included into payload
+	BundleTxs    uint64   // transactions offered by bundles of external builders
+	BundleIncl   uint64   // transactions of bundles included into payload
+	Uncles       uint64
+}
+
+// DirectPayments - part of value paid to fee recipient not by priority fees (e.g. coinbase transfers of MEV searchers)
+func (s *PayloadStats) DirectPayments() *big.Int {
+	return new(big.Int).Sub(s.Value, s.PriorityFees)
+}
+
+// WritePayloadStats appends payload to PayloadLog and deletes entries of blocks older than PayloadStatsRetention
+func WritePayloadStats(tx kv.RwTx, s *PayloadStats) error {
+	v, err := rlp.EncodeToBytes(s)
+	if err != nil {
+		return err
+	}
+	k := make([]byte, 16)
+	binary.BigEndian.PutUint64(k, s.Number)
+	binary.BigEndian.PutUint64(k[8:], s.BuiltAt)
+	if err = tx.Put(PayloadLog, k, v); err != nil {
+		return err
+	}
+	if s.Number < PayloadStatsRetention {
+		return nil
+	}
+
+	c, err := tx.RwCursor(PayloadLog)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for k, _, err = c.First(); k != nil && binary.BigEndian.Uint64(k)+PayloadStatsRetention <= s.Number; k, _, err = c.First() {
+		if err = c.DeleteCurrent(); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// ReadPayloadStats - payloads of blocks in [from, to], ordered by block number and build time
+func ReadPayloadStats(tx kv.Tx, from, to uint64) ([]*PayloadStats, error) {
+	c, err := tx.Cursor(PayloadLog)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	var payloads []*PayloadStats
+	for k, v, err := c.Seek(dbutils.EncodeBlockNumber(from)); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return nil, err
+		}
+		if len(k) != 16 {
+			return nil, fmt.Errorf("invalid %s key: %x", PayloadLog, k)
+		}
+		if binary.BigEndian.Uint64(k) > to {
+			break
+		}
+		s := &PayloadStats{}
+		if err := rlp.DecodeBytes(v, s); err != nil {
+			return nil, fmt.Errorf("invalid %s entry %x: %w", PayloadLog, k, err)
+		}
+		payloads = append(payloads, s)
+	}
+	return payloads, nil
+}
@@ -0,0 +1,43 @@
+package rawdb
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadLog(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	newStats := func(number, builtAt uint64) *PayloadStats {
+		return &PayloadStats{
+			Number:       number,
+			BuiltAt:      builtAt,
+			ParentHash:   common.Hash{1, byte(number)},
+			Hash:         common.Hash{2, byte(number), byte(builtAt)},
+			GasLimit:     30_000_000,
+			GasUsed:      21_000,
+			Value:        big.NewInt(int64(number) * 3),
+			PriorityFees: big.NewInt(int64(number)),
+			Candidates:   10,
+			Included:     1,
+			BundleTxs:    2,
+			BundleIncl:   2,
+		}
+	}
+	require.NoError(t, WritePayloadStats(tx, newStats(1, 200)))
+	require.NoError(t, WritePayloadStats(tx, newStats(1, 100)))
+	require.NoError(t, WritePayloadStats(tx, newStats(2, 50)))
+
+	payloads, err := ReadPayloadStats(tx, 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, []*PayloadStats{newStats(1, 100), newStats(1, 200)}, payloads)
+	require.Equal(t, big.NewInt(2), payloads[0].DirectPayments())
+
+	require.NoError(t, WritePayloadStats(tx, newStats(PayloadStatsRetention+1, 1)))
+	payloads, err = ReadPayloadStats(tx, 0, PayloadStatsRetention+1)
+	require.NoError(t, err)
+	require.Equal(t, []*PayloadStats{newStats(2, 50), newStats(PayloadStatsRetention+1, 1)}, payloads) // block 1 is too old
+}
@@ -0,0 +1,97 @@
+package rawdb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+)
+
+// MaxReorgLogEntries - size of ReorgLog ring buffer, older reorgs are deleted
+const MaxReorgLogEntries = 1024
+
+const reorgEncodedLen = 3*(8+common.HashLength) + 8
+
+// Reorg - change of canonical chain: blocks above CommonAncestor up to OldHead were replaced by blocks up to NewHead
+type Reorg struct {
+	ID             uint64 // assigned by WriteReorg
+	OldHeadNumber  uint64
+	OldHeadHash    common.Hash
+	NewHeadNumber  uint64
+	NewHeadHash    common.Hash
+	AncestorNumber uint64
+	AncestorHash   common.Hash
+	Time           uint64 // unix time when reorg was observed
+}
+
+// Depth - amount of canonical blocks which were replaced
+func (r *Reorg) Depth() uint64 {
+	return r.OldHeadNumber - r.AncestorNumber
+}
+
+// WriteReorg appends reorg to ReorgLog, assigns its ID and deletes reorgs which don't fit into ring buffer
+func WriteReorg(tx kv.RwTx, r *Reorg) error {
+	c, err := tx.RwCursor(ReorgLog)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	k, _, err := c.Last()
+	if err != nil {
+		return err
+	}
+	r.ID = 1
+	if k != nil {
+		r.ID = binary.BigEndian.Uint64(k) + 1
+	}
+
+	v := make([]byte, reorgEncodedLen)
+	pos := 0
+	for _, ref := range []struct {
+		number uint64
+		hash   common.Hash
+	}{{r.OldHeadNumber, r.OldHeadHash}, {r.NewHeadNumber, r.NewHeadHash}, {r.AncestorNumber, r.AncestorHash}} {
+		binary.BigEndian.PutUint64(v[pos:], ref.number)
+		copy(v[pos+8:], ref.hash[:])
+		pos += 8 + common.HashLength
+	}
+	binary.BigEndian.PutUint64(v[pos:], r.Time)
+	if err = c.Append(dbutils.EncodeBlockNumber(r.ID), v); err != nil {
+		return err
+	}
+
+	for k, _, err = c.First(); k != nil && binary.BigEndian.Uint64(k)+MaxReorgLogEntries <= r.ID; k, _, err = c.First() {
+		if err = c.DeleteCurrent(); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// ReadReorgs - reorgs with id >= fromID, in order of ids
+func ReadReorgs(tx kv.Tx, fromID uint64) ([]*Reorg, error) {
+	var reorgs []*Reorg
+	if err := tx.ForEach(ReorgLog, dbutils.EncodeBlockNumber(fromID), func(k, v []byte) error {
+		if len(k) != 8 || len(v) != reorgEncodedLen {
+			return fmt.Errorf("invalid %s entry: key %x, value %x", ReorgLog, k, v)
+		}
+		r := &Reorg{ID: binary.BigEndian.Uint64(k)}
+		pos := 0
+		for _, ref := range []struct {
+			number *uint64
+			hash   *common.Hash
+		}{{&r.OldHeadNumber, &r.OldHeadHash}, {&r.NewHeadNumber, &r.NewHeadHash}, {&r.AncestorNumber, &r.AncestorHash}} {
+			*ref.number = binary.BigEndian.Uint64(v[pos:])
+			copy(ref.hash[:], v[pos+8:])
+			pos += 8 + common.HashLength
+		}
+		r.Time = binary.BigEndian.Uint64(v[pos:])
+		reorgs = append(reorgs, r)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return reorgs, nil
+}
@@ -0,0 +1,41 @@
+package rawdb
+
+import (
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReorgLog(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	newReorg := func(i uint64) *Reorg {
+		return &Reorg{
+			OldHeadNumber:  i + 10,
+			OldHeadHash:    common.Hash{1, byte(i)},
+			NewHeadNumber:  i + 11,
+			NewHeadHash:    common.Hash{2, byte(i)},
+			AncestorNumber: i,
+			AncestorHash:   common.Hash{3, byte(i)},
+			Time:           1000 + i,
+		}
+	}
+	for i := uint64(1); i <= MaxReorgLogEntries+2; i++ {
+		r := newReorg(i)
+		require.NoError(t, WriteReorg(tx, r))
+		require.Equal(t, i, r.ID)
+	}
+
+	all, err := ReadReorgs(tx, 0)
+	require.NoError(t, err)
+	require.Len(t, all, MaxReorgLogEntries)
+	require.Equal(t, uint64(3), all[0].ID) // the oldest ones don't fit
+
+	last, err := ReadReorgs(tx, MaxReorgLogEntries+2)
+	require.NoError(t, err)
+	expected := newReorg(MaxReorgLogEntries + 2)
+	expected.ID = MaxReorgLogEntries + 2
+	require.Equal(t, []*Reorg{expected}, last)
+	require.Equal(t, uint64(10), last[0].Depth())
+}
@@ -0,0 +1,127 @@
+package rawdb
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// StaleForksPrunedKey - key in kv.DatabaseInfo: non-canonical blocks below this number are deleted
+var StaleForksPrunedKey = []byte("staleForksPrunedTo")
+
+func ReadStaleForksPrunedTo(db kv.Getter) (uint64, error) {
+	data, err := db.GetOne(kv.DatabaseInfo, StaleForksPrunedKey)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) < 8 {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+func WriteStaleForksPrunedTo(db kv.Putter, number uint64) error {
+	return db.Put(kv.DatabaseInfo, StaleForksPrunedKey, dbutils.EncodeBlockNumber(number))
+}
+
+// DeleteNonCanonicalBlock - deletes header, body, senders and total difficulty of non-canonical block, returns amount of
+// deleted bytes (keys and values). Transactions of non-canonical block can be in EthTx (block never was canonical) or in
+// NonCanonicalTxs (block was unwound) - they are deleted only from table where they match transactions root of header.
+func DeleteNonCanonicalBlock(db kv.RwTx, hash common.Hash, number uint64) (deleted uint64, err error) {
+	key := dbutils.HeaderKey(number, hash)
+	del := func(table string, k []byte) error {
+		v, err := db.GetOne(table, k)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return nil
+		}
+		deleted += uint64(len(k) + len(v))
+		return db.Delete(table, k, nil)
+	}
+
+	var header *types.Header
+	if headerRlp, err := db.GetOne(kv.Headers, key); err != nil {
+		return 0, err
+	} else if headerRlp != nil {
+		header = new(types.Header)
+		if err = rlp.DecodeBytes(headerRlp, header); err != nil {
+			return 0, err
+		}
+	}
+	if bodyRlp := ReadStorageBodyRLP(db, hash, number); header != nil && len(bodyRlp) > 0 {
+		body := new(types.BodyForStorage)
+		if err = rlp.DecodeBytes(bodyRlp, body); err != nil {
+			return 0, err
+		}
+		if body.TxAmount > 0 {
+			var matched []string
+			for _, table := range []string{kv.EthTx, kv.NonCanonicalTxs} {
+				ok, err := txsMatchRoot(db, table, body.BaseTxId, body.TxAmount, header.TxHash)
+				if err != nil {
+					return 0, err
+				}
+				if ok {
+					matched = append(matched, table)
+				}
+			}
+			if len(matched) == 1 {
+				for id := body.BaseTxId; id < body.BaseTxId+uint64(body.TxAmount); id++ {
+					if err = del(matched[0], dbutils.EncodeBlockNumber(id)); err != nil {
+						return 0, err
+					}
+				}
+			} else {
+				log.Debug("Transactions of non-canonical block are not found or ambiguous, kept", "number", number, "hash", hash, "tables", matched)
+			}
+		}
+	}
+
+	for _, table := range []string{kv.Headers, kv.BlockBody, kv.Senders, kv.HeaderTD} {
+		if err = del(table, key); err != nil {
+			return 0, err
+		}
+	}
+	if n := ReadHeaderNumber(db, hash); n != nil && *n == number {
+		if err = del(kv.HeaderNumber, hash[:]); err != nil {
+			return 0, err
+		}
+	}
+	return deleted, nil
+}
+
+// txsMatchRoot - whether amount of transactions starting from baseTxID in table have given root
+func txsMatchRoot(db kv.Getter, table string, baseTxID uint64, amount uint32, root common.Hash) (bool, error) {
+	txs := make(types.Transactions, 0, amount)
+	reader := bytes.NewReader(nil)
+	stream := rlp.NewStream(reader, 0)
+	var decodeFailed bool
+	if err := db.ForAmount(table, dbutils.EncodeBlockNumber(baseTxID), amount, func(k, v []byte) error {
+		if binary.BigEndian.Uint64(k) != baseTxID+uint64(len(txs)) {
+			decodeFailed = true
+			return nil
+		}
+		reader.Reset(v)
+		stream.Reset(reader, 0)
+		txn, err := types.DecodeTransaction(stream)
+		if err != nil {
+			decodeFailed = true
+			return nil
+		}
+		txs = append(txs, txn)
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	if decodeFailed || len(txs) != int(amount) {
+		return false, nil
+	}
+	return types.DeriveSha(txs) == root, nil
+}
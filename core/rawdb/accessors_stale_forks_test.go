@@ -0,0 +1,76 @@
+package rawdb
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/common/u256"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestBlock(t *testing.T, tx kv.RwTx, number uint64, extra byte, nonces ...uint64) common.Hash {
+	var txs types.Transactions
+	for _, nonce := range nonces {
+		txs = append(txs, types.NewTransaction(nonce, common.Address{extra}, u256.Num1, 21_000, u256.Num1, nil))
+	}
+	header := &types.Header{Number: new(big.Int).SetUint64(number), Extra: []byte{extra}, TxHash: types.DeriveSha(txs), Difficulty: big.NewInt(1)}
+	WriteHeader(tx, header)
+	require.NoError(t, WriteTd(tx, header.Hash(), number, big.NewInt(int64(number))))
+	require.NoError(t, WriteBody(tx, header.Hash(), number, &types.Body{Transactions: txs}))
+	return header.Hash()
+}
+
+func TestDeleteNonCanonicalBlock(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	require := require.New(t)
+
+	canonical1 := writeTestBlock(t, tx, 1, 1, 1, 2)
+	require.NoError(WriteCanonicalHash(tx, canonical1, 1))
+	neverCanonical := writeTestBlock(t, tx, 1, 2, 3, 4) // transactions in EthTx
+
+	// unwound block - transactions in NonCanonicalTxs
+	unwound := writeTestBlock(t, tx, 2, 3, 5, 6)
+	require.NoError(WriteCanonicalHash(tx, unwound, 2))
+	logEvery := time.NewTicker(time.Minute)
+	defer logEvery.Stop()
+	require.NoError(MakeBodiesNonCanonical(tx, 2, context.Background(), "test", logEvery))
+	canonical2 := writeTestBlock(t, tx, 2, 4, 5, 7)
+	require.NoError(WriteCanonicalHash(tx, canonical2, 2))
+
+	for _, b := range []struct {
+		hash   common.Hash
+		number uint64
+		table  string
+	}{{neverCanonical, 1, kv.EthTx}, {unwound, 2, kv.NonCanonicalTxs}} {
+		body := new(types.BodyForStorage)
+		require.NoError(rlp.DecodeBytes(ReadStorageBodyRLP(tx, b.hash, b.number), body))
+		deleted, err := DeleteNonCanonicalBlock(tx, b.hash, b.number)
+		require.NoError(err)
+		require.NotZero(deleted)
+		require.Nil(ReadHeader(tx, b.hash, b.number))
+		require.Nil(ReadStorageBodyRLP(tx, b.hash, b.number))
+		require.Nil(ReadHeaderNumber(tx, b.hash))
+		td, err := ReadTd(tx, b.hash, b.number)
+		require.NoError(err)
+		require.Nil(td)
+		has, err := tx.Has(b.table, dbutils.EncodeBlockNumber(body.BaseTxId))
+		require.NoError(err)
+		require.False(has)
+	}
+
+	// canonical blocks are untouched
+	for number, hash := range map[uint64]common.Hash{1: canonical1, 2: canonical2} {
+		block := ReadBlock(tx, hash, number)
+		require.NotNil(block)
+		require.Len(block.Transactions(), 2)
+		require.Equal(block.Header().TxHash, types.DeriveSha(block.Transactions()))
+	}
+}
@@ -0,0 +1,154 @@
+package rawdb
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/interfaces"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/types"
+)
+
+// TxLookupBloomSegmentSize - amount of blocks which share one bloom filter of TxLookupBloom table.
+// Lookup of transaction in segment with false positive reads bodies of all its blocks.
+const TxLookupBloomSegmentSize = 1_000
+
+const (
+	txBloomBitsPerTx = 20 // with txBloomHashes: false positive rate ~0.007% - ~1 of 14K segments of mainnet
+	txBloomHashes    = 14
+)
+
+// maxTxBloomReadSegments - limit of segments whose blocks are read by one lookup. Filters of existing transaction
+// and their rare false positives never reach it: it only bounds lookup if filters are broken or overfilled.
+const maxTxBloomReadSegments = 16
+
+// TxBloom - bloom filter of transaction hashes. Hashes are uniformly distributed, so bit positions are derived
+// from the hash itself (double hashing by its first two words) - without extra hashing.
+type TxBloom []byte
+
+// NewTxBloom - empty bloom filter for given amount of transactions
+func NewTxBloom(txAmount int) TxBloom {
+	return make(TxBloom, txAmount*txBloomBitsPerTx/64*8+8)
+}
+
+func (b TxBloom) Add(txnHash common.Hash) {
+	m := uint64(len(b)) * 8
+	h1, h2 := binary.BigEndian.Uint64(txnHash[:8]), binary.BigEndian.Uint64(txnHash[8:16])|1
+	for i := uint64(0); i < txBloomHashes; i++ {
+		pos := (h1 + i*h2) % m
+		b[pos/8] |= 1 << (pos % 8)
+	}
+}
+
+// Has - false if transaction is not in the filter, true if it may be there
+func (b TxBloom) Has(txnHash common.Hash) bool {
+	m := uint64(len(b)) * 8
+	if m == 0 {
+		return false
+	}
+	h1, h2 := binary.BigEndian.Uint64(txnHash[:8]), binary.BigEndian.Uint64(txnHash[8:16])|1
+	for i := uint64(0); i < txBloomHashes; i++ {
+		pos := (h1 + i*h2) % m
+		if b[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func WriteTxBloom(db kv.Putter, segment uint64, bloom TxBloom) error {
+	return db.Put(TxLookupBloom, dbutils.EncodeBlockNumber(segment), bloom)
+}
+
+// DeleteTxBlooms - removes bloom filters of given segment and newer
+func DeleteTxBlooms(db kv.RwTx, fromSegment uint64) error {
+	return db.ForEach(TxLookupBloom, dbutils.EncodeBlockNumber(fromSegment), func(k, v []byte) error {
+		return db.Delete(TxLookupBloom, k, nil)
+	})
+}
+
+// ReadLastTxBloomSegment - number of the last segment which has bloom filter, nil if there are no filters
+func ReadLastTxBloomSegment(db kv.Tx) (*uint64, error) {
+	c, err := db.Cursor(TxLookupBloom)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	k, _, err := c.Last()
+	if err != nil || k == nil {
+		return nil, err
+	}
+	segment := binary.BigEndian.Uint64(k)
+	return &segment, nil
+}
+
+// findTxInBlooms - number of canonical block with given transaction, from the newest segments to the oldest ones.
+// Blocks of segments are read by blockReader - they may be in snapshots already.
+func findTxInBlooms(ctx context.Context, db kv.Tx, blockReader interfaces.BlockReader, txnHash common.Hash) (*uint64, error) {
+	c, err := db.Cursor(TxLookupBloom)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	var readSegments int
+	for k, v, err := c.Last(); k != nil; k, v, err = c.Prev() {
+		if err != nil {
+			return nil, err
+		}
+		if !TxBloom(v).Has(txnHash) {
+			continue
+		}
+		if readSegments == maxTxBloomReadSegments {
+			return nil, fmt.Errorf("transaction %x: more than %d segments of TxLookupBloom may have it", txnHash, maxTxBloomReadSegments)
+		}
+		readSegments++
+		from := binary.BigEndian.Uint64(k) * TxLookupBloomSegmentSize
+		for blockNum := from; blockNum < from+TxLookupBloomSegmentSize; blockNum++ {
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+			found, err := canonicalBlockHasTxn(ctx, db, blockReader, blockNum, txnHash)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				return &blockNum, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// canonicalBlockHasTxn - false if there is no such canonical block
+func canonicalBlockHasTxn(ctx context.Context, db kv.Tx, blockReader interfaces.BlockReader, blockNum uint64, txnHash common.Hash) (bool, error) {
+	blockHash, err := ReadCanonicalHash(db, blockNum)
+	if err != nil {
+		return false, err
+	}
+	if blockHash == (common.Hash{}) {
+		return false, nil
+	}
+	block, _, err := blockReader.BlockWithSenders(ctx, db, blockHash, blockNum)
+	if err != nil {
+		return false, err
+	}
+	if block == nil {
+		return false, nil
+	}
+	for _, txn := range block.Transactions() {
+		if txn.Hash() == txnHash {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// dbBlockReader - reads blocks from db only, for lookups of ReadTransaction and ReadReceipt, which read from db too
+type dbBlockReader struct{}
+
+func (dbBlockReader) BlockWithSenders(_ context.Context, tx kv.Tx, hash common.Hash, number uint64) (*types.Block, []common.Address, error) {
+	return ReadBlockWithSenders(tx, hash, number)
+}
@@ -0,0 +1,95 @@
+package gethfreezer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/interfaces"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/log/v3"
+)
+
+var logInterval = 30 * time.Second
+
+// Export writes canonical blocks [0, to] into a new geth ancient store in dir.
+// Receipts must not be pruned for the exported range.
+func Export(ctx context.Context, tx kv.Tx, blockReader interfaces.FullBlockReader, dir string, to uint64) error {
+	f, err := New(dir)
+	if err != nil {
+		return err
+	}
+	logEvery := time.NewTicker(logInterval)
+	defer logEvery.Stop()
+
+	for number := uint64(0); number <= to; number++ {
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return ctx.Err()
+		case <-logEvery.C:
+			log.Info("[export_ancient] Progress", "block", number, "to", to)
+		default:
+		}
+		if err := exportBlock(ctx, tx, blockReader, f, number); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Info("[export_ancient] Done", "blocks", to+1, "dir", dir)
+	return nil
+}
+
+func exportBlock(ctx context.Context, tx kv.Tx, blockReader interfaces.FullBlockReader, f *Freezer, number uint64) error {
+	hash, err := rawdb.ReadCanonicalHash(tx, number)
+	if err != nil {
+		return err
+	}
+	block, _, err := blockReader.BlockWithSenders(ctx, tx, hash, number)
+	if err != nil {
+		return err
+	}
+	if block == nil {
+		return fmt.Errorf("block %d %x not found", number, hash)
+	}
+	headerRlp, err := rlp.EncodeToBytes(block.Header())
+	if err != nil {
+		return err
+	}
+	bodyRlp, err := rlp.EncodeToBytes(block.Body())
+	if err != nil {
+		return err
+	}
+
+	receipts := rawdb.ReadRawReceipts(tx, number)
+	if len(receipts) != len(block.Transactions()) {
+		return fmt.Errorf("receipts of block %d are missing (pruned?): have %d, want %d", number, len(receipts), len(block.Transactions()))
+	}
+	storageReceipts := make([]*types.ReceiptForStorage, len(receipts))
+	for i, r := range receipts {
+		storageReceipts[i] = (*types.ReceiptForStorage)(r)
+	}
+	receiptsRlp, err := rlp.EncodeToBytes(storageReceipts)
+	if err != nil {
+		return err
+	}
+
+	td, err := rawdb.ReadTd(tx, hash, number)
+	if err != nil {
+		return err
+	}
+	if td == nil {
+		return fmt.Errorf("total difficulty of block %d not found", number)
+	}
+	tdRlp, err := rlp.EncodeToBytes(td)
+	if err != nil {
+		return err
+	}
+	return f.AppendBlock(number, hash, headerRlp, bodyRlp, receiptsRlp, tdRlp)
+}
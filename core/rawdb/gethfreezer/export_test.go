@@ -0,0 +1,89 @@
+package gethfreezer_test
+
+import (
+	"context"
+	"encoding/binary"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/rawdb/gethfreezer"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+// readItem reads item i of a table which fits into single data file
+func readItem(t *testing.T, dir, table string, compressed bool, i int) []byte {
+	ext := "r"
+	if compressed {
+		ext = "c"
+	}
+	index, err := os.ReadFile(filepath.Join(dir, table+"."+ext+"idx"))
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(dir, table+".0000."+ext+"dat"))
+	require.NoError(t, err)
+	start, end := binary.BigEndian.Uint32(index[i*6+2:]), binary.BigEndian.Uint32(index[(i+1)*6+2:])
+	item := data[start:end]
+	if compressed {
+		item, err = snappy.Decode(nil, item)
+		require.NoError(t, err)
+	}
+	return item
+}
+
+func TestExport(t *testing.T) {
+	m := stages.Mock(t)
+	signer := types.LatestSignerForChainID(nil)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 3, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+		txn, err := types.SignTx(types.NewTransaction(b.TxNonce(m.Address), common.Address{2}, uint256.NewInt(1000), 21000, uint256.NewInt(1), nil), *signer, m.Key)
+		require.NoError(t, err)
+		b.AddTx(txn)
+	}, false)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	dir := filepath.Join(t.TempDir(), "ancient")
+	tx, err := m.DB.BeginRo(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	require.NoError(t, gethfreezer.Export(context.Background(), tx, snapshotsync.NewBlockReader(), dir, 2))
+
+	block := chain.Blocks[1]
+	require.Equal(t, block.Hash().Bytes(), readItem(t, dir, gethfreezer.HashesTable, false, 2))
+
+	var header types.Header
+	require.NoError(t, rlp.DecodeBytes(readItem(t, dir, gethfreezer.HeadersTable, true, 2), &header))
+	require.Equal(t, block.Hash(), header.Hash())
+
+	var body types.Body
+	require.NoError(t, rlp.DecodeBytes(readItem(t, dir, gethfreezer.BodiesTable, true, 2), &body))
+	require.Equal(t, 1, len(body.Transactions))
+	require.Equal(t, block.Transactions()[0].Hash(), body.Transactions[0].Hash())
+
+	var receipts []*types.ReceiptForStorage
+	require.NoError(t, rlp.DecodeBytes(readItem(t, dir, gethfreezer.ReceiptsTable, true, 2), &receipts))
+	require.Equal(t, 1, len(receipts))
+	require.Equal(t, types.ReceiptStatusSuccessful, receipts[0].Status)
+	require.Equal(t, uint64(21000), receipts[0].CumulativeGasUsed)
+
+	td := new(big.Int)
+	require.NoError(t, rlp.DecodeBytes(readItem(t, dir, gethfreezer.DiffsTable, false, 2), td))
+	expectedTd, err := rawdb.ReadTd(tx, block.Hash(), 2)
+	require.NoError(t, err)
+	require.Equal(t, expectedTd, td)
+
+	// block 3 is not exported
+	index, err := os.ReadFile(filepath.Join(dir, "headers.cidx"))
+	require.NoError(t, err)
+	require.Equal(t, 4*6, len(index))
+}
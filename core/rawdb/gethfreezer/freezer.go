@@ -0,0 +1,221 @@
+// Package gethfreezer writes canonical chain data in the layout of go-ethereum's ancient store ("freezer"),
+// so that a geth node can be seeded from an Erigon database without re-downloading the frozen part of the chain.
+package gethfreezer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/snappy"
+	"github.com/ledgerwatch/erigon/common"
+)
+
+const (
+	HeadersTable  = "headers"
+	HashesTable   = "hashes"
+	BodiesTable   = "bodies"
+	ReceiptsTable = "receipts"
+	DiffsTable    = "diffs" // total difficulty
+
+	// maxFileSize - geth splits every table into data files of at most this size
+	maxFileSize = 2 * 1000 * 1000 * 1000
+
+	indexEntrySize = 6
+)
+
+// noSnappy - tables which geth keeps uncompressed, all the others are snappy-compressed
+var noSnappy = map[string]bool{
+	HeadersTable:  false,
+	HashesTable:   true,
+	BodiesTable:   false,
+	ReceiptsTable: false,
+	DiffsTable:    true,
+}
+
+// Tables - in order of appending
+var Tables = []string{HeadersTable, HashesTable, BodiesTable, ReceiptsTable, DiffsTable}
+
+// table - append-only writer of one freezer table. Items are stored back to back in data files "<name>.NNNN.{rdat,cdat}",
+// index file "<name>.{ridx,cidx}" has 6-byte entries (2 bytes file number, 4 bytes end offset of item in that file),
+// the very first entry is all zeroes.
+type table struct {
+	name        string
+	dir         string
+	compress    bool
+	maxFileSize uint32
+
+	index  *os.File
+	indexW *bufio.Writer
+
+	head      *os.File
+	headW     *bufio.Writer
+	headID    uint32
+	headBytes uint32
+
+	items uint64
+}
+
+func newTable(dir, name string, compress bool, maxFileSize uint32) (*table, error) {
+	t := &table{name: name, dir: dir, compress: compress, maxFileSize: maxFileSize}
+	var err error
+	if t.index, err = os.OpenFile(filepath.Join(dir, name+"."+t.ext("idx")), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644); err != nil {
+		return nil, err
+	}
+	t.indexW = bufio.NewWriter(t.index)
+	if err = t.writeIndex(0, 0); err != nil {
+		t.index.Close()
+		return nil, err
+	}
+	if err = t.openHead(); err != nil {
+		t.index.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *table) ext(kind string) string {
+	if t.compress {
+		return "c" + kind
+	}
+	return "r" + kind
+}
+
+func (t *table) openHead() (err error) {
+	name := fmt.Sprintf("%s.%04d.%s", t.name, t.headID, t.ext("dat"))
+	if t.head, err = os.OpenFile(filepath.Join(t.dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644); err != nil {
+		return err
+	}
+	t.headW = bufio.NewWriter(t.head)
+	t.headBytes = 0
+	return nil
+}
+
+func (t *table) closeHead() error {
+	if err := t.headW.Flush(); err != nil {
+		return err
+	}
+	if err := t.head.Sync(); err != nil {
+		return err
+	}
+	return t.head.Close()
+}
+
+func (t *table) writeIndex(fileID, offset uint32) error {
+	var entry [indexEntrySize]byte
+	binary.BigEndian.PutUint16(entry[:2], uint16(fileID))
+	binary.BigEndian.PutUint32(entry[2:], offset)
+	_, err := t.indexW.Write(entry[:])
+	return err
+}
+
+func (t *table) append(blob []byte) error {
+	if t.compress {
+		blob = snappy.Encode(nil, blob)
+	}
+	if uint64(t.headBytes)+uint64(len(blob)) > uint64(t.maxFileSize) {
+		if err := t.closeHead(); err != nil {
+			return err
+		}
+		t.headID++
+		if err := t.openHead(); err != nil {
+			return err
+		}
+	}
+	if _, err := t.headW.Write(blob); err != nil {
+		return err
+	}
+	t.headBytes += uint32(len(blob))
+	if err := t.writeIndex(t.headID, t.headBytes); err != nil {
+		return err
+	}
+	t.items++
+	return nil
+}
+
+func (t *table) close() error {
+	if err := t.closeHead(); err != nil {
+		return err
+	}
+	if err := t.indexW.Flush(); err != nil {
+		return err
+	}
+	if err := t.index.Sync(); err != nil {
+		return err
+	}
+	return t.index.Close()
+}
+
+// Freezer - writer of geth's ancient store. Only creation of a new store is supported, blocks must be appended
+// one by one starting from genesis.
+type Freezer struct {
+	dir    string
+	tables map[string]*table
+	frozen uint64
+}
+
+// New creates ancient store in dir, dir must not exist or be empty
+func New(dir string) (*Freezer, error) {
+	return newFreezer(dir, maxFileSize)
+}
+
+func newFreezer(dir string, maxFileSize uint32) (*Freezer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("ancient dir %s is not empty", dir)
+	}
+	f := &Freezer{dir: dir, tables: make(map[string]*table, len(Tables))}
+	for _, name := range Tables {
+		t, err := newTable(dir, name, !noSnappy[name], maxFileSize)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		f.tables[name] = t
+	}
+	return f, nil
+}
+
+// Frozen - amount of blocks appended so far
+func (f *Freezer) Frozen() uint64 { return f.frozen }
+
+// AppendBlock adds the next block of canonical chain. Header, body, receipts and td are RLP-encoded
+// in the same way geth stores them.
+func (f *Freezer) AppendBlock(number uint64, hash common.Hash, header, body, receipts, td []byte) error {
+	if number != f.frozen {
+		return fmt.Errorf("appending block %d out of order, expected %d", number, f.frozen)
+	}
+	for _, item := range []struct {
+		table string
+		blob  []byte
+	}{{HeadersTable, header}, {HashesTable, hash[:]}, {BodiesTable, body}, {ReceiptsTable, receipts}, {DiffsTable, td}} {
+		if err := f.tables[item.table].append(item.blob); err != nil {
+			return fmt.Errorf("failed to append block %d to %s: %w", number, item.table, err)
+		}
+	}
+	f.frozen++
+	return nil
+}
+
+// Close flushes all tables to disk
+func (f *Freezer) Close() error {
+	var firstErr error
+	for _, name := range Tables {
+		t, ok := f.tables[name]
+		if !ok {
+			continue
+		}
+		if err := t.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
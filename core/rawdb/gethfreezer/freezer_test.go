@@ -0,0 +1,58 @@
+package gethfreezer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/stretchr/testify/require"
+)
+
+func readIndex(t *testing.T, path string) [][2]uint32 {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(data)%indexEntrySize)
+	var entries [][2]uint32
+	for i := 0; i < len(data); i += indexEntrySize {
+		entries = append(entries, [2]uint32{uint32(binary.BigEndian.Uint16(data[i:])), binary.BigEndian.Uint32(data[i+2:])})
+	}
+	return entries
+}
+
+func TestTableLayout(t *testing.T) {
+	dir := t.TempDir()
+	f, err := newFreezer(dir, 12)
+	require.NoError(t, err)
+	for i := uint64(0); i < 3; i++ {
+		hash := common.Hash{byte(i)}
+		blob := bytes.Repeat([]byte{byte(i)}, 4)
+		require.NoError(t, f.AppendBlock(i, hash, blob, blob, blob, []byte{byte(i)}))
+	}
+	require.Error(t, f.AppendBlock(5, common.Hash{}, nil, nil, nil, nil))
+	require.NoError(t, f.Close())
+	require.Equal(t, uint64(3), f.Frozen())
+
+	// raw table: 32-byte hashes don't fit into 12-byte files, one item per file
+	require.Equal(t, [][2]uint32{{0, 0}, {1, 32}, {2, 32}, {3, 32}}, readIndex(t, filepath.Join(dir, "hashes.ridx")))
+	data, err := os.ReadFile(filepath.Join(dir, "hashes.0002.rdat"))
+	require.NoError(t, err)
+	require.Equal(t, common.Hash{1}.Bytes(), data)
+
+	// 1-byte items: all in first file
+	require.Equal(t, [][2]uint32{{0, 0}, {0, 1}, {0, 2}, {0, 3}}, readIndex(t, filepath.Join(dir, "diffs.ridx")))
+
+	// compressed table: two items per file
+	compressed := snappy.Encode(nil, bytes.Repeat([]byte{2}, 4))
+	size := uint32(len(compressed))
+	require.Equal(t, [][2]uint32{{0, 0}, {0, size}, {0, 2 * size}, {1, size}}, readIndex(t, filepath.Join(dir, "headers.cidx")))
+	data, err = os.ReadFile(filepath.Join(dir, "headers.0001.cdat"))
+	require.NoError(t, err)
+	require.Equal(t, compressed, data)
+
+	_, err = New(dir)
+	require.Error(t, err)
+}
@@ -0,0 +1,261 @@
+package rawdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/ethdb/cbor"
+)
+
+// Receipts (kv.Receipts) and logs (kv.Log) are stored as CBOR compressed by zstd. Most of their size are addresses of
+// popular contracts and topics of popular events: they repeat across blocks, but rarely inside one value. So every
+// segment of ReceiptsSegmentSize blocks has a dictionary (ReceiptsDict table) trained on receipts of the previous segment.
+//
+// Value is receiptsZstdMarker + zstd frame, its header has ID of the dictionary (0 - compressed without dictionary).
+// Values written before compression (plain CBOR) are read as is.
+const ReceiptsSegmentSize = 100_000
+
+const (
+	receiptsZstdMarker     = 0x00      // CBOR of receipts and logs is an array, it never starts with 0x00
+	receiptsDictBlocks     = 2_000     // blocks of the previous segment to train dictionary on
+	receiptsDictMinSamples = 256       // segment with less samples in the previous one is compressed without dictionary
+	receiptsDictMaxHistory = 64 * 1024 // frequent addresses and topics
+	receiptsDictIDBase     = 32_768    // zstd dictionary IDs below are reserved
+	receiptsDictIDRandBits = 12
+)
+
+// receiptsNoDict - value of ReceiptsDict: segment is compressed without dictionary
+var receiptsNoDict = []byte{0}
+
+// receiptsDictID - ID of dictionary of segment. Dictionary trained again (after rollback of write transaction which
+// trained it) has another ID: training isn't deterministic, so cached decoder of the old one must not be used.
+func receiptsDictID(segment uint64) uint32 {
+	return receiptsDictIDBase + uint32(segment)<<receiptsDictIDRandBits | uint32(rand.Intn(1<<receiptsDictIDRandBits)) // nolint:gosec
+}
+
+func receiptsDictSegment(id uint32) uint64 {
+	return uint64(id-receiptsDictIDBase) >> receiptsDictIDRandBits
+}
+
+type receiptsCodec struct {
+	lock     sync.Mutex
+	plain    *zstd.Encoder
+	segment  uint64 // encoder of the last written segment
+	dict     []byte
+	encoder  *zstd.Encoder
+	decoders *lru.Cache // dictionary ID -> *zstd.Decoder
+}
+
+var receiptsZstd = newReceiptsCodec()
+
+func newReceiptsCodec() *receiptsCodec {
+	decoders, err := lru.New(32)
+	if err != nil {
+		panic(err)
+	}
+	plain, err := zstd.NewWriter(nil, zstd.WithEncoderCRC(false))
+	if err != nil {
+		panic(err)
+	}
+	return &receiptsCodec{plain: plain, decoders: decoders}
+}
+
+// encoderOf - encoder of segment, trains dictionary of segment if it has no one yet
+func (c *receiptsCodec) encoderOf(tx kv.RwTx, segment uint64) (*zstd.Encoder, error) {
+	key := dbutils.EncodeBlockNumber(segment)
+	dict, err := tx.GetOne(ReceiptsDict, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(dict) == 0 {
+		if dict, err = trainReceiptsDict(tx, segment); err != nil {
+			return nil, fmt.Errorf("training receipts dictionary of segment %d: %w", segment, err)
+		}
+		if err = tx.Put(ReceiptsDict, key, dict); err != nil {
+			return nil, err
+		}
+	}
+	if bytes.Equal(dict, receiptsNoDict) {
+		return c.plain, nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.encoder != nil && c.segment == segment && bytes.Equal(c.dict, dict) {
+		return c.encoder, nil
+	}
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderDict(dict), zstd.WithEncoderCRC(false))
+	if err != nil {
+		return nil, err
+	}
+	c.segment, c.dict, c.encoder = segment, common.CopyBytes(dict), encoder
+	return encoder, nil
+}
+
+func (c *receiptsCodec) decoderOf(tx kv.Getter, dictID uint32) (*zstd.Decoder, error) {
+	if d, ok := c.decoders.Get(dictID); ok {
+		return d.(*zstd.Decoder), nil
+	}
+	var opts []zstd.DOption
+	if dictID != 0 {
+		if dictID < receiptsDictIDBase {
+			return nil, fmt.Errorf("unknown receipts dictionary %d", dictID)
+		}
+		segment := receiptsDictSegment(dictID)
+		dict, err := tx.GetOne(ReceiptsDict, dbutils.EncodeBlockNumber(segment))
+		if err != nil {
+			return nil, err
+		}
+		if len(dict) < 8 || binary.LittleEndian.Uint32(dict[4:]) != dictID {
+			return nil, fmt.Errorf("receipts dictionary %d of segment %d not found", dictID, segment)
+		}
+		opts = append(opts, zstd.WithDecoderDicts(common.CopyBytes(dict)))
+	}
+	d, err := zstd.NewReader(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.decoders.Add(dictID, d)
+	return d, nil
+}
+
+// EncodeReceiptsValue - compressed CBOR of receipts or logs of block
+func EncodeReceiptsValue(tx kv.RwTx, blockNum uint64, raw []byte) ([]byte, error) {
+	encoder, err := receiptsZstd.encoderOf(tx, blockNum/ReceiptsSegmentSize)
+	if err != nil {
+		return nil, err
+	}
+	v := encoder.EncodeAll(raw, append(make([]byte, 0, len(raw)/2+16), receiptsZstdMarker))
+	if len(v) >= len(raw) {
+		return raw, nil
+	}
+	return v, nil
+}
+
+// IsCompressedReceiptsValue - value of kv.Receipts or kv.Log is compressed, not plain CBOR
+func IsCompressedReceiptsValue(v []byte) bool {
+	return len(v) > 0 && v[0] == receiptsZstdMarker
+}
+
+// DecodeReceiptsValue - CBOR of receipts (kv.Receipts) or logs (kv.Log) from value of these tables
+func DecodeReceiptsValue(tx kv.Getter, v []byte) ([]byte, error) {
+	if !IsCompressedReceiptsValue(v) {
+		return v, nil
+	}
+	var header zstd.Header
+	if err := header.Decode(v[1:]); err != nil {
+		return nil, err
+	}
+	decoder, err := receiptsZstd.decoderOf(tx, header.DictionaryID)
+	if err != nil {
+		return nil, err
+	}
+	return decoder.DecodeAll(v[1:], nil)
+}
+
+// UnmarshalLogs - logs of transaction from value of kv.Log
+func UnmarshalLogs(tx kv.Getter, v []byte) (types.Logs, error) {
+	raw, err := DecodeReceiptsValue(tx, v)
+	if err != nil {
+		return nil, err
+	}
+	var logs types.Logs
+	if err := cbor.Unmarshal(&logs, bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// trainReceiptsDict - dictionary of segment from receipts and logs of evenly spaced blocks of the previous segment.
+// Its history is frequent addresses and topics, the most frequent are the last - offsets to them are shorter.
+func trainReceiptsDict(tx kv.Tx, segment uint64) ([]byte, error) {
+	if segment == 0 {
+		return receiptsNoDict, nil
+	}
+	var samples [][]byte
+	frequency := map[string]int{}
+	from := (segment - 1) * ReceiptsSegmentSize
+	for blockNum := from; blockNum < from+ReceiptsSegmentSize; blockNum += ReceiptsSegmentSize / receiptsDictBlocks {
+		v, err := tx.GetOne(kv.Receipts, dbutils.EncodeBlockNumber(blockNum))
+		if err != nil {
+			return nil, err
+		}
+		if len(v) == 0 {
+			continue
+		}
+		raw, err := DecodeReceiptsValue(tx, v)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, common.CopyBytes(raw))
+		if err := tx.ForPrefix(kv.Log, dbutils.EncodeBlockNumber(blockNum), func(k, v []byte) error {
+			raw, err := DecodeReceiptsValue(tx, v)
+			if err != nil {
+				return err
+			}
+			var logs types.Logs
+			if err := cbor.Unmarshal(&logs, bytes.NewReader(raw)); err != nil {
+				return err
+			}
+			for _, l := range logs {
+				frequency[string(l.Address[:])]++
+				for _, topic := range l.Topics {
+					frequency[string(topic[:])]++
+				}
+			}
+			samples = append(samples, common.CopyBytes(raw))
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if len(samples) < receiptsDictMinSamples {
+		return receiptsNoDict, nil
+	}
+
+	patterns := make([]string, 0, len(frequency))
+	for pattern, n := range frequency {
+		if n > 1 {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		wi, wj := frequency[patterns[i]]*len(patterns[i]), frequency[patterns[j]]*len(patterns[j])
+		if wi != wj {
+			return wi > wj
+		}
+		return patterns[i] < patterns[j]
+	})
+	size := 0
+	for i, pattern := range patterns {
+		if size+len(pattern) > receiptsDictMaxHistory {
+			patterns = patterns[:i]
+			break
+		}
+		size += len(pattern)
+	}
+	if size < 8 {
+		return receiptsNoDict, nil
+	}
+	history := make([]byte, 0, size)
+	for i := len(patterns) - 1; i >= 0; i-- {
+		history = append(history, patterns[i]...)
+	}
+	return zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       receiptsDictID(segment),
+		Contents: samples,
+		History:  history,
+		Offsets:  [3]int{1, 4, 8},
+		Level:    zstd.SpeedDefault,
+	})
+}
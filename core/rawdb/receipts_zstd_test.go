@@ -0,0 +1,73 @@
+package rawdb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/ethdb/cbor"
+	"github.com/stretchr/testify/require"
+)
+
+func testReceipts(blockNum uint64) types.Receipts {
+	transfer := common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	receipts := make(types.Receipts, 3)
+	for i := range receipts {
+		receipts[i] = &types.Receipt{
+			Status:            types.ReceiptStatusSuccessful,
+			CumulativeGasUsed: blockNum*1000 + uint64(i)*21000,
+			Logs: []*types.Log{{
+				Address: common.BytesToAddress([]byte{0xa0, byte(i)}),
+				Topics:  []common.Hash{transfer, common.BytesToHash([]byte{byte(blockNum), byte(i)}), {0xee}},
+				Data:    common.BigToHash(common.Big1).Bytes(),
+			}},
+		}
+	}
+	return receipts
+}
+
+func TestReceiptsZstd(t *testing.T) {
+	require := require.New(t)
+	_, tx := memdb.NewTestTx(t)
+
+	// segment 0 has no previous segment - compressed without dictionary
+	for blockNum := uint64(0); blockNum < ReceiptsSegmentSize; blockNum += ReceiptsSegmentSize / receiptsDictBlocks {
+		require.NoError(AppendReceipts(tx, blockNum, testReceipts(blockNum)))
+	}
+	dict, err := tx.GetOne(ReceiptsDict, dbutils.EncodeBlockNumber(0))
+	require.NoError(err)
+	require.Equal(receiptsNoDict, dict)
+
+	// segment 1 is compressed with dictionary trained on segment 0
+	blockNum := uint64(ReceiptsSegmentSize + 1)
+	receipts := testReceipts(blockNum)
+	require.NoError(WriteReceipts(tx, blockNum, receipts))
+	dict, err = tx.GetOne(ReceiptsDict, dbutils.EncodeBlockNumber(1))
+	require.NoError(err)
+	require.Greater(len(dict), 8)
+
+	v, err := tx.GetOne(kv.Log, dbutils.LogKey(blockNum, 0))
+	require.NoError(err)
+	require.True(IsCompressedReceiptsValue(v))
+	var header zstd.Header
+	require.NoError(header.Decode(v[1:]))
+	require.Equal(uint64(1), receiptsDictSegment(header.DictionaryID))
+	buf := bytes.NewBuffer(nil)
+	require.NoError(cbor.Marshal(buf, receipts[0].Logs))
+	require.Less(len(v), buf.Len())
+
+	logs, err := UnmarshalLogs(tx, v)
+	require.NoError(err)
+	require.Equal(receipts[0].Logs[0].Topics, logs[0].Topics)
+	require.NoError(checkReceiptsRLP(ReadRawReceipts(tx, blockNum), receipts))
+
+	// plain CBOR written before compression is read as is
+	logs, err = UnmarshalLogs(tx, buf.Bytes())
+	require.NoError(err)
+	require.Equal(receipts[0].Logs[0].Address, logs[0].Address)
+}
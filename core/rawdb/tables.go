@@ -0,0 +1,143 @@
+package rawdb
+
+import (
+	"sort"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// UncleInclusion - index of canonical blocks which included given uncle (ommer)
+// key - uncle hash
+// value - number of block which included this uncle
+const UncleInclusion = "UncleInclusion"
+
+// TxLookupCompact - compact layout of kv.TxLookup (v2). Two-level structure (DupSort):
+// key - first TxLookupPrefixLen bytes of transaction hash
+// value - varint encoded number of block which included transaction. Multiple values possible - if prefixes collide.
+const TxLookupCompact = "TxLookupCompact"
+
+// TxLookupBloom - bloom filters of hashes of transactions of segments of TxLookupBloomSegmentSize blocks. They replace
+// TxLookupCompact for blocks pruned by --prune=t when `txbloom` experiment is enabled. See ReadTxLookupEntry.
+// key - segment number (8 bytes big-endian)
+// value - bloom filter of transaction hashes, see NewTxBloom
+const TxLookupBloom = "TxLookupBloom"
+
+// LastForkchoice - last fork choice state received from consensus layer via engine_forkchoiceUpdated
+// key - one of ForkchoiceHeadKey, ForkchoiceSafeKey, ForkchoiceFinalizedKey, ForkchoiceUpdatedAtKey
+// value - block hash, or unix timestamp (big-endian uint64) of last update
+const LastForkchoice = "LastForkchoice"
+
+// StateAccessSet - accounts and storage slots accessed (read or written) by each block, written by Execution stage
+// when `stateaccess` experiment is enabled. Two-level structure (DupSort):
+// key - block number (8 bytes big-endian)
+// value - address (20 bytes) or address + storage key (20+32 bytes), with suffix 0x01 if item was deleted by block
+const StateAccessSet = "StateAccessSet"
+
+// StateLastAccess - number of the last block which accessed given account or storage slot (state expiry research)
+// key - address (20 bytes) or address + storage key (20+32 bytes)
+// value - block number (8 bytes big-endian)
+const StateLastAccess = "StateLastAccess"
+
+// StateLastAccessChangeSet - previous values of StateLastAccess, to unwind it. Two-level structure (DupSort):
+// key - block number (8 bytes big-endian)
+// value - key of StateLastAccess + previous block number (8 bytes big-endian, 0 - item was not accessed before)
+const StateLastAccessChangeSet = "StateLastAccessChangeSet"
+
+// StateDiffs - state diffs of transactions in the form of trace_replayBlockTransactions "stateDiff" trace, written by
+// StateDiffs stage when `statediffs` experiment is enabled. See turbo/statediff.
+// key - block number (8 bytes big-endian) + transaction index (4 bytes big-endian)
+// value - RLP encoded statediff.Tx
+const StateDiffs = "StateDiffs"
+
+// CallSelectorSet - contracts and 4-byte selectors of functions called by each block, written by Execution stage
+// together with kv.CallTraceSet. Two-level structure (DupSort):
+// key - block number (8 bytes big-endian)
+// value - address of called code (20 bytes) + selector (4 bytes)
+const CallSelectorSet = "CallSelectorSet"
+
+// CallSelectorIndex - blocks which called given function of given contract, built by CallTraces stage
+// key - address (20 bytes) + selector (4 bytes) + chunk suffix (8 bytes big-endian, see bitmapdb.ChunkLimit)
+// value - roaring64 bitmap of block numbers
+const CallSelectorIndex = "CallSelectorIndex"
+
+// CodeHistory - changes of contract code by deployments and self-destructs, written by Execution stage. Contracts
+// of genesis allocation are not recorded. Two-level structure (DupSort):
+// key - address (20 bytes)
+// value - block number (8 bytes big-endian) + incarnation (8 bytes big-endian) + code hash (32 bytes, zero if
+// contract was self-destructed)
+const CodeHistory = "CodeHistory"
+
+// TxCallSet - addresses touched by internal calls (callers, callees and self-destruct beneficiaries) of each
+// transaction, written by Execution stage when `appearances` experiment is enabled. Two-level structure (DupSort):
+// key - block number (8 bytes big-endian)
+// value - address (20 bytes) + transaction index (4 bytes big-endian)
+const TxCallSet = "TxCallSet"
+
+// AppearanceIndex - transactions in which given address appears (as sender, recipient, internal call participant,
+// log address or log topic), built by AddressAppearances stage. Appearance is encoded by AppearanceID.
+// key - address (20 bytes) + chunk suffix (8 bytes big-endian, see bitmapdb.ChunkLimit)
+// value - roaring64 bitmap of appearance ids
+const AppearanceIndex = "AppearanceIndex"
+
+// ReorgLog - reorgs of canonical chain observed by Headers stage, ring buffer of the last MaxReorgLogEntries.
+// Encoding see WriteReorg.
+// key - reorg id (8 bytes big-endian, grows by 1)
+// value - old head, new head, common ancestor (each block number 8 bytes big-endian + hash 32 bytes) + unix time
+// (8 bytes big-endian)
+const ReorgLog = "ReorgLog"
+
+// PayloadLog - payloads built by mining stages (every recommit of every height), for analysis of block production.
+// Entries of blocks older than PayloadStatsRetention are deleted. See WritePayloadStats.
+// key - block number (8 bytes big-endian) + unix time in nanoseconds when payload was built (8 bytes big-endian)
+// value - RLP encoded PayloadStats
+const PayloadLog = "PayloadLog"
+
+// ReceiptsDict - zstd dictionaries which compress receipts (kv.Receipts) and logs (kv.Log) of segments of
+// ReceiptsSegmentSize blocks. Dictionary of a segment is trained on the previous one. See EncodeReceiptsValue.
+// key - segment number (8 bytes big-endian)
+// value - zstd dictionary, empty - segment is compressed without dictionary
+const ReceiptsDict = "ReceiptsDict"
+
+// ErigonTables - tables which are defined in this repository (and not in erigon-lib).
+// They are registered in kv.ChaindataTables at init, to be opened/created together with all other chaindata tables.
+var ErigonTables = kv.TableCfg{
+	UncleInclusion:  {},
+	TxLookupCompact: {Flags: kv.DupSort},
+	TxLookupBloom:   {},
+	LastForkchoice:  {},
+
+	StateAccessSet:           {Flags: kv.DupSort},
+	StateLastAccess:          {},
+	StateLastAccessChangeSet: {Flags: kv.DupSort},
+
+	StateDiffs: {},
+
+	CallSelectorSet:   {Flags: kv.DupSort},
+	CallSelectorIndex: {},
+
+	CodeHistory: {Flags: kv.DupSort},
+
+	TxCallSet:       {Flags: kv.DupSort},
+	AppearanceIndex: {},
+
+	ReorgLog: {},
+
+	PayloadLog: {},
+
+	ReceiptsDict: {},
+}
+
+func init() {
+	registerTables(ErigonTables)
+}
+
+func registerTables(cfg kv.TableCfg) {
+	for name, item := range cfg {
+		if _, ok := kv.ChaindataTablesCfg[name]; ok {
+			continue
+		}
+		kv.ChaindataTables = append(kv.ChaindataTables, name)
+		kv.ChaindataTablesCfg[name] = item
+	}
+	sort.Strings(kv.ChaindataTables)
+}
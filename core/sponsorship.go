@@ -0,0 +1,90 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+)
+
+// ErrUnknownSponsorshipScheme is returned if chain config enables sponsored transactions
+// with scheme which has no registered FeePayerResolver.
+var ErrUnknownSponsorshipScheme = errors.New("unknown sponsorship scheme")
+
+// FeePayerResolver is an extension point for sponsored transactions experiments (EIP-2711 style):
+// it decides which account pays for gas of a message. It's consulted during block execution,
+// so it must depend only on the state and the message.
+type FeePayerResolver interface {
+	// FeePayer returns account which pays for gas of msg, msg.From() means "not sponsored"
+	FeePayer(ibs vm.IntraBlockState, msg Message) common.Address
+}
+
+var feePayerResolvers = map[string]func(cfg *params.SponsorshipConfig) FeePayerResolver{
+	"registry": func(cfg *params.SponsorshipConfig) FeePayerResolver { return registryResolver{registry: cfg.Registry} },
+}
+
+// RegisterFeePayerResolver makes resolver available to chain configs by scheme name. Not thread-safe, must be called from init().
+func RegisterFeePayerResolver(scheme string, constructor func(cfg *params.SponsorshipConfig) FeePayerResolver) {
+	feePayerResolvers[scheme] = constructor
+}
+
+// FeePayer returns account which pays for gas of msg in block blockNum
+func FeePayer(config *params.ChainConfig, blockNum uint64, ibs vm.IntraBlockState, msg Message) (common.Address, error) {
+	if config == nil || !config.IsSponsorship(blockNum) {
+		return msg.From(), nil
+	}
+	constructor, ok := feePayerResolvers[config.Sponsorship.Scheme]
+	if !ok {
+		return common.Address{}, fmt.Errorf("%w: %s", ErrUnknownSponsorshipScheme, config.Sponsorship.Scheme)
+	}
+	return constructor(config.Sponsorship).FeePayer(ibs, msg), nil
+}
+
+// ValidateSponsoredTx is the check for pools and block builders: fee payer of sponsored message must afford
+// gas * feeCap, and sender must afford value. Not sponsored messages are not checked.
+func ValidateSponsoredTx(config *params.ChainConfig, blockNum uint64, ibs vm.IntraBlockState, msg Message) error {
+	feePayer, err := FeePayer(config, blockNum, ibs, msg)
+	if err != nil {
+		return err
+	}
+	if feePayer == msg.From() {
+		return nil
+	}
+	price := msg.FeeCap()
+	if price == nil {
+		price = msg.GasPrice()
+	}
+	gasCost, overflow := new(uint256.Int).MulOverflow(uint256.NewInt(msg.Gas()), price)
+	if overflow {
+		return fmt.Errorf("%w: fee payer %v", ErrInsufficientFunds, feePayer.Hex())
+	}
+	if have := ibs.GetBalance(feePayer); have.Lt(gasCost) {
+		return fmt.Errorf("%w: fee payer %v have %v want %v", ErrInsufficientFunds, feePayer.Hex(), have, gasCost)
+	}
+	if have := ibs.GetBalance(msg.From()); have.Lt(msg.Value()) {
+		return fmt.Errorf("%w: address %v have %v want %v", ErrInsufficientFunds, msg.From().Hex(), have, msg.Value())
+	}
+	return nil
+}
+
+// registryResolver - sponsors are assigned by registry contract, which keeps them in
+// Solidity's `mapping(address => address)` at storage slot 0: sender => fee payer
+type registryResolver struct {
+	registry common.Address
+}
+
+func (r registryResolver) FeePayer(ibs vm.IntraBlockState, msg Message) common.Address {
+	var key [64]byte
+	copy(key[12:32], msg.From().Bytes())
+	slot := common.BytesToHash(crypto.Keccak256(key[:]))
+	var value uint256.Int
+	ibs.GetState(r.registry, &slot, &value)
+	if value.IsZero() {
+		return msg.From()
+	}
+	return value.Bytes20()
+}
@@ -0,0 +1,107 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+// sponsorSlot - storage slot of `mapping(address => address)` at slot 0
+func sponsorSlot(sender common.Address) common.Hash {
+	var key [64]byte
+	copy(key[12:32], sender.Bytes())
+	return common.BytesToHash(crypto.Keccak256(key[:]))
+}
+
+func TestSponsoredTransaction(t *testing.T) {
+	var (
+		senderKey, _     = crypto.GenerateKey()
+		sender           = crypto.PubkeyToAddress(senderKey.PublicKey)
+		poorSenderKey, _ = crypto.GenerateKey()
+		poorSender       = crypto.PubkeyToAddress(poorSenderKey.PublicKey)
+		sponsor          = common.HexToAddress("0x5000")
+		poorSponsor      = common.HexToAddress("0x5001")
+		registry         = common.HexToAddress("0x6000")
+		funds            = big.NewInt(params.Ether)
+		gasPrice         = uint256.NewInt(2 * params.GWei)
+	)
+	config := *params.TestChainConfig
+	config.Sponsorship = &params.SponsorshipConfig{Block: big.NewInt(0), Scheme: "registry", Registry: registry}
+	gspec := &core.Genesis{
+		Config: &config,
+		Alloc: core.GenesisAlloc{
+			sponsor: {Balance: funds},
+			registry: {
+				Balance: big.NewInt(0),
+				Storage: map[common.Hash]common.Hash{
+					sponsorSlot(sender):     common.BytesToHash(sponsor.Bytes()),
+					sponsorSlot(poorSender): common.BytesToHash(poorSponsor.Bytes()),
+				},
+			},
+		},
+	}
+	m := stages.MockWithGenesis(t, gspec, senderKey)
+	signer := types.LatestSigner(&config)
+
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 1, func(i int, b *core.BlockGen) {
+		txn, err := types.SignTx(types.NewTransaction(0, common.Address{2}, uint256.NewInt(0), params.TxGas, gasPrice, nil), *signer, senderKey)
+		require.NoError(t, err)
+		b.AddTx(txn)
+	}, false)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	tx, err := m.DB.BeginRo(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	ibs := state.New(state.NewPlainStateReader(tx))
+	require.Equal(t, uint64(1), ibs.GetNonce(sender))
+	require.True(t, ibs.GetBalance(sender).IsZero())
+	gasCost := new(uint256.Int).Mul(uint256.NewInt(params.TxGas), gasPrice)
+	expected, _ := uint256.FromBig(funds)
+	require.Equal(t, expected.Sub(expected, gasCost), ibs.GetBalance(sponsor))
+
+	// pool-side check
+	txn, err := types.SignTx(types.NewTransaction(1, common.Address{2}, uint256.NewInt(0), params.TxGas, gasPrice, nil), *signer, senderKey)
+	require.NoError(t, err)
+	msg, err := txn.AsMessage(*signer, nil)
+	require.NoError(t, err)
+	require.NoError(t, core.ValidateSponsoredTx(&config, 2, ibs, msg))
+
+	txn, err = types.SignTx(types.NewTransaction(0, common.Address{2}, uint256.NewInt(0), params.TxGas, gasPrice, nil), *signer, poorSenderKey)
+	require.NoError(t, err)
+	msg, err = txn.AsMessage(*signer, nil)
+	require.NoError(t, err)
+	require.True(t, errors.Is(core.ValidateSponsoredTx(&config, 2, ibs, msg), core.ErrInsufficientFunds))
+
+	// sender of sponsored transaction pays value: the transaction is rejected before sponsor is charged
+	txn, err = types.SignTx(types.NewTransaction(1, common.Address{2}, uint256.NewInt(1), params.TxGas, gasPrice, nil), *signer, senderKey)
+	require.NoError(t, err)
+	msg, err = txn.AsMessage(*signer, nil)
+	require.NoError(t, err)
+	require.True(t, errors.Is(core.ValidateSponsoredTx(&config, 2, ibs, msg), core.ErrInsufficientFunds))
+	header := types.CopyHeader(chain.Blocks[0].Header())
+	header.Number = big.NewInt(2)
+	var gasUsed uint64
+	getHeader := func(common.Hash, uint64) *types.Header { return nil }
+	contractHasTEVM := func(common.Hash) (bool, error) { return false, nil }
+	_, _, err = core.ApplyTransaction(&config, getHeader, m.Engine, nil, new(core.GasPool).AddGas(header.GasLimit), ibs, state.NewNoopWriter(), header, txn, &gasUsed, vm.Config{}, contractHasTEVM)
+	require.True(t, errors.Is(err, core.ErrInsufficientFunds))
+	require.Equal(t, expected, ibs.GetBalance(sponsor))
+
+	unknown := config
+	unknown.Sponsorship = &params.SponsorshipConfig{Block: big.NewInt(0), Scheme: "unknown"}
+	require.True(t, errors.Is(core.ValidateSponsoredTx(&unknown, 2, ibs, msg), core.ErrUnknownSponsorshipScheme))
+}
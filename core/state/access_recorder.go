@@ -0,0 +1,114 @@
+package state
+
+import (
+	"sort"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+)
+
+// AccessRecorder collects accounts and storage slots accessed during execution of a block - for state expiry research.
+// Only existing items are recorded: reads of absent accounts/slots don't keep anything alive.
+// Key of account is its address, key of storage slot is address + storage key (incarnation is not part of the key).
+type AccessRecorder struct {
+	items map[string]bool // key => deleted
+}
+
+func NewAccessRecorder() *AccessRecorder {
+	return &AccessRecorder{items: map[string]bool{}}
+}
+
+func (ar *AccessRecorder) touch(key []byte) {
+	if _, ok := ar.items[string(key)]; !ok {
+		ar.items[string(key)] = false
+	}
+}
+
+func (ar *AccessRecorder) set(key []byte, deleted bool) {
+	ar.items[string(key)] = deleted
+}
+
+// Len - amount of recorded items
+func (ar *AccessRecorder) Len() int {
+	return len(ar.items)
+}
+
+// ForEach walks recorded items in order of their keys. deleted == true means item doesn't exist after the block
+func (ar *AccessRecorder) ForEach(walker func(key []byte, deleted bool) error) error {
+	keys := make([]string, 0, len(ar.items))
+	for k := range ar.items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := walker([]byte(k), ar.items[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reader wraps r to record accounts and storage slots which were read
+func (ar *AccessRecorder) Reader(r StateReader) StateReader {
+	return &accessRecordingReader{StateReader: r, rec: ar}
+}
+
+// Writer wraps w to record accounts and storage slots which were written or deleted
+func (ar *AccessRecorder) Writer(w WriterWithChangeSets) WriterWithChangeSets {
+	return &accessRecordingWriter{WriterWithChangeSets: w, rec: ar}
+}
+
+func storageAccessKey(address common.Address, key *common.Hash) []byte {
+	k := make([]byte, common.AddressLength+common.HashLength)
+	copy(k, address[:])
+	copy(k[common.AddressLength:], key[:])
+	return k
+}
+
+type accessRecordingReader struct {
+	StateReader
+	rec *AccessRecorder
+}
+
+func (r *accessRecordingReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	a, err := r.StateReader.ReadAccountData(address)
+	if err != nil {
+		return nil, err
+	}
+	if a != nil {
+		r.rec.touch(address[:])
+	}
+	return a, nil
+}
+
+func (r *accessRecordingReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	v, err := r.StateReader.ReadAccountStorage(address, incarnation, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(v) > 0 {
+		r.rec.touch(storageAccessKey(address, key))
+	}
+	return v, nil
+}
+
+type accessRecordingWriter struct {
+	WriterWithChangeSets
+	rec *AccessRecorder
+}
+
+func (w *accessRecordingWriter) UpdateAccountData(address common.Address, original, account *accounts.Account) error {
+	w.rec.set(address[:], false)
+	return w.WriterWithChangeSets.UpdateAccountData(address, original, account)
+}
+
+func (w *accessRecordingWriter) DeleteAccount(address common.Address, original *accounts.Account) error {
+	w.rec.set(address[:], true)
+	return w.WriterWithChangeSets.DeleteAccount(address, original)
+}
+
+func (w *accessRecordingWriter) WriteAccountStorage(address common.Address, incarnation uint64, key *common.Hash, original, value *uint256.Int) error {
+	w.rec.set(storageAccessKey(address, key), value.IsZero())
+	return w.WriterWithChangeSets.WriteAccountStorage(address, incarnation, key, original, value)
+}
@@ -0,0 +1,84 @@
+package state
+
+import (
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+)
+
+// Backend - state store hosted outside of the node database (in another process or on another machine), which
+// Execution stage executes blocks against. Node still writes the changes to its own PlainState, so changesets, history
+// and verification of state root work as usual.
+type Backend interface {
+	// Reader - latest state of the backend
+	Reader() StateReader
+	// Writer - receives changes of block blockNum, WriteChangeSets makes them visible to Reader. On unwind, receives
+	// values restored by the unwind and blockNum is the unwind point.
+	Writer(blockNum uint64) WriterWithChangeSets
+}
+
+// TeeWriter - sends every change to both writers, the first one is called first
+type TeeWriter struct {
+	first, second WriterWithChangeSets
+}
+
+func NewTeeWriter(first, second WriterWithChangeSets) *TeeWriter {
+	return &TeeWriter{first: first, second: second}
+}
+
+// ChangeSetWriter - of the first writer, if it has one
+func (w *TeeWriter) ChangeSetWriter() *ChangeSetWriter {
+	if hasChangeSet, ok := w.first.(interface{ ChangeSetWriter() *ChangeSetWriter }); ok {
+		return hasChangeSet.ChangeSetWriter()
+	}
+	return nil
+}
+
+func (w *TeeWriter) UpdateAccountData(address common.Address, original, account *accounts.Account) error {
+	if err := w.first.UpdateAccountData(address, original, account); err != nil {
+		return err
+	}
+	return w.second.UpdateAccountData(address, original, account)
+}
+
+func (w *TeeWriter) UpdateAccountCode(address common.Address, incarnation uint64, codeHash common.Hash, code []byte) error {
+	if err := w.first.UpdateAccountCode(address, incarnation, codeHash, code); err != nil {
+		return err
+	}
+	return w.second.UpdateAccountCode(address, incarnation, codeHash, code)
+}
+
+func (w *TeeWriter) DeleteAccount(address common.Address, original *accounts.Account) error {
+	if err := w.first.DeleteAccount(address, original); err != nil {
+		return err
+	}
+	return w.second.DeleteAccount(address, original)
+}
+
+func (w *TeeWriter) WriteAccountStorage(address common.Address, incarnation uint64, key *common.Hash, original, value *uint256.Int) error {
+	if err := w.first.WriteAccountStorage(address, incarnation, key, original, value); err != nil {
+		return err
+	}
+	return w.second.WriteAccountStorage(address, incarnation, key, original, value)
+}
+
+func (w *TeeWriter) CreateContract(address common.Address) error {
+	if err := w.first.CreateContract(address); err != nil {
+		return err
+	}
+	return w.second.CreateContract(address)
+}
+
+func (w *TeeWriter) WriteChangeSets() error {
+	if err := w.first.WriteChangeSets(); err != nil {
+		return err
+	}
+	return w.second.WriteChangeSets()
+}
+
+func (w *TeeWriter) WriteHistory() error {
+	if err := w.first.WriteHistory(); err != nil {
+		return err
+	}
+	return w.second.WriteHistory()
+}
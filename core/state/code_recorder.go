@@ -0,0 +1,71 @@
+package state
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+)
+
+// CodeChange - code of the contract after the block: new incarnation means the contract was (re)deployed,
+// zero code hash means it was self-destructed
+type CodeChange struct {
+	Incarnation uint64
+	CodeHash    common.Hash
+}
+
+// CodeRecorder collects changes of contract code made by a block: deployments (including CREATE2 redeployments
+// to the address of self-destructed contract) and self-destructs. Only the last change of every address is kept.
+type CodeRecorder struct {
+	changes map[common.Address]CodeChange
+}
+
+func NewCodeRecorder() *CodeRecorder {
+	return &CodeRecorder{changes: map[common.Address]CodeChange{}}
+}
+
+// Len - amount of addresses with changed code
+func (cr *CodeRecorder) Len() int {
+	return len(cr.changes)
+}
+
+// ForEach walks recorded changes in order of addresses
+func (cr *CodeRecorder) ForEach(walker func(address common.Address, change CodeChange) error) error {
+	addrs := make([]common.Address, 0, len(cr.changes))
+	for addr := range cr.changes {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+	for _, addr := range addrs {
+		if err := walker(addr, cr.changes[addr]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writer wraps w to record code changes
+func (cr *CodeRecorder) Writer(w WriterWithChangeSets) WriterWithChangeSets {
+	return &codeRecordingWriter{WriterWithChangeSets: w, rec: cr}
+}
+
+type codeRecordingWriter struct {
+	WriterWithChangeSets
+	rec *CodeRecorder
+}
+
+func (w *codeRecordingWriter) UpdateAccountData(address common.Address, original, account *accounts.Account) error {
+	// every contract creation gets new incarnation, even if there was no contract at the address before
+	if account.Incarnation != original.Incarnation {
+		w.rec.changes[address] = CodeChange{Incarnation: account.Incarnation, CodeHash: account.CodeHash}
+	}
+	return w.WriterWithChangeSets.UpdateAccountData(address, original, account)
+}
+
+func (w *codeRecordingWriter) DeleteAccount(address common.Address, original *accounts.Account) error {
+	if original.Incarnation > 0 {
+		w.rec.changes[address] = CodeChange{Incarnation: original.Incarnation}
+	}
+	return w.WriterWithChangeSets.DeleteAccount(address, original)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 
 	"github.com/RoaringBitmap/roaring/roaring64"
 	"github.com/ledgerwatch/erigon-lib/kv"
@@ -16,8 +17,62 @@ import (
 	"github.com/ledgerwatch/erigon/ethdb/bitmapdb"
 )
 
-func GetAsOf(tx kv.Tx, indexC kv.Cursor, changesC kv.CursorDupSort, storage bool, key []byte, timestamp uint64) ([]byte, error) {
-	v, err := FindByHistory(tx, indexC, changesC, storage, key, timestamp)
+// HistorySnapshots - history of state in immutable files, for blocks before To()
+type HistorySnapshots interface {
+	To() uint64
+	FindByHistory(storage bool, key []byte, timestamp uint64) ([]byte, bool)
+	LatestChange(storage bool, key []byte, before uint64) (uint64, bool)
+}
+
+// findInHistorySnapshots - history lookups for blocks covered by files read files before database, history can be nil
+func findInHistorySnapshots(history HistorySnapshots, storage bool, key []byte, timestamp uint64) ([]byte, bool) {
+	if history == nil || timestamp >= history.To() {
+		return nil, false
+	}
+	return history.FindByHistory(storage, key, timestamp)
+}
+
+// LatestAccountChange - last block <= blockNum which changed the account: by history index of database, then by
+// history snapshots (can be nil) for blocks which are pruned from database
+func LatestAccountChange(tx kv.Tx, history HistorySnapshots, address common.Address, blockNum uint64) (uint64, bool, error) {
+	c, err := tx.Cursor(kv.AccountsHistory)
+	if err != nil {
+		return 0, false, err
+	}
+	defer c.Close()
+	// chunk key suffix is the last block of chunk: first chunk which can have blockNum, then previous chunks
+	k, v, err := c.Seek(changeset.Mapper[kv.AccountChangeSet].IndexChunkKey(address[:], blockNum))
+	if err != nil {
+		return 0, false, err
+	}
+	if k == nil {
+		k, v, err = c.Last()
+	} else if !bytes.HasPrefix(k, address[:]) {
+		k, v, err = c.Prev()
+	}
+	for ; err == nil && k != nil && bytes.HasPrefix(k, address[:]); k, v, err = c.Prev() {
+		index := roaring64.New()
+		if _, err = index.ReadFrom(bytes.NewReader(v)); err != nil {
+			return 0, false, err
+		}
+		index.RemoveRange(blockNum+1, math.MaxUint64)
+		if !index.IsEmpty() {
+			return index.Maximum(), true, nil
+		}
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	if history == nil {
+		return 0, false, nil
+	}
+	changed, ok := history.LatestChange(false, address[:], blockNum+1)
+	return changed, ok, nil
+}
+
+func GetAsOf(tx kv.Tx, history HistorySnapshots, indexC kv.Cursor, changesC kv.CursorDupSort, storage bool, key []byte, timestamp uint64) ([]byte, error) {
+	v, err := FindByHistory(tx, history, indexC, changesC, storage, key, timestamp)
 	if err == nil {
 		return v, nil
 	}
@@ -27,7 +82,7 @@ func GetAsOf(tx kv.Tx, indexC kv.Cursor, changesC kv.CursorDupSort, storage bool
 	return tx.GetOne(kv.PlainState, key)
 }
 
-func FindByHistory(tx kv.Tx, indexC kv.Cursor, changesC kv.CursorDupSort, storage bool, key []byte, timestamp uint64) ([]byte, error) {
+func FindByHistory(tx kv.Tx, history HistorySnapshots, indexC kv.Cursor, changesC kv.CursorDupSort, storage bool, key []byte, timestamp uint64) ([]byte, error) {
 	var csBucket string
 	if storage {
 		csBucket = kv.StorageChangeSet
@@ -35,6 +90,13 @@ func FindByHistory(tx kv.Tx, indexC kv.Cursor, changesC kv.CursorDupSort, storag
 		csBucket = kv.AccountChangeSet
 	}
 
+	if data, ok := findInHistorySnapshots(history, storage, key, timestamp); ok {
+		if storage {
+			return data, nil
+		}
+		return restoreCodeHash(tx, key, data)
+	}
+
 	k, v, seekErr := indexC.Seek(changeset.Mapper[csBucket].IndexChunkKey(key, timestamp))
 	if seekErr != nil {
 		return nil, seekErr
@@ -78,28 +140,32 @@ func FindByHistory(tx kv.Tx, indexC kv.Cursor, changesC kv.CursorDupSort, storag
 		return nil, ethdb.ErrKeyNotFound
 	}
 
-	//restore codehash
 	if !storage {
-		var acc accounts.Account
-		if err := acc.DecodeForStorage(data); err != nil {
+		return restoreCodeHash(tx, key, data)
+	}
+
+	return data, nil
+}
+
+// restoreCodeHash - changesets of accounts have empty code hash of contracts
+func restoreCodeHash(tx kv.Tx, key, data []byte) ([]byte, error) {
+	var acc accounts.Account
+	if err := acc.DecodeForStorage(data); err != nil {
+		return nil, err
+	}
+	if acc.Incarnation > 0 && acc.IsEmptyCodeHash() {
+		var codeHash []byte
+		var err error
+		codeHash, err = tx.GetOne(kv.PlainContractCode, dbutils.PlainGenerateStoragePrefix(key, acc.Incarnation))
+		if err != nil {
 			return nil, err
 		}
-		if acc.Incarnation > 0 && acc.IsEmptyCodeHash() {
-			var codeHash []byte
-			var err error
-			codeHash, err = tx.GetOne(kv.PlainContractCode, dbutils.PlainGenerateStoragePrefix(key, acc.Incarnation))
-			if err != nil {
-				return nil, err
-			}
-			if len(codeHash) > 0 {
-				acc.CodeHash.SetBytes(codeHash)
-			}
-			data = make([]byte, acc.EncodingLengthForStorage())
-			acc.EncodeForStorage(data)
+		if len(codeHash) > 0 {
+			acc.CodeHash.SetBytes(codeHash)
 		}
-		return data, nil
+		data = make([]byte, acc.EncodingLengthForStorage())
+		acc.EncodeForStorage(data)
 	}
-
 	return data, nil
 }
 
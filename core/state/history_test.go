@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/RoaringBitmap/roaring/roaring64"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/erigon-lib/kv"
@@ -134,7 +135,7 @@ func TestMutationCommit(t *testing.T) {
 		for k, v := range accHistoryStateStorage[i] {
 			c1, _ := tx.Cursor(kv.StorageHistory)
 			c2, _ := tx.CursorDupSort(kv.StorageChangeSet)
-			res, err := GetAsOf(tx, c1, c2, true /* storage */, dbutils.PlainGenerateCompositeStorageKey(addr.Bytes(), acc.Incarnation, k.Bytes()), 1)
+			res, err := GetAsOf(tx, nil, c1, c2, true /* storage */, dbutils.PlainGenerateCompositeStorageKey(addr.Bytes(), acc.Incarnation, k.Bytes()), 1)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -1144,3 +1145,38 @@ func assertChangesEquals(t *testing.T, changesObtained, changesExpected *changes
 		t.Fatal("block result is incorrect")
 	}
 }
+
+func TestLatestAccountChange(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	addr, next := common.Address{2}, common.Address{3}
+	putChunk := func(address common.Address, chunkEnd uint64, blocks ...uint64) {
+		v, err := roaring64.BitmapOf(blocks...).ToBytes()
+		require.NoError(t, err)
+		require.NoError(t, tx.Put(kv.AccountsHistory, changeset.Mapper[kv.AccountChangeSet].IndexChunkKey(address[:], chunkEnd), v))
+	}
+	putChunk(addr, 5, 1, 3, 5)
+	putChunk(addr, math.MaxUint64, 10, 20)
+	putChunk(next, math.MaxUint64, 7)
+
+	for _, tt := range []struct {
+		address  common.Address
+		blockNum uint64
+		changed  uint64
+		ok       bool
+	}{
+		{addr, 0, 0, false},
+		{addr, 4, 3, true},
+		{addr, 5, 5, true},
+		{addr, 9, 5, true}, // previous chunk
+		{addr, 100, 20, true},
+		{next, 6, 0, false},
+		{next, 7, 7, true},
+		{common.Address{1}, 100, 0, false},
+		{common.Address{0xff}, 100, 0, false},
+	} {
+		changed, ok, err := LatestAccountChange(tx, nil, tt.address, tt.blockNum)
+		require.NoError(t, err)
+		require.Equal(t, tt.ok, ok, "%x at %d", tt.address, tt.blockNum)
+		require.Equal(t, tt.changed, changed, "%x at %d", tt.address, tt.blockNum)
+	}
+}
@@ -19,13 +19,16 @@ package state
 import (
 	"bytes"
 	"encoding/binary"
+	"sort"
 
 	"github.com/google/btree"
 	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common/length"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/dbutils"
 	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 	"github.com/ledgerwatch/log/v3"
 )
 
@@ -43,11 +46,13 @@ type PlainState struct {
 	accHistoryC, storageHistoryC kv.Cursor
 	accChangesC, storageChangesC kv.CursorDupSort
 	tx                           kv.Tx
+	history                      HistorySnapshots
 	blockNr                      uint64
 	storage                      map[common.Address]*btree.BTree
 }
 
-func NewPlainState(tx kv.Tx, blockNr uint64) *PlainState {
+// NewPlainState - state as of block blockNr, history is read from history snapshots (can be nil) before database
+func NewPlainState(tx kv.Tx, blockNr uint64, history HistorySnapshots) *PlainState {
 	c1, _ := tx.Cursor(kv.AccountsHistory)
 	c2, _ := tx.Cursor(kv.StorageHistory)
 	c3, _ := tx.CursorDupSort(kv.AccountChangeSet)
@@ -55,6 +60,7 @@ func NewPlainState(tx kv.Tx, blockNr uint64) *PlainState {
 
 	return &PlainState{
 		tx:          tx,
+		history:     history,
 		blockNr:     blockNr,
 		storage:     make(map[common.Address]*btree.BTree),
 		accHistoryC: c1, storageHistoryC: c2, accChangesC: c3, storageChangesC: c4,
@@ -73,7 +79,7 @@ func (s *PlainState) ForEachStorage(addr common.Address, startLocation common.Ha
 	st := btree.New(16)
 	var k [common.AddressLength + common.IncarnationLength + common.HashLength]byte
 	copy(k[:], addr[:])
-	accData, err := GetAsOf(s.tx, s.accHistoryC, s.accChangesC, false /* storage */, addr[:], s.blockNr+1)
+	accData, err := GetAsOf(s.tx, s.history, s.accHistoryC, s.accChangesC, false /* storage */, addr[:], s.blockNr+1)
 	if err != nil {
 		return err
 	}
@@ -144,8 +150,142 @@ func (s *PlainState) ForEachStorage(addr common.Address, startLocation common.Ha
 	return innerErr
 }
 
+// ForEachStorageHashed - like ForEachStorage, but in order of hashed locations (order of storage trie, as in
+// debug_storageRangeAt of geth), starting from startSeckey. Storage is read from the HashedStorage table, which is
+// ordered by hashed locations, so only the requested page is walked. HashedStorage reflects the state after the
+// HashState stage progress: locations changed between that block and s.blockNr are taken from storage changesets
+// and read as of s.blockNr. Preimages of locations are not stored, key is nil for locations which come only from
+// HashedStorage.
+func (s *PlainState) ForEachStorageHashed(addr common.Address, startSeckey common.Hash, cb func(key *common.Hash, seckey common.Hash, value uint256.Int) bool, maxResults int) error {
+	if maxResults <= 0 {
+		return nil
+	}
+	accData, err := GetAsOf(s.tx, s.history, s.accHistoryC, s.accChangesC, false /* storage */, addr[:], s.blockNr+1)
+	if err != nil {
+		return err
+	}
+	var acc accounts.Account
+	if err := acc.DecodeForStorage(accData); err != nil {
+		return err
+	}
+	if acc.Incarnation == 0 {
+		return nil // not a contract at this block
+	}
+
+	changed, err := s.storageChangedSinceHashState(addr, acc.Incarnation)
+	if err != nil {
+		return err
+	}
+	if overrides, ok := s.storage[addr]; ok {
+		overrides.Ascend(func(i btree.Item) bool {
+			item := *i.(*storageItem)
+			changed[item.seckey] = &item
+			return true
+		})
+	}
+	var patch []*storageItem // sorted by seckey, starting from startSeckey
+	for seckey, item := range changed {
+		if bytes.Compare(seckey[:], startSeckey[:]) >= 0 {
+			patch = append(patch, item)
+		}
+	}
+	sort.Slice(patch, func(i, j int) bool { return bytes.Compare(patch[i].seckey[:], patch[j].seckey[:]) < 0 })
+
+	addrHash, err := common.HashData(addr[:])
+	if err != nil {
+		return err
+	}
+	c, err := s.tx.CursorDupSort(kv.HashedStorage)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	results := 0
+	emit := func(item *storageItem, key *common.Hash) bool {
+		if item.value.IsZero() {
+			return true
+		}
+		results++
+		return cb(key, item.seckey, item.value) && results < maxResults
+	}
+	v, err := c.SeekBothRange(dbutils.GenerateStoragePrefix(addrHash[:], acc.Incarnation), startSeckey[:])
+	for ; v != nil || len(patch) > 0; _, v, err = c.NextDup() {
+		if err != nil {
+			return err
+		}
+		var hashed *storageItem
+		if v != nil {
+			hashed = &storageItem{}
+			copy(hashed.seckey[:], v[:length.Hash])
+			hashed.value.SetBytes(v[length.Hash:])
+		}
+		// locations changed after s.blockNr go before (and instead of) the hashed state
+		for len(patch) > 0 && (hashed == nil || bytes.Compare(patch[0].seckey[:], hashed.seckey[:]) <= 0) {
+			item := patch[0]
+			patch = patch[1:]
+			if !emit(item, &item.key) {
+				return nil
+			}
+		}
+		if hashed == nil {
+			break
+		}
+		if _, ok := changed[hashed.seckey]; ok {
+			continue
+		}
+		if !emit(hashed, nil) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// storageChangedSinceHashState - storage locations of the contract changed between s.blockNr and the progress of
+// the HashState stage, with their values as of s.blockNr, by hashed location
+func (s *PlainState) storageChangedSinceHashState(addr common.Address, incarnation uint64) (map[common.Hash]*storageItem, error) {
+	hashedTo, err := stages.GetStageProgress(s.tx, stages.HashState)
+	if err != nil {
+		return nil, err
+	}
+	from, to := s.blockNr, hashedTo
+	if from > to {
+		from, to = to, from
+	}
+	c, err := s.tx.CursorDupSort(kv.StorageChangeSet)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	changed := map[common.Hash]*storageItem{}
+	seek := make([]byte, length.BlockNum+length.Addr+length.Incarnation)
+	copy(seek[length.BlockNum:], dbutils.PlainGenerateStoragePrefix(addr[:], incarnation))
+	for blockNum := from + 1; blockNum <= to; blockNum++ {
+		binary.BigEndian.PutUint64(seek, blockNum)
+		for k, v, err := c.SeekExact(seek); k != nil; k, v, err = c.NextDup() {
+			if err != nil {
+				return nil, err
+			}
+			item := &storageItem{}
+			copy(item.key[:], v[:length.Hash])
+			if item.seckey, err = common.HashData(item.key[:]); err != nil {
+				return nil, err
+			}
+			if _, ok := changed[item.seckey]; ok {
+				continue
+			}
+			enc, err := s.ReadAccountStorage(addr, incarnation, &item.key)
+			if err != nil {
+				return nil, err
+			}
+			item.value.SetBytes(enc)
+			changed[item.seckey] = item
+		}
+	}
+	return changed, nil
+}
+
 func (s *PlainState) ReadAccountData(address common.Address) (*accounts.Account, error) {
-	enc, err := GetAsOf(s.tx, s.accHistoryC, s.accChangesC, false /* storage */, address[:], s.blockNr+1)
+	enc, err := GetAsOf(s.tx, s.history, s.accHistoryC, s.accChangesC, false /* storage */, address[:], s.blockNr+1)
 	if err != nil {
 		return nil, err
 	}
@@ -171,7 +311,7 @@ func (s *PlainState) ReadAccountData(address common.Address) (*accounts.Account,
 
 func (s *PlainState) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
 	compositeKey := dbutils.PlainGenerateCompositeStorageKey(address.Bytes(), incarnation, key.Bytes())
-	enc, err := GetAsOf(s.tx, s.storageHistoryC, s.storageChangesC, true /* storage */, compositeKey, s.blockNr+1)
+	enc, err := GetAsOf(s.tx, s.history, s.storageHistoryC, s.storageChangesC, true /* storage */, compositeKey, s.blockNr+1)
 	if err != nil {
 		return nil, err
 	}
@@ -198,7 +338,7 @@ func (s *PlainState) ReadAccountCodeSize(address common.Address, incarnation uin
 }
 
 func (s *PlainState) ReadAccountIncarnation(address common.Address) (uint64, error) {
-	enc, err := GetAsOf(s.tx, s.accHistoryC, s.accChangesC, false /* storage */, address[:], s.blockNr+2)
+	enc, err := GetAsOf(s.tx, s.history, s.accHistoryC, s.accChangesC, false /* storage */, address[:], s.blockNr+2)
 	if err != nil {
 		return 0, err
 	}
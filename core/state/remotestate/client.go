@@ -0,0 +1,148 @@
+package remotestate
+
+import (
+	"context"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/rlp"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Client - state.Backend served by Server of another process. Every read is a round-trip, changes of a block are sent
+// at once by WriteChangeSets.
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+// Dial - client of Server listening on addr, without TLS
+func Dial(addr string) (*Client, error) {
+	conn, err := grpcutil.Connect(nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+func (c *Client) invoke(method string, in, out interface{}) error {
+	return c.cc.Invoke(context.Background(), "/remotestate.State/"+method, in, out)
+}
+
+func (c *Client) readBytes(method string, in []byte) ([]byte, error) {
+	out := new(wrapperspb.BytesValue)
+	if err := c.invoke(method, wrapperspb.Bytes(in), out); err != nil {
+		return nil, err
+	}
+	return out.GetValue(), nil
+}
+
+func (c *Client) Reader() state.StateReader {
+	return &reader{c: c}
+}
+
+func (c *Client) Writer(blockNum uint64) state.WriterWithChangeSets {
+	return &writer{c: c, block: Block{Number: blockNum}}
+}
+
+type reader struct {
+	c *Client
+}
+
+func (r *reader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	enc, err := r.c.readBytes("ReadAccount", address.Bytes())
+	if err != nil || len(enc) == 0 {
+		return nil, err
+	}
+	var acc accounts.Account
+	if err = acc.DecodeForStorage(enc); err != nil {
+		return nil, err
+	}
+	return &acc, nil
+}
+
+func (r *reader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	req, err := rlp.EncodeToBytes(&storageRequest{Address: address, Incarnation: incarnation, Key: *key})
+	if err != nil {
+		return nil, err
+	}
+	return r.c.readBytes("ReadStorage", req)
+}
+
+func (r *reader) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	req, err := rlp.EncodeToBytes(&storageRequest{Address: address, Incarnation: incarnation, Key: codeHash})
+	if err != nil {
+		return nil, err
+	}
+	return r.c.readBytes("ReadCode", req)
+}
+
+func (r *reader) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	code, err := r.ReadAccountCode(address, incarnation, codeHash)
+	return len(code), err
+}
+
+func (r *reader) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	out := new(wrapperspb.UInt64Value)
+	if err := r.c.invoke("ReadIncarnation", wrapperspb.Bytes(address.Bytes()), out); err != nil {
+		return 0, err
+	}
+	return out.GetValue(), nil
+}
+
+type writer struct {
+	c     *Client
+	block Block
+}
+
+func (w *writer) add(c Change) error {
+	w.block.Changes = append(w.block.Changes, c)
+	return nil
+}
+
+func (w *writer) UpdateAccountData(address common.Address, original, account *accounts.Account) error {
+	return w.add(Change{Kind: UpdateAccount, Address: address, Value: encodeAccount(account), Original: encodeAccount(original)})
+}
+
+func (w *writer) UpdateAccountCode(address common.Address, incarnation uint64, codeHash common.Hash, code []byte) error {
+	return w.add(Change{Kind: UpdateCode, Address: address, Incarnation: incarnation, Key: codeHash, Value: common.CopyBytes(code)})
+}
+
+func (w *writer) DeleteAccount(address common.Address, original *accounts.Account) error {
+	return w.add(Change{Kind: DeleteAccount, Address: address, Original: encodeAccount(original)})
+}
+
+func (w *writer) WriteAccountStorage(address common.Address, incarnation uint64, key *common.Hash, original, value *uint256.Int) error {
+	return w.add(Change{Kind: WriteStorage, Address: address, Incarnation: incarnation, Key: *key, Value: value.Bytes(), Original: original.Bytes()})
+}
+
+func (w *writer) CreateContract(address common.Address) error {
+	return w.add(Change{Kind: CreateContract, Address: address})
+}
+
+func (w *writer) WriteChangeSets() error {
+	if len(w.block.Changes) == 0 {
+		return nil
+	}
+	data, err := rlp.EncodeToBytes(&w.block)
+	if err != nil {
+		return err
+	}
+	if err = w.c.invoke("WriteBlock", wrapperspb.Bytes(data), new(emptypb.Empty)); err != nil {
+		return err
+	}
+	w.block.Changes = w.block.Changes[:0]
+	return nil
+}
+
+func (w *writer) WriteHistory() error {
+	return nil
+}
@@ -0,0 +1,136 @@
+package remotestate
+
+import (
+	"context"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+)
+
+// DbBackend - state.Backend on PlainState of a database, without history. Reference store for Server.
+type DbBackend struct {
+	db kv.RwDB
+}
+
+func NewDbBackend(db kv.RwDB) *DbBackend {
+	return &DbBackend{db: db}
+}
+
+func (b *DbBackend) Reader() state.StateReader {
+	return &dbReader{db: b.db}
+}
+
+func (b *DbBackend) Writer(uint64) state.WriterWithChangeSets {
+	return &dbWriter{db: b.db}
+}
+
+// dbReader - every read in own transaction
+type dbReader struct {
+	db kv.RoDB
+}
+
+func (r *dbReader) view(f func(r *state.PlainStateReader) error) error {
+	return r.db.View(context.Background(), func(tx kv.Tx) error {
+		return f(state.NewPlainStateReader(tx))
+	})
+}
+
+func (r *dbReader) ReadAccountData(address common.Address) (acc *accounts.Account, err error) {
+	err = r.view(func(r *state.PlainStateReader) error {
+		acc, err = r.ReadAccountData(address)
+		return err
+	})
+	return acc, err
+}
+
+func (r *dbReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) (v []byte, err error) {
+	err = r.view(func(r *state.PlainStateReader) error {
+		v, err = r.ReadAccountStorage(address, incarnation, key)
+		v = common.CopyBytes(v)
+		return err
+	})
+	return v, err
+}
+
+func (r *dbReader) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) (code []byte, err error) {
+	err = r.view(func(r *state.PlainStateReader) error {
+		code, err = r.ReadAccountCode(address, incarnation, codeHash)
+		code = common.CopyBytes(code)
+		return err
+	})
+	return code, err
+}
+
+func (r *dbReader) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (size int, err error) {
+	err = r.view(func(r *state.PlainStateReader) error {
+		size, err = r.ReadAccountCodeSize(address, incarnation, codeHash)
+		return err
+	})
+	return size, err
+}
+
+func (r *dbReader) ReadAccountIncarnation(address common.Address) (incarnation uint64, err error) {
+	err = r.view(func(r *state.PlainStateReader) error {
+		incarnation, err = r.ReadAccountIncarnation(address)
+		return err
+	})
+	return incarnation, err
+}
+
+// dbWriter - changes are applied in one transaction by WriteChangeSets
+type dbWriter struct {
+	db      kv.RwDB
+	pending []func(w state.StateWriter) error
+}
+
+func (w *dbWriter) add(f func(w state.StateWriter) error) error {
+	w.pending = append(w.pending, f)
+	return nil
+}
+
+func (w *dbWriter) UpdateAccountData(address common.Address, original, account *accounts.Account) error {
+	original, account = original.SelfCopy(), account.SelfCopy()
+	return w.add(func(sw state.StateWriter) error { return sw.UpdateAccountData(address, original, account) })
+}
+
+func (w *dbWriter) UpdateAccountCode(address common.Address, incarnation uint64, codeHash common.Hash, code []byte) error {
+	code = common.CopyBytes(code)
+	return w.add(func(sw state.StateWriter) error { return sw.UpdateAccountCode(address, incarnation, codeHash, code) })
+}
+
+func (w *dbWriter) DeleteAccount(address common.Address, original *accounts.Account) error {
+	original = original.SelfCopy()
+	return w.add(func(sw state.StateWriter) error { return sw.DeleteAccount(address, original) })
+}
+
+func (w *dbWriter) WriteAccountStorage(address common.Address, incarnation uint64, key *common.Hash, original, value *uint256.Int) error {
+	k, o, v := *key, original.Clone(), value.Clone()
+	return w.add(func(sw state.StateWriter) error { return sw.WriteAccountStorage(address, incarnation, &k, o, v) })
+}
+
+func (w *dbWriter) CreateContract(address common.Address) error {
+	return w.add(func(sw state.StateWriter) error { return sw.CreateContract(address) })
+}
+
+func (w *dbWriter) WriteChangeSets() error {
+	if err := w.db.Update(context.Background(), func(tx kv.RwTx) error {
+		sw := state.NewPlainStateWriterNoHistory(tx)
+		for _, f := range w.pending {
+			if err := f(sw); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	w.pending = w.pending[:0]
+	return nil
+}
+
+func (w *dbWriter) WriteHistory() error {
+	return nil
+}
@@ -0,0 +1,84 @@
+package remotestate
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func testClient(t *testing.T, backend state.Backend) *Client {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	server.RegisterService(&State_ServiceDesc, NewServer(backend))
+	go server.Serve(listener) //nolint:errcheck
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return NewClient(conn)
+}
+
+func TestClientServer(t *testing.T) {
+	db := memdb.NewTestDB(t)
+	c := testClient(t, NewDbBackend(db))
+	addr := common.Address{1}
+	code := []byte{0x60, 0x00}
+	codeHash := crypto.Keccak256Hash(code)
+	key := common.Hash{2}
+
+	acc := accounts.NewAccount()
+	acc.Nonce, acc.Balance, acc.Incarnation, acc.CodeHash = 1, *uint256.NewInt(100), 1, codeHash
+	empty := accounts.NewAccount()
+	w := c.Writer(1)
+	require.NoError(t, w.CreateContract(addr))
+	require.NoError(t, w.UpdateAccountData(addr, &empty, &acc))
+	require.NoError(t, w.UpdateAccountCode(addr, 1, codeHash, code))
+	require.NoError(t, w.WriteAccountStorage(addr, 1, &key, uint256.NewInt(0), uint256.NewInt(7)))
+
+	r := c.Reader()
+	got, err := r.ReadAccountData(addr)
+	require.NoError(t, err)
+	require.Nil(t, got, "changes are sent by WriteChangeSets")
+	require.NoError(t, w.WriteChangeSets())
+
+	got, err = r.ReadAccountData(addr)
+	require.NoError(t, err)
+	require.True(t, acc.Equals(got))
+	v, err := r.ReadAccountStorage(addr, 1, &key)
+	require.NoError(t, err)
+	require.Equal(t, []byte{7}, v)
+	gotCode, err := r.ReadAccountCode(addr, 1, codeHash)
+	require.NoError(t, err)
+	require.Equal(t, code, gotCode)
+	size, err := r.ReadAccountCodeSize(addr, 1, codeHash)
+	require.NoError(t, err)
+	require.Equal(t, len(code), size)
+
+	// unwind of the block
+	w = c.Writer(0)
+	require.NoError(t, w.WriteAccountStorage(addr, 1, &key, uint256.NewInt(7), uint256.NewInt(0)))
+	require.NoError(t, w.DeleteAccount(addr, &acc))
+	require.NoError(t, w.WriteChangeSets())
+	got, err = r.ReadAccountData(addr)
+	require.NoError(t, err)
+	require.Nil(t, got)
+	v, err = r.ReadAccountStorage(addr, 1, &key)
+	require.NoError(t, err)
+	require.Empty(t, v)
+	incarnation, err := r.ReadAccountIncarnation(addr)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), incarnation)
+}
@@ -0,0 +1,142 @@
+package remotestate
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/rlp"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Server - serves backend to remote Execution stage. Reads don't run concurrently with writes of a block.
+type Server struct {
+	lock    sync.RWMutex
+	backend state.Backend
+}
+
+func NewServer(backend state.Backend) *Server {
+	return &Server{backend: backend}
+}
+
+func encodeAccount(acc *accounts.Account) []byte {
+	if acc == nil {
+		return nil
+	}
+	enc := make([]byte, acc.EncodingLengthForStorage())
+	acc.EncodeForStorage(enc)
+	return enc
+}
+
+// decodeAccount - empty encoding is empty account: writers expect non-nil original
+func decodeAccount(enc []byte) (*accounts.Account, error) {
+	acc := accounts.NewAccount()
+	if len(enc) == 0 {
+		return &acc, nil
+	}
+	if err := acc.DecodeForStorage(enc); err != nil {
+		return nil, err
+	}
+	return &acc, nil
+}
+
+func (s *Server) ReadAccount(_ context.Context, in *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	acc, err := s.backend.Reader().ReadAccountData(common.BytesToAddress(in.GetValue()))
+	if err != nil {
+		return nil, err
+	}
+	return wrapperspb.Bytes(encodeAccount(acc)), nil
+}
+
+func (s *Server) ReadStorage(_ context.Context, in *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error) {
+	var req storageRequest
+	if err := rlp.DecodeBytes(in.GetValue(), &req); err != nil {
+		return nil, err
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	v, err := s.backend.Reader().ReadAccountStorage(req.Address, req.Incarnation, &req.Key)
+	if err != nil {
+		return nil, err
+	}
+	return wrapperspb.Bytes(v), nil
+}
+
+func (s *Server) ReadCode(_ context.Context, in *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error) {
+	var req storageRequest
+	if err := rlp.DecodeBytes(in.GetValue(), &req); err != nil {
+		return nil, err
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	code, err := s.backend.Reader().ReadAccountCode(req.Address, req.Incarnation, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	return wrapperspb.Bytes(code), nil
+}
+
+func (s *Server) ReadIncarnation(_ context.Context, in *wrapperspb.BytesValue) (*wrapperspb.UInt64Value, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	incarnation, err := s.backend.Reader().ReadAccountIncarnation(common.BytesToAddress(in.GetValue()))
+	if err != nil {
+		return nil, err
+	}
+	return wrapperspb.UInt64(incarnation), nil
+}
+
+func (s *Server) WriteBlock(_ context.Context, in *wrapperspb.BytesValue) (*emptypb.Empty, error) {
+	var block Block
+	if err := rlp.DecodeBytes(in.GetValue(), &block); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	w := s.backend.Writer(block.Number)
+	for i := range block.Changes {
+		if err := apply(w, &block.Changes[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.WriteChangeSets(); err != nil {
+		return nil, err
+	}
+	if err := w.WriteHistory(); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func apply(w state.StateWriter, c *Change) error {
+	switch c.Kind {
+	case UpdateAccount, DeleteAccount:
+		original, err := decodeAccount(c.Original)
+		if err != nil {
+			return err
+		}
+		if c.Kind == DeleteAccount {
+			return w.DeleteAccount(c.Address, original)
+		}
+		acc, err := decodeAccount(c.Value)
+		if err != nil {
+			return err
+		}
+		return w.UpdateAccountData(c.Address, original, acc)
+	case UpdateCode:
+		return w.UpdateAccountCode(c.Address, c.Incarnation, c.Key, c.Value)
+	case WriteStorage:
+		return w.WriteAccountStorage(c.Address, c.Incarnation, &c.Key, new(uint256.Int).SetBytes(c.Original), new(uint256.Int).SetBytes(c.Value))
+	case CreateContract:
+		return w.CreateContract(c.Address)
+	default:
+		return fmt.Errorf("unknown change kind %d", c.Kind)
+	}
+}
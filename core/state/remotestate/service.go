@@ -0,0 +1,106 @@
+// Package remotestate - gRPC implementation of state.Backend: Execution stage of the node reads and writes state hosted
+// by another process. Client is the node side, Server exposes any state.Backend, for example NewDbBackend.
+package remotestate
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/erigon/common"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Kinds of Change
+const (
+	UpdateAccount uint8 = iota
+	DeleteAccount
+	UpdateCode
+	WriteStorage
+	CreateContract
+)
+
+// Change - one call of state.StateWriter. Value and Original are account encoded for storage, code or storage value,
+// depending on Kind.
+type Change struct {
+	Kind        uint8
+	Address     common.Address
+	Incarnation uint64
+	Key         common.Hash // storage key or code hash
+	Value       []byte
+	Original    []byte
+}
+
+// Block - changes of one block, in order of calls
+type Block struct {
+	Number  uint64
+	Changes []Change
+}
+
+type storageRequest struct {
+	Address     common.Address
+	Incarnation uint64
+	Key         common.Hash
+}
+
+// StateServer - service "remotestate.State", messages are protobuf well-known types with RLP payloads:
+// rpc ReadAccount(BytesValue) returns (BytesValue) - address in, account encoded for storage out (empty - no account);
+// rpc ReadStorage(BytesValue) returns (BytesValue) - RLP of [address, incarnation, key] in, value out;
+// rpc ReadCode(BytesValue) returns (BytesValue) - RLP of [address, incarnation, code hash] in, code out;
+// rpc ReadIncarnation(BytesValue) returns (UInt64Value) - address in;
+// rpc WriteBlock(BytesValue) returns (google.protobuf.Empty) - RLP of Block in
+type StateServer interface {
+	ReadAccount(context.Context, *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error)
+	ReadStorage(context.Context, *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error)
+	ReadCode(context.Context, *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error)
+	ReadIncarnation(context.Context, *wrapperspb.BytesValue) (*wrapperspb.UInt64Value, error)
+	WriteBlock(context.Context, *wrapperspb.BytesValue) (*emptypb.Empty, error)
+}
+
+// unaryHandler - handler of a method which takes BytesValue
+func unaryHandler(method string, call func(srv StateServer, ctx context.Context, in *wrapperspb.BytesValue) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(wrapperspb.BytesValue)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(StateServer), ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/remotestate.State/" + method,
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(StateServer), ctx, req.(*wrapperspb.BytesValue))
+			}
+			return interceptor(ctx, in, info, handler)
+		},
+	}
+}
+
+// State_ServiceDesc - hand-written descriptor of "remotestate.State" service
+var State_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "remotestate.State",
+	HandlerType: (*StateServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryHandler("ReadAccount", func(srv StateServer, ctx context.Context, in *wrapperspb.BytesValue) (interface{}, error) {
+			return srv.ReadAccount(ctx, in)
+		}),
+		unaryHandler("ReadStorage", func(srv StateServer, ctx context.Context, in *wrapperspb.BytesValue) (interface{}, error) {
+			return srv.ReadStorage(ctx, in)
+		}),
+		unaryHandler("ReadCode", func(srv StateServer, ctx context.Context, in *wrapperspb.BytesValue) (interface{}, error) {
+			return srv.ReadCode(ctx, in)
+		}),
+		unaryHandler("ReadIncarnation", func(srv StateServer, ctx context.Context, in *wrapperspb.BytesValue) (interface{}, error) {
+			return srv.ReadIncarnation(ctx, in)
+		}),
+		unaryHandler("WriteBlock", func(srv StateServer, ctx context.Context, in *wrapperspb.BytesValue) (interface{}, error) {
+			return srv.WriteBlock(ctx, in)
+		}),
+	},
+	Streams: []grpc.StreamDesc{},
+}
@@ -108,8 +108,8 @@ func (s *StateSuite) SetUpTest(c *checker.C) {
 		panic(err)
 	}
 	s.tx = tx
-	s.r = NewPlainState(tx, 0)
-	s.w = NewPlainState(tx, 0)
+	s.r = NewPlainState(tx, 0, nil)
+	s.w = NewPlainState(tx, 0, nil)
 	s.state = New(s.r)
 }
 
@@ -177,8 +177,8 @@ func (s *StateSuite) TestSnapshotEmpty(c *checker.C) {
 // printing/logging in tests (-check.vv does not work)
 func TestSnapshot2(t *testing.T) {
 	_, tx := memdb.NewTestTx(t)
-	w := NewPlainState(tx, 0)
-	state := New(NewPlainState(tx, 0))
+	w := NewPlainState(tx, 0, nil)
+	state := New(NewPlainState(tx, 0, nil))
 
 	stateobjaddr0 := toAddr([]byte("so0"))
 	stateobjaddr1 := toAddr([]byte("so1"))
@@ -203,7 +203,7 @@ func TestSnapshot2(t *testing.T) {
 	if err != nil {
 		t.Fatal("error while finalizing transaction", err)
 	}
-	w = NewPlainState(tx, 1)
+	w = NewPlainState(tx, 1, nil)
 
 	err = state.CommitBlock(params.Rules{}, w)
 	if err != nil {
@@ -0,0 +1,131 @@
+package state
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+)
+
+// WitnessRecorder collects state accessed during execution of a block: accounts and storage slots, also absent ones -
+// stateless verifier needs proofs of their absence, and code of contracts. With proofs of recorded accounts and slots
+// against state root of the parent block it makes the witness of the block.
+type WitnessRecorder struct {
+	storage map[common.Address]map[common.Hash]struct{} // address => storage keys
+	codes   map[common.Hash][]byte
+}
+
+func NewWitnessRecorder() *WitnessRecorder {
+	return &WitnessRecorder{storage: map[common.Address]map[common.Hash]struct{}{}, codes: map[common.Hash][]byte{}}
+}
+
+func (wr *WitnessRecorder) account(address common.Address) map[common.Hash]struct{} {
+	keys, ok := wr.storage[address]
+	if !ok {
+		keys = map[common.Hash]struct{}{}
+		wr.storage[address] = keys
+	}
+	return keys
+}
+
+// Accounts - addresses of recorded accounts, sorted
+func (wr *WitnessRecorder) Accounts() []common.Address {
+	addrs := make([]common.Address, 0, len(wr.storage))
+	for addr := range wr.storage {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+	return addrs
+}
+
+// Storage - recorded storage keys of the account, sorted
+func (wr *WitnessRecorder) Storage(address common.Address) []common.Hash {
+	keys := make([]common.Hash, 0, len(wr.storage[address]))
+	for key := range wr.storage[address] {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+	return keys
+}
+
+// Codes - recorded code of contracts, in order of code hashes
+func (wr *WitnessRecorder) Codes() [][]byte {
+	hashes := make([]common.Hash, 0, len(wr.codes))
+	for hash := range wr.codes {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+	codes := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		codes[i] = wr.codes[hash]
+	}
+	return codes
+}
+
+// Reader wraps r to record accounts, storage slots and code which were read
+func (wr *WitnessRecorder) Reader(r StateReader) StateReader {
+	return &witnessRecordingReader{StateReader: r, rec: wr}
+}
+
+// Writer wraps w to record accounts and storage slots which were written or deleted without reading
+func (wr *WitnessRecorder) Writer(w WriterWithChangeSets) WriterWithChangeSets {
+	return &witnessRecordingWriter{WriterWithChangeSets: w, rec: wr}
+}
+
+type witnessRecordingReader struct {
+	StateReader
+	rec *WitnessRecorder
+}
+
+func (r *witnessRecordingReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	r.rec.account(address)
+	return r.StateReader.ReadAccountData(address)
+}
+
+func (r *witnessRecordingReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	r.rec.account(address)[*key] = struct{}{}
+	return r.StateReader.ReadAccountStorage(address, incarnation, key)
+}
+
+func (r *witnessRecordingReader) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	code, err := r.StateReader.ReadAccountCode(address, incarnation, codeHash)
+	if err != nil {
+		return nil, err
+	}
+	r.rec.account(address)
+	if len(code) > 0 {
+		r.rec.codes[codeHash] = code
+	}
+	return code, nil
+}
+
+// ReadAccountCodeSize - verifier needs the whole code to know its size
+func (r *witnessRecordingReader) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	code, err := r.ReadAccountCode(address, incarnation, codeHash)
+	if err != nil {
+		return 0, err
+	}
+	return len(code), nil
+}
+
+type witnessRecordingWriter struct {
+	WriterWithChangeSets
+	rec *WitnessRecorder
+}
+
+func (w *witnessRecordingWriter) UpdateAccountData(address common.Address, original, account *accounts.Account) error {
+	w.rec.account(address)
+	return w.WriterWithChangeSets.UpdateAccountData(address, original, account)
+}
+
+func (w *witnessRecordingWriter) DeleteAccount(address common.Address, original *accounts.Account) error {
+	w.rec.account(address)
+	return w.WriterWithChangeSets.DeleteAccount(address, original)
+}
+
+func (w *witnessRecordingWriter) WriteAccountStorage(address common.Address, incarnation uint64, key *common.Hash, original, value *uint256.Int) error {
+	w.rec.account(address)[*key] = struct{}{}
+	return w.WriterWithChangeSets.WriteAccountStorage(address, incarnation, key, original, value)
+}
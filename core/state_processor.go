@@ -155,5 +155,6 @@ func ApplyTransaction(config *params.ChainConfig, getHeader func(hash common.Has
 	// about the transaction and calling mechanisms.
 	cfg.SkipAnalysis = SkipAnalysis(config, header.Number.Uint64())
 
+	diffCheckTransaction(config, getHeader, engine, author, gp, ibs, header, tx, cfg, contractHasTEVM)
 	return applyTransaction(config, gp, ibs, stateWriter, header, tx, usedGas, vmenv, cfg)
 }
@@ -61,6 +61,7 @@ type StateTransition struct {
 	data       []byte
 	state      vm.IntraBlockState
 	evm        vm.VMInterface
+	feePayer   common.Address // pays for gas, differs from sender only for sponsored transactions
 
 	//some pre-allocated intermediate variables
 	sharedBuyGas        *uint256.Int
@@ -87,9 +88,10 @@ type Message interface {
 // ExecutionResult includes all output after executing given evm
 // message no matter the execution itself is successful or not.
 type ExecutionResult struct {
-	UsedGas    uint64 // Total used gas but include the refunded gas
-	Err        error  // Any error encountered during the execution(listed in core/vm/errors.go)
-	ReturnData []byte // Returned data from evm(function result or data supplied with revert opcode)
+	UsedGas     uint64 // Total used gas but include the refunded gas
+	RefundedGas uint64 // Gas refunded after execution (e.g. for cleared storage), it's not included in UsedGas
+	Err         error  // Any error encountered during the execution(listed in core/vm/errors.go)
+	ReturnData  []byte // Returned data from evm(function result or data supplied with revert opcode)
 }
 
 // Unwrap returns the internal evm error which allows us for further
@@ -121,12 +123,18 @@ func (result *ExecutionResult) Revert() []byte {
 
 // IntrinsicGas computes the 'intrinsic gas' for a message with the given data.
 func IntrinsicGas(data []byte, accessList types.AccessList, isContractCreation bool, isHomestead, isEIP2028 bool) (uint64, error) {
+	return ScheduledIntrinsicGas(data, accessList, isContractCreation, isHomestead, isEIP2028, nil)
+}
+
+// ScheduledIntrinsicGas computes the 'intrinsic gas' with costs modified by the schedule, nil schedule
+// keeps costs of the fork.
+func ScheduledIntrinsicGas(data []byte, accessList types.AccessList, isContractCreation bool, isHomestead, isEIP2028 bool, schedule *vm.GasSchedule) (uint64, error) {
 	// Set the starting gas for the raw transaction
 	var gas uint64
 	if isContractCreation && isHomestead {
-		gas = params.TxGasContractCreation
+		gas = schedule.IntrinsicCost(vm.IntrinsicContractCreate, params.TxGasContractCreation)
 	} else {
-		gas = params.TxGas
+		gas = schedule.IntrinsicCost(vm.IntrinsicTx, params.TxGas)
 	}
 
 	// Auxiliary variables for overflow protection
@@ -146,6 +154,7 @@ func IntrinsicGas(data []byte, accessList types.AccessList, isContractCreation b
 		if isEIP2028 {
 			nonZeroGas = params.TxDataNonZeroGasEIP2028
 		}
+		nonZeroGas = schedule.IntrinsicCost(vm.IntrinsicDataNonZero, nonZeroGas)
 
 		overflow, product = bits.Mul64(nz, nonZeroGas)
 		if overflow != 0 {
@@ -157,7 +166,7 @@ func IntrinsicGas(data []byte, accessList types.AccessList, isContractCreation b
 		}
 
 		z := uint64(len(data)) - nz
-		overflow, product = bits.Mul64(z, params.TxDataZeroGas)
+		overflow, product = bits.Mul64(z, schedule.IntrinsicCost(vm.IntrinsicDataZero, params.TxDataZeroGas))
 		if overflow != 0 {
 			return 0, ErrGasUintOverflow
 		}
@@ -200,6 +209,7 @@ func NewStateTransition(evm vm.VMInterface, msg Message, gp *GasPool) *StateTran
 		value:     msg.Value(),
 		data:      msg.Data(),
 		state:     evm.IntraBlockState(),
+		feePayer:  msg.From(),
 
 		sharedBuyGas:        uint256.NewInt(0),
 		sharedBuyGasBalance: uint256.NewInt(0),
@@ -229,30 +239,39 @@ func (st *StateTransition) to() common.Address {
 }
 
 func (st *StateTransition) buyGas(gasBailout bool) error {
+	sponsored := st.feePayer != st.msg.From()
 	mgval := st.sharedBuyGas
 	mgval.SetUint64(st.msg.Gas())
 	mgval, overflow := mgval.MulOverflow(mgval, st.gasPrice)
 	if overflow {
-		return fmt.Errorf("%w: address %v", ErrInsufficientFunds, st.msg.From().Hex())
+		return fmt.Errorf("%w: address %v", ErrInsufficientFunds, st.feePayer.Hex())
 	}
 	balanceCheck := mgval
 	if st.gasFeeCap != nil {
 		balanceCheck = st.sharedBuyGasBalance.SetUint64(st.msg.Gas())
 		balanceCheck, overflow = balanceCheck.MulOverflow(balanceCheck, st.gasFeeCap)
 		if overflow {
-			return fmt.Errorf("%w: address %v", ErrInsufficientFunds, st.msg.From().Hex())
+			return fmt.Errorf("%w: address %v", ErrInsufficientFunds, st.feePayer.Hex())
 		}
-		balanceCheck, overflow = balanceCheck.AddOverflow(balanceCheck, st.value)
-		if overflow {
-			return fmt.Errorf("%w: address %v", ErrInsufficientFunds, st.msg.From().Hex())
+		if !sponsored { // value of sponsored transaction is paid by sender, checked below
+			balanceCheck, overflow = balanceCheck.AddOverflow(balanceCheck, st.value)
+			if overflow {
+				return fmt.Errorf("%w: address %v", ErrInsufficientFunds, st.msg.From().Hex())
+			}
 		}
 	}
-	if have, want := st.state.GetBalance(st.msg.From()), balanceCheck; have.Cmp(want) < 0 {
-		if !gasBailout {
+	// sender of sponsored transaction pays only value, it's checked before fee payer is charged
+	if sponsored {
+		if have, want := st.state.GetBalance(st.msg.From()), st.value; have.Cmp(want) < 0 && !gasBailout {
 			return fmt.Errorf("%w: address %v have %v want %v", ErrInsufficientFunds, st.msg.From().Hex(), have, want)
 		}
+	}
+	if have, want := st.state.GetBalance(st.feePayer), balanceCheck; have.Cmp(want) < 0 {
+		if !gasBailout {
+			return fmt.Errorf("%w: address %v have %v want %v", ErrInsufficientFunds, st.feePayer.Hex(), have, want)
+		}
 	} else {
-		st.state.SubBalance(st.msg.From(), mgval)
+		st.state.SubBalance(st.feePayer, mgval)
 	}
 	if err := st.gp.SubGas(st.msg.Gas()); err != nil {
 		if !gasBailout {
@@ -313,6 +332,11 @@ func (st *StateTransition) preCheck(gasBailout bool) error {
 			}
 		}
 	}
+	feePayer, err := FeePayer(st.evm.ChainConfig(), st.evm.Context().BlockNumber, st.state, st.msg)
+	if err != nil {
+		return err
+	}
+	st.feePayer = feePayer
 	return st.buyGas(gasBailout)
 }
 
@@ -352,7 +376,7 @@ func (st *StateTransition) TransitionDb(refunds bool, gasBailout bool) (*Executi
 	contractCreation := msg.To() == nil
 
 	// Check clauses 4-5, subtract intrinsic gas if everything is correct
-	gas, err := IntrinsicGas(st.data, st.msg.AccessList(), contractCreation, homestead, istanbul)
+	gas, err := ScheduledIntrinsicGas(st.data, st.msg.AccessList(), contractCreation, homestead, istanbul, st.evm.Config().GasSchedule)
 	if err != nil {
 		return nil, err
 	}
@@ -371,7 +395,7 @@ func (st *StateTransition) TransitionDb(refunds bool, gasBailout bool) (*Executi
 
 	// Set up the initial access list.
 	if st.evm.ChainRules().IsBerlin {
-		st.state.PrepareAccessList(msg.From(), msg.To(), vm.ActivePrecompiles(st.evm.ChainRules()), msg.AccessList())
+		st.state.PrepareAccessList(msg.From(), msg.To(), vm.PrecompiledAddresses(st.evm.ChainConfig(), st.evm.Context().BlockNumber), msg.AccessList())
 	}
 
 	var (
@@ -389,13 +413,14 @@ func (st *StateTransition) TransitionDb(refunds bool, gasBailout bool) (*Executi
 		st.state.SetNonce(msg.From(), st.state.GetNonce(sender.Address())+1)
 		ret, st.gas, vmerr = st.evm.Call(sender, st.to(), st.data, st.gas, st.value, bailout)
 	}
+	var refunded uint64
 	if refunds {
 		if london {
 			// After EIP-3529: refunds are capped to gasUsed / 5
-			st.refundGas(params.RefundQuotientEIP3529)
+			refunded = st.refundGas(params.RefundQuotientEIP3529)
 		} else {
 			// Before EIP-3529: refunds were capped to gasUsed / 2
-			st.refundGas(params.RefundQuotient)
+			refunded = st.refundGas(params.RefundQuotient)
 		}
 	}
 	effectiveTip := st.gasPrice
@@ -405,13 +430,14 @@ func (st *StateTransition) TransitionDb(refunds bool, gasBailout bool) (*Executi
 	st.state.AddBalance(st.evm.Context().Coinbase, new(uint256.Int).Mul(new(uint256.Int).SetUint64(st.gasUsed()), effectiveTip))
 
 	return &ExecutionResult{
-		UsedGas:    st.gasUsed(),
-		Err:        vmerr,
-		ReturnData: ret,
+		UsedGas:     st.gasUsed(),
+		RefundedGas: refunded,
+		Err:         vmerr,
+		ReturnData:  ret,
 	}, nil
 }
 
-func (st *StateTransition) refundGas(refundQuotient uint64) {
+func (st *StateTransition) refundGas(refundQuotient uint64) uint64 {
 	// Apply refund counter, capped to half of the used gas.
 	refund := st.gasUsed() / refundQuotient
 	if refund > st.state.GetRefund() {
@@ -421,11 +447,12 @@ func (st *StateTransition) refundGas(refundQuotient uint64) {
 
 	// Return ETH for remaining gas, exchanged at the original rate.
 	remaining := new(uint256.Int).Mul(new(uint256.Int).SetUint64(st.gas), st.gasPrice)
-	st.state.AddBalance(st.msg.From(), remaining)
+	st.state.AddBalance(st.feePayer, remaining)
 
 	// Also return remaining gas to the block gas counter so it is
 	// available for the next transaction.
 	st.gp.AddGas(st.gas)
+	return refund
 }
 
 // gasUsed returns the amount of gas used up by the state transition.
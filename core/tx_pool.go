@@ -78,6 +78,13 @@ type TxPoolConfig struct {
 	Lifetime      time.Duration // Maximum amount of time non-executable transaction are queued
 	StartOnInit   bool
 	TracedSenders []string // List of senders for which tx pool should print out debugging info
+
+	Shadow       bool   // Record rejected transactions to metrics
+	ShadowFile   string // Also write rejected transactions to this file
+	ShadowPolicy string // Candidate policy, evaluated but not enforced, see txpoolshadow.ParsePolicy
+	Events       bool   // Publish events of pool changes, see txpoolevents.Bus
+
+	FetchInflight uint64 // Bytes of announced transactions requested from all peers and not received yet, see txpoolfetch.Scheduler
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -96,4 +103,6 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	GlobalQueue:        30_000,
 
 	Lifetime: 3 * time.Hour,
+
+	FetchInflight: 16 * 1024 * 1024,
 }
@@ -186,6 +186,16 @@ func (sg Signer) Sender(tx Transaction) (common.Address, error) {
 
 // SenderWithContext returns the sender address of the transaction.
 func (sg Signer) SenderWithContext(context *secp256k1.Context, tx Transaction) (common.Address, error) {
+	sighash, sig, err := sg.RecoveryInput(tx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return recoverPlain(context, sighash, sig)
+}
+
+// RecoveryInput returns the signing hash and the validated 65-byte [R || S || V] signature
+// of the transaction, from which public key of the sender can be recovered by ecrecover.
+func (sg Signer) RecoveryInput(tx Transaction) (common.Hash, []byte, error) {
 	var V uint256.Int
 	var R, S *uint256.Int
 	signChainID := sg.chainID.ToBig() // This is reset to nil if tx is unprotected
@@ -194,16 +204,16 @@ func (sg Signer) SenderWithContext(context *secp256k1.Context, tx Transaction) (
 	case *LegacyTx:
 		if !t.Protected() {
 			if !sg.unprotected {
-				return common.Address{}, fmt.Errorf("unprotected tx is not supported by signer %s", sg)
+				return common.Hash{}, nil, fmt.Errorf("unprotected tx is not supported by signer %s", sg)
 			}
 			signChainID = nil
 			V.Set(&t.V)
 		} else {
 			if !sg.protected {
-				return common.Address{}, fmt.Errorf("protected tx is not supported by signer %s", sg)
+				return common.Hash{}, nil, fmt.Errorf("protected tx is not supported by signer %s", sg)
 			}
 			if !DeriveChainId(&t.V).Eq(&sg.chainID) {
-				return common.Address{}, ErrInvalidChainId
+				return common.Hash{}, nil, ErrInvalidChainId
 			}
 			V.Sub(&t.V, &sg.chainIDMul)
 			V.Sub(&V, u256.Num8)
@@ -211,14 +221,14 @@ func (sg Signer) SenderWithContext(context *secp256k1.Context, tx Transaction) (
 		R, S = &t.R, &t.S
 	case *AccessListTx:
 		if !sg.accesslist {
-			return common.Address{}, fmt.Errorf("accesslist tx is not supported by signer %s", sg)
+			return common.Hash{}, nil, fmt.Errorf("accesslist tx is not supported by signer %s", sg)
 		}
 		if t.ChainID == nil {
 			if !sg.chainID.IsZero() {
-				return common.Address{}, ErrInvalidChainId
+				return common.Hash{}, nil, ErrInvalidChainId
 			}
 		} else if !t.ChainID.Eq(&sg.chainID) {
-			return common.Address{}, ErrInvalidChainId
+			return common.Hash{}, nil, ErrInvalidChainId
 		}
 		// ACL txs are defined to use 0 and 1 as their recovery id, add
 		// 27 to become equivalent to unprotected Homestead signatures.
@@ -226,23 +236,27 @@ func (sg Signer) SenderWithContext(context *secp256k1.Context, tx Transaction) (
 		R, S = &t.R, &t.S
 	case *DynamicFeeTransaction:
 		if !sg.dynamicfee {
-			return common.Address{}, fmt.Errorf("dynamicfee tx is not supported by signer %s", sg)
+			return common.Hash{}, nil, fmt.Errorf("dynamicfee tx is not supported by signer %s", sg)
 		}
 		if t.ChainID == nil {
 			if !sg.chainID.IsZero() {
-				return common.Address{}, ErrInvalidChainId
+				return common.Hash{}, nil, ErrInvalidChainId
 			}
 		} else if !t.ChainID.Eq(&sg.chainID) {
-			return common.Address{}, ErrInvalidChainId
+			return common.Hash{}, nil, ErrInvalidChainId
 		}
 		// ACL and DynamicFee txs are defined to use 0 and 1 as their recovery
 		// id, add 27 to become equivalent to unprotected Homestead signatures.
 		V.Add(&t.V, u256.Num27)
 		R, S = &t.R, &t.S
 	default:
-		return common.Address{}, ErrTxTypeNotSupported
+		return common.Hash{}, nil, ErrTxTypeNotSupported
 	}
-	return recoverPlain(context, tx.SigningHash(signChainID), R, S, &V, !sg.maleable)
+	sig, err := plainSignature(R, S, &V, !sg.maleable)
+	if err != nil {
+		return common.Hash{}, nil, err
+	}
+	return tx.SigningHash(signChainID), sig, nil
 }
 
 // SignatureValues returns the raw R, S, V values corresponding to the
@@ -308,13 +322,13 @@ func decodeSignature(sig []byte) (r, s, v *uint256.Int) {
 	return r, s, v
 }
 
-func recoverPlain(context *secp256k1.Context, sighash common.Hash, R, S, Vb *uint256.Int, homestead bool) (common.Address, error) {
+func plainSignature(R, S, Vb *uint256.Int, homestead bool) ([]byte, error) {
 	if Vb.BitLen() > 8 {
-		return common.Address{}, ErrInvalidSig
+		return nil, ErrInvalidSig
 	}
 	V := byte(Vb.Uint64() - 27)
 	if !crypto.ValidateSignatureValues(V, R, S, homestead) {
-		return common.Address{}, ErrInvalidSig
+		return nil, ErrInvalidSig
 	}
 	// encode the signature in uncompressed format
 	r, s := R.Bytes(), S.Bytes()
@@ -322,11 +336,20 @@ func recoverPlain(context *secp256k1.Context, sighash common.Hash, R, S, Vb *uin
 	copy(sig[32-len(r):32], r)
 	copy(sig[64-len(s):64], s)
 	sig[64] = V
+	return sig, nil
+}
+
+func recoverPlain(context *secp256k1.Context, sighash common.Hash, sig []byte) (common.Address, error) {
 	// recover the public key from the signature
 	pub, err := crypto.EcrecoverWithContext(context, sighash[:], sig)
 	if err != nil {
 		return common.Address{}, err
 	}
+	return PubkeyToSender(pub)
+}
+
+// PubkeyToSender returns the address of the uncompressed (65 bytes) public key recovered from a signature.
+func PubkeyToSender(pub []byte) (common.Address, error) {
 	if len(pub) == 0 || pub[0] != 4 {
 		return common.Address{}, errors.New("invalid public key")
 	}
@@ -52,6 +52,8 @@ type Contract struct {
 	analysis      []uint64                 // Locally cached result of JUMPDEST analysis
 	skipAnalysis  bool
 	vmType        VmType
+	container     *Container // nil for legacy code
+	returnStack   []uint64   // return addresses of CALLF in EOF code
 
 	Code     []byte
 	CodeHash common.Hash
@@ -0,0 +1,234 @@
+package vm
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon/params"
+)
+
+// EVM Object Format (EIP-3540) container, version 1:
+//
+//	magic      0xEF00
+//	version    0x01
+//	kind_types 0x01, types_size uint16 (4 bytes per code section)
+//	kind_code  0x02, num_code_sections uint16, code_size uint16 * num_code_sections
+//	kind_data  0x03, data_size uint16
+//	terminator 0x00
+//	types      (inputs uint8, outputs uint8, max_stack_height uint16) * num_code_sections
+//	code sections
+//	data section
+//
+// Code sections are executed in place: program counter is offset in the whole container, so CODECOPY and PUSH work
+// the same way as for legacy code.
+const (
+	eofFormatByte = 0xEF
+	eofMagicByte  = 0x00
+	eof1Version   = 0x01
+
+	kindTypes      = 0x01
+	kindCode       = 0x02
+	kindData       = 0x03
+	headerTerminal = 0x00
+
+	eofMaxCodeSections = 1024
+	eofMaxIO           = 127  // max number of inputs or outputs of code section
+	eofMaxStackHeight  = 1023 // max declared stack height of code section
+)
+
+// FunctionMetadata - entry of types section, describes stack of code section
+type FunctionMetadata struct {
+	Inputs         uint8
+	Outputs        uint8
+	MaxStackHeight uint16
+}
+
+// Container - EOF container, parsed by UnmarshalBinary
+type Container struct {
+	Types []FunctionMetadata
+	Code  [][]byte
+	Data  []byte
+
+	codeOffsets []uint64 // offsets of code sections in the container
+}
+
+// hasEOFMagic - whether code is EOF container of any version (EIP-3540), such code can't be deployed by legacy code
+func hasEOFMagic(code []byte) bool {
+	return len(code) >= 2 && code[0] == eofFormatByte && code[1] == eofMagicByte
+}
+
+// MarshalBinary - encodes container, sizes of sections are taken from their content
+func (c *Container) MarshalBinary() []byte {
+	b := []byte{eofFormatByte, eofMagicByte, eof1Version}
+	b = append(b, kindTypes)
+	b = appendUint16(b, uint16(4*len(c.Types)))
+	b = append(b, kindCode)
+	b = appendUint16(b, uint16(len(c.Code)))
+	for _, code := range c.Code {
+		b = appendUint16(b, uint16(len(code)))
+	}
+	b = append(b, kindData)
+	b = appendUint16(b, uint16(len(c.Data)))
+	b = append(b, headerTerminal)
+	for _, t := range c.Types {
+		b = append(b, t.Inputs, t.Outputs)
+		b = appendUint16(b, t.MaxStackHeight)
+	}
+	for _, code := range c.Code {
+		b = append(b, code...)
+	}
+	return append(b, c.Data...)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+// UnmarshalBinary - parses container and checks its header and types section. Code of sections is checked by
+// ValidateCode. Code and data of the container are sub-slices of b.
+func (c *Container) UnmarshalBinary(b []byte) error {
+	if !hasEOFMagic(b) {
+		return fmt.Errorf("%w: invalid magic", ErrInvalidEOF)
+	}
+	if len(b) < 3 || b[2] != eof1Version {
+		return fmt.Errorf("%w: unsupported version", ErrInvalidEOF)
+	}
+	pos := 3
+	typesSize, err := readSectionHeader(b, &pos, kindTypes)
+	if err != nil {
+		return err
+	}
+	numCode, err := readSectionHeader(b, &pos, kindCode)
+	if err != nil {
+		return err
+	}
+	if numCode == 0 || numCode > eofMaxCodeSections {
+		return fmt.Errorf("%w: invalid number of code sections %d", ErrInvalidEOF, numCode)
+	}
+	if typesSize != 4*numCode {
+		return fmt.Errorf("%w: types section size %d doesn't match number of code sections %d", ErrInvalidEOF, typesSize, numCode)
+	}
+	codeSizes := make([]int, numCode)
+	for i := range codeSizes {
+		if pos+2 > len(b) {
+			return fmt.Errorf("%w: truncated header", ErrInvalidEOF)
+		}
+		codeSizes[i] = int(binary.BigEndian.Uint16(b[pos:]))
+		if codeSizes[i] == 0 {
+			return fmt.Errorf("%w: empty code section %d", ErrInvalidEOF, i)
+		}
+		pos += 2
+	}
+	dataSize, err := readSectionHeader(b, &pos, kindData)
+	if err != nil {
+		return err
+	}
+	if pos >= len(b) || b[pos] != headerTerminal {
+		return fmt.Errorf("%w: missing header terminator", ErrInvalidEOF)
+	}
+	pos++
+
+	size := pos + typesSize + dataSize
+	for _, codeSize := range codeSizes {
+		size += codeSize
+	}
+	if size != len(b) {
+		return fmt.Errorf("%w: container size %d doesn't match sizes of sections %d", ErrInvalidEOF, len(b), size)
+	}
+
+	c.Types = make([]FunctionMetadata, numCode)
+	for i := range c.Types {
+		t := FunctionMetadata{Inputs: b[pos], Outputs: b[pos+1], MaxStackHeight: binary.BigEndian.Uint16(b[pos+2:])}
+		if t.Inputs > eofMaxIO || t.Outputs > eofMaxIO {
+			return fmt.Errorf("%w: too many inputs or outputs of code section %d", ErrInvalidEOF, i)
+		}
+		if t.MaxStackHeight > eofMaxStackHeight {
+			return fmt.Errorf("%w: max stack height of code section %d is above limit", ErrInvalidEOF, i)
+		}
+		c.Types[i] = t
+		pos += 4
+	}
+	if c.Types[0].Inputs != 0 || c.Types[0].Outputs != 0 {
+		return fmt.Errorf("%w: first code section must have 0 inputs and outputs", ErrInvalidEOF)
+	}
+	c.Code = make([][]byte, numCode)
+	c.codeOffsets = make([]uint64, numCode)
+	for i, codeSize := range codeSizes {
+		c.codeOffsets[i] = uint64(pos)
+		c.Code[i] = b[pos : pos+codeSize]
+		pos += codeSize
+	}
+	c.Data = b[pos:]
+	return nil
+}
+
+func readSectionHeader(b []byte, pos *int, kind byte) (int, error) {
+	if *pos+3 > len(b) {
+		return 0, fmt.Errorf("%w: truncated header", ErrInvalidEOF)
+	}
+	if b[*pos] != kind {
+		return 0, fmt.Errorf("%w: expected section kind %d, got %d", ErrInvalidEOF, kind, b[*pos])
+	}
+	size := int(binary.BigEndian.Uint16(b[*pos+1:]))
+	*pos += 3
+	return size, nil
+}
+
+// ParseAndValidateEOF - parses container and validates all its code sections against EOF instruction set
+func ParseAndValidateEOF(code []byte, jt *JumpTable) (*Container, error) {
+	c := &Container{}
+	if err := c.UnmarshalBinary(code); err != nil {
+		return nil, err
+	}
+	if err := c.ValidateCode(jt); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newEOFInstructionSet - instructions of EOF code: instructions of the fork without dynamic jumps and PC, plus
+// relative jumps (EIP-4200) and functions (EIP-4750)
+func newEOFInstructionSet(jt *JumpTable) JumpTable {
+	instructionSet := *jt
+	instructionSet[JUMP] = nil
+	instructionSet[JUMPI] = nil
+	instructionSet[PC] = nil
+	instructionSet[RJUMP] = &operation{
+		execute:     opRjump,
+		constantGas: params.RjumpGas,
+		minStack:    minStack(0, 0),
+		maxStack:    maxStack(0, 0),
+		jumps:       true,
+	}
+	instructionSet[RJUMPI] = &operation{
+		execute:     opRjumpi,
+		constantGas: params.RjumpiGas,
+		minStack:    minStack(1, 0),
+		maxStack:    maxStack(1, 0),
+		numPop:      1,
+		jumps:       true,
+	}
+	instructionSet[RJUMPV] = &operation{
+		execute:     opRjumpv,
+		constantGas: params.RjumpiGas,
+		minStack:    minStack(1, 0),
+		maxStack:    maxStack(1, 0),
+		numPop:      1,
+		jumps:       true,
+	}
+	instructionSet[CALLF] = &operation{
+		execute:     opCallf,
+		constantGas: params.CallfGas,
+		minStack:    minStack(0, 0),
+		maxStack:    maxStack(0, 0),
+		jumps:       true,
+	}
+	instructionSet[RETF] = &operation{
+		execute:     opRetf,
+		constantGas: params.RetfGas,
+		minStack:    minStack(0, 0),
+		maxStack:    maxStack(0, 0),
+		jumps:       true,
+	}
+	return instructionSet
+}
@@ -0,0 +1,66 @@
+package vm
+
+import (
+	"encoding/binary"
+
+	"github.com/ledgerwatch/erigon/params"
+)
+
+// Immediates of relative jumps and CALLF are checked by EOF validation, so instructions don't check bounds.
+
+func relativeJump(code []byte, pc, offsetPos uint64, next uint64) uint64 {
+	return uint64(int64(next) + int64(int16(binary.BigEndian.Uint16(code[pc+offsetPos:]))))
+}
+
+func opRjump(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+	*pc = relativeJump(scope.Contract.Code, *pc, 1, *pc+3)
+	return nil, nil
+}
+
+func opRjumpi(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+	cond := scope.Stack.Pop()
+	if cond.IsZero() {
+		*pc += 3
+	} else {
+		*pc = relativeJump(scope.Contract.Code, *pc, 1, *pc+3)
+	}
+	return nil, nil
+}
+
+func opRjumpv(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+	code := scope.Contract.Code
+	count := uint64(code[*pc+1])
+	next := *pc + 2 + 2*count
+	idx := scope.Stack.Pop()
+	if !idx.IsUint64() || idx.Uint64() >= count {
+		*pc = next
+	} else {
+		*pc = relativeJump(code, *pc, 2+2*idx.Uint64(), next)
+	}
+	return nil, nil
+}
+
+func opCallf(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+	container := scope.Contract.container
+	idx := binary.BigEndian.Uint16(scope.Contract.Code[*pc+1:])
+	typ := container.Types[idx]
+	if height := scope.Stack.Len() + int(typ.MaxStackHeight) - int(typ.Inputs); height > int(params.StackLimit) {
+		return nil, &ErrStackOverflow{stackLen: height, limit: int(params.StackLimit)}
+	}
+	if len(scope.Contract.returnStack) >= int(params.StackLimit) {
+		return nil, ErrReturnStackExceeded
+	}
+	scope.Contract.returnStack = append(scope.Contract.returnStack, *pc+3)
+	*pc = container.codeOffsets[idx]
+	return nil, nil
+}
+
+func opRetf(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+	returnStack := scope.Contract.returnStack
+	if len(returnStack) == 0 { // not possible in validated code
+		return nil, ErrInvalidRetsub
+	}
+	*pc = returnStack[len(returnStack)-1]
+	scope.Contract.returnStack = returnStack[:len(returnStack)-1]
+	return nil, nil
+}
@@ -0,0 +1,166 @@
+package vm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func eofBytes(types []FunctionMetadata, data []byte, code ...[]byte) []byte {
+	return (&Container{Types: types, Code: code, Data: data}).MarshalBinary()
+}
+
+func TestEOFContainerRoundTrip(t *testing.T) {
+	types := []FunctionMetadata{{0, 0, 1}, {2, 1, 3}}
+	code := [][]byte{{byte(CALLF), 0, 1, byte(STOP)}, {byte(ADD), byte(RETF)}}
+	b := eofBytes(types, []byte{0xaa, 0xbb}, code...)
+	require.Equal(t, []byte{0xef, 0x00, 0x01, 0x01, 0x00, 0x08, 0x02, 0x00, 0x02, 0x00, 0x04, 0x00, 0x02, 0x03, 0x00, 0x02, 0x00}, b[:17])
+
+	var c Container
+	require.NoError(t, c.UnmarshalBinary(b))
+	require.Equal(t, types, c.Types)
+	require.Equal(t, code, c.Code)
+	require.Equal(t, []byte{0xaa, 0xbb}, c.Data)
+	require.Equal(t, []uint64{25, 29}, c.codeOffsets)
+	require.Equal(t, b, c.MarshalBinary())
+}
+
+func TestEOFUnmarshalInvalid(t *testing.T) {
+	valid := eofBytes([]FunctionMetadata{{0, 0, 0}}, []byte{1}, []byte{byte(STOP)})
+	withByte := func(pos int, v byte) []byte {
+		b := append([]byte{}, valid...)
+		b[pos] = v
+		return b
+	}
+	for name, b := range map[string][]byte{
+		"empty":                  {},
+		"no magic":               {0xef},
+		"wrong magic":            withByte(1, 0x01),
+		"no version":             {0xef, 0x00},
+		"unknown version":        withByte(2, 0x02),
+		"no types section":       withByte(3, kindCode),
+		"truncated header":       valid[:8],
+		"zero code sections":     eofBytes(nil, nil),
+		"types size mismatch":    withByte(5, 0x08),
+		"empty code section":     withByte(10, 0x00),
+		"no data section":        withByte(11, kindTypes),
+		"no terminator":          withByte(14, 0x01),
+		"truncated body":         valid[:len(valid)-1],
+		"trailing bytes":         append(append([]byte{}, valid...), 0x00),
+		"first section inputs":   eofBytes([]FunctionMetadata{{1, 0, 1}}, nil, []byte{byte(STOP)}),
+		"first section outputs":  eofBytes([]FunctionMetadata{{0, 1, 0}}, nil, []byte{byte(STOP)}),
+		"too many inputs":        eofBytes([]FunctionMetadata{{0, 0, 0}, {128, 0, 128}}, nil, []byte{byte(STOP)}, []byte{byte(RETF)}),
+		"max stack above limit":  eofBytes([]FunctionMetadata{{0, 0, 1024}}, nil, []byte{byte(STOP)}),
+		"too many code sections": eofBytes(make([]FunctionMetadata, 1025), nil, make([][]byte, 1025)...),
+	} {
+		var c Container
+		err := c.UnmarshalBinary(b)
+		require.Error(t, err, name)
+		require.True(t, errors.Is(err, ErrInvalidEOF), name)
+	}
+	var c Container
+	require.NoError(t, c.UnmarshalBinary(valid))
+}
+
+func TestEOFValidateCode(t *testing.T) {
+	jt := newEOFInstructionSet(&londonInstructionSet)
+	type testcase struct {
+		types []FunctionMetadata
+		code  [][]byte
+		err   string // empty if valid
+	}
+	main := func(maxStack uint16, code ...byte) testcase {
+		return testcase{types: []FunctionMetadata{{0, 0, maxStack}}, code: [][]byte{code}}
+	}
+	withErr := func(tc testcase, err string) testcase {
+		tc.err = err
+		return tc
+	}
+	for name, tc := range map[string]testcase{
+		"stop":                        main(0, byte(STOP)),
+		"invalid instruction":         main(0, 0xfe),
+		"push and store":              main(2, byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE), byte(STOP)),
+		"push32":                      main(1, append(append([]byte{byte(PUSH32)}, make([]byte, 32)...), byte(STOP))...),
+		"jumpdest is nop":             main(0, byte(JUMPDEST), byte(STOP)),
+		"rjumpi":                      main(1, byte(PUSH1), 0, byte(RJUMPI), 0, 1, byte(STOP), byte(STOP)),
+		"rjump backward":              main(0, byte(RJUMP), 0xff, 0xfd),
+		"rjump zero offset":           main(0, byte(RJUMP), 0, 0, byte(STOP)),
+		"rjumpv":                      main(1, byte(PUSH1), 0, byte(RJUMPV), 2, 0, 0, 0, 1, byte(STOP), byte(STOP)),
+		"loop with counter":           main(2, byte(PUSH1), 3, byte(PUSH1), 1, byte(SWAP1), byte(SUB), byte(DUP1), byte(RJUMPI), 0xff, 0xf8, byte(POP), byte(STOP)),
+		"undefined instruction":       withErr(main(0, 0x0c, byte(STOP)), "undefined instruction"),
+		"jump":                        withErr(main(1, byte(PUSH1), 0, byte(JUMP)), "undefined instruction"),
+		"jumpi":                       withErr(main(2, byte(PUSH1), 0, byte(DUP1), byte(JUMPI), byte(STOP)), "undefined instruction"),
+		"pc":                          withErr(main(1, byte(PC), byte(STOP)), "undefined instruction"),
+		"truncated push":              withErr(main(1, byte(PUSH2), 0), "truncated immediate"),
+		"truncated rjump":             withErr(main(0, byte(RJUMP), 0), "truncated immediate"),
+		"truncated rjumpv":            withErr(main(1, byte(PUSH1), 0, byte(RJUMPV)), "truncated RJUMPV"),
+		"truncated rjumpv jump table": withErr(main(1, byte(PUSH1), 0, byte(RJUMPV), 2, 0, 0, 0), "truncated immediate"),
+		"empty rjumpv table":          withErr(main(1, byte(PUSH1), 0, byte(RJUMPV), 0, byte(STOP)), "empty jump table"),
+		"rjump into immediate":        withErr(main(1, byte(PUSH1), 0, byte(RJUMP), 0xff, 0xfc, byte(STOP)), "invalid relative jump target"),
+		"rjump out of code":           withErr(main(0, byte(RJUMP), 0, 1, byte(STOP)), "invalid relative jump target"),
+		"rjump before code":           withErr(main(0, byte(RJUMP), 0xff, 0xfc), "invalid relative jump target"),
+		"rjumpv into immediate":       withErr(main(1, byte(PUSH1), 0, byte(RJUMPV), 1, 0xff, 0xff, byte(STOP)), "invalid relative jump target"),
+		"falls off end":               withErr(main(1, byte(PUSH1), 0), "falls off the end"),
+		"rjumpi falls off end":        withErr(main(1, byte(PUSH1), 0, byte(RJUMPI), 0xff, 0xfb), "falls off the end"),
+		"stack underflow":             withErr(main(1, byte(PUSH1), 0, byte(ADD), byte(STOP)), "stack underflow"),
+		"unreachable code":            withErr(main(0, byte(STOP), byte(STOP)), "unreachable instruction"),
+		"code after rjump":            withErr(main(0, byte(RJUMP), 0, 1, byte(STOP), byte(STOP)), "unreachable instruction"),
+		"stack height mismatch":       withErr(main(1, byte(PUSH1), 0, byte(RJUMP), 0xff, 0xfb), "stack height mismatch"),
+		"max stack too high":          withErr(main(2, byte(PUSH1), 0, byte(POP), byte(STOP)), "doesn't match types section"),
+		"max stack too low":           withErr(main(0, byte(PUSH1), 0, byte(POP), byte(STOP)), "doesn't match types section"),
+		"callf": {
+			types: []FunctionMetadata{{0, 0, 1}, {0, 1, 1}},
+			code:  [][]byte{{byte(CALLF), 0, 1, byte(POP), byte(STOP)}, {byte(PUSH1), 42, byte(RETF)}},
+		},
+		"callf with inputs": {
+			types: []FunctionMetadata{{0, 0, 2}, {2, 1, 2}},
+			code:  [][]byte{{byte(PUSH1), 1, byte(PUSH1), 2, byte(CALLF), 0, 1, byte(POP), byte(STOP)}, {byte(ADD), byte(RETF)}},
+		},
+		"callf recursion": {
+			types: []FunctionMetadata{{0, 0, 0}, {0, 0, 0}},
+			code:  [][]byte{{byte(CALLF), 0, 1, byte(STOP)}, {byte(CALLF), 0, 1, byte(RETF)}},
+		},
+		"callf unknown section": {
+			types: []FunctionMetadata{{0, 0, 0}},
+			code:  [][]byte{{byte(CALLF), 0, 1, byte(STOP)}},
+			err:   "unknown code section",
+		},
+		"callf stack underflow": {
+			types: []FunctionMetadata{{0, 0, 1}, {2, 1, 2}},
+			code:  [][]byte{{byte(PUSH1), 1, byte(CALLF), 0, 1, byte(STOP)}, {byte(ADD), byte(RETF)}},
+			err:   "stack underflow",
+		},
+		"callf stack overflow": {
+			types: []FunctionMetadata{{0, 0, 2}, {0, 0, 1023}},
+			code:  [][]byte{{byte(PUSH1), 1, byte(PUSH1), 1, byte(CALLF), 0, 1, byte(STOP)}, append(pushes(1023), byte(RETF))},
+			err:   "stack overflow by CALLF",
+		},
+		"retf in first section": withErr(main(0, byte(RETF)), "RETF in the first code section"),
+		"retf wrong outputs": {
+			types: []FunctionMetadata{{0, 0, 1}, {0, 1, 0}},
+			code:  [][]byte{{byte(CALLF), 0, 1, byte(STOP)}, {byte(RETF)}},
+			err:   "RETF with stack height",
+		},
+		"stack above limit": withErr(main(1024, append(pushes(1024), byte(STOP))...), "above limit"),
+	} {
+		c := &Container{Types: tc.types, Code: tc.code}
+		b := c.MarshalBinary()
+		_, err := ParseAndValidateEOF(b, &jt)
+		if tc.err == "" {
+			require.NoError(t, err, name)
+			continue
+		}
+		require.Error(t, err, name)
+		require.True(t, errors.Is(err, ErrInvalidEOF), name)
+		require.Contains(t, err.Error(), tc.err, name)
+	}
+}
+
+func pushes(n int) []byte {
+	code := make([]byte, 0, 2*n)
+	for i := 0; i < n; i++ {
+		code = append(code, byte(PUSH1), 0)
+	}
+	return code
+}
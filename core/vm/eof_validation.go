@@ -0,0 +1,184 @@
+package vm
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon/params"
+)
+
+// opInvalid - designated invalid instruction (EIP-141), allowed in EOF code
+const opInvalid OpCode = 0xfe
+
+// ValidateCode - validates code sections of the container:
+//   - EIP-3670: only defined instructions, no truncated immediates
+//   - EIP-4200: targets of relative jumps are instructions of the same section
+//   - EIP-4750: CALLF targets existing section, RETF is not used in the first section
+//   - EIP-5450: stack height is the same at every instruction regardless of the path which reaches it, there is no
+//     stack underflow, RETF leaves exactly section outputs on the stack, max stack height matches types section,
+//     every instruction is reachable and execution can't fall off the end of the section
+func (c *Container) ValidateCode(jt *JumpTable) error {
+	for i, code := range c.Code {
+		if err := c.validateSection(i, code, jt); err != nil {
+			return fmt.Errorf("%w: code section %d: %v", ErrInvalidEOF, i, err)
+		}
+	}
+	return nil
+}
+
+// immediateSize - size of immediate data of instruction at pos, code must have at least 2 bytes after RJUMPV
+func immediateSize(code []byte, pos int) int {
+	op := OpCode(code[pos])
+	switch {
+	case op >= PUSH1 && op <= PUSH32:
+		return int(op-PUSH1) + 1
+	case op == RJUMP || op == RJUMPI || op == CALLF:
+		return 2
+	case op == RJUMPV:
+		return 1 + 2*int(code[pos+1])
+	}
+	return 0
+}
+
+func isTerminating(op OpCode) bool {
+	switch op {
+	case STOP, RETURN, REVERT, SELFDESTRUCT, opInvalid, RETF, RJUMP:
+		return true
+	}
+	return false
+}
+
+// relativeJumpTargets - destinations of RJUMP, RJUMPI or RJUMPV at pos
+func relativeJumpTargets(code []byte, pos int) []int {
+	switch OpCode(code[pos]) {
+	case RJUMP, RJUMPI:
+		return []int{pos + 3 + int(int16(binary.BigEndian.Uint16(code[pos+1:])))}
+	case RJUMPV:
+		count := int(code[pos+1])
+		next := pos + 2 + 2*count
+		targets := make([]int, count)
+		for i := range targets {
+			targets[i] = next + int(int16(binary.BigEndian.Uint16(code[pos+2+2*i:])))
+		}
+		return targets
+	}
+	return nil
+}
+
+func (c *Container) validateSection(section int, code []byte, jt *JumpTable) error {
+	// instruction boundaries and immediates
+	isInstruction := make([]bool, len(code))
+	for pos := 0; pos < len(code); {
+		op := OpCode(code[pos])
+		if jt[op] == nil && op != opInvalid {
+			return fmt.Errorf("undefined instruction %s at %d", op, pos)
+		}
+		if op == RJUMPV {
+			if pos+1 >= len(code) {
+				return fmt.Errorf("truncated RJUMPV at %d", pos)
+			}
+			if code[pos+1] == 0 {
+				return fmt.Errorf("RJUMPV with empty jump table at %d", pos)
+			}
+		}
+		isInstruction[pos] = true
+		next := pos + 1 + immediateSize(code, pos)
+		if next > len(code) {
+			return fmt.Errorf("truncated immediate of %s at %d", op, pos)
+		}
+		switch op {
+		case CALLF:
+			if idx := int(binary.BigEndian.Uint16(code[pos+1:])); idx >= len(c.Code) {
+				return fmt.Errorf("CALLF to unknown code section %d at %d", idx, pos)
+			}
+		case RETF:
+			if section == 0 {
+				return fmt.Errorf("RETF in the first code section at %d", pos)
+			}
+		}
+		pos = next
+	}
+	for pos := range code {
+		if !isInstruction[pos] {
+			continue
+		}
+		for _, target := range relativeJumpTargets(code, pos) {
+			if target < 0 || target >= len(code) || !isInstruction[target] {
+				return fmt.Errorf("invalid relative jump target %d at %d", target, pos)
+			}
+		}
+	}
+	return c.validateStack(section, code, jt)
+}
+
+// validateStack - EIP-5450 stack validation, single pass over the control flow graph of the section
+func (c *Container) validateStack(section int, code []byte, jt *JumpTable) error {
+	typ := c.Types[section]
+	heights := make([]int, len(code))
+	for i := range heights {
+		heights[i] = -1
+	}
+	heights[0] = int(typ.Inputs)
+	maxHeight := int(typ.Inputs)
+	worklist := []int{0}
+	for len(worklist) > 0 {
+		pos := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		height := heights[pos]
+		op := OpCode(code[pos])
+
+		var required, delta int
+		switch op {
+		case CALLF:
+			callee := c.Types[binary.BigEndian.Uint16(code[pos+1:])]
+			required, delta = int(callee.Inputs), int(callee.Outputs)-int(callee.Inputs)
+			if height+int(callee.MaxStackHeight)-int(callee.Inputs) > int(params.StackLimit) {
+				return fmt.Errorf("stack overflow by CALLF at %d", pos)
+			}
+		case RETF:
+			if height != int(typ.Outputs) {
+				return fmt.Errorf("RETF with stack height %d, section has %d outputs, at %d", height, typ.Outputs, pos)
+			}
+		case opInvalid:
+		default:
+			operation := jt[op]
+			required, delta = operation.minStack, int(params.StackLimit)-operation.maxStack
+		}
+		if height < required {
+			return fmt.Errorf("stack underflow by %s at %d", op, pos)
+		}
+		height += delta
+		if height > maxHeight {
+			maxHeight = height
+		}
+
+		var successors []int
+		if !isTerminating(op) {
+			successors = append(successors, pos+1+immediateSize(code, pos))
+		}
+		successors = append(successors, relativeJumpTargets(code, pos)...)
+		for _, next := range successors {
+			if next >= len(code) {
+				return fmt.Errorf("execution falls off the end of code after %s at %d", op, pos)
+			}
+			if heights[next] == -1 {
+				heights[next] = height
+				worklist = append(worklist, next)
+			} else if heights[next] != height {
+				return fmt.Errorf("stack height mismatch at %d: %d and %d", next, heights[next], height)
+			}
+		}
+	}
+	for pos := 0; pos < len(code); pos += 1 + immediateSize(code, pos) {
+		if heights[pos] == -1 {
+			return fmt.Errorf("unreachable instruction at %d", pos)
+		}
+	}
+	if maxHeight > eofMaxStackHeight {
+		return fmt.Errorf("max stack height %d is above limit", maxHeight)
+	}
+	if maxHeight != int(typ.MaxStackHeight) {
+		return fmt.Errorf("max stack height %d doesn't match types section %d", maxHeight, typ.MaxStackHeight)
+	}
+	return nil
+}
@@ -41,6 +41,7 @@ var (
 	ErrReturnStackExceeded      = errors.New("return stack limit reached")
 	ErrInvalidCode              = errors.New("invalid code")
 	ErrNonceUintOverflow        = errors.New("nonce uint64 overflow")
+	ErrInvalidEOF               = errors.New("invalid EOF container")
 )
 
 // ErrStackUnderflow wraps an evm error when the items on the stack less
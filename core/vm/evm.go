@@ -44,18 +44,7 @@ type (
 )
 
 func (evm *EVM) precompile(addr common.Address) (PrecompiledContract, bool) {
-	var precompiles map[common.Address]PrecompiledContract
-	switch {
-	case evm.chainRules.IsBerlin:
-		precompiles = PrecompiledContractsBerlin
-	case evm.chainRules.IsIstanbul:
-		precompiles = PrecompiledContractsIstanbul
-	case evm.chainRules.IsByzantium:
-		precompiles = PrecompiledContractsByzantium
-	default:
-		precompiles = PrecompiledContractsHomestead
-	}
-	p, ok := precompiles[addr]
+	p, ok := evm.precompiles[addr]
 	return p, ok
 }
 
@@ -143,6 +132,8 @@ type EVM struct {
 	chainConfig *params.ChainConfig
 	// chain rules contains the chain rules for the current epoch
 	chainRules params.Rules
+	// precompiles of the current fork and ones registered for the chain by RegisterPrecompiles
+	precompiles map[common.Address]PrecompiledContract
 	// virtual machine configuration options used to initialise the
 	// evm.
 	config Config
@@ -169,6 +160,7 @@ func NewEVM(blockCtx BlockContext, txCtx TxContext, state IntraBlockState, chain
 		config:          vmConfig,
 		chainConfig:     chainConfig,
 		chainRules:      chainConfig.Rules(blockCtx.BlockNumber),
+		precompiles:     PrecompiledContracts(chainConfig, blockCtx.BlockNumber),
 	}
 
 	evmInterp := NewEVMInterpreter(evm, vmConfig)
@@ -537,14 +529,23 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 		return nil, address, gas, nil
 	}
 
-	ret, err = run(evm, contract, nil, false)
+	// EOF initcode must be valid EOF container (EIP-3540)
+	if evm.chainRules.IsEOF && hasEOFMagic(codeAndHash.code) {
+		contract.container, err = ParseAndValidateEOF(codeAndHash.code, evm.eofInstructionSet())
+	}
+	if err == nil {
+		ret, err = run(evm, contract, nil, false)
+	}
 
 	// check whether the max code size has been exceeded
 	maxCodeSizeExceeded := evm.chainRules.IsEIP158 && len(ret) > params.MaxCodeSize
 
 	// Reject code starting with 0xEF if EIP-3541 is enabled.
+	// EOF initcode can deploy only valid EOF code (EIP-3540).
 	if err == nil && !maxCodeSizeExceeded {
-		if evm.chainRules.IsLondon && len(ret) >= 1 && ret[0] == 0xEF {
+		if contract.container != nil {
+			_, err = ParseAndValidateEOF(ret, evm.eofInstructionSet())
+		} else if evm.chainRules.IsLondon && len(ret) >= 1 && ret[0] == 0xEF {
 			err = ErrInvalidCode
 		}
 	}
@@ -598,6 +599,14 @@ func (evm *EVM) Create2(caller ContractRef, code []byte, gas uint64, endowment *
 	return evm.create(caller, codeAndHash, gas, endowment, contractAddr, CREATE2T)
 }
 
+// eofInstructionSet - instruction set against which EOF code is validated, nil before EOF fork
+func (evm *EVM) eofInstructionSet() *JumpTable {
+	if in, ok := evm.interpreters[EVMType].(*EVMInterpreter); ok {
+		return in.eofJt
+	}
+	return nil
+}
+
 // ChainConfig returns the environment's chain configuration
 func (evm *EVM) Config() Config {
 	return evm.config
@@ -0,0 +1,74 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Names of intrinsic costs which can be overridden by GasSchedule
+const (
+	IntrinsicTx             = "tx"
+	IntrinsicContractCreate = "txContractCreation"
+	IntrinsicDataZero       = "txDataZero"
+	IntrinsicDataNonZero    = "txDataNonZero"
+)
+
+// GasSchedule - modified gas costs, used to evaluate repricing proposals against historical transactions.
+// Costs which are not mentioned keep their values of the active fork. Only static part of instruction cost
+// can be overridden, dynamic part (memory expansion, cold access, etc.) is unchanged.
+//
+//	{"opcodes": {"SLOAD": 2100, "BALANCE": 2600}, "intrinsic": {"txDataNonZero": 8}}
+type GasSchedule struct {
+	Opcodes   map[string]uint64 `json:"opcodes,omitempty"`   // constant gas by instruction name
+	Intrinsic map[string]uint64 `json:"intrinsic,omitempty"` // IntrinsicTx, IntrinsicContractCreate, IntrinsicDataZero, IntrinsicDataNonZero
+}
+
+// ParseGasSchedule - decodes schedule from JSON and checks names of instructions and intrinsic costs
+func ParseGasSchedule(data []byte) (*GasSchedule, error) {
+	s := &GasSchedule{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	for name := range s.Opcodes {
+		if _, ok := stringToOp[name]; !ok {
+			return nil, fmt.Errorf("unknown instruction %q", name)
+		}
+	}
+	for name := range s.Intrinsic {
+		switch name {
+		case IntrinsicTx, IntrinsicContractCreate, IntrinsicDataZero, IntrinsicDataNonZero:
+		default:
+			return nil, fmt.Errorf("unknown intrinsic cost %q", name)
+		}
+	}
+	return s, nil
+}
+
+// IntrinsicCost - overridden intrinsic cost, or def if schedule doesn't change it. Safe to call on nil schedule.
+func (s *GasSchedule) IntrinsicCost(name string, def uint64) uint64 {
+	if s == nil {
+		return def
+	}
+	if cost, ok := s.Intrinsic[name]; ok {
+		return cost
+	}
+	return def
+}
+
+// apply - copy of jt with overridden constant gas, instruction tables of forks are shared and must not be modified
+func (s *GasSchedule) apply(jt *JumpTable) *JumpTable {
+	if len(s.Opcodes) == 0 {
+		return jt
+	}
+	modified := *jt
+	for name, cost := range s.Opcodes {
+		op := stringToOp[name]
+		if modified[op] == nil {
+			continue // not available in this fork
+		}
+		operation := *modified[op]
+		operation.constantGas = cost
+		modified[op] = &operation
+	}
+	return &modified
+}
@@ -0,0 +1,36 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGasSchedule(t *testing.T) {
+	s, err := ParseGasSchedule([]byte(`{"opcodes": {"SLOAD": 5000, "ADD": 1}, "intrinsic": {"txDataNonZero": 8}}`))
+	require.NoError(t, err)
+	require.Equal(t, uint64(8), s.IntrinsicCost(IntrinsicDataNonZero, params.TxDataNonZeroGasEIP2028))
+	require.Equal(t, params.TxGas, s.IntrinsicCost(IntrinsicTx, params.TxGas))
+
+	var nilSchedule *GasSchedule
+	require.Equal(t, params.TxGas, nilSchedule.IntrinsicCost(IntrinsicTx, params.TxGas))
+
+	_, err = ParseGasSchedule([]byte(`{"opcodes": {"SLOADX": 5000}}`))
+	require.Error(t, err)
+	_, err = ParseGasSchedule([]byte(`{"intrinsic": {"txData": 8}}`))
+	require.Error(t, err)
+	_, err = ParseGasSchedule([]byte(`{"opcodes": {"SLOAD": -1}}`))
+	require.Error(t, err)
+}
+
+func TestGasScheduleApply(t *testing.T) {
+	s := &GasSchedule{Opcodes: map[string]uint64{"ADD": 10, "BASEFEE": 7}}
+	jt := s.apply(&istanbulInstructionSet)
+	require.Equal(t, uint64(10), jt[ADD].constantGas)
+	require.Nil(t, jt[BASEFEE], "instruction is not enabled by the schedule")
+	require.Equal(t, GasFastestStep, istanbulInstructionSet[ADD].constantGas, "instruction set of the fork is not modified")
+	require.Equal(t, istanbulInstructionSet[MUL], jt[MUL])
+
+	require.Equal(t, &istanbulInstructionSet, (&GasSchedule{}).apply(&istanbulInstructionSet))
+}
@@ -94,6 +94,7 @@ type VMInterface interface {
 	Create(caller ContractRef, code []byte, gas uint64, value *uint256.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error)
 	Call(caller ContractRef, addr common.Address, input []byte, gas uint64, value *uint256.Int, bailout bool) (ret []byte, leftOverGas uint64, err error)
 	Config() Config
+	ChainConfig() *params.ChainConfig
 	ChainRules() params.Rules
 	Context() BlockContext
 	IntraBlockState() IntraBlockState
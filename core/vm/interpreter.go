@@ -38,7 +38,8 @@ type Config struct {
 	ReadOnly      bool   // Do no perform any block finalisation
 	EnableTEMV    bool   // true if execution with TEVM enable flag
 
-	ExtraEips []int // Additional EIPS that are to be enabled
+	ExtraEips   []int        // Additional EIPS that are to be enabled
+	GasSchedule *GasSchedule // Modified gas costs, nil for costs of the fork
 }
 
 // Interpreter is used to run Ethereum based contracts and will utilise the
@@ -84,6 +85,8 @@ type VM struct {
 
 	readOnly   bool   // Whether to throw on stateful modifications
 	returnData []byte // Last CALL's return data for subsequent reuse
+
+	eofJt *JumpTable // EVM instruction table of EOF code, nil before EOF fork
 }
 
 // NewEVMInterpreter returns a new instance of the Interpreter.
@@ -118,11 +121,24 @@ func NewEVMInterpreter(evm *EVM, cfg Config) *EVMInterpreter {
 			}
 		}
 	}
+	if cfg.GasSchedule != nil {
+		jt = cfg.GasSchedule.apply(jt)
+	}
+
+	var eofJt *JumpTable
+	if evm.ChainRules().IsEOF {
+		eof := newEOFInstructionSet(jt)
+		eofJt = &eof
+		if cfg.GasSchedule != nil {
+			eofJt = cfg.GasSchedule.apply(eofJt)
+		}
+	}
 
 	return &EVMInterpreter{
 		VM: &VM{
-			evm: evm,
-			cfg: cfg,
+			evm:   evm,
+			cfg:   cfg,
+			eofJt: eofJt,
 		},
 		jt: jt,
 	}
@@ -159,6 +175,9 @@ func NewEVMInterpreterByVM(vm *VM) *EVMInterpreter {
 			}
 		}
 	}
+	if vm.cfg.GasSchedule != nil {
+		jt = vm.cfg.GasSchedule.apply(jt)
+	}
 
 	return &EVMInterpreter{
 		VM: vm,
@@ -192,6 +211,17 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 	if len(contract.Code) == 0 {
 		return nil, nil
 	}
+	jt := in.jt
+	if in.eofJt != nil && contract.container == nil && hasEOFMagic(contract.Code) {
+		// deployed EOF code was validated on creation, only header needs to be parsed
+		container := &Container{}
+		if err := container.UnmarshalBinary(contract.Code); err == nil {
+			contract.container = container
+		}
+	}
+	if contract.container != nil {
+		jt = in.eofJt
+	}
 
 	var (
 		op          OpCode        // current opcode
@@ -220,6 +250,9 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 		stack.ReturnNormalStack(locStack)
 	}()
 	contract.Input = input
+	if contract.container != nil {
+		pc = contract.container.codeOffsets[0]
+	}
 
 	if in.cfg.Debug {
 		defer func() {
@@ -250,7 +283,7 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 		// Get the operation from the jump table and validate the stack to ensure there are
 		// enough stack items available to perform the operation.
 		op = contract.GetOp(pc)
-		operation := in.jt[op]
+		operation := jt[op]
 
 		if operation == nil {
 			return nil, &ErrInvalidOpCode{opcode: op}
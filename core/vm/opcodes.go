@@ -199,6 +199,15 @@ const (
 	LOG4
 )
 
+// 0xe0 range - relative jumps and functions of EOF code.
+const (
+	RJUMP OpCode = 0xe0 + iota
+	RJUMPI
+	RJUMPV
+	CALLF
+	RETF
+)
+
 // unofficial opcodes used for parsing.
 const (
 	PUSH OpCode = 0xb0 + iota
@@ -372,6 +381,13 @@ var opCodeToString = map[OpCode]string{
 	LOG3:   "LOG3",
 	LOG4:   "LOG4",
 
+	// 0xe0 range.
+	RJUMP:  "RJUMP",
+	RJUMPI: "RJUMPI",
+	RJUMPV: "RJUMPV",
+	CALLF:  "CALLF",
+	RETF:   "RETF",
+
 	// 0xf0 range.
 	CREATE:       "CREATE",
 	CALL:         "CALL",
@@ -533,6 +549,11 @@ var stringToOp = map[string]OpCode{
 	"LOG2":           LOG2,
 	"LOG3":           LOG3,
 	"LOG4":           LOG4,
+	"RJUMP":          RJUMP,
+	"RJUMPI":         RJUMPI,
+	"RJUMPV":         RJUMPV,
+	"CALLF":          CALLF,
+	"RETF":           RETF,
 	"CREATE":         CREATE,
 	"CREATE2":        CREATE2,
 	"CALL":           CALL,
@@ -0,0 +1,110 @@
+package vm
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/params"
+)
+
+// PrecompileOverride - precompiled contract added by application, active from Block
+type PrecompileOverride struct {
+	Contract PrecompiledContract
+	Block    uint64
+}
+
+// PrecompileOverrides - additional precompiled contracts of a chain by address. Override at the address of built-in
+// precompile replaces it.
+type PrecompileOverrides map[common.Address]PrecompileOverride
+
+var (
+	overridesLock sync.RWMutex
+	overrides     = map[string]PrecompileOverrides{}
+)
+
+// RegisterPrecompiles - adds precompiled contracts to the chain with given name (ChainName of chain config). Applications
+// embedding Erigon call it before node creation, usually from init(). Precompiles are resolved when EVM is created.
+// Panics if the name is empty or an address is already registered for the chain.
+func RegisterPrecompiles(chainName string, precompiles PrecompileOverrides) {
+	if chainName == "" {
+		panic("vm: chain name is required to register precompiles")
+	}
+	overridesLock.Lock()
+	defer overridesLock.Unlock()
+	registered, ok := overrides[chainName]
+	if !ok {
+		registered = PrecompileOverrides{}
+		overrides[chainName] = registered
+	}
+	for addr, p := range precompiles {
+		if p.Contract == nil {
+			panic(fmt.Sprintf("vm: nil precompile at %x for chain %q", addr, chainName))
+		}
+		if _, ok := registered[addr]; ok {
+			panic(fmt.Sprintf("vm: precompile at %x is already registered for chain %q", addr, chainName))
+		}
+		registered[addr] = p
+	}
+}
+
+func builtinPrecompiles(rules params.Rules) map[common.Address]PrecompiledContract {
+	switch {
+	case rules.IsBerlin:
+		return PrecompiledContractsBerlin
+	case rules.IsIstanbul:
+		return PrecompiledContractsIstanbul
+	case rules.IsByzantium:
+		return PrecompiledContractsByzantium
+	default:
+		return PrecompiledContractsHomestead
+	}
+}
+
+func hasOverrides(chainName string) bool {
+	overridesLock.RLock()
+	defer overridesLock.RUnlock()
+	return len(overrides[chainName]) > 0
+}
+
+// PrecompiledContracts - precompiled contracts of the chain at given block: built-in ones of the active fork and
+// registered overrides. Must not be modified.
+func PrecompiledContracts(chainConfig *params.ChainConfig, blockNumber uint64) map[common.Address]PrecompiledContract {
+	builtin := builtinPrecompiles(chainConfig.Rules(blockNumber))
+	overridesLock.RLock()
+	defer overridesLock.RUnlock()
+	registered := overrides[chainConfig.ChainName]
+	if len(registered) == 0 {
+		return builtin
+	}
+	var precompiles map[common.Address]PrecompiledContract
+	for addr, p := range registered {
+		if p.Block > blockNumber {
+			continue
+		}
+		if precompiles == nil {
+			precompiles = make(map[common.Address]PrecompiledContract, len(builtin)+len(registered))
+			for builtinAddr, builtinContract := range builtin {
+				precompiles[builtinAddr] = builtinContract
+			}
+		}
+		precompiles[addr] = p.Contract
+	}
+	if precompiles == nil {
+		return builtin
+	}
+	return precompiles
+}
+
+// PrecompiledAddresses - addresses of PrecompiledContracts, they are warm from the start of transaction (EIP-2929)
+func PrecompiledAddresses(chainConfig *params.ChainConfig, blockNumber uint64) []common.Address {
+	if !hasOverrides(chainConfig.ChainName) {
+		return ActivePrecompiles(chainConfig.Rules(blockNumber))
+	}
+	precompiles := PrecompiledContracts(chainConfig, blockNumber)
+	addresses := make([]common.Address, 0, len(precompiles))
+	for addr := range precompiles {
+		addresses = append(addresses, addr)
+	}
+	return addresses
+}
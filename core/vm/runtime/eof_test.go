@@ -0,0 +1,121 @@
+package runtime
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/stretchr/testify/require"
+)
+
+func eofConfig() *Config {
+	cfg := &Config{}
+	setDefaults(cfg)
+	chainConfig := *cfg.ChainConfig
+	chainConfig.EOFBlock = new(big.Int)
+	cfg.ChainConfig = &chainConfig
+	return cfg
+}
+
+// returnTop - stores top of the stack to memory and returns it
+var returnTop = []byte{byte(vm.PUSH1), 0, byte(vm.MSTORE), byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.RETURN)}
+
+func TestEOFExecute(t *testing.T) {
+	// CALLF to the function which adds its two inputs
+	code := (&vm.Container{
+		Types: []vm.FunctionMetadata{{Inputs: 0, Outputs: 0, MaxStackHeight: 2}, {Inputs: 2, Outputs: 1, MaxStackHeight: 2}},
+		Code: [][]byte{
+			append([]byte{byte(vm.PUSH1), 40, byte(vm.PUSH1), 2, byte(vm.CALLF), 0, 1}, returnTop...),
+			{byte(vm.ADD), byte(vm.RETF)},
+		},
+	}).MarshalBinary()
+	ret, _, err := Execute(code, nil, eofConfig(), 0)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(42), new(big.Int).SetBytes(ret))
+
+	// EOF code is not recognized before the fork
+	_, _, err = Execute(code, nil, nil, 0)
+	require.Error(t, err)
+
+	// RJUMPV selects the second branch, which jumps over the first one
+	code = (&vm.Container{
+		Types: []vm.FunctionMetadata{{MaxStackHeight: 2}},
+		Code: [][]byte{append([]byte{
+			byte(vm.PUSH1), 1, byte(vm.RJUMPV), 2, 0, 0, 0, 5,
+			byte(vm.PUSH1), 10, byte(vm.RJUMP), 0, 2,
+			byte(vm.PUSH1), 20,
+		}, returnTop...)},
+	}).MarshalBinary()
+	ret, _, err = Execute(code, nil, eofConfig(), 0)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(20), new(big.Int).SetBytes(ret))
+
+	// loop: counter from 5 down to 0, accumulating 1+2+3+4+5 in the second stack item
+	code = (&vm.Container{
+		Types: []vm.FunctionMetadata{{MaxStackHeight: 3}},
+		Code: [][]byte{append([]byte{
+			byte(vm.PUSH1), 0, byte(vm.PUSH1), 5, // sum, counter
+			byte(vm.DUP1), byte(vm.SWAP2), byte(vm.ADD), byte(vm.SWAP1), // sum+counter, counter
+			byte(vm.PUSH1), 1, byte(vm.SWAP1), byte(vm.SUB), // sum, counter-1
+			byte(vm.DUP1), byte(vm.RJUMPI), 0xff, 0xf4,
+			byte(vm.POP),
+		}, returnTop...)},
+	}).MarshalBinary()
+	ret, _, err = Execute(code, nil, eofConfig(), 0)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(15), new(big.Int).SetBytes(ret))
+}
+
+// eofInitcode - EOF initcode which deploys given code, placed in its data section
+func eofInitcode(deployed []byte) []byte {
+	size := byte(len(deployed))
+	initcode := &vm.Container{
+		Types: []vm.FunctionMetadata{{MaxStackHeight: 3}},
+		Code: [][]byte{{
+			byte(vm.PUSH1), size, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.CODECOPY),
+			byte(vm.PUSH1), size, byte(vm.PUSH1), 0, byte(vm.RETURN),
+		}},
+		Data: deployed,
+	}
+	// data offset in CODECOPY
+	initcode.Code[0][3] = byte(len(initcode.MarshalBinary()) - len(deployed))
+	return initcode.MarshalBinary()
+}
+
+func TestEOFCreate(t *testing.T) {
+	deployed := (&vm.Container{
+		Types: []vm.FunctionMetadata{{MaxStackHeight: 2}},
+		Code:  [][]byte{append([]byte{byte(vm.PUSH1), 42}, returnTop...)},
+	}).MarshalBinary()
+	ret, _, _, err := Create(eofInitcode(deployed), eofConfig(), 0)
+	require.NoError(t, err)
+	require.Equal(t, deployed, ret)
+
+	// EOF initcode can't deploy legacy code
+	legacy := append([]byte{byte(vm.PUSH1), 42}, returnTop...)
+	_, _, _, err = Create(eofInitcode(legacy), eofConfig(), 0)
+	require.True(t, errors.Is(err, vm.ErrInvalidEOF), err)
+
+	// nor invalid EOF code
+	invalid := append([]byte{}, deployed...)
+	invalid[len(invalid)-1] = byte(vm.PUSH1) // falls off the end
+	_, _, _, err = Create(eofInitcode(invalid), eofConfig(), 0)
+	require.True(t, errors.Is(err, vm.ErrInvalidEOF), err)
+
+	// invalid EOF initcode is not executed
+	initcode := eofInitcode(deployed)
+	initcode[len(initcode)-len(deployed)-1] = byte(vm.JUMP)
+	_, _, leftOverGas, err := Create(initcode, eofConfig(), 0)
+	require.True(t, errors.Is(err, vm.ErrInvalidEOF), err)
+	require.Equal(t, uint64(0), leftOverGas)
+
+	// legacy initcode can't deploy EOF code (EIP-3541)
+	legacyInitcode := []byte{
+		byte(vm.PUSH1), byte(len(deployed)), byte(vm.DUP1), byte(vm.PUSH1), 12, byte(vm.PUSH1), 0, byte(vm.CODECOPY),
+		byte(vm.PUSH1), 0, byte(vm.RETURN),
+	}
+	legacyInitcode = append(legacyInitcode, make([]byte, 12-len(legacyInitcode))...)
+	_, _, _, err = Create(append(legacyInitcode, deployed...), eofConfig(), 0)
+	require.Equal(t, vm.ErrInvalidCode, err)
+}
@@ -0,0 +1,21 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGasSchedule(t *testing.T) {
+	code := []byte{byte(vm.PUSH1), 1, byte(vm.PUSH1), 2, byte(vm.ADD), byte(vm.POP), byte(vm.STOP)}
+	cfg := &Config{GasLimit: 100}
+	_, _, baseline, err := Create(code, cfg, 0)
+	require.NoError(t, err)
+
+	cfg = &Config{GasLimit: 100, EVMConfig: vm.Config{GasSchedule: &vm.GasSchedule{Opcodes: map[string]uint64{"ADD": 13, "PUSH1": 0}}}}
+	_, _, modified, err := Create(code, cfg, 0)
+	require.NoError(t, err)
+	// ADD: 3 -> 13, two PUSH1: 3 -> 0
+	require.Equal(t, baseline-10+6, modified)
+}
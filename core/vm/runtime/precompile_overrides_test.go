@@ -0,0 +1,79 @@
+package runtime
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/stretchr/testify/require"
+)
+
+// invert - precompile which inverts bits of the input
+type invert struct{}
+
+func (invert) RequiredGas(input []byte) uint64 { return 7 }
+
+func (invert) Run(input []byte) ([]byte, error) {
+	out := make([]byte, len(input))
+	for i, b := range input {
+		out[i] = ^b
+	}
+	return out, nil
+}
+
+func TestPrecompileOverrides(t *testing.T) {
+	addr := common.BytesToAddress([]byte{1, 0})
+	vm.RegisterPrecompiles("precompile-test", vm.PrecompileOverrides{
+		addr:                             {Contract: invert{}, Block: 10},
+		common.BytesToAddress([]byte{2}): {Contract: invert{}}, // replaces sha256
+	})
+	require.Panics(t, func() {
+		vm.RegisterPrecompiles("precompile-test", vm.PrecompileOverrides{addr: {Contract: invert{}}})
+	})
+
+	callWord := func(to common.Address) []byte {
+		// mstore(0, 0x2a), call(gas, to, 0, 0, 32, 0, 32), return(0, 32)
+		code := []byte{byte(vm.PUSH1), 0x2a, byte(vm.PUSH1), 0, byte(vm.MSTORE),
+			byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0,
+			byte(vm.PUSH20)}
+		code = append(code, to[:]...)
+		return append(code, byte(vm.GAS), byte(vm.CALL), byte(vm.POP),
+			byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.RETURN))
+	}
+	config := func(block int64) *Config {
+		cfg := &Config{BlockNumber: big.NewInt(block)}
+		setDefaults(cfg)
+		chainConfig := *cfg.ChainConfig
+		chainConfig.ChainName = "precompile-test"
+		cfg.ChainConfig = &chainConfig
+		return cfg
+	}
+	inverted := common.LeftPadBytes([]byte{0x2a}, 32)
+	for i := range inverted {
+		inverted[i] = ^inverted[i]
+	}
+
+	// not active yet - empty account
+	ret, _, err := Execute(callWord(addr), nil, config(9), 0)
+	require.NoError(t, err)
+	require.Equal(t, common.LeftPadBytes([]byte{0x2a}, 32), ret)
+	require.NotContains(t, vm.PrecompiledAddresses(config(9).ChainConfig, 9), addr)
+
+	ret, _, err = Execute(callWord(addr), nil, config(10), 0)
+	require.NoError(t, err)
+	require.Equal(t, inverted, ret)
+	require.Contains(t, vm.PrecompiledAddresses(config(10).ChainConfig, 10), addr)
+
+	ret, _, err = Execute(callWord(common.BytesToAddress([]byte{2})), nil, config(0), 0)
+	require.NoError(t, err)
+	require.Equal(t, inverted, ret)
+
+	// other chains are not affected
+	cfg := &Config{BlockNumber: big.NewInt(10)}
+	setDefaults(cfg)
+	ret, _, err = Execute(callWord(addr), nil, cfg, 0)
+	require.NoError(t, err)
+	require.Equal(t, common.LeftPadBytes([]byte{0x2a}, 32), ret)
+	require.NotContains(t, vm.PrecompiledAddresses(cfg.ChainConfig, 10), addr)
+}
@@ -129,7 +129,7 @@ func Execute(code, input []byte, cfg *Config, blockNr uint64) ([]byte, *state.In
 		sender  = vm.AccountRef(cfg.Origin)
 	)
 	if rules := cfg.ChainConfig.Rules(vmenv.Context().BlockNumber); rules.IsBerlin {
-		cfg.State.PrepareAccessList(cfg.Origin, &address, vm.ActivePrecompiles(rules), nil)
+		cfg.State.PrepareAccessList(cfg.Origin, &address, vm.PrecompiledAddresses(cfg.ChainConfig, vmenv.Context().BlockNumber), nil)
 	}
 	cfg.State.CreateAccount(address, true)
 	// set the receiver's (the executing contract) code for execution.
@@ -167,7 +167,7 @@ func Create(input []byte, cfg *Config, blockNr uint64) ([]byte, common.Address,
 		sender = vm.AccountRef(cfg.Origin)
 	)
 	if rules := cfg.ChainConfig.Rules(vmenv.Context().BlockNumber); rules.IsBerlin {
-		cfg.State.PrepareAccessList(cfg.Origin, nil, vm.ActivePrecompiles(rules), nil)
+		cfg.State.PrepareAccessList(cfg.Origin, nil, vm.PrecompiledAddresses(cfg.ChainConfig, vmenv.Context().BlockNumber), nil)
 	}
 
 	// Call the code with the given configuration.
@@ -193,7 +193,7 @@ func Call(address common.Address, input []byte, cfg *Config) ([]byte, uint64, er
 	sender := cfg.State.GetOrNewStateObject(cfg.Origin)
 	statedb := cfg.State
 	if rules := cfg.ChainConfig.Rules(vmenv.Context().BlockNumber); rules.IsBerlin {
-		statedb.PrepareAccessList(cfg.Origin, &address, vm.ActivePrecompiles(rules), nil)
+		statedb.PrepareAccessList(cfg.Origin, &address, vm.PrecompiledAddresses(cfg.ChainConfig, vmenv.Context().BlockNumber), nil)
 	}
 
 	// Call the code with the given configuration.
@@ -0,0 +1,60 @@
+package crypto
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// BatchRecoverer recovers public keys of many signatures by one call. Senders stage uses it during initial sync,
+// where batches are big enough to pay for transfer to an accelerator (e.g. GPU). Implementations are registered
+// by RegisterBatchRecoverer and selected by name. None is built in: libsecp256k1 has no batch recovery, and Senders
+// stage already recovers on all its contexts in parallel.
+type BatchRecoverer interface {
+	// RecoverBatch fills pubkeys[i] by uncompressed (65 bytes) public key recovered from hashes[i] (32 bytes) and
+	// sigs[i] (65 bytes, [R || S || V]). Signature which can't be recovered gets nil key. Error means the batch
+	// was not served at all - caller recovers it on CPU.
+	// Must be safe for concurrent use.
+	RecoverBatch(hashes, sigs, pubkeys [][]byte) error
+}
+
+var (
+	batchRecoverersLock sync.Mutex
+	batchRecoverers     = map[string]func() (BatchRecoverer, error){}
+)
+
+// RegisterBatchRecoverer makes recoverer available by name. Open is called once, when recoverer is selected.
+func RegisterBatchRecoverer(name string, open func() (BatchRecoverer, error)) {
+	batchRecoverersLock.Lock()
+	defer batchRecoverersLock.Unlock()
+	if _, ok := batchRecoverers[name]; ok {
+		panic(fmt.Sprintf("batch recoverer %s is already registered", name))
+	}
+	batchRecoverers[name] = open
+}
+
+// BatchRecoverers returns names of registered recoverers
+func BatchRecoverers() []string {
+	batchRecoverersLock.Lock()
+	defer batchRecoverersLock.Unlock()
+	names := make([]string, 0, len(batchRecoverers))
+	for name := range batchRecoverers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenBatchRecoverer returns recoverer registered by name, nil if name is empty
+func OpenBatchRecoverer(name string) (BatchRecoverer, error) {
+	if name == "" {
+		return nil, nil
+	}
+	batchRecoverersLock.Lock()
+	open, ok := batchRecoverers[name]
+	batchRecoverersLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown batch recoverer %s, available: %v", name, BatchRecoverers())
+	}
+	return open()
+}
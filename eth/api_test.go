@@ -245,7 +245,7 @@ func TestStorageRangeAt(t *testing.T) {
 		},
 	}
 
-	dbs := adapter.NewStateReader(db.RwKV(), 1)
+	dbs := adapter.NewStateReader(db.RwKV(), 1, nil)
 	for i, test := range tests {
 		test := test
 		t.Run("test_"+strconv.Itoa(i), func(t *testing.T) {
@@ -20,9 +20,11 @@ package eth
 import (
 	"context"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
+	"net/http"
 	"os"
 	"path"
 	"reflect"
@@ -57,23 +59,37 @@ import (
 	"github.com/ledgerwatch/erigon/consensus/ethash"
 	"github.com/ledgerwatch/erigon/core"
 	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/state/remotestate"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/core/vm"
 	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/eth/builder"
+	"github.com/ledgerwatch/erigon/eth/clcheckpoint"
+	"github.com/ledgerwatch/erigon/eth/clfollower"
 	"github.com/ledgerwatch/erigon/eth/ethconfig"
 	"github.com/ledgerwatch/erigon/eth/ethutils"
 	"github.com/ledgerwatch/erigon/eth/protocols/eth"
 	"github.com/ledgerwatch/erigon/eth/stagedsync"
+	"github.com/ledgerwatch/erigon/eth/txpoolevents"
+	"github.com/ledgerwatch/erigon/eth/txpoolfetch"
+	"github.com/ledgerwatch/erigon/eth/txpoolshadow"
 	"github.com/ledgerwatch/erigon/ethdb/privateapi"
 	"github.com/ledgerwatch/erigon/ethdb/prune"
 	"github.com/ledgerwatch/erigon/node"
 	"github.com/ledgerwatch/erigon/p2p"
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/export"
+	"github.com/ledgerwatch/erigon/turbo/firehose"
+	"github.com/ledgerwatch/erigon/turbo/reexec"
 	"github.com/ledgerwatch/erigon/turbo/shards"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/historysnapshot"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snapshothashes"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snapshotmerge"
 	stages2 "github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/ledgerwatch/erigon/turbo/tiering"
 	"github.com/ledgerwatch/log/v3"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -91,6 +107,10 @@ type Ethereum struct {
 	// DB interfaces
 	chainDB    kv.RwDB
 	privateAPI *grpc.Server
+	builderAPI *grpc.Server
+
+	relayProxy *http.Server
+	firehose   firehose.Sink // opened by --firehose.sink, sinks of embedders are closed by them
 
 	engine consensus.Engine
 
@@ -114,9 +134,13 @@ type Ethereum struct {
 	sentryServers       []*sentry.SentryServerImpl
 	sentries            []direct.SentryClient
 
-	stagedSync *stagedsync.Sync
+	stagedSync   *stagedsync.Sync
+	stagesCtx    context.Context // cancelled if staged sync doesn't stop at safe checkpoint in config.ShutdownTimeout
+	stagesCancel context.CancelFunc
+	admin        *stages2.Admin
 
 	downloaderClient proto_downloader.DownloaderClient
+	historySnapshots *historysnapshot.Files
 
 	notifications *stagedsync.Notifications
 
@@ -129,6 +153,9 @@ type Ethereum struct {
 	txPool2Fetch            *txpool2.Fetch
 	txPool2Send             *txpool2.Send
 	txPool2GrpcServer       *txpool2.GrpcServer
+	txPoolShadow            *txpoolshadow.Shadow
+	txPoolFetchScheduler    *txpoolfetch.Scheduler
+	txPoolEvents            *txpoolevents.Bus
 	notifyMiningAboutNewTxs chan struct{}
 	// When we receive something here, it means that the beacon chain transitioned
 	// to proof-of-stake so we start reverse syncing from the header
@@ -177,11 +204,25 @@ func New(stack *node.Node, config *ethconfig.Config, logger log.Logger) (*Ethere
 	types.SetHeaderSealFlag(chainConfig.IsHeaderWithSeal())
 	log.Info("Initialised chain configuration", "config", chainConfig)
 
+	// old blocks moved to cold database are read by transactions of chaindata, cold database is closed with it
+	var hotKv kv.RwDB = chainKv
+	var coldDB *tiering.Cold
+	if config.TieringColdDir != "" {
+		if coldDB, err = tiering.Open(config.TieringColdDir, chainKv, false); err != nil {
+			return nil, err
+		}
+		log.Info("[tiering] Opened cold database", "dir", config.TieringColdDir, "to", coldDB.To())
+		chainKv = tiering.NewDB(chainKv, coldDB)
+	}
+
 	ctx, ctxCancel := context.WithCancel(context.Background())
+	stagesCtx, stagesCancel := context.WithCancel(context.Background())
 	kvRPC := remotedbserver.NewKvServer(ctx, chainKv)
 	backend := &Ethereum{
 		sentryCtx:            ctx,
 		sentryCancel:         ctxCancel,
+		stagesCtx:            stagesCtx,
+		stagesCancel:         stagesCancel,
 		config:               config,
 		logger:               logger,
 		chainDB:              chainKv,
@@ -194,6 +235,7 @@ func New(stack *node.Node, config *ethconfig.Config, logger log.Logger) (*Ethere
 		sentries:             []direct.SentryClient{},
 		notifications: &stagedsync.Notifications{
 			Events:               privateapi.NewEvents(),
+			ForkChoice:           privateapi.NewForkChoice(),
 			Accumulator:          shards.NewAccumulator(chainConfig),
 			StateChangesConsumer: kvRPC,
 		},
@@ -202,10 +244,14 @@ func New(stack *node.Node, config *ethconfig.Config, logger log.Logger) (*Ethere
 
 	var consensusConfig interface{}
 
-	if chainConfig.Clique != nil {
+	if _, ok := consensus.LookupEngine(chainConfig.Consensus); ok {
+		consensusConfig = &config.External
+	} else if chainConfig.Clique != nil {
 		consensusConfig = &config.Clique
 	} else if chainConfig.Parlia != nil {
 		consensusConfig = &config.Parlia
+	} else if chainConfig.Bor != nil {
+		consensusConfig = &config.Bor
 	} else if chainConfig.Aura != nil {
 		config.Aura.Etherbase = config.Miner.Etherbase
 		consensusConfig = &config.Aura
@@ -222,7 +268,7 @@ func New(stack *node.Node, config *ethconfig.Config, logger log.Logger) (*Ethere
 			return err
 		}
 
-		if err = stagedsync.UpdateMetrics(tx); err != nil {
+		if err = stagedsync.UpdateMetrics(chainConfig.ChainName, tx); err != nil {
 			return err
 		}
 
@@ -244,18 +290,31 @@ func New(stack *node.Node, config *ethconfig.Config, logger log.Logger) (*Ethere
 	}); err != nil {
 		return nil, err
 	}
+	if err := logVersionInfo(chainConfig, backend.genesisHash, config.Prune); err != nil {
+		return nil, err
+	}
 
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = stack.ResolvePath(config.TxPool.Journal)
 	}
 
+	var sentryAddrs []string
+	var sentryLabels []sentry.SentryLabels
+	var sentryPeers []sentry.PeersInfoSource
 	if len(stack.Config().P2P.SentryAddr) > 0 {
 		for _, addr := range stack.Config().P2P.SentryAddr {
-			sentryClient, err := sentry.GrpcClient(backend.sentryCtx, addr)
+			host, labels, err := sentry.ParseSentryAddr(addr)
+			if err != nil {
+				return nil, err
+			}
+			sentryAddrs = append(sentryAddrs, host)
+			sentryLabels = append(sentryLabels, labels)
+			sentryClient, peersClient, err := sentry.GrpcClient(backend.sentryCtx, addr)
 			if err != nil {
 				return nil, err
 			}
 			backend.sentries = append(backend.sentries, sentryClient)
+			sentryPeers = append(sentryPeers, peersClient)
 		}
 	} else {
 		var readNodeInfo = func() *eth.NodeInfo {
@@ -275,9 +334,20 @@ func New(stack *node.Node, config *ethconfig.Config, logger log.Logger) (*Ethere
 
 		cfg66 := stack.Config().P2P
 		cfg66.NodeDatabase = path.Join(stack.Config().DataDir, "nodes", "eth66")
+		if config.Snapshot.Enabled {
+			// devp2p shares bandwidth limits with torrent client, if Downloader is configured to share them
+			downloaderConn, err := downloadergrpc.NewConn(ctx, stack.Config().DownloaderAddr)
+			if err != nil {
+				return nil, err
+			}
+			share := downloadergrpc.NewBandwidthShare(backend.sentryCtx, downloadergrpc.BandwidthClassP2P)
+			go share.Loop(backend.sentryCtx, downloaderConn, downloadergrpc.BandwidthReportInterval)
+			cfg66.WrapConn = share.Conn
+		}
 		server66 := sentry.NewSentryServer(backend.sentryCtx, d66, readNodeInfo, &cfg66, eth.ETH66)
 		backend.sentryServers = append(backend.sentryServers, server66)
 		backend.sentries = []direct.SentryClient{direct.NewSentryClientDirect(eth.ETH66, server66)}
+		sentryPeers = []sentry.PeersInfoSource{server66}
 
 		go func() {
 			logEvery := time.NewTicker(120 * time.Second)
@@ -303,6 +373,27 @@ func New(stack *node.Node, config *ethconfig.Config, logger log.Logger) (*Ethere
 	if err != nil {
 		return nil, err
 	}
+	var routing sentry.RoutingPolicy
+	if routing.Headers, err = sentry.ParseSentrySelector(config.SentryPreferHeaders); err != nil {
+		return nil, err
+	}
+	if routing.Bodies, err = sentry.ParseSentrySelector(config.SentryPreferBodies); err != nil {
+		return nil, err
+	}
+	backend.sentryControlServer.SetSentryRouting(sentryAddrs, sentryLabels, routing)
+	backend.sentryControlServer.SetPeersInfo(sentryPeers)
+	var clCheckpoints *clcheckpoint.Checker
+	if len(config.CLEndpoints) > 0 {
+		clCheckpoints, err = clcheckpoint.New(config.CLEndpoints, config.CLQuorum)
+		if err != nil {
+			return nil, err
+		}
+		backend.sentryControlServer.Hd.SetFinalizedCheckpoints(clCheckpoints)
+		go clCheckpoints.Loop(backend.sentryCtx, clcheckpoint.PollInterval)
+	}
+	if config.CLLight && (clCheckpoints == nil || chainConfig.TerminalTotalDifficulty == nil) {
+		return nil, fmt.Errorf("embedded light consensus layer needs --cl.endpoints and proof-of-stake chain")
+	}
 	config.BodyDownloadTimeoutSeconds = 30
 
 	var txPoolRPC txpool_proto.TxpoolServer
@@ -323,16 +414,39 @@ func New(stack *node.Node, config *ethconfig.Config, logger log.Logger) (*Ethere
 		//cacheConfig := kvcache.DefaultCoherentCacheConfig
 		//cacheConfig.MetricsLabel = "txpool"
 
+		if backend.txPoolFetchScheduler, err = txpoolfetch.New(int(config.TxPool.FetchInflight)); err != nil {
+			return nil, err
+		}
+		txPoolSentries := backend.txPoolFetchScheduler.WrapSentries(backend.sentries)
+		if config.TxPool.Shadow {
+			var policy *txpoolshadow.Policy
+			if config.TxPool.ShadowPolicy != "" {
+				if policy, err = txpoolshadow.ParsePolicy(config.TxPool.ShadowPolicy); err != nil {
+					return nil, err
+				}
+			}
+			if backend.txPoolShadow, err = txpoolshadow.New(config.TxPool.ShadowFile, policy); err != nil {
+				return nil, err
+			}
+			txPoolSentries = backend.txPoolShadow.WrapSentries(txPoolSentries)
+		}
+
 		stateDiffClient := direct.NewStateDiffClientDirect(kvRPC)
 		backend.newTxs2 = make(chan txpool2.Hashes, 1024)
 		//defer close(newTxs)
 		backend.txPool2DB, backend.txPool2, backend.txPool2Fetch, backend.txPool2Send, backend.txPool2GrpcServer, err = txpooluitl.AllComponents(
-			ctx, cfg, kvcache.NewDummy(), backend.newTxs2, backend.chainDB, backend.sentries, stateDiffClient,
+			ctx, cfg, kvcache.NewDummy(), backend.newTxs2, backend.chainDB, txPoolSentries, stateDiffClient,
 		)
 		if err != nil {
 			return nil, err
 		}
 		txPoolRPC = backend.txPool2GrpcServer
+		if backend.txPoolShadow != nil {
+			txPoolRPC = backend.txPoolShadow.WrapGrpcServer(backend.txPool2GrpcServer)
+		}
+		if config.TxPool.Events {
+			backend.txPoolEvents = txpoolevents.NewBus()
+		}
 	}
 
 	backend.notifyMiningAboutNewTxs = make(chan struct{}, 1)
@@ -348,6 +462,7 @@ func New(stack *node.Node, config *ethconfig.Config, logger log.Logger) (*Ethere
 	backend.statusCh = make(chan privateapi.ExecutionStatus)
 
 	var blockReader interfaces.FullBlockReader
+	var allSnapshots *snapshotsync.AllSnapshots
 	if config.Snapshot.Enabled {
 		snConfig := snapshothashes.KnownConfig(chainConfig.ChainName)
 		//TODO: incremental snapshot sync
@@ -376,11 +491,25 @@ func New(stack *node.Node, config *ethconfig.Config, logger log.Logger) (*Ethere
 			return nil, err
 		}
 
-		allSnapshots := snapshotsync.NewAllSnapshots(config.Snapshot.Dir, snConfig)
+		allSnapshots = snapshotsync.NewAllSnapshots(config.Snapshot.Dir, snConfig)
 		if err != nil {
 			return nil, err
 		}
+		if config.Snapshot.Remote != "" {
+			remote, err := snapshotsync.NewRemoteStorage(config.Snapshot.Remote, config.Snapshot.Dir)
+			if err != nil {
+				return nil, err
+			}
+			remote.Lazy, remote.CacheSize = config.Snapshot.RemoteLazy, uint64(config.Snapshot.RemoteCacheSize)
+			allSnapshots.SetRemote(remote)
+		}
 		blockReader = snapshotsync.NewBlockReaderWithSnapshots(allSnapshots)
+		if config.Snapshot.MergeInterval > 0 {
+			chainID, _ := uint256.FromBig(chainConfig.ChainID)
+			merger := snapshotmerge.NewMerger(allSnapshots, *chainID, snapshotmerge.DefaultSteps)
+			merger.SetMaintenance(config.MaintenanceWindows)
+			go merger.Loop(backend.sentryCtx, config.Snapshot.MergeInterval)
+		}
 
 		// connect to Downloader
 		backend.downloaderClient, err = downloadergrpc.NewClient(ctx, stack.Config().DownloaderAddr)
@@ -390,24 +519,97 @@ func New(stack *node.Node, config *ethconfig.Config, logger log.Logger) (*Ethere
 	} else {
 		blockReader = snapshotsync.NewBlockReader()
 	}
+	var history state.HistorySnapshots // of this node, not a typed nil if there are no files
+	if config.Snapshot.HistoryDir != "" {
+		if backend.historySnapshots, err = historysnapshot.Open(config.Snapshot.HistoryDir); err != nil {
+			return nil, err
+		}
+		history = backend.historySnapshots
+		log.Info("[history snapshots] Opened", "to", backend.historySnapshots.To())
+	}
+	if coldDB != nil {
+		manager := tiering.NewManager(hotKv, coldDB, config.TieringHotBlocks)
+		manager.SetMaintenance(config.MaintenanceWindows)
+		go manager.Loop(backend.sentryCtx, tiering.Interval)
+	}
 
+	var txSelector builder.TxSelector
+	if config.Miner.BuilderAddr != "" {
+		policy, err := builder.ParsePolicy(config.Miner.TxSelection)
+		if err != nil {
+			return nil, err
+		}
+		bundlePool := builder.NewBundlePool(policy, builder.DefaultBundleTTL)
+		var validator builder.BundleValidator
+		if chainConfig.Sponsorship != nil {
+			validator = builder.NewSponsorshipValidator(chainKv, chainConfig)
+		}
+		backend.builderAPI, err = builder.StartGrpc(bundlePool, validator, config.Miner.BuilderAddr, config.Miner.BuilderAuthToken)
+		if err != nil {
+			return nil, err
+		}
+		txSelector = bundlePool
+	}
+
+	var miningTxSource stagedsync.MiningTxSource
+	if backend.txPool2 != nil {
+		miningTxSource = stagedsync.NewLocalTxSource(backend.txPool2, backend.txPool2DB)
+	}
 	mining := stagedsync.New(
 		stagedsync.MiningStages(backend.sentryCtx,
-			stagedsync.StageMiningCreateBlockCfg(backend.chainDB, miner, *backend.chainConfig, backend.engine, backend.txPool2, backend.txPool2DB, tmpdir),
-			stagedsync.StageMiningExecCfg(backend.chainDB, miner, backend.notifications.Events, *backend.chainConfig, backend.engine, &vm.Config{}, tmpdir),
+			stagedsync.StageMiningCreateBlockCfg(backend.chainDB, miner, backend.chainConfig, backend.engine, miningTxSource, txSelector, tmpdir),
+			stagedsync.StageMiningExecCfg(backend.chainDB, miner, backend.notifications.Events, backend.chainConfig, backend.engine, txSelector, &vm.Config{}, tmpdir),
 			stagedsync.StageHashStateCfg(backend.chainDB, tmpdir),
 			stagedsync.StageTrieCfg(backend.chainDB, false, true, tmpdir, blockReader),
-			stagedsync.StageMiningFinishCfg(backend.chainDB, *backend.chainConfig, backend.engine, miner, backend.miningSealingQuit),
+			stagedsync.StageMiningFinishCfg(backend.chainDB, backend.chainConfig, backend.engine, miner, backend.miningSealingQuit),
 		), stagedsync.MiningUnwindOrder, stagedsync.MiningPruneOrder)
+	mining.SetChain(chainConfig.ChainName)
 
 	var ethashApi *ethash.API
 	if casted, ok := backend.engine.(*ethash.Ethash); ok {
 		ethashApi = casted.APIs(nil)[1].Service.(*ethash.API)
 	}
 	atomic.StoreUint32(&backend.waitingForBeaconChain, 0)
-	ethBackendRPC := privateapi.NewEthBackendServer(ctx, backend, backend.chainDB, backend.notifications.Events,
+	ethBackendRPC := privateapi.NewEthBackendServer(ctx, backend, backend.chainDB, backend.notifications.Events, backend.notifications.ForkChoice,
 		blockReader, chainConfig, backend.reverseDownloadCh, backend.statusCh, &backend.waitingForBeaconChain)
+	if config.Miner.RelayAddr != "" {
+		executor := stagedsync.NewInMemoryExecutor(backend.chainDB, chainConfig, backend.engine, blockReader, tmpdir)
+		proxy, err := builder.NewRelayProxy(config.Miner.Relays, config.Miner.RelayTimeout, backend.chainDB, chainConfig, ethBackendRPC, executor)
+		if err != nil {
+			return nil, err
+		}
+		if backend.relayProxy, err = builder.StartRelayProxy(proxy, config.Miner.RelayAddr); err != nil {
+			return nil, err
+		}
+	} else if len(config.Miner.Relays) > 0 {
+		return nil, fmt.Errorf("--miner.relays requires --miner.relay.addr: consensus layer asks relays for bids through it")
+	}
 	miningRPC = privateapi.NewMiningServer(ctx, backend, ethashApi)
+	if config.CLLight {
+		follower, err := clfollower.New(config.CLEndpoints, clCheckpoints, ethBackendRPC)
+		if err != nil {
+			return nil, err
+		}
+		go follower.Loop(backend.sentryCtx, clfollower.SlotInterval)
+	}
+	reexecRPC := privateapi.NewReexecServer(reexec.NewProvider(backend.chainDB, chainConfig, backend.engine, blockReader, history))
+	exportRPC := privateapi.NewExportServer(export.NewExporter(backend.chainDB, blockReader))
+	// blocks in snapshots and state changes in history snapshots can't be unwound
+	backend.admin = stages2.NewAdmin(chainConfig, backend.engine, func() uint64 {
+		var frozen uint64
+		if allSnapshots != nil {
+			frozen = allSnapshots.BlocksAvailable()
+		}
+		if backend.historySnapshots != nil && backend.historySnapshots.To() > frozen+1 {
+			frozen = backend.historySnapshots.To() - 1
+		}
+		return frozen
+	})
+	adminRPC := privateapi.NewAdminServer(backend.admin, backend.sentryControlServer)
+	var txPoolEventsRPC privateapi.TxPoolEventsServer
+	if backend.txPoolEvents != nil {
+		txPoolEventsRPC = privateapi.NewTxPoolEventsServer(backend.txPoolEvents)
+	}
 	if stack.Config().PrivateApiAddr != "" {
 		var creds credentials.TransportCredentials
 		if stack.Config().TLSConnection {
@@ -421,6 +623,10 @@ func New(stack *node.Node, config *ethconfig.Config, logger log.Logger) (*Ethere
 			ethBackendRPC,
 			txPoolRPC,
 			miningRPC,
+			reexecRPC,
+			exportRPC,
+			txPoolEventsRPC,
+			adminRPC,
 			stack.Config().PrivateApiAddr,
 			stack.Config().PrivateApiRateLimit,
 			creds,
@@ -433,6 +639,13 @@ func New(stack *node.Node, config *ethconfig.Config, logger log.Logger) (*Ethere
 	if !config.TxPool.Disable {
 		backend.txPool2Fetch.ConnectCore()
 		backend.txPool2Fetch.ConnectSentries()
+		go backend.txPoolFetchScheduler.Loop(backend.sentryCtx)
+		if backend.txPoolShadow != nil {
+			go backend.txPoolShadow.Loop(backend.sentryCtx, backend.txPool2, backend.txPool2DB)
+		}
+		if backend.txPoolEvents != nil {
+			go backend.txPoolEvents.Loop(backend.sentryCtx, backend.txPool2GrpcServer, backend.chainDB)
+		}
 		go txpool2.MainLoop(backend.sentryCtx,
 			backend.txPool2DB, backend.chainDB,
 			backend.txPool2, backend.newTxs2, backend.txPool2Send, backend.txPool2GrpcServer.NewSlotsStreams,
@@ -471,11 +684,39 @@ func New(stack *node.Node, config *ethconfig.Config, logger log.Logger) (*Ethere
 		}
 	}()
 
+	go func() {
+		defer debug.LogPanic()
+		for {
+			select {
+			case stats := <-miner.PayloadStatsCh:
+				if err := backend.chainDB.Update(context.Background(), func(tx kv.RwTx) error {
+					return rawdb.WritePayloadStats(tx, stats)
+				}); err != nil {
+					log.Warn("write payload stats", "err", err)
+				}
+			case <-backend.quitMining:
+				return
+			}
+		}
+	}()
+
 	if err := backend.StartMining(context.Background(), backend.chainDB, mining, backend.config.Miner, backend.gasPrice, backend.quitMining); err != nil {
 		return nil, err
 	}
 
-	backend.stagedSync, err = stages2.NewStagedSync(backend.sentryCtx, backend.logger, backend.chainDB,
+	if config.StateBackend == nil && config.StateBackendAddr != "" {
+		log.Warn("Blocks are executed against remote state store", "addr", config.StateBackendAddr)
+		if config.StateBackend, err = remotestate.Dial(config.StateBackendAddr); err != nil {
+			return nil, fmt.Errorf("connect to state backend: %w", err)
+		}
+	}
+	if config.Firehose == nil && config.FirehoseSink != "" {
+		if config.Firehose, err = firehose.OpenSink(config.FirehoseSink); err != nil {
+			return nil, fmt.Errorf("open firehose sink: %w", err)
+		}
+		backend.firehose = config.Firehose
+	}
+	backend.stagedSync, err = stages2.NewStagedSync(backend.stagesCtx, backend.logger, backend.chainDB,
 		stack.Config().P2P, *config, chainConfig.TerminalTotalDifficulty,
 		backend.sentryControlServer, tmpdir, backend.notifications.Accumulator,
 		backend.reverseDownloadCh, backend.statusCh, &backend.waitingForBeaconChain,
@@ -648,8 +889,11 @@ func (s *Ethereum) StartMining(ctx context.Context, db kv.RwDB, mining *stagedsy
 
 func (s *Ethereum) IsMining() bool { return s.config.Miner.Enabled }
 
-func (s *Ethereum) ChainKV() kv.RwDB            { return s.chainDB }
-func (s *Ethereum) NetVersion() (uint64, error) { return s.networkID, nil }
+func (s *Ethereum) ChainKV() kv.RwDB { return s.chainDB }
+
+// TxPoolEvents - bus of transaction pool events, nil unless --txpool.events is set
+func (s *Ethereum) TxPoolEvents() *txpoolevents.Bus { return s.txPoolEvents }
+func (s *Ethereum) NetVersion() (uint64, error)     { return s.networkID, nil }
 func (s *Ethereum) NetPeerCount() (uint64, error) {
 	var sentryPc uint64 = 0
 
@@ -673,12 +917,14 @@ func (s *Ethereum) NodesInfo(limit int) (*remote.NodesInfoReply, error) {
 	}
 
 	nodes := make([]*prototypes.NodeInfoReply, 0, limit)
-	for i := 0; i < limit; i++ {
-		sc := s.sentries[i]
-
+	for _, sc := range s.sentries {
+		if len(nodes) == limit {
+			break
+		}
 		nodeInfo, err := sc.NodeInfo(context.Background(), nil)
 		if err != nil {
 			log.Error("sentry nodeInfo", "err", err)
+			continue
 		}
 
 		nodes = append(nodes, nodeInfo)
@@ -715,7 +961,7 @@ func (s *Ethereum) Start() error {
 		}(i)
 	}
 
-	go stages2.StageLoop(s.sentryCtx, s.chainDB, s.stagedSync, s.sentryControlServer.Hd, s.notifications, s.sentryControlServer.UpdateHead, s.waitForStageLoopStop, s.config.SyncLoopThrottle)
+	go stages2.StageLoop(s.stagesCtx, s.chainDB, s.stagedSync, s.sentryControlServer.Hd, s.notifications, s.sentryControlServer.UpdateHead, s.waitForStageLoopStop, s.config.SyncLoopThrottle, s.admin)
 
 	return nil
 }
@@ -723,7 +969,11 @@ func (s *Ethereum) Start() error {
 // Stop implements node.Service, terminating all internal goroutines used by the
 // Ethereum protocol.
 func (s *Ethereum) Stop() error {
+	// Staged sync stops first, while peers and APIs it may wait for are still running
+	s.stopStageLoop()
+
 	// Stop all the peer-related stuff first.
+	log.Info("Shutdown: stopping p2p, mining and APIs")
 	s.sentryCancel()
 	if s.privateAPI != nil {
 		shutdownDone := make(chan bool)
@@ -737,6 +987,12 @@ func (s *Ethereum) Stop() error {
 		case <-shutdownDone:
 		}
 	}
+	if s.builderAPI != nil {
+		s.builderAPI.Stop()
+	}
+	if s.relayProxy != nil {
+		_ = s.relayProxy.Close()
+	}
 	if s.quitMining != nil {
 		close(s.quitMining)
 	}
@@ -744,15 +1000,74 @@ func (s *Ethereum) Stop() error {
 	//s.miner.Stop()
 	s.engine.Close()
 	<-s.waitForStageLoopStop
+	if s.firehose != nil {
+		if err := s.firehose.Close(); err != nil {
+			log.Warn("Failed to close firehose sink", "err", err)
+		}
+	}
 	if s.config.Miner.Enabled {
 		<-s.waitForMiningStop
 	}
 	for _, sentryServer := range s.sentryServers {
 		sentryServer.Close()
 	}
+	s.stagesCancel()
+	log.Info("Shutdown: closing databases")
 	s.chainDB.Close()
+	if s.historySnapshots != nil {
+		s.historySnapshots.Close()
+	}
 	if s.txPool2DB != nil {
 		s.txPool2DB.Close()
 	}
 	return nil
 }
+
+// stopStageLoop - asks staged sync to stop at safe checkpoint and waits for it, reporting progress. Stages are
+// cancelled if they don't stop in config.ShutdownTimeout: work of the running stage since its last commit is lost
+func (s *Ethereum) stopStageLoop() {
+	s.stagedSync.Stop()
+	log.Info("Shutdown: stopping staged sync at safe checkpoint", "stage", s.stagedSync.RunningStage(), "timeout", s.config.ShutdownTimeout)
+	start := time.Now()
+	logEvery := time.NewTicker(10 * time.Second)
+	defer logEvery.Stop()
+	var deadline <-chan time.Time
+	if s.config.ShutdownTimeout > 0 {
+		timer := time.NewTimer(s.config.ShutdownTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for {
+		select {
+		case <-s.waitForStageLoopStop:
+			log.Info("Shutdown: staged sync stopped", "in", time.Since(start).Truncate(time.Millisecond))
+			return
+		case <-logEvery.C:
+			log.Info("Shutdown: waiting for staged sync", "stage", s.stagedSync.RunningStage(), "elapsed", time.Since(start).Truncate(time.Second))
+		case <-deadline:
+			log.Warn("Shutdown: staged sync didn't stop in time, aborting", "stage", s.stagedSync.RunningStage(), "timeout", s.config.ShutdownTimeout)
+			s.stagesCancel()
+			deadline = nil
+		}
+	}
+}
+
+// logVersionInfo - startup banner in machine-readable form, same as erigon_versionInfo returns
+func logVersionInfo(chainConfig *params.ChainConfig, genesisHash common.Hash, pm prune.Mode) error {
+	configHash, err := params.ChainConfigHash(chainConfig)
+	if err != nil {
+		return err
+	}
+	info, err := json.Marshal(params.VersionInfo{
+		BuildInfo:       params.GetBuildInfo(),
+		Chain:           chainConfig.ChainName,
+		GenesisHash:     genesisHash,
+		ChainConfigHash: configHash,
+		Experiments:     pm.Experiments.Names(),
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("Version info", "json", string(info))
+	return nil
+}
@@ -0,0 +1,159 @@
+// Package builder allows external block builders to take part in local block building:
+// they inject ordered transaction bundles, which are included into block before txpool's transactions,
+// and choose policy of bundles selection.
+package builder
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/core/types"
+)
+
+// Policy - order in which bundles are included into block
+type Policy uint8
+
+const (
+	// MaxProfit - bundles which pay most tips go first
+	MaxProfit Policy = iota
+	// FIFO - bundles go in order of arrival
+	FIFO
+)
+
+func (p Policy) String() string {
+	switch p {
+	case MaxProfit:
+		return "maxprofit"
+	case FIFO:
+		return "fifo"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(p))
+	}
+}
+
+func ParsePolicy(s string) (Policy, error) {
+	switch s {
+	case "maxprofit", "":
+		return MaxProfit, nil
+	case "fifo":
+		return FIFO, nil
+	default:
+		return 0, fmt.Errorf("unknown tx selection policy: %s, supported: maxprofit, fifo", s)
+	}
+}
+
+// DefaultBundleTTL - how long bundle takes part in block building
+const DefaultBundleTTL = time.Minute
+
+// Bundle - ordered transactions, which builder wants to see in block one after another. Bundle is executed
+// atomically: it's dropped from block entirely if any of its transactions fails or reverts.
+type Bundle struct {
+	Txs      types.Transactions
+	Received time.Time
+}
+
+// Profit - tips which block producer receives from executed bundle: gas used by transactions (from their receipts)
+// multiplied by effective tips
+func (b *Bundle) Profit(baseFee *uint256.Int, receipts types.Receipts) *uint256.Int {
+	profit, gas := uint256.NewInt(0), uint256.NewInt(0)
+	for i, receipt := range receipts {
+		gas.SetUint64(receipt.GasUsed)
+		profit.Add(profit, gas.Mul(gas, b.Txs[i].GetEffectiveGasTip(baseFee)))
+	}
+	return profit
+}
+
+// SortByProfit - orders bundles by MaxProfit policy, profits of executed bundles are calculated by Bundle.Profit
+func SortByProfit(bundles []*Bundle, profits map[*Bundle]*uint256.Int) {
+	sort.SliceStable(bundles, func(i, j int) bool {
+		return profits[bundles[i]].Gt(profits[bundles[j]])
+	})
+}
+
+// TxSelector - extension point of block building: returns bundles which must be included in block
+// with given header before txpool's transactions. Block builder orders them by Policy.
+type TxSelector interface {
+	Select(header *types.Header) []*Bundle
+	Policy() Policy
+	// Evict - removes bundles which can't be included anymore: their transactions are already in chain
+	Evict(bundles []*Bundle)
+}
+
+// BundlePool - thread-safe storage of bundles received from external builders. Implements TxSelector.
+type BundlePool struct {
+	lock    sync.Mutex
+	bundles []*Bundle
+	policy  Policy
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+func NewBundlePool(policy Policy, ttl time.Duration) *BundlePool {
+	return &BundlePool{policy: policy, ttl: ttl, now: time.Now}
+}
+
+func (p *BundlePool) AddBundle(txs types.Transactions) {
+	if len(txs) == 0 {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.bundles = append(p.bundles, &Bundle{Txs: txs, Received: p.now()})
+}
+
+func (p *BundlePool) SetPolicy(policy Policy) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.policy = policy
+}
+
+func (p *BundlePool) Policy() Policy {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.policy
+}
+
+// Select - drops expired bundles and returns others in order of arrival
+func (p *BundlePool) Select(_ *types.Header) []*Bundle {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := p.now()
+	p.filter(func(b *Bundle) bool { return now.Sub(b.Received) < p.ttl })
+	selected := make([]*Bundle, len(p.bundles))
+	copy(selected, p.bundles)
+	return selected
+}
+
+func (p *BundlePool) Evict(bundles []*Bundle) {
+	if len(bundles) == 0 {
+		return
+	}
+	evicted := make(map[*Bundle]struct{}, len(bundles))
+	for _, b := range bundles {
+		evicted[b] = struct{}{}
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.filter(func(b *Bundle) bool {
+		_, ok := evicted[b]
+		return !ok
+	})
+}
+
+// filter - keeps bundles for which keep returns true, must be called under lock
+func (p *BundlePool) filter(keep func(b *Bundle) bool) {
+	kept := p.bundles[:0]
+	for _, b := range p.bundles {
+		if keep(b) {
+			kept = append(kept, b)
+		}
+	}
+	for i := len(kept); i < len(p.bundles); i++ {
+		p.bundles[i] = nil
+	}
+	p.bundles = kept
+}
@@ -0,0 +1,110 @@
+package builder
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	txpool_proto "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func bundle(nonce uint64, gasPrice uint64) types.Transactions {
+	return types.Transactions{
+		types.NewTransaction(nonce, common.Address{}, uint256.NewInt(0), 21000, uint256.NewInt(gasPrice), nil),
+		types.NewTransaction(nonce+1, common.Address{}, uint256.NewInt(0), 21000, uint256.NewInt(gasPrice), nil),
+	}
+}
+
+func nonces(bundles []*Bundle) []uint64 {
+	var res []uint64
+	for _, b := range bundles {
+		for _, txn := range b.Txs {
+			res = append(res, txn.GetNonce())
+		}
+	}
+	return res
+}
+
+func TestSelectPolicy(t *testing.T) {
+	header := &types.Header{BaseFee: uint256.NewInt(10).ToBig()}
+	pool := NewBundlePool(FIFO, DefaultBundleTTL)
+	pool.AddBundle(bundle(0, 11))
+	pool.AddBundle(bundle(10, 30))
+	pool.AddBundle(bundle(20, 20))
+	pool.AddBundle(nil)
+
+	bundles := pool.Select(header)
+	require.Equal(t, []uint64{0, 1, 10, 11, 20, 21}, nonces(bundles))
+
+	pool.SetPolicy(MaxProfit)
+	require.Equal(t, MaxProfit, pool.Policy())
+	// profit is calculated by gas used of receipts, not by gas limits of transactions
+	baseFee := uint256.NewInt(10)
+	profits := map[*Bundle]*uint256.Int{
+		bundles[0]: bundles[0].Profit(baseFee, types.Receipts{{GasUsed: 21000}, {GasUsed: 21000}}),
+		bundles[1]: bundles[1].Profit(baseFee, types.Receipts{{GasUsed: 1000}, {GasUsed: 1000}}),
+		bundles[2]: bundles[2].Profit(baseFee, types.Receipts{{GasUsed: 21000}, {GasUsed: 21000}}),
+	}
+	require.Equal(t, uint256.NewInt(2*21000*10), profits[bundles[2]])
+	SortByProfit(bundles, profits)
+	require.Equal(t, []uint64{20, 21, 0, 1, 10, 11}, nonces(bundles))
+
+	pool.Evict(bundles[:1])
+	require.Equal(t, []uint64{0, 1, 10, 11}, nonces(pool.Select(header)))
+}
+
+func TestSelectDropsExpired(t *testing.T) {
+	now := time.Unix(1000, 0)
+	pool := NewBundlePool(MaxProfit, time.Minute)
+	pool.now = func() time.Time { return now }
+
+	pool.AddBundle(bundle(0, 1))
+	now = now.Add(30 * time.Second)
+	pool.AddBundle(bundle(10, 1))
+	require.Equal(t, []uint64{0, 1, 10, 11}, nonces(pool.Select(&types.Header{})))
+
+	now = now.Add(45 * time.Second)
+	require.Equal(t, []uint64{10, 11}, nonces(pool.Select(&types.Header{})))
+
+	now = now.Add(time.Minute)
+	require.Empty(t, pool.Select(&types.Header{}))
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, p := range []Policy{MaxProfit, FIFO} {
+		parsed, err := ParsePolicy(p.String())
+		require.NoError(t, err)
+		require.Equal(t, p, parsed)
+	}
+	_, err := ParsePolicy("random")
+	require.Error(t, err)
+}
+
+func TestGrpcAuth(t *testing.T) {
+	pool := NewBundlePool(FIFO, DefaultBundleTTL)
+	srv := NewGrpcServer(pool, nil, "secret")
+	rlpTx, err := rlp.EncodeToBytes(bundle(0, 1)[0])
+	require.NoError(t, err)
+	req := &txpool_proto.AddRequest{RlpTxs: [][]byte{rlpTx}}
+
+	_, err = srv.AddBundle(context.Background(), req)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = srv.AddBundle(metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer wrong")), req)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	require.Empty(t, pool.Select(&types.Header{}))
+
+	_, err = srv.AddBundle(metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer secret")), req)
+	require.NoError(t, err)
+	require.Len(t, pool.Select(&types.Header{}), 1)
+
+	_, err = StartGrpc(pool, nil, "127.0.0.1:0", "")
+	require.Error(t, err)
+}
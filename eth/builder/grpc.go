@@ -0,0 +1,162 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	txpool_proto "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/turbo/authtoken"
+	"github.com/ledgerwatch/log/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// BundlesServer - local gRPC endpoint for external builders. Service "builder.Bundles" re-uses messages of txpool.proto.
+// AddBundle - all transactions of request is 1 ordered bundle. SetPolicy - accepts "maxprofit" or "fifo".
+// Requests need metadata "authorization: Bearer <token>" with token of --miner.builder.authtoken.
+type BundlesServer interface {
+	AddBundle(context.Context, *txpool_proto.AddRequest) (*txpool_proto.AddReply, error)
+	SetPolicy(context.Context, *wrapperspb.StringValue) (*emptypb.Empty, error)
+}
+
+type GrpcServer struct {
+	pool      *BundlePool
+	validator BundleValidator // optional
+	authToken string
+}
+
+func NewGrpcServer(pool *BundlePool, validator BundleValidator, authToken string) *GrpcServer {
+	return &GrpcServer{pool: pool, validator: validator, authToken: authToken}
+}
+
+// authorize - request has metadata "authorization: Bearer <token>", empty token never matches
+func (s *GrpcServer) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get(authtoken.Header) {
+		if authtoken.Matches(v, s.authToken) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid or missing bearer token")
+}
+
+func (s *GrpcServer) AddBundle(ctx context.Context, in *txpool_proto.AddRequest) (*txpool_proto.AddReply, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	reply := &txpool_proto.AddReply{
+		Imported: make([]txpool_proto.ImportResult, len(in.RlpTxs)),
+		Errors:   make([]string, len(in.RlpTxs)),
+	}
+	txs, err := types.DecodeTransactions(in.RlpTxs)
+	if err == nil && s.validator != nil {
+		err = s.validator.ValidateBundle(ctx, txs)
+	}
+	if err != nil {
+		for i := range reply.Imported {
+			reply.Imported[i] = txpool_proto.ImportResult_INVALID
+			reply.Errors[i] = err.Error()
+		}
+		return reply, nil
+	}
+	s.pool.AddBundle(txs)
+	for i := range reply.Imported {
+		reply.Imported[i] = txpool_proto.ImportResult_SUCCESS
+		reply.Errors[i] = txpool_proto.ImportResult_SUCCESS.String()
+	}
+	return reply, nil
+}
+
+func (s *GrpcServer) SetPolicy(ctx context.Context, in *wrapperspb.StringValue) (*emptypb.Empty, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	policy, err := ParsePolicy(in.GetValue())
+	if err != nil {
+		return nil, err
+	}
+	s.pool.SetPolicy(policy)
+	log.Info("Tx selection policy changed", "policy", policy)
+	return &emptypb.Empty{}, nil
+}
+
+func _Bundles_AddBundle_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(txpool_proto.AddRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BundlesServer).AddBundle(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/builder.Bundles/AddBundle",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BundlesServer).AddBundle(ctx, req.(*txpool_proto.AddRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bundles_SetPolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BundlesServer).SetPolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/builder.Bundles/SetPolicy",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BundlesServer).SetPolicy(ctx, req.(*wrapperspb.StringValue))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Bundles_ServiceDesc - descriptor of "builder.Bundles" service, written in same way as protoc-gen-go-grpc does
+var Bundles_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "builder.Bundles",
+	HandlerType: (*BundlesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddBundle",
+			Handler:    _Bundles_AddBundle_Handler,
+		},
+		{
+			MethodName: "SetPolicy",
+			Handler:    _Bundles_SetPolicy_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+const grpcRateLimit = 16
+
+func StartGrpc(pool *BundlePool, validator BundleValidator, addr, authToken string) (*grpc.Server, error) {
+	if authToken == "" {
+		return nil, fmt.Errorf("builder gRPC server requires auth token (--miner.builder.authtoken)")
+	}
+	log.Info("Starting builder gRPC server", "on", addr)
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not create listener: %w, addr=%s", err, addr)
+	}
+	grpcServer := grpcutil.NewServer(grpcRateLimit, nil)
+	grpcServer.RegisterService(&Bundles_ServiceDesc, NewGrpcServer(pool, validator, authToken))
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Error("builder gRPC server fail", "err", err)
+		}
+	}()
+	return grpcServer, nil
+}
@@ -0,0 +1,263 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/common/math"
+	"github.com/ledgerwatch/erigon/consensus/serenity"
+	"github.com/ledgerwatch/erigon/core/types"
+)
+
+// Paths of builder API (https://github.com/ethereum/builder-specs), served by relays and by RelayProxy
+const (
+	statusPath       = "/eth/v1/builder/status"
+	validatorsPath   = "/eth/v1/builder/validators"
+	headerPath       = "/eth/v1/builder/header/"
+	blindedBlockPath = "/eth/v1/builder/blinded_blocks"
+)
+
+// ExecutionPayloadHeader - header of payload offered by relay, numbers are decimal strings as in builder API
+type ExecutionPayloadHeader struct {
+	ParentHash       common.Hash      `json:"parent_hash"`
+	FeeRecipient     common.Address   `json:"fee_recipient"`
+	StateRoot        common.Hash      `json:"state_root"`
+	ReceiptsRoot     common.Hash      `json:"receipts_root"`
+	LogsBloom        hexutil.Bytes    `json:"logs_bloom"`
+	PrevRandao       common.Hash      `json:"prev_randao"`
+	BlockNumber      math.Decimal64   `json:"block_number"`
+	GasLimit         math.Decimal64   `json:"gas_limit"`
+	GasUsed          math.Decimal64   `json:"gas_used"`
+	Timestamp        math.Decimal64   `json:"timestamp"`
+	ExtraData        hexutil.Bytes    `json:"extra_data"`
+	BaseFeePerGas    *math.Decimal256 `json:"base_fee_per_gas"`
+	BlockHash        common.Hash      `json:"block_hash"`
+	TransactionsRoot common.Hash      `json:"transactions_root"`
+}
+
+// ExecutionPayload - payload revealed by relay for signed blinded block
+type ExecutionPayload struct {
+	ParentHash    common.Hash      `json:"parent_hash"`
+	FeeRecipient  common.Address   `json:"fee_recipient"`
+	StateRoot     common.Hash      `json:"state_root"`
+	ReceiptsRoot  common.Hash      `json:"receipts_root"`
+	LogsBloom     hexutil.Bytes    `json:"logs_bloom"`
+	PrevRandao    common.Hash      `json:"prev_randao"`
+	BlockNumber   math.Decimal64   `json:"block_number"`
+	GasLimit      math.Decimal64   `json:"gas_limit"`
+	GasUsed       math.Decimal64   `json:"gas_used"`
+	Timestamp     math.Decimal64   `json:"timestamp"`
+	ExtraData     hexutil.Bytes    `json:"extra_data"`
+	BaseFeePerGas *math.Decimal256 `json:"base_fee_per_gas"`
+	BlockHash     common.Hash      `json:"block_hash"`
+	Transactions  []hexutil.Bytes  `json:"transactions"`
+}
+
+// BuilderBid - header of payload and value which fee recipient receives from it, signed by builder with BLS key Pubkey
+type BuilderBid struct {
+	Header *ExecutionPayloadHeader `json:"header"`
+	Value  *math.Decimal256        `json:"value"`
+	Pubkey hexutil.Bytes           `json:"pubkey"`
+}
+
+type SignedBuilderBid struct {
+	Message   *BuilderBid   `json:"message"`
+	Signature hexutil.Bytes `json:"signature"`
+}
+
+// versioned - envelope of getHeader and getPayload responses
+type versioned struct {
+	Version string          `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// blindedBlockHash - the only part of signed blinded beacon block which is needed to find the bid it's signed for
+type blindedBlockHash struct {
+	Message struct {
+		Body struct {
+			ExecutionPayloadHeader struct {
+				BlockHash common.Hash `json:"block_hash"`
+			} `json:"execution_payload_header"`
+		} `json:"body"`
+	} `json:"message"`
+}
+
+// Header - block header of bid. Fields which are constant after the Merge are filled as consensus requires.
+func (h *ExecutionPayloadHeader) Header() (*types.Header, error) {
+	if len(h.LogsBloom) != types.BloomByteLength {
+		return nil, fmt.Errorf("invalid logs_bloom length: %d", len(h.LogsBloom))
+	}
+	if h.BaseFeePerGas == nil {
+		return nil, fmt.Errorf("missing base_fee_per_gas")
+	}
+	return &types.Header{
+		ParentHash:  h.ParentHash,
+		UncleHash:   types.EmptyUncleHash,
+		Coinbase:    h.FeeRecipient,
+		Root:        h.StateRoot,
+		TxHash:      h.TransactionsRoot,
+		ReceiptHash: h.ReceiptsRoot,
+		Bloom:       types.BytesToBloom(h.LogsBloom),
+		Difficulty:  serenity.SerenityDifficulty,
+		Number:      new(big.Int).SetUint64(uint64(h.BlockNumber)),
+		GasLimit:    uint64(h.GasLimit),
+		GasUsed:     uint64(h.GasUsed),
+		Time:        uint64(h.Timestamp),
+		Extra:       h.ExtraData,
+		MixDigest:   h.PrevRandao,
+		Nonce:       serenity.SerenityNonce,
+		BaseFee:     (*big.Int)(h.BaseFeePerGas),
+		Eip1559:     true,
+	}, nil
+}
+
+// Block - block of revealed payload, its transactions root is calculated from transactions
+func (p *ExecutionPayload) Block() (*types.Block, error) {
+	rawTxs := make([][]byte, len(p.Transactions))
+	for i, rawTx := range p.Transactions {
+		rawTxs[i] = rawTx
+	}
+	txs, err := types.DecodeTransactions(rawTxs)
+	if err != nil {
+		return nil, err
+	}
+	header, err := (&ExecutionPayloadHeader{
+		ParentHash:       p.ParentHash,
+		FeeRecipient:     p.FeeRecipient,
+		StateRoot:        p.StateRoot,
+		ReceiptsRoot:     p.ReceiptsRoot,
+		LogsBloom:        p.LogsBloom,
+		PrevRandao:       p.PrevRandao,
+		BlockNumber:      p.BlockNumber,
+		GasLimit:         p.GasLimit,
+		GasUsed:          p.GasUsed,
+		Timestamp:        p.Timestamp,
+		ExtraData:        p.ExtraData,
+		BaseFeePerGas:    p.BaseFeePerGas,
+		BlockHash:        p.BlockHash,
+		TransactionsRoot: types.DeriveSha(types.RawTransactions(rawTxs)),
+	}).Header()
+	if err != nil {
+		return nil, err
+	}
+	return types.NewBlockFromStorage(header.Hash(), header, txs, nil), nil
+}
+
+// RelayClient - client of builder API of one relay
+type RelayClient struct {
+	url    string
+	client *http.Client
+}
+
+func NewRelayClient(relayURL string) (*RelayClient, error) {
+	u, err := url.Parse(relayURL)
+	if err != nil {
+		return nil, fmt.Errorf("relay %s: %w", relayURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("relay %s: unsupported scheme %q", relayURL, u.Scheme)
+	}
+	return &RelayClient{url: strings.TrimSuffix(relayURL, "/"), client: &http.Client{}}, nil
+}
+
+func (c *RelayClient) URL() string { return c.url }
+
+// Status - nil if relay is available
+func (c *RelayClient) Status(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodGet, statusPath, nil)
+	return err
+}
+
+// RegisterValidators - forwards registrations of validators (opaque JSON array, relay checks signatures)
+func (c *RelayClient) RegisterValidators(ctx context.Context, registrations []byte) error {
+	_, err := c.do(ctx, http.MethodPost, validatorsPath, registrations)
+	return err
+}
+
+// GetHeader - best bid of relay for given slot, nil if relay has no bid
+func (c *RelayClient) GetHeader(ctx context.Context, slot uint64, parentHash common.Hash, pubkey hexutil.Bytes) (*SignedBuilderBid, error) {
+	body, err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s%d/%s/%s", headerPath, slot, parentHash.Hex(), pubkey.String()), nil)
+	if err != nil || body == nil {
+		return nil, err
+	}
+	var bid SignedBuilderBid
+	if err = decodeVersioned(body, &bid); err != nil {
+		return nil, err
+	}
+	if bid.Message == nil || bid.Message.Header == nil || bid.Message.Value == nil {
+		return nil, fmt.Errorf("incomplete bid")
+	}
+	return &bid, nil
+}
+
+// GetPayload - reveals payload of signed blinded block
+func (c *RelayClient) GetPayload(ctx context.Context, signedBlindedBlock []byte) (*ExecutionPayload, error) {
+	body, err := c.do(ctx, http.MethodPost, blindedBlockPath, signedBlindedBlock)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, fmt.Errorf("no payload")
+	}
+	var payload ExecutionPayload
+	if err = decodeVersioned(body, &payload); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+// do - sends request, returns body of 200 response or nil body of 204 response
+func (c *RelayClient) do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return respBody, nil
+	case http.StatusNoContent:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+}
+
+// maxResponseSize - payloads are limited by block gas limit: 30M gas of zero calldata is 7.5MB, 15MB in hex
+const maxResponseSize = 32 << 20
+
+func decodeVersioned(body []byte, data interface{}) error {
+	var v versioned
+	if err := json.Unmarshal(body, &v); err != nil {
+		return err
+	}
+	if len(v.Data) == 0 {
+		return fmt.Errorf("empty response data, version %q", v.Version)
+	}
+	return json.Unmarshal(v.Data, data)
+}
@@ -0,0 +1,411 @@
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	types2 "github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/consensus/misc"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// LocalPayloads - payloads which this node builds for consensus layer (see engine_forkchoiceUpdated)
+type LocalPayloads interface {
+	// LatestPayload - the latest payload built on top of given parent
+	LatestPayload(parentHash common.Hash) (*types2.ExecutionPayload, bool)
+}
+
+// PayloadExecutor - executes payloads on top of the head of local chain without writing to db,
+// see stagedsync.InMemoryExecutor. Values are balance increases of fee recipient.
+type PayloadExecutor interface {
+	ExecuteBlock(ctx context.Context, block *types.Block) (*big.Int, error)
+	TransactionsValue(ctx context.Context, header *types.Header, txs types.Transactions) (*big.Int, error)
+}
+
+// bidsKeptSlots - accepted bids of older slots are forgotten
+const bidsKeptSlots = 2
+
+type acceptedBid struct {
+	relay  *RelayClient
+	slot   uint64
+	header *types.Header
+	value  *big.Int
+}
+
+// RelayProxy - serves builder API to consensus layer, as mev-boost does, for relays given by --miner.relays.
+// Unlike mev-boost it doesn't trust relays:
+//   - getHeader: header of bid is checked against parent header and against payload which this node builds on top of
+//     the same parent (timestamp, prev_randao, fee recipient). Bid is returned only if it's worth more than the local
+//     payload, whose value is found by execution of its transactions. Otherwise 204 makes consensus layer propose
+//     the local payload.
+//   - blinded_blocks: revealed payload must hash to the header of accepted bid and is executed on top of its parent:
+//     receipts root, bloom, gas used, state root and value received by fee recipient are checked before payload is
+//     returned. Consensus layer gets error instead of invalid payload.
+//
+// BLS signatures of bids aren't verified - payloads are validated by execution instead.
+type RelayProxy struct {
+	relays      []*RelayClient
+	timeout     time.Duration
+	db          kv.RoDB
+	chainConfig *params.ChainConfig
+	local       LocalPayloads
+	executor    PayloadExecutor
+
+	lock sync.Mutex
+	bids map[common.Hash]*acceptedBid // by block hash
+}
+
+func NewRelayProxy(urls []string, timeout time.Duration, db kv.RoDB, chainConfig *params.ChainConfig, local LocalPayloads, executor PayloadExecutor) (*RelayProxy, error) {
+	p := &RelayProxy{timeout: timeout, db: db, chainConfig: chainConfig, local: local, executor: executor,
+		bids: map[common.Hash]*acceptedBid{}}
+	for _, u := range urls {
+		relay, err := NewRelayClient(u)
+		if err != nil {
+			return nil, err
+		}
+		p.relays = append(p.relays, relay)
+	}
+	return p, nil
+}
+
+// StartRelayProxy - serves builder API on addr until returned server is closed
+func StartRelayProxy(proxy *RelayProxy, addr string) (*http.Server, error) {
+	log.Info("Starting builder API for consensus layer", "on", addr, "relays", len(proxy.relays))
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not create listener: %w, addr=%s", err, addr)
+	}
+	srv := &http.Server{Handler: proxy, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(lis); err != nil && err != http.ErrServerClosed {
+			log.Error("builder API server fail", "err", err)
+		}
+	}()
+	return srv, nil
+}
+
+func (p *RelayProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == statusPath && r.Method == http.MethodGet:
+		p.handleStatus(w, r)
+	case r.URL.Path == validatorsPath && r.Method == http.MethodPost:
+		p.handleValidators(w, r)
+	case strings.HasPrefix(r.URL.Path, headerPath) && r.Method == http.MethodGet:
+		p.handleHeader(w, r)
+	case r.URL.Path == blindedBlockPath && r.Method == http.MethodPost:
+		p.handleBlindedBlock(w, r)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown endpoint %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// forEachRelay - calls f for all relays in parallel, returns amount of successful calls
+func (p *RelayProxy) forEachRelay(ctx context.Context, f func(ctx context.Context, relay *RelayClient) error) int {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	relays := p.relays
+	errs := make([]error, len(relays))
+	var wg sync.WaitGroup
+	for i := range relays {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = f(ctx, relays[i])
+		}(i)
+	}
+	wg.Wait()
+	succeeded := 0
+	for i, err := range errs {
+		if err != nil {
+			log.Warn("[relay] Request failed", "relay", relays[i].URL(), "err", err)
+			continue
+		}
+		succeeded++
+	}
+	return succeeded
+}
+
+func (p *RelayProxy) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if p.forEachRelay(r.Context(), func(ctx context.Context, relay *RelayClient) error { return relay.Status(ctx) }) == 0 {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("no relay is available"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (p *RelayProxy) handleValidators(w http.ResponseWriter, r *http.Request) {
+	registrations, err := ioutil.ReadAll(io.LimitReader(r.Body, maxResponseSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if p.forEachRelay(r.Context(), func(ctx context.Context, relay *RelayClient) error {
+		return relay.RegisterValidators(ctx, registrations)
+	}) == 0 {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("no relay accepted registrations"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleHeader - GET /eth/v1/builder/header/{slot}/{parent_hash}/{pubkey}
+func (p *RelayProxy) handleHeader(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, headerPath), "/")
+	if len(parts) != 3 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("expected /{slot}/{parent_hash}/{pubkey}"))
+		return
+	}
+	slot, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("slot: %w", err))
+		return
+	}
+	var parentHash common.Hash
+	if err = parentHash.UnmarshalText([]byte(parts[1])); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("parent_hash: %w", err))
+		return
+	}
+	pubkey, err := hexutil.Decode(parts[2])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("pubkey: %w", err))
+		return
+	}
+
+	bid, err := p.bestBid(r.Context(), slot, parentHash, pubkey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if bid == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeVersioned(w, bid)
+}
+
+// bestBid - the most valuable valid bid if it's worth more than the local payload, nil otherwise
+func (p *RelayProxy) bestBid(ctx context.Context, slot uint64, parentHash common.Hash, pubkey hexutil.Bytes) (*SignedBuilderBid, error) {
+	local, ok := p.local.LatestPayload(parentHash)
+	if !ok {
+		log.Warn("[relay] Bids are ignored: no local payload to compare with", "slot", slot, "parent", parentHash)
+		return nil, nil
+	}
+	parent, err := p.header(ctx, parentHash)
+	if err != nil {
+		return nil, err
+	}
+	localValue, err := p.localValue(ctx, local, parent)
+	if err != nil {
+		return nil, fmt.Errorf("value of local payload: %w", err)
+	}
+
+	var lock sync.Mutex
+	var best *SignedBuilderBid
+	var bestRelay *RelayClient
+	var bestHeader *types.Header
+	bestValue := localValue
+	p.forEachRelay(ctx, func(ctx context.Context, relay *RelayClient) error {
+		bid, err := relay.GetHeader(ctx, slot, parentHash, pubkey)
+		if err != nil || bid == nil {
+			return err
+		}
+		header, err := p.checkBid(bid.Message, parent, local)
+		if err != nil {
+			return fmt.Errorf("invalid bid %x: %w", bid.Message.Header.BlockHash, err)
+		}
+		value := (*big.Int)(bid.Message.Value)
+		lock.Lock()
+		defer lock.Unlock()
+		if value.Cmp(bestValue) > 0 {
+			best, bestRelay, bestHeader, bestValue = bid, relay, header, value
+		}
+		return nil
+	})
+	if best == nil {
+		log.Info("[relay] Local payload chosen", "slot", slot, "value", localValue)
+		return nil, nil
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for hash, bid := range p.bids {
+		if bid.slot+bidsKeptSlots < slot {
+			delete(p.bids, hash)
+		}
+	}
+	p.bids[bestHeader.Hash()] = &acceptedBid{relay: bestRelay, slot: slot, header: bestHeader, value: bestValue}
+	log.Info("[relay] Bid chosen", "slot", slot, "relay", bestRelay.URL(), "value", bestValue, "localValue", localValue,
+		"block", bestHeader.Number, "hash", bestHeader.Hash(), "builder", best.Message.Pubkey)
+	return best, nil
+}
+
+func (p *RelayProxy) header(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	tx, err := p.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	header, err := rawdb.ReadHeaderByHash(tx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("header %x not found", hash)
+	}
+	return header, nil
+}
+
+// localValue - what fee recipient receives from transactions of local payload
+func (p *RelayProxy) localValue(ctx context.Context, local *types2.ExecutionPayload, parent *types.Header) (*big.Int, error) {
+	txs, err := types.DecodeTransactions(local.Transactions)
+	if err != nil {
+		return nil, err
+	}
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Coinbase:   gointerfaces.ConvertH160toAddress(local.Coinbase),
+		Difficulty: new(big.Int),
+		Number:     new(big.Int).SetUint64(parent.Number.Uint64() + 1),
+		GasLimit:   local.GasLimit,
+		Time:       local.Timestamp,
+		Extra:      local.ExtraData,
+		MixDigest:  gointerfaces.ConvertH256ToHash(local.Random),
+	}
+	if p.chainConfig.IsLondon(header.Number.Uint64()) {
+		header.BaseFee = misc.CalcBaseFee(p.chainConfig, parent)
+		header.Eip1559 = true
+	}
+	return p.executor.TransactionsValue(ctx, header, txs)
+}
+
+// checkBid - checks header of bid against its parent and local payload for the same slot
+func (p *RelayProxy) checkBid(bid *BuilderBid, parent *types.Header, local *types2.ExecutionPayload) (*types.Header, error) {
+	header, err := bid.Header.Header()
+	if err != nil {
+		return nil, err
+	}
+	if header.Hash() != bid.Header.BlockHash {
+		return nil, fmt.Errorf("block hash doesn't match header: %x", header.Hash())
+	}
+	if header.ParentHash != parent.Hash() {
+		return nil, fmt.Errorf("parent %x, expected %x", header.ParentHash, parent.Hash())
+	}
+	if header.Number.Uint64() != parent.Number.Uint64()+1 {
+		return nil, fmt.Errorf("block number %d, expected %d", header.Number, parent.Number.Uint64()+1)
+	}
+	if header.Time != local.Timestamp {
+		return nil, fmt.Errorf("timestamp %d, expected %d", header.Time, local.Timestamp)
+	}
+	if random := gointerfaces.ConvertH256ToHash(local.Random); header.MixDigest != random {
+		return nil, fmt.Errorf("prev_randao %x, expected %x", header.MixDigest, random)
+	}
+	if feeRecipient := gointerfaces.ConvertH160toAddress(local.Coinbase); header.Coinbase != feeRecipient {
+		return nil, fmt.Errorf("fee recipient %x, expected %x", header.Coinbase, feeRecipient)
+	}
+	if uint64(len(header.Extra)) > params.MaximumExtraDataSize {
+		return nil, fmt.Errorf("extra data too long: %d", len(header.Extra))
+	}
+	if header.GasUsed > header.GasLimit {
+		return nil, fmt.Errorf("gas used %d above gas limit %d", header.GasUsed, header.GasLimit)
+	}
+	// gas limit and base fee
+	if err = misc.VerifyEip1559Header(p.chainConfig, parent, header); err != nil {
+		return nil, err
+	}
+	if (*big.Int)(bid.Value).Sign() <= 0 {
+		return nil, fmt.Errorf("zero value")
+	}
+	return header, nil
+}
+
+// handleBlindedBlock - POST /eth/v1/builder/blinded_blocks: reveals payload of accepted bid by its relay
+func (p *RelayProxy) handleBlindedBlock(w http.ResponseWriter, r *http.Request) {
+	signedBlindedBlock, err := ioutil.ReadAll(io.LimitReader(r.Body, maxResponseSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var blinded blindedBlockHash
+	if err = json.Unmarshal(signedBlindedBlock, &blinded); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	hash := blinded.Message.Body.ExecutionPayloadHeader.BlockHash
+	p.lock.Lock()
+	bid, ok := p.bids[hash]
+	p.lock.Unlock()
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("no accepted bid for block %x", hash))
+		return
+	}
+	payload, err := p.reveal(r.Context(), bid, signedBlindedBlock)
+	if err != nil {
+		log.Error("[relay] Payload rejected", "relay", bid.relay.URL(), "slot", bid.slot, "hash", hash, "err", err)
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeVersioned(w, payload)
+}
+
+// reveal - asks relay for payload and executes it
+func (p *RelayProxy) reveal(ctx context.Context, bid *acceptedBid, signedBlindedBlock []byte) (*ExecutionPayload, error) {
+	payload, err := bid.relay.GetPayload(ctx, signedBlindedBlock)
+	if err != nil {
+		return nil, err
+	}
+	block, err := payload.Block()
+	if err != nil {
+		return nil, err
+	}
+	// header of bid commits to all fields of block, including transactions root
+	if block.Hash() != bid.header.Hash() || payload.BlockHash != block.Hash() {
+		return nil, fmt.Errorf("payload %x (claimed %x) doesn't match bid %x", block.Hash(), payload.BlockHash, bid.header.Hash())
+	}
+	value, err := p.executor.ExecuteBlock(ctx, block)
+	if err != nil {
+		return nil, fmt.Errorf("execution: %w", err)
+	}
+	if value.Cmp(bid.value) < 0 {
+		return nil, fmt.Errorf("fee recipient receives %d, bid value %d", value, bid.value)
+	}
+	log.Info("[relay] Payload revealed", "slot", bid.slot, "relay", bid.relay.URL(), "block", block.NumberU64(),
+		"hash", block.Hash(), "txs", len(block.Transactions()), "value", value)
+	return payload, nil
+}
+
+func writeVersioned(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		Version string      `json:"version"`
+		Data    interface{} `json:"data"`
+	}{Version: "bellatrix", Data: data}); err != nil {
+		log.Warn("[relay] Can't write response", "err", err)
+	}
+}
+
+// writeError - error response of builder API
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}{Code: code, Message: err.Error()})
+}
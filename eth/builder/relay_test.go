@@ -0,0 +1,207 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	types2 "github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/common/math"
+	"github.com/ledgerwatch/erigon/consensus/misc"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/stretchr/testify/require"
+)
+
+type testLocalPayloads struct{ payload *types2.ExecutionPayload }
+
+func (l testLocalPayloads) LatestPayload(parentHash common.Hash) (*types2.ExecutionPayload, bool) {
+	if l.payload == nil || gointerfaces.ConvertH256ToHash(l.payload.ParentHash) != parentHash {
+		return nil, false
+	}
+	return l.payload, true
+}
+
+type testExecutor struct {
+	localValue, blockValue *big.Int
+	executed               []common.Hash
+}
+
+func (e *testExecutor) ExecuteBlock(_ context.Context, block *types.Block) (*big.Int, error) {
+	e.executed = append(e.executed, block.Hash())
+	return e.blockValue, nil
+}
+
+func (e *testExecutor) TransactionsValue(context.Context, *types.Header, types.Transactions) (*big.Int, error) {
+	return e.localValue, nil
+}
+
+// testRelay - builder API of relay, which bids with payload on top of requested parent
+type testRelay struct {
+	value     int64
+	timestamp uint64 // of local payload by default
+	payload   *ExecutionPayload
+	revealed  int
+}
+
+func (r *testRelay) handler(t *testing.T, parent *types.Header, local *types2.ExecutionPayload, chainConfig *params.ChainConfig) http.Handler {
+	r.payload = &ExecutionPayload{
+		ParentHash:    parent.Hash(),
+		FeeRecipient:  gointerfaces.ConvertH160toAddress(local.Coinbase),
+		StateRoot:     common.Hash{byte(r.value)},
+		LogsBloom:     make(hexutil.Bytes, types.BloomByteLength),
+		PrevRandao:    gointerfaces.ConvertH256ToHash(local.Random),
+		BlockNumber:   math.Decimal64(parent.Number.Uint64() + 1),
+		GasLimit:      math.Decimal64(parent.GasLimit),
+		Timestamp:     math.Decimal64(local.Timestamp),
+		BaseFeePerGas: (*math.Decimal256)(misc.CalcBaseFee(chainConfig, parent)),
+		Transactions:  []hexutil.Bytes{},
+	}
+	if r.timestamp != 0 {
+		r.payload.Timestamp = math.Decimal64(r.timestamp)
+	}
+	block, err := r.payload.Block()
+	require.NoError(t, err)
+	r.payload.BlockHash = block.Hash()
+	bid := &SignedBuilderBid{
+		Message: &BuilderBid{
+			Header: &ExecutionPayloadHeader{
+				ParentHash:       r.payload.ParentHash,
+				FeeRecipient:     r.payload.FeeRecipient,
+				StateRoot:        r.payload.StateRoot,
+				LogsBloom:        r.payload.LogsBloom,
+				PrevRandao:       r.payload.PrevRandao,
+				BlockNumber:      r.payload.BlockNumber,
+				GasLimit:         r.payload.GasLimit,
+				Timestamp:        r.payload.Timestamp,
+				BaseFeePerGas:    r.payload.BaseFeePerGas,
+				BlockHash:        block.Hash(),
+				TransactionsRoot: block.TxHash(),
+			},
+			Value:  math.NewDecimal256(r.value),
+			Pubkey: hexutil.Bytes{1},
+		},
+		Signature: hexutil.Bytes{2},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == statusPath:
+		case strings.HasPrefix(req.URL.Path, fmt.Sprintf("%s%d/%s/", headerPath, 10, parent.Hash().Hex())):
+			writeVersioned(w, bid)
+		case req.URL.Path == blindedBlockPath:
+			r.revealed++
+			writeVersioned(w, r.payload)
+		default:
+			http.NotFound(w, req)
+		}
+	})
+}
+
+func signedBlindedBlock(hash common.Hash) []byte {
+	return []byte(fmt.Sprintf(`{"message":{"slot":"10","body":{"execution_payload_header":{"block_hash":"%s"}}},"signature":"0x02"}`, hash.Hex()))
+}
+
+func TestRelayProxy(t *testing.T) {
+	chainConfig := *params.TestChainConfig
+	chainConfig.LondonBlock = big.NewInt(0)
+	parent := &types.Header{Number: big.NewInt(5), GasLimit: 30_000_000, GasUsed: 15_000_000, Time: 100,
+		BaseFee: big.NewInt(params.InitialBaseFee), Eip1559: true, Difficulty: new(big.Int)}
+	db := memdb.NewTestDB(t)
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		rawdb.WriteHeader(tx, parent)
+		return nil
+	}))
+	local := &types2.ExecutionPayload{
+		ParentHash: gointerfaces.ConvertHashToH256(parent.Hash()),
+		Coinbase:   gointerfaces.ConvertAddressToH160(common.Address{2}),
+		Random:     gointerfaces.ConvertHashToH256(common.Hash{3}),
+		Timestamp:  112,
+		GasLimit:   parent.GasLimit,
+	}
+
+	relays := []*testRelay{{value: 5}, {value: 7}, {value: 100, timestamp: 111 /* another slot */}}
+	var urls []string
+	for _, r := range relays {
+		srv := httptest.NewServer(r.handler(t, parent, local, &chainConfig))
+		defer srv.Close()
+		urls = append(urls, srv.URL)
+	}
+	executor := &testExecutor{localValue: big.NewInt(3), blockValue: big.NewInt(7)}
+	proxy, err := NewRelayProxy(urls, 5*time.Second, db, &chainConfig, testLocalPayloads{payload: local}, executor)
+	require.NoError(t, err)
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+
+	getHeader := func(parentHash common.Hash) *http.Response {
+		resp, err := http.Get(fmt.Sprintf("%s%s10/%s/0x01", srv.URL, headerPath, parentHash.Hex()))
+		require.NoError(t, err)
+		return resp
+	}
+	reveal := func(hash common.Hash) *http.Response {
+		resp, err := http.Post(srv.URL+blindedBlockPath, "application/json", bytes.NewReader(signedBlindedBlock(hash)))
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp, err := http.Get(srv.URL + statusPath)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the most valuable valid bid
+	resp = getHeader(parent.Hash())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var bid SignedBuilderBid
+	require.NoError(t, decodeVersionedResponse(resp, &bid))
+	require.Equal(t, relays[1].payload.BlockHash, bid.Message.Header.BlockHash)
+	require.Equal(t, hexutil.Bytes{2}, bid.Signature)
+
+	// payload is revealed only for accepted bid and after execution
+	resp = reveal(relays[0].payload.BlockHash)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = reveal(relays[1].payload.BlockHash)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var payload ExecutionPayload
+	require.NoError(t, decodeVersionedResponse(resp, &payload))
+	require.Equal(t, relays[1].payload.BlockHash, payload.BlockHash)
+	require.Equal(t, []common.Hash{payload.BlockHash}, executor.executed)
+
+	// execution shows that fee recipient receives less than bid value
+	executor.blockValue = big.NewInt(6)
+	resp = reveal(relays[1].payload.BlockHash)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	// local payload is worth more, or there is no local payload to compare with
+	executor.localValue = big.NewInt(7)
+	resp = getHeader(parent.Hash())
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = getHeader(common.Hash{1})
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, 0, relays[2].revealed)
+}
+
+func decodeVersionedResponse(resp *http.Response, data interface{}) error {
+	defer resp.Body.Close()
+	var v versioned
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return err
+	}
+	return json.Unmarshal(v.Data, data)
+}
@@ -0,0 +1,64 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/params"
+)
+
+// BundleValidator - extension point of bundles admission: bundle is rejected if validator returns error
+type BundleValidator interface {
+	ValidateBundle(ctx context.Context, txs types.Transactions) error
+}
+
+// SponsorshipValidator - rejects bundles with sponsored transactions (see params.SponsorshipConfig) whose fee payer
+// can't pay for gas on top of the latest executed state. Such transactions never reach the block from txpool -
+// it considers only sender's balance - so bundles are the way to submit them.
+type SponsorshipValidator struct {
+	db          kv.RoDB
+	chainConfig *params.ChainConfig
+}
+
+func NewSponsorshipValidator(db kv.RoDB, chainConfig *params.ChainConfig) *SponsorshipValidator {
+	return &SponsorshipValidator{db: db, chainConfig: chainConfig}
+}
+
+func (v *SponsorshipValidator) ValidateBundle(ctx context.Context, txs types.Transactions) error {
+	tx, err := v.db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	executed, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return err
+	}
+	blockNum := executed + 1
+	if !v.chainConfig.IsSponsorship(blockNum) {
+		return nil
+	}
+	head := rawdb.ReadHeaderByNumber(tx, executed)
+	if head == nil {
+		return fmt.Errorf("header %d not found", executed)
+	}
+	signer := types.MakeSigner(v.chainConfig, blockNum)
+	ibs := state.New(state.NewPlainStateReader(tx))
+	for i, txn := range txs {
+		msg, err := txn.AsMessage(*signer, head.BaseFee)
+		if err != nil {
+			return fmt.Errorf("tx %d: %w", i, err)
+		}
+		if err = core.ValidateSponsoredTx(v.chainConfig, blockNum, ibs, msg); err != nil {
+			return fmt.Errorf("tx %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package calltracer
 
 import (
+	"bytes"
 	"encoding/binary"
 	"math/big"
 	"sort"
@@ -9,28 +10,53 @@ import (
 	"github.com/ledgerwatch/erigon-lib/common/length"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/core/vm"
 	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/log/v3"
 )
 
+// selectorKey - address of called code + 4-byte function selector
+type selectorKey [length.Addr + 4]byte
+
+// txCallKey - address + index of transaction which touched it (4 bytes big-endian)
+type txCallKey [length.Addr + 4]byte
+
 type CallTracer struct {
-	froms   map[common.Address]struct{}
-	tos     map[common.Address]bool // address -> isCreated
-	hasTEVM func(contractHash common.Hash) (bool, error)
+	froms     map[common.Address]struct{}
+	tos       map[common.Address]bool // address -> isCreated
+	selectors map[selectorKey]struct{}
+	txCalls   map[txCallKey]struct{}
+	txIndex   int // index of currently executed transaction, top-level call starts the next one
+	hasTEVM   func(contractHash common.Hash) (bool, error)
 }
 
 func NewCallTracer(hasTEVM func(contractHash common.Hash) (bool, error)) *CallTracer {
 	return &CallTracer{
-		froms:   make(map[common.Address]struct{}),
-		tos:     make(map[common.Address]bool),
-		hasTEVM: hasTEVM,
+		froms:     make(map[common.Address]struct{}),
+		tos:       make(map[common.Address]bool),
+		selectors: make(map[selectorKey]struct{}),
+		txCalls:   make(map[txCallKey]struct{}),
+		txIndex:   -1,
+		hasTEVM:   hasTEVM,
 	}
 }
 
 func (ct *CallTracer) CaptureStart(evm *vm.EVM, depth int, from common.Address, to common.Address, precompile bool, create bool, calltype vm.CallType, input []byte, gas uint64, value *big.Int, code []byte) {
 	ct.froms[from] = struct{}{}
+	if depth == 0 {
+		ct.txIndex++
+	}
+	ct.addTxCall(from)
+	ct.addTxCall(to)
+	// for DELEGATECALL and CALLCODE `to` is the address of the code, it's what selector belongs to
+	if !create && !precompile && len(input) >= 4 {
+		var k selectorKey
+		copy(k[:], to[:])
+		copy(k[length.Addr:], input[:4])
+		ct.selectors[k] = struct{}{}
+	}
 
 	created, ok := ct.tos[to]
 	if !ok {
@@ -59,6 +85,15 @@ func (ct *CallTracer) CaptureEnd(depth int, output []byte, startGas, endGas uint
 func (ct *CallTracer) CaptureSelfDestruct(from common.Address, to common.Address, value *big.Int) {
 	ct.froms[from] = struct{}{}
 	ct.tos[to] = false
+	ct.addTxCall(from)
+	ct.addTxCall(to)
+}
+
+func (ct *CallTracer) addTxCall(addr common.Address) {
+	var k txCallKey
+	copy(k[:], addr[:])
+	binary.BigEndian.PutUint32(k[length.Addr:], uint32(ct.txIndex))
+	ct.txCalls[k] = struct{}{}
 }
 func (ct *CallTracer) CaptureAccountRead(account common.Address) error {
 	return nil
@@ -117,5 +152,48 @@ func (ct *CallTracer) WriteToDb(tx kv.RwTx, block *types.Block, vmConfig vm.Conf
 		}
 		copy(prev[:], addr[:])
 	}
+	return ct.writeSelectors(tx, blockNumEnc[:])
+}
+
+func (ct *CallTracer) writeSelectors(tx kv.RwTx, blockNumEnc []byte) error {
+	keys := make([]selectorKey, 0, len(ct.selectors))
+	for k := range ct.selectors {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+	for j := range keys {
+		if j == 0 {
+			if err := tx.Append(rawdb.CallSelectorSet, blockNumEnc, keys[j][:]); err != nil {
+				return err
+			}
+		} else {
+			if err := tx.AppendDup(rawdb.CallSelectorSet, blockNumEnc, keys[j][:]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteTxCallsToDb - addresses touched by calls of every transaction of the block, see rawdb.TxCallSet
+func (ct *CallTracer) WriteTxCallsToDb(tx kv.RwTx, blockNum uint64) error {
+	keys := make([]txCallKey, 0, len(ct.txCalls))
+	for k := range ct.txCalls {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+	var blockNumEnc [8]byte
+	binary.BigEndian.PutUint64(blockNumEnc[:], blockNum)
+	for j := range keys {
+		if j == 0 {
+			if err := tx.Append(rawdb.TxCallSet, blockNumEnc[:], keys[j][:]); err != nil {
+				return err
+			}
+		} else {
+			if err := tx.AppendDup(rawdb.TxCallSet, blockNumEnc[:], keys[j][:]); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
@@ -0,0 +1,235 @@
+// Package clcheckpoint polls finalized blocks from several consensus layer (beacon node) REST endpoints, cross-checks
+// them and provides finalized block hashes agreed by quorum of endpoints - trust anchors for PoS backward sync of headers.
+package clcheckpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	PollInterval   = 30 * time.Second
+	requestTimeout = 10 * time.Second
+	// keepCheckpoints - amount of latest finalized block numbers for which votes of endpoints are kept
+	keepCheckpoints = 1024
+)
+
+var disagreements = metrics.GetOrCreateCounter("cl_checkpoint_disagreements")
+
+type Checkpoint struct {
+	Number uint64
+	Hash   common.Hash
+}
+
+// Checker - keeps finalized blocks reported by endpoints. Block is trusted if quorum of endpoints reported same hash
+// for its number, and no endpoint reported other hash.
+type Checker struct {
+	endpoints []string
+	names     []string // endpoints without credentials, for logs and metrics
+	quorum    int
+	client    *http.Client
+
+	lock    sync.RWMutex
+	votes   map[uint64]map[common.Hash]map[int]struct{} // block number -> hash -> indices of endpoints
+	numbers []uint64                                    // sorted keys of votes
+}
+
+// New - quorum 0 means majority of endpoints
+func New(endpoints []string, quorum int) (*Checker, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no consensus layer endpoints")
+	}
+	if quorum == 0 {
+		quorum = len(endpoints)/2 + 1
+	}
+	if quorum < 0 || quorum > len(endpoints) {
+		return nil, fmt.Errorf("quorum %d of %d consensus layer endpoints", quorum, len(endpoints))
+	}
+	names := make([]string, len(endpoints))
+	for i, endpoint := range endpoints {
+		names[i] = Redact(endpoint)
+	}
+	return &Checker{
+		endpoints: endpoints,
+		names:     names,
+		quorum:    quorum,
+		client:    &http.Client{Timeout: requestTimeout},
+		votes:     map[uint64]map[common.Hash]map[int]struct{}{},
+	}, nil
+}
+
+// Finalized - hash of finalized block with given number, if quorum of endpoints agree on it
+func (c *Checker) Finalized(number uint64) (common.Hash, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.trusted(number)
+}
+
+// Quorum - how many endpoints must agree on block to trust it
+func (c *Checker) Quorum() int { return c.quorum }
+
+// Latest - highest trusted finalized block
+func (c *Checker) Latest() (Checkpoint, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for i := len(c.numbers) - 1; i >= 0; i-- {
+		if hash, ok := c.trusted(c.numbers[i]); ok {
+			return Checkpoint{Number: c.numbers[i], Hash: hash}, true
+		}
+	}
+	return Checkpoint{}, false
+}
+
+func (c *Checker) trusted(number uint64) (common.Hash, bool) {
+	byHash := c.votes[number]
+	if len(byHash) != 1 {
+		return common.Hash{}, false
+	}
+	for hash, endpoints := range byHash {
+		if len(endpoints) >= c.quorum {
+			return hash, true
+		}
+	}
+	return common.Hash{}, false
+}
+
+// add - records finalized block reported by endpoint, alerts if other endpoint reported other hash for same number
+func (c *Checker) add(endpoint int, cp Checkpoint) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	byHash, ok := c.votes[cp.Number]
+	if !ok {
+		if len(c.numbers) >= keepCheckpoints && cp.Number < c.numbers[0] {
+			return
+		}
+		byHash = map[common.Hash]map[int]struct{}{}
+		c.votes[cp.Number] = byHash
+		i := sort.Search(len(c.numbers), func(i int) bool { return c.numbers[i] > cp.Number })
+		c.numbers = append(c.numbers, 0)
+		copy(c.numbers[i+1:], c.numbers[i:])
+		c.numbers[i] = cp.Number
+		if len(c.numbers) > keepCheckpoints {
+			delete(c.votes, c.numbers[0])
+			c.numbers = c.numbers[1:]
+		}
+	}
+	if _, ok := byHash[cp.Hash][endpoint]; ok {
+		return
+	}
+	if byHash[cp.Hash] == nil {
+		byHash[cp.Hash] = map[int]struct{}{}
+	}
+	byHash[cp.Hash][endpoint] = struct{}{}
+	if len(byHash) > 1 {
+		disagreements.Inc()
+		args := []interface{}{"number", cp.Number}
+		for hash, endpoints := range byHash {
+			for e := range endpoints {
+				args = append(args, c.names[e], hash)
+			}
+		}
+		log.Error("[cl checkpoints] Consensus layer endpoints disagree on finalized block", args...)
+	}
+}
+
+// Loop - polls endpoints every interval
+func (c *Checker) Loop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.Poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll - requests finalized block from all endpoints
+func (c *Checker) Poll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range c.endpoints {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cp, err := fetchFinalized(ctx, c.client, c.endpoints[i])
+			if err != nil {
+				metrics.GetOrCreateCounter(fmt.Sprintf(`cl_checkpoint_errors{endpoint="%s"}`, c.names[i])).Inc()
+				log.Warn("[cl checkpoints] Can't get finalized block", "endpoint", c.names[i], "err", err)
+				return
+			}
+			c.add(i, cp)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// Redact - endpoints of RPC providers often contain API keys in path or query, only host is logged
+func Redact(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "invalid"
+	}
+	return u.Host
+}
+
+type blockResponse struct {
+	Data struct {
+		Message struct {
+			Body struct {
+				ExecutionPayload *struct {
+					BlockNumber string      `json:"block_number"`
+					BlockHash   common.Hash `json:"block_hash"`
+				} `json:"execution_payload"`
+			} `json:"body"`
+		} `json:"message"`
+	} `json:"data"`
+}
+
+// fetchFinalized - execution block of finalized beacon block, by standard beacon node API
+func fetchFinalized(ctx context.Context, client *http.Client, endpoint string) (Checkpoint, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(endpoint, "/")+"/eth/v2/beacon/blocks/finalized", nil)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) { // don't log url
+			err = urlErr.Err
+		}
+		return Checkpoint{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Checkpoint{}, fmt.Errorf("status %s", resp.Status)
+	}
+	var block blockResponse
+	if err = json.NewDecoder(resp.Body).Decode(&block); err != nil {
+		return Checkpoint{}, err
+	}
+	payload := block.Data.Message.Body.ExecutionPayload
+	if payload == nil {
+		return Checkpoint{}, fmt.Errorf("finalized block has no execution payload")
+	}
+	number, err := strconv.ParseUint(payload.BlockNumber, 10, 64)
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("block_number: %w", err)
+	}
+	return Checkpoint{Number: number, Hash: payload.BlockHash}, nil
+}
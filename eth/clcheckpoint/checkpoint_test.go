@@ -0,0 +1,116 @@
+package clcheckpoint
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/stretchr/testify/require"
+)
+
+// beaconNode - serves finalized block, number and hash can be changed by test
+type beaconNode struct {
+	number uint64
+	hash   common.Hash
+}
+
+func (b *beaconNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/eth/v2/beacon/blocks/finalized" {
+		http.NotFound(w, r)
+		return
+	}
+	if b.number == 0 { // before merge
+		fmt.Fprint(w, `{"version":"altair","data":{"message":{"slot":"1","body":{}}}}`)
+		return
+	}
+	fmt.Fprintf(w, `{"version":"bellatrix","data":{"message":{"slot":"1","body":{"execution_payload":{"block_number":"%d","block_hash":"%s"}}}}}`, b.number, b.hash.Hex())
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(nil, 0)
+	require.Error(t, err)
+	_, err = New([]string{"http://a", "http://b"}, 3)
+	require.Error(t, err)
+	c, err := New([]string{"http://a", "http://b", "http://c"}, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, c.quorum)
+}
+
+func TestPoll(t *testing.T) {
+	nodes := []*beaconNode{{number: 100, hash: common.Hash{1}}, {number: 100, hash: common.Hash{1}}, {number: 90, hash: common.Hash{9}}}
+	var endpoints []string
+	for _, node := range nodes {
+		srv := httptest.NewServer(node)
+		defer srv.Close()
+		endpoints = append(endpoints, srv.URL+"/")
+	}
+	c, err := New(endpoints, 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	c.Poll(ctx)
+	hash, ok := c.Finalized(100)
+	require.True(t, ok)
+	require.Equal(t, common.Hash{1}, hash)
+	_, ok = c.Finalized(90) // only one endpoint
+	require.False(t, ok)
+	latest, ok := c.Latest()
+	require.True(t, ok)
+	require.Equal(t, Checkpoint{Number: 100, Hash: common.Hash{1}}, latest)
+
+	// lagging endpoint catches up with other hash - block is not trusted anymore
+	before := disagreements.Get()
+	nodes[2].number, nodes[2].hash = 100, common.Hash{2}
+	c.Poll(ctx)
+	_, ok = c.Finalized(100)
+	require.False(t, ok)
+	require.Equal(t, before+1, disagreements.Get())
+	_, ok = c.Latest()
+	require.False(t, ok)
+
+	// repeated reports are not new disagreements
+	c.Poll(ctx)
+	require.Equal(t, before+1, disagreements.Get())
+
+	nodes[0].number, nodes[1].number, nodes[2].number = 200, 200, 0
+	nodes[0].hash, nodes[1].hash = common.Hash{3}, common.Hash{3}
+	c.Poll(ctx)
+	latest, ok = c.Latest()
+	require.True(t, ok)
+	require.Equal(t, Checkpoint{Number: 200, Hash: common.Hash{3}}, latest)
+}
+
+func TestFetchFinalized(t *testing.T) {
+	srv := httptest.NewServer(&beaconNode{})
+	defer srv.Close()
+	_, err := fetchFinalized(context.Background(), http.DefaultClient, srv.URL)
+	require.Error(t, err)
+
+	srv.Close()
+	_, err = fetchFinalized(context.Background(), http.DefaultClient, srv.URL+"/secret-api-key")
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "secret-api-key")
+
+	require.Equal(t, "provider.io:8080", Redact("https://provider.io:8080/v1/secret-api-key?token=x"))
+}
+
+func TestKeepCheckpoints(t *testing.T) {
+	c, err := New([]string{"http://a"}, 1)
+	require.NoError(t, err)
+	for i := uint64(1); i <= keepCheckpoints+10; i++ {
+		c.add(0, Checkpoint{Number: i * 32, Hash: common.BigToHash(new(big.Int).SetUint64(i))})
+	}
+	require.Len(t, c.numbers, keepCheckpoints)
+	require.Len(t, c.votes, keepCheckpoints)
+	_, found := c.Finalized(32)
+	require.False(t, found)
+	c.add(0, Checkpoint{Number: 32, Hash: common.Hash{1}}) // too old
+	require.Len(t, c.votes, keepCheckpoints)
+	hash, found := c.Finalized((keepCheckpoints + 10) * 32)
+	require.True(t, found)
+	require.Equal(t, common.BigToHash(big.NewInt(keepCheckpoints+10)), hash)
+}
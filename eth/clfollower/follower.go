@@ -0,0 +1,314 @@
+// Package clfollower is an embedded light consensus layer: it follows head of beacon nodes by their REST API and
+// drives execution by engine API calls (new payload, fork choice update) in-process, so the node follows post-merge
+// chain without external consensus layer client. Sync committee signatures are not verified - instead every block
+// (head as well as finalized) is used only if quorum of endpoints (clcheckpoint.Checker.Quorum) returns same block,
+// so a single endpoint can't steer the head. Sync starts from finalized block agreed by quorum of endpoints
+// (checkpoint sync), then head is followed every slot.
+package clfollower
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	types2 "github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/eth/clcheckpoint"
+	"github.com/ledgerwatch/erigon/ethdb/privateapi"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	SlotInterval   = 12 * time.Second
+	requestTimeout = 10 * time.Second
+)
+
+var (
+	headNumber  uint64 // number of last payload accepted as VALID
+	_           = metrics.GetOrCreateGauge("cl_light_head", func() float64 { return float64(atomic.LoadUint64(&headNumber)) })
+	fetchErrors = metrics.GetOrCreateCounter("cl_light_fetch_errors")
+	noQuorum    = metrics.GetOrCreateCounter("cl_light_no_quorum")
+)
+
+// errNoQuorum - endpoints don't agree on block yet, e.g. some of them haven't imported new head
+var errNoQuorum = errors.New("no quorum of endpoints")
+
+// Engine - engine API of execution layer, implemented by privateapi.EthBackendServer
+type Engine interface {
+	EngineExecutePayloadV1(ctx context.Context, req *types2.ExecutionPayload) (*remote.EngineExecutePayloadReply, error)
+	EngineForkChoiceUpdatedV1(ctx context.Context, req *remote.EngineForkChoiceUpdatedRequest) (*remote.EngineForkChoiceUpdatedReply, error)
+}
+
+type Follower struct {
+	endpoints   []string
+	names       []string // endpoints without credentials, for logs
+	quorum      int
+	checkpoints *clcheckpoint.Checker
+	engine      Engine
+	client      *http.Client
+
+	checkpointSynced bool
+	head             common.Hash // last payload accepted as VALID
+}
+
+// New - all endpoints are asked for block, it's used if quorum of checkpoints' endpoints return it
+func New(endpoints []string, checkpoints *clcheckpoint.Checker, engine Engine) (*Follower, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no consensus layer endpoints")
+	}
+	names := make([]string, len(endpoints))
+	for i, endpoint := range endpoints {
+		names[i] = clcheckpoint.Redact(endpoint)
+	}
+	return &Follower{
+		endpoints:   endpoints,
+		names:       names,
+		quorum:      checkpoints.Quorum(),
+		checkpoints: checkpoints,
+		engine:      engine,
+		client:      &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+// Loop - steps every interval
+func (f *Follower) Loop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := f.Step(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Warn("[cl light] Step failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Step - sends beacon nodes' head (or, until checkpoint is synced, trusted finalized block) to execution layer
+// and updates fork choice. Payload which execution layer is still syncing to is sent again on next step.
+func (f *Follower) Step(ctx context.Context) error {
+	blockID := "head"
+	if !f.checkpointSynced {
+		blockID = "finalized"
+	}
+	payload, number, err := f.fetch(ctx, blockID)
+	if errors.Is(err, errNoQuorum) {
+		log.Debug("[cl light] Waiting for quorum of endpoints", "id", blockID, "err", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	hash := gointerfaces.ConvertH256ToHash(payload.BlockHash)
+	var finalized common.Hash
+	if f.checkpointSynced {
+		if cp, ok := f.checkpoints.Latest(); ok {
+			finalized = cp.Hash
+		}
+	} else {
+		// checkpoint sync starts only from a block agreed by quorum of endpoints
+		if trusted, ok := f.checkpoints.Finalized(number); !ok || trusted != hash {
+			log.Info("[cl light] Waiting for quorum of endpoints on finalized block", "number", number, "hash", common.Hash(hash))
+			return nil
+		}
+		finalized = hash
+	}
+	if hash == f.head {
+		return nil
+	}
+
+	reply, err := f.engine.EngineExecutePayloadV1(ctx, payload)
+	if err != nil {
+		return fmt.Errorf("new payload %d: %w", number, err)
+	}
+	if privateapi.PayloadStatus(reply.Status) == privateapi.Invalid {
+		return fmt.Errorf("execution layer rejected payload %d %x agreed by quorum of beacon nodes", number, hash)
+	}
+	if _, err = f.engine.EngineForkChoiceUpdatedV1(ctx, &remote.EngineForkChoiceUpdatedRequest{
+		Forkchoice: &remote.EngineForkChoiceUpdated{
+			HeadBlockHash:      payload.BlockHash,
+			SafeBlockHash:      gointerfaces.ConvertHashToH256(finalized),
+			FinalizedBlockHash: gointerfaces.ConvertHashToH256(finalized),
+		},
+	}); err != nil {
+		return fmt.Errorf("fork choice update %d: %w", number, err)
+	}
+	if privateapi.PayloadStatus(reply.Status) != privateapi.Valid {
+		log.Info("[cl light] Execution layer is syncing", "number", number, "hash", common.Hash(hash))
+		return nil
+	}
+	f.head = hash
+	atomic.StoreUint64(&headNumber, number)
+	if !f.checkpointSynced {
+		f.checkpointSynced = true
+		log.Info("[cl light] Checkpoint synced, following head", "number", number, "hash", common.Hash(hash))
+	} else {
+		log.Debug("[cl light] New head", "number", number, "hash", common.Hash(hash))
+	}
+	return nil
+}
+
+// fetch - execution payload of beacon block, which quorum of endpoints agree on. Endpoints are asked in parallel.
+func (f *Follower) fetch(ctx context.Context, blockID string) (*types2.ExecutionPayload, uint64, error) {
+	type result struct {
+		payload *types2.ExecutionPayload
+		number  uint64
+		err     error
+	}
+	results := make([]result, len(f.endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range f.endpoints {
+		wg.Add(1)
+		go func(i int, endpoint string) {
+			defer wg.Done()
+			payload, number, err := fetchPayload(ctx, f.client, endpoint, blockID)
+			results[i] = result{payload, number, err}
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	votes := map[common.Hash]int{}
+	var lastErr error
+	for i, r := range results {
+		if r.err != nil {
+			if errors.Is(r.err, context.Canceled) {
+				return nil, 0, r.err
+			}
+			fetchErrors.Inc()
+			log.Debug("[cl light] Can't get block", "id", blockID, "endpoint", f.names[i], "err", r.err)
+			lastErr = r.err
+			continue
+		}
+		hash := gointerfaces.ConvertH256ToHash(r.payload.BlockHash)
+		votes[hash]++
+		if votes[hash] >= f.quorum {
+			return r.payload, r.number, nil
+		}
+	}
+	if len(votes) == 0 {
+		return nil, 0, fmt.Errorf("no endpoint returned %s block: %w", blockID, lastErr)
+	}
+	noQuorum.Inc()
+	return nil, 0, fmt.Errorf("%w: %s block, %d endpoints, %d different blocks, quorum %d", errNoQuorum, blockID, len(f.endpoints), len(votes), f.quorum)
+}
+
+type executionPayload struct {
+	ParentHash    common.Hash     `json:"parent_hash"`
+	FeeRecipient  common.Address  `json:"fee_recipient"`
+	StateRoot     common.Hash     `json:"state_root"`
+	ReceiptsRoot  common.Hash     `json:"receipts_root"`
+	LogsBloom     hexutil.Bytes   `json:"logs_bloom"`
+	PrevRandao    common.Hash     `json:"prev_randao"`
+	Random        common.Hash     `json:"random"` // name of prev_randao in pre-release specs
+	BlockNumber   string          `json:"block_number"`
+	GasLimit      string          `json:"gas_limit"`
+	GasUsed       string          `json:"gas_used"`
+	Timestamp     string          `json:"timestamp"`
+	ExtraData     hexutil.Bytes   `json:"extra_data"`
+	BaseFeePerGas string          `json:"base_fee_per_gas"`
+	BlockHash     common.Hash     `json:"block_hash"`
+	Transactions  []hexutil.Bytes `json:"transactions"`
+}
+
+type blockResponse struct {
+	Data struct {
+		Message struct {
+			Body struct {
+				ExecutionPayload *executionPayload `json:"execution_payload"`
+			} `json:"body"`
+		} `json:"message"`
+	} `json:"data"`
+}
+
+// fetchPayload - execution payload of beacon block by standard beacon node API, with its number
+func fetchPayload(ctx context.Context, client *http.Client, endpoint, blockID string) (*types2.ExecutionPayload, uint64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(endpoint, "/")+"/eth/v2/beacon/blocks/"+blockID, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) { // don't log url
+			err = urlErr.Err
+		}
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("status %s", resp.Status)
+	}
+	var block blockResponse
+	if err = json.NewDecoder(resp.Body).Decode(&block); err != nil {
+		return nil, 0, err
+	}
+	if block.Data.Message.Body.ExecutionPayload == nil {
+		return nil, 0, fmt.Errorf("%s block has no execution payload", blockID)
+	}
+	return block.Data.Message.Body.ExecutionPayload.toProto()
+}
+
+func (p *executionPayload) toProto() (*types2.ExecutionPayload, uint64, error) {
+	var numbers [4]uint64
+	for i, field := range []struct{ name, value string }{
+		{"block_number", p.BlockNumber}, {"gas_limit", p.GasLimit}, {"gas_used", p.GasUsed}, {"timestamp", p.Timestamp},
+	} {
+		n, err := strconv.ParseUint(field.value, 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", field.name, err)
+		}
+		numbers[i] = n
+	}
+	baseFeeBig, ok := new(big.Int).SetString(p.BaseFeePerGas, 10)
+	if !ok {
+		return nil, 0, fmt.Errorf("base_fee_per_gas: invalid number %q", p.BaseFeePerGas)
+	}
+	baseFee, overflow := uint256.FromBig(baseFeeBig)
+	if overflow {
+		return nil, 0, fmt.Errorf("base_fee_per_gas: overflow")
+	}
+	if len(p.LogsBloom) != 256 {
+		return nil, 0, fmt.Errorf("logs_bloom: length %d", len(p.LogsBloom))
+	}
+	random := p.PrevRandao
+	if random == (common.Hash{}) {
+		random = p.Random
+	}
+	txs := make([][]byte, len(p.Transactions))
+	for i, tx := range p.Transactions {
+		txs[i] = tx
+	}
+	return &types2.ExecutionPayload{
+		ParentHash:    gointerfaces.ConvertHashToH256(p.ParentHash),
+		Coinbase:      gointerfaces.ConvertAddressToH160(p.FeeRecipient),
+		StateRoot:     gointerfaces.ConvertHashToH256(p.StateRoot),
+		ReceiptRoot:   gointerfaces.ConvertHashToH256(p.ReceiptsRoot),
+		LogsBloom:     gointerfaces.ConvertBytesToH2048(p.LogsBloom),
+		Random:        gointerfaces.ConvertHashToH256(random),
+		BlockNumber:   numbers[0],
+		GasLimit:      numbers[1],
+		GasUsed:       numbers[2],
+		Timestamp:     numbers[3],
+		ExtraData:     p.ExtraData,
+		BaseFeePerGas: gointerfaces.ConvertUint256IntToH256(baseFee),
+		BlockHash:     gointerfaces.ConvertHashToH256(p.BlockHash),
+		Transactions:  txs,
+	}, numbers[0], nil
+}
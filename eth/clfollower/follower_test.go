@@ -0,0 +1,107 @@
+package clfollower
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	types2 "github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/eth/clcheckpoint"
+	"github.com/ledgerwatch/erigon/ethdb/privateapi"
+	"github.com/stretchr/testify/require"
+)
+
+// beaconNode - serves finalized and head blocks by number, hash of block N is common.Hash{N}
+type beaconNode struct {
+	finalized, head uint64
+}
+
+func (b *beaconNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var number uint64
+	switch r.URL.Path {
+	case "/eth/v2/beacon/blocks/finalized":
+		number = b.finalized
+	case "/eth/v2/beacon/blocks/head":
+		number = b.head
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprintf(w, `{"version":"bellatrix","data":{"message":{"slot":"1","body":{"execution_payload":{
+		"parent_hash":"%s","fee_recipient":"0x0000000000000000000000000000000000000001","state_root":"%s",
+		"receipts_root":"%s","logs_bloom":"0x%s","prev_randao":"%s","block_number":"%d","gas_limit":"30000000",
+		"gas_used":"21000","timestamp":"1655000000","extra_data":"0x01","base_fee_per_gas":"7","block_hash":"%s",
+		"transactions":["0x02f0"]}}}}}`,
+		common.Hash{byte(number - 1)}.Hex(), common.Hash{}.Hex(), common.Hash{}.Hex(), strings.Repeat("00", 256),
+		common.Hash{}.Hex(), number, common.Hash{byte(number)}.Hex())
+}
+
+// engine - replies status of payloads, records fork choice updates
+type engine struct {
+	status     privateapi.PayloadStatus
+	payloads   []uint64
+	forkchoice []*remote.EngineForkChoiceUpdated
+}
+
+func (e *engine) EngineExecutePayloadV1(_ context.Context, req *types2.ExecutionPayload) (*remote.EngineExecutePayloadReply, error) {
+	e.payloads = append(e.payloads, req.BlockNumber)
+	return &remote.EngineExecutePayloadReply{Status: string(e.status)}, nil
+}
+
+func (e *engine) EngineForkChoiceUpdatedV1(_ context.Context, req *remote.EngineForkChoiceUpdatedRequest) (*remote.EngineForkChoiceUpdatedReply, error) {
+	e.forkchoice = append(e.forkchoice, req.Forkchoice)
+	return &remote.EngineForkChoiceUpdatedReply{Status: "SUCCESS"}, nil
+}
+
+func TestStep(t *testing.T) {
+	nodes := []*beaconNode{{finalized: 10, head: 12}, {finalized: 10, head: 12}}
+	var endpoints []string
+	for _, node := range nodes {
+		srv := httptest.NewServer(node)
+		defer srv.Close()
+		endpoints = append(endpoints, srv.URL)
+	}
+	checkpoints, err := clcheckpoint.New(endpoints, 2)
+	require.NoError(t, err)
+	e := &engine{status: privateapi.Syncing}
+	f, err := New(append([]string{"http://127.0.0.1:1"}, endpoints...), checkpoints, e) // first endpoint is down
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// no quorum on finalized block yet - nothing is sent
+	require.NoError(t, f.Step(ctx))
+	require.Empty(t, e.payloads)
+
+	// checkpoint sync: finalized block is sent until execution layer reaches it
+	checkpoints.Poll(ctx)
+	require.NoError(t, f.Step(ctx))
+	require.NoError(t, f.Step(ctx))
+	require.Equal(t, []uint64{10, 10}, e.payloads)
+	require.Equal(t, gointerfaces.ConvertHashToH256(common.Hash{10}), e.forkchoice[1].FinalizedBlockHash)
+	e.status = privateapi.Valid
+	require.NoError(t, f.Step(ctx))
+	require.True(t, f.checkpointSynced)
+
+	// head is followed, same head is not sent twice
+	require.NoError(t, f.Step(ctx))
+	require.NoError(t, f.Step(ctx))
+	require.Equal(t, []uint64{10, 10, 10, 12}, e.payloads)
+	last := e.forkchoice[len(e.forkchoice)-1]
+	require.Equal(t, gointerfaces.ConvertHashToH256(common.Hash{12}), last.HeadBlockHash)
+	require.Equal(t, gointerfaces.ConvertHashToH256(common.Hash{10}), last.FinalizedBlockHash)
+
+	// endpoints disagree on head - it's not sent
+	nodes[1].head = 13
+	require.NoError(t, f.Step(ctx))
+	require.Equal(t, []uint64{10, 10, 10, 12}, e.payloads)
+
+	e.status = privateapi.Invalid
+	nodes[0].head = 13
+	require.Error(t, f.Step(ctx))
+}
@@ -30,11 +30,16 @@ import (
 	"github.com/ledgerwatch/erigon/consensus/aura"
 	"github.com/ledgerwatch/erigon/consensus/aura/consensusconfig"
 	"github.com/ledgerwatch/erigon/consensus/serenity"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/turbo/firehose"
+	"github.com/ledgerwatch/erigon/turbo/maintenance"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snapshothashes"
 
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/consensus"
+	"github.com/ledgerwatch/erigon/consensus/bor"
 	"github.com/ledgerwatch/erigon/consensus/clique"
 	"github.com/ledgerwatch/erigon/consensus/db"
 	"github.com/ledgerwatch/erigon/consensus/ethash"
@@ -82,6 +87,8 @@ var Defaults = Config{
 		GasCeil:  8000000,
 		GasPrice: big.NewInt(params.GWei),
 		Recommit: 3 * time.Second,
+
+		RelayTimeout: time.Second,
 	},
 	TxPool:      core.DefaultTxPoolConfig,
 	RPCGasCap:   50000000,
@@ -89,6 +96,7 @@ var Defaults = Config{
 	RPCTxFeeCap: 1, // 1 ether
 
 	BodyDownloadTimeoutSeconds: 30,
+	ShutdownTimeout:            5 * time.Minute,
 }
 
 func init() {
@@ -121,6 +129,13 @@ type Snapshot struct {
 	Enabled             bool
 	Dir                 string
 	ChainSnapshotConfig *snapshothashes.Config
+	MergeInterval       time.Duration // how often small segments are merged into bigger ones, 0 - never
+	HistoryDir          string        // files of history of state, "" - history is read from database only
+
+	// Remote - S3-compatible bucket with cold segments, see snapshotsync.RemoteStorage. "" - local directory only
+	Remote          string
+	RemoteLazy      bool              // segments are fetched on first read instead of start
+	RemoteCacheSize datasize.ByteSize // lazily fetched segments kept in Dir, 0 - unlimited
 }
 
 // Config contains configuration options for ETH protocol.
@@ -141,6 +156,19 @@ type Config struct {
 	Prune     prune.Mode
 	BatchSize datasize.ByteSize // Batch size for execution stage
 
+	StaleForksRetention uint64 // non-canonical blocks older than finalized by more blocks are deleted, 0 - never
+	HeadLag             uint64 // blocks are executed only when they are this deep or marked safe by consensus layer, 0 - follow head
+
+	// Heavy background work (pruning, snapshot merges, catch-up of indices lagging by more than
+	// MaintenanceIndexLag blocks) runs only inside of these windows. Empty - at any time
+	MaintenanceWindows  maintenance.Windows
+	MaintenanceIndexLag uint64
+
+	// Bodies, transactions and receipts of blocks which are more than TieringHotBlocks behind head are moved to
+	// database in TieringColdDir (on slower volume). Empty - not moved
+	TieringColdDir   string
+	TieringHotBlocks uint64
+
 	BadBlockHash common.Hash // hash of the block marked as bad
 
 	Snapshot Snapshot
@@ -154,6 +182,17 @@ type Config struct {
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
 
+	// Consensus layer (beacon node) REST endpoints: finalized blocks which CLQuorum of them agree on must be
+	// ancestors of PoS payloads. CLQuorum 0 - majority
+	CLEndpoints []string
+	CLQuorum    int
+	// Follow head of CLEndpoints and drive execution in-process, without external consensus layer client
+	CLLight bool
+
+	// Labels of sentries (see --sentry.api.addr) to which header and body requests are sent first
+	SentryPreferHeaders string
+	SentryPreferBodies  string
+
 	// Mining options
 	Miner params.MiningConfig
 
@@ -163,6 +202,10 @@ type Config struct {
 	Clique params.ConsensusSnapshotConfig
 	Aura   params.AuRaConfig
 	Parlia params.ParliaConfig
+	Bor    params.BorConfig
+
+	// External is used when chain config names consensus engine registered via consensus.RegisterEngine
+	External params.ExternalConsensusConfig
 
 	// Transaction pool options
 	TxPool core.TxPoolConfig
@@ -178,10 +221,94 @@ type Config struct {
 	RPCTxFeeCap float64 `toml:",omitempty"`
 
 	StateStream                bool
-	BodyDownloadTimeoutSeconds int // TODO change to duration
+	ExecPrefetch               bool   // read state of next block in background during execution
+	SendersRecoverer           string // name of crypto.BatchRecoverer for Senders stage, empty - recover transaction by transaction
+	BodyDownloadTimeoutSeconds int    // TODO change to duration
+
+	// Execution stage executes blocks against this state store besides own PlainState. Set by applications embedding
+	// erigon, or connected to remotestate.Server at StateBackendAddr
+	StateBackend     state.Backend `toml:"-"`
+	StateBackendAddr string
+
+	// ExecWitnessHook receives state accessed by every block executed by Execution stage, to build witnesses of blocks.
+	// Set by applications embedding erigon
+	ExecWitnessHook func(block *types.Block, rec *state.WitnessRecorder) `toml:"-"`
+
+	// Firehose stage streams executed blocks to this sink. Set by applications embedding erigon, or opened by
+	// firehose.OpenSink(FirehoseSink); FirehoseConfirmations - how many blocks the stream stays behind the head
+	Firehose              firehose.Sink `toml:"-"`
+	FirehoseSink          string
+	FirehoseConfirmations uint64
 
 	// SyncLoopThrottle sets a minimum time between staged loop iterations
 	SyncLoopThrottle time.Duration
+
+	// ShutdownTimeout - how long shutdown waits for staged sync to stop at safe checkpoint before aborting the
+	// running stage, 0 - no limit
+	ShutdownTimeout time.Duration
+}
+
+// Copy returns deep copy of c: big integers, slices and maps are not shared with c, so flags applied to the copy
+// don't change c. Every network of --networks builds its config from copy of Defaults.
+func (c *Config) Copy() *Config {
+	cpy := *c
+	cpy.EthDiscoveryURLs = copyStrings(c.EthDiscoveryURLs)
+	cpy.MaintenanceWindows = append(maintenance.Windows(nil), c.MaintenanceWindows...)
+	if c.Whitelist != nil {
+		cpy.Whitelist = make(map[uint64]common.Hash, len(c.Whitelist))
+		for k, v := range c.Whitelist {
+			cpy.Whitelist[k] = v
+		}
+	}
+	cpy.CLEndpoints = copyStrings(c.CLEndpoints)
+
+	cpy.Miner.Notify = copyStrings(c.Miner.Notify)
+	cpy.Miner.ExtraData = common.CopyBytes(c.Miner.ExtraData)
+	cpy.Miner.GasPrice = copyBig(c.Miner.GasPrice)
+	cpy.Miner.Relays = copyStrings(c.Miner.Relays)
+
+	cpy.Bor.Period = copyUint64s(c.Bor.Period)
+	cpy.Bor.BackupMultiplier = copyUint64s(c.Bor.BackupMultiplier)
+	if c.Bor.OverrideStateSyncRecords != nil {
+		cpy.Bor.OverrideStateSyncRecords = make(map[string]int, len(c.Bor.OverrideStateSyncRecords))
+		for k, v := range c.Bor.OverrideStateSyncRecords {
+			cpy.Bor.OverrideStateSyncRecords[k] = v
+		}
+	}
+
+	cpy.TxPool.Locals = append([]common.Address(nil), c.TxPool.Locals...)
+	cpy.TxPool.TracedSenders = copyStrings(c.TxPool.TracedSenders)
+
+	cpy.GPO.Default = copyBig(c.GPO.Default)
+	cpy.GPO.MaxPrice = copyBig(c.GPO.MaxPrice)
+	cpy.GPO.MinPrice = copyBig(c.GPO.MinPrice)
+	cpy.GPO.IgnorePrice = copyBig(c.GPO.IgnorePrice)
+	return &cpy
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
+
+func copyUint64s(m map[string]uint64) map[string]uint64 {
+	if m == nil {
+		return nil
+	}
+	cpy := make(map[string]uint64, len(m))
+	for k, v := range m {
+		cpy[k] = v
+	}
+	return cpy
+}
+
+func copyBig(b *big.Int) *big.Int {
+	if b == nil {
+		return nil
+	}
+	return new(big.Int).Set(b)
 }
 
 func CreateConsensusEngine(chainConfig *params.ChainConfig, logger log.Logger, config interface{}, notify []string, noverify bool, genesisHash common.Hash) consensus.Engine {
@@ -211,12 +338,28 @@ func CreateConsensusEngine(chainConfig *params.ChainConfig, logger log.Logger, c
 		}
 	case *params.ConsensusSnapshotConfig:
 		if chainConfig.Clique != nil {
-			eng = clique.New(chainConfig, consensusCfg, db.OpenDatabase(consensusCfg.DBPath, logger, consensusCfg.InMemory))
+			eng = clique.New(chainConfig, consensusCfg, clique.OpenDatabase(consensusCfg.DBPath, logger, consensusCfg.InMemory))
 		}
 	case *params.ParliaConfig:
 		if chainConfig.Parlia != nil {
 			eng = parlia.New(chainConfig, db.OpenDatabase(consensusCfg.DBPath, logger, consensusCfg.InMemory), genesisHash)
 		}
+	case *params.BorConfig:
+		if chainConfig.Bor != nil {
+			var heimdall bor.IHeimdallClient
+			if !consensusCfg.WithoutHeimdall {
+				heimdall = bor.NewHeimdallClient(consensusCfg.HeimdallURL)
+			}
+			eng = bor.New(chainConfig, bor.OpenDatabase(consensusCfg.DBPath, logger, consensusCfg.InMemory), heimdall)
+		}
+	case *params.ExternalConsensusConfig:
+		if constructor, ok := consensus.LookupEngine(chainConfig.Consensus); ok {
+			var err error
+			eng, err = constructor(chainConfig, consensusCfg, logger)
+			if err != nil {
+				panic(err)
+			}
+		}
 	case *params.AuRaConfig:
 		if chainConfig.Aura != nil {
 			var err error
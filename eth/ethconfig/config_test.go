@@ -0,0 +1,31 @@
+package ethconfig
+
+import (
+	"testing"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopy(t *testing.T) {
+	require := require.New(t)
+	orig := Defaults.Copy()
+	orig.Miner.Relays = []string{"http://relay"}
+	orig.Whitelist = map[uint64]common.Hash{1: {1}}
+	orig.Bor.Period = map[string]uint64{"0": 2}
+
+	cpy := orig.Copy()
+	cpy.Miner.GasPrice.SetUint64(1)
+	cpy.GPO.MaxPrice.SetUint64(1)
+	cpy.Miner.Relays[0] = "http://other"
+	cpy.Whitelist[1] = common.Hash{2}
+	cpy.Bor.Period["0"] = 4
+	cpy.TxPool.Locals = append(cpy.TxPool.Locals, common.Address{1})
+
+	require.Equal(Defaults.Miner.GasPrice, orig.Miner.GasPrice)
+	require.Equal(Defaults.GPO.MaxPrice, orig.GPO.MaxPrice)
+	require.Equal([]string{"http://relay"}, orig.Miner.Relays)
+	require.Equal(common.Hash{1}, orig.Whitelist[1])
+	require.Equal(uint64(2), orig.Bor.Period["0"])
+	require.Empty(orig.TxPool.Locals)
+}
@@ -0,0 +1,146 @@
+package gasprice
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/holiman/uint256"
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus/misc"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+// HotGasShare - contract is "hot" if transactions sent to it used at least this share of gas of the sampled blocks
+const HotGasShare = 0.1
+
+// ContractFees - fees of recent blocks, conditioned on transactions sent to one contract
+type ContractFees struct {
+	OldestBlock uint64
+	Blocks      int
+	NextBaseFee *big.Int
+
+	GasUsed         uint64  // gas used by all transactions of sampled blocks
+	ContractGasUsed uint64  // gas used by transactions sent to the contract
+	ContractTxs     int     // amount of transactions sent to the contract
+	GasShare        float64 // ContractGasUsed / GasUsed
+	Hot             bool    // GasShare >= HotGasShare and there are at least sampleNumber contract transactions
+
+	// gas weighted percentiles of effective priority fees, same as reward of FeeHistory but over all sampled blocks
+	Tips         []*big.Int
+	ContractTips []*big.Int
+	// SuggestedTips - ContractTips of hot contract (if they are higher than Tips), otherwise Tips.
+	// Transactions to hot contract compete with each other, general network tips are not enough for them.
+	SuggestedTips []*big.Int
+	// SuggestedMaxFees - 2 * NextBaseFee + SuggestedTips, enough to survive 6 full blocks in a row
+	SuggestedMaxFees []*big.Int
+}
+
+// ContractFees returns percentiles of priority fees paid in range of blocks ending with lastBlock,
+// and the same percentiles of only transactions sent to the given address (internal calls are not counted).
+func (oracle *Oracle) ContractFees(ctx context.Context, blocks int, unresolvedLastBlock rpc.BlockNumber, to common.Address, percentiles []float64) (*ContractFees, error) {
+	if blocks < 1 {
+		return nil, fmt.Errorf("block count must be positive, got %d", blocks)
+	}
+	if blocks > maxFeeHistory {
+		blocks = maxFeeHistory
+	}
+	if err := checkPercentiles(percentiles); err != nil {
+		return nil, err
+	}
+	_, _, lastBlock, blocks, err := oracle.resolveBlockRange(ctx, unresolvedLastBlock, blocks, oracle.maxBlockHistory)
+	if err != nil {
+		return nil, err
+	}
+	if blocks == 0 {
+		return nil, fmt.Errorf("no blocks available")
+	}
+	chainConfig := oracle.backend.ChainConfig()
+	res := &ContractFees{OldestBlock: lastBlock + 1 - uint64(blocks), Blocks: blocks, NextBaseFee: new(big.Int)}
+	var all, contract sortGasAndReward
+	for blockNum := res.OldestBlock; blockNum <= lastBlock; blockNum++ {
+		if err = libcommon.Stopped(ctx.Done()); err != nil {
+			return nil, err
+		}
+		block, err := oracle.backend.BlockByNumber(ctx, rpc.BlockNumber(blockNum))
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			return nil, fmt.Errorf("block not found: %d", blockNum)
+		}
+		if blockNum == lastBlock && chainConfig.IsLondon(blockNum+1) {
+			res.NextBaseFee = misc.CalcBaseFee(chainConfig, block.Header())
+		}
+		if len(block.Transactions()) == 0 {
+			continue
+		}
+		receipts, err := oracle.backend.GetReceipts(ctx, block.Hash())
+		if err != nil {
+			return nil, err
+		}
+		if len(receipts) != len(block.Transactions()) {
+			return nil, fmt.Errorf("receipts of block %d are not available", blockNum)
+		}
+		baseFee := uint256.NewInt(0)
+		if block.BaseFee() != nil {
+			baseFee.SetFromBig(block.BaseFee())
+		}
+		for i, txn := range block.Transactions() {
+			item := txGasAndReward{gasUsed: receipts[i].GasUsed, reward: txn.GetEffectiveGasTip(baseFee).ToBig()}
+			all = append(all, item)
+			res.GasUsed += item.gasUsed
+			if txn.GetTo() != nil && *txn.GetTo() == to {
+				contract = append(contract, item)
+				res.ContractGasUsed += item.gasUsed
+			}
+		}
+	}
+	res.ContractTxs = len(contract)
+	if res.GasUsed > 0 {
+		res.GasShare = float64(res.ContractGasUsed) / float64(res.GasUsed)
+	}
+	res.Hot = res.GasShare >= HotGasShare && res.ContractTxs >= sampleNumber
+	res.Tips = gasWeightedPercentiles(all, res.GasUsed, percentiles)
+	res.ContractTips = gasWeightedPercentiles(contract, res.ContractGasUsed, percentiles)
+
+	res.SuggestedTips = make([]*big.Int, len(percentiles))
+	res.SuggestedMaxFees = make([]*big.Int, len(percentiles))
+	for i := range percentiles {
+		tip := res.Tips[i]
+		if res.Hot && res.ContractTips[i].Cmp(tip) > 0 {
+			tip = res.ContractTips[i]
+		}
+		if tip.Cmp(oracle.maxPrice) > 0 {
+			tip = oracle.maxPrice
+		}
+		res.SuggestedTips[i] = new(big.Int).Set(tip)
+		res.SuggestedMaxFees[i] = new(big.Int).Add(new(big.Int).Lsh(res.NextBaseFee, 1), tip)
+	}
+	return res, nil
+}
+
+// gasWeightedPercentiles - same selection as processBlock does for one block
+func gasWeightedPercentiles(items sortGasAndReward, totalGasUsed uint64, percentiles []float64) []*big.Int {
+	res := make([]*big.Int, len(percentiles))
+	if len(items) == 0 {
+		for i := range res {
+			res[i] = new(big.Int)
+		}
+		return res
+	}
+	sort.Sort(items)
+	var txIndex int
+	sumGasUsed := items[0].gasUsed
+	for i, p := range percentiles {
+		thresholdGasUsed := uint64(float64(totalGasUsed) * p / 100)
+		for sumGasUsed < thresholdGasUsed && txIndex < len(items)-1 {
+			txIndex++
+			sumGasUsed += items[txIndex].gasUsed
+		}
+		res[i] = items[txIndex].reward
+	}
+	return res
+}
@@ -0,0 +1,74 @@
+package gasprice_test
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/eth/gasprice"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContractFees(t *testing.T) {
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		gspec  = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{addr: {Balance: big.NewInt(math.MaxInt64)}},
+		}
+		signer = types.LatestSigner(gspec.Config)
+		hot    = common.HexToAddress("0x11")
+		cold   = common.HexToAddress("0x22")
+		idle   = common.HexToAddress("0x33")
+	)
+	m := stages.MockWithGenesis(t, gspec, key)
+	// every block: 1 expensive transaction to hot contract and 2 cheap transactions to cold one
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 10, func(i int, b *core.BlockGen) {
+		for _, to := range []common.Address{hot, cold, cold} {
+			gasPrice := 2 * params.GWei
+			if to == hot {
+				gasPrice = 100 * params.GWei
+			}
+			tx, err := types.SignTx(types.NewTransaction(b.TxNonce(addr), to, uint256.NewInt(1), 21000, uint256.NewInt(uint64(gasPrice)), nil), *signer, key)
+			require.NoError(t, err)
+			b.AddTx(tx)
+		}
+	}, false)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	oracle := gasprice.NewOracle(&testBackend{db: m.DB, cfg: params.TestChainConfig}, ethconfig.Defaults.GPO)
+	percentiles := []float64{10, 50, 90}
+
+	fees, err := oracle.ContractFees(context.Background(), 5, rpc.LatestBlockNumber, hot, percentiles)
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), fees.OldestBlock)
+	require.Equal(t, 5, fees.Blocks)
+	require.Equal(t, 5, fees.ContractTxs)
+	require.Equal(t, uint64(15*21000), fees.GasUsed)
+	require.Equal(t, uint64(5*21000), fees.ContractGasUsed)
+	require.True(t, fees.Hot)
+	require.Equal(t, 1, fees.ContractTips[1].Cmp(fees.Tips[1]))
+	require.Equal(t, fees.ContractTips[1], fees.SuggestedTips[1])
+	require.Equal(t, new(big.Int).Add(new(big.Int).Mul(fees.NextBaseFee, big.NewInt(2)), fees.SuggestedTips[1]), fees.SuggestedMaxFees[1])
+
+	fees, err = oracle.ContractFees(context.Background(), 5, rpc.LatestBlockNumber, idle, percentiles)
+	require.NoError(t, err)
+	require.False(t, fees.Hot)
+	require.Equal(t, 0, fees.ContractTxs)
+	require.Equal(t, fees.Tips, fees.SuggestedTips)
+
+	_, err = oracle.ContractFees(context.Background(), 5, rpc.LatestBlockNumber, hot, []float64{50, 10})
+	require.ErrorIs(t, err, gasprice.ErrInvalidPercentile)
+}
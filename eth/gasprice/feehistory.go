@@ -131,6 +131,19 @@ func (oracle *Oracle) processBlock(bf *blockFees, percentiles []float64) {
 	}
 }
 
+// checkPercentiles - percentiles must be in [0, 100] and in ascending order
+func checkPercentiles(percentiles []float64) error {
+	for i, p := range percentiles {
+		if p < 0 || p > 100 {
+			return fmt.Errorf("%w: %f", ErrInvalidPercentile, p)
+		}
+		if i > 0 && p < percentiles[i-1] {
+			return fmt.Errorf("%w: #%d:%f > #%d:%f", ErrInvalidPercentile, i-1, percentiles[i-1], i, p)
+		}
+	}
+	return nil
+}
+
 // resolveBlockRange resolves the specified block range to absolute block numbers while also
 // enforcing backend specific limitations. The pending block and corresponding receipts are
 // also returned if requested and available.
@@ -208,13 +221,8 @@ func (oracle *Oracle) FeeHistory(ctx context.Context, blocks int, unresolvedLast
 		log.Warn("Sanitizing fee history length", "requested", blocks, "truncated", maxFeeHistory)
 		blocks = maxFeeHistory
 	}
-	for i, p := range rewardPercentiles {
-		if p < 0 || p > 100 {
-			return common.Big0, nil, nil, nil, fmt.Errorf("%w: %f", ErrInvalidPercentile, p)
-		}
-		if i > 0 && p < rewardPercentiles[i-1] {
-			return common.Big0, nil, nil, nil, fmt.Errorf("%w: #%d:%f > #%d:%f", ErrInvalidPercentile, i-1, rewardPercentiles[i-1], i, p)
-		}
+	if err := checkPercentiles(rewardPercentiles); err != nil {
+		return common.Big0, nil, nil, nil, err
 	}
 	// Only process blocks if reward percentiles were requested
 	maxHistory := oracle.maxHeaderHistory
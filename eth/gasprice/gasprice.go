@@ -33,19 +33,23 @@ import (
 
 const sampleNumber = 3 // Number of transactions sampled in a block
 
+// lookbackFactor - when recent blocks have few transactions, oracle looks back at most Blocks*lookbackFactor blocks
+const lookbackFactor = sampleNumber
+
 var (
 	DefaultMaxPrice    = big.NewInt(500 * params.GWei)
 	DefaultIgnorePrice = big.NewInt(2 * params.Wei)
 )
 
 type Config struct {
-	Blocks           int
+	Blocks           int // tips of sampleNumber*Blocks transactions are sampled from recent blocks
 	Percentile       int
 	MaxHeaderHistory int
 	MaxBlockHistory  int
-	Default          *big.Int `toml:",omitempty"`
+	Default          *big.Int `toml:",omitempty"` // suggested while there are no samples
 	MaxPrice         *big.Int `toml:",omitempty"`
-	IgnorePrice      *big.Int `toml:",omitempty"`
+	MinPrice         *big.Int `toml:",omitempty"` // suggested tip is never lower, nil - no lower bound
+	IgnorePrice      *big.Int `toml:",omitempty"` // transactions with lower tips aren't sampled
 }
 
 // OracleBackend includes all necessary background APIs for oracle.
@@ -62,11 +66,11 @@ type OracleBackend interface {
 // blocks. Suitable for both light and full clients.
 type Oracle struct {
 	backend     OracleBackend
-	lastHead    common.Hash
-	lastPrice   *big.Int
+	cache       *Cache
+	defaultTip  *big.Int
 	maxPrice    *big.Int
+	minPrice    *big.Int
 	ignorePrice *big.Int
-	cacheLock   sync.RWMutex
 
 	checkBlocks                       int
 	percentile                        int
@@ -76,6 +80,12 @@ type Oracle struct {
 // NewOracle returns a new gasprice oracle which can recommend suitable
 // gasprice for newly created transaction.
 func NewOracle(backend OracleBackend, params Config) *Oracle {
+	return NewOracleWithCache(backend, params, NewCache())
+}
+
+// NewOracleWithCache - oracle which takes samples of blocks from cache and adds there samples of new blocks. Oracles
+// which share cache must have the same config.
+func NewOracleWithCache(backend OracleBackend, params Config, cache *Cache) *Oracle {
 	blocks := params.Blocks
 	if blocks < 1 {
 		blocks = 1
@@ -95,15 +105,26 @@ func NewOracle(backend OracleBackend, params Config) *Oracle {
 		maxPrice = DefaultMaxPrice
 		log.Warn("Sanitizing invalid gasprice oracle price cap", "provided", params.MaxPrice, "updated", maxPrice)
 	}
+	minPrice := params.MinPrice
+	if minPrice != nil && (minPrice.Sign() < 0 || minPrice.Cmp(maxPrice) > 0) {
+		minPrice = nil
+		log.Warn("Sanitizing invalid gasprice oracle price floor", "provided", params.MinPrice, "updated", minPrice)
+	}
 	ignorePrice := params.IgnorePrice
 	if ignorePrice == nil || ignorePrice.Int64() < 0 {
 		ignorePrice = DefaultIgnorePrice
 		log.Warn("Sanitizing invalid gasprice oracle ignore price", "provided", params.IgnorePrice, "updated", ignorePrice)
 	}
+	defaultTip := params.Default
+	if defaultTip == nil {
+		defaultTip = new(big.Int)
+	}
 	return &Oracle{
 		backend:          backend,
-		lastPrice:        params.Default,
+		cache:            cache,
+		defaultTip:       defaultTip,
 		maxPrice:         maxPrice,
+		minPrice:         minPrice,
 		ignorePrice:      ignorePrice,
 		checkBlocks:      blocks,
 		percentile:       percent,
@@ -117,34 +138,36 @@ func NewOracle(backend OracleBackend, params Config) *Oracle {
 // NODE: if caller wants legacy tx SuggestedPrice, we need to add
 // baseFee to the returned bigInt
 func (gpo *Oracle) SuggestTipCap(ctx context.Context) (*big.Int, error) {
-	head, _ := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	head, err := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if head == nil {
+		return nil, errors.New("latest header not found")
+	}
 	headHash := head.Hash()
 
+	gpo.cache.lock.Lock()
+	defer gpo.cache.lock.Unlock()
 	// If the latest gasprice is still available, return it.
-	gpo.cacheLock.RLock()
-	lastHead, lastPrice := gpo.lastHead, gpo.lastPrice
-	gpo.cacheLock.RUnlock()
-	if headHash == lastHead {
-		return lastPrice, nil
+	if headHash == gpo.cache.lastHead && gpo.cache.lastPrice != nil {
+		return new(big.Int).Set(gpo.cache.lastPrice), nil
 	}
 
-	// Try checking the cache again, maybe the last fetch fetched what we need
-	gpo.cacheLock.RLock()
-	lastHead, lastPrice = gpo.lastHead, gpo.lastPrice
-	gpo.cacheLock.RUnlock()
-	if headHash == lastHead {
-		return lastPrice, nil
-	}
 	number := head.Number.Uint64()
+	lookback := uint64(gpo.checkBlocks * lookbackFactor)
+	gpo.cache.evict(number, lookback)
 	txPrices := make(sortingHeap, 0, sampleNumber*gpo.checkBlocks)
-	for txPrices.Len() < sampleNumber*gpo.checkBlocks && number > 0 {
-		err := gpo.getBlockPrices(ctx, number, sampleNumber, gpo.ignorePrice, &txPrices)
+	for n := number; txPrices.Len() < sampleNumber*gpo.checkBlocks && n > 0 && n+lookback > number; n-- {
+		tips, err := gpo.blockSample(ctx, n)
 		if err != nil {
-			return lastPrice, err
+			return nil, err
 		}
-		number--
+		txPrices = append(txPrices, tips...)
 	}
-	price := lastPrice
+	heap.Init(&txPrices)
+
+	price := gpo.defaultTip
 	if txPrices.Len() > 0 {
 		// Item with this position needs to be extracted from the sorting heap
 		// so we pop all the items before it
@@ -152,19 +175,66 @@ func (gpo *Oracle) SuggestTipCap(ctx context.Context) (*big.Int, error) {
 		for i := 0; i < percentilePosition; i++ {
 			heap.Pop(&txPrices)
 		}
-	}
-	if txPrices.Len() > 0 {
 		// Don't need to pop it, just take from the top of the heap
 		price = txPrices[0].ToBig()
 	}
 	if price.Cmp(gpo.maxPrice) > 0 {
-		price = new(big.Int).Set(gpo.maxPrice)
+		price = gpo.maxPrice
+	}
+	if gpo.minPrice != nil && price.Cmp(gpo.minPrice) < 0 {
+		price = gpo.minPrice
+	}
+	gpo.cache.lastHead = headHash
+	gpo.cache.lastPrice = new(big.Int).Set(price)
+	return new(big.Int).Set(price), nil
+}
+
+// blockSample - lowest tips of canonical block, from cache if block was already sampled
+func (gpo *Oracle) blockSample(ctx context.Context, number uint64) ([]*uint256.Int, error) {
+	header, err := gpo.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, nil
+	}
+	hash := header.Hash()
+	if sample, ok := gpo.cache.blocks[number]; ok && sample.hash == hash {
+		return sample.tips, nil
+	}
+	tips := make(sortingHeap, 0, sampleNumber)
+	if err := gpo.getBlockPrices(ctx, number, sampleNumber, gpo.ignorePrice, &tips); err != nil {
+		return nil, err
+	}
+	gpo.cache.blocks[number] = blockSample{hash: hash, tips: tips}
+	return tips, nil
+}
+
+// Cache - samples of recent blocks and the last suggestion, to be shared by oracles of different requests: when head
+// moves, only new blocks are read. Samples of blocks which are not canonical any more are replaced.
+type Cache struct {
+	lock      sync.Mutex
+	blocks    map[uint64]blockSample
+	lastHead  common.Hash
+	lastPrice *big.Int
+}
+
+type blockSample struct {
+	hash common.Hash
+	tips []*uint256.Int
+}
+
+func NewCache() *Cache {
+	return &Cache{blocks: map[uint64]blockSample{}}
+}
+
+// evict - drops samples which oracle won't look at with given head
+func (c *Cache) evict(head, lookback uint64) {
+	for number := range c.blocks {
+		if number > head || number+lookback <= head {
+			delete(c.blocks, number)
+		}
 	}
-	gpo.cacheLock.Lock()
-	gpo.lastHead = headHash
-	gpo.lastPrice = price
-	gpo.cacheLock.Unlock()
-	return price, nil
 }
 
 type transactionsByGasPrice struct {
@@ -33,6 +33,7 @@ import (
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
 )
 
 type testBackend struct {
@@ -156,3 +157,47 @@ func TestSuggestPrice(t *testing.T) {
 		t.Fatalf("Gas price mismatch, want %d, got %d", expect, got)
 	}
 }
+
+type countingBackend struct {
+	*testBackend
+	blockReads int
+}
+
+func (b *countingBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	b.blockReads++
+	return b.testBackend.BlockByNumber(ctx, number)
+}
+
+func TestSuggestPriceCache(t *testing.T) {
+	config := gasprice.Config{
+		Blocks:     2,
+		Percentile: 60,
+		Default:    big.NewInt(params.GWei),
+	}
+	backend := &countingBackend{testBackend: newTestBackend(t)}
+	cache := gasprice.NewCache()
+
+	got, err := gasprice.NewOracleWithCache(backend, config, cache).SuggestTipCap(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(params.GWei*30), got)
+	require.Equal(t, 6, backend.blockReads)
+
+	// suggestion of same head is served from cache and can't be spoiled by caller
+	got.Add(got, big.NewInt(params.GWei))
+	got, err = gasprice.NewOracleWithCache(backend, config, cache).SuggestTipCap(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(params.GWei*30), got)
+	require.Equal(t, 6, backend.blockReads)
+
+	// suggestion is clamped by max and min price
+	config.MaxPrice = big.NewInt(params.GWei * 20)
+	got, err = gasprice.NewOracle(backend, config).SuggestTipCap(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(params.GWei*20), got)
+
+	config.MaxPrice = nil
+	config.MinPrice = big.NewInt(params.GWei * 40)
+	got, err = gasprice.NewOracle(backend, config).SuggestTipCap(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(params.GWei*40), got)
+}
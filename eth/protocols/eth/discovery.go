@@ -55,6 +55,20 @@ func CurrentENREntry(chainConfig *params.ChainConfig, genesisHash common.Hash, h
 	}
 }
 
+// NewNodeFilter returns filter of discovered nodes for dialing: nodes announcing `eth`
+// with fork ID accepted by forkFilter. Records of discv4 nodes are often not fetched
+// (sequence number 0), such nodes are accepted and checked in handshake.
+func NewNodeFilter(forkFilter func() forkid.Filter) func(*enode.Node) bool {
+	return func(n *enode.Node) bool {
+		var entry enrEntry
+		if err := n.Load(&entry); err != nil {
+			return n.Seq() == 0
+		}
+		filter := forkFilter()
+		return filter == nil || filter(entry.ForkID) == nil
+	}
+}
+
 // CurrentENREntryFromForks constructs an `eth` ENR entry based on the current state of the chain.
 func CurrentENREntryFromForks(forks []uint64, genesisHash common.Hash, headHeight uint64) *enrEntry {
 	return &enrEntry{
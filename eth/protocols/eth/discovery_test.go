@@ -0,0 +1,41 @@
+package eth_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ledgerwatch/erigon/core/forkid"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/eth/protocols/eth"
+	"github.com/ledgerwatch/erigon/p2p/enode"
+	"github.com/ledgerwatch/erigon/p2p/enr"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeFilter(t *testing.T) {
+	mainnet := forkid.NewFilterFromForks(forkid.GatherForks(params.MainnetChainConfig), params.MainnetGenesisHash, 14_000_000)
+	filter := eth.NewNodeFilter(func() forkid.Filter { return mainnet })
+
+	node := func(entries ...enr.Entry) *enode.Node {
+		db, err := enode.OpenDB("")
+		require.NoError(t, err)
+		defer db.Close()
+		key, err := crypto.GenerateKey()
+		require.NoError(t, err)
+		ln := enode.NewLocalNode(db, key)
+		ln.SetStaticIP(net.IP{10, 0, 0, 1})
+		for _, e := range entries {
+			ln.Set(e)
+		}
+		return ln.Node()
+	}
+
+	require.True(t, filter(node(eth.CurrentENREntry(params.MainnetChainConfig, params.MainnetGenesisHash, 14_000_000))))
+	require.False(t, filter(node(eth.CurrentENREntry(params.GoerliChainConfig, params.GoerliGenesisHash, 6_000_000))))
+	require.False(t, filter(node())) // record without `eth`, e.g. consensus layer node
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	require.True(t, filter(enode.NewV4(&key.PublicKey, net.IP{10, 0, 0, 2}, 30303, 30303))) // discv4 node, record not fetched
+}
@@ -99,6 +99,15 @@ type NodeInfo struct {
 	Head       common.Hash         `json:"head"`       // Hex hash of the host's best owned block
 }
 
+// PeerInfo represents a short summary of the `eth` sub-protocol metadata known
+// about a connected peer.
+type PeerInfo struct {
+	Version    uint        `json:"version"`    // Ethereum protocol version negotiated
+	Difficulty *big.Int    `json:"difficulty"` // Total difficulty of the peer's blockchain, as of handshake
+	Head       common.Hash `json:"head"`       // Hash of the peer's best block, as of handshake
+	Number     uint64      `json:"number"`     // Highest block the peer announced
+}
+
 // ReadNodeInfo retrieves some `eth` protocol metadata about the running host node.
 func ReadNodeInfo(getter kv.Getter, config *params.ChainConfig, genesisHash common.Hash, network uint64) *NodeInfo {
 	head := rawdb.ReadCurrentHeader(getter)
@@ -1,21 +1,49 @@
 package stagedsync
 
 import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 )
 
-var syncMetrics = map[stages.SyncStage]*metrics.Counter{
-	stages.Headers:   metrics.GetOrCreateCounter(`sync{stage="headers"}`),
-	stages.Execution: metrics.GetOrCreateCounter(`sync{stage="execution"}`),
-	stages.Finish:    metrics.GetOrCreateCounter(`sync{stage="finish"}`),
+// syncMetrics - chain -> sync{chain,stage} of all stages, see metrics/exp.Registry. One process can run nodes of
+// several chains (see --networks), chain label keeps their metrics apart.
+var syncMetrics sync.Map // string -> map[stages.SyncStage]*metrics.Counter
+
+func stageMetrics(chain string) map[stages.SyncStage]*metrics.Counter {
+	if m, ok := syncMetrics.Load(chain); ok {
+		return m.(map[stages.SyncStage]*metrics.Counter)
+	}
+	m := make(map[stages.SyncStage]*metrics.Counter, len(stages.AllStages))
+	for _, id := range stages.AllStages {
+		m[id] = metrics.GetOrCreateCounter(fmt.Sprintf(`sync{chain=%q,stage=%q}`, chain, stageLabel(id)))
+	}
+	actual, _ := syncMetrics.LoadOrStore(chain, m)
+	return actual.(map[stages.SyncStage]*metrics.Counter)
+}
+
+// stageLabel - value of stage label: lowercase stage id
+func stageLabel(id stages.SyncStage) string { return strings.ToLower(string(id)) }
+
+// updateStageDuration - sync_stage_duration_seconds{chain,stage,action}, action is forward, unwind or prune
+func updateStageDuration(chain string, id stages.SyncStage, action string, start time.Time) {
+	metrics.GetOrCreateSummary(fmt.Sprintf(`sync_stage_duration_seconds{chain=%q,stage=%q,action=%q}`, chain, stageLabel(id), action)).UpdateDuration(start)
+}
+
+// prunedRows - sync_pruned_rows_total{chain,table}
+func prunedRows(chain, table string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`sync_pruned_rows_total{chain=%q,table=%q}`, chain, table))
 }
 
 // UpdateMetrics - need update metrics manually because current "metrics" package doesn't support labels
 // need to fix it in future
-func UpdateMetrics(tx kv.Tx) error {
-	for id, m := range syncMetrics {
+func UpdateMetrics(chain string, tx kv.Tx) error {
+	for id, m := range stageMetrics(chain) {
 		progress, err := stages.GetStageProgress(tx, id)
 		if err != nil {
 			return err
@@ -0,0 +1,56 @@
+package stagedsync
+
+import (
+	"github.com/ledgerwatch/erigon-lib/common/length"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/changeset"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+)
+
+// writeCodeHistory - called by Execution stage for every block
+func writeCodeHistory(tx kv.RwTx, blockNum uint64, codeRecorder *state.CodeRecorder) error {
+	if codeRecorder.Len() == 0 {
+		return nil
+	}
+	c, err := tx.RwCursorDupSort(rawdb.CodeHistory)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	v := make([]byte, 8+length.Incarnation+length.Hash)
+	copy(v, dbutils.EncodeBlockNumber(blockNum))
+	return codeRecorder.ForEach(func(address common.Address, change state.CodeChange) error {
+		copy(v[8:], dbutils.EncodeBlockNumber(change.Incarnation))
+		copy(v[8+length.Incarnation:], change.CodeHash[:])
+		return c.Put(address[:], v)
+	})
+}
+
+// truncateCodeHistory - deletes code changes of blocks from..to. Every contract which changed code is in the
+// accounts changeset of the block, so changesets must not be truncated yet
+func truncateCodeHistory(tx kv.RwTx, from, to uint64) error {
+	addrs, err := changeset.GetModifiedAccounts(tx, from, to+1)
+	if err != nil {
+		return err
+	}
+	c, err := tx.RwCursorDupSort(rawdb.CodeHistory)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	fromBytes := dbutils.EncodeBlockNumber(from)
+	for _, addr := range addrs {
+		for v, err := c.SeekBothRange(addr[:], fromBytes); v != nil; _, v, err = c.NextDup() {
+			if err != nil {
+				return err
+			}
+			if err = c.DeleteCurrent(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/ledgerwatch/erigon/ethdb/prune"
 )
 
-func DefaultStages(ctx context.Context, sm prune.Mode, headers HeadersCfg, blockHashCfg BlockHashesCfg, bodies BodiesCfg, issuance IssuanceCfg, senders SendersCfg, exec ExecuteBlockCfg, trans TranspileCfg, hashState HashStateCfg, trieCfg TrieCfg, history HistoryCfg, logIndex LogIndexCfg, callTraces CallTracesCfg, txLookup TxLookupCfg, finish FinishCfg, test bool) []*Stage {
+func DefaultStages(ctx context.Context, sm prune.Mode, headers HeadersCfg, blockHashCfg BlockHashesCfg, borHeimdallCfg BorHeimdallCfg, bodies BodiesCfg, issuance IssuanceCfg, senders SendersCfg, exec ExecuteBlockCfg, trans TranspileCfg, stateAccess StateAccessCfg, hashState HashStateCfg, trieCfg TrieCfg, history HistoryCfg, logIndex LogIndexCfg, callTraces CallTracesCfg, stateDiffs StateDiffsCfg, appearances AddressAppearancesCfg, txLookup TxLookupCfg, firehoseCfg FirehoseCfg, finish FinishCfg, test bool) []*Stage {
 	return []*Stage{
 		{
 			ID:          stages.Headers,
@@ -39,6 +39,18 @@ func DefaultStages(ctx context.Context, sm prune.Mode, headers HeadersCfg, block
 				return PruneBlockHashStage(p, tx, blockHashCfg, ctx)
 			},
 		},
+		{
+			ID:                  stages.BorHeimdall,
+			Description:         "Download Heimdall spans and state sync events",
+			Disabled:            !borHeimdallCfg.enabled(),
+			DisabledDescription: "Only for Bor chains",
+			Forward: func(firstCycle bool, badBlockUnwind bool, s *StageState, u Unwinder, tx kv.RwTx) error {
+				return SpawnBorHeimdallStage(s, tx, borHeimdallCfg, ctx)
+			},
+			Unwind: func(firstCycle bool, u *UnwindState, s *StageState, tx kv.RwTx) error {
+				return UnwindBorHeimdallStage(u, s, tx, borHeimdallCfg, ctx)
+			},
+		},
 		{
 			ID:          stages.Bodies,
 			Description: "Download block bodies",
@@ -93,6 +105,21 @@ func DefaultStages(ctx context.Context, sm prune.Mode, headers HeadersCfg, block
 				return PruneTranspileStage(p, tx, trans, firstCycle, ctx)
 			},
 		},
+		{
+			ID:                  stages.StateAccess,
+			Description:         "Track last access block of accounts and storage slots",
+			Disabled:            !sm.Experiments.StateAccess,
+			DisabledDescription: "Enable by adding `stateaccess` to --experiments",
+			Forward: func(firstCycle bool, badBlockUnwind bool, s *StageState, u Unwinder, tx kv.RwTx) error {
+				return SpawnStateAccessStage(s, tx, stateAccess, ctx)
+			},
+			Unwind: func(firstCycle bool, u *UnwindState, s *StageState, tx kv.RwTx) error {
+				return UnwindStateAccessStage(u, s, tx, stateAccess, ctx)
+			},
+			Prune: func(firstCycle bool, p *PruneState, tx kv.RwTx) error {
+				return PruneStateAccessStage(p, tx, stateAccess, ctx)
+			},
+		},
 		{
 			ID:          stages.HashState,
 			Description: "Hash the key in the state",
@@ -124,6 +151,7 @@ func DefaultStages(ctx context.Context, sm prune.Mode, headers HeadersCfg, block
 			ID:                  stages.CallTraces,
 			Description:         "Generate call traces index",
 			DisabledDescription: "Work In Progress",
+			Deferrable:          true,
 			Forward: func(firstCycle bool, badBlockUnwind bool, s *StageState, u Unwinder, tx kv.RwTx) error {
 				return SpawnCallTraces(s, tx, callTraces, ctx)
 			},
@@ -137,6 +165,7 @@ func DefaultStages(ctx context.Context, sm prune.Mode, headers HeadersCfg, block
 		{
 			ID:          stages.AccountHistoryIndex,
 			Description: "Generate account history index",
+			Deferrable:  true,
 			Forward: func(firstCycle bool, badBlockUnwind bool, s *StageState, u Unwinder, tx kv.RwTx) error {
 				return SpawnAccountHistoryIndex(s, tx, history, ctx)
 			},
@@ -150,6 +179,7 @@ func DefaultStages(ctx context.Context, sm prune.Mode, headers HeadersCfg, block
 		{
 			ID:          stages.StorageHistoryIndex,
 			Description: "Generate storage history index",
+			Deferrable:  true,
 			Forward: func(firstCycle bool, badBlockUnwind bool, s *StageState, u Unwinder, tx kv.RwTx) error {
 				return SpawnStorageHistoryIndex(s, tx, history, ctx)
 			},
@@ -160,9 +190,25 @@ func DefaultStages(ctx context.Context, sm prune.Mode, headers HeadersCfg, block
 				return PruneStorageHistoryIndex(p, tx, history, ctx)
 			},
 		},
+		{
+			ID:                  stages.StateDiffs,
+			Description:         "Record state diffs of transactions",
+			Disabled:            !sm.Experiments.StateDiffs,
+			DisabledDescription: "Enable by adding `statediffs` to --experiments",
+			Forward: func(firstCycle bool, badBlockUnwind bool, s *StageState, u Unwinder, tx kv.RwTx) error {
+				return SpawnStateDiffsStage(s, tx, stateDiffs, ctx)
+			},
+			Unwind: func(firstCycle bool, u *UnwindState, s *StageState, tx kv.RwTx) error {
+				return UnwindStateDiffsStage(u, s, tx, stateDiffs, ctx)
+			},
+			Prune: func(firstCycle bool, p *PruneState, tx kv.RwTx) error {
+				return PruneStateDiffsStage(p, tx, stateDiffs, ctx)
+			},
+		},
 		{
 			ID:          stages.LogIndex,
 			Description: "Generate receipt logs index",
+			Deferrable:  true,
 			Forward: func(firstCycle bool, badBlockUnwind bool, s *StageState, u Unwinder, tx kv.RwTx) error {
 				return SpawnLogIndex(s, tx, logIndex, ctx)
 			},
@@ -173,9 +219,25 @@ func DefaultStages(ctx context.Context, sm prune.Mode, headers HeadersCfg, block
 				return PruneLogIndex(p, tx, logIndex, ctx)
 			},
 		},
+		{
+			ID:                  stages.AddressAppearances,
+			Description:         "Generate address appearances index",
+			Disabled:            !sm.Experiments.Appearances,
+			DisabledDescription: "Enable by adding `appearances` to --experiments",
+			Forward: func(firstCycle bool, badBlockUnwind bool, s *StageState, u Unwinder, tx kv.RwTx) error {
+				return SpawnAddressAppearancesStage(s, tx, appearances, ctx)
+			},
+			Unwind: func(firstCycle bool, u *UnwindState, s *StageState, tx kv.RwTx) error {
+				return UnwindAddressAppearancesStage(u, s, tx, appearances, ctx)
+			},
+			Prune: func(firstCycle bool, p *PruneState, tx kv.RwTx) error {
+				return PruneAddressAppearancesStage(p, tx, appearances, ctx)
+			},
+		},
 		{
 			ID:          stages.TxLookup,
 			Description: "Generate tx lookup index",
+			Deferrable:  true,
 			Forward: func(firstCycle bool, badBlockUnwind bool, s *StageState, u Unwinder, tx kv.RwTx) error {
 				return SpawnTxLookup(s, tx, txLookup, ctx)
 			},
@@ -186,6 +248,18 @@ func DefaultStages(ctx context.Context, sm prune.Mode, headers HeadersCfg, block
 				return PruneTxLookup(p, tx, txLookup, ctx)
 			},
 		},
+		{
+			ID:                  stages.Firehose,
+			Description:         "Stream executed blocks to external sink",
+			Disabled:            !firehoseCfg.enabled(),
+			DisabledDescription: "Enable by --firehose.sink",
+			Forward: func(firstCycle bool, badBlockUnwind bool, s *StageState, u Unwinder, tx kv.RwTx) error {
+				return SpawnFirehoseStage(s, tx, firehoseCfg, ctx)
+			},
+			Unwind: func(firstCycle bool, u *UnwindState, s *StageState, tx kv.RwTx) error {
+				return UnwindFirehoseStage(u, s, tx, firehoseCfg, ctx)
+			},
+		},
 		{
 			ID:          stages.Issuance,
 			Description: "Issuance computation",
@@ -218,19 +292,24 @@ func DefaultStages(ctx context.Context, sm prune.Mode, headers HeadersCfg, block
 var DefaultForwardOrder = UnwindOrder{
 	stages.Headers,
 	stages.BlockHashes,
+	stages.BorHeimdall,
 	stages.Bodies,
 
 	// Stages below don't use Internet
 	stages.Senders,
 	stages.Execution,
 	stages.Translation,
+	stages.StateAccess,
 	stages.HashState,
 	stages.IntermediateHashes,
 	stages.CallTraces,
 	stages.AccountHistoryIndex,
 	stages.StorageHistoryIndex,
+	stages.StateDiffs,
 	stages.LogIndex,
+	stages.AddressAppearances,
 	stages.TxLookup,
+	stages.Firehose,
 	stages.Finish,
 }
 
@@ -243,8 +322,11 @@ type PruneOrder []stages.SyncStage
 
 var DefaultUnwindOrder = UnwindOrder{
 	stages.Finish,
+	stages.Firehose,
 	stages.TxLookup,
+	stages.AddressAppearances,
 	stages.LogIndex,
+	stages.StateDiffs,
 	stages.StorageHistoryIndex,
 	stages.AccountHistoryIndex,
 	stages.CallTraces,
@@ -253,19 +335,24 @@ var DefaultUnwindOrder = UnwindOrder{
 	stages.HashState,
 	stages.IntermediateHashes,
 
+	stages.StateAccess,
 	stages.Translation,
 	stages.Execution,
 	stages.Senders,
 
 	stages.Bodies,
+	stages.BorHeimdall,
 	stages.BlockHashes,
 	stages.Headers,
 }
 
 var DefaultPruneOrder = PruneOrder{
 	stages.Finish,
+	stages.Firehose,
 	stages.TxLookup,
+	stages.AddressAppearances,
 	stages.LogIndex,
+	stages.StateDiffs,
 	stages.StorageHistoryIndex,
 	stages.AccountHistoryIndex,
 	stages.CallTraces,
@@ -274,11 +361,13 @@ var DefaultPruneOrder = PruneOrder{
 	stages.HashState,
 	stages.IntermediateHashes,
 
+	stages.StateAccess,
 	stages.Translation,
 	stages.Execution,
 	stages.Senders,
 
 	stages.Bodies,
+	stages.BorHeimdall,
 	stages.BlockHashes,
 	stages.Headers,
 }
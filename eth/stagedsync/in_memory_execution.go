@@ -0,0 +1,154 @@
+package stagedsync
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/interfaces"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb/olddb"
+	"github.com/ledgerwatch/erigon/params"
+)
+
+// InMemoryExecutor - executes blocks on top of the head of local chain without writing to db: changes go to
+// in-memory overlay of read transaction (see olddb.NewMemoryBatch). It allows to check blocks built by others
+// (e.g. payloads of relays) before they are signed by this node.
+type InMemoryExecutor struct {
+	db          kv.RoDB
+	chainConfig *params.ChainConfig
+	engine      consensus.Engine
+	blockReader interfaces.FullBlockReader
+	tmpDir      string
+}
+
+func NewInMemoryExecutor(db kv.RoDB, chainConfig *params.ChainConfig, engine consensus.Engine, blockReader interfaces.FullBlockReader, tmpDir string) *InMemoryExecutor {
+	return &InMemoryExecutor{db: db, chainConfig: chainConfig, engine: engine, blockReader: blockReader, tmpDir: tmpDir}
+}
+
+// ExecuteBlock - executes block, whose parent must be the head of executed chain, and checks receipts root, bloom,
+// gas used and state root against its header. Returns balance increase of block's coinbase (fee recipient).
+func (e *InMemoryExecutor) ExecuteBlock(ctx context.Context, block *types.Block) (*big.Int, error) {
+	tx, err := e.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	batch := olddb.NewMemoryBatch(tx)
+	defer batch.Rollback()
+
+	number := block.NumberU64()
+	if err = checkParentIsHead(batch, block.ParentHash(), number); err != nil {
+		return nil, err
+	}
+	before, err := balanceOf(batch, block.Coinbase())
+	if err != nil {
+		return nil, err
+	}
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		h, _ := e.blockReader.Header(ctx, batch, hash, number)
+		return h
+	}
+	contractHasTEVM := func(common.Hash) (bool, error) { return false, nil }
+	stateWriter := state.NewPlainStateWriter(batch, batch, number)
+	chain := chainReader{config: e.chainConfig, tx: batch, blockReader: e.blockReader}
+	if _, err = core.ExecuteBlockEphemerally(e.chainConfig, &vm.Config{}, getHeader, e.engine, block, state.NewPlainStateReader(batch), stateWriter, epochReader{tx: batch}, chain, contractHasTEVM); err != nil {
+		return nil, err
+	}
+	root, err := StateRootOfNextBlock("InMemoryExecution", batch, number, e.tmpDir, ctx.Done())
+	if err != nil {
+		return nil, err
+	}
+	if root != block.Root() {
+		return nil, fmt.Errorf("wrong state root of block %d: %x, expected (from header): %x", number, root, block.Root())
+	}
+	after, err := balanceOf(batch, block.Coinbase())
+	if err != nil {
+		return nil, err
+	}
+	return feeRecipientValue(before, after), nil
+}
+
+// TransactionsValue - executes transactions in block with given header on top of the head of executed chain,
+// without checks of header fields calculated from execution. Returns balance increase of header's coinbase.
+func (e *InMemoryExecutor) TransactionsValue(ctx context.Context, header *types.Header, txs types.Transactions) (*big.Int, error) {
+	tx, err := e.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err = checkParentIsHead(tx, header.ParentHash, header.Number.Uint64()); err != nil {
+		return nil, err
+	}
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		h, _ := e.blockReader.Header(ctx, tx, hash, number)
+		return h
+	}
+	contractHasTEVM := func(common.Hash) (bool, error) { return false, nil }
+	ibs := state.New(state.NewPlainStateReader(tx))
+	noop := state.NewNoopWriter()
+	gp := new(core.GasPool).AddGas(header.GasLimit)
+	var gasUsed uint64
+
+	before := ibs.GetBalance(header.Coinbase).ToBig()
+	for i, txn := range txs {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		ibs.Prepare(txn.Hash(), common.Hash{}, i)
+		if _, _, err = core.ApplyTransaction(e.chainConfig, getHeader, e.engine, &header.Coinbase, gp, ibs, noop, header, txn, &gasUsed, vm.Config{}, contractHasTEVM); err != nil {
+			return nil, fmt.Errorf("transaction %d (%x): %w", i, txn.Hash(), err)
+		}
+	}
+	return feeRecipientValue(before, ibs.GetBalance(header.Coinbase).ToBig()), nil
+}
+
+// checkParentIsHead - blocks are executed on top of plain state, it must be the state after their parent
+func checkParentIsHead(tx kv.Tx, parentHash common.Hash, number uint64) error {
+	if number == 0 {
+		return fmt.Errorf("genesis block can't be executed")
+	}
+	executed, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return err
+	}
+	if executed+1 != number {
+		return fmt.Errorf("block %d isn't next to the head of executed chain %d", number, executed)
+	}
+	head, err := rawdb.ReadCanonicalHash(tx, executed)
+	if err != nil {
+		return err
+	}
+	if head != parentHash {
+		return fmt.Errorf("parent %x of block %d isn't the head of executed chain %x", parentHash, number, head)
+	}
+	return nil
+}
+
+func balanceOf(tx kv.Tx, address common.Address) (*big.Int, error) {
+	acc, err := state.NewPlainStateReader(tx).ReadAccountData(address)
+	if err != nil {
+		return nil, err
+	}
+	if acc == nil {
+		return new(big.Int), nil
+	}
+	return acc.Balance.ToBig(), nil
+}
+
+// feeRecipientValue - balance increase, zero if fee recipient paid more by own transactions than received
+func feeRecipientValue(before, after *big.Int) *big.Int {
+	value := new(big.Int).Sub(after, before)
+	if value.Sign() < 0 {
+		value.SetUint64(0)
+	}
+	return value
+}
@@ -0,0 +1,64 @@
+package stagedsync_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus/ethash"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryExecutor(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	chainConfig := *params.TestChainConfig
+	chainConfig.LondonBlock = big.NewInt(0)
+	gspec := &core.Genesis{
+		Config: &chainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	m := stages.MockWithGenesis(t, gspec, key)
+	feeRecipient := common.Address{0xfe}
+	gasPrice := uint256.NewInt(10 * params.GWei)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 2, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(feeRecipient)
+		if i == 1 {
+			txn, err := types.SignTx(types.NewTransaction(0, common.Address{2}, uint256.NewInt(1000), params.TxGas, gasPrice, nil), *types.LatestSignerForChainID(m.ChainConfig.ChainID), key)
+			require.NoError(t, err)
+			b.AddTx(txn)
+		}
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain.Slice(0, 1)))
+
+	executor := stagedsync.NewInMemoryExecutor(m.DB, m.ChainConfig, m.Engine, snapshotsync.NewBlockReader(), t.TempDir())
+	block := chain.Blocks[1]
+	value, err := executor.ExecuteBlock(context.Background(), block)
+	require.NoError(t, err)
+	minerReward, _ := ethash.AccumulateRewards(m.ChainConfig, block.Header(), block.Uncles())
+	tip := new(big.Int).Sub(gasPrice.ToBig(), block.BaseFee())
+	expected := new(big.Int).Mul(tip, big.NewInt(int64(params.TxGas)))
+	require.Equal(t, expected.Add(expected, minerReward.ToBig()), value)
+
+	header := block.Header()
+	header.Root = common.Hash{1}
+	_, err = executor.ExecuteBlock(context.Background(), types.NewBlockWithHeader(header).WithBody(block.Transactions(), nil))
+	require.Error(t, err)
+
+	_, err = executor.ExecuteBlock(context.Background(), chain.Blocks[0]) // not next to the head
+	require.Error(t, err)
+
+	// nothing was written to db
+	_, err = executor.ExecuteBlock(context.Background(), block)
+	require.NoError(t, err)
+}
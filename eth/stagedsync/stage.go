@@ -42,6 +42,8 @@ type Stage struct {
 	ID stages.SyncStage
 	// Disabled defines if the stage is disabled. It sets up when the stage is build by its `StageBuilder`.
 	Disabled bool
+	// Deferrable marks heavy background stages (indices, traces), which catch-up can wait for a maintenance window. See `Sync.SetMaintenance`.
+	Deferrable bool
 }
 
 // StageState is the state of the stage.
@@ -53,9 +55,17 @@ type StageState struct {
 
 func (s *StageState) LogPrefix() string { return s.state.LogPrefix() }
 
+// Stopping - closed when sync is asked to stop at safe checkpoint, see Sync.Stop. nil outside of sync
+func (s *StageState) Stopping() <-chan struct{} {
+	if s.state == nil {
+		return nil
+	}
+	return s.state.Stopping()
+}
+
 // Update updates the stage state (current block number) in the database. Can be called multiple times during stage execution.
 func (s *StageState) Update(db kv.Putter, newBlockNum uint64) error {
-	if m, ok := syncMetrics[s.ID]; ok {
+	if m, ok := stageMetrics(s.state.chainName())[s.ID]; ok {
 		m.Set(newBlockNum)
 	}
 	return stages.SaveStageProgress(db, s.ID, newBlockNum)
@@ -103,13 +113,15 @@ func (s *PruneState) Done(db kv.Putter) error {
 	return stages.SaveStagePruneProgress(db, s.ID, s.ForwardProgress)
 }
 
-func PruneTable(tx kv.RwTx, table string, logPrefix string, pruneTo uint64, logEvery *time.Ticker, ctx context.Context) error {
+func PruneTable(tx kv.RwTx, table string, s *PruneState, pruneTo uint64, logEvery *time.Ticker, ctx context.Context) error {
+	logPrefix := s.LogPrefix()
 	c, err := tx.RwCursor(table)
 
 	if err != nil {
 		return fmt.Errorf("failed to create cursor for pruning %w", err)
 	}
 	defer c.Close()
+	pruned := prunedRows(s.state.chainName(), table)
 
 	for k, _, err := c.First(); k != nil; k, _, err = c.Next() {
 		if err != nil {
@@ -130,16 +142,19 @@ func PruneTable(tx kv.RwTx, table string, logPrefix string, pruneTo uint64, logE
 		if err = c.DeleteCurrent(); err != nil {
 			return fmt.Errorf("failed to remove for block %d: %w", blockNum, err)
 		}
+		pruned.Inc()
 	}
 	return nil
 }
 
-func PruneTableDupSort(tx kv.RwTx, table string, logPrefix string, pruneTo uint64, logEvery *time.Ticker, ctx context.Context) error {
+func PruneTableDupSort(tx kv.RwTx, table string, s *PruneState, pruneTo uint64, logEvery *time.Ticker, ctx context.Context) error {
+	logPrefix := s.LogPrefix()
 	c, err := tx.RwCursorDupSort(table)
 	if err != nil {
 		return fmt.Errorf("failed to create cursor for pruning %w", err)
 	}
 	defer c.Close()
+	pruned := prunedRows(s.state.chainName(), table)
 
 	for k, _, err := c.First(); k != nil; k, _, err = c.NextNoDup() {
 		if err != nil {
@@ -159,6 +174,7 @@ func PruneTableDupSort(tx kv.RwTx, table string, logPrefix string, pruneTo uint6
 		if err = c.DeleteCurrentDuplicates(); err != nil {
 			return fmt.Errorf("failed to remove for block %d: %w", blockNum, err)
 		}
+		pruned.Inc()
 	}
 	return nil
 }
@@ -0,0 +1,380 @@
+package stagedsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/c2h5oh/datasize"
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/length"
+	"github.com/ledgerwatch/erigon-lib/etl"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/interfaces"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/ethdb/bitmapdb"
+	"github.com/ledgerwatch/erigon/ethdb/cbor"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// AddressAppearances stage builds the index of all transactions in which an address appears (rawdb.AppearanceIndex):
+// as sender or recipient, as participant of internal calls (rawdb.TxCallSet, written by Execution stage), as address
+// of a log or as a log topic which looks like an address. The index is archival: it's not pruned.
+
+type AddressAppearancesCfg struct {
+	db          kv.RwDB
+	prune       prune.Mode
+	bufLimit    datasize.ByteSize
+	flushEvery  time.Duration
+	tmpdir      string
+	blockReader interfaces.FullBlockReader
+}
+
+func StageAddressAppearancesCfg(db kv.RwDB, prune prune.Mode, tmpDir string, blockReader interfaces.FullBlockReader) AddressAppearancesCfg {
+	return AddressAppearancesCfg{
+		db:          db,
+		prune:       prune,
+		bufLimit:    bitmapsBufLimit,
+		flushEvery:  bitmapsFlushEvery,
+		tmpdir:      tmpDir,
+		blockReader: blockReader,
+	}
+}
+
+func SpawnAddressAppearancesStage(s *StageState, tx kv.RwTx, cfg AddressAppearancesCfg, ctx context.Context) (err error) {
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	endBlock, err := s.ExecutionAt(tx)
+	if err != nil {
+		return fmt.Errorf("getting last executed block: %w", err)
+	}
+	if endBlock <= s.BlockNumber {
+		return nil
+	}
+	logPrefix := s.LogPrefix()
+	startBlock := s.BlockNumber + 1
+	if endBlock-startBlock > 16 {
+		log.Info(fmt.Sprintf("[%s] Indexing address appearances", logPrefix), "from", startBlock, "to", endBlock)
+	}
+	if err = promoteAddressAppearances(logPrefix, tx, cfg, startBlock, endBlock, ctx); err != nil {
+		return err
+	}
+	if err = s.Update(tx, endBlock); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func promoteAddressAppearances(logPrefix string, tx kv.RwTx, cfg AddressAppearancesCfg, startBlock, endBlock uint64, ctx context.Context) error {
+	logEvery := time.NewTicker(logInterval)
+	defer logEvery.Stop()
+	checkFlushEvery := time.NewTicker(cfg.flushEvery)
+	defer checkFlushEvery.Stop()
+
+	collector := etl.NewCollector(logPrefix, cfg.tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	defer collector.Close()
+
+	appearances := map[string]*roaring64.Bitmap{}
+	if err := walkAppearances(ctx, tx, cfg.blockReader, startBlock, endBlock, func(addr []byte, id uint64) error {
+		m, ok := appearances[string(addr)]
+		if !ok {
+			m = roaring64.New()
+			appearances[string(addr)] = m
+		}
+		m.Add(id)
+		select {
+		default:
+		case <-ctx.Done():
+			return libcommon.ErrStopped
+		case <-logEvery.C:
+			blockNum, _ := rawdb.SplitAppearanceID(id)
+			log.Info(fmt.Sprintf("[%s] Progress", logPrefix), "number", blockNum)
+		case <-checkFlushEvery.C:
+			if needFlush64(appearances, cfg.bufLimit) {
+				if err := flushBitmaps64(collector, appearances); err != nil {
+					return err
+				}
+				appearances = map[string]*roaring64.Bitmap{}
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := flushBitmaps64(collector, appearances); err != nil {
+		return err
+	}
+	return collector.Load(tx, rawdb.AppearanceIndex, bitmaps64LoaderFunc(), etl.TransformArgs{Quit: ctx.Done()})
+}
+
+// walkAppearances - appearances of addresses in transactions of blocks from..to, walker gets them grouped by
+// source (block bodies, logs, internal calls), so the same appearance may be walked more than once
+func walkAppearances(ctx context.Context, tx kv.Tx, blockReader interfaces.FullBlockReader, from, to uint64, walker func(addr []byte, id uint64) error) error {
+	for blockNum := from; blockNum <= to; blockNum++ {
+		block, senders, err := readCanonicalBlock(ctx, tx, blockReader, blockNum)
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			return fmt.Errorf("block %d not found", blockNum)
+		}
+		if len(block.Transactions()) > rawdb.MaxAppearanceTxIndex+1 {
+			return fmt.Errorf("block %d has too many transactions to index appearances: %d", blockNum, len(block.Transactions()))
+		}
+		for i, txn := range block.Transactions() {
+			id := rawdb.AppearanceID(blockNum, uint32(i))
+			if i < len(senders) {
+				if err = walker(senders[i][:], id); err != nil {
+					return err
+				}
+			}
+			if recipient := txn.GetTo(); recipient != nil {
+				if err = walker(recipient[:], id); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return walkExecutionAppearances(tx, from, to, walker)
+}
+
+// walkExecutionAppearances - appearances recorded by Execution stage: in logs and internal calls
+func walkExecutionAppearances(tx kv.Tx, from, to uint64, walker func(addr []byte, id uint64) error) error {
+	logs, err := tx.Cursor(kv.Log)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+	reader := bytes.NewReader(nil)
+	for k, v, err := logs.Seek(dbutils.LogKey(from, 0)); k != nil; k, v, err = logs.Next() {
+		if err != nil {
+			return err
+		}
+		blockNum := binary.BigEndian.Uint64(k)
+		if blockNum > to {
+			break
+		}
+		id := rawdb.AppearanceID(blockNum, binary.BigEndian.Uint32(k[8:]))
+		if v, err = rawdb.DecodeReceiptsValue(tx, v); err != nil {
+			return fmt.Errorf("receipt decompression failed: %w, block=%d", err, blockNum)
+		}
+		var ll types.Logs
+		reader.Reset(v)
+		if err := cbor.Unmarshal(&ll, reader); err != nil {
+			return fmt.Errorf("receipt unmarshal failed: %w, block=%d", err, blockNum)
+		}
+		for _, l := range ll {
+			if err = walker(l.Address[:], id); err != nil {
+				return err
+			}
+			for _, topic := range l.Topics {
+				// address is left-padded with zeroes to 32 bytes
+				if isAddressTopic(topic[:]) {
+					if err = walker(topic[32-length.Addr:], id); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	calls, err := tx.CursorDupSort(rawdb.TxCallSet)
+	if err != nil {
+		return err
+	}
+	defer calls.Close()
+	for k, v, err := calls.Seek(dbutils.EncodeBlockNumber(from)); k != nil; k, v, err = calls.Next() {
+		if err != nil {
+			return err
+		}
+		blockNum := binary.BigEndian.Uint64(k)
+		if blockNum > to {
+			break
+		}
+		if len(v) != length.Addr+4 {
+			return fmt.Errorf("wrong size of value in TxCallSet: %x (size %d)", v, len(v))
+		}
+		if err = walker(v[:length.Addr], rawdb.AppearanceID(blockNum, binary.BigEndian.Uint32(v[length.Addr:]))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkUnwoundAppearances - addresses which may appear in blocks from..to. Canonical chain may be already switched to
+// the new fork, so bodies and senders of all known blocks are walked.
+func walkUnwoundAppearances(tx kv.Tx, from, to uint64, walker func(addr []byte) error) error {
+	bodies, err := tx.Cursor(kv.BlockBody)
+	if err != nil {
+		return err
+	}
+	defer bodies.Close()
+	reader := bytes.NewReader(nil)
+	for k, v, err := bodies.Seek(dbutils.EncodeBlockNumber(from)); k != nil; k, v, err = bodies.Next() {
+		if err != nil {
+			return err
+		}
+		if binary.BigEndian.Uint64(k) > to {
+			break
+		}
+		body := new(types.BodyForStorage)
+		reader.Reset(v)
+		if err = rlp.Decode(reader, body); err != nil {
+			return fmt.Errorf("rlp decode err: %w", err)
+		}
+		txs, err := rawdb.CanonicalTransactions(tx, body.BaseTxId, body.TxAmount)
+		if err != nil {
+			return err
+		}
+		for _, txn := range txs {
+			if recipient := txn.GetTo(); recipient != nil {
+				if err = walker(recipient[:]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	senders, err := tx.Cursor(kv.Senders)
+	if err != nil {
+		return err
+	}
+	defer senders.Close()
+	for k, v, err := senders.Seek(dbutils.EncodeBlockNumber(from)); k != nil; k, v, err = senders.Next() {
+		if err != nil {
+			return err
+		}
+		if binary.BigEndian.Uint64(k) > to {
+			break
+		}
+		for i := 0; i+length.Addr <= len(v); i += length.Addr {
+			if err = walker(v[i : i+length.Addr]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return walkExecutionAppearances(tx, from, to, func(addr []byte, _ uint64) error {
+		return walker(addr)
+	})
+}
+
+func isAddressTopic(topic []byte) bool {
+	for _, b := range topic[:32-length.Addr] {
+		if b != 0 {
+			return false
+		}
+	}
+	for _, b := range topic[32-length.Addr:] {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func truncateTxCallSet(tx kv.RwTx, from uint64) error {
+	c, err := tx.RwCursorDupSort(rawdb.TxCallSet)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for k, _, err := c.Seek(dbutils.EncodeBlockNumber(from)); k != nil; k, _, err = c.NextNoDup() {
+		if err != nil {
+			return err
+		}
+		if err = c.DeleteCurrentDuplicates(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func UnwindAddressAppearancesStage(u *UnwindState, s *StageState, tx kv.RwTx, cfg AddressAppearancesCfg, ctx context.Context) (err error) {
+	if s.BlockNumber <= u.UnwindPoint {
+		return nil
+	}
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	logPrefix := u.LogPrefix()
+	addrs := etl.NewCollector(logPrefix, cfg.tmpdir, etl.NewOldestEntryBuffer(etl.BufferOptimalSize))
+	defer addrs.Close()
+	if err = walkUnwoundAppearances(tx, u.UnwindPoint+1, s.BlockNumber, func(addr []byte) error {
+		return addrs.Collect(addr, nil)
+	}); err != nil {
+		return err
+	}
+	truncateFrom := rawdb.AppearanceID(u.UnwindPoint+1, 0)
+	if err = addrs.Load(tx, "", func(k, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
+		return bitmapdb.TruncateRange64(tx, rawdb.AppearanceIndex, k, truncateFrom)
+	}, etl.TransformArgs{Quit: ctx.Done()}); err != nil {
+		return fmt.Errorf("TruncateRange: bucket=%s, %w", rawdb.AppearanceIndex, err)
+	}
+
+	if err = u.Done(tx); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneAddressAppearancesStage - the index is kept for all blocks, only rawdb.TxCallSet of blocks which can't be
+// unwound anymore is deleted
+func PruneAddressAppearancesStage(s *PruneState, tx kv.RwTx, cfg AddressAppearancesCfg, ctx context.Context) (err error) {
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	if s.ForwardProgress > params.FullImmutabilityThreshold {
+		logEvery := time.NewTicker(logInterval)
+		defer logEvery.Stop()
+		if err = PruneTableDupSort(tx, rawdb.TxCallSet, s, s.ForwardProgress-params.FullImmutabilityThreshold, logEvery, ctx); err != nil {
+			return err
+		}
+	}
+	if err = s.Done(tx); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -215,6 +215,8 @@ Loop:
 		select {
 		case <-ctx.Done():
 			stopped = true
+		case <-s.Stopping():
+			stopped = true
 		case <-logEvery.C:
 			deliveredCount, wastedCount := cfg.bd.DeliveryCounts()
 			if prevProgress == bodyProgress {
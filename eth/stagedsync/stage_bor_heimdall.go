@@ -0,0 +1,233 @@
+package stagedsync
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/consensus"
+	"github.com/ledgerwatch/erigon/consensus/bor"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// BorHeimdall stage downloads Heimdall spans and state sync events of Bor chains (Polygon PoS) into the bor
+// database before blocks are executed, so that Finalize of the engine doesn't go to Heimdall for every sprint.
+// For every sprint start block it marks the last event committed in it (bor.BorEventNums).
+
+type BorHeimdallCfg struct {
+	db          kv.RwDB
+	chainConfig params.ChainConfig
+	borDB       kv.RwDB
+	heimdall    bor.IHeimdallClient
+}
+
+func StageBorHeimdallCfg(db kv.RwDB, chainConfig params.ChainConfig, engine consensus.Engine) BorHeimdallCfg {
+	cfg := BorHeimdallCfg{
+		db:          db,
+		chainConfig: chainConfig,
+	}
+	if borEngine, ok := engine.(*bor.Bor); ok {
+		cfg.borDB = borEngine.DB()
+		cfg.heimdall = borEngine.Heimdall()
+	}
+	return cfg
+}
+
+func (cfg BorHeimdallCfg) enabled() bool {
+	return cfg.chainConfig.Bor != nil && cfg.borDB != nil
+}
+
+func SpawnBorHeimdallStage(s *StageState, tx kv.RwTx, cfg BorHeimdallCfg, ctx context.Context) (err error) {
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	headNumber, err := stages.GetStageProgress(tx, stages.Headers)
+	if err != nil {
+		return fmt.Errorf("getting headers progress: %w", err)
+	}
+	if headNumber <= s.BlockNumber {
+		return nil
+	}
+	logPrefix := s.LogPrefix()
+	// without Heimdall validators are taken from headers and events are not committed
+	if cfg.heimdall != nil {
+		if err = fetchBorSpans(ctx, logPrefix, cfg, headNumber); err != nil {
+			return err
+		}
+		if err = fetchBorEvents(ctx, logPrefix, tx, cfg, s.BlockNumber+1, headNumber); err != nil {
+			return err
+		}
+	}
+	if err = s.Update(tx, headNumber); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchBorSpans downloads spans up to the one containing head block, next span is downloaded if it's
+// already known to Heimdall
+func fetchBorSpans(ctx context.Context, logPrefix string, cfg BorHeimdallCfg, headNumber uint64) error {
+	return cfg.borDB.Update(ctx, func(borTx kv.RwTx) error {
+		lastSpanID, ok, err := bor.LastSpanID(borTx)
+		if err != nil {
+			return err
+		}
+		fromID := uint64(0)
+		if ok {
+			fromID = lastSpanID + 1
+		}
+		toID := bor.SpanIDAt(headNumber) + 1
+		chainID := cfg.chainConfig.ChainID.String()
+		for spanID := fromID; spanID <= toID; spanID++ {
+			span, err := cfg.heimdall.Span(ctx, spanID)
+			if spanID == toID && errors.Is(err, bor.ErrNotInHeimdall) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("fetching span %d: %w", spanID, err)
+			}
+			if span.ChainID != chainID {
+				return fmt.Errorf("chain id of span %d does not match, expected %s, got %s", spanID, chainID, span.ChainID)
+			}
+			if err = bor.WriteSpan(borTx, span); err != nil {
+				return err
+			}
+			log.Debug(fmt.Sprintf("[%s] Fetched span", logPrefix), "id", span.ID, "start", span.StartBlock, "end", span.EndBlock)
+		}
+		return nil
+	})
+}
+
+// fetchBorEvents downloads state sync events committed in sprint start blocks in [from, to] and marks the last
+// event of every such block. Events of block N are the ones with time before time of block N-sprint.
+func fetchBorEvents(ctx context.Context, logPrefix string, tx kv.Tx, cfg BorHeimdallCfg, from, to uint64) error {
+	sprint := cfg.chainConfig.Bor.Sprint
+	first := from + (sprint-from%sprint)%sprint
+	if first == 0 {
+		first = sprint
+	}
+	if first > to {
+		return nil
+	}
+	var blockNums []uint64
+	var toTimes []time.Time
+	for blockNum := first; blockNum <= to; blockNum += sprint {
+		hash, err := rawdb.ReadCanonicalHash(tx, blockNum-sprint)
+		if err != nil {
+			return err
+		}
+		header := rawdb.ReadHeader(tx, hash, blockNum-sprint)
+		if header == nil {
+			return fmt.Errorf("header %d not found", blockNum-sprint)
+		}
+		blockNums = append(blockNums, blockNum)
+		toTimes = append(toTimes, time.Unix(int64(header.Time), 0))
+	}
+
+	return cfg.borDB.Update(ctx, func(borTx kv.RwTx) error {
+		lastEventID, err := bor.LastEventID(borTx)
+		if err != nil {
+			return err
+		}
+		events, err := cfg.heimdall.StateSyncEvents(ctx, lastEventID+1, toTimes[len(toTimes)-1].Unix())
+		if err != nil {
+			return fmt.Errorf("fetching state sync events from %d: %w", lastEventID+1, err)
+		}
+		for _, event := range events {
+			if err = bor.WriteEvent(borTx, event); err != nil {
+				return err
+			}
+		}
+		if len(events) > 0 {
+			log.Info(fmt.Sprintf("[%s] Fetched state sync events", logPrefix), "from", events[0].ID, "to", events[len(events)-1].ID)
+		}
+
+		// all events committed before first block are downloaded already
+		prevEventID := uint64(0)
+		if first > sprint {
+			if prevEventID, _, err = bor.ReadLastEventID(borTx, first-sprint); err != nil {
+				return err
+			}
+		}
+		c, err := borTx.Cursor(bor.BorEvents)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		k, v, err := c.Seek(dbutils.EncodeBlockNumber(prevEventID + 1))
+		if err != nil {
+			return err
+		}
+		for i, blockNum := range blockNums {
+			for ; k != nil; k, v, err = c.Next() {
+				if err != nil {
+					return err
+				}
+				var event bor.EventRecordWithTime
+				if err = json.Unmarshal(v, &event); err != nil {
+					return err
+				}
+				if !event.Time.Before(toTimes[i]) {
+					break
+				}
+				prevEventID = binary.BigEndian.Uint64(k)
+			}
+			if err != nil {
+				return err
+			}
+			if err = bor.WriteLastEventID(borTx, blockNum, prevEventID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func UnwindBorHeimdallStage(u *UnwindState, s *StageState, tx kv.RwTx, cfg BorHeimdallCfg, ctx context.Context) (err error) {
+	if s.BlockNumber <= u.UnwindPoint {
+		return nil
+	}
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	// spans and events don't depend on the fork, only markers of blocks are removed
+	if err = cfg.borDB.Update(ctx, func(borTx kv.RwTx) error {
+		return bor.TruncateEventNums(borTx, u.UnwindPoint+1)
+	}); err != nil {
+		return err
+	}
+	if err = u.Done(tx); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/ethdb/bitmapdb"
 	"github.com/ledgerwatch/erigon/ethdb/prune"
 	"github.com/ledgerwatch/log/v3"
@@ -168,19 +169,84 @@ func promoteCallTraces(logPrefix string, tx kv.RwTx, startBlock, endBlock uint64
 		return err
 	}
 
-	if err := finaliseCallTraces(collectorFrom, collectorTo, logPrefix, tx, quit); err != nil {
+	collectorSelectors := etl.NewCollector(logPrefix, tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	defer collectorSelectors.Close()
+	if err = collectCallSelectors(tx, collectorSelectors, startBlock, endBlock, bufLimit, flushEvery, quit); err != nil {
 		return err
 	}
 
+	if err := finaliseCallTraces(collectorFrom, collectorTo, collectorSelectors, logPrefix, tx, quit); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// collectCallSelectors - bitmaps of blocks by contract + selector, from rawdb.CallSelectorSet
+func collectCallSelectors(tx kv.Tx, collector *etl.Collector, startBlock, endBlock uint64, bufLimit datasize.ByteSize, flushEvery time.Duration, quit <-chan struct{}) error {
+	checkFlushEvery := time.NewTicker(flushEvery)
+	defer checkFlushEvery.Stop()
+	c, err := tx.CursorDupSort(rawdb.CallSelectorSet)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	selectors := map[string]*roaring64.Bitmap{}
+	for k, v, err := c.Seek(dbutils.EncodeBlockNumber(startBlock)); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		blockNum := binary.BigEndian.Uint64(k)
+		if blockNum > endBlock {
+			break
+		}
+		if len(v) != length.Addr+4 {
+			return fmt.Errorf("wrong size of value in CallSelectorSet: %x (size %d)", v, len(v))
+		}
+		m, ok := selectors[string(v)]
+		if !ok {
+			m = roaring64.New()
+			selectors[string(v)] = m
+		}
+		m.Add(blockNum)
+		select {
+		default:
+		case <-quit:
+			return libcommon.ErrStopped
+		case <-checkFlushEvery.C:
+			if needFlush64(selectors, bufLimit) {
+				if err = flushBitmaps64(collector, selectors); err != nil {
+					return err
+				}
+				selectors = map[string]*roaring64.Bitmap{}
+			}
+		}
+	}
+	return flushBitmaps64(collector, selectors)
+}
+
+func finaliseCallTraces(collectorFrom, collectorTo, collectorSelectors *etl.Collector, logPrefix string, tx kv.RwTx, quit <-chan struct{}) error {
+	loaderFunc := bitmaps64LoaderFunc()
+	if err := collectorFrom.Load(tx, kv.CallFromIndex, loaderFunc, etl.TransformArgs{Quit: quit}); err != nil {
+		return err
+	}
+	if err := collectorTo.Load(tx, kv.CallToIndex, loaderFunc, etl.TransformArgs{Quit: quit}); err != nil {
+		return err
+	}
+	if err := collectorSelectors.Load(tx, rawdb.CallSelectorIndex, loaderFunc, etl.TransformArgs{Quit: quit}); err != nil {
+		return err
+	}
 	return nil
 }
 
-func finaliseCallTraces(collectorFrom, collectorTo *etl.Collector, logPrefix string, tx kv.RwTx, quit <-chan struct{}) error {
+// bitmaps64LoaderFunc - loads collected bitmaps into chunked index, merging them with the last chunk in the table
+func bitmaps64LoaderFunc() etl.LoadFunc {
 	var buf = bytes.NewBuffer(nil)
 	lastChunkKey := make([]byte, 128)
 	reader := bytes.NewReader(nil)
 	reader2 := bytes.NewReader(nil)
-	var loaderFunc = func(k []byte, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
+	return func(k []byte, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
 		reader.Reset(v)
 		currentBitmap := roaring64.New()
 		if _, err := currentBitmap.ReadFrom(reader); err != nil {
@@ -214,13 +280,6 @@ func finaliseCallTraces(collectorFrom, collectorTo *etl.Collector, logPrefix str
 		}
 		return nil
 	}
-	if err := collectorFrom.Load(tx, kv.CallFromIndex, loaderFunc, etl.TransformArgs{Quit: quit}); err != nil {
-		return err
-	}
-	if err := collectorTo.Load(tx, kv.CallToIndex, loaderFunc, etl.TransformArgs{Quit: quit}); err != nil {
-		return err
-	}
-	return nil
 }
 
 func UnwindCallTraces(u *UnwindState, s *StageState, tx kv.RwTx, cfg CallTracesCfg, ctx context.Context) (err error) {
@@ -324,6 +383,54 @@ func DoUnwindCallTraces(logPrefix string, db kv.RwTx, from, to uint64, ctx conte
 	}, etl.TransformArgs{}); err != nil {
 		return fmt.Errorf("TruncateRange: bucket=%s, %w", kv.CallFromIndex, err)
 	}
+	return unwindCallSelectors(logPrefix, db, from, to, ctx, tmpdir)
+}
+
+func unwindCallSelectors(logPrefix string, tx kv.RwTx, from, to uint64, ctx context.Context, tmpdir string) error {
+	selectors := etl.NewCollector(logPrefix, tmpdir, etl.NewOldestEntryBuffer(etl.BufferOptimalSize))
+	defer selectors.Close()
+
+	c, err := tx.CursorDupSort(rawdb.CallSelectorSet)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for k, v, err := c.Seek(dbutils.EncodeBlockNumber(to + 1)); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if binary.BigEndian.Uint64(k) > from {
+			break
+		}
+		if err = selectors.Collect(v, nil); err != nil {
+			return err
+		}
+		if err = libcommon.Stopped(ctx.Done()); err != nil {
+			return err
+		}
+	}
+	if err = selectors.Load(tx, "", func(k, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
+		return bitmapdb.TruncateRange64(tx, rawdb.CallSelectorIndex, k, to+1)
+	}, etl.TransformArgs{}); err != nil {
+		return fmt.Errorf("TruncateRange: bucket=%s, %w", rawdb.CallSelectorIndex, err)
+	}
+	return nil
+}
+
+func truncateCallSelectorSet(tx kv.RwTx, from uint64) error {
+	c, err := tx.RwCursorDupSort(rawdb.CallSelectorSet)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for k, _, err := c.Seek(dbutils.EncodeBlockNumber(from)); k != nil; k, _, err = c.NextNoDup() {
+		if err != nil {
+			return err
+		}
+		if err = c.DeleteCurrentDuplicates(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -343,6 +450,9 @@ func PruneCallTraces(s *PruneState, tx kv.RwTx, cfg CallTracesCfg, ctx context.C
 		if err = pruneCallTraces(tx, logPrefix, cfg.prune.CallTraces.PruneTo(s.ForwardProgress), ctx, cfg.tmpdir); err != nil {
 			return err
 		}
+		if err = pruneCallSelectors(tx, logPrefix, cfg.prune.CallTraces.PruneTo(s.ForwardProgress), ctx, cfg.tmpdir); err != nil {
+			return err
+		}
 	}
 	if err := s.Done(tx); err != nil {
 		return err
@@ -473,3 +583,49 @@ func pruneCallTraces(tx kv.RwTx, logPrefix string, pruneTo uint64, ctx context.C
 	}
 	return nil
 }
+
+// pruneCallSelectors - deletes chunks of rawdb.CallSelectorIndex which contain only blocks before pruneTo
+func pruneCallSelectors(tx kv.RwTx, logPrefix string, pruneTo uint64, ctx context.Context, tmpdir string) error {
+	selectors := etl.NewCollector(logPrefix, tmpdir, etl.NewOldestEntryBuffer(etl.BufferOptimalSize))
+	defer selectors.Close()
+
+	setC, err := tx.CursorDupSort(rawdb.CallSelectorSet)
+	if err != nil {
+		return err
+	}
+	defer setC.Close()
+	for k, v, err := setC.First(); k != nil; k, v, err = setC.Next() {
+		if err != nil {
+			return err
+		}
+		if binary.BigEndian.Uint64(k) >= pruneTo {
+			break
+		}
+		if err = selectors.Collect(v, nil); err != nil {
+			return err
+		}
+		if err = libcommon.Stopped(ctx.Done()); err != nil {
+			return err
+		}
+	}
+
+	c, err := tx.RwCursor(rawdb.CallSelectorIndex)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return selectors.Load(tx, "", func(selector, _ []byte, _ etl.CurrentTableReader, _ etl.LoadNextFunc) error {
+		for k, _, err := c.Seek(selector); k != nil; k, _, err = c.Next() {
+			if err != nil {
+				return err
+			}
+			if !bytes.HasPrefix(k, selector) || binary.BigEndian.Uint64(k[len(selector):]) >= pruneTo {
+				break
+			}
+			if err = c.DeleteCurrent(); err != nil {
+				return err
+			}
+		}
+		return libcommon.Stopped(ctx.Done())
+	}, etl.TransformArgs{})
+}
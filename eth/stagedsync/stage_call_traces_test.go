@@ -9,6 +9,7 @@ import (
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/memdb"
 	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 	"github.com/ledgerwatch/erigon/ethdb/bitmapdb"
 	"github.com/stretchr/testify/assert"
@@ -72,3 +73,43 @@ func TestCallTrace(t *testing.T) {
 	err = pruneCallTraces(tx, "test", 10, ctx, "")
 	assert.NoError(err)
 }
+
+func TestCallSelectors(t *testing.T) {
+	ctx := context.Background()
+	_, tx := memdb.NewTestTx(t)
+	key := func(addr, selector byte) []byte {
+		k := make([]byte, 24)
+		k[19], k[23] = addr, selector
+		return k
+	}
+	// contract 1: selector 1 is called in every 3rd block, selector 2 in every 5th
+	for i := uint64(1); i <= 30; i++ {
+		if i%3 == 0 {
+			require.NoError(t, tx.Put(rawdb.CallSelectorSet, dbutils.EncodeBlockNumber(i), key(1, 1)))
+		}
+		if i%5 == 0 {
+			require.NoError(t, tx.Put(rawdb.CallSelectorSet, dbutils.EncodeBlockNumber(i), key(1, 2)))
+		}
+	}
+	blocks := func(selector byte) []uint64 {
+		b, err := bitmapdb.Get64(tx, rawdb.CallSelectorIndex, key(1, selector), 0, 30)
+		require.NoError(t, err)
+		return b.ToArray()
+	}
+
+	require.NoError(t, promoteCallTraces("test", tx, 1, 20, 0, time.Nanosecond, ctx.Done(), ""))
+	require.Equal(t, []uint64{3, 6, 9, 12, 15, 18}, blocks(1))
+	require.Equal(t, []uint64{5, 10, 15, 20}, blocks(2))
+
+	require.NoError(t, DoUnwindCallTraces("test", tx, 20, 10, ctx, ""))
+	require.Equal(t, []uint64{3, 6, 9}, blocks(1))
+	require.Equal(t, []uint64{5, 10}, blocks(2))
+
+	require.NoError(t, promoteCallTraces("test", tx, 11, 30, 0, time.Nanosecond, ctx.Done(), ""))
+	require.Equal(t, []uint64{3, 6, 9, 12, 15, 18, 21, 24, 27, 30}, blocks(1))
+	require.Equal(t, []uint64{5, 10, 15, 20, 25, 30}, blocks(2))
+
+	// only whole chunks are pruned, the last chunk is kept - like in CallFromIndex and CallToIndex
+	require.NoError(t, pruneCallSelectors(tx, "test", 20, ctx, ""))
+	require.Equal(t, []uint64{5, 10, 15, 20, 25, 30}, blocks(2))
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/c2h5oh/datasize"
+	"github.com/holiman/uint256"
 	libcommon "github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/common/length"
 	"github.com/ledgerwatch/erigon-lib/etl"
@@ -43,18 +44,26 @@ type HasChangeSetWriter interface {
 
 type ChangeSetHook func(blockNum uint64, wr *state.ChangeSetWriter)
 
+// WitnessHook receives state accessed by executed block - to build its witness (e.g. for stateless verification or
+// zk-provers) while state before the block is at hand
+type WitnessHook func(block *types.Block, rec *state.WitnessRecorder)
+
 type ExecuteBlockCfg struct {
 	db            kv.RwDB
 	batchSize     datasize.ByteSize
 	prune         prune.Mode
 	changeSetHook ChangeSetHook
+	witnessHook   WitnessHook
 	chainConfig   *params.ChainConfig
 	engine        consensus.Engine
 	vmConfig      *vm.Config
 	tmpdir        string
 	stateStream   bool
+	prefetch      bool
+	headLag       uint64
 	accumulator   *shards.Accumulator
 	blockReader   interfaces.FullBlockReader
+	stateBackend  state.Backend // nil - state is read from PlainState only
 }
 
 func StageExecuteBlocksCfg(
@@ -62,26 +71,34 @@ func StageExecuteBlocksCfg(
 	prune prune.Mode,
 	batchSize datasize.ByteSize,
 	changeSetHook ChangeSetHook,
+	witnessHook WitnessHook,
 	chainConfig *params.ChainConfig,
 	engine consensus.Engine,
 	vmConfig *vm.Config,
 	accumulator *shards.Accumulator,
 	stateStream bool,
+	prefetch bool,
+	headLag uint64,
 	tmpdir string,
 	blockReader interfaces.FullBlockReader,
+	stateBackend state.Backend,
 ) ExecuteBlockCfg {
 	return ExecuteBlockCfg{
 		db:            kv,
 		prune:         prune,
 		batchSize:     batchSize,
 		changeSetHook: changeSetHook,
+		witnessHook:   witnessHook,
 		chainConfig:   chainConfig,
 		engine:        engine,
 		vmConfig:      vmConfig,
 		tmpdir:        tmpdir,
 		accumulator:   accumulator,
 		stateStream:   stateStream,
+		prefetch:      prefetch,
+		headLag:       headLag,
 		blockReader:   blockReader,
+		stateBackend:  stateBackend,
 	}
 }
 
@@ -98,7 +115,7 @@ func executeBlock(
 	initialCycle bool,
 ) error {
 	blockNum := block.NumberU64()
-	stateReader, stateWriter, err := newStateReaderWriter(batch, tx, block, writeChangesets, cfg.accumulator, initialCycle, cfg.stateStream)
+	stateReader, stateWriter, err := newStateReaderWriter(batch, tx, block, writeChangesets, cfg.accumulator, initialCycle, cfg.stateStream, cfg.stateBackend)
 	if err != nil {
 		return err
 	}
@@ -112,10 +129,35 @@ func executeBlock(
 	callTracer := calltracer.NewCallTracer(contractHasTEVM)
 	vmConfig.Debug = true
 	vmConfig.Tracer = callTracer
-	receipts, err := core.ExecuteBlockEphemerally(cfg.chainConfig, &vmConfig, getHeader, cfg.engine, block, stateReader, stateWriter, epochReader{tx: tx}, chainReader{config: cfg.chainConfig, tx: tx, blockReader: cfg.blockReader}, contractHasTEVM)
+	codeRecorder := state.NewCodeRecorder()
+	execWriter := codeRecorder.Writer(stateWriter)
+	var accessRecorder *state.AccessRecorder
+	if cfg.prune.Experiments.StateAccess {
+		accessRecorder = state.NewAccessRecorder()
+		stateReader = accessRecorder.Reader(stateReader)
+		execWriter = accessRecorder.Writer(execWriter)
+	}
+	var witnessRecorder *state.WitnessRecorder
+	if cfg.witnessHook != nil {
+		witnessRecorder = state.NewWitnessRecorder()
+		stateReader = witnessRecorder.Reader(stateReader)
+		execWriter = witnessRecorder.Writer(execWriter)
+	}
+	receipts, err := core.ExecuteBlockEphemerally(cfg.chainConfig, &vmConfig, getHeader, cfg.engine, block, stateReader, execWriter, epochReader{tx: tx}, chainReader{config: cfg.chainConfig, tx: tx, blockReader: cfg.blockReader}, contractHasTEVM)
 	if err != nil {
 		return err
 	}
+	if err = writeCodeHistory(tx, blockNum, codeRecorder); err != nil {
+		return err
+	}
+	if witnessRecorder != nil {
+		cfg.witnessHook(block, witnessRecorder)
+	}
+	if accessRecorder != nil {
+		if err = writeStateAccessSet(tx, blockNum, accessRecorder); err != nil {
+			return err
+		}
+	}
 
 	if writeReceipts {
 		if err = rawdb.AppendReceipts(tx, blockNum, receipts); err != nil {
@@ -128,6 +170,11 @@ func executeBlock(
 			cfg.changeSetHook(blockNum, hasChangeSet.ChangeSetWriter())
 		}
 	}
+	if cfg.prune.Experiments.Appearances {
+		if err = callTracer.WriteTxCallsToDb(tx, blockNum); err != nil {
+			return err
+		}
+	}
 	if writeCallTraces {
 		return callTracer.WriteToDb(tx, block, *cfg.vmConfig)
 	}
@@ -142,6 +189,7 @@ func newStateReaderWriter(
 	accumulator *shards.Accumulator,
 	initialCycle bool,
 	stateStream bool,
+	stateBackend state.Backend,
 ) (state.StateReader, state.WriterWithChangeSets, error) {
 
 	var stateReader state.StateReader
@@ -163,6 +211,10 @@ func newStateReaderWriter(
 	} else {
 		stateWriter = state.NewPlainStateWriterNoHistory(batch).SetAccumulator(accumulator)
 	}
+	if stateBackend != nil {
+		stateReader = stateBackend.Reader()
+		stateWriter = state.NewTeeWriter(stateWriter, stateBackend.Writer(block.NumberU64()))
+	}
 
 	return stateReader, stateWriter, nil
 }
@@ -193,6 +245,13 @@ func SpawnExecuteBlocksStage(s *StageState, u Unwinder, tx kv.RwTx, toBlock uint
 	if toBlock > 0 {
 		to = min(prevStageProgress, toBlock)
 	}
+	if cfg.headLag > 0 {
+		lagging, err := laggingHead(tx, cfg.headLag)
+		if err != nil {
+			return err
+		}
+		to = min(to, lagging)
+	}
 	if to <= s.BlockNumber {
 		return nil
 	}
@@ -200,8 +259,10 @@ func SpawnExecuteBlocksStage(s *StageState, u Unwinder, tx kv.RwTx, toBlock uint
 		log.Info(fmt.Sprintf("[%s] Blocks execution", logPrefix), "from", s.BlockNumber, "to", to)
 	}
 
+	// Batch is flushed even if stage is stopped or cancelled: flush is bounded by batchSize, aborting it would throw
+	// away all blocks executed since the last commit
 	var batch ethdb.DbWithPendingMutations
-	batch = olddb.NewBatch(tx, quit)
+	batch = olddb.NewBatch(tx, nil)
 	defer batch.Rollback()
 
 	logEvery := time.NewTicker(logInterval)
@@ -212,25 +273,47 @@ func SpawnExecuteBlocksStage(s *StageState, u Unwinder, tx kv.RwTx, toBlock uint
 	logTime := time.Now()
 	var gas uint64
 
+	var prefetcher *execPrefetcher
+	if cfg.prefetch {
+		prefetcher = newExecPrefetcher(cfg.db)
+		defer prefetcher.Close()
+	}
+	var nextBlock *types.Block // read ahead for prefetcher
+
 	var stoppedErr error
 Loop:
 	for blockNum := stageProgress + 1; blockNum <= to; blockNum++ {
 		if stoppedErr = libcommon.Stopped(quit); stoppedErr != nil {
 			break
 		}
-
-		blockHash, err := rawdb.ReadCanonicalHash(tx, blockNum)
-		if err != nil {
-			return err
+		// cycle in one transaction is short, it's finished
+		if !useExternalTx {
+			if stoppedErr = libcommon.Stopped(s.Stopping()); stoppedErr != nil {
+				log.Info(fmt.Sprintf("[%s] Stopping at safe checkpoint", logPrefix), "block", stageProgress)
+				break
+			}
 		}
-		block, _, err := cfg.blockReader.BlockWithSenders(ctx, tx, blockHash, blockNum)
-		if err != nil {
-			return err
+
+		block := nextBlock
+		if block == nil || block.NumberU64() != blockNum {
+			if block, _, err = readCanonicalBlock(ctx, tx, cfg.blockReader, blockNum); err != nil {
+				return err
+			}
 		}
+		nextBlock = nil
 		if block == nil {
 			log.Error(fmt.Sprintf("[%s] Empty block", logPrefix), "blocknum", blockNum)
 			break
 		}
+		if prefetcher != nil && blockNum < to {
+			var senders []common.Address
+			if nextBlock, senders, err = readCanonicalBlock(ctx, tx, cfg.blockReader, blockNum+1); err != nil {
+				return err
+			}
+			if nextBlock != nil {
+				prefetcher.Prefetch(newPrefetchTask(nextBlock, senders))
+			}
+		}
 
 		lastLogTx += uint64(block.Transactions().Len())
 
@@ -270,7 +353,7 @@ Loop:
 				// TODO: This creates stacked up deferrals
 				defer tx.Rollback()
 			}
-			batch = olddb.NewBatch(tx, quit)
+			batch = olddb.NewBatch(tx, nil)
 			// TODO: This creates stacked up deferrals
 			defer batch.Rollback()
 		}
@@ -283,7 +366,7 @@ Loop:
 			logBlock, logTx, logTime = logProgress(logPrefix, logBlock, logTime, blockNum, logTx, lastLogTx, gas, batch)
 			gas = 0
 			tx.CollectMetrics()
-			syncMetrics[stages.Execution].Set(blockNum)
+			stageMetrics(s.state.chainName())[stages.Execution].Set(blockNum)
 		}
 	}
 
@@ -304,6 +387,14 @@ Loop:
 	return stoppedErr
 }
 
+func readCanonicalBlock(ctx context.Context, tx kv.Tx, blockReader interfaces.FullBlockReader, blockNum uint64) (*types.Block, []common.Address, error) {
+	blockHash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+	if err != nil {
+		return nil, nil, err
+	}
+	return blockReader.BlockWithSenders(ctx, tx, blockHash, blockNum)
+}
+
 func logProgress(logPrefix string, prevBlock uint64, prevTime time.Time, currentBlock uint64, prevTx, currentTx uint64, gas uint64, batch ethdb.DbWithPendingMutations) (uint64, uint64, time.Time) {
 	currentTime := time.Now()
 	interval := currentTime.Sub(prevTime)
@@ -385,7 +476,16 @@ func unwindExecutionStage(u *UnwindState, s *StageState, tx kv.RwTx, quit <-chan
 		return fmt.Errorf("getting rewind data: %w", errRewind)
 	}
 
+	var backendWriter state.WriterWithChangeSets
+	if cfg.stateBackend != nil {
+		backendWriter = cfg.stateBackend.Writer(u.UnwindPoint)
+	}
 	if err := changes.Load(tx, stateBucket, func(k, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
+		if backendWriter != nil {
+			if err := unwindStateBackend(backendWriter, tx, k, v); err != nil {
+				return err
+			}
+		}
 		if len(k) == 20 {
 			if len(v) > 0 {
 				var acc accounts.Account
@@ -456,7 +556,15 @@ func unwindExecutionStage(u *UnwindState, s *StageState, tx kv.RwTx, quit <-chan
 	}, etl.TransformArgs{Quit: quit}); err != nil {
 		return err
 	}
+	if backendWriter != nil {
+		if err := backendWriter.WriteChangeSets(); err != nil {
+			return fmt.Errorf("unwind of state backend: %w", err)
+		}
+	}
 
+	if err := truncateCodeHistory(tx, u.UnwindPoint+1, s.BlockNumber); err != nil {
+		return err
+	}
 	if err := changeset.Truncate(tx, u.UnwindPoint+1); err != nil {
 		return err
 	}
@@ -484,8 +592,14 @@ func unwindExecutionStage(u *UnwindState, s *StageState, tx kv.RwTx, quit <-chan
 			return err
 		}
 	}
+	if err = truncateCallSelectorSet(tx, u.UnwindPoint+1); err != nil {
+		return err
+	}
+	if err = truncateTxCallSet(tx, u.UnwindPoint+1); err != nil {
+		return err
+	}
 
-	return nil
+	return truncateStateAccessSet(tx, u.UnwindPoint+1)
 }
 
 func recoverCodeHashPlain(acc *accounts.Account, db kv.Tx, key []byte) {
@@ -498,6 +612,68 @@ func recoverCodeHashPlain(acc *accounts.Account, db kv.Tx, key []byte) {
 	}
 }
 
+// unwindStateBackend - sends value restored by unwind to state backend, original is the value before unwind
+func unwindStateBackend(w state.StateWriter, tx kv.Tx, k, v []byte) error {
+	if len(k) == length.Addr {
+		var address common.Address
+		copy(address[:], k)
+		original, err := state.NewPlainStateReader(tx).ReadAccountData(address)
+		if err != nil {
+			return err
+		}
+		if len(v) == 0 {
+			return w.DeleteAccount(address, original)
+		}
+		var acc accounts.Account
+		if err = acc.DecodeForStorage(v); err != nil {
+			return err
+		}
+		recoverCodeHashPlain(&acc, tx, k)
+		return w.UpdateAccountData(address, original, &acc)
+	}
+	storageKey := k[:length.Addr+length.Incarnation+length.Hash]
+	enc, err := tx.GetOne(kv.PlainState, storageKey)
+	if err != nil {
+		return err
+	}
+	var address common.Address
+	var location common.Hash
+	copy(address[:], storageKey)
+	copy(location[:], storageKey[length.Addr+length.Incarnation:])
+	incarnation := binary.BigEndian.Uint64(storageKey[length.Addr:])
+	return w.WriteAccountStorage(address, incarnation, &location, new(uint256.Int).SetBytes(enc), new(uint256.Int).SetBytes(v))
+}
+
+// laggingHead - highest block which may be executed when node deliberately follows chain headLag blocks behind
+// head: the one headLag blocks deep or the safe block of consensus layer, whichever is higher
+func laggingHead(tx kv.Tx, headLag uint64) (uint64, error) {
+	headersProgress, err := stages.GetStageProgress(tx, stages.Headers)
+	if err != nil {
+		return 0, err
+	}
+	var lagging uint64
+	if headersProgress > headLag {
+		lagging = headersProgress - headLag
+	}
+	safeHash := rawdb.ReadForkchoiceSafe(tx)
+	if safeHash == (common.Hash{}) {
+		return lagging, nil
+	}
+	safeNum := rawdb.ReadHeaderNumber(tx, safeHash)
+	if safeNum == nil || *safeNum <= lagging || *safeNum > headersProgress {
+		return lagging, nil
+	}
+	// safe block of other fork doesn't make canonical blocks safe
+	canonical, err := rawdb.ReadCanonicalHash(tx, *safeNum)
+	if err != nil {
+		return 0, err
+	}
+	if canonical != safeHash {
+		return lagging, nil
+	}
+	return *safeNum, nil
+}
+
 func min(a, b uint64) uint64 {
 	if a <= b {
 		return a
@@ -506,7 +682,6 @@ func min(a, b uint64) uint64 {
 }
 
 func PruneExecutionStage(s *PruneState, tx kv.RwTx, cfg ExecuteBlockCfg, ctx context.Context, initialCycle bool) (err error) {
-	logPrefix := s.LogPrefix()
 	useExternalTx := tx != nil
 	if !useExternalTx {
 		tx, err = cfg.db.BeginRw(ctx)
@@ -520,24 +695,27 @@ func PruneExecutionStage(s *PruneState, tx kv.RwTx, cfg ExecuteBlockCfg, ctx con
 	defer logEvery.Stop()
 
 	if cfg.prune.History.Enabled() {
-		if err = PruneTableDupSort(tx, kv.AccountChangeSet, logPrefix, cfg.prune.History.PruneTo(s.ForwardProgress), logEvery, ctx); err != nil {
+		if err = PruneTableDupSort(tx, kv.AccountChangeSet, s, cfg.prune.History.PruneTo(s.ForwardProgress), logEvery, ctx); err != nil {
 			return err
 		}
-		if err = PruneTableDupSort(tx, kv.StorageChangeSet, logPrefix, cfg.prune.History.PruneTo(s.ForwardProgress), logEvery, ctx); err != nil {
+		if err = PruneTableDupSort(tx, kv.StorageChangeSet, s, cfg.prune.History.PruneTo(s.ForwardProgress), logEvery, ctx); err != nil {
 			return err
 		}
 	}
 
 	if cfg.prune.Receipts.Enabled() {
-		if err = PruneTable(tx, kv.Receipts, logPrefix, cfg.prune.Receipts.PruneTo(s.ForwardProgress), logEvery, ctx); err != nil {
+		if err = PruneTable(tx, kv.Receipts, s, cfg.prune.Receipts.PruneTo(s.ForwardProgress), logEvery, ctx); err != nil {
 			return err
 		}
-		if err = PruneTable(tx, kv.Log, logPrefix, cfg.prune.Receipts.PruneTo(s.ForwardProgress), logEvery, ctx); err != nil {
+		if err = PruneTable(tx, kv.Log, s, cfg.prune.Receipts.PruneTo(s.ForwardProgress), logEvery, ctx); err != nil {
 			return err
 		}
 	}
 	if cfg.prune.CallTraces.Enabled() {
-		if err = PruneTableDupSort(tx, kv.CallTraceSet, logPrefix, cfg.prune.CallTraces.PruneTo(s.ForwardProgress), logEvery, ctx); err != nil {
+		if err = PruneTableDupSort(tx, kv.CallTraceSet, s, cfg.prune.CallTraces.PruneTo(s.ForwardProgress), logEvery, ctx); err != nil {
+			return err
+		}
+		if err = PruneTableDupSort(tx, rawdb.CallSelectorSet, s, cfg.prune.CallTraces.PruneTo(s.ForwardProgress), logEvery, ctx); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,137 @@
+package stagedsync
+
+import (
+	"context"
+	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/log/v3"
+)
+
+var (
+	prefetchedBlocks = metrics.GetOrCreateCounter(`exec_prefetch_blocks`)
+	prefetchSkipped  = metrics.GetOrCreateCounter(`exec_prefetch_skipped`) // prefetcher was busy with previous block
+)
+
+// prefetchTask - state which transactions of block will surely touch
+type prefetchTask struct {
+	blockNum uint64
+	accounts []common.Address
+	storage  []prefetchSlot
+}
+
+type prefetchSlot struct {
+	address common.Address
+	key     common.Hash
+}
+
+// newPrefetchTask - coinbase, senders, recipients and access lists of block. Collected by caller, so prefetcher
+// doesn't share block with execution
+func newPrefetchTask(block *types.Block, senders []common.Address) *prefetchTask {
+	t := &prefetchTask{blockNum: block.NumberU64(), accounts: make([]common.Address, 0, 1+len(senders)+block.Transactions().Len())}
+	t.accounts = append(t.accounts, block.Coinbase())
+	t.accounts = append(t.accounts, senders...)
+	for _, txn := range block.Transactions() {
+		if to := txn.GetTo(); to != nil {
+			t.accounts = append(t.accounts, *to)
+		}
+		for _, tuple := range txn.GetAccessList() {
+			t.accounts = append(t.accounts, tuple.Address)
+			for _, key := range tuple.StorageKeys {
+				t.storage = append(t.storage, prefetchSlot{address: tuple.Address, key: key})
+			}
+		}
+	}
+	return t
+}
+
+// execPrefetcher - reads state of next block while current block executes. On cold cache each MDBX read of
+// execution is a page fault, prefetcher moves these pages into OS page cache in advance. It uses own read
+// transaction, which sees only committed state: results are discarded, it's enough to touch pages.
+type execPrefetcher struct {
+	db    kv.RoDB
+	tasks chan *prefetchTask
+	quit  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newExecPrefetcher(db kv.RoDB) *execPrefetcher {
+	p := &execPrefetcher{db: db, tasks: make(chan *prefetchTask, 1), quit: make(chan struct{})}
+	p.wg.Add(1)
+	go p.loop()
+	return p
+}
+
+// Prefetch - doesn't block execution: task is dropped if prefetcher didn't finish previous one
+func (p *execPrefetcher) Prefetch(task *prefetchTask) {
+	select {
+	case p.tasks <- task:
+	default:
+		prefetchSkipped.Inc()
+	}
+}
+
+func (p *execPrefetcher) Close() {
+	close(p.quit)
+	p.wg.Wait()
+}
+
+func (p *execPrefetcher) loop() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.quit:
+			return
+		case task := <-p.tasks:
+			// new transaction for each block: long read transaction doesn't allow MDBX to reuse free pages
+			if err := p.db.View(context.Background(), func(tx kv.Tx) error { return p.prefetch(tx, task) }); err != nil {
+				log.Debug("[Execution] prefetch failed", "block", task.blockNum, "err", err)
+				continue
+			}
+			prefetchedBlocks.Inc()
+		}
+	}
+}
+
+func (p *execPrefetcher) prefetch(tx kv.Tx, task *prefetchTask) error {
+	r := state.NewPlainStateReader(tx)
+	incarnations := make(map[common.Address]uint64, len(task.accounts))
+	for _, addr := range task.accounts {
+		if _, ok := incarnations[addr]; ok {
+			continue
+		}
+		select {
+		case <-p.quit:
+			return nil
+		default:
+		}
+		acc, err := r.ReadAccountData(addr)
+		if err != nil {
+			return err
+		}
+		if acc == nil {
+			incarnations[addr] = 0
+			continue
+		}
+		incarnations[addr] = acc.Incarnation
+		recoverCodeHashPlain(acc, tx, addr[:])
+		if _, err = r.ReadAccountCode(addr, acc.Incarnation, acc.CodeHash); err != nil {
+			return err
+		}
+	}
+	for i := range task.storage {
+		slot := &task.storage[i]
+		inc := incarnations[slot.address]
+		if inc == 0 {
+			continue
+		}
+		if _, err := r.ReadAccountStorage(slot.address, inc, &slot.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,14 +2,24 @@ package stagedsync
 
 import (
 	"context"
+	"math/big"
 	"testing"
 
+	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/changeset"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb/dbstats"
 	"github.com/ledgerwatch/erigon/ethdb/prune"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestUnwindExecutionStagePlainStatic(t *testing.T) {
@@ -121,3 +131,78 @@ func TestPruneExecution(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal(uint64(45), available)
 }
+
+func TestExecPrefetch(t *testing.T) {
+	require := require.New(t)
+	coinbase, sender, contract := common.HexToAddress("0x01"), common.HexToAddress("0x02"), common.HexToAddress("0x03")
+	slot := common.HexToHash("0x04")
+	code := []byte{0x60, 0x00}
+	access := dbstats.NewAccess(0, 0)
+	db := dbstats.NewAccessDB(memdb.NewTestDB(t), access)
+	require.NoError(db.Update(context.Background(), func(tx kv.RwTx) error {
+		acc := accounts.NewAccount()
+		acc.Incarnation = 1
+		acc.CodeHash = crypto.Keccak256Hash(code)
+		w := state.NewPlainStateWriterNoHistory(tx)
+		if err := w.UpdateAccountData(contract, &accounts.Account{}, &acc); err != nil {
+			return err
+		}
+		if err := w.UpdateAccountCode(contract, 1, acc.CodeHash, code); err != nil {
+			return err
+		}
+		return w.WriteAccountStorage(contract, 1, &slot, uint256.NewInt(0), uint256.NewInt(1))
+	}))
+	access.Reset()
+
+	txn := &types.AccessListTx{
+		LegacyTx:   types.LegacyTx{CommonTx: types.CommonTx{To: &contract, Value: uint256.NewInt(0)}, GasPrice: uint256.NewInt(0)},
+		ChainID:    uint256.NewInt(1),
+		AccessList: types.AccessList{{Address: contract, StorageKeys: []common.Hash{slot}}},
+	}
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1), Coinbase: coinbase}, []types.Transaction{txn}, nil, nil)
+	task := newPrefetchTask(block, []common.Address{sender})
+	require.Equal([]common.Address{coinbase, sender, contract, contract}, task.accounts)
+
+	p := &execPrefetcher{quit: make(chan struct{})}
+	require.NoError(db.View(context.Background(), func(tx kv.Tx) error { return p.prefetch(tx, task) }))
+	stats := access.Stats(0)
+	reads := map[string]uint64{}
+	for _, t := range stats.Tables {
+		reads[t.Name] = t.Reads
+	}
+	// 3 accounts and 1 storage slot, code of contract
+	require.Equal(map[string]uint64{kv.PlainState: 4, kv.Code: 1}, reads)
+}
+
+func TestLaggingHead(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	var hashes []common.Hash
+	for i := uint64(0); i <= 100; i++ {
+		header := &types.Header{Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(1)}
+		rawdb.WriteHeader(tx, header)
+		require.NoError(t, rawdb.WriteCanonicalHash(tx, header.Hash(), i))
+		hashes = append(hashes, header.Hash())
+	}
+	require.NoError(t, stages.SaveStageProgress(tx, stages.Headers, 100))
+
+	lagging, err := laggingHead(tx, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(90), lagging)
+	lagging, err = laggingHead(tx, 200)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), lagging)
+
+	// safe block of consensus layer may be executed before it's deep enough
+	require.NoError(t, rawdb.WriteForkchoice(tx, hashes[100], hashes[95], hashes[80], 1))
+	lagging, err = laggingHead(tx, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(95), lagging)
+
+	// safe block of other fork is ignored
+	fork := &types.Header{Number: big.NewInt(97), Difficulty: big.NewInt(2)}
+	rawdb.WriteHeader(tx, fork)
+	require.NoError(t, rawdb.WriteForkchoice(tx, hashes[100], fork.Hash(), hashes[80], 2))
+	lagging, err = laggingHead(tx, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(90), lagging)
+}
@@ -136,6 +136,10 @@ func NotifyNewHeaders(ctx context.Context, finishStageBeforeSync uint64, finishS
 		if len(headerRLP) == 0 {
 			return nil
 		}
+		if binary.BigEndian.Uint64(k) > finishStageAfterSync {
+			// not executed yet: node follows chain with lag
+			return nil
+		}
 		header := new(types.Header)
 		if err := rlp.Decode(bytes.NewReader(headerRLP), header); err != nil {
 			log.Error("Invalid block header RLP", "err", err)
@@ -0,0 +1,248 @@
+package stagedsync
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/interfaces"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/firehose"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// Firehose stage streams executed blocks to firehose.Sink. Progress of the stage is the last block delivered to the
+// sink: it's saved only after the sink flushed, so delivery is at least once. Unwind sends undo message.
+// Failure of the sink doesn't fail the stage, chain sync goes on: the stream stays behind and is retried from the last
+// flushed block in the next cycle, firehose_lag_blocks shows how far it is behind.
+
+var (
+	firehoseLag        uint64 // executed (and confirmed) blocks not delivered to the sink yet
+	firehoseSinkErrors = metrics.GetOrCreateCounter(`firehose_sink_errors`)
+	_                  = metrics.GetOrCreateGauge(`firehose_lag_blocks`, func() float64 {
+		return float64(atomic.LoadUint64(&firehoseLag))
+	})
+)
+
+// sinkError - failure of the sink, the stage stays behind instead of failing
+type sinkError struct{ err error }
+
+func (e sinkError) Error() string { return e.err.Error() }
+func (e sinkError) Unwrap() error { return e.err }
+
+type FirehoseCfg struct {
+	db            kv.RwDB
+	sink          firehose.Sink
+	confirmations uint64
+	chainConfig   *params.ChainConfig
+	blockReader   interfaces.FullBlockReader
+	resumed       *bool // resume token of the sink is checked once, when the stage runs first time
+}
+
+func StageFirehoseCfg(db kv.RwDB, sink firehose.Sink, confirmations uint64, chainConfig *params.ChainConfig, blockReader interfaces.FullBlockReader) FirehoseCfg {
+	return FirehoseCfg{
+		db:            db,
+		sink:          sink,
+		confirmations: confirmations,
+		chainConfig:   chainConfig,
+		blockReader:   blockReader,
+		resumed:       new(bool),
+	}
+}
+
+func (cfg FirehoseCfg) enabled() bool {
+	return cfg.sink != nil
+}
+
+func SpawnFirehoseStage(s *StageState, tx kv.RwTx, cfg FirehoseCfg, ctx context.Context) (err error) {
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	executed, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return err
+	}
+	if executed < cfg.confirmations {
+		return nil
+	}
+	endBlock := executed - cfg.confirmations
+	// call traces are read from their stage, state diffs are computed over history
+	for _, stage := range []stages.SyncStage{stages.CallTraces, stages.AccountHistoryIndex, stages.StorageHistoryIndex} {
+		progress, err := stages.GetStageProgress(tx, stage)
+		if err != nil {
+			return err
+		}
+		if progress < endBlock {
+			endBlock = progress
+		}
+	}
+	diffsStored, err := stages.GetStageProgress(tx, stages.StateDiffs)
+	if err != nil {
+		return err
+	}
+
+	logPrefix := s.LogPrefix()
+	delivered := s.BlockNumber
+	if !*cfg.resumed {
+		resumed, err := resumeFirehose(logPrefix, tx, cfg, delivered, endBlock)
+		if _, ok := err.(sinkError); ok {
+			firehoseSinkErrors.Inc()
+			log.Warn(fmt.Sprintf("[%s] Sink is unavailable, retry in the next cycle", logPrefix), "err", err, "lag", updateFirehoseLag(endBlock, delivered))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		delivered = resumed
+		*cfg.resumed = true
+	}
+	if endBlock > delivered+16 {
+		log.Info(fmt.Sprintf("[%s] Streaming blocks", logPrefix), "from", delivered+1, "to", endBlock)
+	}
+	logEvery := time.NewTicker(logInterval)
+	defer logEvery.Stop()
+	flushed := delivered
+	var sinkErr error
+	for blockNum := delivered + 1; blockNum <= endBlock; blockNum++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-logEvery.C:
+			log.Info(fmt.Sprintf("[%s] Progress", logPrefix), "number", blockNum)
+		default:
+		}
+		block, senders, err := readCanonicalBlock(ctx, tx, cfg.blockReader, blockNum)
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			return fmt.Errorf("[%s] block %d not found", logPrefix, blockNum)
+		}
+		msg, err := firehose.NewBlock(ctx, tx, cfg.chainConfig, block, senders, blockNum <= diffsStored)
+		if err != nil {
+			return fmt.Errorf("[%s] %w", logPrefix, err)
+		}
+		if err = cfg.sink.Send(msg); err != nil {
+			sinkErr = fmt.Errorf("send block %d: %w", blockNum, err)
+			break
+		}
+		delivered = blockNum
+	}
+	if sinkErr == nil {
+		if err = cfg.sink.Flush(); err != nil {
+			sinkErr = fmt.Errorf("flush: %w", err)
+		}
+	}
+	if sinkErr != nil {
+		// messages after the last flush may be lost by the sink, they are sent again
+		firehoseSinkErrors.Inc()
+		log.Warn(fmt.Sprintf("[%s] Sink is unavailable, retry in the next cycle", logPrefix), "err", sinkErr, "lag", updateFirehoseLag(endBlock, flushed))
+		delivered = flushed
+	} else {
+		updateFirehoseLag(endBlock, delivered)
+	}
+	if err = s.Update(tx, delivered); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateFirehoseLag - sets and returns firehose_lag_blocks
+func updateFirehoseLag(endBlock, delivered uint64) uint64 {
+	var lag uint64
+	if endBlock > delivered {
+		lag = endBlock - delivered
+	}
+	atomic.StoreUint64(&firehoseLag, lag)
+	return lag
+}
+
+// resumeFirehose - the last block delivered to the sink, by its resume token. Sink may be behind the stage (restored
+// from backup) or ahead of it (it flushed, but progress of the stage wasn't committed, or the node unwound since).
+func resumeFirehose(logPrefix string, tx kv.Tx, cfg FirehoseCfg, delivered, endBlock uint64) (uint64, error) {
+	token, err := cfg.sink.Resume()
+	if err != nil {
+		return 0, sinkError{fmt.Errorf("resume token of the sink: %w", err)}
+	}
+	if token == nil || token.Number == delivered {
+		return delivered, nil
+	}
+	hash, err := rawdb.ReadCanonicalHash(tx, token.Number)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case hash == token.Hash && token.Number <= endBlock:
+		log.Info(fmt.Sprintf("[%s] Continue from resume token of the sink", logPrefix), "token", token, "progress", delivered)
+		return token.Number, nil
+	case token.Number > delivered:
+		log.Info(fmt.Sprintf("[%s] Sink is ahead, undo", logPrefix), "token", token, "progress", delivered)
+		undo, err := firehose.NewUndo(tx, delivered)
+		if err != nil {
+			return 0, err
+		}
+		if err = cfg.sink.Send(undo); err != nil {
+			return 0, sinkError{fmt.Errorf("send undo: %w", err)}
+		}
+		if err = cfg.sink.Flush(); err != nil {
+			return 0, sinkError{fmt.Errorf("flush undo: %w", err)}
+		}
+		return delivered, nil
+	default:
+		return 0, fmt.Errorf("[%s] resume token %s of the sink is not on the canonical chain, reset the sink", logPrefix, token)
+	}
+}
+
+func UnwindFirehoseStage(u *UnwindState, s *StageState, tx kv.RwTx, cfg FirehoseCfg, ctx context.Context) (err error) {
+	if s.BlockNumber <= u.UnwindPoint {
+		return nil
+	}
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	undo, err := firehose.NewUndo(tx, u.UnwindPoint)
+	if err != nil {
+		return err
+	}
+	if err = cfg.sink.Send(undo); err == nil {
+		err = cfg.sink.Flush()
+	}
+	if err != nil {
+		// undo is sent when the sink is available again: its resume token is compared with the canonical chain
+		firehoseSinkErrors.Inc()
+		log.Warn(fmt.Sprintf("[%s] Sink is unavailable, undo is postponed", u.LogPrefix()), "err", err, "unwindPoint", u.UnwindPoint)
+		*cfg.resumed = false
+	}
+	if err = u.Done(tx); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
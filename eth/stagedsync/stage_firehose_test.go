@@ -0,0 +1,76 @@
+package stagedsync
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/turbo/firehose"
+	"github.com/stretchr/testify/require"
+)
+
+// unreliableSink - keeps flushed messages, fails while down
+type unreliableSink struct {
+	down            bool
+	token           *firehose.Token
+	pending, stored []*firehose.Message
+}
+
+var errSinkDown = errors.New("sink is down")
+
+func (s *unreliableSink) Send(msg *firehose.Message) error {
+	if s.down {
+		return errSinkDown
+	}
+	s.pending = append(s.pending, msg)
+	return nil
+}
+
+func (s *unreliableSink) Flush() error {
+	if s.down {
+		s.pending = nil
+		return errSinkDown
+	}
+	s.stored, s.pending = append(s.stored, s.pending...), nil
+	return nil
+}
+
+func (s *unreliableSink) Resume() (*firehose.Token, error) {
+	if s.down {
+		return nil, errSinkDown
+	}
+	return s.token, nil
+}
+
+func (s *unreliableSink) Close() error { return nil }
+
+func TestFirehoseSinkFailure(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	_, tx := memdb.NewTestTx(t)
+	sink := &unreliableSink{down: true, token: &firehose.Token{Number: 5, Hash: common.Hash{5}}}
+	cfg := StageFirehoseCfg(nil, sink, 0, nil, nil)
+
+	// sink is down when the node starts: the stage doesn't fail and asks for the token again
+	require.NoError(SpawnFirehoseStage(&StageState{ID: stages.Firehose, BlockNumber: 5}, tx, cfg, ctx))
+	require.False(*cfg.resumed)
+
+	// undo during the outage is postponed, progress of the stage is unwound
+	s := &StageState{ID: stages.Firehose, BlockNumber: 5}
+	require.NoError(UnwindFirehoseStage(&UnwindState{ID: stages.Firehose, UnwindPoint: 2}, s, tx, cfg, ctx))
+	progress, err := stages.GetStageProgress(tx, stages.Firehose)
+	require.NoError(err)
+	require.Equal(uint64(2), progress)
+	require.Empty(sink.stored)
+
+	// sink is back with the token of block 5, which is not canonical anymore: undo is sent
+	sink.down = false
+	require.NoError(SpawnFirehoseStage(&StageState{ID: stages.Firehose, BlockNumber: 2}, tx, cfg, ctx))
+	require.True(*cfg.resumed)
+	require.Len(sink.stored, 1)
+	require.Equal(firehose.UndoMessage, sink.stored[0].Kind)
+	require.Equal(uint64(2), sink.stored[0].Number)
+}
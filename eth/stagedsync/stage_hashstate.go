@@ -17,6 +17,7 @@ import (
 	"github.com/ledgerwatch/erigon/common/changeset"
 	"github.com/ledgerwatch/erigon/common/dbutils"
 	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/turbo/etlbudget"
 	"github.com/ledgerwatch/log/v3"
 )
 
@@ -157,12 +158,10 @@ func readPlainStateOnce(
 	loadFunc etl.LoadFunc,
 	quit <-chan struct{},
 ) error {
-	bufferSize := etl.BufferOptimalSize
-
-	accCollector := etl.NewCollector(logPrefix, tmpdir, etl.NewSortableBuffer(bufferSize))
-	defer accCollector.Close()
-	storageCollector := etl.NewCollector(logPrefix, tmpdir, etl.NewSortableBuffer(bufferSize))
-	defer storageCollector.Close()
+	accCollector, closeAccCollector := etlbudget.NewCollector(logPrefix, tmpdir)
+	defer closeAccCollector()
+	storageCollector, closeStorageCollector := etlbudget.NewCollector(logPrefix, tmpdir)
+	defer closeStorageCollector()
 
 	t := time.Now()
 	logEvery := time.NewTicker(30 * time.Second)
@@ -491,6 +490,8 @@ func (p *Promoter) Promote(logPrefix string, s *StageState, from, to uint64, sto
 		extract = getExtractFunc(p.db, changeSetBucket)
 	}
 
+	lease := etlbudget.Default.Acquire(logPrefix)
+	defer lease.Release()
 	if err := etl.Transform(
 		logPrefix,
 		p.db,
@@ -501,6 +502,7 @@ func (p *Promoter) Promote(logPrefix string, s *StageState, from, to uint64, sto
 		etl.IdentityLoadFunc,
 		etl.TransformArgs{
 			BufferType:      etl.SortableOldestAppearedBuffer,
+			BufferSize:      int(lease.Size()),
 			ExtractStartKey: startkey,
 			Quit:            p.quitCh,
 		},
@@ -543,6 +545,8 @@ func (p *Promoter) Unwind(logPrefix string, s *StageState, u *UnwindState, stora
 		}
 	}
 
+	lease := etlbudget.Default.Acquire(logPrefix)
+	defer lease.Release()
 	return etl.Transform(
 		logPrefix,
 		p.db,
@@ -553,6 +557,7 @@ func (p *Promoter) Unwind(logPrefix string, s *StageState, u *UnwindState, stora
 		l.LoadFunc,
 		etl.TransformArgs{
 			BufferType:      etl.SortableOldestAppearedBuffer,
+			BufferSize:      int(lease.Size()),
 			ExtractStartKey: startkey,
 			Quit:            p.quitCh,
 			LogDetailsExtract: func(k, v []byte) (additionalLogArguments []interface{}) {
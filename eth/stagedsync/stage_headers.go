@@ -9,6 +9,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/VictoriaMetrics/metrics"
 	"github.com/c2h5oh/datasize"
 	"github.com/holiman/uint256"
 	libcommon "github.com/ledgerwatch/erigon-lib/common"
@@ -19,6 +20,7 @@ import (
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/interfaces"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/consensus/bor"
 	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
@@ -36,7 +38,7 @@ type HeadersCfg struct {
 	db                kv.RwDB
 	hd                *headerdownload.HeaderDownload
 	statusCh          chan privateapi.ExecutionStatus
-	chainConfig       params.ChainConfig
+	chainConfig       *params.ChainConfig
 	headerReqSend     func(context.Context, *headerdownload.HeaderRequest) (enode.ID, bool)
 	announceNewHashes func(context.Context, []headerdownload.Announce)
 	penalize          func(context.Context, []headerdownload.PenaltyItem)
@@ -49,13 +51,15 @@ type HeadersCfg struct {
 	snapshots          *snapshotsync.AllSnapshots
 	snapshotDownloader proto_downloader.DownloaderClient
 	blockReader        interfaces.FullBlockReader
+
+	staleForksRetention uint64 // non-canonical blocks older than finalized by more blocks are deleted, 0 - never
 }
 
 func StageHeadersCfg(
 	db kv.RwDB,
 	headerDownload *headerdownload.HeaderDownload,
 	statusCh chan privateapi.ExecutionStatus,
-	chainConfig params.ChainConfig,
+	chainConfig *params.ChainConfig,
 	headerReqSend func(context.Context, *headerdownload.HeaderRequest) (enode.ID, bool),
 	announceNewHashes func(context.Context, []headerdownload.Announce),
 	penalize func(context.Context, []headerdownload.PenaltyItem),
@@ -67,6 +71,7 @@ func StageHeadersCfg(
 	snapshotDownloader proto_downloader.DownloaderClient,
 	blockReader interfaces.FullBlockReader,
 	tmpdir string,
+	staleForksRetention uint64,
 ) HeadersCfg {
 	return HeadersCfg{
 		db:                 db,
@@ -83,6 +88,8 @@ func StageHeadersCfg(
 		snapshots:          snapshots,
 		snapshotDownloader: snapshotDownloader,
 		blockReader:        blockReader,
+
+		staleForksRetention: staleForksRetention,
 	}
 }
 
@@ -153,12 +160,21 @@ func HeadersPOS(
 
 	// TODO(yperbasis): handle re-orgs properly
 	if s.BlockNumber >= headerNumber && headerHash != existingHash {
+		headHash, err := rawdb.ReadCanonicalHash(tx, s.BlockNumber)
+		if err != nil {
+			cfg.statusCh <- privateapi.ExecutionStatus{Error: err}
+			return err
+		}
+		if err = writeReorg(tx, s.BlockNumber, headHash, headerNumber, headerHash, headerNumber-1); err != nil {
+			cfg.statusCh <- privateapi.ExecutionStatus{Error: err}
+			return err
+		}
 		u.UnwindTo(headerNumber-1, common.Hash{})
 		cfg.statusCh <- privateapi.ExecutionStatus{Status: privateapi.Syncing}
 		return nil
 	}
 	// Set chain header reader right
-	cfg.hd.SetHeaderReader(&chainReader{config: &cfg.chainConfig, tx: tx, blockReader: cfg.blockReader})
+	cfg.hd.SetHeaderReader(&chainReader{config: cfg.chainConfig, tx: tx, blockReader: cfg.blockReader})
 
 	logPrefix := s.LogPrefix()
 	logEvery := time.NewTicker(logInterval)
@@ -249,7 +265,7 @@ func HeadersPOS(
 			maxRequests--
 		}
 
-		if cfg.hd.Synced() { // We do not break unless there best header changed
+		if cfg.hd.Synced() || cfg.hd.CheckpointMismatch() { // We do not break unless there best header changed
 			stopped = true
 		}
 		// Sleep and check for logs
@@ -270,6 +286,10 @@ func HeadersPOS(
 		// Cleanup timer
 		timer.Stop()
 	}
+	if cfg.hd.CheckpointMismatch() {
+		log.Error(fmt.Sprintf("[%s] Payload is not descendant of finalized block, headers are not inserted", logPrefix), "number", headerNumber, "hash", headerHash)
+		return nil
+	}
 	// If the user stopped it, we don't update anything
 	if !cfg.hd.Synced() {
 		return nil
@@ -376,7 +396,10 @@ func HeadersPOW(
 		return fmt.Errorf("localTD is nil: %d, %x", headerProgress, hash)
 	}
 	headerInserter := headerdownload.NewHeaderInserter(logPrefix, localTd, headerProgress)
-	cfg.hd.SetHeaderReader(&chainReader{config: &cfg.chainConfig, tx: tx, blockReader: cfg.blockReader})
+	if borConfig := cfg.chainConfig.Bor; borConfig != nil {
+		headerInserter.SetFinality(func(head uint64) uint64 { return bor.FinalizedBlock(borConfig, head) })
+	}
+	cfg.hd.SetHeaderReader(&chainReader{config: cfg.chainConfig, tx: tx, blockReader: cfg.blockReader})
 
 	var sentToPeer bool
 	stopped := false
@@ -460,6 +483,8 @@ Loop:
 		select {
 		case <-ctx.Done():
 			stopped = true
+		case <-s.Stopping():
+			stopped = true
 		case <-logEvery.C:
 			progress := cfg.hd.Progress()
 			logProgressHeaders(logPrefix, prevProgress, progress)
@@ -474,6 +499,9 @@ Loop:
 		timer.Stop()
 	}
 	if headerInserter.Unwind() {
+		if err := writeReorg(tx, headerProgress, hash, headerInserter.GetHighest(), headerInserter.GetHighestHash(), headerInserter.UnwindPoint()); err != nil {
+			return err
+		}
 		u.UnwindTo(headerInserter.UnwindPoint(), common.Hash{})
 	} else if headerInserter.GetHighest() != 0 {
 		if err := fixCanonicalChain(logPrefix, logEvery, headerInserter.GetHighest(), headerInserter.GetHighestHash(), tx, cfg.blockReader); err != nil {
@@ -494,6 +522,28 @@ Loop:
 	return nil
 }
 
+// writeReorg - records reorg into rawdb.ReorgLog before the unwind to common ancestor
+func writeReorg(tx kv.RwTx, oldHeight uint64, oldHash common.Hash, newHeight uint64, newHash common.Hash, ancestorHeight uint64) error {
+	ancestorHash, err := rawdb.ReadCanonicalHash(tx, ancestorHeight)
+	if err != nil {
+		return err
+	}
+	reorg := &rawdb.Reorg{
+		OldHeadNumber:  oldHeight,
+		OldHeadHash:    oldHash,
+		NewHeadNumber:  newHeight,
+		NewHeadHash:    newHash,
+		AncestorNumber: ancestorHeight,
+		AncestorHash:   ancestorHash,
+		Time:           uint64(time.Now().Unix()),
+	}
+	if err = rawdb.WriteReorg(tx, reorg); err != nil {
+		return fmt.Errorf("writing reorg: %w", err)
+	}
+	log.Info("Chain reorg", "id", reorg.ID, "depth", reorg.Depth(), "oldHead", oldHeight, "newHead", newHeight, "ancestor", ancestorHeight)
+	return nil
+}
+
 func fixCanonicalChain(logPrefix string, logEvery *time.Ticker, height uint64, hash common.Hash, tx kv.StatelessRwTx, headerReader interfaces.FullBlockReader) error {
 	if height == 0 {
 		return nil
@@ -724,6 +774,12 @@ func HeadersPrune(p *PruneState, tx kv.RwTx, cfg HeadersCfg, ctx context.Context
 		defer tx.Rollback()
 	}
 
+	if cfg.staleForksRetention > 0 {
+		if err = pruneStaleForks(p, tx, cfg); err != nil {
+			return err
+		}
+	}
+
 	if !useExternalTx {
 		if err = tx.Commit(); err != nil {
 			return err
@@ -732,6 +788,112 @@ func HeadersPrune(p *PruneState, tx kv.RwTx, cfg HeadersCfg, ctx context.Context
 	return nil
 }
 
+// pruneStaleForksBatch - amount of block numbers checked for stale forks per sync cycle
+const pruneStaleForksBatch = 100_000
+
+// staleForksMetrics - stale_forks_pruned_blocks{chain} and stale_forks_reclaimed_bytes{chain}
+func staleForksMetrics(chain string) (prunedBlocks, reclaimed *metrics.Counter) {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`stale_forks_pruned_blocks{chain=%q}`, chain)),
+		metrics.GetOrCreateCounter(fmt.Sprintf(`stale_forks_reclaimed_bytes{chain=%q}`, chain))
+}
+
+// finalizedBlock - block finalized by consensus layer, or, if there is none, head minus FullImmutabilityThreshold
+func finalizedBlock(tx kv.Getter) (uint64, error) {
+	head, err := stages.GetStageProgress(tx, stages.Headers)
+	if err != nil {
+		return 0, err
+	}
+	if hash := rawdb.ReadForkchoiceFinalized(tx); hash != (common.Hash{}) {
+		if number := rawdb.ReadHeaderNumber(tx, hash); number != nil && *number <= head {
+			return *number, nil
+		}
+	}
+	if head < params.FullImmutabilityThreshold {
+		return 0, nil
+	}
+	return head - params.FullImmutabilityThreshold, nil
+}
+
+// pruneStaleForks - deletes non-canonical blocks which are older than finalized block by more than retention,
+// and forgets them in header downloader
+func pruneStaleForks(p *PruneState, tx kv.RwTx, cfg HeadersCfg) error {
+	logPrefix := p.LogPrefix()
+	finalized, err := finalizedBlock(tx)
+	if err != nil {
+		return err
+	}
+	if finalized <= cfg.staleForksRetention {
+		return nil
+	}
+	pruneTo := finalized - cfg.staleForksRetention
+	from, err := rawdb.ReadStaleForksPrunedTo(tx)
+	if err != nil {
+		return err
+	}
+	isCanonical := func(hash common.Hash, number uint64) (bool, error) {
+		canonical, err := rawdb.ReadCanonicalHash(tx, number)
+		return canonical == hash, err
+	}
+	if cfg.hd != nil {
+		if _, err = cfg.hd.PruneStaleLinks(pruneTo, isCanonical); err != nil {
+			return err
+		}
+	}
+	if from >= pruneTo {
+		return nil
+	}
+	to := pruneTo
+	if to > from+pruneStaleForksBatch {
+		to = from + pruneStaleForksBatch
+	}
+
+	type block struct {
+		hash   common.Hash
+		number uint64
+	}
+	var stale []block
+	c, err := tx.Cursor(kv.Headers)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for k, _, err := c.Seek(dbutils.EncodeBlockNumber(from)); k != nil; k, _, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		number := binary.BigEndian.Uint64(k)
+		if number >= to {
+			break
+		}
+		hash := common.BytesToHash(k[8:])
+		canonical, err := isCanonical(hash, number)
+		if err != nil {
+			return err
+		}
+		if !canonical {
+			stale = append(stale, block{hash: hash, number: number})
+		}
+	}
+	var reclaimed uint64
+	for _, b := range stale {
+		deleted, err := rawdb.DeleteNonCanonicalBlock(tx, b.hash, b.number)
+		if err != nil {
+			return fmt.Errorf("delete non-canonical block %d %x: %w", b.number, b.hash, err)
+		}
+		reclaimed += deleted
+	}
+	if err = rawdb.WriteStaleForksPrunedTo(tx, to); err != nil {
+		return err
+	}
+	if len(stale) > 0 {
+		prunedBlocks, reclaimedBytes := staleForksMetrics(p.state.chainName())
+		prunedBlocks.Add(len(stale))
+		reclaimedBytes.Add(int(reclaimed))
+		log.Info(fmt.Sprintf("[%s] Deleted stale forks", logPrefix), "blocks", len(stale), "bytes", libcommon.ByteCount(reclaimed), "below", to)
+	}
+	return nil
+}
+
 func DownloadAndIndexSnapshotsIfNeed(s *StageState, ctx context.Context, tx kv.RwTx, cfg HeadersCfg) error {
 	if cfg.snapshots == nil {
 		return nil
@@ -841,13 +1003,17 @@ func DownloadAndIndexSnapshotsIfNeed(s *StageState, ctx context.Context, tx kv.R
 			return err
 		}
 
-		sn, ok := cfg.snapshots.Blocks(cfg.snapshots.BlocksAvailable())
+		sn, ok, err := cfg.snapshots.Blocks(cfg.snapshots.BlocksAvailable())
+		if err != nil {
+			return err
+		}
 		if !ok {
 			return fmt.Errorf("snapshot not found for block: %d", cfg.snapshots.BlocksAvailable())
 		}
 
 		// ResetSequence - allow set arbitrary value to sequence (for example to decrement it to exact value)
 		lastTxnID := sn.TxnHashIdx.BaseDataID() + uint64(sn.Transactions.Count())
+		sn.Release()
 		if err := rawdb.ResetSequence(tx, kv.EthTx, lastTxnID+1); err != nil {
 			return err
 		}
@@ -0,0 +1,49 @@
+package stagedsync
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneStaleForks(t *testing.T) {
+	require := require.New(t)
+	_, tx := memdb.NewTestTx(t)
+
+	// canonical chain 0..100, fork block at every height
+	var forks []common.Hash
+	for i := uint64(0); i <= 100; i++ {
+		canonical := &types.Header{Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(1)}
+		rawdb.WriteHeader(tx, canonical)
+		require.NoError(rawdb.WriteCanonicalHash(tx, canonical.Hash(), i))
+		fork := &types.Header{Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(2)}
+		rawdb.WriteHeader(tx, fork)
+		forks = append(forks, fork.Hash())
+	}
+	require.NoError(stages.SaveStageProgress(tx, stages.Headers, 100))
+	cfg := HeadersCfg{staleForksRetention: 10}
+
+	// no finalized block from consensus layer, chain is shorter than FullImmutabilityThreshold
+	require.NoError(pruneStaleForks(&PruneState{ID: stages.Headers}, tx, cfg))
+	require.NotNil(rawdb.ReadHeader(tx, forks[0], 0))
+
+	finalized, err := rawdb.ReadCanonicalHash(tx, 80)
+	require.NoError(err)
+	require.NoError(rawdb.WriteForkchoice(tx, common.Hash{}, common.Hash{}, finalized, 1))
+	require.NoError(pruneStaleForks(&PruneState{ID: stages.Headers}, tx, cfg))
+	for i := uint64(0); i <= 100; i++ {
+		canonical, err := rawdb.ReadCanonicalHash(tx, i)
+		require.NoError(err)
+		require.NotNil(rawdb.ReadHeader(tx, canonical, i))
+		require.Equal(i >= 70, rawdb.ReadHeader(tx, forks[i], i) != nil, i)
+	}
+	prunedTo, err := rawdb.ReadStaleForksPrunedTo(tx)
+	require.NoError(err)
+	require.Equal(uint64(70), prunedTo)
+}
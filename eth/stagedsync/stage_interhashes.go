@@ -18,6 +18,7 @@ import (
 	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/types/accounts"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/turbo/etlbudget"
 	"github.com/ledgerwatch/erigon/turbo/trie"
 	"github.com/ledgerwatch/log/v3"
 )
@@ -124,12 +125,12 @@ func RegenerateIntermediateHashes(logPrefix string, db kv.RwTx, cfg TrieCfg, exp
 	_ = db.ClearBucket(kv.TrieOfAccounts)
 	_ = db.ClearBucket(kv.TrieOfStorage)
 
-	accTrieCollector := etl.NewCollector(logPrefix, cfg.tmpDir, etl.NewSortableBuffer(etl.BufferOptimalSize))
-	defer accTrieCollector.Close()
+	accTrieCollector, closeAccTrieCollector := etlbudget.NewCollector(logPrefix, cfg.tmpDir)
+	defer closeAccTrieCollector()
 	accTrieCollectorFunc := accountTrieCollector(accTrieCollector)
 
-	stTrieCollector := etl.NewCollector(logPrefix, cfg.tmpDir, etl.NewSortableBuffer(etl.BufferOptimalSize))
-	defer stTrieCollector.Close()
+	stTrieCollector, closeStTrieCollector := etlbudget.NewCollector(logPrefix, cfg.tmpDir)
+	defer closeStTrieCollector()
 	stTrieCollectorFunc := storageTrieCollector(stTrieCollector)
 
 	loader := trie.NewFlatDBTrieLoader(logPrefix)
@@ -222,6 +223,8 @@ func (p *HashPromoter) Promote(logPrefix string, s *StageState, from, to uint64,
 	var l OldestAppearedLoad
 	l.innerLoadFunc = load
 
+	lease := etlbudget.Default.Acquire(logPrefix)
+	defer lease.Release()
 	if err := etl.Transform(
 		logPrefix,
 		p.db,
@@ -232,6 +235,7 @@ func (p *HashPromoter) Promote(logPrefix string, s *StageState, from, to uint64,
 		l.LoadFunc,
 		etl.TransformArgs{
 			BufferType:      etl.SortableOldestAppearedBuffer,
+			BufferSize:      int(lease.Size()),
 			ExtractStartKey: startkey,
 			Quit:            p.quitCh,
 		},
@@ -308,6 +312,8 @@ func (p *HashPromoter) Unwind(logPrefix string, s *StageState, u *UnwindState, s
 	var l OldestAppearedLoad
 	l.innerLoadFunc = load
 
+	lease := etlbudget.Default.Acquire(logPrefix)
+	defer lease.Release()
 	if err := etl.Transform(
 		logPrefix,
 		p.db,
@@ -318,6 +324,7 @@ func (p *HashPromoter) Unwind(logPrefix string, s *StageState, u *UnwindState, s
 		l.LoadFunc,
 		etl.TransformArgs{
 			BufferType:      etl.SortableOldestAppearedBuffer,
+			BufferSize:      int(lease.Size()),
 			ExtractStartKey: startkey,
 			Quit:            p.quitCh,
 		},
@@ -358,12 +365,12 @@ func incrementIntermediateHashes(logPrefix string, s *StageState, db kv.RwTx, to
 		return trie.EmptyRoot, err
 	}
 
-	accTrieCollector := etl.NewCollector(logPrefix, cfg.tmpDir, etl.NewSortableBuffer(etl.BufferOptimalSize))
-	defer accTrieCollector.Close()
+	accTrieCollector, closeAccTrieCollector := etlbudget.NewCollector(logPrefix, cfg.tmpDir)
+	defer closeAccTrieCollector()
 	accTrieCollectorFunc := accountTrieCollector(accTrieCollector)
 
-	stTrieCollector := etl.NewCollector(logPrefix, cfg.tmpDir, etl.NewSortableBuffer(etl.BufferOptimalSize))
-	defer stTrieCollector.Close()
+	stTrieCollector, closeStTrieCollector := etlbudget.NewCollector(logPrefix, cfg.tmpDir)
+	defer closeStTrieCollector()
 	stTrieCollectorFunc := storageTrieCollector(stTrieCollector)
 
 	loader := trie.NewFlatDBTrieLoader(logPrefix)
@@ -435,12 +442,12 @@ func unwindIntermediateHashesStageImpl(logPrefix string, u *UnwindState, s *Stag
 		return err
 	}
 
-	accTrieCollector := etl.NewCollector(logPrefix, cfg.tmpDir, etl.NewSortableBuffer(etl.BufferOptimalSize))
-	defer accTrieCollector.Close()
+	accTrieCollector, closeAccTrieCollector := etlbudget.NewCollector(logPrefix, cfg.tmpDir)
+	defer closeAccTrieCollector()
 	accTrieCollectorFunc := accountTrieCollector(accTrieCollector)
 
-	stTrieCollector := etl.NewCollector(logPrefix, cfg.tmpDir, etl.NewSortableBuffer(etl.BufferOptimalSize))
-	defer stTrieCollector.Close()
+	stTrieCollector, closeStTrieCollector := etlbudget.NewCollector(logPrefix, cfg.tmpDir)
+	defer closeStTrieCollector()
 	stTrieCollectorFunc := storageTrieCollector(stTrieCollector)
 
 	loader := trie.NewFlatDBTrieLoader(logPrefix)
@@ -464,6 +471,58 @@ func unwindIntermediateHashesStageImpl(logPrefix string, u *UnwindState, s *Stag
 	return nil
 }
 
+// UnwindIntermediateHashesForTrieLoader - unwinds hashed state in tx from block `from` (progress of IntermediateHashes
+// stage) to block `to` and returns trie loader which calculates state root of block `to`. Intermediate hashes are not
+// unwound: keys changed since `to` are added to rl, so hashes of the sub-tries containing them are not used.
+// tx is usually in-memory batch over read-only transaction (see olddb.NewMemoryBatch), nothing is written to db.
+func UnwindIntermediateHashesForTrieLoader(logPrefix string, rl *trie.RetainList, from, to uint64, tx kv.RwTx, tmpDir string, quit <-chan struct{}) (*trie.FlatDBTrieLoader, error) {
+	s := &StageState{ID: stages.IntermediateHashes, BlockNumber: from}
+	u := &UnwindState{ID: stages.IntermediateHashes, UnwindPoint: to, CurrentBlockNumber: from}
+
+	p := NewHashPromoter(tx, quit)
+	p.TempDir = tmpDir
+	collect := func(k, v []byte, _ etl.CurrentTableReader, _ etl.LoadNextFunc) error {
+		rl.AddKeyWithMarker(k, len(v) == 0)
+		return nil
+	}
+	if err := p.Unwind(logPrefix, s, u, false /* storage */, collect); err != nil {
+		return nil, err
+	}
+	if err := p.Unwind(logPrefix, s, u, true /* storage */, collect); err != nil {
+		return nil, err
+	}
+	if err := unwindHashStateStageImpl(logPrefix, u, s, tx, StageHashStateCfg(nil, tmpDir), quit); err != nil {
+		return nil, err
+	}
+
+	loader := trie.NewFlatDBTrieLoader(logPrefix)
+	if err := loader.Reset(rl, nil, nil, false); err != nil {
+		return nil, err
+	}
+	return loader, nil
+}
+
+// StateRootOfNextBlock - state root after block `blockNum`, whose changes (plain state and change sets) were written to
+// tx on top of the latest block with hashed state and intermediate hashes - it must be blockNum-1. Hashed state and
+// intermediate hashes of tx are updated, so tx is usually in-memory batch over read-only transaction
+// (see olddb.NewMemoryBatch) and nothing is written to db.
+func StateRootOfNextBlock(logPrefix string, tx kv.RwTx, blockNum uint64, tmpDir string, quit <-chan struct{}) (common.Hash, error) {
+	for _, stage := range []stages.SyncStage{stages.HashState, stages.IntermediateHashes} {
+		progress, err := stages.GetStageProgress(tx, stage)
+		if err != nil {
+			return trie.EmptyRoot, err
+		}
+		if progress+1 != blockNum {
+			return trie.EmptyRoot, fmt.Errorf("state root of block %d can't be calculated, %s is at block %d", blockNum, stage, progress)
+		}
+	}
+	s := &StageState{ID: stages.IntermediateHashes, BlockNumber: blockNum - 1}
+	if err := promoteHashedStateIncrementally(logPrefix, s, blockNum-1, blockNum, tx, StageHashStateCfg(nil, tmpDir), quit); err != nil {
+		return trie.EmptyRoot, err
+	}
+	return incrementIntermediateHashes(logPrefix, s, tx, blockNum, StageTrieCfg(nil, false, true, tmpDir, nil), common.Hash{}, quit)
+}
+
 func ResetHashState(tx kv.RwTx) error {
 	if err := tx.ClearBucket(kv.HashedAccounts); err != nil {
 		return err
@@ -506,7 +565,7 @@ func assertSubset(a, b uint16) {
 	}
 }
 
-func accountTrieCollector(collector *etl.Collector) trie.HashCollector2 {
+func accountTrieCollector(collector *etlbudget.Collector) trie.HashCollector2 {
 	newV := make([]byte, 0, 1024)
 	return func(keyHex []byte, hasState, hasTree, hasHash uint16, hashes, _ []byte) error {
 		if len(keyHex) == 0 {
@@ -525,7 +584,7 @@ func accountTrieCollector(collector *etl.Collector) trie.HashCollector2 {
 	}
 }
 
-func storageTrieCollector(collector *etl.Collector) trie.StorageHashCollector2 {
+func storageTrieCollector(collector *etlbudget.Collector) trie.StorageHashCollector2 {
 	newK := make([]byte, 0, 128)
 	newV := make([]byte, 0, 1024)
 	return func(accWithInc []byte, keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
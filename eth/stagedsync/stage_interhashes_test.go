@@ -164,6 +164,85 @@ func TestAccountAndStorageTrie(t *testing.T) {
 	assert.Equal(t, accountTrieA[string(common.FromHex("0B00"))], accountTrieB[string(common.FromHex("0B00"))])
 }
 
+func TestTrieLoaderRetainNodes(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+
+	incarnation := uint64(1)
+	hash1 := common.HexToHash("0xB000000000000000000000000000000000000000000000000000000000000000")
+	hash2 := common.HexToHash("0xB040000000000000000000000000000000000000000000000000000000000000")
+	hash3 := common.HexToHash("0xB041000000000000000000000000000000000000000000000000000000000000")
+	hash4 := common.HexToHash("0xB310000000000000000000000000000000000000000000000000000000000000")
+	hash5 := common.HexToHash("0xB340000000000000000000000000000000000000000000000000000000000000")
+	assert.Nil(t, addTestAccount(tx, hash1, 3*params.Ether, 0))
+	assert.Nil(t, addTestAccount(tx, hash2, 1*params.Ether, 0))
+	assert.Nil(t, addTestAccount(tx, hash3, 2*params.Ether, incarnation))
+	assert.Nil(t, addTestAccount(tx, hash4, 8*params.Ether, 0))
+	assert.Nil(t, addTestAccount(tx, hash5, 1*params.Ether, 0))
+
+	loc1 := common.HexToHash("0x1200000000000000000000000000000000000000000000000000000000000000")
+	loc2 := common.HexToHash("0x1400000000000000000000000000000000000000000000000000000000000000")
+	loc3 := common.HexToHash("0x3000000000000000000000000000000000000000000000000000000000E00000")
+	missingLoc := common.HexToHash("0x3000000000000000000000000000000000000000000000000000000000E00001")
+	assert.Nil(t, tx.Put(kv.HashedStorage, dbutils.GenerateCompositeStorageKey(hash3, incarnation, loc1), common.FromHex("0x42")))
+	assert.Nil(t, tx.Put(kv.HashedStorage, dbutils.GenerateCompositeStorageKey(hash3, incarnation, loc2), common.FromHex("0x01")))
+	assert.Nil(t, tx.Put(kv.HashedStorage, dbutils.GenerateCompositeStorageKey(hash3, incarnation, loc3), common.FromHex("0x127a89")))
+
+	// intermediate hashes are used for the parts of the trie without retained keys
+	cfg := StageTrieCfg(nil, false, true, t.TempDir(), snapshotsync.NewBlockReader())
+	root, err := RegenerateIntermediateHashes("IH", tx, cfg, common.Hash{} /* expectedRootHash */, nil /* quit */)
+	assert.Nil(t, err)
+
+	missingAcc := common.HexToHash("0xB042000000000000000000000000000000000000000000000000000000000000")
+	rl := trie.NewRetainList(0)
+	for _, k := range [][]byte{hash3[:], hash4[:], missingAcc[:], dbutils.GenerateCompositeStorageKey(hash3, incarnation, loc1), dbutils.GenerateCompositeStorageKey(hash3, incarnation, missingLoc)} {
+		rl.AddKey(k)
+	}
+	proofRL := trie.NewRetainList(0)
+	proofRL.AddKey(hash3[:])
+	proofRL.AddKey(missingAcc[:])
+	proofRL.AddKey(dbutils.GenerateCompositeStorageKey(hash3, incarnation, loc1))
+	proofRL.AddKey(dbutils.GenerateCompositeStorageKey(hash3, incarnation, missingLoc))
+	loader := trie.NewFlatDBTrieLoader("IH")
+	assert.Nil(t, loader.Reset(rl, nil, nil, false))
+	loader.RetainNodes(proofRL)
+	hash, err := loader.CalcTrieRoot(tx, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, root, hash)
+	tr := loader.RetainedTrie()
+	assert.Equal(t, root, tr.Hash())
+
+	proof, err := tr.Prove(hash3[:], 0, false)
+	assert.Nil(t, err)
+	enc, err := trie.VerifyProof(root, hash3[:], proof)
+	assert.Nil(t, err)
+	assert.NotNil(t, enc)
+	acc, ok := tr.GetAccount(hash3[:])
+	assert.True(t, ok)
+	assert.Equal(t, incarnation, acc.Incarnation)
+
+	proof, err = tr.Prove(missingAcc[:], 0, false)
+	assert.Nil(t, err)
+	enc, err = trie.VerifyProof(root, missingAcc[:], proof)
+	assert.Nil(t, err)
+	assert.Nil(t, enc)
+
+	proof, err = tr.Prove(append(hash3.Bytes(), loc1[:]...), 64, true)
+	assert.Nil(t, err)
+	enc, err = trie.VerifyProof(acc.Root, loc1[:], proof)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x42}, enc)
+
+	proof, err = tr.Prove(append(hash3.Bytes(), missingLoc[:]...), 64, true)
+	assert.Nil(t, err)
+	enc, err = trie.VerifyProof(acc.Root, missingLoc[:], proof)
+	assert.Nil(t, err)
+	assert.Nil(t, enc)
+
+	// sub-trie without retained keys is a hash node, proof can't be built
+	_, err = tr.Prove(hash4[:], 0, false)
+	assert.NotNil(t, err)
+}
+
 func TestAccountTrieAroundExtensionNode(t *testing.T) {
 	_, tx := memdb.NewTestTx(t)
 
@@ -15,6 +15,7 @@ import (
 	"github.com/ledgerwatch/erigon-lib/etl"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/ethdb/bitmapdb"
 	"github.com/ledgerwatch/erigon/ethdb/cbor"
@@ -144,6 +145,9 @@ func promoteLogIndex(logPrefix string, tx kv.RwTx, start uint64, cfg LogIndexCfg
 			}
 		}
 
+		if v, err = rawdb.DecodeReceiptsValue(tx, v); err != nil {
+			return fmt.Errorf("receipt decompression failed: %w, block=%d", err, blockNum)
+		}
 		var ll types.Logs
 		reader.Reset(v)
 		if err := cbor.Unmarshal(&ll, reader); err != nil {
@@ -268,6 +272,9 @@ func unwindLogIndex(logPrefix string, db kv.RwTx, to uint64, cfg LogIndexCfg, qu
 		if err := libcommon.Stopped(quitCh); err != nil {
 			return err
 		}
+		if v, err = rawdb.DecodeReceiptsValue(db, v); err != nil {
+			return fmt.Errorf("receipt decompression: %w, block=%d", err, binary.BigEndian.Uint64(k))
+		}
 		var logs types.Logs
 		reader.Reset(v)
 		if err := cbor.Unmarshal(&logs, reader); err != nil {
@@ -432,6 +439,9 @@ func pruneLogIndex(logPrefix string, tx kv.RwTx, tmpDir string, pruneTo uint64,
 			default:
 			}
 
+			if v, err = rawdb.DecodeReceiptsValue(tx, v); err != nil {
+				return fmt.Errorf("receipt decompression failed: %w, block=%d", err, blockNum)
+			}
 			var logs types.Logs
 			reader.Reset(v)
 			if err := cbor.Unmarshal(&logs, reader); err != nil {
@@ -11,7 +11,6 @@ import (
 	mapset "github.com/deckarep/golang-set"
 	libcommon "github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
-	"github.com/ledgerwatch/erigon-lib/txpool"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/debug"
 	"github.com/ledgerwatch/erigon/consensus"
@@ -19,6 +18,7 @@ import (
 	"github.com/ledgerwatch/erigon/core"
 	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/builder"
 	"github.com/ledgerwatch/erigon/eth/ethutils"
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/log/v3"
@@ -32,6 +32,9 @@ type MiningBlock struct {
 
 	LocalTxs  types.TransactionsStream
 	RemoteTxs types.TransactionsStream
+	Bundles   []*builder.Bundle // of external builders, executed before LocalTxs
+
+	Stats *rawdb.PayloadStats // filled by each mining stage, sent to MiningState.PayloadStatsCh when block is ready
 }
 
 type MiningState struct {
@@ -39,6 +42,7 @@ type MiningState struct {
 	PendingResultCh chan *types.Block
 	MiningResultCh  chan *types.Block
 	MiningBlock     *MiningBlock
+	PayloadStatsCh  chan *rawdb.PayloadStats // stats of built payloads, dropped when nobody reads them
 }
 
 func NewMiningState(cfg *params.MiningConfig) MiningState {
@@ -47,27 +51,29 @@ func NewMiningState(cfg *params.MiningConfig) MiningState {
 		PendingResultCh: make(chan *types.Block, 1),
 		MiningResultCh:  make(chan *types.Block, 1),
 		MiningBlock:     &MiningBlock{},
+		PayloadStatsCh:  make(chan *rawdb.PayloadStats, 16),
 	}
 }
 
 type MiningCreateBlockCfg struct {
 	db          kv.RwDB
 	miner       MiningState
-	chainConfig params.ChainConfig
+	chainConfig *params.ChainConfig
 	engine      consensus.Engine
-	txPool2     *txpool.TxPool
-	txPool2DB   kv.RoDB
+	txSource    MiningTxSource
+	txSelector  builder.TxSelector
 	tmpdir      string
 }
 
-func StageMiningCreateBlockCfg(db kv.RwDB, miner MiningState, chainConfig params.ChainConfig, engine consensus.Engine, txPool2 *txpool.TxPool, txPool2DB kv.RoDB, tmpdir string) MiningCreateBlockCfg {
+// StageMiningCreateBlockCfg - txSource is nil when txpool is disabled, db is not used when stages run in given tx
+func StageMiningCreateBlockCfg(db kv.RwDB, miner MiningState, chainConfig *params.ChainConfig, engine consensus.Engine, txSource MiningTxSource, txSelector builder.TxSelector, tmpdir string) MiningCreateBlockCfg {
 	return MiningCreateBlockCfg{
 		db:          db,
 		miner:       miner,
 		chainConfig: chainConfig,
 		engine:      engine,
-		txPool2:     txPool2,
-		txPool2DB:   txPool2DB,
+		txSource:    txSource,
+		txSelector:  txSelector,
 		tmpdir:      tmpdir,
 	}
 }
@@ -101,35 +107,21 @@ func SpawnMiningCreateBlockStage(s *StageState, tx kv.RwTx, cfg MiningCreateBloc
 
 	blockNum := executionAt + 1
 	var txs []types.Transaction
-	if err = cfg.txPool2DB.View(context.Background(), func(tx kv.Tx) error {
-		txSlots := txpool.TxsRlp{}
-		if err := cfg.txPool2.Best(200, &txSlots, tx); err != nil {
+	if cfg.txSource != nil {
+		if txs, err = cfg.txSource.Best(context.Background(), 200); err != nil {
 			return err
 		}
-
-		txs, err = types.DecodeTransactions(txSlots.Txs)
-		if err != nil {
-			return fmt.Errorf("decode rlp of pending txs: %w", err)
-		}
-		var sender common.Address
-		for i := range txs {
-			copy(sender[:], txSlots.Senders.At(i))
-			txs[i].SetSender(sender)
-		}
-
-		return nil
-	}); err != nil {
-		return err
 	}
 	current.RemoteTxs = types.NewTransactionsFixedOrder(txs)
 	// txpool v2 - doesn't prioritise local txs over remote
 	current.LocalTxs = types.NewTransactionsFixedOrder(nil)
+	current.Bundles = nil
 	log.Debug(fmt.Sprintf("[%s] Candidate txs", logPrefix), "amount", len(txs))
-	localUncles, remoteUncles, err := readNonCanonicalHeaders(tx, blockNum, cfg.engine, coinbase, txPoolLocals)
+	localUncles, remoteUncles, err := readNonCanonicalHeaders(tx, blockNum, staleThreshold, cfg.engine, coinbase, txPoolLocals)
 	if err != nil {
 		return err
 	}
-	chain := ChainReader{Cfg: cfg.chainConfig, Db: tx}
+	chain := ChainReader{Cfg: *cfg.chainConfig, Db: tx}
 	var GetBlocksFromHash = func(hash common.Hash, n int) (blocks []*types.Block) {
 		number := rawdb.ReadHeaderNumber(tx, hash)
 		if number == nil {
@@ -154,7 +146,7 @@ func SpawnMiningCreateBlockStage(s *StageState, tx kv.RwTx, cfg MiningCreateBloc
 		uncles    mapset.Set // uncle set
 	}
 	env := &envT{
-		signer:    types.MakeSigner(&cfg.chainConfig, blockNum),
+		signer:    types.MakeSigner(cfg.chainConfig, blockNum),
 		ancestors: mapset.NewSet(),
 		family:    mapset.NewSet(),
 		uncles:    mapset.NewSet(),
@@ -165,10 +157,9 @@ func SpawnMiningCreateBlockStage(s *StageState, tx kv.RwTx, cfg MiningCreateBloc
 	if parent.Time >= uint64(timestamp) {
 		timestamp = int64(parent.Time + 1)
 	}
-	num := parent.Number
 	header := &types.Header{
 		ParentHash: parent.Hash(),
-		Number:     num.Add(num, common.Big1),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
 		GasLimit:   core.CalcGasLimit(parent.GasUsed, parent.GasLimit, cfg.miner.MiningConfig.GasFloor, cfg.miner.MiningConfig.GasCeil),
 		Extra:      cfg.miner.MiningConfig.ExtraData,
 		Time:       uint64(timestamp),
@@ -177,7 +168,7 @@ func SpawnMiningCreateBlockStage(s *StageState, tx kv.RwTx, cfg MiningCreateBloc
 	// Set baseFee and GasLimit if we are on an EIP-1559 chain
 	if cfg.chainConfig.IsLondon(header.Number.Uint64()) {
 		header.Eip1559 = true
-		header.BaseFee = misc.CalcBaseFee(&cfg.chainConfig, parent)
+		header.BaseFee = misc.CalcBaseFee(cfg.chainConfig, parent)
 		if !cfg.chainConfig.IsLondon(parent.Number.Uint64()) {
 			parentGasLimit := parent.GasLimit * params.ElasticityMultiplier
 			header.GasLimit = core.CalcGasLimit(parent.GasUsed, parentGasLimit, cfg.miner.MiningConfig.GasFloor, cfg.miner.MiningConfig.GasCeil)
@@ -216,6 +207,16 @@ func SpawnMiningCreateBlockStage(s *StageState, tx kv.RwTx, cfg MiningCreateBloc
 		}
 	}
 
+	// bundles of external builders are executed before txpool's txs
+	var bundleTxs int
+	if cfg.txSelector != nil {
+		current.Bundles = cfg.txSelector.Select(header)
+		for _, b := range current.Bundles {
+			bundleTxs += len(b.Txs)
+		}
+		log.Debug(fmt.Sprintf("[%s] Candidate bundles", logPrefix), "amount", len(current.Bundles), "txs", bundleTxs)
+	}
+
 	// analog of miner.Worker.updateSnapshot
 	var makeUncles = func(proposedUncles mapset.Set) []*types.Header {
 		var uncles []*types.Header
@@ -260,6 +261,10 @@ func SpawnMiningCreateBlockStage(s *StageState, tx kv.RwTx, cfg MiningCreateBloc
 		if env.family.Contains(hash) {
 			return errors.New("uncle already included")
 		}
+		// engine has the last word: e.g. clique doesn't allow uncles, ethash checks their seal
+		if err := cfg.engine.VerifyUncles(chain, header, []*types.Header{uncle}); err != nil {
+			return err
+		}
 		env.uncles.Add(uncle.Hash())
 		return nil
 	}
@@ -289,22 +294,33 @@ func SpawnMiningCreateBlockStage(s *StageState, tx kv.RwTx, cfg MiningCreateBloc
 
 	current.Header = header
 	current.Uncles = makeUncles(env.uncles)
+	current.Stats = &rawdb.PayloadStats{
+		Number:     header.Number.Uint64(),
+		BuiltAt:    uint64(time.Now().UnixNano()),
+		ParentHash: header.ParentHash,
+		Candidates: uint64(len(txs)),
+		BundleTxs:  uint64(bundleTxs),
+		Uncles:     uint64(len(current.Uncles)),
+	}
 	return nil
 }
 
-func readNonCanonicalHeaders(tx kv.Tx, blockNum uint64, engine consensus.Engine, coinbase common.Address, txPoolLocals []common.Address) (localUncles, remoteUncles map[common.Hash]*types.Header, err error) {
+// readNonCanonicalHeaders - candidates to uncles of block blockNum: headers of heights which are not stale yet.
+// Canonical headers are among them, they are rejected as family of the block.
+func readNonCanonicalHeaders(tx kv.Tx, blockNum uint64, staleThreshold uint64, engine consensus.Engine, coinbase common.Address, txPoolLocals []common.Address) (localUncles, remoteUncles map[common.Hash]*types.Header, err error) {
 	localUncles, remoteUncles = map[common.Hash]*types.Header{}, map[common.Hash]*types.Header{}
-	nonCanonicalBlocks, err := rawdb.ReadHeadersByNumber(tx, blockNum)
-	if err != nil {
-		return
-	}
-	for _, u := range nonCanonicalBlocks {
-		if ethutils.IsLocalBlock(engine, coinbase, txPoolLocals, u) {
-			localUncles[u.Hash()] = u
-		} else {
-			remoteUncles[u.Hash()] = u
+	for number := blockNum - 1; number > 0 && number+staleThreshold > blockNum; number-- {
+		var headers []*types.Header
+		if headers, err = rawdb.ReadHeadersByNumber(tx, number); err != nil {
+			return
+		}
+		for _, u := range headers {
+			if ethutils.IsLocalBlock(engine, coinbase, txPoolLocals, u) {
+				localUncles[u.Hash()] = u
+			} else {
+				remoteUncles[u.Hash()] = u
+			}
 		}
-
 	}
 	return
 }
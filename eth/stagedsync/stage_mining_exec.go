@@ -1,8 +1,11 @@
 package stagedsync
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 
+	"github.com/holiman/uint256"
 	libcommon "github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/common"
@@ -13,6 +16,7 @@ import (
 	"github.com/ledgerwatch/erigon/core/state"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/eth/builder"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 	"github.com/ledgerwatch/erigon/ethdb"
 	"github.com/ledgerwatch/erigon/params"
@@ -23,8 +27,9 @@ type MiningExecCfg struct {
 	db          kv.RwDB
 	miningState MiningState
 	notifier    ChainEventNotifier
-	chainConfig params.ChainConfig
+	chainConfig *params.ChainConfig
 	engine      consensus.Engine
+	txSelector  builder.TxSelector
 	vmConfig    *vm.Config
 	tmpdir      string
 }
@@ -33,8 +38,9 @@ func StageMiningExecCfg(
 	db kv.RwDB,
 	miningState MiningState,
 	notifier ChainEventNotifier,
-	chainConfig params.ChainConfig,
+	chainConfig *params.ChainConfig,
 	engine consensus.Engine,
+	txSelector builder.TxSelector,
 	vmConfig *vm.Config,
 	tmpdir string,
 ) MiningExecCfg {
@@ -44,6 +50,7 @@ func StageMiningExecCfg(
 		notifier:    notifier,
 		chainConfig: chainConfig,
 		engine:      engine,
+		txSelector:  txSelector,
 		vmConfig:    vmConfig,
 		tmpdir:      tmpdir,
 	}
@@ -76,13 +83,24 @@ func SpawnMiningExecStage(s *StageState, tx kv.RwTx, cfg MiningExecCfg, quit <-c
 
 	getHeader := func(hash common.Hash, number uint64) *types.Header { return rawdb.ReadHeader(tx, hash, number) }
 	contractHasTEVM := ethdb.GetHasTEVM(tx)
+	coinbase := cfg.miningState.MiningConfig.Etherbase
+	balanceBefore := ibs.GetBalance(coinbase).ToBig()
 
 	// Short circuit if there is no available pending transactions.
 	// But if we disable empty precommit already, ignore it. Since
 	// empty block is necessary to keep the liveness of the network.
 	if noempty {
+		if len(current.Bundles) > 0 && cfg.txSelector != nil {
+			var logs types.Logs
+			var err error
+			if logs, ibs, err = addBundlesToMiningBlock(logPrefix, current, cfg.chainConfig, cfg.vmConfig, getHeader, contractHasTEVM, cfg.engine, cfg.txSelector, coinbase, ibs, quit); err != nil {
+				return err
+			}
+			NotifyPendingLogs(logPrefix, cfg.notifier, logs)
+		}
+		current.Stats.BundleIncl = uint64(len(current.Txs))
 		if !localTxs.Empty() {
-			logs, err := addTransactionsToMiningBlock(logPrefix, current, cfg.chainConfig, cfg.vmConfig, getHeader, contractHasTEVM, cfg.engine, localTxs, cfg.miningState.MiningConfig.Etherbase, ibs, quit)
+			logs, err := addTransactionsToMiningBlock(logPrefix, current, *cfg.chainConfig, cfg.vmConfig, getHeader, contractHasTEVM, cfg.engine, localTxs, cfg.miningState.MiningConfig.Etherbase, ibs, quit)
 			if err != nil {
 				return err
 			}
@@ -94,7 +112,7 @@ func SpawnMiningExecStage(s *StageState, tx kv.RwTx, cfg MiningExecCfg, quit <-c
 			//}
 		}
 		if !remoteTxs.Empty() {
-			logs, err := addTransactionsToMiningBlock(logPrefix, current, cfg.chainConfig, cfg.vmConfig, getHeader, contractHasTEVM, cfg.engine, remoteTxs, cfg.miningState.MiningConfig.Etherbase, ibs, quit)
+			logs, err := addTransactionsToMiningBlock(logPrefix, current, *cfg.chainConfig, cfg.vmConfig, getHeader, contractHasTEVM, cfg.engine, remoteTxs, cfg.miningState.MiningConfig.Etherbase, ibs, quit)
 			if err != nil {
 				return err
 			}
@@ -105,9 +123,16 @@ func SpawnMiningExecStage(s *StageState, tx kv.RwTx, cfg MiningExecCfg, quit <-c
 			NotifyPendingLogs(logPrefix, cfg.notifier, logs)
 			//}
 		}
+		current.Stats.Included = uint64(len(current.Txs)) - current.Stats.BundleIncl
+	}
+	// value is taken before block and uncle rewards are paid
+	current.Stats.Value = new(big.Int).Sub(ibs.GetBalance(coinbase).ToBig(), balanceBefore)
+	if current.Stats.Value.Sign() < 0 { // fee recipient paid more by own transactions than received
+		current.Stats.Value.SetUint64(0)
 	}
+	current.Stats.PriorityFees = priorityFees(current.Header, current.Txs, current.Receipts)
 
-	if err := core.FinalizeBlockExecution(cfg.engine, stateReader, current.Header, current.Txs, current.Uncles, stateWriter, &cfg.chainConfig, ibs, nil, nil, nil, nil); err != nil {
+	if err := core.FinalizeBlockExecution(cfg.engine, stateReader, current.Header, current.Txs, current.Uncles, stateWriter, cfg.chainConfig, ibs, nil, nil, nil, nil); err != nil {
 		return err
 	}
 
@@ -146,10 +171,91 @@ func SpawnMiningExecStage(s *StageState, tx kv.RwTx, cfg MiningExecCfg, quit <-c
 	return nil
 }
 
+// addBundlesToMiningBlock - executes bundles of external builders, each of them atomically: on a copy of state,
+// which replaces the state only if all transactions of bundle succeed (journal of state can't revert changes of
+// finalized transactions). With MaxProfit policy bundles are ordered by profit of their execution on top of the state
+// before bundles. Bundles whose transactions have too low nonces are already in chain (or replaced there) - they're
+// evicted from selector. Returns state after bundles.
+func addBundlesToMiningBlock(logPrefix string, current *MiningBlock, chainConfig *params.ChainConfig, vmConfig *vm.Config, getHeader func(hash common.Hash, number uint64) *types.Header, contractHasTEVM func(common.Hash) (bool, error), engine consensus.Engine, selector builder.TxSelector, coinbase common.Address, ibs *state.IntraBlockState, quit <-chan struct{}) (types.Logs, *state.IntraBlockState, error) {
+	header := current.Header
+	gasPool := new(core.GasPool).AddGas(header.GasLimit - header.GasUsed)
+	bundles := current.Bundles
+	if selector.Policy() == builder.MaxProfit {
+		baseFee := new(uint256.Int)
+		if header.BaseFee != nil {
+			baseFee.SetFromBig(header.BaseFee)
+		}
+		profits := make(map[*builder.Bundle]*uint256.Int, len(bundles))
+		for _, b := range bundles {
+			if err := libcommon.Stopped(quit); err != nil {
+				return nil, nil, err
+			}
+			gasUsed, gas := header.GasUsed, *gasPool
+			receipts, err := applyBundle(b, len(current.Txs), chainConfig, vmConfig, getHeader, contractHasTEVM, engine, coinbase, &gas, ibs.Copy(), header)
+			header.GasUsed = gasUsed
+			if err != nil {
+				profits[b] = uint256.NewInt(0) // fails again below
+				continue
+			}
+			profits[b] = b.Profit(baseFee, receipts)
+		}
+		builder.SortByProfit(bundles, profits)
+	}
+
+	var logs types.Logs
+	var stale []*builder.Bundle
+	for _, b := range bundles {
+		if err := libcommon.Stopped(quit); err != nil {
+			return nil, nil, err
+		}
+		gasUsed, gas := header.GasUsed, *gasPool
+		bundleState := ibs.Copy()
+		receipts, err := applyBundle(b, len(current.Txs), chainConfig, vmConfig, getHeader, contractHasTEVM, engine, coinbase, gasPool, bundleState, header)
+		if err != nil {
+			header.GasUsed, *gasPool = gasUsed, gas
+			if errors.Is(err, core.ErrNonceTooLow) {
+				stale = append(stale, b)
+			}
+			log.Debug(fmt.Sprintf("[%s] Skipping bundle", logPrefix), "txs", len(b.Txs), "err", err)
+			continue
+		}
+		ibs = bundleState
+		current.Txs = append(current.Txs, b.Txs...)
+		current.Receipts = append(current.Receipts, receipts...)
+		for _, receipt := range receipts {
+			logs = append(logs, receipt.Logs...)
+		}
+	}
+	selector.Evict(stale)
+	return logs, ibs, nil
+}
+
+// applyBundle - executes transactions of bundle, the first of them gets index txIndex in block
+func applyBundle(b *builder.Bundle, txIndex int, chainConfig *params.ChainConfig, vmConfig *vm.Config, getHeader func(hash common.Hash, number uint64) *types.Header, contractHasTEVM func(common.Hash) (bool, error), engine consensus.Engine, coinbase common.Address, gasPool *core.GasPool, ibs *state.IntraBlockState, header *types.Header) (types.Receipts, error) {
+	noop := state.NewNoopWriter()
+	receipts := make(types.Receipts, 0, len(b.Txs))
+	for i, txn := range b.Txs {
+		if txn.Protected() && !chainConfig.IsEIP155(header.Number.Uint64()) {
+			return nil, fmt.Errorf("tx %d (%x): replay protected before EIP-155", i, txn.Hash())
+		}
+		ibs.Prepare(txn.Hash(), common.Hash{}, txIndex+i)
+		receipt, _, err := core.ApplyTransaction(chainConfig, getHeader, engine, &coinbase, gasPool, ibs, noop, header, txn, &header.GasUsed, *vmConfig, contractHasTEVM)
+		if err != nil {
+			return nil, fmt.Errorf("tx %d (%x): %w", i, txn.Hash(), err)
+		}
+		if receipt.Status == types.ReceiptStatusFailed {
+			return nil, fmt.Errorf("tx %d (%x): reverted", i, txn.Hash())
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, nil
+}
+
 func addTransactionsToMiningBlock(logPrefix string, current *MiningBlock, chainConfig params.ChainConfig, vmConfig *vm.Config, getHeader func(hash common.Hash, number uint64) *types.Header, contractHasTEVM func(common.Hash) (bool, error), engine consensus.Engine, txs types.TransactionsStream, coinbase common.Address, ibs *state.IntraBlockState, quit <-chan struct{}) (types.Logs, error) {
 	header := current.Header
-	tcount := 0
-	gasPool := new(core.GasPool).AddGas(current.Header.GasLimit)
+	// called for bundles and then for txpool's txs: continue after transactions which are already in block
+	tcount := len(current.Txs)
+	gasPool := new(core.GasPool).AddGas(current.Header.GasLimit - current.Header.GasUsed)
 	signer := types.MakeSigner(&chainConfig, header.Number.Uint64())
 
 	var coalescedLogs types.Logs
@@ -267,6 +373,20 @@ func addTransactionsToMiningBlock(logPrefix string, current *MiningBlock, chainC
 
 }
 
+// priorityFees - sum of tips paid to fee recipient by transactions: gas used * effective gas tip
+func priorityFees(header *types.Header, txs []types.Transaction, receipts types.Receipts) *big.Int {
+	baseFee := new(uint256.Int)
+	if header.BaseFee != nil {
+		baseFee.SetFromBig(header.BaseFee)
+	}
+	fees, fee := new(uint256.Int), new(uint256.Int)
+	for i, txn := range txs {
+		fee.SetUint64(receipts[i].GasUsed)
+		fees.Add(fees, fee.Mul(fee, txn.GetEffectiveGasTip(baseFee)))
+	}
+	return fees.ToBig()
+}
+
 func NotifyPendingLogs(logPrefix string, notifier ChainEventNotifier, logs types.Logs) {
 	if len(logs) == 0 {
 		return
@@ -0,0 +1,65 @@
+package stagedsync
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus/ethash"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/eth/builder"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddBundlesToMiningBlock(t *testing.T) {
+	chainConfig := *params.TestChainConfig
+	chainConfig.LondonBlock = big.NewInt(0)
+	keyA, _ := crypto.GenerateKey()
+	keyB, _ := crypto.GenerateKey()
+	a, b := crypto.PubkeyToAddress(keyA.PublicKey), crypto.PubkeyToAddress(keyB.PublicKey)
+
+	_, tx := memdb.NewTestTx(t)
+	genesis := state.New(state.NewPlainStateReader(tx))
+	genesis.AddBalance(a, uint256.NewInt(params.Ether))
+	genesis.AddBalance(b, uint256.NewInt(params.Ether))
+	genesis.SetNonce(b, 3)
+	require.NoError(t, genesis.CommitBlock(chainConfig.Rules(0), state.NewPlainStateWriter(tx, tx, 0)))
+
+	signer := types.LatestSignerForChainID(chainConfig.ChainID)
+	transfer := func(key *ecdsa.PrivateKey, nonce, gasPrice uint64) types.Transaction {
+		txn, err := types.SignTx(types.NewTransaction(nonce, common.Address{1}, uint256.NewInt(1), params.TxGas, uint256.NewInt(gasPrice), nil), *signer, key)
+		require.NoError(t, err)
+		return txn
+	}
+	pool := builder.NewBundlePool(builder.MaxProfit, builder.DefaultBundleTTL)
+	pool.AddBundle(types.Transactions{transfer(keyA, 0, 2)})
+	pool.AddBundle(types.Transactions{transfer(keyB, 3, 6)})                       // more profitable
+	pool.AddBundle(types.Transactions{transfer(keyA, 1, 2), transfer(keyA, 7, 2)}) // second one fails
+	pool.AddBundle(types.Transactions{transfer(keyB, 1, 100)})                     // already in chain
+
+	header := &types.Header{Number: big.NewInt(1), GasLimit: 1_000_000, BaseFee: big.NewInt(1), Eip1559: true, Difficulty: big.NewInt(1), Coinbase: common.Address{0xfe}}
+	current := &MiningBlock{Header: header, Bundles: pool.Select(header)}
+	base := state.New(state.NewPlainStateReader(tx))
+	getHeader := func(common.Hash, uint64) *types.Header { return nil }
+	contractHasTEVM := func(common.Hash) (bool, error) { return false, nil }
+	_, ibs, err := addBundlesToMiningBlock("test", current, &chainConfig, &vm.Config{}, getHeader, contractHasTEVM, ethash.NewFaker(), pool, header.Coinbase, base, nil)
+	require.NoError(t, err)
+
+	require.Len(t, current.Txs, 2)
+	require.Equal(t, uint64(3), current.Txs[0].GetNonce())
+	require.Equal(t, uint64(0), current.Txs[1].GetNonce())
+	require.Equal(t, 2*params.TxGas, header.GasUsed)
+	require.Equal(t, 2*params.TxGas, current.Receipts[1].CumulativeGasUsed)
+	require.Equal(t, uint64(1), ibs.GetNonce(a)) // failed bundle is reverted entirely
+	require.Equal(t, uint256.NewInt(params.TxGas*5+params.TxGas*1), ibs.GetBalance(header.Coinbase))
+
+	// stale bundle is evicted, failed one stays until it expires
+	require.Len(t, pool.Select(header), 3)
+}
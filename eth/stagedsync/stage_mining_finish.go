@@ -12,7 +12,7 @@ import (
 
 type MiningFinishCfg struct {
 	db          kv.RwDB
-	chainConfig params.ChainConfig
+	chainConfig *params.ChainConfig
 	engine      consensus.Engine
 	sealCancel  <-chan struct{}
 	miningState MiningState
@@ -20,7 +20,7 @@ type MiningFinishCfg struct {
 
 func StageMiningFinishCfg(
 	db kv.RwDB,
-	chainConfig params.ChainConfig,
+	chainConfig *params.ChainConfig,
 	engine consensus.Engine,
 	miningState MiningState,
 	sealCancel <-chan struct{},
@@ -44,7 +44,16 @@ func SpawnMiningFinishStage(s *StageState, tx kv.RwTx, cfg MiningFinishCfg, quit
 	//}
 
 	block := types.NewBlock(current.Header, current.Txs, current.Uncles, current.Receipts)
+	stats := current.Stats
 	*current = MiningBlock{} // hack to clean global data
+	stats.Hash = block.Hash()
+	stats.GasLimit = block.GasLimit()
+	stats.GasUsed = block.GasUsed()
+	select {
+	case cfg.miningState.PayloadStatsCh <- stats:
+	default:
+		log.Debug(fmt.Sprintf("[%s] payload stats dropped", logPrefix), "block", stats.Number)
+	}
 
 	//sealHash := engine.SealHash(block.Header())
 	// Reject duplicate sealing work due to resubmitting.
@@ -69,10 +78,11 @@ func SpawnMiningFinishStage(s *StageState, tx kv.RwTx, cfg MiningFinishCfg, quit
 			"gas_used", block.GasUsed(),
 			"gas_limit", block.GasLimit(),
 			"difficulty", block.Difficulty(),
+			"value", stats.Value,
 		)
 	}
 
-	chain := ChainReader{Cfg: cfg.chainConfig, Db: tx}
+	chain := ChainReader{Cfg: *cfg.chainConfig, Db: tx}
 	if err := cfg.engine.Seal(chain, block, cfg.miningState.MiningResultCh, cfg.sealCancel); err != nil {
 		log.Warn("Block sealing failed", "err", err)
 	}
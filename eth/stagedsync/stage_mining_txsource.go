@@ -0,0 +1,81 @@
+package stagedsync
+
+import (
+	"context"
+	"fmt"
+
+	proto_txpool "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/txpool"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// MiningTxSource - pending transactions for block production, best first, with senders set
+type MiningTxSource interface {
+	Best(ctx context.Context, n uint16) ([]types.Transaction, error)
+}
+
+type localTxSource struct {
+	pool *txpool.TxPool
+	db   kv.RoDB
+}
+
+// NewLocalTxSource - transactions of txpool running in the same process
+func NewLocalTxSource(pool *txpool.TxPool, db kv.RoDB) MiningTxSource {
+	return &localTxSource{pool: pool, db: db}
+}
+
+func (s *localTxSource) Best(ctx context.Context, n uint16) (txs []types.Transaction, err error) {
+	err = s.db.View(ctx, func(tx kv.Tx) error {
+		txSlots := txpool.TxsRlp{}
+		if err := s.pool.Best(n, &txSlots, tx); err != nil {
+			return err
+		}
+		senders := make([][]byte, len(txSlots.Txs))
+		for i := range senders {
+			senders[i] = txSlots.Senders.At(i)
+		}
+		txs, err = decodeWithSenders(txSlots.Txs, senders)
+		return err
+	})
+	return txs, err
+}
+
+type remoteTxSource struct {
+	client proto_txpool.TxpoolClient
+}
+
+// NewRemoteTxSource - transactions of txpool behind gRPC (--txpool.api.addr), e.g. for standalone block producer
+func NewRemoteTxSource(client proto_txpool.TxpoolClient) MiningTxSource {
+	return &remoteTxSource{client: client}
+}
+
+func (s *remoteTxSource) Best(ctx context.Context, n uint16) ([]types.Transaction, error) {
+	reply, err := s.client.Pending(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, err
+	}
+	pending := reply.Txs
+	if len(pending) > int(n) {
+		pending = pending[:n]
+	}
+	rlpTxs := make([][]byte, len(pending))
+	senders := make([][]byte, len(pending))
+	for i, txn := range pending {
+		rlpTxs[i], senders[i] = txn.RlpTx, txn.Sender
+	}
+	return decodeWithSenders(rlpTxs, senders)
+}
+
+func decodeWithSenders(rlpTxs [][]byte, senders [][]byte) ([]types.Transaction, error) {
+	txs, err := types.DecodeTransactions(rlpTxs)
+	if err != nil {
+		return nil, fmt.Errorf("decode rlp of pending txs: %w", err)
+	}
+	for i := range txs {
+		txs[i].SetSender(common.BytesToAddress(senders[i]))
+	}
+	return txs, nil
+}
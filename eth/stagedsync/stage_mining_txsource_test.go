@@ -0,0 +1,45 @@
+package stagedsync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holiman/uint256"
+	proto_txpool "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type pendingTxpool struct {
+	proto_txpool.TxpoolClient
+	reply *proto_txpool.PendingReply
+}
+
+func (c *pendingTxpool) Pending(context.Context, *emptypb.Empty, ...grpc.CallOption) (*proto_txpool.PendingReply, error) {
+	return c.reply, nil
+}
+
+func TestRemoteTxSource(t *testing.T) {
+	reply := &proto_txpool.PendingReply{}
+	for i := 0; i < 3; i++ {
+		txn := types.NewTransaction(uint64(i), common.Address{1}, uint256.NewInt(1), 21000, uint256.NewInt(1), nil)
+		rlpTx, err := rlp.EncodeToBytes(txn)
+		require.NoError(t, err)
+		reply.Txs = append(reply.Txs, &proto_txpool.PendingReply_Tx{RlpTx: rlpTx, Sender: common.Address{byte(i + 1)}.Bytes()})
+	}
+	source := NewRemoteTxSource(&pendingTxpool{reply: reply})
+
+	txs, err := source.Best(context.Background(), 2)
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+	for i, txn := range txs {
+		require.Equal(t, uint64(i), txn.GetNonce())
+		sender, ok := txn.GetSender()
+		require.True(t, ok)
+		require.Equal(t, common.Address{byte(i + 1)}, sender)
+	}
+}
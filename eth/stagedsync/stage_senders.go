@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	libcommon "github.com/ledgerwatch/erigon-lib/common"
@@ -18,6 +19,7 @@ import (
 	"github.com/ledgerwatch/erigon/common/debug"
 	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 	"github.com/ledgerwatch/erigon/ethdb/prune"
 	"github.com/ledgerwatch/erigon/params"
@@ -37,12 +39,18 @@ type SendersCfg struct {
 	prune           prune.Mode
 	chainConfig     *params.ChainConfig
 	snapshots       *snapshotsync.AllSnapshots
+	batch           *batchSenders // nil - senders are recovered transaction by transaction
 }
 
-func StageSendersCfg(db kv.RwDB, chainCfg *params.ChainConfig, tmpdir string, prune prune.Mode, snapshots *snapshotsync.AllSnapshots) SendersCfg {
+// StageSendersCfg - recoverer is optional, see crypto.BatchRecoverer
+func StageSendersCfg(db kv.RwDB, chainCfg *params.ChainConfig, tmpdir string, prune prune.Mode, snapshots *snapshotsync.AllSnapshots, recoverer crypto.BatchRecoverer) SendersCfg {
 	const sendersBatchSize = 10000
 	const sendersBlockSize = 4096
 
+	var batch *batchSenders
+	if recoverer != nil {
+		batch = &batchSenders{recoverer: recoverer}
+	}
 	return SendersCfg{
 		db:              db,
 		batchSize:       sendersBatchSize,
@@ -54,6 +62,7 @@ func StageSendersCfg(db kv.RwDB, chainCfg *params.ChainConfig, tmpdir string, pr
 		chainConfig:     chainCfg,
 		prune:           prune,
 		snapshots:       snapshots,
+		batch:           batch,
 	}
 }
 
@@ -137,6 +146,10 @@ func SpawnRecoverSendersStage(cfg SendersCfg, s *StageState, u Unwinder, tx kv.R
 			defer debug.LogPanic()
 			defer wg.Done()
 			// each goroutine gets it's own crypto context to make sure they are really parallel
+			if cfg.batch != nil {
+				recoverSendersBatched(ctx, logPrefix, secp256k1.ContextForThread(threadNo), cfg.batch, cfg.chainConfig, jobs, out, quitCh)
+				return
+			}
 			recoverSenders(ctx, logPrefix, secp256k1.ContextForThread(threadNo), cfg.chainConfig, jobs, out, quitCh)
 		}(i)
 	}
@@ -335,6 +348,124 @@ func recoverSenders(ctx context.Context, logPrefix string, cryptoContext *secp25
 	}
 }
 
+// batchSendersTxs - transactions of consecutive blocks are collected into batch of this size for crypto.BatchRecoverer
+const batchSendersTxs = 8192
+
+// batchSendersMaxFailures - batch recoverer failed so many batches in a row is not used until restart
+const batchSendersMaxFailures = 3
+
+// batchSenders - crypto.BatchRecoverer with automatic fallback: batch which it fails is recovered on CPU
+type batchSenders struct {
+	recoverer crypto.BatchRecoverer
+	failures  int32 // atomic, failed batches in a row
+}
+
+func (b *batchSenders) enabled() bool { return atomic.LoadInt32(&b.failures) < batchSendersMaxFailures }
+
+// recover - fills senders of jobs, or their errors
+func (b *batchSenders) recover(logPrefix string, cryptoContext *secp256k1.Context, config *params.ChainConfig, jobs []*senderRecoveryJob, txs int) {
+	hashes, sigs := make([][]byte, 0, txs), make([][]byte, 0, txs)
+	for _, job := range jobs {
+		signer := types.MakeSigner(config, job.blockNumber)
+		job.senders = make([]byte, len(job.body.Transactions)*length.Addr)
+		from := len(hashes)
+		for _, txn := range job.body.Transactions {
+			sighash, sig, err := signer.RecoveryInput(txn)
+			if err != nil {
+				job.err = fmt.Errorf("%s: error recovering sender for tx=%x, %w", logPrefix, txn.Hash(), err)
+				hashes, sigs = hashes[:from], sigs[:from]
+				break
+			}
+			hashes, sigs = append(hashes, sighash[:]), append(sigs, sig)
+		}
+	}
+
+	pubkeys := make([][]byte, len(hashes))
+	if b.enabled() {
+		if err := b.recoverer.RecoverBatch(hashes, sigs, pubkeys); err != nil {
+			if atomic.AddInt32(&b.failures, 1) == batchSendersMaxFailures {
+				log.Warn(fmt.Sprintf("[%s] Batch recovery of senders failed, falling back to CPU", logPrefix), "err", err)
+			}
+			pubkeys = make([][]byte, len(hashes))
+		} else {
+			atomic.StoreInt32(&b.failures, 0)
+		}
+	}
+
+	i := 0
+	for _, job := range jobs {
+		if job.err != nil {
+			continue
+		}
+		for j, txn := range job.body.Transactions {
+			pub := pubkeys[i]
+			var err error
+			if pub == nil {
+				// not recovered by batch recoverer - CPU one also gives exact error
+				pub, err = crypto.EcrecoverWithContext(cryptoContext, hashes[i], sigs[i])
+			}
+			i++
+			var from common.Address
+			if err == nil {
+				from, err = types.PubkeyToSender(pub)
+			}
+			if err != nil {
+				job.err = fmt.Errorf("%s: error recovering sender for tx=%x, %w", logPrefix, txn.Hash(), err)
+				i += len(job.body.Transactions) - j - 1
+				break
+			}
+			copy(job.senders[j*length.Addr:], from[:])
+		}
+	}
+}
+
+// recoverSendersBatched - as recoverSenders, but collects jobs which are ready into batches for crypto.BatchRecoverer
+func recoverSendersBatched(ctx context.Context, logPrefix string, cryptoContext *secp256k1.Context, batch *batchSenders, config *params.ChainConfig, in, out chan *senderRecoveryJob, quit <-chan struct{}) {
+	var jobs []*senderRecoveryJob
+	for closed := false; !closed; {
+		txs := 0
+		jobs = jobs[:0]
+		select {
+		case job, ok := <-in:
+			if !ok || job == nil {
+				return
+			}
+			jobs, txs = append(jobs, job), len(job.body.Transactions)
+		case <-ctx.Done():
+			return
+		case <-quit:
+			return
+		}
+	Collect:
+		for txs < batchSendersTxs {
+			select {
+			case job, ok := <-in:
+				if !ok || job == nil {
+					closed = true
+					break Collect
+				}
+				jobs, txs = append(jobs, job), txs+len(job.body.Transactions)
+			default:
+				break Collect
+			}
+		}
+
+		batch.recover(logPrefix, cryptoContext, config, jobs, txs)
+		for _, job := range jobs {
+			// prevent sending to close channel
+			if err := libcommon.Stopped(quit); err != nil {
+				job.err = err
+			} else if err = libcommon.Stopped(ctx.Done()); err != nil {
+				job.err = err
+			}
+			out <- job
+			if errors.Is(job.err, libcommon.ErrStopped) {
+				return
+			}
+		}
+	}
+}
+
 func UnwindSendersStage(s *UnwindState, tx kv.RwTx, cfg SendersCfg, ctx context.Context) (err error) {
 	useExternalTx := tx != nil
 	if !useExternalTx {
@@ -372,7 +503,7 @@ func PruneSendersStage(s *PruneState, tx kv.RwTx, cfg SendersCfg, ctx context.Co
 		defer tx.Rollback()
 	}
 
-	if err = PruneTable(tx, kv.Senders, s.LogPrefix(), to, logEvery, ctx); err != nil {
+	if err = PruneTable(tx, kv.Senders, s, to, logEvery, ctx); err != nil {
 		return err
 	}
 
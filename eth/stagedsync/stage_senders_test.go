@@ -2,6 +2,7 @@ package stagedsync
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	"github.com/ledgerwatch/erigon-lib/kv/memdb"
@@ -108,7 +109,7 @@ func TestSenders(t *testing.T) {
 
 	require.NoError(stages.SaveStageProgress(tx, stages.Bodies, 3))
 
-	cfg := StageSendersCfg(db, params.TestChainConfig, "", prune.Mode{}, nil)
+	cfg := StageSendersCfg(db, params.TestChainConfig, "", prune.Mode{}, nil, nil)
 	err := SpawnRecoverSendersStage(cfg, &StageState{ID: stages.Senders}, nil, tx, 3, ctx)
 	assert.NoError(t, err)
 
@@ -149,3 +150,49 @@ func TestSenders(t *testing.T) {
 	}
 
 }
+
+// loopBatchRecoverer - recovers batch signature by signature, as an accelerator would do it
+type loopBatchRecoverer struct{}
+
+func (loopBatchRecoverer) RecoverBatch(hashes, sigs, pubkeys [][]byte) error {
+	for i := range hashes {
+		pubkeys[i], _ = crypto.Ecrecover(hashes[i], sigs[i])
+	}
+	return nil
+}
+
+type failingBatchRecoverer struct{}
+
+func (failingBatchRecoverer) RecoverBatch(hashes, sigs, pubkeys [][]byte) error {
+	return fmt.Errorf("device is not available")
+}
+
+func TestSendersBatched(t *testing.T) {
+	testKey, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr := crypto.PubkeyToAddress(testKey.PublicKey)
+	signer := types.MakeSigner(params.TestChainConfig, 1)
+	// failing recoverer is disabled after few batches, senders are recovered on CPU
+	for _, recoverer := range []crypto.BatchRecoverer{loopBatchRecoverer{}, failingBatchRecoverer{}} {
+		db, tx := memdb.NewTestTx(t)
+		require := require.New(t)
+		for blockNum := uint64(1); blockNum <= 5; blockNum++ {
+			txn, err := types.SignTx(&types.LegacyTx{
+				CommonTx: types.CommonTx{Nonce: blockNum, To: &testAddr, Value: u256.Num1, Gas: 21000},
+				GasPrice: u256.Num1,
+			}, *signer, testKey)
+			require.NoError(err)
+			hash := common.BytesToHash([]byte{byte(blockNum)})
+			require.NoError(rawdb.WriteBody(tx, hash, blockNum, &types.Body{Transactions: []types.Transaction{txn}}))
+			require.NoError(rawdb.WriteCanonicalHash(tx, hash, blockNum))
+		}
+		require.NoError(stages.SaveStageProgress(tx, stages.Bodies, 5))
+
+		cfg := StageSendersCfg(db, params.TestChainConfig, "", prune.Mode{}, nil, recoverer)
+		require.NoError(SpawnRecoverSendersStage(cfg, &StageState{ID: stages.Senders}, nil, tx, 5, context.Background()))
+		for blockNum := uint64(1); blockNum <= 5; blockNum++ {
+			senders, err := rawdb.ReadSenders(tx, common.BytesToHash([]byte{byte(blockNum)}), blockNum)
+			require.NoError(err)
+			require.Equal([]common.Address{testAddr}, senders)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package stagedsync
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// StateAccess stage folds per-block access sets (rawdb.StateAccessSet, written by Execution stage) into
+// last access block of every account and storage slot (rawdb.StateLastAccess) - for state expiry research.
+
+type StateAccessCfg struct {
+	db    kv.RwDB
+	prune prune.Mode
+}
+
+func StageStateAccessCfg(db kv.RwDB, prune prune.Mode) StateAccessCfg {
+	return StateAccessCfg{
+		db:    db,
+		prune: prune,
+	}
+}
+
+// writeStateAccessSet - called by Execution stage for every block
+func writeStateAccessSet(tx kv.RwTx, blockNum uint64, accessRecorder *state.AccessRecorder) error {
+	c, err := tx.RwCursorDupSort(rawdb.StateAccessSet)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	blockNumBytes := dbutils.EncodeBlockNumber(blockNum)
+	return accessRecorder.ForEach(func(key []byte, deleted bool) error {
+		v := key
+		if deleted {
+			v = append(libcommon.Copy(key), 1)
+		}
+		return c.Put(blockNumBytes, v)
+	})
+}
+
+func truncateStateAccessSet(tx kv.RwTx, from uint64) error {
+	c, err := tx.RwCursorDupSort(rawdb.StateAccessSet)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for k, _, err := c.Seek(dbutils.EncodeBlockNumber(from)); k != nil; k, _, err = c.NextNoDup() {
+		if err != nil {
+			return err
+		}
+		if err = c.DeleteCurrentDuplicates(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeStateAccess - value of rawdb.StateAccessSet to key of rawdb.StateLastAccess
+func decodeStateAccess(v []byte) (key []byte, deleted bool) {
+	if len(v) == 20+1 || len(v) == 20+32+1 {
+		return v[:len(v)-1], true
+	}
+	return v, false
+}
+
+func SpawnStateAccessStage(s *StageState, tx kv.RwTx, cfg StateAccessCfg, ctx context.Context) (err error) {
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	endBlock, err := s.ExecutionAt(tx)
+	if err != nil {
+		return fmt.Errorf("getting last executed block: %w", err)
+	}
+	if endBlock <= s.BlockNumber {
+		return nil
+	}
+	logPrefix := s.LogPrefix()
+	if endBlock-s.BlockNumber > 16 {
+		log.Info(fmt.Sprintf("[%s] Tracking state access", logPrefix), "from", s.BlockNumber, "to", endBlock)
+	}
+	if err = promoteStateAccess(logPrefix, tx, s.BlockNumber+1, endBlock, ctx); err != nil {
+		return err
+	}
+	if err = s.Update(tx, endBlock); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func promoteStateAccess(logPrefix string, tx kv.RwTx, startBlock, endBlock uint64, ctx context.Context) error {
+	logEvery := time.NewTicker(logInterval)
+	defer logEvery.Stop()
+
+	sets, err := tx.CursorDupSort(rawdb.StateAccessSet)
+	if err != nil {
+		return err
+	}
+	defer sets.Close()
+	lastAccess, err := tx.RwCursor(rawdb.StateLastAccess)
+	if err != nil {
+		return err
+	}
+	defer lastAccess.Close()
+	changeSets, err := tx.RwCursorDupSort(rawdb.StateLastAccessChangeSet)
+	if err != nil {
+		return err
+	}
+	defer changeSets.Close()
+
+	for k, v, err := sets.Seek(dbutils.EncodeBlockNumber(startBlock)); k != nil; k, v, err = sets.Next() {
+		if err != nil {
+			return err
+		}
+		blockNum := binary.BigEndian.Uint64(k)
+		if blockNum > endBlock {
+			break
+		}
+		select {
+		case <-logEvery.C:
+			log.Info(fmt.Sprintf("[%s] Progress", logPrefix), "number", blockNum)
+		case <-ctx.Done():
+			return libcommon.ErrStopped
+		default:
+		}
+
+		key, deleted := decodeStateAccess(v)
+		_, prev, err := lastAccess.SeekExact(key)
+		if err != nil {
+			return err
+		}
+		change := make([]byte, len(key)+8)
+		copy(change, key)
+		if len(prev) == 8 {
+			copy(change[len(key):], prev)
+		}
+		if err = changeSets.Put(libcommon.Copy(k), change); err != nil {
+			return err
+		}
+		if deleted {
+			if prev != nil {
+				if err = lastAccess.Delete(key, nil); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err = lastAccess.Put(libcommon.Copy(key), libcommon.Copy(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func UnwindStateAccessStage(u *UnwindState, s *StageState, tx kv.RwTx, cfg StateAccessCfg, ctx context.Context) (err error) {
+	if s.BlockNumber <= u.UnwindPoint {
+		return nil
+	}
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	logPrefix := u.LogPrefix()
+	if s.BlockNumber-u.UnwindPoint > 16 {
+		log.Info(fmt.Sprintf("[%s] Unwind", logPrefix), "from", s.BlockNumber, "to", u.UnwindPoint)
+	}
+	if err = unwindStateAccess(tx, u.UnwindPoint, ctx); err != nil {
+		return err
+	}
+	if err = u.Done(tx); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unwindStateAccess - restore previous values from rawdb.StateLastAccessChangeSet, newest blocks first
+func unwindStateAccess(tx kv.RwTx, unwindPoint uint64, ctx context.Context) error {
+	changeSets, err := tx.RwCursorDupSort(rawdb.StateLastAccessChangeSet)
+	if err != nil {
+		return err
+	}
+	defer changeSets.Close()
+
+	for k, v, err := changeSets.Last(); k != nil; k, v, err = changeSets.Prev() {
+		if err != nil {
+			return err
+		}
+		if binary.BigEndian.Uint64(k) <= unwindPoint {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return libcommon.ErrStopped
+		default:
+		}
+		key, prev := v[:len(v)-8], v[len(v)-8:]
+		if binary.BigEndian.Uint64(prev) == 0 {
+			err = tx.Delete(rawdb.StateLastAccess, key, nil)
+		} else {
+			err = tx.Put(rawdb.StateLastAccess, libcommon.Copy(key), libcommon.Copy(prev))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for k, _, err := changeSets.Seek(dbutils.EncodeBlockNumber(unwindPoint + 1)); k != nil; k, _, err = changeSets.NextNoDup() {
+		if err != nil {
+			return err
+		}
+		if err = changeSets.DeleteCurrentDuplicates(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func PruneStateAccessStage(s *PruneState, tx kv.RwTx, cfg StateAccessCfg, ctx context.Context) (err error) {
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	logEvery := time.NewTicker(logInterval)
+	defer logEvery.Stop()
+
+	// per-block sets are needed only to unwind and for offline analysis - prune them together with history
+	if cfg.prune.History.Enabled() {
+		pruneTo := cfg.prune.History.PruneTo(s.ForwardProgress)
+		if err = PruneTableDupSort(tx, rawdb.StateAccessSet, s, pruneTo, logEvery, ctx); err != nil {
+			return err
+		}
+		if err = PruneTableDupSort(tx, rawdb.StateLastAccessChangeSet, s, pruneTo, logEvery, ctx); err != nil {
+			return err
+		}
+	}
+	if err = s.Done(tx); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package stagedsync
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/stretchr/testify/require"
+)
+
+func lastAccessOf(t *testing.T, tx kv.Tx, key []byte) uint64 {
+	v, err := tx.GetOne(rawdb.StateLastAccess, key)
+	require.NoError(t, err)
+	if v == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+func countOf(t *testing.T, tx kv.Tx, table string) uint64 {
+	c, err := tx.Cursor(table)
+	require.NoError(t, err)
+	defer c.Close()
+	cnt, err := c.Count()
+	require.NoError(t, err)
+	return cnt
+}
+
+func TestStateAccess(t *testing.T) {
+	ctx := context.Background()
+	_, tx := memdb.NewTestTx(t)
+	acc1, acc2 := common.Address{1}, common.Address{2}
+	slot := append(acc1.Bytes(), common.Hash{3}.Bytes()...)
+
+	write := func(blockNum uint64, updated, deleted []common.Address) {
+		rec := state.NewAccessRecorder()
+		_, err := rec.Reader(state.NewPlainStateReader(tx)).ReadAccountData(common.Address{9}) // absent account is not recorded
+		require.NoError(t, err)
+		w := rec.Writer(state.NewNoopWriter())
+		for _, a := range updated {
+			require.NoError(t, w.UpdateAccountData(a, nil, nil))
+		}
+		for _, a := range deleted {
+			require.NoError(t, w.DeleteAccount(a, nil))
+		}
+		require.NoError(t, writeStateAccessSet(tx, blockNum, rec))
+	}
+	write(1, []common.Address{acc1}, nil)
+	require.NoError(t, tx.Put(rawdb.StateAccessSet, dbutils.EncodeBlockNumber(1), slot))
+	write(2, []common.Address{acc2}, nil)
+	write(3, []common.Address{acc1}, nil)
+	write(4, nil, []common.Address{acc2})
+
+	require.NoError(t, promoteStateAccess("test", tx, 1, 2, ctx))
+	require.Equal(t, uint64(1), lastAccessOf(t, tx, acc1[:]))
+	require.Equal(t, uint64(1), lastAccessOf(t, tx, slot))
+	require.Equal(t, uint64(2), lastAccessOf(t, tx, acc2[:]))
+
+	require.NoError(t, promoteStateAccess("test", tx, 3, 4, ctx))
+	require.Equal(t, uint64(3), lastAccessOf(t, tx, acc1[:]))
+	require.Equal(t, uint64(0), lastAccessOf(t, tx, acc2[:]))
+
+	// unwind 4->1 restores values of block 1
+	require.NoError(t, unwindStateAccess(tx, 1, ctx))
+	require.Equal(t, uint64(1), lastAccessOf(t, tx, acc1[:]))
+	require.Equal(t, uint64(1), lastAccessOf(t, tx, slot))
+	require.Equal(t, uint64(0), lastAccessOf(t, tx, acc2[:]))
+	require.NoError(t, truncateStateAccessSet(tx, 2))
+
+	// unwind 1->0 leaves nothing
+	require.NoError(t, unwindStateAccess(tx, 0, ctx))
+	for _, table := range []string{rawdb.StateLastAccess, rawdb.StateLastAccessChangeSet} {
+		require.Zero(t, countOf(t, tx, table), table)
+	}
+	require.Equal(t, uint64(2), countOf(t, tx, rawdb.StateAccessSet))
+}
@@ -0,0 +1,174 @@
+package stagedsync
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/interfaces"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/statediff"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// StateDiffs stage re-executes transactions over historical state and stores their state diffs (rawdb.StateDiffs),
+// so trace_replayBlockTransactions with "stateDiff" trace is served without re-execution.
+// Diffs are archival: they are not pruned together with history.
+
+type StateDiffsCfg struct {
+	db          kv.RwDB
+	prune       prune.Mode
+	chainConfig *params.ChainConfig
+	blockReader interfaces.FullBlockReader
+}
+
+func StageStateDiffsCfg(db kv.RwDB, prune prune.Mode, chainConfig *params.ChainConfig, blockReader interfaces.FullBlockReader) StateDiffsCfg {
+	return StateDiffsCfg{
+		db:          db,
+		prune:       prune,
+		chainConfig: chainConfig,
+		blockReader: blockReader,
+	}
+}
+
+func SpawnStateDiffsStage(s *StageState, tx kv.RwTx, cfg StateDiffsCfg, ctx context.Context) (err error) {
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	// historical state is read through history index
+	endBlock, err := stages.GetStageProgress(tx, stages.AccountHistoryIndex)
+	if err != nil {
+		return err
+	}
+	storageIndexed, err := stages.GetStageProgress(tx, stages.StorageHistoryIndex)
+	if err != nil {
+		return err
+	}
+	if storageIndexed < endBlock {
+		endBlock = storageIndexed
+	}
+	if endBlock <= s.BlockNumber {
+		return nil
+	}
+	logPrefix := s.LogPrefix()
+	startBlock := s.BlockNumber + 1
+	if cfg.prune.History.Enabled() {
+		historyPruned, err := stages.GetStagePruneProgress(tx, stages.AccountHistoryIndex)
+		if err != nil {
+			return err
+		}
+		// diffs of a block are computed over the history of its parent
+		if pruneTo := cfg.prune.History.PruneTo(historyPruned); historyPruned > 0 && startBlock <= pruneTo {
+			log.Warn(fmt.Sprintf("[%s] History is pruned, state diffs of earlier blocks are skipped", logPrefix), "from", startBlock, "to", pruneTo)
+			startBlock = pruneTo + 1
+		}
+	}
+	if startBlock+16 < endBlock {
+		log.Info(fmt.Sprintf("[%s] Recording state diffs", logPrefix), "from", startBlock, "to", endBlock)
+	}
+	if err = promoteStateDiffs(logPrefix, tx, cfg, startBlock, endBlock, ctx); err != nil {
+		return err
+	}
+	if err = s.Update(tx, endBlock); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func promoteStateDiffs(logPrefix string, tx kv.RwTx, cfg StateDiffsCfg, startBlock, endBlock uint64, ctx context.Context) error {
+	logEvery := time.NewTicker(logInterval)
+	defer logEvery.Stop()
+
+	for blockNum := startBlock; blockNum <= endBlock; blockNum++ {
+		select {
+		case <-logEvery.C:
+			log.Info(fmt.Sprintf("[%s] Progress", logPrefix), "number", blockNum)
+		default:
+		}
+		block, senders, err := readCanonicalBlock(ctx, tx, cfg.blockReader, blockNum)
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			return fmt.Errorf("[%s] block %d not found", logPrefix, blockNum)
+		}
+		if len(block.Transactions()) == 0 {
+			continue
+		}
+		if len(senders) == len(block.Transactions()) {
+			for i, txn := range block.Transactions() {
+				txn.SetSender(senders[i])
+			}
+		}
+		diffs, err := statediff.ComputeBlock(ctx, tx, cfg.chainConfig, block)
+		if err != nil {
+			return fmt.Errorf("[%s] %w", logPrefix, err)
+		}
+		if err = statediff.WriteBlock(tx, blockNum, diffs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func UnwindStateDiffsStage(u *UnwindState, s *StageState, tx kv.RwTx, cfg StateDiffsCfg, ctx context.Context) (err error) {
+	if s.BlockNumber <= u.UnwindPoint {
+		return nil
+	}
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	if err = statediff.Truncate(tx, u.UnwindPoint+1); err != nil {
+		return err
+	}
+	if err = u.Done(tx); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneStateDiffsStage - diffs are kept for all blocks, it's the point of the stage
+func PruneStateDiffsStage(s *PruneState, tx kv.RwTx, cfg StateDiffsCfg, ctx context.Context) (err error) {
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		tx, err = cfg.db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+	if err = s.Done(tx); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
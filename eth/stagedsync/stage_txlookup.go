@@ -6,9 +6,12 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math/big"
+	"time"
 
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/etl"
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/interfaces"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/dbutils"
 	"github.com/ledgerwatch/erigon/core/rawdb"
@@ -16,6 +19,7 @@ import (
 	"github.com/ledgerwatch/erigon/ethdb/prune"
 	"github.com/ledgerwatch/erigon/rlp"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/log/v3"
 )
 
 type TxLookupCfg struct {
@@ -57,10 +61,20 @@ func SpawnTxLookup(s *StageState, tx kv.RwTx, cfg TxLookupCfg, ctx context.Conte
 
 	startBlock := s.BlockNumber
 	pruneTo := cfg.prune.TxIndex.PruneTo(endBlock)
+	if cfg.prune.Experiments.TxBloom {
+		// blocks of incomplete segment keep TxLookupCompact entries until the segment gets bloom filter
+		pruneTo = pruneTo / rawdb.TxLookupBloomSegmentSize * rawdb.TxLookupBloomSegmentSize
+	}
 	if startBlock < pruneTo {
 		startBlock = pruneTo
 	}
 
+	// Snapshots don't have UncleInclusion index - build it for all blocks, except pruned by TxIndex prune mode
+	uncleStartBlock := startBlock
+	if uncleStartBlock > 0 {
+		uncleStartBlock++
+	}
+
 	// Snapshot .idx files already have TxLookup index - then no reason iterate over them here
 	if cfg.snapshots != nil && cfg.snapshots.BlocksAvailable() > startBlock {
 		startBlock = cfg.snapshots.BlocksAvailable()
@@ -72,6 +86,9 @@ func SpawnTxLookup(s *StageState, tx kv.RwTx, cfg TxLookupCfg, ctx context.Conte
 	if err = TxLookupTransform(logPrefix, tx, startKey, dbutils.EncodeBlockNumber(endBlock), quitCh, cfg); err != nil {
 		return err
 	}
+	if err = UncleInclusionTransform(logPrefix, tx, dbutils.EncodeBlockNumber(uncleStartBlock), dbutils.EncodeBlockNumber(endBlock), ctx, cfg); err != nil {
+		return err
+	}
 	if err = s.Update(tx, endBlock); err != nil {
 		return err
 	}
@@ -85,8 +102,7 @@ func SpawnTxLookup(s *StageState, tx kv.RwTx, cfg TxLookupCfg, ctx context.Conte
 }
 
 func TxLookupTransform(logPrefix string, tx kv.RwTx, startKey, endKey []byte, quitCh <-chan struct{}, cfg TxLookupCfg) error {
-	bigNum := new(big.Int)
-	return etl.Transform(logPrefix, tx, kv.HeaderCanonical, kv.TxLookup, cfg.tmpdir, func(k []byte, v []byte, next etl.ExtractNextFunc) error {
+	return etl.Transform(logPrefix, tx, kv.HeaderCanonical, rawdb.TxLookupCompact, cfg.tmpdir, func(k []byte, v []byte, next etl.ExtractNextFunc) error {
 		blocknum := binary.BigEndian.Uint64(k)
 		blockHash := common.BytesToHash(v)
 		body := rawdb.ReadBodyWithTransactions(tx, blockHash, blocknum)
@@ -94,8 +110,9 @@ func TxLookupTransform(logPrefix string, tx kv.RwTx, startKey, endKey []byte, qu
 			return fmt.Errorf("empty block body %d, hash %x", blocknum, v)
 		}
 
+		blockNumValue := rawdb.EncodeTxLookupValue(blocknum)
 		for _, txn := range body.Transactions {
-			if err := next(k, txn.Hash().Bytes(), bigNum.SetUint64(blocknum).Bytes()); err != nil {
+			if err := next(k, rawdb.TxLookupKey(txn.Hash()), blockNumValue); err != nil {
 				return err
 			}
 		}
@@ -104,6 +121,64 @@ func TxLookupTransform(logPrefix string, tx kv.RwTx, startKey, endKey []byte, qu
 		Quit:            quitCh,
 		ExtractStartKey: startKey,
 		ExtractEndKey:   endKey,
+		Comparator:      rawdb.CmpTxLookup,
+		LogDetailsExtract: func(k, v []byte) (additionalLogArguments []interface{}) {
+			return []interface{}{"block", binary.BigEndian.Uint64(k)}
+		},
+	})
+}
+
+// UncleInclusionTransform - builds index uncleHash -> number of canonical block which included this uncle.
+// Bodies are read by blockReader - because blocks may be stored in snapshots.
+func UncleInclusionTransform(logPrefix string, tx kv.RwTx, startKey, endKey []byte, ctx context.Context, cfg TxLookupCfg) error {
+	var blockReader interfaces.UnclesReader
+	if cfg.snapshots != nil {
+		blockReader = snapshotsync.NewBlockReaderWithSnapshots(cfg.snapshots)
+	} else {
+		blockReader = snapshotsync.NewBlockReader()
+	}
+	bigNum := new(big.Int)
+	return etl.Transform(logPrefix, tx, kv.HeaderCanonical, rawdb.UncleInclusion, cfg.tmpdir, func(k []byte, v []byte, next etl.ExtractNextFunc) error {
+		blocknum := binary.BigEndian.Uint64(k)
+		uncles, err := blockReader.Uncles(ctx, tx, common.BytesToHash(v), blocknum)
+		if err != nil {
+			return err
+		}
+		for _, uncle := range uncles {
+			if err := next(k, uncle.Hash().Bytes(), bigNum.SetUint64(blocknum).Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, etl.IdentityLoadFunc, etl.TransformArgs{
+		Quit:            ctx.Done(),
+		ExtractStartKey: startKey,
+		ExtractEndKey:   endKey,
+		LogDetailsExtract: func(k, v []byte) (additionalLogArguments []interface{}) {
+			return []interface{}{"block", binary.BigEndian.Uint64(k)}
+		},
+	})
+}
+
+// deleteUncleInclusion - removes UncleInclusion entries of blocks in range [from, to)
+func deleteUncleInclusion(logPrefix string, tx kv.RwTx, from, to uint64, tmpdir string, quitCh <-chan struct{}) error {
+	reader := bytes.NewReader(nil)
+	return etl.Transform(logPrefix, tx, kv.BlockBody, rawdb.UncleInclusion, tmpdir, func(k, v []byte, next etl.ExtractNextFunc) error {
+		body := new(types.BodyForStorage)
+		reader.Reset(v)
+		if err := rlp.Decode(reader, body); err != nil {
+			return fmt.Errorf("rlp decode err: %w", err)
+		}
+		for _, uncle := range body.Uncles {
+			if err := next(k, uncle.Hash().Bytes(), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, etl.IdentityLoadFunc, etl.TransformArgs{
+		Quit:            quitCh,
+		ExtractStartKey: dbutils.EncodeBlockNumber(from),
+		ExtractEndKey:   dbutils.EncodeBlockNumber(to),
 		LogDetailsExtract: func(k, v []byte) (additionalLogArguments []interface{}) {
 			return []interface{}{"block", binary.BigEndian.Uint64(k)}
 		},
@@ -127,6 +202,12 @@ func UnwindTxLookup(u *UnwindState, s *StageState, tx kv.RwTx, cfg TxLookupCfg,
 	if err := unwindTxLookup(u, s, tx, cfg, quitCh); err != nil {
 		return err
 	}
+	if err := deleteUncleInclusion(s.LogPrefix(), tx, u.UnwindPoint+1, s.BlockNumber+1, cfg.tmpdir, quitCh); err != nil {
+		return err
+	}
+	if err := rawdb.DeleteTxBlooms(tx, (u.UnwindPoint+1)/rawdb.TxLookupBloomSegmentSize); err != nil {
+		return err
+	}
 	if err := u.Done(tx); err != nil {
 		return err
 	}
@@ -139,9 +220,31 @@ func UnwindTxLookup(u *UnwindState, s *StageState, tx kv.RwTx, cfg TxLookupCfg,
 }
 
 func unwindTxLookup(u *UnwindState, s *StageState, tx kv.RwTx, cfg TxLookupCfg, quitCh <-chan struct{}) error {
+	// end needs to be s.BlockNumber + 1 and not s.BlockNumber, because
+	// the keys in BlockBody table always have hash after the block number
+	return deleteTxLookup(s.LogPrefix(), tx, u.UnwindPoint+1, s.BlockNumber+1, quitCh)
+}
+
+// deleteTxLookup - removes TxLookup entries of blocks in range [from, to).
+// Entries are deleted as exact (key, value) pairs - because other transactions may have same key (hash prefix).
+func deleteTxLookup(logPrefix string, tx kv.RwTx, from, to uint64, quitCh <-chan struct{}) error {
+	logEvery := time.NewTicker(logInterval)
+	defer logEvery.Stop()
+
+	c, err := tx.Cursor(kv.BlockBody)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
 	reader := bytes.NewReader(nil)
-	logPrefix := s.LogPrefix()
-	return etl.Transform(logPrefix, tx, kv.BlockBody, kv.TxLookup, cfg.tmpdir, func(k, v []byte, next etl.ExtractNextFunc) error {
+	for k, v, err := c.Seek(dbutils.EncodeBlockNumber(from)); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		blockNum := binary.BigEndian.Uint64(k)
+		if blockNum >= to {
+			break
+		}
 		body := new(types.BodyForStorage)
 		reader.Reset(v)
 		if err := rlp.Decode(reader, body); err != nil {
@@ -153,27 +256,24 @@ func unwindTxLookup(u *UnwindState, s *StageState, tx kv.RwTx, cfg TxLookupCfg,
 			return err
 		}
 		for _, txn := range txs {
-			if err = next(k, txn.Hash().Bytes(), nil); err != nil {
+			if err = rawdb.DeleteTxLookupEntry(tx, txn.Hash(), blockNum); err != nil {
 				return err
 			}
 		}
-		return nil
-	}, etl.IdentityLoadFunc, etl.TransformArgs{
-		Quit:            quitCh,
-		ExtractStartKey: dbutils.EncodeBlockNumber(u.UnwindPoint + 1),
-		// end key needs to be s.BlockNumber + 1 and not s.BlockNumber, because
-		// the keys in BlockBody table always have hash after the block number
-		ExtractEndKey: dbutils.EncodeBlockNumber(s.BlockNumber + 1),
-		LogDetailsExtract: func(k, v []byte) (additionalLogArguments []interface{}) {
-			return []interface{}{"block", binary.BigEndian.Uint64(k)}
-		},
-	})
+
+		if err = libcommon.Stopped(quitCh); err != nil {
+			return err
+		}
+		select {
+		case <-logEvery.C:
+			log.Info(fmt.Sprintf("[%s] Deleting TxLookup entries", logPrefix), "block", blockNum)
+		default:
+		}
+	}
+	return nil
 }
 
 func PruneTxLookup(s *PruneState, tx kv.RwTx, cfg TxLookupCfg, ctx context.Context) (err error) {
-	if !cfg.prune.TxIndex.Enabled() {
-		return nil
-	}
 	logPrefix := s.LogPrefix()
 	useExternalTx := tx != nil
 	if !useExternalTx {
@@ -184,17 +284,35 @@ func PruneTxLookup(s *PruneState, tx kv.RwTx, cfg TxLookupCfg, ctx context.Conte
 		defer tx.Rollback()
 	}
 
-	to := cfg.prune.TxIndex.PruneTo(s.ForwardProgress)
-	// Forward stage doesn't write anything before PruneTo point
-	// TODO: maybe need do binary search of values in db in this case
-	if s.PruneProgress != 0 {
-		if err = pruneTxLookup(tx, logPrefix, cfg.tmpdir, s, to, ctx); err != nil {
-			return err
-		}
+	var to uint64
+	if cfg.prune.TxIndex.Enabled() {
+		to = cfg.prune.TxIndex.PruneTo(s.ForwardProgress)
 	}
-	if err = s.Done(tx); err != nil {
+	if err = moveLegacyTxLookup(logPrefix, tx, to, ctx.Done()); err != nil {
 		return err
 	}
+	if cfg.prune.TxIndex.Enabled() {
+		if cfg.prune.Experiments.TxBloom {
+			if err = txLookupToBlooms(logPrefix, tx, to, cfg, ctx.Done()); err != nil {
+				return err
+			}
+		}
+		// Forward stage doesn't write anything before PruneTo point
+		// TODO: maybe need do binary search of values in db in this case
+		if s.PruneProgress != 0 {
+			// previous prune removed entries of blocks before PruneTo of its progress
+			from := cfg.prune.TxIndex.PruneTo(s.PruneProgress)
+			if err = pruneTxLookup(tx, logPrefix, from, to, ctx); err != nil {
+				return err
+			}
+			if err = deleteUncleInclusion(logPrefix, tx, from, to, cfg.tmpdir, ctx.Done()); err != nil {
+				return err
+			}
+		}
+		if err = s.Done(tx); err != nil {
+			return err
+		}
+	}
 
 	if !useExternalTx {
 		if err = tx.Commit(); err != nil {
@@ -204,31 +322,111 @@ func PruneTxLookup(s *PruneState, tx kv.RwTx, cfg TxLookupCfg, ctx context.Conte
 	return nil
 }
 
-func pruneTxLookup(tx kv.RwTx, logPrefix, tmpDir string, s *PruneState, pruneTo uint64, ctx context.Context) error {
-	reader := bytes.NewReader(nil)
-	return etl.Transform(logPrefix, tx, kv.BlockBody, kv.TxLookup, tmpDir, func(k, v []byte, next etl.ExtractNextFunc) error {
-		body := new(types.BodyForStorage)
-		reader.Reset(v)
-		if err := rlp.Decode(reader, body); err != nil {
-			return fmt.Errorf("rlp decode: %w", err)
-		}
+// legacyTxLookupBatch - amount of kv.TxLookup entries moved by one prune cycle
+const legacyTxLookupBatch = 1_000_000
 
-		txs, err := rawdb.CanonicalTransactions(tx, body.BaseTxId, body.TxAmount)
+// moveLegacyTxLookup - moves entries of kv.TxLookup (txHash -> blockNum, layout of previous versions) to
+// TxLookupCompact, entries of blocks before pruneTo are just deleted. Database is converted in batches by prune
+// cycles - without blocking startup, until then lookups read kv.TxLookup as fallback.
+func moveLegacyTxLookup(logPrefix string, tx kv.RwTx, pruneTo uint64, quitCh <-chan struct{}) error {
+	logEvery := time.NewTicker(logInterval)
+	defer logEvery.Stop()
+
+	c, err := tx.RwCursor(kv.TxLookup)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	bigNum := new(big.Int)
+	moved := 0
+	for k, v, err := c.First(); k != nil && moved < legacyTxLookupBatch; k, v, err = c.Next() {
 		if err != nil {
 			return err
 		}
-		for _, txn := range txs {
-			if err := next(k, txn.Hash().Bytes(), nil); err != nil {
+		if blockNum := bigNum.SetBytes(v).Uint64(); blockNum >= pruneTo {
+			if err = tx.Put(rawdb.TxLookupCompact, rawdb.TxLookupKey(common.BytesToHash(k)), rawdb.EncodeTxLookupValue(blockNum)); err != nil {
 				return err
 			}
 		}
-		return nil
-	}, etl.IdentityLoadFunc, etl.TransformArgs{
-		Quit:            ctx.Done(),
-		ExtractStartKey: dbutils.EncodeBlockNumber(s.ForwardProgress),
-		ExtractEndKey:   dbutils.EncodeBlockNumber(pruneTo),
-		LogDetailsExtract: func(k, v []byte) (additionalLogArguments []interface{}) {
-			return []interface{}{"block", binary.BigEndian.Uint64(k)}
-		},
-	})
+		if err = c.DeleteCurrent(); err != nil {
+			return err
+		}
+		moved++
+
+		if err = libcommon.Stopped(quitCh); err != nil {
+			return err
+		}
+		select {
+		case <-logEvery.C:
+			log.Info(fmt.Sprintf("[%s] Moving legacy TxLookup entries", logPrefix), "moved", moved)
+		default:
+		}
+	}
+	return nil
+}
+
+func pruneTxLookup(tx kv.RwTx, logPrefix string, pruneFrom, pruneTo uint64, ctx context.Context) error {
+	return deleteTxLookup(logPrefix, tx, pruneFrom, pruneTo, ctx.Done())
+}
+
+// txLookupToBlooms - builds bloom filters of complete segments of blocks before pruneTo, and removes TxLookupCompact
+// entries of their transactions. Blocks of snapshots don't get filters - .idx files of snapshots index them, so filter
+// of segment with the last block of snapshots has only transactions of the blocks after it.
+func txLookupToBlooms(logPrefix string, tx kv.RwTx, pruneTo uint64, cfg TxLookupCfg, quitCh <-chan struct{}) error {
+	logEvery := time.NewTicker(logInterval)
+	defer logEvery.Stop()
+
+	var segment, firstBlock uint64
+	last, err := rawdb.ReadLastTxBloomSegment(tx)
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		segment = *last + 1
+	} else if cfg.snapshots != nil && cfg.snapshots.BlocksAvailable() > 0 {
+		firstBlock = cfg.snapshots.BlocksAvailable() + 1
+		segment = firstBlock / rawdb.TxLookupBloomSegmentSize
+	}
+	for ; (segment+1)*rawdb.TxLookupBloomSegmentSize <= pruneTo; segment++ {
+		var hashes []common.Hash
+		from := segment * rawdb.TxLookupBloomSegmentSize
+		blockNum := from
+		if blockNum < firstBlock {
+			blockNum = firstBlock
+		}
+		for ; blockNum < from+rawdb.TxLookupBloomSegmentSize; blockNum++ {
+			blockHash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+			if err != nil {
+				return err
+			}
+			body := rawdb.ReadBodyWithTransactions(tx, blockHash, blockNum)
+			if body == nil {
+				return fmt.Errorf("empty block body %d, hash %x", blockNum, blockHash)
+			}
+			for _, txn := range body.Transactions {
+				txnHash := txn.Hash()
+				if err = rawdb.DeleteTxLookupEntry(tx, txnHash, blockNum); err != nil {
+					return err
+				}
+				hashes = append(hashes, txnHash)
+			}
+		}
+		bloom := rawdb.NewTxBloom(len(hashes))
+		for _, txnHash := range hashes {
+			bloom.Add(txnHash)
+		}
+		if err = rawdb.WriteTxBloom(tx, segment, bloom); err != nil {
+			return err
+		}
+
+		if err = libcommon.Stopped(quitCh); err != nil {
+			return err
+		}
+		select {
+		case <-logEvery.C:
+			log.Info(fmt.Sprintf("[%s] Replacing TxLookup entries by bloom filters", logPrefix), "block", from+rawdb.TxLookupBloomSegmentSize)
+		default:
+		}
+	}
+	return nil
 }
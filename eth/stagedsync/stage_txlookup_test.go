@@ -0,0 +1,84 @@
+package stagedsync
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneTxLookup(t *testing.T) {
+	require := require.New(t)
+	_, tx := memdb.NewTestTx(t)
+
+	var txns []types.Transaction
+	var uncles []*types.Header
+	for i := uint64(1); i <= 20; i++ {
+		txn := types.NewTransaction(i, common.Address{1}, uint256.NewInt(1), 21000, uint256.NewInt(1), nil)
+		uncle := &types.Header{Number: new(big.Int).SetUint64(i - 1), Extra: []byte("uncle")}
+		block := types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(i)}).WithBody(types.Transactions{txn}, []*types.Header{uncle})
+		rawdb.WriteHeader(tx, block.Header())
+		require.NoError(rawdb.WriteCanonicalHash(tx, block.Hash(), i))
+		require.NoError(rawdb.WriteBody(tx, block.Hash(), i, block.Body()))
+		rawdb.WriteTxLookupEntries(tx, block)
+		require.NoError(rawdb.WriteUncleInclusionEntries(tx, i, block.Uncles()))
+		txns, uncles = append(txns, txn), append(uncles, uncle)
+	}
+
+	// previous prune was at block 10 - removed entries before block 5
+	s := &PruneState{ID: stages.TxLookup, ForwardProgress: 20, PruneProgress: 10}
+	cfg := StageTxLookupCfg(nil, prune.Mode{TxIndex: prune.Distance(5)}, t.TempDir(), nil)
+	require.NoError(PruneTxLookup(s, tx, cfg, context.Background()))
+
+	for i := uint64(1); i <= 20; i++ {
+		pruned := i >= 5 && i < 15
+		blockNums, err := rawdb.ReadTxLookupEntries(tx, txns[i-1].Hash())
+		require.NoError(err)
+		require.Equal(pruned, len(blockNums) == 0, i)
+		included, err := rawdb.ReadUncleInclusion(tx, uncles[i-1].Hash())
+		require.NoError(err)
+		require.Equal(pruned, included == nil, i)
+	}
+	progress, err := stages.GetStagePruneProgress(tx, stages.TxLookup)
+	require.NoError(err)
+	require.Equal(uint64(20), progress)
+}
+
+func TestMoveLegacyTxLookup(t *testing.T) {
+	require := require.New(t)
+	_, tx := memdb.NewTestTx(t)
+	hashes := []common.Hash{{1}, {2}, {3, 4}}
+	for i, h := range hashes {
+		require.NoError(tx.Put(kv.TxLookup, h.Bytes(), big.NewInt(int64(i+1)*1000).Bytes()))
+	}
+	// not moved yet - read from legacy table
+	blockNums, err := rawdb.ReadTxLookupEntries(tx, hashes[1])
+	require.NoError(err)
+	require.Equal([]uint64{2000}, blockNums)
+
+	// entries of pruned blocks are not moved
+	s := &PruneState{ID: stages.TxLookup, ForwardProgress: 2500}
+	cfg := StageTxLookupCfg(nil, prune.Mode{TxIndex: prune.Distance(1000)}, t.TempDir(), nil)
+	require.NoError(PruneTxLookup(s, tx, cfg, context.Background()))
+	for i, h := range hashes {
+		blockNums, err := rawdb.ReadTxLookupEntries(tx, h)
+		require.NoError(err)
+		if i == 0 {
+			require.Empty(blockNums)
+		} else {
+			require.Equal([]uint64{uint64(i+1) * 1000}, blockNums)
+		}
+	}
+	legacy, err := tx.GetOne(kv.TxLookup, hashes[2].Bytes())
+	require.NoError(err)
+	require.Nil(legacy)
+}
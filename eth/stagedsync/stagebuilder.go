@@ -17,6 +17,7 @@ type ChainEventNotifier interface {
 
 type Notifications struct {
 	Events               *privateapi.Events
+	ForkChoice           *privateapi.ForkChoice
 	Accumulator          *shards.Accumulator
 	StateChangesConsumer shards.StateChangeConsumer
 }
@@ -31,17 +31,22 @@ type SyncStage string
 var (
 	Headers             SyncStage = "Headers"             // Headers are downloaded, their Proof-Of-Work validity and chaining is verified
 	BlockHashes         SyncStage = "BlockHashes"         // Headers Number are written, fills blockHash => number bucket
+	BorHeimdall         SyncStage = "BorHeimdall"         // Heimdall spans and state sync events are downloaded (Bor chains only)
 	Bodies              SyncStage = "Bodies"              // Block bodies are downloaded, TxHash and UncleHash are getting verified
 	Senders             SyncStage = "Senders"             // "From" recovered from signatures, bodies re-written
 	Execution           SyncStage = "Execution"           // Executing each block w/o buildinf a trie
 	Translation         SyncStage = "Translation"         // Translation each marked for translation contract (from EVM to TEVM)
+	StateAccess         SyncStage = "StateAccess"         // Tracking last access block of accounts and storage slots (state expiry research)
 	IntermediateHashes  SyncStage = "IntermediateHashes"  // Generate intermediate hashes, calculate the state root hash
 	HashState           SyncStage = "HashState"           // Apply Keccak256 to all the keys in the state
 	AccountHistoryIndex SyncStage = "AccountHistoryIndex" // Generating history index for accounts
 	StorageHistoryIndex SyncStage = "StorageHistoryIndex" // Generating history index for storage
+	StateDiffs          SyncStage = "StateDiffs"          // Recording state diffs of transactions for trace_replayBlockTransactions
 	LogIndex            SyncStage = "LogIndex"            // Generating logs index (from receipts)
 	CallTraces          SyncStage = "CallTraces"          // Generating call traces index
+	AddressAppearances  SyncStage = "AddressAppearances"  // Generating index of transactions in which addresses appear
 	TxLookup            SyncStage = "TxLookup"            // Generating transactions lookup index
+	Firehose            SyncStage = "Firehose"            // Streaming executed blocks to external sink
 	Issuance            SyncStage = "WatchTheBurn"        // Compute ether issuance for each block
 	Finish              SyncStage = "Finish"              // Nominal stage after all other stages
 
@@ -53,17 +58,22 @@ var (
 var AllStages = []SyncStage{
 	Headers,
 	BlockHashes,
+	BorHeimdall,
 	Bodies,
 	Senders,
 	Execution,
 	Translation,
+	StateAccess,
 	HashState,
 	IntermediateHashes,
 	AccountHistoryIndex,
 	StorageHistoryIndex,
+	StateDiffs,
 	LogIndex,
 	CallTraces,
+	AddressAppearances,
 	TxLookup,
+	Firehose,
 	Finish,
 }
 
@@ -4,12 +4,17 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/debug"
+	"github.com/ledgerwatch/erigon/common/otel"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/turbo/maintenance"
 	"github.com/ledgerwatch/log/v3"
 )
 
@@ -24,6 +29,19 @@ type Sync struct {
 	currentStage uint
 	timings      []Timing
 	logPrefixes  []string
+
+	maintenance    maintenance.Windows
+	maintenanceLag uint64
+	deferring      bool // outside of maintenance windows at the last cycle
+	now            func() time.Time
+
+	stopCh   chan struct{} // closed by Stop
+	stopOnce sync.Once
+	running  atomic.Value // stages.SyncStage which is running now, for shutdown progress
+
+	traceCtx context.Context // span of running cycle, parent of stage spans. nil outside of cycle
+
+	chain string // label of metrics, see SetChain
 }
 
 type Timing struct {
@@ -162,7 +180,76 @@ func New(stagesList []*Stage, unwindOrder UnwindOrder, pruneOrder PruneOrder) *S
 		unwindOrder:  unwindStages,
 		pruningOrder: pruneStages,
 		logPrefixes:  logPrefixes,
+		now:          time.Now,
+		stopCh:       make(chan struct{}),
+	}
+}
+
+// Stop - asks sync to stop at the next safe checkpoint: before the next stage, or at the end of the current batch of
+// stages which commit their progress in parts (Execution, Headers, Bodies). Unlike cancellation of the context of
+// stages, work of the running stage is committed, not thrown away. Cycle in one transaction is finished.
+func (s *Sync) Stop() { s.stopOnce.Do(func() { close(s.stopCh) }) }
+
+// Stopping - closed when Stop was called
+func (s *Sync) Stopping() <-chan struct{} { return s.stopCh }
+
+// RunningStage - stage which is running now (forward, unwind or prune), empty between cycles
+func (s *Sync) RunningStage() stages.SyncStage {
+	id, _ := s.running.Load().(stages.SyncStage)
+	return id
+}
+
+// SetMaintenance - outside of maintenance windows pruning is not run, and deferrable stages are not run
+// if they are behind Execution stage by more than indexLag blocks. Small lag is always caught up, so
+// indices stay usable for RPC. Empty windows - no restrictions.
+func (s *Sync) SetMaintenance(windows maintenance.Windows, indexLag uint64) {
+	s.maintenance = windows
+	s.maintenanceLag = indexLag
+}
+
+// SetChain - name of the chain, label of sync metrics: nodes of several chains can run in one process (--networks)
+func (s *Sync) SetChain(chain string) { s.chain = chain }
+
+// chainName - label of metrics, empty for stage states created outside of sync
+func (s *Sync) chainName() string {
+	if s == nil {
+		return ""
 	}
+	return s.chain
+}
+
+// deferHeavyWork - whether heavy work must wait for maintenance window, logs on change
+func (s *Sync) deferHeavyWork() bool {
+	deferring := !s.maintenance.Allowed(s.now())
+	if deferring != s.deferring {
+		if deferring {
+			log.Info("Outside of maintenance windows, deferring pruning and index catch-up", "windows", s.maintenance.String(), "next_in", s.maintenance.UntilNext(s.now()).Truncate(time.Minute))
+		} else {
+			log.Info("Maintenance window started", "windows", s.maintenance.String())
+		}
+		s.deferring = deferring
+	}
+	return deferring
+}
+
+// deferStage - deferrable stage which is too far behind Execution, while heavy work is deferred
+func (s *Sync) deferStage(stage *Stage, deferring bool, db kv.RoDB, tx kv.Tx) (bool, error) {
+	if !deferring || !stage.Deferrable {
+		return false, nil
+	}
+	stageState, err := s.StageState(stage.ID, tx, db)
+	if err != nil {
+		return false, err
+	}
+	execution, err := s.StageState(stages.Execution, tx, db)
+	if err != nil {
+		return false, err
+	}
+	if execution.BlockNumber <= stageState.BlockNumber+s.maintenanceLag {
+		return false, nil
+	}
+	log.Debug(fmt.Sprintf("[%s] Deferred till maintenance window", s.LogPrefix()), "progress", stageState.BlockNumber, "execution", execution.BlockNumber)
+	return true, nil
 }
 
 func (s *Sync) StageState(stage stages.SyncStage, tx kv.Tx, db kv.RoDB) (*StageState, error) {
@@ -189,28 +276,41 @@ func (s *Sync) StageState(stage stages.SyncStage, tx kv.Tx, db kv.RoDB) (*StageS
 	return &StageState{s, stage, blockNum}, nil
 }
 
-func (s *Sync) Run(db kv.RwDB, tx kv.RwTx, firstCycle bool) error {
+// startCycleSpan - root span of sync cycle, stage runs are its children
+func (s *Sync) startCycleSpan(name string, attrs ...otel.Attr) func(err error) {
+	var span *otel.Span
+	s.traceCtx, span = otel.Start(context.Background(), otel.KindInternal, name, attrs...)
+	return func(err error) {
+		span.SetError(err)
+		span.Finish()
+		s.traceCtx = nil
+	}
+}
+
+// startStageSpan - span of stage run inside of cycle span, action is forward, unwind or prune
+func (s *Sync) startStageSpan(id stages.SyncStage, action string) func(err error) {
+	if s.traceCtx == nil {
+		return func(error) {}
+	}
+	_, span := otel.StartChild(s.traceCtx, otel.KindInternal, action+" "+string(id), otel.String("sync.stage", string(id)), otel.String("sync.action", action))
+	return func(err error) {
+		span.SetError(err)
+		span.Finish()
+	}
+}
+
+func (s *Sync) Run(db kv.RwDB, tx kv.RwTx, firstCycle bool) (err error) {
 	s.prevUnwindPoint = nil
 	s.timings = s.timings[:0]
+	endSpan := s.startCycleSpan("sync cycle", otel.Bool("sync.first_cycle", firstCycle))
+	defer func() { endSpan(err) }()
+	deferring := s.deferHeavyWork()
 
 	for !s.IsDone() {
 		var badBlockUnwind bool
 		if s.unwindPoint != nil {
-			for j := 0; j < len(s.unwindOrder); j++ {
-				if s.unwindOrder[j] == nil || s.unwindOrder[j].Disabled || s.unwindOrder[j].Unwind == nil {
-					continue
-				}
-				if err := s.unwindStage(firstCycle, s.unwindOrder[j], db, tx); err != nil {
-					return err
-				}
-			}
-			s.prevUnwindPoint = s.unwindPoint
-			s.unwindPoint = nil
-			if s.badBlock != (common.Hash{}) {
-				badBlockUnwind = true
-			}
-			s.badBlock = common.Hash{}
-			if err := s.SetCurrentStage(s.stages[0].ID); err != nil {
+			badBlockUnwind = s.badBlock != (common.Hash{})
+			if err := s.unwind(firstCycle, db, tx); err != nil {
 				return err
 			}
 			// If there were unwinds at the start, a heavier but invalid chain may be present, so
@@ -220,6 +320,11 @@ func (s *Sync) Run(db kv.RwDB, tx kv.RwTx, firstCycle bool) error {
 
 		stage := s.stages[s.currentStage]
 
+		if tx == nil && libcommon.Stopped(s.stopCh) != nil {
+			log.Info("Staged sync stopped at safe checkpoint", "next stage", stage.ID)
+			return libcommon.ErrStopped
+		}
+
 		if string(stage.ID) == debug.StopBeforeStage() { // stop process for debugging reasons
 			log.Warn("STOP_BEFORE_STAGE env flag forced to stop app")
 			os.Exit(1)
@@ -232,6 +337,15 @@ func (s *Sync) Run(db kv.RwDB, tx kv.RwTx, firstCycle bool) error {
 			continue
 		}
 
+		deferred, err := s.deferStage(stage, deferring, db, tx)
+		if err != nil {
+			return err
+		}
+		if deferred {
+			s.NextStage()
+			continue
+		}
+
 		if err := s.runStage(stage, db, tx, firstCycle, badBlockUnwind); err != nil {
 			return err
 		}
@@ -239,7 +353,7 @@ func (s *Sync) Run(db kv.RwDB, tx kv.RwTx, firstCycle bool) error {
 		s.NextStage()
 	}
 
-	for i := 0; i < len(s.pruningOrder); i++ {
+	for i := 0; i < len(s.pruningOrder) && !deferring; i++ {
 		if s.pruningOrder[i] == nil || s.pruningOrder[i].Disabled || s.pruningOrder[i].Prune == nil {
 			continue
 		}
@@ -308,7 +422,44 @@ func printLogs(tx kv.RwTx, timings []Timing) error {
 	return nil
 }
 
+func (s *Sync) unwind(firstCycle bool, db kv.RwDB, tx kv.RwTx) error {
+	for j := 0; j < len(s.unwindOrder); j++ {
+		if s.unwindOrder[j] == nil || s.unwindOrder[j].Disabled || s.unwindOrder[j].Unwind == nil {
+			continue
+		}
+		if err := s.unwindStage(firstCycle, s.unwindOrder[j], db, tx); err != nil {
+			return err
+		}
+	}
+	s.prevUnwindPoint = s.unwindPoint
+	s.unwindPoint = nil
+	s.badBlock = common.Hash{}
+	return s.SetCurrentStage(s.stages[0].ID)
+}
+
+// RunUnwind - unwinds all stages to the point of UnwindTo without running them forward, next Run continues from
+// there. Unwind point is dropped if unwind fails: it's not retried by next Run.
+func (s *Sync) RunUnwind(db kv.RwDB, tx kv.RwTx) (err error) {
+	if s.unwindPoint == nil {
+		return nil
+	}
+	s.timings = s.timings[:0]
+	endSpan := s.startCycleSpan("sync unwind", otel.Uint("sync.unwind_point", *s.unwindPoint))
+	defer func() { endSpan(err) }()
+	if err := s.unwind(false, db, tx); err != nil {
+		s.unwindPoint = nil
+		s.badBlock = common.Hash{}
+		return err
+	}
+	s.currentStage = 0
+	return printLogs(tx, s.timings)
+}
+
 func (s *Sync) runStage(stage *Stage, db kv.RwDB, tx kv.RwTx, firstCycle bool, badBlockUnwind bool) (err error) {
+	s.running.Store(stage.ID)
+	defer s.running.Store(stages.SyncStage(""))
+	endSpan := s.startStageSpan(stage.ID, "forward")
+	defer func() { endSpan(err) }()
 	start := time.Now()
 	stageState, err := s.StageState(stage.ID, tx, db)
 	if err != nil {
@@ -319,6 +470,7 @@ func (s *Sync) runStage(stage *Stage, db kv.RwDB, tx kv.RwTx, firstCycle bool, b
 		return fmt.Errorf("[%s] %w", s.LogPrefix(), err)
 	}
 
+	updateStageDuration(s.chain, stage.ID, "forward", start)
 	t := time.Since(start)
 	if t > 60*time.Second {
 		logPrefix := s.LogPrefix()
@@ -327,7 +479,11 @@ func (s *Sync) runStage(stage *Stage, db kv.RwDB, tx kv.RwTx, firstCycle bool, b
 	return nil
 }
 
-func (s *Sync) unwindStage(firstCycle bool, stage *Stage, db kv.RwDB, tx kv.RwTx) error {
+func (s *Sync) unwindStage(firstCycle bool, stage *Stage, db kv.RwDB, tx kv.RwTx) (err error) {
+	s.running.Store(stage.ID)
+	defer s.running.Store(stages.SyncStage(""))
+	endSpan := s.startStageSpan(stage.ID, "unwind")
+	defer func() { endSpan(err) }()
 	t := time.Now()
 	log.Trace("Unwind...", "stage", stage.ID)
 	stageState, err := s.StageState(stage.ID, tx, db)
@@ -351,6 +507,7 @@ func (s *Sync) unwindStage(firstCycle bool, stage *Stage, db kv.RwDB, tx kv.RwTx
 		return fmt.Errorf("[%s] %w", s.LogPrefix(), err)
 	}
 
+	updateStageDuration(s.chain, stage.ID, "unwind", t)
 	took := time.Since(t)
 	if took > 60*time.Second {
 		logPrefix := s.LogPrefix()
@@ -360,7 +517,11 @@ func (s *Sync) unwindStage(firstCycle bool, stage *Stage, db kv.RwDB, tx kv.RwTx
 	return nil
 }
 
-func (s *Sync) pruneStage(firstCycle bool, stage *Stage, db kv.RwDB, tx kv.RwTx) error {
+func (s *Sync) pruneStage(firstCycle bool, stage *Stage, db kv.RwDB, tx kv.RwTx) (err error) {
+	s.running.Store(stage.ID)
+	defer s.running.Store(stages.SyncStage(""))
+	endSpan := s.startStageSpan(stage.ID, "prune")
+	defer func() { endSpan(err) }()
 	t := time.Now()
 	log.Trace("Prune...", "stage", stage.ID)
 
@@ -382,6 +543,7 @@ func (s *Sync) pruneStage(firstCycle bool, stage *Stage, db kv.RwDB, tx kv.RwTx)
 		return fmt.Errorf("[%s] %w", s.LogPrefix(), err)
 	}
 
+	updateStageDuration(s.chain, stage.ID, "prune", t)
 	took := time.Since(t)
 	if took > 60*time.Second {
 		logPrefix := s.LogPrefix()
@@ -4,11 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/memdb"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/turbo/maintenance"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -616,3 +619,104 @@ func TestSyncInterruptLongUnwind(t *testing.T) {
 func unwindOf(s stages.SyncStage) stages.SyncStage {
 	return stages.SyncStage(append([]byte(s), 0xF0))
 }
+
+func TestMaintenanceWindows(t *testing.T) {
+	flow := make([]stages.SyncStage, 0)
+	pruned := 0
+	s := []*Stage{
+		{
+			ID:          stages.Execution,
+			Description: "Executing blocks",
+			Forward: func(firstCycle bool, badBlockUnwind bool, s *StageState, u Unwinder, tx kv.RwTx) error {
+				flow = append(flow, stages.Execution)
+				return s.Update(tx, s.BlockNumber+100)
+			},
+			Prune: func(firstCycle bool, p *PruneState, tx kv.RwTx) error {
+				pruned++
+				return nil
+			},
+		},
+		{
+			ID:          stages.LogIndex,
+			Description: "Generate receipt logs index",
+			Deferrable:  true,
+			Forward: func(firstCycle bool, badBlockUnwind bool, s *StageState, u Unwinder, tx kv.RwTx) error {
+				flow = append(flow, stages.LogIndex)
+				executed, err := stages.GetStageProgress(tx, stages.Execution)
+				if err != nil {
+					return err
+				}
+				return s.Update(tx, executed)
+			},
+		},
+	}
+	state := New(s, nil, PruneOrder{stages.Execution})
+	windows, err := maintenance.ParseWindows("01:00-05:00")
+	assert.NoError(t, err)
+	state.SetMaintenance(windows, 150)
+	at := func(hour int) func() time.Time {
+		return func() time.Time { return time.Date(2022, 1, 1, hour, 0, 0, 0, time.Local) }
+	}
+	db, tx := memdb.NewTestTx(t)
+	assert.NoError(t, stages.SaveStageProgress(tx, stages.Execution, 1000))
+
+	// index is too far behind - deferred, as well as pruning
+	state.now = at(12)
+	assert.NoError(t, state.Run(db, tx, true))
+	assert.Equal(t, []stages.SyncStage{stages.Execution}, flow)
+	assert.Equal(t, 0, pruned)
+
+	state.now = at(2)
+	assert.NoError(t, state.Run(db, tx, false))
+	assert.Equal(t, []stages.SyncStage{stages.Execution, stages.Execution, stages.LogIndex}, flow)
+	assert.Equal(t, 1, pruned)
+
+	// small lag is caught up at any time
+	state.now = at(12)
+	assert.NoError(t, state.Run(db, tx, false))
+	assert.Equal(t, []stages.SyncStage{stages.Execution, stages.Execution, stages.LogIndex, stages.Execution, stages.LogIndex}, flow)
+	assert.Equal(t, 1, pruned)
+	progress, err := stages.GetStageProgress(tx, stages.LogIndex)
+	assert.NoError(t, err)
+	assert.Equal(t, 1300, int(progress))
+}
+
+func TestStopAtSafeCheckpoint(t *testing.T) {
+	flow := make([]stages.SyncStage, 0)
+	var state *Sync
+	s := []*Stage{
+		{
+			ID:          stages.Headers,
+			Description: "Downloading headers",
+			Forward: func(firstCycle bool, badBlockUnwind bool, s *StageState, u Unwinder, tx kv.RwTx) error {
+				flow = append(flow, stages.Headers)
+				assert.Equal(t, stages.Headers, state.RunningStage())
+				state.Stop()
+				assert.Error(t, libcommon.Stopped(s.Stopping()))
+				return nil
+			},
+		},
+		{
+			ID:          stages.Bodies,
+			Description: "Downloading block bodiess",
+			Forward: func(firstCycle bool, badBlockUnwind bool, s *StageState, u Unwinder, tx kv.RwTx) error {
+				flow = append(flow, stages.Bodies)
+				return nil
+			},
+		},
+	}
+
+	// cycle in one transaction is finished
+	state = New(s, nil, nil)
+	db, tx := memdb.NewTestTx(t)
+	assert.NoError(t, state.Run(db, tx, true))
+	assert.Equal(t, []stages.SyncStage{stages.Headers, stages.Bodies}, flow)
+
+	// stages which commit own transactions stop before the next stage
+	flow = flow[:0]
+	state = New(s, nil, nil)
+	err := state.Run(memdb.NewTestDB(t), nil, true)
+	assert.ErrorIs(t, err, libcommon.ErrStopped)
+	assert.Equal(t, []stages.SyncStage{stages.Headers}, flow)
+	assert.Equal(t, stages.SyncStage(""), state.RunningStage())
+}
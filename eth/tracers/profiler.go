@@ -0,0 +1,184 @@
+package tracers
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/vm"
+)
+
+// OpcodeProfilerName - name of the built-in tracer which produces a summary of gas, invocation counts and time
+// by opcode and by contract, instead of struct-log
+const OpcodeProfilerName = "opcodeProfiler"
+
+// ProfileEntry - aggregated executions of instructions
+type ProfileEntry struct {
+	Count  uint64 `json:"count"`
+	Gas    uint64 `json:"gas"`
+	TimeNs int64  `json:"timeNs"`
+}
+
+// ContractProfile - aggregated executions of instructions of contract code
+type ContractProfile struct {
+	Address common.Address `json:"address"`
+	Calls   uint64         `json:"calls"` // number of frames which executed the code
+	ProfileEntry
+}
+
+// ProfileResult - output of OpcodeProfiler
+type ProfileResult struct {
+	Txs       uint64                   `json:"txs"`
+	Gas       uint64                   `json:"gas"` // gas used by execution, without intrinsic gas and refunds
+	Opcodes   map[string]*ProfileEntry `json:"opcodes"`
+	Contracts []*ContractProfile       `json:"contracts"` // by gas, descending
+}
+
+// profiledCall - call or create instruction, its own gas is known when the next instruction of the frame starts
+type profiledCall struct {
+	op, contract *ProfileEntry
+	gas          uint64 // gas before the instruction
+	children     uint64 // gas used by frames started by the instruction
+}
+
+// OpcodeProfiler - tracer which aggregates gas, counts and time of instructions by opcode and by contract code
+// address. Gas of calls and creates doesn't include gas used by the frames they start. Time of an instruction is
+// measured until the next tracer event, so it includes tracing overhead and is only good for comparison.
+// Results accumulate over all transactions executed with the profiler.
+type OpcodeProfiler struct {
+	txs, gas  uint64
+	opcodes   map[vm.OpCode]*ProfileEntry
+	contracts map[common.Address]*ContractProfile
+	pending   map[int]*profiledCall // by depth of frame
+
+	timedOp, timedContract *ProfileEntry // instruction which is being executed
+	timedFrom              time.Time
+}
+
+func NewOpcodeProfiler() *OpcodeProfiler {
+	return &OpcodeProfiler{
+		opcodes:   map[vm.OpCode]*ProfileEntry{},
+		contracts: map[common.Address]*ContractProfile{},
+		pending:   map[int]*profiledCall{},
+	}
+}
+
+func (p *OpcodeProfiler) contract(addr common.Address) *ContractProfile {
+	c, ok := p.contracts[addr]
+	if !ok {
+		c = &ContractProfile{Address: addr}
+		p.contracts[addr] = c
+	}
+	return c
+}
+
+func (p *OpcodeProfiler) stopTimer() {
+	if p.timedOp == nil {
+		return
+	}
+	d := time.Since(p.timedFrom).Nanoseconds()
+	p.timedOp.TimeNs += d
+	p.timedContract.TimeNs += d
+	p.timedOp, p.timedContract = nil, nil
+}
+
+func (p *OpcodeProfiler) CaptureStart(env *vm.EVM, depth int, from common.Address, to common.Address, precompile bool, create bool, calltype vm.CallType, input []byte, gas uint64, value *big.Int, code []byte) {
+	p.stopTimer()
+	if depth == 0 {
+		p.txs++
+	}
+	if create || precompile || len(code) > 0 { // plain transfers are not interesting
+		p.contract(to).Calls++
+	}
+}
+
+func (p *OpcodeProfiler) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	p.stopTimer()
+	if call, ok := p.pending[depth]; ok {
+		delete(p.pending, depth)
+		// the callee can use more than the caller paid because of the call stipend
+		if call.gas > gas && call.gas-gas > call.children {
+			used := call.gas - gas
+			call.op.Gas += used - call.children
+			call.contract.Gas += used - call.children
+		}
+	}
+	if err != nil {
+		return // instruction is not executed
+	}
+	addr := scope.Contract.Address()
+	if scope.Contract.CodeAddr != nil {
+		addr = *scope.Contract.CodeAddr
+	}
+	opEntry, ok := p.opcodes[op]
+	if !ok {
+		opEntry = &ProfileEntry{}
+		p.opcodes[op] = opEntry
+	}
+	contractEntry := &p.contract(addr).ProfileEntry
+	opEntry.Count++
+	contractEntry.Count++
+	switch op {
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL, vm.CREATE, vm.CREATE2:
+		p.pending[depth] = &profiledCall{op: opEntry, contract: contractEntry, gas: gas}
+	default:
+		opEntry.Gas += cost
+		contractEntry.Gas += cost
+	}
+	p.timedOp, p.timedContract, p.timedFrom = opEntry, contractEntry, time.Now()
+}
+
+func (p *OpcodeProfiler) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (p *OpcodeProfiler) CaptureEnd(depth int, output []byte, startGas, endGas uint64, t time.Duration, err error) {
+	p.stopTimer()
+	delete(p.pending, depth+1) // frame ended abnormally right after call instruction
+	used := startGas - endGas
+	if call, ok := p.pending[depth]; ok {
+		call.children += used
+	}
+	if depth == 0 {
+		p.gas += used
+	}
+}
+
+func (p *OpcodeProfiler) CaptureSelfDestruct(from common.Address, to common.Address, value *big.Int) {
+}
+
+func (p *OpcodeProfiler) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+
+func (p *OpcodeProfiler) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
+
+// Result - summary of all transactions executed with the profiler so far
+func (p *OpcodeProfiler) Result() *ProfileResult {
+	res := &ProfileResult{Txs: p.txs, Gas: p.gas, Opcodes: make(map[string]*ProfileEntry, len(p.opcodes))}
+	for op, e := range p.opcodes {
+		entry := *e
+		res.Opcodes[op.String()] = &entry
+	}
+	res.Contracts = make([]*ContractProfile, 0, len(p.contracts))
+	for _, c := range p.contracts {
+		contract := *c
+		res.Contracts = append(res.Contracts, &contract)
+	}
+	sort.Slice(res.Contracts, func(i, j int) bool {
+		if res.Contracts[i].Gas != res.Contracts[j].Gas {
+			return res.Contracts[i].Gas > res.Contracts[j].Gas
+		}
+		return bytes.Compare(res.Contracts[i].Address[:], res.Contracts[j].Address[:]) < 0
+	})
+	return res
+}
+
+// GetResult - JSON encoded Result
+func (p *OpcodeProfiler) GetResult() (json.RawMessage, error) {
+	return json.Marshal(p.Result())
+}
@@ -0,0 +1,68 @@
+package tracers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpcodeProfiler(t *testing.T) {
+	callee := common.HexToAddress("0xca11ee")
+	// callee: SSTORE(0, 1)
+	calleeCode := []byte{byte(vm.PUSH1), 1, byte(vm.PUSH1), 0, byte(vm.SSTORE), byte(vm.STOP)}
+	// caller: CALL(gas, callee, 0, 0, 0, 0, 0) twice
+	call := []byte{
+		byte(vm.PUSH1), 0, byte(vm.DUP1), byte(vm.DUP1), byte(vm.DUP1), byte(vm.DUP1),
+		byte(vm.PUSH3), 0xca, 0x11, 0xee, byte(vm.GAS), byte(vm.CALL), byte(vm.POP),
+	}
+	code := append(append(append([]byte{}, call...), call...), byte(vm.STOP))
+
+	_, tx := memdb.NewTestTx(t)
+	ibs := state.New(state.NewPlainState(tx, 0, nil))
+	caller := common.HexToAddress("0xca11e7")
+	ibs.SetCode(caller, code)
+	ibs.SetCode(callee, calleeCode)
+	blockCtx := vm.BlockContext{
+		CanTransfer:     core.CanTransfer,
+		Transfer:        core.Transfer,
+		ContractHasTEVM: func(common.Hash) (bool, error) { return false, nil },
+		BlockNumber:     1,
+	}
+	profiler := NewOpcodeProfiler()
+	evm := vm.NewEVM(blockCtx, vm.TxContext{}, ibs, params.TestChainConfig, vm.Config{Debug: true, Tracer: profiler})
+	_, _, err := evm.Call(vm.AccountRef(common.Address{}), caller, nil, 1_000_000, uint256.NewInt(0), false)
+	require.NoError(t, err)
+
+	res := profiler.Result()
+	require.Equal(t, uint64(1), res.Txs)
+	require.Equal(t, uint64(2), res.Opcodes["CALL"].Count)
+	require.Equal(t, uint64(2), res.Opcodes["SSTORE"].Count)
+	require.Equal(t, uint64(6), res.Opcodes["PUSH1"].Count)
+
+	// gas of instructions adds up to gas used by execution
+	var total uint64
+	for _, e := range res.Opcodes {
+		total += e.Gas
+	}
+	require.Equal(t, res.Gas, total)
+
+	// callee is the most expensive contract: first SSTORE is the most expensive instruction
+	require.Equal(t, callee, res.Contracts[0].Address)
+	require.Equal(t, uint64(2), res.Contracts[0].Calls)
+	require.Equal(t, uint64(8), res.Contracts[0].Count)
+	require.Equal(t, res.Opcodes["SSTORE"].Gas+res.Opcodes["PUSH1"].Gas-2*3, res.Contracts[0].Gas) // caller has one PUSH1 per call
+
+	data, err := profiler.GetResult()
+	require.NoError(t, err)
+	var decoded ProfileResult
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, res, &decoded)
+}
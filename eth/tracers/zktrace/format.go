@@ -0,0 +1,389 @@
+// Package zktrace - execution traces in stable binary format for zkEVM provers: every executed instruction with state
+// it accessed. Messages are protobuf (see zktrace.proto), encoded and decoded by hand with protowire.
+package zktrace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Version of the format, written to Header of every stream. Fields are only added, so readers skip unknown ones.
+const Version = 1
+
+// maxMessageSize - limit of one message of the stream, one block with all its steps
+const maxMessageSize = 1 << 30
+
+// Header - first message of the stream
+type Header struct {
+	Version uint32
+	ChainID uint64
+}
+
+// Block - traced transactions of the block
+type Block struct {
+	Number       uint64
+	Hash         common.Hash
+	ParentHash   common.Hash
+	Transactions []*Transaction
+}
+
+// Transaction - executed instructions of the transaction, To is nil for contract creation
+type Transaction struct {
+	Hash    common.Hash
+	Index   uint32
+	From    common.Address
+	To      *common.Address
+	GasUsed uint64
+	Failed  bool
+	Steps   []*Step
+}
+
+// Step - one executed instruction, Depth is 1 for the top-level frame
+type Step struct {
+	PC       uint64
+	Op       vm.OpCode
+	Gas      uint64
+	GasCost  uint64
+	Depth    uint32
+	Contract common.Address
+	Accesses []*Access
+}
+
+// AccessKind - what was accessed, defines meaning of Access fields
+type AccessKind uint32
+
+const (
+	StorageRead    AccessKind = iota // SLOAD: Key, Value
+	StorageWrite                     // SSTORE: Key, Value - new value, Previous - value before
+	BalanceRead                      // BALANCE, SELFBALANCE, beneficiary of SELFDESTRUCT: Value - balance
+	CodeRead                         // EXTCODE*, target of calls: Value - code hash
+	ContractCreate                   // CREATE, CREATE2: Address of the new contract
+	SelfDestruct                     // SELFDESTRUCT: Value - balance sent to the beneficiary
+)
+
+// Access - state accessed by the instruction, as of the moment before the instruction
+type Access struct {
+	Kind     AccessKind
+	Address  common.Address
+	Key      common.Hash
+	Value    common.Hash
+	Previous common.Hash
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendHash(b []byte, num protowire.Number, h common.Hash) []byte {
+	if h == (common.Hash{}) {
+		return b
+	}
+	return appendBytes(b, num, h[:])
+}
+
+// appendMessage - embedded message, its length is not known in advance
+func appendMessage(b []byte, num protowire.Number, marshal func([]byte) []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	pos := len(b)
+	b = marshal(b)
+	msg := append([]byte(nil), b[pos:]...)
+	return protowire.AppendBytes(b[:pos], msg)
+}
+
+// walkFields - calls walker for every field of the message, v is value of varint fields, bs - of bytes fields.
+// Fields of other types are skipped.
+func walkFields(b []byte, walker func(num protowire.Number, v uint64, bs []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch typ {
+		case protowire.VarintType:
+			var v uint64
+			if v, n = protowire.ConsumeVarint(b); n >= 0 {
+				if err := walker(num, v, nil); err != nil {
+					return err
+				}
+			}
+		case protowire.BytesType:
+			var bs []byte
+			if bs, n = protowire.ConsumeBytes(b); n >= 0 {
+				if err := walker(num, 0, bs); err != nil {
+					return err
+				}
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func (h *Header) marshal(b []byte) []byte {
+	b = appendVarint(b, 1, uint64(h.Version))
+	return appendVarint(b, 2, h.ChainID)
+}
+
+func (h *Header) unmarshal(b []byte) error {
+	return walkFields(b, func(num protowire.Number, v uint64, bs []byte) error {
+		switch num {
+		case 1:
+			h.Version = uint32(v)
+		case 2:
+			h.ChainID = v
+		}
+		return nil
+	})
+}
+
+// Marshal - protobuf encoding of the block
+func (blk *Block) Marshal() []byte {
+	return blk.marshal(nil)
+}
+
+func (blk *Block) marshal(b []byte) []byte {
+	b = appendVarint(b, 1, blk.Number)
+	b = appendHash(b, 2, blk.Hash)
+	b = appendHash(b, 3, blk.ParentHash)
+	for _, txn := range blk.Transactions {
+		b = appendMessage(b, 4, txn.marshal)
+	}
+	return b
+}
+
+// Unmarshal - decodes protobuf encoding of the block
+func (blk *Block) Unmarshal(b []byte) error {
+	*blk = Block{}
+	return walkFields(b, func(num protowire.Number, v uint64, bs []byte) error {
+		switch num {
+		case 1:
+			blk.Number = v
+		case 2:
+			blk.Hash = common.BytesToHash(bs)
+		case 3:
+			blk.ParentHash = common.BytesToHash(bs)
+		case 4:
+			txn := new(Transaction)
+			if err := txn.unmarshal(bs); err != nil {
+				return err
+			}
+			blk.Transactions = append(blk.Transactions, txn)
+		}
+		return nil
+	})
+}
+
+func (txn *Transaction) marshal(b []byte) []byte {
+	b = appendHash(b, 1, txn.Hash)
+	b = appendVarint(b, 2, uint64(txn.Index))
+	b = appendBytes(b, 3, txn.From[:])
+	if txn.To != nil {
+		b = appendBytes(b, 4, txn.To[:])
+	}
+	b = appendVarint(b, 5, txn.GasUsed)
+	if txn.Failed {
+		b = appendVarint(b, 6, 1)
+	}
+	for _, step := range txn.Steps {
+		b = appendMessage(b, 7, step.marshal)
+	}
+	return b
+}
+
+func (txn *Transaction) unmarshal(b []byte) error {
+	return walkFields(b, func(num protowire.Number, v uint64, bs []byte) error {
+		switch num {
+		case 1:
+			txn.Hash = common.BytesToHash(bs)
+		case 2:
+			txn.Index = uint32(v)
+		case 3:
+			txn.From = common.BytesToAddress(bs)
+		case 4:
+			to := common.BytesToAddress(bs)
+			txn.To = &to
+		case 5:
+			txn.GasUsed = v
+		case 6:
+			txn.Failed = v != 0
+		case 7:
+			step := new(Step)
+			if err := step.unmarshal(bs); err != nil {
+				return err
+			}
+			txn.Steps = append(txn.Steps, step)
+		}
+		return nil
+	})
+}
+
+func (s *Step) marshal(b []byte) []byte {
+	b = appendVarint(b, 1, s.PC)
+	b = appendVarint(b, 2, uint64(s.Op))
+	b = appendVarint(b, 3, s.Gas)
+	b = appendVarint(b, 4, s.GasCost)
+	b = appendVarint(b, 5, uint64(s.Depth))
+	b = appendBytes(b, 6, s.Contract[:])
+	for _, a := range s.Accesses {
+		b = appendMessage(b, 7, a.marshal)
+	}
+	return b
+}
+
+func (s *Step) unmarshal(b []byte) error {
+	return walkFields(b, func(num protowire.Number, v uint64, bs []byte) error {
+		switch num {
+		case 1:
+			s.PC = v
+		case 2:
+			s.Op = vm.OpCode(v)
+		case 3:
+			s.Gas = v
+		case 4:
+			s.GasCost = v
+		case 5:
+			s.Depth = uint32(v)
+		case 6:
+			s.Contract = common.BytesToAddress(bs)
+		case 7:
+			a := new(Access)
+			if err := a.unmarshal(bs); err != nil {
+				return err
+			}
+			s.Accesses = append(s.Accesses, a)
+		}
+		return nil
+	})
+}
+
+func (a *Access) marshal(b []byte) []byte {
+	b = appendVarint(b, 1, uint64(a.Kind))
+	b = appendBytes(b, 2, a.Address[:])
+	b = appendHash(b, 3, a.Key)
+	b = appendHash(b, 4, a.Value)
+	return appendHash(b, 5, a.Previous)
+}
+
+func (a *Access) unmarshal(b []byte) error {
+	return walkFields(b, func(num protowire.Number, v uint64, bs []byte) error {
+		switch num {
+		case 1:
+			a.Kind = AccessKind(v)
+		case 2:
+			a.Address = common.BytesToAddress(bs)
+		case 3:
+			a.Key = common.BytesToHash(bs)
+		case 4:
+			a.Value = common.BytesToHash(bs)
+		case 5:
+			a.Previous = common.BytesToHash(bs)
+		}
+		return nil
+	})
+}
+
+// Writer - writes stream of length-delimited messages: Header, then blocks
+type Writer struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewWriter writes Header of the stream to w
+func NewWriter(w io.Writer, chainID uint64) (*Writer, error) {
+	wr := &Writer{w: w}
+	h := Header{Version: Version, ChainID: chainID}
+	if err := wr.write(h.marshal(nil)); err != nil {
+		return nil, err
+	}
+	return wr, nil
+}
+
+func (w *Writer) write(msg []byte) error {
+	w.buf = protowire.AppendVarint(w.buf[:0], uint64(len(msg)))
+	w.buf = append(w.buf, msg...)
+	_, err := w.w.Write(w.buf)
+	return err
+}
+
+func (w *Writer) WriteBlock(blk *Block) error {
+	return w.write(blk.Marshal())
+}
+
+// Reader - reads stream written by Writer
+type Reader struct {
+	r      *bufio.Reader
+	header Header
+}
+
+// NewReader reads Header of the stream, streams of newer versions are rejected
+func NewReader(r io.Reader) (*Reader, error) {
+	rd := &Reader{r: bufio.NewReader(r)}
+	msg, err := rd.read()
+	if err != nil {
+		return nil, err
+	}
+	if err = rd.header.unmarshal(msg); err != nil {
+		return nil, err
+	}
+	if rd.header.Version == 0 || rd.header.Version > Version {
+		return nil, fmt.Errorf("unsupported version of zk trace: %d", rd.header.Version)
+	}
+	return rd, nil
+}
+
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+func (r *Reader) read() ([]byte, error) {
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("message of zk trace is too big: %d", size)
+	}
+	msg := make([]byte, size)
+	if _, err = io.ReadFull(r.r, msg); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// ReadBlock - next block of the stream, io.EOF at the end
+func (r *Reader) ReadBlock() (*Block, error) {
+	msg, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+	blk := new(Block)
+	if err = blk.Unmarshal(msg); err != nil {
+		return nil, err
+	}
+	return blk, nil
+}
@@ -0,0 +1,172 @@
+package zktrace
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// grpcScheme - prefix of sink target which is served by TraceSink service
+const grpcScheme = "grpc://"
+
+// Sink - destination of traced blocks
+type Sink interface {
+	WriteBlock(blk *Block) error
+	// Close flushes written blocks, error means they may be not delivered
+	Close() error
+}
+
+// OpenSink - "grpc://host:port" is TraceSink service, anything else is path of the file to create
+func OpenSink(target string, chainID uint64) (Sink, error) {
+	if strings.HasPrefix(target, grpcScheme) {
+		return DialSink(strings.TrimPrefix(target, grpcScheme), chainID)
+	}
+	f, err := os.Create(target)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriterSize(f, 1<<20)
+	w, err := NewWriter(buf, chainID)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileSink{f: f, buf: buf, w: w}, nil
+}
+
+type fileSink struct {
+	f   *os.File
+	buf *bufio.Writer
+	w   *Writer
+}
+
+func (s *fileSink) WriteBlock(blk *Block) error {
+	return s.w.WriteBlock(blk)
+}
+
+func (s *fileSink) Close() error {
+	if err := s.buf.Flush(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+// SinkServer - receiver of streams pushed to TraceSink service. Push is called once per stream, returns after the
+// stream is read; error is returned to the client.
+type SinkServer interface {
+	Push(header Header, blocks func() (*Block, error)) error
+}
+
+// pushStreamName - client stream of BytesValue, every one is a message of the stream: Header, then blocks
+const pushStreamName = "Push"
+
+// TraceSink_ServiceDesc - hand-written descriptor of "zktrace.v1.TraceSink" service, see zktrace.proto
+var TraceSink_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "zktrace.v1.TraceSink",
+	HandlerType: (*SinkServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    pushStreamName,
+		ClientStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			recv := func() ([]byte, error) {
+				in := new(wrapperspb.BytesValue)
+				if err := stream.RecvMsg(in); err != nil {
+					return nil, err
+				}
+				return in.GetValue(), nil
+			}
+			msg, err := recv()
+			if err != nil {
+				return err
+			}
+			var header Header
+			if err = header.unmarshal(msg); err != nil {
+				return err
+			}
+			blocks := func() (*Block, error) {
+				msg, err := recv()
+				if err != nil {
+					return nil, err // io.EOF at the end of the stream
+				}
+				blk := new(Block)
+				if err = blk.Unmarshal(msg); err != nil {
+					return nil, err
+				}
+				return blk, nil
+			}
+			if err = srv.(SinkServer).Push(header, blocks); err != nil {
+				return err
+			}
+			return stream.SendMsg(&emptypb.Empty{})
+		},
+	}},
+}
+
+// RegisterSinkServer serves TraceSink service by srv
+func RegisterSinkServer(s *grpc.Server, srv SinkServer) {
+	s.RegisterService(&TraceSink_ServiceDesc, srv)
+}
+
+type grpcSink struct {
+	conn   *grpc.ClientConn
+	stream grpc.ClientStream
+	cancel context.CancelFunc
+}
+
+// DialSink - sink which pushes blocks to TraceSink service listening on addr, without TLS
+func DialSink(addr string, chainID uint64) (Sink, error) {
+	conn, err := grpcutil.Connect(nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := conn.NewStream(ctx, &TraceSink_ServiceDesc.Streams[0], "/"+TraceSink_ServiceDesc.ServiceName+"/"+pushStreamName)
+	if err != nil {
+		cancel()
+		conn.Close()
+		return nil, err
+	}
+	s := &grpcSink{conn: conn, stream: stream, cancel: cancel}
+	h := Header{Version: Version, ChainID: chainID}
+	if err = s.send(h.marshal(nil)); err != nil {
+		s.cancel()
+		s.conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *grpcSink) send(msg []byte) error {
+	err := s.stream.SendMsg(wrapperspb.Bytes(msg))
+	if errors.Is(err, io.EOF) {
+		// server closed the stream, the reason is returned by RecvMsg
+		if err = s.stream.RecvMsg(new(emptypb.Empty)); err == nil {
+			err = errors.New("zk trace stream is closed by the server")
+		}
+	}
+	return err
+}
+
+func (s *grpcSink) WriteBlock(blk *Block) error {
+	return s.send(blk.Marshal())
+}
+
+// Close waits until server reads the whole stream
+func (s *grpcSink) Close() error {
+	defer s.conn.Close()
+	defer s.cancel()
+	if err := s.stream.CloseSend(); err != nil {
+		return err
+	}
+	return s.stream.RecvMsg(new(emptypb.Empty))
+}
@@ -0,0 +1,112 @@
+package zktrace
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/vm"
+)
+
+// Tracer - vm.Tracer which records executed instructions of one transaction with state they access.
+// State is read from IntraBlockState of the EVM before the instruction is executed.
+type Tracer struct {
+	steps []*Step
+}
+
+func NewTracer() *Tracer {
+	return &Tracer{}
+}
+
+// Steps - recorded instructions, Reset starts the next transaction
+func (t *Tracer) Steps() []*Step {
+	return t.steps
+}
+
+func (t *Tracer) Reset() {
+	t.steps = nil
+}
+
+func (t *Tracer) CaptureStart(env *vm.EVM, depth int, from common.Address, to common.Address, precompile bool, create bool, callType vm.CallType, input []byte, gas uint64, value *big.Int, code []byte) {
+	// new contract is known only when the frame of CREATE or CREATE2 starts
+	if create && depth > 0 && len(t.steps) > 0 {
+		last := t.steps[len(t.steps)-1]
+		last.Accesses = append(last.Accesses, &Access{Kind: ContractCreate, Address: to})
+	}
+}
+
+func (t *Tracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	contract := scope.Contract.Address()
+	step := &Step{PC: pc, Op: op, Gas: gas, GasCost: cost, Depth: uint32(depth), Contract: contract}
+	t.steps = append(t.steps, step)
+
+	stack, ibs := scope.Stack, env.IntraBlockState()
+	// arg - stack item n from the top, nil if stack is too short (instruction will fail)
+	arg := func(n int) *uint256.Int {
+		if stack.Len() <= n {
+			return nil
+		}
+		return stack.Back(n)
+	}
+	access := func(a *Access) {
+		step.Accesses = append(step.Accesses, a)
+	}
+	balance := func(address common.Address) common.Hash {
+		return ibs.GetBalance(address).Bytes32()
+	}
+	switch op {
+	case vm.SLOAD:
+		if key := arg(0); key != nil {
+			a := &Access{Kind: StorageRead, Address: contract, Key: key.Bytes32()}
+			var value uint256.Int
+			ibs.GetState(contract, &a.Key, &value)
+			a.Value = value.Bytes32()
+			access(a)
+		}
+	case vm.SSTORE:
+		if key, value := arg(0), arg(1); key != nil && value != nil {
+			a := &Access{Kind: StorageWrite, Address: contract, Key: key.Bytes32(), Value: value.Bytes32()}
+			var previous uint256.Int
+			ibs.GetState(contract, &a.Key, &previous)
+			a.Previous = previous.Bytes32()
+			access(a)
+		}
+	case vm.BALANCE:
+		if address := arg(0); address != nil {
+			addr := common.Address(address.Bytes20())
+			access(&Access{Kind: BalanceRead, Address: addr, Value: balance(addr)})
+		}
+	case vm.SELFBALANCE:
+		access(&Access{Kind: BalanceRead, Address: contract, Value: balance(contract)})
+	case vm.EXTCODESIZE, vm.EXTCODECOPY, vm.EXTCODEHASH:
+		if address := arg(0); address != nil {
+			addr := common.Address(address.Bytes20())
+			access(&Access{Kind: CodeRead, Address: addr, Value: ibs.GetCodeHash(addr)})
+		}
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		if address := arg(1); address != nil {
+			addr := common.Address(address.Bytes20())
+			access(&Access{Kind: CodeRead, Address: addr, Value: ibs.GetCodeHash(addr)})
+		}
+	case vm.SELFDESTRUCT:
+		if beneficiary := arg(0); beneficiary != nil {
+			addr := common.Address(beneficiary.Bytes20())
+			access(&Access{Kind: SelfDestruct, Address: contract, Value: balance(contract)})
+			access(&Access{Kind: BalanceRead, Address: addr, Value: balance(addr)})
+		}
+	}
+}
+
+func (t *Tracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+func (t *Tracer) CaptureEnd(depth int, output []byte, startGas, endGas uint64, d time.Duration, err error) {
+}
+func (t *Tracer) CaptureSelfDestruct(from common.Address, to common.Address, value *big.Int) {
+}
+func (t *Tracer) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+func (t *Tracer) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
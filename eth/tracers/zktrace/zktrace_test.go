@@ -0,0 +1,109 @@
+package zktrace
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func testBlock(number uint64) *Block {
+	to := common.Address{2}
+	return &Block{
+		Number:     number,
+		Hash:       common.Hash{byte(number)},
+		ParentHash: common.Hash{byte(number - 1)},
+		Transactions: []*Transaction{{
+			Hash:    common.Hash{0xaa},
+			From:    common.Address{1},
+			To:      &to,
+			GasUsed: 43_000,
+			Steps: []*Step{
+				{PC: 0, Op: vm.PUSH1, Gas: 79_000, GasCost: 3, Depth: 1, Contract: to},
+				{PC: 5, Op: vm.SSTORE, Gas: 78_000, GasCost: 20_000, Depth: 1, Contract: to, Accesses: []*Access{
+					{Kind: StorageWrite, Address: to, Key: common.Hash{31: 1}, Value: common.Hash{31: 9}, Previous: common.Hash{31: 3}},
+				}},
+			},
+		}, {
+			Index:  1,
+			From:   common.Address{1},
+			Failed: true,
+			Steps: []*Step{
+				{PC: 0, Op: vm.CREATE, Depth: 1, Accesses: []*Access{{Kind: ContractCreate, Address: common.Address{3}}}},
+			},
+		}},
+	}
+}
+
+func TestStream(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, 5)
+	require.NoError(t, err)
+	blocks := []*Block{testBlock(1), {Number: 2, Hash: common.Hash{2}, ParentHash: common.Hash{1}}}
+	for _, blk := range blocks {
+		require.NoError(t, w.WriteBlock(blk))
+	}
+
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	require.Equal(t, Header{Version: Version, ChainID: 5}, r.Header())
+	for _, want := range blocks {
+		got, err := r.ReadBlock()
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+	_, err = r.ReadBlock()
+	require.ErrorIs(t, err, io.EOF)
+
+	// streams of unknown versions are rejected
+	buf.Reset()
+	h := Header{Version: Version + 1}
+	w = &Writer{w: &buf}
+	require.NoError(t, w.write(h.marshal(nil)))
+	_, err = NewReader(&buf)
+	require.Error(t, err)
+}
+
+type testSinkServer struct {
+	header Header
+	blocks []*Block
+}
+
+func (s *testSinkServer) Push(header Header, blocks func() (*Block, error)) error {
+	s.header = header
+	for {
+		blk, err := blocks()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.blocks = append(s.blocks, blk)
+	}
+}
+
+func TestGrpcSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	srv := &testSinkServer{}
+	RegisterSinkServer(server, srv)
+	go server.Serve(listener) //nolint:errcheck
+	defer server.Stop()
+
+	sink, err := OpenSink(grpcScheme+listener.Addr().String(), 5)
+	require.NoError(t, err)
+	require.NoError(t, sink.WriteBlock(testBlock(1)))
+	require.NoError(t, sink.WriteBlock(testBlock(2)))
+	require.NoError(t, sink.Close())
+
+	require.Equal(t, Header{Version: Version, ChainID: 5}, srv.header)
+	require.Equal(t, []*Block{testBlock(1), testBlock(2)}, srv.blocks)
+}
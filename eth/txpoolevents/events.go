@@ -0,0 +1,89 @@
+// Package txpoolevents - structured events of the transaction pool (added, promoted, demoted, replaced, dropped,
+// included in block) for embedders and external consumers (gRPC stream). Pool doesn't report its decisions, so they
+// are derived from changes of pool content between polls and from canonical blocks.
+package txpoolevents
+
+import (
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon/common"
+)
+
+type Kind string
+
+const (
+	Added    Kind = "added"    // transaction entered the pool
+	Promoted Kind = "promoted" // moved to better sub-pool: Queued -> BaseFee -> Pending
+	Demoted  Kind = "demoted"  // moved to worse sub-pool
+	Replaced Kind = "replaced" // removed in favor of transaction with same sender and nonce, see ReplacedBy
+	Dropped  Kind = "dropped"  // removed without inclusion, see Reason
+	Included Kind = "included" // removed because it's included in canonical block
+)
+
+// Discarded - reason of drop when pool's reason is unknown: pool overflow, fee below base fee or insufficient balance
+const Discarded = "discarded"
+
+var lostCounter = metrics.GetOrCreateCounter(`txpool_events_lost`)
+
+// Event - change of one transaction in the pool
+type Event struct {
+	Kind        Kind           `json:"kind"`
+	Time        time.Time      `json:"time"`
+	Hash        common.Hash    `json:"hash"`
+	Sender      common.Address `json:"sender"`
+	Nonce       uint64         `json:"nonce"`
+	SubPool     string         `json:"subPool,omitempty"`     // Added, Promoted, Demoted: Pending, BaseFee or Queued
+	PrevSubPool string         `json:"prevSubPool,omitempty"` // Promoted, Demoted
+	Reason      string         `json:"reason,omitempty"`      // Dropped
+	ReplacedBy  *common.Hash   `json:"replacedBy,omitempty"`  // Replaced
+	BlockNumber *uint64        `json:"blockNumber,omitempty"` // Included
+	BlockHash   *common.Hash   `json:"blockHash,omitempty"`   // Included
+}
+
+// Bus - delivers events to subscribers
+type Bus struct {
+	lock        sync.RWMutex
+	subscribers map[int]chan Event
+	nextID      int
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: map[int]chan Event{}}
+}
+
+// Subscribe - events are sent to the channel without blocking the pool: if subscriber doesn't keep up and buffer is
+// full, events are lost (metric txpool_events_lost). Unsubscribe closes the channel.
+func (b *Bus) Subscribe(buffer int) (events <-chan Event, unsubscribe func()) {
+	ch := make(chan Event, buffer)
+	b.lock.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = ch
+	b.lock.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.lock.Lock()
+			delete(b.subscribers, id)
+			b.lock.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (b *Bus) publish(events []Event) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for _, ch := range b.subscribers {
+		for _, ev := range events {
+			select {
+			case ch <- ev:
+			default:
+				lostCounter.Inc()
+			}
+		}
+	}
+}
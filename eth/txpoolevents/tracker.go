@@ -0,0 +1,221 @@
+package txpoolevents
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	txpool_proto "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/txpool"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// PollInterval - how often pool content is compared with the previous one
+const PollInterval = time.Second
+
+// includedDepth - transactions of this many recent blocks are remembered: pool may remove mined transaction some time
+// after the block becomes canonical
+const includedDepth = 128
+
+// PoolContent - part of txpool_proto.TxpoolServer used by Loop
+type PoolContent interface {
+	All(ctx context.Context, in *txpool_proto.AllRequest) (*txpool_proto.AllReply, error)
+}
+
+type senderNonce struct {
+	sender common.Address
+	nonce  uint64
+}
+
+type poolTx struct {
+	senderNonce
+	subPool txpool.SubPoolType
+}
+
+type blockRef struct {
+	number uint64
+	hash   common.Hash
+}
+
+// tracker - previous content of the pool and recently included transactions
+type tracker struct {
+	txs           map[common.Hash]*poolTx
+	included      map[common.Hash]blockRef
+	includedNonce map[senderNonce]blockRef
+	lastBlock     uint64
+}
+
+func newTracker() *tracker {
+	return &tracker{included: map[common.Hash]blockRef{}, includedNonce: map[senderNonce]blockRef{}}
+}
+
+func subPoolOf(t txpool_proto.AllReply_Type) txpool.SubPoolType {
+	switch t {
+	case txpool_proto.AllReply_PENDING:
+		return txpool.PendingSubPool
+	case txpool_proto.AllReply_BASE_FEE:
+		return txpool.BaseFeeSubPool
+	default:
+		return txpool.QueuedSubPool
+	}
+}
+
+// rank - Pending is better than BaseFee, BaseFee is better than Queued
+func rank(subPool txpool.SubPoolType) int {
+	return -int(subPool)
+}
+
+// snapshot - content of the pool by hash, only new transactions are decoded
+func (t *tracker) snapshot(reply *txpool_proto.AllReply) map[common.Hash]*poolTx {
+	txs := make(map[common.Hash]*poolTx, len(reply.Txs))
+	for _, tx := range reply.Txs {
+		hash := crypto.Keccak256Hash(tx.RlpTx)
+		subPool := subPoolOf(tx.Type)
+		if prev, ok := t.txs[hash]; ok {
+			txs[hash] = &poolTx{senderNonce: prev.senderNonce, subPool: subPool}
+			continue
+		}
+		txn, err := types.UnmarshalTransactionFromBinary(tx.RlpTx)
+		if err != nil {
+			continue
+		}
+		txs[hash] = &poolTx{senderNonce: senderNonce{common.BytesToAddress(tx.Sender), txn.GetNonce()}, subPool: subPool}
+	}
+	return txs
+}
+
+// readBlocks - remembers transactions of canonical blocks since the previous call
+func (t *tracker) readBlocks(tx kv.Tx) error {
+	head := rawdb.ReadHeaderNumber(tx, rawdb.ReadHeadBlockHash(tx))
+	if head == nil || *head == t.lastBlock {
+		return nil
+	}
+	from := t.lastBlock + 1
+	if t.lastBlock == 0 || *head > includedDepth && from < *head-includedDepth {
+		from = *head + 1 // first call or too far behind - only new blocks are interesting
+	}
+	for number := from; number <= *head; number++ {
+		hash, err := rawdb.ReadCanonicalHash(tx, number)
+		if err != nil {
+			return err
+		}
+		body := rawdb.ReadBodyWithTransactions(tx, hash, number)
+		if body == nil {
+			continue
+		}
+		senders, err := rawdb.ReadSenders(tx, hash, number)
+		if err != nil {
+			return err
+		}
+		ref := blockRef{number: number, hash: hash}
+		for i, txn := range body.Transactions {
+			t.included[txn.Hash()] = ref
+			if i < len(senders) {
+				t.includedNonce[senderNonce{senders[i], txn.GetNonce()}] = ref
+			}
+		}
+	}
+	t.lastBlock = *head
+	for hash, ref := range t.included {
+		if ref.number+includedDepth < *head {
+			delete(t.included, hash)
+		}
+	}
+	for key, ref := range t.includedNonce {
+		if ref.number+includedDepth < *head {
+			delete(t.includedNonce, key)
+		}
+	}
+	return nil
+}
+
+// update - events of changes from the previous content to txs. First call only remembers the content.
+func (t *tracker) update(txs map[common.Hash]*poolTx, now time.Time) []Event {
+	prevTxs := t.txs
+	t.txs = txs
+	if prevTxs == nil {
+		return nil
+	}
+	var added, moved, removed []Event
+	bySenderNonce := make(map[senderNonce]common.Hash, len(txs))
+	for hash, cur := range txs {
+		bySenderNonce[cur.senderNonce] = hash
+		prev, ok := prevTxs[hash]
+		ev := Event{Time: now, Hash: hash, Sender: cur.sender, Nonce: cur.nonce, SubPool: cur.subPool.String()}
+		switch {
+		case !ok:
+			ev.Kind = Added
+			added = append(added, ev)
+		case rank(cur.subPool) > rank(prev.subPool):
+			ev.Kind, ev.PrevSubPool = Promoted, prev.subPool.String()
+			moved = append(moved, ev)
+		case rank(cur.subPool) < rank(prev.subPool):
+			ev.Kind, ev.PrevSubPool = Demoted, prev.subPool.String()
+			moved = append(moved, ev)
+		}
+	}
+	for hash, prev := range prevTxs {
+		if _, ok := txs[hash]; ok {
+			continue
+		}
+		ev := Event{Time: now, Hash: hash, Sender: prev.sender, Nonce: prev.nonce}
+		if ref, ok := t.included[hash]; ok {
+			ev.Kind, ev.BlockNumber, ev.BlockHash = Included, &ref.number, &ref.hash
+		} else if other, ok := bySenderNonce[prev.senderNonce]; ok {
+			ev.Kind, ev.ReplacedBy = Replaced, &other
+		} else if _, ok := t.includedNonce[prev.senderNonce]; ok {
+			ev.Kind, ev.Reason = Dropped, txpool.NonceTooLow.String()
+		} else {
+			ev.Kind, ev.Reason = Dropped, Discarded
+		}
+		removed = append(removed, ev)
+	}
+	for _, events := range [][]Event{added, moved, removed} {
+		sort.Slice(events, func(i, j int) bool {
+			if events[i].Sender != events[j].Sender {
+				return bytes.Compare(events[i].Sender[:], events[j].Sender[:]) < 0
+			}
+			return events[i].Nonce < events[j].Nonce
+		})
+	}
+	return append(append(added, moved...), removed...)
+}
+
+// Loop - polls pool content and canonical chain, publishes changes
+func (b *Bus) Loop(ctx context.Context, pool PoolContent, chainDB kv.RoDB) {
+	t := newTracker()
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// blocks are read after the pool: transaction which pool removed as mined is in the chain already
+		reply, err := pool.All(ctx, &txpool_proto.AllRequest{})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Debug("[txpool.events] Can't read pool content", "err", err)
+			continue
+		}
+		if err = chainDB.View(ctx, t.readBlocks); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn("[txpool.events] Can't read blocks", "err", err)
+			continue
+		}
+		if events := t.update(t.snapshot(reply), time.Now()); len(events) > 0 {
+			b.publish(events)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package txpoolevents
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	txpool_proto "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	"github.com/ledgerwatch/erigon-lib/txpool"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testSender = crypto.PubkeyToAddress(testKey.PublicKey)
+)
+
+func poolTxRlp(t *testing.T, nonce uint64, gasPrice uint64) (common.Hash, []byte) {
+	txn := types.NewTransaction(nonce, common.Address{1}, uint256.NewInt(1), 21_000, uint256.NewInt(gasPrice), nil)
+	signed, err := types.SignTx(txn, *types.LatestSignerForChainID(params.MainnetChainConfig.ChainID), testKey)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, signed.MarshalBinary(&buf))
+	return signed.Hash(), buf.Bytes()
+}
+
+func allReply(txs ...*txpool_proto.AllReply_Tx) *txpool_proto.AllReply {
+	return &txpool_proto.AllReply{Txs: txs}
+}
+
+func replyTx(typ txpool_proto.AllReply_Type, rlpTx []byte) *txpool_proto.AllReply_Tx {
+	return &txpool_proto.AllReply_Tx{Type: typ, Sender: testSender.Bytes(), RlpTx: rlpTx}
+}
+
+func TestTrackerUpdate(t *testing.T) {
+	now := time.Unix(1_600_000_000, 0)
+	hash0, rlp0 := poolTxRlp(t, 0, 10)
+	hash1, rlp1 := poolTxRlp(t, 1, 10)
+	hash1b, rlp1b := poolTxRlp(t, 1, 20)
+	hash2, rlp2 := poolTxRlp(t, 2, 10)
+	hash3, rlp3 := poolTxRlp(t, 3, 10)
+
+	tr := newTracker()
+	// first poll is a baseline
+	require.Empty(t, tr.update(tr.snapshot(allReply(
+		replyTx(txpool_proto.AllReply_PENDING, rlp0),
+		replyTx(txpool_proto.AllReply_QUEUED, rlp1),
+		replyTx(txpool_proto.AllReply_PENDING, rlp2),
+	)), now))
+
+	events := tr.update(tr.snapshot(allReply(
+		replyTx(txpool_proto.AllReply_PENDING, rlp0),
+		replyTx(txpool_proto.AllReply_BASE_FEE, rlp1),
+		replyTx(txpool_proto.AllReply_QUEUED, rlp2),
+		replyTx(txpool_proto.AllReply_QUEUED, rlp3),
+	)), now)
+	require.Equal(t, []Event{
+		{Kind: Added, Time: now, Hash: hash3, Sender: testSender, Nonce: 3, SubPool: "Queued"},
+		{Kind: Promoted, Time: now, Hash: hash1, Sender: testSender, Nonce: 1, SubPool: "BaseFee", PrevSubPool: "Queued"},
+		{Kind: Demoted, Time: now, Hash: hash2, Sender: testSender, Nonce: 2, SubPool: "Queued", PrevSubPool: "Pending"},
+	}, events)
+
+	// nonce 0 is mined, nonce 1 is replaced, nonce 3 is dropped
+	block := blockRef{number: 5, hash: common.Hash{5}}
+	tr.included[hash0] = block
+	tr.includedNonce[senderNonce{testSender, 0}] = block
+	events = tr.update(tr.snapshot(allReply(
+		replyTx(txpool_proto.AllReply_BASE_FEE, rlp1b),
+		replyTx(txpool_proto.AllReply_QUEUED, rlp2),
+	)), now)
+	require.Equal(t, []Event{
+		{Kind: Added, Time: now, Hash: hash1b, Sender: testSender, Nonce: 1, SubPool: "BaseFee"},
+		{Kind: Included, Time: now, Hash: hash0, Sender: testSender, Nonce: 0, BlockNumber: &block.number, BlockHash: &block.hash},
+		{Kind: Replaced, Time: now, Hash: hash1, Sender: testSender, Nonce: 1, ReplacedBy: &hash1b},
+		{Kind: Dropped, Time: now, Hash: hash3, Sender: testSender, Nonce: 3, Reason: Discarded},
+	}, events)
+
+	// other transaction with nonce 2 is mined
+	tr.includedNonce[senderNonce{testSender, 2}] = blockRef{number: 6, hash: common.Hash{6}}
+	events = tr.update(tr.snapshot(allReply(replyTx(txpool_proto.AllReply_BASE_FEE, rlp1b))), now)
+	require.Equal(t, []Event{
+		{Kind: Dropped, Time: now, Hash: hash2, Sender: testSender, Nonce: 2, Reason: txpool.NonceTooLow.String()},
+	}, events)
+}
+
+func TestBusSubscribe(t *testing.T) {
+	b := NewBus()
+	fast, unsubscribeFast := b.Subscribe(2)
+	slow, unsubscribeSlow := b.Subscribe(1)
+	defer unsubscribeSlow()
+
+	b.publish([]Event{{Kind: Added, Nonce: 0}, {Kind: Added, Nonce: 1}})
+	require.Equal(t, uint64(0), (<-slow).Nonce) // second event is lost
+	require.Equal(t, uint64(0), (<-fast).Nonce)
+	require.Equal(t, uint64(1), (<-fast).Nonce)
+
+	unsubscribeFast()
+	unsubscribeFast()
+	_, ok := <-fast
+	require.False(t, ok)
+	b.publish([]Event{{Kind: Dropped}})
+	require.Equal(t, Dropped, (<-slow).Kind)
+}
@@ -0,0 +1,366 @@
+// Package txpoolfetch schedules fetching of announced transactions for pool's Fetch across all sentries:
+// a transaction announced by several peers (of the same or different sentries) is requested from one of them only,
+// bytes requested and not received yet are limited by a global budget, and peers are served in turns with one
+// request in flight per peer - so one busy peer can't take the whole budget.
+package txpoolfetch
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/erigon-lib/direct"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/eth/protocols/eth"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	// DefaultInflightBytes - default budget of bytes requested from all peers and not received yet
+	DefaultInflightBytes = 16 * 1024 * 1024
+	// FetchTimeout - request which is not answered in time is given up, its transactions are asked from other announcers
+	FetchTimeout = 5 * time.Second
+
+	maxRequestHashes = 256    // same as soft limit of geth for GetPooledTransactions
+	initialTxSize    = 1024   // size estimate of announced transaction before any is received
+	maxAnnounced     = 50_000 // announced transactions waiting or in flight, more are ignored
+	fetchedCacheSize = 50_000 // recently received hashes, announced again while pool is adding them
+)
+
+var (
+	duplicateCounter = metrics.GetOrCreateCounter(`txpool_fetch_duplicate`)
+	requestedCounter = metrics.GetOrCreateCounter(`txpool_fetch_requested`)
+	timeoutCounter   = metrics.GetOrCreateCounter(`txpool_fetch_timeout`)
+	droppedCounter   = metrics.GetOrCreateCounter(`txpool_fetch_dropped`)
+	inflightGauge    = metrics.GetOrCreateCounter(`txpool_fetch_inflight_bytes`)
+)
+
+// peerKey - peer as seen by one sentry, same peer connected to two sentries is two peers
+type peerKey struct {
+	sentry int
+	id     [32]byte
+}
+
+type announce struct {
+	announcers []peerKey // peers which announced the transaction and were not asked for it yet
+	inflight   bool
+}
+
+type request struct {
+	hashes []common.Hash
+	bytes  int
+	sent   time.Time
+}
+
+type peer struct {
+	queue    []common.Hash // announced by this peer, not requested yet
+	inflight *request
+	turn     uint64 // last turn of the peer, new peers go first
+}
+
+// Scheduler - is shared by sentry clients returned by WrapSentries. Pool's Fetch requests unknown announced
+// transactions through them, Scheduler takes these requests as announcements and sends own requests instead.
+type Scheduler struct {
+	budget   int
+	sentries []direct.SentryClient
+
+	lock          sync.Mutex
+	announced     map[common.Hash]*announce
+	fetched       *lru.Cache
+	peers         map[peerKey]*peer
+	turn          uint64
+	inflightBytes int
+	txSize        int // moving average of received transactions
+	requestID     uint64
+}
+
+// New - budget is in bytes, 0 - DefaultInflightBytes
+func New(budget int) (*Scheduler, error) {
+	if budget <= 0 {
+		budget = DefaultInflightBytes
+	}
+	fetched, err := lru.New(fetchedCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	return &Scheduler{
+		budget:    budget,
+		announced: map[common.Hash]*announce{},
+		fetched:   fetched,
+		peers:     map[peerKey]*peer{},
+		txSize:    initialTxSize,
+	}, nil
+}
+
+// outbound - request of scheduler to a peer, sent without holding the lock
+type outbound struct {
+	key peerKey
+	req *request
+}
+
+// onAnnounce - is called when Fetch asks peer of sentry for transactions which pool doesn't know
+func (s *Scheduler) onAnnounce(ctx context.Context, sentryIdx int, peerID *types.H256, hashes []common.Hash) {
+	key := peerKey{sentry: sentryIdx, id: gointerfaces.ConvertH256ToHash(peerID)}
+	s.lock.Lock()
+	p := s.peers[key]
+	if p == nil {
+		p = &peer{}
+		s.peers[key] = p
+	}
+	for _, hash := range hashes {
+		if s.fetched.Contains(hash) {
+			duplicateCounter.Inc()
+			continue
+		}
+		if a, ok := s.announced[hash]; ok {
+			duplicateCounter.Inc()
+			a.announcers = append(a.announcers, key)
+			continue
+		}
+		if len(s.announced) >= maxAnnounced {
+			droppedCounter.Inc()
+			continue
+		}
+		s.announced[hash] = &announce{}
+		p.queue = append(p.queue, hash)
+	}
+	if len(p.queue) == 0 && p.inflight == nil {
+		delete(s.peers, key)
+	}
+	out := s.schedule()
+	s.lock.Unlock()
+	s.send(ctx, out)
+}
+
+// schedule - takes requests from peers in turns while budget allows, one request per peer.
+// Each request gets fair share of budget among peers waiting for their turn, but at least one transaction.
+// If nothing is in flight, one request is sent over budget - so transaction bigger than budget is still fetched.
+func (s *Scheduler) schedule() []outbound {
+	var out []outbound
+	var ready []peerKey
+	for key, p := range s.peers {
+		if len(p.queue) > 0 && p.inflight == nil {
+			ready = append(ready, key)
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool {
+		ti, tj := s.peers[ready[i]].turn, s.peers[ready[j]].turn
+		if ti != tj {
+			return ti < tj
+		}
+		return bytes.Compare(ready[i].id[:], ready[j].id[:]) < 0
+	})
+	for i, key := range ready {
+		available := s.budget - s.inflightBytes
+		if available < s.txSize && s.inflightBytes > 0 {
+			break
+		}
+		share := available / (len(ready) - i)
+		p := s.peers[key]
+		req := &request{}
+		rest := p.queue[:0]
+		for _, hash := range p.queue {
+			a, ok := s.announced[hash]
+			if !ok || a.inflight { // received or asked from other peer meanwhile
+				continue
+			}
+			if len(req.hashes) >= maxRequestHashes || (len(req.hashes) > 0 && req.bytes+s.txSize > share) {
+				rest = append(rest, hash)
+				continue
+			}
+			a.inflight = true
+			req.hashes = append(req.hashes, hash)
+			req.bytes += s.txSize
+		}
+		p.queue = rest
+		if len(req.hashes) == 0 {
+			if len(p.queue) == 0 {
+				delete(s.peers, key)
+			}
+			continue
+		}
+		s.turn++
+		p.turn = s.turn
+		req.sent = time.Now()
+		p.inflight = req
+		s.inflightBytes += req.bytes
+		out = append(out, outbound{key: key, req: req})
+	}
+	inflightGauge.Set(uint64(s.inflightBytes))
+	return out
+}
+
+func (s *Scheduler) send(ctx context.Context, out []outbound) {
+	for _, o := range out {
+		s.lock.Lock()
+		s.requestID++
+		requestID := s.requestID
+		s.lock.Unlock()
+		data, err := rlp.EncodeToBytes(&eth.GetPooledTransactionsPacket66{
+			RequestId:                   requestID,
+			GetPooledTransactionsPacket: o.req.hashes,
+		})
+		if err == nil {
+			requestedCounter.Add(len(o.req.hashes))
+			_, err = s.sentries[o.key.sentry].SendMessageById(ctx, &sentry.SendMessageByIdRequest{
+				Data:   &sentry.OutboundMessageData{Id: sentry.MessageId_GET_POOLED_TRANSACTIONS_66, Data: data},
+				PeerId: gointerfaces.ConvertHashToH256(o.key.id),
+			})
+		}
+		if err != nil {
+			log.Trace("[txpool.fetch] Request failed", "err", err)
+			s.lock.Lock()
+			if p := s.peers[o.key]; p != nil && p.inflight == o.req {
+				s.finish(o.key, nil)
+			}
+			next := s.schedule()
+			s.lock.Unlock()
+			s.send(ctx, next)
+		}
+	}
+}
+
+// finish - releases request in flight of peer, transactions which are not received are asked from other announcers
+func (s *Scheduler) finish(key peerKey, received map[common.Hash]struct{}) {
+	p := s.peers[key]
+	if p == nil || p.inflight == nil {
+		return
+	}
+	req := p.inflight
+	p.inflight = nil
+	s.inflightBytes -= req.bytes
+	for _, hash := range req.hashes {
+		if _, ok := received[hash]; ok {
+			continue
+		}
+		a, ok := s.announced[hash]
+		if !ok {
+			continue
+		}
+		a.inflight = false
+		s.reassign(hash, a)
+	}
+	if len(p.queue) == 0 {
+		delete(s.peers, key)
+	}
+}
+
+func (s *Scheduler) reassign(hash common.Hash, a *announce) {
+	if len(a.announcers) > 0 {
+		key := a.announcers[0]
+		a.announcers = a.announcers[1:]
+		p := s.peers[key]
+		if p == nil {
+			p = &peer{}
+			s.peers[key] = p
+		}
+		p.queue = append(p.queue, hash)
+		return
+	}
+	delete(s.announced, hash)
+}
+
+// onTransactions - is called for transactions received from any peer of sentry, requested or broadcasted
+func (s *Scheduler) onTransactions(ctx context.Context, sentryIdx int, msg *sentry.InboundMessage) {
+	var txs []rlp.RawValue
+	switch msg.Id {
+	case sentry.MessageId_POOLED_TRANSACTIONS_66:
+		var packet eth.PooledTransactionsRLPPacket66
+		if err := rlp.DecodeBytes(msg.Data, &packet); err != nil { // pool penalizes such peers
+			return
+		}
+		txs = packet.PooledTransactionsRLPPacket
+	case sentry.MessageId_TRANSACTIONS_66:
+		if err := rlp.DecodeBytes(msg.Data, &txs); err != nil {
+			return
+		}
+	default:
+		return
+	}
+	received := make(map[common.Hash]struct{}, len(txs))
+	for _, raw := range txs {
+		if hash, ok := txHash(raw); ok {
+			received[hash] = struct{}{}
+		}
+	}
+
+	s.lock.Lock()
+	for hash := range received {
+		s.fetched.Add(hash, struct{}{})
+		delete(s.announced, hash)
+	}
+	for _, raw := range txs {
+		s.txSize = (s.txSize*15 + len(raw)) / 16
+	}
+	if s.txSize < 1 {
+		s.txSize = 1
+	}
+	if msg.Id == sentry.MessageId_POOLED_TRANSACTIONS_66 && msg.PeerId != nil {
+		key := peerKey{sentry: sentryIdx, id: gointerfaces.ConvertH256ToHash(msg.PeerId)}
+		if p := s.peers[key]; p != nil && p.inflight != nil && answers(p.inflight.hashes, received) {
+			s.finish(key, received)
+		}
+	}
+	out := s.schedule()
+	s.lock.Unlock()
+	s.send(ctx, out)
+}
+
+// answers - reply has some of requested transactions, or none if peer doesn't have them any more
+func answers(hashes []common.Hash, set map[common.Hash]struct{}) bool {
+	for _, hash := range hashes {
+		if _, ok := set[hash]; ok {
+			return true
+		}
+	}
+	return len(set) == 0 // empty reply - peer has none of them
+}
+
+// txHash - legacy transaction is RLP list, typed one is RLP string with type byte and payload
+func txHash(raw rlp.RawValue) (common.Hash, bool) {
+	kind, content, _, err := rlp.Split(raw)
+	if err != nil {
+		return common.Hash{}, false
+	}
+	if kind == rlp.List {
+		return crypto.Keccak256Hash(raw), true
+	}
+	return crypto.Keccak256Hash(content), true
+}
+
+// expire - gives up requests which are not answered in FetchTimeout
+func (s *Scheduler) expire(ctx context.Context, now time.Time) {
+	s.lock.Lock()
+	for key, p := range s.peers {
+		if p.inflight != nil && now.Sub(p.inflight.sent) > FetchTimeout {
+			timeoutCounter.Inc()
+			s.finish(key, nil)
+		}
+	}
+	out := s.schedule()
+	s.lock.Unlock()
+	s.send(ctx, out)
+}
+
+// Loop - expires unanswered requests
+func (s *Scheduler) Loop(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.expire(ctx, now)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package txpoolfetch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/direct"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/protocols/eth"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+type sent struct {
+	peer   [32]byte
+	hashes []common.Hash
+}
+
+type testSentry struct {
+	direct.SentryClient
+	sent []sent
+}
+
+func (c *testSentry) SendMessageById(_ context.Context, in *sentry.SendMessageByIdRequest, _ ...grpc.CallOption) (*sentry.SentPeers, error) {
+	var packet eth.GetPooledTransactionsPacket66
+	if err := rlp.DecodeBytes(in.Data.Data, &packet); err != nil {
+		return nil, err
+	}
+	c.sent = append(c.sent, sent{peer: gointerfaces.ConvertH256ToHash(in.PeerId), hashes: packet.GetPooledTransactionsPacket})
+	return &sentry.SentPeers{}, nil
+}
+
+func (c *testSentry) take() []sent {
+	s := c.sent
+	c.sent = nil
+	return s
+}
+
+func testTxs(t *testing.T, n int) ([]types.Transaction, []common.Hash) {
+	txs := make([]types.Transaction, n)
+	hashes := make([]common.Hash, n)
+	for i := range txs {
+		txs[i] = types.NewTransaction(uint64(i), common.Address{1}, uint256.NewInt(1), 21000, uint256.NewInt(1), nil)
+		hashes[i] = txs[i].Hash()
+	}
+	return txs, hashes
+}
+
+func announceTo(t *testing.T, client direct.SentryClient, peer [32]byte, hashes ...common.Hash) {
+	data, err := rlp.EncodeToBytes(&eth.GetPooledTransactionsPacket66{RequestId: 1, GetPooledTransactionsPacket: hashes})
+	require.NoError(t, err)
+	_, err = client.SendMessageById(context.Background(), &sentry.SendMessageByIdRequest{
+		Data:   &sentry.OutboundMessageData{Id: sentry.MessageId_GET_POOLED_TRANSACTIONS_66, Data: data},
+		PeerId: gointerfaces.ConvertHashToH256(peer),
+	})
+	require.NoError(t, err)
+}
+
+func deliver(t *testing.T, s *Scheduler, sentryIdx int, peer [32]byte, txs ...types.Transaction) {
+	data, err := rlp.EncodeToBytes(&eth.PooledTransactionsPacket66{RequestId: 1, PooledTransactionsPacket: txs})
+	require.NoError(t, err)
+	s.onTransactions(context.Background(), sentryIdx, &sentry.InboundMessage{
+		Id:     sentry.MessageId_POOLED_TRANSACTIONS_66,
+		Data:   data,
+		PeerId: gointerfaces.ConvertHashToH256(peer),
+	})
+}
+
+func TestDedupAcrossSentries(t *testing.T) {
+	s, err := New(0)
+	require.NoError(t, err)
+	sentry0, sentry1 := &testSentry{}, &testSentry{}
+	clients := s.WrapSentries([]direct.SentryClient{sentry0, sentry1})
+	txs, hashes := testTxs(t, 2)
+	peerA, peerB := [32]byte{0xa}, [32]byte{0xb}
+
+	announceTo(t, clients[0], peerA, hashes[0])
+	announceTo(t, clients[1], peerB, hashes[0], hashes[1])
+	require.Equal(t, []sent{{peer: peerA, hashes: hashes[:1]}}, sentry0.take())
+	require.Equal(t, []sent{{peer: peerB, hashes: hashes[1:]}}, sentry1.take()) // hashes[0] is in flight from peerA
+
+	deliver(t, s, 1, peerB, txs[1])
+	deliver(t, s, 0, peerA) // peerA doesn't have it any more - asked from peerB
+	require.Equal(t, []sent{{peer: peerB, hashes: hashes[:1]}}, sentry1.take())
+
+	deliver(t, s, 1, peerB, txs[0])
+	announceTo(t, clients[0], peerA, hashes[0]) // already received
+	require.Empty(t, sentry0.take())
+	require.Empty(t, s.announced)
+	require.Zero(t, s.inflightBytes)
+}
+
+func TestInflightBudget(t *testing.T) {
+	s, err := New(2 * initialTxSize)
+	require.NoError(t, err)
+	sentry0 := &testSentry{}
+	clients := s.WrapSentries([]direct.SentryClient{sentry0})
+	txs, hashes := testTxs(t, 6)
+	peerA, peerB := [32]byte{0xa}, [32]byte{0xb}
+
+	announceTo(t, clients[0], peerA, hashes[:4]...)
+	require.Equal(t, []sent{{peer: peerA, hashes: hashes[:2]}}, sentry0.take()) // whole budget for the only peer
+	announceTo(t, clients[0], peerB, hashes[4:]...)
+	require.Empty(t, sentry0.take()) // budget is taken
+
+	deliver(t, s, 0, peerA, txs[:2]...)
+	// peerA had its turn, peerB goes first and both share the budget
+	require.Equal(t, []sent{{peer: peerB, hashes: hashes[4:5]}, {peer: peerA, hashes: hashes[2:3]}}, sentry0.take())
+}
+
+func TestFetchTimeout(t *testing.T) {
+	s, err := New(0)
+	require.NoError(t, err)
+	sentry0 := &testSentry{}
+	clients := s.WrapSentries([]direct.SentryClient{sentry0})
+	_, hashes := testTxs(t, 1)
+	peerA, peerB := [32]byte{0xa}, [32]byte{0xb}
+
+	announceTo(t, clients[0], peerA, hashes...)
+	announceTo(t, clients[0], peerB, hashes...)
+	require.Equal(t, []sent{{peer: peerA, hashes: hashes}}, sentry0.take())
+
+	s.expire(context.Background(), time.Now())
+	require.Empty(t, sentry0.take())
+	s.expire(context.Background(), time.Now().Add(FetchTimeout+time.Second))
+	require.Equal(t, []sent{{peer: peerB, hashes: hashes}}, sentry0.take())
+	s.expire(context.Background(), time.Now().Add(2*FetchTimeout+time.Second))
+	require.Empty(t, s.announced) // nobody else announced it
+	require.Empty(t, s.peers)
+}
@@ -0,0 +1,64 @@
+package txpoolfetch
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/erigon-lib/direct"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon/eth/protocols/eth"
+	"github.com/ledgerwatch/erigon/rlp"
+	"google.golang.org/grpc"
+)
+
+type sentryClient struct {
+	direct.SentryClient
+	idx       int
+	scheduler *Scheduler
+}
+
+type messagesClient struct {
+	sentry.Sentry_MessagesClient
+	ctx    context.Context
+	client *sentryClient
+}
+
+func (c *messagesClient) Recv() (*sentry.InboundMessage, error) {
+	msg, err := c.Sentry_MessagesClient.Recv()
+	if err == nil && msg != nil {
+		c.client.scheduler.onTransactions(c.ctx, c.client.idx, msg)
+	}
+	return msg, err
+}
+
+func (c *sentryClient) Messages(ctx context.Context, in *sentry.MessagesRequest, opts ...grpc.CallOption) (sentry.Sentry_MessagesClient, error) {
+	stream, err := c.SentryClient.Messages(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &messagesClient{Sentry_MessagesClient: stream, ctx: ctx, client: c}, nil
+}
+
+// SendMessageById - requests of pooled transactions are taken by Scheduler as announcements, other messages are sent as is
+func (c *sentryClient) SendMessageById(ctx context.Context, in *sentry.SendMessageByIdRequest, opts ...grpc.CallOption) (*sentry.SentPeers, error) {
+	if in.Data == nil || in.Data.Id != sentry.MessageId_GET_POOLED_TRANSACTIONS_66 {
+		return c.SentryClient.SendMessageById(ctx, in, opts...)
+	}
+	var packet eth.GetPooledTransactionsPacket66
+	if err := rlp.DecodeBytes(in.Data.Data, &packet); err != nil {
+		return nil, err
+	}
+	c.scheduler.onAnnounce(ctx, c.idx, in.PeerId, packet.GetPooledTransactionsPacket)
+	return &sentry.SentPeers{Peers: []*types.H256{in.PeerId}}, nil
+}
+
+// WrapSentries - sentry clients for pool's Fetch, fetching of announced transactions goes through Scheduler.
+// Must be called once, before the clients are used.
+func (s *Scheduler) WrapSentries(sentries []direct.SentryClient) []direct.SentryClient {
+	s.sentries = sentries
+	wrapped := make([]direct.SentryClient, len(sentries))
+	for i, c := range sentries {
+		wrapped[i] = &sentryClient{SentryClient: c, idx: i, scheduler: s}
+	}
+	return wrapped
+}
@@ -0,0 +1,74 @@
+package txpoolshadow
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/core/types"
+)
+
+// Policy - candidate admission rules, evaluated for every transaction seen by the pool but never enforced.
+// Zero value of a field means "no limit".
+type Policy struct {
+	MinFeeCap uint64 // same meaning as --txpool.pricelimit
+	MinTip    uint64
+	MaxData   uint64 // bytes of transaction data
+	MaxGas    uint64
+}
+
+// ParsePolicy - parses comma separated list of key=value, for example: "pricelimit=2000000000,tiplimit=1000000000,maxdata=65536".
+// Keys: pricelimit (min fee cap, wei), tiplimit (min priority fee, wei), maxdata (bytes), maxgas.
+func ParsePolicy(s string) (*Policy, error) {
+	p := &Policy{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("expected key=value, got %q", item)
+		}
+		key := strings.TrimSpace(kv[0])
+		v, err := strconv.ParseUint(strings.ReplaceAll(strings.TrimSpace(kv[1]), "_", ""), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		switch key {
+		case "pricelimit":
+			p.MinFeeCap = v
+		case "tiplimit":
+			p.MinTip = v
+		case "maxdata":
+			p.MaxData = v
+		case "maxgas":
+			p.MaxGas = v
+		default:
+			return nil, fmt.Errorf("unknown policy key %q", key)
+		}
+	}
+	return p, nil
+}
+
+func (p *Policy) String() string {
+	return fmt.Sprintf("pricelimit=%d,tiplimit=%d,maxdata=%d,maxgas=%d", p.MinFeeCap, p.MinTip, p.MaxData, p.MaxGas)
+}
+
+// Evaluate - returns reason of rejection by the policy, or empty string if the transaction is acceptable
+func (p *Policy) Evaluate(txn types.Transaction) string {
+	if p.MinFeeCap > 0 && txn.GetFeeCap().Lt(uint256.NewInt(p.MinFeeCap)) {
+		return "fee too low"
+	}
+	if p.MinTip > 0 && txn.GetTip().Lt(uint256.NewInt(p.MinTip)) {
+		return "tip too low"
+	}
+	if p.MaxData > 0 && uint64(len(txn.GetData())) > p.MaxData {
+		return "oversized data"
+	}
+	if p.MaxGas > 0 && txn.GetGas() > p.MaxGas {
+		return "gas limit too high"
+	}
+	return ""
+}
@@ -0,0 +1,267 @@
+// Package txpoolshadow observes admission decisions of the transaction pool without changing them:
+// rejected transactions are counted in metrics and optionally written to a file (one JSON object per line),
+// and every transaction is also evaluated by a candidate Policy - to see what would change if pool flags were changed.
+package txpoolshadow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/txpool"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/protocols/eth"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// RemoteDiscarded - reason of rejection of remote transactions. Pool keeps reasons only for local transactions,
+// so for remote ones it's only known that transaction was discarded.
+const RemoteDiscarded = "discarded"
+
+// CheckDelay - remote transactions are processed by pool in batches, their outcome is checked after this delay
+const CheckDelay = 2 * time.Second
+
+const (
+	messagesBuffer = 1024
+	maxPending     = 100_000
+	seenCacheSize  = 100_000
+)
+
+var (
+	droppedCounter     = metrics.GetOrCreateCounter(`txpool_shadow_dropped`)
+	unprocessedCounter = metrics.GetOrCreateCounter(`txpool_shadow_unprocessed`)
+)
+
+// Event - outcome of one transaction. Empty Reason/PolicyReason means acceptance by pool/policy.
+type Event struct {
+	Time         time.Time      `json:"time"`
+	Hash         common.Hash    `json:"hash"`
+	Sender       common.Address `json:"sender"`
+	Nonce        uint64         `json:"nonce"`
+	FeeCap       *big.Int       `json:"feeCap"`
+	Tip          *big.Int       `json:"tip"`
+	Gas          uint64         `json:"gas"`
+	DataLen      int            `json:"dataLen"`
+	Local        bool           `json:"local"`
+	Reason       string         `json:"reason,omitempty"`
+	PolicyReason string         `json:"policyReason,omitempty"`
+
+	txn types.Transaction
+}
+
+type Shadow struct {
+	policy *Policy // nil - no candidate policy
+
+	fileLock sync.Mutex
+	file     *os.File
+	enc      *json.Encoder
+
+	messages chan *sentry.InboundMessage
+	seen     *lru.Cache // hashes of remote transactions, which are already checked or waiting for check
+}
+
+// New - filePath and policy are optional
+func New(filePath string, policy *Policy) (*Shadow, error) {
+	seen, err := lru.New(seenCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	s := &Shadow{policy: policy, seen: seen, messages: make(chan *sentry.InboundMessage, messagesBuffer)}
+	if filePath != "" {
+		if s.file, err = os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			return nil, err
+		}
+		s.enc = json.NewEncoder(s.file)
+	}
+	return s, nil
+}
+
+func (s *Shadow) Close() error {
+	s.fileLock.Lock()
+	defer s.fileLock.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file, s.enc = nil, nil
+	return err
+}
+
+func newEvent(txn types.Transaction, local bool) *Event {
+	ev := &Event{
+		Time:    time.Now(),
+		Hash:    txn.Hash(),
+		Nonce:   txn.GetNonce(),
+		FeeCap:  txn.GetFeeCap().ToBig(),
+		Tip:     txn.GetTip().ToBig(),
+		Gas:     txn.GetGas(),
+		DataLen: len(txn.GetData()),
+		Local:   local,
+		txn:     txn,
+	}
+	var chainID *big.Int
+	if id := txn.GetChainID(); id != nil {
+		chainID = id.ToBig()
+	}
+	// invalid signature is pool's business, here sender is informational only
+	ev.Sender, _ = txn.Sender(*types.LatestSignerForChainID(chainID))
+	return ev
+}
+
+// label - turns reason into value of metric label
+func label(reason string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, reason)
+}
+
+func verdict(rejected bool) string {
+	if rejected {
+		return "rejected"
+	}
+	return "accepted"
+}
+
+// record - evaluates candidate policy and reports the event. Accepted by both pool and policy transactions are only counted.
+func (s *Shadow) record(ev *Event) {
+	rejected := ev.Reason != ""
+	if rejected {
+		metrics.GetOrCreateCounter(fmt.Sprintf(`txpool_shadow_rejected{reason="%s"}`, label(ev.Reason))).Inc()
+	}
+	if s.policy != nil {
+		ev.PolicyReason = s.policy.Evaluate(ev.txn)
+		policyRejected := ev.PolicyReason != ""
+		metrics.GetOrCreateCounter(fmt.Sprintf(`txpool_shadow_policy{pool="%s",policy="%s"}`, verdict(rejected), verdict(policyRejected))).Inc()
+		if policyRejected {
+			metrics.GetOrCreateCounter(fmt.Sprintf(`txpool_shadow_policy_rejected{reason="%s"}`, label(ev.PolicyReason))).Inc()
+		}
+	}
+	if !rejected && ev.PolicyReason == "" {
+		return
+	}
+
+	s.fileLock.Lock()
+	defer s.fileLock.Unlock()
+	if s.enc == nil {
+		return
+	}
+	if err := s.enc.Encode(ev); err != nil {
+		log.Warn("[txpool.shadow] Can't write event", "err", err)
+	}
+}
+
+// onMessage - is called from sentry streams of pool's Fetch, must not block them
+func (s *Shadow) onMessage(msg *sentry.InboundMessage) {
+	switch msg.Id {
+	case sentry.MessageId_TRANSACTIONS_66, sentry.MessageId_POOLED_TRANSACTIONS_66:
+	default:
+		return
+	}
+	select {
+	case s.messages <- msg:
+	default:
+		droppedCounter.Inc()
+	}
+}
+
+func decodeTxs(msg *sentry.InboundMessage) ([]types.Transaction, error) {
+	switch msg.Id {
+	case sentry.MessageId_TRANSACTIONS_66:
+		var txs eth.TransactionsPacket
+		if err := rlp.DecodeBytes(msg.Data, &txs); err != nil {
+			return nil, err
+		}
+		return txs, nil
+	case sentry.MessageId_POOLED_TRANSACTIONS_66:
+		var packet eth.PooledTransactionsPacket66
+		if err := rlp.DecodeBytes(msg.Data, &packet); err != nil {
+			return nil, err
+		}
+		return packet.PooledTransactionsPacket, nil
+	}
+	return nil, nil
+}
+
+// Loop - checks outcome of remote transactions. Transaction is accepted if pool has it after CheckDelay,
+// and discarded if pool knows the hash but doesn't have the transaction.
+func (s *Shadow) Loop(ctx context.Context, pool txpool.Pool, db kv.RoDB) {
+	defer s.Close()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var pending []*Event
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-s.messages:
+			txs, err := decodeTxs(msg)
+			if err != nil { // pool penalizes such peers
+				continue
+			}
+			for _, txn := range txs {
+				if len(pending) >= maxPending {
+					droppedCounter.Inc()
+					continue
+				}
+				if ok, _ := s.seen.ContainsOrAdd(txn.Hash(), struct{}{}); ok {
+					continue
+				}
+				pending = append(pending, newEvent(txn, false))
+			}
+		case <-ticker.C:
+			cutoff := time.Now().Add(-CheckDelay)
+			ready := 0
+			for ready < len(pending) && pending[ready].Time.Before(cutoff) {
+				ready++
+			}
+			if ready == 0 || !pool.Started() {
+				continue
+			}
+			if err := db.View(ctx, func(tx kv.Tx) error {
+				for _, ev := range pending[:ready] {
+					rlpTx, err := pool.GetRlp(tx, ev.Hash[:])
+					if err != nil {
+						return err
+					}
+					if rlpTx == nil {
+						known, err := pool.IdHashKnown(tx, ev.Hash[:])
+						if err != nil {
+							return err
+						}
+						if !known { // not delivered to pool or already forgotten
+							unprocessedCounter.Inc()
+							continue
+						}
+						ev.Reason = RemoteDiscarded
+					}
+					s.record(ev)
+				}
+				return nil
+			}); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Warn("[txpool.shadow] Can't check transactions", "err", err)
+			}
+			pending = pending[ready:]
+		}
+	}
+}
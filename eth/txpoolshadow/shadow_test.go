@@ -0,0 +1,137 @@
+package txpoolshadow
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("pricelimit=2_000_000_000, tiplimit=1000,maxdata=64,maxgas=21000")
+	require.NoError(t, err)
+	require.Equal(t, Policy{MinFeeCap: 2_000_000_000, MinTip: 1000, MaxData: 64, MaxGas: 21000}, *p)
+
+	p, err = ParsePolicy("")
+	require.NoError(t, err)
+	require.Equal(t, Policy{}, *p)
+
+	for _, bad := range []string{"pricelimit", "pricelimit=-1", "unknown=1"} {
+		_, err = ParsePolicy(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func signedTx(t *testing.T, nonce uint64, gasPrice uint64, data []byte) types.Transaction {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	txn := types.NewTransaction(nonce, common.Address{1}, uint256.NewInt(1), 100_000, uint256.NewInt(gasPrice), data)
+	signed, err := types.SignTx(txn, *types.LatestSignerForChainID(params.MainnetChainConfig.ChainID), key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	p := &Policy{MinFeeCap: 100, MinTip: 10, MaxData: 4, MaxGas: 50_000}
+	require.Equal(t, "fee too low", p.Evaluate(signedTx(t, 0, 99, nil)))
+	require.Equal(t, "oversized data", p.Evaluate(signedTx(t, 0, 100, make([]byte, 5))))
+	require.Equal(t, "gas limit too high", p.Evaluate(signedTx(t, 0, 100, nil)))
+	p.MaxGas = 0
+	require.Equal(t, "", p.Evaluate(signedTx(t, 0, 100, make([]byte, 4))))
+}
+
+func TestRecord(t *testing.T) {
+	dir := t.TempDir()
+	policy, err := ParsePolicy("pricelimit=100")
+	require.NoError(t, err)
+	s, err := New(filepath.Join(dir, "shadow.jsonl"), policy)
+	require.NoError(t, err)
+
+	accepted := newEvent(signedTx(t, 1, 200, nil), false)
+	s.record(accepted) // accepted by both - not written
+	policyRejected := newEvent(signedTx(t, 2, 50, nil), true)
+	s.record(policyRejected)
+	poolRejected := newEvent(signedTx(t, 3, 300, nil), false)
+	poolRejected.Reason = RemoteDiscarded
+	s.record(poolRejected)
+	require.NoError(t, s.Close())
+
+	f, err := os.Open(filepath.Join(dir, "shadow.jsonl"))
+	require.NoError(t, err)
+	defer f.Close()
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &ev))
+		events = append(events, ev)
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, events, 2)
+
+	require.Equal(t, policyRejected.Hash, events[0].Hash)
+	require.Equal(t, policyRejected.Sender, events[0].Sender)
+	require.NotEqual(t, common.Address{}, events[0].Sender)
+	require.Equal(t, uint64(2), events[0].Nonce)
+	require.Equal(t, int64(50), events[0].FeeCap.Int64())
+	require.True(t, events[0].Local)
+	require.Equal(t, "", events[0].Reason)
+	require.Equal(t, "fee too low", events[0].PolicyReason)
+
+	require.Equal(t, poolRejected.Hash, events[1].Hash)
+	require.Equal(t, RemoteDiscarded, events[1].Reason)
+	require.Equal(t, "", events[1].PolicyReason)
+}
+
+type testStream struct {
+	sentry.Sentry_MessagesClient
+	msgs []*sentry.InboundMessage
+}
+
+func (s *testStream) Recv() (*sentry.InboundMessage, error) {
+	msg := s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return msg, nil
+}
+
+func TestMessagesTee(t *testing.T) {
+	s, err := New("", nil)
+	require.NoError(t, err)
+	txs := []types.Transaction{signedTx(t, 0, 1, nil), signedTx(t, 1, 2, nil)}
+	raw, err := types.MarshalTransactionsBinary(txs)
+	require.NoError(t, err)
+	broadcast, err := rlp.EncodeToBytes([]rlp.RawValue{raw[0], raw[1]})
+	require.NoError(t, err)
+	pooled, err := rlp.EncodeToBytes([]interface{}{uint64(1), []rlp.RawValue{raw[1]}})
+	require.NoError(t, err)
+
+	stream := &messagesClient{shadow: s, Sentry_MessagesClient: &testStream{msgs: []*sentry.InboundMessage{
+		{Id: sentry.MessageId_TRANSACTIONS_66, Data: broadcast},
+		{Id: sentry.MessageId_NEW_BLOCK_HASHES_66, Data: []byte{1}},
+		{Id: sentry.MessageId_POOLED_TRANSACTIONS_66, Data: pooled},
+	}}}
+	for i := 0; i < 3; i++ {
+		_, err = stream.Recv()
+		require.NoError(t, err)
+	}
+	require.Len(t, s.messages, 2)
+
+	decoded, err := decodeTxs(<-s.messages)
+	require.NoError(t, err)
+	require.Len(t, decoded, 2)
+	require.Equal(t, txs[0].Hash(), decoded[0].Hash())
+	decoded, err = decodeTxs(<-s.messages)
+	require.NoError(t, err)
+	require.Len(t, decoded, 1)
+	require.Equal(t, txs[1].Hash(), decoded[0].Hash())
+}
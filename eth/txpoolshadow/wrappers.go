@@ -0,0 +1,82 @@
+package txpoolshadow
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/erigon-lib/direct"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	txpool_proto "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	"github.com/ledgerwatch/erigon-lib/txpool"
+	"github.com/ledgerwatch/erigon/core/types"
+	"google.golang.org/grpc"
+)
+
+type sentryClient struct {
+	direct.SentryClient
+	shadow *Shadow
+}
+
+type messagesClient struct {
+	sentry.Sentry_MessagesClient
+	shadow *Shadow
+}
+
+func (c *messagesClient) Recv() (*sentry.InboundMessage, error) {
+	msg, err := c.Sentry_MessagesClient.Recv()
+	if err == nil {
+		c.shadow.onMessage(msg)
+	}
+	return msg, err
+}
+
+func (c *sentryClient) Messages(ctx context.Context, in *sentry.MessagesRequest, opts ...grpc.CallOption) (sentry.Sentry_MessagesClient, error) {
+	stream, err := c.SentryClient.Messages(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &messagesClient{Sentry_MessagesClient: stream, shadow: c.shadow}, nil
+}
+
+// WrapSentries - sentry clients which show to Shadow transactions received by pool's Fetch
+func (s *Shadow) WrapSentries(sentries []direct.SentryClient) []direct.SentryClient {
+	wrapped := make([]direct.SentryClient, len(sentries))
+	for i, c := range sentries {
+		wrapped[i] = &sentryClient{SentryClient: c, shadow: s}
+	}
+	return wrapped
+}
+
+// GrpcServer - records outcome of local transactions (sent by RPC), their rejection reasons are known
+type GrpcServer struct {
+	*txpool.GrpcServer
+	shadow *Shadow
+}
+
+func (s *Shadow) WrapGrpcServer(server *txpool.GrpcServer) *GrpcServer {
+	return &GrpcServer{GrpcServer: server, shadow: s}
+}
+
+func (s *GrpcServer) Add(ctx context.Context, in *txpool_proto.AddRequest) (*txpool_proto.AddReply, error) {
+	reply, err := s.GrpcServer.Add(ctx, in)
+	if err != nil {
+		return reply, err
+	}
+	for i, rlpTx := range in.RlpTxs {
+		if i >= len(reply.Imported) {
+			break
+		}
+		txn, err := types.UnmarshalTransactionFromBinary(rlpTx)
+		if err != nil { // rejected by pool for same reason
+			continue
+		}
+		ev := newEvent(txn, true)
+		if reply.Imported[i] != txpool_proto.ImportResult_SUCCESS {
+			ev.Reason = reply.Errors[i]
+			if ev.Reason == "" {
+				ev.Reason = reply.Imported[i].String()
+			}
+		}
+		s.shadow.record(ev)
+	}
+	return reply, nil
+}
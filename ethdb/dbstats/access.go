@@ -0,0 +1,215 @@
+package dbstats
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+)
+
+const (
+	// maxSampledPrefixes - limit of distinct prefixes kept by sampler. When it's reached, counters of all prefixes
+	// are decremented and zero ones are evicted (Misra-Gries), so heavy hitters survive and memory stays bounded
+	maxSampledPrefixes = 4096
+	// DefaultHotPrefixes - amount of hottest prefixes returned by RPC
+	DefaultHotPrefixes = 100
+)
+
+// Access - counters of reads and writes per table. Counters are atomic and cheap, so they are always on.
+// Reads are point lookups (GetOne/Has), cursor positioning and entries visited by ForEach-like walks.
+// Writes are Put/Append/Delete and cursor writes.
+//
+// Optionally, 1 of sampleRate accesses records prefix of the key, it shows which key ranges are hot:
+// useful to choose indices and to find unexpected IO patterns.
+type Access struct {
+	tables map[string]*tableAccess // known tables, never modified after creation - read without lock
+
+	lock    sync.Mutex
+	other   map[string]*tableAccess // tables outside of kv.ChaindataTables
+	since   time.Time
+	samples map[sampledPrefix]uint64
+
+	sampleRate uint64 // 0 - sampling disabled
+	prefixLen  int
+	ticks      uint64
+}
+
+type tableAccess struct {
+	reads  uint64
+	writes uint64
+}
+
+type sampledPrefix struct {
+	table  string
+	prefix string
+	write  bool
+}
+
+// NewAccess - sampleRate 0 disables sampling of keys, prefixLen is amount of leading key bytes to group samples by
+func NewAccess(sampleRate uint, prefixLen int) *Access {
+	a := &Access{
+		tables:     make(map[string]*tableAccess, len(kv.ChaindataTables)),
+		other:      map[string]*tableAccess{},
+		since:      time.Now(),
+		samples:    map[sampledPrefix]uint64{},
+		sampleRate: uint64(sampleRate),
+		prefixLen:  prefixLen,
+	}
+	for _, name := range kv.ChaindataTables {
+		a.tables[name] = &tableAccess{}
+	}
+	return a
+}
+
+// RegisterMetrics - exports counters of known tables as db_table_reads/db_table_writes metrics, labeled by chain
+// and name of database: one process can run nodes of several chains (see --networks)
+func (a *Access) RegisterMetrics(chain, db string) {
+	for name, t := range a.tables {
+		t := t
+		metrics.GetOrCreateGauge(fmt.Sprintf(`db_table_reads{chain="%s",db="%s",table="%s"}`, chain, db, name), func() float64 {
+			return float64(atomic.LoadUint64(&t.reads))
+		})
+		metrics.GetOrCreateGauge(fmt.Sprintf(`db_table_writes{chain="%s",db="%s",table="%s"}`, chain, db, name), func() float64 {
+			return float64(atomic.LoadUint64(&t.writes))
+		})
+	}
+}
+
+func (a *Access) table(name string) *tableAccess {
+	if t, ok := a.tables[name]; ok {
+		return t
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	t, ok := a.other[name]
+	if !ok {
+		t = &tableAccess{}
+		a.other[name] = t
+	}
+	return t
+}
+
+// Read - counts read of table, key is used only by sampler
+func (a *Access) Read(table string, key []byte) {
+	atomic.AddUint64(&a.table(table).reads, 1)
+	a.sample(table, key, false)
+}
+
+// Write - counts write of table, key is used only by sampler
+func (a *Access) Write(table string, key []byte) {
+	atomic.AddUint64(&a.table(table).writes, 1)
+	a.sample(table, key, true)
+}
+
+func (a *Access) sample(table string, key []byte, write bool) {
+	if a.sampleRate == 0 || key == nil || atomic.AddUint64(&a.ticks, 1)%a.sampleRate != 0 {
+		return
+	}
+	if len(key) > a.prefixLen {
+		key = key[:a.prefixLen]
+	}
+	s := sampledPrefix{table: table, prefix: string(key), write: write}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if _, ok := a.samples[s]; !ok && len(a.samples) >= maxSampledPrefixes {
+		for k, v := range a.samples {
+			if v <= 1 {
+				delete(a.samples, k)
+			} else {
+				a.samples[k] = v - 1
+			}
+		}
+		return
+	}
+	a.samples[s]++
+}
+
+type TableAccess struct {
+	Name   string `json:"name"`
+	Reads  uint64 `json:"reads"`
+	Writes uint64 `json:"writes"`
+}
+
+type HotPrefix struct {
+	Table   string        `json:"table"`
+	Prefix  hexutil.Bytes `json:"prefix"`
+	Write   bool          `json:"write"`
+	Samples uint64        `json:"samples"` // approximate: multiply by sample rate to estimate amount of accesses
+}
+
+type AccessStats struct {
+	Tables      []TableAccess `json:"tables"` // only accessed tables, sorted by reads+writes, most accessed first
+	HotPrefixes []HotPrefix   `json:"hotPrefixes,omitempty"`
+	SampleRate  uint64        `json:"sampleRate"` // 0 - sampling disabled
+	PrefixLen   int           `json:"prefixLen,omitempty"`
+	Since       time.Time     `json:"since"`
+}
+
+// Stats - counters since creation or last Reset and top hottest prefixes
+func (a *Access) Stats(top int) *AccessStats {
+	res := &AccessStats{SampleRate: a.sampleRate}
+	if a.sampleRate > 0 {
+		res.PrefixLen = a.prefixLen
+	}
+	add := func(name string, t *tableAccess) {
+		ta := TableAccess{Name: name, Reads: atomic.LoadUint64(&t.reads), Writes: atomic.LoadUint64(&t.writes)}
+		if ta.Reads+ta.Writes > 0 {
+			res.Tables = append(res.Tables, ta)
+		}
+	}
+	for name, t := range a.tables {
+		add(name, t)
+	}
+	a.lock.Lock()
+	for name, t := range a.other {
+		add(name, t)
+	}
+	res.Since = a.since
+	for s, n := range a.samples {
+		res.HotPrefixes = append(res.HotPrefixes, HotPrefix{Table: s.table, Prefix: hexutil.Bytes(s.prefix), Write: s.write, Samples: n})
+	}
+	a.lock.Unlock()
+
+	sort.Slice(res.Tables, func(i, j int) bool {
+		ti, tj := res.Tables[i], res.Tables[j]
+		if ti.Reads+ti.Writes != tj.Reads+tj.Writes {
+			return ti.Reads+ti.Writes > tj.Reads+tj.Writes
+		}
+		return ti.Name < tj.Name
+	})
+	sort.Slice(res.HotPrefixes, func(i, j int) bool {
+		pi, pj := res.HotPrefixes[i], res.HotPrefixes[j]
+		if pi.Samples != pj.Samples {
+			return pi.Samples > pj.Samples
+		}
+		if pi.Table != pj.Table {
+			return pi.Table < pj.Table
+		}
+		return string(pi.Prefix) < string(pj.Prefix)
+	})
+	if len(res.HotPrefixes) > top {
+		res.HotPrefixes = res.HotPrefixes[:top]
+	}
+	return res
+}
+
+// Reset - zeroes counters and forgets samples
+func (a *Access) Reset() {
+	for _, t := range a.tables {
+		atomic.StoreUint64(&t.reads, 0)
+		atomic.StoreUint64(&t.writes, 0)
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for _, t := range a.other {
+		atomic.StoreUint64(&t.reads, 0)
+		atomic.StoreUint64(&t.writes, 0)
+	}
+	a.samples = map[sampledPrefix]uint64{}
+	a.since = time.Now()
+}
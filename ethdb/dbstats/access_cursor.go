@@ -0,0 +1,134 @@
+package dbstats
+
+import (
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// wrapCursor - keeps DupSort and write methods of c available: callers may type-assert cursors
+func wrapCursor(c kv.Cursor, table string, access *Access) kv.Cursor {
+	base := &accessCursor{Cursor: c, table: table, access: access}
+	dc, isDupSort := c.(kv.CursorDupSort)
+	rw, isRw := c.(kv.RwCursor)
+	switch {
+	case isDupSort && isRw:
+		rwd, ok := c.(kv.RwCursorDupSort)
+		if !ok {
+			return &accessCursorDupSort{accessCursor: base, dc: dc}
+		}
+		return &accessRwCursorDupSort{
+			accessCursorDupSort: &accessCursorDupSort{accessCursor: base, dc: dc},
+			cursorWriter:        cursorWriter{rw: rw, table: table, access: access},
+			rwd:                 rwd,
+		}
+	case isDupSort:
+		return &accessCursorDupSort{accessCursor: base, dc: dc}
+	case isRw:
+		return &accessRwCursor{accessCursor: base, cursorWriter: cursorWriter{rw: rw, table: table, access: access}}
+	default:
+		return base
+	}
+}
+
+type accessCursor struct {
+	kv.Cursor
+	table  string
+	access *Access
+}
+
+// read - iteration counts returned key, positioning by key counts requested key (miss costs IO too)
+func (c *accessCursor) read(k, v []byte, err error) ([]byte, []byte, error) {
+	c.access.Read(c.table, k)
+	return k, v, err
+}
+
+func (c *accessCursor) First() ([]byte, []byte, error) { return c.read(c.Cursor.First()) }
+func (c *accessCursor) Next() ([]byte, []byte, error)  { return c.read(c.Cursor.Next()) }
+func (c *accessCursor) Prev() ([]byte, []byte, error)  { return c.read(c.Cursor.Prev()) }
+func (c *accessCursor) Last() ([]byte, []byte, error)  { return c.read(c.Cursor.Last()) }
+
+func (c *accessCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	c.access.Read(c.table, seek)
+	return c.Cursor.Seek(seek)
+}
+
+func (c *accessCursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	c.access.Read(c.table, key)
+	return c.Cursor.SeekExact(key)
+}
+
+type accessCursorDupSort struct {
+	*accessCursor
+	dc kv.CursorDupSort
+}
+
+func (c *accessCursorDupSort) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
+	c.access.Read(c.table, key)
+	return c.dc.SeekBothExact(key, value)
+}
+
+func (c *accessCursorDupSort) SeekBothRange(key, value []byte) ([]byte, error) {
+	c.access.Read(c.table, key)
+	return c.dc.SeekBothRange(key, value)
+}
+
+func (c *accessCursorDupSort) FirstDup() ([]byte, error) {
+	c.access.Read(c.table, nil)
+	return c.dc.FirstDup()
+}
+
+func (c *accessCursorDupSort) NextDup() ([]byte, []byte, error)   { return c.read(c.dc.NextDup()) }
+func (c *accessCursorDupSort) NextNoDup() ([]byte, []byte, error) { return c.read(c.dc.NextNoDup()) }
+
+func (c *accessCursorDupSort) LastDup() ([]byte, error) {
+	c.access.Read(c.table, nil)
+	return c.dc.LastDup()
+}
+
+func (c *accessCursorDupSort) CountDuplicates() (uint64, error) { return c.dc.CountDuplicates() }
+
+type cursorWriter struct {
+	rw     kv.RwCursor
+	table  string
+	access *Access
+}
+
+func (c cursorWriter) Put(k, v []byte) error {
+	c.access.Write(c.table, k)
+	return c.rw.Put(k, v)
+}
+
+func (c cursorWriter) Append(k, v []byte) error {
+	c.access.Write(c.table, k)
+	return c.rw.Append(k, v)
+}
+
+func (c cursorWriter) Delete(k, v []byte) error {
+	c.access.Write(c.table, k)
+	return c.rw.Delete(k, v)
+}
+
+func (c cursorWriter) DeleteCurrent() error {
+	c.access.Write(c.table, nil)
+	return c.rw.DeleteCurrent()
+}
+
+type accessRwCursor struct {
+	*accessCursor
+	cursorWriter
+}
+
+type accessRwCursorDupSort struct {
+	*accessCursorDupSort
+	cursorWriter
+	rwd kv.RwCursorDupSort
+}
+
+func (c *accessRwCursorDupSort) DeleteCurrentDuplicates() error {
+	c.access.Write(c.table, nil)
+	return c.rwd.DeleteCurrentDuplicates()
+}
+
+func (c *accessRwCursorDupSort) AppendDup(k, v []byte) error {
+	c.access.Write(c.table, k)
+	return c.rwd.AppendDup(k, v)
+}
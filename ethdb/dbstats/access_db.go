@@ -0,0 +1,189 @@
+package dbstats
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/torquem-ch/mdbx-go/mdbx"
+)
+
+// HasAccess - database which counts accesses
+type HasAccess interface {
+	Access() *Access
+}
+
+// AccessDB - wraps database and counts reads and writes of its transactions, see Access
+type AccessDB struct {
+	kv.RwDB
+	access *Access
+}
+
+func NewAccessDB(db kv.RwDB, access *Access) *AccessDB {
+	return &AccessDB{RwDB: db, access: access}
+}
+
+func (db *AccessDB) Access() *Access { return db.access }
+
+func (db *AccessDB) BeginRo(ctx context.Context) (kv.Tx, error) {
+	tx, err := db.RwDB.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &accessTx{Tx: tx, access: db.access}, nil
+}
+
+func (db *AccessDB) BeginRw(ctx context.Context) (kv.RwTx, error) {
+	tx, err := db.RwDB.BeginRw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &accessRwTx{accessTx: &accessTx{Tx: tx, access: db.access}, rw: tx}, nil
+}
+
+func (db *AccessDB) View(ctx context.Context, f func(tx kv.Tx) error) error {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *AccessDB) Update(ctx context.Context, f func(tx kv.RwTx) error) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type accessTx struct {
+	kv.Tx
+	access *Access
+}
+
+func (tx *accessTx) Has(table string, key []byte) (bool, error) {
+	tx.access.Read(table, key)
+	return tx.Tx.Has(table, key)
+}
+
+func (tx *accessTx) GetOne(table string, key []byte) ([]byte, error) {
+	tx.access.Read(table, key)
+	return tx.Tx.GetOne(table, key)
+}
+
+func (tx *accessTx) ForEach(table string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	return tx.Tx.ForEach(table, fromPrefix, tx.countedWalker(table, walker))
+}
+
+func (tx *accessTx) ForPrefix(table string, prefix []byte, walker func(k, v []byte) error) error {
+	return tx.Tx.ForPrefix(table, prefix, tx.countedWalker(table, walker))
+}
+
+func (tx *accessTx) ForAmount(table string, prefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	return tx.Tx.ForAmount(table, prefix, amount, tx.countedWalker(table, walker))
+}
+
+func (tx *accessTx) countedWalker(table string, walker func(k, v []byte) error) func(k, v []byte) error {
+	return func(k, v []byte) error {
+		tx.access.Read(table, k)
+		return walker(k, v)
+	}
+}
+
+func (tx *accessTx) Cursor(table string) (kv.Cursor, error) {
+	c, err := tx.Tx.Cursor(table)
+	if err != nil {
+		return nil, err
+	}
+	return wrapCursor(c, table, tx.access), nil
+}
+
+func (tx *accessTx) CursorDupSort(table string) (kv.CursorDupSort, error) {
+	c, err := tx.Tx.CursorDupSort(table)
+	if err != nil {
+		return nil, err
+	}
+	return wrapCursor(c, table, tx.access).(kv.CursorDupSort), nil
+}
+
+// ListBuckets and BucketStat - forward MDBX table stats of wrapped transaction, see StatTx
+func (tx *accessTx) ListBuckets() ([]string, error) {
+	stx, ok := tx.Tx.(StatTx)
+	if !ok {
+		return nil, fmt.Errorf("table stats are not supported by %T", tx.Tx)
+	}
+	return stx.ListBuckets()
+}
+
+func (tx *accessTx) BucketStat(name string) (*mdbx.Stat, error) {
+	stx, ok := tx.Tx.(StatTx)
+	if !ok {
+		return nil, fmt.Errorf("table stats are not supported by %T", tx.Tx)
+	}
+	return stx.BucketStat(name)
+}
+
+type accessRwTx struct {
+	*accessTx
+	rw kv.RwTx
+}
+
+func (tx *accessRwTx) Put(table string, k, v []byte) error {
+	tx.access.Write(table, k)
+	return tx.rw.Put(table, k, v)
+}
+
+func (tx *accessRwTx) Delete(table string, k, v []byte) error {
+	tx.access.Write(table, k)
+	return tx.rw.Delete(table, k, v)
+}
+
+func (tx *accessRwTx) Append(table string, k, v []byte) error {
+	tx.access.Write(table, k)
+	return tx.rw.Append(table, k, v)
+}
+
+func (tx *accessRwTx) AppendDup(table string, k, v []byte) error {
+	tx.access.Write(table, k)
+	return tx.rw.AppendDup(table, k, v)
+}
+
+func (tx *accessRwTx) IncrementSequence(table string, amount uint64) (uint64, error) {
+	tx.access.Write(kv.Sequence, []byte(table))
+	return tx.rw.IncrementSequence(table, amount)
+}
+
+func (tx *accessRwTx) ClearBucket(table string) error {
+	tx.access.Write(table, nil)
+	return tx.rw.ClearBucket(table)
+}
+
+func (tx *accessRwTx) DropBucket(table string) error   { return tx.rw.DropBucket(table) }
+func (tx *accessRwTx) CreateBucket(table string) error { return tx.rw.CreateBucket(table) }
+func (tx *accessRwTx) ExistsBucket(table string) (bool, error) {
+	return tx.rw.ExistsBucket(table)
+}
+func (tx *accessRwTx) ListBuckets() ([]string, error) { return tx.rw.ListBuckets() }
+func (tx *accessRwTx) CollectMetrics()                { tx.rw.CollectMetrics() }
+
+func (tx *accessRwTx) RwCursor(table string) (kv.RwCursor, error) {
+	c, err := tx.rw.RwCursor(table)
+	if err != nil {
+		return nil, err
+	}
+	return wrapCursor(c, table, tx.access).(kv.RwCursor), nil
+}
+
+func (tx *accessRwTx) RwCursorDupSort(table string) (kv.RwCursorDupSort, error) {
+	c, err := tx.rw.RwCursorDupSort(table)
+	if err != nil {
+		return nil, err
+	}
+	return wrapCursor(c, table, tx.access).(kv.RwCursorDupSort), nil
+}
@@ -0,0 +1,79 @@
+package dbstats
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccess(t *testing.T) {
+	require := require.New(t)
+	access := NewAccess(1, 2)
+	db := NewAccessDB(memdb.NewTestDB(t), access)
+	find := func(s *AccessStats, name string) TableAccess {
+		for _, t := range s.Tables {
+			if t.Name == name {
+				return t
+			}
+		}
+		return TableAccess{Name: name}
+	}
+
+	require.NoError(db.Update(context.Background(), func(tx kv.RwTx) error {
+		for i := 0; i < 10; i++ {
+			if err := tx.Put(kv.PlainState, []byte{1, 2, byte(i)}, []byte{1}); err != nil {
+				return err
+			}
+		}
+		c, err := tx.RwCursorDupSort(kv.AccountChangeSet)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		return c.AppendDup([]byte{3, 4}, []byte{5})
+	}))
+	require.NoError(db.View(context.Background(), func(tx kv.Tx) error {
+		if _, err := tx.GetOne(kv.PlainState, []byte{1, 2, 0}); err != nil {
+			return err
+		}
+		if err := tx.ForPrefix(kv.PlainState, []byte{1, 2}, func(k, v []byte) error { return nil }); err != nil {
+			return err
+		}
+		// DupSort methods stay available for callers which type-assert cursors
+		c, err := tx.Cursor(kv.AccountChangeSet)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		_, err = c.(kv.CursorDupSort).SeekBothRange([]byte{3, 4}, []byte{5})
+		return err
+	}))
+
+	stats := access.Stats(DefaultHotPrefixes)
+	require.Equal(TableAccess{Name: kv.PlainState, Reads: 11, Writes: 10}, find(stats, kv.PlainState))
+	require.Equal(TableAccess{Name: kv.AccountChangeSet, Reads: 1, Writes: 1}, find(stats, kv.AccountChangeSet))
+	require.Equal(kv.PlainState, stats.Tables[0].Name)
+	require.Equal(uint64(1), stats.SampleRate)
+	require.Equal(HotPrefix{Table: kv.PlainState, Prefix: []byte{1, 2}, Samples: 11}, stats.HotPrefixes[0])
+	require.Equal(HotPrefix{Table: kv.PlainState, Prefix: []byte{1, 2}, Write: true, Samples: 10}, stats.HotPrefixes[1])
+	require.Len(access.Stats(1).HotPrefixes, 1)
+
+	access.Reset()
+	stats = access.Stats(DefaultHotPrefixes)
+	require.Empty(stats.Tables)
+	require.Empty(stats.HotPrefixes)
+}
+
+func TestAccessSamplesBounded(t *testing.T) {
+	access := NewAccess(1, 4)
+	for i := 0; i < 3*maxSampledPrefixes; i++ {
+		access.Read(kv.PlainState, []byte{byte(i >> 8), byte(i)})
+		access.Read(kv.PlainState, []byte{0xff})
+	}
+	stats := access.Stats(maxSampledPrefixes * 2)
+	require.LessOrEqual(t, len(stats.HotPrefixes), maxSampledPrefixes)
+	require.Equal(t, []byte{0xff}, []byte(stats.HotPrefixes[0].Prefix))
+}
@@ -0,0 +1,122 @@
+// Package dbstats - size breakdown of MDBX tables, same numbers as mdbx_stat prints, but available on running node
+package dbstats
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/torquem-ch/mdbx-go/mdbx"
+)
+
+// FreeList - name of MDBX GC table, it holds pages which can be reused by next writes
+const FreeList = "freelist"
+
+// StatTx - implemented by MDBX transactions. Remote transactions don't provide table stats
+type StatTx interface {
+	ListBuckets() ([]string, error)
+	BucketStat(name string) (*mdbx.Stat, error)
+}
+
+type TableStats struct {
+	Name          string `json:"name"`
+	Entries       uint64 `json:"entries"`
+	Depth         uint   `json:"depth"`
+	BranchPages   uint64 `json:"branchPages"`
+	LeafPages     uint64 `json:"leafPages"`
+	OverflowPages uint64 `json:"overflowPages"`
+	Size          uint64 `json:"size"`
+	Growth        int64  `json:"growth"` // bytes since previous call, 0 on first call
+}
+
+type Stats struct {
+	Tables []TableStats `json:"tables"` // sorted by size, biggest first
+	Size   uint64       `json:"size"`   // sum of sizes of all tables, including freelist
+	Since  *time.Time   `json:"since,omitempty"`
+}
+
+// Collect - stats of all tables which exist in DB, plus freelist
+func Collect(tx kv.Tx) ([]TableStats, error) {
+	stx, ok := tx.(StatTx)
+	if !ok {
+		return nil, fmt.Errorf("table stats are not supported by %T, only by local MDBX database", tx)
+	}
+	tables, err := stx.ListBuckets()
+	if err != nil {
+		return nil, err
+	}
+	tables = append(tables, FreeList)
+	res := make([]TableStats, 0, len(tables))
+	for _, name := range tables {
+		st, err := stx.BucketStat(name)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, TableStats{
+			Name:          name,
+			Entries:       st.Entries,
+			Depth:         st.Depth,
+			BranchPages:   st.BranchPages,
+			LeafPages:     st.LeafPages,
+			OverflowPages: st.OverflowPages,
+			Size:          (st.BranchPages + st.LeafPages + st.OverflowPages) * uint64(st.PSize),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Size != res[j].Size {
+			return res[i].Size > res[j].Size
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res, nil
+}
+
+// Snapshot - table sizes at some moment, base for growth calculation
+type Snapshot struct {
+	Time  time.Time         `json:"time"`
+	Sizes map[string]uint64 `json:"sizes"`
+}
+
+// Tracker - remembers sizes of previous call to report growth
+type Tracker struct {
+	lock sync.Mutex
+	last *Snapshot
+}
+
+// NewTracker - last can be nil
+func NewTracker(last *Snapshot) *Tracker {
+	return &Tracker{last: last}
+}
+
+func (t *Tracker) Stats(tx kv.Tx) (*Stats, error) {
+	tables, err := Collect(tx)
+	if err != nil {
+		return nil, err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	res := &Stats{Tables: tables}
+	snapshot := &Snapshot{Time: time.Now(), Sizes: make(map[string]uint64, len(tables))}
+	for i := range tables {
+		res.Size += tables[i].Size
+		snapshot.Sizes[tables[i].Name] = tables[i].Size
+		if t.last != nil {
+			tables[i].Growth = int64(tables[i].Size) - int64(t.last.Sizes[tables[i].Name])
+		}
+	}
+	if t.last != nil {
+		since := t.last.Time
+		res.Since = &since
+	}
+	t.last = snapshot
+	return res, nil
+}
+
+// Last - snapshot of previous call, nil if there were no calls
+func (t *Tracker) Last() *Snapshot {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.last
+}
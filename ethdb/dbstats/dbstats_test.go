@@ -0,0 +1,54 @@
+package dbstats
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracker(t *testing.T) {
+	require := require.New(t)
+	db := memdb.NewTestDB(t)
+	tracker := NewTracker(nil)
+	stats := func() *Stats {
+		var res *Stats
+		require.NoError(db.View(context.Background(), func(tx kv.Tx) (err error) {
+			res, err = tracker.Stats(tx)
+			return err
+		}))
+		return res
+	}
+	find := func(s *Stats, name string) TableStats {
+		for _, t := range s.Tables {
+			if t.Name == name {
+				return t
+			}
+		}
+		t.Fatalf("table %s not found", name)
+		return TableStats{}
+	}
+
+	first := stats()
+	require.Nil(first.Since)
+	require.Zero(find(first, kv.PlainState).Entries)
+	find(first, FreeList)
+
+	require.NoError(db.Update(context.Background(), func(tx kv.RwTx) error {
+		for i := 0; i < 1000; i++ {
+			if err := tx.Put(kv.PlainState, []byte{byte(i >> 8), byte(i)}, make([]byte, 100)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	second := stats()
+	require.NotNil(second.Since)
+	plainState := find(second, kv.PlainState)
+	require.Equal(uint64(1000), plainState.Entries)
+	require.Equal(int64(plainState.Size-find(first, kv.PlainState).Size), plainState.Growth)
+	require.Greater(plainState.Growth, int64(0))
+	require.Equal(kv.PlainState, second.Tables[0].Name)
+}
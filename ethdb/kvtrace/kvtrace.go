@@ -0,0 +1,107 @@
+// Package kvtrace - wraps database: read transactions opened inside of traced request are recorded as child spans
+// "db.read", with amount of gets and cursors, see otel.StartChild
+package kvtrace
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common/otel"
+	"github.com/ledgerwatch/erigon/ethdb/dbstats"
+	"github.com/torquem-ch/mdbx-go/mdbx"
+)
+
+type DB struct {
+	kv.RwDB
+	name string
+}
+
+func New(db kv.RwDB, name string) *DB { return &DB{RwDB: db, name: name} }
+
+func (db *DB) BeginRo(ctx context.Context) (kv.Tx, error) {
+	_, span := otel.StartChild(ctx, otel.KindClient, "db.read", otel.String("db.system", "mdbx"), otel.String("db.name", db.name))
+	tx, err := db.RwDB.BeginRo(ctx)
+	if err != nil {
+		span.SetError(err)
+		span.Finish()
+		return nil, err
+	}
+	if span == nil {
+		return tx, nil
+	}
+	return &roTx{Tx: tx, span: span}, nil
+}
+
+func (db *DB) View(ctx context.Context, f func(tx kv.Tx) error) error {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+type roTx struct {
+	kv.Tx
+	span    *otel.Span
+	gets    int64
+	cursors int64
+	done    bool
+}
+
+func (tx *roTx) finish() {
+	if tx.done {
+		return
+	}
+	tx.done = true
+	tx.span.SetAttrs(otel.Int("db.gets", tx.gets), otel.Int("db.cursors", tx.cursors))
+	tx.span.Finish()
+}
+
+func (tx *roTx) Commit() error {
+	defer tx.finish()
+	return tx.Tx.Commit()
+}
+
+func (tx *roTx) Rollback() {
+	defer tx.finish()
+	tx.Tx.Rollback()
+}
+
+func (tx *roTx) Has(table string, key []byte) (bool, error) {
+	tx.gets++
+	return tx.Tx.Has(table, key)
+}
+
+func (tx *roTx) GetOne(table string, key []byte) ([]byte, error) {
+	tx.gets++
+	return tx.Tx.GetOne(table, key)
+}
+
+func (tx *roTx) Cursor(table string) (kv.Cursor, error) {
+	tx.cursors++
+	return tx.Tx.Cursor(table)
+}
+
+func (tx *roTx) CursorDupSort(table string) (kv.CursorDupSort, error) {
+	tx.cursors++
+	return tx.Tx.CursorDupSort(table)
+}
+
+// ListBuckets and BucketStat - forward MDBX table stats of wrapped transaction, see dbstats.StatTx
+func (tx *roTx) ListBuckets() ([]string, error) {
+	stx, ok := tx.Tx.(dbstats.StatTx)
+	if !ok {
+		return nil, fmt.Errorf("table stats are not supported by %T", tx.Tx)
+	}
+	return stx.ListBuckets()
+}
+
+func (tx *roTx) BucketStat(name string) (*mdbx.Stat, error) {
+	stx, ok := tx.Tx.(dbstats.StatTx)
+	if !ok {
+		return nil, fmt.Errorf("table stats are not supported by %T", tx.Tx)
+	}
+	return stx.BucketStat(name)
+}
@@ -0,0 +1,242 @@
+package kvwatchdog
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/ethdb/dbstats"
+	"github.com/torquem-ch/mdbx-go/mdbx"
+)
+
+type roTx struct {
+	kv.Tx
+	db     *DB
+	id     uint64
+	reader *reader
+}
+
+func (tx *roTx) Commit() error {
+	defer tx.db.done(tx.id)
+	return tx.Tx.Commit()
+}
+
+func (tx *roTx) Rollback() {
+	defer tx.db.done(tx.id)
+	tx.Tx.Rollback()
+}
+
+func (tx *roTx) cancelled() bool {
+	return atomic.LoadUint32(&tx.reader.cancelled) == 1
+}
+
+func (tx *roTx) Has(bucket string, key []byte) (bool, error) {
+	if tx.cancelled() {
+		return false, ErrCancelled
+	}
+	return tx.Tx.Has(bucket, key)
+}
+
+func (tx *roTx) GetOne(bucket string, key []byte) ([]byte, error) {
+	if tx.cancelled() {
+		return nil, ErrCancelled
+	}
+	return tx.Tx.GetOne(bucket, key)
+}
+
+func (tx *roTx) ForEach(bucket string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	return tx.Tx.ForEach(bucket, fromPrefix, tx.checkedWalker(walker))
+}
+
+func (tx *roTx) ForPrefix(bucket string, prefix []byte, walker func(k, v []byte) error) error {
+	return tx.Tx.ForPrefix(bucket, prefix, tx.checkedWalker(walker))
+}
+
+func (tx *roTx) ForAmount(bucket string, prefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	return tx.Tx.ForAmount(bucket, prefix, amount, tx.checkedWalker(walker))
+}
+
+func (tx *roTx) checkedWalker(walker func(k, v []byte) error) func(k, v []byte) error {
+	if !tx.db.cancel {
+		return walker
+	}
+	return func(k, v []byte) error {
+		if tx.cancelled() {
+			return ErrCancelled
+		}
+		return walker(k, v)
+	}
+}
+
+func (tx *roTx) Cursor(bucket string) (kv.Cursor, error) {
+	c, err := tx.Tx.Cursor(bucket)
+	if err != nil || !tx.db.cancel {
+		return c, err
+	}
+	// keep DupSort methods available: callers may type-assert cursors of DupSort tables
+	if dc, ok := c.(kv.CursorDupSort); ok {
+		return &cursorDupSort{CursorDupSort: dc, tx: tx}, nil
+	}
+	return &cursor{Cursor: c, tx: tx}, nil
+}
+
+func (tx *roTx) CursorDupSort(bucket string) (kv.CursorDupSort, error) {
+	c, err := tx.Tx.CursorDupSort(bucket)
+	if err != nil || !tx.db.cancel {
+		return c, err
+	}
+	return &cursorDupSort{CursorDupSort: c, tx: tx}, nil
+}
+
+type cursor struct {
+	kv.Cursor
+	tx *roTx
+}
+
+func (c *cursor) First() ([]byte, []byte, error) {
+	if c.tx.cancelled() {
+		return nil, nil, ErrCancelled
+	}
+	return c.Cursor.First()
+}
+
+func (c *cursor) Seek(seek []byte) ([]byte, []byte, error) {
+	if c.tx.cancelled() {
+		return nil, nil, ErrCancelled
+	}
+	return c.Cursor.Seek(seek)
+}
+
+func (c *cursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	if c.tx.cancelled() {
+		return nil, nil, ErrCancelled
+	}
+	return c.Cursor.SeekExact(key)
+}
+
+func (c *cursor) Next() ([]byte, []byte, error) {
+	if c.tx.cancelled() {
+		return nil, nil, ErrCancelled
+	}
+	return c.Cursor.Next()
+}
+
+func (c *cursor) Prev() ([]byte, []byte, error) {
+	if c.tx.cancelled() {
+		return nil, nil, ErrCancelled
+	}
+	return c.Cursor.Prev()
+}
+
+func (c *cursor) Last() ([]byte, []byte, error) {
+	if c.tx.cancelled() {
+		return nil, nil, ErrCancelled
+	}
+	return c.Cursor.Last()
+}
+
+type cursorDupSort struct {
+	kv.CursorDupSort
+	tx *roTx
+}
+
+func (c *cursorDupSort) First() ([]byte, []byte, error) {
+	if c.tx.cancelled() {
+		return nil, nil, ErrCancelled
+	}
+	return c.CursorDupSort.First()
+}
+
+func (c *cursorDupSort) Seek(seek []byte) ([]byte, []byte, error) {
+	if c.tx.cancelled() {
+		return nil, nil, ErrCancelled
+	}
+	return c.CursorDupSort.Seek(seek)
+}
+
+func (c *cursorDupSort) SeekExact(key []byte) ([]byte, []byte, error) {
+	if c.tx.cancelled() {
+		return nil, nil, ErrCancelled
+	}
+	return c.CursorDupSort.SeekExact(key)
+}
+
+func (c *cursorDupSort) Next() ([]byte, []byte, error) {
+	if c.tx.cancelled() {
+		return nil, nil, ErrCancelled
+	}
+	return c.CursorDupSort.Next()
+}
+
+func (c *cursorDupSort) Prev() ([]byte, []byte, error) {
+	if c.tx.cancelled() {
+		return nil, nil, ErrCancelled
+	}
+	return c.CursorDupSort.Prev()
+}
+
+func (c *cursorDupSort) Last() ([]byte, []byte, error) {
+	if c.tx.cancelled() {
+		return nil, nil, ErrCancelled
+	}
+	return c.CursorDupSort.Last()
+}
+
+func (c *cursorDupSort) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
+	if c.tx.cancelled() {
+		return nil, nil, ErrCancelled
+	}
+	return c.CursorDupSort.SeekBothExact(key, value)
+}
+
+func (c *cursorDupSort) SeekBothRange(key, value []byte) ([]byte, error) {
+	if c.tx.cancelled() {
+		return nil, ErrCancelled
+	}
+	return c.CursorDupSort.SeekBothRange(key, value)
+}
+
+func (c *cursorDupSort) FirstDup() ([]byte, error) {
+	if c.tx.cancelled() {
+		return nil, ErrCancelled
+	}
+	return c.CursorDupSort.FirstDup()
+}
+
+func (c *cursorDupSort) NextDup() ([]byte, []byte, error) {
+	if c.tx.cancelled() {
+		return nil, nil, ErrCancelled
+	}
+	return c.CursorDupSort.NextDup()
+}
+
+func (c *cursorDupSort) NextNoDup() ([]byte, []byte, error) {
+	if c.tx.cancelled() {
+		return nil, nil, ErrCancelled
+	}
+	return c.CursorDupSort.NextNoDup()
+}
+
+func (c *cursorDupSort) LastDup() ([]byte, error) {
+	if c.tx.cancelled() {
+		return nil, ErrCancelled
+	}
+	return c.CursorDupSort.LastDup()
+}
+
+// ListBuckets and BucketStat - forward MDBX table stats of wrapped transaction, see dbstats.StatTx
+func (tx *roTx) ListBuckets() ([]string, error) {
+	stx, ok := tx.Tx.(dbstats.StatTx)
+	if !ok {
+		return nil, fmt.Errorf("table stats are not supported by %T", tx.Tx)
+	}
+	return stx.ListBuckets()
+}
+
+func (tx *roTx) BucketStat(name string) (*mdbx.Stat, error) {
+	stx, ok := tx.Tx.(dbstats.StatTx)
+	if !ok {
+		return nil, fmt.Errorf("table stats are not supported by %T", tx.Tx)
+	}
+	return stx.BucketStat(name)
+}
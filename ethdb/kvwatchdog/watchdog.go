@@ -0,0 +1,183 @@
+// Package kvwatchdog tracks age of read transactions. MDBX can't reuse pages freed after start of oldest read
+// transaction, so long reader makes database file grow.
+package kvwatchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common/reqlabel"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// ErrCancelled - returned by reads of transaction which was open longer than threshold, if cancellation is enabled
+var ErrCancelled = errors.New("read transaction cancelled: open longer than threshold")
+
+const maxStackDepth = 32
+
+// DB - wraps database and watches its read transactions. Transactions open longer than threshold are logged (once)
+// with stack of goroutine which opened them and label of RPC call, if any (see reqlabel). If cancel is set, reads of such transactions return ErrCancelled -
+// it's for RPC queries, which can be retried by client. Must not be used for database of sync stages.
+// Metrics are labeled by chain and name of database: one process can run nodes of several chains (see --networks).
+type DB struct {
+	kv.RwDB
+	chain     string
+	name      string
+	threshold time.Duration
+	cancel    bool
+
+	lock    sync.Mutex
+	readers map[uint64]*reader
+	nextID  uint64
+	oldest  int64 // nanoseconds, age of oldest read transaction at last check
+
+	longReaders      *metrics.Counter
+	cancelledReaders *metrics.Counter
+	oldestGauge      string
+	quit             chan struct{}
+	wg               sync.WaitGroup
+}
+
+type reader struct {
+	started   time.Time
+	pcs       []uintptr
+	label     reqlabel.Label // RPC call which opened transaction, if known
+	reported  bool
+	cancelled uint32
+}
+
+func New(db kv.RwDB, chain, name string, threshold time.Duration, cancel bool) *DB {
+	w := &DB{
+		RwDB:             db,
+		chain:            chain,
+		name:             name,
+		threshold:        threshold,
+		cancel:           cancel,
+		readers:          map[uint64]*reader{},
+		longReaders:      metrics.GetOrCreateCounter(fmt.Sprintf(`db_long_read_tx{chain="%s",db="%s"}`, chain, name)),
+		cancelledReaders: metrics.GetOrCreateCounter(fmt.Sprintf(`db_long_read_tx_cancelled{chain="%s",db="%s"}`, chain, name)),
+		oldestGauge:      fmt.Sprintf(`db_oldest_read_tx_seconds{chain="%s",db="%s"}`, chain, name),
+		quit:             make(chan struct{}),
+	}
+	metrics.GetOrCreateGauge(w.oldestGauge, func() float64 {
+		return time.Duration(atomic.LoadInt64(&w.oldest)).Seconds()
+	})
+	w.wg.Add(1)
+	go w.loop()
+	return w
+}
+
+func (w *DB) loop() {
+	defer w.wg.Done()
+	interval := w.threshold / 2
+	if interval > 10*time.Second {
+		interval = 10 * time.Second
+	}
+	if interval <= 0 {
+		interval = w.threshold
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.quit:
+			return
+		case now := <-ticker.C:
+			w.check(now)
+		}
+	}
+}
+
+// check - updates age of oldest reader, reports and cancels readers which are older than threshold
+func (w *DB) check(now time.Time) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	var oldest time.Duration
+	for _, r := range w.readers {
+		age := now.Sub(r.started)
+		if age > oldest {
+			oldest = age
+		}
+		if age < w.threshold || r.reported {
+			continue
+		}
+		r.reported = true
+		w.longReaders.Inc()
+		if w.cancel {
+			atomic.StoreUint32(&r.cancelled, 1)
+			w.cancelledReaders.Inc()
+		}
+		holder, stack := describe(r.pcs)
+		logCtx := append([]interface{}{"chain", w.chain, "db", w.name, "age", age, "holder", holder, "cancelled", w.cancel}, r.label.LogCtx()...)
+		log.Warn("[db] long read transaction", append(logCtx, "stack", stack)...)
+	}
+	atomic.StoreInt64(&w.oldest, int64(oldest))
+}
+
+// OldestReaderAge - age of oldest read transaction at last check
+func (w *DB) OldestReaderAge() time.Duration {
+	return time.Duration(atomic.LoadInt64(&w.oldest))
+}
+
+func (w *DB) BeginRo(ctx context.Context) (kv.Tx, error) {
+	tx, err := w.RwDB.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pcs := make([]uintptr, maxStackDepth)
+	r := &reader{started: time.Now(), pcs: pcs[:runtime.Callers(2, pcs)]}
+	r.label, _ = reqlabel.From(ctx)
+	w.lock.Lock()
+	id := w.nextID
+	w.nextID++
+	w.readers[id] = r
+	w.lock.Unlock()
+	return &roTx{Tx: tx, db: w, id: id, reader: r}, nil
+}
+
+func (w *DB) View(ctx context.Context, f func(tx kv.Tx) error) error {
+	tx, err := w.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (w *DB) Close() {
+	close(w.quit)
+	w.wg.Wait()
+	metrics.UnregisterMetric(w.oldestGauge)
+	w.RwDB.Close()
+}
+
+func (w *DB) done(id uint64) {
+	w.lock.Lock()
+	delete(w.readers, id)
+	w.lock.Unlock()
+}
+
+// describe - returns first function outside of this package (holder of transaction) and formatted stack
+func describe(pcs []uintptr) (holder string, stack string) {
+	var sb strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if holder == "" && !strings.Contains(frame.Function, "/ethdb/kvwatchdog.") {
+			holder = frame.Function
+		}
+		fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return holder, sb.String()
+}
@@ -0,0 +1,82 @@
+package kvwatchdog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common/reqlabel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLongReader(t *testing.T) {
+	require := require.New(t)
+	for _, cancel := range []bool{false, true} {
+		db := New(memdb.New(), "test", "test", time.Minute, cancel)
+		require.NoError(db.Update(context.Background(), func(tx kv.RwTx) error {
+			for _, k := range []string{"a", "b", "c"} {
+				if err := tx.Put(kv.PlainState, []byte(k), []byte(k)); err != nil {
+					return err
+				}
+			}
+			return tx.Put(kv.AccountChangeSet, []byte("a"), []byte("a"))
+		}))
+
+		tx, err := db.BeginRo(context.Background())
+		require.NoError(err)
+		c, err := tx.Cursor(kv.PlainState)
+		require.NoError(err)
+		_, _, err = c.First()
+		require.NoError(err)
+		dc, err := tx.Cursor(kv.AccountChangeSet)
+		require.NoError(err)
+		_, isDupSort := dc.(kv.CursorDupSort)
+		require.True(isDupSort)
+
+		db.check(time.Now())
+		require.Less(db.OldestReaderAge(), time.Minute)
+		_, _, err = c.Next()
+		require.NoError(err)
+
+		db.check(time.Now().Add(time.Hour))
+		require.Greater(db.OldestReaderAge(), time.Minute)
+		_, _, err = c.Next()
+		_, errGet := tx.GetOne(kv.PlainState, []byte("a"))
+		if cancel {
+			require.ErrorIs(err, ErrCancelled)
+			require.ErrorIs(errGet, ErrCancelled)
+		} else {
+			require.NoError(err)
+			require.NoError(errGet)
+		}
+		tx.Rollback()
+
+		db.check(time.Now().Add(time.Hour))
+		require.Zero(db.OldestReaderAge())
+		db.Close()
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	db := New(memdb.New(), "test", "test", time.Minute, false)
+	defer db.Close()
+	require.NoError(t, db.View(context.Background(), func(tx kv.Tx) error {
+		holder, stack := describe(tx.(*roTx).reader.pcs)
+		// test itself is in watchdog package
+		require.Equal(t, "testing.tRunner", holder)
+		require.Contains(t, stack, "kvwatchdog.TestDescribe")
+		return nil
+	}))
+}
+
+func TestReaderLabel(t *testing.T) {
+	db := New(memdb.New(), "test", "test", time.Minute, false)
+	defer db.Close()
+	l := reqlabel.Label{ID: "abc-1", Method: "eth_getLogs", Client: "10.0.0.1:80"}
+	tx, err := db.BeginRo(reqlabel.With(context.Background(), l))
+	require.NoError(t, err)
+	defer tx.Rollback()
+	require.Equal(t, l, tx.(*roTx).reader.label)
+}
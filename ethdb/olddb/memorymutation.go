@@ -0,0 +1,410 @@
+package olddb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+)
+
+// memorymutation - overlay over read transaction: writes go to in-memory MDBX, deletes are remembered as tombstones,
+// reads and cursors merge both layers. Base transaction is never modified, changes can be written by Flush.
+type memorymutation struct {
+	db     kv.Tx
+	memDb  kv.RwDB
+	memTx  kv.RwTx
+	gen    uint64 // incremented by each write, cursors re-position overlay layer when it changes
+	closed bool
+
+	clearedTables  map[string]struct{}
+	deletedEntries map[string]map[string]struct{}            // table -> key
+	deletedDups    map[string]map[string]map[string]struct{} // DupSort table -> key -> value
+}
+
+// NewMemoryBatch - starts overlay over tx, it allows to execute blocks (for example payloads beyond canonical head)
+// or apply state overrides without writing to the DB.
+//
+// Common pattern:
+//
+// batch := NewMemoryBatch(tx)
+// defer batch.Rollback()
+// ... some calculations on `batch`
+// batch.Flush(rwTx) // optional
+//
+// Like any MDBX write transaction, it must be used by one goroutine. Rollback doesn't rollback tx.
+func NewMemoryBatch(tx kv.Tx) *memorymutation {
+	memDb := memdb.New()
+	memTx, err := memDb.BeginRw(context.Background())
+	if err != nil {
+		memDb.Close()
+		panic(err)
+	}
+	return &memorymutation{
+		db:             tx,
+		memDb:          memDb,
+		memTx:          memTx,
+		clearedTables:  map[string]struct{}{},
+		deletedEntries: map[string]map[string]struct{}{},
+		deletedDups:    map[string]map[string]map[string]struct{}{},
+	}
+}
+
+// isDupSort - tables with AutoDupSortKeysConversion look like usual tables for cursors, MDBX does conversion
+func isDupSort(table string) bool {
+	cfg := kv.ChaindataTablesCfg[table]
+	return cfg.Flags&kv.DupSort != 0 && !cfg.AutoDupSortKeysConversion
+}
+
+// isHidden - entry of base transaction is deleted or table is cleared in overlay
+func (m *memorymutation) isHidden(table string, k, v []byte) bool {
+	if _, ok := m.clearedTables[table]; ok {
+		return true
+	}
+	if _, ok := m.deletedEntries[table][string(k)]; ok {
+		return true
+	}
+	if v == nil || !isDupSort(table) {
+		return false
+	}
+	_, ok := m.deletedDups[table][string(k)][string(v)]
+	return ok
+}
+
+func (m *memorymutation) ViewID() uint64 { return m.db.ViewID() }
+
+func (m *memorymutation) GetOne(table string, key []byte) ([]byte, error) {
+	if isDupSort(table) {
+		c, err := m.Cursor(table)
+		if err != nil {
+			return nil, err
+		}
+		defer c.Close()
+		_, v, err := c.SeekExact(key)
+		return v, err
+	}
+	v, err := m.memTx.GetOne(table, key)
+	if err != nil {
+		return nil, err
+	}
+	if v != nil {
+		return v, nil
+	}
+	if has, err := m.memTx.Has(table, key); err != nil || has {
+		return v, err
+	}
+	if m.isHidden(table, key, nil) {
+		return nil, nil
+	}
+	return m.db.GetOne(table, key)
+}
+
+func (m *memorymutation) Has(table string, key []byte) (bool, error) {
+	if isDupSort(table) {
+		c, err := m.Cursor(table)
+		if err != nil {
+			return false, err
+		}
+		defer c.Close()
+		k, _, err := c.SeekExact(key)
+		return k != nil, err
+	}
+	if has, err := m.memTx.Has(table, key); err != nil || has {
+		return has, err
+	}
+	if m.isHidden(table, key, nil) {
+		return false, nil
+	}
+	return m.db.Has(table, key)
+}
+
+func (m *memorymutation) ReadSequence(table string) (uint64, error) {
+	v, err := m.GetOne(kv.Sequence, []byte(table))
+	if err != nil {
+		return 0, err
+	}
+	if len(v) == 0 {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+func (m *memorymutation) IncrementSequence(table string, amount uint64) (uint64, error) {
+	current, err := m.ReadSequence(table)
+	if err != nil {
+		return 0, err
+	}
+	newV := make([]byte, 8)
+	binary.BigEndian.PutUint64(newV, current+amount)
+	if err := m.Put(kv.Sequence, []byte(table), newV); err != nil {
+		return 0, err
+	}
+	return current, nil
+}
+
+func (m *memorymutation) Put(table string, k, v []byte) error {
+	m.gen++
+	if isDupSort(table) {
+		if dups, ok := m.deletedDups[table][string(k)]; ok {
+			delete(dups, string(v))
+		}
+	}
+	return m.memTx.Put(table, k, v)
+}
+
+func (m *memorymutation) Append(table string, k, v []byte) error {
+	// overlay layer may already have greater keys
+	return m.Put(table, k, v)
+}
+
+func (m *memorymutation) AppendDup(table string, k, v []byte) error {
+	return m.Put(table, k, v)
+}
+
+// Delete - v is used only by DupSort tables, nil v deletes all values of key
+func (m *memorymutation) Delete(table string, k, v []byte) error {
+	m.gen++
+	if v == nil || !isDupSort(table) {
+		if _, ok := m.deletedEntries[table]; !ok {
+			m.deletedEntries[table] = map[string]struct{}{}
+		}
+		m.deletedEntries[table][string(k)] = struct{}{}
+		if isDupSort(table) {
+			return deleteAllDups(m.memTx, table, k)
+		}
+		return m.memTx.Delete(table, k, nil)
+	}
+	if _, ok := m.deletedDups[table]; !ok {
+		m.deletedDups[table] = map[string]map[string]struct{}{}
+	}
+	if _, ok := m.deletedDups[table][string(k)]; !ok {
+		m.deletedDups[table][string(k)] = map[string]struct{}{}
+	}
+	m.deletedDups[table][string(k)][string(v)] = struct{}{}
+	return deleteDup(m.memTx, table, k, v)
+}
+
+// deleteDup - MDBX Delete(table, k, v) and SeekBothExact of not existing value find next value of k
+func deleteDup(tx kv.RwTx, table string, k, v []byte) error {
+	c, err := tx.RwCursorDupSort(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	found, foundV, err := c.SeekBothExact(k, v)
+	if err != nil || found == nil || !bytes.Equal(foundV, v) {
+		return err
+	}
+	return c.DeleteCurrent()
+}
+
+// deleteAllDups - Delete(table, k, nil) deletes only empty value of DupSort key
+func deleteAllDups(tx kv.RwTx, table string, k []byte) error {
+	c, err := tx.RwCursorDupSort(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	found, _, err := c.SeekExact(k)
+	if err != nil || found == nil {
+		return err
+	}
+	return c.DeleteCurrentDuplicates()
+}
+
+func (m *memorymutation) ForEach(table string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	c, err := m.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for k, v, err := c.Seek(fromPrefix); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memorymutation) ForPrefix(table string, prefix []byte, walker func(k, v []byte) error) error {
+	c, err := m.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for k, v, err := c.Seek(prefix); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(k, prefix) {
+			break
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memorymutation) ForAmount(table string, prefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	if amount == 0 {
+		return nil
+	}
+	c, err := m.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for k, v, err := c.Seek(prefix); k != nil && amount > 0; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+		amount--
+	}
+	return nil
+}
+
+func (m *memorymutation) BucketSize(table string) (uint64, error) { return m.db.BucketSize(table) }
+
+func (m *memorymutation) ClearBucket(table string) error {
+	m.gen++
+	m.clearedTables[table] = struct{}{}
+	delete(m.deletedEntries, table)
+	delete(m.deletedDups, table)
+	return m.memTx.ClearBucket(table)
+}
+
+func (m *memorymutation) DropBucket(table string) error { return m.ClearBucket(table) }
+
+func (m *memorymutation) CreateBucket(string) error { return nil }
+
+func (m *memorymutation) ExistsBucket(table string) (bool, error) {
+	if migrator, ok := m.db.(kv.BucketMigrator); ok {
+		return migrator.ExistsBucket(table)
+	}
+	_, ok := kv.ChaindataTablesCfg[table]
+	return ok, nil
+}
+
+func (m *memorymutation) ListBuckets() ([]string, error) {
+	if migrator, ok := m.db.(kv.BucketMigrator); ok {
+		return migrator.ListBuckets()
+	}
+	return kv.ChaindataTables, nil
+}
+
+func (m *memorymutation) CollectMetrics() {}
+
+func (m *memorymutation) Cursor(table string) (kv.Cursor, error) {
+	return m.newCursor(table)
+}
+
+func (m *memorymutation) CursorDupSort(table string) (kv.CursorDupSort, error) {
+	return m.RwCursorDupSort(table)
+}
+
+func (m *memorymutation) RwCursor(table string) (kv.RwCursor, error) {
+	return m.newCursor(table)
+}
+
+// RwCursorDupSort - for tables with AutoDupSortKeysConversion returns cursor which splits keys like MDBX does,
+// for other not DupSort tables dup methods treat every key as having one value
+func (m *memorymutation) RwCursorDupSort(table string) (kv.RwCursorDupSort, error) {
+	c, err := m.newCursor(table)
+	if err != nil {
+		return nil, err
+	}
+	if cfg := kv.ChaindataTablesCfg[table]; cfg.AutoDupSortKeysConversion {
+		return &autoDupSortCursor{memoryMutationCursor: c, keyLen: cfg.DupToLen, fullKeyLen: cfg.DupFromLen}, nil
+	}
+	return c, nil
+}
+
+func (m *memorymutation) newCursor(table string) (*memoryMutationCursor, error) {
+	c := &memoryMutationCursor{mutation: m, table: table, dupSort: isDupSort(table), gen: m.gen}
+	var err error
+	if c.dupSort {
+		if c.base.dc, err = m.db.CursorDupSort(table); err != nil {
+			return nil, err
+		}
+		c.base.c = c.base.dc
+		if c.mem.dc, err = m.memTx.RwCursorDupSort(table); err != nil {
+			c.base.c.Close()
+			return nil, err
+		}
+		c.mem.c = c.mem.dc
+	} else {
+		if c.base.c, err = m.db.Cursor(table); err != nil {
+			return nil, err
+		}
+		if c.mem.c, err = m.memTx.Cursor(table); err != nil {
+			c.base.c.Close()
+			return nil, err
+		}
+	}
+	c.base.hidden = func(k, v []byte) bool { return m.isHidden(table, k, v) }
+	return c, nil
+}
+
+// Flush - writes overlay into tx (it can be transaction on which overlay was started)
+func (m *memorymutation) Flush(tx kv.RwTx) error {
+	for table := range m.clearedTables {
+		if err := tx.ClearBucket(table); err != nil {
+			return err
+		}
+	}
+	for table, keys := range m.deletedEntries {
+		for k := range keys {
+			var err error
+			if isDupSort(table) {
+				err = deleteAllDups(tx, table, []byte(k))
+			} else {
+				err = tx.Delete(table, []byte(k), nil)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for table, keys := range m.deletedDups {
+		for k, values := range keys {
+			for v := range values {
+				if err := deleteDup(tx, table, []byte(k), []byte(v)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, table := range kv.ChaindataTables {
+		if err := m.memTx.ForEach(table, nil, func(k, v []byte) error {
+			return tx.Put(table, k, v)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit - overlay can't be committed, changes are discarded. Use Flush to write them
+func (m *memorymutation) Commit() error {
+	m.Rollback()
+	return fmt.Errorf("memory mutation can't be committed, use Flush")
+}
+
+// Rollback - discards overlay, base transaction stays open
+func (m *memorymutation) Rollback() {
+	if m.closed {
+		return
+	}
+	m.closed = true
+	m.memTx.Rollback()
+	m.memDb.Close()
+}
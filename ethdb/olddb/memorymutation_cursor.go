@@ -0,0 +1,531 @@
+package olddb
+
+import (
+	"bytes"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// cursorLayer - cursor of one layer of memorymutation and its current entry, nil k - layer is exhausted
+type cursorLayer struct {
+	c      kv.Cursor
+	dc     kv.CursorDupSort // nil for not DupSort tables
+	k, v   []byte
+	hidden func(k, v []byte) bool // nil for overlay layer
+}
+
+// skip - stores entry, skipping hidden entries by move
+func (l *cursorLayer) skip(k, v []byte, err error, move func() ([]byte, []byte, error)) error {
+	for err == nil && k != nil && l.hidden != nil && l.hidden(k, v) {
+		k, v, err = move()
+	}
+	if err != nil {
+		return err
+	}
+	l.k, l.v = k, v
+	return nil
+}
+
+func (l *cursorLayer) first() error {
+	k, v, err := l.c.First()
+	return l.skip(k, v, err, l.c.Next)
+}
+
+func (l *cursorLayer) last() error {
+	k, v, err := l.c.Last()
+	return l.skip(k, v, err, l.c.Prev)
+}
+
+func (l *cursorLayer) next() error {
+	k, v, err := l.c.Next()
+	return l.skip(k, v, err, l.c.Next)
+}
+
+func (l *cursorLayer) prev() error {
+	k, v, err := l.c.Prev()
+	return l.skip(k, v, err, l.c.Prev)
+}
+
+// seek - first entry >= (k, v). v is used only by DupSort tables, nil v - first value of key
+func (l *cursorLayer) seek(k, v []byte) error {
+	foundK, foundV, err := l.c.Seek(k)
+	if err != nil || l.dc == nil || v == nil || !bytes.Equal(foundK, k) {
+		return l.skip(foundK, foundV, err, l.c.Next)
+	}
+	if foundV, err = l.dc.SeekBothRange(k, v); err != nil {
+		return err
+	}
+	if foundV != nil {
+		return l.skip(k, foundV, nil, l.c.Next)
+	}
+	// all values of k are less than v
+	if _, _, err = l.c.Seek(k); err != nil {
+		return err
+	}
+	foundK, foundV, err = l.dc.NextNoDup()
+	return l.skip(foundK, foundV, err, l.c.Next)
+}
+
+// seekNextKey - first entry with key > k
+func (l *cursorLayer) seekNextKey(k []byte) error {
+	if err := l.seek(k, nil); err != nil {
+		return err
+	}
+	if l.k == nil || !bytes.Equal(l.k, k) {
+		return nil
+	}
+	if l.dc == nil {
+		return l.next()
+	}
+	foundK, foundV, err := l.dc.NextNoDup()
+	return l.skip(foundK, foundV, err, l.c.Next)
+}
+
+// memoryMutationCursor - merges cursors of base transaction and overlay. Entries of overlay win on equal keys
+// (on equal key and value for DupSort tables). Like MDBX merging iterators, both layers are positioned on entries
+// >= current one when cursor moves forward, and <= current one when it moves backward.
+type memoryMutationCursor struct {
+	mutation *memorymutation
+	table    string
+	dupSort  bool
+	gen      uint64
+
+	base, mem cursorLayer
+
+	k, v        []byte // current entry, copied if it belongs to overlay - writes invalidate its memory
+	positioned  bool
+	forward     bool
+	afterDelete bool // current entry was deleted, layers are positioned after it
+}
+
+func (c *memoryMutationCursor) cmp(k1, v1, k2, v2 []byte) int {
+	if r := bytes.Compare(k1, k2); r != 0 || !c.dupSort {
+		return r
+	}
+	return bytes.Compare(v1, v2)
+}
+
+// choose - next entry of merged view in direction of cursor
+func (c *memoryMutationCursor) choose() (k, v []byte, fromMem bool) {
+	switch {
+	case c.base.k == nil && c.mem.k == nil:
+		return nil, nil, false
+	case c.base.k == nil:
+		return c.mem.k, c.mem.v, true
+	case c.mem.k == nil:
+		return c.base.k, c.base.v, false
+	}
+	r := c.cmp(c.base.k, c.base.v, c.mem.k, c.mem.v)
+	if (c.forward && r < 0) || (!c.forward && r > 0) {
+		return c.base.k, c.base.v, false
+	}
+	return c.mem.k, c.mem.v, true
+}
+
+func (c *memoryMutationCursor) pick() ([]byte, []byte, error) {
+	k, v, fromMem := c.choose()
+	if fromMem {
+		k, v = common.Copy(k), common.Copy(v)
+	}
+	c.k, c.v = k, v
+	c.positioned = true
+	c.afterDelete = false
+	return k, v, nil
+}
+
+// sync - re-positions layers if overlay was modified after last move of cursor: overlay cursor could move and
+// entries of base could become hidden
+func (c *memoryMutationCursor) sync() error {
+	if c.gen == c.mutation.gen {
+		return nil
+	}
+	c.gen = c.mutation.gen
+	if !c.positioned {
+		return nil
+	}
+	return c.reposition(c.forward)
+}
+
+// repositionLayer - forward: first entry > current, backward: last entry < current
+func (c *memoryMutationCursor) repositionLayer(l *cursorLayer, forward bool) error {
+	if c.k == nil {
+		if forward {
+			l.k, l.v = nil, nil
+			return nil
+		}
+		return l.last()
+	}
+	var v []byte
+	if c.dupSort {
+		v = c.v
+	}
+	if err := l.seek(c.k, v); err != nil {
+		return err
+	}
+	if forward {
+		if l.k != nil && c.cmp(l.k, l.v, c.k, c.v) == 0 {
+			return l.next()
+		}
+		return nil
+	}
+	if l.k == nil {
+		return l.last()
+	}
+	return l.prev()
+}
+
+func (c *memoryMutationCursor) reposition(forward bool) error {
+	c.forward = forward
+	if err := c.repositionLayer(&c.base, forward); err != nil {
+		return err
+	}
+	return c.repositionLayer(&c.mem, forward)
+}
+
+func (c *memoryMutationCursor) First() ([]byte, []byte, error) {
+	c.gen, c.forward = c.mutation.gen, true
+	if err := c.base.first(); err != nil {
+		return []byte{}, nil, err
+	}
+	if err := c.mem.first(); err != nil {
+		return []byte{}, nil, err
+	}
+	return c.pick()
+}
+
+func (c *memoryMutationCursor) Last() ([]byte, []byte, error) {
+	c.gen, c.forward = c.mutation.gen, false
+	if err := c.base.last(); err != nil {
+		return []byte{}, nil, err
+	}
+	if err := c.mem.last(); err != nil {
+		return []byte{}, nil, err
+	}
+	return c.pick()
+}
+
+func (c *memoryMutationCursor) seek(k, v []byte) ([]byte, []byte, error) {
+	c.gen, c.forward = c.mutation.gen, true
+	if err := c.base.seek(k, v); err != nil {
+		return []byte{}, nil, err
+	}
+	if err := c.mem.seek(k, v); err != nil {
+		return []byte{}, nil, err
+	}
+	return c.pick()
+}
+
+func (c *memoryMutationCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	return c.seek(seek, nil)
+}
+
+func (c *memoryMutationCursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	k, v, err := c.seek(key, nil)
+	if err != nil || !bytes.Equal(k, key) {
+		return nil, nil, err
+	}
+	return k, v, nil
+}
+
+func (c *memoryMutationCursor) Next() ([]byte, []byte, error) {
+	if !c.positioned {
+		return c.First()
+	}
+	if err := c.sync(); err != nil {
+		return []byte{}, nil, err
+	}
+	if c.afterDelete {
+		return c.pick()
+	}
+	if c.k == nil {
+		return nil, nil, nil
+	}
+	if !c.forward {
+		if err := c.reposition(true); err != nil {
+			return []byte{}, nil, err
+		}
+		return c.pick()
+	}
+	for _, l := range []*cursorLayer{&c.base, &c.mem} {
+		if l.k != nil && c.cmp(l.k, l.v, c.k, c.v) == 0 {
+			if err := l.next(); err != nil {
+				return []byte{}, nil, err
+			}
+		}
+	}
+	return c.pick()
+}
+
+func (c *memoryMutationCursor) Prev() ([]byte, []byte, error) {
+	if !c.positioned {
+		return c.Last()
+	}
+	if err := c.sync(); err != nil {
+		return []byte{}, nil, err
+	}
+	if c.k == nil && !c.afterDelete {
+		// MDBX moves to last entry from the end
+		return c.Last()
+	}
+	if c.forward {
+		if err := c.reposition(false); err != nil {
+			return []byte{}, nil, err
+		}
+		return c.pick()
+	}
+	for _, l := range []*cursorLayer{&c.base, &c.mem} {
+		if l.k != nil && c.cmp(l.k, l.v, c.k, c.v) == 0 {
+			if err := l.prev(); err != nil {
+				return []byte{}, nil, err
+			}
+		}
+	}
+	return c.pick()
+}
+
+func (c *memoryMutationCursor) Current() ([]byte, []byte, error) {
+	if c.afterDelete {
+		if err := c.sync(); err != nil {
+			return []byte{}, nil, err
+		}
+		k, v, _ := c.choose()
+		return k, v, nil
+	}
+	return c.k, c.v, nil
+}
+
+// Count - amount of entries in merged view, doesn't move cursor
+func (c *memoryMutationCursor) Count() (uint64, error) {
+	counter, err := c.mutation.newCursor(c.table)
+	if err != nil {
+		return 0, err
+	}
+	defer counter.Close()
+	var n uint64
+	for k, _, err := counter.First(); k != nil; k, _, err = counter.Next() {
+		if err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (c *memoryMutationCursor) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
+	k, v, err := c.seek(key, value)
+	if err != nil || !bytes.Equal(k, key) || !bytes.Equal(v, value) {
+		return nil, nil, err
+	}
+	return k, v, nil
+}
+
+func (c *memoryMutationCursor) SeekBothRange(key, value []byte) ([]byte, error) {
+	k, v, err := c.seek(key, value)
+	if err != nil || !bytes.Equal(k, key) {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (c *memoryMutationCursor) FirstDup() ([]byte, error) {
+	if c.k == nil {
+		return nil, nil
+	}
+	_, v, err := c.seek(common.Copy(c.k), nil)
+	return v, err
+}
+
+// NextDup - like MDBX, doesn't move cursor if current key has no more values
+func (c *memoryMutationCursor) NextDup() ([]byte, []byte, error) {
+	if c.k == nil {
+		return nil, nil, nil
+	}
+	k, v := common.Copy(c.k), common.Copy(c.v)
+	nextK, nextV, err := c.Next()
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	if bytes.Equal(nextK, k) {
+		return nextK, nextV, nil
+	}
+	if _, _, err := c.seek(k, v); err != nil {
+		return []byte{}, nil, err
+	}
+	return nil, nil, nil
+}
+
+func (c *memoryMutationCursor) NextNoDup() ([]byte, []byte, error) {
+	if !c.positioned {
+		return c.First()
+	}
+	if c.k == nil {
+		return nil, nil, nil
+	}
+	k := common.Copy(c.k)
+	c.gen, c.forward = c.mutation.gen, true
+	if err := c.base.seekNextKey(k); err != nil {
+		return []byte{}, nil, err
+	}
+	if err := c.mem.seekNextKey(k); err != nil {
+		return []byte{}, nil, err
+	}
+	return c.pick()
+}
+
+func (c *memoryMutationCursor) LastDup() ([]byte, error) {
+	if c.k == nil {
+		return nil, nil
+	}
+	k := common.Copy(c.k)
+	if _, _, err := c.NextNoDup(); err != nil {
+		return nil, err
+	}
+	var err error
+	if c.k == nil {
+		_, _, err = c.Last()
+	} else {
+		_, _, err = c.Prev()
+	}
+	if err != nil || !bytes.Equal(c.k, k) {
+		return nil, err
+	}
+	return c.v, nil
+}
+
+// CountDuplicates - amount of values of current key, doesn't move cursor
+func (c *memoryMutationCursor) CountDuplicates() (uint64, error) {
+	if c.k == nil {
+		return 0, nil
+	}
+	k, v := common.Copy(c.k), common.Copy(c.v)
+	var n uint64
+	dup, err := c.FirstDup()
+	for ; dup != nil && err == nil; _, dup, err = c.NextDup() {
+		n++
+	}
+	if err != nil {
+		return 0, err
+	}
+	if _, _, err := c.seek(k, v); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (c *memoryMutationCursor) Put(k, v []byte) error {
+	k, v = common.Copy(k), common.Copy(v)
+	if err := c.mutation.Put(c.table, k, v); err != nil {
+		return err
+	}
+	_, _, err := c.seek(k, v)
+	return err
+}
+
+func (c *memoryMutationCursor) Append(k []byte, v []byte) error {
+	return c.Put(k, v)
+}
+
+func (c *memoryMutationCursor) AppendDup(k []byte, v []byte) error {
+	return c.Put(k, v)
+}
+
+func (c *memoryMutationCursor) Delete(k, v []byte) error {
+	if !c.dupSort {
+		v = nil
+	}
+	return c.delete(common.Copy(k), common.Copy(v))
+}
+
+func (c *memoryMutationCursor) DeleteCurrent() error {
+	if c.k == nil {
+		return nil
+	}
+	if !c.dupSort {
+		return c.delete(c.k, nil)
+	}
+	return c.delete(c.k, c.v)
+}
+
+func (c *memoryMutationCursor) DeleteCurrentDuplicates() error {
+	if c.k == nil {
+		return nil
+	}
+	return c.delete(c.k, nil)
+}
+
+// delete - after delete layers are positioned on next entry, like in MDBX Next and Current return it
+func (c *memoryMutationCursor) delete(k, v []byte) error {
+	if err := c.mutation.Delete(c.table, k, v); err != nil {
+		return err
+	}
+	c.gen = c.mutation.gen
+	c.k, c.v, c.positioned = k, v, true
+	if err := c.reposition(true); err != nil {
+		return err
+	}
+	c.afterDelete = true
+	return nil
+}
+
+func (c *memoryMutationCursor) Close() {
+	c.base.c.Close()
+	c.mem.c.Close()
+}
+
+// autoDupSortCursor - DupSort view of table with AutoDupSortKeysConversion: merged cursor works with full keys,
+// dup methods take and return keys of keyLen and values prefixed by the rest of full key, as MDBX stores them
+type autoDupSortCursor struct {
+	*memoryMutationCursor
+	keyLen, fullKeyLen int
+}
+
+// split - converts full key entry to MDBX layout, nil if entry doesn't belong to key
+func (c *autoDupSortCursor) split(key, k, v []byte) ([]byte, []byte) {
+	if len(k) != c.fullKeyLen || !bytes.Equal(k[:c.keyLen], key) {
+		return nil, nil
+	}
+	return k[:c.keyLen], append(common.Copy(k[c.keyLen:]), v...)
+}
+
+func (c *autoDupSortCursor) SeekBothRange(key, value []byte) ([]byte, error) {
+	seek := append(common.Copy(key), value...)
+	k, v, err := c.Seek(seek)
+	if err != nil {
+		return nil, err
+	}
+	_, v = c.split(key, k, v)
+	return v, nil
+}
+
+func (c *autoDupSortCursor) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
+	if len(value) < c.fullKeyLen-c.keyLen {
+		return nil, nil, nil
+	}
+	fullKey := append(common.Copy(key), value[:c.fullKeyLen-c.keyLen]...)
+	k, v, err := c.SeekExact(fullKey)
+	if err != nil || k == nil || !bytes.Equal(v, value[c.fullKeyLen-c.keyLen:]) {
+		return nil, nil, err
+	}
+	k, v = c.split(key, k, v)
+	return k, v, nil
+}
+
+// NextDup - like MDBX, doesn't move cursor if current key has no more values
+func (c *autoDupSortCursor) NextDup() ([]byte, []byte, error) {
+	if c.k == nil || len(c.k) != c.fullKeyLen {
+		return nil, nil, nil
+	}
+	current := common.Copy(c.k)
+	k, v, err := c.Next()
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	if k, v = c.split(current[:c.keyLen], k, v); k != nil {
+		return k, v, nil
+	}
+	if _, _, err := c.Seek(current); err != nil {
+		return []byte{}, nil, err
+	}
+	return nil, nil, nil
+}
@@ -0,0 +1,383 @@
+package olddb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+)
+
+func initMemoryMutationBase(t *testing.T, table string, entries [][2]string) kv.RwDB {
+	db := memdb.NewTestDB(t)
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		for _, e := range entries {
+			if err := tx.Put(table, []byte(e[0]), []byte(e[1])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	return db
+}
+
+func readAll(t *testing.T, tx kv.Tx, table string) (forward, backward []string) {
+	c, err := tx.Cursor(table)
+	require.NoError(t, err)
+	defer c.Close()
+	for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+		require.NoError(t, err)
+		forward = append(forward, string(k)+"="+string(v))
+	}
+	for k, v, err := c.Last(); k != nil; k, v, err = c.Prev() {
+		require.NoError(t, err)
+		backward = append([]string{string(k) + "=" + string(v)}, backward...)
+	}
+	return forward, backward
+}
+
+func TestMemoryMutation(t *testing.T) {
+	require := require.New(t)
+	db := initMemoryMutationBase(t, kv.HashedAccounts, [][2]string{{"a", "1"}, {"b", "2"}, {"c", "3"}, {"d", "4"}})
+	tx, err := db.BeginRo(context.Background())
+	require.NoError(err)
+	defer tx.Rollback()
+
+	batch := NewMemoryBatch(tx)
+	defer batch.Rollback()
+	require.NoError(batch.Put(kv.HashedAccounts, []byte("b"), []byte("22")))
+	require.NoError(batch.Delete(kv.HashedAccounts, []byte("c"), nil))
+	require.NoError(batch.Put(kv.HashedAccounts, []byte("e"), []byte("5")))
+
+	v, err := batch.GetOne(kv.HashedAccounts, []byte("b"))
+	require.NoError(err)
+	require.Equal("22", string(v))
+	v, err = batch.GetOne(kv.HashedAccounts, []byte("c"))
+	require.NoError(err)
+	require.Nil(v)
+	has, err := batch.Has(kv.HashedAccounts, []byte("a"))
+	require.NoError(err)
+	require.True(has)
+
+	expected := []string{"a=1", "b=22", "d=4", "e=5"}
+	forward, backward := readAll(t, batch, kv.HashedAccounts)
+	require.Equal(expected, forward)
+	require.Equal(expected, backward)
+
+	c, err := batch.Cursor(kv.HashedAccounts)
+	require.NoError(err)
+	defer c.Close()
+	k, _, err := c.Seek([]byte("c"))
+	require.NoError(err)
+	require.Equal("d", string(k))
+	k, _, err = c.Prev()
+	require.NoError(err)
+	require.Equal("b", string(k))
+	k, _, err = c.Next()
+	require.NoError(err)
+	require.Equal("d", string(k))
+	k, _, err = c.SeekExact([]byte("c"))
+	require.NoError(err)
+	require.Nil(k)
+
+	// base is not modified
+	forward, _ = readAll(t, tx, kv.HashedAccounts)
+	require.Equal([]string{"a=1", "b=2", "c=3", "d=4"}, forward)
+
+	rwTx, err := db.BeginRw(context.Background())
+	require.NoError(err)
+	defer rwTx.Rollback()
+	require.NoError(batch.Flush(rwTx))
+	forward, _ = readAll(t, rwTx, kv.HashedAccounts)
+	require.Equal(expected, forward)
+}
+
+func TestMemoryMutationDupSort(t *testing.T) {
+	require := require.New(t)
+	db := initMemoryMutationBase(t, kv.AccountChangeSet, [][2]string{{"a", "1"}, {"a", "3"}, {"b", "1"}, {"c", "1"}})
+	tx, err := db.BeginRo(context.Background())
+	require.NoError(err)
+	defer tx.Rollback()
+
+	batch := NewMemoryBatch(tx)
+	defer batch.Rollback()
+	require.NoError(batch.Put(kv.AccountChangeSet, []byte("a"), []byte("2")))
+	require.NoError(batch.Delete(kv.AccountChangeSet, []byte("a"), []byte("3")))
+	require.NoError(batch.Delete(kv.AccountChangeSet, []byte("b"), nil))
+	require.NoError(batch.Put(kv.AccountChangeSet, []byte("b"), []byte("5")))
+
+	expected := []string{"a=1", "a=2", "b=5", "c=1"}
+	forward, backward := readAll(t, batch, kv.AccountChangeSet)
+	require.Equal(expected, forward)
+	require.Equal(expected, backward)
+
+	c, err := batch.CursorDupSort(kv.AccountChangeSet)
+	require.NoError(err)
+	defer c.Close()
+	v, err := c.SeekBothRange([]byte("a"), []byte("2"))
+	require.NoError(err)
+	require.Equal("2", string(v))
+	n, err := c.CountDuplicates()
+	require.NoError(err)
+	require.Equal(uint64(2), n)
+	k, v, err := c.NextDup()
+	require.NoError(err)
+	require.Nil(k)
+	require.Nil(v)
+	v, err = c.FirstDup()
+	require.NoError(err)
+	require.Equal("1", string(v))
+	v, err = c.LastDup()
+	require.NoError(err)
+	require.Equal("2", string(v))
+	k, v, err = c.NextNoDup()
+	require.NoError(err)
+	require.Equal("b", string(k))
+	require.Equal("5", string(v))
+
+	rwTx, err := db.BeginRw(context.Background())
+	require.NoError(err)
+	defer rwTx.Rollback()
+	require.NoError(batch.Flush(rwTx))
+	forward, _ = readAll(t, rwTx, kv.AccountChangeSet)
+	require.Equal(expected, forward)
+}
+
+func TestMemoryMutationAutoDupSort(t *testing.T) {
+	require := require.New(t)
+	acc1, acc2 := strings.Repeat("a", 40), strings.Repeat("b", 40)
+	slot := func(b byte) string { return strings.Repeat(string(b), 32) }
+	db := initMemoryMutationBase(t, kv.HashedStorage, [][2]string{{acc1 + slot('1'), "1"}, {acc1 + slot('3'), "3"}, {acc2 + slot('1'), "1"}})
+	tx, err := db.BeginRo(context.Background())
+	require.NoError(err)
+	defer tx.Rollback()
+
+	batch := NewMemoryBatch(tx)
+	defer batch.Rollback()
+	require.NoError(batch.Put(kv.HashedStorage, []byte(acc1+slot('2')), []byte("2")))
+	require.NoError(batch.Delete(kv.HashedStorage, []byte(acc1+slot('3')), nil))
+
+	c, err := batch.CursorDupSort(kv.HashedStorage)
+	require.NoError(err)
+	defer c.Close()
+	var values []string
+	for v, err := c.SeekBothRange([]byte(acc1), []byte("2")); v != nil; _, v, err = c.NextDup() {
+		require.NoError(err)
+		values = append(values, string(v))
+	}
+	require.Equal([]string{slot('2') + "2"}, values)
+	v, err := c.SeekBothRange([]byte(acc1), nil)
+	require.NoError(err)
+	require.Equal(slot('1')+"1", string(v))
+	k, v, err := c.SeekBothExact([]byte(acc2), []byte(slot('1')+"1"))
+	require.NoError(err)
+	require.Equal(acc2, string(k))
+	require.Equal(slot('1')+"1", string(v))
+	v, err = c.SeekBothRange([]byte(acc2), []byte(slot('2')))
+	require.NoError(err)
+	require.Nil(v)
+
+	trieC, err := batch.CursorDupSort(kv.TrieOfStorage)
+	require.NoError(err)
+	trieC.Close()
+}
+
+func TestMemoryMutationDeleteCurrent(t *testing.T) {
+	require := require.New(t)
+	db := initMemoryMutationBase(t, kv.HashedAccounts, [][2]string{{"a", "1"}, {"c", "3"}})
+	tx, err := db.BeginRo(context.Background())
+	require.NoError(err)
+	defer tx.Rollback()
+
+	batch := NewMemoryBatch(tx)
+	defer batch.Rollback()
+	require.NoError(batch.Put(kv.HashedAccounts, []byte("b"), []byte("2")))
+	c, err := batch.RwCursor(kv.HashedAccounts)
+	require.NoError(err)
+	defer c.Close()
+	var deleted []string
+	for k, _, err := c.First(); k != nil; k, _, err = c.Next() {
+		require.NoError(err)
+		deleted = append(deleted, string(k))
+		require.NoError(c.DeleteCurrent())
+	}
+	require.Equal([]string{"a", "b", "c"}, deleted)
+	forward, _ := readAll(t, batch, kv.HashedAccounts)
+	require.Empty(forward)
+}
+
+// TestMemoryMutationRandom - overlay must behave as MDBX transaction with same writes
+func TestMemoryMutationRandom(t *testing.T) {
+	for _, table := range []string{kv.HashedAccounts, kv.AccountChangeSet} {
+		table := table
+		t.Run(table, func(t *testing.T) {
+			for seed := int64(0); seed < 20; seed++ {
+				testMemoryMutationRandom(t, table, seed)
+			}
+		})
+	}
+}
+
+func testMemoryMutationRandom(t *testing.T, table string, seed int64) {
+	require := require.New(t)
+	rnd := rand.New(rand.NewSource(seed))
+	key := func() []byte { return []byte{byte(rnd.Intn(16))} }
+	value := func() []byte { return []byte{byte(rnd.Intn(4))} }
+
+	var entries [][2]string
+	for i := 0; i < 30; i++ {
+		entries = append(entries, [2]string{string(key()), string(value())})
+	}
+	db := initMemoryMutationBase(t, table, entries)
+	tx, err := db.BeginRo(context.Background())
+	require.NoError(err)
+	defer tx.Rollback()
+	_, refTx := memdb.NewTestTx(t)
+	for _, e := range entries {
+		require.NoError(refTx.Put(table, []byte(e[0]), []byte(e[1])))
+	}
+	batch := NewMemoryBatch(tx)
+	defer batch.Rollback()
+
+	for i := 0; i < 40; i++ {
+		switch op := rnd.Intn(10); {
+		case op < 5:
+			k, v := key(), value()
+			require.NoError(batch.Put(table, k, v))
+			require.NoError(refTx.Put(table, k, v))
+		case op < 7:
+			k, v := key(), value()
+			require.NoError(batch.Delete(table, k, v))
+			if isDupSort(table) {
+				require.NoError(deleteDup(refTx, table, k, v))
+			} else {
+				require.NoError(refTx.Delete(table, k, v))
+			}
+		case op < 9:
+			k := key()
+			require.NoError(batch.Delete(table, k, nil))
+			if isDupSort(table) {
+				require.NoError(deleteAllDups(refTx, table, k))
+			} else {
+				require.NoError(refTx.Delete(table, k, nil))
+			}
+		default:
+			// delete through cursor, which must stay usable
+			k := key()
+			c, err := batch.RwCursor(table)
+			require.NoError(err)
+			refC, err := refTx.RwCursor(table)
+			require.NoError(err)
+			found, _, err := c.Seek(k)
+			require.NoError(err)
+			refFound, _, err := refC.Seek(k)
+			require.NoError(err)
+			require.Equal(refFound, found)
+			if found != nil {
+				require.NoError(c.DeleteCurrent())
+				require.NoError(refC.DeleteCurrent())
+				next, nextV, err := c.Next()
+				require.NoError(err)
+				refNext, refNextV, err := refC.Next()
+				require.NoError(err)
+				require.Equal(fmt.Sprintf("%x=%x", refNext, refNextV), fmt.Sprintf("%x=%x", next, nextV))
+			}
+			c.Close()
+			refC.Close()
+		}
+	}
+
+	forward, backward := readAll(t, batch, table)
+	refForward, _ := readAll(t, refTx, table)
+	require.Equal(refForward, forward, "seed %d", seed)
+	require.Equal(refForward, backward, "seed %d", seed)
+
+	c, err := batch.CursorDupSort(table)
+	if !isDupSort(table) {
+		require.NoError(err)
+		c.Close()
+		c2, err := batch.Cursor(table)
+		require.NoError(err)
+		defer c2.Close()
+		refC, err := refTx.Cursor(table)
+		require.NoError(err)
+		defer refC.Close()
+		compareCursors(t, rnd, c2, refC, nil, nil)
+		return
+	}
+	require.NoError(err)
+	defer c.Close()
+	refC, err := refTx.CursorDupSort(table)
+	require.NoError(err)
+	defer refC.Close()
+	compareCursors(t, rnd, c, refC, c, refC)
+}
+
+func compareCursors(t *testing.T, rnd *rand.Rand, c, refC kv.Cursor, dc, refDc kv.CursorDupSort) {
+	format := func(k, v []byte, err error) string {
+		require.NoError(t, err)
+		if k == nil {
+			return "nil"
+		}
+		return fmt.Sprintf("%x=%x", k, v)
+	}
+	// dup operations of unpositioned MDBX cursor are not defined
+	got, expected := format(c.First()), format(refC.First())
+	require.Equal(t, expected, got)
+	var hist []string
+	for i := 0; i < 200; i++ {
+		k, v := []byte{byte(rnd.Intn(16))}, []byte{byte(rnd.Intn(4))}
+		var got, expected string
+		// LastDup of MDBX cursor in this version panics, it's checked by TestMemoryMutationDupSort
+		op := rnd.Intn(12)
+		if dc == nil {
+			op = op % 7
+		}
+		switch op {
+		case 0:
+			got, expected = format(c.First()), format(refC.First())
+		case 1:
+			got, expected = format(c.Last()), format(refC.Last())
+		case 2, 3:
+			got, expected = format(c.Next()), format(refC.Next())
+		case 4, 5:
+			got, expected = format(c.Prev()), format(refC.Prev())
+		case 6:
+			got, expected = format(c.Seek(k)), format(refC.Seek(k))
+		case 7:
+			got = format(dc.SeekBothExact(k, v))
+			// MDBX cursor of this version returns next value if value not found
+			k2, v2, err := refDc.SeekBothExact(k, v)
+			if !bytes.Equal(v2, v) {
+				k2, v2 = nil, nil
+			}
+			expected = format(k2, v2, err)
+		case 8:
+			v1, err1 := dc.SeekBothRange(k, v)
+			v2, err2 := refDc.SeekBothRange(k, v)
+			got, expected = format(v1, v1, err1), format(v2, v2, err2)
+		case 9:
+			got, expected = format(dc.NextNoDup()), format(refDc.NextNoDup())
+		case 10:
+			got, expected = format(dc.NextDup()), format(refDc.NextDup())
+		case 11:
+			n1, err1 := dc.CountDuplicates()
+			n2, err2 := refDc.CountDuplicates()
+			require.NoError(t, err1)
+			require.NoError(t, err2)
+			got, expected = fmt.Sprint(n1), fmt.Sprint(n2)
+		}
+		hist = append(hist, fmt.Sprintf("op %d %x %x: %s", op, k, v, expected))
+		require.Equal(t, expected, got, "history: %v", hist)
+		if expected == "nil" {
+			// position of MDBX cursor after not found is not specified
+			got, expected = format(c.First()), format(refC.First())
+			require.Equal(t, expected, got)
+		}
+	}
+}
@@ -45,7 +45,8 @@ func NewBatch(tx kv.RwTx, quit <-chan struct{}) *mutation {
 	clean := func() {}
 	if quit == nil {
 		ch := make(chan struct{})
-		clean = func() { close(ch) }
+		var once sync.Once // Commit and deferred Rollback both clean
+		clean = func() { once.Do(func() { close(ch) }) }
 		quit = ch
 	}
 	return &mutation{
@@ -0,0 +1,385 @@
+package privateapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon/common/logging"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/p2p"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// AdminServer - service "admin.Admin", administrative operations of the node for rpcdaemon:
+// rpc Rewind(google.protobuf.UInt64Value) returns (google.protobuf.Empty) - unwinds all stages to the block and
+// continues sync from there
+// rpc Import(google.protobuf.BytesValue) returns (google.protobuf.Empty) - value is RLP list of consecutive blocks
+// extending canonical chain, they are inserted through staged sync
+// rpc UpdateChainConfig(google.protobuf.BytesValue) returns (google.protobuf.Empty) - value is JSON of chain config
+// with new forks scheduled above head
+// rpc Sentries(google.protobuf.Empty) returns (google.protobuf.BytesValue) - value is JSON list of SentryInfo
+// rpc Peers(google.protobuf.Empty) returns (google.protobuf.BytesValue) - value is JSON list of PeerInfo
+// rpc SetLogLevel(google.protobuf.BytesValue) returns (google.protobuf.BytesValue) - value of request is JSON of
+// LogLevel, of reply - JSON map of levels of all subsystems, see logging.Levels
+type AdminServer interface {
+	Rewind(context.Context, *wrapperspb.UInt64Value) (*emptypb.Empty, error)
+	Import(context.Context, *wrapperspb.BytesValue) (*emptypb.Empty, error)
+	UpdateChainConfig(context.Context, *wrapperspb.BytesValue) (*emptypb.Empty, error)
+	Sentries(context.Context, *emptypb.Empty) (*wrapperspb.BytesValue, error)
+	Peers(context.Context, *emptypb.Empty) (*wrapperspb.BytesValue, error)
+	SetLogLevel(context.Context, *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error)
+}
+
+// Admin - implemented by turbo/stages.Admin
+type Admin interface {
+	Rewind(ctx context.Context, to uint64) error
+	ImportBlocks(ctx context.Context, blocks []*types.Block) error
+	UpdateChainConfig(ctx context.Context, cfg *params.ChainConfig) error
+}
+
+// Sentries - implemented by cmd/sentry/sentry.ControlServerImpl
+type Sentries interface {
+	SentriesInfo() []SentryInfo
+	PeersInfo(ctx context.Context) []PeerInfo
+}
+
+// PeerInfo - peer connected to one of sentries of the node
+type PeerInfo struct {
+	*p2p.PeerInfo
+	Sentry string `json:"sentry"` // address of standalone sentry, "#<index>" of embedded one
+}
+
+// SentryInfo - sentry used by the node, its labels, state and counters of header and body requests sent to it
+type SentryInfo struct {
+	Addr      string            `json:"addr,omitempty"` // empty for embedded sentries
+	Labels    map[string]string `json:"labels,omitempty"`
+	Preferred []string          `json:"preferred,omitempty"` // kinds of requests routed to this sentry first
+	Protocol  string            `json:"protocol"`
+	Ready     bool              `json:"ready"`
+	Down      bool              `json:"down"` // recent request failed, sentry is asked only if others can't serve
+	Requests  uint64            `json:"requests"`
+	NoPeers   uint64            `json:"noPeers"` // requests for which sentry had no suitable peer
+	Errors    uint64            `json:"errors"`
+}
+
+// LogLevel - level of subsystem (or logging.Default), see logging.ParseLevel
+type LogLevel struct {
+	Subsystem string `json:"subsystem"`
+	Level     string `json:"level"`
+}
+
+type AdminRPCServer struct {
+	admin    Admin
+	sentries Sentries
+}
+
+func NewAdminServer(admin Admin, sentries Sentries) *AdminRPCServer {
+	return &AdminRPCServer{admin: admin, sentries: sentries}
+}
+
+func (s *AdminRPCServer) Rewind(ctx context.Context, in *wrapperspb.UInt64Value) (*emptypb.Empty, error) {
+	if err := s.admin.Rewind(ctx, in.GetValue()); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *AdminRPCServer) Import(ctx context.Context, in *wrapperspb.BytesValue) (*emptypb.Empty, error) {
+	var blocks []*types.Block
+	if err := rlp.DecodeBytes(in.GetValue(), &blocks); err != nil {
+		return nil, fmt.Errorf("decode blocks: %w", err)
+	}
+	if err := s.admin.ImportBlocks(ctx, blocks); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *AdminRPCServer) UpdateChainConfig(ctx context.Context, in *wrapperspb.BytesValue) (*emptypb.Empty, error) {
+	cfg := new(params.ChainConfig)
+	if err := json.Unmarshal(in.GetValue(), cfg); err != nil {
+		return nil, fmt.Errorf("decode chain config: %w", err)
+	}
+	if err := s.admin.UpdateChainConfig(ctx, cfg); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *AdminRPCServer) Sentries(_ context.Context, _ *emptypb.Empty) (*wrapperspb.BytesValue, error) {
+	data, err := json.Marshal(s.sentries.SentriesInfo())
+	if err != nil {
+		return nil, err
+	}
+	return wrapperspb.Bytes(data), nil
+}
+
+func (s *AdminRPCServer) Peers(ctx context.Context, _ *emptypb.Empty) (*wrapperspb.BytesValue, error) {
+	data, err := json.Marshal(s.sentries.PeersInfo(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return wrapperspb.Bytes(data), nil
+}
+
+func (s *AdminRPCServer) SetLogLevel(_ context.Context, in *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error) {
+	var req LogLevel
+	if err := json.Unmarshal(in.GetValue(), &req); err != nil {
+		return nil, fmt.Errorf("decode log level: %w", err)
+	}
+	lvl, err := logging.ParseLevel(req.Level)
+	if err != nil {
+		return nil, err
+	}
+	if err = logging.SetLevel(req.Subsystem, lvl); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(logging.Levels())
+	if err != nil {
+		return nil, err
+	}
+	return wrapperspb.Bytes(data), nil
+}
+
+func _Admin_Rewind_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.UInt64Value)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Rewind(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/Rewind",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Rewind(ctx, req.(*wrapperspb.UInt64Value))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Import_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.BytesValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Import(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/Import",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Import(ctx, req.(*wrapperspb.BytesValue))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_UpdateChainConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.BytesValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).UpdateChainConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/UpdateChainConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).UpdateChainConfig(ctx, req.(*wrapperspb.BytesValue))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Sentries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Sentries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/Sentries",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Sentries(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Peers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Peers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/Peers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Peers(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetLogLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.BytesValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetLogLevel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/SetLogLevel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetLogLevel(ctx, req.(*wrapperspb.BytesValue))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc - hand-written descriptor of "admin.Admin" service, messages are protobuf well-known types
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "admin.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Rewind",
+			Handler:    _Admin_Rewind_Handler,
+		},
+		{
+			MethodName: "Import",
+			Handler:    _Admin_Import_Handler,
+		},
+		{
+			MethodName: "UpdateChainConfig",
+			Handler:    _Admin_UpdateChainConfig_Handler,
+		},
+		{
+			MethodName: "Sentries",
+			Handler:    _Admin_Sentries_Handler,
+		},
+		{
+			MethodName: "Peers",
+			Handler:    _Admin_Peers_Handler,
+		},
+		{
+			MethodName: "SetLogLevel",
+			Handler:    _Admin_SetLogLevel_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// AdminClient - client of "admin.Admin" service
+type AdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) *AdminClient {
+	return &AdminClient{cc: cc}
+}
+
+// Rewind - error of the node is returned without gRPC status wrapping
+func (c *AdminClient) Rewind(ctx context.Context, to uint64) error {
+	return c.invoke(ctx, "/admin.Admin/Rewind", wrapperspb.UInt64(to))
+}
+
+// ImportBlocks - sends blocks in one request, caller keeps it below max message size of the server
+func (c *AdminClient) ImportBlocks(ctx context.Context, blocks []*types.Block) error {
+	data, err := rlp.EncodeToBytes(blocks)
+	if err != nil {
+		return err
+	}
+	return c.invoke(ctx, "/admin.Admin/Import", wrapperspb.Bytes(data))
+}
+
+// UpdateChainConfig - node stores cfg if it only schedules forks above its head, applies it after restart
+func (c *AdminClient) UpdateChainConfig(ctx context.Context, cfg *params.ChainConfig) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return c.invoke(ctx, "/admin.Admin/UpdateChainConfig", wrapperspb.Bytes(data))
+}
+
+// Sentries - sentries of the node with their labels and request counters
+func (c *AdminClient) Sentries(ctx context.Context) ([]SentryInfo, error) {
+	out := new(wrapperspb.BytesValue)
+	if err := c.cc.Invoke(ctx, "/admin.Admin/Sentries", &emptypb.Empty{}, out); err != nil {
+		if s, ok := status.FromError(err); ok {
+			return nil, errors.New(s.Message())
+		}
+		return nil, err
+	}
+	var sentries []SentryInfo
+	if err := json.Unmarshal(out.GetValue(), &sentries); err != nil {
+		return nil, err
+	}
+	return sentries, nil
+}
+
+// Peers - peers of all sentries of the node with their connection stats
+func (c *AdminClient) Peers(ctx context.Context) ([]PeerInfo, error) {
+	out := new(wrapperspb.BytesValue)
+	if err := c.cc.Invoke(ctx, "/admin.Admin/Peers", &emptypb.Empty{}, out); err != nil {
+		if s, ok := status.FromError(err); ok {
+			return nil, errors.New(s.Message())
+		}
+		return nil, err
+	}
+	var peers []PeerInfo
+	if err := json.Unmarshal(out.GetValue(), &peers); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+// SetLogLevel - changes level of subsystem of the node, returns levels of all its subsystems
+func (c *AdminClient) SetLogLevel(ctx context.Context, subsystem, level string) (map[string]string, error) {
+	data, err := json.Marshal(LogLevel{Subsystem: subsystem, Level: level})
+	if err != nil {
+		return nil, err
+	}
+	out := new(wrapperspb.BytesValue)
+	if err := c.cc.Invoke(ctx, "/admin.Admin/SetLogLevel", wrapperspb.Bytes(data), out); err != nil {
+		if s, ok := status.FromError(err); ok {
+			return nil, errors.New(s.Message())
+		}
+		return nil, err
+	}
+	var levels map[string]string
+	if err := json.Unmarshal(out.GetValue(), &levels); err != nil {
+		return nil, err
+	}
+	return levels, nil
+}
+
+func (c *AdminClient) invoke(ctx context.Context, method string, in interface{}) error {
+	if err := c.cc.Invoke(ctx, method, in, new(emptypb.Empty)); err != nil {
+		if s, ok := status.FromError(err); ok {
+			return errors.New(s.Message())
+		}
+		return err
+	}
+	return nil
+}
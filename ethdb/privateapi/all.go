@@ -1,11 +1,13 @@
 package privateapi
 
 import (
+	"context"
 	"fmt"
 	"net"
 
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
 	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
+	"github.com/ledgerwatch/erigon/common/reqlabel"
 
 	//grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
@@ -18,7 +20,7 @@ import (
 )
 
 func StartGrpc(kv *remotedbserver.KvServer, ethBackendSrv *EthBackendServer, txPoolServer txpool_proto.TxpoolServer,
-	miningServer txpool_proto.MiningServer, addr string, rateLimit uint32, creds credentials.TransportCredentials,
+	miningServer txpool_proto.MiningServer, blockProviderServer BlockProviderServer, exportServer ExportServer, txPoolEventsServer TxPoolEventsServer, adminServer AdminServer, addr string, rateLimit uint32, creds credentials.TransportCredentials,
 	healthCheck bool) (*grpc.Server, error) {
 	log.Info("Starting private RPC server", "on", addr)
 	lis, err := net.Listen("tcp", addr)
@@ -34,7 +36,19 @@ func StartGrpc(kv *remotedbserver.KvServer, ethBackendSrv *EthBackendServer, txP
 	if miningServer != nil {
 		txpool_proto.RegisterMiningServer(grpcServer, miningServer)
 	}
-	remote.RegisterKVServer(grpcServer, kv)
+	if blockProviderServer != nil {
+		grpcServer.RegisterService(&BlockProvider_ServiceDesc, blockProviderServer)
+	}
+	if exportServer != nil {
+		grpcServer.RegisterService(&Export_ServiceDesc, exportServer)
+	}
+	if txPoolEventsServer != nil {
+		grpcServer.RegisterService(&TxPoolEvents_ServiceDesc, txPoolEventsServer)
+	}
+	if adminServer != nil {
+		grpcServer.RegisterService(&Admin_ServiceDesc, adminServer)
+	}
+	remote.RegisterKVServer(grpcServer, labeledKVServer{kv})
 	var healthServer *health.Server
 	if healthCheck {
 		healthServer = health.NewServer()
@@ -51,3 +65,20 @@ func StartGrpc(kv *remotedbserver.KvServer, ethBackendSrv *EthBackendServer, txP
 
 	return grpcServer, nil
 }
+
+// labeledKVServer - read transactions opened by rpcdaemon carry labels of RPC calls (see reqlabel.Incoming), which
+// appear in logs of long read transactions
+type labeledKVServer struct {
+	remote.KVServer
+}
+
+func (s labeledKVServer) Tx(stream remote.KV_TxServer) error {
+	return s.KVServer.Tx(labeledTxStream{KV_TxServer: stream, ctx: reqlabel.Incoming(stream.Context())})
+}
+
+type labeledTxStream struct {
+	remote.KV_TxServer
+	ctx context.Context
+}
+
+func (s labeledTxStream) Context() context.Context { return s.ctx }
@@ -93,7 +93,7 @@ func TestMockDownloadRequest(t *testing.T) {
 	statusCh := make(chan ExecutionStatus)
 	waitingForHeaders := uint32(1)
 
-	backend := NewEthBackendServer(ctx, nil, db, nil, nil, &params.ChainConfig{TerminalTotalDifficulty: common.Big1}, reverseDownloadCh, statusCh, &waitingForHeaders)
+	backend := NewEthBackendServer(ctx, nil, db, nil, nil, nil, &params.ChainConfig{TerminalTotalDifficulty: common.Big1}, reverseDownloadCh, statusCh, &waitingForHeaders)
 
 	var err error
 	var reply *remote.EngineExecutePayloadReply
@@ -153,7 +153,7 @@ func TestMockValidExecution(t *testing.T) {
 	statusCh := make(chan ExecutionStatus)
 	waitingForHeaders := uint32(1)
 
-	backend := NewEthBackendServer(ctx, nil, db, nil, nil, &params.ChainConfig{TerminalTotalDifficulty: common.Big1}, reverseDownloadCh, statusCh, &waitingForHeaders)
+	backend := NewEthBackendServer(ctx, nil, db, nil, nil, nil, &params.ChainConfig{TerminalTotalDifficulty: common.Big1}, reverseDownloadCh, statusCh, &waitingForHeaders)
 
 	var err error
 	var reply *remote.EngineExecutePayloadReply
@@ -189,7 +189,7 @@ func TestMockInvalidExecution(t *testing.T) {
 	statusCh := make(chan ExecutionStatus)
 
 	waitingForHeaders := uint32(1)
-	backend := NewEthBackendServer(ctx, nil, db, nil, nil, &params.ChainConfig{TerminalTotalDifficulty: common.Big1}, reverseDownloadCh, statusCh, &waitingForHeaders)
+	backend := NewEthBackendServer(ctx, nil, db, nil, nil, nil, &params.ChainConfig{TerminalTotalDifficulty: common.Big1}, reverseDownloadCh, statusCh, &waitingForHeaders)
 
 	var err error
 	var reply *remote.EngineExecutePayloadReply
@@ -225,7 +225,7 @@ func TestNoTTD(t *testing.T) {
 	statusCh := make(chan ExecutionStatus)
 	waitingForHeaders := uint32(1)
 
-	backend := NewEthBackendServer(ctx, nil, db, nil, nil, &params.ChainConfig{}, reverseDownloadCh, statusCh, &waitingForHeaders)
+	backend := NewEthBackendServer(ctx, nil, db, nil, nil, nil, &params.ChainConfig{}, reverseDownloadCh, statusCh, &waitingForHeaders)
 
 	var err error
 
@@ -255,3 +255,39 @@ func TestNoTTD(t *testing.T) {
 
 	require.Equal(err.Error(), "not a proof-of-stake chain")
 }
+
+func TestForkchoiceRecorded(t *testing.T) {
+	db := memdb.New()
+	ctx := context.Background()
+	require := require.New(t)
+
+	makeTestDb(ctx, db)
+	waitingForHeaders := uint32(1)
+	forkChoice := NewForkChoice()
+	backend := NewEthBackendServer(ctx, nil, db, nil, forkChoice, nil, &params.ChainConfig{TerminalTotalDifficulty: common.Big1}, nil, nil, &waitingForHeaders)
+
+	safeHash := common.HexToHash("0x5")
+	reply, err := backend.EngineForkChoiceUpdatedV1(ctx, &remote.EngineForkChoiceUpdatedRequest{
+		Forkchoice: &remote.EngineForkChoiceUpdated{
+			HeadBlockHash:      gointerfaces.ConvertHashToH256(startingHeadHash),
+			SafeBlockHash:      gointerfaces.ConvertHashToH256(safeHash),
+			FinalizedBlockHash: gointerfaces.ConvertHashToH256(common.Hash{}),
+		},
+	})
+	require.NoError(err)
+	require.Equal("SUCCESS", reply.Status)
+
+	// engine API doesn't write to db, state is stored by stage loop
+	tx, err := db.BeginRw(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+	require.Equal(common.Hash{}, rawdb.ReadForkchoiceHead(tx))
+	require.True(forkChoice.Changed())
+	require.NoError(forkChoice.WriteTo(tx))
+	require.False(forkChoice.Changed())
+
+	require.Equal(startingHeadHash, rawdb.ReadForkchoiceHead(tx))
+	require.Equal(safeHash, rawdb.ReadForkchoiceSafe(tx))
+	require.Equal(common.Hash{}, rawdb.ReadForkchoiceFinalized(tx))
+	require.NotZero(rawdb.ReadForkchoiceUpdatedAt(tx))
+}
@@ -7,6 +7,9 @@ import (
 	"math/big"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
 
 	"github.com/ledgerwatch/erigon-lib/gointerfaces"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
@@ -38,18 +41,26 @@ const (
 // 3.0.0 - adding PoS interfaces
 var EthBackendAPIVersion = &types2.VersionReply{Major: 3, Minor: 0, Patch: 0}
 
+var (
+	forkchoiceUpdates         = metrics.GetOrCreateCounter("engine_forkchoice_updates")
+	forkchoiceHeadNumber      = metrics.GetOrCreateCounter(`engine_forkchoice{block="head"}`)
+	forkchoiceSafeNumber      = metrics.GetOrCreateCounter(`engine_forkchoice{block="safe"}`)
+	forkchoiceFinalizedNumber = metrics.GetOrCreateCounter(`engine_forkchoice{block="finalized"}`)
+)
+
 type EthBackendServer struct {
 	remote.UnimplementedETHBACKENDServer // must be embedded to have forward compatible implementations.
 
 	ctx         context.Context
 	eth         EthBackend
 	events      *Events
-	db          kv.RoDB
+	forkChoice  *ForkChoice
+	db          kv.RwDB
 	blockReader interfaces.BlockReader
 	config      *params.ChainConfig
 	// Block proposing for proof-of-stake
 	payloadId       uint64
-	pendingPayloads map[uint64]types2.ExecutionPayload
+	pendingPayloads map[uint64]*types2.ExecutionPayload
 	// Send reverse sync starting point to staged sync
 	reverseDownloadCh chan<- PayloadMessage
 	// Notify whether the current block being processed is Valid or not
@@ -83,12 +94,12 @@ type PayloadMessage struct {
 	Body   *types.RawBody
 }
 
-func NewEthBackendServer(ctx context.Context, eth EthBackend, db kv.RwDB, events *Events, blockReader interfaces.BlockReader,
+func NewEthBackendServer(ctx context.Context, eth EthBackend, db kv.RwDB, events *Events, forkChoice *ForkChoice, blockReader interfaces.BlockReader,
 	config *params.ChainConfig, reverseDownloadCh chan<- PayloadMessage, statusCh <-chan ExecutionStatus, waitingForBeaconChain *uint32,
 ) *EthBackendServer {
-	return &EthBackendServer{ctx: ctx, eth: eth, events: events, db: db, blockReader: blockReader, config: config,
+	return &EthBackendServer{ctx: ctx, eth: eth, events: events, forkChoice: forkChoice, db: db, blockReader: blockReader, config: config,
 		reverseDownloadCh: reverseDownloadCh, statusCh: statusCh, waitingForBeaconChain: waitingForBeaconChain,
-		pendingPayloads: make(map[uint64]types2.ExecutionPayload),
+		pendingPayloads: make(map[uint64]*types2.ExecutionPayload),
 	}
 }
 
@@ -207,7 +218,9 @@ func (s *EthBackendServer) EngineExecutePayloadV1(ctx context.Context, req *type
 
 	blockHash := gointerfaces.ConvertH256ToHash(req.BlockHash)
 	// Discard all previous prepared payloads if another block was proposed
-	s.pendingPayloads = make(map[uint64]types2.ExecutionPayload)
+	s.mu.Lock()
+	s.pendingPayloads = make(map[uint64]*types2.ExecutionPayload)
+	s.mu.Unlock()
 	// If another payload is already commissioned then we just reply with syncing
 	if atomic.LoadUint32(s.waitingForBeaconChain) == 0 {
 		// We are still syncing a commissioned payload
@@ -279,10 +292,24 @@ func (s *EthBackendServer) EngineGetPayloadV1(ctx context.Context, req *remote.E
 	}
 
 	payload, ok := s.pendingPayloads[req.PayloadId]
-	if ok {
-		return &payload, nil
+	if !ok {
+		return nil, fmt.Errorf("unknown payload")
+	}
+	return payload, nil
+}
+
+// LatestPayload - the latest payload assembled on top of given parent. Bids of relays compete with it, see builder.RelayProxy
+func (s *EthBackendServer) LatestPayload(parentHash common.Hash) (*types2.ExecutionPayload, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var latest *types2.ExecutionPayload
+	var latestID uint64
+	for id, payload := range s.pendingPayloads {
+		if gointerfaces.ConvertH256ToHash(payload.ParentHash) == parentHash && (latest == nil || id > latestID) {
+			latest, latestID = payload, id
+		}
 	}
-	return nil, fmt.Errorf("unknown payload")
+	return latest, latest != nil
 }
 
 // EngineForkChoiceUpdatedV1, either states new block head or request the assembling of a new bloc
@@ -292,12 +319,22 @@ func (s *EthBackendServer) EngineForkChoiceUpdatedV1(ctx context.Context, req *r
 	if s.config.TerminalTotalDifficulty == nil {
 		return nil, fmt.Errorf("not a proof-of-stake chain")
 	}
+	if err := s.recordForkchoice(ctx, req.Forkchoice); err != nil {
+		return nil, err
+	}
+	// Only fork choice update, no payload to assemble
+	if req.Prepare == nil {
+		return &remote.EngineForkChoiceUpdatedReply{
+			Status: "SUCCESS",
+		}, nil
+	}
 	// Check if parent equate to the head
 	parent := gointerfaces.ConvertH256ToHash(req.Forkchoice.HeadBlockHash)
 	tx, err := s.db.BeginRo(ctx)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
 	headHeader, err := rawdb.ReadHeaderByHash(tx, parent)
 	if err != nil {
@@ -311,7 +348,7 @@ func (s *EthBackendServer) EngineForkChoiceUpdatedV1(ctx context.Context, req *r
 	}
 
 	// Hash is incorrect because mining archittecture has yet to be implemented
-	s.pendingPayloads[s.payloadId] = types2.ExecutionPayload{
+	s.pendingPayloads[s.payloadId] = &types2.ExecutionPayload{
 		ParentHash:    req.Forkchoice.HeadBlockHash,
 		Coinbase:      req.Prepare.FeeRecipient,
 		Timestamp:     req.Prepare.Timestamp,
@@ -335,6 +372,36 @@ func (s *EthBackendServer) EngineForkChoiceUpdatedV1(ctx context.Context, req *r
 	}, nil
 }
 
+// recordForkchoice keeps head/safe/finalized markers of fork choice state in memory, stage loop stores them to db
+// to be served by RPC ("safe"/"finalized" block tags)
+func (s *EthBackendServer) recordForkchoice(ctx context.Context, forkchoice *remote.EngineForkChoiceUpdated) error {
+	if forkchoice == nil {
+		return fmt.Errorf("empty fork choice state")
+	}
+	head := gointerfaces.ConvertH256ToHash(forkchoice.HeadBlockHash)
+	safe := gointerfaces.ConvertH256ToHash(forkchoice.SafeBlockHash)
+	finalized := gointerfaces.ConvertH256ToHash(forkchoice.FinalizedBlockHash)
+	if err := s.db.View(ctx, func(tx kv.Tx) error {
+		for _, marker := range []struct {
+			hash    common.Hash
+			counter *metrics.Counter
+		}{{head, forkchoiceHeadNumber}, {safe, forkchoiceSafeNumber}, {finalized, forkchoiceFinalizedNumber}} {
+			if number := rawdb.ReadHeaderNumber(tx, marker.hash); number != nil {
+				marker.counter.Set(*number)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if s.forkChoice != nil {
+		s.forkChoice.Update(head, safe, finalized, uint64(time.Now().Unix()))
+	}
+	forkchoiceUpdates.Inc()
+	log.Debug("Fork choice updated", "head", head, "safe", safe, "finalized", finalized)
+	return nil
+}
+
 func (s *EthBackendServer) NodeInfo(_ context.Context, r *remote.NodesInfoRequest) (*remote.NodesInfoReply, error) {
 	nodesInfo, err := s.eth.NodesInfo(int(r.Limit))
 	if err != nil {
@@ -0,0 +1,119 @@
+package privateapi
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/export"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// ExportServer - service "export.Export", streams canonical blocks and state commitments for backup verification:
+// rpc Blocks(google.protobuf.BytesValue) returns (stream google.protobuf.BytesValue) - RLP of export.Request in,
+// RLP of export.Frame out
+type ExportServer interface {
+	Blocks(*wrapperspb.BytesValue, Export_BlocksServer) error
+}
+
+type Export_BlocksServer interface {
+	Send(*wrapperspb.BytesValue) error
+	grpc.ServerStream
+}
+
+type ExportStreamServer struct {
+	exporter *export.Exporter
+}
+
+func NewExportServer(exporter *export.Exporter) *ExportStreamServer {
+	return &ExportStreamServer{exporter: exporter}
+}
+
+func (s *ExportStreamServer) Blocks(in *wrapperspb.BytesValue, stream Export_BlocksServer) error {
+	req, err := export.DecodeRequest(in.GetValue())
+	if err != nil {
+		return err
+	}
+	return s.exporter.Export(stream.Context(), req, func(f *export.Frame) error {
+		data, err := rlp.EncodeToBytes(f)
+		if err != nil {
+			return err
+		}
+		return stream.Send(wrapperspb.Bytes(data))
+	})
+}
+
+func _Export_Blocks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(wrapperspb.BytesValue)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ExportServer).Blocks(m, &exportBlocksServer{stream})
+}
+
+type exportBlocksServer struct {
+	grpc.ServerStream
+}
+
+func (x *exportBlocksServer) Send(m *wrapperspb.BytesValue) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Export_ServiceDesc - hand-written descriptor of "export.Export" service, messages are protobuf well-known types
+var Export_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "export.Export",
+	HandlerType: (*ExportServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Blocks",
+			Handler:       _Export_Blocks_Handler,
+			ServerStreams: true,
+		},
+	},
+}
+
+// ExportClient - client of "export.Export" service
+type ExportClient interface {
+	Blocks(ctx context.Context, in *wrapperspb.BytesValue, opts ...grpc.CallOption) (Export_BlocksClient, error)
+}
+
+type Export_BlocksClient interface {
+	Recv() (*wrapperspb.BytesValue, error)
+	grpc.ClientStream
+}
+
+type exportClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewExportClient(cc grpc.ClientConnInterface) ExportClient {
+	return &exportClient{cc}
+}
+
+func (c *exportClient) Blocks(ctx context.Context, in *wrapperspb.BytesValue, opts ...grpc.CallOption) (Export_BlocksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Export_ServiceDesc.Streams[0], "/export.Export/Blocks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &exportBlocksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type exportBlocksClient struct {
+	grpc.ClientStream
+}
+
+func (x *exportBlocksClient) Recv() (*wrapperspb.BytesValue, error) {
+	m := new(wrapperspb.BytesValue)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,58 @@
+package privateapi
+
+import (
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+)
+
+// ForkChoice - the latest fork choice state received by engine API. Engine API only keeps it in memory,
+// stage loop stores it to db after sync cycle (see WriteTo) - to be served by RPC ("safe"/"finalized" block tags).
+type ForkChoice struct {
+	mu                    sync.Mutex
+	head, safe, finalized common.Hash
+	updatedAt             uint64
+	changed               bool
+}
+
+func NewForkChoice() *ForkChoice {
+	return &ForkChoice{}
+}
+
+// Update - empty safe or finalized hash means "not known yet", such markers keep previous values
+func (f *ForkChoice) Update(head, safe, finalized common.Hash, updatedAt uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.head = head
+	if safe != (common.Hash{}) {
+		f.safe = safe
+	}
+	if finalized != (common.Hash{}) {
+		f.finalized = finalized
+	}
+	f.updatedAt = updatedAt
+	f.changed = true
+}
+
+// WriteTo - stores the state if it was updated after previous call
+func (f *ForkChoice) WriteTo(tx kv.Putter) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.changed {
+		return nil
+	}
+	if err := rawdb.WriteForkchoice(tx, f.head, f.safe, f.finalized, f.updatedAt); err != nil {
+		return err
+	}
+	f.changed = false
+	return nil
+}
+
+// Changed - true if there is state to write
+func (f *ForkChoice) Changed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.changed
+}
@@ -0,0 +1,67 @@
+package privateapi
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/reexec"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// BlockProviderServer - service "reexec.BlockProvider", serves re-executable blocks to external fraud-proof systems:
+// rpc Block(google.protobuf.UInt64Value) returns (google.protobuf.BytesValue) - block number in, RLP of reexec.Block out
+type BlockProviderServer interface {
+	Block(context.Context, *wrapperspb.UInt64Value) (*wrapperspb.BytesValue, error)
+}
+
+type ReexecServer struct {
+	provider *reexec.Provider
+}
+
+func NewReexecServer(provider *reexec.Provider) *ReexecServer {
+	return &ReexecServer{provider: provider}
+}
+
+func (s *ReexecServer) Block(ctx context.Context, in *wrapperspb.UInt64Value) (*wrapperspb.BytesValue, error) {
+	block, err := s.provider.Block(ctx, in.GetValue())
+	if err != nil {
+		return nil, err
+	}
+	data, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return nil, err
+	}
+	return wrapperspb.Bytes(data), nil
+}
+
+func _BlockProvider_Block_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.UInt64Value)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlockProviderServer).Block(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/reexec.BlockProvider/Block",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlockProviderServer).Block(ctx, req.(*wrapperspb.UInt64Value))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// BlockProvider_ServiceDesc - hand-written descriptor of "reexec.BlockProvider" service, messages are protobuf well-known types
+var BlockProvider_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "reexec.BlockProvider",
+	HandlerType: (*BlockProviderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Block",
+			Handler:    _BlockProvider_Block_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
@@ -0,0 +1,127 @@
+package privateapi
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ledgerwatch/erigon/eth/txpoolevents"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// txPoolEventsBuffer - events of one stream waiting to be sent, stream loses events when client is slower
+const txPoolEventsBuffer = 4096
+
+// TxPoolEventsServer - service "txpoolevents.TxPoolEvents", streams changes of the transaction pool:
+// rpc Subscribe(google.protobuf.Empty) returns (stream google.protobuf.BytesValue) - JSON of txpoolevents.Event out
+type TxPoolEventsServer interface {
+	Subscribe(*emptypb.Empty, TxPoolEvents_SubscribeServer) error
+}
+
+type TxPoolEvents_SubscribeServer interface {
+	Send(*wrapperspb.BytesValue) error
+	grpc.ServerStream
+}
+
+type TxPoolEventsStreamServer struct {
+	bus *txpoolevents.Bus
+}
+
+func NewTxPoolEventsServer(bus *txpoolevents.Bus) *TxPoolEventsStreamServer {
+	return &TxPoolEventsStreamServer{bus: bus}
+}
+
+func (s *TxPoolEventsStreamServer) Subscribe(_ *emptypb.Empty, stream TxPoolEvents_SubscribeServer) error {
+	events, unsubscribe := s.bus.Subscribe(txPoolEventsBuffer)
+	defer unsubscribe()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case ev := <-events:
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+			if err = stream.Send(wrapperspb.Bytes(data)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func _TxPoolEvents_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(emptypb.Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TxPoolEventsServer).Subscribe(m, &txPoolEventsSubscribeServer{stream})
+}
+
+type txPoolEventsSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *txPoolEventsSubscribeServer) Send(m *wrapperspb.BytesValue) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// TxPoolEvents_ServiceDesc - hand-written descriptor of "txpoolevents.TxPoolEvents" service
+var TxPoolEvents_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "txpoolevents.TxPoolEvents",
+	HandlerType: (*TxPoolEventsServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _TxPoolEvents_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+}
+
+// TxPoolEventsClient - client of "txpoolevents.TxPoolEvents" service
+type TxPoolEventsClient interface {
+	Subscribe(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (TxPoolEvents_SubscribeClient, error)
+}
+
+type TxPoolEvents_SubscribeClient interface {
+	Recv() (*wrapperspb.BytesValue, error)
+	grpc.ClientStream
+}
+
+type txPoolEventsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTxPoolEventsClient(cc grpc.ClientConnInterface) TxPoolEventsClient {
+	return &txPoolEventsClient{cc}
+}
+
+func (c *txPoolEventsClient) Subscribe(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (TxPoolEvents_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &TxPoolEvents_ServiceDesc.Streams[0], "/txpoolevents.TxPoolEvents/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &txPoolEventsSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type txPoolEventsSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *txPoolEventsSubscribeClient) Recv() (*wrapperspb.BytesValue, error) {
+	m := new(wrapperspb.BytesValue)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -19,9 +19,46 @@ var DefaultMode = Mode{
 }
 
 type Experiments struct {
-	TEVM bool
+	TEVM        bool
+	StateAccess bool
+	StateDiffs  bool
+	Appearances bool
+	TxBloom     bool
 }
 
+// Names - enabled experiments, as in --experiments flag
+func (e Experiments) Names() []string {
+	names := []string{}
+	if e.TEVM {
+		names = append(names, "tevm")
+	}
+	if e.StateAccess {
+		names = append(names, "stateaccess")
+	}
+	if e.StateDiffs {
+		names = append(names, "statediffs")
+	}
+	if e.Appearances {
+		names = append(names, "appearances")
+	}
+	if e.TxBloom {
+		names = append(names, "txbloom")
+	}
+	return names
+}
+
+// storageModeStateAccess - key in kv.DatabaseInfo, same encoding as kv.StorageModeTEVM
+var storageModeStateAccess = []byte("smStateAccess")
+
+// storageModeStateDiffs - key in kv.DatabaseInfo, same encoding as kv.StorageModeTEVM
+var storageModeStateDiffs = []byte("smStateDiffs")
+
+// storageModeAppearances - key in kv.DatabaseInfo, same encoding as kv.StorageModeTEVM
+var storageModeAppearances = []byte("smAppearances")
+
+// storageModeTxBloom - key in kv.DatabaseInfo, same encoding as kv.StorageModeTEVM
+var storageModeTxBloom = []byte("smTxBloom")
+
 func FromCli(flags string, exactHistory, exactReceipts, exactTxIndex, exactCallTraces,
 	beforeH, beforeR, beforeT, beforeC uint64, experiments []string) (Mode, error) {
 	mode := DefaultMode
@@ -74,6 +111,14 @@ func FromCli(flags string, exactHistory, exactReceipts, exactTxIndex, exactCallT
 		switch ex {
 		case "tevm":
 			mode.Experiments.TEVM = true
+		case "stateaccess":
+			mode.Experiments.StateAccess = true
+		case "statediffs":
+			mode.Experiments.StateDiffs = true
+		case "appearances":
+			mode.Experiments.Appearances = true
+		case "txbloom":
+			mode.Experiments.TxBloom = true
 		case "":
 			// skip
 		default:
@@ -126,6 +171,30 @@ func Get(db kv.Getter) (Mode, error) {
 	}
 	prune.Experiments.TEVM = len(v) == 1 && v[0] == 1
 
+	v, err = db.GetOne(kv.DatabaseInfo, storageModeStateAccess)
+	if err != nil {
+		return prune, err
+	}
+	prune.Experiments.StateAccess = len(v) == 1 && v[0] == 1
+
+	v, err = db.GetOne(kv.DatabaseInfo, storageModeStateDiffs)
+	if err != nil {
+		return prune, err
+	}
+	prune.Experiments.StateDiffs = len(v) == 1 && v[0] == 1
+
+	v, err = db.GetOne(kv.DatabaseInfo, storageModeAppearances)
+	if err != nil {
+		return prune, err
+	}
+	prune.Experiments.Appearances = len(v) == 1 && v[0] == 1
+
+	v, err = db.GetOne(kv.DatabaseInfo, storageModeTxBloom)
+	if err != nil {
+		return prune, err
+	}
+	prune.Experiments.TxBloom = len(v) == 1 && v[0] == 1
+
 	return prune, nil
 }
 
@@ -218,8 +287,8 @@ func (m Mode) String() string {
 			long += fmt.Sprintf(" --prune.c.%s=%d", m.CallTraces.dbType(), m.CallTraces.toValue())
 		}
 	}
-	if m.Experiments.TEVM {
-		long += " --experiments.tevm=enabled"
+	for _, name := range m.Experiments.Names() {
+		long += " --experiments." + name + "=enabled"
 	}
 	return short + long
 }
@@ -254,6 +323,26 @@ func Override(db kv.RwTx, sm Mode) error {
 		return err
 	}
 
+	err = setMode(db, storageModeStateAccess, sm.Experiments.StateAccess)
+	if err != nil {
+		return err
+	}
+
+	err = setMode(db, storageModeStateDiffs, sm.Experiments.StateDiffs)
+	if err != nil {
+		return err
+	}
+
+	err = setMode(db, storageModeAppearances, sm.Experiments.Appearances)
+	if err != nil {
+		return err
+	}
+
+	err = setMode(db, storageModeTxBloom, sm.Experiments.TxBloom)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -284,6 +373,26 @@ func SetIfNotExist(db kv.GetPut, pm Mode) error {
 		return err
 	}
 
+	err = setModeOnEmpty(db, storageModeStateAccess, pm.Experiments.StateAccess)
+	if err != nil {
+		return err
+	}
+
+	err = setModeOnEmpty(db, storageModeStateDiffs, pm.Experiments.StateDiffs)
+	if err != nil {
+		return err
+	}
+
+	err = setModeOnEmpty(db, storageModeAppearances, pm.Experiments.Appearances)
+	if err != nil {
+		return err
+	}
+
+	err = setModeOnEmpty(db, storageModeTxBloom, pm.Experiments.TxBloom)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
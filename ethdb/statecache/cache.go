@@ -0,0 +1,235 @@
+// Package statecache wraps kvcache.Coherent of erigon-lib (state cache of rpcdaemon and txpool): counts hits,
+// misses and invalidations per table, allows to flush the cache and to resize it by its hit rate and free memory.
+package statecache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+)
+
+// Kinds of cached keys. Coherent cache keeps accounts and storage of kv.PlainState and kv.Code.
+const (
+	accountsTable = iota
+	storageTable
+	codeTable
+	tablesAmount
+)
+
+var tableNames = [tablesAmount]string{"accounts", "storage", "code"}
+
+func plainStateTable(k []byte) int {
+	if len(k) > 20 {
+		return storageTable
+	}
+	return accountsTable
+}
+
+type tableCounters struct {
+	requests, misses, invalidations uint64 // atomic
+}
+
+// Cache - kvcache.Cache with stats. Coherent cache can't be resized or flushed in place: Cache replaces it by new one.
+// Views opened before replacement keep working with old cache.
+type Cache struct {
+	lock      sync.RWMutex
+	cache     *kvcache.Coherent
+	cfg       kvcache.CoherentConfig
+	viewID    uint64 // of last OnNewBlock, new cache is started from it
+	hasViewID bool
+
+	tables                   [tablesAmount]tableCounters
+	resets, flushes, resizes uint64 // atomic
+}
+
+var _ kvcache.Cache = (*Cache)(nil) // compile-time interface check
+
+func New(cfg kvcache.CoherentConfig) *Cache {
+	c := &Cache{cache: kvcache.New(cfg), cfg: cfg}
+	for i := range c.tables {
+		t := &c.tables[i]
+		metrics.GetOrCreateGauge(fmt.Sprintf(`cache_table_total{result="hit",name="%s",table="%s"}`, cfg.MetricsLabel, tableNames[i]), func() float64 {
+			return float64(atomic.LoadUint64(&t.requests) - atomic.LoadUint64(&t.misses))
+		})
+		metrics.GetOrCreateGauge(fmt.Sprintf(`cache_table_total{result="miss",name="%s",table="%s"}`, cfg.MetricsLabel, tableNames[i]), func() float64 {
+			return float64(atomic.LoadUint64(&t.misses))
+		})
+		metrics.GetOrCreateGauge(fmt.Sprintf(`cache_invalidations_total{name="%s",table="%s"}`, cfg.MetricsLabel, tableNames[i]), func() float64 {
+			return float64(atomic.LoadUint64(&t.invalidations))
+		})
+	}
+	metrics.GetOrCreateGauge(fmt.Sprintf(`cache_resets_total{name="%s"}`, cfg.MetricsLabel), func() float64 {
+		return float64(atomic.LoadUint64(&c.resets))
+	})
+	metrics.GetOrCreateGauge(fmt.Sprintf(`cache_keys_limit{name="%s"}`, cfg.MetricsLabel), func() float64 {
+		return float64(c.KeysLimit())
+	})
+	return c
+}
+
+func (c *Cache) View(ctx context.Context, tx kv.Tx) (kvcache.CacheView, error) {
+	c.lock.RLock()
+	cache := c.cache
+	c.lock.RUnlock()
+	// cache reads db only on miss, so misses are counted by reads of tx
+	view, err := cache.View(ctx, &missTx{Tx: tx, tables: &c.tables})
+	if err != nil {
+		return nil, err
+	}
+	return &cacheView{view: view, tables: &c.tables}, nil
+}
+
+func (c *Cache) OnNewBlock(sc *remote.StateChangeBatch) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// Coherent cache drops all keys if it missed state changes (also on unwind)
+	if c.hasViewID && sc.DatabaseViewID != c.viewID+1 {
+		atomic.AddUint64(&c.resets, 1)
+	}
+	c.viewID, c.hasViewID = sc.DatabaseViewID, true
+	for _, change := range sc.ChangeBatch {
+		for _, acc := range change.Changes {
+			switch acc.Action {
+			case remote.Action_UPSERT, remote.Action_DELETE:
+				atomic.AddUint64(&c.tables[accountsTable].invalidations, 1)
+			case remote.Action_UPSERT_CODE:
+				atomic.AddUint64(&c.tables[accountsTable].invalidations, 1)
+				atomic.AddUint64(&c.tables[codeTable].invalidations, 1)
+			case remote.Action_CODE:
+				atomic.AddUint64(&c.tables[codeTable].invalidations, 1)
+			}
+			if c.cfg.WithStorage {
+				atomic.AddUint64(&c.tables[storageTable].invalidations, uint64(len(acc.StorageChanges)))
+			}
+		}
+	}
+	c.cache.OnNewBlock(sc)
+}
+
+func (c *Cache) Len() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.cache.Len()
+}
+
+func (c *Cache) KeysLimit() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.cfg.KeysLimit
+}
+
+// Flush - drops all keys
+func (c *Cache) Flush() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.replace(c.cfg)
+	atomic.AddUint64(&c.flushes, 1)
+}
+
+// Resize - drops all keys if limit changes
+func (c *Cache) Resize(keysLimit int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if keysLimit == c.cfg.KeysLimit {
+		return
+	}
+	cfg := c.cfg
+	cfg.KeysLimit = keysLimit
+	c.replace(cfg)
+	atomic.AddUint64(&c.resizes, 1)
+}
+
+// replace - new cache starts from view of last OnNewBlock, otherwise its views would wait for next block
+// (see CoherentConfig.NewBlockWait). Empty cache is coherent with any view.
+func (c *Cache) replace(cfg kvcache.CoherentConfig) {
+	c.cfg = cfg
+	c.cache = kvcache.New(cfg)
+	if c.hasViewID {
+		c.cache.OnNewBlock(&remote.StateChangeBatch{DatabaseViewID: c.viewID})
+	}
+}
+
+// TableStats - counters since start of process
+type TableStats struct {
+	Name          string  `json:"name"`
+	Hits          uint64  `json:"hits"`
+	Misses        uint64  `json:"misses"`
+	HitRate       float64 `json:"hitRate"`
+	Invalidations uint64  `json:"invalidations"` // keys changed by new blocks
+}
+
+type Stats struct {
+	Keys      int          `json:"keys"` // accounts and storage, code is limited separately
+	KeysLimit int          `json:"keysLimit"`
+	ViewID    uint64       `json:"viewID"`
+	Tables    []TableStats `json:"tables"`
+	Resets    uint64       `json:"resets"` // cache dropped keys because it missed state changes
+	Flushes   uint64       `json:"flushes"`
+	Resizes   uint64       `json:"resizes"`
+}
+
+func (c *Cache) Stats() *Stats {
+	c.lock.RLock()
+	s := &Stats{Keys: c.cache.Len(), KeysLimit: c.cfg.KeysLimit, ViewID: c.viewID}
+	c.lock.RUnlock()
+	s.Resets, s.Flushes, s.Resizes = atomic.LoadUint64(&c.resets), atomic.LoadUint64(&c.flushes), atomic.LoadUint64(&c.resizes)
+	for i := range c.tables {
+		t := &c.tables[i]
+		misses := atomic.LoadUint64(&t.misses)
+		requests := atomic.LoadUint64(&t.requests)
+		if misses > requests { // counters are loaded not atomically together
+			requests = misses
+		}
+		ts := TableStats{Name: tableNames[i], Hits: requests - misses, Misses: misses, Invalidations: atomic.LoadUint64(&t.invalidations)}
+		if requests > 0 {
+			ts.HitRate = float64(ts.Hits) / float64(requests)
+		}
+		s.Tables = append(s.Tables, ts)
+	}
+	return s
+}
+
+// requests - of accounts and storage, they are limited by KeysLimit
+func (c *Cache) requests() (requests, misses uint64) {
+	for _, table := range []int{accountsTable, storageTable} {
+		requests += atomic.LoadUint64(&c.tables[table].requests)
+		misses += atomic.LoadUint64(&c.tables[table].misses)
+	}
+	return requests, misses
+}
+
+type cacheView struct {
+	view   kvcache.CacheView
+	tables *[tablesAmount]tableCounters
+}
+
+func (v *cacheView) Get(k []byte) ([]byte, error) {
+	atomic.AddUint64(&v.tables[plainStateTable(k)].requests, 1)
+	return v.view.Get(k)
+}
+
+func (v *cacheView) GetCode(k []byte) ([]byte, error) {
+	atomic.AddUint64(&v.tables[codeTable].requests, 1)
+	return v.view.GetCode(k)
+}
+
+type missTx struct {
+	kv.Tx
+	tables *[tablesAmount]tableCounters
+}
+
+func (tx *missTx) GetOne(table string, k []byte) ([]byte, error) {
+	switch table {
+	case kv.PlainState:
+		atomic.AddUint64(&tx.tables[plainStateTable(k)].misses, 1)
+	case kv.Code:
+		atomic.AddUint64(&tx.tables[codeTable].misses, 1)
+	}
+	return tx.Tx.GetOne(table, k)
+}
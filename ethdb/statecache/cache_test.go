@@ -0,0 +1,108 @@
+package statecache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheStats(t *testing.T) {
+	ctx := context.Background()
+	db := memdb.NewTestDB(t)
+	k1 := [20]byte{1}
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error { return tx.Put(kv.PlainState, k1[:], []byte{1}) }))
+
+	cfg := kvcache.DefaultCoherentConfig
+	cfg.MetricsLabel = "statecache_test"
+	c := New(cfg)
+	tx, err := db.BeginRo(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	id := tx.ViewID()
+	c.OnNewBlock(&remote.StateChangeBatch{DatabaseViewID: id})
+
+	view, err := c.View(ctx, tx)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		v, err := view.Get(k1[:])
+		require.NoError(t, err)
+		require.Equal(t, []byte{1}, v)
+	}
+	_, err = view.Get(make([]byte, 20+8+32))
+	require.NoError(t, err)
+	_, err = view.GetCode(make([]byte, 32))
+	require.NoError(t, err)
+	require.Equal(t, 2, c.Len())
+
+	s := c.Stats()
+	require.Equal(t, id, s.ViewID)
+	require.Equal(t, TableStats{Name: "accounts", Hits: 2, Misses: 1, HitRate: 2.0 / 3}, s.Tables[0])
+	require.Equal(t, TableStats{Name: "storage", Misses: 1}, s.Tables[1])
+	require.Equal(t, TableStats{Name: "code", Misses: 1}, s.Tables[2])
+
+	// new cache starts from same view: keys are read from db again
+	c.Flush()
+	require.Equal(t, 0, c.Len())
+	view, err = c.View(ctx, tx)
+	require.NoError(t, err)
+	_, err = view.Get(k1[:])
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), c.Stats().Tables[0].Misses)
+	require.Equal(t, 1, c.Len())
+
+	c.Resize(10)
+	require.Equal(t, 10, c.KeysLimit())
+	c.Resize(10)
+	s = c.Stats()
+	require.Equal(t, uint64(1), s.Flushes)
+	require.Equal(t, uint64(1), s.Resizes)
+
+	c.OnNewBlock(&remote.StateChangeBatch{DatabaseViewID: id + 1, ChangeBatch: []*remote.StateChange{{
+		Changes: []*remote.AccountChange{{
+			Action:  remote.Action_UPSERT,
+			Address: gointerfaces.ConvertAddressToH160(k1),
+			StorageChanges: []*remote.StorageChange{
+				{Location: gointerfaces.ConvertHashToH256([32]byte{1})},
+				{Location: gointerfaces.ConvertHashToH256([32]byte{2})},
+			},
+		}},
+	}}})
+	s = c.Stats()
+	require.Equal(t, uint64(1), s.Tables[0].Invalidations)
+	require.Equal(t, uint64(2), s.Tables[1].Invalidations)
+	require.Equal(t, uint64(0), s.Resets)
+
+	c.OnNewBlock(&remote.StateChangeBatch{DatabaseViewID: id + 5})
+	require.Equal(t, uint64(1), c.Stats().Resets)
+}
+
+func TestTunedLimit(t *testing.T) {
+	cfg := TuneConfig{MinKeys: 100, MaxKeys: 1000, TargetHitRate: 0.9, MinRequests: 100, MinFreeMemory: 0.1}
+	const total = 100 * 1024 * 1024
+	for _, tt := range []struct {
+		name                        string
+		limit, keys                 int
+		requests, misses, available uint64
+		expect                      int
+	}{
+		{name: "low hit rate, full", limit: 200, keys: 200, requests: 1000, misses: 500, available: total / 2, expect: 400},
+		{name: "high hit rate", limit: 200, keys: 200, requests: 1000, misses: 50, available: total / 2, expect: 200},
+		{name: "few requests", limit: 200, keys: 200, requests: 10, misses: 10, available: total / 2, expect: 200},
+		{name: "not full", limit: 200, keys: 100, requests: 1000, misses: 500, available: total / 2, expect: 200},
+		{name: "max keys", limit: 600, keys: 600, requests: 1000, misses: 500, available: total / 2, expect: 600},
+		{name: "not enough memory to grow", limit: 200, keys: 200, requests: 1000, misses: 500, available: total/10 + 200*BytesPerKey - 1, expect: 200},
+		{name: "low memory", limit: 400, keys: 400, requests: 1000, misses: 500, available: total / 20, expect: 200},
+		{name: "low memory, min keys", limit: 150, keys: 150, available: total / 20, expect: 100},
+		{name: "low memory, below min keys", limit: 50, keys: 50, available: total / 20, expect: 50},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expect, tunedLimit(cfg, tt.limit, tt.keys, tt.requests, tt.misses, tt.available, total))
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package statecache
+
+import (
+	"context"
+	"time"
+
+	"github.com/ledgerwatch/log/v3"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// BytesPerKey - approximate RAM of cached key with value and btree/list overhead
+const BytesPerKey = 2 * 1024
+
+// TuneConfig - limits of AutoTune. Resize drops all keys of cache, so it's done rarely and only by big steps.
+type TuneConfig struct {
+	Every         time.Duration // how often to check hit rate
+	MinKeys       int
+	MaxKeys       int
+	TargetHitRate float64 // cache grows while its hit rate is lower
+	MinRequests   uint64  // ignore periods with less requests: hit rate is not representative
+	MinFreeMemory float64 // share of total memory which must stay available, cache shrinks if less is available
+}
+
+var DefaultTuneConfig = TuneConfig{
+	Every:         5 * time.Minute,
+	MinKeys:       100_000,
+	MaxKeys:       8_000_000,
+	TargetHitRate: 0.9,
+	MinRequests:   10_000,
+	MinFreeMemory: 0.1,
+}
+
+// AutoTune - grows cache (x2) while hit rate is low, cache is full and memory allows, shrinks it (/2) if available
+// memory is low. Blocks until ctx is done.
+func (c *Cache) AutoTune(ctx context.Context, cfg TuneConfig) {
+	ticker := time.NewTicker(cfg.Every)
+	defer ticker.Stop()
+	lastRequests, lastMisses := c.requests()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		vm, err := mem.VirtualMemory()
+		if err != nil {
+			log.Warn("[StateCache] can't read memory stats, auto-tuning disabled", "err", err)
+			return
+		}
+		requests, misses := c.requests()
+		periodRequests, periodMisses := requests-lastRequests, misses-lastMisses
+		lastRequests, lastMisses = requests, misses
+		limit := c.KeysLimit()
+		newLimit := tunedLimit(cfg, limit, c.Len(), periodRequests, periodMisses, vm.Available, vm.Total)
+		if newLimit == limit {
+			continue
+		}
+		log.Info("[StateCache] resize", "keys", limit, "newKeys", newLimit,
+			"hitRate", hitRate(periodRequests, periodMisses), "availableMem", vm.Available)
+		c.Resize(newLimit)
+		lastRequests, lastMisses = c.requests()
+	}
+}
+
+func hitRate(requests, misses uint64) float64 {
+	if requests == 0 {
+		return 0
+	}
+	return float64(requests-misses) / float64(requests)
+}
+
+// tunedLimit - keys limit of cache for next period, requests and misses are counted over last period
+func tunedLimit(cfg TuneConfig, limit, keys int, requests, misses, available, total uint64) int {
+	minFree := uint64(cfg.MinFreeMemory * float64(total))
+	if available < minFree {
+		if limit <= cfg.MinKeys {
+			return limit
+		}
+		if limit/2 < cfg.MinKeys {
+			return cfg.MinKeys
+		}
+		return limit / 2
+	}
+	if requests < cfg.MinRequests || hitRate(requests, misses) >= cfg.TargetHitRate {
+		return limit
+	}
+	if keys < limit*9/10 { // misses are not caused by evictions
+		return limit
+	}
+	if limit*2 > cfg.MaxKeys || available-minFree < uint64(limit)*BytesPerKey {
+		return limit
+	}
+	return limit * 2
+}
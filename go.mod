@@ -37,6 +37,7 @@ require (
 	github.com/json-iterator/go v1.1.12
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/kevinburke/go-bindata v3.21.0+incompatible
+	github.com/klauspost/compress v1.17.0
 	github.com/ledgerwatch/erigon-lib v0.0.0-20211231112434-5f40a789859a
 	github.com/ledgerwatch/log/v3 v3.4.0
 	github.com/ledgerwatch/secp256k1 v1.0.0
@@ -21,9 +21,15 @@ import (
 	"net/http"
 	_ "net/http/pprof" //nolint:gosec
 	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/c2h5oh/datasize"
 
-	metrics2 "github.com/VictoriaMetrics/metrics"
 	"github.com/ledgerwatch/erigon/common/fdlimit"
+	"github.com/ledgerwatch/erigon/common/logging"
+	"github.com/ledgerwatch/erigon/common/otel"
+	"github.com/ledgerwatch/erigon/common/profiling"
 	"github.com/ledgerwatch/erigon/metrics"
 	"github.com/ledgerwatch/erigon/metrics/exp"
 	"github.com/ledgerwatch/log/v3"
@@ -39,7 +45,11 @@ var (
 	}
 	logjsonFlag = cli.BoolFlag{
 		Name:  "log.json",
-		Usage: "Format logs with JSON",
+		Usage: "Format logs with JSON, records of subsystems have key \"subsystem\"",
+	}
+	logLevelsFlag = cli.StringFlag{
+		Name:  "log.levels",
+		Usage: "Logging verbosity of subsystems (downloader, sentry, stages, rpcdaemon, txpool), overrides --verbosity: comma-separated list of <subsystem>=<level> (e.g. stages=debug,txpool=warn). Changed at runtime by admin_setLogLevel",
 	}
 	//nolint
 	vmoduleFlag = cli.StringFlag{
@@ -72,17 +82,49 @@ var (
 		Name:  "pprof.cpuprofile",
 		Usage: "Write CPU profile to the given file",
 	}
+	pprofDirFlag = cli.StringFlag{
+		Name:  "pprof.dir",
+		Usage: "Directory of periodic CPU/heap profiles (--pprof.continuous.interval) and heap dumps (--pprof.heapdump.rss)",
+	}
+	pprofIntervalFlag = cli.DurationFlag{
+		Name:  "pprof.continuous.interval",
+		Usage: "Capture CPU (30s) and heap profiles with given interval into --pprof.dir and/or --pprof.continuous.push, 0 - disabled",
+	}
+	pprofKeepFlag = cli.IntFlag{
+		Name:  "pprof.continuous.keep",
+		Usage: "Number of the latest profiles of each kind (cpu, heap, heapdump) kept in --pprof.dir",
+		Value: 24,
+	}
+	pprofPushFlag = cli.StringFlag{
+		Name:  "pprof.continuous.push",
+		Usage: "Push periodic profiles to Pyroscope server (e.g. http://localhost:4040)",
+	}
+	heapDumpRSSFlag = cli.StringFlag{
+		Name:  "pprof.heapdump.rss",
+		Usage: "Write heap profile into --pprof.dir when RSS of the process crosses given size (e.g. 24GB)",
+	}
 	traceFlag = cli.StringFlag{
 		Name:  "trace",
 		Usage: "Write execution trace to the given file",
 	}
+	otelEndpointFlag = cli.StringFlag{
+		Name:  "otel.endpoint",
+		Usage: "Export OpenTelemetry spans of RPC requests and sync cycles to OTLP/HTTP collector (e.g. http://localhost:4318)",
+	}
+	otelSampleFlag = cli.Float64Flag{
+		Name:  "otel.sample",
+		Usage: "Share of traced RPC requests and sync cycles: 1 - all, 0.01 - every hundredth",
+		Value: 1,
+	}
 )
 
 // Flags holds all command-line flags required for debugging.
 var Flags = []cli.Flag{
-	verbosityFlag, logjsonFlag, //backtraceAtFlag, vmoduleFlag, debugFlag,
+	verbosityFlag, logjsonFlag, logLevelsFlag, //backtraceAtFlag, vmoduleFlag, debugFlag,
 	pprofFlag, pprofAddrFlag, pprofPortFlag,
 	cpuprofileFlag, traceFlag,
+	pprofDirFlag, pprofIntervalFlag, pprofKeepFlag, pprofPushFlag, heapDumpRSSFlag,
+	otelEndpointFlag, otelSampleFlag,
 }
 
 //var glogger *log.GlogHandler
@@ -119,7 +161,17 @@ func SetupCobra(cmd *cobra.Command) error {
 		_, glogger = log.SetupDefaultTerminalLogger(log.Lvl(lvl), vmodule, backtrace)
 		log.PrintOrigins(dbg)
 	*/
-	log.Root().SetHandler(log.LvlFilterHandler(log.Lvl(lvl), log.StderrHandler))
+	logJson, err := flags.GetBool(logjsonFlag.Name)
+	if err != nil {
+		return err
+	}
+	logLevels, err := flags.GetString(logLevelsFlag.Name)
+	if err != nil {
+		return err
+	}
+	if err = setupLogging(log.Lvl(lvl), logJson, logLevels); err != nil {
+		return err
+	}
 
 	traceFile, err := flags.GetString(traceFlag.Name)
 	if err != nil {
@@ -142,6 +194,42 @@ func SetupCobra(cmd *cobra.Command) error {
 		}
 	}
 
+	otelEndpoint, err := flags.GetString(otelEndpointFlag.Name)
+	if err != nil {
+		return err
+	}
+	otelSample, err := flags.GetFloat64(otelSampleFlag.Name)
+	if err != nil {
+		return err
+	}
+	if err = setupOtel(otelEndpoint, otelSample); err != nil {
+		return err
+	}
+
+	pprofDir, err := flags.GetString(pprofDirFlag.Name)
+	if err != nil {
+		return err
+	}
+	pprofInterval, err := flags.GetDuration(pprofIntervalFlag.Name)
+	if err != nil {
+		return err
+	}
+	pprofKeep, err := flags.GetInt(pprofKeepFlag.Name)
+	if err != nil {
+		return err
+	}
+	pprofPush, err := flags.GetString(pprofPushFlag.Name)
+	if err != nil {
+		return err
+	}
+	heapDumpRSS, err := flags.GetString(heapDumpRSSFlag.Name)
+	if err != nil {
+		return err
+	}
+	if err = setupProfiling(pprofDir, pprofInterval, pprofKeep, pprofPush, heapDumpRSS); err != nil {
+		return err
+	}
+
 	go ListenSignals(nil)
 	pprof, err := flags.GetBool(pprofFlag.Name)
 	if err != nil {
@@ -182,15 +270,9 @@ func SetupCobra(cmd *cobra.Command) error {
 // It should be called as early as possible in the program.
 func Setup(ctx *cli.Context) error {
 	RaiseFdLimit()
-	//var ostream log.Handler
-	//output := io.Writer(os.Stderr)
-	if ctx.GlobalBool(logjsonFlag.Name) {
-		log.Root().SetHandler(log.LvlFilterHandler(log.Lvl(ctx.GlobalInt(verbosityFlag.Name)), log.StreamHandler(os.Stderr, log.JsonFormat())))
-		//ostream = log.StreamHandler(output, log.JsonFormat())
-	} else {
-		log.Root().SetHandler(log.LvlFilterHandler(log.Lvl(ctx.GlobalInt(verbosityFlag.Name)), log.StderrHandler))
-	}
-	//log.Root().SetHandler(ostream)
+	if err := setupLogging(log.Lvl(ctx.GlobalInt(verbosityFlag.Name)), ctx.GlobalBool(logjsonFlag.Name), ctx.GlobalString(logLevelsFlag.Name)); err != nil {
+		return err
+	}
 
 	/*
 		glogger.SetHandler(ostream)
@@ -214,6 +296,13 @@ func Setup(ctx *cli.Context) error {
 			return err
 		}
 	}
+	if err := setupOtel(ctx.GlobalString(otelEndpointFlag.Name), ctx.GlobalFloat64(otelSampleFlag.Name)); err != nil {
+		return err
+	}
+	if err := setupProfiling(ctx.GlobalString(pprofDirFlag.Name), ctx.GlobalDuration(pprofIntervalFlag.Name),
+		ctx.GlobalInt(pprofKeepFlag.Name), ctx.GlobalString(pprofPushFlag.Name), ctx.GlobalString(heapDumpRSSFlag.Name)); err != nil {
+		return err
+	}
 	pprofEnabled := ctx.GlobalBool(pprofFlag.Name)
 	metricsAddr := ctx.GlobalString(metricsAddrFlag.Name)
 
@@ -236,12 +325,49 @@ func Setup(ctx *cli.Context) error {
 	return nil
 }
 
+// setupLogging - stderr handler, text or JSON, filtering records by level of their subsystem, see logging.SetLevels
+func setupLogging(verbosity log.Lvl, json bool, levels string) error {
+	h := log.StderrHandler
+	if json {
+		h = log.StreamHandler(os.Stderr, log.JsonFormat())
+	}
+	log.Root().SetHandler(logging.Handler(verbosity, json, h))
+	return logging.SetLevels(levels)
+}
+
+// setupOtel - exports spans, if endpoint is set. Service name is the name of binary: erigon, rpcdaemon, ...
+func setupOtel(endpoint string, sample float64) error {
+	if endpoint == "" {
+		return nil
+	}
+	return otel.Setup(endpoint, filepath.Base(os.Args[0]), sample)
+}
+
+// setupProfiling - periodic profiles and heap dumps, if interval or RSS threshold is set. Pushed profiles are named
+// after binary: erigon.cpu, rpcdaemon.heap, ...
+func setupProfiling(dir string, interval time.Duration, keep int, push string, heapDumpRSS string) error {
+	cfg := profiling.Config{Dir: dir, Interval: interval, Keep: keep, PushURL: push, App: filepath.Base(os.Args[0])}
+	if heapDumpRSS != "" {
+		var size datasize.ByteSize
+		if err := size.UnmarshalText([]byte(heapDumpRSS)); err != nil {
+			return fmt.Errorf("--%s: %w", heapDumpRSSFlag.Name, err)
+		}
+		cfg.HeapDumpRSS = size.Bytes()
+	}
+	if cfg.Interval == 0 && cfg.HeapDumpRSS == 0 {
+		return nil
+	}
+	return profiling.Start(cfg)
+}
+
 func StartPProf(address string, withMetrics bool) {
 	// Hook go-metrics into expvar on any /debug/metrics request, load all vars
 	// from the registry into expvar, and execute regular expvar handler.
 	if withMetrics {
 		http.HandleFunc("/debug/metrics/prometheus", func(w http.ResponseWriter, req *http.Request) {
-			metrics2.WritePrometheus(w, true)
+			if err := exp.WritePrometheus(w, true); err != nil {
+				log.Warn("Failure in writing metrics", "err", err)
+			}
 		})
 	}
 	cpuMsg := fmt.Sprintf("go tool pprof -lines -http=: http://%s/%s", address, "debug/pprof/profile?seconds=20")
@@ -259,6 +385,8 @@ func StartPProf(address string, withMetrics bool) {
 func Exit() {
 	_ = Handler.StopCPUProfile()
 	_ = Handler.StopGoTrace()
+	otel.Shutdown()
+	profiling.Stop()
 }
 
 // RaiseFdLimit raises out the number of allowed file handles per process
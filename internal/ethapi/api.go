@@ -160,6 +160,44 @@ type Account struct {
 	StateDiff *map[common.Hash]uint256.Int `json:"stateDiff"`
 }
 
+// BlockOverrides is a set of header fields to override during the execution of a message call.
+type BlockOverrides struct {
+	Number     *hexutil.Big    `json:"number"`
+	Difficulty *hexutil.Big    `json:"difficulty"`
+	Time       *hexutil.Uint64 `json:"time"`
+	GasLimit   *hexutil.Uint64 `json:"gasLimit"`
+	Coinbase   *common.Address `json:"coinbase"`
+	BaseFee    *hexutil.Big    `json:"baseFee"`
+}
+
+// Override returns a copy of header with overridden fields
+func (o *BlockOverrides) Override(header *types.Header) *types.Header {
+	if o == nil {
+		return header
+	}
+	header = types.CopyHeader(header)
+	if o.Number != nil {
+		header.Number = o.Number.ToInt()
+	}
+	if o.Difficulty != nil {
+		header.Difficulty = o.Difficulty.ToInt()
+	}
+	if o.Time != nil {
+		header.Time = uint64(*o.Time)
+	}
+	if o.GasLimit != nil {
+		header.GasLimit = uint64(*o.GasLimit)
+	}
+	if o.Coinbase != nil {
+		header.Coinbase = *o.Coinbase
+	}
+	if o.BaseFee != nil {
+		header.BaseFee = o.BaseFee.ToInt()
+		header.Eip1559 = true
+	}
+	return header
+}
+
 func NewRevertError(result *core.ExecutionResult) *RevertError {
 	reason, errUnpack := abi.UnpackRevert(result.Revert())
 	err := errors.New("execution reverted")
@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"sync"
 
-	metrics2 "github.com/VictoriaMetrics/metrics"
 	"github.com/ledgerwatch/erigon/metrics"
 	"github.com/ledgerwatch/log/v3"
 )
@@ -46,7 +45,9 @@ func ExpHandler(r metrics.Registry) http.Handler {
 // This function enables metrics reporting separate from pprof.
 func Setup(address string) {
 	http.HandleFunc("/debug/metrics/prometheus", func(w http.ResponseWriter, r *http.Request) {
-		metrics2.WritePrometheus(w, true)
+		if err := WritePrometheus(w, true); err != nil {
+			log.Warn("Failure in writing metrics", "err", err)
+		}
 	})
 	//m.Handle("/debug/metrics", ExpHandler(metrics.DefaultRegistry))
 	//m.Handle("/debug/metrics/prometheus2", promhttp.HandlerFor(prometheus2.DefaultGatherer, promhttp.HandlerOpts{
@@ -0,0 +1,102 @@
+package exp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	metrics2 "github.com/VictoriaMetrics/metrics"
+)
+
+// Family - documented metric family. Names and labels of families are stable: dashboards rely on them, so family is
+// renamed or its labels are changed only together with ./cmd/prometheus/dashboards
+type Family struct {
+	Name   string
+	Type   string // counter, gauge or summary
+	Labels []string
+	Help   string
+}
+
+// Registry - metric families exposed by /debug/metrics/prometheus with # HELP and # TYPE, see ./cmd/prometheus/Readme.md.
+// Metrics which are not listed here are exposed as is
+var Registry = []Family{
+	{Name: "rpc_requests_total", Type: "counter", Labels: []string{"method", "status"}, Help: "JSON-RPC calls, status is success or failure"},
+	{Name: "rpc_duration_seconds", Type: "summary", Labels: []string{"method", "status"}, Help: "Duration of JSON-RPC calls"},
+
+	{Name: "sync", Type: "gauge", Labels: []string{"chain", "stage"}, Help: "Progress of sync stage, block number"},
+	{Name: "sync_stage_duration_seconds", Type: "summary", Labels: []string{"chain", "stage", "action"}, Help: "Duration of sync stage runs, action is forward, unwind or prune"},
+	{Name: "sync_pruned_rows_total", Type: "counter", Labels: []string{"chain", "table"}, Help: "Keys deleted from database table by pruning of sync stages"},
+
+	{Name: "p2p_peers", Type: "gauge", Labels: []string{"client"}, Help: "Connected peers by client name they advertise, other - for unknown clients"},
+	{Name: "p2p_connections", Type: "gauge", Help: "Open p2p connections, including ones in handshake"},
+	{Name: "p2p_dials", Type: "counter", Help: "Outbound p2p connections"},
+	{Name: "p2p_serves", Type: "counter", Help: "Inbound p2p connections"},
+	{Name: "p2p_ingress", Type: "counter", Help: "Bytes received from peers"},
+	{Name: "p2p_egress", Type: "counter", Help: "Bytes sent to peers"},
+}
+
+// family - documented family of the exposed line, summaries are exposed as name{quantile}, name_sum and name_count
+func family(families map[string]*Family, line string) *Family {
+	name := line
+	if i := strings.IndexAny(name, "{ "); i >= 0 {
+		name = name[:i]
+	}
+	if f, ok := families[name]; ok {
+		return f
+	}
+	for _, suffix := range []string{"_sum", "_count"} {
+		if f, ok := families[strings.TrimSuffix(name, suffix)]; ok && f.Type == "summary" && strings.HasSuffix(name, suffix) {
+			return f
+		}
+	}
+	return nil
+}
+
+// WritePrometheus - writes all metrics in Prometheus text format. Lines of documented families are grouped and
+// preceded by their # HELP and # TYPE
+func WritePrometheus(w io.Writer, exposeProcessMetrics bool) error {
+	var buf bytes.Buffer
+	metrics2.WritePrometheus(&buf, exposeProcessMetrics)
+	return writeFamilies(w, &buf, Registry)
+}
+
+func writeFamilies(w io.Writer, r io.Reader, registry []Family) error {
+	families := make(map[string]*Family, len(registry))
+	for i := range registry {
+		families[registry[i].Name] = &registry[i]
+	}
+	documented := map[string][]string{}
+	bw := bufio.NewWriter(w)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if f := family(families, line); f != nil {
+			documented[f.Name] = append(documented[f.Name], line)
+			continue
+		}
+		if _, err := fmt.Fprintln(bw, line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for _, f := range registry {
+		lines, ok := documented[f.Name]
+		if !ok {
+			continue
+		}
+		if _, err := fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", f.Name, f.Help, f.Name, f.Type); err != nil {
+			return err
+		}
+		for _, line := range lines {
+			if _, err := fmt.Fprintln(bw, line); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,42 @@
+package exp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFamilies(t *testing.T) {
+	in := strings.Join([]string{
+		`db_size 10`,
+		`rpc_duration_seconds{method="eth_call",status="success",quantile="0.5"} 0.1`,
+		`rpc_duration_seconds_count{method="eth_call",status="success"} 3`,
+		`rpc_duration_seconds_sum{method="eth_call",status="success"} 0.3`,
+		`rpc_requests_total{method="eth_call",status="success"} 3`,
+		`sync_stage_duration_seconds_count{stage="headers",action="forward"} 1`,
+		`sync{stage="headers"} 100`,
+		`sync_stage_duration_seconds_sum{stage="headers",action="forward"} 2`,
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	require.NoError(t, writeFamilies(&out, strings.NewReader(in), Registry))
+	require.Equal(t, strings.Join([]string{
+		`db_size 10`,
+		`# HELP rpc_requests_total JSON-RPC calls, status is success or failure`,
+		`# TYPE rpc_requests_total counter`,
+		`rpc_requests_total{method="eth_call",status="success"} 3`,
+		`# HELP rpc_duration_seconds Duration of JSON-RPC calls`,
+		`# TYPE rpc_duration_seconds summary`,
+		`rpc_duration_seconds{method="eth_call",status="success",quantile="0.5"} 0.1`,
+		`rpc_duration_seconds_count{method="eth_call",status="success"} 3`,
+		`rpc_duration_seconds_sum{method="eth_call",status="success"} 0.3`,
+		`# HELP sync Progress of sync stage, block number`,
+		`# TYPE sync gauge`,
+		`sync{stage="headers"} 100`,
+		`# HELP sync_stage_duration_seconds Duration of sync stage runs, action is forward, unwind or prune`,
+		`# TYPE sync_stage_duration_seconds summary`,
+		`sync_stage_duration_seconds_count{stage="headers",action="forward"} 1`,
+		`sync_stage_duration_seconds_sum{stage="headers",action="forward"} 2`,
+	}, "\n")+"\n", out.String())
+}
@@ -21,4 +21,8 @@ var dbSchemaVersion5 = Migration{
 		}
 		return tx.Commit()
 	},
+	Down: func(db kv.RwDB, tmpdir string) error {
+		// nothing to revert, Rollback restores previous schema version
+		return nil
+	},
 }
@@ -0,0 +1,100 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// Estimate - approximate amount of work of migration
+type Estimate struct {
+	Entries  uint64            // amount of records migration will read
+	Size     datasize.ByteSize // extra disk space: new tables and ETL files, before old tables are dropped
+	Duration time.Duration
+}
+
+// estimateTable - estimation for migrations which rewrite all records of one table through ETL:
+// new table and ETL files take ~size of old table each, and records processed with speed of entriesPerSecond
+func estimateTable(tx kv.Tx, table string, entriesPerSecond uint64) (Estimate, error) {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return Estimate{}, err
+	}
+	defer c.Close()
+	entries, err := c.Count()
+	if err != nil {
+		return Estimate{}, err
+	}
+	size, err := tx.BucketSize(table)
+	if err != nil {
+		return Estimate{}, err
+	}
+	return Estimate{
+		Entries:  entries,
+		Size:     datasize.ByteSize(2 * size),
+		Duration: time.Duration(entries/entriesPerSecond) * time.Second,
+	}, nil
+}
+
+// Plan - what Apply will do with migration
+type Plan struct {
+	Name     string
+	Resumed  bool      // migration was interrupted and will continue from checkpoint
+	Estimate *Estimate // nil if migration has no estimation
+	Rollback bool      // migration can be reverted by Migrator.Rollback
+}
+
+func (p Plan) String() string {
+	s := p.Name
+	if p.Resumed {
+		s += " (resumed)"
+	}
+	if p.Estimate != nil {
+		s += fmt.Sprintf(": entries=%d, extra_space=%s, time=%s", p.Estimate.Entries, p.Estimate.Size.HR(), p.Estimate.Duration)
+	} else {
+		s += ": no estimation"
+	}
+	if !p.Rollback {
+		s += ", no rollback"
+	}
+	return s
+}
+
+// DryRun - plans pending migrations without applying them
+func (m *Migrator) DryRun(db kv.RoDB) ([]Plan, error) {
+	var plans []Plan
+	if err := db.View(context.Background(), func(tx kv.Tx) (err error) {
+		plans, err = m.plan(tx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+func (m *Migrator) plan(tx kv.Tx) ([]Plan, error) {
+	pending, err := m.PendingMigrations(tx)
+	if err != nil {
+		return nil, err
+	}
+	var plans []Plan
+	for _, v := range pending {
+		progress, err := tx.GetOne(kv.Migrations, []byte(progressPrefix+v.Name))
+		if err != nil {
+			return nil, err
+		}
+		p := Plan{Name: v.Name, Resumed: progress != nil, Rollback: v.Down != nil}
+		if v.Estimate != nil {
+			e, err := v.Estimate(tx)
+			if err != nil {
+				return nil, fmt.Errorf("estimating migration %s: %w", v.Name, err)
+			}
+			p.Estimate = &e
+		}
+		plans = append(plans, p)
+	}
+	return plans, nil
+}
@@ -29,9 +29,13 @@ import (
 // - in the end:drop old bucket (not in defer!).
 // - if you need migrate multiple buckets - create separate migration for each bucket
 // - write test - and check that it's safe to apply same migration twice
+// - long migration: commit checkpoints by BeforeCommit(tx, progressKey, false) and set Estimate - for dry-run and progress logs
+// - set Down if previous version of Erigon can work with DB after revert - `integration rollback_migration`
+// - new table which stages can fill from data already in DB (e.g. new index) - RebuildStages, no resync needed
 var migrations = map[kv.Label][]Migration{
 	kv.ChainDB: {
 		dbSchemaVersion5,
+		receiptsZstd,
 	},
 	kv.TxPoolDB: {},
 	kv.SentryDB: {},
@@ -41,8 +45,17 @@ type Callback func(tx kv.RwTx, progress []byte, isDone bool) error
 type Migration struct {
 	Name string
 	Up   func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) error
+	// Estimate - optional. Used by dry-run and by progress logs to show how much work is left
+	Estimate func(tx kv.Tx) (Estimate, error)
+	// Down - optional. Reverts applied (or partially applied) migration, must be idempotent as Up
+	Down func(db kv.RwDB, tmpdir string) error
 }
 
+const (
+	progressPrefix = "_progress_"
+	rollbackPrefix = "_rollback_"
+)
+
 var (
 	ErrMigrationNonUniqueName   = fmt.Errorf("please provide unique migration name")
 	ErrMigrationCommitNotCalled = fmt.Errorf("migration commit function was not called")
@@ -57,12 +70,14 @@ func NewMigrator(label kv.Label) *Migrator {
 
 type Migrator struct {
 	Migrations []Migration
+	// AllowMajorUpgrade - apply migrations to DB which is more than 1 major version behind, set by `integration migrate`
+	AllowMajorUpgrade bool
 }
 
 func AppliedMigrations(tx kv.Tx, withPayload bool) (map[string][]byte, error) {
 	applied := map[string][]byte{}
 	err := tx.ForEach(kv.Migrations, nil, func(k []byte, v []byte) error {
-		if bytes.HasPrefix(k, []byte("_progress_")) {
+		if bytes.HasPrefix(k, []byte(progressPrefix)) || bytes.HasPrefix(k, []byte(rollbackPrefix)) {
 			return nil
 		}
 		if withPayload {
@@ -147,8 +162,8 @@ func (m *Migrator) Apply(db kv.RwDB, datadir string) error {
 				}
 			} else {
 				// major < kv.DBSchemaVersion.Major
-				if kv.DBSchemaVersion.Major-major > 1 {
-					return fmt.Errorf("cannot upgrade major DB version for more than 1 version from %d to %d, use integration tool if you know what you are doing", major, kv.DBSchemaVersion.Major)
+				if kv.DBSchemaVersion.Major-major > 1 && !m.AllowMajorUpgrade {
+					return fmt.Errorf("cannot upgrade major DB version for more than 1 version from %d to %d, use `integration migrate --allow.major.upgrade` if you know what you are doing", major, kv.DBSchemaVersion.Major)
 				}
 			}
 		}
@@ -175,21 +190,43 @@ func (m *Migrator) Apply(db kv.RwDB, datadir string) error {
 
 		callbackCalled := false // commit function must be called if no error, protection against people's mistake
 
-		log.Info("Apply migration", "name", v.Name)
 		var progress []byte
+		var estimate *Estimate
 		if err := db.View(context.Background(), func(tx kv.Tx) (err error) {
-			progress, err = tx.GetOne(kv.Migrations, []byte("_progress_"+v.Name))
+			progress, err = tx.GetOne(kv.Migrations, []byte(progressPrefix+v.Name))
+			if err != nil {
+				return err
+			}
+			if v.Estimate != nil {
+				e, err := v.Estimate(tx)
+				if err != nil {
+					return fmt.Errorf("estimating migration %s: %w", v.Name, err)
+				}
+				estimate = &e
+			}
+			return nil
+		}); err != nil {
 			return err
+		}
+		if err := db.Update(context.Background(), func(tx kv.RwTx) error {
+			return saveRollbackMeta(tx, v.Name, existingVersion)
 		}); err != nil {
 			return err
 		}
 
+		logArgs := []interface{}{"name", v.Name, "resumed", progress != nil}
+		if estimate != nil {
+			logArgs = append(logArgs, "entries", estimate.Entries, "extra_space", estimate.Size, "estimated_time", estimate.Duration)
+		}
+		log.Info("Apply migration, it's safe to interrupt: migration resumes from last checkpoint on restart", logArgs...)
+		reporter := startProgressReporter(v.Name, estimate)
 		if err := v.Up(db, path.Join(datadir, "migrations", v.Name), progress, func(tx kv.RwTx, key []byte, isDone bool) error {
 			if !isDone {
 				if key != nil {
-					if err := tx.Put(kv.Migrations, []byte("_progress_"+v.Name), key); err != nil {
+					if err := tx.Put(kv.Migrations, []byte(progressPrefix+v.Name), key); err != nil {
 						return err
 					}
+					reporter.checkpoint()
 				}
 				return nil
 			}
@@ -204,20 +241,22 @@ func (m *Migrator) Apply(db kv.RwDB, datadir string) error {
 				return err
 			}
 
-			err = tx.Delete(kv.Migrations, []byte("_progress_"+v.Name), nil)
+			err = tx.Delete(kv.Migrations, []byte(progressPrefix+v.Name), nil)
 			if err != nil {
 				return err
 			}
 
 			return nil
 		}); err != nil {
+			reporter.stop()
 			return err
 		}
+		reporter.stop()
 
 		if !callbackCalled {
 			return fmt.Errorf("%w: %s", ErrMigrationCommitNotCalled, v.Name)
 		}
-		log.Info("Applied migration", "name", v.Name)
+		log.Info("Applied migration", "name", v.Name, "took", reporter.elapsed())
 	}
 	// Write DB schema version
 	var version [12]byte
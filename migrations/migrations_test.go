@@ -2,7 +2,9 @@ package migrations
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/ledgerwatch/erigon-lib/kv"
@@ -16,8 +18,8 @@ func TestApplyWithInit(t *testing.T) {
 	require, db := require.New(t), memdb.NewTestDB(t)
 	m := []Migration{
 		{
-			"one",
-			func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) (err error) {
+			Name: "one",
+			Up: func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) (err error) {
 				tx, err := db.BeginRw(context.Background())
 				if err != nil {
 					return err
@@ -31,8 +33,8 @@ func TestApplyWithInit(t *testing.T) {
 			},
 		},
 		{
-			"two",
-			func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) (err error) {
+			Name: "two",
+			Up: func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) (err error) {
 				tx, err := db.BeginRw(context.Background())
 				if err != nil {
 					return err
@@ -80,15 +82,15 @@ func TestApplyWithoutInit(t *testing.T) {
 	require, db := require.New(t), memdb.NewTestDB(t)
 	m := []Migration{
 		{
-			"one",
-			func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) (err error) {
+			Name: "one",
+			Up: func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) (err error) {
 				t.Fatal("shouldn't been executed")
 				return nil
 			},
 		},
 		{
-			"two",
-			func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) (err error) {
+			Name: "two",
+			Up: func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) (err error) {
 				tx, err := db.BeginRw(context.Background())
 				if err != nil {
 					return err
@@ -144,8 +146,8 @@ func TestWhenNonFirstMigrationAlreadyApplied(t *testing.T) {
 	require, db := require.New(t), memdb.NewTestDB(t)
 	m := []Migration{
 		{
-			"one",
-			func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) (err error) {
+			Name: "one",
+			Up: func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) (err error) {
 				tx, err := db.BeginRw(context.Background())
 				if err != nil {
 					return err
@@ -159,8 +161,8 @@ func TestWhenNonFirstMigrationAlreadyApplied(t *testing.T) {
 			},
 		},
 		{
-			"two",
-			func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) (err error) {
+			Name: "two",
+			Up: func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) (err error) {
 				t.Fatal("shouldn't been executed")
 				return nil
 			},
@@ -295,3 +297,155 @@ func TestCommitCallRequired(t *testing.T) {
 	})
 	require.NoError(err)
 }
+
+func TestDryRun(t *testing.T) {
+	require, db := require.New(t), memdb.NewTestDB(t)
+	err := db.Update(context.Background(), func(tx kv.RwTx) error {
+		if err := tx.Put(kv.Receipts, []byte{1}, []byte{2}); err != nil {
+			return err
+		}
+		return tx.Put(kv.Migrations, []byte(progressPrefix+receiptsZstd.Name), []byte{1})
+	})
+	require.NoError(err)
+
+	migrator := NewMigrator(kv.ChainDB)
+	migrator.Migrations = []Migration{dbSchemaVersion5, receiptsZstd}
+	plans, err := migrator.DryRun(db)
+	require.NoError(err)
+	require.Equal(2, len(plans))
+	require.Equal(Plan{Name: dbSchemaVersion5.Name, Rollback: true}, plans[0])
+	require.True(plans[1].Resumed)
+	require.True(plans[1].Rollback)
+	require.Equal(uint64(1), plans[1].Estimate.Entries)
+
+	// dry-run doesn't apply migrations
+	has, err := migrator.HasPendingMigrations(db)
+	require.NoError(err)
+	require.True(has)
+}
+
+func TestRollback(t *testing.T) {
+	require, db := require.New(t), memdb.NewTestDB(t)
+	downCalled := 0
+	up := func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) (err error) {
+		return db.Update(context.Background(), func(tx kv.RwTx) error {
+			return BeforeCommit(tx, nil, true)
+		})
+	}
+	m := []Migration{
+		{
+			Name: "one",
+			Up:   up,
+			Down: func(db kv.RwDB, tmpdir string) error {
+				downCalled++
+				return nil
+			},
+		},
+		{
+			Name: "two",
+			Up:   up,
+		},
+	}
+	oldVersion := []byte{0, 0, 0, 4, 0, 0, 0, 0, 0, 0, 0, 0}
+	err := db.Update(context.Background(), func(tx kv.RwTx) error {
+		return tx.Put(kv.DatabaseInfo, kv.DBSchemaVersionKey, oldVersion)
+	})
+	require.NoError(err)
+
+	migrator := NewMigrator(kv.ChainDB)
+	migrator.Migrations = m
+	require.NoError(migrator.Apply(db, ""))
+
+	require.True(errors.Is(migrator.Rollback(db, "three", ""), ErrMigrationNotFound))
+	require.True(errors.Is(migrator.Rollback(db, "two", ""), ErrMigrationNoRollback))
+	require.True(errors.Is(migrator.Rollback(db, "one", ""), ErrMigrationRollbackOrder))
+
+	migrator.Migrations = m[:1]
+	require.NoError(migrator.Rollback(db, "one", ""))
+	require.Equal(1, downCalled)
+	err = db.View(context.Background(), func(tx kv.Tx) error {
+		applied, err := AppliedMigrations(tx, false)
+		require.NoError(err)
+		_, ok := applied["one"]
+		require.False(ok)
+		version, err := tx.GetOne(kv.DatabaseInfo, kv.DBSchemaVersionKey)
+		require.NoError(err)
+		require.Equal(oldVersion, version)
+		return nil
+	})
+	require.NoError(err)
+	require.True(errors.Is(migrator.Rollback(db, "one", ""), ErrMigrationNotApplied))
+}
+
+func TestStatus(t *testing.T) {
+	require, db := require.New(t), memdb.NewTestDB(t)
+	err := db.Update(context.Background(), func(tx kv.RwTx) error {
+		if err := tx.Put(kv.Migrations, []byte(dbSchemaVersion5.Name), []byte{}); err != nil {
+			return err
+		}
+		return tx.Put(kv.Migrations, []byte("other_fork_index"), []byte{})
+	})
+	require.NoError(err)
+
+	migrator := NewMigrator(kv.ChainDB)
+	migrator.Migrations = []Migration{dbSchemaVersion5, receiptsZstd}
+	status, err := migrator.Status(db)
+	require.NoError(err)
+	require.Equal("", status.SchemaVersion)
+	require.Equal([]string{dbSchemaVersion5.Name}, status.Applied)
+	require.Equal([]string{"other_fork_index"}, status.Unknown)
+	require.Equal(1, len(status.Pending))
+	require.Equal(receiptsZstd.Name, status.Pending[0].Name)
+	require.False(status.MajorUpgrade())
+
+	status.SchemaVersion = fmt.Sprintf("%d.0.0", kv.DBSchemaVersion.Major-2)
+	require.True(status.MajorUpgrade())
+}
+
+func TestMajorUpgrade(t *testing.T) {
+	require, db := require.New(t), memdb.NewTestDB(t)
+	var version [12]byte
+	binary.BigEndian.PutUint32(version[:], kv.DBSchemaVersion.Major-2)
+	err := db.Update(context.Background(), func(tx kv.RwTx) error {
+		return tx.Put(kv.DatabaseInfo, kv.DBSchemaVersionKey, version[:])
+	})
+	require.NoError(err)
+
+	migrator := NewMigrator(kv.ChainDB)
+	migrator.Migrations = []Migration{dbSchemaVersion5}
+	require.Error(migrator.Apply(db, ""))
+	migrator.AllowMajorUpgrade = true
+	require.NoError(migrator.Apply(db, ""))
+}
+
+func TestRebuildStages(t *testing.T) {
+	require, db := require.New(t), memdb.NewTestDB(t)
+	err := db.Update(context.Background(), func(tx kv.RwTx) error {
+		if err := tx.Put(kv.CallFromIndex, []byte{1}, []byte{2}); err != nil {
+			return err
+		}
+		if err := stages.SaveStageProgress(tx, stages.CallTraces, 100); err != nil {
+			return err
+		}
+		return stages.SaveStageProgress(tx, stages.Execution, 100)
+	})
+	require.NoError(err)
+
+	migrator := NewMigrator(kv.ChainDB)
+	migrator.Migrations = []Migration{RebuildStages("rebuild_call_index", []string{kv.CallFromIndex}, stages.CallTraces)}
+	require.NoError(migrator.Apply(db, ""))
+
+	err = db.View(context.Background(), func(tx kv.Tx) error {
+		v, err := tx.GetOne(kv.CallFromIndex, []byte{1})
+		require.NoError(err)
+		require.Nil(v)
+		progress, err := stages.GetStageProgress(tx, stages.CallTraces)
+		require.NoError(err)
+		require.Equal(uint64(0), progress)
+		progress, err = stages.GetStageProgress(tx, stages.Execution)
+		require.NoError(err)
+		require.Equal(uint64(100), progress)
+		return nil
+	})
+	require.NoError(err)
+}
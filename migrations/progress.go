@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/erigon/common/debug"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// progressLogInterval - long migrations run for hours, without periodic logs node looks hung
+var progressLogInterval = 30 * time.Second
+
+type progressReporter struct {
+	name        string
+	estimate    *Estimate
+	started     time.Time
+	checkpoints uint64 // atomic
+	quit        chan struct{}
+	done        chan struct{}
+}
+
+func startProgressReporter(name string, estimate *Estimate) *progressReporter {
+	r := &progressReporter{
+		name:     name,
+		estimate: estimate,
+		started:  time.Now(),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.loop()
+	return r
+}
+
+func (r *progressReporter) loop() {
+	defer debug.LogPanic()
+	defer close(r.done)
+	logEvery := time.NewTicker(progressLogInterval)
+	defer logEvery.Stop()
+	for {
+		select {
+		case <-r.quit:
+			return
+		case <-logEvery.C:
+			log.Info("Migration in progress", r.logArgs()...)
+		}
+	}
+}
+
+func (r *progressReporter) logArgs() []interface{} {
+	elapsed := r.elapsed()
+	args := []interface{}{"name", r.name, "elapsed", elapsed, "checkpoints", atomic.LoadUint64(&r.checkpoints)}
+	if r.estimate != nil && r.estimate.Duration > 0 {
+		left := r.estimate.Duration - elapsed
+		if left < 0 {
+			left = 0
+		}
+		args = append(args, "estimated_left", left.Round(time.Second))
+	}
+	return args
+}
+
+// checkpoint - called when migration commits intermediate progress
+func (r *progressReporter) checkpoint() { atomic.AddUint64(&r.checkpoints, 1) }
+
+func (r *progressReporter) elapsed() time.Duration { return time.Since(r.started).Round(time.Second) }
+
+func (r *progressReporter) stop() {
+	select {
+	case <-r.quit:
+	default:
+		close(r.quit)
+	}
+	<-r.done
+}
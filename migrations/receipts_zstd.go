@@ -0,0 +1,119 @@
+package migrations
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/ledgerwatch/erigon-lib/etl"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+)
+
+// receiptsZstd - compresses kv.Receipts and kv.Log by zstd with dictionaries of rawdb.ReceiptsDict. Segments are
+// compressed in order: dictionary of a segment is trained on the previous (already migrated) one, progress is the
+// next segment. Rollback decompresses values back to plain CBOR.
+var receiptsZstd = Migration{
+	Name: "receipts_zstd",
+	Estimate: func(tx kv.Tx) (Estimate, error) {
+		receipts, err := estimateTable(tx, kv.Receipts, 50_000)
+		if err != nil {
+			return Estimate{}, err
+		}
+		logs, err := estimateTable(tx, kv.Log, 50_000)
+		if err != nil {
+			return Estimate{}, err
+		}
+		return Estimate{
+			Entries:  receipts.Entries + logs.Entries,
+			Size:     receipts.Size + logs.Size,
+			Duration: receipts.Duration + logs.Duration,
+		}, nil
+	},
+	Up: func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) (err error) {
+		var segment uint64
+		if len(progress) == 8 {
+			segment = binary.BigEndian.Uint64(progress)
+		}
+		for done := false; !done; {
+			if err := db.Update(context.Background(), func(tx kv.RwTx) error {
+				last, err := lastReceiptsBlock(tx)
+				if err != nil {
+					return err
+				}
+				if last == nil || segment > *last/rawdb.ReceiptsSegmentSize {
+					done = true
+					return BeforeCommit(tx, nil, true)
+				}
+				if err = compressReceiptsSegment(tx, segment, tmpdir); err != nil {
+					return err
+				}
+				segment++
+				return BeforeCommit(tx, dbutils.EncodeBlockNumber(segment), false)
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(db kv.RwDB, tmpdir string) error {
+		return db.Update(context.Background(), func(tx kv.RwTx) error {
+			for _, table := range []string{kv.Receipts, kv.Log} {
+				if err := etl.Transform("receipts_zstd", tx, table, table, tmpdir, func(k, v []byte, next etl.ExtractNextFunc) error {
+					if !rawdb.IsCompressedReceiptsValue(v) {
+						return nil
+					}
+					raw, err := rawdb.DecodeReceiptsValue(tx, v)
+					if err != nil {
+						return err
+					}
+					return next(k, k, raw)
+				}, etl.IdentityLoadFunc, etl.TransformArgs{}); err != nil {
+					return err
+				}
+			}
+			return tx.ClearBucket(rawdb.ReceiptsDict)
+		})
+	},
+}
+
+func lastReceiptsBlock(tx kv.Tx) (*uint64, error) {
+	c, err := tx.Cursor(kv.Receipts)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	k, _, err := c.Last()
+	if err != nil || k == nil {
+		return nil, err
+	}
+	last := binary.BigEndian.Uint64(k)
+	return &last, nil
+}
+
+// compressReceiptsSegment - compresses receipts and logs of blocks of segment, skips compressed values
+func compressReceiptsSegment(tx kv.RwTx, segment uint64, tmpdir string) error {
+	from, to := segment*rawdb.ReceiptsSegmentSize, (segment+1)*rawdb.ReceiptsSegmentSize-1
+	for _, table := range []string{kv.Receipts, kv.Log} {
+		endKey := dbutils.EncodeBlockNumber(to)
+		if table == kv.Log {
+			endKey = dbutils.LogKey(to, ^uint32(0))
+		}
+		if err := etl.Transform("receipts_zstd", tx, table, table, tmpdir, func(k, v []byte, next etl.ExtractNextFunc) error {
+			if rawdb.IsCompressedReceiptsValue(v) {
+				return nil
+			}
+			compressed, err := rawdb.EncodeReceiptsValue(tx, binary.BigEndian.Uint64(k), v)
+			if err != nil {
+				return err
+			}
+			return next(k, k, compressed)
+		}, etl.IdentityLoadFunc, etl.TransformArgs{
+			ExtractStartKey: dbutils.EncodeBlockNumber(from),
+			ExtractEndKey:   endKey,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
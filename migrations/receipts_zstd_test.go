@@ -0,0 +1,87 @@
+package migrations
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/ethdb/cbor"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiptsZstd(t *testing.T) {
+	require, db := require.New(t), memdb.NewTestDB(t)
+	blocks := []uint64{1, rawdb.ReceiptsSegmentSize + 1, 3*rawdb.ReceiptsSegmentSize + 1}
+	logs := types.Logs{{Address: common.Address{1}, Topics: []common.Hash{{2}, {2}, {2}}, Data: make([]byte, 256)}}
+	receipts := types.Receipts{{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000}}
+
+	// plain CBOR, as written before compression
+	buf := bytes.NewBuffer(nil)
+	require.NoError(cbor.Marshal(buf, logs))
+	plainLogs := common.CopyBytes(buf.Bytes())
+	buf.Reset()
+	require.NoError(cbor.Marshal(buf, receipts))
+	plainReceipts := common.CopyBytes(buf.Bytes())
+	err := db.Update(context.Background(), func(tx kv.RwTx) error {
+		for _, blockNum := range blocks {
+			if err := tx.Put(kv.Receipts, dbutils.EncodeBlockNumber(blockNum), plainReceipts); err != nil {
+				return err
+			}
+			if err := tx.Put(kv.Log, dbutils.LogKey(blockNum, 0), plainLogs); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(err)
+
+	migrator := NewMigrator(kv.ChainDB)
+	migrator.Migrations = []Migration{receiptsZstd}
+	require.NoError(migrator.Apply(db, t.TempDir()))
+
+	err = db.View(context.Background(), func(tx kv.Tx) error {
+		for _, blockNum := range blocks {
+			v, err := tx.GetOne(kv.Log, dbutils.LogKey(blockNum, 0))
+			require.NoError(err)
+			require.True(rawdb.IsCompressedReceiptsValue(v))
+			require.Less(len(v), len(plainLogs))
+			got, err := rawdb.UnmarshalLogs(tx, v)
+			require.NoError(err)
+			require.Equal(logs[0].Data, got[0].Data)
+			require.Equal(1, len(rawdb.ReadRawReceipts(tx, blockNum)))
+		}
+		// segment with receipts has dictionary (or marker of its absence)
+		for _, blockNum := range blocks {
+			segment := blockNum / rawdb.ReceiptsSegmentSize
+			dict, err := tx.GetOne(rawdb.ReceiptsDict, dbutils.EncodeBlockNumber(segment))
+			require.NoError(err)
+			require.NotEmpty(dict, segment)
+		}
+		return nil
+	})
+	require.NoError(err)
+
+	// rollback restores plain CBOR
+	require.NoError(receiptsZstd.Down(db, t.TempDir()))
+	err = db.View(context.Background(), func(tx kv.Tx) error {
+		for _, blockNum := range blocks {
+			v, err := tx.GetOne(kv.Log, dbutils.LogKey(blockNum, 0))
+			require.NoError(err)
+			require.Equal(plainLogs, v)
+		}
+		c, err := tx.Cursor(rawdb.ReceiptsDict)
+		require.NoError(err)
+		defer c.Close()
+		count, err := c.Count()
+		require.NoError(err)
+		require.Zero(count)
+		return nil
+	})
+	require.NoError(err)
+}
@@ -0,0 +1,125 @@
+package migrations
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/ugorji/go/codec"
+)
+
+var (
+	ErrMigrationNotFound      = fmt.Errorf("migration not found")
+	ErrMigrationNotApplied    = fmt.Errorf("migration was not applied")
+	ErrMigrationNoRollback    = fmt.Errorf("migration doesn't support rollback")
+	ErrMigrationRollbackOrder = fmt.Errorf("migrations must be rolled back in reverse order")
+)
+
+// rollbackMeta - stored when migration starts, allows to return DB into state readable by previous version of Erigon
+type rollbackMeta struct {
+	SchemaVersion []byte `codec:"schema_version"` // DB schema version before migration, empty if DB had no version
+	Started       int64  `codec:"started"`        // unix time of first attempt
+}
+
+// saveRollbackMeta - keeps meta of first attempt if migration is resumed
+func saveRollbackMeta(tx kv.RwTx, name string, schemaVersion []byte) error {
+	k := []byte(rollbackPrefix + name)
+	existing, err := tx.GetOne(kv.Migrations, k)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := codec.NewEncoder(buf, &codec.CborHandle{}).Encode(rollbackMeta{SchemaVersion: schemaVersion, Started: time.Now().Unix()}); err != nil {
+		return err
+	}
+	return tx.Put(kv.Migrations, k, buf.Bytes())
+}
+
+func readRollbackMeta(tx kv.Tx, name string) (*rollbackMeta, error) {
+	v, err := tx.GetOne(kv.Migrations, []byte(rollbackPrefix+name))
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		// migration was applied before rollback meta was introduced
+		return nil, nil
+	}
+	meta := &rollbackMeta{}
+	if err := codec.NewDecoder(bytes.NewReader(v), &codec.CborHandle{}).Decode(meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// Rollback - reverts applied or interrupted migration and restores DB schema version which was before it.
+// Migration will be applied again on next start of Erigon with this migration in the list.
+func (m *Migrator) Rollback(db kv.RwDB, name string, datadir string) error {
+	idx := -1
+	for i := range m.Migrations {
+		if m.Migrations[i].Name == name {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return fmt.Errorf("%w: %s", ErrMigrationNotFound, name)
+	}
+	v := m.Migrations[idx]
+	if v.Down == nil {
+		return fmt.Errorf("%w: %s", ErrMigrationNoRollback, name)
+	}
+
+	var meta *rollbackMeta
+	if err := db.View(context.Background(), func(tx kv.Tx) error {
+		applied, err := AppliedMigrations(tx, false)
+		if err != nil {
+			return err
+		}
+		for _, later := range m.Migrations[idx+1:] {
+			if _, ok := applied[later.Name]; ok {
+				return fmt.Errorf("%w: %s applied after %s", ErrMigrationRollbackOrder, later.Name, name)
+			}
+		}
+		progress, err := tx.GetOne(kv.Migrations, []byte(progressPrefix+name))
+		if err != nil {
+			return err
+		}
+		if _, ok := applied[name]; !ok && progress == nil {
+			return fmt.Errorf("%w: %s", ErrMigrationNotApplied, name)
+		}
+		meta, err = readRollbackMeta(tx, name)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	log.Info("Rollback migration", "name", name)
+	if err := v.Down(db, path.Join(datadir, "migrations", name)); err != nil {
+		return err
+	}
+	if err := db.Update(context.Background(), func(tx kv.RwTx) error {
+		for _, k := range []string{name, progressPrefix + name, rollbackPrefix + name} {
+			if err := tx.Delete(kv.Migrations, []byte(k), nil); err != nil {
+				return err
+			}
+		}
+		if meta == nil {
+			return nil
+		}
+		if len(meta.SchemaVersion) == 0 {
+			return tx.Delete(kv.DatabaseInfo, kv.DBSchemaVersionKey, nil)
+		}
+		return tx.Put(kv.DatabaseInfo, kv.DBSchemaVersionKey, meta.SchemaVersion)
+	}); err != nil {
+		return err
+	}
+	log.Info("Rolled back migration", "name", name)
+	return nil
+}
@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+)
+
+// Status - state of DB relatively to migrations of this version of Erigon
+type Status struct {
+	SchemaVersion string   // written by last Apply, empty if DB was never migrated
+	Applied       []string // migrations of this version which are applied
+	Unknown       []string // applied migrations this version doesn't know: DB was migrated by newer version or other fork
+	Pending       []Plan
+}
+
+// MajorUpgrade - DB is more than 1 major version behind, Apply requires AllowMajorUpgrade
+func (s *Status) MajorUpgrade() bool {
+	var major uint32
+	if _, err := fmt.Sscanf(s.SchemaVersion, "%d.", &major); err != nil {
+		return false
+	}
+	return major < kv.DBSchemaVersion.Major && kv.DBSchemaVersion.Major-major > 1
+}
+
+func (m *Migrator) Status(db kv.RoDB) (*Status, error) {
+	s := &Status{}
+	if err := db.View(context.Background(), func(tx kv.Tx) error {
+		version, err := tx.GetOne(kv.DatabaseInfo, kv.DBSchemaVersionKey)
+		if err != nil {
+			return err
+		}
+		if len(version) == 12 {
+			s.SchemaVersion = fmt.Sprintf("%d.%d.%d", binary.BigEndian.Uint32(version), binary.BigEndian.Uint32(version[4:]), binary.BigEndian.Uint32(version[8:]))
+		}
+		applied, err := AppliedMigrations(tx, false)
+		if err != nil {
+			return err
+		}
+		for _, v := range m.Migrations {
+			if _, ok := applied[v.Name]; ok {
+				s.Applied = append(s.Applied, v.Name)
+				delete(applied, v.Name)
+			}
+		}
+		for name := range applied {
+			s.Unknown = append(s.Unknown, name)
+		}
+		sort.Strings(s.Unknown)
+		s.Pending, err = m.plan(tx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// RebuildStages - migration for table layout which stages can rebuild from data already in DB (e.g. new index):
+// clears tables and resets progress of stages which fill them, next sync cycle refills them instead of full resync.
+// Stages are reset to 0, so include stages which depend on them.
+func RebuildStages(name string, tables []string, resetStages ...stages.SyncStage) Migration {
+	return Migration{
+		Name: name,
+		Up: func(db kv.RwDB, tmpdir string, progress []byte, BeforeCommit Callback) error {
+			tx, err := db.BeginRw(context.Background())
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			for _, table := range tables {
+				if err := tx.ClearBucket(table); err != nil {
+					return err
+				}
+			}
+			for _, stage := range resetStages {
+				if err := stages.SaveStageProgress(tx, stage, 0); err != nil {
+					return err
+				}
+				if err := stages.SaveStagePruneProgress(tx, stage, 0); err != nil {
+					return err
+				}
+			}
+			if err := BeforeCommit(tx, nil, true); err != nil {
+				return err
+			}
+			return tx.Commit()
+		},
+	}
+}
@@ -0,0 +1,53 @@
+package node
+
+import (
+	"errors"
+	"os"
+
+	"github.com/ledgerwatch/log/v3"
+)
+
+// CompactedSuffix - compacted copy of database directory (created by `integration mdbx_compact`) has this suffix,
+// it replaces database on next start
+const CompactedSuffix = ".compact"
+
+// SwapCompactedDatabase - replaces database by its compacted copy, if copy exists. Each step is rename or removal of
+// directory, and is resumed by next call if process was interrupted.
+func SwapCompactedDatabase(dbPath string) error {
+	compacted, old := dbPath+CompactedSuffix, dbPath+".old"
+	if exists, err := dirExists(compacted); err != nil || !exists {
+		if err != nil {
+			return err
+		}
+		// interrupted after swap
+		return os.RemoveAll(old)
+	}
+	exists, err := dirExists(dbPath)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if err = os.RemoveAll(old); err != nil {
+			return err
+		}
+		if err = os.Rename(dbPath, old); err != nil {
+			return err
+		}
+	}
+	if err = os.Rename(compacted, dbPath); err != nil {
+		return err
+	}
+	log.Info("Database replaced by compacted copy", "path", dbPath)
+	return os.RemoveAll(old)
+}
+
+func dirExists(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.IsDir(), nil
+}
@@ -0,0 +1,47 @@
+package node
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwapCompactedDatabase(t *testing.T) {
+	require := require.New(t)
+	dbPath := filepath.Join(t.TempDir(), "chaindata")
+
+	// nothing to swap
+	require.NoError(SwapCompactedDatabase(dbPath))
+	_, err := os.Stat(dbPath)
+	require.True(os.IsNotExist(err))
+
+	writeDir := func(path, content string) {
+		require.NoError(os.MkdirAll(path, 0744))
+		require.NoError(ioutil.WriteFile(filepath.Join(path, "mdbx.dat"), []byte(content), 0644))
+	}
+	readDir := func(path string) string {
+		content, err := ioutil.ReadFile(filepath.Join(path, "mdbx.dat"))
+		require.NoError(err)
+		return string(content)
+	}
+
+	writeDir(dbPath, "original")
+	writeDir(dbPath+CompactedSuffix, "compacted")
+	require.NoError(SwapCompactedDatabase(dbPath))
+	require.Equal("compacted", readDir(dbPath))
+	for _, path := range []string{dbPath + CompactedSuffix, dbPath + ".old"} {
+		_, err = os.Stat(path)
+		require.True(os.IsNotExist(err), path)
+	}
+
+	// interrupted after original database was moved away
+	require.NoError(os.Rename(dbPath, dbPath+".old"))
+	writeDir(dbPath+CompactedSuffix, "compacted2")
+	require.NoError(SwapCompactedDatabase(dbPath))
+	require.Equal("compacted2", readDir(dbPath))
+	_, err = os.Stat(dbPath + ".old")
+	require.True(os.IsNotExist(err))
+}
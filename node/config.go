@@ -24,6 +24,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ledgerwatch/erigon-lib/kv"
 
@@ -66,6 +67,10 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// Chain is name of the chain run by the node. It labels metrics of node's databases: one process can run nodes
+	// of several chains (see --networks)
+	Chain string `toml:"-"`
+
 	// Configuration of peer-to-peer networking.
 	P2P p2p.Config
 
@@ -145,6 +150,9 @@ type Config struct {
 	Logger log.Logger `toml:",omitempty"`
 
 	DatabaseVerbosity kv.DBVerbosityLvl
+	// ReadTxWarn - log read transactions of chaindata which are open longer than this (they block reuse of free pages),
+	// 0 - disabled
+	ReadTxWarn time.Duration
 
 	// Address to listen to when launchig listener for remote database access
 	// empty string means not to start the listener
@@ -28,6 +28,8 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/ledgerwatch/erigon/ethdb/dbstats"
+	"github.com/ledgerwatch/erigon/ethdb/kvwatchdog"
 	"github.com/ledgerwatch/erigon/params"
 
 	"github.com/gofrs/flock"
@@ -518,6 +520,12 @@ func OpenDatabase(config *Config, logger log.Logger, label kv.Label) (kv.RwDB, e
 		return nil, fmt.Errorf("safety error, see log message")
 	}
 
+	if label == kv.ChainDB {
+		if err := SwapCompactedDatabase(dbPath); err != nil {
+			return nil, fmt.Errorf("replace database by compacted copy: %w", err)
+		}
+	}
+
 	var openFunc func(exclusive bool) (kv.RwDB, error)
 	log.Info("Opening Database", "label", name, "path", dbPath)
 	openFunc = func(exclusive bool) (kv.RwDB, error) {
@@ -562,6 +570,14 @@ func OpenDatabase(config *Config, logger log.Logger, label kv.Label) (kv.RwDB, e
 	}); err != nil {
 		return nil, err
 	}
+	if label == kv.ChainDB && config.ReadTxWarn > 0 {
+		db = kvwatchdog.New(db, config.Chain, name, config.ReadTxWarn, false)
+	}
+	if label == kv.ChainDB {
+		access := dbstats.NewAccess(0, 0)
+		access.RegisterMetrics(config.Chain, name)
+		db = dbstats.NewAccessDB(db, access)
+	}
 
 	return db, nil
 }
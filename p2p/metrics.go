@@ -19,7 +19,10 @@
 package p2p
 
 import (
+	"fmt"
 	"net"
+	"strings"
+	"sync/atomic"
 
 	"github.com/VictoriaMetrics/metrics"
 )
@@ -34,9 +37,33 @@ var (
 	ingressTrafficMeter = metrics.GetOrCreateCounter(ingressMeterName)
 	egressConnectMeter  = metrics.GetOrCreateCounter("p2p_dials")
 	egressTrafficMeter  = metrics.GetOrCreateCounter(egressMeterName)
-	activePeerGauge     = metrics.GetOrCreateCounter("p2p_peers")
+	activeConnGauge     = metrics.GetOrCreateCounter("p2p_connections")
 )
 
+// knownClients - values of client label of p2p_peers, names advertised by other clients are counted as "other" to
+// keep amount of series bounded
+var knownClients = map[string]bool{
+	"erigon": true, "geth": true, "nethermind": true, "besu": true, "openethereum": true, "turbogeth": true,
+	"coregeth": true, "bor": true, "reth": true, "akula": true,
+}
+
+// peerClient - client of the peer by the first part of its advertised name, e.g. "erigon" of "erigon/v2022.02.1/linux-amd64/go1.17.6"
+func peerClient(name string) string {
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.ToLower(name)
+	if knownClients[name] {
+		return name
+	}
+	return "other"
+}
+
+// peersGauge - p2p_peers{client}, see metrics/exp.Registry
+func peersGauge(name string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`p2p_peers{client=%q}`, peerClient(name)))
+}
+
 // meteredConn is a wrapper around a net.Conn that meters both the
 // inbound and outbound network traffic.
 type meteredConn struct {
@@ -53,7 +80,7 @@ func newMeteredConn(conn net.Conn, ingress bool, addr *net.TCPAddr) net.Conn {
 	} else {
 		egressConnectMeter.Inc()
 	}
-	activePeerGauge.Inc()
+	activeConnGauge.Inc()
 	return &meteredConn{Conn: conn}
 }
 
@@ -78,7 +105,25 @@ func (c *meteredConn) Write(b []byte) (n int, err error) {
 func (c *meteredConn) Close() error {
 	err := c.Conn.Close()
 	if err == nil {
-		activePeerGauge.Dec()
+		activeConnGauge.Dec()
 	}
 	return err
 }
+
+// countingConn counts bytes read and written by a peer connection, see PeerInfo.Stats.
+type countingConn struct {
+	net.Conn
+	in, out uint64 // atomic
+}
+
+func (c *countingConn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	atomic.AddUint64(&c.in, uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (n int, err error) {
+	n, err = c.Conn.Write(b)
+	atomic.AddUint64(&c.out, uint64(n))
+	return n, err
+}
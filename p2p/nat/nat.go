@@ -60,7 +60,21 @@ type Interface interface {
 //     "upnp"               uses the Universal Plug and Play protocol
 //     "pmp"                uses NAT-PMP with an auto-detected gateway address
 //     "pmp:192.168.0.1"    uses NAT-PMP with the given gateway address
+//     "stun"               asks DefaultSTUNServers for the external IP, doesn't map ports
+//     "stun:host:port"     asks the given STUN server for the external IP
+//
+// "any", "upnp" and "pmp" ask DefaultSTUNServers for the external IP if the router
+// doesn't know its public address (e.g. it is behind carrier-grade NAT).
 func Parse(spec string) (Interface, error) {
+	if mech := strings.SplitN(spec, ":", 2); strings.ToLower(mech[0]) == "stun" {
+		if len(mech) == 1 {
+			return STUN(), nil
+		}
+		if _, _, err := net.SplitHostPort(mech[1]); err != nil {
+			return nil, fmt.Errorf("invalid STUN server: %w", err)
+		}
+		return STUN(mech[1]), nil
+	}
 	var (
 		parts = strings.SplitN(spec, ":", 2)
 		mech  = strings.ToLower(parts[0])
@@ -76,16 +90,16 @@ func Parse(spec string) (Interface, error) {
 	case "", "none", "off":
 		return nil, nil
 	case "any", "auto", "on":
-		return Any(), nil
+		return withSTUN{Any(), DefaultSTUNServers}, nil
 	case "extip", "ip":
 		if ip == nil {
 			return nil, errors.New("missing IP address")
 		}
 		return ExtIP(ip), nil
 	case "upnp":
-		return UPnP(), nil
+		return withSTUN{UPnP(), DefaultSTUNServers}, nil
 	case "pmp", "natpmp", "nat-pmp":
-		return PMP(ip), nil
+		return withSTUN{PMP(ip), DefaultSTUNServers}, nil
 	default:
 		return nil, fmt.Errorf("unknown mechanism %q", parts[0])
 	}
@@ -95,10 +109,32 @@ const (
 	mapTimeout = 10 * time.Minute
 )
 
+// redetector is implemented by interfaces which discover the router and can do it
+// again when the network changes, see Redetect.
+type redetector interface {
+	redetect()
+	// changed is closed when the router is discovered again
+	changed() <-chan struct{}
+}
+
+// Redetect makes m discover the router again on next use, e.g. after the machine
+// moved to another network. Port mappings kept by Map are re-added right away.
+func Redetect(m Interface) {
+	if r, ok := m.(redetector); ok {
+		r.redetect()
+	}
+}
+
 // Map adds a port mapping on m and keeps it alive until c is closed.
+// The mapping is re-added when m redetects the router.
 // This function is typically invoked in its own goroutine.
 func Map(m Interface, c <-chan struct{}, protocol string, extport, intport int, name string) {
 	log := log.New("proto", protocol, "extport", extport, "intport", intport, "interface", m)
+	var changed <-chan struct{}
+	r, redetects := m.(redetector)
+	if redetects {
+		changed = r.changed()
+	}
 	refresh := time.NewTimer(mapTimeout)
 	defer func() {
 		refresh.Stop()
@@ -122,6 +158,17 @@ func Map(m Interface, c <-chan struct{}, protocol string, extport, intport int,
 				log.Debug("Couldn't add port mapping", "err", err)
 			}
 			refresh.Reset(mapTimeout)
+		case <-changed:
+			changed = r.changed()
+			if err := m.AddMapping(protocol, extport, intport, name, mapTimeout); err != nil {
+				log.Debug("Couldn't add port mapping", "err", err)
+			} else {
+				log.Info("Mapped network port", "interface", m)
+			}
+			if !refresh.Stop() {
+				<-refresh.C
+			}
+			refresh.Reset(mapTimeout)
 		}
 	}
 }
@@ -182,37 +229,42 @@ func PMP(gateway net.IP) Interface {
 // want return an Interface value from UPnP, PMP and Auto immediately.
 type autodisc struct {
 	what string // type of interface being autodiscovered
-	once sync.Once
 	doit func() Interface
 
+	discovering sync.Mutex // held by the caller which runs doit
+
 	mu    sync.Mutex
+	done  bool
 	found Interface
+	gen   chan struct{} // closed by redetect
 }
 
 func startautodisc(what string, doit func() Interface) Interface {
-	// TODO: monitor network configuration and rerun doit when it changes.
-	return &autodisc{what: what, doit: doit}
+	return &autodisc{what: what, doit: doit, gen: make(chan struct{})}
 }
 
 func (n *autodisc) AddMapping(protocol string, extport, intport int, name string, lifetime time.Duration) error {
-	if err := n.wait(); err != nil {
+	found, err := n.wait()
+	if err != nil {
 		return err
 	}
-	return n.found.AddMapping(protocol, extport, intport, name, lifetime)
+	return found.AddMapping(protocol, extport, intport, name, lifetime)
 }
 
 func (n *autodisc) DeleteMapping(protocol string, extport, intport int) error {
-	if err := n.wait(); err != nil {
+	found, err := n.wait()
+	if err != nil {
 		return err
 	}
-	return n.found.DeleteMapping(protocol, extport, intport)
+	return found.DeleteMapping(protocol, extport, intport)
 }
 
 func (n *autodisc) ExternalIP() (net.IP, error) {
-	if err := n.wait(); err != nil {
+	found, err := n.wait()
+	if err != nil {
 		return nil, err
 	}
-	return n.found.ExternalIP()
+	return found.ExternalIP()
 }
 
 func (n *autodisc) String() string {
@@ -224,15 +276,37 @@ func (n *autodisc) String() string {
 	return n.found.String()
 }
 
+func (n *autodisc) redetect() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.done = false
+	close(n.gen)
+	n.gen = make(chan struct{})
+}
+
+func (n *autodisc) changed() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.gen
+}
+
 // wait blocks until auto-discovery has been performed.
-func (n *autodisc) wait() error {
-	n.once.Do(func() {
+func (n *autodisc) wait() (Interface, error) {
+	n.discovering.Lock()
+	defer n.discovering.Unlock()
+	n.mu.Lock()
+	done := n.done
+	n.mu.Unlock()
+	if !done {
+		found := n.doit()
 		n.mu.Lock()
-		n.found = n.doit()
+		n.found, n.done = found, true
 		n.mu.Unlock()
-	})
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
 	if n.found == nil {
-		return fmt.Errorf("no %s router discovered", n.what)
+		return nil, fmt.Errorf("no %s router discovered", n.what)
 	}
-	return nil
+	return n.found, nil
 }
@@ -0,0 +1,48 @@
+package nat
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WatchNetwork calls onChange when addresses of local network interfaces change (e.g. the machine
+// got another address from DHCP or moved to another network), until quit is closed.
+// Interfaces are checked every interval. This function is typically invoked in its own goroutine.
+func WatchNetwork(quit <-chan struct{}, interval time.Duration, onChange func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := localAddrs()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			addrs := localAddrs()
+			if addrs == last {
+				continue
+			}
+			last = addrs
+			onChange()
+		}
+	}
+}
+
+// localAddrs - sorted addresses of network interfaces, except loopback and link-local
+func localAddrs() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	var list []string
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		list = append(list, ipnet.String())
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
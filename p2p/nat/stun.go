@@ -0,0 +1,195 @@
+package nat
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ledgerwatch/erigon/p2p/netutil"
+)
+
+// DefaultSTUNServers are asked for external IP when no server is given, see STUN.
+var DefaultSTUNServers = []string{
+	"stun.l.google.com:19302",
+	"stun.cloudflare.com:3478",
+}
+
+const (
+	stunTimeout         = 3 * time.Second
+	stunMagicCookie     = 0x2112A442
+	stunBindingRequest  = 0x0001
+	stunBindingResponse = 0x0101
+	stunMappedAddr      = 0x0001
+	stunXorMappedAddr   = 0x0020
+	stunHeaderLen       = 20
+)
+
+// STUN returns a NAT interface which detects external IP by asking STUN servers (RFC 5389) which address
+// requests come from. It doesn't map ports, so it suits hosts behind NAT which forwards ports already,
+// and routers without UPnP or NAT-PMP. Servers are "<host>:<port>", DefaultSTUNServers if empty.
+func STUN(servers ...string) Interface {
+	if len(servers) == 0 {
+		servers = DefaultSTUNServers
+	}
+	return stun(servers)
+}
+
+type stun []string
+
+func (s stun) String() string { return fmt.Sprintf("STUN(%s)", strings.Join(s, ",")) }
+
+// These do nothing.
+
+func (stun) AddMapping(string, int, int, string, time.Duration) error { return nil }
+func (stun) DeleteMapping(string, int, int) error                     { return nil }
+
+func (s stun) ExternalIP() (net.IP, error) {
+	var err error
+	for _, server := range s {
+		var ip net.IP
+		if ip, err = stunExternalIP(server, stunTimeout); err == nil {
+			return ip, nil
+		}
+	}
+	return nil, err
+}
+
+// stunExternalIP sends binding request to server and returns address from its response
+func stunExternalIP(server string, timeout time.Duration) (net.IP, error) {
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	req := make([]byte, stunHeaderLen)
+	binary.BigEndian.PutUint16(req[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint32(req[4:8], stunMagicCookie)
+	if _, err = rand.Read(req[8:stunHeaderLen]); err != nil {
+		return nil, err
+	}
+	if _, err = conn.Write(req); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, fmt.Errorf("STUN server %s: %w", server, err)
+		}
+		resp := buf[:n]
+		if len(resp) < stunHeaderLen || !bytes.Equal(resp[8:stunHeaderLen], req[8:stunHeaderLen]) {
+			continue // not response to our request
+		}
+		ip, err := parseSTUNResponse(resp)
+		if err != nil {
+			return nil, fmt.Errorf("STUN server %s: %w", server, err)
+		}
+		return ip, nil
+	}
+}
+
+// parseSTUNResponse returns XOR-MAPPED-ADDRESS of binding response, MAPPED-ADDRESS of old servers if it is absent
+func parseSTUNResponse(resp []byte) (net.IP, error) {
+	if binary.BigEndian.Uint16(resp[0:2]) != stunBindingResponse {
+		return nil, fmt.Errorf("unexpected message type 0x%04x", binary.BigEndian.Uint16(resp[0:2]))
+	}
+	attrs := resp[stunHeaderLen:]
+	if l := int(binary.BigEndian.Uint16(resp[2:4])); l <= len(attrs) {
+		attrs = attrs[:l]
+	}
+	var mapped net.IP
+	for len(attrs) >= 4 {
+		typ, l := binary.BigEndian.Uint16(attrs[0:2]), int(binary.BigEndian.Uint16(attrs[2:4]))
+		if 4+l > len(attrs) {
+			break
+		}
+		value := attrs[4 : 4+l]
+		switch typ {
+		case stunXorMappedAddr:
+			ip := stunAddr(value)
+			if ip == nil {
+				return nil, errors.New("malformed XOR-MAPPED-ADDRESS")
+			}
+			// address is xored with magic cookie followed by transaction id, which is the response header tail
+			for i := range ip {
+				ip[i] ^= resp[4+i]
+			}
+			return ip, nil
+		case stunMappedAddr:
+			mapped = stunAddr(value)
+		}
+		attrs = attrs[4+(l+3)&^3:] // values are padded to 4 bytes
+	}
+	if mapped == nil {
+		return nil, errors.New("no mapped address in response")
+	}
+	return mapped, nil
+}
+
+// stunAddr - IP of (XOR-)MAPPED-ADDRESS value: reserved byte, family, port, address
+func stunAddr(value []byte) net.IP {
+	if len(value) < 4 {
+		return nil
+	}
+	var l int
+	switch value[1] {
+	case 0x01:
+		l = net.IPv4len
+	case 0x02:
+		l = net.IPv6len
+	default:
+		return nil
+	}
+	if len(value) < 4+l {
+		return nil
+	}
+	return append(net.IP{}, value[4:4+l]...)
+}
+
+// withSTUN asks STUN servers for external IP when mapper can't tell it or tells non-public address of the router
+// (router behind another NAT, carrier-grade NAT).
+type withSTUN struct {
+	Interface
+	stun stun
+}
+
+func (n withSTUN) ExternalIP() (net.IP, error) {
+	ip, err := n.Interface.ExternalIP()
+	if err == nil && isPublic(ip) {
+		return ip, nil
+	}
+	if stunIP, stunErr := n.stun.ExternalIP(); stunErr == nil {
+		return stunIP, nil
+	}
+	return ip, err
+}
+
+func (n withSTUN) String() string { return n.Interface.String() + ", " + n.stun.String() }
+
+func (n withSTUN) redetect() {
+	if r, ok := n.Interface.(redetector); ok {
+		r.redetect()
+	}
+}
+
+func (n withSTUN) changed() <-chan struct{} {
+	if r, ok := n.Interface.(redetector); ok {
+		return r.changed()
+	}
+	return nil
+}
+
+func isPublic(ip net.IP) bool {
+	return ip != nil && ip.IsGlobalUnicast() && !netutil.IsLAN(ip) && !cgnat.Contains(ip)
+}
+
+// cgnat - shared address space of carrier-grade NAT (RFC 6598)
+var cgnat = &net.IPNet{IP: net.IP{100, 64, 0, 0}, Mask: net.CIDRMask(10, 32)}
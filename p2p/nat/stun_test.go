@@ -0,0 +1,125 @@
+package nat
+
+import (
+	"encoding/binary"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// stunServer answers binding requests with XOR-MAPPED-ADDRESS ip, or MAPPED-ADDRESS if xor is false
+func stunServer(t *testing.T, ip net.IP, xor bool) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < stunHeaderLen {
+				continue
+			}
+			family, addrIP := byte(0x01), ip.To4()
+			if addrIP == nil {
+				family, addrIP = 0x02, ip.To16()
+			}
+			typ := uint16(stunMappedAddr)
+			if xor {
+				typ = stunXorMappedAddr
+				addrIP = append(net.IP{}, addrIP...)
+				for i := range addrIP {
+					addrIP[i] ^= buf[4+i]
+				}
+			}
+			// unknown attribute with padding goes first
+			attrs := []byte{0x80, 0x22, 0, 3, 'e', 'r', 'i', 0}
+			attr := make([]byte, 8+len(addrIP))
+			binary.BigEndian.PutUint16(attr[0:2], typ)
+			binary.BigEndian.PutUint16(attr[2:4], uint16(4+len(addrIP)))
+			attr[5] = family
+			binary.BigEndian.PutUint16(attr[6:8], 30303)
+			copy(attr[8:], addrIP)
+			attrs = append(attrs, attr...)
+
+			resp := make([]byte, stunHeaderLen, stunHeaderLen+len(attrs))
+			binary.BigEndian.PutUint16(resp[0:2], stunBindingResponse)
+			binary.BigEndian.PutUint16(resp[2:4], uint16(len(attrs)))
+			copy(resp[4:stunHeaderLen], buf[4:stunHeaderLen])
+			resp = append(resp, attrs...)
+			if _, err := conn.WriteTo(resp, addr); err != nil {
+				return
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestSTUNExternalIP(t *testing.T) {
+	for _, ip := range []net.IP{net.ParseIP("33.44.55.66"), net.ParseIP("2a01:4f8::1")} {
+		for _, xor := range []bool{true, false} {
+			got, err := stunExternalIP(stunServer(t, ip, xor), time.Second)
+			require.NoError(t, err)
+			require.True(t, ip.Equal(got), "got %v, want %v", got, ip)
+		}
+	}
+
+	// first server doesn't answer
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer silent.Close()
+	_, err = stunExternalIP(silent.LocalAddr().String(), 100*time.Millisecond)
+	require.Error(t, err)
+	got, err := stun{stunServer(t, net.IP{33, 44, 55, 66}, true)}.ExternalIP()
+	require.NoError(t, err)
+	require.Equal(t, "33.44.55.66", got.String())
+}
+
+func TestParseSTUN(t *testing.T) {
+	m, err := Parse("stun")
+	require.NoError(t, err)
+	require.Equal(t, STUN(), m)
+	m, err = Parse("stun:stun.example.org:3478")
+	require.NoError(t, err)
+	require.Equal(t, STUN("stun.example.org:3478"), m)
+	_, err = Parse("stun:stun.example.org")
+	require.Error(t, err)
+}
+
+func TestWithSTUN(t *testing.T) {
+	server := stunServer(t, net.IP{33, 44, 55, 66}, true)
+	ip, err := withSTUN{ExtIP{100, 64, 1, 1}, stun{server}}.ExternalIP() // router behind carrier-grade NAT
+	require.NoError(t, err)
+	require.Equal(t, "33.44.55.66", ip.String())
+	ip, err = withSTUN{ExtIP{77, 12, 33, 4}, stun{server}}.ExternalIP()
+	require.NoError(t, err)
+	require.Equal(t, "77.12.33.4", ip.String())
+}
+
+func TestAutoDiscRedetect(t *testing.T) {
+	var discoveries int32
+	ad := startautodisc("thing", func() Interface {
+		return ExtIP{33, 44, 55, byte(atomic.AddInt32(&discoveries, 1))}
+	})
+	changed := ad.(redetector).changed()
+	ip, err := ad.ExternalIP()
+	require.NoError(t, err)
+	require.Equal(t, "33.44.55.1", ip.String())
+	_, _ = ad.ExternalIP()
+	require.Equal(t, int32(1), atomic.LoadInt32(&discoveries))
+
+	Redetect(withSTUN{ad, nil})
+	select {
+	case <-changed:
+	default:
+		t.Fatal("changed is not closed by redetect")
+	}
+	ip, err = ad.ExternalIP()
+	require.NoError(t, err)
+	require.Equal(t, "33.44.55.2", ip.String())
+}
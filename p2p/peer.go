@@ -23,6 +23,7 @@ import (
 	"net"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	metrics2 "github.com/VictoriaMetrics/metrics"
@@ -111,6 +112,9 @@ type Peer struct {
 	log     log.Logger
 	created mclock.AbsTime
 
+	pingSent int64 // atomic, unix nanoseconds of ping waiting for pong
+	latency  int64 // atomic, round trip of last ping in nanoseconds
+
 	wg       sync.WaitGroup
 	protoErr chan error
 	closed   chan struct{}
@@ -280,6 +284,7 @@ func (p *Peer) pingLoop() {
 	for {
 		select {
 		case <-ping.C:
+			atomic.StoreInt64(&p.pingSent, time.Now().UnixNano())
 			if err := SendItems(p.rw, pingMsg); err != nil {
 				p.protoErr <- err
 				return
@@ -313,6 +318,11 @@ func (p *Peer) handle(msg Msg) error {
 	case msg.Code == pingMsg:
 		msg.Discard()
 		go SendItems(p.rw, pongMsg)
+	case msg.Code == pongMsg:
+		msg.Discard()
+		if sent := atomic.SwapInt64(&p.pingSent, 0); sent != 0 {
+			atomic.StoreInt64(&p.latency, time.Now().UnixNano()-sent)
+		}
 	case msg.Code == discMsg:
 		var reason [1]DiscReason
 		// This is the last message. We don't need to discard or
@@ -479,6 +489,12 @@ type PeerInfo struct {
 		Static        bool   `json:"static"`
 	} `json:"network"`
 	Protocols map[string]interface{} `json:"protocols"` // Sub-protocol specific metadata fields
+	Stats     struct {
+		Duration uint64 `json:"duration"`  // Seconds since the connection was established
+		Latency  uint64 `json:"latencyMs"` // Round trip of the last ping, 0 until the first pong
+		BytesIn  uint64 `json:"bytesIn"`
+		BytesOut uint64 `json:"bytesOut"`
+	} `json:"stats"`
 }
 
 // Info gathers and returns a collection of metadata known about a peer.
@@ -504,6 +520,12 @@ func (p *Peer) Info() *PeerInfo {
 	info.Network.Inbound = p.rw.is(inboundConn)
 	info.Network.Trusted = p.rw.is(trustedConn)
 	info.Network.Static = p.rw.is(staticDialedConn)
+	info.Stats.Duration = uint64(time.Duration(mclock.Now() - p.created).Seconds())
+	info.Stats.Latency = uint64(time.Duration(atomic.LoadInt64(&p.latency)).Milliseconds())
+	if c, ok := p.rw.fd.(*countingConn); ok {
+		info.Stats.BytesIn = atomic.LoadUint64(&c.in)
+		info.Stats.BytesOut = atomic.LoadUint64(&c.out)
+	}
 
 	// Gather all the running protocol infos
 	for _, proto := range p.running {
@@ -59,6 +59,10 @@ type Protocol struct {
 	// attempts to create connections to them.
 	DialCandidates enode.Iterator
 
+	// NodeFilter, if non-nil, is applied to nodes found by discv4 and discv5 before
+	// dialing them: nodes are dialed if a protocol with filter accepts them.
+	NodeFilter func(*enode.Node) bool
+
 	// Attributes contains protocol specific information for the node record.
 	Attributes []enr.Entry
 }
@@ -63,6 +63,11 @@ const (
 
 	// Maximum amount of time allowed for writing a complete message.
 	frameWriteTimeout = 20 * time.Second
+
+	// How often local network interfaces are checked for changes, and external IP
+	// is asked again from NAT, which may change it without changes of local network.
+	networkCheckInterval = 30 * time.Second
+	externalIPInterval   = 5 * time.Minute
 )
 
 var errServerStopped = errors.New("server stopped")
@@ -139,6 +144,10 @@ type Config struct {
 	ListenAddr65 string
 	SentryAddr   []string
 
+	// Caps of `eth` traffic of all peers in megabits per second, zero means no cap.
+	MaxDownloadMbps float64 `toml:",omitempty"`
+	MaxUploadMbps   float64 `toml:",omitempty"`
+
 	// If set to a non-nil value, the given NAT port mapper
 	// is used to make the listening port available to the
 	// Internet.
@@ -151,6 +160,10 @@ type Config struct {
 	// If NoDial is true, the server will not dial any peers.
 	NoDial bool `toml:",omitempty"`
 
+	// If WrapConn is set to a non-nil value, it wraps every peer connection,
+	// inbound and dialed ones, e.g. to limit bandwidth.
+	WrapConn func(net.Conn) net.Conn `toml:"-"`
+
 	// If EnableMsgEvents is set then the server will emit PeerEvents
 	// whenever a message is sent to or received from a peer
 	EnableMsgEvents bool
@@ -538,14 +551,55 @@ func (srv *Server) setupLocalNode() error {
 		go func() {
 			defer debug.LogPanic()
 			defer srv.loopWG.Done()
-			if ip, err := srv.NAT.ExternalIP(); err == nil {
-				srv.localnode.SetStaticIP(ip)
-			}
+			srv.natLoop()
 		}()
 	}
 	return nil
 }
 
+// natLoop keeps IP of the local node equal to external IP reported by NAT. When local
+// network changes, NAT discovers the router again and re-adds port mappings.
+func (srv *Server) natLoop() {
+	var ip net.IP
+	updateIP := func() {
+		newIP, err := srv.NAT.ExternalIP()
+		if err != nil {
+			srv.log.Debug("Couldn't get external IP", "interface", srv.NAT, "err", err)
+			return
+		}
+		if !newIP.Equal(ip) {
+			if ip != nil {
+				srv.log.Info("External IP changed", "ip", newIP, "interface", srv.NAT)
+			}
+			ip = newIP
+			srv.localnode.SetStaticIP(ip)
+		}
+	}
+	updateIP()
+
+	networkChanged := make(chan struct{}, 1)
+	go nat.WatchNetwork(srv.quit, networkCheckInterval, func() {
+		select {
+		case networkChanged <- struct{}{}:
+		default:
+		}
+	})
+	refresh := time.NewTicker(externalIPInterval)
+	defer refresh.Stop()
+	for {
+		select {
+		case <-srv.quit:
+			return
+		case <-networkChanged:
+			srv.log.Info("Local network changed, discovering NAT again", "interface", srv.NAT)
+			nat.Redetect(srv.NAT)
+			updateIP()
+		case <-refresh.C:
+			updateIP()
+		}
+	}
+}
+
 func (srv *Server) setupDiscovery() error {
 	srv.discmix = enode.NewFairMix(discmixTimeout)
 
@@ -605,7 +659,7 @@ func (srv *Server) setupDiscovery() error {
 			return err
 		}
 		srv.ntab = ntab
-		srv.discmix.AddSource(ntab.RandomNodes())
+		srv.discmix.AddSource(srv.filterNodes(ntab.RandomNodes()))
 	}
 
 	// Discovery V5
@@ -625,10 +679,33 @@ func (srv *Server) setupDiscovery() error {
 		if err != nil {
 			return err
 		}
+		srv.discmix.AddSource(srv.filterNodes(srv.DiscV5.RandomNodes()))
 	}
 	return nil
 }
 
+// filterNodes drops discovered nodes which no protocol accepts, see Protocol.NodeFilter
+func (srv *Server) filterNodes(it enode.Iterator) enode.Iterator {
+	var filters []func(*enode.Node) bool
+	for _, proto := range srv.Protocols {
+		if proto.NodeFilter == nil {
+			return it
+		}
+		filters = append(filters, proto.NodeFilter)
+	}
+	if len(filters) == 0 {
+		return it
+	}
+	return enode.Filter(it, func(n *enode.Node) bool {
+		for _, accepts := range filters {
+			if accepts(n) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
 func (srv *Server) setupDialScheduler() {
 	config := dialConfig{
 		self:           srv.localnode.ID(),
@@ -779,6 +856,7 @@ running:
 				// The handshakes are done and it passed all checks.
 				p := srv.launchPeer(c)
 				peers[c.node.ID()] = p
+				peersGauge(p.Fullname()).Inc()
 				srv.log.Trace("Adding p2p peer", "peercount", len(peers), "id", p.ID(), "conn", c.flags, "addr", p.RemoteAddr(), "name", p.Name())
 				srv.dialsched.peerAdded(c)
 				if p.Inbound() {
@@ -791,6 +869,7 @@ running:
 			// A peer disconnected.
 			d := common.PrettyDuration(mclock.Now() - pd.created)
 			delete(peers, pd.ID())
+			peersGauge(pd.Fullname()).Dec()
 			srv.log.Trace("Removing p2p peer", "peercount", len(peers), "id", pd.ID(), "duration", d, "req", pd.requested, "err", pd.err)
 			srv.dialsched.peerRemoved(pd.rw)
 			if pd.Inbound() {
@@ -819,6 +898,7 @@ running:
 		p := <-srv.delpeer
 		p.log.Trace("<-delpeer (spindown)")
 		delete(peers, p.ID())
+		peersGauge(p.Fullname()).Dec()
 	}
 }
 
@@ -943,6 +1023,10 @@ func (srv *Server) checkInboundConn(fd net.Conn, remoteIP net.IP) error {
 // as a peer. It returns when the connection has been added as a peer
 // or the handshakes have failed.
 func (srv *Server) SetupConn(fd net.Conn, flags connFlag, dialDest *enode.Node) error {
+	if srv.WrapConn != nil {
+		fd = srv.WrapConn(fd)
+	}
+	fd = &countingConn{Conn: fd}
 	c := &conn{fd: fd, flags: flags, cont: make(chan error)}
 	if dialDest == nil {
 		c.transport = srv.newTransport(fd, nil)
@@ -0,0 +1,59 @@
+package params
+
+import (
+	"encoding/json"
+	"runtime"
+
+	"github.com/ledgerwatch/erigon/common"
+	"golang.org/x/crypto/sha3"
+)
+
+// BuildTags - go build tags of the binary, injected through the build flags like GitCommit (see Makefile)
+var BuildTags string
+
+// BuildInfo - what binary is running: version, source and the way it was built
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	GitBranch string `json:"gitBranch"`
+	GitTag    string `json:"gitTag"`
+	BuildTags string `json:"buildTags"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// GetBuildInfo returns metadata embedded into the binary
+func GetBuildInfo() BuildInfo {
+	return BuildInfo{
+		Version:   VersionWithMeta,
+		GitCommit: GitCommit,
+		GitBranch: GitBranch,
+		GitTag:    GitTag,
+		BuildTags: BuildTags,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+}
+
+// VersionInfo - what node is running: binary, chain and enabled experimental features.
+// Printed by erigon at startup and returned by erigon_versionInfo, so fleet of nodes can be verified by machine.
+type VersionInfo struct {
+	BuildInfo
+	Chain           string      `json:"chain"`
+	GenesisHash     common.Hash `json:"genesisHash"`
+	ChainConfigHash common.Hash `json:"chainConfigHash"`
+	Experiments     []string    `json:"experiments"`
+}
+
+// ChainConfigHash - keccak256 of JSON encoding of chain config: nodes with equal hashes follow equal forks
+func ChainConfigHash(c *ChainConfig) (common.Hash, error) {
+	enc, err := json.Marshal(c)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	var h common.Hash
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(enc)
+	hasher.Sum(h[:0])
+	return h, nil
+}
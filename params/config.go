@@ -17,9 +17,12 @@
 package params
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"path"
+	"sort"
+	"strconv"
 
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/common/paths"
@@ -33,6 +36,7 @@ const (
 	EtHashConsensus ConsensusType = "ethash"
 	CliqueConsensus ConsensusType = "clique"
 	ParliaConsensus ConsensusType = "parlia"
+	BorConsensus    ConsensusType = "bor"
 )
 
 // Genesis hashes to enforce below configs on.
@@ -490,6 +494,9 @@ type ChainConfig struct {
 	LondonBlock         *big.Int `json:"londonBlock,omitempty"`         // London switch block (nil = no fork, 0 = already on london)
 	ArrowGlacierBlock   *big.Int `json:"arrowGlacierBlock,omitempty"`   // EIP-4345 (bomb delay) switch block (nil = no fork, 0 = already activated)
 
+	// Experimental EVM Object Format (EIP-3540, 3670, 4200, 4750, 5450), for experimental networks only
+	EOFBlock *big.Int `json:"eofBlock,omitempty"` // EOF switch block (nil = no fork, 0 = already activated)
+
 	RamanujanBlock  *big.Int `json:"ramanujanBlock,omitempty"`  // ramanujanBlock switch block (nil = no fork, 0 = already activated)
 	NielsBlock      *big.Int `json:"nielsBlock,omitempty"`      // nielsBlock switch block (nil = no fork, 0 = already activated)
 	MirrorSyncBlock *big.Int `json:"mirrorSyncBlock,omitempty"` // mirrorSyncBlock switch block (nil = no fork, 0 = already activated)
@@ -501,6 +508,12 @@ type ChainConfig struct {
 	Clique *CliqueConfig `json:"clique,omitempty"`
 	Aura   *AuRaConfig   `json:"aura,omitempty"`
 	Parlia *ParliaConfig `json:"parlia,omitempty"`
+	Bor    *BorConfig    `json:"bor,omitempty"`
+	// Settings of consensus engine registered via consensus.RegisterEngine, which is named by Consensus field
+	Engine json.RawMessage `json:"engine,omitempty"`
+
+	// Experimental sponsored transactions (fee payer different from sender), for research networks only
+	Sponsorship *SponsorshipConfig `json:"sponsorship,omitempty"`
 }
 
 // EthashConfig is the consensus engine configs for proof-of-work based sealing.
@@ -529,6 +542,12 @@ func (c *CliqueConfig) String() string {
 	return "clique"
 }
 
+// ExternalConsensusConfig - node settings for consensus engines registered via consensus.RegisterEngine
+type ExternalConsensusConfig struct {
+	DBPath   string // directory in which engine may keep its databases
+	InMemory bool
+}
+
 // ParliaConfig is the consensus engine configs for proof-of-staked-authority based sealing.
 type ParliaConfig struct {
 	DBPath   string
@@ -542,6 +561,88 @@ func (b *ParliaConfig) String() string {
 	return "parlia"
 }
 
+// BorConfig is the consensus engine configs for Polygon PoS (Matic) chains: validators are elected by
+// staking on Ethereum and announced by Heimdall, they produce blocks in sprints.
+type BorConfig struct {
+	DBPath          string
+	InMemory        bool
+	HeimdallURL     string // REST API of Heimdall node: spans and state sync events
+	WithoutHeimdall bool   // validators are taken from headers, state sync events are not committed (devnets)
+
+	Period                   map[string]uint64      `json:"period"`                   // Number of seconds between blocks to enforce, by activation block
+	ProducerDelay            uint64                 `json:"producerDelay"`            // Number of seconds delay between two producer interval
+	Sprint                   uint64                 `json:"sprint"`                   // Epoch length to proposer
+	BackupMultiplier         map[string]uint64      `json:"backupMultiplier"`         // Backup multiplier to determine the wiggle time, by activation block
+	ValidatorContract        string                 `json:"validatorContract"`        // Validator set contract
+	StateReceiverContract    string                 `json:"stateReceiverContract"`    // State receiver contract
+	OverrideStateSyncRecords map[string]int         `json:"overrideStateSyncRecords"` // override state records count, by block
+	BlockAlloc               map[string]interface{} `json:"blockAlloc"`               // contract codes replaced at given blocks
+}
+
+// String implements the stringer interface, returning the consensus engine details.
+func (c *BorConfig) String() string {
+	return "bor"
+}
+
+func (c *BorConfig) CalculateBackupMultiplier(number uint64) uint64 {
+	return borKeyValueConfigHelper(c.BackupMultiplier, number)
+}
+
+func (c *BorConfig) CalculatePeriod(number uint64) uint64 {
+	return borKeyValueConfigHelper(c.Period, number)
+}
+
+// IsSprintStart - first block of sprint, state sync events and spans are committed in it
+func (c *BorConfig) IsSprintStart(number uint64) bool {
+	return number%c.Sprint == 0
+}
+
+// Validate - checks values which are used without checks: Sprint divides block numbers, Period and BackupMultiplier
+// must have value for every block
+func (c *BorConfig) Validate() error {
+	if c.Sprint == 0 {
+		return fmt.Errorf("sprint must be positive")
+	}
+	for name, field := range map[string]map[string]uint64{"period": c.Period, "backupMultiplier": c.BackupMultiplier} {
+		if len(field) == 0 {
+			return fmt.Errorf("%s must have value for at least one block", name)
+		}
+		for k := range field {
+			if _, err := strconv.ParseUint(k, 10, 64); err != nil {
+				return fmt.Errorf("%s: block number expected, got %q", name, k)
+			}
+		}
+	}
+	return nil
+}
+
+// borKeyValueConfigHelper - value of latest activation block which is not after number, field is checked by Validate
+func borKeyValueConfigHelper(field map[string]uint64, number uint64) uint64 {
+	keys := make([]uint64, 0, len(field))
+	for k := range field {
+		n, err := strconv.ParseUint(k, 10, 64)
+		if err != nil {
+			panic(err)
+		}
+		keys = append(keys, n)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for i := 0; i < len(keys)-1; i++ {
+		if number >= keys[i] && number < keys[i+1] {
+			return field[strconv.FormatUint(keys[i], 10)]
+		}
+	}
+	return field[strconv.FormatUint(keys[len(keys)-1], 10)]
+}
+
+// SponsorshipConfig enables sponsored transactions: gas of transaction is paid by fee payer
+// chosen by resolver registered under Scheme name (see core.RegisterFeePayerResolver).
+type SponsorshipConfig struct {
+	Block    *big.Int       `json:"block"`              // activation block
+	Scheme   string         `json:"scheme"`             // name of fee payer resolver, for example "registry"
+	Registry common.Address `json:"registry,omitempty"` // contract with sponsors of senders, used by "registry" scheme
+}
+
 // String implements the fmt.Stringer interface.
 func (c *ChainConfig) String() string {
 	var engine interface{}
@@ -552,6 +653,8 @@ func (c *ChainConfig) String() string {
 		engine = c.Clique
 	case c.Parlia != nil:
 		engine = c.Parlia
+	case c.Bor != nil:
+		engine = c.Bor
 	default:
 		engine = "unknown"
 	}
@@ -727,6 +830,16 @@ func (c *ChainConfig) IsArrowGlacier(num uint64) bool {
 	return isForked(c.ArrowGlacierBlock, num)
 }
 
+// IsEOF returns whether num is either equal to the EOF fork block or greater.
+func (c *ChainConfig) IsEOF(num uint64) bool {
+	return isForked(c.EOFBlock, num)
+}
+
+// IsSponsorship returns whether sponsored transactions are enabled at block num.
+func (c *ChainConfig) IsSponsorship(num uint64) bool {
+	return c.Sponsorship != nil && isForked(c.Sponsorship.Block, num)
+}
+
 // CheckCompatible checks whether scheduled fork transitions have been imported
 // with a mismatching chain configuration.
 func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64) *ConfigCompatError {
@@ -746,11 +859,17 @@ func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64) *Confi
 }
 
 // CheckConfigForkOrder checks that we don't "skip" any forks, geth isn't pluggable enough
-// to guarantee that forks can be implemented in a different order than on official networks
+// to guarantee that forks can be implemented in a different order than on official networks.
+// Also checks config of bor, its invalid values would crash the node.
 func (c *ChainConfig) CheckConfigForkOrder() error {
 	if c != nil && c.ChainID != nil && c.ChainID.Uint64() == 77 {
 		return nil
 	}
+	if c.Bor != nil {
+		if err := c.Bor.Validate(); err != nil {
+			return fmt.Errorf("invalid bor config: %w", err)
+		}
+	}
 	type fork struct {
 		name     string
 		block    *big.Int
@@ -771,6 +890,7 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 		{name: "berlinBlock", block: c.BerlinBlock},
 		{name: "londonBlock", block: c.LondonBlock},
 		{name: "arrowGlacierBlock", block: c.ArrowGlacierBlock, optional: true},
+		{name: "eofBlock", block: c.EOFBlock, optional: true},
 	} {
 		if lastFork.name != "" {
 			// Next one must be higher number
@@ -849,9 +969,22 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head uint64) *ConfigC
 	if isForkIncompatible(c.ArrowGlacierBlock, newcfg.ArrowGlacierBlock, head) {
 		return newCompatError("Arrow Glacier fork block", c.ArrowGlacierBlock, newcfg.ArrowGlacierBlock)
 	}
+	if isForkIncompatible(c.EOFBlock, newcfg.EOFBlock, head) {
+		return newCompatError("EOF fork block", c.EOFBlock, newcfg.EOFBlock)
+	}
+	if isForkIncompatible(c.sponsorshipBlock(), newcfg.sponsorshipBlock(), head) {
+		return newCompatError("Sponsorship fork block", c.sponsorshipBlock(), newcfg.sponsorshipBlock())
+	}
 	return nil
 }
 
+func (c *ChainConfig) sponsorshipBlock() *big.Int {
+	if c.Sponsorship == nil {
+		return nil
+	}
+	return c.Sponsorship.Block
+}
+
 // isForkIncompatible returns true if a fork scheduled at s1 cannot be rescheduled to
 // block s2 because head is already past the fork.
 func isForkIncompatible(s1, s2 *big.Int, head uint64) bool {
@@ -917,6 +1050,7 @@ type Rules struct {
 	IsHomestead, IsEIP150, IsEIP155, IsEIP158               bool
 	IsByzantium, IsConstantinople, IsPetersburg, IsIstanbul bool
 	IsBerlin, IsLondon                                      bool
+	IsEOF                                                   bool
 }
 
 // Rules ensures c's ChainID is not nil.
@@ -937,5 +1071,6 @@ func (c *ChainConfig) Rules(num uint64) Rules {
 		IsIstanbul:       c.IsIstanbul(num),
 		IsBerlin:         c.IsBerlin(num),
 		IsLondon:         c.IsLondon(num),
+		IsEOF:            c.IsEOF(num),
 	}
 }
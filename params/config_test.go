@@ -96,3 +96,24 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckBorConfig(t *testing.T) {
+	valid := func() *BorConfig {
+		return &BorConfig{Sprint: 64, Period: map[string]uint64{"0": 2}, BackupMultiplier: map[string]uint64{"0": 2, "100": 5}}
+	}
+	if err := (&ChainConfig{Bor: valid()}).CheckConfigForkOrder(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+	noSprint, noPeriod, badKey := valid(), valid(), valid()
+	noSprint.Sprint = 0
+	noPeriod.Period = nil
+	badKey.BackupMultiplier["x"] = 1
+	for _, c := range []*BorConfig{noSprint, noPeriod, badKey} {
+		if err := (&ChainConfig{Bor: c}).CheckConfigForkOrder(); err == nil {
+			t.Errorf("expected error for %+v", c)
+		}
+	}
+	if got := valid().CalculateBackupMultiplier(150); got != 5 {
+		t.Errorf("backup multiplier at 150: %d, want 5", got)
+	}
+}
@@ -21,4 +21,12 @@ type MiningConfig struct {
 	GasCeil   uint64            // Target gas ceiling for mined blocks.
 	GasPrice  *big.Int          // Minimum gas price for mining a transaction
 	Recommit  time.Duration     // The time interval for miner to re-create mining work.
+
+	BuilderAddr      string `toml:",omitempty"` // Listen address of gRPC endpoint which accepts transaction bundles from external builders
+	BuilderAuthToken string `toml:",omitempty"` // Builders send it in gRPC metadata "authorization: Bearer <token>"
+	TxSelection      string `toml:",omitempty"` // Policy of external builders' bundles selection: maxprofit or fifo
+
+	RelayAddr    string        `toml:",omitempty"` // Listen address of builder API for consensus layer, which proxies relays
+	Relays       []string      `toml:",omitempty"` // URLs of relays, whose bids compete with locally built payload
+	RelayTimeout time.Duration // How long builder API waits for relays' bids
 }
@@ -69,6 +69,10 @@ const (
 	SstoreClearsScheduleRefundEIP3529 uint64 = SstoreResetGasEIP2200 - ColdSloadCostEIP2929 + TxAccessListStorageKeyGas
 
 	JumpdestGas   uint64 = 1     // Once per JUMPDEST operation.
+	RjumpGas      uint64 = 2     // Once per RJUMP operation (EIP-4200).
+	RjumpiGas     uint64 = 4     // Once per RJUMPI and RJUMPV operation (EIP-4200).
+	CallfGas      uint64 = 5     // Once per CALLF operation (EIP-4750).
+	RetfGas       uint64 = 3     // Once per RETF operation (EIP-4750).
 	EpochDuration uint64 = 30000 // Duration between proof-of-work epochs.
 
 	CreateDataGas         uint64 = 200   //
@@ -0,0 +1,25 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+)
+
+type batchKey struct{}
+
+// Batch is shared by calls of one batch request. Services use it to limit resources
+// consumed by the whole batch: calls of a batch are executed concurrently.
+type Batch struct {
+	values sync.Map
+}
+
+// LoadOrStore returns the existing value for the key if present, otherwise it stores value.
+func (b *Batch) LoadOrStore(key, value interface{}) (actual interface{}, loaded bool) {
+	return b.values.LoadOrStore(key, value)
+}
+
+// BatchFromContext returns the Batch of the call, ok is false if the call isn't part of a batch request.
+func BatchFromContext(ctx context.Context) (*Batch, bool) {
+	b, ok := ctx.Value(batchKey{}).(*Batch)
+	return b, ok
+}
@@ -80,6 +80,7 @@ type Client struct {
 	methodAllowList AllowList
 
 	idCounter uint32
+	connID    uint64
 
 	// This function, if non-nil, is called when the connection is lost.
 	reconnectFunc reconnectFunc
@@ -191,6 +192,14 @@ func ClientFromContext(ctx context.Context) (*Client, bool) {
 	return client, ok
 }
 
+var connCounter uint64
+
+// ConnID returns number of the connection, unique in the process. Server handlers get the client of their
+// connection with ClientFromContext.
+func (c *Client) ConnID() uint64 {
+	return c.connID
+}
+
 func newClient(initctx context.Context, connect reconnectFunc) (*Client, error) {
 	conn, err := connect(initctx)
 	if err != nil {
@@ -217,6 +226,7 @@ func initClient(conn ServerCodec, idgen func() ID, services *serviceRegistry) *C
 		reqInit:     make(chan *requestOp),
 		reqSent:     make(chan error, 1),
 		reqTimeout:  make(chan *requestOp),
+		connID:      atomic.AddUint64(&connCounter, 1),
 	}
 	if !isHTTP {
 		go c.dispatch(conn)
@@ -0,0 +1,152 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/ugorji/go/codec"
+)
+
+// Besides JSON, HTTP responses can be encoded by CBOR or MessagePack - it's for indexers which fetch big traces
+// (debug_trace*, trace_*): payload is smaller and faster to parse than JSON. Requests are always JSON.
+// Client selects encoding by Accept header or by "encoding" query parameter (it has priority), for example:
+//
+//	curl -H "Content-Type: application/json" -H "Accept: application/cbor" -d '{...}' localhost:8545
+//	curl -H "Content-Type: application/json" -d '{...}' "localhost:8545?encoding=msgpack"
+//
+// Response has same structure as JSON one: objects keep order of fields, hex strings stay strings.
+const (
+	cborContentType    = "application/cbor"
+	msgpackContentType = "application/msgpack"
+	encodingQueryParam = "encoding"
+)
+
+var (
+	cborHandle    = &codec.CborHandle{}
+	msgpackHandle = &codec.MsgpackHandle{WriteExt: true} // WriteExt - use str and bin types of current spec
+)
+
+// binaryEncoding - encoding of responses other than JSON
+type binaryEncoding struct {
+	name        string
+	contentType string
+	handle      codec.Handle
+}
+
+var binaryEncodings = []*binaryEncoding{
+	{name: "cbor", contentType: cborContentType, handle: cborHandle},
+	{name: "msgpack", contentType: msgpackContentType, handle: msgpackHandle},
+	{name: "msgpack", contentType: "application/x-msgpack", handle: msgpackHandle},
+}
+
+// negotiateEncoding - nil means JSON
+func negotiateEncoding(r *http.Request) (*binaryEncoding, error) {
+	if name := r.URL.Query().Get(encodingQueryParam); name != "" {
+		if name == "json" {
+			return nil, nil
+		}
+		for _, enc := range binaryEncodings {
+			if enc.name == name {
+				return enc, nil
+			}
+		}
+		return nil, fmt.Errorf("unsupported encoding %q, supported: json, cbor, msgpack", name)
+	}
+	for _, accept := range strings.Split(r.Header.Get("accept"), ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		if mt == contentType {
+			return nil, nil // JSON is preferred by client
+		}
+		for _, enc := range binaryEncodings {
+			if enc.contentType == mt {
+				return enc, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// encoder - writes JSON-RPC messages to w in this encoding. Messages are already serialized to JSON
+// (streaming methods write JSON directly), so they are transcoded.
+func (e *binaryEncoding) encoder(w io.Writer) func(v interface{}) error {
+	enc := codec.NewEncoder(w, e.handle)
+	return func(v interface{}) error {
+		data, ok := v.(json.RawMessage)
+		if !ok {
+			var err error
+			if data, err = json.Marshal(v); err != nil {
+				return err
+			}
+		}
+		value, err := fromJSON(data)
+		if err != nil {
+			return err
+		}
+		enc.Reset(w)
+		return enc.Encode(value)
+	}
+}
+
+// orderedMap - JSON object, encoded as map with fields in original order (key, value, key, value...)
+type orderedMap []interface{}
+
+func (orderedMap) MapBySlice() {}
+
+// fromJSON - generic value of JSON document: numbers become integers if they fit into 64 bits
+func fromJSON(data []byte) (interface{}, error) {
+	iter := jsoniter.ConfigDefault.BorrowIterator(data)
+	defer jsoniter.ConfigDefault.ReturnIterator(iter)
+	v := readJSONValue(iter)
+	if iter.Error != nil && iter.Error != io.EOF {
+		return nil, iter.Error
+	}
+	return v, nil
+}
+
+func readJSONValue(iter *jsoniter.Iterator) interface{} {
+	switch iter.WhatIsNext() {
+	case jsoniter.StringValue:
+		return iter.ReadString()
+	case jsoniter.NumberValue:
+		n := iter.ReadNumber()
+		if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+			return u
+		}
+		f, err := n.Float64()
+		if err != nil {
+			iter.ReportError("read number", err.Error())
+		}
+		return f
+	case jsoniter.BoolValue:
+		return iter.ReadBool()
+	case jsoniter.ArrayValue:
+		arr := []interface{}{}
+		iter.ReadArrayCB(func(iter *jsoniter.Iterator) bool {
+			arr = append(arr, readJSONValue(iter))
+			return true
+		})
+		return arr
+	case jsoniter.ObjectValue:
+		obj := orderedMap{}
+		iter.ReadObjectCB(func(iter *jsoniter.Iterator, field string) bool {
+			obj = append(obj, field, readJSONValue(iter))
+			return true
+		})
+		return obj
+	default:
+		iter.Skip() // null or invalid input, iterator reports error
+		return nil
+	}
+}
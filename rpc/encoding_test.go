@@ -0,0 +1,104 @@
+package rpc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/require"
+	"github.com/ugorji/go/codec"
+)
+
+type streamService struct{}
+
+func (streamService) Numbers(_ context.Context, stream *jsoniter.Stream) error {
+	stream.WriteArrayStart()
+	stream.WriteUint64(18446744073709551615)
+	stream.WriteMore()
+	stream.WriteInt(-1)
+	stream.WriteMore()
+	stream.WriteFloat64(0.5)
+	stream.WriteArrayEnd()
+	return nil
+}
+
+func TestHTTPBinaryEncoding(t *testing.T) {
+	s := newTestServer()
+	defer s.Stop()
+	require.NoError(t, s.RegisterName("stream", streamService{}))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	post := func(query, accept, body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+query, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("content-type", contentType)
+		if accept != "" {
+			req.Header.Set("accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	decode := func(resp *http.Response, h codec.Handle, v interface{}) {
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, codec.NewDecoderBytes(data, h).Decode(v))
+	}
+
+	for _, tt := range []struct {
+		query, accept, contentType string
+		handle                     codec.Handle
+	}{
+		{accept: "application/cbor", contentType: cborContentType, handle: cborHandle},
+		{accept: "text/html, application/msgpack;q=0.9", contentType: msgpackContentType, handle: msgpackHandle},
+		{query: "?encoding=cbor", accept: "application/json", contentType: cborContentType, handle: cborHandle},
+		{query: "?encoding=msgpack", contentType: msgpackContentType, handle: msgpackHandle},
+	} {
+		resp := post(tt.query, tt.accept, `{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["x",7,{"S":"y"}]}`)
+		require.Equal(t, tt.contentType, resp.Header.Get("content-type"))
+		var echo struct {
+			Version string     `codec:"jsonrpc"`
+			ID      int        `codec:"id"`
+			Result  echoResult `codec:"result"`
+		}
+		decode(resp, tt.handle, &echo)
+		require.Equal(t, "2.0", echo.Version)
+		require.Equal(t, 1, echo.ID)
+		require.Equal(t, echoResult{String: "x", Int: 7, Args: &echoArgs{S: "y"}}, echo.Result)
+
+		// streaming methods write JSON, it's transcoded
+		resp = post(tt.query, tt.accept, `[{"jsonrpc":"2.0","id":2,"method":"stream_numbers"}]`)
+		var batch []struct {
+			Result []interface{} `codec:"result"`
+		}
+		decode(resp, tt.handle, &batch)
+		require.Len(t, batch, 1)
+		require.Len(t, batch[0].Result, 3)
+		require.EqualValues(t, uint64(18446744073709551615), batch[0].Result[0])
+		require.EqualValues(t, -1, batch[0].Result[1])
+		require.EqualValues(t, 0.5, batch[0].Result[2])
+	}
+
+	resp := post("", "*/*", `{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["x",7,{"S":"y"}]}`)
+	resp.Body.Close()
+	require.Equal(t, contentType, resp.Header.Get("content-type"))
+
+	resp = post("?encoding=xml", "", `{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["x",7,{"S":"y"}]}`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+}
+
+func TestFromJSONKeepsFieldOrder(t *testing.T) {
+	v, err := fromJSON([]byte(`{"b":1,"a":{"":null,"c":[true,"s"]}}`))
+	require.NoError(t, err)
+	require.Equal(t, orderedMap{"b", int64(1), "a", orderedMap{"", nil, "c", []interface{}{true, "s"}}}, v)
+
+	_, err = fromJSON([]byte(`{"b":`))
+	require.Error(t, err)
+}
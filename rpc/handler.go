@@ -27,6 +27,8 @@ import (
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/ledgerwatch/erigon/common/otel"
+	"github.com/ledgerwatch/erigon/common/reqlabel"
 	"github.com/ledgerwatch/log/v3"
 )
 
@@ -122,6 +124,7 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 	}
 	// Process calls on a goroutine because they may block indefinitely:
 	h.startCallProc(func(cp *callProc) {
+		cp.ctx = context.WithValue(cp.ctx, batchKey{}, &Batch{})
 		// All goroutines will place results right to this array. Because requests order must match reply orders.
 		answersWithNils := make([]interface{}, len(msgs))
 		// Bounded parallelism pattern explanation https://blog.golang.org/pipelines#TOC_9.
@@ -386,16 +389,24 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage, stream *jsoniter
 		return msg.errorResponse(&invalidParamsError{err.Error()})
 	}
 	start := time.Now()
-	answer := h.runMethod(cp.ctx, msg, callb, args, stream)
+	ctx := cp.ctx
+	var span *otel.Span
+	if callb != h.unsubscribeCb {
+		ctx = reqlabel.With(ctx, reqlabel.New(ctx, msg.Method, h.conn.remoteAddr()))
+		ctx, span = otel.Start(ctx, otel.KindServer, msg.Method, otel.String("rpc.system", "jsonrpc"), otel.String("rpc.method", msg.Method))
+	}
+	answer := h.runMethod(ctx, msg, callb, args, stream)
 
 	// Collect the statistics for RPC calls if metrics is enabled.
 	// We only care about pure rpc call. Filter out subscription.
 	if callb != h.unsubscribeCb {
-		rpcRequestGauge.Inc()
-		if answer != nil && answer.Error != nil {
-			failedReqeustGauge.Inc()
+		valid := answer == nil || answer.Error == nil
+		if !valid {
+			span.SetError(answer.Error)
 		}
-		newRPCServingTimerMS(msg.Method, answer == nil || answer.Error == nil).UpdateDuration(start)
+		span.Finish()
+		newRPCRequestCounter(msg.Method, valid).Inc()
+		newRPCServingTimerMS(msg.Method, valid).UpdateDuration(start)
 	}
 	return answer
 }
@@ -426,7 +437,7 @@ func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage, stream *jso
 	args = args[1:]
 
 	// Install notifier in context so the subscription handler can find it.
-	n := &Notifier{h: h, namespace: namespace}
+	n := &Notifier{h: h, namespace: namespace, activatedCh: make(chan struct{})}
 	cp.notifiers = append(cp.notifiers, n)
 	ctx := context.WithValue(cp.ctx, notifierKey{}, n)
 
@@ -29,6 +29,9 @@ import (
 	"net/url"
 	"sync"
 	"time"
+
+	"github.com/ledgerwatch/erigon/common/otel"
+	"github.com/ledgerwatch/erigon/common/reqlabel"
 )
 
 const (
@@ -212,6 +215,15 @@ func newHTTPServerConn(r *http.Request, w http.ResponseWriter) ServerCodec {
 	return NewCodec(conn)
 }
 
+// newBinaryHTTPServerConn - reads JSON requests, writes responses in given encoding
+func newBinaryHTTPServerConn(r *http.Request, w http.ResponseWriter, enc *binaryEncoding) ServerCodec {
+	body := io.LimitReader(r.Body, maxRequestContentLength)
+	conn := &httpServerConn{Reader: body, Writer: w, r: r}
+	dec := json.NewDecoder(conn)
+	dec.UseNumber()
+	return NewFuncCodec(conn, enc.encoder(conn), dec.Decode)
+}
+
 // Close does nothing and always returns nil.
 func (t *httpServerConn) Close() error { return nil }
 
@@ -247,9 +259,29 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if origin := r.Header.Get("Origin"); origin != "" {
 		ctx = context.WithValue(ctx, "Origin", origin)
 	}
+	if id := r.Header.Get("X-Request-Id"); id != "" {
+		ctx = reqlabel.WithID(ctx, id)
+	}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		ctx = context.WithValue(ctx, "Authorization", auth)
+	}
+	if traceparent := r.Header.Get("traceparent"); traceparent != "" {
+		ctx = otel.Extract(ctx, traceparent)
+	}
 
-	w.Header().Set("content-type", contentType)
-	codec := newHTTPServerConn(r, w)
+	enc, err := negotiateEncoding(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+	var codec ServerCodec
+	if enc != nil {
+		w.Header().Set("content-type", enc.contentType)
+		codec = newBinaryHTTPServerConn(r, w, enc)
+	} else {
+		w.Header().Set("content-type", contentType)
+		codec = newHTTPServerConn(r, w)
+	}
 	defer codec.close()
 	s.serveSingleRequest(ctx, codec)
 }
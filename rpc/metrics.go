@@ -22,16 +22,19 @@ import (
 	"github.com/VictoriaMetrics/metrics"
 )
 
-var (
-	rpcRequestGauge    = metrics.GetOrCreateCounter("rpc_total")
-	failedReqeustGauge = metrics.GetOrCreateCounter("rpc_failure")
-)
+func rpcStatus(valid bool) string {
+	if valid {
+		return "success"
+	}
+	return "failure"
+}
+
+// newRPCRequestCounter - rpc_requests_total{method,status}, see metrics/exp.Registry
+func newRPCRequestCounter(method string, valid bool) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`rpc_requests_total{method=%q,status=%q}`, method, rpcStatus(valid)))
+}
 
 func newRPCServingTimerMS(method string, valid bool) *metrics.Summary {
-	flag := "success"
-	if !valid {
-		flag = "failure"
-	}
-	m := fmt.Sprintf(`rpc_duration_seconds{method="%s",success="%s"}`, method, flag)
+	m := fmt.Sprintf(`rpc_duration_seconds{method=%q,status=%q}`, method, rpcStatus(valid))
 	return metrics.GetOrCreateSummary(m)
 }
@@ -99,6 +99,7 @@ type Notifier struct {
 	buffer       []json.RawMessage
 	callReturned bool
 	activated    bool
+	activatedCh  chan struct{} // closed on activation
 }
 
 // CreateSubscription returns a new subscription that is coupled to the
@@ -169,9 +170,17 @@ func (n *Notifier) activate() error {
 		}
 	}
 	n.activated = true
+	close(n.activatedCh)
 	return nil
 }
 
+// Activated returns a channel which is closed when the subscription is activated. After activation notifications are
+// written to the connection synchronously - Notify blocks while client doesn't read, before activation they are
+// buffered in memory. Subscriptions which send many notifications at once wait for activation.
+func (n *Notifier) Activated() <-chan struct{} {
+	return n.activatedCh
+}
+
 func (n *Notifier) send(sub *Subscription, data json.RawMessage) error {
 	params, _ := json.Marshal(&subscriptionResult{ID: string(sub.ID), Result: data})
 	ctx := context.Background()
@@ -16,22 +16,24 @@ type StateReader struct {
 	accChangesC, storageChangesC kv.CursorDupSort
 	blockNr                      uint64
 	tx                           kv.Tx
+	history                      state.HistorySnapshots
 }
 
-func NewStateReader(tx kv.Tx, blockNr uint64) *StateReader {
+func NewStateReader(tx kv.Tx, blockNr uint64, history state.HistorySnapshots) *StateReader {
 	c1, _ := tx.Cursor(kv.AccountsHistory)
 	c2, _ := tx.Cursor(kv.StorageHistory)
 	c3, _ := tx.CursorDupSort(kv.AccountChangeSet)
 	c4, _ := tx.CursorDupSort(kv.StorageChangeSet)
 	return &StateReader{
 		tx:          tx,
+		history:     history,
 		blockNr:     blockNr,
 		accHistoryC: c1, storageHistoryC: c2, accChangesC: c3, storageChangesC: c4,
 	}
 }
 
 func (r *StateReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
-	enc, err := state.GetAsOf(r.tx, r.accHistoryC, r.accChangesC, false /* storage */, address[:], r.blockNr+1)
+	enc, err := state.GetAsOf(r.tx, r.history, r.accHistoryC, r.accChangesC, false /* storage */, address[:], r.blockNr+1)
 	if err != nil || enc == nil || len(enc) == 0 {
 		return nil, nil
 	}
@@ -44,7 +46,7 @@ func (r *StateReader) ReadAccountData(address common.Address) (*accounts.Account
 
 func (r *StateReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
 	compositeKey := dbutils.PlainGenerateCompositeStorageKey(address.Bytes(), incarnation, key.Bytes())
-	return state.GetAsOf(r.tx, r.storageHistoryC, r.storageChangesC, true /* storage */, compositeKey, r.blockNr+1)
+	return state.GetAsOf(r.tx, r.history, r.storageHistoryC, r.storageChangesC, true /* storage */, compositeKey, r.blockNr+1)
 }
 
 func (r *StateReader) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
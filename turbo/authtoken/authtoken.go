@@ -0,0 +1,28 @@
+// Package authtoken - bearer token which guards privileged features: clients send HTTP header (or gRPC metadata)
+// "Authorization: Bearer <token>". Empty token never matches, so features guarded by it are disabled until it's set.
+package authtoken
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+)
+
+// Header - name of HTTP header with token, lower case in gRPC metadata
+const Header = "Authorization"
+
+const bearer = "Bearer "
+
+// Matches - value of authorization header is "Bearer <token>", empty token never matches
+func Matches(authorization, token string) bool {
+	if token == "" || !strings.HasPrefix(authorization, bearer) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(authorization[len(bearer):]), []byte(token)) == 1
+}
+
+// FromContext - authorization header of JSON-RPC request, rpc keeps it in context of HTTP requests
+func FromContext(ctx context.Context) string {
+	authorization, _ := ctx.Value(Header).(string)
+	return authorization
+}
@@ -0,0 +1,21 @@
+package authtoken
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatches(t *testing.T) {
+	require.True(t, Matches("Bearer secret", "secret"))
+	require.False(t, Matches("Bearer other", "secret"))
+	require.False(t, Matches("secret", "secret"))
+	require.False(t, Matches("Basic secret", "secret"))
+	require.False(t, Matches("Bearer ", ""))
+	require.False(t, Matches("", ""))
+
+	ctx := context.WithValue(context.Background(), Header, "Bearer secret")
+	require.True(t, Matches(FromContext(ctx), "secret"))
+	require.Empty(t, FromContext(context.Background()))
+}
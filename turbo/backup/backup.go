@@ -0,0 +1,655 @@
+// Package backup - backups of datadir taken while Erigon is running, and their restore.
+//
+// Backup is a set of files in a directory or S3-compatible bucket:
+//   - chaindata.kv - all tables of chaindata read by one MDBX read transaction (consistent snapshot of the database):
+//     records of table name ('T', uvarint size, name) followed by its key-value pairs ('R', uvarint size, key, uvarint
+//     size, value), ended by 'E' and uvarint amount of pairs
+//   - snapshots/... - snapshot files (.seg, .idx, history files) which existed when the transaction started, as is.
+//     They are hard-linked at start: merge of segments deletes retired files while backup reads them
+//   - manifest.json - list of files with sizes and sha256 of stored bytes, stage progress of the snapshot, compression
+//     and encryption. It's written last: backup without manifest is incomplete
+//
+// Files are optionally compressed by zstd, then encrypted (see stream.go).
+package backup
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/turbo/s3"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	ManifestFile    = "manifest.json"
+	CompressionZstd = "zstd"
+
+	manifestVersion = 1
+	chaindataFile   = "chaindata.kv"
+	snapshotsDir    = "snapshots"
+
+	recordTable = 'T'
+	recordPair  = 'R'
+	recordEnd   = 'E'
+)
+
+var (
+	ErrNoManifest       = errors.New("backup has no manifest, it's incomplete")
+	ErrChaindataExists  = errors.New("chaindata already exists, restore only into datadir without it")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// progressLogInterval - backup of large database takes hours
+var progressLogInterval = 30 * time.Second
+
+// linkAttempts - snapshot files are listed again if some were deleted before their links were created
+const linkAttempts = 5
+
+type Options struct {
+	Compress   bool
+	Passphrase []byte // empty - not encrypted
+}
+
+type Manifest struct {
+	Version     int               `json:"version"`
+	Created     time.Time         `json:"created"`
+	Stages      map[string]uint64 `json:"stages"`
+	Compression string            `json:"compression,omitempty"`
+	Encryption  *Encryption       `json:"encryption,omitempty"`
+	Files       []File            `json:"files"`
+}
+
+type File struct {
+	Name    string        `json:"name"`
+	Size    uint64        `json:"size"`              // stored bytes
+	Entries uint64        `json:"entries,omitempty"` // key-value pairs of chaindata
+	Sha256  hexutil.Bytes `json:"sha256"`            // of stored bytes
+}
+
+// Backup - writes backup of chaindata and snapshot files to target. Database can be used by Erigon: backup reads it
+// by one read transaction, which keeps pages of the snapshot from reuse until chaindata is copied (database may grow).
+func Backup(ctx context.Context, db kv.RwDB, snapshotDir string, target Target, opts Options) (*Manifest, error) {
+	m := &Manifest{Version: manifestVersion, Created: time.Now().UTC(), Stages: map[string]uint64{}}
+	if opts.Compress {
+		m.Compression = CompressionZstd
+	}
+	var key []byte
+	if len(opts.Passphrase) > 0 {
+		var err error
+		if m.Encryption, key, err = newEncryption(opts.Passphrase); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	for _, s := range stages.AllStages {
+		progress, err := stages.GetStageProgress(tx, s)
+		if err != nil {
+			return nil, err
+		}
+		if progress > 0 {
+			m.Stages[string(s)] = progress
+		}
+	}
+	// snapshot files are immutable: files which exist at start of the transaction are consistent with it. Links keep
+	// them until backup ends, even if they are retired meanwhile
+	linksDir, snapshotFiles, err := linkSnapshotFiles(snapshotDir)
+	if err != nil {
+		return nil, err
+	}
+	if linksDir != "" {
+		defer os.RemoveAll(linksDir)
+	}
+	log.Info("Backup of chaindata", "execution", m.Stages[string(stages.Execution)], "finish", m.Stages[string(stages.Finish)])
+	f, err := backupChaindata(ctx, tx, db.AllBuckets(), target, m, key)
+	if err != nil {
+		return nil, err
+	}
+	tx.Rollback()
+	m.Files = append(m.Files, f)
+
+	for _, name := range snapshotFiles {
+		f, err := backupFile(ctx, filepath.Join(linksDir, filepath.FromSlash(name)), snapshotsDir+"/"+name, target, m, key)
+		if err != nil {
+			return nil, err
+		}
+		m.Files = append(m.Files, f)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	w, err := target.Create(ctx, ManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// linkSnapshotFiles - hard links of snapshot files in temporary directory inside of dir. Merged segments replace their
+// parts before parts are deleted: files deleted between listing and linking are found by listing again.
+func linkSnapshotFiles(dir string) (linksDir string, files []string, err error) {
+	if _, err = os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return "", nil, nil
+	}
+	for attempt := 1; ; attempt++ {
+		if linksDir, err = ioutil.TempDir(dir, "backup-*.tmp"); err != nil {
+			return "", nil, err
+		}
+		if files, err = listSnapshotFiles(dir); err == nil {
+			err = linkFiles(dir, linksDir, files)
+		}
+		if err == nil {
+			return linksDir, files, nil
+		}
+		os.RemoveAll(linksDir)
+		if !errors.Is(err, os.ErrNotExist) || attempt == linkAttempts {
+			return "", nil, err
+		}
+	}
+}
+
+func linkFiles(dir, linksDir string, files []string) error {
+	for _, name := range files {
+		link := filepath.Join(linksDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+			return err
+		}
+		if err := os.Link(filepath.Join(dir, filepath.FromSlash(name)), link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listSnapshotFiles - slash-separated paths relative to the directory, except temporary files and directories
+func listSnapshotFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() && path != dir && strings.HasSuffix(path, ".tmp") {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || !info.Mode().IsRegular() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func backupChaindata(ctx context.Context, tx kv.Tx, tables kv.TableCfg, target Target, m *Manifest, key []byte) (File, error) {
+	w, err := createFile(ctx, target, chaindataFile, m, key)
+	if err != nil {
+		return File{}, err
+	}
+	defer w.abort()
+	names := make([]string, 0, len(tables))
+	for name, cfg := range tables {
+		if !cfg.IsDeprecated {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	logEvery := time.NewTicker(progressLogInterval)
+	defer logEvery.Stop()
+	var entries uint64
+	for _, name := range names {
+		if err = w.record(recordTable, []byte(name)); err != nil {
+			return File{}, err
+		}
+		c, err := tx.Cursor(name)
+		if err != nil {
+			return File{}, err
+		}
+		for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+			if err != nil {
+				c.Close()
+				return File{}, err
+			}
+			if err = w.record(recordPair, k, v); err != nil {
+				c.Close()
+				return File{}, err
+			}
+			entries++
+			select {
+			case <-ctx.Done():
+				c.Close()
+				return File{}, ctx.Err()
+			case <-logEvery.C:
+				log.Info("Backup in progress", "table", name, "entries", entries, "written", datasize.ByteSize(w.hashing.size).HR())
+			default:
+			}
+		}
+		c.Close()
+	}
+	var end [binary.MaxVarintLen64 + 1]byte
+	end[0] = recordEnd
+	n := binary.PutUvarint(end[1:], entries)
+	if _, err = w.Write(end[:n+1]); err != nil {
+		return File{}, err
+	}
+	f, err := w.Close()
+	f.Entries = entries
+	return f, err
+}
+
+func backupFile(ctx context.Context, path, name string, target Target, m *Manifest, key []byte) (File, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer src.Close()
+	w, err := createFile(ctx, target, name, m, key)
+	if err != nil {
+		return File{}, err
+	}
+	defer w.abort()
+	if _, err = io.Copy(w, src); err != nil {
+		return File{}, err
+	}
+	log.Info("Backup of file", "name", name, "written", datasize.ByteSize(w.hashing.size).HR())
+	return w.Close()
+}
+
+// fileWriter - buffer -> zstd -> encryption -> hashing -> target
+type fileWriter struct {
+	name    string
+	target  Writer
+	hashing *hashingWriter
+	enc     *encryptWriter
+	zw      *zstd.Encoder
+	buf     *bufio.Writer
+	closed  bool
+}
+
+func createFile(ctx context.Context, target Target, name string, m *Manifest, key []byte) (*fileWriter, error) {
+	t, err := target.Create(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	w := &fileWriter{name: name, target: t, hashing: newHashingWriter(t)}
+	var out io.Writer = w.hashing
+	if key != nil {
+		if w.enc, err = newEncryptWriter(out, key, name); err != nil {
+			t.Abort()
+			return nil, err
+		}
+		out = w.enc
+	}
+	if m.Compression == CompressionZstd {
+		if w.zw, err = zstd.NewWriter(out); err != nil {
+			t.Abort()
+			return nil, err
+		}
+		out = w.zw
+	}
+	w.buf = bufio.NewWriterSize(out, 1024*1024)
+	return w, nil
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *fileWriter) record(kind byte, fields ...[]byte) error {
+	if err := w.buf.WriteByte(kind); err != nil {
+		return err
+	}
+	var size [binary.MaxVarintLen64]byte
+	for _, field := range fields {
+		n := binary.PutUvarint(size[:], uint64(len(field)))
+		if _, err := w.buf.Write(size[:n]); err != nil {
+			return err
+		}
+		if _, err := w.buf.Write(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *fileWriter) Close() (File, error) {
+	if err := w.buf.Flush(); err != nil {
+		return File{}, err
+	}
+	if w.zw != nil {
+		if err := w.zw.Close(); err != nil {
+			return File{}, err
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Close(); err != nil {
+			return File{}, err
+		}
+	}
+	w.closed = true
+	if err := w.target.Close(); err != nil {
+		return File{}, err
+	}
+	return File{Name: w.name, Size: w.hashing.size, Sha256: w.hashing.h.Sum(nil)}, nil
+}
+
+// abort - releases resources of the file which failed to write, file doesn't appear in target
+func (w *fileWriter) abort() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	if w.zw != nil {
+		w.zw.Close()
+	}
+	w.target.Abort()
+}
+
+func ReadManifest(ctx context.Context, target Target) (*Manifest, error) {
+	r, err := target.Open(ctx, ManifestFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, s3.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %v", ErrNoManifest, err)
+		}
+		return nil, err
+	}
+	defer r.Close()
+	m := &Manifest{}
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported version of backup: %d", m.Version)
+	}
+	if m.Compression != "" && m.Compression != CompressionZstd {
+		return nil, fmt.Errorf("unsupported compression of backup: %s", m.Compression)
+	}
+	return m, nil
+}
+
+// Restore - restores backup into datadir which has no chaindata. Every file is verified by checksum of the manifest.
+// Chaindata is restored into temporary directory and renamed at the end: interrupted restore can be started again.
+func Restore(ctx context.Context, target Target, datadir string, passphrase []byte) (*Manifest, error) {
+	m, err := ReadManifest(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	var key []byte
+	if m.Encryption != nil {
+		if key, err = m.Encryption.key(passphrase); err != nil {
+			return nil, err
+		}
+	}
+	chaindata := filepath.Join(datadir, "chaindata")
+	if _, err := os.Stat(filepath.Join(chaindata, "mdbx.dat")); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrChaindataExists, chaindata)
+	}
+	log.Info("Restore of backup", "created", m.Created, "files", len(m.Files), "execution", m.Stages[string(stages.Execution)])
+
+	var chaindataBackup *File
+	for i := range m.Files {
+		f := m.Files[i]
+		if f.Name == chaindataFile {
+			chaindataBackup = &f
+			continue
+		}
+		if err := restoreFile(ctx, target, f, m, key, datadir); err != nil {
+			return nil, err
+		}
+	}
+	if chaindataBackup == nil {
+		return nil, fmt.Errorf("backup has no %s", chaindataFile)
+	}
+	tmp := chaindata + ".restore"
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+	if err := restoreChaindata(ctx, target, *chaindataBackup, m, key, tmp); err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(chaindata); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, chaindata); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func restoreFile(ctx context.Context, target Target, f File, m *Manifest, key []byte, datadir string) error {
+	name := filepath.Clean(filepath.FromSlash(f.Name))
+	if !strings.HasPrefix(name, snapshotsDir+string(filepath.Separator)) {
+		return fmt.Errorf("unexpected file of backup: %s", f.Name)
+	}
+	path := filepath.Join(datadir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	r, err := openFile(ctx, target, f, m, key)
+	if err != nil {
+		return err
+	}
+	defer r.abort()
+	dst, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, r.buf); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = r.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	log.Info("Restored file", "name", f.Name)
+	return os.Rename(path+".tmp", path)
+}
+
+func restoreChaindata(ctx context.Context, target Target, f File, m *Manifest, key []byte, path string) error {
+	r, err := openFile(ctx, target, f, m, key)
+	if err != nil {
+		return err
+	}
+	defer r.abort()
+	db, err := mdbx.NewMDBX(log.New()).Path(path).Open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tables := db.AllBuckets()
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { tx.Rollback() }()
+
+	logEvery := time.NewTicker(progressLogInterval)
+	defer logEvery.Stop()
+	var table string
+	var c kv.RwCursor
+	var entries uint64
+	for {
+		kind, err := r.buf.ReadByte()
+		if err != nil {
+			return fmt.Errorf("%s is truncated: %w", f.Name, err)
+		}
+		switch kind {
+		case recordTable:
+			name, err := readField(r.buf)
+			if err != nil {
+				return err
+			}
+			table = string(name)
+			if _, ok := tables[table]; !ok {
+				return fmt.Errorf("table %s of backup is unknown to this version of Erigon", table)
+			}
+			if c, err = tx.RwCursor(table); err != nil {
+				return err
+			}
+		case recordPair:
+			if c == nil {
+				return fmt.Errorf("%s: pair before table", f.Name)
+			}
+			k, err := readField(r.buf)
+			if err != nil {
+				return err
+			}
+			v, err := readField(r.buf)
+			if err != nil {
+				return err
+			}
+			if dup, ok := c.(kv.RwCursorDupSort); ok {
+				err = dup.AppendDup(k, v)
+			} else {
+				err = c.Append(k, v)
+			}
+			if err != nil {
+				return fmt.Errorf("table %s, key %x: %w", table, k, err)
+			}
+			entries++
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-logEvery.C:
+				log.Info("Restore in progress", "table", table, "entries", entries, "of", f.Entries)
+				if err = tx.Commit(); err != nil {
+					return err
+				}
+				if tx, err = db.BeginRw(ctx); err != nil {
+					return err
+				}
+				if c, err = tx.RwCursor(table); err != nil {
+					return err
+				}
+			default:
+			}
+		case recordEnd:
+			total, err := binary.ReadUvarint(r.buf)
+			if err != nil {
+				return err
+			}
+			if total != entries {
+				return fmt.Errorf("%s has %d pairs, expected %d", f.Name, entries, total)
+			}
+			if err = r.Close(); err != nil {
+				return err
+			}
+			log.Info("Restored chaindata", "entries", entries)
+			return tx.Commit()
+		default:
+			return fmt.Errorf("%s: unknown record %q", f.Name, kind)
+		}
+	}
+}
+
+func readField(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	field := make([]byte, size)
+	if _, err = io.ReadFull(r, field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// fileReader - target -> hashing -> decryption -> zstd -> buffer
+type fileReader struct {
+	f       File
+	src     io.ReadCloser
+	hashing *hashingReader
+	zr      *zstd.Decoder
+	buf     *bufio.Reader
+}
+
+func openFile(ctx context.Context, target Target, f File, m *Manifest, key []byte) (*fileReader, error) {
+	src, err := target.Open(ctx, f.Name)
+	if err != nil {
+		return nil, err
+	}
+	r := &fileReader{f: f, src: src, hashing: newHashingReader(src)}
+	var in io.Reader = r.hashing
+	if key != nil {
+		if in, err = newDecryptReader(in, key, f.Name); err != nil {
+			src.Close()
+			return nil, err
+		}
+	}
+	if m.Compression == CompressionZstd {
+		if r.zr, err = zstd.NewReader(in); err != nil {
+			src.Close()
+			return nil, err
+		}
+		in = r.zr
+	}
+	r.buf = bufio.NewReaderSize(in, 1024*1024)
+	return r, nil
+}
+
+// Close - verifies size and checksum of stored bytes
+func (r *fileReader) Close() error {
+	if _, err := io.Copy(ioutil.Discard, r.hashing); err != nil {
+		return err
+	}
+	if r.hashing.size != r.f.Size || string(r.hashing.h.Sum(nil)) != string(r.f.Sha256) {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, r.f.Name)
+	}
+	return nil
+}
+
+func (r *fileReader) abort() {
+	if r.zr != nil {
+		r.zr.Close()
+	}
+	r.src.Close()
+}
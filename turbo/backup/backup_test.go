@@ -0,0 +1,154 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func testDatadir(t *testing.T) (kv.RwDB, string) {
+	db := memdb.NewTestDB(t)
+	err := db.Update(context.Background(), func(tx kv.RwTx) error {
+		for i := byte(0); i < 100; i++ {
+			if err := tx.Put(kv.Headers, []byte{0, i}, []byte{i, i}); err != nil {
+				return err
+			}
+		}
+		// DupSort table
+		c, err := tx.RwCursorDupSort(kv.AccountChangeSet)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		for _, v := range [][]byte{{1}, {2}, {3}} {
+			if err := c.AppendDup([]byte{1, 2, 3}, v); err != nil {
+				return err
+			}
+		}
+		return stages.SaveStageProgress(tx, stages.Execution, 99)
+	})
+	require.NoError(t, err)
+
+	snapshotDir := filepath.Join(t.TempDir(), "snapshots")
+	require.NoError(t, os.MkdirAll(filepath.Join(snapshotDir, "history"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(snapshotDir, "v1-000000-000500-headers.seg"), []byte("headers"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(snapshotDir, "history", "accounts.dat"), []byte("accounts"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(snapshotDir, "partial.seg.tmp"), []byte("partial"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(snapshotDir, "merge.tmp"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(snapshotDir, "merge.tmp", "v1-000000-001000-headers.seg"), []byte("merging"), 0644))
+	return db, snapshotDir
+}
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	db, snapshotDir := testDatadir(t)
+	targetDir := t.TempDir()
+	target, err := OpenTarget("file://" + targetDir)
+	require.NoError(t, err)
+	passphrase := []byte("secret")
+	m, err := Backup(ctx, db, snapshotDir, target, Options{Compress: true, Passphrase: passphrase})
+	require.NoError(t, err)
+	require.Equal(t, uint64(99), m.Stages[string(stages.Execution)])
+	require.Len(t, m.Files, 3)
+	require.Equal(t, chaindataFile, m.Files[0].Name)
+	require.Equal(t, "snapshots/history/accounts.dat", m.Files[1].Name)
+	require.Equal(t, "snapshots/v1-000000-000500-headers.seg", m.Files[2].Name)
+
+	_, err = Restore(ctx, target, t.TempDir(), []byte("wrong"))
+	require.True(t, errors.Is(err, ErrWrongPassphrase))
+
+	datadir := t.TempDir()
+	_, err = Restore(ctx, target, datadir, passphrase)
+	require.NoError(t, err)
+	data, err := ioutil.ReadFile(filepath.Join(datadir, "snapshots", "history", "accounts.dat"))
+	require.NoError(t, err)
+	require.Equal(t, "accounts", string(data))
+	_, err = os.Stat(filepath.Join(datadir, "snapshots", "partial.seg.tmp"))
+	require.True(t, os.IsNotExist(err))
+
+	restored := mdbx.NewMDBX(log.New()).Path(filepath.Join(datadir, "chaindata")).MustOpen()
+	defer restored.Close()
+	err = restored.View(ctx, func(tx kv.Tx) error {
+		v, err := tx.GetOne(kv.Headers, []byte{0, 42})
+		require.NoError(t, err)
+		require.Equal(t, []byte{42, 42}, v)
+		var values [][]byte
+		require.NoError(t, tx.ForEach(kv.AccountChangeSet, nil, func(k, v []byte) error {
+			values = append(values, append([]byte{}, v...))
+			return nil
+		}))
+		require.Equal(t, [][]byte{{1}, {2}, {3}}, values)
+		progress, err := stages.GetStageProgress(tx, stages.Execution)
+		require.NoError(t, err)
+		require.Equal(t, uint64(99), progress)
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, err = Restore(ctx, target, datadir, passphrase)
+	require.True(t, errors.Is(err, ErrChaindataExists))
+}
+
+func TestLinkSnapshotFiles(t *testing.T) {
+	_, snapshotDir := testDatadir(t)
+	linksDir, files, err := linkSnapshotFiles(snapshotDir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"history/accounts.dat", "v1-000000-000500-headers.seg"}, files)
+
+	// retired file is removed by merge while backup reads it
+	require.NoError(t, os.Remove(filepath.Join(snapshotDir, "v1-000000-000500-headers.seg")))
+	data, err := ioutil.ReadFile(filepath.Join(linksDir, "v1-000000-000500-headers.seg"))
+	require.NoError(t, err)
+	require.Equal(t, "headers", string(data))
+
+	// links are not snapshot files
+	files, err = listSnapshotFiles(snapshotDir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"history/accounts.dat"}, files)
+}
+
+func TestRestoreCorrupted(t *testing.T) {
+	ctx := context.Background()
+	db, snapshotDir := testDatadir(t)
+	targetDir := t.TempDir()
+	target, err := OpenTarget(targetDir)
+	require.NoError(t, err)
+
+	_, err = Restore(ctx, target, t.TempDir(), nil)
+	require.True(t, errors.Is(err, ErrNoManifest))
+
+	_, err = Backup(ctx, db, snapshotDir, target, Options{})
+	require.NoError(t, err)
+	path := filepath.Join(targetDir, "snapshots", "v1-000000-000500-headers.seg")
+	require.NoError(t, ioutil.WriteFile(path, []byte("Headers"), 0644))
+	_, err = Restore(ctx, target, t.TempDir(), nil)
+	require.True(t, errors.Is(err, ErrChecksumMismatch))
+}
+
+func TestEncryptedTruncated(t *testing.T) {
+	ctx := context.Background()
+	db, snapshotDir := testDatadir(t)
+	targetDir := t.TempDir()
+	target, err := OpenTarget(targetDir)
+	require.NoError(t, err)
+	_, err = Backup(ctx, db, snapshotDir, target, Options{Passphrase: []byte("secret")})
+	require.NoError(t, err)
+
+	// the last chunk is cut off
+	path := filepath.Join(targetDir, chaindataFile)
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, data[:len(data)/2], 0644))
+	_, err = Restore(ctx, target, t.TempDir(), []byte("secret"))
+	require.Error(t, err)
+}
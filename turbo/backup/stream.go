@@ -0,0 +1,230 @@
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/ledgerwatch/erigon/common/hexutil"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Files of encrypted backup are sequences of chunks sealed by AES-256-GCM: 4 bytes of big-endian size of the sealed
+// chunk, then sealed chunk. Key of every file is HMAC-SHA256(key of backup, name of file), nonce is number of the chunk,
+// additional data is 1 for the last chunk and 0 for others - reordered, replaced and truncated files fail to decrypt.
+// Key of backup is derived from passphrase by scrypt with random salt of the backup.
+const (
+	EncryptionAES256GCM = "aes-256-gcm"
+	encryptionChunkSize = 64 * 1024
+	keyCheckLabel       = "erigon backup key check"
+)
+
+var ErrWrongPassphrase = errors.New("wrong passphrase of backup")
+
+type Encryption struct {
+	Algorithm string        `json:"algorithm"`
+	Salt      hexutil.Bytes `json:"salt"`
+	KeyCheck  hexutil.Bytes `json:"keyCheck"` // HMAC of keyCheckLabel, to report wrong passphrase before reading of files
+}
+
+func newEncryption(passphrase []byte) (*Encryption, []byte, error) {
+	e := &Encryption{Algorithm: EncryptionAES256GCM, Salt: make([]byte, 16)}
+	if _, err := rand.Read(e.Salt); err != nil {
+		return nil, nil, err
+	}
+	key, err := scrypt.Key(passphrase, e.Salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	e.KeyCheck = hmacSHA256(key, keyCheckLabel)
+	return e, key, nil
+}
+
+func (e *Encryption) key(passphrase []byte) ([]byte, error) {
+	if e.Algorithm != EncryptionAES256GCM {
+		return nil, fmt.Errorf("unsupported encryption of backup: %s", e.Algorithm)
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("backup is encrypted, passphrase is required")
+	}
+	key, err := scrypt.Key(passphrase, e.Salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(hmacSHA256(key, keyCheckLabel), e.KeyCheck) {
+		return nil, ErrWrongPassphrase
+	}
+	return key, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func fileCipher(key []byte, name string) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(hmacSHA256(key, name))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(aead cipher.AEAD, n uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], n)
+	return nonce
+}
+
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	buf    []byte
+	chunks uint64
+}
+
+func newEncryptWriter(w io.Writer, key []byte, name string) (*encryptWriter, error) {
+	aead, err := fileCipher(key, name)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, buf: make([]byte, 0, encryptionChunkSize)}, nil
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if len(w.buf) == encryptionChunkSize {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):encryptionChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close - writes the last chunk, doesn't close underlying writer
+func (w *encryptWriter) Close() error {
+	return w.seal(true)
+}
+
+func (w *encryptWriter) seal(last bool) error {
+	ad := []byte{0}
+	if last {
+		ad[0] = 1
+	}
+	sealed := w.aead.Seal(nil, chunkNonce(w.aead, w.chunks), w.buf, ad)
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(sealed)))
+	if _, err := w.w.Write(size[:]); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(sealed); err != nil {
+		return err
+	}
+	w.chunks++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+type decryptReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	chunk  []byte
+	chunks uint64
+	last   bool
+}
+
+func newDecryptReader(r io.Reader, key []byte, name string) (*decryptReader, error) {
+	aead, err := fileCipher(key, name)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: r, aead: aead}, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if r.last {
+			return 0, io.EOF
+		}
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+func (r *decryptReader) open() error {
+	var size [4]byte
+	if _, err := io.ReadFull(r.r, size[:]); err != nil {
+		return fmt.Errorf("encrypted file is truncated: %w", err)
+	}
+	sealed := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if len(sealed) > encryptionChunkSize+r.aead.Overhead() {
+		return fmt.Errorf("encrypted chunk of %d bytes is too large", len(sealed))
+	}
+	if _, err := io.ReadFull(r.r, sealed); err != nil {
+		return fmt.Errorf("encrypted file is truncated: %w", err)
+	}
+	nonce := chunkNonce(r.aead, r.chunks)
+	chunk, err := r.aead.Open(nil, nonce, sealed, []byte{0})
+	if err != nil {
+		if chunk, err = r.aead.Open(nil, nonce, sealed, []byte{1}); err != nil {
+			return fmt.Errorf("decrypting chunk %d: %w", r.chunks, err)
+		}
+		r.last = true
+	}
+	r.chunk = chunk
+	r.chunks++
+	return nil
+}
+
+// hashingWriter - size and sha256 of stored bytes of the file
+type hashingWriter struct {
+	w    io.Writer
+	h    hash.Hash
+	size uint64
+}
+
+func newHashingWriter(w io.Writer) *hashingWriter {
+	return &hashingWriter{w: w, h: sha256.New()}
+}
+
+func (w *hashingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.h.Write(p[:n])
+	w.size += uint64(n)
+	return n, err
+}
+
+type hashingReader struct {
+	r    io.Reader
+	h    hash.Hash
+	size uint64
+}
+
+func newHashingReader(r io.Reader) *hashingReader {
+	return &hashingReader{r: r, h: sha256.New()}
+}
+
+func (r *hashingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.h.Write(p[:n])
+	r.size += uint64(n)
+	return n, err
+}
@@ -0,0 +1,95 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ledgerwatch/erigon/turbo/s3"
+)
+
+// Target - storage of backups: directory or S3-compatible bucket
+type Target interface {
+	// Create - writer of the file, file appears on Close
+	Create(ctx context.Context, name string) (Writer, error)
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+type Writer interface {
+	io.WriteCloser
+	Abort() // file doesn't appear
+}
+
+// OpenTarget - `s3://bucket/prefix?endpoint=...` (see s3.Parse), `file:///path` or just path of directory
+func OpenTarget(target string) (Target, error) {
+	if strings.HasPrefix(target, "s3://") {
+		c, prefix, err := s3.Parse(target)
+		if err != nil {
+			return nil, err
+		}
+		return &s3Target{c: c, prefix: prefix}, nil
+	}
+	return dirTarget(strings.TrimPrefix(target, "file://")), nil
+}
+
+type dirTarget string
+
+func (d dirTarget) Create(ctx context.Context, name string) (Writer, error) {
+	path := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &dirFile{File: f, path: path}, nil
+}
+
+func (d dirTarget) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+// dirFile - written to .tmp file, renamed after fsync: partial files are never seen by restore
+type dirFile struct {
+	*os.File
+	path string
+}
+
+func (f *dirFile) Close() error {
+	if err := f.File.Sync(); err != nil {
+		f.File.Close()
+		return err
+	}
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.File.Name(), f.path)
+}
+
+func (f *dirFile) Abort() {
+	f.File.Close()
+	os.Remove(f.File.Name())
+}
+
+type s3Target struct {
+	c      *s3.Client
+	prefix string
+}
+
+func (t *s3Target) key(name string) string {
+	if t.prefix == "" {
+		return name
+	}
+	return t.prefix + "/" + name
+}
+
+func (t *s3Target) Create(ctx context.Context, name string) (Writer, error) {
+	return t.c.Create(ctx, t.key(name)), nil
+}
+
+func (t *s3Target) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return t.c.Get(ctx, t.key(name))
+}
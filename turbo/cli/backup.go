@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/turbo/backup"
+	"github.com/ledgerwatch/log/v3"
+	mdbx2 "github.com/torquem-ch/mdbx-go/mdbx"
+	"github.com/urfave/cli"
+)
+
+var backupCommand = cli.Command{
+	Action: MigrateFlags(doBackup),
+	Name:   "backup",
+	Usage:  "Backup chaindata and snapshot files, Erigon can keep running",
+	Flags: []cli.Flag{
+		utils.DataDirFlag,
+		BackupTargetFlag,
+		BackupCompressFlag,
+		BackupPassphraseFileFlag,
+	},
+	Category: "DATABASE COMMANDS",
+	Description: `
+The backup command copies consistent snapshot of chaindata (one read transaction) and snapshot files which existed at
+its start to --backup.target: directory or S3-compatible bucket. Files are optionally compressed by zstd and encrypted
+by AES-256-GCM with key derived from passphrase. manifest.json with checksums of files is written last.`,
+}
+
+var restoreCommand = cli.Command{
+	Action: MigrateFlags(doRestore),
+	Name:   "restore",
+	Usage:  "Restore backup made by 'erigon backup' into datadir without chaindata",
+	Flags: []cli.Flag{
+		utils.DataDirFlag,
+		BackupTargetFlag,
+		BackupPassphraseFileFlag,
+	},
+	Category: "DATABASE COMMANDS",
+}
+
+var (
+	BackupTargetFlag = cli.StringFlag{
+		Name:     "backup.target",
+		Usage:    "Directory (path or file:///path) or S3-compatible bucket: s3://bucket/prefix?endpoint=https://host:port&region=us-east-1, credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY",
+		Required: true,
+	}
+	BackupCompressFlag = cli.BoolFlag{
+		Name:  "backup.compress",
+		Usage: "Compress files of backup by zstd",
+	}
+	BackupPassphraseFileFlag = cli.StringFlag{
+		Name:  "backup.passphrase.file",
+		Usage: "File with passphrase: backup is encrypted by key derived from it",
+	}
+)
+
+func backupPassphrase(ctx *cli.Context) ([]byte, error) {
+	file := ctx.String(BackupPassphraseFileFlag.Name)
+	if file == "" {
+		return nil, nil
+	}
+	passphrase, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(passphrase, "\r\n"), nil
+}
+
+func doBackup(cliCtx *cli.Context) error {
+	ctx, cancel := utils.RootContext()
+	defer cancel()
+	dataDir := cliCtx.String(utils.DataDirFlag.Name)
+	target, err := backup.OpenTarget(cliCtx.String(BackupTargetFlag.Name))
+	if err != nil {
+		return err
+	}
+	passphrase, err := backupPassphrase(cliCtx)
+	if err != nil {
+		return err
+	}
+	db, err := mdbx.NewMDBX(log.New()).Path(path.Join(dataDir, "chaindata")).Flags(func(flags uint) uint { return mdbx2.Readonly | mdbx2.Accede }).Open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	m, err := backup.Backup(ctx, db, path.Join(dataDir, "snapshots"), target, backup.Options{
+		Compress:   cliCtx.Bool(BackupCompressFlag.Name),
+		Passphrase: passphrase,
+	})
+	if err != nil {
+		return err
+	}
+	var size uint64
+	for _, f := range m.Files {
+		size += f.Size
+	}
+	log.Info("Backup done", "files", len(m.Files), "size", datasize.ByteSize(size).HR())
+	return nil
+}
+
+func doRestore(cliCtx *cli.Context) error {
+	ctx, cancel := utils.RootContext()
+	defer cancel()
+	target, err := backup.OpenTarget(cliCtx.String(BackupTargetFlag.Name))
+	if err != nil {
+		return err
+	}
+	passphrase, err := backupPassphrase(cliCtx)
+	if err != nil {
+		return err
+	}
+	m, err := backup.Restore(ctx, target, cliCtx.String(utils.DataDirFlag.Name), passphrase)
+	if err != nil {
+		return err
+	}
+	log.Info("Restore done", "created", m.Created, "files", len(m.Files))
+	return nil
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/urfave/cli"
+)
+
+var updateChainConfigCommand = cli.Command{
+	Action:    MigrateFlags(doUpdateChainConfig),
+	Name:      "update_chain_config",
+	Usage:     "Schedule forks of running Erigon node",
+	ArgsUsage: "<chainConfigPath>",
+	Flags: []cli.Flag{
+		PrivateApiAddr,
+		utils.TLSCertFlag,
+		utils.TLSKeyFlag,
+		utils.TLSCACertFlag,
+	},
+	Category: "BLOCKCHAIN COMMANDS",
+	Description: `
+The update_chain_config command sends chain config JSON (same as "config" of genesis file)
+to the node at --private.api.addr. Node stores it in the database if it only adds or moves
+forks above its head, and applies it after restart (started without genesis file).`,
+}
+
+func doUpdateChainConfig(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("this command requires path to chain config JSON")
+	}
+	data, err := os.ReadFile(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	cfg := new(params.ChainConfig)
+	if err = json.Unmarshal(data, cfg); err != nil {
+		return err
+	}
+	client, closeConn, err := dialAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	if err = client.UpdateChainConfig(context.Background(), cfg); err != nil {
+		return err
+	}
+	log.Info("Chain config stored, restart the node to apply it", "config", cfg)
+	return nil
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"text/tabwriter"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/ethdb/dbstats"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/urfave/cli"
+)
+
+// dbSizeSnapshotFile - sizes of previous run of db_size, stored in datadir to show growth
+const dbSizeSnapshotFile = "db_size.json"
+
+var dbSizeCommand = cli.Command{
+	Action: MigrateFlags(doDbSize),
+	Name:   "db_size",
+	Usage:  "Print sizes of chaindata tables and their growth since previous run",
+	Flags: []cli.Flag{
+		utils.DataDirFlag,
+	},
+	Category: "DATABASE COMMANDS",
+	Description: `
+The db_size command reads MDBX stats of all tables (same as mdbx_stat -a), Erigon can keep running.`,
+}
+
+func doDbSize(ctx *cli.Context) error {
+	dataDir := ctx.String(utils.DataDirFlag.Name)
+	snapshotPath := path.Join(dataDir, dbSizeSnapshotFile)
+	last, err := readDbSizeSnapshot(snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	chainDB, err := mdbx.NewMDBX(log.New()).Path(path.Join(dataDir, "chaindata")).Readonly().Open()
+	if err != nil {
+		return err
+	}
+	defer chainDB.Close()
+	tracker := dbstats.NewTracker(last)
+	var stats *dbstats.Stats
+	if err := chainDB.View(context.Background(), func(tx kv.Tx) error {
+		stats, err = tracker.Stats(tx)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Table\tEntries\tDepth\tBranch\tLeaf\tOverflow\tSize\tGrowth\t")
+	for _, t := range stats.Tables {
+		growth := "-" // first run
+		if stats.Since != nil {
+			growth = growthHR(t.Growth)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t\n", t.Name, t.Entries, t.Depth, t.BranchPages, t.LeafPages, t.OverflowPages, datasize.ByteSize(t.Size).HR(), growth)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("Total: %s\n", datasize.ByteSize(stats.Size).HR())
+	if stats.Since != nil {
+		fmt.Printf("Growth since: %s\n", stats.Since.Format("2006-01-02 15:04:05"))
+	}
+
+	data, err := json.Marshal(tracker.Last())
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(snapshotPath, data, 0644)
+}
+
+func readDbSizeSnapshot(snapshotPath string) (*dbstats.Snapshot, error) {
+	data, err := ioutil.ReadFile(snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	last := &dbstats.Snapshot{}
+	if err := json.Unmarshal(data, last); err != nil {
+		return nil, fmt.Errorf("%s: %w", snapshotPath, err)
+	}
+	return last, nil
+}
+
+func growthHR(growth int64) string {
+	if growth < 0 {
+		return "-" + datasize.ByteSize(-growth).HR()
+	}
+	return "+" + datasize.ByteSize(growth).HR()
+}
@@ -25,6 +25,11 @@ var DefaultFlags = []cli.Flag{
 	utils.TxPoolGlobalQueueFlag,
 	utils.TxPoolLifetimeFlag,
 	utils.TxPoolTraceSendersFlag,
+	utils.TxPoolShadowFlag,
+	utils.TxPoolShadowFileFlag,
+	utils.TxPoolShadowPolicyFlag,
+	utils.TxPoolEventsFlag,
+	utils.TxPoolFetchInflightFlag,
 	PruneFlag,
 	PruneHistoryFlag,
 	PruneReceiptFlag,
@@ -34,20 +39,39 @@ var DefaultFlags = []cli.Flag{
 	PruneReceiptBeforeFlag,
 	PruneTxIndexBeforeFlag,
 	PruneCallTracesBeforeFlag,
+	PruneStaleForksFlag,
 	BatchSizeFlag,
 	BlockDownloaderWindowFlag,
 	DatabaseVerbosityFlag,
+	DatabaseReadTxWarnFlag,
 	PrivateApiAddr,
 	PrivateApiRateLimit,
 	EtlBufferSizeFlag,
+	EtlMemoryBudgetFlag,
 	TLSFlag,
 	TLSCertFlag,
 	TLSKeyFlag,
 	TLSCACertFlag,
 	StateStreamDisableFlag,
+	ExecPrefetchDisableFlag,
+	SendersRecovererFlag,
+	StateBackendFlag,
+	FirehoseSinkFlag,
+	FirehoseConfirmationsFlag,
 	SyncLoopThrottleFlag,
+	SyncHeadLagFlag,
+	MaintenanceWindowsFlag,
+	MaintenanceIndexLagFlag,
+	TieringColdDirFlag,
+	TieringHotBlocksFlag,
+	ShutdownTimeoutFlag,
 	BadBlockFlag,
 	utils.SnapshotSyncFlag,
+	utils.SnapshotMergeIntervalFlag,
+	utils.SnapshotRemoteFlag,
+	utils.SnapshotRemoteLazyFlag,
+	utils.SnapshotRemoteCacheFlag,
+	utils.HistorySnapshotsFlag,
 	utils.ListenPortFlag,
 	utils.NATFlag,
 	utils.NoDiscoverFlag,
@@ -59,13 +83,19 @@ var DefaultFlags = []cli.Flag{
 	utils.StaticPeersFlag,
 	utils.TrustedPeersFlag,
 	utils.MaxPeersFlag,
+	utils.P2PMaxDownloadMbpsFlag,
+	utils.P2PMaxUploadMbpsFlag,
 	utils.ChainFlag,
+	NetworksFlag,
 	utils.DeveloperPeriodFlag,
 	utils.VMEnableDebugFlag,
 	utils.NetworkIdFlag,
 	utils.FakePoWFlag,
 	utils.GpoBlocksFlag,
 	utils.GpoPercentileFlag,
+	utils.GpoMaxGasPriceFlag,
+	utils.GpoMinGasPriceFlag,
+	utils.GpoIgnoreGasPriceFlag,
 	utils.InsecureUnlockAllowedFlag,
 	utils.MetricsEnabledFlag,
 	utils.MetricsEnabledExpensiveFlag,
@@ -76,6 +106,8 @@ var DefaultFlags = []cli.Flag{
 	utils.CliqueSnapshotInmemorySnapshotsFlag,
 	utils.CliqueSnapshotInmemorySignaturesFlag,
 	utils.CliqueDataDirFlag,
+	utils.HeimdallURLFlag,
+	utils.WithoutHeimdallFlag,
 	utils.MiningEnabledFlag,
 	utils.MinerNotifyFlag,
 	utils.MinerGasTargetFlag,
@@ -84,7 +116,18 @@ var DefaultFlags = []cli.Flag{
 	utils.MinerExtraDataFlag,
 	utils.MinerNoVerfiyFlag,
 	utils.MinerSigningKeyFileFlag,
+	utils.MinerBuilderAddrFlag,
+	utils.MinerBuilderAuthTokenFlag,
+	utils.MinerTxSelectionFlag,
+	utils.MinerRelayAddrFlag,
+	utils.MinerRelaysFlag,
+	utils.MinerRelayTimeoutFlag,
 	utils.SentryAddrFlag,
+	utils.SentryPreferHeadersFlag,
+	utils.SentryPreferBodiesFlag,
 	utils.DownloaderAddrFlag,
+	utils.CLEndpointsFlag,
+	utils.CLQuorumFlag,
+	utils.CLLightFlag,
 	HealthCheckFlag,
 }
@@ -0,0 +1,363 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/interfaces"
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snapshothashes"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/urfave/cli"
+)
+
+var (
+	DoctorFromFlag = cli.Uint64Flag{
+		Name:  "from",
+		Usage: "Check canonical chain from this block",
+	}
+	DoctorFixFlag = cli.BoolFlag{
+		Name:  "fix",
+		Usage: "Apply repairs which can be done automatically, Erigon must be stopped",
+	}
+)
+
+var doctorCommand = cli.Command{
+	Action: MigrateFlags(doDoctor),
+	Name:   "doctor",
+	Usage:  "Cross-check stage progress, canonical chain, row counts and snapshot coverage, and report inconsistencies",
+	Flags: []cli.Flag{
+		utils.DataDirFlag,
+		utils.SnapshotSyncFlag,
+		DoctorFromFlag,
+		DoctorFixFlag,
+	},
+	Category: "DATABASE COMMANDS",
+	Description: `
+The doctor command reports inconsistencies of chaindata with suggestions how to repair them.
+With --fix repairs which don't lose data are applied (e.g. missing entries of HeaderNumber are
+regenerated like BlockHashes stage does), Erigon must be stopped then. Without --fix the
+database is opened read-only.`,
+}
+
+func doDoctor(cliCtx *cli.Context) error {
+	ctx, cancel := utils.RootContext()
+	defer cancel()
+	dataDir := cliCtx.String(utils.DataDirFlag.Name)
+	fix := cliCtx.Bool(DoctorFixFlag.Name)
+	opts := mdbx.NewMDBX(log.New()).Path(path.Join(dataDir, "chaindata"))
+	if !fix {
+		opts = opts.Readonly()
+	}
+	db, err := opts.Open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var snapshotsDir string
+	if cliCtx.Bool(utils.SnapshotSyncFlag.Name) {
+		snapshotsDir = path.Join(dataDir, "snapshots")
+	}
+	issues, err := doctor(ctx, db, snapshotsDir, cliCtx.Uint64(DoctorFromFlag.Name))
+	if err != nil {
+		return err
+	}
+	return treatIssues(ctx, db, issues, fix)
+}
+
+// doctorIssue - inconsistency found by doctor
+type doctorIssue struct {
+	problem    string
+	suggestion string
+	fix        func(tx kv.RwTx) error // nil - can't be repaired automatically
+}
+
+// stageDependencies - stages whose progress the stage can't exceed
+var stageDependencies = map[stages.SyncStage][]stages.SyncStage{
+	stages.BlockHashes:         {stages.Headers},
+	stages.Bodies:              {stages.Headers},
+	stages.Senders:             {stages.Bodies},
+	stages.Execution:           {stages.Senders},
+	stages.Translation:         {stages.Execution},
+	stages.StateAccess:         {stages.Execution},
+	stages.HashState:           {stages.Execution},
+	stages.IntermediateHashes:  {stages.HashState},
+	stages.CallTraces:          {stages.Execution},
+	stages.AccountHistoryIndex: {stages.Execution},
+	stages.StorageHistoryIndex: {stages.Execution},
+	stages.StateDiffs:          {stages.AccountHistoryIndex, stages.StorageHistoryIndex},
+	stages.LogIndex:            {stages.Execution},
+	stages.AddressAppearances:  {stages.Execution},
+	stages.TxLookup:            {stages.Execution},
+	stages.Firehose:            {stages.CallTraces, stages.AccountHistoryIndex, stages.StorageHistoryIndex},
+	stages.Finish:              {stages.Execution},
+}
+
+// maxReportedBreaks - breaks of canonical chain which are reported one by one, others are counted
+const maxReportedBreaks = 10
+
+// doctor - issues of db, snapshotsDir - block snapshots, empty if they are not enabled
+func doctor(ctx context.Context, db kv.RoDB, snapshotsDir string, from uint64) ([]doctorIssue, error) {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	progress := map[stages.SyncStage]uint64{}
+	for _, stage := range stages.AllStages {
+		if progress[stage], err = stages.GetStageProgress(tx, stage); err != nil {
+			return nil, err
+		}
+	}
+	var issues []doctorIssue
+	issues = append(issues, checkStageProgress(progress)...)
+
+	genesisHash, err := rawdb.ReadCanonicalHash(tx, 0)
+	if err != nil {
+		return nil, err
+	}
+	chainConfig, err := rawdb.ReadChainConfig(tx, genesisHash)
+	if err != nil {
+		return nil, err
+	}
+	if chainConfig == nil {
+		return append(issues, doctorIssue{problem: "chain config is not found", suggestion: "database is not initialized, start Erigon"}), nil
+	}
+
+	for _, table := range []string{kv.Headers, kv.HeaderCanonical, kv.HeaderNumber, kv.BlockBody, kv.EthTx, kv.Receipts, kv.PlainState} {
+		c, err := tx.Cursor(table)
+		if err != nil {
+			return nil, err
+		}
+		count, err := c.Count()
+		c.Close()
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Rows", "table", table, "count", count)
+	}
+
+	var blockReader interfaces.FullBlockReader = snapshotsync.NewBlockReader()
+	var snapshotsEnd uint64
+	if snapshotsDir != "" {
+		snapshots := snapshotsync.NewAllSnapshots(snapshotsDir, snapshothashes.KnownConfig(chainConfig.ChainName))
+		if err = snapshots.ReopenSegments(); err != nil {
+			return nil, err
+		}
+		if err = snapshots.ReopenSomeIndices(snapshotsync.AllSnapshotTypes...); err != nil {
+			return nil, err
+		}
+		var snapshotIssues []doctorIssue
+		snapshotsEnd, snapshotIssues = checkSnapshotCoverage(snapshots, progress)
+		issues = append(issues, snapshotIssues...)
+		blockReader = snapshotsync.NewBlockReaderWithSnapshots(snapshots)
+	}
+
+	chainIssues, err := checkCanonicalChain(ctx, tx, blockReader, from, progress, snapshotsEnd)
+	if err != nil {
+		return nil, err
+	}
+	return append(issues, chainIssues...), nil
+}
+
+// checkStageProgress - stages which are ahead of stages they depend on
+func checkStageProgress(progress map[stages.SyncStage]uint64) []doctorIssue {
+	var issues []doctorIssue
+	for _, stage := range stages.AllStages {
+		for _, dep := range stageDependencies[stage] {
+			if progress[stage] <= progress[dep] {
+				continue
+			}
+			issue := doctorIssue{
+				problem:    fmt.Sprintf("stage %s is at %d, ahead of %s at %d", stage, progress[stage], dep, progress[dep]),
+				suggestion: fmt.Sprintf("run stage %s up to %d, or unwind %s to %d", dep, progress[stage], stage, progress[dep]),
+			}
+			if stage == stages.Finish {
+				// Finish has no data, only the head for RPC
+				to := progress[dep]
+				issue.suggestion = fmt.Sprintf("set progress of %s to %d", stage, to)
+				issue.fix = func(tx kv.RwTx) error { return stages.SaveStageProgress(tx, stages.Finish, to) }
+			}
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// checkSnapshotCoverage - segments of block snapshots are contiguous from genesis and the database continues them.
+// Returns the last block of snapshots, 0 if there are none.
+func checkSnapshotCoverage(snapshots *snapshotsync.AllSnapshots, progress map[stages.SyncStage]uint64) (uint64, []doctorIssue) {
+	var issues []doctorIssue
+	var end uint64
+	for _, r := range snapshots.Opened() {
+		if r.From != end {
+			issues = append(issues, doctorIssue{
+				problem:    fmt.Sprintf("block snapshots have a gap: blocks %d-%d", end, r.From-1),
+				suggestion: "re-download snapshots (check_snapshots marks corrupted files for the downloader)",
+			})
+		}
+		end = r.To
+	}
+	if end == 0 {
+		log.Info("No block snapshots")
+		return 0, issues
+	}
+	log.Info("Block snapshots", "blocks", end)
+	last := end - 1
+	for _, stage := range []stages.SyncStage{stages.Headers, stages.Bodies} {
+		if progress[stage] < last {
+			issues = append(issues, doctorIssue{
+				problem:    fmt.Sprintf("stage %s is at %d, behind block snapshots which end at %d", stage, progress[stage], last),
+				suggestion: fmt.Sprintf("run stage %s, it moves to the end of snapshots", stage),
+			})
+		}
+	}
+	return last, issues
+}
+
+// checkCanonicalChain - every canonical block up to Headers stage has header linked to the previous one, entry of
+// HeaderNumber, and body up to Bodies stage. Blocks in snapshots are checked only for links.
+func checkCanonicalChain(ctx context.Context, tx kv.Tx, blockReader interfaces.FullBlockReader, from uint64, progress map[stages.SyncStage]uint64, snapshotsEnd uint64) ([]doctorIssue, error) {
+	var issues []doctorIssue
+	var breaks, missingBodies int
+	type headerNumber struct {
+		hash   common.Hash
+		number uint64
+	}
+	var missingNumbers []headerNumber
+	to := progress[stages.Headers]
+	reportBreak := func(n uint64, problem string) {
+		if breaks < maxReportedBreaks {
+			issues = append(issues, doctorIssue{
+				problem:    problem,
+				suggestion: fmt.Sprintf("unwind Headers below the break and sync again (integration stage_headers --unwind=%d)", to-n+1),
+			})
+		}
+		breaks++
+	}
+
+	var prevHash common.Hash
+	if from > 0 {
+		var err error
+		if prevHash, err = rawdb.ReadCanonicalHash(tx, from-1); err != nil {
+			return nil, err
+		}
+	}
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	for n := from; n <= to; n++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-logEvery.C:
+			log.Info("Checking canonical chain", "block", n, "to", to)
+		default:
+		}
+		hash, err := rawdb.ReadCanonicalHash(tx, n)
+		if err != nil {
+			return nil, err
+		}
+		if hash == (common.Hash{}) {
+			reportBreak(n, fmt.Sprintf("canonical hash of block %d is missing", n))
+			prevHash = common.Hash{}
+			continue
+		}
+		h, err := blockReader.HeaderByNumber(ctx, tx, n)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case h == nil:
+			reportBreak(n, fmt.Sprintf("header of canonical block %d %x is missing", n, hash))
+		case h.Hash() != hash:
+			reportBreak(n, fmt.Sprintf("header of block %d has hash %x, canonical is %x", n, h.Hash(), hash))
+		case n > 0 && prevHash != (common.Hash{}) && h.ParentHash != prevHash:
+			reportBreak(n, fmt.Sprintf("block %d %x doesn't link to canonical block %d %x", n, hash, n-1, prevHash))
+		}
+		prevHash = hash
+		if n > snapshotsEnd || snapshotsEnd == 0 {
+			if num := rawdb.ReadHeaderNumber(tx, hash); num == nil || *num != n {
+				missingNumbers = append(missingNumbers, headerNumber{hash: hash, number: n})
+			}
+			if n <= progress[stages.Bodies] {
+				has, err := tx.Has(kv.BlockBody, dbutils.BlockBodyKey(n, hash))
+				if err != nil {
+					return nil, err
+				}
+				if !has {
+					missingBodies++
+				}
+			}
+		}
+	}
+	if breaks > maxReportedBreaks {
+		issues = append(issues, doctorIssue{problem: fmt.Sprintf("%d more breaks of canonical chain", breaks-maxReportedBreaks)})
+	}
+	if missingBodies > 0 {
+		issues = append(issues, doctorIssue{
+			problem:    fmt.Sprintf("%d bodies of canonical blocks below Bodies stage are missing", missingBodies),
+			suggestion: "unwind Bodies below the first missing body and sync again (integration stage_bodies --unwind=N)",
+		})
+	}
+	if len(missingNumbers) > 0 {
+		issues = append(issues, doctorIssue{
+			problem:    fmt.Sprintf("%d canonical blocks have no or wrong entry in HeaderNumber, first %d", len(missingNumbers), missingNumbers[0].number),
+			suggestion: "regenerate entries of BlockHashes stage (--fix)",
+			fix: func(tx kv.RwTx) error {
+				for _, e := range missingNumbers {
+					if err := tx.Put(kv.HeaderNumber, e.hash[:], dbutils.EncodeBlockNumber(e.number)); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		})
+	}
+	return issues, nil
+}
+
+// treatIssues - reports issues, applies their fixes if fix is set. Error if some issues remain.
+func treatIssues(ctx context.Context, db kv.RwDB, issues []doctorIssue, fix bool) error {
+	if len(issues) == 0 {
+		log.Info("No inconsistencies found")
+		return nil
+	}
+	var fixable int
+	for _, issue := range issues {
+		log.Warn(issue.problem, "suggestion", issue.suggestion, "fixable", issue.fix != nil)
+		if issue.fix != nil {
+			fixable++
+		}
+	}
+	if !fix || fixable == 0 {
+		return fmt.Errorf("%d inconsistencies found, %d can be fixed by --fix", len(issues), fixable)
+	}
+	if err := db.Update(ctx, func(tx kv.RwTx) error {
+		for _, issue := range issues {
+			if issue.fix == nil {
+				continue
+			}
+			if err := issue.fix(tx); err != nil {
+				return fmt.Errorf("fix %q: %w", issue.problem, err)
+			}
+			log.Info("Fixed", "problem", issue.problem)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if remain := len(issues) - fixable; remain > 0 {
+		return fmt.Errorf("%d inconsistencies need manual repair", remain)
+	}
+	return nil
+}
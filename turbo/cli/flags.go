@@ -14,6 +14,9 @@ import (
 	"github.com/ledgerwatch/erigon/eth/ethconfig"
 	"github.com/ledgerwatch/erigon/ethdb/prune"
 	"github.com/ledgerwatch/erigon/node"
+	"github.com/ledgerwatch/erigon/turbo/etlbudget"
+	"github.com/ledgerwatch/erigon/turbo/maintenance"
+	"github.com/ledgerwatch/erigon/turbo/tiering"
 	"github.com/ledgerwatch/log/v3"
 	"github.com/spf13/pflag"
 	"github.com/urfave/cli"
@@ -25,6 +28,10 @@ var (
 		Usage: "Enabling internal db logs. Very high verbosity levels may require recompile db. Default: 2, means warning.",
 		Value: 2,
 	}
+	DatabaseReadTxWarnFlag = cli.DurationFlag{
+		Name:  "database.readtx.warn",
+		Usage: "Log (with stack) read transactions open longer than this - they don't allow db to reuse free pages. 0 - disabled",
+	}
 	BatchSizeFlag = cli.StringFlag{
 		Name:  "batchSize",
 		Usage: "Batch size for the execution stage",
@@ -35,6 +42,10 @@ var (
 		Usage: "Buffer size for ETL operations.",
 		Value: etl.BufferOptimalSize.String(),
 	}
+	EtlMemoryBudgetFlag = cli.StringFlag{
+		Name:  "etl.memory.budget",
+		Usage: "Total size of ETL buffers of HashState and IntermediateHashes stages, under this limit collectors spill to temp files more often. Empty - unlimited",
+	}
 	BlockDownloaderWindowFlag = cli.IntFlag{
 		Name:  "blockDownloaderWindow",
 		Usage: "Outstanding limit of block bodies being downloaded",
@@ -64,7 +75,7 @@ var (
 		Usage: `Choose which ancient data delete from DB: 
 	h - prune history (ChangeSets, HistoryIndices - used by historical state access)
 	r - prune receipts (Receipts, Logs, LogTopicIndex, LogAddressIndex - used by eth_getLogs and similar RPC methods)
-	t - prune transaction by it's hash index
+	t - prune transaction by it's hash index, and index of blocks which included uncles (used by erigon_getUncleInclusion)
 	c - prune call traces (used by trace_* methods)
 	Does delete data older than 90K block (can set another value by '--prune.*.older' flags). 
 	If item is NOT in the list - means NO pruning for this data.s
@@ -104,11 +115,20 @@ var (
 		Name:  "prune.c.before",
 		Usage: `Prune data before this block`,
 	}
+	PruneStaleForksFlag = cli.Uint64Flag{
+		Name: "prune.forks.older",
+		Usage: `Delete non-canonical blocks which are older than finalized block by this amount of blocks (0 - keep them).
+	Finalized block is received from consensus layer, or is 90K blocks behind head`,
+	}
 
 	ExperimentsFlag = cli.StringFlag{
 		Name: "experiments",
 		Usage: `Enable some experimental stages:
-* tevm - write TEVM translated code to the DB`,
+* tevm - write TEVM translated code to the DB
+* stateaccess - track last access block of every account and storage slot (state expiry research)
+* statediffs - record state diffs of transactions, to serve trace_replayBlockTransactions without re-execution
+* appearances - index all appearances of addresses in transactions, for erigon_getAddressAppearances
+* txbloom - replace transaction lookup index of blocks pruned by --prune=t with per-segment bloom filters of transaction hashes`,
 		Value: "default",
 	}
 
@@ -136,6 +156,29 @@ var (
 		Name:  "state.stream.disable",
 		Usage: "Disable streaming of state changes from core to RPC daemon",
 	}
+	ExecPrefetchDisableFlag = cli.BoolFlag{
+		Name:  "exec.prefetch.disable",
+		Usage: "Disable reading state of next block in background during execution (warms page cache)",
+	}
+	SendersRecovererFlag = cli.StringFlag{
+		Name:  "senders.recoverer",
+		Usage: "Recover senders of transactions in batches of consecutive blocks by implementation registered by crypto.RegisterBatchRecoverer (e.g. GPU one), failed batches fall back to CPU. Empty - recover transaction by transaction",
+	}
+	StateBackendFlag = cli.StringFlag{
+		Name:  "experimental.state.backend",
+		Usage: "Address of remote state store (gRPC service remotestate.State) to execute blocks against, see ./core/state/remotestate/README.md",
+	}
+	FirehoseSinkFlag = cli.StringFlag{
+		Name: "firehose.sink",
+		Usage: `Stream executed blocks with receipts, call traces and state diffs to the sink, see ./turbo/firehose/README.md:
+* file:///path or /path - append to the file
+* grpc://host:port - push to firehose.v1.Firehose service
+* other schemes - sinks registered by firehose.RegisterSink (e.g. Kafka, NATS)`,
+	}
+	FirehoseConfirmationsFlag = cli.Uint64Flag{
+		Name:  "firehose.confirmations",
+		Usage: "Stream blocks only when they have this number of blocks on top of them, reorgs of smaller depth are not streamed",
+	}
 
 	// Throttling Flags
 	SyncLoopThrottleFlag = cli.StringFlag{
@@ -144,6 +187,41 @@ var (
 		Value: "",
 	}
 
+	SyncHeadLagFlag = cli.Uint64Flag{
+		Name: "sync.head.lag",
+		Usage: `Execute only blocks which are at least this amount of blocks behind head or marked safe by consensus layer (0 - follow head).
+	Built-in protection from reorgs: RPC sees state of lagging block only`,
+	}
+
+	MaintenanceWindowsFlag = cli.StringFlag{
+		Name: "maintenance.windows",
+		Usage: `Comma separated time of day windows (local time) when heavy background work is allowed: pruning,
+	merging of snapshots, catch-up of lagging indices. For example "01:00-05:00,22:00-23:30". Default - at any time`,
+	}
+	MaintenanceIndexLagFlag = cli.Uint64Flag{
+		Name:  "maintenance.index.lag",
+		Usage: "Outside of maintenance windows, indices and call traces are still built if they are behind execution by at most this amount of blocks",
+		Value: 1_000,
+	}
+
+	TieringColdDirFlag = cli.StringFlag{
+		Name: "tiering.cold.dir",
+		Usage: `Move bodies, transactions and receipts of old blocks from chaindata to database in this directory (on slower,
+	cheaper volume). Reads are transparent. Additional chains of --networks use <dir>/<chain>. Default - not moved`,
+	}
+	TieringHotBlocksFlag = cli.Uint64Flag{
+		Name:  "tiering.hot.blocks",
+		Usage: "Amount of recent blocks which stay in chaindata with --tiering.cold.dir",
+		Value: tiering.DefaultHotBlocks,
+	}
+
+	ShutdownTimeoutFlag = cli.DurationFlag{
+		Name: "shutdown.timeout",
+		Usage: `On shutdown, how long to wait for staged sync to stop at safe checkpoint (running stage commits its work,
+	Execution commits executed blocks) before aborting the running stage. 0 - wait as long as needed`,
+		Value: ethconfig.Defaults.ShutdownTimeout,
+	}
+
 	BadBlockFlag = cli.StringFlag{
 		Name:  "bad.block",
 		Usage: "Marks block with given hex string as bad and forces initial reorg before normal staged sync",
@@ -173,6 +251,14 @@ func ApplyFlagsForEthConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		utils.Fatalf(fmt.Sprintf("error while parsing mode: %v", err))
 	}
 	cfg.Prune = mode
+	cfg.StaleForksRetention = ctx.GlobalUint64(PruneStaleForksFlag.Name)
+	cfg.HeadLag = ctx.GlobalUint64(SyncHeadLagFlag.Name)
+	if cfg.MaintenanceWindows, err = maintenance.ParseWindows(ctx.GlobalString(MaintenanceWindowsFlag.Name)); err != nil {
+		utils.Fatalf("Invalid %s: %v", MaintenanceWindowsFlag.Name, err)
+	}
+	cfg.MaintenanceIndexLag = ctx.GlobalUint64(MaintenanceIndexLagFlag.Name)
+	cfg.TieringColdDir = ctx.GlobalString(TieringColdDirFlag.Name)
+	cfg.TieringHotBlocks = ctx.GlobalUint64(TieringHotBlocksFlag.Name)
 
 	if ctx.GlobalString(BatchSizeFlag.Name) != "" {
 		err := cfg.BatchSize.UnmarshalText([]byte(ctx.GlobalString(BatchSizeFlag.Name)))
@@ -190,8 +276,20 @@ func ApplyFlagsForEthConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		}
 		etl.BufferOptimalSize = *size
 	}
+	if ctx.GlobalString(EtlMemoryBudgetFlag.Name) != "" {
+		var size datasize.ByteSize
+		if err := size.UnmarshalText([]byte(ctx.GlobalString(EtlMemoryBudgetFlag.Name))); err != nil {
+			utils.Fatalf("Invalid etl.memory.budget provided: %v", err)
+		}
+		etlbudget.Default.SetTotal(size)
+	}
 
 	cfg.StateStream = !ctx.GlobalBool(StateStreamDisableFlag.Name)
+	cfg.ExecPrefetch = !ctx.GlobalBool(ExecPrefetchDisableFlag.Name)
+	cfg.SendersRecoverer = ctx.GlobalString(SendersRecovererFlag.Name)
+	cfg.StateBackendAddr = ctx.GlobalString(StateBackendFlag.Name)
+	cfg.FirehoseSink = ctx.GlobalString(FirehoseSinkFlag.Name)
+	cfg.FirehoseConfirmations = ctx.GlobalUint64(FirehoseConfirmationsFlag.Name)
 	cfg.BlockDownloaderWindow = ctx.GlobalInt(BlockDownloaderWindowFlag.Name)
 
 	if ctx.GlobalString(SyncLoopThrottleFlag.Name) != "" {
@@ -202,6 +300,8 @@ func ApplyFlagsForEthConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		cfg.SyncLoopThrottle = syncLoopThrottle
 	}
 
+	cfg.ShutdownTimeout = ctx.GlobalDuration(ShutdownTimeoutFlag.Name)
+
 	if ctx.GlobalString(BadBlockFlag.Name) != "" {
 		bytes, err := hexutil.Decode(ctx.GlobalString(BadBlockFlag.Name))
 		if err != nil {
@@ -268,16 +368,31 @@ func ApplyFlagsForEthConfigCobra(f *pflag.FlagSet, cfg *ethconfig.Config) {
 		}
 		etl.BufferOptimalSize = *size
 	}
+	if v := f.String(EtlMemoryBudgetFlag.Name, EtlMemoryBudgetFlag.Value, EtlMemoryBudgetFlag.Usage); v != nil && *v != "" {
+		var size datasize.ByteSize
+		if err := size.UnmarshalText([]byte(*v)); err != nil {
+			utils.Fatalf("Invalid etl.memory.budget provided: %v", err)
+		}
+		etlbudget.Default.SetTotal(size)
+	}
 
 	cfg.StateStream = true
 	if v := f.Bool(StateStreamDisableFlag.Name, false, StateStreamDisableFlag.Usage); v != nil {
 		cfg.StateStream = false
 	}
+	cfg.ExecPrefetch = true
+	if v := f.Bool(ExecPrefetchDisableFlag.Name, false, ExecPrefetchDisableFlag.Usage); v != nil && *v {
+		cfg.ExecPrefetch = false
+	}
+	if v := f.String(SendersRecovererFlag.Name, SendersRecovererFlag.Value, SendersRecovererFlag.Usage); v != nil {
+		cfg.SendersRecoverer = *v
+	}
 }
 
 func ApplyFlagsForNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setPrivateApi(ctx, cfg)
 	cfg.DatabaseVerbosity = kv.DBVerbosityLvl(ctx.GlobalInt(DatabaseVerbosityFlag.Name))
+	cfg.ReadTxWarn = ctx.GlobalDuration(DatabaseReadTxWarnFlag.Name)
 }
 
 // setPrivateApi populates configuration fields related to the remote
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/ethdb/privateapi"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/urfave/cli"
+)
+
+// importBatchSize - RLP size of blocks sent in one request, well below 4MB message limit of private api
+const importBatchSize = 2 * datasize.MB
+
+var importCommand = cli.Command{
+	Action:    MigrateFlags(doImport),
+	Name:      "import",
+	Usage:     "Import RLP-encoded blocks into running Erigon node",
+	ArgsUsage: "<filename> (<filename 2> ... <filename N>) ",
+	Flags: []cli.Flag{
+		PrivateApiAddr,
+		utils.TLSCertFlag,
+		utils.TLSKeyFlag,
+		utils.TLSCACertFlag,
+	},
+	Category: "BLOCKCHAIN COMMANDS",
+	Description: `
+The import command sends blocks from RLP files (gzipped if name ends with .gz) to the node
+at --private.api.addr, node keeps running and inserts them through staged sync between
+sync cycles. Blocks must be consecutive and extend canonical chain of the node, blocks
+which are canonical already are skipped, so interrupted import can be restarted.`,
+}
+
+func doImport(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return errors.New("this command requires at least one argument")
+	}
+	client, closeConn, err := dialAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	for _, fileName := range ctx.Args() {
+		if err = importFile(client, fileName); err != nil {
+			return fmt.Errorf("import %s: %w", fileName, err)
+		}
+	}
+	return nil
+}
+
+// dialAdmin - client of admin service of the node at --private.api.addr
+func dialAdmin(ctx *cli.Context) (*privateapi.AdminClient, func(), error) {
+	creds, err := grpcutil.TLS(ctx.String(utils.TLSCACertFlag.Name), ctx.String(utils.TLSCertFlag.Name), ctx.String(utils.TLSKeyFlag.Name))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not connect to node: %w", err)
+	}
+	conn, err := grpcutil.Connect(creds, ctx.String(PrivateApiAddr.Name))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not connect to node: %w", err)
+	}
+	return privateapi.NewAdminClient(conn), func() { conn.Close() }, nil
+}
+
+func importFile(client *privateapi.AdminClient, fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var reader io.Reader = f
+	if strings.HasSuffix(fileName, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return err
+		}
+	}
+	stream := rlp.NewStream(reader, 0)
+
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	var batch []*types.Block
+	var batchSize datasize.ByteSize
+	var imported int
+	send := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := client.ImportBlocks(context.Background(), batch); err != nil {
+			return fmt.Errorf("blocks %d-%d: %w", batch[0].NumberU64(), batch[len(batch)-1].NumberU64(), err)
+		}
+		imported += len(batch)
+		select {
+		case <-logEvery.C:
+			log.Info("Importing blocks", "file", fileName, "block", batch[len(batch)-1].NumberU64())
+		default:
+		}
+		batch, batchSize = batch[:0], 0
+		return nil
+	}
+	for {
+		var block types.Block
+		if err = stream.Decode(&block); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("block %d: %w", imported+len(batch), err)
+		}
+		batch = append(batch, &block)
+		if batchSize += datasize.ByteSize(block.Size()); batchSize >= importBatchSize {
+			if err = send(); err != nil {
+				return err
+			}
+		}
+	}
+	if err = send(); err != nil {
+		return err
+	}
+	log.Info("Imported blocks", "file", fileName, "blocks", imported)
+	return nil
+}
@@ -1,9 +1,10 @@
 package cli
 
 import (
-	"encoding/json"
 	"os"
+	"path"
 
+	"github.com/ledgerwatch/erigon-lib/etl"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/cmd/utils"
 	"github.com/ledgerwatch/erigon/core"
@@ -26,7 +27,9 @@ The init command initializes a new genesis block and definition for the network.
 This is a destructive action and changes the network in which you will be
 participating.
 
-It expects the genesis file as argument.`,
+It expects the genesis file as argument. Accounts of "alloc" are streamed through
+temporary files in datadir, so genesis with millions of accounts doesn't need to fit
+into memory.`,
 }
 
 // initGenesis will initialise the given JSON format genesis file and writes it as
@@ -44,15 +47,21 @@ func initGenesis(ctx *cli.Context) error {
 	}
 	defer file.Close()
 
-	genesis := new(core.Genesis)
-	if err := json.NewDecoder(file).Decode(genesis); err != nil {
-		utils.Fatalf("invalid genesis file: %v", err)
-	}
-
 	// Open and initialise both full and light databases
 	stack := MakeConfigNodeDefault(ctx)
 	defer stack.Close()
 
+	// alloc is streamed through temporary files, genesis of big testnets doesn't fit into memory
+	tmpdir := path.Join(stack.Config().DataDir, etl.TmpDirName)
+	if err = os.MkdirAll(tmpdir, 0755); err != nil {
+		utils.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	genesis, err := core.ReadGenesisJSON(file, tmpdir)
+	if err != nil {
+		utils.Fatalf("invalid genesis file: %v", err)
+	}
+	defer genesis.Close()
+
 	chaindb, err := node.OpenDatabase(stack.Config(), log.New(ctx), kv.ChainDB)
 	if err != nil {
 		utils.Fatalf("Failed to open database: %v", err)
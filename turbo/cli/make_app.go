@@ -27,7 +27,7 @@ func MakeApp(action func(*cli.Context), cliFlags []cli.Flag) *cli.App {
 		debug.Exit()
 		return nil
 	}
-	app.Commands = []cli.Command{initCommand, snapshotCommand}
+	app.Commands = []cli.Command{initCommand, importCommand, updateChainConfigCommand, snapshotCommand, dbSizeCommand, doctorCommand, backupCommand, restoreCommand}
 	return app
 }
 
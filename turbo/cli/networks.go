@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/urfave/cli"
+)
+
+var NetworksFlag = cli.StringFlag{
+	Name: "networks",
+	Usage: `Run additional chains in this process, comma separated <chain>=<datadir>. For example "goerli=/data/goerli,sepolia=/data/sepolia".
+	Each network has own datadir and sentry and inherits all other flags, N-th network of the list listens p2p on --port+N
+	and serves private api on port of --private.api.addr+N. Connect rpcdaemon to them by --private.api.networks`,
+}
+
+// Network is an additional chain run by the same process, see --networks
+type Network struct {
+	Chain   string
+	DataDir string
+}
+
+// ParseNetworks parses value of --networks
+func ParseNetworks(s string) ([]Network, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var networks []Network
+	chains, dirs := map[string]struct{}{}, map[string]struct{}{}
+	for _, item := range utils.SplitAndTrim(s) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("network %q: expected <chain>=<datadir>", item)
+		}
+		chain, dir := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if chain == "" || dir == "" {
+			return nil, fmt.Errorf("network %q: expected <chain>=<datadir>", item)
+		}
+		dir = filepath.Clean(dir)
+		if _, ok := chains[chain]; ok {
+			return nil, fmt.Errorf("network %q: chain %s is listed twice", item, chain)
+		}
+		if _, ok := dirs[dir]; ok {
+			return nil, fmt.Errorf("network %q: datadir %s is used by another network", item, dir)
+		}
+		chains[chain], dirs[dir] = struct{}{}, struct{}{}
+		networks = append(networks, Network{Chain: chain, DataDir: dir})
+	}
+	return networks, nil
+}
+
+// ShiftPort returns addr ("host:port") with port increased by offset. Empty addr and port 0 (random port) are
+// returned as is.
+func ShiftPort(addr string, offset int) (string, error) {
+	if addr == "" {
+		return addr, nil
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", fmt.Errorf("invalid port in %s: %w", addr, err)
+	}
+	if port == 0 {
+		return addr, nil
+	}
+	if port+offset > 65535 {
+		return "", fmt.Errorf("port of %s shifted by %d is out of range", addr, offset)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port+offset)), nil
+}
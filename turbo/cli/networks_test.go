@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks("goerli=/data/goerli, sepolia = /data/sepolia/")
+	require.NoError(t, err)
+	require.Equal(t, []Network{{Chain: "goerli", DataDir: "/data/goerli"}, {Chain: "sepolia", DataDir: "/data/sepolia"}}, networks)
+
+	networks, err = ParseNetworks("")
+	require.NoError(t, err)
+	require.Empty(t, networks)
+
+	for _, bad := range []string{"goerli", "goerli=", "=/data", "goerli=/a,goerli=/b", "goerli=/a,sepolia=/a/"} {
+		_, err = ParseNetworks(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestShiftPort(t *testing.T) {
+	for addr, expect := range map[string]string{
+		"127.0.0.1:9090": "127.0.0.1:9092",
+		":30303":         ":30305",
+		":0":             ":0",
+		"":               "",
+	} {
+		shifted, err := ShiftPort(addr, 2)
+		require.NoError(t, err, addr)
+		require.Equal(t, expect, shifted, addr)
+	}
+	_, err := ShiftPort("localhost:65535", 1)
+	require.Error(t, err)
+	_, err = ShiftPort("localhost", 1)
+	require.Error(t, err)
+}
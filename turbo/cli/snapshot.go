@@ -8,13 +8,21 @@ import (
 	"os"
 	"path"
 
+	lg "github.com/anacrolix/log"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/c2h5oh/datasize"
 	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/etl"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/cmd/downloader/downloader"
 	"github.com/ledgerwatch/erigon/cmd/hack/tool"
 	"github.com/ledgerwatch/erigon/cmd/utils"
 	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/historysnapshot"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync/parallelcompress"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snapshothashes"
 	"github.com/ledgerwatch/log/v3"
@@ -33,9 +41,41 @@ var snapshotCommand = cli.Command{
 			Flags: []cli.Flag{
 				utils.DataDirFlag,
 				SnapshotFromFlag,
+				SnapshotToFlag,
 				SnapshotSegmentSizeFlag,
+				SnapshotVerifyFlag,
+				SnapshotSeedFlag,
 			},
-			Description: `Create snapshots`,
+			Description: `Create .seg files and .torrent files for blocks range [from, to) of synced datadir`,
+		},
+		{
+			Name:   "history",
+			Action: doHistorySnapshotCommand,
+			Flags: []cli.Flag{
+				utils.DataDirFlag,
+				SnapshotFromFlag,
+				SnapshotToFlag,
+				SnapshotSegmentSizeFlag,
+			},
+			Description: `Create files of history of accounts and storage for blocks range [from, to) of archive datadir`,
+		},
+		{
+			Name:        "history-blooms",
+			Action:      doHistoryBloomsCommand,
+			Flags:       []cli.Flag{utils.DataDirFlag},
+			Description: `Create missing .bloom files of history files (created before blooms were introduced)`,
+		},
+		{
+			Name:   "offload",
+			Action: doOffloadCommand,
+			Flags: []cli.Flag{
+				utils.DataDirFlag,
+				utils.SnapshotRemoteFlag,
+				SnapshotOffloadBeforeFlag,
+				SnapshotOffloadKeepFlag,
+			},
+			Description: `Upload segments of blocks below --before into --experimental.snapshot.remote and remove them from datadir,
+to run with --experimental.snapshot.remote (and --experimental.snapshot.remote.lazy). Indices stay in datadir. Erigon must be stopped`,
 		},
 	},
 }
@@ -46,110 +86,315 @@ var (
 		Usage:    "From block number",
 		Required: true,
 	}
+	SnapshotToFlag = cli.Uint64Flag{
+		Name:  "to",
+		Usage: "To block number (excluded). By default: last block of datadir, rounded down to --segment.size",
+	}
 	SnapshotSegmentSizeFlag = cli.Uint64Flag{
 		Name:     "segment.size",
 		Usage:    "Amount of blocks in each segment",
 		Value:    500_000,
 		Required: true,
 	}
+	SnapshotVerifyFlag = cli.BoolTFlag{
+		Name:  "verify",
+		Usage: "Compare created segments with database before creating .torrent files",
+	}
+	SnapshotSeedFlag = cli.BoolFlag{
+		Name:  "seed",
+		Usage: "Seed created segments until interrupted. Downloader must not run on same datadir",
+	}
+	SnapshotOffloadBeforeFlag = cli.Uint64Flag{
+		Name:     "before",
+		Usage:    "Offload segments which end at or below this block number",
+		Required: true,
+	}
+	SnapshotOffloadKeepFlag = cli.BoolFlag{
+		Name:  "keep",
+		Usage: "Only upload segments, keep them in datadir",
+	}
 )
 
+func checkSegmentFlags(fromBlock, toBlock, segmentSize uint64) error {
+	if segmentSize < 1000 {
+		return fmt.Errorf("too small --segment.size %d", segmentSize)
+	}
+	// file names store block numbers in thousands
+	if fromBlock%1_000 != 0 || toBlock%1_000 != 0 || segmentSize%1_000 != 0 {
+		return fmt.Errorf("--from, --to and --segment.size must be multiples of 1000")
+	}
+	return nil
+}
+
 func doSnapshotCommand(ctx *cli.Context) error {
 	fromBlock := ctx.Uint64(SnapshotFromFlag.Name)
+	toBlock := ctx.Uint64(SnapshotToFlag.Name)
 	segmentSize := ctx.Uint64(SnapshotSegmentSizeFlag.Name)
-	if segmentSize < 1000 {
-		return fmt.Errorf("too small --segment.size %d", segmentSize)
+	if err := checkSegmentFlags(fromBlock, toBlock, segmentSize); err != nil {
+		return err
 	}
 	dataDir := ctx.String(utils.DataDirFlag.Name)
 	snapshotDir := path.Join(dataDir, "snapshots")
+	tmpDir := path.Join(dataDir, etl.TmpDirName)
 
-	chainDB := mdbx.MustOpen(path.Join(dataDir, "chaindata"))
+	chainDB := mdbx.NewMDBX(log.New()).Path(path.Join(dataDir, "chaindata")).Readonly().MustOpen()
 	defer chainDB.Close()
 
-	if err := snapshotBlocks(chainDB, fromBlock, segmentSize, snapshotDir); err != nil {
-		log.Error("Error", "err", err)
+	created, err := snapshotBlocks(chainDB, fromBlock, toBlock, segmentSize, tmpDir, snapshotDir, ctx.BoolT(SnapshotVerifyFlag.Name))
+	if err != nil {
+		return err
+	}
+	for _, fileName := range created {
+		info, err := downloader.BuildInfoBytesForFile(snapshotDir, fileName)
+		if err != nil {
+			return err
+		}
+		// existing .torrent file may describe old content of re-created segment
+		if err = downloader.CreateTorrentFile(snapshotDir, info, nil); err != nil {
+			return err
+		}
+		mi, err := metainfo.LoadFromFile(path.Join(snapshotDir, fileName+".torrent"))
+		if err != nil {
+			return err
+		}
+		log.Info("Created", "file", fileName+".torrent", "hash", mi.HashInfoBytes())
+	}
+	if ctx.Bool(SnapshotSeedFlag.Name) {
+		return seedSnapshots(snapshotDir, created)
 	}
 	return nil
 }
 
-func snapshotBlocks(chainDB kv.RoDB, fromBlock, blocksPerFile uint64, snapshotDir string) error {
-	lastChunk := func(tx kv.Tx, blocksPerFile uint64) (uint64, error) {
+// snapshotBlocks - creates headers, bodies and transactions segments for [fromBlock, toBlock), returns names of created files.
+// Last segment can be smaller than blocksPerFile.
+func snapshotBlocks(chainDB kv.RoDB, fromBlock, toBlock, blocksPerFile uint64, tmpDir, snapshotDir string, verify bool) ([]string, error) {
+	var last uint64
+	if err := chainDB.View(context.Background(), func(tx kv.Tx) error {
 		c, err := tx.Cursor(kv.BlockBody)
 		if err != nil {
-			return 0, err
+			return err
 		}
 		k, _, err := c.Last()
 		if err != nil {
-			return 0, err
+			return err
 		}
-		last := binary.BigEndian.Uint64(k)
-		// TODO: enable next condition (disabled for tests)
-		//if last > params.FullImmutabilityThreshold {
-		//	last -= params.FullImmutabilityThreshold
-		//} else {
-		//	last = 0
-		//}
-		last = last - last%blocksPerFile
-		return last, nil
+		if k != nil {
+			last = binary.BigEndian.Uint64(k)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	log.Info("Last body number", "last", last)
+	if toBlock == 0 {
+		// TODO: keep distance params.FullImmutabilityThreshold from the tip (disabled for tests)
+		toBlock = last - last%blocksPerFile
+	}
+	if toBlock > last+1 {
+		return nil, fmt.Errorf("--to %d is after last block %d", toBlock, last)
+	}
+	if fromBlock >= toBlock {
+		return nil, fmt.Errorf("empty blocks range [%d, %d)", fromBlock, toBlock)
+	}
+	if err := os.MkdirAll(snapshotDir, fs.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(tmpDir, fs.ModePerm); err != nil {
+		return nil, err
 	}
 
-	var last uint64
+	var created []string
+	for i := fromBlock; i < toBlock; i += blocksPerFile {
+		to := i + blocksPerFile
+		if to > toBlock {
+			to = toBlock
+		}
+		for _, snapshotType := range snapshotsync.AllSnapshotTypes {
+			if err := dumpSegment(chainDB, i, to, snapshotType, tmpDir, snapshotDir); err != nil {
+				return nil, fmt.Errorf("%s: %w", snapshotsync.SegmentFileName(i, to, snapshotType), err)
+			}
+		}
+		if verify {
+			if err := snapshotsync.VerifySegments(chainDB, snapshotDir, i, to); err != nil {
+				return nil, fmt.Errorf("verify segments [%d, %d): %w", i, to, err)
+			}
+			log.Info("Verified", "from", i, "to", to)
+		}
+		for _, snapshotType := range snapshotsync.AllSnapshotTypes {
+			created = append(created, snapshotsync.SegmentFileName(i, to, snapshotType))
+		}
+	}
+	return created, nil
+}
 
-	chainConfig := tool.ChainConfigFromDB(chainDB)
-	chainID, _ := uint256.FromBig(chainConfig.ChainID)
-	_ = chainID
-	if err := chainDB.View(context.Background(), func(tx kv.Tx) (err error) {
-		last, err = lastChunk(tx, blocksPerFile)
+func dumpSegment(chainDB kv.RoDB, from, to uint64, snapshotType snapshotsync.SnapshotType, tmpDir, snapshotDir string) error {
+	fileName := snapshotsync.FileName(from, to, snapshotType)
+	log.Info("Creating", "file", fileName+".seg")
+	tmpFileName := path.Join(tmpDir, fileName)
+	defer os.Remove(tmpFileName + ".dat")
+	defer os.Remove(tmpFileName + ".dictionary.txt")
+
+	var err error
+	switch snapshotType {
+	case snapshotsync.Headers:
+		err = snapshotsync.DumpHeaders(chainDB, tmpDir, from, int(to-from))
+	case snapshotsync.Bodies:
+		err = snapshotsync.DumpBodies(chainDB, tmpDir, from, int(to-from))
+	case snapshotsync.Transactions:
+		_, err = snapshotsync.DumpTxs(chainDB, tmpDir, from, int(to-from))
+	}
+	if err != nil {
 		return err
-	}); err != nil {
+	}
+	return parallelcompress.Compress(string(snapshotType), tmpFileName, path.Join(snapshotDir, fileName+".seg"))
+}
+
+func doHistorySnapshotCommand(ctx *cli.Context) error {
+	fromBlock := ctx.Uint64(SnapshotFromFlag.Name)
+	toBlock := ctx.Uint64(SnapshotToFlag.Name)
+	segmentSize := ctx.Uint64(SnapshotSegmentSizeFlag.Name)
+	if err := checkSegmentFlags(fromBlock, toBlock, segmentSize); err != nil {
+		return err
+	}
+	dataDir := ctx.String(utils.DataDirFlag.Name)
+	historyDir := path.Join(dataDir, "snapshots", historysnapshot.DirName)
+	tmpDir := path.Join(dataDir, etl.TmpDirName)
+	if err := os.MkdirAll(tmpDir, fs.ModePerm); err != nil {
 		return err
 	}
-	_ = os.MkdirAll(snapshotDir, fs.ModePerm)
 
-	log.Info("Last body number", "last", last)
-	for i := fromBlock; i < last; i += blocksPerFile {
-		fileName := snapshotsync.FileName(i, i+blocksPerFile, snapshotsync.Bodies)
+	chainDB := mdbx.NewMDBX(log.New()).Path(path.Join(dataDir, "chaindata")).Readonly().MustOpen()
+	defer chainDB.Close()
 
-		log.Info("Creating", "file", fileName+".seg")
-		if err := snapshotsync.DumpBodies(chainDB, "", i, int(blocksPerFile)); err != nil {
-			panic(err)
+	if err := chainDB.View(context.Background(), func(tx kv.Tx) error {
+		executed, err := stages.GetStageProgress(tx, stages.Execution)
+		if err != nil {
+			return err
 		}
-		segmentFile := path.Join(snapshotDir, fileName) + ".seg"
-		if err := parallelcompress.Compress("Bodies", fileName, segmentFile); err != nil {
-			panic(err)
+		if toBlock == 0 {
+			toBlock = (executed + 1) - (executed+1)%segmentSize
 		}
-		_ = os.Remove(fileName + ".dat")
-
-		fileName = snapshotsync.FileName(i, i+blocksPerFile, snapshotsync.Headers)
-		log.Info("Creating", "file", fileName+".seg")
-		if err := snapshotsync.DumpHeaders(chainDB, "", i, int(blocksPerFile)); err != nil {
-			panic(err)
+		if toBlock > executed+1 {
+			return fmt.Errorf("--to %d is after last executed block %d", toBlock, executed)
 		}
-		segmentFile = path.Join(snapshotDir, fileName) + ".seg"
-		if err := parallelcompress.Compress("Headers", fileName, segmentFile); err != nil {
-			panic(err)
+		pm, err := prune.Get(tx)
+		if err != nil {
+			return err
 		}
-		_ = os.Remove(fileName + ".dat")
+		if pm.History.Enabled() && pm.History.PruneTo(executed) > fromBlock {
+			return fmt.Errorf("history of blocks before %d is pruned in this datadir, --from %d needs archive node", pm.History.PruneTo(executed), fromBlock)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if fromBlock >= toBlock {
+		return fmt.Errorf("empty blocks range [%d, %d)", fromBlock, toBlock)
+	}
+
+	rootCtx, cancel := utils.RootContext()
+	defer cancel()
+	return historysnapshot.DumpRange(rootCtx, chainDB, fromBlock, toBlock, segmentSize, tmpDir, historyDir)
+}
+
+func doHistoryBloomsCommand(ctx *cli.Context) error {
+	dataDir := ctx.String(utils.DataDirFlag.Name)
+	return historysnapshot.BuildMissingBlooms(path.Join(dataDir, "snapshots", historysnapshot.DirName))
+}
+
+// seedSnapshots - seeds given files until interrupted, doesn't download anything
+func seedSnapshots(snapshotDir string, files []string) error {
+	ctx, cancel := utils.RootContext()
+	defer cancel()
 
-		fileName = snapshotsync.FileName(i, i+blocksPerFile, snapshotsync.Transactions)
-		log.Info("Creating", "file", fileName+".seg")
-		_, err := snapshotsync.DumpTxs(chainDB, "", i, int(blocksPerFile))
+	// same as downloader defaults
+	cfg, pieceStore, err := downloader.TorrentConfig(snapshotDir, true, "", lg.Warning, datasize.GB, datasize.GB)
+	if err != nil {
+		return err
+	}
+	client, err := downloader.New(cfg, pieceStore)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for _, fileName := range files {
+		mi, err := metainfo.LoadFromFile(path.Join(snapshotDir, fileName+".torrent"))
 		if err != nil {
-			panic(err)
+			return err
 		}
-		segmentFile = path.Join(snapshotDir, fileName) + ".seg"
-		if err := parallelcompress.Compress("Transactions", fileName, segmentFile); err != nil {
-			panic(err)
+		mi.AnnounceList = downloader.Trackers
+		t, err := client.Cli.AddTorrent(mi)
+		if err != nil {
+			return err
 		}
-		_ = os.Remove(fileName + ".dat")
-
-		//nolint
-		//break // TODO: remove me - useful for tests
+		t.VerifyData()
+		t.AllowDataUpload()
 	}
+	log.Info("Seeding, press Ctrl+C to stop", "files", len(files))
+	downloader.MainLoop(ctx, client.Cli)
 	return nil
 }
 
 //nolint
+func doOffloadCommand(ctx *cli.Context) error {
+	snapshotDir := path.Join(ctx.String(utils.DataDirFlag.Name), "snapshots")
+	before := ctx.Uint64(SnapshotOffloadBeforeFlag.Name)
+	if ctx.String(utils.SnapshotRemoteFlag.Name) == "" {
+		return fmt.Errorf("--%s is required", utils.SnapshotRemoteFlag.Name)
+	}
+	remote, err := snapshotsync.NewRemoteStorage(ctx.String(utils.SnapshotRemoteFlag.Name), snapshotDir)
+	if err != nil {
+		return err
+	}
+	if err = remote.Refresh(context.Background()); err != nil {
+		return err
+	}
+	ranges, err := snapshotsync.SegmentRanges(snapshotDir)
+	if err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		if r.To > before {
+			continue
+		}
+		var files []string
+		for _, snapshotType := range snapshotsync.AllSnapshotTypes {
+			files = append(files, snapshotsync.IdxFileName(r.From, r.To, snapshotType))
+		}
+		// headers last: remote range is used only if segments of all types exist
+		files = append(files,
+			snapshotsync.SegmentFileName(r.From, r.To, snapshotsync.Bodies),
+			snapshotsync.SegmentFileName(r.From, r.To, snapshotsync.Transactions),
+			snapshotsync.SegmentFileName(r.From, r.To, snapshotsync.Headers),
+		)
+		for _, f := range files {
+			info, err := os.Stat(path.Join(snapshotDir, f))
+			if err != nil {
+				return err
+			}
+			if size, ok := remote.Size(f); ok && size == info.Size() {
+				continue
+			}
+			if err := remote.Upload(context.Background(), f); err != nil {
+				return fmt.Errorf("uploading %s: %w", f, err)
+			}
+		}
+		if !ctx.Bool(SnapshotOffloadKeepFlag.Name) {
+			for _, snapshotType := range snapshotsync.AllSnapshotTypes {
+				segment := snapshotsync.SegmentFileName(r.From, r.To, snapshotType)
+				for _, f := range []string{segment, segment + ".torrent"} {
+					if err := os.Remove(path.Join(snapshotDir, f)); err != nil && !os.IsNotExist(err) {
+						return err
+					}
+				}
+			}
+		}
+		log.Info("Offloaded segments", "range", r)
+	}
+	return nil
+}
+
 func checkBlockSnapshot(chaindata string) error {
 	database := mdbx.MustOpen(chaindata)
 	defer database.Close()
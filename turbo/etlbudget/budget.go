@@ -0,0 +1,97 @@
+// Package etlbudget shares memory between ETL collectors which are open at same time. Collector which gets smaller
+// buffer spills sorted data to zstd-compressed temp files more often - it's slower, but RAM usage stays bounded.
+// etl.Transform with leased BufferSize spills through erigon-lib/etl, its temp files are not compressed.
+package etlbudget
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/etl"
+)
+
+// MinBufferSize - buffer size under pressure. Smaller buffers produce too many temp files, which are all open during load
+const MinBufferSize = 16 * datasize.MB
+
+// Default - budget of sync stages, set by --etl.memory.budget. Zero total - unlimited
+var Default = newBudget(0, true)
+
+type Budget struct {
+	lock     sync.Mutex
+	total    datasize.ByteSize
+	used     datasize.ByteSize
+	perStage map[string]datasize.ByteSize
+	metrics  bool
+}
+
+func New(total datasize.ByteSize) *Budget {
+	return newBudget(total, false)
+}
+
+func newBudget(total datasize.ByteSize, withMetrics bool) *Budget {
+	return &Budget{total: total, perStage: map[string]datasize.ByteSize{}, metrics: withMetrics}
+}
+
+func (b *Budget) SetTotal(total datasize.ByteSize) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.total = total
+}
+
+// Acquire - leases buffer for collector of stage: etl.BufferOptimalSize if budget has enough free memory,
+// otherwise rest of budget, but not less than MinBufferSize
+func (b *Budget) Acquire(stage string) *Lease {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	size := etl.BufferOptimalSize
+	if b.total > 0 {
+		free := datasize.ByteSize(0)
+		if b.total > b.used {
+			free = b.total - b.used
+		}
+		if free < size {
+			size = free
+		}
+		if size < MinBufferSize {
+			size = MinBufferSize
+		}
+	}
+	b.used += size
+	if _, ok := b.perStage[stage]; !ok && b.metrics {
+		metrics.GetOrCreateGauge(fmt.Sprintf(`etl_buffers_bytes{stage="%s"}`, stage), func() float64 {
+			return float64(b.Used(stage))
+		})
+	}
+	b.perStage[stage] += size
+	return &Lease{budget: b, stage: stage, size: size}
+}
+
+// Used - memory leased by collectors of stage
+func (b *Budget) Used(stage string) datasize.ByteSize {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.perStage[stage]
+}
+
+func (b *Budget) release(l *Lease) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.used -= l.size
+	b.perStage[l.stage] -= l.size
+}
+
+type Lease struct {
+	budget *Budget
+	stage  string
+	size   datasize.ByteSize
+	once   sync.Once
+}
+
+func (l *Lease) Size() datasize.ByteSize { return l.size }
+
+// Release - returns memory to budget, can be called many times
+func (l *Lease) Release() {
+	l.once.Do(func() { l.budget.release(l) })
+}
@@ -0,0 +1,78 @@
+package etlbudget
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/etl"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudget(t *testing.T) {
+	require := require.New(t)
+	unlimited := New(0)
+	l := unlimited.Acquire("a")
+	require.Equal(etl.BufferOptimalSize, l.Size())
+	l.Release()
+	require.Zero(unlimited.Used("a"))
+
+	b := New(etl.BufferOptimalSize + 100*datasize.MB)
+	l1 := b.Acquire("a")
+	require.Equal(etl.BufferOptimalSize, l1.Size())
+	l2 := b.Acquire("b")
+	require.Equal(100*datasize.MB, l2.Size())
+	// budget is exhausted
+	l3 := b.Acquire("b")
+	require.Equal(MinBufferSize, l3.Size())
+	require.Equal(100*datasize.MB+MinBufferSize, b.Used("b"))
+
+	l1.Release()
+	l1.Release()
+	require.Zero(b.Used("a"))
+	l4 := b.Acquire("a")
+	require.Equal(etl.BufferOptimalSize-MinBufferSize, l4.Size())
+	l2.Release()
+	l3.Release()
+	l4.Release()
+	require.Zero(b.Used("a"))
+	require.Zero(b.Used("b"))
+}
+
+func TestCollectorSpill(t *testing.T) {
+	require := require.New(t)
+	_, tx := memdb.NewTestTx(t)
+	require.NoError(tx.Put(kv.HashedAccounts, []byte{0x05}, []byte{0xff}))
+	require.NoError(tx.Put(kv.HashedAccounts, []byte{0x10}, []byte{0xff}))
+
+	tmpdir := t.TempDir()
+	// 2-byte entries, 3 entries per buffer
+	c := newCollector("test", tmpdir, New(0).Acquire("test"))
+	c.lease.size = 3 * (2 + entryOverhead)
+	defer c.Close()
+	for _, e := range [][2][]byte{
+		{{0x03}, {0x01}}, {{0x01}, {0x01}}, {{0x02}, {0x01}}, // spilled
+		{{0x02}, {0x02}}, {{0x05}, {}}, {{0x04}, {0x02}}, // spilled, overrides 0x02, deletes 0x05
+		{{0x02}, {0x03}}, // stays in memory
+	} {
+		require.NoError(c.Collect(e[0], e[1]))
+	}
+	files, err := ioutil.ReadDir(tmpdir)
+	require.NoError(err)
+	require.Len(files, 2)
+
+	require.NoError(c.Load(tx, kv.HashedAccounts, etl.IdentityLoadFunc, etl.TransformArgs{}))
+	var got [][2][]byte
+	require.NoError(tx.ForEach(kv.HashedAccounts, nil, func(k, v []byte) error {
+		got = append(got, [2][]byte{k, v})
+		return nil
+	}))
+	require.Equal([][2][]byte{{{0x01}, {0x01}}, {{0x02}, {0x03}}, {{0x03}, {0x01}}, {{0x04}, {0x02}}, {{0x10}, {0xff}}}, got)
+
+	c.Close()
+	files, err = ioutil.ReadDir(tmpdir)
+	require.NoError(err)
+	require.Empty(files)
+}
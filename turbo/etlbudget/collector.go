@@ -0,0 +1,304 @@
+package etlbudget
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/klauspost/compress/zstd"
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/etl"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// Collector - etl collector with buffer leased from budget. Full buffer is sorted and spilled to zstd-compressed temp
+// file, Load merges temp files and the last buffer into table the same way as etl.Collector with etl.SortableBuffer:
+// values of equal keys are loaded in order of collection.
+type Collector struct {
+	logPrefix string
+	tmpdir    string
+	lease     *Lease
+	entries   []entry
+	size      int
+	files     []*os.File
+	encoder   *zstd.Encoder
+}
+
+type entry struct{ k, v []byte }
+
+// entryOverhead - memory of entry besides its bytes: two slice headers in entries and rounding of two allocations to
+// size classes. Without it buffer of small keys (HashState) takes 1.5-2x of the lease.
+const entryOverhead = 48 + 2*8
+
+// NewCollector - collector with buffer leased from Default budget. Returned func closes collector, removes its temp
+// files and releases the lease.
+func NewCollector(logPrefix, tmpdir string) (*Collector, func()) {
+	c := newCollector(logPrefix, tmpdir, Default.Acquire(logPrefix))
+	return c, c.Close
+}
+
+func newCollector(logPrefix, tmpdir string, lease *Lease) *Collector {
+	return &Collector{logPrefix: logPrefix, tmpdir: tmpdir, lease: lease}
+}
+
+func (c *Collector) Collect(k, v []byte) error {
+	c.entries = append(c.entries, entry{libcommon.Copy(k), libcommon.Copy(v)})
+	c.size += len(k) + len(v) + entryOverhead
+	if c.size >= int(c.lease.Size()) {
+		return c.spill()
+	}
+	return nil
+}
+
+func (c *Collector) sort() {
+	sort.SliceStable(c.entries, func(i, j int) bool { return bytes.Compare(c.entries[i].k, c.entries[j].k) < 0 })
+}
+
+// spill - writes sorted buffer to temp file as zstd stream of (uvarint len, key, uvarint len, value)
+func (c *Collector) spill() error {
+	c.sort()
+	f, err := ioutil.TempFile(c.tmpdir, "erigon-sortable-buf-zst-")
+	if err != nil {
+		return fmt.Errorf("%s: creating temp file: %w", c.logPrefix, err)
+	}
+	c.files = append(c.files, f)
+	if c.encoder == nil {
+		if c.encoder, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest)); err != nil {
+			return err
+		}
+	}
+	c.encoder.Reset(f)
+	w := bufio.NewWriterSize(c.encoder, 1<<20)
+	var lenBuf [binary.MaxVarintLen64]byte
+	for _, e := range c.entries {
+		for _, b := range [][]byte{e.k, e.v} {
+			n := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+			if _, err = w.Write(lenBuf[:n]); err != nil {
+				return fmt.Errorf("%s: writing temp file: %w", c.logPrefix, err)
+			}
+			if _, err = w.Write(b); err != nil {
+				return fmt.Errorf("%s: writing temp file: %w", c.logPrefix, err)
+			}
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return fmt.Errorf("%s: writing temp file: %w", c.logPrefix, err)
+	}
+	if err = c.encoder.Close(); err != nil {
+		return fmt.Errorf("%s: writing temp file: %w", c.logPrefix, err)
+	}
+	c.entries, c.size = nil, 0
+	return nil
+}
+
+// provider - sorted source of entries: temp file or the last buffer
+type provider interface {
+	next() (k, v []byte, err error)
+}
+
+type fileProvider struct{ r *bufio.Reader }
+
+func (p *fileProvider) next() ([]byte, []byte, error) {
+	k, err := p.read()
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := p.read()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return k, v, err
+}
+
+func (p *fileProvider) read() ([]byte, error) {
+	l, err := binary.ReadUvarint(p.r)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, l)
+	if _, err = io.ReadFull(p.r, b); err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+type memProvider struct {
+	entries []entry
+	i       int
+}
+
+func (p *memProvider) next() ([]byte, []byte, error) {
+	if p.i == len(p.entries) {
+		return nil, nil, io.EOF
+	}
+	e := p.entries[p.i]
+	p.i++
+	return e.k, e.v, nil
+}
+
+type heapElem struct {
+	k, v []byte
+	idx  int // index of provider, providers are in order of collection
+}
+
+type mergeHeap []heapElem
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if c := bytes.Compare(h[i].k, h[j].k); c != 0 {
+		return c < 0
+	}
+	return h[i].idx < h[j].idx
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(heapElem)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+type currentTableReader struct {
+	tx    kv.Tx
+	table string
+}
+
+func (r *currentTableReader) Get(k []byte) ([]byte, error) { return r.tx.GetOne(r.table, k) }
+
+// Load - writes collected entries to table through loadFunc: empty value deletes key, identity loadFunc appends if
+// all keys are after the last key of table
+func (c *Collector) Load(db kv.RwTx, table string, loadFunc etl.LoadFunc, args etl.TransformArgs) error {
+	if loadFunc == nil {
+		loadFunc = etl.IdentityLoadFunc
+	}
+	c.sort()
+	providers := make([]provider, 0, len(c.files)+1)
+	for _, f := range c.files {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		decoder, err := zstd.NewReader(bufio.NewReaderSize(f, 1<<20), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+		defer decoder.Close()
+		providers = append(providers, &fileProvider{bufio.NewReader(decoder)})
+	}
+	providers = append(providers, &memProvider{entries: c.entries})
+
+	h := &mergeHeap{}
+	for i, p := range providers {
+		k, v, err := p.next()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: reading temp file: %w", c.logPrefix, err)
+		}
+		heap.Push(h, heapElem{k, v, i})
+	}
+
+	cur, err := db.RwCursor(table)
+	if err != nil {
+		return err
+	}
+	defer cur.Close()
+	lastKey, _, err := cur.Last()
+	if err != nil {
+		return err
+	}
+	identity := reflect.ValueOf(etl.IdentityLoadFunc).Pointer() == reflect.ValueOf(loadFunc).Pointer() // other loadFunc may change order
+	isDupSort := kv.ChaindataTablesCfg[table].Flags&kv.DupSort != 0 && !kv.ChaindataTablesCfg[table].AutoDupSortKeysConversion
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	var m runtime.MemStats
+
+	first, canUseAppend := true, false
+	loadNext := func(_, k, v []byte) error {
+		if first {
+			canUseAppend = identity && (lastKey == nil || bytes.Compare(lastKey, k) < 0)
+			first = false
+		}
+		select {
+		default:
+		case <-logEvery.C:
+			logArgs := []interface{}{"into", table}
+			if args.LogDetailsLoad != nil {
+				logArgs = append(logArgs, args.LogDetailsLoad(k, v)...)
+			} else {
+				logArgs = append(logArgs, "current key", fmt.Sprintf("%x", k))
+			}
+			runtime.ReadMemStats(&m)
+			logArgs = append(logArgs, "alloc", libcommon.ByteCount(m.Alloc), "sys", libcommon.ByteCount(m.Sys))
+			log.Info(fmt.Sprintf("[%s] ETL [2/2] Loading", c.logPrefix), logArgs...)
+		}
+		switch {
+		case len(v) == 0 && canUseAppend:
+			return nil // nothing to delete after end of table
+		case len(v) == 0:
+			return cur.Delete(k, nil)
+		case canUseAppend && isDupSort:
+			if err := cur.(kv.RwCursorDupSort).AppendDup(k, v); err != nil {
+				return fmt.Errorf("%s: table: %s, appendDup: k=%x, %w", c.logPrefix, table, k, err)
+			}
+		case canUseAppend:
+			if err := cur.Append(k, v); err != nil {
+				return fmt.Errorf("%s: table: %s, append: k=%x, %w", c.logPrefix, table, k, err)
+			}
+		default:
+			if err := cur.Put(k, v); err != nil {
+				return fmt.Errorf("%s: put: k=%x, %w", c.logPrefix, k, err)
+			}
+		}
+		return nil
+	}
+
+	tableReader := &currentTableReader{db, table}
+	for h.Len() > 0 {
+		if err := libcommon.Stopped(args.Quit); err != nil {
+			return err
+		}
+		e := heap.Pop(h).(heapElem)
+		if err := loadFunc(e.k, e.v, tableReader, loadNext); err != nil {
+			return err
+		}
+		k, v, err := providers[e.idx].next()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: reading temp file: %w", c.logPrefix, err)
+		}
+		heap.Push(h, heapElem{k, v, e.idx})
+	}
+	return nil
+}
+
+// Close - removes temp files and releases the lease, can be called many times
+func (c *Collector) Close() {
+	var total int64
+	for _, f := range c.files {
+		if info, err := f.Stat(); err == nil {
+			total += info.Size()
+		}
+		f.Close()
+		os.Remove(f.Name())
+	}
+	if total > 0 {
+		log.Info(fmt.Sprintf("[%s] etl: temp files removed", c.logPrefix), "total size", datasize.ByteSize(total).HumanReadable())
+	}
+	c.files, c.entries, c.size = nil, nil, 0
+	c.lease.Release()
+}
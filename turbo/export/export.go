@@ -0,0 +1,184 @@
+// Package export streams canonical blocks together with periodic state commitments, so that offsite backups of the
+// node can be continuously validated against it. Every frame carries a checksum of its own content and a rolling
+// checksum of all block hashes exported in the stream, see Verifier for the checks done on the receiving side.
+// Frames are RLP-encoded, SSZ encoding is not supported.
+package export
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/interfaces"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/rlp"
+)
+
+const (
+	KindBlock      uint8 = 0 // Payload is RLP of the block
+	KindCommitment uint8 = 1 // Root is state root after the block, Chain is rolling checksum up to the block
+)
+
+const (
+	DefaultCommitmentInterval = 1_000
+	batchSize                 = 1_000 // max blocks read in one db transaction
+	pollInterval              = 3 * time.Second
+)
+
+// Frame - one message of the export stream
+type Frame struct {
+	Kind     uint8
+	Number   uint64
+	Hash     common.Hash
+	Payload  []byte
+	Root     common.Hash
+	Chain    common.Hash
+	Checksum common.Hash // keccak256 of RLP of the frame with empty checksum
+}
+
+func (f *Frame) checksum() (common.Hash, error) {
+	c := *f
+	c.Checksum = common.Hash{}
+	data, err := rlp.EncodeToBytes(&c)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(data), nil
+}
+
+func DecodeFrame(data []byte) (*Frame, error) {
+	f := &Frame{}
+	if err := rlp.DecodeBytes(data, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Request - parameters of the export stream. Stream starts at block From, emits commitment frame after every block
+// divisible by CommitmentInterval, and stays Confirmations blocks behind the executed head, to not export blocks
+// which are likely to be unwound.
+type Request struct {
+	From               uint64
+	CommitmentInterval uint64
+	Confirmations      uint64
+}
+
+func DecodeRequest(data []byte) (*Request, error) {
+	r := &Request{}
+	if err := rlp.DecodeBytes(data, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// NextChain - rolling checksum of exported block hashes: chain(n) = keccak256(chain(n-1) ++ hash(n)), chain before the
+// first block of the stream is empty hash
+func NextChain(chain common.Hash, blockHash common.Hash) common.Hash {
+	return crypto.Keccak256Hash(chain[:], blockHash[:])
+}
+
+type Exporter struct {
+	db          kv.RoDB
+	blockReader interfaces.FullBlockReader
+}
+
+func NewExporter(db kv.RoDB, blockReader interfaces.FullBlockReader) *Exporter {
+	return &Exporter{db: db, blockReader: blockReader}
+}
+
+type exportState struct {
+	next     uint64
+	lastHash common.Hash
+	chain    common.Hash
+}
+
+// Export - sends frames until context is cancelled, send fails, or canonical chain is unwound below already exported
+// block. Blocks are exported only after their execution, so the state root of commitment frames is verified by the node.
+func (e *Exporter) Export(ctx context.Context, req *Request, send func(*Frame) error) error {
+	if req.CommitmentInterval == 0 {
+		req.CommitmentInterval = DefaultCommitmentInterval
+	}
+	s := &exportState{next: req.From}
+	for {
+		sent, err := e.exportBatch(ctx, req, s, send)
+		if err != nil {
+			return err
+		}
+		if sent > 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (e *Exporter) exportBatch(ctx context.Context, req *Request, s *exportState, send func(*Frame) error) (int, error) {
+	tx, err := e.db.BeginRo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	executed, err := stages.GetStageProgress(tx, stages.Finish)
+	if err != nil {
+		return 0, err
+	}
+	if executed < req.Confirmations {
+		return 0, nil
+	}
+	to := executed - req.Confirmations
+	sent := 0
+	for ; s.next <= to && sent < batchSize; s.next++ {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+		hash, err := rawdb.ReadCanonicalHash(tx, s.next)
+		if err != nil {
+			return sent, err
+		}
+		if hash == (common.Hash{}) {
+			return sent, fmt.Errorf("canonical block %d not found", s.next)
+		}
+		block, _, err := e.blockReader.BlockWithSenders(ctx, tx, hash, s.next)
+		if err != nil {
+			return sent, err
+		}
+		if block == nil {
+			return sent, fmt.Errorf("block %d not found", s.next)
+		}
+		if s.lastHash != (common.Hash{}) && block.ParentHash() != s.lastHash {
+			return sent, fmt.Errorf("canonical chain was unwound below exported block %d, restart export", s.next-1)
+		}
+		payload, err := rlp.EncodeToBytes(block)
+		if err != nil {
+			return sent, err
+		}
+		s.chain = NextChain(s.chain, hash)
+		s.lastHash = hash
+		if err := sendFrame(send, &Frame{Kind: KindBlock, Number: s.next, Hash: hash, Payload: payload}); err != nil {
+			return sent, err
+		}
+		if s.next%req.CommitmentInterval == 0 {
+			if err := sendFrame(send, &Frame{Kind: KindCommitment, Number: s.next, Hash: hash, Root: block.Root(), Chain: s.chain}); err != nil {
+				return sent, err
+			}
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func sendFrame(send func(*Frame) error, f *Frame) error {
+	checksum, err := f.checksum()
+	if err != nil {
+		return err
+	}
+	f.Checksum = checksum
+	return send(f)
+}
@@ -0,0 +1,75 @@
+package export_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/export"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportVerify(t *testing.T) {
+	m := stages.Mock(t)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 5, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+	}, false)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var frames []*export.Frame
+	err = export.NewExporter(m.DB, snapshotsync.NewBlockReader()).Export(ctx, &export.Request{From: 1, CommitmentInterval: 2, Confirmations: 1}, func(f *export.Frame) error {
+		data, err := rlp.EncodeToBytes(f)
+		require.NoError(t, err)
+		decoded, err := export.DecodeFrame(data)
+		require.NoError(t, err)
+		frames = append(frames, decoded)
+		if f.Number == 4 {
+			cancel()
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	// blocks 1..4, commitments after 2 and 4
+	require.Equal(t, 6, len(frames))
+	require.Equal(t, export.KindCommitment, frames[5].Kind)
+	require.Equal(t, chain.Blocks[3].Root(), frames[5].Root)
+
+	verifier := export.NewVerifier(m.DB)
+	for _, f := range frames {
+		require.NoError(t, verifier.Verify(context.Background(), f))
+	}
+	require.Equal(t, uint64(4), verifier.Blocks)
+	require.Equal(t, uint64(6), verifier.Verified)
+
+	// backup which has only genesis
+	backup := memdb.NewTestDB(t)
+	tx, err := backup.BeginRw(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, rawdb.WriteCanonicalHash(tx, m.Genesis.Hash(), 0))
+	require.NoError(t, tx.Commit())
+	verifier = export.NewVerifier(backup)
+	for _, f := range frames {
+		require.NoError(t, verifier.Verify(context.Background(), f))
+	}
+	require.Equal(t, uint64(4), verifier.Missing)
+
+	// corrupted payload
+	corrupted := *frames[0]
+	corrupted.Payload = append([]byte{}, corrupted.Payload...)
+	corrupted.Payload[len(corrupted.Payload)-1]++
+	require.Error(t, export.NewVerifier(nil).Verify(context.Background(), &corrupted))
+
+	// gap in the stream
+	verifier = export.NewVerifier(nil)
+	require.NoError(t, verifier.Verify(context.Background(), frames[0]))
+	require.Error(t, verifier.Verify(context.Background(), frames[3])) // block 3
+}
@@ -0,0 +1,118 @@
+package export
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rlp"
+)
+
+// Verifier - checks frames of the export stream: checksums, integrity of blocks, continuity of the chain and rolling
+// checksum at commitments. If backup database is given, exported blocks and commitments are compared with it.
+// Blocks which backup doesn't have yet are counted in Missing, backups are allowed to lag behind the node.
+type Verifier struct {
+	backup kv.RoDB
+
+	started  bool
+	last     *types.Header
+	chain    common.Hash
+	Blocks   uint64
+	Verified uint64 // blocks and commitments found in backup and matching it
+	Missing  uint64
+}
+
+func NewVerifier(backup kv.RoDB) *Verifier {
+	return &Verifier{backup: backup}
+}
+
+func (v *Verifier) Verify(ctx context.Context, f *Frame) error {
+	checksum, err := f.checksum()
+	if err != nil {
+		return err
+	}
+	if checksum != f.Checksum {
+		return fmt.Errorf("frame %d: checksum mismatch, expected %x, got %x", f.Number, checksum, f.Checksum)
+	}
+	switch f.Kind {
+	case KindBlock:
+		return v.verifyBlock(ctx, f)
+	case KindCommitment:
+		return v.verifyCommitment(ctx, f)
+	default:
+		return fmt.Errorf("frame %d: unknown kind %d", f.Number, f.Kind)
+	}
+}
+
+func (v *Verifier) verifyBlock(ctx context.Context, f *Frame) error {
+	block := &types.Block{}
+	if err := rlp.DecodeBytes(f.Payload, block); err != nil {
+		return fmt.Errorf("block %d: %w", f.Number, err)
+	}
+	header := block.Header()
+	if header.Number.Uint64() != f.Number || header.Hash() != f.Hash {
+		return fmt.Errorf("block %d: number or hash doesn't match frame", f.Number)
+	}
+	if txHash := types.DeriveSha(block.Transactions()); txHash != header.TxHash {
+		return fmt.Errorf("block %d: transactions root mismatch, header %x, computed %x", f.Number, header.TxHash, txHash)
+	}
+	if uncleHash := types.CalcUncleHash(block.Uncles()); uncleHash != header.UncleHash {
+		return fmt.Errorf("block %d: uncles hash mismatch, header %x, computed %x", f.Number, header.UncleHash, uncleHash)
+	}
+	if v.started {
+		if f.Number != v.last.Number.Uint64()+1 || header.ParentHash != v.last.Hash() {
+			return fmt.Errorf("block %d: doesn't follow block %d %x", f.Number, v.last.Number.Uint64(), v.last.Hash())
+		}
+	}
+	v.started = true
+	v.last = header
+	v.chain = NextChain(v.chain, f.Hash)
+	v.Blocks++
+	if v.backup == nil {
+		return nil
+	}
+	return v.backup.View(ctx, func(tx kv.Tx) error {
+		hash, err := rawdb.ReadCanonicalHash(tx, f.Number)
+		if err != nil {
+			return err
+		}
+		if hash == (common.Hash{}) {
+			v.Missing++
+			return nil
+		}
+		if hash != f.Hash {
+			return fmt.Errorf("block %d: backup has canonical block %x, node has %x", f.Number, hash, f.Hash)
+		}
+		v.Verified++
+		return nil
+	})
+}
+
+func (v *Verifier) verifyCommitment(ctx context.Context, f *Frame) error {
+	if !v.started || v.last.Number.Uint64() != f.Number || v.last.Hash() != f.Hash {
+		return fmt.Errorf("commitment %d: doesn't follow its block", f.Number)
+	}
+	if f.Root != v.last.Root {
+		return fmt.Errorf("commitment %d: state root %x doesn't match block header %x", f.Number, f.Root, v.last.Root)
+	}
+	if f.Chain != v.chain {
+		return fmt.Errorf("commitment %d: rolling checksum mismatch, node %x, received blocks %x", f.Number, f.Chain, v.chain)
+	}
+	if v.backup == nil {
+		return nil
+	}
+	return v.backup.View(ctx, func(tx kv.Tx) error {
+		header := rawdb.ReadHeader(tx, f.Hash, f.Number)
+		if header == nil {
+			return nil // already counted as missing block
+		}
+		if header.Root != f.Root {
+			return fmt.Errorf("commitment %d: backup has state root %x, node has %x", f.Number, header.Root, f.Root)
+		}
+		v.Verified++
+		return nil
+	})
+}
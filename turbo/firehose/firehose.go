@@ -0,0 +1,190 @@
+// Package firehose - stream of executed blocks for downstream indexers: block, receipts, call traces and state diffs of
+// every canonical block in order, and undo messages on reorgs. Messages are delivered to a Sink at least once, every
+// message carries a resume token, see README.md.
+package firehose
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ledgerwatch/erigon-lib/common/length"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/statediff"
+)
+
+// Kinds of Message
+const (
+	BlockMessage uint8 = iota // block became canonical and is executed
+	UndoMessage               // blocks after Number are not canonical anymore, the next block message follows Number
+)
+
+// Token - resume token: the last block delivered to the sink. Its string form is "number:hash".
+type Token struct {
+	Number uint64
+	Hash   common.Hash
+}
+
+func (t Token) String() string {
+	return fmt.Sprintf("%d:%x", t.Number, t.Hash)
+}
+
+// ParseToken - inverse of Token.String
+func ParseToken(s string) (Token, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return Token{}, fmt.Errorf("resume token %q is not number:hash", s)
+	}
+	n, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return Token{}, fmt.Errorf("resume token %q: %w", s, err)
+	}
+	h := common.FromHex(parts[1])
+	if len(h) != length.Hash {
+		return Token{}, fmt.Errorf("resume token %q: wrong hash", s)
+	}
+	return Token{Number: n, Hash: common.BytesToHash(h)}, nil
+}
+
+// Call - account which appeared in call traces of the block, as sender (From) or recipient (To) of a call
+type Call struct {
+	Address common.Address
+	From    bool
+	To      bool
+}
+
+// Message - one message of the stream, encoded by RLP. Undo messages have only Kind, Number and Hash - the new head.
+// Header, Body and Receipts are RLP in the consensus encoding of types.Header, types.Body and types.Receipts.
+type Message struct {
+	Kind       uint8
+	Number     uint64
+	Hash       common.Hash
+	Header     []byte
+	Body       []byte
+	Receipts   []byte
+	Calls      []Call
+	StateDiffs []*statediff.Tx // one per transaction, in order
+}
+
+// Token - resume token of the stream after this message
+func (m *Message) Token() Token {
+	return Token{Number: m.Number, Hash: m.Hash}
+}
+
+// Block - decoded Header and Body
+func (m *Message) Block() (*types.Block, error) {
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(m.Header, header); err != nil {
+		return nil, fmt.Errorf("header of block %d: %w", m.Number, err)
+	}
+	body := new(types.Body)
+	if err := rlp.DecodeBytes(m.Body, body); err != nil {
+		return nil, fmt.Errorf("body of block %d: %w", m.Number, err)
+	}
+	return types.NewBlockFromStorage(m.Hash, header, body.Transactions, body.Uncles), nil
+}
+
+// DecodeReceipts - decoded Receipts, only consensus fields are set
+func (m *Message) DecodeReceipts() (types.Receipts, error) {
+	var receipts types.Receipts
+	if err := rlp.DecodeBytes(m.Receipts, &receipts); err != nil {
+		return nil, fmt.Errorf("receipts of block %d: %w", m.Number, err)
+	}
+	return receipts, nil
+}
+
+// NewUndo - message which moves head of the stream back to canonical block number
+func NewUndo(tx kv.Tx, number uint64) (*Message, error) {
+	hash, err := rawdb.ReadCanonicalHash(tx, number)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Kind: UndoMessage, Number: number, Hash: hash}, nil
+}
+
+// NewBlock - message of executed canonical block. State diffs are read from the StateDiffs stage when it stored them
+// (diffsStored), otherwise they are computed by re-execution, which needs history of the block's parent.
+func NewBlock(ctx context.Context, tx kv.Tx, chainConfig *params.ChainConfig, block *types.Block, senders []common.Address, diffsStored bool) (*Message, error) {
+	number := block.NumberU64()
+	msg := &Message{Kind: BlockMessage, Number: number, Hash: block.Hash()}
+	var err error
+	if msg.Header, err = rlp.EncodeToBytes(block.Header()); err != nil {
+		return nil, err
+	}
+	if msg.Body, err = rlp.EncodeToBytes(block.Body()); err != nil {
+		return nil, err
+	}
+	receipts := rawdb.ReadReceipts(tx, block, senders)
+	if receipts == nil && len(block.Transactions()) > 0 {
+		return nil, fmt.Errorf("receipts of block %d not found", number)
+	}
+	if msg.Receipts, err = rlp.EncodeToBytes(receipts); err != nil {
+		return nil, err
+	}
+	if msg.Calls, err = readCalls(tx, number); err != nil {
+		return nil, err
+	}
+	if len(block.Transactions()) == 0 {
+		return msg, nil
+	}
+	if diffsStored {
+		msg.StateDiffs, err = statediff.ReadBlock(tx, number)
+	} else {
+		msg.StateDiffs, err = statediff.ComputeBlock(ctx, tx, chainConfig, block)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// readCalls - entries of kv.CallTraceSet of the block
+func readCalls(tx kv.Tx, number uint64) ([]Call, error) {
+	c, err := tx.CursorDupSort(kv.CallTraceSet)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	var calls []Call
+	key := dbutils.EncodeBlockNumber(number)
+	for k, v, err := c.SeekExact(key); k != nil; k, v, err = c.NextDup() {
+		if err != nil {
+			return nil, err
+		}
+		if len(v) != length.Addr+1 {
+			return nil, fmt.Errorf("wrong size of value in CallTraceSet: %x (size %d)", v, len(v))
+		}
+		calls = append(calls, Call{
+			Address: common.BytesToAddress(v[:length.Addr]),
+			From:    v[length.Addr]&1 > 0,
+			To:      v[length.Addr]&2 > 0,
+		})
+	}
+	return calls, nil
+}
+
+// encodeToken - token as stored by sinks which keep it next to the data
+func encodeToken(t Token) []byte {
+	b := make([]byte, 8+length.Hash)
+	binary.BigEndian.PutUint64(b, t.Number)
+	copy(b[8:], t.Hash[:])
+	return b
+}
+
+func decodeToken(b []byte) (*Token, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if len(b) != 8+length.Hash {
+		return nil, fmt.Errorf("wrong size of resume token: %d", len(b))
+	}
+	return &Token{Number: binary.BigEndian.Uint64(b), Hash: common.BytesToHash(b[8:])}, nil
+}
@@ -0,0 +1,185 @@
+package firehose_test
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/firehose"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestToken(t *testing.T) {
+	token := firehose.Token{Number: 42, Hash: common.Hash{1, 2, 3}}
+	parsed, err := firehose.ParseToken(token.String())
+	require.NoError(t, err)
+	require.Equal(t, token, parsed)
+	_, err = firehose.ParseToken("42")
+	require.Error(t, err)
+	_, err = firehose.ParseToken("42:0x01")
+	require.Error(t, err)
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "firehose.bin")
+	msgs := []*firehose.Message{
+		{Kind: firehose.BlockMessage, Number: 1, Hash: common.Hash{1}, Header: []byte{0xc0}, Calls: []firehose.Call{{Address: common.Address{1}, From: true}}},
+		{Kind: firehose.BlockMessage, Number: 2, Hash: common.Hash{2}, Header: []byte{0xc0}},
+		{Kind: firehose.UndoMessage, Number: 1, Hash: common.Hash{1}},
+	}
+
+	sink, err := firehose.OpenSink(path)
+	require.NoError(t, err)
+	token, err := sink.Resume()
+	require.NoError(t, err)
+	require.Nil(t, token)
+	require.NoError(t, sink.Send(msgs[0]))
+	require.NoError(t, sink.Send(msgs[1]))
+	require.NoError(t, sink.Close())
+
+	// message partially written by a crash is cut off
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{100, 0xc0})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	sink, err = firehose.OpenSink("file://" + path)
+	require.NoError(t, err)
+	token, err = sink.Resume()
+	require.NoError(t, err)
+	require.Equal(t, &firehose.Token{Number: 2, Hash: common.Hash{2}}, token)
+	require.NoError(t, sink.Send(msgs[2]))
+	require.NoError(t, sink.Close())
+
+	f, err = os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	r := firehose.NewReader(f)
+	for _, want := range msgs {
+		got, err := r.Read()
+		require.NoError(t, err)
+		require.Equal(t, want.Token(), got.Token())
+		require.Equal(t, want.Kind, got.Kind)
+		require.Equal(t, len(want.Calls), len(got.Calls))
+	}
+	_, err = r.Read()
+	require.Error(t, err)
+
+	_, err = firehose.OpenSink("kafka://localhost:9092")
+	require.Error(t, err)
+}
+
+type testServer struct {
+	token *firehose.Token
+	msgs  []*firehose.Message
+}
+
+func (s *testServer) Resume(ctx context.Context) (*firehose.Token, error) {
+	return s.token, nil
+}
+
+func (s *testServer) Push(ctx context.Context, msgs []*firehose.Message) error {
+	s.msgs = append(s.msgs, msgs...)
+	t := msgs[len(msgs)-1].Token()
+	s.token = &t
+	return nil
+}
+
+func TestGrpcSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	srv := &testServer{}
+	firehose.RegisterServer(server, srv)
+	go server.Serve(listener) //nolint:errcheck
+	defer server.Stop()
+
+	sink, err := firehose.OpenSink("grpc://" + listener.Addr().String())
+	require.NoError(t, err)
+	defer sink.Close()
+	token, err := sink.Resume()
+	require.NoError(t, err)
+	require.Nil(t, token)
+
+	require.NoError(t, sink.Send(&firehose.Message{Number: 1, Hash: common.Hash{1}}))
+	require.NoError(t, sink.Send(&firehose.Message{Number: 2, Hash: common.Hash{2}}))
+	require.Empty(t, srv.msgs) // buffered until flush
+	require.NoError(t, sink.Flush())
+	require.Len(t, srv.msgs, 2)
+
+	token, err = sink.Resume()
+	require.NoError(t, err)
+	require.Equal(t, &firehose.Token{Number: 2, Hash: common.Hash{2}}, token)
+}
+
+func TestNewBlock(t *testing.T) {
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		gspec  = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{addr: {Balance: big.NewInt(params.Ether)}},
+		}
+		signer = types.LatestSigner(gspec.Config)
+		to     = common.HexToAddress("0x11")
+	)
+	m := stages.MockWithGenesis(t, gspec, key)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 2, func(i int, b *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(addr), to, uint256.NewInt(1000), 21000, uint256.NewInt(params.GWei), nil), *signer, key)
+		require.NoError(t, err)
+		b.AddTx(tx)
+	}, false)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	tx, err := m.DB.BeginRo(m.Ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	block, senders, err := rawdb.ReadBlockWithSenders(tx, chain.Blocks[1].Hash(), 2)
+	require.NoError(t, err)
+	msg, err := firehose.NewBlock(m.Ctx, tx, m.ChainConfig, block, senders, false)
+	require.NoError(t, err)
+
+	// message survives encoding of the stream
+	enc, err := rlp.EncodeToBytes(msg)
+	require.NoError(t, err)
+	msg = new(firehose.Message)
+	require.NoError(t, rlp.DecodeBytes(enc, msg))
+
+	require.Equal(t, firehose.Token{Number: 2, Hash: block.Hash()}, msg.Token())
+	decoded, err := msg.Block()
+	require.NoError(t, err)
+	require.Equal(t, block.Hash(), decoded.Header().Hash())
+	require.Equal(t, block.Transactions()[0].Hash(), decoded.Transactions()[0].Hash())
+	receipts, err := msg.DecodeReceipts()
+	require.NoError(t, err)
+	require.Len(t, receipts, 1)
+	require.Equal(t, types.ReceiptStatusSuccessful, receipts[0].Status)
+	require.Contains(t, msg.Calls, firehose.Call{Address: addr, From: true})
+	require.Contains(t, msg.Calls, firehose.Call{Address: to, To: true})
+
+	require.Len(t, msg.StateDiffs, 1)
+	var recipient bool
+	for _, acc := range msg.StateDiffs[0].Accounts {
+		if acc.Address == to {
+			recipient = true
+			require.Equal(t, uint64(1000), acc.FromBalance.Uint64())
+			require.Equal(t, uint64(2000), acc.ToBalance.Uint64())
+		}
+	}
+	require.True(t, recipient)
+}
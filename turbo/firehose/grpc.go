@@ -0,0 +1,138 @@
+package firehose
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	"github.com/ledgerwatch/erigon/rlp"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Server - receiver of the stream, service "firehose.v1.Firehose", messages are protobuf well-known types:
+// rpc Resume(google.protobuf.Empty) returns (BytesValue) - token, 8 bytes of number and 32 of hash, empty - no token;
+// rpc Push(BytesValue) returns (google.protobuf.Empty) - RLP list of messages, in order.
+// Push must return only after messages are stored, then it's acknowledged to the node; on error the node sends them
+// again. Resume is called once when the node starts, to continue the stream from the server's position.
+type Server interface {
+	Resume(ctx context.Context) (*Token, error)
+	Push(ctx context.Context, msgs []*Message) error
+}
+
+const serviceName = "firehose.v1.Firehose"
+
+// Firehose_ServiceDesc - hand-written descriptor of "firehose.v1.Firehose" service
+var Firehose_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Resume",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(emptypb.Empty)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				call := func(ctx context.Context, req interface{}) (interface{}, error) {
+					t, err := srv.(Server).Resume(ctx)
+					if err != nil || t == nil {
+						return &wrapperspb.BytesValue{}, err
+					}
+					return wrapperspb.Bytes(encodeToken(*t)), nil
+				}
+				if interceptor == nil {
+					return call(ctx, in)
+				}
+				return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/Resume"}, call)
+			},
+		},
+		{
+			MethodName: "Push",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(wrapperspb.BytesValue)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				call := func(ctx context.Context, req interface{}) (interface{}, error) {
+					var msgs []*Message
+					if err := rlp.DecodeBytes(req.(*wrapperspb.BytesValue).GetValue(), &msgs); err != nil {
+						return nil, err
+					}
+					if err := srv.(Server).Push(ctx, msgs); err != nil {
+						return nil, err
+					}
+					return &emptypb.Empty{}, nil
+				}
+				if interceptor == nil {
+					return call(ctx, in)
+				}
+				return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/Push"}, call)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// RegisterServer serves "firehose.v1.Firehose" service by srv
+func RegisterServer(s *grpc.Server, srv Server) {
+	s.RegisterService(&Firehose_ServiceDesc, srv)
+}
+
+// maxPushSize - messages buffered by grpc sink are pushed without waiting for Flush when they reach this size
+const maxPushSize = 16 << 20
+
+// grpcSink - client of "firehose.v1.Firehose" service, sends messages in batches by Push
+type grpcSink struct {
+	conn *grpc.ClientConn
+	msgs []*Message
+	size int
+}
+
+// openGrpcSink - target is "grpc://host:port", without TLS
+func openGrpcSink(target string) (Sink, error) {
+	conn, err := grpcutil.Connect(nil, strings.TrimPrefix(target, "grpc://"))
+	if err != nil {
+		return nil, err
+	}
+	return &grpcSink{conn: conn}, nil
+}
+
+func (s *grpcSink) Send(msg *Message) error {
+	s.msgs = append(s.msgs, msg)
+	s.size += len(msg.Header) + len(msg.Body) + len(msg.Receipts)
+	if s.size >= maxPushSize {
+		return s.Flush()
+	}
+	return nil
+}
+
+func (s *grpcSink) Flush() error {
+	if len(s.msgs) == 0 {
+		return nil
+	}
+	// batch is dropped on error too, the stage sends the messages again from the last successful flush
+	defer func() { s.msgs, s.size = s.msgs[:0], 0 }()
+	v, err := rlp.EncodeToBytes(s.msgs)
+	if err != nil {
+		return err
+	}
+	return s.conn.Invoke(context.Background(), "/"+serviceName+"/Push", wrapperspb.Bytes(v), new(emptypb.Empty))
+}
+
+func (s *grpcSink) Resume() (*Token, error) {
+	out := new(wrapperspb.BytesValue)
+	if err := s.conn.Invoke(context.Background(), "/"+serviceName+"/Resume", &emptypb.Empty{}, out); err != nil {
+		return nil, err
+	}
+	return decodeToken(out.GetValue())
+}
+
+func (s *grpcSink) Close() error {
+	if err := s.Flush(); err != nil {
+		s.conn.Close()
+		return err
+	}
+	return s.conn.Close()
+}
@@ -0,0 +1,202 @@
+package firehose
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ledgerwatch/erigon/rlp"
+)
+
+// Sink - destination of the stream. Delivery is at least once: Firehose stage saves its progress only after Flush
+// returned, so messages after the last flush are sent again when the node restarts or the sink fails. After an error
+// of Send or Flush the sink may drop messages sent since the last successful Flush.
+type Sink interface {
+	// Send - may buffer the message until Flush
+	Send(msg *Message) error
+	// Flush - returns when all sent messages are delivered
+	Flush() error
+	// Resume - token of the last message the sink has, nil if it has none or doesn't keep it
+	Resume() (*Token, error)
+	Close() error
+}
+
+// Opener - opens sink by target, target is passed with its "scheme://" prefix
+type Opener func(target string) (Sink, error)
+
+var (
+	openersLock sync.RWMutex
+	openers     = map[string]Opener{
+		"file": openFileSink,
+		"grpc": openGrpcSink,
+	}
+)
+
+// RegisterSink makes sinks of given scheme available for --firehose.sink, for example Kafka or NATS clients which are
+// linked by the embedder. Built-in schemes are "file" and "grpc".
+func RegisterSink(scheme string, open Opener) {
+	openersLock.Lock()
+	defer openersLock.Unlock()
+	openers[scheme] = open
+}
+
+// Schemes - registered schemes of sink targets
+func Schemes() []string {
+	openersLock.RLock()
+	defer openersLock.RUnlock()
+	schemes := make([]string, 0, len(openers))
+	for scheme := range openers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// OpenSink - target is "scheme://...", target without scheme is a path of the file
+func OpenSink(target string) (Sink, error) {
+	scheme := "file"
+	if i := strings.Index(target, "://"); i >= 0 {
+		scheme = target[:i]
+	} else {
+		target = "file://" + target
+	}
+	openersLock.RLock()
+	open, ok := openers[scheme]
+	openersLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown firehose sink %q, supported: %s", scheme, strings.Join(Schemes(), ", "))
+	}
+	return open(target)
+}
+
+// maxMessageSize - limit of one message of the file, one block with its receipts and state diffs
+const maxMessageSize = 1 << 30
+
+// fileSink - appends length-delimited messages (uvarint size, then RLP) to the file. Partially written message at the
+// end of the file, left by a crash, is cut off on open.
+type fileSink struct {
+	f     *os.File
+	buf   *bufio.Writer
+	last  *Token
+	frame [binary.MaxVarintLen64]byte
+}
+
+func openFileSink(target string) (Sink, error) {
+	path := strings.TrimPrefix(target, "file://")
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	last, size, err := scanFile(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("firehose file %s: %w", path, err)
+	}
+	if err = f.Truncate(size); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err = f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileSink{f: f, buf: bufio.NewWriterSize(f, 1<<20), last: last}, nil
+}
+
+// scanFile - token of the last complete message and size of the file up to its end
+func scanFile(f *os.File) (*Token, int64, error) {
+	r := NewReader(f)
+	var last *Token
+	for {
+		msg, err := r.Read()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return last, r.offset, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		t := msg.Token()
+		last = &t
+	}
+}
+
+func (s *fileSink) Send(msg *Message) error {
+	v, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		return err
+	}
+	n := binary.PutUvarint(s.frame[:], uint64(len(v)))
+	if _, err = s.buf.Write(s.frame[:n]); err != nil {
+		return err
+	}
+	if _, err = s.buf.Write(v); err != nil {
+		return err
+	}
+	t := msg.Token()
+	s.last = &t
+	return nil
+}
+
+func (s *fileSink) Flush() error {
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func (s *fileSink) Resume() (*Token, error) {
+	return s.last, nil
+}
+
+func (s *fileSink) Close() error {
+	if err := s.Flush(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+// Reader - reads messages of the file written by "file" sink
+type Reader struct {
+	r      *bufio.Reader
+	offset int64 // end of the last complete message
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read - next message, io.EOF at the end of the file, io.ErrUnexpectedEOF if the last message is incomplete
+func (r *Reader) Read() (*Message, error) {
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("message of firehose is too big: %d", size)
+	}
+	v := make([]byte, size)
+	if _, err = io.ReadFull(r.r, v); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	msg := new(Message)
+	if err = rlp.DecodeBytes(v, msg); err != nil {
+		return nil, err
+	}
+	r.offset += int64(uvarintSize(size)) + int64(size)
+	return msg, nil
+}
+
+func uvarintSize(v uint64) int {
+	var b [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(b[:], v)
+}
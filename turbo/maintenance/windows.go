@@ -0,0 +1,124 @@
+// Package maintenance - time of day windows during which heavy background work (pruning, snapshot merges,
+// catching up of index stages) is allowed, so it doesn't compete with RPC serving at busy hours.
+package maintenance
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window - period between From and To (time since midnight, local time).
+// Window with To < From wraps midnight: "22:00-06:00".
+type Window struct {
+	From, To time.Duration
+}
+
+// ParseWindow parses window "HH:MM-HH:MM", shared by all time of day settings
+func ParseWindow(s string) (Window, error) {
+	dash := strings.IndexByte(s, '-')
+	if dash < 0 {
+		return Window{}, fmt.Errorf("expected format HH:MM-HH:MM")
+	}
+	var w Window
+	var err error
+	if w.From, err = parseTimeOfDay(s[:dash]); err != nil {
+		return Window{}, err
+	}
+	if w.To, err = parseTimeOfDay(s[dash+1:]); err != nil {
+		return Window{}, err
+	}
+	if w.From == w.To {
+		return Window{}, fmt.Errorf("window is empty")
+	}
+	return w, nil
+}
+
+// Contains - whether moment now (local time) is inside of window
+func (w Window) Contains(now time.Time) bool {
+	return w.contains(sinceMidnight(now))
+}
+
+func (w Window) contains(sinceMidnight time.Duration) bool {
+	if w.From <= w.To {
+		return sinceMidnight >= w.From && sinceMidnight < w.To
+	}
+	return sinceMidnight >= w.From || sinceMidnight < w.To
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", int(w.From.Hours()), int(w.From.Minutes())%60, int(w.To.Hours()), int(w.To.Minutes())%60)
+}
+
+// Windows - heavy work is allowed inside of any of windows. No windows - allowed at any time.
+type Windows []Window
+
+// ParseWindows parses comma separated windows "HH:MM-HH:MM", for example "01:00-05:00,13:00-14:00"
+func ParseWindows(s string) (Windows, error) {
+	var windows Windows
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		w, err := ParseWindow(item)
+		if err != nil {
+			return nil, fmt.Errorf("maintenance window %q: %w", item, err)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("time of day %q: expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+// Allowed - whether heavy work is allowed at moment now
+func (ws Windows) Allowed(now time.Time) bool {
+	if len(ws) == 0 {
+		return true
+	}
+	at := sinceMidnight(now)
+	for _, w := range ws {
+		if w.contains(at) {
+			return true
+		}
+	}
+	return false
+}
+
+// UntilNext - time until start of the next window, 0 if heavy work is allowed now
+func (ws Windows) UntilNext(now time.Time) time.Duration {
+	if ws.Allowed(now) {
+		return 0
+	}
+	at := sinceMidnight(now)
+	next := 24 * time.Hour
+	for _, w := range ws {
+		d := w.From - at
+		if d < 0 {
+			d += 24 * time.Hour
+		}
+		if d < next {
+			next = d
+		}
+	}
+	return next
+}
+
+func (ws Windows) String() string {
+	items := make([]string, len(ws))
+	for i, w := range ws {
+		items[i] = w.String()
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,34 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindows(t *testing.T) {
+	windows, err := ParseWindows("22:00-06:00, 13:00-13:30")
+	require.NoError(t, err)
+	require.Equal(t, "22:00-06:00,13:00-13:30", windows.String())
+
+	at := func(hour, min int) time.Time { return time.Date(2022, 1, 1, hour, min, 0, 0, time.Local) }
+	require.True(t, windows.Allowed(at(23, 0)))
+	require.True(t, windows.Allowed(at(5, 59)))
+	require.False(t, windows.Allowed(at(6, 0)))
+	require.True(t, windows.Allowed(at(13, 15)))
+	require.False(t, windows.Allowed(at(13, 30)))
+
+	require.Equal(t, time.Duration(0), windows.UntilNext(at(1, 0)))
+	require.Equal(t, 3*time.Hour, windows.UntilNext(at(10, 0)))
+	require.Equal(t, 8*time.Hour+30*time.Minute, windows.UntilNext(at(13, 30)))
+
+	for _, bad := range []string{"22:00", "22:00-", "25:00-06:00", "06:00-06:00", "6-7"} {
+		_, err = ParseWindows(bad)
+		require.Error(t, err, bad)
+	}
+	windows, err = ParseWindows("")
+	require.NoError(t, err)
+	require.Empty(t, windows)
+	require.True(t, windows.Allowed(at(12, 0)))
+}
@@ -2,6 +2,10 @@
 package node
 
 import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/cmd/utils"
 	"github.com/ledgerwatch/erigon/eth"
@@ -40,6 +44,51 @@ func (eri *ErigonNode) run() {
 	// see cmd/geth/main.go#startNode for full implementation
 }
 
+// MultiNode runs nodes of several chains in one process, see --networks
+type MultiNode struct {
+	nodes []*ErigonNode
+}
+
+// NewMulti creates a node for every pair of configs, logger of each node is tagged with its chain name.
+func NewMulti(nodeConfigs []*node.Config, ethConfigs []*ethconfig.Config, logger log.Logger) (*MultiNode, error) {
+	m := &MultiNode{}
+	for i := range nodeConfigs {
+		chain := networkname.MainnetChainName
+		if ethConfigs[i].Genesis != nil && ethConfigs[i].Genesis.Config != nil && ethConfigs[i].Genesis.Config.ChainName != "" {
+			chain = ethConfigs[i].Genesis.Config.ChainName
+		}
+		n, err := New(nodeConfigs[i], ethConfigs[i], logger.New("network", chain))
+		if err != nil {
+			m.close()
+			return nil, fmt.Errorf("network %s: %w", chain, err)
+		}
+		m.nodes = append(m.nodes, n)
+	}
+	return m, nil
+}
+
+// Serve runs all nodes and blocks until all of them are stopped. Interrupt signal stops all nodes.
+func (m *MultiNode) Serve() error {
+	var wg sync.WaitGroup
+	for _, n := range m.nodes {
+		wg.Add(1)
+		go func(n *ErigonNode) {
+			defer wg.Done()
+			if err := n.Serve(); err != nil {
+				log.Error("error while serving an Erigon node", "err", err)
+			}
+		}(n)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (m *MultiNode) close() {
+	for _, n := range m.nodes {
+		n.stack.Close()
+	}
+}
+
 // Params contains optional parameters for creating a node.
 // * GitCommit is a commit from which then node was built.
 // * CustomBuckets is a `map[string]dbutils.TableCfgItem`, that contains bucket name and its properties.
@@ -80,12 +129,68 @@ func NewNodConfigUrfave(ctx *cli.Context) *node.Config {
 	return nodeConfig
 }
 func NewEthConfigUrfave(ctx *cli.Context, nodeConfig *node.Config) *ethconfig.Config {
-	ethConfig := &ethconfig.Defaults
+	ethConfig := ethconfig.Defaults.Copy() // every network of --networks has own config
 	utils.SetEthConfig(ctx, nodeConfig, ethConfig)
 	erigoncli.ApplyFlagsForEthConfig(ctx, ethConfig)
 	return ethConfig
 }
 
+// NewNetworkConfigsUrfave returns configs of all networks run by the process: the primary one first, then
+// additional chains of --networks. Every additional network inherits flags of the primary one, except chain
+// and datadir. N-th network listens p2p and private api on ports of the primary network shifted by N, and keeps
+// cold database of --tiering.cold.dir in its <chain> subdirectory.
+// Must be called after configs of the primary network are built, because it overrides flags of ctx.
+func NewNetworkConfigsUrfave(ctx *cli.Context, primary *node.Config, primaryEth *ethconfig.Config) ([]*node.Config, []*ethconfig.Config, error) {
+	networks, err := erigoncli.ParseNetworks(ctx.GlobalString(erigoncli.NetworksFlag.Name))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid --%s: %w", erigoncli.NetworksFlag.Name, err)
+	}
+	if len(networks) == 0 {
+		return []*node.Config{primary}, []*ethconfig.Config{primaryEth}, nil
+	}
+	// these flags can't be shared by chains
+	for _, name := range []string{utils.NetworkIdFlag.Name, utils.SentryAddrFlag.Name, utils.SnapshotSyncFlag.Name} {
+		if ctx.GlobalIsSet(name) {
+			return nil, nil, fmt.Errorf("--%s can't be used together with --%s", name, erigoncli.NetworksFlag.Name)
+		}
+	}
+	primaryChain := ctx.GlobalString(utils.ChainFlag.Name)
+	if primaryChain == "" {
+		primaryChain = networkname.MainnetChainName
+	}
+	nodeConfigs := []*node.Config{primary}
+	ethConfigs := []*ethconfig.Config{primaryEth}
+	for i, network := range networks {
+		if network.Chain == primaryChain {
+			return nil, nil, fmt.Errorf("network %s is already run by --%s", network.Chain, utils.ChainFlag.Name)
+		}
+		if network.DataDir == primary.DataDir {
+			return nil, nil, fmt.Errorf("network %s: datadir %s is used by --%s", network.Chain, network.DataDir, utils.ChainFlag.Name)
+		}
+		if err := ctx.GlobalSet(utils.ChainFlag.Name, network.Chain); err != nil {
+			return nil, nil, err
+		}
+		if err := ctx.GlobalSet(utils.DataDirFlag.Name, network.DataDir); err != nil {
+			return nil, nil, err
+		}
+		nodeConfig := NewNodConfigUrfave(ctx)
+		if nodeConfig.P2P.ListenAddr, err = erigoncli.ShiftPort(primary.P2P.ListenAddr, i+1); err != nil {
+			return nil, nil, fmt.Errorf("network %s: %w", network.Chain, err)
+		}
+		if nodeConfig.PrivateApiAddr, err = erigoncli.ShiftPort(primary.PrivateApiAddr, i+1); err != nil {
+			return nil, nil, fmt.Errorf("network %s: %w", network.Chain, err)
+		}
+		ethConfig := NewEthConfigUrfave(ctx, nodeConfig)
+		if ethConfig.TieringColdDir != "" {
+			// cold database belongs to chaindata of one node
+			ethConfig.TieringColdDir = filepath.Join(primaryEth.TieringColdDir, network.Chain)
+		}
+		nodeConfigs = append(nodeConfigs, nodeConfig)
+		ethConfigs = append(ethConfigs, ethConfig)
+	}
+	return nodeConfigs, ethConfigs, nil
+}
+
 // New creates a new `ErigonNode`.
 // * ctx - `*cli.Context` from the main function. Necessary to be able to configure the node based on the command-line flags
 // * sync - `stagedsync.StagedSync`, an instance of staged sync, setup just as needed.
@@ -0,0 +1,407 @@
+// Package reexec provides blocks together with everything needed to re-execute them in isolation:
+// header, transactions, senders and pre-state of all accounts/storage slots touched by execution.
+// It's intended for downstream fraud-proof systems (optimistic-rollup style validators).
+package reexec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/interfaces"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
+)
+
+// Block - self-contained re-executable block. RLP-encoded form is returned by gRPC API, use DecodeBlock to parse it.
+type Block struct {
+	Header       *types.Header
+	Transactions [][]byte // binary (EIP-2718) encoded
+	Senders      []common.Address
+	Uncles       []*types.Header
+	PreState     []*Account   // sorted by address
+	BlockHashes  []*BlockHash // ancestors accessed by BLOCKHASH opcode or consensus engine, sorted by number
+}
+
+// Account - state of account before block execution and its storage slots accessed by execution
+type Account struct {
+	Address     common.Address
+	Absent      bool // account didn't exist before block, other fields are empty
+	Nonce       uint64
+	Balance     uint256.Int
+	Incarnation uint64
+	CodeHash    common.Hash
+	Code        []byte
+	Storage     []*StorageSlot // sorted by key
+}
+
+type StorageSlot struct {
+	Key   common.Hash
+	Value []byte // empty - slot is not set
+}
+
+type BlockHash struct {
+	Number uint64
+	Hash   common.Hash
+}
+
+func DecodeBlock(data []byte) (*Block, error) {
+	b := &Block{}
+	if err := rlp.DecodeBytes(data, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Provider - Go API of re-executable blocks
+type Provider struct {
+	db          kv.RoDB
+	chainConfig *params.ChainConfig
+	engine      consensus.Engine
+	blockReader interfaces.FullBlockReader
+	history     state.HistorySnapshots
+}
+
+// NewProvider - history (can be nil) is read before database for blocks it covers
+func NewProvider(db kv.RoDB, chainConfig *params.ChainConfig, engine consensus.Engine, blockReader interfaces.FullBlockReader, history state.HistorySnapshots) *Provider {
+	return &Provider{db: db, chainConfig: chainConfig, engine: engine, blockReader: blockReader, history: history}
+}
+
+// Block - executes canonical block with given number on top of historical state and records everything it reads
+func (p *Provider) Block(ctx context.Context, blockNum uint64) (*Block, error) {
+	tx, err := p.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	return ReadBlock(ctx, tx, p.chainConfig, p.engine, p.blockReader, p.history, blockNum)
+}
+
+func ReadBlock(ctx context.Context, tx kv.Tx, chainConfig *params.ChainConfig, engine consensus.Engine, blockReader interfaces.FullBlockReader, history state.HistorySnapshots, blockNum uint64) (*Block, error) {
+	if blockNum == 0 {
+		return nil, fmt.Errorf("genesis block can't be re-executed")
+	}
+	hash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	if hash == (common.Hash{}) {
+		return nil, fmt.Errorf("canonical block %d not found", blockNum)
+	}
+	block, senders, err := blockReader.BlockWithSenders(ctx, tx, hash, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %d not found", blockNum)
+	}
+
+	hashes := map[uint64]common.Hash{}
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		h, _ := blockReader.Header(ctx, tx, hash, number)
+		if h != nil && number < blockNum {
+			hashes[number] = hash
+			if number > 0 {
+				hashes[number-1] = h.ParentHash
+			}
+		}
+		return h
+	}
+	reader := newRecordingReader(state.NewPlainState(tx, blockNum-1, history))
+	chain := chainReader{tx: tx, config: chainConfig, getHeader: getHeader}
+	contractHasTEVM := func(common.Hash) (bool, error) { return false, nil }
+	if _, err = core.ExecuteBlockEphemerally(chainConfig, &vm.Config{}, getHeader, engine, block, reader, state.NewNoopWriter(), epochReader{tx: tx}, chain, contractHasTEVM); err != nil {
+		return nil, fmt.Errorf("re-execution of block %d: %w", blockNum, err)
+	}
+
+	txs, err := types.MarshalTransactionsBinary(block.Transactions())
+	if err != nil {
+		return nil, err
+	}
+	res := &Block{
+		Header:       block.Header(),
+		Transactions: txs,
+		Senders:      senders,
+		Uncles:       block.Uncles(),
+		PreState:     reader.preState(),
+	}
+	for number, hash := range hashes {
+		res.BlockHashes = append(res.BlockHashes, &BlockHash{Number: number, Hash: hash})
+	}
+	sort.Slice(res.BlockHashes, func(i, j int) bool { return res.BlockHashes[i].Number < res.BlockHashes[j].Number })
+	return res, nil
+}
+
+// Execute - re-executes block in isolation, using nothing but its own data. Receipts root, bloom and gas used
+// are validated against header.
+func (b *Block) Execute(chainConfig *params.ChainConfig, engine consensus.Engine) (types.Receipts, error) {
+	txs, err := types.DecodeTransactions(b.Transactions)
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) != len(b.Senders) {
+		return nil, fmt.Errorf("amount of senders %d doesn't match amount of txs %d", len(b.Senders), len(txs))
+	}
+	for i := range txs {
+		txs[i].SetSender(b.Senders[i])
+	}
+	block := types.NewBlockFromStorage(b.Header.Hash(), b.Header, txs, b.Uncles)
+
+	// headers of ancestors are known only partially: number and parent hash, it's enough for BLOCKHASH opcode
+	hashes := make(map[uint64]common.Hash, len(b.BlockHashes))
+	for _, h := range b.BlockHashes {
+		hashes[h.Number] = h.Hash
+	}
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		if number == 0 || hashes[number] != hash {
+			return nil
+		}
+		parentHash, ok := hashes[number-1]
+		if !ok {
+			return nil
+		}
+		return &types.Header{Number: new(big.Int).SetUint64(number), ParentHash: parentHash}
+	}
+	chain := chainReader{config: chainConfig, getHeader: getHeader}
+	contractHasTEVM := func(common.Hash) (bool, error) { return false, nil }
+	return core.ExecuteBlockEphemerally(chainConfig, &vm.Config{}, getHeader, engine, block, newPreStateReader(b.PreState), state.NewNoopWriter(), nil, chain, contractHasTEVM)
+}
+
+// preStateReader - serves state from Block.PreState
+type preStateReader struct {
+	accounts map[common.Address]*Account
+}
+
+func newPreStateReader(preState []*Account) *preStateReader {
+	r := &preStateReader{accounts: make(map[common.Address]*Account, len(preState))}
+	for _, a := range preState {
+		r.accounts[a.Address] = a
+	}
+	return r
+}
+
+func (r *preStateReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	a, ok := r.accounts[address]
+	if !ok {
+		return nil, fmt.Errorf("account %x is not in pre-state", address)
+	}
+	if a.Absent {
+		return nil, nil
+	}
+	acc := accounts.NewAccount()
+	acc.Initialised = true
+	acc.Nonce, acc.Balance, acc.Incarnation, acc.CodeHash = a.Nonce, a.Balance, a.Incarnation, a.CodeHash
+	return &acc, nil
+}
+
+func (r *preStateReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	a, ok := r.accounts[address]
+	if !ok {
+		return nil, fmt.Errorf("account %x is not in pre-state", address)
+	}
+	i := sort.Search(len(a.Storage), func(i int) bool { return bytes.Compare(a.Storage[i].Key[:], key[:]) >= 0 })
+	if i == len(a.Storage) || a.Storage[i].Key != *key {
+		return nil, fmt.Errorf("storage %x of account %x is not in pre-state", *key, address)
+	}
+	return a.Storage[i].Value, nil
+}
+
+func (r *preStateReader) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	a, ok := r.accounts[address]
+	if !ok || a.CodeHash != codeHash {
+		return nil, fmt.Errorf("code %x of account %x is not in pre-state", codeHash, address)
+	}
+	return a.Code, nil
+}
+
+func (r *preStateReader) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	code, err := r.ReadAccountCode(address, incarnation, codeHash)
+	return len(code), err
+}
+
+func (r *preStateReader) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	if a, ok := r.accounts[address]; ok {
+		return a.Incarnation, nil
+	}
+	return 0, nil
+}
+
+// recordingReader - remembers first value of every account, code and storage slot read from underlying reader,
+// which is pre-state of the block
+type recordingReader struct {
+	r        state.StateReader
+	accounts map[common.Address]*Account
+	storage  map[common.Address]map[common.Hash][]byte
+}
+
+func newRecordingReader(r state.StateReader) *recordingReader {
+	return &recordingReader{
+		r:        r,
+		accounts: map[common.Address]*Account{},
+		storage:  map[common.Address]map[common.Hash][]byte{},
+	}
+}
+
+func (r *recordingReader) account(address common.Address) (*Account, error) {
+	if a, ok := r.accounts[address]; ok {
+		return a, nil
+	}
+	acc, err := r.r.ReadAccountData(address)
+	if err != nil {
+		return nil, err
+	}
+	a := &Account{Address: address, Absent: acc == nil}
+	if acc != nil {
+		a.Nonce, a.Balance, a.Incarnation, a.CodeHash = acc.Nonce, acc.Balance, acc.Incarnation, acc.CodeHash
+	}
+	r.accounts[address] = a
+	return a, nil
+}
+
+func (r *recordingReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	a, err := r.account(address)
+	if err != nil || a.Absent {
+		return nil, err
+	}
+	acc := accounts.NewAccount()
+	acc.Initialised = true
+	acc.Nonce, acc.Balance, acc.Incarnation, acc.CodeHash = a.Nonce, a.Balance, a.Incarnation, a.CodeHash
+	return &acc, nil
+}
+
+func (r *recordingReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	if _, err := r.account(address); err != nil {
+		return nil, err
+	}
+	slots, ok := r.storage[address]
+	if !ok {
+		slots = map[common.Hash][]byte{}
+		r.storage[address] = slots
+	}
+	if v, ok := slots[*key]; ok {
+		return v, nil
+	}
+	v, err := r.r.ReadAccountStorage(address, incarnation, key)
+	if err != nil {
+		return nil, err
+	}
+	slots[*key] = common.CopyBytes(v)
+	return v, nil
+}
+
+func (r *recordingReader) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	a, err := r.account(address)
+	if err != nil {
+		return nil, err
+	}
+	if a.Code != nil && a.CodeHash == codeHash {
+		return a.Code, nil
+	}
+	code, err := r.r.ReadAccountCode(address, incarnation, codeHash)
+	if err != nil {
+		return nil, err
+	}
+	if a.CodeHash == codeHash {
+		a.Code = common.CopyBytes(code)
+	}
+	return code, nil
+}
+
+func (r *recordingReader) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	code, err := r.ReadAccountCode(address, incarnation, codeHash)
+	return len(code), err
+}
+
+func (r *recordingReader) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	return r.r.ReadAccountIncarnation(address)
+}
+
+func (r *recordingReader) preState() []*Account {
+	res := make([]*Account, 0, len(r.accounts))
+	for address, a := range r.accounts {
+		for key, value := range r.storage[address] {
+			a.Storage = append(a.Storage, &StorageSlot{Key: key, Value: value})
+		}
+		sort.Slice(a.Storage, func(i, j int) bool { return bytes.Compare(a.Storage[i].Key[:], a.Storage[j].Key[:]) < 0 })
+		res = append(res, a)
+	}
+	sort.Slice(res, func(i, j int) bool { return bytes.Compare(res[i].Address[:], res[j].Address[:]) < 0 })
+	return res
+}
+
+// chainReader - implements consensus.ChainHeaderReader on top of read-only transaction, or on top of getHeader only if tx is nil
+type chainReader struct {
+	tx        kv.Tx
+	config    *params.ChainConfig
+	getHeader func(hash common.Hash, number uint64) *types.Header
+}
+
+func (cr chainReader) Config() *params.ChainConfig  { return cr.config }
+func (cr chainReader) CurrentHeader() *types.Header { panic("") }
+func (cr chainReader) GetHeader(hash common.Hash, number uint64) *types.Header {
+	return cr.getHeader(hash, number)
+}
+func (cr chainReader) GetHeaderByNumber(number uint64) *types.Header {
+	if cr.tx == nil {
+		return nil
+	}
+	hash, err := rawdb.ReadCanonicalHash(cr.tx, number)
+	if err != nil || hash == (common.Hash{}) {
+		return nil
+	}
+	return cr.getHeader(hash, number)
+}
+func (cr chainReader) GetHeaderByHash(hash common.Hash) *types.Header {
+	if cr.tx == nil {
+		return nil
+	}
+	number := rawdb.ReadHeaderNumber(cr.tx, hash)
+	if number == nil {
+		return nil
+	}
+	return cr.getHeader(hash, *number)
+}
+func (cr chainReader) GetTd(hash common.Hash, number uint64) *big.Int {
+	if cr.tx == nil {
+		return nil
+	}
+	td, err := rawdb.ReadTd(cr.tx, hash, number)
+	if err != nil {
+		return nil
+	}
+	return td
+}
+
+// NewEpochReader - read-only epoch reader of chaindata, for re-execution of blocks outside of stages
+func NewEpochReader(tx kv.Tx) consensus.EpochReader { return epochReader{tx: tx} }
+
+// epochReader - read-only: epochs produced by re-execution are not persisted
+type epochReader struct {
+	tx kv.Tx
+}
+
+func (cr epochReader) GetEpoch(hash common.Hash, number uint64) ([]byte, error) {
+	return rawdb.ReadEpoch(cr.tx, number, hash)
+}
+func (cr epochReader) PutEpoch(hash common.Hash, number uint64, proof []byte) error { return nil }
+func (cr epochReader) GetPendingEpoch(hash common.Hash, number uint64) ([]byte, error) {
+	return rawdb.ReadPendingEpoch(cr.tx, number, hash)
+}
+func (cr epochReader) PutPendingEpoch(hash common.Hash, number uint64, proof []byte) error {
+	return nil
+}
+func (cr epochReader) FindBeforeOrEqualNumber(number uint64) (blockNum uint64, blockHash common.Hash, transitionProof []byte, err error) {
+	return rawdb.FindEpochBeforeOrEqualNumber(cr.tx, number)
+}
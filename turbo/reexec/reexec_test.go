@@ -0,0 +1,76 @@
+package reexec_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/reexec"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+// runtime: slot[0]++; slot[1] = blockhash(number-2)
+var counterCode = common.FromHex("0x600054600101600055600243034060015500")
+
+// init: return runtime code
+var counterInit = append(common.FromHex("0x6012600c60003960126000f3"), counterCode...)
+
+func TestReadBlock(t *testing.T) {
+	m := stages.Mock(t)
+	signer := types.LatestSignerForChainID(nil)
+	contract := crypto.CreateAddress(m.Address, 0)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 3, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+		var txn types.Transaction
+		if i == 0 {
+			txn = types.NewContractCreation(b.TxNonce(m.Address), uint256.NewInt(0), 100_000, uint256.NewInt(1), counterInit)
+		} else {
+			txn = types.NewTransaction(b.TxNonce(m.Address), contract, uint256.NewInt(0), 100_000, uint256.NewInt(1), nil)
+		}
+		signed, err := types.SignTx(txn, *signer, m.Key)
+		require.NoError(t, err)
+		getHeader := func(hash common.Hash, number uint64) *types.Header {
+			if number == 0 {
+				return m.Genesis.Header()
+			}
+			return b.PrevBlock(int(number) - 1).Header()
+		}
+		b.AddTxWithChain(getHeader, m.Engine, signed)
+	}, false)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	provider := reexec.NewProvider(m.DB, m.ChainConfig, m.Engine, snapshotsync.NewBlockReader(), nil)
+	block, err := provider.Block(context.Background(), 3)
+	require.NoError(t, err)
+	require.Equal(t, chain.Blocks[2].Hash(), block.Header.Hash())
+	require.Equal(t, []common.Address{m.Address}, block.Senders)
+	require.Equal(t, []*reexec.BlockHash{{Number: 1, Hash: chain.Blocks[0].Hash()}, {Number: 2, Hash: chain.Blocks[1].Hash()}}, block.BlockHashes)
+
+	var contractPreState *reexec.Account
+	for _, a := range block.PreState {
+		if a.Address == contract {
+			contractPreState = a
+		}
+	}
+	require.NotNil(t, contractPreState)
+	require.Equal(t, counterCode, contractPreState.Code)
+	require.Equal(t, 2, len(contractPreState.Storage))
+	require.Equal(t, []byte{1}, contractPreState.Storage[0].Value)
+
+	data, err := rlp.EncodeToBytes(block)
+	require.NoError(t, err)
+	decoded, err := reexec.DecodeBlock(data)
+	require.NoError(t, err)
+	receipts, err := decoded.Execute(m.ChainConfig, m.Engine)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(receipts))
+	require.Equal(t, types.ReceiptStatusSuccessful, receipts[0].Status)
+}
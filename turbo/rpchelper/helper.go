@@ -7,6 +7,7 @@ import (
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/filters"
 	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
 	"github.com/ledgerwatch/erigon/core/types/accounts"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 	"github.com/ledgerwatch/erigon/rpc"
@@ -30,6 +31,28 @@ func GetCanonicalBlockNumber(blockNrOrHash rpc.BlockNumberOrHash, tx kv.Tx, filt
 	return _GetBlockNumber(true, blockNrOrHash, tx, filters)
 }
 
+// GetForkchoiceBlockNumber resolves "safe" and "finalized" tags to the block marked by consensus layer in last fork choice update
+func GetForkchoiceBlockNumber(number rpc.BlockNumber, tx kv.Tx) (uint64, common.Hash, error) {
+	var hash common.Hash
+	var name string
+	switch number {
+	case rpc.SafeBlockNumber:
+		hash, name = rawdb.ReadForkchoiceSafe(tx), "safe"
+	case rpc.FinalizedBlockNumber:
+		hash, name = rawdb.ReadForkchoiceFinalized(tx), "finalized"
+	default:
+		return 0, common.Hash{}, fmt.Errorf("not a fork choice block tag: %d", number)
+	}
+	if hash == (common.Hash{}) {
+		return 0, common.Hash{}, fmt.Errorf("%s block not found", name)
+	}
+	blockNumber := rawdb.ReadHeaderNumber(tx, hash)
+	if blockNumber == nil {
+		return 0, common.Hash{}, fmt.Errorf("%s block %x not found", name, hash)
+	}
+	return *blockNumber, hash, nil
+}
+
 func _GetBlockNumber(requireCanonical bool, blockNrOrHash rpc.BlockNumberOrHash, tx kv.Tx, filters *filters.Filters) (uint64, common.Hash, error) {
 	var blockNumber uint64
 	var err error
@@ -43,6 +66,8 @@ func _GetBlockNumber(requireCanonical bool, blockNrOrHash rpc.BlockNumberOrHash,
 			}
 		} else if number == rpc.EarliestBlockNumber {
 			blockNumber = 0
+		} else if number == rpc.SafeBlockNumber || number == rpc.FinalizedBlockNumber {
+			return GetForkchoiceBlockNumber(number, tx)
 		} else if number == rpc.PendingBlockNumber {
 			pendingBlock := filters.LastPendingBlock()
 			if pendingBlock == nil {
@@ -78,7 +103,7 @@ func _GetBlockNumber(requireCanonical bool, blockNrOrHash rpc.BlockNumberOrHash,
 	return blockNumber, hash, nil
 }
 
-func GetAccount(tx kv.Tx, blockNumber uint64, address common.Address) (*accounts.Account, error) {
-	reader := adapter.NewStateReader(tx, blockNumber)
+func GetAccount(tx kv.Tx, blockNumber uint64, history state.HistorySnapshots, address common.Address) (*accounts.Account, error) {
+	reader := adapter.NewStateReader(tx, blockNumber, history)
 	return reader.ReadAccountData(address)
 }
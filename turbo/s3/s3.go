@@ -0,0 +1,367 @@
+// Package s3 - minimal client of S3-compatible object storages (AWS S3, MinIO, Ceph, Cloudflare R2, GCS in
+// interoperability mode): path-style requests signed by AWS Signature Version 4, without SDK dependencies.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PartSize - objects larger than this are uploaded by multipart upload in parts of this size (S3 minimum is 5MB)
+var PartSize = 16 * 1024 * 1024
+
+var ErrNotFound = errors.New("object not found")
+
+type Client struct {
+	Endpoint  string // scheme://host[:port]
+	Region    string
+	Bucket    string
+	AccessKey string // empty - anonymous requests, for public buckets
+	SecretKey string
+	HTTP      *http.Client
+}
+
+// Parse - client and key prefix of `s3://bucket/prefix?endpoint=https://host:port&region=us-east-1`.
+// Credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, region defaults to AWS_REGION or us-east-1,
+// endpoint defaults to AWS endpoint of the region.
+func Parse(s string) (*Client, string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, "", err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return nil, "", fmt.Errorf("%q is not s3://bucket/prefix url", s)
+	}
+	c := &Client{
+		Bucket:    u.Host,
+		Endpoint:  u.Query().Get("endpoint"),
+		Region:    u.Query().Get("region"),
+		AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	}
+	if c.Region == "" {
+		if c.Region = os.Getenv("AWS_REGION"); c.Region == "" {
+			c.Region = "us-east-1"
+		}
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = "https://s3." + c.Region + ".amazonaws.com"
+	}
+	c.Endpoint = strings.TrimSuffix(c.Endpoint, "/")
+	return c, strings.Trim(u.Path, "/"), nil
+}
+
+func (c *Client) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// GetRange - length bytes of the object from offset
+func (c *Client) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	resp, err := c.doWithHeader(ctx, http.MethodGet, key, nil, nil, http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)}})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 GET %s: range request returned %s", key, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (c *Client) Put(ctx context.Context, key string, data []byte) error {
+	resp, err := c.do(ctx, http.MethodPut, key, nil, data)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *Client) Delete(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+type Object struct {
+	Key  string
+	Size int64
+}
+
+// List - objects with keys starting with prefix, in order of keys
+func (c *Client) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	var token string
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		var result struct {
+			Contents []struct {
+				Key  string
+				Size int64
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if err := c.doXML(ctx, http.MethodGet, "", query, nil, &result); err != nil {
+			return nil, err
+		}
+		for _, o := range result.Contents {
+			objects = append(objects, Object{Key: o.Key, Size: o.Size})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Create - writer of the object: it's buffered and uploaded by parts of PartSize, object appears on Close.
+// Object smaller than PartSize is uploaded by one request on Close.
+func (c *Client) Create(ctx context.Context, key string) *Writer {
+	return &Writer{ctx: ctx, c: c, key: key}
+}
+
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+type Writer struct {
+	ctx      context.Context
+	c        *Client
+	key      string
+	buf      []byte
+	uploadID string
+	parts    []completedPart
+	err      error
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf = append(w.buf, p...)
+	for len(w.buf) >= PartSize {
+		if err := w.uploadPart(w.buf[:PartSize]); err != nil {
+			w.Abort()
+			return 0, err
+		}
+		w.buf = append(w.buf[:0], w.buf[PartSize:]...)
+	}
+	return len(p), nil
+}
+
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = errors.New("writer is closed")
+	if w.uploadID == "" {
+		return w.c.Put(w.ctx, w.key, w.buf)
+	}
+	if len(w.buf) > 0 {
+		if err := w.uploadPart(w.buf); err != nil {
+			w.Abort()
+			return err
+		}
+	}
+	complete := struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: w.parts}
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	// S3 may return error in body of 200 response of CompleteMultipartUpload
+	var result struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if err := w.c.doXML(w.ctx, http.MethodPost, w.key, url.Values{"uploadId": {w.uploadID}}, body, &result); err != nil {
+		w.Abort()
+		return err
+	}
+	if result.XMLName.Local == "Error" {
+		w.Abort()
+		return fmt.Errorf("s3 complete upload of %s: %s: %s", w.key, result.Code, result.Message)
+	}
+	return nil
+}
+
+func (w *Writer) uploadPart(data []byte) error {
+	if w.uploadID == "" {
+		var result struct{ UploadId string }
+		if err := w.c.doXML(w.ctx, http.MethodPost, w.key, url.Values{"uploads": {""}}, nil, &result); err != nil {
+			return err
+		}
+		w.uploadID = result.UploadId
+	}
+	number := len(w.parts) + 1
+	resp, err := w.c.do(w.ctx, http.MethodPut, w.key, url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {w.uploadID}}, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	w.parts = append(w.parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	return nil
+}
+
+// Abort - cancels upload, object doesn't appear. Storage keeps uploaded parts until abort
+func (w *Writer) Abort() {
+	w.err = errors.New("writer is aborted")
+	if w.uploadID == "" {
+		return
+	}
+	uploadID := w.uploadID
+	w.uploadID = ""
+	if resp, err := w.c.do(context.Background(), http.MethodDelete, w.key, url.Values{"uploadId": {uploadID}}, nil); err == nil {
+		resp.Body.Close()
+	}
+}
+
+func (c *Client) doXML(ctx context.Context, method, key string, query url.Values, body []byte, result interface{}) error {
+	resp, err := c.do(ctx, method, key, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return xml.NewDecoder(resp.Body).Decode(result)
+}
+
+// do - sends signed request, non-2xx responses are errors
+func (c *Client) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	return c.doWithHeader(ctx, method, key, query, body, nil)
+}
+
+// doWithHeader - do with unsigned headers
+func (c *Client) doWithHeader(ctx context.Context, method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	path := "/" + uriEncode(c.Bucket, true)
+	if key != "" {
+		path += "/" + uriEncode(key, false)
+	}
+	rawQuery := canonicalQuery(query)
+	u, err := url.Parse(c.Endpoint + path)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = rawQuery
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	c.sign(req, path, rawQuery, body, time.Now().UTC())
+
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet && key != "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("s3 %s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(msg))
+}
+
+// sign - AWS Signature Version 4
+func (c *Client) sign(req *http.Request, path, rawQuery string, body []byte, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", hex.EncodeToString(payloadHash[:]))
+	if c.AccessKey == "" {
+		return
+	}
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		rawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + hex.EncodeToString(payloadHash[:]),
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	date := now.Format("20060102")
+	scope := date + "/" + c.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := hmacSHA256([]byte("AWS4"+c.SecretKey), date)
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.AccessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, uriEncode(k, true)+"="+uriEncode(query.Get(k), true))
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode - encoding of SigV4: everything except unreserved characters, and slashes of keys
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ('A' <= ch && ch <= 'Z') || ('a' <= ch && ch <= 'z') || ('0' <= ch && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || (ch == '/' && !encodeSlash) {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
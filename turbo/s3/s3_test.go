@@ -0,0 +1,141 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 - in-memory storage serving requests of the client
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	key := ""
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+	q := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		var result struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []Object
+		}
+		for k, v := range s.objects {
+			if strings.HasPrefix(k, q.Get("prefix")) {
+				result.Contents = append(result.Contents, Object{Key: k, Size: int64(len(v))})
+			}
+		}
+		sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+		_ = xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodGet:
+		v, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(v))
+	case r.Method == http.MethodPost && q["uploads"] != nil:
+		id := fmt.Sprintf("upload%d", len(s.uploads))
+		s.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && q.Get("uploadId") != "":
+		var n int
+		fmt.Sscanf(q.Get("partNumber"), "%d", &n) //nolint:errcheck
+		s.uploads[q.Get("uploadId")][n] = body
+		w.Header().Set("ETag", fmt.Sprintf("\"etag%d\"", n))
+	case r.Method == http.MethodPost && q.Get("uploadId") != "":
+		var complete struct{ Part []completedPart }
+		_ = xml.Unmarshal(body, &complete)
+		var data []byte
+		for _, p := range complete.Part {
+			data = append(data, s.uploads[q.Get("uploadId")][p.PartNumber]...)
+		}
+		s.objects[key] = data
+		delete(s.uploads, q.Get("uploadId"))
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodPut:
+		s.objects[key] = body
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+	}
+}
+
+func TestClient(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	for k, v := range map[string]string{"AWS_ACCESS_KEY_ID": "key", "AWS_SECRET_ACCESS_KEY": "secret"} {
+		require.NoError(t, os.Setenv(k, v))
+		defer os.Unsetenv(k)
+	}
+	c, prefix, err := Parse("s3://bucket/backups/node1?endpoint=" + server.URL)
+	require.NoError(t, err)
+	require.Equal(t, "backups/node1", prefix)
+	require.Equal(t, "us-east-1", c.Region)
+	ctx := context.Background()
+
+	defer func(size int) { PartSize = size }(PartSize)
+	PartSize = 10
+	large := bytes.Repeat([]byte("0123456789abc"), 3)
+	w := c.Create(ctx, prefix+"/large")
+	_, err = w.Write(large)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Empty(t, fake.uploads)
+	w = c.Create(ctx, prefix+"/small file")
+	_, err = w.Write([]byte("small"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r, err := c.Get(ctx, prefix+"/large")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, large, data)
+
+	r, err = c.GetRange(ctx, prefix+"/large", 3, 12)
+	require.NoError(t, err)
+	data, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, large[3:15], data)
+
+	objects, err := c.List(ctx, prefix+"/")
+	require.NoError(t, err)
+	require.Equal(t, []Object{{Key: prefix + "/large", Size: int64(len(large))}, {Key: prefix + "/small file", Size: 5}}, objects)
+
+	require.NoError(t, c.Delete(ctx, prefix+"/large"))
+	_, err = c.Get(ctx, prefix+"/large")
+	require.True(t, errors.Is(err, ErrNotFound))
+
+	c.AccessKey = "other"
+	_, err = c.Get(ctx, prefix+"/small file")
+	require.Error(t, err)
+}
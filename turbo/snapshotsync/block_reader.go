@@ -45,6 +45,14 @@ func (back *BlockReader) BodyRlp(ctx context.Context, tx kv.Tx, hash common.Hash
 	return bodyRlp, nil
 }
 
+func (back *BlockReader) Uncles(ctx context.Context, tx kv.Tx, hash common.Hash, blockHeight uint64) (uncles []*types.Header, err error) {
+	body, _, _ := rawdb.ReadBody(tx, hash, blockHeight)
+	if body == nil {
+		return nil, nil
+	}
+	return body.Uncles, nil
+}
+
 func (back *BlockReader) HeaderByNumber(ctx context.Context, tx kv.Getter, blockHeight uint64) (*types.Header, error) {
 	h := rawdb.ReadHeaderByNumber(tx, blockHeight)
 	return h, nil
@@ -128,6 +136,17 @@ func (back *RemoteBlockReader) BodyRlp(ctx context.Context, tx kv.Tx, hash commo
 	return bodyRlp, nil
 }
 
+func (back *RemoteBlockReader) Uncles(ctx context.Context, tx kv.Tx, hash common.Hash, blockHeight uint64) (uncles []*types.Header, err error) {
+	body, err := back.Body(ctx, tx, hash, blockHeight)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, nil
+	}
+	return body.Uncles, nil
+}
+
 // BlockReaderWithSnapshots can read blocks from db and snapshots
 type BlockReaderWithSnapshots struct {
 	sn   *AllSnapshots
@@ -138,36 +157,51 @@ func NewBlockReaderWithSnapshots(snapshots *AllSnapshots) *BlockReaderWithSnapsh
 	return &BlockReaderWithSnapshots{sn: snapshots}
 }
 func (back *BlockReaderWithSnapshots) HeaderByNumber(ctx context.Context, tx kv.Getter, blockHeight uint64) (*types.Header, error) {
-	sn, ok := back.sn.Blocks(blockHeight)
+	sn, ok, err := back.sn.Blocks(blockHeight)
+	if err != nil {
+		return nil, err
+	}
 	if !ok {
 		h := rawdb.ReadHeaderByNumber(tx, blockHeight)
 		return h, nil
 	}
+	defer sn.Release()
 	return back.headerFromSnapshot(blockHeight, sn)
 }
 
 func (back *BlockReaderWithSnapshots) Header(ctx context.Context, tx kv.Getter, hash common.Hash, blockHeight uint64) (*types.Header, error) {
-	sn, ok := back.sn.Blocks(blockHeight)
+	sn, ok, err := back.sn.Blocks(blockHeight)
+	if err != nil {
+		return nil, err
+	}
 	if !ok {
 		h := rawdb.ReadHeader(tx, hash, blockHeight)
 		return h, nil
 	}
+	defer sn.Release()
 
 	return back.headerFromSnapshot(blockHeight, sn)
 }
 
 func (back *BlockReaderWithSnapshots) ReadHeaderByNumber(ctx context.Context, tx kv.Getter, hash common.Hash, blockHeight uint64) (*types.Header, error) {
-	sn, ok := back.sn.Blocks(blockHeight)
+	sn, ok, err := back.sn.Blocks(blockHeight)
+	if err != nil {
+		return nil, err
+	}
 	if !ok {
 		h := rawdb.ReadHeader(tx, hash, blockHeight)
 		return h, nil
 	}
+	defer sn.Release()
 
 	return back.headerFromSnapshot(blockHeight, sn)
 }
 
 func (back *BlockReaderWithSnapshots) Body(ctx context.Context, tx kv.Tx, hash common.Hash, blockHeight uint64) (body *types.Body, err error) {
-	sn, ok := back.sn.Blocks(blockHeight)
+	sn, ok, err := back.sn.Blocks(blockHeight)
+	if err != nil {
+		return nil, err
+	}
 	if !ok {
 		canonicalHash, err := rawdb.ReadCanonicalHash(tx, blockHeight)
 		if err != nil {
@@ -190,6 +224,7 @@ func (back *BlockReaderWithSnapshots) Body(ctx context.Context, tx kv.Tx, hash c
 		}
 		return body, nil
 	}
+	defer sn.Release()
 
 	body, _, _, _, err = back.bodyFromSnapshot(blockHeight, sn)
 	if err != nil {
@@ -210,8 +245,33 @@ func (back *BlockReaderWithSnapshots) BodyRlp(ctx context.Context, tx kv.Tx, has
 	return bodyRlp, nil
 }
 
+// Uncles - reads only body's storage record (without transactions) - it's cheap enough to serve uncles-related RPC from snapshots
+func (back *BlockReaderWithSnapshots) Uncles(ctx context.Context, tx kv.Tx, hash common.Hash, blockHeight uint64) (uncles []*types.Header, err error) {
+	sn, ok, err := back.sn.Blocks(blockHeight)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		body, _, _ := rawdb.ReadBody(tx, hash, blockHeight)
+		if body == nil {
+			return nil, nil
+		}
+		return body.Uncles, nil
+	}
+	defer sn.Release()
+
+	b, err := back.bodyForStorageFromSnapshot(blockHeight, sn)
+	if err != nil {
+		return nil, err
+	}
+	return b.Uncles, nil
+}
+
 func (back *BlockReaderWithSnapshots) BlockWithSenders(ctx context.Context, tx kv.Tx, hash common.Hash, blockHeight uint64) (block *types.Block, senders []common.Address, err error) {
-	sn, ok := back.sn.Blocks(blockHeight)
+	sn, ok, err := back.sn.Blocks(blockHeight)
+	if err != nil {
+		return nil, nil, err
+	}
 	if !ok {
 		canonicalHash, err := rawdb.ReadCanonicalHash(tx, blockHeight)
 		if err != nil {
@@ -226,6 +286,7 @@ func (back *BlockReaderWithSnapshots) BlockWithSenders(ctx context.Context, tx k
 		}
 		return rawdb.NonCanonicalBlockWithSenders(tx, hash, blockHeight)
 	}
+	defer sn.Release()
 
 	buf := make([]byte, 16)
 
@@ -298,6 +359,21 @@ func (back *BlockReaderWithSnapshots) headerFromSnapshot(blockHeight uint64, sn
 	return h, nil
 }
 
+func (back *BlockReaderWithSnapshots) bodyForStorageFromSnapshot(blockHeight uint64, sn *BlocksSnapshot) (*types.BodyForStorage, error) {
+	buf := make([]byte, 16)
+
+	bodyOffset := sn.BodyNumberIdx.Lookup2(blockHeight - sn.BodyNumberIdx.BaseDataID())
+
+	gg := sn.Bodies.MakeGetter()
+	gg.Reset(bodyOffset)
+	buf, _ = gg.Next(buf[:0])
+	b := &types.BodyForStorage{}
+	if err := rlp.DecodeBytes(buf, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
 func (back *BlockReaderWithSnapshots) bodyFromSnapshot(blockHeight uint64, sn *BlocksSnapshot) (*types.Body, []common.Address, uint64, uint32, error) {
 	buf := make([]byte, 16)
 
@@ -16,6 +16,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/holiman/uint256"
@@ -29,6 +30,7 @@ import (
 	"github.com/ledgerwatch/erigon/common/dbutils"
 	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/erigon/rlp"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snapshothashes"
 	"github.com/ledgerwatch/log/v3"
@@ -44,6 +46,12 @@ type BlocksSnapshot struct {
 
 	From uint64 // included
 	To   uint64 // excluded
+
+	lazy *lazySegment // not nil - segments are fetched from remote storage on first read, see AllSnapshots.SetRemote
+
+	refLock sync.Mutex
+	refs    int    // readers which got snapshot by AllSnapshots.Blocks and didn't Release it yet
+	retired func() // not nil - snapshot is replaced, it's closed when last reader releases it, then retired is called
 }
 
 type SnapshotType string
@@ -52,6 +60,10 @@ const (
 	Headers      SnapshotType = "headers"
 	Bodies       SnapshotType = "bodies"
 	Transactions SnapshotType = "transactions"
+
+	// history of state, see historysnapshot package
+	AccountHistory SnapshotType = "accounthistory"
+	StorageHistory SnapshotType = "storagehistory"
 )
 
 var AllSnapshotTypes = []SnapshotType{Headers, Bodies, Transactions}
@@ -76,9 +88,194 @@ func IdxFileName(from, to uint64, name SnapshotType) string {
 	return FileName(from, to, name) + ".idx"
 }
 
-func (s BlocksSnapshot) Has(block uint64) bool { return block >= s.From && block < s.To }
+func (s *BlocksSnapshot) Has(block uint64) bool { return block >= s.From && block < s.To }
+
+// OpenBlocksSnapshot - opens segments of all types, but not indices
+func OpenBlocksSnapshot(dir string, r Range) (*BlocksSnapshot, error) {
+	sn := &BlocksSnapshot{From: r.From, To: r.To}
+	var err error
+	if sn.Bodies, err = compress.NewDecompressor(path.Join(dir, SegmentFileName(r.From, r.To, Bodies))); err != nil {
+		sn.Close()
+		return nil, err
+	}
+	if sn.Headers, err = compress.NewDecompressor(path.Join(dir, SegmentFileName(r.From, r.To, Headers))); err != nil {
+		sn.Close()
+		return nil, err
+	}
+	if sn.Transactions, err = compress.NewDecompressor(path.Join(dir, SegmentFileName(r.From, r.To, Transactions))); err != nil {
+		sn.Close()
+		return nil, err
+	}
+	return sn, nil
+}
+
+func (s *BlocksSnapshot) Close() {
+	if s.HeaderHashIdx != nil {
+		s.HeaderHashIdx.Close()
+	}
+	if s.Headers != nil {
+		s.Headers.Close()
+	}
+	if s.BodyNumberIdx != nil {
+		s.BodyNumberIdx.Close()
+	}
+	if s.Bodies != nil {
+		s.Bodies.Close()
+	}
+	if s.TxnHashIdx != nil {
+		s.TxnHashIdx.Close()
+	}
+	if s.Transactions != nil {
+		s.Transactions.Close()
+	}
+}
+
+func (s *BlocksSnapshot) acquire() {
+	s.refLock.Lock()
+	defer s.refLock.Unlock()
+	s.refs++
+}
+
+// Release - reader doesn't use snapshot anymore, must be called for every snapshot got by AllSnapshots.Blocks
+func (s *BlocksSnapshot) Release() {
+	s.refLock.Lock()
+	s.refs--
+	closeNow := s.refs == 0 && s.retired != nil
+	s.refLock.Unlock()
+	if closeNow {
+		s.closeRetired()
+	}
+}
+
+// Retire - snapshot is removed from AllSnapshots, so no new readers can get it. It's closed when last reader
+// releases it (or now, if there are no readers), then onClosed is called - for example to remove its files.
+func (s *BlocksSnapshot) Retire(onClosed func()) {
+	if onClosed == nil {
+		onClosed = func() {}
+	}
+	s.refLock.Lock()
+	s.retired = onClosed
+	closeNow := s.refs == 0
+	s.refLock.Unlock()
+	if closeNow {
+		s.closeRetired()
+	}
+}
+
+func (s *BlocksSnapshot) closeRetired() {
+	s.Close()
+	s.retired()
+}
+
+// OpenIdx - opens indices of all types
+func (s *BlocksSnapshot) OpenIdx(dir string) (err error) {
+	if s.HeaderHashIdx, err = recsplit.OpenIndex(path.Join(dir, IdxFileName(s.From, s.To, Headers))); err != nil {
+		return err
+	}
+	if s.BodyNumberIdx, err = recsplit.OpenIndex(path.Join(dir, IdxFileName(s.From, s.To, Bodies))); err != nil {
+		return err
+	}
+	if s.TxnHashIdx, err = recsplit.OpenIndex(path.Join(dir, IdxFileName(s.From, s.To, Transactions))); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Range - blocks [From, To) of segment
+type Range struct {
+	From uint64 // included
+	To   uint64 // excluded
+}
+
+func (r Range) String() string { return fmt.Sprintf("%d-%d", r.From, r.To) }
+
+// ChainOfRanges - longest chain of adjacent ranges, starting from block 0. Ranges may overlap: segments are merged
+// into bigger ones in background, and old segments may stay on disk if merge was interrupted. Chain of fewer ranges
+// wins - merged segment is preferred over its parts.
+func ChainOfRanges(ranges []Range) []Range {
+	sorted := make([]Range, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].From == sorted[j].From {
+			return sorted[i].To > sorted[j].To
+		}
+		return sorted[i].From < sorted[j].From
+	})
+	type link struct {
+		count int
+		prev  Range
+	}
+	best := map[uint64]link{0: {}} // end of chain -> shortest chain which ends there
+	var end uint64
+	for _, r := range sorted {
+		if r.To <= r.From {
+			continue
+		}
+		l, ok := best[r.From]
+		if !ok {
+			continue
+		}
+		if existing, ok := best[r.To]; !ok || l.count+1 < existing.count {
+			best[r.To] = link{count: l.count + 1, prev: r}
+		}
+		if r.To > end {
+			end = r.To
+		}
+	}
+	chain := make([]Range, best[end].count)
+	for i := len(chain) - 1; i >= 0; i-- {
+		chain[i] = best[end].prev
+		end = chain[i].From
+	}
+	return chain
+}
+
+// fileRanges - ranges of files of given type and extension
+func fileRanges(files []string, ext string) ([]Range, error) {
+	var res []Range
+	for _, f := range files {
+		from, to, _, err := ParseFileName(f, ext)
+		if err != nil {
+			if errors.Is(err, ErrInvalidCompressedFileName) {
+				continue
+			}
+			return nil, err
+		}
+		res = append(res, Range{From: from, To: to})
+	}
+	return res, nil
+}
+
+// SegmentRanges - ranges for which segments of all types exist. Result may have overlaps and gaps.
+func SegmentRanges(dir string) ([]Range, error) {
+	found := map[Range]int{}
+	for _, snapshotType := range AllSnapshotTypes {
+		files, err := segments(dir, snapshotType)
+		if err != nil {
+			return nil, err
+		}
+		ranges, err := fileRanges(files, ".seg")
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range ranges {
+			found[r]++
+		}
+	}
+	var res []Range
+	for r, count := range found {
+		if count == len(AllSnapshotTypes) {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].From < res[j].From || (res[i].From == res[j].From && res[i].To < res[j].To)
+	})
+	return res, nil
+}
 
 type AllSnapshots struct {
+	lock                 sync.RWMutex // guards blocks, they are replaced by merge of segments
 	dir                  string
 	allSegmentsAvailable bool
 	allIdxAvailable      bool
@@ -86,13 +283,14 @@ type AllSnapshots struct {
 	idxAvailable         uint64
 	blocks               []*BlocksSnapshot
 	cfg                  *snapshothashes.Config
+	remote               *RemoteStorage
 }
 
 // NewAllSnapshots - opens all snapshots. But to simplify everything:
-//  - it opens snapshots only on App start and immutable after
-//  - all snapshots of given blocks range must exist - to make this blocks range available
-//  - gaps are not allowed
-//  - segment have [from:to) semantic
+//   - it opens snapshots only on App start and immutable after
+//   - all snapshots of given blocks range must exist - to make this blocks range available
+//   - gaps are not allowed
+//   - segment have [from:to) semantic
 func NewAllSnapshots(dir string, cfg *snapshothashes.Config) *AllSnapshots {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		panic(err)
@@ -100,6 +298,7 @@ func NewAllSnapshots(dir string, cfg *snapshothashes.Config) *AllSnapshots {
 	return &AllSnapshots{dir: dir, cfg: cfg}
 }
 
+func (s *AllSnapshots) Dir() string                                 { return s.dir }
 func (s *AllSnapshots) ChainSnapshotConfig() *snapshothashes.Config { return s.cfg }
 func (s *AllSnapshots) AllSegmentsAvailable() bool                  { return s.allSegmentsAvailable }
 func (s *AllSnapshots) SetAllSegmentsAvailable(v bool)              { s.allSegmentsAvailable = v }
@@ -109,13 +308,18 @@ func (s *AllSnapshots) SetAllIdxAvailable(v bool)                   { s.allIdxAv
 func (s *AllSnapshots) IndicesAvailable() uint64                    { return s.idxAvailable }
 
 func (s *AllSnapshots) SegmentsAvailability() (headers, bodies, txs uint64, err error) {
-	if headers, err = latestSegment(s.dir, Headers); err != nil {
+	if s.remote != nil {
+		if err = s.remote.Refresh(context.Background()); err != nil {
+			return
+		}
+	}
+	if headers, err = s.latestSegment(Headers); err != nil {
 		return
 	}
-	if bodies, err = latestSegment(s.dir, Bodies); err != nil {
+	if bodies, err = s.latestSegment(Bodies); err != nil {
 		return
 	}
-	if txs, err = latestSegment(s.dir, Transactions); err != nil {
+	if txs, err = s.latestSegment(Transactions); err != nil {
 		return
 	}
 	return
@@ -138,6 +342,8 @@ func (s *AllSnapshots) ReopenIndices() error {
 }
 
 func (s *AllSnapshots) ReopenSomeIndices(types ...SnapshotType) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	for _, bs := range s.blocks {
 		for _, snapshotType := range types {
 			switch snapshotType {
@@ -186,114 +392,158 @@ func (s *AllSnapshots) ReopenSomeIndices(types ...SnapshotType) error {
 	return nil
 }
 
-func (s *AllSnapshots) ReopenSegments() error {
-	dir := s.dir
-	files, err := segments(dir, Headers)
+// SegmentRanges - ranges for which segments of all types exist in local directory or in remote storage
+func (s *AllSnapshots) SegmentRanges() ([]Range, error) {
+	ranges, err := SegmentRanges(s.dir)
+	if err != nil || s.remote == nil {
+		return ranges, err
+	}
+	remote, err := s.remoteRanges()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	var prevTo uint64
-	for _, f := range files {
-		from, to, _, err := ParseFileName(f, ".seg")
-		if err != nil {
-			if errors.Is(ErrInvalidCompressedFileName, err) {
-				continue
-			}
-			return err
+	found := map[Range]bool{}
+	for _, r := range ranges {
+		found[r] = true
+	}
+	for _, r := range remote {
+		if !found[r] {
+			ranges = append(ranges, r)
 		}
-		if to == prevTo {
-			continue
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].From < ranges[j].From || (ranges[i].From == ranges[j].From && ranges[i].To < ranges[j].To)
+	})
+	return ranges, nil
+}
+
+func (s *AllSnapshots) ReopenSegments() error {
+	if s.remote != nil {
+		if err := s.fetchRemote(context.Background()); err != nil {
+			return err
 		}
-		if from > s.cfg.ExpectBlocks {
-			log.Debug("[open snapshots] skip snapshot because node expect less blocks in snapshots", "file", f)
+	}
+	ranges, err := s.SegmentRanges()
+	if err != nil {
+		return err
+	}
+	var expected []Range
+	for _, r := range ranges {
+		if s.cfg != nil && r.From > s.cfg.ExpectBlocks {
+			log.Debug("[open snapshots] skip snapshot because node expect less blocks in snapshots", "range", r)
 			continue
 		}
-		if from != prevTo { // no gaps
-			return fmt.Errorf("[open snapshots] snapshot missed: from %d to %d", prevTo, from)
-			//log.Debug("[open snapshots] snapshot missed before", "file", f)
-			//break
+		expected = append(expected, r)
+	}
+	chain := ChainOfRanges(expected)
+	var prevTo uint64
+	if len(chain) > 0 {
+		prevTo = chain[len(chain)-1].To
+	}
+	for _, r := range expected {
+		if r.From > prevTo { // no gaps
+			return fmt.Errorf("[open snapshots] snapshot missed: from %d to %d", prevTo, r.From)
 		}
-		prevTo = to
+	}
 
-		blocksSnapshot := &BlocksSnapshot{From: from, To: to}
-		{
-			fileName := SegmentFileName(from, to, Bodies)
-			blocksSnapshot.Bodies, err = compress.NewDecompressor(path.Join(dir, fileName))
-			if err != nil {
-				if errors.Is(err, os.ErrNotExist) {
-					break
-				}
-				return err
-			}
-		}
-		{
-			fileName := SegmentFileName(from, to, Headers)
-			blocksSnapshot.Headers, err = compress.NewDecompressor(path.Join(dir, fileName))
-			if err != nil {
-				if errors.Is(err, os.ErrNotExist) {
-					break
-				}
-				return err
-			}
+	blocks := make([]*BlocksSnapshot, 0, len(chain))
+	for _, r := range chain {
+		if s.remote != nil && s.remote.Lazy && s.remote.Has(r) {
+			blocks = append(blocks, s.openLazy(r))
+			continue
 		}
-		{
-			fileName := SegmentFileName(from, to, Transactions)
-			blocksSnapshot.Transactions, err = compress.NewDecompressor(path.Join(dir, fileName))
-			if err != nil {
-				if errors.Is(err, os.ErrNotExist) {
-					break
-				}
-				return err
+		blocksSnapshot, err := OpenBlocksSnapshot(s.dir, r)
+		if err != nil {
+			for _, sn := range blocks {
+				sn.Close()
 			}
+			return err
 		}
+		blocks = append(blocks, blocksSnapshot)
+	}
 
-		s.blocks = append(s.blocks, blocksSnapshot)
-		if blocksSnapshot.To > 0 {
-			s.segmentsAvailable = blocksSnapshot.To - 1
-		} else {
-			s.segmentsAvailable = 0
-		}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.blocks = blocks
+	s.segmentsAvailable = 0
+	if len(blocks) > 0 && blocks[len(blocks)-1].To > 0 {
+		s.segmentsAvailable = blocks[len(blocks)-1].To - 1
 	}
 	return nil
 }
 
 func (s *AllSnapshots) Close() {
-	for _, s := range s.blocks {
-		if s.HeaderHashIdx != nil {
-			s.HeaderHashIdx.Close()
-		}
-		if s.Headers != nil {
-			s.Headers.Close()
-		}
-		if s.BodyNumberIdx != nil {
-			s.BodyNumberIdx.Close()
-		}
-		if s.Bodies != nil {
-			s.Bodies.Close()
-		}
-		if s.TxnHashIdx != nil {
-			s.TxnHashIdx.Close()
-		}
-		if s.Transactions != nil {
-			s.Transactions.Close()
-		}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, sn := range s.blocks {
+		sn.Close()
 	}
 }
 
-func (s *AllSnapshots) Blocks(blockNumber uint64) (snapshot *BlocksSnapshot, found bool) {
-	if blockNumber > s.segmentsAvailable {
-		return snapshot, false
+// Opened - ranges of currently open segments
+func (s *AllSnapshots) Opened() []Range {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	res := make([]Range, len(s.blocks))
+	for i, sn := range s.blocks {
+		res[i] = Range{From: sn.From, To: sn.To}
+	}
+	return res
+}
+
+// Replace - atomically replaces open segments covered by merged one. Returns replaced segments: they may still be used
+// by readers which got them before, so caller must Retire them.
+func (s *AllSnapshots) Replace(merged *BlocksSnapshot) (replaced []*BlocksSnapshot, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	i := sort.Search(len(s.blocks), func(i int) bool { return s.blocks[i].From >= merged.From })
+	j := i
+	for j < len(s.blocks) && s.blocks[j].To <= merged.To {
+		j++
+	}
+	if i == len(s.blocks) || s.blocks[i].From != merged.From || j == i || s.blocks[j-1].To != merged.To {
+		return nil, fmt.Errorf("merged segment %d-%d doesn't match open segments", merged.From, merged.To)
 	}
-	for _, blocksSnapshot := range s.blocks {
-		if blocksSnapshot.Has(blockNumber) {
-			return blocksSnapshot, true
+	replaced = append(replaced, s.blocks[i:j]...)
+	blocks := make([]*BlocksSnapshot, 0, len(s.blocks)-len(replaced)+1)
+	blocks = append(blocks, s.blocks[:i]...)
+	blocks = append(blocks, merged)
+	blocks = append(blocks, s.blocks[j:]...)
+	s.blocks = blocks
+	return replaced, nil
+}
+
+// Blocks - snapshot which has given block, caller must Release it after use: segments replaced by merge or evicted
+// from cache of remote storage stay open until their last reader releases them. Error - segment of remote storage
+// can't be fetched, the block isn't in db either.
+func (s *AllSnapshots) Blocks(blockNumber uint64) (snapshot *BlocksSnapshot, found bool, err error) {
+	s.lock.RLock()
+	if blockNumber <= s.segmentsAvailable {
+		for _, blocksSnapshot := range s.blocks {
+			if blocksSnapshot.Has(blockNumber) {
+				blocksSnapshot.acquire()
+				snapshot, found = blocksSnapshot, true
+				break
+			}
 		}
 	}
-	return snapshot, false
+	s.lock.RUnlock()
+	if !found {
+		return snapshot, false, nil
+	}
+	// without lock: fetching may take long
+	if err := s.ensureFetched(snapshot); err != nil {
+		snapshot.Release()
+		return nil, false, fmt.Errorf("fetching segment %s from remote storage: %w", Range{From: snapshot.From, To: snapshot.To}, err)
+	}
+	return snapshot, true, nil
 }
 
 func (s *AllSnapshots) BuildIndices(ctx context.Context, chainID uint256.Int) error {
 	for _, sn := range s.blocks {
+		if err := s.ensureFetched(sn); err != nil {
+			return err
+		}
 		f := path.Join(s.dir, SegmentFileName(sn.From, sn.To, Headers))
 		if err := HeadersHashIdx(f, sn.From); err != nil {
 			return err
@@ -340,56 +590,40 @@ func (s *AllSnapshots) BuildIndices(ctx context.Context, chainID uint256.Int) er
 	return nil
 }
 
-func latestSegment(dir string, ofType SnapshotType) (uint64, error) {
-	files, err := segments(dir, ofType)
+// latestSegment - of local directory and remote storage
+func (s *AllSnapshots) latestSegment(ofType SnapshotType) (uint64, error) {
+	files, err := segments(s.dir, ofType)
 	if err != nil {
 		return 0, err
 	}
-	var maxBlock, prevTo uint64
-	for _, f := range files {
-		from, to, _, err := ParseFileName(f, ".seg")
-		if err != nil {
-			if errors.Is(ErrInvalidCompressedFileName, err) {
-				continue
-			}
-			return 0, err
-		}
-		if from != prevTo { // no gaps
-			log.Warn("[open snapshots] snapshot missed", "type", ofType, "from", prevTo, "to", from)
-			break
-		}
-		prevTo = to
-		if maxBlock < to {
-			maxBlock = to
-		}
-	}
-	if maxBlock == 0 {
-		return 0, nil
+	if s.remote != nil {
+		files = append(files, s.remoteFiles(ofType, ".seg")...)
 	}
-	return maxBlock - 1, nil
+	return latestBlock(files, ".seg", ofType)
 }
 func latestIdx(dir string, ofType SnapshotType) (uint64, error) {
 	files, err := idxFiles(dir, ofType)
 	if err != nil {
 		return 0, err
 	}
-	var maxBlock, prevTo uint64
-	for _, f := range files {
-		from, to, _, err := ParseFileName(f, ".idx")
-		if err != nil {
-			if errors.Is(ErrInvalidCompressedFileName, err) {
-				continue
-			}
-			return 0, err
-		}
-		if from != prevTo { // no gaps
-			log.Warn("[open snapshots] snapshot missed", "type", ofType, "from", prevTo, "to", from)
+	return latestBlock(files, ".idx", ofType)
+}
+
+func latestBlock(files []string, ext string, ofType SnapshotType) (uint64, error) {
+	ranges, err := fileRanges(files, ext)
+	if err != nil {
+		return 0, err
+	}
+	chain := ChainOfRanges(ranges)
+	var maxBlock uint64
+	if len(chain) > 0 {
+		maxBlock = chain[len(chain)-1].To
+	}
+	for _, r := range ranges {
+		if r.From > maxBlock { // no gaps
+			log.Warn("[open snapshots] snapshot missed", "type", ofType, "from", maxBlock, "to", r.From)
 			break
 		}
-		prevTo = to
-		if maxBlock < to {
-			maxBlock = to
-		}
 	}
 	if maxBlock == 0 {
 		return 0, nil
@@ -480,6 +714,10 @@ func ParseFileName(name, expectedExt string) (from, to uint64, snapshotType Snap
 		snapshotType = Bodies
 	case Transactions:
 		snapshotType = Transactions
+	case AccountHistory:
+		snapshotType = AccountHistory
+	case StorageHistory:
+		snapshotType = StorageHistory
 	default:
 		return 0, 0, "", fmt.Errorf("%w, unexpected snapshot suffix: %s", ErrInvalidCompressedFileName, parts[2])
 	}
@@ -587,7 +825,7 @@ func DumpTxs(db kv.RoDB, tmpdir string, fromBlock uint64, blocksAmount int) (fir
 	}); err != nil {
 		return 0, err
 	}
-	if lastBody.BaseTxId+uint64(lastBody.TxAmount)-firstTxID != count {
+	if firstIDSaved && lastBody.BaseTxId+uint64(lastBody.TxAmount)-firstTxID != count {
 		fmt.Printf("prevTxID: %d\n", prevTxID)
 		return 0, fmt.Errorf("incorrect tx count: %d, expected: %d", count, lastBody.BaseTxId+uint64(lastBody.TxAmount)-firstTxID)
 	}
@@ -705,6 +943,98 @@ func DumpBodies(db kv.RoDB, tmpdir string, fromBlock uint64, blocksAmount int) e
 	return nil
 }
 
+// VerifySegments - compares segments of range [from, to) in dir with canonical blocks in db:
+// every header must hash to canonical hash, every body must be equal to stored body,
+// transactions must be equal to stored transactions and there must be exactly as many of them as bodies declare
+func VerifySegments(db kv.RoDB, dir string, from, to uint64) error {
+	return db.View(context.Background(), func(tx kv.Tx) error {
+		blockNum := from
+		if err := ForEachWord(path.Join(dir, SegmentFileName(from, to, Headers)), func(word []byte) error {
+			hash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+			if err != nil {
+				return err
+			}
+			if got := common.BytesToHash(crypto.Keccak256(word)); got != hash {
+				return fmt.Errorf("header %d: hash %x, canonical %x", blockNum, got, hash)
+			}
+			blockNum++
+			return nil
+		}); err != nil {
+			return err
+		}
+		if blockNum != to {
+			return fmt.Errorf("headers segment has %d headers, expected %d", blockNum-from, to-from)
+		}
+
+		var firstTxID, txsAmount uint64
+		blockNum = from
+		if err := ForEachWord(path.Join(dir, SegmentFileName(from, to, Bodies)), func(word []byte) error {
+			hash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(word, rawdb.ReadStorageBodyRLP(tx, hash, blockNum)) {
+				return fmt.Errorf("body %d doesn't match database", blockNum)
+			}
+			var body types.BodyForStorage
+			if err := rlp.DecodeBytes(word, &body); err != nil {
+				return fmt.Errorf("body %d: %w", blockNum, err)
+			}
+			if txsAmount == 0 {
+				firstTxID = body.BaseTxId
+			}
+			txsAmount += uint64(body.TxAmount)
+			blockNum++
+			return nil
+		}); err != nil {
+			return err
+		}
+		if blockNum != to {
+			return fmt.Errorf("bodies segment has %d bodies, expected %d", blockNum-from, to-from)
+		}
+
+		var i uint64
+		if err := ForEachWord(path.Join(dir, SegmentFileName(from, to, Transactions)), func(word []byte) error {
+			if len(word) < 1+20 {
+				return fmt.Errorf("transaction %d: too short word", firstTxID+i)
+			}
+			v, err := tx.GetOne(kv.EthTx, dbutils.EncodeBlockNumber(firstTxID+i))
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(word[1+20:], v) {
+				return fmt.Errorf("transaction %d doesn't match database", firstTxID+i)
+			}
+			i++
+			return nil
+		}); err != nil {
+			return err
+		}
+		if i != txsAmount {
+			return fmt.Errorf("transactions segment has %d transactions, expected %d", i, txsAmount)
+		}
+		return nil
+	})
+}
+
+// ForEachWord - calls walker for every word of the segment, word is valid only during the call
+func ForEachWord(segmentFileName string, walker func(word []byte) error) error {
+	d, err := compress.NewDecompressor(segmentFileName)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	g := d.MakeGetter()
+	var word []byte
+	for g.HasNext() {
+		word, _ = g.Next(word[:0])
+		if err := walker(word); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func TransactionsHashIdx(chainID uint256.Int, firstTxID uint64, segmentFileName string, expectedCount uint64) error {
 	logEvery := time.NewTicker(20 * time.Second)
 	defer logEvery.Stop()
@@ -844,7 +1174,12 @@ RETRY:
 }
 
 func ForEachHeader(s *AllSnapshots, walker func(header *types.Header) error) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 	for _, sn := range s.blocks {
+		if err := s.ensureFetched(sn); err != nil {
+			return err
+		}
 		d := sn.Headers
 		g := d.MakeGetter()
 		word := make([]byte, 0, 4096)
@@ -1,12 +1,18 @@
 package snapshotsync
 
 import (
+	"context"
+	"math/big"
 	"path"
 	"testing"
 
 	"github.com/ledgerwatch/erigon-lib/compress"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
 	"github.com/ledgerwatch/erigon-lib/recsplit"
 	"github.com/ledgerwatch/erigon/common/math"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/params/networkname"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snapshothashes"
 	"github.com/stretchr/testify/require"
@@ -67,15 +73,18 @@ func TestOpenAllSnapshot(t *testing.T) {
 	defer s.Close()
 	require.Equal(2, len(s.blocks))
 
-	sn, ok := s.Blocks(10)
+	sn, ok, err := s.Blocks(10)
+	require.NoError(err)
 	require.True(ok)
 	require.Equal(int(sn.To), 500_000)
 
-	sn, ok = s.Blocks(500_000)
+	sn, ok, err = s.Blocks(500_000)
+	require.NoError(err)
 	require.True(ok)
 	require.Equal(int(sn.To), 1_000_000) // [from:to)
 
-	_, ok = s.Blocks(1_000_000)
+	_, ok, err = s.Blocks(1_000_000)
+	require.NoError(err)
 	require.False(ok)
 
 	// user must be able to limit amount of blocks which read from snapshot
@@ -86,6 +95,7 @@ func TestOpenAllSnapshot(t *testing.T) {
 	defer s.Close()
 	require.Equal(1, len(s.blocks))
 
+	// overlapping segments: merged segment and its parts exist until parts are retired, longest chain is used
 	createFile(500_000, 900_000, Headers)
 	createFile(500_000, 900_000, Bodies)
 	createFile(500_000, 900_000, Transactions)
@@ -93,9 +103,46 @@ func TestOpenAllSnapshot(t *testing.T) {
 	s = NewAllSnapshots(dir, cfg)
 	defer s.Close()
 	err = s.ReopenSegments()
+	require.NoError(err)
+	require.Equal([]Range{{0, 500_000}, {500_000, 1_000_000}}, s.Opened())
+
+	createFile(1_100_000, 1_200_000, Headers)
+	createFile(1_100_000, 1_200_000, Bodies)
+	createFile(1_100_000, 1_200_000, Transactions)
+	s = NewAllSnapshots(dir, cfg)
+	defer s.Close()
+	err = s.ReopenSegments()
 	require.Error(err)
 }
 
+func TestRetireSnapshot(t *testing.T) {
+	require := require.New(t)
+	var closed int
+	sn := &BlocksSnapshot{}
+	sn.acquire()
+	sn.acquire()
+	sn.Retire(func() { closed++ })
+	sn.Release()
+	require.Zero(closed) // still read
+	sn.Release()
+	require.Equal(1, closed)
+
+	// no readers - closed at once
+	(&BlocksSnapshot{}).Retire(func() { closed++ })
+	require.Equal(2, closed)
+}
+
+func TestChainOfRanges(t *testing.T) {
+	require := require.New(t)
+	require.Empty(ChainOfRanges(nil))
+	require.Empty(ChainOfRanges([]Range{{1_000, 2_000}}))
+	require.Equal([]Range{{0, 1_000}, {1_000, 2_000}}, ChainOfRanges([]Range{{0, 1_000}, {1_000, 2_000}, {3_000, 4_000}}))
+	// merged segment preferred over its parts
+	require.Equal([]Range{{0, 2_000}, {2_000, 3_000}}, ChainOfRanges([]Range{{0, 1_000}, {0, 2_000}, {1_000, 2_000}, {2_000, 3_000}}))
+	// longer chain preferred over fewer files
+	require.Equal([]Range{{0, 1_000}, {1_000, 3_000}}, ChainOfRanges([]Range{{0, 1_000}, {0, 2_000}, {1_000, 3_000}}))
+}
+
 func TestParseCompressedFileName(t *testing.T) {
 	require := require.New(t)
 	_, _, _, err := ParseFileName("a", ".seg")
@@ -121,3 +168,66 @@ func TestParseCompressedFileName(t *testing.T) {
 	require.Equal(1_000, int(from))
 	require.Equal(2_000, int(to))
 }
+
+func TestVerifySegments(t *testing.T) {
+	dir, require := t.TempDir(), require.New(t)
+	db := memdb.New()
+	defer db.Close()
+	require.NoError(db.Update(context.Background(), func(tx kv.RwTx) error {
+		for i := uint64(0); i < 1_000; i++ {
+			header := &types.Header{Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(1)}
+			rawdb.WriteHeader(tx, header)
+			require.NoError(rawdb.WriteCanonicalHash(tx, header.Hash(), i))
+			body := &types.RawBody{}
+			if i%10 == 0 {
+				body.Transactions = [][]byte{{0x01, byte(i)}, {0x02, byte(i)}}
+			}
+			require.NoError(rawdb.WriteRawBody(tx, header.Hash(), i, body))
+		}
+		return nil
+	}))
+
+	// words of segment in same format as Dump* functions produce, skipLast - to make broken segment
+	createSegment := func(name SnapshotType, skipLast bool) {
+		var words [][]byte
+		require.NoError(db.View(context.Background(), func(tx kv.Tx) error {
+			if name == Transactions {
+				return tx.ForEach(kv.EthTx, nil, func(k, v []byte) error {
+					words = append(words, append(make([]byte, 1+20), v...))
+					return nil
+				})
+			}
+			for i := uint64(0); i < 1_000; i++ {
+				hash, err := rawdb.ReadCanonicalHash(tx, i)
+				require.NoError(err)
+				if name == Headers {
+					words = append(words, rawdb.ReadHeaderRLP(tx, hash, i))
+				} else {
+					words = append(words, rawdb.ReadStorageBodyRLP(tx, hash, i))
+				}
+			}
+			return nil
+		}))
+		if skipLast {
+			words = words[:len(words)-1]
+		}
+		c, err := compress.NewCompressor("test", path.Join(dir, SegmentFileName(0, 1_000, name)), dir, 100)
+		require.NoError(err)
+		defer c.Close()
+		for _, word := range words {
+			require.NoError(c.AddWord(word))
+		}
+		require.NoError(c.Compress())
+	}
+
+	for _, name := range AllSnapshotTypes {
+		createSegment(name, false)
+	}
+	require.NoError(VerifySegments(db, dir, 0, 1_000))
+
+	for _, name := range AllSnapshotTypes {
+		createSegment(name, true)
+		require.Error(VerifySegments(db, dir, 0, 1_000), name)
+		createSegment(name, false)
+	}
+}
@@ -0,0 +1,174 @@
+package historysnapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/ledgerwatch/erigon-lib/compress"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// Bloom file of segment - accounts touched in blocks of segment: changed accounts for account history, owners of
+// changed storage for storage history. Lookups of other accounts skip the segment without reading index and segment.
+// Format: amount of hash functions (1 byte) + bit array.
+const (
+	bloomExt         = ".bloom"
+	bloomBitsPerKey  = 10 // ~1% of false positives
+	bloomHashes      = 7
+	bloomMinimumBits = 1024
+)
+
+func bloomFileName(from, to uint64, snapshotType snapshotsync.SnapshotType) string {
+	return snapshotsync.FileName(from, to, snapshotType) + bloomExt
+}
+
+type bloom struct {
+	hashes uint8
+	bits   []byte
+}
+
+func newBloom(keyCount int) *bloom {
+	bits := keyCount * bloomBitsPerKey
+	if bits < bloomMinimumBits {
+		bits = bloomMinimumBits
+	}
+	return &bloom{hashes: bloomHashes, bits: make([]byte, (bits+7)/8)}
+}
+
+// positions - double hashing of keccak256 of address: h1 + i*h2
+func (b *bloom) positions(addr []byte, f func(pos uint64) bool) bool {
+	h := crypto.Keccak256(addr)
+	h1, h2 := binary.BigEndian.Uint64(h), binary.BigEndian.Uint64(h[8:])
+	m := uint64(len(b.bits)) * 8
+	for i := uint64(0); i < uint64(b.hashes); i++ {
+		if !f((h1 + i*h2) % m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bloom) add(addr []byte) {
+	b.positions(addr, func(pos uint64) bool {
+		b.bits[pos/8] |= 1 << (pos % 8)
+		return true
+	})
+}
+
+// mayContain - false if account was not touched for sure
+func (b *bloom) mayContain(addr []byte) bool {
+	return b.positions(addr, func(pos uint64) bool {
+		return b.bits[pos/8]&(1<<(pos%8)) != 0
+	})
+}
+
+func (b *bloom) write(fileName string) error {
+	tmpFileName := fileName + ".tmp"
+	defer os.Remove(tmpFileName)
+	if err := ioutil.WriteFile(tmpFileName, append([]byte{b.hashes}, b.bits...), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFileName, fileName)
+}
+
+// openBloom - nil if segment has no bloom file (created before bloom files were introduced)
+func openBloom(fileName string) (*bloom, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(data) < 2 || data[0] == 0 {
+		return nil, fmt.Errorf("invalid bloom file %s", path.Base(fileName))
+	}
+	return &bloom{hashes: data[0], bits: data[1:]}, nil
+}
+
+// buildBloom - adds addresses of all words of segment, addrCount - amount of distinct addresses
+func buildBloom(segmentFileName, bloomFileName string, keyLen, addrCount int) error {
+	d, err := compress.NewDecompressor(segmentFileName)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	b := newBloom(addrCount)
+	g := d.MakeGetter()
+	var word, prevAddr []byte
+	for g.HasNext() {
+		word, _ = g.Next(word[:0])
+		if len(word) < keyLen+8 {
+			return fmt.Errorf("too short word %x", word)
+		}
+		if addr := word[:common.AddressLength]; !bytes.Equal(addr, prevAddr) {
+			b.add(addr)
+			prevAddr = append(prevAddr[:0], addr...)
+		}
+	}
+	return b.write(bloomFileName)
+}
+
+// BuildMissingBlooms - creates bloom files for segments of dir which don't have them. Segments without index are
+// skipped: they are not complete
+func BuildMissingBlooms(dir string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		from, to, snapshotType, err := snapshotsync.ParseFileName(info.Name(), ".seg")
+		if err != nil || (snapshotType != snapshotsync.AccountHistory && snapshotType != snapshotsync.StorageHistory) {
+			continue
+		}
+		if _, err = os.Stat(path.Join(dir, snapshotsync.IdxFileName(from, to, snapshotType))); err != nil {
+			continue
+		}
+		bloomFile := path.Join(dir, bloomFileName(from, to, snapshotType))
+		if _, err = os.Stat(bloomFile); err == nil {
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		addrCount, err := countAddresses(path.Join(dir, info.Name()), keyLength(snapshotType))
+		if err != nil {
+			return fmt.Errorf("%s: %w", info.Name(), err)
+		}
+		log.Info("Creating", "file", path.Base(bloomFile), "accounts", addrCount)
+		if err = buildBloom(path.Join(dir, info.Name()), bloomFile, keyLength(snapshotType), addrCount); err != nil {
+			return fmt.Errorf("%s: %w", info.Name(), err)
+		}
+	}
+	return nil
+}
+
+// countAddresses - amount of distinct addresses in segment, words are sorted by key
+func countAddresses(segmentFileName string, keyLen int) (int, error) {
+	d, err := compress.NewDecompressor(segmentFileName)
+	if err != nil {
+		return 0, err
+	}
+	defer d.Close()
+	g := d.MakeGetter()
+	var word, prevAddr []byte
+	var count int
+	for g.HasNext() {
+		word, _ = g.Next(word[:0])
+		if len(word) < keyLen+8 {
+			return 0, fmt.Errorf("too short word %x", word)
+		}
+		if addr := word[:common.AddressLength]; !bytes.Equal(addr, prevAddr) {
+			count++
+			prevAddr = append(prevAddr[:0], addr...)
+		}
+	}
+	return count, nil
+}
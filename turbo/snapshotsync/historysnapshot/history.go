@@ -0,0 +1,376 @@
+// Package historysnapshot keeps history of accounts and storage in compressed immutable files: archive queries for
+// blocks covered by files don't read AccountChangeSet/StorageChangeSet and history indices of database, so history
+// of database can be pruned.
+//
+// Word of segment: key + block number (8 bytes) + value of key before change in that block (same as in changeset).
+// Words are sorted by key and block number. Index maps key to offset of its first word in segment. Bloom file of
+// segment has accounts touched in blocks of segment, see bloom.go.
+package historysnapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/compress"
+	"github.com/ledgerwatch/erigon-lib/etl"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/recsplit"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/changeset"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// DirName - subdirectory of snapshots directory. Files are not seeded by Downloader
+const DirName = "history"
+
+var Types = []snapshotsync.SnapshotType{snapshotsync.AccountHistory, snapshotsync.StorageHistory}
+
+func changeSetBucket(snapshotType snapshotsync.SnapshotType) string {
+	if snapshotType == snapshotsync.StorageHistory {
+		return kv.StorageChangeSet
+	}
+	return kv.AccountChangeSet
+}
+
+// DumpRange - creates files of all types for blocks [from, to), by segments of segmentSize blocks. Last segment can
+// be smaller. Existing files of same ranges are replaced.
+func DumpRange(ctx context.Context, db kv.RoDB, from, to, segmentSize uint64, tmpDir, dir string) error {
+	if err := os.MkdirAll(dir, fs.ModePerm); err != nil {
+		return err
+	}
+	return db.View(ctx, func(tx kv.Tx) error {
+		for i := from; i < to; i += segmentSize {
+			end := i + segmentSize
+			if end > to {
+				end = to
+			}
+			for _, snapshotType := range Types {
+				if err := Dump(ctx, tx, snapshotType, i, end, tmpDir, dir); err != nil {
+					return fmt.Errorf("%s: %w", snapshotsync.SegmentFileName(i, end, snapshotType), err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Dump - creates segment, bloom and index of history of given type for blocks [from, to) from changesets.
+// Index is renamed last: segment without index is not opened.
+func Dump(ctx context.Context, tx kv.Tx, snapshotType snapshotsync.SnapshotType, from, to uint64, tmpDir, dir string) error {
+	logPrefix := string(snapshotType)
+	segmentFileName := path.Join(dir, snapshotsync.SegmentFileName(from, to, snapshotType))
+	idxFileName := path.Join(dir, snapshotsync.IdxFileName(from, to, snapshotType))
+	bloomFileName := path.Join(dir, bloomFileName(from, to, snapshotType))
+	log.Info("Creating", "file", filepath.Base(segmentFileName))
+
+	collector := etl.NewCollector(logPrefix, tmpDir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	defer collector.Close()
+	if err := changeset.ForRange(tx, changeSetBucket(snapshotType), from, to, func(blockN uint64, k, v []byte) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		key := make([]byte, len(k)+8)
+		copy(key, k)
+		binary.BigEndian.PutUint64(key[len(k):], blockN)
+		return collector.Collect(key, common.CopyBytes(v))
+	}); err != nil {
+		return err
+	}
+
+	c, err := compress.NewCompressor(logPrefix, segmentFileName+".tmp", tmpDir, 100)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	defer os.Remove(segmentFileName + ".tmp")
+	var prevKey, word []byte
+	var keyCount, addrCount int
+	if err = collector.Load(nil, "", func(k, v []byte, _ etl.CurrentTableReader, _ etl.LoadNextFunc) error {
+		if key := k[:len(k)-8]; !bytes.Equal(key, prevKey) {
+			if len(prevKey) == 0 || !bytes.Equal(key[:common.AddressLength], prevKey[:common.AddressLength]) {
+				addrCount++
+			}
+			keyCount++
+			prevKey = append(prevKey[:0], key...)
+		}
+		word = append(append(word[:0], k...), v...)
+		return c.AddWord(word)
+	}, etl.TransformArgs{Quit: ctx.Done()}); err != nil {
+		return err
+	}
+	if err = c.Compress(); err != nil {
+		return err
+	}
+	if err = os.Rename(segmentFileName+".tmp", segmentFileName); err != nil {
+		return err
+	}
+	if err = buildBloom(segmentFileName, bloomFileName, keyLength(snapshotType), addrCount); err != nil {
+		return fmt.Errorf("bloom: %w", err)
+	}
+	defer os.Remove(idxFileName + ".tmp")
+	if err = buildIdx(segmentFileName, idxFileName+".tmp", keyLength(snapshotType), keyCount, tmpDir); err != nil {
+		return fmt.Errorf("index: %w", err)
+	}
+	return os.Rename(idxFileName+".tmp", idxFileName)
+}
+
+func keyLength(snapshotType snapshotsync.SnapshotType) int {
+	if snapshotType == snapshotsync.StorageHistory {
+		return common.AddressLength + common.IncarnationLength + common.HashLength
+	}
+	return common.AddressLength
+}
+
+// buildIdx - maps every key to offset of its first word
+func buildIdx(segmentFileName, idxFileName string, keyLen, keyCount int, tmpDir string) error {
+	d, err := compress.NewDecompressor(segmentFileName)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	rs, err := recsplit.NewRecSplit(recsplit.RecSplitArgs{
+		KeyCount:   keyCount,
+		BucketSize: 2000,
+		LeafSize:   8,
+		TmpDir:     tmpDir,
+		IndexFile:  idxFileName,
+	})
+	if err != nil {
+		return err
+	}
+	logEvery := time.NewTicker(20 * time.Second)
+	defer logEvery.Stop()
+
+RETRY:
+	g := d.MakeGetter()
+	var pos, nextPos, wc uint64
+	var word, prevKey []byte
+	for g.HasNext() {
+		word, nextPos = g.Next(word[:0])
+		if len(word) < keyLen+8 {
+			return fmt.Errorf("too short word %x at offset %d", word, pos)
+		}
+		if key := word[:keyLen]; !bytes.Equal(key, prevKey) {
+			if err = rs.AddKey(key, pos); err != nil {
+				return err
+			}
+			prevKey = append(prevKey[:0], key...)
+		}
+		wc++
+		pos = nextPos
+		select {
+		default:
+		case <-logEvery.C:
+			log.Info("[Filling recsplit] Processed", "millions", wc/1_000_000)
+		}
+	}
+	if err = rs.Build(); err != nil {
+		if errors.Is(err, recsplit.ErrCollision) {
+			log.Info("Building recsplit. Collision happened. It's ok. Restarting with another salt...", "err", err)
+			rs.ResetNextSalt()
+			goto RETRY
+		}
+		return err
+	}
+	return nil
+}
+
+type segment struct {
+	snapshotsync.Range
+	keyLen int
+	seg    *compress.Decompressor
+	lock   sync.Mutex // Lookup of recsplit.Index is not thread-safe
+	idx    *recsplit.Index
+	bloom  *bloom // nil - segment has no bloom file
+}
+
+func openSegment(dir string, r snapshotsync.Range, snapshotType snapshotsync.SnapshotType) (*segment, error) {
+	seg, err := compress.NewDecompressor(path.Join(dir, snapshotsync.SegmentFileName(r.From, r.To, snapshotType)))
+	if err != nil {
+		return nil, err
+	}
+	idx, err := recsplit.OpenIndex(path.Join(dir, snapshotsync.IdxFileName(r.From, r.To, snapshotType)))
+	if err != nil {
+		seg.Close()
+		return nil, err
+	}
+	b, err := openBloom(path.Join(dir, bloomFileName(r.From, r.To, snapshotType)))
+	if err != nil {
+		seg.Close()
+		idx.Close()
+		return nil, err
+	}
+	return &segment{Range: r, keyLen: keyLength(snapshotType), seg: seg, idx: idx, bloom: b}, nil
+}
+
+func (s *segment) close() {
+	s.seg.Close()
+	s.idx.Close()
+}
+
+// mayContain - false if key is not in segment for sure
+func (s *segment) mayContain(key []byte) bool {
+	if s.idx.Empty() {
+		return false
+	}
+	return s.bloom == nil || s.bloom.mayContain(key[:common.AddressLength])
+}
+
+// words - calls f for words of key in order of blocks, until f returns false
+func (s *segment) words(key []byte, f func(blockNum uint64, value []byte) bool) {
+	if !s.mayContain(key) {
+		return
+	}
+	s.lock.Lock()
+	offset := s.idx.Lookup(key)
+	s.lock.Unlock()
+	// index returns some offset for absent key too
+	g := s.seg.MakeGetter()
+	g.Reset(offset)
+	for g.HasNext() {
+		word, _ := g.Next(nil)
+		if len(word) < s.keyLen+8 || !bytes.Equal(word[:s.keyLen], key) {
+			return
+		}
+		if !f(binary.BigEndian.Uint64(word[s.keyLen:]), word[s.keyLen+8:]) {
+			return
+		}
+	}
+}
+
+// find - value before first change of key in block >= timestamp
+func (s *segment) find(key []byte, timestamp uint64) (value []byte, ok bool) {
+	s.words(key, func(blockNum uint64, v []byte) bool {
+		if blockNum >= timestamp {
+			value, ok = v, true
+			return false
+		}
+		return true
+	})
+	return value, ok
+}
+
+// lastChange - last block < before which changed key
+func (s *segment) lastChange(key []byte, before uint64) (last uint64, ok bool) {
+	s.words(key, func(blockNum uint64, _ []byte) bool {
+		if blockNum >= before {
+			return false
+		}
+		last, ok = blockNum, true
+		return true
+	})
+	return last, ok
+}
+
+// Files - open history files: chain of adjacent ranges from block 0, for which files of all types exist
+type Files struct {
+	accounts []*segment
+	storage  []*segment
+	to       uint64
+}
+
+func Open(dir string) (*Files, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Files{}, nil
+		}
+		return nil, err
+	}
+	found := map[snapshotsync.Range]int{}
+	for _, info := range infos {
+		for _, ext := range []string{".seg", ".idx"} {
+			from, to, snapshotType, err := snapshotsync.ParseFileName(info.Name(), ext)
+			if err != nil {
+				continue
+			}
+			if snapshotType == snapshotsync.AccountHistory || snapshotType == snapshotsync.StorageHistory {
+				found[snapshotsync.Range{From: from, To: to}]++
+			}
+		}
+	}
+	var ranges []snapshotsync.Range
+	for r, count := range found {
+		if count == 2*len(Types) {
+			ranges = append(ranges, r)
+		}
+	}
+	f := &Files{}
+	for _, r := range snapshotsync.ChainOfRanges(ranges) {
+		accounts, err := openSegment(dir, r, snapshotsync.AccountHistory)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		f.accounts = append(f.accounts, accounts)
+		storage, err := openSegment(dir, r, snapshotsync.StorageHistory)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		f.storage = append(f.storage, storage)
+		f.to = r.To
+	}
+	return f, nil
+}
+
+func (f *Files) Close() {
+	for _, s := range f.accounts {
+		s.close()
+	}
+	for _, s := range f.storage {
+		s.close()
+	}
+	f.accounts, f.storage = nil, nil
+}
+
+// To - first block which is not covered by files
+func (f *Files) To() uint64 { return f.to }
+
+// FindByHistory - value of key before its first change in block >= timestamp, if key changed in [timestamp, To()).
+// Semantic is same as state.FindByHistory, key of storage contains incarnation.
+func (f *Files) FindByHistory(storage bool, key []byte, timestamp uint64) ([]byte, bool) {
+	segments := f.accounts
+	if storage {
+		segments = f.storage
+	}
+	i := sort.Search(len(segments), func(i int) bool { return segments[i].To > timestamp })
+	for ; i < len(segments); i++ {
+		if v, ok := segments[i].find(key, timestamp); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// LatestChange - last block < before in which key changed, if key changed in [0, min(before, To())). Segments whose
+// bloom doesn't have the account are skipped, so lookups of rarely changed accounts don't read most of segments.
+func (f *Files) LatestChange(storage bool, key []byte, before uint64) (uint64, bool) {
+	segments := f.accounts
+	if storage {
+		segments = f.storage
+	}
+	for i := len(segments) - 1; i >= 0; i-- {
+		if segments[i].From >= before {
+			continue
+		}
+		if blockNum, ok := segments[i].lastChange(key, before); ok {
+			return blockNum, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,135 @@
+package historysnapshot
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/changeset"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/stretchr/testify/require"
+)
+
+func storageKey(addr common.Address) []byte {
+	return append(dbutils.PlainGenerateStoragePrefix(addr[:], 1), common.Hash{2}.Bytes()...)
+}
+
+func TestDumpAndFind(t *testing.T) {
+	require := require.New(t)
+	db := memdb.New()
+	defer db.Close()
+
+	// every block changes one of 10 accounts and one storage slot of it, value is block number
+	var addrs []common.Address
+	for i := 0; i < 10; i++ {
+		addrs = append(addrs, common.Address{byte(i + 1)})
+	}
+	require.NoError(db.Update(context.Background(), func(tx kv.RwTx) error {
+		for b := uint64(0); b < 2_500; b++ {
+			addr := addrs[b%10]
+			accounts := changeset.NewAccountChangeSet()
+			if err := accounts.Add(addr[:], dbutils.EncodeBlockNumber(b)); err != nil {
+				return err
+			}
+			if err := changeset.EncodeAccounts(b, accounts, func(k, v []byte) error { return tx.Put(kv.AccountChangeSet, k, v) }); err != nil {
+				return err
+			}
+			storage := changeset.NewStorageChangeSet()
+			if err := storage.Add(storageKey(addr), dbutils.EncodeBlockNumber(b)); err != nil {
+				return err
+			}
+			if err := changeset.EncodeStorage(b, storage, func(k, v []byte) error { return tx.Put(kv.StorageChangeSet, k, v) }); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	dir := path.Join(t.TempDir(), DirName)
+	require.NoError(DumpRange(context.Background(), db, 0, 2_000, 1_000, t.TempDir(), dir))
+	// segment without index is not opened
+	require.NoError(os.WriteFile(path.Join(dir, snapshotsync.SegmentFileName(2_000, 3_000, snapshotsync.AccountHistory)), []byte{1}, 0644))
+
+	files, err := Open(dir)
+	require.NoError(err)
+	defer files.Close()
+	require.Equal(uint64(2_000), files.To())
+
+	for _, storage := range []bool{false, true} {
+		key := func(i int) []byte {
+			if storage {
+				return storageKey(addrs[i])
+			}
+			return addrs[i][:]
+		}
+		v, ok := files.FindByHistory(storage, key(3), 5)
+		require.True(ok)
+		require.Equal(dbutils.EncodeBlockNumber(13), v)
+		v, ok = files.FindByHistory(storage, key(3), 994) // change is in next file
+		require.True(ok)
+		require.Equal(dbutils.EncodeBlockNumber(1003), v)
+		v, ok = files.FindByHistory(storage, key(7), 1997)
+		require.True(ok)
+		require.Equal(dbutils.EncodeBlockNumber(1997), v)
+		_, ok = files.FindByHistory(storage, key(3), 1995) // changed after end of files
+		require.False(ok)
+	}
+	_, ok := files.FindByHistory(false, common.Address{0xff}.Bytes(), 5)
+	require.False(ok)
+	_, ok = files.FindByHistory(true, storageKey(common.Address{0xff}), 5)
+	require.False(ok)
+
+	for _, s := range append(files.accounts, files.storage...) {
+		require.NotNil(s.bloom)
+		require.True(s.mayContain(addrs[3][:]))
+		require.True(s.mayContain(storageKey(addrs[3])))
+	}
+	var skipped int
+	for i := 0; i < 1000; i++ {
+		if !files.accounts[0].mayContain(common.Address{0xff, byte(i >> 8), byte(i)}.Bytes()) {
+			skipped++
+		}
+	}
+	require.Greater(skipped, 950)
+
+	changed, ok := files.LatestChange(false, addrs[3][:], 1_000_000)
+	require.True(ok)
+	require.Equal(uint64(1993), changed)
+	changed, ok = files.LatestChange(false, addrs[3][:], 1003) // before given block
+	require.True(ok)
+	require.Equal(uint64(993), changed)
+	changed, ok = files.LatestChange(true, storageKey(addrs[3]), 1004)
+	require.True(ok)
+	require.Equal(uint64(1003), changed)
+	_, ok = files.LatestChange(false, addrs[3][:], 3)
+	require.False(ok)
+	_, ok = files.LatestChange(false, common.Address{0xff}.Bytes(), 1_000_000)
+	require.False(ok)
+
+	// files without blooms are still opened, blooms are created for them
+	files.Close()
+	bloomFile := path.Join(dir, bloomFileName(0, 1_000, snapshotsync.AccountHistory))
+	require.NoError(os.Remove(bloomFile))
+	files, err = Open(dir)
+	require.NoError(err)
+	defer files.Close()
+	require.Nil(files.accounts[0].bloom)
+	v, ok := files.FindByHistory(false, addrs[3][:], 5)
+	require.True(ok)
+	require.Equal(dbutils.EncodeBlockNumber(13), v)
+	require.NoError(BuildMissingBlooms(dir))
+	require.FileExists(bloomFile)
+}
+
+func TestOpenEmpty(t *testing.T) {
+	files, err := Open(path.Join(t.TempDir(), DirName))
+	require.NoError(t, err)
+	require.Zero(t, files.To())
+	_, ok := files.FindByHistory(false, common.Address{1}.Bytes(), 0)
+	require.False(t, ok)
+}
@@ -41,6 +41,14 @@ const maxPatternLen = 64
 // minPatternScore is minimum score (per superstring) required to consider including pattern into the dictionary
 const minPatternScore = 1024
 
+// workersAmount - half of CPUs, but at least one: without workers nobody reads the channel
+func workersAmount() int {
+	if n := runtime.NumCPU() / 2; n > 0 {
+		return n
+	}
+	return 1
+}
+
 func Compress(logPrefix, fileName, segmentFileName string) error {
 	logEvery := time.NewTicker(20 * time.Second)
 	defer logEvery.Stop()
@@ -49,7 +57,7 @@ func Compress(logPrefix, fileName, segmentFileName string) error {
 	// We only consider values with length > 2, because smaller values are not compressible without going into bits
 	var superstring []byte
 
-	workers := runtime.NumCPU() / 2
+	workers := workersAmount()
 	// Collector for dictionary words (sorted by their score)
 	tmpDir := ""
 	ch := make(chan []byte, workers)
@@ -622,7 +630,7 @@ func reducedict(name string, segmentFileName string) error {
 	ch := make(chan []byte, 10000)
 	inputSize, outputSize := atomic2.NewUint64(0), atomic2.NewUint64(0)
 	var wg sync.WaitGroup
-	workers := runtime.NumCPU() / 2
+	workers := workersAmount()
 	var collectors []*etl.Collector
 	defer func() {
 		for _, c := range collectors {
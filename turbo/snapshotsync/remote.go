@@ -0,0 +1,424 @@
+package snapshotsync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ledgerwatch/erigon/turbo/s3"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snapshothashes"
+	"github.com/ledgerwatch/log/v3"
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	// FetchChunkSize - files are fetched by parallel ranged GETs of this size
+	FetchChunkSize int64 = 32 * 1024 * 1024
+	fetchParallel        = 8
+	fetchRetries         = 3
+)
+
+// TorrentPieceSize - piece size of .torrent files of segments, info hashes of preverified segments depend on it
+const TorrentPieceSize = 1 * 1024 * 1024
+
+// RemoteStorage - S3-compatible bucket (AWS S3, MinIO, GCS by its XML API) with snapshot files, for archive nodes which
+// keep cold segments in object storage. Segments missing in local directory are fetched from the bucket: at once by
+// ReopenSegments, or in lazy mode on first read of their blocks. There are no reads of single blocks from the bucket:
+// segment files are memory-mapped, so first read of lazy segment downloads all its files (by parallel ranged GETs)
+// and keeps them in local directory as cache of CacheSize, least recently read segments are evicted. Indices are
+// small and always fetched by ReopenSegments. Fetched files of preverified segments must have their info hashes.
+type RemoteStorage struct {
+	client    *s3.Client
+	prefix    string
+	dir       string
+	Lazy      bool   // fetch whole segment on first read of its blocks, instead of ReopenSegments
+	CacheSize uint64 // bytes of lazily fetched segments kept in local directory, 0 - unlimited
+
+	preverified snapshothashes.Preverified // name -> info hash, see AllSnapshots.SetRemote
+
+	lock  sync.Mutex
+	files map[string]int64 // name -> size
+}
+
+// NewRemoteStorage - bucket of `s3://bucket/prefix?endpoint=...`, see s3.Parse. dir - local directory of snapshots
+func NewRemoteStorage(url, dir string) (*RemoteStorage, error) {
+	client, prefix, err := s3.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteStorage{client: client, prefix: prefix, dir: dir, files: map[string]int64{}}, nil
+}
+
+func (r *RemoteStorage) key(name string) string {
+	if r.prefix == "" {
+		return name
+	}
+	return r.prefix + "/" + name
+}
+
+// Refresh - lists files of the bucket
+func (r *RemoteStorage) Refresh(ctx context.Context) error {
+	objects, err := r.client.List(ctx, r.key(""))
+	if err != nil {
+		return err
+	}
+	files := make(map[string]int64, len(objects))
+	for _, o := range objects {
+		name := strings.TrimPrefix(o.Key, r.key(""))
+		if IsCorrectFileName(name) {
+			files[name] = o.Size
+		}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.files = files
+	return nil
+}
+
+// Files - names of files in the bucket, sorted
+func (r *RemoteStorage) Files() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	names := make([]string, 0, len(r.files))
+	for name := range r.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *RemoteStorage) Size(name string) (int64, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	size, ok := r.files[name]
+	return size, ok
+}
+
+// Has - all segments of the range are in the bucket
+func (r *RemoteStorage) Has(rng Range) bool {
+	for _, snapshotType := range AllSnapshotTypes {
+		if _, ok := r.Size(SegmentFileName(rng.From, rng.To, snapshotType)); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Fetch - downloads file into local directory by parallel ranged GETs, file appears when it's complete and verified
+func (r *RemoteStorage) Fetch(ctx context.Context, name string) error {
+	size, ok := r.Size(name)
+	if !ok {
+		return fmt.Errorf("%s is not in remote storage", name)
+	}
+	started := time.Now()
+	tmp := path.Join(r.dir, name+".part")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err = f.Truncate(size); err != nil {
+		f.Close()
+		return err
+	}
+	g, gctx := errgroup.WithContext(ctx)
+	chunks := make(chan int64)
+	for i := 0; i < fetchParallel; i++ {
+		g.Go(func() error {
+			for offset := range chunks {
+				length := FetchChunkSize
+				if offset+length > size {
+					length = size - offset
+				}
+				var err error
+				for attempt := 0; attempt < fetchRetries; attempt++ {
+					if err = r.fetchChunk(gctx, f, name, offset, length); err == nil || gctx.Err() != nil {
+						break
+					}
+				}
+				if err != nil {
+					return fmt.Errorf("fetching %s from %d: %w", name, offset, err)
+				}
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		defer close(chunks)
+		for offset := int64(0); offset < size; offset += FetchChunkSize {
+			select {
+			case chunks <- offset:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+		}
+		return nil
+	})
+	if err = g.Wait(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = r.verify(name, tmp); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path.Join(r.dir, name)); err != nil {
+		return err
+	}
+	log.Info("[snapshots] Fetched from remote storage", "file", name, "size", size, "took", time.Since(started))
+	return nil
+}
+
+// verify - fetched file of preverified segment must have its info hash: bucket may have corrupted or other files
+func (r *RemoteStorage) verify(name, fetched string) error {
+	expected, ok := r.preverified[name]
+	if !ok {
+		return nil
+	}
+	hash, err := InfoHash(fetched, name)
+	if err != nil {
+		return err
+	}
+	if hash != metainfo.NewHashFromHex(expected) {
+		return fmt.Errorf("fetched %s has info hash %x, expected %s", name, hash, expected)
+	}
+	return nil
+}
+
+// InfoHash - info hash of .torrent file of given file, named as name
+func InfoHash(filePath, name string) (metainfo.Hash, error) {
+	info := &metainfo.Info{PieceLength: TorrentPieceSize}
+	if err := info.BuildFromFilePath(filePath); err != nil {
+		return metainfo.Hash{}, err
+	}
+	info.Name = name
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		return metainfo.Hash{}, err
+	}
+	return metainfo.HashBytes(infoBytes), nil
+}
+
+func (r *RemoteStorage) fetchChunk(ctx context.Context, f *os.File, name string, offset, length int64) error {
+	body, err := r.client.GetRange(ctx, r.key(name), offset, length)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	n, err := io.Copy(&offsetWriter{f: f, offset: offset}, io.LimitReader(body, length))
+	if err != nil {
+		return err
+	}
+	if n != length {
+		return fmt.Errorf("got %d bytes of %d", n, length)
+	}
+	return nil
+}
+
+type offsetWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// Upload - uploads file of local directory into the bucket
+func (r *RemoteStorage) Upload(ctx context.Context, name string) error {
+	f, err := os.Open(path.Join(r.dir, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := r.client.Create(ctx, r.key(name))
+	n, err := io.Copy(w, f)
+	if err != nil {
+		w.Abort()
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.files[name] = n
+	return nil
+}
+
+// lazySegment - state of segment which is fetched from remote storage on first read
+type lazySegment struct {
+	lock       sync.Mutex
+	fetched    uint32 // atomic, 1 - segments are open
+	lastAccess int64  // atomic, unix nanoseconds
+	size       int64
+}
+
+// SetRemote - segments are fetched from remote storage, before ReopenSegments. Fetched files of preverified segments
+// of chain config are verified.
+func (s *AllSnapshots) SetRemote(r *RemoteStorage) {
+	if s.cfg != nil {
+		r.preverified = s.cfg.Preverified
+	}
+	s.remote = r
+}
+
+// Remote - segments of the range are read from remote storage
+func (s *AllSnapshots) Remote(r Range) bool {
+	return s.remote != nil && s.remote.Has(r)
+}
+
+// fetchRemote - before reopen: indices of all segments of the bucket, and segments if it's not lazy
+func (s *AllSnapshots) fetchRemote(ctx context.Context) error {
+	if err := s.remote.Refresh(ctx); err != nil {
+		return err
+	}
+	for _, name := range s.remote.Files() {
+		ext := path.Ext(name)
+		if ext != ".idx" && (ext != ".seg" || s.remote.Lazy) {
+			continue
+		}
+		if _, err := os.Stat(path.Join(s.dir, name)); err == nil {
+			continue
+		}
+		if err := s.remote.Fetch(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remoteFiles - names of files of given type and extension in the bucket
+func (s *AllSnapshots) remoteFiles(ofType SnapshotType, ext string) []string {
+	var res []string
+	for _, name := range s.remote.Files() {
+		if path.Ext(name) == ext && strings.Contains(name, string(ofType)) {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// remoteRanges - ranges for which segments of all types are in the bucket
+func (s *AllSnapshots) remoteRanges() ([]Range, error) {
+	ranges, err := fileRanges(s.remoteFiles(Headers, ".seg"), ".seg")
+	if err != nil {
+		return nil, err
+	}
+	var res []Range
+	for _, r := range ranges {
+		if s.remote.Has(r) {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+func (s *AllSnapshots) openLazy(r Range) *BlocksSnapshot {
+	sn := &BlocksSnapshot{From: r.From, To: r.To, lazy: &lazySegment{}}
+	for _, snapshotType := range AllSnapshotTypes {
+		size, _ := s.remote.Size(SegmentFileName(r.From, r.To, snapshotType))
+		sn.lazy.size += size
+	}
+	return sn
+}
+
+// ensureFetched - fetches and opens segments of lazy snapshot
+func (s *AllSnapshots) ensureFetched(sn *BlocksSnapshot) error {
+	if sn.lazy == nil {
+		return nil
+	}
+	atomic.StoreInt64(&sn.lazy.lastAccess, time.Now().UnixNano())
+	if atomic.LoadUint32(&sn.lazy.fetched) == 1 {
+		return nil
+	}
+	sn.lazy.lock.Lock()
+	defer sn.lazy.lock.Unlock()
+	if atomic.LoadUint32(&sn.lazy.fetched) == 1 {
+		return nil
+	}
+	for _, snapshotType := range AllSnapshotTypes {
+		name := SegmentFileName(sn.From, sn.To, snapshotType)
+		if _, err := os.Stat(path.Join(s.dir, name)); err == nil {
+			continue
+		}
+		if err := s.remote.Fetch(context.Background(), name); err != nil {
+			return err
+		}
+	}
+	opened, err := OpenBlocksSnapshot(s.dir, Range{From: sn.From, To: sn.To})
+	if err != nil {
+		return err
+	}
+	sn.Headers, sn.Bodies, sn.Transactions = opened.Headers, opened.Bodies, opened.Transactions
+	atomic.StoreUint32(&sn.lazy.fetched, 1)
+	go s.evictLazy()
+	return nil
+}
+
+// evictLazy - replaces least recently read lazy snapshots by not fetched ones, until fetched fit into cache
+func (s *AllSnapshots) evictLazy() {
+	if s.remote.CacheSize == 0 {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var fetched []int
+	var total uint64
+	for i, sn := range s.blocks {
+		if sn.lazy != nil && atomic.LoadUint32(&sn.lazy.fetched) == 1 {
+			fetched = append(fetched, i)
+			total += uint64(sn.lazy.size)
+		}
+	}
+	sort.Slice(fetched, func(i, j int) bool {
+		return atomic.LoadInt64(&s.blocks[fetched[i]].lazy.lastAccess) < atomic.LoadInt64(&s.blocks[fetched[j]].lazy.lastAccess)
+	})
+	// the most recently read segment stays even if it's bigger than cache
+	for len(fetched) > 1 && total > s.remote.CacheSize {
+		i := fetched[0]
+		old := s.blocks[i]
+		fetched = fetched[1:]
+		total -= uint64(old.lazy.size)
+		evicted := s.openLazy(Range{From: old.From, To: old.To})
+		if old.HeaderHashIdx != nil {
+			if err := evicted.OpenIdx(s.dir); err != nil {
+				log.Warn("[snapshots] Can't evict segment", "range", Range{From: old.From, To: old.To}, "err", err)
+				evicted.Close()
+				continue
+			}
+		}
+		s.blocks[i] = evicted
+		log.Debug("[snapshots] Evicted segment fetched from remote storage", "range", Range{From: old.From, To: old.To})
+		old.Retire(func() {
+			// segment may be fetched again meanwhile
+			evicted.lazy.lock.Lock()
+			defer evicted.lazy.lock.Unlock()
+			if atomic.LoadUint32(&evicted.lazy.fetched) == 1 {
+				return
+			}
+			for _, snapshotType := range AllSnapshotTypes {
+				if err := os.Remove(path.Join(s.dir, SegmentFileName(evicted.From, evicted.To, snapshotType))); err != nil && !os.IsNotExist(err) {
+					log.Warn("[snapshots] Can't remove evicted segment", "err", err)
+				}
+			}
+		})
+	}
+}
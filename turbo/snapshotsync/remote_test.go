@@ -0,0 +1,198 @@
+package snapshotsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/compress"
+	"github.com/ledgerwatch/erigon-lib/recsplit"
+	"github.com/ledgerwatch/erigon/common/math"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snapshothashes"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBucket - in-memory bucket serving list, get (with ranges) and put of whole objects
+type fakeBucket struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	gets    int
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/bucket"), "/")
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		type object struct {
+			Key  string
+			Size int64
+		}
+		var result struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []object
+		}
+		for k, v := range b.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				result.Contents = append(result.Contents, object{Key: k, Size: int64(len(v))})
+			}
+		}
+		_ = xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodGet:
+		v, ok := b.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		b.gets++
+		http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(v))
+	case r.Method == http.MethodPut:
+		b.objects[key], _ = ioutil.ReadAll(r.Body)
+	}
+}
+
+func createTestSegments(t *testing.T, dir string, r Range) {
+	for _, snapshotType := range AllSnapshotTypes {
+		c, err := compress.NewCompressor("test", path.Join(dir, SegmentFileName(r.From, r.To, snapshotType)), dir, 100)
+		require.NoError(t, err)
+		require.NoError(t, c.AddWord([]byte{1}))
+		require.NoError(t, c.Compress())
+		c.Close()
+		idx, err := recsplit.NewRecSplit(recsplit.RecSplitArgs{
+			KeyCount:   1,
+			BucketSize: 10,
+			TmpDir:     dir,
+			IndexFile:  path.Join(dir, IdxFileName(r.From, r.To, snapshotType)),
+			LeafSize:   8,
+		})
+		require.NoError(t, err)
+		require.NoError(t, idx.AddKey([]byte{1}, 0))
+		require.NoError(t, idx.Build())
+	}
+}
+
+func TestRemoteStorage(t *testing.T) {
+	ctx := context.Background()
+	bucket := &fakeBucket{objects: map[string][]byte{}}
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+	for k, v := range map[string]string{"AWS_ACCESS_KEY_ID": "key", "AWS_SECRET_ACCESS_KEY": "secret"} {
+		require.NoError(t, os.Setenv(k, v))
+		defer os.Unsetenv(k)
+	}
+	defer func(size int64) { FetchChunkSize = size }(FetchChunkSize)
+	FetchChunkSize = 7
+	url := "s3://bucket/mainnet?endpoint=" + server.URL
+
+	// cold segments are offloaded, hot ones stay in local directory
+	dir := t.TempDir()
+	cold := []Range{{0, 500_000}, {500_000, 1_000_000}}
+	for _, r := range append(cold, Range{1_000_000, 1_500_000}) {
+		createTestSegments(t, dir, r)
+	}
+	// preverified segments are verified by info hashes after fetching
+	cfg := &snapshothashes.Config{ExpectBlocks: math.MaxUint64, Preverified: snapshothashes.Preverified{}}
+	for _, name := range []string{SegmentFileName(0, 500_000, Headers), SegmentFileName(500_000, 1_000_000, Headers)} {
+		hash, err := InfoHash(path.Join(dir, name), name)
+		require.NoError(t, err)
+		cfg.Preverified[name] = hash.HexString()
+	}
+	remote, err := NewRemoteStorage(url, dir)
+	require.NoError(t, err)
+	for _, r := range cold {
+		for _, snapshotType := range AllSnapshotTypes {
+			for _, name := range []string{SegmentFileName(r.From, r.To, snapshotType), IdxFileName(r.From, r.To, snapshotType)} {
+				require.NoError(t, remote.Upload(ctx, name))
+				require.NoError(t, os.Remove(path.Join(dir, name)))
+			}
+		}
+	}
+	require.Contains(t, bucket.objects, "mainnet/"+SegmentFileName(0, 500_000, Headers))
+
+	s := NewAllSnapshots(dir, cfg)
+	defer s.Close()
+	remote.Lazy, remote.CacheSize = true, 1
+	s.SetRemote(remote)
+	headers, _, _, err := s.SegmentsAvailability()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1_500_000-1), headers)
+	require.NoError(t, s.ReopenSegments())
+	require.Equal(t, []Range{{0, 500_000}, {500_000, 1_000_000}, {1_000_000, 1_500_000}}, s.Opened())
+	require.True(t, s.Remote(Range{0, 500_000}))
+	require.False(t, s.Remote(Range{1_000_000, 1_500_000}))
+
+	// indices are fetched at once, segments on first read
+	_, err = os.Stat(path.Join(dir, IdxFileName(0, 500_000, Headers)))
+	require.NoError(t, err)
+	_, err = os.Stat(path.Join(dir, SegmentFileName(0, 500_000, Headers)))
+	require.True(t, os.IsNotExist(err))
+	gets := bucket.gets
+	sn, ok, err := s.Blocks(10)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NotNil(t, sn.Headers)
+	require.Greater(t, bucket.gets, gets+len(AllSnapshotTypes)) // by several ranged GETs
+	_, err = os.Stat(path.Join(dir, SegmentFileName(0, 500_000, Headers)))
+	require.NoError(t, err)
+	gets = bucket.gets
+	reader, ok, err := s.Blocks(20)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, gets, bucket.gets)
+	sn.Release()
+
+	// cache is smaller than two segments: least recently read one is evicted, and removed after its last reader
+	sn, ok, err = s.Blocks(600_000)
+	require.NoError(t, err)
+	require.True(t, ok)
+	sn.Release()
+	require.Eventually(t, func() bool { return !isFetched(s, Range{0, 500_000}) }, 5*time.Second, 10*time.Millisecond)
+	_, err = os.Stat(path.Join(dir, SegmentFileName(0, 500_000, Headers)))
+	require.NoError(t, err)
+	require.Equal(t, 1, reader.Headers.Count())
+	reader.Release()
+	_, err = os.Stat(path.Join(dir, SegmentFileName(0, 500_000, Headers)))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path.Join(dir, SegmentFileName(500_000, 1_000_000, Headers)))
+	require.NoError(t, err)
+	sn, ok, err = s.Blocks(10)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NotNil(t, sn.Headers)
+	sn.Release()
+
+	// segment which doesn't match preverified hash isn't used, failed fetch is error - not absent block
+	require.Eventually(t, func() bool { return !isFetched(s, Range{500_000, 1_000_000}) }, 5*time.Second, 10*time.Millisecond)
+	bucket.mu.Lock()
+	corrupted := bucket.objects["mainnet/"+SegmentFileName(500_000, 1_000_000, Headers)]
+	corrupted[len(corrupted)-1]++
+	bucket.mu.Unlock()
+	_, ok, err = s.Blocks(600_000)
+	require.Error(t, err)
+	require.False(t, ok)
+	_, err = os.Stat(path.Join(dir, SegmentFileName(500_000, 1_000_000, Headers)))
+	require.True(t, os.IsNotExist(err))
+}
+
+// isFetched - segments of the range are fetched and open
+func isFetched(s *AllSnapshots, r Range) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, sn := range s.blocks {
+		if sn.From == r.From && sn.To == r.To {
+			return sn.lazy == nil || atomic.LoadUint32(&sn.lazy.fetched) == 1
+		}
+	}
+	return false
+}
@@ -0,0 +1,336 @@
+// Package snapshotmerge merges small adjacent block segments into bigger ones, in background and without pauses of sync:
+// merged segment and its indices are built in temporary directory, moved to snapshots directory, replace its parts
+// in open snapshots atomically, and parts are deleted when their last reader releases them.
+package snapshotmerge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/compress"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/maintenance"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync/parallelcompress"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// DefaultSteps - segments are merged into segments of 100K blocks, and then those into segments of 500K blocks
+var DefaultSteps = []uint64{100_000, 500_000}
+
+const tmpDirName = "merge.tmp"
+
+type Merger struct {
+	snapshots *snapshotsync.AllSnapshots
+	chainID   uint256.Int
+	steps     []uint64
+
+	maintenance maintenance.Windows
+}
+
+func NewMerger(snapshots *snapshotsync.AllSnapshots, chainID uint256.Int, steps []uint64) *Merger {
+	return &Merger{snapshots: snapshots, chainID: chainID, steps: steps}
+}
+
+// SetMaintenance - Loop merges only inside of given windows, empty - at any time
+func (m *Merger) SetMaintenance(windows maintenance.Windows) { m.maintenance = windows }
+
+// FindMerge - finds first range [k*step, (k+1)*step) which is fully covered by at least 2 adjacent segments,
+// smallest steps first. Preverified segments are not merged: Downloader would download them again. Segments of
+// remote storage are not merged too: they are cold, and may be absent in local directory.
+func FindMerge(segments []snapshotsync.Range, steps []uint64, preverified func(r snapshotsync.Range) bool) (merged snapshotsync.Range, parts []snapshotsync.Range, ok bool) {
+	for _, step := range steps {
+		for i := 0; i < len(segments); {
+			window := snapshotsync.Range{From: segments[i].From - segments[i].From%step}
+			window.To = window.From + step
+			j := i
+			var skip bool
+			for j < len(segments) && segments[j].To <= window.To {
+				skip = skip || segments[j].From < window.From || (j > i && segments[j].From != segments[j-1].To) || preverified(segments[j])
+				j++
+			}
+			if j == i { // segment is bigger than step
+				i++
+				continue
+			}
+			if !skip && j-i >= 2 && segments[i].From == window.From && segments[j-1].To == window.To {
+				return window, segments[i:j], true
+			}
+			i = j
+		}
+	}
+	return snapshotsync.Range{}, nil, false
+}
+
+// excluded - preverified segments and segments of remote storage
+func (m *Merger) excluded(r snapshotsync.Range) bool {
+	if m.snapshots.Remote(r) {
+		return true
+	}
+	cfg := m.snapshots.ChainSnapshotConfig()
+	if cfg == nil {
+		return false
+	}
+	for _, snapshotType := range snapshotsync.AllSnapshotTypes {
+		if _, ok := cfg.Preverified[snapshotsync.SegmentFileName(r.From, r.To, snapshotType)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Loop - merges segments every interval, if it's inside of maintenance windows
+func (m *Merger) Loop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if !m.maintenance.Allowed(time.Now()) {
+			log.Debug("[snapshots] Merge deferred till maintenance window", "in", m.maintenance.UntilNext(time.Now()).Truncate(time.Minute))
+		} else if _, err := m.MergeAll(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn("[snapshots] Merge failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// MergeAll - merges segments until nothing to merge, returns amount of merges
+func (m *Merger) MergeAll(ctx context.Context) (int, error) {
+	// segments are opened and their indices built by Headers stage, until then files may be in use by it
+	if !m.snapshots.AllIdxAvailable() {
+		return 0, nil
+	}
+	if err := m.retireCovered(); err != nil {
+		return 0, err
+	}
+	for merges := 0; ; merges++ {
+		if err := ctx.Err(); err != nil {
+			return merges, err
+		}
+		ranges, err := m.snapshots.SegmentRanges()
+		if err != nil {
+			return merges, err
+		}
+		merged, parts, ok := FindMerge(snapshotsync.ChainOfRanges(ranges), m.steps, m.excluded)
+		if !ok {
+			return merges, nil
+		}
+		log.Info("[snapshots] Merging segments", "range", merged, "parts", len(parts))
+		if err = m.merge(ctx, merged, parts); err != nil {
+			return merges, err
+		}
+	}
+}
+
+func isOpen(opened []snapshotsync.Range, parts []snapshotsync.Range) bool {
+	for _, o := range opened {
+		for _, p := range parts {
+			if o == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *Merger) merge(ctx context.Context, merged snapshotsync.Range, parts []snapshotsync.Range) error {
+	dir := m.snapshots.Dir()
+	tmpDir := path.Join(dir, tmpDirName)
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, snapshotType := range snapshotsync.AllSnapshotTypes {
+		if err := mergeSegments(ctx, dir, tmpDir, merged, parts, snapshotType); err != nil {
+			return err
+		}
+	}
+	if err := m.buildIndices(tmpDir, merged); err != nil {
+		return err
+	}
+
+	// indices first and headers last: segments are opened by list of headers segments, and merged range is
+	// used only if segments of all types exist
+	var files []string
+	for _, snapshotType := range snapshotsync.AllSnapshotTypes {
+		files = append(files, snapshotsync.IdxFileName(merged.From, merged.To, snapshotType))
+	}
+	files = append(files,
+		snapshotsync.SegmentFileName(merged.From, merged.To, snapshotsync.Bodies),
+		snapshotsync.SegmentFileName(merged.From, merged.To, snapshotsync.Transactions),
+		snapshotsync.SegmentFileName(merged.From, merged.To, snapshotsync.Headers),
+	)
+	for _, f := range files {
+		if err := os.Rename(path.Join(tmpDir, f), path.Join(dir, f)); err != nil {
+			return err
+		}
+	}
+
+	if !isOpen(m.snapshots.Opened(), parts) {
+		return removeFiles(dir, parts)
+	}
+	sn, err := snapshotsync.OpenBlocksSnapshot(dir, merged)
+	if err != nil {
+		return err
+	}
+	if err = sn.OpenIdx(dir); err != nil {
+		sn.Close()
+		return err
+	}
+	replaced, err := m.snapshots.Replace(sn)
+	if err != nil {
+		sn.Close()
+		return err
+	}
+	// parts which weren't open are removed now, replaced ones - after their last reader
+	retired := map[snapshotsync.Range]bool{}
+	for _, old := range replaced {
+		r := snapshotsync.Range{From: old.From, To: old.To}
+		retired[r] = true
+		old.Retire(func() {
+			if err := removeFiles(dir, []snapshotsync.Range{r}); err != nil {
+				log.Warn("[snapshots] Can't remove merged segment", "range", r, "err", err)
+			}
+		})
+	}
+	var notOpen []snapshotsync.Range
+	for _, p := range parts {
+		if !retired[p] {
+			notOpen = append(notOpen, p)
+		}
+	}
+	return removeFiles(dir, notOpen)
+}
+
+func mergeSegments(ctx context.Context, dir, tmpDir string, merged snapshotsync.Range, parts []snapshotsync.Range, snapshotType snapshotsync.SnapshotType) error {
+	tmpFileName := path.Join(tmpDir, snapshotsync.FileName(merged.From, merged.To, snapshotType))
+	f, err := snapshotsync.NewSimpleFile(tmpFileName + ".dat")
+	if err != nil {
+		return err
+	}
+	var expectedCount int
+	for _, p := range parts {
+		if err = snapshotsync.ForEachWord(path.Join(dir, snapshotsync.SegmentFileName(p.From, p.To, snapshotType)), func(word []byte) error {
+			expectedCount++
+			return f.Append(word)
+		}); err != nil {
+			f.Close()
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	f.Close()
+
+	segmentFileName := path.Join(tmpDir, snapshotsync.SegmentFileName(merged.From, merged.To, snapshotType))
+	if err = parallelcompress.Compress(string(snapshotType), tmpFileName, segmentFileName); err != nil {
+		return err
+	}
+	d, err := compress.NewDecompressor(segmentFileName)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if d.Count() != expectedCount {
+		return fmt.Errorf("merged %s segment has %d words, expected %d", snapshotType, d.Count(), expectedCount)
+	}
+	return nil
+}
+
+func (m *Merger) buildIndices(tmpDir string, merged snapshotsync.Range) error {
+	headers := path.Join(tmpDir, snapshotsync.SegmentFileName(merged.From, merged.To, snapshotsync.Headers))
+	if err := snapshotsync.HeadersHashIdx(headers, merged.From); err != nil {
+		return err
+	}
+	bodies := path.Join(tmpDir, snapshotsync.SegmentFileName(merged.From, merged.To, snapshotsync.Bodies))
+	if err := snapshotsync.BodiesIdx(bodies, merged.From); err != nil {
+		return err
+	}
+	firstTxID, txsAmount, err := txsRange(bodies)
+	if err != nil {
+		return err
+	}
+	txs := path.Join(tmpDir, snapshotsync.SegmentFileName(merged.From, merged.To, snapshotsync.Transactions))
+	return snapshotsync.TransactionsHashIdx(m.chainID, firstTxID, txs, txsAmount)
+}
+
+// txsRange - id of first transaction and amount of transactions of bodies segment
+func txsRange(bodiesSegment string) (firstTxID, amount uint64, err error) {
+	var first, last *types.BodyForStorage
+	if err = snapshotsync.ForEachWord(bodiesSegment, func(word []byte) error {
+		last = new(types.BodyForStorage)
+		if err := rlp.DecodeBytes(word, last); err != nil {
+			return err
+		}
+		if first == nil {
+			first = last
+		}
+		return nil
+	}); err != nil {
+		return 0, 0, err
+	}
+	if first == nil {
+		return 0, 0, fmt.Errorf("empty bodies segment %s", bodiesSegment)
+	}
+	return first.BaseTxId, last.BaseTxId + uint64(last.TxAmount) - first.BaseTxId, nil
+}
+
+// retireCovered - removes segments covered by other segments, which are left if node stopped before their retirement
+func (m *Merger) retireCovered() error {
+	dir := m.snapshots.Dir()
+	ranges, err := snapshotsync.SegmentRanges(dir)
+	if err != nil {
+		return err
+	}
+	opened := m.snapshots.Opened()
+	var covered []snapshotsync.Range
+	for _, r := range ranges {
+		if isOpen(opened, []snapshotsync.Range{r}) {
+			continue
+		}
+		for _, other := range ranges {
+			if other != r && other.From <= r.From && r.To <= other.To {
+				covered = append(covered, r)
+				break
+			}
+		}
+	}
+	if len(covered) == 0 {
+		return nil
+	}
+	log.Info("[snapshots] Removing merged segments", "amount", len(covered))
+	return removeFiles(dir, covered)
+}
+
+// removeFiles - removes segments, indices and .torrent files of given ranges
+func removeFiles(dir string, ranges []snapshotsync.Range) error {
+	for _, r := range ranges {
+		for _, snapshotType := range snapshotsync.AllSnapshotTypes {
+			segment := snapshotsync.SegmentFileName(r.From, r.To, snapshotType)
+			for _, f := range []string{segment, segment + ".torrent", snapshotsync.IdxFileName(r.From, r.To, snapshotType)} {
+				if err := os.Remove(path.Join(dir, f)); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package snapshotmerge
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/compress"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/snapshotsync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindMerge(t *testing.T) {
+	require := require.New(t)
+	none := func(r snapshotsync.Range) bool { return false }
+	steps := []uint64{10_000, 50_000}
+
+	_, _, ok := FindMerge(nil, steps, none)
+	require.False(ok)
+
+	segments := []snapshotsync.Range{{From: 0, To: 50_000}, {From: 50_000, To: 51_000}, {From: 51_000, To: 55_000}, {From: 55_000, To: 60_000}, {From: 60_000, To: 61_000}}
+	merged, parts, ok := FindMerge(segments, steps, none)
+	require.True(ok)
+	require.Equal(snapshotsync.Range{From: 50_000, To: 60_000}, merged)
+	require.Equal(segments[1:4], parts)
+
+	// window is not fully covered yet
+	_, _, ok = FindMerge(segments[:3], steps, none)
+	require.False(ok)
+
+	// bigger step after smaller ones
+	segments = []snapshotsync.Range{{From: 0, To: 10_000}, {From: 10_000, To: 20_000}, {From: 20_000, To: 30_000}, {From: 30_000, To: 40_000}, {From: 40_000, To: 50_000}, {From: 50_000, To: 51_000}}
+	merged, parts, ok = FindMerge(segments, steps, none)
+	require.True(ok)
+	require.Equal(snapshotsync.Range{From: 0, To: 50_000}, merged)
+	require.Equal(segments[:5], parts)
+
+	// overlapping segments, which are not retired yet
+	_, _, ok = FindMerge([]snapshotsync.Range{{From: 0, To: 5_000}, {From: 0, To: 10_000}, {From: 5_000, To: 10_000}}, steps, none)
+	require.False(ok)
+
+	// preverified segments are not merged
+	_, _, ok = FindMerge(segments, steps, func(r snapshotsync.Range) bool { return r.From == 20_000 })
+	require.False(ok)
+}
+
+func createSegment(t *testing.T, dir string, r snapshotsync.Range, snapshotType snapshotsync.SnapshotType, words [][]byte) {
+	c, err := compress.NewCompressor("test", path.Join(dir, snapshotsync.SegmentFileName(r.From, r.To, snapshotType)), dir, 100)
+	require.NoError(t, err)
+	defer c.Close()
+	for _, word := range words {
+		require.NoError(t, c.AddWord(word))
+	}
+	require.NoError(t, c.Compress())
+}
+
+func TestMergeAll(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	// compressor writes huffman codes to working directory
+	wd, err := os.Getwd()
+	require.NoError(err)
+	require.NoError(os.Chdir(t.TempDir()))
+	defer os.Chdir(wd) //nolint:errcheck
+
+	key, err := crypto.GenerateKey()
+	require.NoError(err)
+	chainID := uint256.NewInt(1)
+	signer := types.LatestSignerForChainID(chainID.ToBig())
+
+	// blocks 0..1999 in 2 segments, every 10th block has transaction
+	var baseTxID uint64
+	var parentHash common.Hash
+	for _, r := range []snapshotsync.Range{{From: 0, To: 1_000}, {From: 1_000, To: 2_000}} {
+		var headers, bodies, txs [][]byte
+		for i := r.From; i < r.To; i++ {
+			header := &types.Header{ParentHash: parentHash, Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(1), Time: i * 15}
+			parentHash = header.Hash()
+			headerRlp, err := rlp.EncodeToBytes(header)
+			require.NoError(err)
+			headers = append(headers, headerRlp)
+			body := &types.BodyForStorage{BaseTxId: baseTxID}
+			if i%10 == 0 {
+				txn, err := types.SignTx(types.NewTransaction(i/10, common.Address{1}, uint256.NewInt(1), 21_000, uint256.NewInt(1), nil), *signer, key)
+				require.NoError(err)
+				txRlp, err := rlp.EncodeToBytes(txn)
+				require.NoError(err)
+				hash := txn.Hash()
+				sender := crypto.PubkeyToAddress(key.PublicKey)
+				txs = append(txs, append(append([]byte{hash[0]}, sender[:]...), txRlp...))
+				body.TxAmount = 1
+				baseTxID++
+			}
+			bodyRlp, err := rlp.EncodeToBytes(body)
+			require.NoError(err)
+			bodies = append(bodies, bodyRlp)
+		}
+		createSegment(t, dir, r, snapshotsync.Headers, headers)
+		createSegment(t, dir, r, snapshotsync.Bodies, bodies)
+		createSegment(t, dir, r, snapshotsync.Transactions, txs)
+	}
+
+	snapshots := snapshotsync.NewAllSnapshots(dir, nil)
+	defer snapshots.Close()
+	require.NoError(snapshots.ReopenSegments())
+	merger := NewMerger(snapshots, *chainID, []uint64{2_000})
+
+	// nothing is merged until indices are built
+	merges, err := merger.MergeAll(context.Background())
+	require.NoError(err)
+	require.Zero(merges)
+
+	require.NoError(snapshots.BuildIndices(context.Background(), *chainID))
+	require.NoError(snapshots.ReopenIndices())
+	snapshots.SetAllIdxAvailable(true)
+	reader, ok, err := snapshots.Blocks(500)
+	require.NoError(err)
+	require.True(ok)
+	merges, err = merger.MergeAll(context.Background())
+	require.NoError(err)
+	require.Equal(1, merges)
+
+	require.Equal([]snapshotsync.Range{{From: 0, To: 2_000}}, snapshots.Opened())
+	sn, ok, err := snapshots.Blocks(1_500)
+	require.NoError(err)
+	require.True(ok)
+	defer sn.Release()
+	require.Equal(2_000, sn.Headers.Count())
+	require.Equal(2_000, sn.Bodies.Count())
+	require.Equal(200, sn.Transactions.Count())
+	require.NotNil(sn.HeaderHashIdx)
+	require.NotNil(sn.BodyNumberIdx)
+	require.NotNil(sn.TxnHashIdx)
+	require.Equal(uint64(0), sn.BodyNumberIdx.BaseDataID())
+	_, err = os.Stat(path.Join(dir, tmpDirName))
+	require.True(os.IsNotExist(err))
+
+	// part which is still read is kept open until its reader releases it, and is removed on next start if node
+	// stopped before
+	require.Equal(1_000, reader.Headers.Count())
+	ranges, err := snapshotsync.SegmentRanges(dir)
+	require.NoError(err)
+	require.Equal([]snapshotsync.Range{{From: 0, To: 1_000}, {From: 0, To: 2_000}}, ranges)
+	restarted := snapshotsync.NewAllSnapshots(dir, nil)
+	defer restarted.Close()
+	require.NoError(restarted.ReopenSegments())
+	require.Equal([]snapshotsync.Range{{From: 0, To: 2_000}}, restarted.Opened())
+	restarted.SetAllIdxAvailable(true)
+	merges, err = NewMerger(restarted, *chainID, []uint64{2_000}).MergeAll(context.Background())
+	require.NoError(err)
+	require.Zero(merges)
+	ranges, err = snapshotsync.SegmentRanges(dir)
+	require.NoError(err)
+	require.Equal([]snapshotsync.Range{{From: 0, To: 2_000}}, ranges)
+	_, err = os.Stat(path.Join(dir, snapshotsync.IdxFileName(0, 1_000, snapshotsync.Transactions)))
+	require.True(os.IsNotExist(err))
+	reader.Release()
+}
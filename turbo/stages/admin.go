@@ -0,0 +1,103 @@
+package stages
+
+import (
+	"context"
+	"errors"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/stages/headerdownload"
+)
+
+// Admin - administrative requests to staged sync of running node: rewind (debug_setHead), import of blocks
+// (erigon import) and scheduling of forks. StageLoop executes them between sync cycles, so they don't need exclusive
+// access to datadir.
+type Admin struct {
+	requests    chan adminRequest
+	chainConfig *params.ChainConfig
+	engine      consensus.Engine
+	frozen      func() uint64
+}
+
+type adminRequest struct {
+	rewindTo    uint64
+	blocks      []*types.Block      // import if not empty
+	chainConfig *params.ChainConfig // stored for next start of the node if not nil
+	done        chan error
+}
+
+// NewAdmin - engine verifies imported headers. frozen returns lowest block to which the node can be rewound because of
+// data in snapshot files, nil if there are no snapshots
+func NewAdmin(chainConfig *params.ChainConfig, engine consensus.Engine, frozen func() uint64) *Admin {
+	return &Admin{requests: make(chan adminRequest), chainConfig: chainConfig, engine: engine, frozen: frozen}
+}
+
+// Rewind - waits till StageLoop unwinds all stages to block to. If ctx is done after StageLoop took the request, rewind
+// still happens
+func (a *Admin) Rewind(ctx context.Context, to uint64) error {
+	return a.do(ctx, adminRequest{rewindTo: to})
+}
+
+// ImportBlocks - waits till StageLoop writes headers and bodies of blocks, next sync cycles execute them. Blocks must
+// be consecutive and extend canonical chain, blocks which are canonical already are skipped.
+func (a *Admin) ImportBlocks(ctx context.Context, blocks []*types.Block) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	return a.do(ctx, adminRequest{blocks: blocks})
+}
+
+// UpdateChainConfig - waits till StageLoop stores cfg as chain config of the node, see updateChainConfigStep
+func (a *Admin) UpdateChainConfig(ctx context.Context, cfg *params.ChainConfig) error {
+	if cfg == nil {
+		return errors.New("chain config is empty")
+	}
+	return a.do(ctx, adminRequest{chainConfig: cfg})
+}
+
+func (a *Admin) do(ctx context.Context, req adminRequest) error {
+	req.done = make(chan error, 1)
+	select {
+	case a.requests <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pending - channel of requests, nil for nil Admin
+func (a *Admin) pending() chan adminRequest {
+	if a == nil {
+		return nil
+	}
+	return a.requests
+}
+
+func (a *Admin) step(
+	ctx context.Context,
+	db kv.RwDB,
+	sync *stagedsync.Sync,
+	hd *headerdownload.HeaderDownload,
+	notifications *stagedsync.Notifications,
+	updateHead func(ctx context.Context, head uint64, hash common.Hash, td *uint256.Int),
+	req adminRequest,
+	initialCycle bool,
+) error {
+	if len(req.blocks) > 0 {
+		return a.importStep(ctx, db, hd, req.blocks)
+	}
+	if req.chainConfig != nil {
+		return a.updateChainConfigStep(ctx, db, req.chainConfig)
+	}
+	return a.rewindStep(ctx, db, sync, hd, notifications, updateHead, req.rewindTo, initialCycle)
+}
@@ -0,0 +1,63 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// updateChainConfigStep - schedules forks: cfg replaces stored chain config of the node if it differs only by forks
+// above downloaded headers. Chain config of running node is shared by stages, consensus engine, sentries and txpool
+// without synchronization, so it isn't changed: stored config is applied at next start of the node (when it's
+// started without genesis file, as nodes of private chains are, see core.WriteGenesisBlock).
+func (a *Admin) updateChainConfigStep(ctx context.Context, db kv.RwDB, cfg *params.ChainConfig) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	genesisHash, err := rawdb.ReadCanonicalHash(tx, 0)
+	if err != nil {
+		return err
+	}
+	// previous update can be stored and not applied yet
+	current, err := rawdb.ReadChainConfig(tx, genesisHash)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		current = a.chainConfig
+	}
+	if cfg.ChainID == nil || current.ChainID.Cmp(cfg.ChainID) != 0 {
+		return fmt.Errorf("chain id %v doesn't match %v", cfg.ChainID, current.ChainID)
+	}
+	if cfg.Consensus != current.Consensus {
+		return fmt.Errorf("consensus %s can't be changed to %s", current.Consensus, cfg.Consensus)
+	}
+	if err = cfg.CheckConfigForkOrder(); err != nil {
+		return err
+	}
+	head, err := stages.GetStageProgress(tx, stages.Headers)
+	if err != nil {
+		return err
+	}
+	// running node follows its own config till restart, new forks must be above head for both
+	for _, c := range []*params.ChainConfig{a.chainConfig, current} {
+		if compatErr := c.CheckCompatible(cfg, head); compatErr != nil {
+			return compatErr
+		}
+	}
+	if err = rawdb.WriteChainConfig(tx, genesisHash, cfg); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	log.Warn("Chain config stored by admin request, restart the node to apply it", "head", head, "config", cfg)
+	return nil
+}
@@ -0,0 +1,58 @@
+package stages_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	stages2 "github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateChainConfig(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	m := stages2.MockWithGenesis(t, &core.Genesis{Config: params.AllEthashProtocolChanges, Alloc: core.GenesisAlloc{
+		crypto.PubkeyToAddress(key.PublicKey): {Balance: big.NewInt(params.Ether)},
+	}}, key)
+	london := func(block int64) *params.ChainConfig {
+		cfg := *m.ChainConfig
+		cfg.LondonBlock = big.NewInt(block)
+		return &cfg
+	}
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 5, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+	a := stages2.NewAdmin(m.ChainConfig, m.Engine, nil)
+	stored := func() *params.ChainConfig {
+		var cfg *params.ChainConfig
+		require.NoError(t, m.DB.View(context.Background(), func(tx kv.Tx) error {
+			cfg, err = rawdb.ReadChainConfig(tx, m.Genesis.Hash())
+			return err
+		}))
+		return cfg
+	}
+
+	require.Error(t, m.UpdateChainConfig(a, london(3))) // below head
+	otherChain := london(7)
+	otherChain.ChainID = big.NewInt(1)
+	require.Error(t, m.UpdateChainConfig(a, otherChain))
+	require.Nil(t, stored().LondonBlock)
+
+	// stored for next start, config of running node isn't changed
+	require.NoError(t, m.UpdateChainConfig(a, london(7)))
+	require.Equal(t, uint64(7), stored().LondonBlock.Uint64())
+	require.Nil(t, m.ChainConfig.LondonBlock)
+
+	// stored update can be moved while it's above head
+	require.NoError(t, m.UpdateChainConfig(a, london(9)))
+	require.Equal(t, uint64(9), stored().LondonBlock.Uint64())
+	require.Error(t, m.UpdateChainConfig(a, london(4)))
+}
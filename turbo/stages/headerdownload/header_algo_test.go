@@ -5,9 +5,12 @@ import (
 	"math/big"
 	"testing"
 
+	"github.com/ledgerwatch/erigon-lib/etl"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
 	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/erigon/params"
@@ -59,3 +62,130 @@ func TestInserter1(t *testing.T) {
 		t.Errorf("feed empty header 2: %v", err)
 	}
 }
+
+func TestInserterFinality(t *testing.T) {
+	db := memdb.NewTestDB(t)
+	defer db.Close()
+	_, genesis, err := core.CommitGenesisBlock(db, &core.Genesis{Config: params.AllEthashProtocolChanges})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.BeginRw(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	hi := NewHeaderInserter("headers", big.NewInt(0), 0)
+	// blocks up to head-1 are final
+	hi.SetFinality(func(head uint64) uint64 {
+		if head == 0 {
+			return 0
+		}
+		return head - 1
+	})
+	feed := func(parent common.Hash, number uint64, difficulty int64) common.Hash {
+		h := &types.Header{Number: new(big.Int).SetUint64(number), Difficulty: big.NewInt(difficulty), ParentHash: parent}
+		raw, _ := rlp.EncodeToBytes(h)
+		if _, err := hi.FeedHeaderPoW(tx, snapshotsync.NewBlockReader(), h, raw, h.Hash(), number); err != nil {
+			t.Fatalf("feed header %d: %v", number, err)
+		}
+		return h.Hash()
+	}
+	h1 := feed(genesis.Hash(), 1, 1)
+	h2 := feed(h1, 2, 1)
+	h3 := feed(h2, 3, 1)
+
+	// heavier fork from block 1 is below finalized block 2
+	fork2 := feed(h1, 2, 100)
+	if head := rawdb.ReadHeadHeaderHash(tx); head != h3 {
+		t.Errorf("fork below finalized block became canonical: head %x", head)
+	}
+	if rawdb.ReadHeader(tx, fork2, 2) == nil {
+		t.Errorf("header of rejected fork must be stored")
+	}
+	// heavier fork from block 2 is allowed
+	fork3 := feed(h2, 3, 100)
+	if head := rawdb.ReadHeadHeaderHash(tx); head != fork3 {
+		t.Errorf("fork above finalized block is not canonical: head %x", head)
+	}
+}
+
+type testCheckpoints map[uint64]common.Hash
+
+func (c testCheckpoints) Finalized(number uint64) (common.Hash, bool) {
+	hash, ok := c[number]
+	return hash, ok
+}
+
+func TestProcessSegmentPOSCheckpoint(t *testing.T) {
+	db := memdb.NewTestDB(t)
+	tx, err := db.BeginRo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	// headers 10..5 downloaded backwards
+	var segment ChainSegment
+	parentHash := common.Hash{1}
+	for i := uint64(5); i <= 10; i++ {
+		h := &types.Header{Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(1), ParentHash: parentHash}
+		raw, _ := rlp.EncodeToBytes(h)
+		parentHash = h.Hash()
+		segment = append(ChainSegment{{HeaderRaw: raw, Header: h, Hash: h.Hash(), Number: i}}, segment...)
+	}
+	run := func(checkpoints FinalizedCheckpoints) *HeaderDownload {
+		hd := NewHeaderDownload(16, 16, nil)
+		hd.SetFinalizedCheckpoints(checkpoints)
+		hd.SetPOSSync(true)
+		collector := etl.NewCollector("test", t.TempDir(), etl.NewSortableBuffer(etl.BufferOptimalSize))
+		t.Cleanup(collector.Close)
+		hd.SetHeadersCollector(collector)
+		hd.SetProcessed(11)
+		hd.SetExpectedHash(segment[0].Hash)
+		if err := hd.ProcessSegmentPOS(segment, tx); err != nil {
+			t.Fatal(err)
+		}
+		return hd
+	}
+
+	hd := run(testCheckpoints{7: segment[3].Hash})
+	if hd.CheckpointMismatch() || hd.Progress() != 5 {
+		t.Errorf("matching checkpoint: mismatch %t, progress %d", hd.CheckpointMismatch(), hd.Progress())
+	}
+	hd = run(testCheckpoints{7: common.Hash{7}})
+	if !hd.CheckpointMismatch() || hd.Progress() != 8 {
+		t.Errorf("other finalized block: mismatch %t, progress %d", hd.CheckpointMismatch(), hd.Progress())
+	}
+	hd.Unsync()
+	if hd.CheckpointMismatch() {
+		t.Errorf("mismatch must be reset")
+	}
+}
+
+func TestPruneStaleLinks(t *testing.T) {
+	hd := NewHeaderDownload(100, 1600, nil)
+	canonical := map[common.Hash]bool{}
+	for i := uint64(1); i <= 10; i++ {
+		for _, difficulty := range []int64{1, 2} {
+			header := &types.Header{Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(difficulty)}
+			hd.addHeaderAsLink(ChainSegmentHeader{Header: header, Hash: header.Hash(), Number: i}, true /* persisted */)
+			canonical[header.Hash()] = difficulty == 1
+		}
+	}
+	removed, err := hd.PruneStaleLinks(6, func(hash common.Hash, number uint64) (bool, error) { return canonical[hash], nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 5 {
+		t.Fatalf("removed %d links, expected 5", removed)
+	}
+	if hd.persistedLinkQueue.Len() != 15 || len(hd.links) != 15 {
+		t.Fatalf("%d persisted links, %d links left, expected 15", hd.persistedLinkQueue.Len(), len(hd.links))
+	}
+	for hash, link := range hd.links {
+		if link.blockHeight < 6 && !canonical[hash] {
+			t.Fatalf("stale link %d %x is kept", link.blockHeight, hash)
+		}
+	}
+}
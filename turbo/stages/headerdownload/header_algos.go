@@ -727,6 +727,16 @@ func (hd *HeaderDownload) ProcessSegmentPOS(segment ChainSegment, tx kv.Getter)
 		if header.Hash() != hd.expectedHash {
 			return nil
 		}
+		if hd.checkpoints != nil {
+			if finalized, ok := hd.checkpoints.Finalized(header.Number.Uint64()); ok {
+				if finalized != hd.expectedHash {
+					log.Error("[PoS sync] Chain of payload doesn't contain finalized block", "number", header.Number.Uint64(), "hash", hd.expectedHash, "finalized", finalized)
+					hd.checkpointMismatch = true
+					return nil
+				}
+				log.Info("[PoS sync] Passed finalized checkpoint", "number", header.Number.Uint64(), "hash", finalized)
+			}
+		}
 		currentCanonical, err := rawdb.ReadCanonicalHash(tx, header.Number.Uint64())
 		if err != nil {
 			return err
@@ -838,7 +848,6 @@ func (hi *HeaderInserter) FeedHeaderPoW(db kv.StatelessRwTx, headerReader interf
 	td = new(big.Int).Add(parentTd, header.Difficulty)
 	// Now we can decide wether this header will create a change in the canonical head
 	if td.Cmp(hi.localTd) > 0 {
-		hi.newCanonical = true
 		// Find the forking point - i.e. the latest header on the canonical chain which is an ancestor of this one
 		// Most common case - forking point is the height of the parent header
 		var forkingPoint uint64
@@ -879,6 +888,13 @@ func (hi *HeaderInserter) FeedHeaderPoW(db kv.StatelessRwTx, headerReader interf
 			// Loop above terminates when either err != nil (handled already) or ch == ancestorHash, therefore ancestorHeight is our forking point
 			forkingPoint = ancestorHeight
 		}
+		if hi.finality != nil {
+			if finalized := hi.finality(hi.canonicalHeight); forkingPoint < finalized {
+				log.Warn(fmt.Sprintf("[%s] Rejected fork below finalized block", hi.logPrefix), "height", blockHeight, "hash", hash, "forkingPoint", forkingPoint, "finalized", finalized)
+				return hi.storeHeader(db, headerRaw, hash, blockHeight, td)
+			}
+		}
+		hi.newCanonical = true
 		if err = rawdb.WriteHeadHeaderHash(db, hash); err != nil {
 			return nil, fmt.Errorf("[%s] marking head header hash as %x: %w", hi.logPrefix, hash, err)
 		}
@@ -896,12 +912,18 @@ func (hi *HeaderInserter) FeedHeaderPoW(db kv.StatelessRwTx, headerReader interf
 		}
 		// This makes sure we end up choosing the chain with the max total difficulty
 		hi.localTd.Set(td)
+		hi.canonicalHeight = blockHeight
 	}
-	if err = rawdb.WriteTd(db, hash, blockHeight, td); err != nil {
+	return hi.storeHeader(db, headerRaw, hash, blockHeight, td)
+}
+
+// storeHeader writes header and its total difficulty, canonical or not
+func (hi *HeaderInserter) storeHeader(db kv.StatelessRwTx, headerRaw []byte, hash common.Hash, blockHeight uint64, td *big.Int) (*big.Int, error) {
+	if err := rawdb.WriteTd(db, hash, blockHeight, td); err != nil {
 		return nil, fmt.Errorf("[%s] failed to WriteTd: %w", hi.logPrefix, err)
 	}
 
-	if err = db.Put(kv.Headers, dbutils.HeaderKey(blockHeight, hash), headerRaw); err != nil {
+	if err := db.Put(kv.Headers, dbutils.HeaderKey(blockHeight, hash), headerRaw); err != nil {
 		return nil, fmt.Errorf("[%s] failed to store header: %w", hi.logPrefix, err)
 	}
 
@@ -1068,6 +1090,44 @@ func (hd *HeaderDownload) Unsync() {
 	hd.lock.Lock()
 	defer hd.lock.Unlock()
 	hd.synced = false
+	hd.checkpointMismatch = false
+}
+
+func (hd *HeaderDownload) SetFinalizedCheckpoints(checkpoints FinalizedCheckpoints) {
+	hd.lock.Lock()
+	defer hd.lock.Unlock()
+	hd.checkpoints = checkpoints
+}
+
+// CheckpointMismatch - backward sync reached block which contradicts finalized checkpoint
+func (hd *HeaderDownload) CheckpointMismatch() bool {
+	hd.lock.RLock()
+	defer hd.lock.RUnlock()
+	return hd.checkpointMismatch
+}
+
+// PruneStaleLinks - forgets persisted links of non-canonical headers below given height, returns amount of removed links
+func (hd *HeaderDownload) PruneStaleLinks(below uint64, canonical func(hash common.Hash, number uint64) (bool, error)) (int, error) {
+	hd.lock.Lock()
+	defer hd.lock.Unlock()
+	var stale []*Link
+	for _, link := range *hd.persistedLinkQueue {
+		if link.blockHeight >= below {
+			continue
+		}
+		ok, err := canonical(link.hash, link.blockHeight)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			stale = append(stale, link)
+		}
+	}
+	for _, link := range stale {
+		heap.Remove(hd.persistedLinkQueue, link.idx)
+		delete(hd.links, link.hash)
+	}
+	return len(stale), nil
 }
 
 func (hd *HeaderDownload) SetHeadersCollector(collector *etl.Collector) {
@@ -226,6 +226,13 @@ type HeaderDownload struct {
 	synced               bool           // if we found a canonical hash during backward sync, in this case our sync process is done
 	posSync              bool           // True if the chain is syncing backwards or not
 	headersCollector     *etl.Collector // ETL collector for headers
+	checkpoints          FinalizedCheckpoints
+	checkpointMismatch   bool // chain being downloaded backwards doesn't contain finalized block
+}
+
+// FinalizedCheckpoints - source of hashes of finalized blocks, headers downloaded backwards must match them
+type FinalizedCheckpoints interface {
+	Finalized(number uint64) (common.Hash, bool)
 }
 
 // HeaderRecord encapsulates two forms of the same header - raw RLP encoding (to avoid duplicated decodings and encodings), and parsed value types.Header
@@ -302,18 +309,26 @@ type HeaderInserter struct {
 	highest          uint64
 	highestTimestamp uint64
 	canonicalCache   *lru.Cache
+	canonicalHeight  uint64                   // height of current canonical head
+	finality         func(head uint64) uint64 // blocks up to returned one can't be reorged, nil if chain has no finality
 }
 
 func NewHeaderInserter(logPrefix string, localTd *big.Int, headerProgress uint64) *HeaderInserter {
 	hi := &HeaderInserter{
-		logPrefix:   logPrefix,
-		localTd:     localTd,
-		unwindPoint: headerProgress,
+		logPrefix:       logPrefix,
+		localTd:         localTd,
+		unwindPoint:     headerProgress,
+		canonicalHeight: headerProgress,
 	}
 	hi.canonicalCache, _ = lru.New(1000)
 	return hi
 }
 
+// SetFinality - forks from blocks below finalized one are stored, but never become canonical (Bor sprints)
+func (hi *HeaderInserter) SetFinality(finality func(head uint64) uint64) {
+	hi.finality = finality
+}
+
 // SeenAnnounces - external announcement hashes, after header verification if hash is in this set - will broadcast it further
 type SeenAnnounces struct {
 	hashes *lru.Cache
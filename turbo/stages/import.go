@@ -0,0 +1,118 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/turbo/stages/headerdownload"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// importStep - writes headers and bodies of blocks in one transaction, as Headers and Bodies stages do for downloaded
+// blocks. Senders, Execution and the rest of stages process them in next sync cycles
+func (a *Admin) importStep(ctx context.Context, db kv.RwDB, hd *headerdownload.HeaderDownload, blocks []*types.Block) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	head, err := stages.GetStageProgress(tx, stages.Headers)
+	if err != nil {
+		return err
+	}
+	bodiesProgress, err := stages.GetStageProgress(tx, stages.Bodies)
+	if err != nil {
+		return err
+	}
+	if bodiesProgress != head {
+		return fmt.Errorf("bodies of blocks %d-%d are not downloaded yet, import is possible when they are", bodiesProgress+1, head)
+	}
+
+	// Skip blocks which are canonical already, so that import of the same file can be restarted
+	for len(blocks) > 0 && blocks[0].NumberU64() <= head {
+		hash, err := rawdb.ReadCanonicalHash(tx, blocks[0].NumberU64())
+		if err != nil {
+			return err
+		}
+		if hash != blocks[0].Hash() {
+			return fmt.Errorf("block %d %x conflicts with canonical block %x", blocks[0].NumberU64(), blocks[0].Hash(), hash)
+		}
+		blocks = blocks[1:]
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+	if blocks[0].NumberU64() != head+1 {
+		return fmt.Errorf("block %d doesn't extend head %d", blocks[0].NumberU64(), head)
+	}
+	parentHash, err := rawdb.ReadCanonicalHash(tx, head)
+	if err != nil {
+		return err
+	}
+	td, err := rawdb.ReadTd(tx, parentHash, head)
+	if err != nil {
+		return err
+	}
+	if td == nil {
+		return fmt.Errorf("total difficulty of block %d not found", head)
+	}
+
+	cr := stagedsync.ChainReader{Cfg: *a.chainConfig, Db: tx}
+	td = new(big.Int).Set(td)
+	for i, block := range blocks {
+		header := block.Header()
+		if i > 0 && block.NumberU64() != blocks[i-1].NumberU64()+1 {
+			return fmt.Errorf("block %d follows block %d", block.NumberU64(), blocks[i-1].NumberU64())
+		}
+		if header.ParentHash != parentHash {
+			return fmt.Errorf("block %d: parent hash %x, expected %x", block.NumberU64(), header.ParentHash, parentHash)
+		}
+		if err = a.engine.VerifyHeader(cr, header, true /* seal */); err != nil {
+			return fmt.Errorf("block %d: invalid header: %w", block.NumberU64(), err)
+		}
+		if hash := types.DeriveSha(block.Transactions()); hash != header.TxHash {
+			return fmt.Errorf("block %d: transactions root %x, expected %x", block.NumberU64(), hash, header.TxHash)
+		}
+		if hash := types.CalcUncleHash(block.Uncles()); hash != header.UncleHash {
+			return fmt.Errorf("block %d: uncles hash %x, expected %x", block.NumberU64(), hash, header.UncleHash)
+		}
+		if err = a.engine.VerifyUncles(cr, header, block.Uncles()); err != nil {
+			return fmt.Errorf("block %d: invalid uncles: %w", block.NumberU64(), err)
+		}
+
+		hash := block.Hash()
+		td.Add(td, header.Difficulty)
+		rawdb.WriteHeader(tx, header)
+		if err = rawdb.WriteTd(tx, hash, block.NumberU64(), td); err != nil {
+			return err
+		}
+		if err = rawdb.WriteCanonicalHash(tx, hash, block.NumberU64()); err != nil {
+			return err
+		}
+		if err = rawdb.WriteRawBodyIfNotExists(tx, hash, block.NumberU64(), block.RawBody()); err != nil {
+			return err
+		}
+		parentHash = hash
+	}
+	last := blocks[len(blocks)-1].NumberU64()
+	if err = rawdb.WriteHeadHeaderHash(tx, parentHash); err != nil {
+		return err
+	}
+	if err = stages.SaveStageProgress(tx, stages.Headers, last); err != nil {
+		return err
+	}
+	if err = stages.SaveStageProgress(tx, stages.Bodies, last); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	log.Info("Imported blocks by admin request", "from", blocks[0].NumberU64(), "to", last)
+	return hd.RecoverFromDb(db)
+}
@@ -0,0 +1,51 @@
+package stages_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	stages2 "github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportBlocks(t *testing.T) {
+	m := stages2.Mock(t)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 6, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	a := stages2.NewAdmin(m.ChainConfig, m.Engine, nil)
+
+	require.Error(t, m.ImportBlocks(a, chain.Blocks[1:3]))                                // doesn't extend head
+	require.Error(t, m.ImportBlocks(a, []*types.Block{chain.Blocks[0], chain.Blocks[2]})) // gap
+	require.NoError(t, m.ImportBlocks(a, chain.Blocks[:4]))
+	// already canonical blocks are skipped
+	require.NoError(t, m.ImportBlocks(a, chain.Blocks[2:]))
+
+	require.NoError(t, stages2.StageLoopStep(m.Ctx, m.DB, m.Sync, 0, m.Notifications, false, m.UpdateHead, nil))
+	require.NoError(t, m.DB.View(context.Background(), func(tx kv.Tx) error {
+		execution, err := stages.GetStageProgress(tx, stages.Execution)
+		require.NoError(t, err)
+		require.Equal(t, uint64(6), execution)
+		finish, err := stages.GetStageProgress(tx, stages.Finish)
+		require.NoError(t, err)
+		require.Equal(t, uint64(6), finish)
+		hash, err := rawdb.ReadCanonicalHash(tx, 6)
+		require.NoError(t, err)
+		require.Equal(t, chain.TopBlock.Hash(), hash)
+		return nil
+	}))
+
+	// conflicting block
+	fork, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 1, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{2})
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.Error(t, m.ImportBlocks(a, fork.Blocks))
+}
@@ -61,6 +61,7 @@ type MockSentry struct {
 	MiningSync    *stagedsync.Sync
 	PendingBlocks chan *types.Block
 	MinedBlocks   chan *types.Block
+	PayloadStats  chan *rawdb.PayloadStats
 	downloader    *sentry.ControlServerImpl
 	Key           *ecdsa.PrivateKey
 	Genesis       *types.Block
@@ -188,6 +189,7 @@ func MockWithEverything(t *testing.T, gspec *core.Genesis, key *ecdsa.PrivateKey
 		Key:         key,
 		Notifications: &stagedsync.Notifications{
 			Events:               privateapi.NewEvents(),
+			ForkChoice:           privateapi.NewForkChoice(),
 			Accumulator:          shards.NewAccumulator(gspec.Config),
 			StateChangesConsumer: erigonGrpcServeer,
 		},
@@ -207,6 +209,7 @@ func MockWithEverything(t *testing.T, gspec *core.Genesis, key *ecdsa.PrivateKey
 	penalize := func(context.Context, []headerdownload.PenaltyItem) {}
 	cfg := ethconfig.Defaults
 	cfg.StateStream = true
+	cfg.ExecPrefetch = true
 	cfg.BatchSize = 1 * datasize.MB
 	cfg.BodyDownloadTimeoutSeconds = 10
 	cfg.TxPool.Disable = !withTxPool
@@ -278,7 +281,7 @@ func MockWithEverything(t *testing.T, gspec *core.Genesis, key *ecdsa.PrivateKey
 			mock.DB,
 			mock.downloader.Hd,
 			make(chan privateapi.ExecutionStatus),
-			*mock.ChainConfig,
+			mock.ChainConfig,
 			sendHeaderRequest,
 			propagateNewBlockHashes,
 			penalize,
@@ -290,7 +293,8 @@ func MockWithEverything(t *testing.T, gspec *core.Genesis, key *ecdsa.PrivateKey
 			snapshotsDownloader,
 			blockReader,
 			mock.tmpdir,
-		), stagedsync.StageBlockHashesCfg(mock.DB, mock.tmpdir, mock.ChainConfig), stagedsync.StageBodiesCfg(
+			0,
+		), stagedsync.StageBlockHashesCfg(mock.DB, mock.tmpdir, mock.ChainConfig), stagedsync.StageBorHeimdallCfg(mock.DB, *mock.ChainConfig, mock.Engine), stagedsync.StageBodiesCfg(
 			mock.DB,
 			mock.downloader.Bd,
 			sendBodyRequest,
@@ -302,27 +306,35 @@ func MockWithEverything(t *testing.T, gspec *core.Genesis, key *ecdsa.PrivateKey
 			allSnapshots,
 			blockReader,
 		), stagedsync.StageIssuanceCfg(mock.DB, mock.ChainConfig),
-			stagedsync.StageSendersCfg(mock.DB, mock.ChainConfig, mock.tmpdir, prune, allSnapshots),
+			stagedsync.StageSendersCfg(mock.DB, mock.ChainConfig, mock.tmpdir, prune, allSnapshots, nil),
 			stagedsync.StageExecuteBlocksCfg(
 				mock.DB,
 				prune,
 				cfg.BatchSize,
 				nil,
+				nil,
 				mock.ChainConfig,
 				mock.Engine,
 				&vm.Config{},
 				mock.Notifications.Accumulator,
 				cfg.StateStream,
+				cfg.ExecPrefetch,
+				cfg.HeadLag,
 				mock.tmpdir,
 				blockReader,
+				cfg.StateBackend,
 			),
 			stagedsync.StageTranspileCfg(mock.DB, cfg.BatchSize, mock.ChainConfig),
+			stagedsync.StageStateAccessCfg(mock.DB, prune),
 			stagedsync.StageHashStateCfg(mock.DB, mock.tmpdir),
 			stagedsync.StageTrieCfg(mock.DB, true, true, mock.tmpdir, blockReader),
 			stagedsync.StageHistoryCfg(mock.DB, prune, mock.tmpdir),
 			stagedsync.StageLogIndexCfg(mock.DB, prune, mock.tmpdir),
 			stagedsync.StageCallTracesCfg(mock.DB, prune, 0, mock.tmpdir),
+			stagedsync.StageStateDiffsCfg(mock.DB, prune, mock.ChainConfig, blockReader),
+			stagedsync.StageAddressAppearancesCfg(mock.DB, prune, mock.tmpdir, blockReader),
 			stagedsync.StageTxLookupCfg(mock.DB, prune, mock.tmpdir, allSnapshots),
+			stagedsync.StageFirehoseCfg(mock.DB, nil, 0, mock.ChainConfig, blockReader),
 			stagedsync.StageFinishCfg(mock.DB, mock.tmpdir, mock.Log), true),
 		stagedsync.DefaultUnwindOrder,
 		stagedsync.DefaultPruneOrder,
@@ -337,13 +349,18 @@ func MockWithEverything(t *testing.T, gspec *core.Genesis, key *ecdsa.PrivateKey
 	miner := stagedsync.NewMiningState(&miningConfig)
 	mock.PendingBlocks = miner.PendingResultCh
 	mock.MinedBlocks = miner.MiningResultCh
+	mock.PayloadStats = miner.PayloadStatsCh
+	var miningTxSource stagedsync.MiningTxSource
+	if mock.TxPool != nil {
+		miningTxSource = stagedsync.NewLocalTxSource(mock.TxPool, mock.txPoolDB)
+	}
 	mock.MiningSync = stagedsync.New(
 		stagedsync.MiningStages(mock.Ctx,
-			stagedsync.StageMiningCreateBlockCfg(mock.DB, miner, *mock.ChainConfig, mock.Engine, mock.TxPool, nil, mock.tmpdir),
-			stagedsync.StageMiningExecCfg(mock.DB, miner, nil, *mock.ChainConfig, mock.Engine, &vm.Config{}, mock.tmpdir),
+			stagedsync.StageMiningCreateBlockCfg(mock.DB, miner, mock.ChainConfig, mock.Engine, miningTxSource, nil, mock.tmpdir),
+			stagedsync.StageMiningExecCfg(mock.DB, miner, nil, mock.ChainConfig, mock.Engine, nil, &vm.Config{}, mock.tmpdir),
 			stagedsync.StageHashStateCfg(mock.DB, mock.tmpdir),
 			stagedsync.StageTrieCfg(mock.DB, false, true, mock.tmpdir, blockReader),
-			stagedsync.StageMiningFinishCfg(mock.DB, *mock.ChainConfig, mock.Engine, miner, mock.Ctx.Done()),
+			stagedsync.StageMiningFinishCfg(mock.DB, mock.ChainConfig, mock.Engine, miner, mock.Ctx.Done()),
 		),
 		stagedsync.MiningUnwindOrder,
 		stagedsync.MiningPruneOrder,
@@ -399,6 +416,22 @@ func (ms *MockSentry) EnableLogs() {
 	})
 }
 
+// Rewind - executes rewind request as StageLoop does it between sync cycles
+func (ms *MockSentry) Rewind(a *Admin, to uint64) error {
+	return a.step(ms.Ctx, ms.DB, ms.Sync, ms.downloader.Hd, ms.Notifications, ms.UpdateHead, adminRequest{rewindTo: to}, false /* initialCycle */)
+}
+
+// UpdateChainConfig - executes request to update chain config as StageLoop does it between sync cycles
+func (ms *MockSentry) UpdateChainConfig(a *Admin, cfg *params.ChainConfig) error {
+	return a.step(ms.Ctx, ms.DB, ms.Sync, ms.downloader.Hd, ms.Notifications, ms.UpdateHead, adminRequest{chainConfig: cfg}, false /* initialCycle */)
+}
+
+// ImportBlocks - executes import request as StageLoop does it between sync cycles, blocks are executed by next
+// InsertChain or StageLoopStep
+func (ms *MockSentry) ImportBlocks(a *Admin, blocks []*types.Block) error {
+	return a.step(ms.Ctx, ms.DB, ms.Sync, ms.downloader.Hd, ms.Notifications, ms.UpdateHead, adminRequest{blocks: blocks}, false /* initialCycle */)
+}
+
 func (ms *MockSentry) InsertChain(chain *core.ChainPack) error {
 	// Send NewBlock message
 	b, err := rlp.EncodeToBytes(&eth.NewBlockPacket{
@@ -0,0 +1,131 @@
+package stages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/consensus/misc"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/turbo/stages/headerdownload"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// rewindMaxLag - node which saw headers further than this ahead of its head is syncing and can't be rewound. Same
+// distance decides whether sync cycle runs in one transaction
+const rewindMaxLag = 8096
+
+// ErrRewindSyncing - rewind is refused while node catches up with the chain
+var ErrRewindSyncing = errors.New("node is syncing, rewind is possible only when it follows the head of the chain")
+
+// checkRewind - rewind to block to is safe: it's below head, and data of unwound blocks is not pruned or frozen
+func (a *Admin) checkRewind(tx kv.Tx, to, head uint64) error {
+	if to >= head {
+		return fmt.Errorf("block %d is not below head %d", to, head)
+	}
+	if a.frozen != nil {
+		if frozen := a.frozen(); to < frozen {
+			return fmt.Errorf("blocks before %d are in snapshots and can't be unwound", frozen)
+		}
+	}
+	pm, err := prune.Get(tx)
+	if err != nil {
+		return err
+	}
+	for _, p := range []struct {
+		name   string
+		amount prune.BlockAmount
+	}{
+		{"history", pm.History},
+		{"receipts", pm.Receipts},
+		{"txindex", pm.TxIndex},
+		{"callTraces", pm.CallTraces},
+	} {
+		if p.amount.Enabled() && to < p.amount.PruneTo(head) {
+			return fmt.Errorf("block %d is beyond prune horizon of %s: %d", to, p.name, p.amount.PruneTo(head))
+		}
+	}
+	return nil
+}
+
+// rewindStep - executes rewind request in one transaction, notifies about changes as sync cycle does
+func (a *Admin) rewindStep(
+	ctx context.Context,
+	db kv.RwDB,
+	sync *stagedsync.Sync,
+	hd *headerdownload.HeaderDownload,
+	notifications *stagedsync.Notifications,
+	updateHead func(ctx context.Context, head uint64, hash common.Hash, td *uint256.Int),
+	to uint64,
+	initialCycle bool,
+) error {
+	if initialCycle {
+		return ErrRewindSyncing
+	}
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	head, err := stages.GetStageProgress(tx, stages.Finish)
+	if err != nil {
+		return err
+	}
+	if hd.TopSeenHeight() > head+rewindMaxLag {
+		return ErrRewindSyncing
+	}
+	if err = a.checkRewind(tx, to, head); err != nil {
+		return err
+	}
+
+	log.Warn("Rewinding all stages by admin request", "from", head, "to", to)
+	if notifications != nil && notifications.Accumulator != nil {
+		notifications.Accumulator.Reset(tx.ViewID())
+	}
+	sync.UnwindTo(to, common.Hash{})
+	if err = sync.RunUnwind(db, tx); err != nil {
+		return err
+	}
+	hash, err := rawdb.ReadCanonicalHash(tx, to)
+	if err != nil {
+		return err
+	}
+	var td *big.Int
+	if td, err = rawdb.ReadTd(tx, hash, to); err != nil {
+		return err
+	}
+	if td == nil {
+		return fmt.Errorf("total difficulty of block %d not found", to)
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	if err = hd.RecoverFromDb(db); err != nil {
+		return err
+	}
+
+	td256, overflow := uint256.FromBig(td)
+	if overflow {
+		return fmt.Errorf("headTds higher than 2^256-1")
+	}
+	updateHead(ctx, to, hash, td256)
+	if notifications != nil && notifications.Accumulator != nil {
+		return db.View(ctx, func(tx kv.Tx) error {
+			header := rawdb.ReadCurrentHeader(tx)
+			if header == nil {
+				return nil
+			}
+			pendingBaseFee := misc.CalcBaseFee(notifications.Accumulator.ChainConfig(), header)
+			notifications.Accumulator.SendAndReset(ctx, notifications.StateChangesConsumer, pendingBaseFee.Uint64())
+			return nil
+		})
+	}
+	return nil
+}
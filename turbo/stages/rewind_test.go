@@ -0,0 +1,54 @@
+package stages_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	stages2 "github.com/ledgerwatch/erigon/turbo/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewind(t *testing.T) {
+	m := stages2.Mock(t)
+	chain, err := core.GenerateChain(m.ChainConfig, m.Genesis, m.Engine, m.DB, 5, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+	require.NoError(t, m.InsertChain(chain))
+
+	progress := func() (finish, execution uint64, canonical3 common.Hash) {
+		require.NoError(t, m.DB.View(context.Background(), func(tx kv.Tx) error {
+			if finish, err = stages.GetStageProgress(tx, stages.Finish); err != nil {
+				return err
+			}
+			if execution, err = stages.GetStageProgress(tx, stages.Execution); err != nil {
+				return err
+			}
+			canonical3, err = rawdb.ReadCanonicalHash(tx, 3)
+			return err
+		}))
+		return finish, execution, canonical3
+	}
+
+	a := stages2.NewAdmin(m.ChainConfig, m.Engine, func() uint64 { return 1 })
+	require.Error(t, m.Rewind(a, 5)) // not below head
+	require.Error(t, m.Rewind(a, 0)) // in snapshots
+
+	require.NoError(t, m.Rewind(a, 2))
+	finish, execution, canonical3 := progress()
+	require.Equal(t, uint64(2), finish)
+	require.Equal(t, uint64(2), execution)
+	require.Equal(t, common.Hash{}, canonical3)
+
+	// sync continues from rewound block
+	require.NoError(t, m.InsertChain(chain))
+	finish, execution, canonical3 = progress()
+	require.Equal(t, uint64(5), finish)
+	require.Equal(t, uint64(5), execution)
+	require.Equal(t, chain.Blocks[2].Hash(), canonical3)
+}
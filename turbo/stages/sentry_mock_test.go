@@ -122,6 +122,13 @@ func TestMineBlockWith1Tx(t *testing.T) {
 	require.Equal(chain.TopBlock.Transactions().Len(), got.Transactions().Len())
 	got2 := <-m.MinedBlocks
 	require.Equal(chain.TopBlock.Transactions().Len(), got2.Transactions().Len())
+	stats := <-m.PayloadStats
+	require.Equal(got.Hash(), stats.Hash)
+	require.Equal(uint64(1), stats.Candidates)
+	require.Equal(uint64(1), stats.Included)
+	require.Equal(got.GasUsed(), stats.GasUsed)
+	require.Equal(stats.PriorityFees, stats.Value)            // no direct payments
+	require.Equal(uint64(params.TxGas), stats.Value.Uint64()) // gas price 1 wei, no base fee
 }
 
 func TestReorg(t *testing.T) {
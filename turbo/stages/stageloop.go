@@ -18,9 +18,11 @@ import (
 	"github.com/ledgerwatch/erigon/consensus/misc"
 	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/erigon/eth/ethconfig"
 	"github.com/ledgerwatch/erigon/eth/stagedsync"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb/olddb"
 	"github.com/ledgerwatch/erigon/ethdb/privateapi"
 	"github.com/ledgerwatch/erigon/p2p"
 	"github.com/ledgerwatch/erigon/turbo/shards"
@@ -40,6 +42,7 @@ func StageLoop(
 	updateHead func(ctx context.Context, head uint64, hash common.Hash, td *uint256.Int),
 	waitForDone chan struct{},
 	loopMinTime time.Duration,
+	admin *Admin,
 ) {
 	defer close(waitForDone)
 	initialCycle := true
@@ -48,6 +51,11 @@ func StageLoop(
 		select {
 		case <-ctx.Done():
 			return
+		case <-sync.Stopping():
+			return
+		case req := <-admin.pending():
+			req.done <- admin.step(ctx, db, sync, hd, notifications, updateHead, req, initialCycle)
+			continue
 		default:
 		}
 
@@ -74,10 +82,18 @@ func StageLoop(
 			waitTime := loopMinTime - time.Since(start)
 			log.Info("Wait time until next loop", "for", waitTime)
 			c := time.After(waitTime)
-			select {
-			case <-ctx.Done():
-				return
-			case <-c:
+		wait:
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-sync.Stopping():
+					return
+				case req := <-admin.pending():
+					req.done <- admin.step(ctx, db, sync, hd, notifications, updateHead, req, initialCycle)
+				case <-c:
+					break wait
+				}
 			}
 		}
 	}
@@ -133,6 +149,17 @@ func StageLoopStep(
 	if err != nil {
 		return err
 	}
+	if notifications != nil && notifications.ForkChoice != nil {
+		// engine API keeps fork choice state in memory, it's stored with results of the cycle
+		if canRunCycleInOneTransaction {
+			err = notifications.ForkChoice.WriteTo(tx)
+		} else if notifications.ForkChoice.Changed() {
+			err = db.Update(ctx, func(tx kv.RwTx) error { return notifications.ForkChoice.WriteTo(tx) })
+		}
+		if err != nil {
+			return err
+		}
+	}
 	if canRunCycleInOneTransaction {
 		commitStart := time.Now()
 		errTx := tx.Commit()
@@ -160,6 +187,11 @@ func StageLoopStep(
 	if headTd, err = rawdb.ReadTd(rotx, headHash, head); err != nil {
 		return err
 	}
+	// behind head if node follows chain with lag (--sync.head.lag)
+	var finishProgressAfter uint64
+	if finishProgressAfter, err = stages.GetStageProgress(rotx, stages.Finish); err != nil {
+		return err
+	}
 
 	if canRunCycleInOneTransaction && snapshotMigratorFinal != nil {
 		err = snapshotMigratorFinal(rotx)
@@ -188,7 +220,7 @@ func StageLoopStep(
 			}
 			notifications.Accumulator.SendAndReset(ctx, notifications.StateChangesConsumer, pendingBaseFee.Uint64())
 
-			return stagedsync.NotifyNewHeaders(ctx, finishProgressBefore, head, sync.PrevUnwindPoint(), notifications.Events, tx)
+			return stagedsync.NotifyNewHeaders(ctx, finishProgressBefore, finishProgressAfter, sync.PrevUnwindPoint(), notifications.Events, tx)
 
 		}); err != nil {
 			return err
@@ -217,6 +249,25 @@ func MiningStep(ctx context.Context, kv kv.RwDB, mining *stagedsync.Sync) (err e
 	return nil
 }
 
+// MiningStepInMemory - same as MiningStep, but db is only read: stages write to in-memory overlay of read transaction.
+// It allows to produce blocks over remote db (e.g. by standalone block producer).
+func MiningStepInMemory(ctx context.Context, db kv.RoDB, mining *stagedsync.Sync) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("%+v, trace: %s", rec, dbg.Stack())
+		}
+	}()
+
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	batch := olddb.NewMemoryBatch(tx)
+	defer batch.Rollback()
+	return mining.Run(nil, batch, false)
+}
+
 func NewStagedSync(
 	ctx context.Context,
 	logger log.Logger,
@@ -240,13 +291,17 @@ func NewStagedSync(
 	} else {
 		blockReader = snapshotsync.NewBlockReader()
 	}
+	sendersRecoverer, err := crypto.OpenBatchRecoverer(cfg.SendersRecoverer)
+	if err != nil {
+		log.Warn("Batch recovery of senders is not available, senders are recovered on CPU", "recoverer", cfg.SendersRecoverer, "err", err)
+	}
 
-	return stagedsync.New(
+	sync := stagedsync.New(
 		stagedsync.DefaultStages(ctx, cfg.Prune, stagedsync.StageHeadersCfg(
 			db,
 			controlServer.Hd,
 			statusCh,
-			*controlServer.ChainConfig,
+			controlServer.ChainConfig,
 			controlServer.SendHeaderRequest,
 			controlServer.PropagateNewBlockHashes,
 			controlServer.Penalize,
@@ -258,7 +313,8 @@ func NewStagedSync(
 			snapshotDownloader,
 			blockReader,
 			tmpdir,
-		), stagedsync.StageBlockHashesCfg(db, tmpdir, controlServer.ChainConfig), stagedsync.StageBodiesCfg(
+			cfg.StaleForksRetention,
+		), stagedsync.StageBlockHashesCfg(db, tmpdir, controlServer.ChainConfig), stagedsync.StageBorHeimdallCfg(db, *controlServer.ChainConfig, controlServer.Engine), stagedsync.StageBodiesCfg(
 			db,
 			controlServer.Bd,
 			controlServer.SendBodyRequest,
@@ -269,30 +325,41 @@ func NewStagedSync(
 			cfg.BatchSize,
 			allSnapshots,
 			blockReader,
-		), stagedsync.StageIssuanceCfg(db, controlServer.ChainConfig), stagedsync.StageSendersCfg(db, controlServer.ChainConfig, tmpdir, cfg.Prune, allSnapshots), stagedsync.StageExecuteBlocksCfg(
+		), stagedsync.StageIssuanceCfg(db, controlServer.ChainConfig), stagedsync.StageSendersCfg(db, controlServer.ChainConfig, tmpdir, cfg.Prune, allSnapshots, sendersRecoverer), stagedsync.StageExecuteBlocksCfg(
 			db,
 			cfg.Prune,
 			cfg.BatchSize,
 			nil,
+			cfg.ExecWitnessHook,
 			controlServer.ChainConfig,
 			controlServer.Engine,
 			&vm.Config{EnableTEMV: cfg.Prune.Experiments.TEVM},
 			accumulator,
 			cfg.StateStream,
+			cfg.ExecPrefetch,
+			cfg.HeadLag,
 			tmpdir,
 			blockReader,
+			cfg.StateBackend,
 		), stagedsync.StageTranspileCfg(
 			db,
 			cfg.BatchSize,
 			controlServer.ChainConfig,
-		), stagedsync.StageHashStateCfg(db, tmpdir),
+		), stagedsync.StageStateAccessCfg(db, cfg.Prune),
+			stagedsync.StageHashStateCfg(db, tmpdir),
 			stagedsync.StageTrieCfg(db, true, true, tmpdir, blockReader),
 			stagedsync.StageHistoryCfg(db, cfg.Prune, tmpdir),
 			stagedsync.StageLogIndexCfg(db, cfg.Prune, tmpdir),
 			stagedsync.StageCallTracesCfg(db, cfg.Prune, 0, tmpdir),
+			stagedsync.StageStateDiffsCfg(db, cfg.Prune, controlServer.ChainConfig, blockReader),
+			stagedsync.StageAddressAppearancesCfg(db, cfg.Prune, tmpdir, blockReader),
 			stagedsync.StageTxLookupCfg(db, cfg.Prune, tmpdir, allSnapshots),
+			stagedsync.StageFirehoseCfg(db, cfg.Firehose, cfg.FirehoseConfirmations, controlServer.ChainConfig, blockReader),
 			stagedsync.StageFinishCfg(db, tmpdir, logger), false),
 		stagedsync.DefaultUnwindOrder,
 		stagedsync.DefaultPruneOrder,
-	), nil
+	)
+	sync.SetMaintenance(cfg.MaintenanceWindows, cfg.MaintenanceIndexLag)
+	sync.SetChain(controlServer.ChainConfig.ChainName)
+	return sync, nil
 }
@@ -0,0 +1,273 @@
+// Package statediff - state diffs of transactions in the form of "stateDiff" trace of Parity's
+// trace_replayBlockTransactions. Diffs are computed by re-execution of block's transactions over historical state, the
+// same way as trace API does it, and stored by StateDiffs stage (rawdb.StateDiffs table) to serve the trace without
+// re-execution.
+package statediff
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/holiman/uint256"
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/shards"
+)
+
+// Storage - storage slot changed by transaction
+type Storage struct {
+	Key  common.Hash
+	From common.Hash
+	To   common.Hash
+}
+
+// Account - account before and after transaction. Only accounts which transaction touched and changed are recorded.
+// Code is referenced by hash (kv.Code), empty hash - account doesn't have code.
+type Account struct {
+	Address      common.Address
+	FromExists   bool
+	ToExists     bool
+	FromBalance  uint256.Int
+	ToBalance    uint256.Int
+	FromNonce    uint64
+	ToNonce      uint64
+	FromCodeHash common.Hash
+	ToCodeHash   common.Hash
+	Storage      []Storage // sorted by key
+}
+
+// Tx - state diff of one transaction, with its return data (trace API returns it in the same result)
+type Tx struct {
+	Output   []byte
+	Accounts []Account // sorted by address
+}
+
+// collector - StateWriter which collects touched accounts and changed storage slots, like StateDiff of trace API
+type collector struct {
+	accounts map[common.Address]map[common.Hash]Storage
+}
+
+func newCollector() *collector {
+	return &collector{accounts: map[common.Address]map[common.Hash]Storage{}}
+}
+
+func (c *collector) touch(address common.Address) map[common.Hash]Storage {
+	slots, ok := c.accounts[address]
+	if !ok {
+		slots = map[common.Hash]Storage{}
+		c.accounts[address] = slots
+	}
+	return slots
+}
+
+func (c *collector) UpdateAccountData(address common.Address, original, account *accounts.Account) error {
+	c.touch(address)
+	return nil
+}
+
+func (c *collector) UpdateAccountCode(address common.Address, incarnation uint64, codeHash common.Hash, code []byte) error {
+	c.touch(address)
+	return nil
+}
+
+func (c *collector) DeleteAccount(address common.Address, original *accounts.Account) error {
+	c.touch(address)
+	return nil
+}
+
+func (c *collector) WriteAccountStorage(address common.Address, incarnation uint64, key *common.Hash, original, value *uint256.Int) error {
+	if *original == *value {
+		return nil
+	}
+	c.touch(address)[*key] = Storage{Key: *key, From: common.BytesToHash(original.Bytes()), To: common.BytesToHash(value.Bytes())}
+	return nil
+}
+
+func (c *collector) CreateContract(address common.Address) error {
+	c.touch(address)
+	return nil
+}
+
+// compare - state of collected accounts before and after transaction. Accounts which didn't exist before and after,
+// or have the same balance, nonce and code and no changed storage, are skipped - trace API skips them too.
+func (c *collector) compare(initialIbs, ibs *state.IntraBlockState) []Account {
+	res := make([]Account, 0, len(c.accounts))
+	for addr, slots := range c.accounts {
+		a := Account{Address: addr, FromExists: initialIbs.Exist(addr), ToExists: ibs.Exist(addr)}
+		if a.FromExists {
+			a.FromBalance, a.FromNonce, a.FromCodeHash = *initialIbs.GetBalance(addr), initialIbs.GetNonce(addr), codeHash(initialIbs, addr)
+		}
+		if a.ToExists {
+			a.ToBalance, a.ToNonce, a.ToCodeHash = *ibs.GetBalance(addr), ibs.GetNonce(addr), codeHash(ibs, addr)
+		}
+		if !a.FromExists && !a.ToExists {
+			continue
+		}
+		if a.FromExists && a.ToExists && len(slots) == 0 &&
+			a.FromBalance == a.ToBalance && a.FromNonce == a.ToNonce && a.FromCodeHash == a.ToCodeHash {
+			continue
+		}
+		for _, s := range slots {
+			a.Storage = append(a.Storage, s)
+		}
+		sort.Slice(a.Storage, func(i, j int) bool { return bytes.Compare(a.Storage[i].Key[:], a.Storage[j].Key[:]) < 0 })
+		res = append(res, a)
+	}
+	sort.Slice(res, func(i, j int) bool { return bytes.Compare(res[i].Address[:], res[j].Address[:]) < 0 })
+	return res
+}
+
+// codeHash - hash of account's code, empty hash if there is no code
+func codeHash(ibs *state.IntraBlockState, addr common.Address) common.Hash {
+	h := ibs.GetCodeHash(addr)
+	if accounts.IsEmptyCodeHash(h) {
+		return common.Hash{}
+	}
+	return h
+}
+
+// evmContext - the same context as trace API uses (transactions.GetEvmContext), turbo/transactions is not imported to
+// avoid import cycle with eth/stagedsync
+func evmContext(msg core.Message, header *types.Header, tx kv.Tx, contractHasTEVM func(common.Hash) (bool, error)) (vm.BlockContext, vm.TxContext) {
+	var baseFee uint256.Int
+	if header.Eip1559 {
+		if overflow := baseFee.SetFromBig(header.BaseFee); overflow {
+			panic(fmt.Errorf("header.BaseFee higher than 2^256-1"))
+		}
+	}
+	return vm.BlockContext{
+			CanTransfer: core.CanTransfer,
+			Transfer:    core.Transfer,
+			GetHash: func(n uint64) common.Hash {
+				hash, _ := rawdb.ReadCanonicalHash(tx, n)
+				return hash
+			},
+			ContractHasTEVM: contractHasTEVM,
+			Coinbase:        header.Coinbase,
+			BlockNumber:     header.Number.Uint64(),
+			Time:            header.Time,
+			Difficulty:      new(big.Int).Set(header.Difficulty),
+			GasLimit:        header.GasLimit,
+			BaseFee:         &baseFee,
+		},
+		vm.TxContext{
+			Origin:   msg.From(),
+			GasPrice: msg.GasPrice().ToBig(),
+		}
+}
+
+// ComputeBlock - re-executes transactions of the block over the state of its parent, like trace_replayBlockTransactions
+// does: without block rewards and system calls, every transaction sees changes of previous ones. History of the parent
+// block must be available and indexed.
+func ComputeBlock(ctx context.Context, tx kv.Tx, chainConfig *params.ChainConfig, block *types.Block) ([]*Tx, error) {
+	blockNum := block.NumberU64()
+	if blockNum == 0 {
+		return nil, nil
+	}
+	header := block.Header()
+	signer := types.MakeSigner(chainConfig, blockNum)
+	stateReader := state.NewPlainState(tx, blockNum-1, nil)
+	stateCache := shards.NewStateCache(32, 0 /* no limit */)
+	cachedReader := state.NewCachedReader(stateReader, stateCache)
+	cachedWriter := state.NewCachedWriter(state.NewNoopWriter(), stateCache)
+	contractHasTEVM := func(common.Hash) (bool, error) { return false, nil }
+
+	res := make([]*Tx, 0, len(block.Transactions()))
+	for txIndex, txn := range block.Transactions() {
+		if err := libcommon.Stopped(ctx.Done()); err != nil {
+			return nil, err
+		}
+		msg, err := txn.AsMessage(*signer, header.BaseFee)
+		if err != nil {
+			return nil, fmt.Errorf("convert tx %d of block %d into msg: %w", txIndex, blockNum, err)
+		}
+		blockCtx, txCtx := evmContext(msg, header, tx, contractHasTEVM)
+		ibs := state.New(cachedReader)
+		// state before the transaction, to compare with
+		initialIbs := state.New(state.NewCachedReader(stateReader, stateCache.Clone()))
+		evm := vm.NewEVM(blockCtx, txCtx, ibs, chainConfig, vm.Config{})
+		ibs.Prepare(txn.Hash(), block.Hash(), txIndex)
+		execResult, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.Gas()), true /* refunds */, false /* gasBailout */)
+		if err != nil {
+			return nil, fmt.Errorf("execution of tx %d of block %d: %w", txIndex, blockNum, err)
+		}
+		c := newCollector()
+		if err = ibs.FinalizeTx(evm.ChainRules(), c); err != nil {
+			return nil, err
+		}
+		res = append(res, &Tx{Output: common.CopyBytes(execResult.ReturnData), Accounts: c.compare(initialIbs, ibs)})
+		if err = ibs.CommitBlock(evm.ChainRules(), cachedWriter); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func txKey(blockNum uint64, txIndex int) []byte {
+	k := make([]byte, 8+4)
+	binary.BigEndian.PutUint64(k, blockNum)
+	binary.BigEndian.PutUint32(k[8:], uint32(txIndex))
+	return k
+}
+
+// WriteBlock - stores diffs of block's transactions
+func WriteBlock(tx kv.Putter, blockNum uint64, diffs []*Tx) error {
+	for txIndex, diff := range diffs {
+		v, err := rlp.EncodeToBytes(diff)
+		if err != nil {
+			return err
+		}
+		if err = tx.Put(rawdb.StateDiffs, txKey(blockNum, txIndex), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadBlock - stored diffs of block's transactions, empty if block has no transactions or its diffs are not stored
+func ReadBlock(tx kv.Tx, blockNum uint64) ([]*Tx, error) {
+	var diffs []*Tx
+	if err := tx.ForPrefix(rawdb.StateDiffs, dbutils.EncodeBlockNumber(blockNum), func(k, v []byte) error {
+		diff := &Tx{}
+		if err := rlp.DecodeBytes(v, diff); err != nil {
+			return fmt.Errorf("state diff %x: %w", k, err)
+		}
+		diffs = append(diffs, diff)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+// Truncate - deletes diffs of blocks from given one
+func Truncate(tx kv.RwTx, from uint64) error {
+	c, err := tx.RwCursor(rawdb.StateDiffs)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for k, _, err := c.Seek(dbutils.EncodeBlockNumber(from)); k != nil; k, _, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err = c.DeleteCurrent(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package tiering
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// DB - chaindata with cold database: its transactions read moved blocks from cold database (see rawdb.ColdTx), in
+// one read transaction of cold database per transaction of chaindata. Cold database is closed with chaindata.
+type DB struct {
+	kv.RwDB
+	cold *Cold
+}
+
+func NewDB(hot kv.RwDB, cold *Cold) *DB {
+	return &DB{RwDB: hot, cold: cold}
+}
+
+func (db *DB) Close() {
+	db.RwDB.Close()
+	db.cold.Close()
+}
+
+func (db *DB) BeginRo(ctx context.Context) (kv.Tx, error) {
+	tx, err := db.RwDB.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &roTx{Tx: tx, coldTx: coldTx{ctx: ctx, cold: db.cold}}, nil
+}
+
+func (db *DB) BeginRw(ctx context.Context) (kv.RwTx, error) {
+	tx, err := db.RwDB.BeginRw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &rwTx{RwTx: tx, coldTx: coldTx{ctx: ctx, cold: db.cold}}, nil
+}
+
+func (db *DB) View(ctx context.Context, f func(tx kv.Tx) error) error {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *DB) Update(ctx context.Context, f func(tx kv.RwTx) error) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// coldTx - read transaction of cold database, begins on first read of moved block
+type coldTx struct {
+	ctx  context.Context
+	cold *Cold
+	tx   kv.Tx
+}
+
+func (c *coldTx) ColdTx(blockNum uint64) (kv.Tx, error) {
+	if blockNum >= c.cold.To() {
+		return nil, nil
+	}
+	if c.tx == nil {
+		tx, err := c.cold.db.BeginRo(c.ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.tx = tx
+	}
+	return c.tx, nil
+}
+
+func (c *coldTx) rollback() {
+	if c.tx != nil {
+		c.tx.Rollback()
+		c.tx = nil
+	}
+}
+
+type roTx struct {
+	kv.Tx
+	coldTx
+}
+
+func (tx *roTx) Commit() error {
+	tx.rollback()
+	return tx.Tx.Commit()
+}
+
+func (tx *roTx) Rollback() {
+	tx.rollback()
+	tx.Tx.Rollback()
+}
+
+type rwTx struct {
+	kv.RwTx
+	coldTx
+}
+
+func (tx *rwTx) Commit() error {
+	tx.rollback()
+	return tx.RwTx.Commit()
+}
+
+func (tx *rwTx) Rollback() {
+	tx.rollback()
+	tx.RwTx.Rollback()
+}
@@ -0,0 +1,310 @@
+// Package tiering moves bodies, transactions and receipts of old blocks from chaindata to database on secondary
+// (slower, cheaper) volume, keeping recent blocks on fast one. Reads are transparent: transactions of chaindata
+// wrapped by NewDB read blocks which are absent in chaindata from cold database, see rawdb.ColdTx.
+//
+// Blocks are moved by batches: batch is copied to cold database, and only after its commit it's deleted from
+// chaindata. Readers which see batch deleted from chaindata find it in cold database. Node stopped between these
+// commits deletes rest of the batch on next move.
+package tiering
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/turbo/maintenance"
+	"github.com/ledgerwatch/log/v3"
+)
+
+var (
+	coldToKey      = []byte("tiering_to")       // kv.DatabaseInfo of cold database: blocks before are moved
+	coldGenesisKey = []byte("tiering_genesis")  // kv.DatabaseInfo of cold database: genesis of its chaindata
+	hotFromKey     = []byte("tiering_hot_from") // kv.DatabaseInfo of chaindata: blocks before are deleted from chaindata
+)
+
+var (
+	DefaultHotBlocks uint64 = 100_000
+	Interval                = 10 * time.Minute
+	// BatchSize - blocks moved by one transaction, chaindata is locked for writing meanwhile
+	BatchSize uint64 = 1_000
+)
+
+// Cold - database of moved blocks
+type Cold struct {
+	db       kv.RwDB
+	to       uint64 // atomic
+	readonly bool
+}
+
+// Open - opens cold database of given chaindata in dir, readonly - for rpcdaemon, blocks are moved by Erigon. Cold
+// database belongs to chaindata of its first open: database of other chain (other datadir) is rejected.
+func Open(dir string, hot kv.RoDB, readonly bool) (*Cold, error) {
+	opts := mdbx.NewMDBX(log.New()).Label(kv.ChainDB).Path(dir)
+	if readonly {
+		opts = opts.Readonly()
+	}
+	db, err := opts.Open()
+	if err != nil {
+		return nil, err
+	}
+	c := &Cold{db: db, readonly: readonly}
+	if err = db.View(context.Background(), func(tx kv.Tx) error {
+		v, err := tx.GetOne(kv.DatabaseInfo, coldToKey)
+		if len(v) == 8 {
+			c.to = binary.BigEndian.Uint64(v)
+		}
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err = c.checkGenesis(hot); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// checkGenesis - cold database has blocks of chaindata with same genesis, genesis is stored on first open
+func (c *Cold) checkGenesis(hot kv.RoDB) error {
+	var genesis common.Hash
+	if err := hot.View(context.Background(), func(tx kv.Tx) (err error) {
+		genesis, err = rawdb.ReadCanonicalHash(tx, 0)
+		return err
+	}); err != nil {
+		return err
+	}
+	if genesis == (common.Hash{}) {
+		return nil
+	}
+	var stored []byte
+	if err := c.db.View(context.Background(), func(tx kv.Tx) (err error) {
+		v, err := tx.GetOne(kv.DatabaseInfo, coldGenesisKey)
+		stored = common.CopyBytes(v)
+		return err
+	}); err != nil {
+		return err
+	}
+	if len(stored) > 0 {
+		if common.BytesToHash(stored) != genesis {
+			return fmt.Errorf("cold database has blocks of other chain: genesis %x, chaindata genesis %x", stored, genesis)
+		}
+		return nil
+	}
+	if c.readonly {
+		return nil
+	}
+	return c.db.Update(context.Background(), func(tx kv.RwTx) error {
+		return tx.Put(kv.DatabaseInfo, coldGenesisKey, genesis.Bytes())
+	})
+}
+
+// To - blocks before To are moved. Readonly database is not notified about moves, and it's checked for all blocks
+// which are absent in chaindata
+func (c *Cold) To() uint64 {
+	if c.readonly {
+		return math.MaxUint64
+	}
+	return atomic.LoadUint64(&c.to)
+}
+
+func (c *Cold) Close() { c.db.Close() }
+
+// Manager - moves blocks which are more than hotBlocks behind Finish stage into cold database
+type Manager struct {
+	hot         kv.RwDB
+	cold        *Cold
+	hotBlocks   uint64
+	maintenance maintenance.Windows
+}
+
+func NewManager(hot kv.RwDB, cold *Cold, hotBlocks uint64) *Manager {
+	return &Manager{hot: hot, cold: cold, hotBlocks: hotBlocks}
+}
+
+// SetMaintenance - Loop moves blocks only inside of given windows, empty - at any time
+func (m *Manager) SetMaintenance(windows maintenance.Windows) { m.maintenance = windows }
+
+// Loop - moves blocks every interval, if it's inside of maintenance windows
+func (m *Manager) Loop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if !m.maintenance.Allowed(time.Now()) {
+			log.Debug("[tiering] Move deferred till maintenance window", "in", m.maintenance.UntilNext(time.Now()).Truncate(time.Minute))
+		} else if _, err := m.MoveAll(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn("[tiering] Move failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// MoveAll - moves all blocks which are old enough, returns amount of moved blocks
+func (m *Manager) MoveAll(ctx context.Context) (uint64, error) {
+	var finish, hotFrom uint64
+	if err := m.hot.View(ctx, func(tx kv.Tx) (err error) {
+		if finish, err = stages.GetStageProgress(tx, stages.Finish); err != nil {
+			return err
+		}
+		v, err := tx.GetOne(kv.DatabaseInfo, hotFromKey)
+		if len(v) == 8 {
+			hotFrom = binary.BigEndian.Uint64(v)
+		}
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	from := m.cold.To()
+	// rest of the batch, if node was stopped before its deletion
+	if hotFrom < from {
+		if err := m.deleteRange(ctx, hotFrom, from); err != nil {
+			return 0, err
+		}
+	}
+	if finish < m.hotBlocks {
+		return 0, nil
+	}
+	target := finish - m.hotBlocks
+	if from >= target {
+		return 0, nil
+	}
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	log.Info("[tiering] Moving blocks to cold database", "from", from, "to", target)
+	for batchFrom := from; batchFrom < target; {
+		batchTo := batchFrom + BatchSize
+		if batchTo > target {
+			batchTo = target
+		}
+		if err := m.copyRange(ctx, batchFrom, batchTo); err != nil {
+			return batchFrom - from, err
+		}
+		if err := m.deleteRange(ctx, batchFrom, batchTo); err != nil {
+			return batchTo - from, err
+		}
+		batchFrom = batchTo
+		select {
+		case <-ctx.Done():
+			return batchFrom - from, ctx.Err()
+		case <-logEvery.C:
+			log.Info("[tiering] Moving blocks to cold database", "block", batchFrom, "to", target)
+		default:
+		}
+	}
+	return target - from, nil
+}
+
+// copyRange - copies bodies, transactions and receipts of canonical blocks [from, to) into cold database
+func (m *Manager) copyRange(ctx context.Context, from, to uint64) error {
+	tx, err := m.hot.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	coldTx, err := m.cold.db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer coldTx.Rollback()
+	put := func(table string) func(k, v []byte) error {
+		return func(k, v []byte) error { return coldTx.Put(table, k, v) }
+	}
+	for blockNum := from; blockNum < to; blockNum++ {
+		hash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+		if err != nil {
+			return err
+		}
+		if hash == (common.Hash{}) {
+			return fmt.Errorf("canonical hash of block %d not found", blockNum)
+		}
+		key := dbutils.BlockBodyKey(blockNum, hash)
+		body, err := tx.GetOne(kv.BlockBody, key)
+		if err != nil {
+			return err
+		}
+		if len(body) > 0 {
+			if err = coldTx.Put(kv.BlockBody, key, body); err != nil {
+				return err
+			}
+			baseTxId, txAmount, err := types.DecodeOnlyTxMetadataFromBody(body)
+			if err != nil {
+				return fmt.Errorf("body of block %d: %w", blockNum, err)
+			}
+			if err = tx.ForAmount(kv.EthTx, dbutils.EncodeBlockNumber(baseTxId), txAmount, put(kv.EthTx)); err != nil {
+				return err
+			}
+		}
+		receipts, err := tx.GetOne(kv.Receipts, dbutils.EncodeBlockNumber(blockNum))
+		if err != nil {
+			return err
+		}
+		if len(receipts) > 0 {
+			if err = coldTx.Put(kv.Receipts, dbutils.EncodeBlockNumber(blockNum), receipts); err != nil {
+				return err
+			}
+		}
+		if err = tx.ForPrefix(kv.Log, dbutils.EncodeBlockNumber(blockNum), put(kv.Log)); err != nil {
+			return err
+		}
+	}
+	if err = coldTx.Put(kv.DatabaseInfo, coldToKey, dbutils.EncodeBlockNumber(to)); err != nil {
+		return err
+	}
+	if err = coldTx.Commit(); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&m.cold.to, to)
+	return nil
+}
+
+// deleteRange - deletes bodies, transactions and receipts of canonical blocks [from, to) from chaindata
+func (m *Manager) deleteRange(ctx context.Context, from, to uint64) error {
+	return m.hot.Update(ctx, func(tx kv.RwTx) error {
+		for blockNum := from; blockNum < to; blockNum++ {
+			hash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+			if err != nil {
+				return err
+			}
+			key := dbutils.BlockBodyKey(blockNum, hash)
+			body, err := tx.GetOne(kv.BlockBody, key)
+			if err != nil {
+				return err
+			}
+			if len(body) > 0 {
+				baseTxId, txAmount, err := types.DecodeOnlyTxMetadataFromBody(body)
+				if err != nil {
+					return fmt.Errorf("body of block %d: %w", blockNum, err)
+				}
+				for id := baseTxId; id < baseTxId+uint64(txAmount); id++ {
+					if err = tx.Delete(kv.EthTx, dbutils.EncodeBlockNumber(id), nil); err != nil {
+						return err
+					}
+				}
+				if err = tx.Delete(kv.BlockBody, key, nil); err != nil {
+					return err
+				}
+			}
+			if err = rawdb.DeleteReceipts(tx, blockNum); err != nil {
+				return err
+			}
+		}
+		return tx.Put(kv.DatabaseInfo, hotFromKey, dbutils.EncodeBlockNumber(to))
+	})
+}
@@ -0,0 +1,120 @@
+package tiering
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/common/dbutils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoveAll(t *testing.T) {
+	ctx := context.Background()
+	hot := memdb.NewTestDB(t)
+	require.NoError(t, hot.Update(ctx, func(tx kv.RwTx) error {
+		for i := uint64(0); i < 50; i++ {
+			hash := common.Hash{byte(i + 1)}
+			if err := rawdb.WriteCanonicalHash(tx, hash, i); err != nil {
+				return err
+			}
+			txn := types.NewTransaction(i, common.Address{1}, uint256.NewInt(i), 21000, uint256.NewInt(1), nil)
+			if err := rawdb.WriteBody(tx, hash, i, &types.Body{Transactions: []types.Transaction{txn}}); err != nil {
+				return err
+			}
+			receipts := types.Receipts{{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: i, Logs: []*types.Log{{Address: common.Address{byte(i)}}}}}
+			if err := rawdb.WriteReceipts(tx, i, receipts); err != nil {
+				return err
+			}
+		}
+		return stages.SaveStageProgress(tx, stages.Finish, 49)
+	}))
+
+	coldDir := t.TempDir()
+	cold, err := Open(coldDir, hot, false)
+	require.NoError(t, err)
+	db := NewDB(hot, cold)
+	defer db.Close()
+	defer func(size uint64) { BatchSize = size }(BatchSize)
+	BatchSize = 7
+	m := NewManager(hot, cold, 10)
+	moved, err := m.MoveAll(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(39), moved)
+	require.Equal(t, uint64(39), cold.To())
+	moved, err = m.MoveAll(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), moved)
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		// moved blocks are absent in chaindata, recent ones stay there
+		has, err := tx.Has(kv.BlockBody, dbutils.BlockBodyKey(5, common.Hash{6}))
+		require.NoError(t, err)
+		require.False(t, has)
+		has, err = tx.Has(kv.BlockBody, dbutils.BlockBodyKey(45, common.Hash{46}))
+		require.NoError(t, err)
+		require.True(t, has)
+
+		for _, blockNum := range []uint64{5, 45} {
+			body := rawdb.ReadBodyWithTransactions(tx, common.Hash{byte(blockNum + 1)}, blockNum)
+			require.NotNil(t, body)
+			require.Len(t, body.Transactions, 1)
+			require.Equal(t, blockNum, body.Transactions[0].GetNonce())
+			receipts := rawdb.ReadRawReceipts(tx, blockNum)
+			require.Len(t, receipts, 1)
+			require.Equal(t, blockNum, receipts[0].CumulativeGasUsed)
+			require.Equal(t, common.Address{byte(blockNum)}, receipts[0].Logs[0].Address)
+			require.True(t, rawdb.HasReceipts(tx, common.Hash{}, blockNum))
+			var logs int
+			require.NoError(t, rawdb.ForEachLog(tx, blockNum, func(k, v []byte) error {
+				logs++
+				return nil
+			}))
+			require.Equal(t, 1, logs)
+		}
+		from, err := rawdb.ReceiptsAvailableFrom(tx)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), from)
+
+		// all reads of moved blocks are in one transaction of cold database
+		coldTx, err := tx.(rawdb.ColdTx).ColdTx(5)
+		require.NoError(t, err)
+		again, err := tx.(rawdb.ColdTx).ColdTx(20)
+		require.NoError(t, err)
+		require.Equal(t, coldTx, again)
+		recent, err := tx.(rawdb.ColdTx).ColdTx(45)
+		require.NoError(t, err)
+		require.Nil(t, recent)
+		return nil
+	}))
+	// without cold database moved blocks are absent
+	require.NoError(t, hot.View(ctx, func(tx kv.Tx) error {
+		require.Nil(t, rawdb.ReadRawReceipts(tx, 5))
+		return nil
+	}))
+}
+
+func TestOpenOtherChain(t *testing.T) {
+	genesis := func(hash common.Hash) kv.RwDB {
+		db := memdb.NewTestDB(t)
+		require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+			return rawdb.WriteCanonicalHash(tx, hash, 0)
+		}))
+		return db
+	}
+	dir := t.TempDir()
+	cold, err := Open(dir, genesis(common.Hash{1}), false)
+	require.NoError(t, err)
+	cold.Close()
+	cold, err = Open(dir, genesis(common.Hash{1}), true)
+	require.NoError(t, err)
+	cold.Close()
+	_, err = Open(dir, genesis(common.Hash{2}), false)
+	require.Error(t, err)
+}
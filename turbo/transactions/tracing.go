@@ -3,6 +3,7 @@ package transactions
 import (
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
@@ -19,6 +20,7 @@ import (
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/core/vm"
 	"github.com/ledgerwatch/erigon/eth/tracers"
+	"github.com/ledgerwatch/erigon/eth/tracers/zktrace"
 	"github.com/ledgerwatch/erigon/params"
 )
 
@@ -31,9 +33,9 @@ type BlockGetter interface {
 }
 
 // computeTxEnv returns the execution environment of a certain transaction.
-func ComputeTxEnv(ctx context.Context, block *types.Block, cfg *params.ChainConfig, getHeader func(hash common.Hash, number uint64) *types.Header, contractHasTEVM func(common.Hash) (bool, error), engine consensus.Engine, dbtx kv.Tx, blockHash common.Hash, txIndex uint64) (core.Message, vm.BlockContext, vm.TxContext, *state.IntraBlockState, *state.PlainState, error) {
+func ComputeTxEnv(ctx context.Context, block *types.Block, cfg *params.ChainConfig, getHeader func(hash common.Hash, number uint64) *types.Header, contractHasTEVM func(common.Hash) (bool, error), engine consensus.Engine, dbtx kv.Tx, history state.HistorySnapshots, blockHash common.Hash, txIndex uint64) (core.Message, vm.BlockContext, vm.TxContext, *state.IntraBlockState, *state.PlainState, error) {
 	// Create the parent state database
-	reader := state.NewPlainState(dbtx, block.NumberU64()-1)
+	reader := state.NewPlainState(dbtx, block.NumberU64()-1, history)
 	statedb := state.New(reader)
 
 	if txIndex == 0 && len(block.Transactions()) == 0 {
@@ -75,6 +77,11 @@ func ComputeTxEnv(ctx context.Context, block *types.Block, cfg *params.ChainConf
 	return nil, vm.BlockContext{}, vm.TxContext{}, nil, nil, fmt.Errorf("transaction index %d out of range for block %x", txIndex, blockHash)
 }
 
+// resultTracer - tracer which produces its output after execution, instead of streaming it
+type resultTracer interface {
+	GetResult() (json.RawMessage, error)
+}
+
 // TraceTx configures a new tracer according to the provided configuration, and
 // executes the given message in the provided environment. The return value will
 // be tracer dependent.
@@ -95,6 +102,10 @@ func TraceTx(
 	)
 	var streaming bool
 	switch {
+	case config != nil && config.Tracer != nil && *config.Tracer == tracers.OpcodeProfilerName:
+		tracer = tracers.NewOpcodeProfiler()
+		streaming = false
+
 	case config != nil && config.Tracer != nil:
 		// Define a meaningful timeout of a single transaction trace
 		timeout := callTimeout
@@ -167,7 +178,7 @@ func TraceTx(
 		stream.WriteString(returnVal)
 		stream.WriteObjectEnd()
 	} else {
-		if r, err1 := tracer.(*tracers.Tracer).GetResult(); err1 == nil {
+		if r, err1 := tracer.(resultTracer).GetResult(); err1 == nil {
 			stream.Write(r)
 		} else {
 			return err1
@@ -176,6 +187,92 @@ func TraceTx(
 	return nil
 }
 
+// TraceBlock traces transactions of the block one after another, ibs is the state before the block. Writes array
+// of traces of transactions, same as TraceTx, except for the opcode profiler, which produces one summary of the block.
+func TraceBlock(
+	ctx context.Context,
+	block *types.Block,
+	blockCtx vm.BlockContext,
+	ibs *state.IntraBlockState,
+	config *tracers.TraceConfig,
+	chainConfig *params.ChainConfig,
+	stream *jsoniter.Stream,
+) error {
+	if config != nil && config.Tracer != nil && *config.Tracer == tracers.OpcodeProfilerName {
+		profiler := tracers.NewOpcodeProfiler()
+		if err := ProfileBlock(ctx, block, blockCtx, ibs, profiler, chainConfig); err != nil {
+			stream.WriteNil()
+			return err
+		}
+		r, err := profiler.GetResult()
+		if err != nil {
+			stream.WriteNil()
+			return err
+		}
+		stream.Write(r)
+		return nil
+	}
+
+	signer := types.MakeSigner(chainConfig, block.NumberU64())
+	rules := chainConfig.Rules(block.NumberU64())
+	stream.WriteArrayStart()
+	for idx, txn := range block.Transactions() {
+		ibs.Prepare(txn.Hash(), block.Hash(), idx)
+		msg, err := txn.AsMessage(*signer, block.BaseFee())
+		if err != nil {
+			stream.WriteArrayEnd()
+			return fmt.Errorf("transaction %x: %w", txn.Hash(), err)
+		}
+		txCtx := core.NewEVMTxContext(msg)
+		txCtx.TxHash = txn.Hash()
+		if idx > 0 {
+			stream.WriteMore()
+		}
+		stream.WriteObjectStart()
+		stream.WriteObjectField("result")
+		err = TraceTx(ctx, msg, blockCtx, txCtx, ibs, config, chainConfig, stream)
+		stream.WriteObjectEnd()
+		if err != nil {
+			stream.WriteArrayEnd()
+			return fmt.Errorf("transaction %x: %w", txn.Hash(), err)
+		}
+		if err = ibs.FinalizeTx(rules, state.NewNoopWriter()); err != nil {
+			stream.WriteArrayEnd()
+			return err
+		}
+	}
+	stream.WriteArrayEnd()
+	return nil
+}
+
+// ProfileBlock executes transactions of the block with the profiler, ibs is the state before the block.
+// The profiler accumulates results, so it can be used for several blocks.
+func ProfileBlock(ctx context.Context, block *types.Block, blockCtx vm.BlockContext, ibs *state.IntraBlockState, profiler *tracers.OpcodeProfiler, chainConfig *params.ChainConfig) error {
+	signer := types.MakeSigner(chainConfig, block.NumberU64())
+	rules := chainConfig.Rules(block.NumberU64())
+	vmenv := vm.NewEVM(blockCtx, vm.TxContext{}, ibs, chainConfig, vm.Config{Debug: true, Tracer: profiler})
+	for idx, txn := range block.Transactions() {
+		select {
+		default:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		ibs.Prepare(txn.Hash(), block.Hash(), idx)
+		msg, err := txn.AsMessage(*signer, block.BaseFee())
+		if err != nil {
+			return fmt.Errorf("transaction %x: %w", txn.Hash(), err)
+		}
+		vmenv.Reset(core.NewEVMTxContext(msg), ibs)
+		if _, err = core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas()), true /* refunds */, false /* gasBailout */); err != nil {
+			return fmt.Errorf("transaction %x failed: %w", txn.Hash(), err)
+		}
+		if err = ibs.FinalizeTx(rules, state.NewNoopWriter()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // StructLogger is an EVM state logger and implements Tracer.
 //
 // StructLogger can capture state based on the given Log configuration and also keeps
@@ -359,3 +456,48 @@ func (l *JsonStreamLogger) CaptureAccountRead(account common.Address) error {
 func (l *JsonStreamLogger) CaptureAccountWrite(account common.Address) error {
 	return nil
 }
+
+// ZkTraceBlock executes transactions of the block with zktrace.Tracer, ibs is the state before the block
+func ZkTraceBlock(ctx context.Context, block *types.Block, blockCtx vm.BlockContext, ibs *state.IntraBlockState, chainConfig *params.ChainConfig) (*zktrace.Block, error) {
+	signer := types.MakeSigner(chainConfig, block.NumberU64())
+	rules := chainConfig.Rules(block.NumberU64())
+	tracer := zktrace.NewTracer()
+	vmenv := vm.NewEVM(blockCtx, vm.TxContext{}, ibs, chainConfig, vm.Config{Debug: true, Tracer: tracer})
+	result := &zktrace.Block{
+		Number:       block.NumberU64(),
+		Hash:         block.Hash(),
+		ParentHash:   block.ParentHash(),
+		Transactions: make([]*zktrace.Transaction, 0, len(block.Transactions())),
+	}
+	for idx, txn := range block.Transactions() {
+		select {
+		default:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		ibs.Prepare(txn.Hash(), block.Hash(), idx)
+		msg, err := txn.AsMessage(*signer, block.BaseFee())
+		if err != nil {
+			return nil, fmt.Errorf("transaction %x: %w", txn.Hash(), err)
+		}
+		tracer.Reset()
+		vmenv.Reset(core.NewEVMTxContext(msg), ibs)
+		res, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas()), true /* refunds */, false /* gasBailout */)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %x failed: %w", txn.Hash(), err)
+		}
+		if err = ibs.FinalizeTx(rules, state.NewNoopWriter()); err != nil {
+			return nil, err
+		}
+		result.Transactions = append(result.Transactions, &zktrace.Transaction{
+			Hash:    txn.Hash(),
+			Index:   uint32(idx),
+			From:    msg.From(),
+			To:      msg.To(),
+			GasUsed: res.UsedGas,
+			Failed:  res.Failed(),
+			Steps:   tracer.Steps(),
+		})
+	}
+	return result, nil
+}
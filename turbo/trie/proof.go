@@ -5,6 +5,8 @@ import (
 	"fmt"
 
 	"github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/rlp"
 )
 
 // Prove constructs a merkle proof for key. The result contains all encoded nodes
@@ -95,3 +97,111 @@ func (t *Trie) Prove(key []byte, fromLevel int, storage bool) ([][]byte, error)
 	}
 	return proof, nil
 }
+
+// VerifyProof checks merkle proof of key (as returned by Prove with fromLevel 0) against root and returns the value
+// stored at key, nil if proof proves absence of the key. For storage proofs key is hash of storage slot and root is
+// storage root of the account.
+func VerifyProof(root common.Hash, key []byte, proof [][]byte) ([]byte, error) {
+	hex := keybytesToHex(key)
+	hex = hex[:len(hex)-1] // Remove terminator
+	ref := root[:]         // hash of next node, or the node itself if it's embedded into parent
+	if root == EmptyRoot {
+		if len(proof) > 0 {
+			return nil, fmt.Errorf("proof of empty trie must be empty, got %d nodes", len(proof))
+		}
+		return nil, nil
+	}
+	for i, enc := range proof {
+		if len(ref) == common.HashLength {
+			if !bytes.Equal(crypto.Keccak256(enc), ref) {
+				return nil, fmt.Errorf("proof node %d: hash mismatch", i)
+			}
+		} else if !bytes.Equal(enc, ref) {
+			return nil, fmt.Errorf("proof node %d: embedded node mismatch", i)
+		}
+		elems, _, err := rlp.SplitList(enc)
+		if err != nil {
+			return nil, fmt.Errorf("proof node %d: %w", i, err)
+		}
+		n, err := rlp.CountValues(elems)
+		if err != nil {
+			return nil, fmt.Errorf("proof node %d: %w", i, err)
+		}
+		var child []byte
+		switch n {
+		case 2:
+			compactKey, rest, err := rlp.SplitString(elems)
+			if err != nil {
+				return nil, fmt.Errorf("proof node %d: %w", i, err)
+			}
+			nodeKey := compactToHex(compactKey)
+			isLeaf := len(nodeKey) > 0 && nodeKey[len(nodeKey)-1] == 16
+			if isLeaf {
+				nodeKey = nodeKey[:len(nodeKey)-1]
+			}
+			if len(hex) < len(nodeKey) || !bytes.Equal(nodeKey, hex[:len(nodeKey)]) {
+				return nil, checkProofEnd(proof, i)
+			}
+			hex = hex[len(nodeKey):]
+			if isLeaf {
+				if len(hex) != 0 {
+					return nil, checkProofEnd(proof, i)
+				}
+				value, _, err := rlp.SplitString(rest)
+				if err != nil {
+					return nil, fmt.Errorf("proof node %d: %w", i, err)
+				}
+				return value, checkProofEnd(proof, i)
+			}
+			if child, err = childRef(rest); err != nil {
+				return nil, fmt.Errorf("proof node %d: %w", i, err)
+			}
+		case 17:
+			if len(hex) == 0 {
+				return nil, fmt.Errorf("proof node %d: key is shorter than path", i)
+			}
+			rest := elems
+			for j := byte(0); j < hex[0]; j++ {
+				if _, _, rest, err = rlp.Split(rest); err != nil {
+					return nil, fmt.Errorf("proof node %d: %w", i, err)
+				}
+			}
+			if child, err = childRef(rest); err != nil {
+				return nil, fmt.Errorf("proof node %d: %w", i, err)
+			}
+			hex = hex[1:]
+		default:
+			return nil, fmt.Errorf("proof node %d: invalid number of elements %d", i, n)
+		}
+		if child == nil {
+			return nil, checkProofEnd(proof, i)
+		}
+		ref = child
+	}
+	return nil, fmt.Errorf("proof is incomplete")
+}
+
+// childRef - reference to child node from first element of b: hash, embedded node or nil if there is no child
+func childRef(b []byte) ([]byte, error) {
+	kind, content, rest, err := rlp.Split(b)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case kind == rlp.List:
+		return b[:len(b)-len(rest)], nil
+	case len(content) == 0:
+		return nil, nil
+	case len(content) == common.HashLength:
+		return content, nil
+	default:
+		return nil, fmt.Errorf("invalid child reference of length %d", len(content))
+	}
+}
+
+func checkProofEnd(proof [][]byte, i int) error {
+	if i != len(proof)-1 {
+		return fmt.Errorf("proof has %d extra nodes after the end of the path", len(proof)-1-i)
+	}
+	return nil
+}
@@ -122,6 +122,10 @@ type RootHashAggregator struct {
 	a              accounts.Account
 	leafData       GenStructStepLeafData
 	accData        GenStructStepAccountData
+
+	retain    RetainDecider // nil - only hashes are calculated, otherwise nodes on the paths to retained keys are constructed
+	retainBuf []byte
+	rootNode  node
 }
 
 type StreamReceiver interface {
@@ -173,6 +177,23 @@ func (l *FlatDBTrieLoader) SetStreamReceiver(receiver StreamReceiver) {
 	l.receiver = receiver
 }
 
+// RetainNodes - makes next CalcTrieRoot construct trie nodes on the paths to keys retained by rd (in addition to
+// root hash), they can be used to build merkle proofs. rd must retain subset of keys retained by RetainDecider
+// passed to Reset - otherwise nodes are hashes taken from AccTrie/StorageTrie. Must be called after Reset.
+func (l *FlatDBTrieLoader) RetainNodes(rd RetainDecider) {
+	l.defaultReceiver.retain = rd
+}
+
+// RetainedTrie - trie built by last CalcTrieRoot, which must be preceded by RetainNodes call.
+// Nodes which are not on the paths to retained keys are hash nodes.
+func (l *FlatDBTrieLoader) RetainedTrie() *Trie {
+	t := New(l.defaultReceiver.root)
+	if l.defaultReceiver.rootNode != nil {
+		t.root = l.defaultReceiver.rootNode
+	}
+	return t
+}
+
 // CalcTrieRoot algo:
 //	for iterateIHOfAccounts {
 //		if canSkipState
@@ -323,6 +344,21 @@ func (l *FlatDBTrieLoader) logProgress(accountKey, ihK []byte) {
 	log.Info(fmt.Sprintf("[%s] Calculating Merkle root", l.logPrefix), "current key", k)
 }
 
+// retainAccount - decides if trie node with given prefix of account key (in nibbles) must be constructed
+func (r *RootHashAggregator) retainAccount(prefix []byte) bool {
+	return r.retain != nil && r.retain.Retain(prefix)
+}
+
+// retainStorage - same as retainAccount, but prefix is prefix of storage key of current account
+func (r *RootHashAggregator) retainStorage(prefix []byte) bool {
+	if r.retain == nil {
+		return false
+	}
+	hexutil.DecompressNibbles(r.currAccK, &r.retainBuf)
+	r.retainBuf = append(r.retainBuf, prefix...)
+	return r.retain.Retain(r.retainBuf)
+}
+
 func (r *RootHashAggregator) RetainNothing(_ []byte) bool {
 	return false
 }
@@ -344,6 +380,8 @@ func (r *RootHashAggregator) Reset(hc HashCollector2, shc StorageHashCollector2,
 	r.valueStorage = nil
 	r.wasIHStorage = false
 	r.root = common.Hash{}
+	r.retain = nil
+	r.rootNode = nil
 	r.trace = trace
 	r.hb.trace = trace
 }
@@ -493,6 +531,9 @@ func (r *RootHashAggregator) Receive(itemType StreamItem,
 		}
 		if r.hb.hasRoot() {
 			r.root = r.hb.rootHash()
+			if r.retain != nil {
+				r.rootNode = r.hb.root()
+			}
 		} else {
 			r.root = EmptyRoot
 		}
@@ -563,7 +604,7 @@ func (r *RootHashAggregator) genStructStorage() error {
 		r.leafData.Value = rlphacks.RlpSerializableBytes(r.valueStorage)
 		data = &r.leafData
 	}
-	r.groupsStorage, r.hasTreeStorage, r.hasHashStorage, err = GenStructStep(r.RetainNothing, r.currStorage.Bytes(), r.succStorage.Bytes(), r.hb, func(keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
+	r.groupsStorage, r.hasTreeStorage, r.hasHashStorage, err = GenStructStep(r.retainStorage, r.currStorage.Bytes(), r.succStorage.Bytes(), r.hb, func(keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
 		if r.shc == nil {
 			return nil
 		}
@@ -631,7 +672,7 @@ func (r *RootHashAggregator) genStructAccount() error {
 	r.currStorage.Reset()
 	r.succStorage.Reset()
 	var err error
-	if r.groups, r.hasTree, r.hasHash, err = GenStructStep(r.RetainNothing, r.curr.Bytes(), r.succ.Bytes(), r.hb, func(keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
+	if r.groups, r.hasTree, r.hasHash, err = GenStructStep(r.retainAccount, r.curr.Bytes(), r.succ.Bytes(), r.hb, func(keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
 		if r.hc == nil {
 			return nil
 		}